@@ -8,6 +8,8 @@ const (
 	pluginName    = "azure-ipam"
 	cnsBaseURL    = "" // fallback to default http://localhost:10090
 	cnsReqTimeout = 15 * time.Second
+	// linkScope is RT_SCOPE_LINK, the scope of the on link route of the gateway
+	linkScope = 253
 )
 
 // plugin specific error codes
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 
 	"github.com/Azure/azure-container-networking/azure-ipam/internal/buildinfo"
 	"github.com/Azure/azure-container-networking/azure-ipam/ipconfig"
@@ -115,7 +116,7 @@ func (p *IPAMPlugin) CmdAdd(args *cniSkel.CmdArgs) error {
 	p.logger.Debug("Received CNS IP config response", zap.Any("response", resp))
 
 	// Get Pod IP and gateway IP from ip config response
-	podIPNet, err := ipconfig.ProcessIPConfigsResp(resp)
+	podIPNet, gatewayIPs, err := ipconfig.ProcessIPConfigsResp(resp)
 	if err != nil {
 		p.logger.Error("Failed to interpret CNS IPConfigResponse", zap.Error(err), zap.Any("response", resp))
 		return cniTypes.NewError(ErrProcessIPConfigResponse, err.Error(), "failed to interpret CNS IPConfigResponse")
@@ -136,6 +137,11 @@ func (p *IPAMPlugin) CmdAdd(args *cniSkel.CmdArgs) error {
 				Mask: net.CIDRMask(ipNet.Bits(), 128), // nolint
 			}
 		}
+		// a /32 or /128 pod ip has no subnet the gateway is in, the gateway is routed on link explicitly
+		if ipNet.IsSingleIP() && gatewayIPs[i].IsValid() {
+			ipConfig.Gateway = net.IP(gatewayIPs[i].AsSlice())
+			cniResult.Routes = append(cniResult.Routes, gatewayRoutes(gatewayIPs[i])...)
+		}
 		cniResult.IPs[i] = ipConfig
 	}
 
@@ -242,3 +248,23 @@ func parseNetConf(b []byte) (*cniTypes.NetConf, error) {
 
 	return netConf, nil
 }
+
+// gatewayRoutes returns the on link route of the gateway of a host prefix, and the default route through it.
+func gatewayRoutes(gateway netip.Addr) []*cniTypes.Route {
+	scope := linkScope
+	gatewayIP := net.IP(gateway.AsSlice())
+	defaultDst := net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)} // nolint
+	if gateway.Is6() {
+		defaultDst = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)} // nolint
+	}
+	return []*cniTypes.Route{
+		{
+			Dst:   net.IPNet{IP: gatewayIP, Mask: net.CIDRMask(gateway.BitLen(), gateway.BitLen())},
+			Scope: &scope,
+		},
+		{
+			Dst: defaultDst,
+			GW:  gatewayIP,
+		},
+	}
+}
@@ -22,6 +22,7 @@ var (
 	errFoo                           = errors.New("err")
 	errUnsupportedAPI                = errors.New("Unsupported API")
 	loggerCfg         *logger.Config = &logger.Config{}
+	linkScopeValue                   = linkScope
 )
 
 // MOckCNSClient is a mock implementation of the CNSClient interface
@@ -97,6 +98,38 @@ func (c *MockCNSClient) RequestIPs(ctx context.Context, ipconfig cns.IPConfigsRe
 		e.Code = types.UnsupportedAPI
 		e.Err = errUnsupportedAPI
 		return nil, e
+	case "happyArgsHostPrefix":
+		result := &cns.IPConfigsResponse{
+			PodIPInfo: []cns.PodIpInfo{
+				{
+					PodIPConfig: cns.IPSubnet{
+						IPAddress:    "10.0.1.10",
+						PrefixLength: 32,
+					},
+					NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+						IPSubnet: cns.IPSubnet{
+							IPAddress:    "10.0.1.10",
+							PrefixLength: 32,
+						},
+						GatewayIPAddress: "10.0.0.1",
+					},
+				},
+				{
+					PodIPConfig: cns.IPSubnet{
+						IPAddress:    "fd11:1234::1",
+						PrefixLength: 128,
+					},
+					NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+						IPSubnet: cns.IPSubnet{
+							IPAddress:    "fd11:1234::1",
+							PrefixLength: 128,
+						},
+						GatewayIPAddress: "fe80::1234:5678:9abc",
+					},
+				},
+			},
+		}
+		return result, nil
 	case "failProcessCNSResp":
 		result := &cns.IPConfigsResponse{
 			PodIPInfo: []cns.PodIpInfo{
@@ -316,6 +349,37 @@ func TestCmdAdd(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Happy CNI add host prefixes",
+			args: buildArgs("happyArgsHostPrefix", happyPodArgs, happyNetConfByteArr),
+			want: &types100.Result{
+				CNIVersion: "1.0.0",
+				IPs: []*types100.IPConfig{
+					{
+						Address: net.IPNet{
+							IP:   net.IPv4(10, 0, 1, 10),
+							Mask: net.CIDRMask(32, 32),
+						},
+						Gateway: net.IPv4(10, 0, 0, 1),
+					},
+					{
+						Address: net.IPNet{
+							IP:   net.ParseIP("fd11:1234::1"),
+							Mask: net.CIDRMask(128, 128),
+						},
+						Gateway: net.ParseIP("fe80::1234:5678:9abc"),
+					},
+				},
+				Routes: []*cniTypes.Route{
+					{Dst: net.IPNet{IP: net.IPv4(10, 0, 0, 1), Mask: net.CIDRMask(32, 32)}, Scope: &linkScopeValue},
+					{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, GW: net.IPv4(10, 0, 0, 1)},
+					{Dst: net.IPNet{IP: net.ParseIP("fe80::1234:5678:9abc"), Mask: net.CIDRMask(128, 128)}, Scope: &linkScopeValue},
+					{Dst: net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}, GW: net.ParseIP("fe80::1234:5678:9abc")},
+				},
+				DNS: cniTypes.DNS{},
+			},
+			wantErr: false,
+		},
 		{
 			name:    "Fail request CNS ipconfig during CmdAdd",
 			args:    buildArgs("failRequestCNSArgs", happyPodArgs, happyNetConfByteArr),
@@ -63,8 +63,11 @@ func CreateIPConfigsReq(args *cniSkel.CmdArgs) (cns.IPConfigsRequest, error) {
 	return req, nil
 }
 
-func ProcessIPConfigsResp(resp *cns.IPConfigsResponse) (*[]netip.Prefix, error) {
+// ProcessIPConfigsResp returns the pod ip prefixes of the response, and the gateways of their ncs. A gateway is not
+// valid if cns returned none.
+func ProcessIPConfigsResp(resp *cns.IPConfigsResponse) (*[]netip.Prefix, []netip.Addr, error) {
 	podIPNets := make([]netip.Prefix, len(resp.PodIPInfo))
+	gatewayIPs := make([]netip.Addr, len(resp.PodIPInfo))
 
 	for i := range resp.PodIPInfo {
 		podCIDR := fmt.Sprintf(
@@ -74,12 +77,20 @@ func ProcessIPConfigsResp(resp *cns.IPConfigsResponse) (*[]netip.Prefix, error)
 		)
 		podIPNet, err := netip.ParsePrefix(podCIDR)
 		if err != nil {
-			return nil, errors.Wrapf(err, "cns returned invalid pod CIDR %q", podCIDR)
+			return nil, nil, errors.Wrapf(err, "cns returned invalid pod CIDR %q", podCIDR)
 		}
 		podIPNets[i] = podIPNet
+
+		if gateway := resp.PodIPInfo[i].NetworkContainerPrimaryIPConfig.GatewayIPAddress; gateway != "" {
+			gatewayIP, err := netip.ParseAddr(gateway)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "cns returned invalid gateway %q", gateway)
+			}
+			gatewayIPs[i] = gatewayIP
+		}
 	}
 
-	return &podIPNets, nil
+	return &podIPNets, gatewayIPs, nil
 }
 
 type k8sPodEnvArgs struct {
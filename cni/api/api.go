@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net"
 	"os"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cni/log"
 	"go.uber.org/zap"
@@ -17,6 +18,39 @@ type PodNetworkInterfaceInfo struct {
 	PodEndpointId string
 	ContainerID   string
 	IPAddresses   []net.IPNet
+	// FlowLogs is set for the endpoints whose flows cns serves
+	FlowLogs bool `json:",omitempty"`
+	// History is the last operations which programmed the endpoint, oldest first
+	History []EndpointOperation `json:",omitempty"`
+	// Traffic is the traffic counters of the endpoint, only dumped with them
+	Traffic *EndpointTraffic `json:",omitempty"`
+	// OperState is the state of the dataplane of the endpoint, dumped with the traffic counters
+	OperState *EndpointOperState `json:",omitempty"`
+}
+
+// EndpointOperState is the state of the interface of an endpoint on the host, see network.EndpointOperState.
+type EndpointOperState struct {
+	Up         bool
+	Carrier    bool     `json:",omitempty"`
+	MissingIPs []string `json:",omitempty"`
+	Error      string   `json:",omitempty"`
+}
+
+// EndpointTraffic is the traffic counters of an endpoint, from the pod's point of view.
+type EndpointTraffic struct {
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	RxDropped uint64
+	TxDropped uint64
+}
+
+type EndpointOperation struct {
+	Operation string
+	Timestamp time.Time
+	Duration  time.Duration
+	Error     string `json:",omitempty"`
 }
 
 type AzureCNIState struct {
@@ -38,3 +72,32 @@ func (a *AzureCNIState) PrintResult() error {
 
 	return nil
 }
+
+// DatapathMigrationRequest asks for a batch of endpoints to be migrated to a datapath generation.
+type DatapathMigrationRequest struct {
+	// Generation is the generation to migrate to, a negative generation selects the latest
+	Generation int
+	// After is the Last of the previous batch, empty for the first batch
+	After     string
+	BatchSize int
+}
+
+// DatapathMigrationProgress reports the endpoints a batch of a datapath migration went through.
+type DatapathMigrationProgress struct {
+	Generation int
+	Migrated   int
+	Failed     int
+	Remaining  int
+	Last       string
+}
+
+func (p *DatapathMigrationProgress) PrintResult() error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err //nolint:wrapcheck // logged by the caller
+	}
+
+	// write result to stdout to be captured by caller
+	_, err = os.Stdout.Write(b)
+	return err //nolint:wrapcheck // logged by the caller
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -29,10 +30,25 @@ func New(exec utilexec.Interface) *client {
 }
 
 func (c *client) GetEndpointState() (*api.AzureCNIState, error) {
+	return c.getEndpointState(cni.CmdGetEndpointsState)
+}
+
+// GetEndpointStats returns the state of the endpoints with their traffic counters.
+func (c *client) GetEndpointStats() (*api.AzureCNIState, error) {
+	return c.getEndpointState(cni.CmdGetEndpointsStats)
+}
+
+// RecoverEndpointState returns the state of the endpoints, which the cni rebuilds from the endpoints found in the
+// dataplane first when its state is missing or can't be read.
+func (c *client) RecoverEndpointState() (*api.AzureCNIState, error) {
+	return c.getEndpointState(cni.CmdRecoverEndpointState)
+}
+
+func (c *client) getEndpointState(command string) (*api.AzureCNIState, error) {
 	cmd := c.exec.Command(platform.CNIBinaryPath)
 	cmd.SetDir(CNIExecDir)
 	envs := os.Environ()
-	cmdenv := fmt.Sprintf("%s=%s", cni.Cmd, cni.CmdGetEndpointsState)
+	cmdenv := fmt.Sprintf("%s=%s", cni.Cmd, command)
 	logger.Info("Setting cmd to", zap.String("cmdenv", cmdenv))
 	envs = append(envs, cmdenv)
 	cmd.SetEnv(envs)
@@ -50,6 +66,51 @@ func (c *client) GetEndpointState() (*api.AzureCNIState, error) {
 	return state, nil
 }
 
+// ReattachHnsEndpoints has the cni create again the hcn endpoints hns lost, on windows.
+func (c *client) ReattachHnsEndpoints() error {
+	cmd := c.exec.Command(platform.CNIBinaryPath)
+	cmd.SetDir(CNIExecDir)
+	envs := os.Environ()
+	cmdenv := fmt.Sprintf("%s=%s", cni.Cmd, cni.CmdReattachHnsEndpoints)
+	logger.Info("Setting cmd to", zap.String("cmdenv", cmdenv))
+	envs = append(envs, cmdenv)
+	cmd.SetEnv(envs)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to call Azure CNI bin with err: [%w], output: [%s]", err, string(output))
+	}
+	return nil
+}
+
+// MigrateDatapath has the cni migrate a batch of endpoints to a datapath generation.
+func (c *client) MigrateDatapath(req api.DatapathMigrationRequest) (*api.DatapathMigrationProgress, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode datapath migration request")
+	}
+
+	cmd := c.exec.Command(platform.CNIBinaryPath)
+	cmd.SetDir(CNIExecDir)
+	envs := os.Environ()
+	cmdenv := fmt.Sprintf("%s=%s", cni.Cmd, cni.CmdMigrateDatapath)
+	logger.Info("Setting cmd to", zap.String("cmdenv", cmdenv))
+	envs = append(envs, cmdenv)
+	cmd.SetEnv(envs)
+	cmd.SetStdin(bytes.NewReader(b))
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Azure CNI bin with err: [%w], output: [%s]", err, string(output))
+	}
+
+	progress := &api.DatapathMigrationProgress{}
+	if err := json.Unmarshal(output, progress); err != nil {
+		return nil, fmt.Errorf("failed to decode response from Azure CNI when migrating datapath: [%w], response from CNI: [%s]", err, string(output))
+	}
+
+	return progress, nil
+}
+
 func (c *client) GetVersion() (*semver.Version, error) {
 	cmd := c.exec.Command(platform.CNIBinaryPath, "-v")
 	cmd.SetDir(CNIExecDir)
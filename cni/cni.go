@@ -20,10 +20,26 @@ const (
 	CmdUpdate = "UPDATE"
 	// CmdVersion - CNI VERSION command.
 	CmdVersion = "VERSION"
+	// CmdStatus - CNI STATUS command.
+	CmdStatus = "STATUS"
 
 	// nonstandard CNI spec command, used to dump CNI state to stdout
 	CmdGetEndpointsState = "GET_ENDPOINT_STATE"
 
+	// nonstandard CNI spec command, used by cns to dump CNI state with the traffic counters of the endpoints to stdout
+	CmdGetEndpointsStats = "GET_ENDPOINT_STATS"
+
+	// nonstandard CNI spec command, used by cns to have the hcn endpoints hns lost created again, windows only
+	CmdReattachHnsEndpoints = "REATTACH_HNS_ENDPOINTS"
+
+	// nonstandard CNI spec command, used by cns to migrate a batch of endpoints to a datapath generation. The request
+	// is read from stdin and the progress written to stdout.
+	CmdMigrateDatapath = "MIGRATE_DATAPATH"
+
+	// nonstandard CNI spec command, used by cns to dump CNI state to stdout, rebuilding it from the endpoints found in
+	// the dataplane first when the state is missing or can't be read
+	CmdRecoverEndpointState = "RECOVER_ENDPOINT_STATE"
+
 	// CNI errors.
 	ErrRuntime = 100
 
@@ -32,7 +48,7 @@ const (
 )
 
 // Supported CNI versions.
-var supportedVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0", "1.0.0"}
+var supportedVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0", "1.0.0", "1.1.0"}
 
 // CNI contract.
 type PluginApi interface {
@@ -41,3 +57,10 @@ type PluginApi interface {
 	Delete(args *cniSkel.CmdArgs) error
 	Update(args *cniSkel.CmdArgs) error
 }
+
+// StatusApi is implemented by the plugins which report whether they can service ADDs, so the runtime can stop
+// scheduling pods on the node rather than have them fail one by one. The runtime only sends STATUS with a network
+// config of version 1.1.0 or later, the plugins without it always report they are available.
+type StatusApi interface {
+	Status(args *cniSkel.CmdArgs) error
+}
@@ -0,0 +1,80 @@
+package cni
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Error codes of the CNI spec for STATUS.
+const (
+	// ErrPluginNotAvailable is returned by STATUS when the plugin can't service ADDs.
+	ErrPluginNotAvailable uint = 50
+)
+
+// Error codes of the failures of the plugin, from the range the CNI spec leaves to the plugins. They tell the runtime
+// and the fleet telemetry what failed without parsing the message of the error.
+const (
+	// ErrIPAMExhausted is returned when the pool of the node has no ip left for the pod.
+	ErrIPAMExhausted uint = 101
+	// ErrCNSUnreachable is returned when the plugin can't connect to CNS.
+	ErrCNSUnreachable uint = 102
+	// ErrHNSFailure is returned when HNS fails to program the network or the endpoint of the pod.
+	ErrHNSFailure uint = 103
+	// ErrNetNsGone is returned when the network namespace of the pod was deleted before the command completed.
+	ErrNetNsGone uint = 104
+)
+
+// errorCodes are the names and whether the runtime should retry the command of the error codes of the plugin, and of
+// the CNI error codes it returns.
+var errorCodes = map[uint]struct {
+	name      string
+	retryable bool
+}{
+	cniTypes.ErrTryAgainLater: {name: "TryAgainLater", retryable: true},
+	ErrPluginNotAvailable:     {name: "PluginNotAvailable", retryable: true},
+	ErrRuntime:                {name: "Runtime"},
+	ErrIPAMExhausted:          {name: "IPAMExhausted", retryable: true},
+	ErrCNSUnreachable:         {name: "CNSUnreachable", retryable: true},
+	ErrHNSFailure:             {name: "HNSFailure", retryable: true},
+	ErrNetNsGone:              {name: "NetNsGone"},
+}
+
+// ErrorCodeName returns the name of the error code the telemetry reports, the code itself when it isn't one of the
+// plugin.
+func ErrorCodeName(code uint) string {
+	if errorCode, ok := errorCodes[code]; ok {
+		return errorCode.name
+	}
+	return strconv.FormatUint(uint64(code), 10)
+}
+
+// IsRetryable returns whether a command which failed with the error code can succeed when retried. The failures which
+// are not retryable, like a netns which is gone, fail again until the pod is recreated.
+func IsRetryable(code uint) bool {
+	return errorCodes[code].retryable
+}
+
+// ErrorResult is the CNI error result the plugin prints, which tells the runtime whether it should retry the command.
+type ErrorResult struct {
+	*cniTypes.Error
+	Retryable bool `json:"retryable"`
+}
+
+// NewErrorResult returns the error result of the CNI error.
+func NewErrorResult(cniErr *cniTypes.Error) *ErrorResult {
+	return &ErrorResult{Error: cniErr, Retryable: IsRetryable(cniErr.Code)}
+}
+
+// Print prints the error result to stdout.
+func (r *ErrorResult) Print() error {
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal error result")
+	}
+	_, err = os.Stdout.Write(data)
+	return errors.Wrap(err, "failed to print error result")
+}
@@ -5,14 +5,62 @@ package cni
 
 import (
 	"encoding/json"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/network/policy"
+	"github.com/Azure/azure-container-networking/tracing"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/pkg/errors"
 )
 
 const (
 	PolicyStr string = "Policy"
+	// EthtoolProfileAnnotation selects the EthtoolProfiles entry applied to the pod's delegated nics
+	EthtoolProfileAnnotation = "kubernetes.azure.com/ethtool-profile"
+	// StaticIPAnnotation pins the pod to the comma separated IPs, one per family, which CNS assigns from the node pool
+	StaticIPAnnotation = "kubernetes.azure.com/static-ip"
+	// IPFamiliesAnnotation requests the comma separated IP families, IPv4 and/or IPv6, for the pod instead of all the
+	// families of the node
+	IPFamiliesAnnotation = "kubernetes.azure.com/ip-families"
+	// SecondaryIPsAnnotation requests the number of IPs CNS assigns the pod on top of each of its IPs, which are
+	// programmed on its primary interface
+	SecondaryIPsAnnotation = "kubernetes.azure.com/secondary-ips"
+	// NetworksAnnotation attaches the pod to the comma separated AdditionalNetworks, each as name or name@ifName, on top of
+	// its default network
+	NetworksAnnotation = "kubernetes.azure.com/networks"
+	// DSCPAnnotation marks the egress traffic of the pod with the dscp value, 0 to 63, so that the fabric can prioritize
+	// it, linux only
+	DSCPAnnotation = "kubernetes.azure.com/dscp"
+	// FlowLogsAnnotation logs the flows of the pod, which cns serves sampled, when true, linux only
+	FlowLogsAnnotation = "kubernetes.azure.com/flow-logs"
+
+	// StateStoreFile and StateStoreBolt are the stores the state can be kept in, see NetworkConfig.StateStore
+	StateStoreFile = "file"
+	StateStoreBolt = "bolt"
+
+	// maxIfNameLen is the longest interface name the kernel accepts
+	maxIfNameLen = 15
+	// maxDSCP is the largest value of the 6 bits of the dscp field
+	maxDSCP = 63
+)
+
+var (
+	ErrUnknownEthtoolProfile = errors.New("unknown ethtool profile")
+	ErrInvalidStaticIP       = errors.New("invalid static ip")
+	ErrInvalidIPFamilies     = errors.New("invalid ip families")
+	ErrInvalidSecondaryIPs   = errors.New("invalid secondary ips")
+	ErrInvalidDSCP           = errors.New("invalid dscp")
+	ErrInvalidFlowLogs       = errors.New("invalid flow logs")
+	ErrUnknownNetwork        = errors.New("unknown network")
+	ErrInvalidNetworks       = errors.New("invalid network selections")
+	ErrEBPFDatapathPolicy    = errors.New("ebpf datapath bypasses the network policy engine")
+	ErrEBPFDatapathIPVlan    = errors.New("ebpf datapath needs the host veths the ipvlan datapath doesn't have")
+	ErrEBPFDatapathMacvlan   = errors.New("ebpf datapath needs the host veths the macvlan datapath doesn't have")
+	ErrUnknownStateStore     = errors.New("unknown state store")
 )
 
 // KVPair represents a K-V pair of a json object.
@@ -31,6 +79,8 @@ type PortMapping struct {
 type RuntimeConfig struct {
 	PortMappings []PortMapping    `json:"portMappings,omitempty"`
 	DNS          RuntimeDNSConfig `json:"dns,omitempty"`
+	// PodAnnotations is populated by containerd when the io.kubernetes.cri.pod-annotations capability is set
+	PodAnnotations map[string]string `json:"io.kubernetes.cri.pod-annotations,omitempty"`
 }
 
 // https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/dockershim/network/cni/cni.go#L104
@@ -61,7 +111,7 @@ type NetworkConfig struct {
 	Bridge                        string          `json:"bridge,omitempty"`
 	LogLevel                      string          `json:"logLevel,omitempty"`
 	LogTarget                     string          `json:"logTarget,omitempty"`
-	InfraVnetAddressSpace         string          `json:"infraVnetAddressSpace,omitempty"`
+	InfraVnetAddressSpace         string          `json:"infraVnetAddressSpace,omitempty"` // a subnet per ip family, comma separated on dual stack
 	IPV6Mode                      string          `json:"ipv6Mode,omitempty"`
 	ServiceCidrs                  string          `json:"serviceCidrs,omitempty"`
 	VnetCidrs                     string          `json:"vnetCidrs,omitempty"`
@@ -79,11 +129,139 @@ type NetworkConfig struct {
 	RuntimeConfig                 RuntimeConfig   `json:"runtimeConfig,omitempty"`
 	WindowsSettings               WindowsSettings `json:"windowsSettings,omitempty"`
 	AdditionalArgs                []KVPair        `json:"AdditionalArgs,omitempty"`
+	DatapathGeneration            *int            `json:"datapathGeneration,omitempty"` // defaults to the latest generation
+	PushMetricsToCNS              bool            `json:"pushMetricsToCns,omitempty"`
+	// DNSProxy routes the dns of the multitenant pods to the snat bridge, where the cns dns proxy intercepts it, even
+	// when the host doesn't need snat for dns otherwise. Set it along with the DNSProxySettings of cns, linux only
+	DNSProxy bool `json:"dnsProxy,omitempty"`
+	// DNSRedirectExceptionAnnotations is an allowlist of pod annotations; pods with any of them bypass dns interception
+	// so they can reach azure dns directly, their dns is still snatted
+	DNSRedirectExceptionAnnotations map[string]string `json:"dnsRedirectExceptionAnnotations,omitempty"`
+	// EnableEBPFDatapath redirects pod to pod traffic with tc-eBPF in linux transparent mode, requires kernel 5.10+.
+	// The redirected traffic skips the host iptables chains, so it can't be enabled with a NetworkPolicyEngine
+	EnableEBPFDatapath bool `json:"enableEbpfDatapath,omitempty"`
+	// EnableIPVlanL3S plumbs the pods of a linux transparent network as ipvlan devices in l3s mode on the host interface
+	// in place of veth pairs, which need no proxy arp. It is set on the network when it is created, its endpoints keep
+	// the datapath they were created with
+	EnableIPVlanL3S bool `json:"enableIpvlanL3s,omitempty"`
+	// EnableMacvlan plumbs the pods of a linux transparent network as macvlan devices in bridge mode on the host
+	// interface, so that they appear on the vnet with mac addresses of their own, which are registered with the fabric
+	// by a dhcp discover. It is set on the network when it is created and is ignored along with EnableIPVlanL3S
+	EnableMacvlan bool `json:"enableMacvlan,omitempty"`
+	// NetworkPolicyEngine is the engine enforcing the network policies of the cluster, such as azure-npm or calico,
+	// unset when none is installed
+	NetworkPolicyEngine string `json:"networkPolicyEngine,omitempty"`
+	// WireguardIfName is the wireguard interface cns brings up for the wireguard mode, defaults to azwg0
+	WireguardIfName string `json:"wireguardIfName,omitempty"`
+	// VxlanIfName, VxlanID and VxlanPort are the vxlan interface the vxlan mode creates for the network and syncs
+	// with cns, default to azvxlan, vni 4096 and port 4789. Every node of the cluster must use the same vni and port
+	VxlanIfName string `json:"vxlanIfName,omitempty"`
+	VxlanID     int    `json:"vxlanId,omitempty"`
+	VxlanPort   int    `json:"vxlanPort,omitempty"`
+	// MTU is the mtu of the bridges, veths and hns networks created for the pods, which default to the mtu of the
+	// master interface, including the jumbo frames of the skus which support them
+	MTU int `json:"mtu,omitempty"`
+	// AllowedVlanIDs are delivered tagged to the pods' delegated nics, making them 802.1q trunks
+	AllowedVlanIDs []int `json:"allowedVlanIds,omitempty"`
+	// EthtoolProfiles are the ring sizes and channel counts pods select for their delegated nics by the
+	// EthtoolProfileAnnotation, linux only
+	EthtoolProfiles map[string]EthtoolProfile `json:"ethtoolProfiles,omitempty"`
+	// DeferDelUntilSandboxExit fails a DEL with a retriable error while processes still run in the pod's netns, so the
+	// runtime retries it rather than the ips of a running sandbox are released, linux only
+	DeferDelUntilSandboxExit bool `json:"deferDelUntilSandboxExit,omitempty"`
+	// DisableConntrackFlush keeps the conntrack entries of the ips of the pods when their endpoints are deleted. They
+	// are flushed by default, so that a pod an ip is reused for doesn't inherit the nat and established state of the
+	// flows of the previous one, linux only
+	DisableConntrackFlush bool `json:"disableConntrackFlush,omitempty"`
+	// SandboxedRuntimes are the runtime classes, as passed in the K8S_POD_RUNTIME_CLASS arg, whose pods run in a vm
+	// which owns their netns, such as kata, linux only
+	SandboxedRuntimes map[string]SandboxedRuntime `json:"sandboxedRuntimes,omitempty"`
+	// AdditionalNetworks are the azure-vnet networks, by name, pods attach to on top of this one with the
+	// NetworksAnnotation, each with an endpoint of its own
+	AdditionalNetworks map[string]AdditionalNetwork `json:"additionalNetworks,omitempty"`
+	// StateFormat is the format the state file is written in, json or binary, defaults to json. The state file is
+	// converted on the next save when it changes. The binary state is written to azure-vnet.bin in place of
+	// azure-vnet.json, set it back to json before rolling back to a version without it
+	StateFormat string `json:"stateFormat,omitempty"`
+	// StateStore is the store the state is kept in, file for the state file in StateFormat or bolt for a bolt database,
+	// which only writes the endpoints which changed, defaults to file. The state is moved to the new store and the files
+	// of the previous one are removed when it changes
+	StateStore string `json:"stateStore,omitempty"`
+	// Tracing exports the spans of the commands to an OpenTelemetry collector, which breaks the latency of the commands
+	// down by step, cns continues the traces when it exports its spans as well
+	Tracing *tracing.Config `json:"tracing,omitempty"`
+	// SnatBridgeSubnet is the subnet of the snat bridge of the multitenant pods, in place of the 169.254 subnet cns
+	// gets for their NC, for hosts whose networks overlap it. Cns fails the ADD when it overlaps the vnet or host
+	// subnets or a host route
+	SnatBridgeSubnet string `json:"snatBridgeSubnet,omitempty"`
+	// EndpointValidationMode is what the endpoints of an ADD must have in common, containerID, the default, or podUID
+	// for sandboxes whose interfaces are added with differing container ids, such as windows hostprocess pods. The
+	// podUID mode needs the runtime to pass the K8S_POD_UID arg
+	EndpointValidationMode string `json:"endpointValidationMode,omitempty"`
+	// PodMatch is how the network containers and the existing endpoint of a multitenant pod are found by the pod name,
+	// in place of EnableExactMatchForPodName: exact; prefix, for the network containers registered with the longest name
+	// the pod name starts with, followed by a dash, such as the name of its deployment; regex, for the name PodNameRegex
+	// captures from the pod name; or uid, for the endpoint with the uid in the K8S_POD_UID arg and the network containers
+	// of the exact pod name. Without it, the pod name without its last two dash-delimited parts is matched, or the exact
+	// pod name with EnableExactMatchForPodName
+	PodMatch string `json:"podMatch,omitempty"`
+	// PodNameRegex is the regex of the regex PodMatch, its first capture group, or its whole match without one, is the
+	// name the network containers of the pod are registered with
+	PodNameRegex string `json:"podNameRegex,omitempty"`
+	// BridgeARP is the arp handling of the endpoints of bridge networks, linux only
+	BridgeARP *BridgeARPConfig `json:"bridgeArp,omitempty"`
+}
+
+// BridgeARPConfig is the arp handling of the endpoints of bridge networks. Without it, the bridge answers the arp
+// requests for the ips of the endpoints and the host has static neighbor entries for them, which conflicts with
+// appliances answering arp themselves.
+type BridgeARPConfig struct {
+	// DisableProxyARP leaves answering the arp requests for the ips of the endpoints to the endpoints themselves
+	DisableProxyARP bool `json:"disableProxyArp,omitempty"`
+	// SpoofProtection drops the arp the endpoints send with a sender ip or mac which isn't their own
+	SpoofProtection bool `json:"spoofProtection,omitempty"`
+	// GratuitousARP announces the ips of the endpoints once they are assigned, so the neighbors update the mac they
+	// cached for an ip of an earlier pod
+	GratuitousARP bool `json:"gratuitousArp,omitempty"`
+}
+
+// AdditionalNetwork is the configuration of a network pods attach to on top of their default network. The settings it
+// leaves unset are the ones of the default network.
+type AdditionalNetwork struct {
+	Mode   string `json:"mode,omitempty"`
+	Master string `json:"master,omitempty"`
+	Bridge string `json:"bridge,omitempty"`
+	IPAM   IPAM   `json:"ipam"`
+}
+
+// NetworkSelection is an additional network a pod attaches to, on the interface IfName.
+type NetworkSelection struct {
+	Name   string
+	IfName string
+}
+
+// SandboxedRuntime describes how the infra nic of a pod is handed to the vm of its sandbox.
+type SandboxedRuntime struct {
+	// Device is the device the vm consumes in the netns, tap or ipvtap on the container veth. When unset, the runtime
+	// bridges the container veth to the vm itself.
+	Device string `json:"device,omitempty"`
+}
+
+// EthtoolProfile sizes the rings and channels of a nic, the unset ones are left as the driver set them.
+type EthtoolProfile struct {
+	RxRing           uint32 `json:"rxRing,omitempty"`
+	TxRing           uint32 `json:"txRing,omitempty"`
+	RxChannels       uint32 `json:"rxChannels,omitempty"`
+	TxChannels       uint32 `json:"txChannels,omitempty"`
+	CombinedChannels uint32 `json:"combinedChannels,omitempty"`
 }
 
 type WindowsSettings struct {
 	EnableLoopbackDSR           bool `json:"enableLoopbackDSR,omitempty"`
 	HnsTimeoutDurationInSeconds int  `json:"hnsTimeoutDurationInSeconds,omitempty"`
+	// HostProtectedPorts are the host ports, as <tcp|udp>/<port>, the pods' traffic is blocked to, e.g. winrm, rdp and
+	// kubelet
+	HostProtectedPorts []string `json:"hostProtectedPorts,omitempty"`
 }
 
 type K8SPodEnvArgs struct {
@@ -91,6 +269,8 @@ type K8SPodEnvArgs struct {
 	K8S_POD_NAMESPACE          cniTypes.UnmarshallableString `json:"K8S_POD_NAMESPACE,omitempty"`
 	K8S_POD_NAME               cniTypes.UnmarshallableString `json:"K8S_POD_NAME,omitempty"`
 	K8S_POD_INFRA_CONTAINER_ID cniTypes.UnmarshallableString `json:"K8S_POD_INFRA_CONTAINER_ID,omitempty"`
+	K8S_POD_RUNTIME_CLASS      cniTypes.UnmarshallableString `json:"K8S_POD_RUNTIME_CLASS,omitempty"`
+	K8S_POD_UID                cniTypes.UnmarshallableString `json:"K8S_POD_UID,omitempty"`
 }
 
 // ParseCniArgs unmarshals cni arguments.
@@ -136,6 +316,201 @@ func GetPoliciesFromNwCfg(kvp []KVPair) []policy.Policy {
 	return policies
 }
 
+// SkipDNSRedirect returns true if the pod has any of the DNSRedirectExceptionAnnotations with the same value.
+func (nwcfg *NetworkConfig) SkipDNSRedirect() bool {
+	for key, value := range nwcfg.DNSRedirectExceptionAnnotations {
+		if podValue, ok := nwcfg.RuntimeConfig.PodAnnotations[key]; ok && podValue == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEBPFDatapath returns an error if the ebpf datapath is enabled along with a network policy engine, which
+// enforces the policies on the host chains the datapath redirects the pod to pod traffic around, or along with the
+// ipvlan or macvlan datapaths, whose pods have no host veth for the ebpf program.
+func (nwcfg *NetworkConfig) ValidateEBPFDatapath() error {
+	if nwcfg.EnableEBPFDatapath && nwcfg.NetworkPolicyEngine != "" {
+		return errors.Wrapf(ErrEBPFDatapathPolicy, "policies are enforced by %s", nwcfg.NetworkPolicyEngine)
+	}
+	if nwcfg.EnableEBPFDatapath && nwcfg.EnableIPVlanL3S {
+		return ErrEBPFDatapathIPVlan
+	}
+	if nwcfg.EnableEBPFDatapath && nwcfg.EnableMacvlan {
+		return ErrEBPFDatapathMacvlan
+	}
+	return nil
+}
+
+// SandboxedRuntime returns the sandboxed runtime of the runtime class the pod runs with, or nil if the pod runs in
+// a regular container.
+func (nwcfg *NetworkConfig) SandboxedRuntime(podCfg *K8SPodEnvArgs) *SandboxedRuntime {
+	runtimeClass := string(podCfg.K8S_POD_RUNTIME_CLASS)
+	if runtimeClass == "" {
+		return nil
+	}
+	if sandboxed, ok := nwcfg.SandboxedRuntimes[runtimeClass]; ok {
+		return &sandboxed
+	}
+	return nil
+}
+
+// EthtoolProfile returns the profile the pod selects with the EthtoolProfileAnnotation, or nil if it selects none.
+func (nwcfg *NetworkConfig) EthtoolProfile() (*EthtoolProfile, error) {
+	name, ok := nwcfg.RuntimeConfig.PodAnnotations[EthtoolProfileAnnotation]
+	if !ok || name == "" {
+		return nil, nil
+	}
+	profile, ok := nwcfg.EthtoolProfiles[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownEthtoolProfile, "pod selects %q", name)
+	}
+	return &profile, nil
+}
+
+// StaticIPs returns the IPs the pod is pinned to with the StaticIPAnnotation, or nil if it is pinned to none.
+func (nwcfg *NetworkConfig) StaticIPs() ([]string, error) {
+	value, ok := nwcfg.RuntimeConfig.PodAnnotations[StaticIPAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var ips []string
+	families := map[bool]bool{}
+	for _, field := range strings.Split(value, ",") {
+		ip, err := netip.ParseAddr(strings.TrimSpace(field))
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidStaticIP, "pod is pinned to %q", value)
+		}
+		ip = ip.Unmap()
+		if families[ip.Is4()] {
+			return nil, errors.Wrapf(ErrInvalidStaticIP, "pod is pinned to more than one ip of a family in %q", value)
+		}
+		families[ip.Is4()] = true
+		ips = append(ips, ip.String())
+	}
+	return ips, nil
+}
+
+// IPFamilies returns the IP families the pod requests with the IPFamiliesAnnotation, or nil if it requests all the
+// families of the node.
+func (nwcfg *NetworkConfig) IPFamilies() ([]cns.IPFamily, error) {
+	value, ok := nwcfg.RuntimeConfig.PodAnnotations[IPFamiliesAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var families []cns.IPFamily
+	for _, field := range strings.Split(value, ",") {
+		var family cns.IPFamily
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "ipv4":
+			family = cns.IPv4Family
+		case "ipv6":
+			family = cns.IPv6Family
+		default:
+			return nil, errors.Wrapf(ErrInvalidIPFamilies, "pod requests %q", value)
+		}
+		if slices.Contains(families, family) {
+			return nil, errors.Wrapf(ErrInvalidIPFamilies, "pod requests %s twice in %q", family, value)
+		}
+		families = append(families, family)
+	}
+	return families, nil
+}
+
+// SecondaryIPs returns the number of secondary IPs the pod requests with the SecondaryIPsAnnotation, or 0 if it requests
+// none.
+func (nwcfg *NetworkConfig) SecondaryIPs() (int, error) {
+	value, ok := nwcfg.RuntimeConfig.PodAnnotations[SecondaryIPsAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || count < 0 {
+		return 0, errors.Wrapf(ErrInvalidSecondaryIPs, "pod requests %q", value)
+	}
+	return count, nil
+}
+
+// DSCP returns the dscp value the pod marks its egress traffic with using the DSCPAnnotation, or 0 if it marks none.
+func (nwcfg *NetworkConfig) DSCP() (int, error) {
+	value, ok := nwcfg.RuntimeConfig.PodAnnotations[DSCPAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	dscp, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || dscp < 0 || dscp > maxDSCP {
+		return 0, errors.Wrapf(ErrInvalidDSCP, "pod requests %q", value)
+	}
+	return dscp, nil
+}
+
+// FlowLogs returns whether the flows of the pod are logged using the FlowLogsAnnotation.
+func (nwcfg *NetworkConfig) FlowLogs() (bool, error) {
+	value, ok := nwcfg.RuntimeConfig.PodAnnotations[FlowLogsAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, errors.Wrapf(ErrInvalidFlowLogs, "pod requests %q", value)
+	}
+	return enabled, nil
+}
+
+// NetworkSelections returns the additional networks the pod attaches to with the NetworksAnnotation, in the order it
+// selects them. The interfaces the pod doesn't name are net1, net2 and so on, by position.
+func (nwcfg *NetworkConfig) NetworkSelections() ([]NetworkSelection, error) {
+	value, ok := nwcfg.RuntimeConfig.PodAnnotations[NetworksAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var selections []NetworkSelection
+	ifNames := map[string]bool{}
+	for i, field := range strings.Split(value, ",") {
+		name, ifName, _ := strings.Cut(strings.TrimSpace(field), "@")
+		if ifName == "" {
+			ifName = "net" + strconv.Itoa(i+1)
+		}
+		if _, ok := nwcfg.AdditionalNetworks[name]; !ok {
+			return nil, errors.Wrapf(ErrUnknownNetwork, "pod selects %q", name)
+		}
+		if len(ifName) > maxIfNameLen || strings.ContainsAny(ifName, "/ ") {
+			return nil, errors.Wrapf(ErrInvalidNetworks, "interface name %q in %q", ifName, value)
+		}
+		if ifNames[ifName] {
+			return nil, errors.Wrapf(ErrInvalidNetworks, "pod selects interface %s twice in %q", ifName, value)
+		}
+		ifNames[ifName] = true
+		selections = append(selections, NetworkSelection{Name: name, IfName: ifName})
+	}
+	return selections, nil
+}
+
+// AdditionalNetworkConfig returns the configuration of the additional network of the given name, the one of this
+// network with the settings of the additional network applied. It returns nil for an unknown network.
+func (nwcfg *NetworkConfig) AdditionalNetworkConfig(name string) *NetworkConfig {
+	additional, ok := nwcfg.AdditionalNetworks[name]
+	if !ok {
+		return nil
+	}
+	attCfg := *nwcfg
+	attCfg.Name = name
+	attCfg.IPAM = additional.IPAM
+	if additional.Mode != "" {
+		attCfg.Mode = additional.Mode
+	}
+	if additional.Master != "" {
+		attCfg.Master = additional.Master
+	}
+	if additional.Bridge != "" {
+		attCfg.Bridge = additional.Bridge
+	}
+	// the port mappings and the features of the pod are the ones of its default network
+	attCfg.RuntimeConfig = RuntimeConfig{DNS: nwcfg.RuntimeConfig.DNS}
+	attCfg.AdditionalNetworks = nil
+	return &attCfg
+}
+
 // Serialize marshals a network configuration to bytes.
 func (nwcfg *NetworkConfig) Serialize() []byte {
 	bytes, _ := json.Marshal(nwcfg)
@@ -0,0 +1,93 @@
+package cni
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/network/policy"
+)
+
+// addConflistSeeds seeds the fuzzer with the azure-vnet plugin configs of the conflists shipped with the cni, with
+// the runtime config containerd adds to them.
+func addConflistSeeds(f *testing.F) {
+	conflists, err := filepath.Glob("*.conflist")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, conflist := range conflists {
+		b, err := os.ReadFile(conflist)
+		if err != nil {
+			f.Fatal(err)
+		}
+		var list struct {
+			Plugins []json.RawMessage `json:"plugins"`
+		}
+		if err := json.Unmarshal(b, &list); err != nil {
+			f.Fatalf("failed to parse %s: %v", conflist, err)
+		}
+		for _, plugin := range list.Plugins {
+			f.Add([]byte(plugin))
+		}
+	}
+	f.Add([]byte(`{"type":"azure-vnet","name":"azure","runtimeConfig":{"io.kubernetes.cri.pod-annotations":{` +
+		`"kubernetes.azure.com/static-ip":"10.0.0.4,fd00::4","kubernetes.azure.com/ip-families":"IPv4,IPv6",` +
+		`"kubernetes.azure.com/networks":"storage@stor0,backend","kubernetes.azure.com/ethtool-profile":"large"}},` +
+		`"additionalNetworks":{"storage":{"ipam":{"type":"azure-vnet-ipam"}},"backend":{"mode":"bridge","ipam":{}}},` +
+		`"ethtoolProfiles":{"large":{"rxRing":4096}},"sandboxedRuntimes":{"kata":{"device":"tap"}},` +
+		`"AdditionalArgs":[{"name":"EndpointPolicy","value":{"Type":"OutBoundNAT","ExceptionList":["10.0.0.0/8"]}}]}`))
+}
+
+// FuzzParseNetworkConfig parses network configs and the pod annotations and args the plugin reads from them on ADD,
+// none of which may panic on malformed input. The crashers go test records under testdata/fuzz are run as
+// regression cases by the unit tests.
+func FuzzParseNetworkConfig(f *testing.F) {
+	addConflistSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		nwCfg, err := ParseNetworkConfig(b)
+		if err != nil {
+			return
+		}
+
+		_, _ = nwCfg.StaticIPs()
+		_, _ = nwCfg.IPFamilies()
+		_, _ = nwCfg.SecondaryIPs()
+		_, _ = nwCfg.DSCP()
+		_, _ = nwCfg.FlowLogs()
+		_, _ = nwCfg.EthtoolProfile()
+		_ = nwCfg.SkipDNSRedirect()
+		selections, err := nwCfg.NetworkSelections()
+		if err == nil {
+			for _, selection := range selections {
+				if nwCfg.AdditionalNetworkConfig(selection.Name) == nil {
+					t.Fatalf("selected network %q has no config", selection.Name)
+				}
+			}
+		}
+		for _, p := range GetPoliciesFromNwCfg(nwCfg.AdditionalArgs) {
+			_, _ = policy.AddOutBoundNATExceptions([]policy.Policy{p}, []string{"10.0.0.0/8"})
+			_, _ = policy.ParseL4WFPProxySetting(p.Data)
+		}
+
+		// what the plugin serializes for the ipam plugins it delegates to must parse back
+		if _, err := ParseNetworkConfig(nwCfg.Serialize()); err != nil {
+			t.Fatalf("failed to parse serialized config: %v", err)
+		}
+	})
+}
+
+// FuzzParseCniArgs parses the CNI_ARGS the runtime passes to the plugin.
+func FuzzParseCniArgs(f *testing.F) {
+	f.Add("K8S_POD_NAME=pod;K8S_POD_NAMESPACE=default;K8S_POD_INFRA_CONTAINER_ID=abc;K8S_POD_RUNTIME_CLASS=kata")
+	f.Add("IgnoreUnknown=1;K8S_POD_NAME=pod")
+	f.Add("K8S_POD_NAME")
+	f.Fuzz(func(_ *testing.T, args string) {
+		podCfg, err := ParseCniArgs(args)
+		if err != nil {
+			return
+		}
+		nwCfg := &NetworkConfig{SandboxedRuntimes: map[string]SandboxedRuntime{"kata": {Device: "tap"}}}
+		_ = nwCfg.SandboxedRuntime(podCfg)
+	})
+}
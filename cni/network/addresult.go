@@ -0,0 +1,101 @@
+package network
+
+import (
+	"encoding/json"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/100"
+	"go.uber.org/zap"
+)
+
+// newAddResult returns the CNI result of an ADD: the interface of the infra nic, or of one of the secondary nics when
+// the pod has no infra nic, followed by the interfaces of the rest of its endpoints.
+func newAddResult(args *cniSkel.CmdArgs, nwCfg *cni.NetworkConfig, ipamAddResult IPAMAddResult, epInfos, attEpInfos []*network.EndpointInfo) *cniTypesCurr.Result {
+	// previously we had a default interface info to select which interface info was the one to be returned from cni add
+	cniResult := &cniTypesCurr.Result{}
+	for key := range ipamAddResult.interfaceInfo {
+		// now we have to infer which interface info should be returned
+		// we assume that we want to return the infra nic always, and if that is not found, return any one of the secondary interfaces
+		// if there is an infra nic + secondary, we will always return the infra nic (linux swift v2)
+		cniResult = convertInterfaceInfoToCniResult(ipamAddResult.interfaceInfo[key], args.IfName)
+		if ipamAddResult.interfaceInfo[key].NICType == cns.InfraNIC {
+			break
+		}
+	}
+
+	// stdout multiple cniResults for containerd to create multiple pods
+	// containerd receives each cniResult as the stdout and create pod
+	addSnatInterface(nwCfg, cniResult) //nolint TODO: check whether Linux supports adding secondary snatinterface
+
+	// add IB NIC interfaceInfo to cniResult
+	for _, epInfo := range epInfos {
+		if epInfo.NICType == cns.BackendNIC {
+			cniResult.Interfaces = append(cniResult.Interfaces, &cniTypesCurr.Interface{
+				Name:  epInfo.MasterIfName,
+				Mac:   epInfo.MacAddress.String(),
+				PciID: epInfo.PnPID,
+			})
+		}
+		// the sandboxed runtime finds the device to hand to the vm in the netns of the pod
+		if epInfo.SandboxDevice != "" {
+			cniResult.Interfaces = append(cniResult.Interfaces, &cniTypesCurr.Interface{
+				Name:    network.SandboxDeviceName(epInfo.IfName),
+				Sandbox: args.Netns,
+			})
+		}
+	}
+
+	// the additional networks are interfaces of the sandbox with their own ips
+	for _, epInfo := range attEpInfos {
+		cniResult.Interfaces = append(cniResult.Interfaces, &cniTypesCurr.Interface{
+			Name:    epInfo.IfName,
+			Sandbox: args.Netns,
+		})
+		for i := range epInfo.IPAddresses {
+			cniResult.IPs = append(cniResult.IPs, &cniTypesCurr.IPConfig{
+				Interface: cniTypesCurr.Int(len(cniResult.Interfaces) - 1),
+				Address:   epInfo.IPAddresses[i],
+			})
+		}
+	}
+
+	return cniResult
+}
+
+// recordAddResult keeps the result of the ADD on the endpoint of the interface of the ADD, so that it is saved with the
+// endpoints. The result of the pods without an infra nic, which have no endpoint for the interface, isn't kept.
+func recordAddResult(args *cniSkel.CmdArgs, cniResult *cniTypesCurr.Result, epInfos []*network.EndpointInfo) {
+	for _, epInfo := range epInfos {
+		if epInfo.IfName != args.IfName {
+			continue
+		}
+		data, err := json.Marshal(cniResult)
+		if err != nil {
+			logger.Error("Failed to marshal ADD result", zap.Error(err))
+			return
+		}
+		epInfo.AddResult = data
+		return
+	}
+}
+
+// cachedAddResult returns the result of the ADD which already created the endpoint of the container and interface of
+// the args, nil when there is none. The runtimes retry the ADDs which timed out, which are then answered
+// with the result instead of plumbing the pod again.
+func (plugin *NetPlugin) cachedAddResult(args *cniSkel.CmdArgs) *cniTypesCurr.Result {
+	for _, epInfo := range plugin.nm.GetEndpointInfosFromContainerID(args.ContainerID) {
+		if epInfo.IfName != args.IfName || len(epInfo.AddResult) == 0 {
+			continue
+		}
+		cniResult := &cniTypesCurr.Result{}
+		if err := json.Unmarshal(epInfo.AddResult, cniResult); err != nil {
+			logger.Error("Failed to unmarshal cached ADD result", zap.String("endpointID", epInfo.EndpointID), zap.Error(err))
+			return nil
+		}
+		return cniResult
+	}
+	return nil
+}
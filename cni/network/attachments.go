@@ -0,0 +1,162 @@
+package network
+
+import (
+	"context"
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	errAttachmentsUnsupported = errors.New("additional networks are not supported")
+	errAttachmentIPAM         = errors.New("additional networks don't support the ipam type")
+)
+
+// attachmentIpamInvoker returns the invoker allocating the ips of an additional network. The ips of the pod subnet
+// come from cns for the default network only, the additional networks allocate theirs from their own ipam plugin.
+func (plugin *NetPlugin) attachmentIpamInvoker(netNs string, attCfg *cni.NetworkConfig) IPAMInvoker {
+	if plugin.newAttachmentIpamInvoker != nil {
+		return plugin.newAttachmentIpamInvoker(netNs, attCfg)
+	}
+	nwInfo := plugin.getNetworkInfo(netNs, nil, attCfg)
+	return NewAzureIpamInvoker(plugin, &nwInfo)
+}
+
+// attachmentConfig returns the configuration of the additional network of an endpoint of the pod, or nil if the
+// endpoint is on the default network.
+func attachmentConfig(nwCfg *cni.NetworkConfig, networkID string) *cni.NetworkConfig {
+	if networkID == nwCfg.Name {
+		return nil
+	}
+	return nwCfg.AdditionalNetworkConfig(networkID)
+}
+
+// addAttachments allocates the ips of the additional networks the pod selects with the NetworksAnnotation and
+// generates the infos of their endpoints, one per network. The ips of all the attachments are released when one of
+// them fails.
+func (plugin *NetPlugin) addAttachments(ctx context.Context, args *cniSkel.CmdArgs, nwCfg *cni.NetworkConfig, k8sPodName, k8sNamespace string) ([]*network.EndpointInfo, error) {
+	selections, err := nwCfg.NetworkSelections()
+	if err != nil {
+		return nil, err
+	}
+	if len(selections) == 0 {
+		return nil, nil
+	}
+	// DEL finds the additional network of an endpoint by the network it is saved in, which only the statefile records
+	if nwCfg.MultiTenancy || plugin.nm.IsStatelessCNIMode() {
+		return nil, errors.Wrap(errAttachmentsUnsupported, "with multitenancy or stateless cni")
+	}
+
+	epInfos := make([]*network.EndpointInfo, 0, len(selections))
+	for _, selection := range selections {
+		if selection.IfName == args.IfName || selection.Name == nwCfg.Name {
+			err = errors.Wrapf(cni.ErrInvalidNetworks, "pod selects its default network or interface with %s@%s", selection.Name, selection.IfName)
+			break
+		}
+
+		var epInfo *network.EndpointInfo
+		if epInfo, err = plugin.addAttachment(ctx, args, nwCfg, selection, k8sPodName, k8sNamespace); err != nil {
+			break
+		}
+		epInfos = append(epInfos, epInfo)
+	}
+	if err != nil {
+		plugin.releaseAttachments(context.WithoutCancel(ctx), epInfos, nwCfg, args)
+		return nil, err
+	}
+
+	return epInfos, nil
+}
+
+// addAttachment allocates the ips of an additional network and generates the info of its endpoint.
+func (plugin *NetPlugin) addAttachment(ctx context.Context, args *cniSkel.CmdArgs, nwCfg *cni.NetworkConfig, selection cni.NetworkSelection,
+	k8sPodName, k8sNamespace string,
+) (*network.EndpointInfo, error) {
+	attCfg := nwCfg.AdditionalNetworkConfig(selection.Name)
+	if attCfg.IPAM.Type == network.AzureCNS {
+		return nil, errors.Wrapf(errAttachmentIPAM, "%s of network %s", attCfg.IPAM.Type, selection.Name)
+	}
+
+	attArgs := *args
+	attArgs.IfName = selection.IfName
+	options := make(map[string]any)
+	ipamAddConfig := IPAMAddConfig{nwCfg: attCfg, args: &attArgs, options: options}
+	invoker := plugin.attachmentIpamInvoker(args.Netns, attCfg)
+	ipamAddResult, err := invoker.Add(ctx, ipamAddConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to allocate the ips of network %s", selection.Name)
+	}
+
+	ifInfo := ipamAddResult.interfaceInfo[string(cns.InfraNIC)]
+	// the default route of the pod stays on its default network
+	ifInfo.SkipDefaultRoutes = true
+	routes := make([]network.RouteInfo, 0, len(ifInfo.Routes))
+	for _, route := range ifInfo.Routes {
+		if ones, _ := route.Dst.Mask.Size(); ones > 0 {
+			routes = append(routes, route)
+		}
+	}
+	ifInfo.Routes = routes
+
+	networkID, _ := plugin.getNetworkID(args.Netns, &ifInfo, attCfg)
+	infraSeen := false
+	epInfo, err := plugin.createEpInfo(&createEpInfoOpt{
+		nwCfg:         attCfg,
+		ipamAddResult: ipamAddResult,
+		args:          &attArgs,
+		policies:      cni.GetPoliciesFromNwCfg(attCfg.AdditionalArgs),
+		k8sPodName:    k8sPodName,
+		k8sNamespace:  k8sNamespace,
+		natInfo:       getNATInfo(attCfg, options[network.SNATIPKey], false),
+		networkID:     networkID,
+		ifInfo:        &ifInfo,
+		ipamAddConfig: &ipamAddConfig,
+		ipv6Enabled:   ipamAddResult.ipv6Enabled,
+		// the endpoint gets the interface the pod selects rather than an ethX one
+		infraSeen:     &infraSeen,
+		endpointIndex: 1,
+	})
+	if err != nil {
+		for _, ipConfig := range ifInfo.IPConfigs {
+			if delErr := invoker.Delete(context.WithoutCancel(ctx), &ipConfig.Address, attCfg, &attArgs, options); delErr != nil {
+				logger.Error("Failed to release the ip of network", zap.String("network", selection.Name), zap.Error(delErr))
+			}
+		}
+		return nil, err
+	}
+	setAttachmentVethName(epInfo, selection.IfName)
+
+	logger.Info("Attaching pod to additional network", zap.String("network", selection.Name), zap.String("ifName", selection.IfName),
+		zap.Any("ips", epInfo.IPAddresses))
+	return epInfo, nil
+}
+
+// releaseAttachments releases the ips of the endpoints on the additional networks, on a failed ADD.
+func (plugin *NetPlugin) releaseAttachments(ctx context.Context, epInfos []*network.EndpointInfo, nwCfg *cni.NetworkConfig, args *cniSkel.CmdArgs) {
+	for _, epInfo := range epInfos {
+		if err := plugin.releaseAttachment(ctx, epInfo, attachmentConfig(nwCfg, epInfo.NetworkID), args); err != nil {
+			logger.Error("Failed to cleanup ip allocation on failure", zap.String("network", epInfo.NetworkID), zap.Error(err))
+		}
+	}
+}
+
+// releaseAttachment releases the ips of the endpoint of an additional network to its ipam plugin.
+func (plugin *NetPlugin) releaseAttachment(ctx context.Context, epInfo *network.EndpointInfo, attCfg *cni.NetworkConfig, args *cniSkel.CmdArgs) error {
+	if attCfg == nil {
+		return errors.Wrapf(cni.ErrUnknownNetwork, "endpoint %s is on network %s", epInfo.EndpointID, epInfo.NetworkID)
+	}
+
+	attArgs := *args
+	attArgs.IfName = epInfo.IfName
+	invoker := plugin.attachmentIpamInvoker(args.Netns, attCfg)
+	for i := range epInfo.IPAddresses {
+		logger.Info("Release ip of additional network", zap.String("network", epInfo.NetworkID), zap.String("ip", epInfo.IPAddresses[i].IP.String()))
+		if err := invoker.Delete(ctx, &epInfo.IPAddresses[i], attCfg, &attArgs, nil); err != nil {
+			return errors.Wrapf(err, "failed to release address of network %s", epInfo.NetworkID)
+		}
+	}
+	return nil
+}
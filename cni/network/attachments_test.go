@@ -0,0 +1,128 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cni"
+	acnnetwork "github.com/Azure/azure-container-networking/network"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkSelections(t *testing.T) {
+	additional := map[string]cni.AdditionalNetwork{"storage": {}, "backend": {}}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []cni.NetworkSelection
+		wantErr     error
+	}{
+		{
+			name:        "Default interface names",
+			annotations: map[string]string{cni.NetworksAnnotation: "storage, backend"},
+			want:        []cni.NetworkSelection{{Name: "storage", IfName: "net1"}, {Name: "backend", IfName: "net2"}},
+		},
+		{
+			name:        "Named interface",
+			annotations: map[string]string{cni.NetworksAnnotation: "storage@stor0,backend"},
+			want:        []cni.NetworkSelection{{Name: "storage", IfName: "stor0"}, {Name: "backend", IfName: "net2"}},
+		},
+		{
+			name:        "No networks selected",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Unknown network",
+			annotations: map[string]string{cni.NetworksAnnotation: "frontend"},
+			wantErr:     cni.ErrUnknownNetwork,
+		},
+		{
+			name:        "Repeated interface",
+			annotations: map[string]string{cni.NetworksAnnotation: "storage@net2,backend"},
+			wantErr:     cni.ErrInvalidNetworks,
+		},
+		{
+			name:        "Interface name too long",
+			annotations: map[string]string{cni.NetworksAnnotation: "storage@averyveryverylongname"},
+			wantErr:     cni.ErrInvalidNetworks,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{AdditionalNetworks: additional, RuntimeConfig: cni.RuntimeConfig{PodAnnotations: tt.annotations}}
+			got, err := cfg.NetworkSelections()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPluginAddDeleteAdditionalNetworks(t *testing.T) {
+	plugin := GetTestResources()
+	attInvoker := NewMockIpamInvoker(false, false, false, false, false)
+	var attCfgs []*cni.NetworkConfig
+	plugin.newAttachmentIpamInvoker = func(_ string, attCfg *cni.NetworkConfig) IPAMInvoker {
+		attCfgs = append(attCfgs, attCfg)
+		return attInvoker
+	}
+
+	cfg := nwCfg
+	cfg.AdditionalNetworks = map[string]cni.AdditionalNetwork{
+		"storage": {Master: "eth1", IPAM: cni.IPAM{Type: "azure-vnet-ipam", Subnet: "10.241.0.0/16"}},
+	}
+	cfg.RuntimeConfig.PodAnnotations = map[string]string{cni.NetworksAnnotation: "storage"}
+	args := &cniSkel.CmdArgs{
+		StdinData:   cfg.Serialize(),
+		ContainerID: "test-container",
+		Netns:       "test-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v", "test-pod", "test-pod-ns"),
+		IfName:      eth0IfName,
+	}
+
+	require.NoError(t, plugin.Add(args))
+
+	nm := plugin.nm.(*acnnetwork.MockNetworkManager)
+	epInfos := nm.GetEndpointInfosFromContainerID(args.ContainerID)
+	require.Len(t, epInfos, 2)
+	var attEpInfo *acnnetwork.EndpointInfo
+	for _, epInfo := range epInfos {
+		if epInfo.NetworkID == "storage" {
+			attEpInfo = epInfo
+		}
+	}
+	require.NotNil(t, attEpInfo)
+	assert.Equal(t, "net1", attEpInfo.IfName)
+	assert.Equal(t, "eth1", attEpInfo.MasterIfName)
+	assert.True(t, attEpInfo.SkipDefaultRoutes)
+	require.NotEmpty(t, attCfgs)
+	assert.Equal(t, "azure-vnet-ipam", attCfgs[0].IPAM.Type)
+	assert.Len(t, attInvoker.ipMap, 1)
+
+	// the ip of the additional network goes back to its own ipam plugin
+	require.NoError(t, plugin.Delete(args))
+	assert.Empty(t, nm.GetEndpointInfosFromContainerID(args.ContainerID))
+	assert.Empty(t, attInvoker.ipMap)
+}
+
+func TestPluginAddAdditionalNetworkCNSIPAM(t *testing.T) {
+	plugin := GetTestResources()
+	cfg := nwCfg
+	cfg.AdditionalNetworks = map[string]cni.AdditionalNetwork{"storage": {IPAM: cni.IPAM{Type: "azure-cns"}}}
+	cfg.RuntimeConfig.PodAnnotations = map[string]string{cni.NetworksAnnotation: "storage"}
+	args := &cniSkel.CmdArgs{
+		StdinData:   cfg.Serialize(),
+		ContainerID: "test-container",
+		Netns:       "test-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v", "test-pod", "test-pod-ns"),
+		IfName:      eth0IfName,
+	}
+
+	err := plugin.Add(args)
+	require.ErrorIs(t, err, errAttachmentIPAM)
+	// the ips of the default network are released with the failed attachment
+	assert.Empty(t, plugin.nm.(*acnnetwork.MockNetworkManager).GetEndpointInfosFromContainerID(args.ContainerID))
+	assert.Empty(t, plugin.ipamInvoker.(*MockIpamInvoker).ipMap)
+}
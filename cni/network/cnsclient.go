@@ -12,5 +12,5 @@ type cnsclient interface {
 	RequestIPs(ctx context.Context, ipconfig cns.IPConfigsRequest) (*cns.IPConfigsResponse, error)
 	ReleaseIPs(ctx context.Context, ipconfig cns.IPConfigsRequest) error
 	GetNetworkContainer(ctx context.Context, orchestratorContext []byte) (*cns.GetNetworkContainerResponse, error)
-	GetAllNetworkContainers(ctx context.Context, orchestratorContext []byte) ([]cns.GetNetworkContainerResponse, error)
+	GetAllNetworkContainers(ctx context.Context, orchestratorContext []byte, snatBridgeSubnet string) ([]cns.GetNetworkContainerResponse, error)
 }
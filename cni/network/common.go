@@ -82,5 +82,5 @@ func PrintCNIError(msg string) {
 		Code: cniTypes.ErrTryAgainLater,
 		Msg:  msg,
 	}
-	cniErr.Print()
+	cni.NewErrorResult(cniErr).Print()
 }
@@ -0,0 +1,101 @@
+package network
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/Azure/azure-container-networking/cni"
+	cnscli "github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/telemetry"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// codedError is the CNI error with the code of a failure, which keeps the error of the failure in its chain.
+type codedError struct {
+	cniErr *cniTypes.Error
+	err    error
+}
+
+func (e *codedError) Error() string {
+	return e.cniErr.Error()
+}
+
+func (e *codedError) Unwrap() []error {
+	return []error{e.cniErr, e.err}
+}
+
+// withErrorCode returns the error of a failed command with the CNI error with the code of the failure it comes from in
+// its chain, or as it is when the failure isn't one with a code. The CNI errors which already have a code of their own
+// are kept.
+func (plugin *NetPlugin) withErrorCode(err error, netnsPath string) error {
+	if err == nil {
+		return nil
+	}
+	var cniErr *cniTypes.Error
+	if errors.As(err, &cniErr) && cniErr.Code != cni.ErrRuntime {
+		return err
+	}
+
+	code, ok := errorCode(err)
+	if !ok {
+		code, ok = plugin.netNsGoneErrorCode(netnsPath)
+	}
+	if !ok {
+		return err
+	}
+	return &codedError{cniErr: plugin.CodedError(code, err), err: err}
+}
+
+// errorCode returns the code of the failure the error comes from.
+func errorCode(err error) (uint, bool) {
+	// a stage which ran past its deadline may well complete when the command is retried
+	if errors.Is(err, context.DeadlineExceeded) {
+		return cniTypes.ErrTryAgainLater, true
+	}
+
+	var cnsErr *cnscli.CNSClientError
+	if errors.As(err, &cnsErr) && cnsErr.Code == types.FailedToAllocateIPConfig {
+		return cni.ErrIPAMExhausted, true
+	}
+
+	// the requests to CNS which can't be sent fail with a url error
+	var connectionErr *cnscli.ConnectionFailureErr
+	var urlErr *url.Error
+	if errors.As(err, &connectionErr) || errors.As(err, &urlErr) {
+		return cni.ErrCNSUnreachable, true
+	}
+
+	return platformErrorCode(err)
+}
+
+// netNsGoneErrorCode returns ErrNetNsGone when the netns of the pod is gone, which fails whatever the command was doing
+// in it.
+func (plugin *NetPlugin) netNsGoneErrorCode(netnsPath string) (uint, bool) {
+	if netnsPath == "" {
+		return 0, false
+	}
+	if plugin.sandboxInspector == nil {
+		plugin.sandboxInspector = newSandboxInspector()
+	}
+	state, err := plugin.sandboxInspector.State(netnsPath)
+	if err != nil || state != sandboxGone {
+		return 0, false
+	}
+	return cni.ErrNetNsGone, true
+}
+
+// recordErrorCode records the code of the error which failed the ADD, unless the record already has the CNS response
+// code of a failed allocation.
+func recordErrorCode(record *telemetry.IPAllocationRecord, err error) {
+	var cniErr *cniTypes.Error
+	if !errors.As(err, &cniErr) {
+		return
+	}
+	record.Retryable = cni.IsRetryable(cniErr.Code)
+	generic := record.ErrorCode == "" || record.ErrorCode == telemetry.IPAMErrorStr || record.ErrorCode == telemetry.DatapathErrorStr
+	if generic && cniErr.Code != cni.ErrRuntime {
+		record.ErrorCode = cni.ErrorCodeName(cniErr.Code)
+	}
+}
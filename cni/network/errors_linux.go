@@ -0,0 +1,7 @@
+package network
+
+// platformErrorCode returns the code of the linux failure the error comes from. The netns of the pods which are gone
+// are found by inspecting them instead.
+func platformErrorCode(error) (uint, bool) {
+	return 0, false
+}
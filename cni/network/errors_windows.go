@@ -0,0 +1,25 @@
+package network
+
+import (
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	hnsv2 "github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+)
+
+// platformErrorCode returns the code of the hns failure the error comes from. A namespace hns no longer has is the
+// netns of a pod which is gone.
+func platformErrorCode(err error) (uint, bool) {
+	var namespaceErr hnsv2.NamespaceNotFoundError
+	if errors.As(err, &namespaceErr) {
+		return cni.ErrNetNsGone, true
+	}
+
+	var hcnErr *hnsv2.HcnError
+	var networkErr hnsv2.NetworkNotFoundError
+	var endpointErr hnsv2.EndpointNotFoundError
+	if errors.As(err, &hcnErr) || errors.As(err, &networkErr) || errors.As(err, &endpointErr) || errors.Is(err, hnswrapper.ErrHNSCallTimeout) {
+		return cni.ErrHNSFailure, true
+	}
+	return 0, false
+}
@@ -1,9 +1,11 @@
 package network
 
 import (
+	"context"
 	"net"
 
 	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/network"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 )
@@ -12,11 +14,11 @@ import (
 // This interface can be used to call into external binaries, like the azure-vnet-ipam binary,
 // or simply act as a client to an external ipam, such as azure-cns.
 type IPAMInvoker interface {
-	// Add returns two results, one IPv4, the other IPv6.
-	Add(IPAMAddConfig) (IPAMAddResult, error)
+	// Add returns two results, one IPv4, the other IPv6. The calls to the source fail once ctx is done.
+	Add(ctx context.Context, addConfig IPAMAddConfig) (IPAMAddResult, error)
 
 	// Delete calls to the invoker source, and returns error. Returning an error here will fail the CNI Delete call.
-	Delete(address *net.IPNet, nwCfg *cni.NetworkConfig, args *cniSkel.CmdArgs, options map[string]interface{}) error
+	Delete(ctx context.Context, address *net.IPNet, nwCfg *cni.NetworkConfig, args *cniSkel.CmdArgs, options map[string]interface{}) error
 }
 
 type IPAMAddConfig struct {
@@ -29,6 +31,8 @@ type IPAMAddResult struct {
 	interfaceInfo map[string]network.InterfaceInfo
 	// ncResponse and host subnet prefix were moved into interface info
 	ipv6Enabled bool
+	// allocationStats are reported by CNS, nil with other IPAMs
+	allocationStats *cns.IPAllocationStats
 }
 
 func (ipamAddResult IPAMAddResult) PrettyString() string {
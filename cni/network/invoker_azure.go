@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -33,9 +34,10 @@ type AzureIPAMInvoker struct {
 }
 
 type delegatePlugin interface {
-	DelegateAdd(pluginName string, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error)
-	DelegateDel(pluginName string, nwCfg *cni.NetworkConfig) error
+	DelegateAdd(ctx context.Context, pluginName string, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error)
+	DelegateDel(ctx context.Context, pluginName string, nwCfg *cni.NetworkConfig) error
 	Errorf(format string, args ...interface{}) *cniTypes.Error
+	CodedError(code uint, err error) *cniTypes.Error
 }
 
 // Create an IPAM instance every time a CNI action is called.
@@ -46,7 +48,7 @@ func NewAzureIpamInvoker(plugin *NetPlugin, nwInfo *network.EndpointInfo) *Azure
 	}
 }
 
-func (invoker *AzureIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, error) {
+func (invoker *AzureIPAMInvoker) Add(ctx context.Context, addConfig IPAMAddConfig) (IPAMAddResult, error) {
 	addResult := IPAMAddResult{interfaceInfo: make(map[string]network.InterfaceInfo)}
 
 	if addConfig.nwCfg == nil {
@@ -58,13 +60,17 @@ func (invoker *AzureIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, er
 	}
 
 	// Call into IPAM plugin to allocate an address pool for the network.
-	result, err := invoker.plugin.DelegateAdd(addConfig.nwCfg.IPAM.Type, addConfig.nwCfg)
+	result, err := invoker.plugin.DelegateAdd(ctx, addConfig.nwCfg.IPAM.Type, addConfig.nwCfg)
 	if err != nil && strings.Contains(err.Error(), ipam.ErrNoAvailableAddressPools.Error()) {
 		invoker.deleteIpamState()
 		logger.Info("Retry pool allocation after deleting IPAM state")
-		result, err = invoker.plugin.DelegateAdd(addConfig.nwCfg.IPAM.Type, addConfig.nwCfg)
+		result, err = invoker.plugin.DelegateAdd(ctx, addConfig.nwCfg.IPAM.Type, addConfig.nwCfg)
 	}
 
+	if err != nil && strings.Contains(err.Error(), ipam.ErrNoAvailableAddressPools.Error()) {
+		err = invoker.plugin.CodedError(cni.ErrIPAMExhausted, fmt.Errorf("Failed to allocate pool: %w", err))
+		return addResult, err
+	}
 	if err != nil {
 		err = invoker.plugin.Errorf("Failed to allocate pool: %v", err)
 		return addResult, err
@@ -73,7 +79,7 @@ func (invoker *AzureIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, er
 	defer func() {
 		if err != nil {
 			if len(addResult.interfaceInfo) > 0 && len(addResult.interfaceInfo[invoker.getInterfaceInfoKey(cns.InfraNIC)].IPConfigs) > 0 {
-				if er := invoker.Delete(&addResult.interfaceInfo[invoker.getInterfaceInfoKey(cns.InfraNIC)].IPConfigs[0].Address, addConfig.nwCfg, nil, addConfig.options); er != nil {
+				if er := invoker.Delete(context.WithoutCancel(ctx), &addResult.interfaceInfo[invoker.getInterfaceInfoKey(cns.InfraNIC)].IPConfigs[0].Address, addConfig.nwCfg, nil, addConfig.options); er != nil {
 					err = invoker.plugin.Errorf("Failed to clean up IP's during Delete with error %v, after Add failed with error %w", er, err)
 				}
 			} else {
@@ -93,7 +99,7 @@ func (invoker *AzureIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, er
 		}
 
 		var ipv6Result *cniTypesCurr.Result
-		ipv6Result, err = invoker.plugin.DelegateAdd(nwCfg6.IPAM.Type, &nwCfg6)
+		ipv6Result, err = invoker.plugin.DelegateAdd(ctx, nwCfg6.IPAM.Type, &nwCfg6)
 		if err != nil {
 			err = invoker.plugin.Errorf("Failed to allocate v6 pool: %v", err)
 		} else {
@@ -133,14 +139,16 @@ func (invoker *AzureIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, er
 }
 
 func (invoker *AzureIPAMInvoker) deleteIpamState() {
-	cniStateExists, err := platform.CheckIfFileExists(platform.CNIStateFilePath)
-	if err != nil {
-		logger.Error("Error checking CNI state exist", zap.Error(err))
-		return
-	}
+	for _, stateFile := range []string{platform.CNIStateFilePath, platform.CNIBoltStateFilePath} {
+		cniStateExists, err := platform.CheckIfFileExists(stateFile)
+		if err != nil {
+			logger.Error("Error checking CNI state exist", zap.Error(err))
+			return
+		}
 
-	if cniStateExists {
-		return
+		if cniStateExists {
+			return
+		}
 	}
 
 	ipamStateExists, err := platform.CheckIfFileExists(platform.CNIIpamStatePath)
@@ -159,7 +167,7 @@ func (invoker *AzureIPAMInvoker) deleteIpamState() {
 	}
 }
 
-func (invoker *AzureIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConfig, _ *cniSkel.CmdArgs, options map[string]interface{}) error { //nolint
+func (invoker *AzureIPAMInvoker) Delete(ctx context.Context, address *net.IPNet, nwCfg *cni.NetworkConfig, _ *cniSkel.CmdArgs, options map[string]interface{}) error { //nolint
 	if nwCfg == nil {
 		return invoker.plugin.Errorf("nil nwCfg passed to CNI ADD, stack: %+v", string(debug.Stack()))
 	}
@@ -169,7 +177,7 @@ func (invoker *AzureIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkCo
 	}
 
 	if address == nil {
-		if err := invoker.plugin.DelegateDel(nwCfg.IPAM.Type, nwCfg); err != nil {
+		if err := invoker.plugin.DelegateDel(ctx, nwCfg.IPAM.Type, nwCfg); err != nil {
 			return invoker.plugin.Errorf("Attempted to release address with error:  %v", err)
 		}
 	} else if len(address.IP.To4()) == bytesSize4 { //nolint:gocritic
@@ -177,7 +185,7 @@ func (invoker *AzureIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkCo
 		logger.Info("Releasing ipv4",
 			zap.String("address", nwCfg.IPAM.Address),
 			zap.String("pool", nwCfg.IPAM.Subnet))
-		if err := invoker.plugin.DelegateDel(nwCfg.IPAM.Type, nwCfg); err != nil {
+		if err := invoker.plugin.DelegateDel(ctx, nwCfg.IPAM.Type, nwCfg); err != nil {
 			logger.Error("Failed to release ipv4 address", zap.Error(err))
 			return invoker.plugin.Errorf("Failed to release ipv4 address: %v", err)
 		}
@@ -198,7 +206,7 @@ func (invoker *AzureIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkCo
 		logger.Info("Releasing ipv6",
 			zap.String("address", nwCfgIpv6.IPAM.Address),
 			zap.String("pool", nwCfgIpv6.IPAM.Subnet))
-		if err := invoker.plugin.DelegateDel(nwCfgIpv6.IPAM.Type, &nwCfgIpv6); err != nil {
+		if err := invoker.plugin.DelegateDel(ctx, nwCfgIpv6.IPAM.Type, &nwCfgIpv6); err != nil {
 			logger.Error("Failed to release ipv6 address", zap.Error(err))
 			return invoker.plugin.Errorf("Failed to release ipv6 address: %v", err)
 		}
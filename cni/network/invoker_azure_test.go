@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -39,7 +40,7 @@ type add struct {
 	errv6            error
 }
 
-func (d *add) DelegateAdd(pluginName string, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error) {
+func (d *add) DelegateAdd(_ context.Context, pluginName string, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error) {
 	if pluginName == ipamV6 {
 		if d.errv6 != nil {
 			return nil, d.errv6
@@ -67,7 +68,7 @@ type del struct {
 	err error
 }
 
-func (d *del) DelegateDel(pluginName string, nwCfg *cni.NetworkConfig) error {
+func (d *del) DelegateDel(_ context.Context, pluginName string, nwCfg *cni.NetworkConfig) error {
 	if d.err != nil {
 		return d.err
 	}
@@ -82,6 +83,10 @@ func (m *mockDelegatePlugin) Errorf(format string, args ...interface{}) *cniType
 	}
 }
 
+func (m *mockDelegatePlugin) CodedError(code uint, err error) *cniTypes.Error {
+	return cniTypes.NewError(code, err.Error(), "")
+}
+
 // net.ParseCIDR will first get the ip, which contains byte data for the ip and mask,
 // and the ipnet, which has a field for the *masked* ip and a field for the mask
 // this function then replaces the masked ip with the "ip" field retrieved earlier and returns the ipnet
@@ -244,7 +249,7 @@ func TestAzureIPAMInvoker_Add(t *testing.T) {
 				nwInfo: tt.fields.nwInfo,
 			}
 
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.in1, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.in1, options: tt.args.options})
 			if tt.wantErr {
 				require.NotNil(err) // use NotNil since *cniTypes.Error is not of type Error
 			} else {
@@ -385,7 +390,7 @@ func TestAzureIPAMInvoker_Delete(t *testing.T) {
 				plugin: tt.fields.plugin,
 				nwInfo: tt.fields.nwInfo,
 			}
-			err := invoker.Delete(tt.args.address, tt.args.nwCfg, tt.args.in2, tt.args.options)
+			err := invoker.Delete(context.Background(), tt.args.address, tt.args.nwCfg, tt.args.in2, tt.args.options)
 			if tt.wantErr {
 				require.NotNil(err)
 				return
@@ -447,7 +452,7 @@ func TestRemoveIpamState_Add(t *testing.T) {
 				nwInfo: tt.fields.nwInfo,
 			}
 
-			_, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.in1, options: tt.args.options})
+			_, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.in1, options: tt.args.options})
 			if tt.wantErr {
 				requires.NotNil(err) // use NotNil since *cniTypes.Error is not of type Error
 				requires.ErrorContains(err, tt.wantErrMsg)
@@ -31,6 +31,7 @@ var (
 	errInvalidArgs           = errors.New("invalid arg(s)")
 	errInvalidDefaultRouting = errors.New("add result requires exactly one interface with default routes")
 	errInvalidGatewayIP      = errors.New("invalid gateway IP")
+	errStaticIPUnavailable   = errors.New("static IP is not available in the node pool")
 	overlayGatewayV6IP       = "fe80::1234:5678:9abc"
 	watcherPath              = "/var/run/azure-vnet/deleteIDs"
 )
@@ -57,6 +58,8 @@ type IPResultInfo struct {
 	routes             []cns.Route
 	pnpID              string
 	endpointPolicies   []policy.Policy
+	secondaryIPConfigs []cns.IPSubnet
+	snatExceptionCIDRs []string
 }
 
 func (i IPResultInfo) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
@@ -71,6 +74,8 @@ func (i IPResultInfo) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
 	encoder.AddString("macAddress", i.macAddress)
 	encoder.AddBool("skipDefaultRoutes", i.skipDefaultRoutes)
 	encoder.AddString("routes", fmt.Sprintf("%+v", i.routes))
+	encoder.AddString("secondaryIPConfigs", fmt.Sprintf("%+v", i.secondaryIPConfigs))
+	encoder.AddString("snatExceptionCIDRs", fmt.Sprintf("%+v", i.snatExceptionCIDRs))
 	return nil
 }
 
@@ -85,7 +90,7 @@ func NewCNSInvoker(podName, namespace string, cnsClient cnsclient, executionMode
 }
 
 // Add uses the requestipconfig API in cns, and returns ipv4 and a nil ipv6 as CNS doesn't support IPv6 yet
-func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, error) {
+func (invoker *CNSIPAMInvoker) Add(ctx context.Context, addConfig IPAMAddConfig) (IPAMAddResult, error) {
 	// Parse Pod arguments.
 	podInfo := cns.KubernetesPodInfo{
 		PodName:      invoker.podName,
@@ -102,18 +107,40 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 		return IPAMAddResult{}, errEmptyCNIArgs
 	}
 
+	staticIPs, err := addConfig.nwCfg.StaticIPs()
+	if err != nil {
+		return IPAMAddResult{}, errors.Wrap(err, "failed to get the static IPs of the pod")
+	}
+
+	ipFamilies, err := addConfig.nwCfg.IPFamilies()
+	if err != nil {
+		return IPAMAddResult{}, errors.Wrap(err, "failed to get the IP families of the pod")
+	}
+
+	secondaryIPs, err := addConfig.nwCfg.SecondaryIPs()
+	if err != nil {
+		return IPAMAddResult{}, errors.Wrap(err, "failed to get the secondary IPs of the pod")
+	}
+
 	ipconfigs := cns.IPConfigsRequest{
 		OrchestratorContext: orchestratorContext,
 		PodInterfaceID:      GetEndpointID(addConfig.args),
 		InfraContainerID:    addConfig.args.ContainerID,
+		DesiredIPAddresses:  staticIPs,
+		IPFamilies:          ipFamilies,
+		SecondaryIPCount:    secondaryIPs,
 	}
 
 	logger.Info("Requesting IP for pod using ipconfig",
 		zap.Any("pod", podInfo),
 		zap.Any("ipconfig", ipconfigs))
-	response, err := invoker.cnsClient.RequestIPs(context.TODO(), ipconfigs)
+	response, err := invoker.cnsClient.RequestIPs(ctx, ipconfigs)
 	if err != nil {
-		if cnscli.IsUnsupportedAPI(err) {
+		if cnscli.IsStaticIPUnavailable(err) {
+			// the pod is pinned to its IPs, waiting for the pool to scale up won't free them
+			return IPAMAddResult{}, errors.Wrapf(errStaticIPUnavailable, "pod is pinned to %v: %v", staticIPs, err)
+		}
+		if cnscli.IsUnsupportedAPI(err) && len(staticIPs) == 0 && len(ipFamilies) == 0 && secondaryIPs == 0 {
 			// If RequestIPs is not supported by CNS, use RequestIPAddress API
 			logger.Error("RequestIPs not supported by CNS. Invoking RequestIPAddress API",
 				zap.Any("infracontainerid", ipconfigs.InfraContainerID))
@@ -123,7 +150,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 				InfraContainerID:    addConfig.args.ContainerID,
 			}
 
-			res, errRequestIP := invoker.cnsClient.RequestIPAddress(context.TODO(), ipconfig)
+			res, errRequestIP := invoker.cnsClient.RequestIPAddress(ctx, ipconfig)
 			if errRequestIP != nil {
 				// if the old API fails as well then we just return the error
 				logger.Error("Failed to request IP address from CNS using RequestIPAddress",
@@ -144,7 +171,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 		}
 	}
 
-	addResult := IPAMAddResult{interfaceInfo: make(map[string]network.InterfaceInfo)}
+	addResult := IPAMAddResult{interfaceInfo: make(map[string]network.InterfaceInfo), allocationStats: response.AllocationStats}
 	numInterfacesWithDefaultRoutes := 0
 
 	for i := 0; i < len(response.PodIPInfo); i++ {
@@ -162,6 +189,8 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 			routes:             response.PodIPInfo[i].Routes,
 			pnpID:              response.PodIPInfo[i].PnPID,
 			endpointPolicies:   response.PodIPInfo[i].EndpointPolicies,
+			secondaryIPConfigs: response.PodIPInfo[i].SecondaryIPConfigs,
+			snatExceptionCIDRs: response.PodIPInfo[i].SNATExceptionCIDRs,
 		}
 
 		logger.Info("Received info for pod",
@@ -172,9 +201,9 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 		// Do we want to leverage this lint skip in other places of our code?
 		key := invoker.getInterfaceInfoKey(info.nicType, info.macAddress)
 		switch info.nicType {
-		case cns.NodeNetworkInterfaceFrontendNIC:
-			// only handling single v4 PodIPInfo for NodeNetworkInterfaceFrontendNIC and AccelnetNIC at the moment, will have to update once v6 gets added
-			if !info.skipDefaultRoutes {
+		case cns.NodeNetworkInterfaceFrontendNIC, cns.NodeNetworkInterfaceAccelnetFrontendNIC:
+			// only count a nic with several pod ips once
+			if _, exist := addResult.interfaceInfo[key]; !exist && !info.skipDefaultRoutes {
 				numInterfacesWithDefaultRoutes++
 			}
 
@@ -251,26 +280,14 @@ func setHostOptions(ncSubnetPrefix *net.IPNet, options map[string]interface{}, i
 	// we need to snat IMDS traffic to node IP, this sets up snat '--to'
 	snatHostIPJump := fmt.Sprintf("%s --to %s", iptables.Snat, info.hostPrimaryIP)
 
+	// the rules are programmed in a single transaction, which skips the chain and rules that already exist
 	iptablesClient := iptables.NewClient()
-	var iptableCmds []iptables.IPTableEntry
-	if !iptablesClient.ChainExists(iptables.V4, iptables.Nat, iptables.Swift) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetCreateChainCmd(iptables.V4, iptables.Nat, iptables.Swift))
-	}
-
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Postrouting, "", iptables.Swift) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetAppendIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Postrouting, "", iptables.Swift))
-	}
-
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Swift, azureDNSUDPMatch, snatPrimaryIPJump) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureDNSUDPMatch, snatPrimaryIPJump))
-	}
-
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Swift, azureDNSTCPMatch, snatPrimaryIPJump) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureDNSTCPMatch, snatPrimaryIPJump))
-	}
-
-	if !iptablesClient.RuleExists(iptables.V4, iptables.Nat, iptables.Swift, azureIMDSMatch, snatHostIPJump) {
-		iptableCmds = append(iptableCmds, iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureIMDSMatch, snatHostIPJump))
+	iptableCmds := []iptables.IPTableEntry{
+		iptablesClient.GetCreateChainCmd(iptables.V4, iptables.Nat, iptables.Swift),
+		iptablesClient.GetAppendIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Postrouting, "", iptables.Swift),
+		iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureDNSUDPMatch, snatPrimaryIPJump),
+		iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureDNSTCPMatch, snatPrimaryIPJump),
+		iptablesClient.GetInsertIptableRuleCmd(iptables.V4, iptables.Nat, iptables.Swift, azureIMDSMatch, snatHostIPJump),
 	}
 
 	options[network.IPTablesKey] = iptableCmds
@@ -279,7 +296,7 @@ func setHostOptions(ncSubnetPrefix *net.IPNet, options map[string]interface{}, i
 }
 
 // Delete calls into the releaseipconfiguration API in CNS
-func (invoker *CNSIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConfig, args *cniSkel.CmdArgs, _ map[string]interface{}) error { //nolint
+func (invoker *CNSIPAMInvoker) Delete(ctx context.Context, address *net.IPNet, nwCfg *cni.NetworkConfig, args *cniSkel.CmdArgs, _ map[string]interface{}) error { //nolint
 	var connectionErr *cnscli.ConnectionFailureErr
 	// Parse Pod arguments.
 	podInfo := cns.KubernetesPodInfo{
@@ -308,7 +325,7 @@ func (invoker *CNSIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConf
 		logger.Info("CNS invoker called with empty IP address")
 	}
 
-	if err := invoker.cnsClient.ReleaseIPs(context.TODO(), ipConfigs); err != nil {
+	if err := invoker.cnsClient.ReleaseIPs(ctx, ipConfigs); err != nil {
 		if cnscli.IsUnsupportedAPI(err) {
 			// If ReleaseIPs is not supported by CNS, use ReleaseIPAddress API
 			logger.Error("ReleaseIPs not supported by CNS. Invoking ReleaseIPAddress API",
@@ -320,7 +337,7 @@ func (invoker *CNSIPAMInvoker) Delete(address *net.IPNet, nwCfg *cni.NetworkConf
 				InfraContainerID:    args.ContainerID,
 			}
 
-			if err = invoker.cnsClient.ReleaseIPAddress(context.TODO(), ipConfig); err != nil {
+			if err = invoker.cnsClient.ReleaseIPAddress(ctx, ipConfig); err != nil {
 				if errors.As(err, &connectionErr) {
 					addErr := fsnotify.AddFile(ipConfigs.PodInterfaceID, args.ContainerID, watcherPath)
 					if addErr != nil {
@@ -371,8 +388,11 @@ func getRoutes(cnsRoutes []cns.Route, skipDefaultRoutes bool) ([]network.RouteIn
 
 		routes = append(routes,
 			network.RouteInfo{
-				Dst: *dst,
-				Gw:  gw,
+				Dst:    *dst,
+				Gw:     gw,
+				MTU:    route.MTU,
+				AdvMSS: route.AdvMSS,
+				OnLink: route.OnLink,
 			})
 	}
 
@@ -433,6 +453,13 @@ func configureDefaultAddResult(info *IPResultInfo, addConfig *IPAMAddConfig, add
 				Gateway: ncgw,
 			})
 
+		// secondary ips share the interface, gateway and routes of the primary pod ip
+		secondaryIPConfigs, getSecondaryIPsErr := getSecondaryIPConfigs(info.secondaryIPConfigs, ncgw)
+		if getSecondaryIPsErr != nil {
+			return getSecondaryIPsErr
+		}
+		ipConfigs = append(ipConfigs, secondaryIPConfigs...)
+
 		routes, getRoutesErr := getRoutes(info.routes, info.skipDefaultRoutes)
 		if getRoutesErr != nil {
 			return getRoutesErr
@@ -442,6 +469,10 @@ func configureDefaultAddResult(info *IPResultInfo, addConfig *IPAMAddConfig, add
 		if len(routes) > 0 {
 			resRoute = append(resRoute, routes...)
 		} else { // add default routes if none are provided
+			// the gateway of a point-to-point pod ip is outside its subnet, it is routed on link first
+			if !overlayMode {
+				resRoute = append(resRoute, getOnLinkGatewayRoutes(ncIPNet, ncgw)...)
+			}
 			resRoute = append(resRoute, network.RouteInfo{
 				Dst: defaultRouteDstPrefix,
 				Gw:  ncgw,
@@ -451,12 +482,13 @@ func configureDefaultAddResult(info *IPResultInfo, addConfig *IPAMAddConfig, add
 		// if we have multiple infra ip result infos, we effectively append routes and ip configs to that same interface info each time
 		// the host subnet prefix (in ipv4 or ipv6) will always refer to the same interface regardless of which ip result info we look at
 		addResult.interfaceInfo[key] = network.InterfaceInfo{
-			NICType:           cns.InfraNIC,
-			SkipDefaultRoutes: info.skipDefaultRoutes,
-			IPConfigs:         ipConfigs,
-			Routes:            resRoute,
-			HostSubnetPrefix:  *hostIPNet,
-			EndpointPolicies:  info.endpointPolicies,
+			NICType:            cns.InfraNIC,
+			SkipDefaultRoutes:  info.skipDefaultRoutes,
+			IPConfigs:          ipConfigs,
+			Routes:             resRoute,
+			HostSubnetPrefix:   *hostIPNet,
+			EndpointPolicies:   info.endpointPolicies,
+			SNATExceptionCIDRs: info.snatExceptionCIDRs,
 		}
 	}
 
@@ -472,6 +504,26 @@ func configureDefaultAddResult(info *IPResultInfo, addConfig *IPAMAddConfig, add
 	return nil
 }
 
+func getSecondaryIPConfigs(secondaryIPs []cns.IPSubnet, gateway net.IP) ([]*network.IPConfig, error) {
+	ipConfigs := make([]*network.IPConfig, 0, len(secondaryIPs))
+	for i := range secondaryIPs {
+		ip, ipnet, err := secondaryIPs[i].GetIPNet()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse secondary IP %s from response", secondaryIPs[i].IPAddress)
+		}
+
+		ipConfigs = append(ipConfigs, &network.IPConfig{
+			Address: net.IPNet{
+				IP:   ip,
+				Mask: ipnet.Mask,
+			},
+			Gateway: gateway,
+		})
+	}
+
+	return ipConfigs, nil
+}
+
 func configureSecondaryAddResult(info *IPResultInfo, addResult *IPAMAddResult, podIPConfig *cns.IPSubnet, key string) error {
 	ip, ipnet, err := podIPConfig.GetIPNet()
 	if ip == nil {
@@ -489,25 +541,60 @@ func configureSecondaryAddResult(info *IPResultInfo, addResult *IPAMAddResult, p
 		return err
 	}
 
-	addResult.interfaceInfo[key] = network.InterfaceInfo{
-		IPConfigs: []*network.IPConfig{
-			{
-				Address: net.IPNet{
-					IP:   ip,
-					Mask: ipnet.Mask,
-				},
-				Gateway: net.ParseIP(info.ncGatewayIPAddress),
+	// a nic with several pod ips, of the same family or not, has a pod ip info for each of them with the same mac, their
+	// ip configs are all added to the one interface info
+	gateway := net.ParseIP(info.ncGatewayIPAddress)
+	ipConfigs := addResult.interfaceInfo[key].IPConfigs
+	ipConfigs = append(ipConfigs,
+		&network.IPConfig{
+			Address: net.IPNet{
+				IP:   ip,
+				Mask: ipnet.Mask,
 			},
-		},
-		Routes:            routes,
+			Gateway: gateway,
+		})
+
+	// secondary ips share the interface, gateway and routes of the primary pod ip
+	secondaryIPConfigs, err := getSecondaryIPConfigs(info.secondaryIPConfigs, gateway)
+	if err != nil {
+		return err
+	}
+	ipConfigs = append(ipConfigs, secondaryIPConfigs...)
+
+	// the pod ips of a nic usually carry the same routes, which are only added once
+	resRoutes := routes
+	if ifInfo, exist := addResult.interfaceInfo[key]; exist {
+		resRoutes = ifInfo.Routes
+		for _, route := range routes {
+			if !containsRoute(resRoutes, route) {
+				resRoutes = append(resRoutes, route)
+			}
+		}
+	}
+
+	addResult.interfaceInfo[key] = network.InterfaceInfo{
+		IPConfigs:         ipConfigs,
+		Routes:            resRoutes,
 		NICType:           info.nicType,
 		MacAddress:        macAddress,
 		SkipDefaultRoutes: info.skipDefaultRoutes,
+		EndpointPolicies:  info.endpointPolicies,
+		PnPID:             info.pnpID,
 	}
 
 	return nil
 }
 
+// containsRoute returns whether the route, by destination and gateway, is in routes.
+func containsRoute(routes []network.RouteInfo, route network.RouteInfo) bool {
+	for i := range routes {
+		if routes[i].Dst.String() == route.Dst.String() && routes[i].Gw.Equal(route.Gw) {
+			return true
+		}
+	}
+	return false
+}
+
 func addBackendNICToResult(info *IPResultInfo, addResult *IPAMAddResult, key string) error {
 	macAddress, err := net.ParseMAC(info.macAddress)
 	if err != nil {
@@ -532,7 +619,7 @@ func addBackendNICToResult(info *IPResultInfo, addResult *IPAMAddResult, key str
 }
 
 func (invoker *CNSIPAMInvoker) getInterfaceInfoKey(nicType cns.NICType, macAddress string) string {
-	if nicType == cns.NodeNetworkInterfaceFrontendNIC || nicType == cns.BackendNIC {
+	if nicType.IsFrontendNIC() || nicType == cns.BackendNIC {
 		return macAddress
 	}
 	return string(nicType)
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -10,6 +11,8 @@ import (
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cni/util"
 	"github.com/Azure/azure-container-networking/cns"
+	cnscli "github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/network/policy"
@@ -147,6 +150,94 @@ func TestCNSIPAMInvoker_Add_Overlay(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Test happy CNI Overlay add with secondary ips on the infra nic",
+			fields: fields{
+				podName:      testPodInfo.PodName,
+				podNamespace: testPodInfo.PodNamespace,
+				ipamMode:     util.Overlay,
+				cnsClient: &MockCNSClient{
+					require: require,
+					requestIPs: requestIPsHandler{
+						ipconfigArgument: getTestIPConfigsRequest(),
+						result: &cns.IPConfigsResponse{
+							PodIPInfo: []cns.PodIpInfo{
+								{
+									PodIPConfig: cns.IPSubnet{
+										IPAddress:    "10.240.1.242",
+										PrefixLength: 16,
+									},
+									SecondaryIPConfigs: []cns.IPSubnet{
+										{
+											IPAddress:    "10.240.1.243",
+											PrefixLength: 16,
+										},
+										{
+											IPAddress:    "10.240.1.244",
+											PrefixLength: 16,
+										},
+									},
+									NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+										IPSubnet: cns.IPSubnet{
+											IPAddress:    "10.240.1.0",
+											PrefixLength: 16,
+										},
+										DNSServers:       nil,
+										GatewayIPAddress: "",
+									},
+									HostPrimaryIPInfo: cns.HostIPInfo{
+										Gateway:   "10.224.0.1",
+										PrimaryIP: "10.224.0.5",
+										Subnet:    "10.224.0.0/16",
+									},
+									NICType: cns.InfraNIC,
+								},
+							},
+							Response: cns.Response{
+								ReturnCode: 0,
+								Message:    "",
+							},
+						},
+						err: nil,
+					},
+				},
+			},
+			args: args{
+				nwCfg: &cni.NetworkConfig{},
+				args: &cniSkel.CmdArgs{
+					ContainerID: "testcontainerid",
+					Netns:       "testnetns",
+					IfName:      "testifname",
+				},
+				hostSubnetPrefix: getCIDRNotationForAddress("10.224.0.0/16"),
+				options:          map[string]interface{}{},
+			},
+			wantDefaultResult: network.InterfaceInfo{
+				IPConfigs: []*network.IPConfig{
+					{
+						Address: *getCIDRNotationForAddress("10.240.1.242/16"),
+						Gateway: getTestOverlayGateway(),
+					},
+					{
+						Address: *getCIDRNotationForAddress("10.240.1.243/16"),
+						Gateway: getTestOverlayGateway(),
+					},
+					{
+						Address: *getCIDRNotationForAddress("10.240.1.244/16"),
+						Gateway: getTestOverlayGateway(),
+					},
+				},
+				Routes: []network.RouteInfo{
+					{
+						Dst: network.Ipv4DefaultRouteDstPrefix,
+						Gw:  getTestOverlayGateway(),
+					},
+				},
+				NICType:          cns.InfraNIC,
+				HostSubnetPrefix: *parseCIDR("10.224.0.0/16"),
+			},
+			wantErr: false,
+		},
 		{
 			name: "Test happy CNI Overlay add in dualstack overlay ipamMode",
 			fields: fields{
@@ -486,7 +577,7 @@ func TestCNSIPAMInvoker_Add_Overlay(t *testing.T) {
 			if tt.fields.ipamMode != "" {
 				invoker.ipamMode = tt.fields.ipamMode
 			}
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if tt.wantErr {
 				require.Error(err)
 			} else {
@@ -837,7 +928,7 @@ func TestCNSIPAMInvoker_Add(t *testing.T) {
 			if tt.fields.ipamMode != "" {
 				invoker.ipamMode = tt.fields.ipamMode
 			}
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if tt.wantErr {
 				require.Equalf([]policy.Policy(nil), ipamAddResult.interfaceInfo[string(cns.InfraNIC)].EndpointPolicies, "There was an error requesting IP addresses from cns")
 				require.Error(err)
@@ -973,7 +1064,7 @@ func TestCNSIPAMInvoker_Add_UnsupportedAPI(t *testing.T) {
 			if tt.fields.ipamMode != "" {
 				invoker.ipamMode = tt.fields.ipamMode
 			}
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if err != nil && tt.wantErr {
 				t.Fatalf("expected an error %+v but none received", err)
 			}
@@ -988,6 +1079,142 @@ func TestCNSIPAMInvoker_Add_UnsupportedAPI(t *testing.T) {
 	}
 }
 
+func TestCNSIPAMInvoker_Add_StaticIP(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{
+		RuntimeConfig: cni.RuntimeConfig{PodAnnotations: map[string]string{cni.StaticIPAnnotation: "10.0.1.10"}},
+	}
+	args := &cniSkel.CmdArgs{ContainerID: "testcontainerid", Netns: "testnetns", IfName: "testifname"}
+	req := getTestIPConfigsRequest()
+	req.DesiredIPAddresses = []string{"10.0.1.10"}
+	response := &cns.IPConfigsResponse{
+		PodIPInfo: []cns.PodIpInfo{
+			{
+				PodIPConfig: cns.IPSubnet{IPAddress: "10.0.1.10", PrefixLength: 24},
+				NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+					IPSubnet:         cns.IPSubnet{IPAddress: "10.0.1.0", PrefixLength: 24},
+					GatewayIPAddress: "10.0.0.1",
+				},
+				HostPrimaryIPInfo: cns.HostIPInfo{Gateway: "10.0.0.1", PrimaryIP: "10.0.0.1", Subnet: "10.0.0.0/24"},
+				NICType:           cns.InfraNIC,
+			},
+		},
+	}
+
+	// the pinned IP is requested from CNS
+	invoker := &CNSIPAMInvoker{
+		podName:      testPodInfo.PodName,
+		podNamespace: testPodInfo.PodNamespace,
+		cnsClient: &MockCNSClient{
+			require:    require.New(t),
+			requestIPs: requestIPsHandler{ipconfigArgument: req, result: response},
+		},
+	}
+	result, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.NoError(t, err)
+	require.Len(t, result.interfaceInfo, 1)
+
+	// the pinned IP is taken, which fails the add without falling back to another IP
+	invoker.cnsClient = &MockCNSClient{
+		require: require.New(t),
+		requestIPs: requestIPsHandler{
+			ipconfigArgument: req,
+			err:              &cnscli.CNSClientError{Code: types.StaticIPUnavailable, Err: errors.New("IP is assigned")},
+		},
+	}
+	_, err = invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.ErrorIs(t, err, errStaticIPUnavailable)
+
+	// the pod is pinned to an invalid IP
+	nwCfg.RuntimeConfig.PodAnnotations[cni.StaticIPAnnotation] = "not-an-ip"
+	_, err = invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.ErrorIs(t, err, cni.ErrInvalidStaticIP)
+}
+
+func TestCNSIPAMInvoker_Add_IPFamilies(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{
+		RuntimeConfig: cni.RuntimeConfig{PodAnnotations: map[string]string{cni.IPFamiliesAnnotation: "IPv6"}},
+	}
+	args := &cniSkel.CmdArgs{ContainerID: "testcontainerid", Netns: "testnetns", IfName: "testifname"}
+	req := getTestIPConfigsRequest()
+	req.IPFamilies = []cns.IPFamily{cns.IPv6Family}
+	response := &cns.IPConfigsResponse{
+		PodIPInfo: []cns.PodIpInfo{
+			{
+				PodIPConfig: cns.IPSubnet{IPAddress: "fd11:1234::1", PrefixLength: 112},
+				NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+					IPSubnet:         cns.IPSubnet{IPAddress: "fd11:1234::", PrefixLength: 112},
+					GatewayIPAddress: "fe80::1234:5678:9abc",
+				},
+				HostPrimaryIPInfo: cns.HostIPInfo{Gateway: "fe80::1234:5678:9abc", PrimaryIP: "fe80::1234:5678:9abc", Subnet: "fd11:1234::/112"},
+				NICType:           cns.InfraNIC,
+			},
+		},
+	}
+
+	// the requested families are passed to CNS
+	invoker := &CNSIPAMInvoker{
+		podName:      testPodInfo.PodName,
+		podNamespace: testPodInfo.PodNamespace,
+		cnsClient: &MockCNSClient{
+			require:    require.New(t),
+			requestIPs: requestIPsHandler{ipconfigArgument: req, result: response},
+		},
+	}
+	result, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.NoError(t, err)
+	require.True(t, result.ipv6Enabled)
+
+	nwCfg.RuntimeConfig.PodAnnotations[cni.IPFamiliesAnnotation] = "IPv7"
+	_, err = invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.ErrorIs(t, err, cni.ErrInvalidIPFamilies)
+}
+
+func TestCNSIPAMInvoker_Add_SecondaryIPs(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{
+		RuntimeConfig: cni.RuntimeConfig{PodAnnotations: map[string]string{cni.SecondaryIPsAnnotation: "1"}},
+	}
+	args := &cniSkel.CmdArgs{ContainerID: "testcontainerid", Netns: "testnetns", IfName: "testifname"}
+	req := getTestIPConfigsRequest()
+	req.SecondaryIPCount = 1
+	response := &cns.IPConfigsResponse{
+		PodIPInfo: []cns.PodIpInfo{
+			{
+				PodIPConfig:        cns.IPSubnet{IPAddress: "10.0.1.10", PrefixLength: 24},
+				SecondaryIPConfigs: []cns.IPSubnet{{IPAddress: "10.0.1.11", PrefixLength: 24}},
+				NetworkContainerPrimaryIPConfig: cns.IPConfiguration{
+					IPSubnet:         cns.IPSubnet{IPAddress: "10.0.1.0", PrefixLength: 24},
+					GatewayIPAddress: "10.0.0.1",
+				},
+				HostPrimaryIPInfo: cns.HostIPInfo{Gateway: "10.0.0.1", PrimaryIP: "10.0.0.1", Subnet: "10.0.0.0/24"},
+				NICType:           cns.InfraNIC,
+			},
+		},
+	}
+
+	// the requested secondary IPs are passed to CNS and programmed with the pod IP
+	invoker := &CNSIPAMInvoker{
+		podName:      testPodInfo.PodName,
+		podNamespace: testPodInfo.PodNamespace,
+		cnsClient: &MockCNSClient{
+			require:    require.New(t),
+			requestIPs: requestIPsHandler{ipconfigArgument: req, result: response},
+		},
+	}
+	result, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.NoError(t, err)
+	var ips []string
+	for _, ifInfo := range result.interfaceInfo {
+		for _, ipConfig := range ifInfo.IPConfigs {
+			ips = append(ips, ipConfig.Address.IP.String())
+		}
+	}
+	require.Equal(t, []string{"10.0.1.10", "10.0.1.11"}, ips)
+
+	nwCfg.RuntimeConfig.PodAnnotations[cni.SecondaryIPsAnnotation] = "many"
+	_, err = invoker.Add(context.Background(), IPAMAddConfig{nwCfg: nwCfg, args: args, options: map[string]interface{}{}})
+	require.ErrorIs(t, err, cni.ErrInvalidSecondaryIPs)
+}
+
 func TestRequestIPAPIsFail(t *testing.T) {
 	require := require.New(t) //nolint further usage of require without passing t
 
@@ -1092,7 +1319,7 @@ func TestRequestIPAPIsFail(t *testing.T) {
 			if tt.fields.ipamMode != "" {
 				invoker.ipamMode = tt.fields.ipamMode
 			}
-			_, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			_, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if err == nil && tt.wantErr {
 				t.Fatalf("expected an error %+v but none received", err)
 			}
@@ -1167,7 +1394,7 @@ func TestCNSIPAMInvoker_Delete(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			err := invoker.Delete(tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
+			err := invoker.Delete(context.Background(), tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
 			if tt.wantErr {
 				require.Error(err)
 			} else {
@@ -1258,7 +1485,7 @@ func TestCNSIPAMInvoker_Delete_Overlay(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			err := invoker.Delete(tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
+			err := invoker.Delete(context.Background(), tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
 			if tt.wantErr {
 				require.Error(err)
 			} else {
@@ -1323,7 +1550,7 @@ func TestCNSIPAMInvoker_Delete_NotSupportedAPI(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			err := invoker.Delete(tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
+			err := invoker.Delete(context.Background(), tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
 			if tt.wantErr {
 				require.Error(err)
 			} else {
@@ -1383,7 +1610,7 @@ func TestReleaseIPAPIsFail(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			err := invoker.Delete(tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
+			err := invoker.Delete(context.Background(), tt.args.address, tt.args.nwCfg, tt.args.args, tt.args.options)
 			if !errors.Is(err, errNoReleaseIPFound) {
 				t.Fatalf("expected an error %s but %v received", errNoReleaseIPFound, err)
 			}
@@ -1593,6 +1820,93 @@ func TestCNSIPAMInvoker_Add_SwiftV2(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Test happy CNI add delegatedVMNIC type with several ips",
+			fields: fields{
+				podName:      testPodInfo.PodName,
+				podNamespace: testPodInfo.PodNamespace,
+				cnsClient: &MockCNSClient{
+					require: require,
+					requestIPs: requestIPsHandler{
+						ipconfigArgument: cns.IPConfigsRequest{
+							PodInterfaceID:      "testcont-testifname1",
+							InfraContainerID:    "testcontainerid1",
+							OrchestratorContext: marshallPodInfo(testPodInfo),
+						},
+						result: &cns.IPConfigsResponse{
+							PodIPInfo: []cns.PodIpInfo{
+								{
+									PodIPConfig: cns.IPSubnet{
+										IPAddress:    "10.1.1.10",
+										PrefixLength: 24,
+									},
+									SecondaryIPConfigs: []cns.IPSubnet{
+										{
+											IPAddress:    "10.1.1.11",
+											PrefixLength: 24,
+										},
+									},
+									HostPrimaryIPInfo: cns.HostIPInfo{
+										Gateway:   "10.0.0.1",
+										PrimaryIP: "10.0.0.2",
+										Subnet:    "10.0.0.1/24",
+									},
+									NICType:    cns.NodeNetworkInterfaceFrontendNIC,
+									MacAddress: macAddress,
+								},
+								{
+									PodIPConfig: cns.IPSubnet{
+										IPAddress:    "10.1.1.12",
+										PrefixLength: 24,
+									},
+									HostPrimaryIPInfo: cns.HostIPInfo{
+										Gateway:   "10.0.0.1",
+										PrimaryIP: "10.0.0.2",
+										Subnet:    "10.0.0.1/24",
+									},
+									NICType:    cns.NodeNetworkInterfaceFrontendNIC,
+									MacAddress: macAddress,
+								},
+							},
+							Response: cns.Response{
+								ReturnCode: 0,
+								Message:    "",
+							},
+						},
+						err: nil,
+					},
+				},
+			},
+			args: args{
+				nwCfg: &cni.NetworkConfig{},
+				args: &cniSkel.CmdArgs{
+					ContainerID: "testcontainerid1",
+					Netns:       "testnetns1",
+					IfName:      "testifname1",
+				},
+				hostSubnetPrefix: getCIDRNotationForAddress("10.0.0.1/24"),
+				options:          map[string]interface{}{},
+			},
+			wantSecondaryInterfacesInfo: map[string]network.InterfaceInfo{
+				macAddress: {
+					IPConfigs: []*network.IPConfig{
+						{
+							Address: *getCIDRNotationForAddress("10.1.1.10/24"),
+						},
+						{
+							Address: *getCIDRNotationForAddress("10.1.1.11/24"),
+						},
+						{
+							Address: *getCIDRNotationForAddress("10.1.1.12/24"),
+						},
+					},
+					Routes:     []network.RouteInfo{},
+					NICType:    cns.NodeNetworkInterfaceFrontendNIC,
+					MacAddress: parsedMacAddress,
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Test happy CNI add with DelegatedNIC + BackendNIC interfaces",
 			fields: fields{
@@ -1786,7 +2100,7 @@ func TestCNSIPAMInvoker_Add_SwiftV2(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if tt.wantErr {
 				require.Error(err)
 			} else {
@@ -2065,7 +2379,11 @@ func TestAddNICsToCNIResult(t *testing.T) {
 				macAddress: {
 					MacAddress: newParsedMacAddress,
 					NICType:    cns.NodeNetworkInterfaceFrontendNIC,
+					// the new ip is added to the ones of the nic
 					IPConfigs: []*network.IPConfig{
+						{
+							Address: *getCIDRNotationForAddress("20.1.1.10/24"),
+						},
 						{
 							Address: net.IPNet{
 								IP:   newIP,
@@ -2087,7 +2405,7 @@ func TestAddNICsToCNIResult(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if err != nil {
 				t.Fatalf("Failed to create ipamAddResult due to error: %v", err)
 			}
@@ -2272,7 +2590,7 @@ func TestMultipleIBNICsToResult(t *testing.T) {
 				podNamespace: tt.fields.podNamespace,
 				cnsClient:    tt.fields.cnsClient,
 			}
-			ipamAddResult, err := invoker.Add(IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
+			ipamAddResult, err := invoker.Add(context.Background(), IPAMAddConfig{nwCfg: tt.args.nwCfg, args: tt.args.args, options: tt.args.options})
 			if err != nil {
 				t.Fatalf("Failed to create ipamAddResult due to error: %v", err)
 			}
@@ -2298,3 +2616,18 @@ func TestMultipleIBNICsToResult(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRoutes(t *testing.T) {
+	routes, err := getRoutes([]cns.Route{
+		{IPAddress: "10.0.0.0/8", GatewayIPAddress: "10.240.0.1", MTU: 1400, AdvMSS: 1360, OnLink: true},
+		{IPAddress: "192.168.0.0/16", GatewayIPAddress: "10.240.0.1"},
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, []network.RouteInfo{
+		{Dst: *parseCIDR("10.0.0.0/8"), Gw: net.ParseIP("10.240.0.1"), MTU: 1400, AdvMSS: 1360, OnLink: true},
+		{Dst: *parseCIDR("192.168.0.0/16"), Gw: net.ParseIP("10.240.0.1")},
+	}, routes)
+
+	_, err = getRoutes([]cns.Route{{IPAddress: "10.0.0.0/8"}}, true)
+	require.ErrorIs(t, err, errInvalidGatewayIP)
+}
@@ -191,17 +191,15 @@ func (m *Multitenancy) SetupRoutingForMultitenancy(
 func (m *Multitenancy) GetAllNetworkContainers(
 	ctx context.Context, nwCfg *cni.NetworkConfig, podName, podNamespace, ifName string,
 ) (IPAMAddResult, error) {
-	var podNameWithoutSuffix string
-
-	if !nwCfg.EnableExactMatchForPodName {
-		podNameWithoutSuffix = network.GetPodNameWithoutSuffix(podName)
-	} else {
-		podNameWithoutSuffix = podName
+	podInfo, err := cnsPodInfo(nwCfg, podName, podNamespace)
+	if err != nil {
+		return IPAMAddResult{}, err
 	}
 
-	logger.Info("Podname without suffix", zap.String("podName", podNameWithoutSuffix))
+	logger.Info("Pod name the network containers are found with", zap.String("podName", podInfo.PodName),
+		zap.String("podNameMatch", string(podInfo.PodNameMatch)))
 
-	ncResponses, hostSubnetPrefixes, err := m.getNetworkContainersInternal(ctx, podNamespace, podNameWithoutSuffix)
+	ncResponses, hostSubnetPrefixes, err := m.getNetworkContainersInternal(ctx, podInfo, nwCfg.SnatBridgeSubnet)
 	if err != nil {
 		return IPAMAddResult{}, fmt.Errorf("%w", err)
 	}
@@ -238,15 +236,11 @@ func (m *Multitenancy) GetAllNetworkContainers(
 	return ipamResult, err
 }
 
-// get all network containers configuration for given orchestratorContext
+// get all network containers configuration for given orchestratorContext, with their snat ip in the snat bridge subnet
+// when it is set
 func (m *Multitenancy) getNetworkContainersInternal(
-	ctx context.Context, namespace, podName string,
+	ctx context.Context, podInfo cns.KubernetesPodInfo, snatBridgeSubnet string,
 ) ([]cns.GetNetworkContainerResponse, []net.IPNet, error) {
-	podInfo := cns.KubernetesPodInfo{
-		PodName:      podName,
-		PodNamespace: namespace,
-	}
-
 	orchestratorContext, err := json.Marshal(podInfo)
 	if err != nil {
 		logger.Error("Marshalling KubernetesPodInfo failed", zap.Error(err))
@@ -255,7 +249,7 @@ func (m *Multitenancy) getNetworkContainersInternal(
 
 	// First try the new CNS API that returns slice of nc responses. If CNS doesn't support the new API, an error will be returned and as a result
 	// try using the old CNS API that returns single nc response.
-	ncConfigs, err := m.cnsclient.GetAllNetworkContainers(ctx, orchestratorContext)
+	ncConfigs, err := m.cnsclient.GetAllNetworkContainers(ctx, orchestratorContext, snatBridgeSubnet)
 	if err != nil && client.IsUnsupportedAPI(err) {
 		ncConfig, errGetNC := m.cnsclient.GetNetworkContainer(ctx, orchestratorContext)
 		if errGetNC != nil {
@@ -268,6 +262,10 @@ func (m *Multitenancy) getNetworkContainersInternal(
 
 	logger.Info("Network config received from cns", zap.Any("nconfig", ncConfigs))
 
+	if err := checkSnatBridgeSubnet(ncConfigs, snatBridgeSubnet); err != nil {
+		return nil, []net.IPNet{}, err
+	}
+
 	subnetPrefixes := []net.IPNet{}
 	for i := 0; i < len(ncConfigs); i++ {
 		subnetPrefix := m.netioshim.GetInterfaceSubnetWithSpecificIP(ncConfigs[i].PrimaryInterfaceIdentifier)
@@ -348,17 +346,37 @@ func convertToIPConfigAndRouteInfo(networkConfig *cns.GetNetworkContainerRespons
 	return ipconfig, routes
 }
 
+// infraVnetAddressSpaces returns the subnets of the infra vnet address space, a comma separated list with a subnet per
+// ip family on dual stack.
+func infraVnetAddressSpaces(nwCfg *cni.NetworkConfig) []*net.IPNet {
+	ipNets := []*net.IPNet{}
+	for _, space := range strings.Split(nwCfg.InfraVnetAddressSpace, ",") {
+		if _, ipNet, err := net.ParseCIDR(strings.TrimSpace(space)); err == nil {
+			ipNets = append(ipNets, ipNet)
+		}
+	}
+	return ipNets
+}
+
 func checkIfSubnetOverlaps(enableInfraVnet bool, nwCfg *cni.NetworkConfig, cnsNetworkConfig *cns.GetNetworkContainerResponse) bool {
 	if enableInfraVnet {
 		if cnsNetworkConfig != nil {
-			_, infraNet, _ := net.ParseCIDR(nwCfg.InfraVnetAddressSpace)
-			for _, cnetSpace := range cnsNetworkConfig.CnetAddressSpace {
-				cnetSpaceIPNet := &net.IPNet{
-					IP:   net.ParseIP(cnetSpace.IPAddress),
-					Mask: net.CIDRMask(int(cnetSpace.PrefixLength), ipv4FullMask),
-				}
+			for _, infraNet := range infraVnetAddressSpaces(nwCfg) {
+				for _, cnetSpace := range cnsNetworkConfig.CnetAddressSpace {
+					cnetSpaceIP := net.ParseIP(cnetSpace.IPAddress)
+					fullMask := ipv6FullMask
+					if cnetSpaceIP.To4() != nil {
+						fullMask = ipv4FullMask
+					}
+					cnetSpaceIPNet := &net.IPNet{
+						IP:   cnetSpaceIP,
+						Mask: net.CIDRMask(int(cnetSpace.PrefixLength), fullMask),
+					}
 
-				return infraNet.Contains(cnetSpaceIPNet.IP) || cnetSpaceIPNet.Contains(infraNet.IP)
+					if infraNet.Contains(cnetSpaceIPNet.IP) || cnetSpaceIPNet.Contains(infraNet.IP) {
+						return true
+					}
+				}
 			}
 		}
 	}
@@ -366,6 +384,26 @@ func checkIfSubnetOverlaps(enableInfraVnet bool, nwCfg *cni.NetworkConfig, cnsNe
 	return false
 }
 
+// checkSnatBridgeSubnet returns an error when the snat ip of an NC is not in the snat bridge subnet, which a cns
+// without support for it leaves the snat ip out of.
+func checkSnatBridgeSubnet(ncConfigs []cns.GetNetworkContainerResponse, snatBridgeSubnet string) error {
+	if snatBridgeSubnet == "" {
+		return nil
+	}
+
+	_, subnet, err := net.ParseCIDR(snatBridgeSubnet)
+	if err != nil {
+		return fmt.Errorf("invalid snatBridgeSubnet %s: %w", snatBridgeSubnet, err)
+	}
+	for i := range ncConfigs {
+		snatIP := net.ParseIP(ncConfigs[i].LocalIPConfiguration.IPSubnet.IPAddress)
+		if snatIP != nil && !subnet.Contains(snatIP) {
+			return fmt.Errorf("%w: snat ip %s of nc %s", errSnatBridgeSubnet, snatIP, ncConfigs[i].NetworkContainerID)
+		}
+	}
+	return nil
+}
+
 func (m *Multitenancy) getInterfaceInfoKey(nicType cns.NICType, i int) string {
 	return string(nicType) + strconv.Itoa(i)
 }
@@ -375,4 +413,6 @@ var (
 	errInfraVnet     = errors.New("infravnet not populated")
 	errSubnetOverlap = errors.New("subnet overlap error")
 	errIfaceNotFound = errors.New("Interface not found for this ip")
+
+	errSnatBridgeSubnet = errors.New("snat ip is not in the snatBridgeSubnet, cns may not support it")
 )
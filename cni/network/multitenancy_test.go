@@ -141,7 +141,7 @@ func (c *MockCNSClient) GetNetworkContainer(ctx context.Context, orchestratorCon
 	return c.getNetworkContainerConfiguration.returnResponse, c.getNetworkContainerConfiguration.err
 }
 
-func (c *MockCNSClient) GetAllNetworkContainers(ctx context.Context, orchestratorContext []byte) ([]cns.GetNetworkContainerResponse, error) {
+func (c *MockCNSClient) GetAllNetworkContainers(ctx context.Context, orchestratorContext []byte, _ string) ([]cns.GetNetworkContainerResponse, error) {
 	if _, isUnsupported := c.unsupportedAPIs[GetAllNetworkContainers]; isUnsupported {
 		e := &client.CNSClientError{}
 		e.Code = types.UnsupportedAPI
@@ -862,3 +862,35 @@ func TestGetMultiTenancyCNIResultNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckSnatBridgeSubnet(t *testing.T) {
+	ncConfigs := []cns.GetNetworkContainerResponse{
+		{
+			NetworkContainerID: "nc1",
+			LocalIPConfiguration: cns.IPConfiguration{
+				IPSubnet: cns.IPSubnet{IPAddress: "100.64.0.5", PrefixLength: 16},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		subnet  string
+		wantErr error
+	}{
+		{name: "no snat bridge subnet"},
+		{name: "snat ip in the subnet", subnet: "100.64.0.0/16"},
+		{name: "snat ip not moved by cns", subnet: "100.65.0.0/16", wantErr: errSnatBridgeSubnet},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSnatBridgeSubnet(ncConfigs, tt.subnet)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cni"
@@ -30,10 +31,13 @@ import (
 	nnscontracts "github.com/Azure/azure-container-networking/proto/nodenetworkservice/3.302.0.744"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
 	cniTypesCurr "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -46,6 +50,7 @@ var (
 const (
 	dockerNetworkOption = "com.docker.network.generic"
 	OpModeTransparent   = "transparent"
+	OpModeWireguard     = "wireguard"
 	// Supported IP version. Currently support only IPv4
 	ipamV6                = "azure-vnet-ipamv6"
 	defaultRequestTimeout = 15 * time.Second
@@ -54,6 +59,19 @@ const (
 	ibInterfacePrefix     = "ib"
 )
 
+// Timeouts of the commands and of their stages, so that a stuck call to hns, cns or the wireserver fails the command
+// with an error the runtime retries, before the runtime gives up on the plugin and kills it.
+const (
+	addTimeout    = 90 * time.Second
+	deleteTimeout = 90 * time.Second
+	// ipamTimeout bounds the allocation of the ips of the pod, which waits for the pool to scale up when it is empty.
+	ipamTimeout = 30 * time.Second
+	// endpointTimeout bounds the creation of the endpoints of the pod.
+	endpointTimeout = 45 * time.Second
+	// cleanupTimeout bounds the rollback of a failed ADD, which runs after the deadline of the ADD may have passed.
+	cleanupTimeout = 15 * time.Second
+)
+
 // CNI Operation Types
 const (
 	CNI_ADD    = "ADD"
@@ -84,6 +102,15 @@ type NetPlugin struct {
 	nnsClient          NnsClient
 	multitenancyClient MultitenancyClient
 	netClient          InterfaceGetter
+	execClient         platform.ExecClient
+	sandboxInspector   sandboxInspector
+	nicTypeDetector    nicTypeDetector
+	// flushTracing exports the spans of the command, once the store lock is released
+	flushTracing func(context.Context) error
+	// newAttachmentIpamInvoker creates the ipam invokers of the additional networks, the azure ipam ones when nil
+	newAttachmentIpamInvoker func(netNs string, attCfg *cni.NetworkConfig) IPAMInvoker
+	// newIPPoolClient creates the client STATUS reads the ip pool of the node with, the cns client when nil
+	newIPPoolClient func(cnsURL string) ipPoolClient
 }
 
 type PolicyArgs struct {
@@ -130,8 +157,9 @@ func NewPlugin(name string,
 	}
 
 	nl := netlink.NewNetlink()
+	execClient := platform.NewExecClient(logger)
 	// Setup network manager.
-	nm, err := network.NewNetworkManager(nl, platform.NewExecClient(logger), &netio.NetIO{}, network.NewNamespaceClient(), iptables.NewClient(), dhcp.New(logger))
+	nm, err := network.NewNetworkManager(nl, execClient, &netio.NetIO{}, network.NewNamespaceClient(), iptables.NewClient(), dhcp.New(logger))
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +172,7 @@ func NewPlugin(name string,
 		nnsClient:          client,
 		multitenancyClient: multitenancyClient,
 		netClient:          &netio.NetIO{},
+		execClient:         execClient,
 	}, nil
 }
 
@@ -173,6 +202,31 @@ func (plugin *NetPlugin) Start(config *common.PluginConfig) error {
 	return nil
 }
 
+// ReattachHnsEndpoints creates again the hcn endpoints hns lost and attaches them to their pods.
+func (plugin *NetPlugin) ReattachHnsEndpoints() error {
+	return errors.Wrap(plugin.nm.ReattachHnsEndpoints(), "failed to reattach hcn endpoints")
+}
+
+// MigrateDatapath migrates a batch of endpoints to the datapath generation of the request.
+func (plugin *NetPlugin) MigrateDatapath(req api.DatapathMigrationRequest) (*api.DatapathMigrationProgress, error) {
+	if err := plugin.nm.SetDatapathGeneration(req.Generation); err != nil {
+		return nil, errors.Wrap(err, "failed to set datapath generation")
+	}
+
+	progress, err := plugin.nm.MigrateEndpoints(req.After, req.BatchSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate endpoints")
+	}
+
+	return &api.DatapathMigrationProgress{
+		Generation: progress.Generation,
+		Migrated:   progress.Migrated,
+		Failed:     progress.Failed,
+		Remaining:  progress.Remaining,
+		Last:       progress.Last,
+	}, nil
+}
+
 func (plugin *NetPlugin) GetAllEndpointState(networkid string) (*api.AzureCNIState, error) {
 	st := api.AzureCNIState{
 		ContainerInterfaces: make(map[string]api.PodNetworkInterfaceInfo),
@@ -193,6 +247,28 @@ func (plugin *NetPlugin) GetAllEndpointState(networkid string) (*api.AzureCNISta
 			PodEndpointId: ep.EndpointID,
 			ContainerID:   ep.ContainerID,
 			IPAddresses:   ep.IPAddresses,
+			FlowLogs:      ep.FlowLogs,
+		}
+		for _, op := range ep.History {
+			info.History = append(info.History, api.EndpointOperation(op))
+		}
+		if _, ok := ep.Data[network.RxBytesKey]; ok {
+			counter := func(key string) uint64 {
+				value, _ := ep.Data[key].(uint64)
+				return value
+			}
+			info.Traffic = &api.EndpointTraffic{
+				RxBytes:   counter(network.RxBytesKey),
+				TxBytes:   counter(network.TxBytesKey),
+				RxPackets: counter(network.RxPacketsKey),
+				TxPackets: counter(network.TxPacketsKey),
+				RxDropped: counter(network.RxDroppedKey),
+				TxDropped: counter(network.TxDroppedKey),
+			}
+		}
+		if ep.OperState != nil {
+			state := api.EndpointOperState(*ep.OperState)
+			info.OperState = &state
 		}
 
 		st.ContainerInterfaces[id] = info
@@ -219,6 +295,9 @@ func (plugin *NetPlugin) findInterfaceByMAC(macAddress string) string {
 	for _, iface := range interfaces {
 		// find master interface by macAddress for Swiftv2
 		macs = append(macs, iface.HardwareAddr.String())
+		if isHostVSwitchInterface(iface.Name) {
+			continue
+		}
 		if iface.HardwareAddr.String() == macAddress {
 			return iface.Name
 		}
@@ -294,6 +373,15 @@ func (plugin *NetPlugin) getPodInfo(args string) (name, ns string, err error) {
 	return k8sPodName, k8sNamespace, nil
 }
 
+// getPodUID returns the pod uid in the CNI args, or an empty uid if the runtime doesn't pass it.
+func getPodUID(args string) string {
+	podCfg, err := cni.ParseCniArgs(args)
+	if err != nil {
+		return ""
+	}
+	return string(podCfg.K8S_POD_UID)
+}
+
 func (plugin *NetPlugin) setCNIReportDetails(containerID, opType, msg string) {
 	telemetryClient.Settings().OperationType = opType
 	telemetryClient.Settings().SubContext = containerID
@@ -319,14 +407,36 @@ func addNatIPV6SubnetInfo(nwCfg *cni.NetworkConfig,
 	}
 }
 
-func (plugin *NetPlugin) addIpamInvoker(ipamAddConfig IPAMAddConfig) (IPAMAddResult, error) {
-	ipamAddResult, err := plugin.ipamInvoker.Add(ipamAddConfig)
+func (plugin *NetPlugin) addIpamInvoker(ctx context.Context, ipamAddConfig IPAMAddConfig) (IPAMAddResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipamTimeout)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "ipam.Add", attribute.String("ipam.type", ipamAddConfig.nwCfg.IPAM.Type))
+	ipamAddResult, err := plugin.ipamInvoker.Add(ctx, ipamAddConfig)
+	tracing.End(span, err)
 	if err != nil {
 		return IPAMAddResult{}, errors.Wrap(err, "failed to add ipam invoker")
 	}
 	return ipamAddResult, nil
 }
 
+// newIPAllocationRecord describes the IPAM step of an ADD for telemetry.
+func newIPAllocationRecord(ipamDuration time.Duration, stats *cns.IPAllocationStats, err error) *telemetry.IPAllocationRecord {
+	record := &telemetry.IPAllocationRecord{IPAMDuration: ipamDuration}
+	if stats != nil {
+		record.WaitForIP = stats.WaitForIP
+		record.CNSRequests = stats.Requests
+		record.WaitForPoolScaling = stats.WaitForPoolScaling
+	}
+	if err != nil {
+		record.ErrorCode = telemetry.IPAMErrorStr
+		var cnsErr *cnscli.CNSClientError
+		if errors.As(err, &cnsErr) {
+			record.ErrorCode = cnsErr.Code.String()
+		}
+	}
+	return record
+}
+
 // get network
 func (plugin *NetPlugin) getNetworkID(netNs string, interfaceInfo *network.InterfaceInfo, nwCfg *cni.NetworkConfig) (string, error) {
 	networkID, err := plugin.getNetworkName(netNs, interfaceInfo, nwCfg)
@@ -348,7 +458,7 @@ func (plugin *NetPlugin) getNetworkInfo(netNs string, interfaceInfo *network.Int
 // https://github.com/containernetworking/cni/blob/master/SPEC.md
 
 // Add handles CNI add commands.
-func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
+func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) (err error) {
 	var (
 		ipamAddResult    IPAMAddResult
 		azIpamResult     *cniTypesCurr.Result
@@ -356,6 +466,8 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		enableSnatForDNS bool
 		k8sPodName       string
 		epInfos          []*network.EndpointInfo
+		attEpInfos       []*network.EndpointInfo
+		ipamRecord       *telemetry.IPAllocationRecord
 	)
 
 	startTime := time.Now()
@@ -374,17 +486,27 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		return err
 	}
 
+	traceCtx, endTrace := plugin.startTracing(nwCfg, CNI_ADD, args)
+	defer func() { endTrace(err) }()
+
 	if argErr := plugin.validateArgs(args, nwCfg); argErr != nil {
 		err = argErr
 		return err
 	}
 
+	// only refused on ADD, the endpoints created with the datapath are still deleted
+	if err = nwCfg.ValidateEBPFDatapath(); err != nil {
+		err = plugin.Errorf("Invalid network configuration: %v.", err)
+		return err
+	}
+
 	// Parse Pod arguments.
 	k8sPodName, k8sNamespace, err := plugin.getPodInfo(args.Args)
 	if err != nil {
 		return err
 	}
 	telemetryClient.Settings().ContainerName = k8sPodName + ":" + k8sNamespace
+	trace.SpanFromContext(traceCtx).SetAttributes(attribute.String("k8s.pod.name", k8sPodName), attribute.String("k8s.namespace.name", k8sNamespace))
 
 	plugin.setCNIReportDetails(args.ContainerID, CNI_ADD, "")
 	telemetryClient.SendEvent(fmt.Sprintf("[cni-net] Processing ADD command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v StdinData:%s}.",
@@ -392,34 +514,34 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 
 	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
 
-	defer func() {
-		// Add Interfaces to result.
-		// previously we had a default interface info to select which interface info was the one to be returned from cni add
-		cniResult := &cniTypesCurr.Result{}
-		for key := range ipamAddResult.interfaceInfo {
-			// now we have to infer which interface info should be returned
-			// we assume that we want to return the infra nic always, and if that is not found, return any one of the secondary interfaces
-			// if there is an infra nic + secondary, we will always return the infra nic (linux swift v2)
-			cniResult = convertInterfaceInfoToCniResult(ipamAddResult.interfaceInfo[key], args.IfName)
-			if ipamAddResult.interfaceInfo[key].NICType == cns.InfraNIC {
-				break
-			}
-		}
+	if err = plugin.setDatapathGeneration(nwCfg); err != nil {
+		return err
+	}
 
-		// stdout multiple cniResults for containerd to create multiple pods
-		// containerd receives each cniResult as the stdout and create pod
-		addSnatInterface(nwCfg, cniResult) //nolint TODO: check whether Linux supports adding secondary snatinterface
+	if err = plugin.setStateStore(nwCfg); err != nil {
+		return err
+	}
 
-		// add IB NIC interfaceInfo to cniResult
-		for _, epInfo := range epInfos {
-			if epInfo.NICType == cns.BackendNIC {
-				cniResult.Interfaces = append(cniResult.Interfaces, &cniTypesCurr.Interface{
-					Name:  epInfo.MasterIfName,
-					Mac:   epInfo.MacAddress.String(),
-					PciID: epInfo.PnPID,
-				})
-			}
+	if err = plugin.setStateFormat(nwCfg); err != nil {
+		return err
+	}
+
+	// a retried ADD of an endpoint which is already created gets the result of the ADD which created it
+	if cniResult := plugin.cachedAddResult(args); cniResult != nil {
+		logger.Info("Endpoint already created, returning the result of its ADD",
+			zap.String("containerID", args.ContainerID),
+			zap.String("ifName", args.IfName))
+		res, vererr := cniResult.GetAsVersion(nwCfg.CNIVersion)
+		if vererr != nil {
+			return plugin.Error(vererr)
 		}
+		return res.Print()
+	}
+
+	defer func() {
+		err = plugin.withErrorCode(err, args.Netns)
+
+		cniResult := newAddResult(args, nwCfg, ipamAddResult, epInfos, attEpInfos)
 
 		// Convert result to the requested CNI version.
 		res, vererr := cniResult.GetAsVersion(nwCfg.CNIVersion)
@@ -442,8 +564,20 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 
 		operationTimeMs := time.Since(startTime).Milliseconds()
 		telemetryClient.SendMetric(telemetry.CNIAddTimeMetricStr, float64(operationTimeMs), make(map[string]string))
+		if ipamRecord != nil {
+			ipamRecord.AddDuration = time.Since(startTime)
+			if err != nil && ipamRecord.ErrorCode == "" {
+				ipamRecord.ErrorCode = telemetry.DatapathErrorStr
+			}
+			recordErrorCode(ipamRecord, err)
+			telemetryClient.SendIPAllocationRecord(ipamRecord)
+		}
+		pushNetworkMetrics(nwCfg)
 	}()
 
+	ctx, cancel := context.WithTimeout(traceCtx, addTimeout)
+	defer cancel()
+
 	ipamAddResult = IPAMAddResult{interfaceInfo: make(map[string]network.InterfaceInfo)}
 
 	k8sContainerID := args.ContainerID
@@ -464,7 +598,7 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 	if nwCfg.ExecutionMode == string(util.Baremetal) {
 		var res *nnscontracts.ConfigureContainerNetworkingResponse
 		logger.Info("Baremetal mode. Calling vnet agent for ADD")
-		res, err = plugin.nnsClient.AddContainerNetworking(context.Background(), k8sPodName, args.Netns)
+		res, err = plugin.nnsClient.AddContainerNetworking(ctx, k8sPodName, args.Netns)
 
 		if err == nil {
 			ipamAddResult.interfaceInfo[string(cns.InfraNIC)] = network.InterfaceInfo{
@@ -506,7 +640,12 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 			return fmt.Errorf("%w", err)
 		}
 
-		ipamAddResult, err = plugin.multitenancyClient.GetAllNetworkContainers(context.TODO(), nwCfg, k8sPodName, k8sNamespace, args.IfName)
+		// the dns proxy only sees the dns routed through the snat bridge
+		if nwCfg.DNSProxy && dnsProxySupported {
+			enableSnatForDNS = true
+		}
+
+		ipamAddResult, err = plugin.multitenancyClient.GetAllNetworkContainers(ctx, nwCfg, k8sPodName, k8sNamespace, args.IfName)
 		if err != nil {
 			err = fmt.Errorf("GetAllNetworkContainers failed for podname %s namespace %s. error: %w", k8sPodName, k8sNamespace, err)
 			logger.Error("GetAllNetworkContainers failed",
@@ -535,12 +674,16 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 			}
 		}
 
-		ipamAddResult, err = plugin.addIpamInvoker(ipamAddConfig)
+		ipamStartTime := time.Now()
+		ipamAddResult, err = plugin.addIpamInvoker(ctx, ipamAddConfig)
+		ipamRecord = newIPAllocationRecord(time.Since(ipamStartTime), ipamAddResult.allocationStats, err)
 		if err != nil {
 			return fmt.Errorf("IPAM Invoker Add failed with error: %w", err)
 		}
 	}
 
+	plugin.detectNICTypes(ipamAddResult.interfaceInfo)
+
 	policies := cni.GetPoliciesFromNwCfg(nwCfg.AdditionalArgs)
 	defer func() { //nolint:gocritic
 		if err != nil {
@@ -550,7 +693,7 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 					// This used to only be called for infraNIC, test if this breaks scenarios
 					// If it does then will have to search for infraNIC
 					if ifInfo.NICType == cns.InfraNIC {
-						plugin.cleanupAllocationOnError(ifInfo.IPConfigs, nwCfg, args, options)
+						plugin.cleanupAllocationOnError(ctx, ifInfo.IPConfigs, nwCfg, args, options)
 					}
 				}
 			}
@@ -599,16 +742,33 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		//	ipamAddResult.interfaceInfo[ifIndex].IPConfigs, epInfo.Data[network.VlanIDKey], k8sPodName, k8sNamespace, plugin.nm.GetNumberOfEndpoints("", nwCfg.Name)))
 		endpointIndex++
 	}
+
+	// the additional networks the pod selects get an endpoint each, on top of the ones of its default network
+	attEpInfos, err = plugin.addAttachments(ctx, args, nwCfg, k8sPodName, k8sNamespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			cleanupCtx, cleanupCancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+			defer cleanupCancel()
+			plugin.releaseAttachments(cleanupCtx, attEpInfos, nwCfg, args)
+		}
+	}()
+	epInfos = append(epInfos, attEpInfos...)
+
 	cnsclient, err := cnscli.New(nwCfg.CNSUrl, defaultRequestTimeout)
 	if err != nil {
 		return errors.Wrap(err, "failed to create cns client")
 	}
 	defer func() {
 		if err != nil {
+			cleanupCtx, cleanupCancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+			defer cleanupCancel()
 
 			// Delete all endpoints
 			for _, epInfo := range epInfos {
-				deleteErr := plugin.nm.DeleteEndpoint(epInfo.NetworkID, epInfo.EndpointID, epInfo)
+				deleteErr := plugin.nm.DeleteEndpoint(cleanupCtx, epInfo.NetworkID, epInfo.EndpointID, epInfo)
 				if deleteErr != nil {
 					// we already do not return an error when the endpoint is not found, so deleteErr is a real error
 					logger.Error("Could not delete endpoint after detecting add failure", zap.String("epInfo", epInfo.PrettyString()), zap.Error(deleteErr))
@@ -625,7 +785,10 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		}
 	}()
 
-	err = plugin.nm.EndpointCreate(cnsclient, epInfos)
+	recordAddResult(args, newAddResult(args, nwCfg, ipamAddResult, epInfos, attEpInfos), epInfos)
+	endpointCtx, endpointCancel := context.WithTimeout(ctx, endpointTimeout)
+	defer endpointCancel()
+	err = plugin.nm.EndpointCreate(endpointCtx, cnsclient, epInfos)
 	if err != nil {
 		return errors.Wrap(err, "failed to create endpoint") // behavior can change if you don't assign to err prior to returning
 	}
@@ -636,8 +799,8 @@ func (plugin *NetPlugin) findMasterInterface(opt *createEpInfoOpt) string {
 	switch opt.ifInfo.NICType {
 	case cns.InfraNIC:
 		return plugin.findMasterInterfaceBySubnet(opt.ipamAddConfig.nwCfg, &opt.ifInfo.HostSubnetPrefix)
-	case cns.NodeNetworkInterfaceFrontendNIC:
-		return plugin.findInterfaceByMAC(opt.ifInfo.MacAddress.String())
+	case cns.NodeNetworkInterfaceFrontendNIC, cns.NodeNetworkInterfaceAccelnetFrontendNIC:
+		return plugin.findDelegatedInterface(opt.ifInfo)
 	case cns.BackendNIC:
 		// if windows swiftv2 has right network drivers, there will be an NDIS interface while the VFs are mounted
 		// when the VF is dismounted, this interface will go away
@@ -691,14 +854,6 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 		return nil, err
 	}
 
-	vethName := fmt.Sprintf("%s.%s", opt.k8sNamespace, opt.k8sPodName)
-	if opt.nwCfg.Mode != OpModeTransparent {
-		// this mechanism of using only namespace and name is not unique for different incarnations of POD/container.
-		// IT will result in unpredictable behavior if API server decides to
-		// reorder DELETE and ADD call for new incarnation of same POD.
-		vethName = fmt.Sprintf("%s%s%s", opt.networkID, opt.args.ContainerID, opt.args.IfName)
-	}
-
 	// for secondary (Populate addresses)
 	// initially only for infra nic but now applied to all nic types
 	addresses := make([]net.IPNet, len(opt.ifInfo.IPConfigs))
@@ -719,6 +874,11 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 		endpointID = plugin.nm.GetEndpointID(opt.args.ContainerID, ifName)
 	}
 
+	// the veth is named by the container and the interface, unlike the pod name it is unique for every incarnation of
+	// the pod so a reordered DEL of the old incarnation doesn't race the ADD of the new one, and a retried ADD of the
+	// same container finds the links left over by the one before it
+	vethName := fmt.Sprintf("%s.%s", opt.args.ContainerID, ifName)
+
 	endpointInfo := network.EndpointInfo{
 		NetworkID:                     opt.networkID,
 		Mode:                          opt.ipamAddConfig.nwCfg.Mode,
@@ -729,6 +889,7 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 		NetNs:                         opt.ipamAddConfig.args.Netns,
 		Options:                       opt.ipamAddConfig.shallowCopyIpamAddConfigOptions(),
 		DisableHairpinOnHostInterface: opt.ipamAddConfig.nwCfg.DisableHairpinOnHostInterface,
+		DisableConntrackFlush:         opt.nwCfg.DisableConntrackFlush,
 		IsIPv6Enabled:                 opt.ipv6Enabled, // present infra only
 
 		EndpointID:  endpointID,
@@ -743,8 +904,19 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 		EnableMultiTenancy: opt.nwCfg.MultiTenancy,
 		EnableInfraVnet:    opt.enableInfraVnet,
 		EnableSnatForDns:   opt.enableSnatForDNS,
+		SkipDNSRedirect:    opt.nwCfg.SkipDNSRedirect(),
+		EnableEBPFDatapath: opt.nwCfg.EnableEBPFDatapath,
+		EnableIPVlanL3S:    opt.nwCfg.EnableIPVlanL3S,
+		EnableMacvlan:      opt.nwCfg.EnableMacvlan,
+		WireguardIfName:    opt.nwCfg.WireguardIfName,
+		VxlanIfName:        opt.nwCfg.VxlanIfName,
+		VxlanID:            opt.nwCfg.VxlanID,
+		VxlanPort:          opt.nwCfg.VxlanPort,
+		MTU:                opt.nwCfg.MTU,
+		HostProtectedPorts: opt.nwCfg.WindowsSettings.HostProtectedPorts,
 		PODName:            opt.k8sPodName,
 		PODNameSpace:       opt.k8sNamespace,
+		PODUID:             getPodUID(opt.args.Args),
 		SkipHotAttachEp:    false, // Hot attach at the time of endpoint creation
 		IPV6Mode:           opt.nwCfg.IPV6Mode,
 		VnetCidrs:          opt.nwCfg.VnetCidrs,
@@ -759,8 +931,54 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 		// the following is used for creating an external interface if we can't find an existing network
 		HostSubnetPrefix: opt.ifInfo.HostSubnetPrefix.String(),
 		PnPID:            opt.ifInfo.PnPID,
+		// the endpoints of the ADD are validated by the mode of its first endpoint
+		EndpointValidationMode: network.EndpointValidationMode(opt.nwCfg.EndpointValidationMode),
+	}
+
+	// only delegated nics carry the vlans to the pod, the infra nic is behind the host's datapath
+	if opt.ifInfo.NICType.IsFrontendNIC() {
+		endpointInfo.AllowedVlanIDs = opt.nwCfg.AllowedVlanIDs
+
+		profile, err := opt.nwCfg.EthtoolProfile()
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			endpointInfo.EthtoolSettings = &network.EthtoolSettings{
+				RxRing:           profile.RxRing,
+				TxRing:           profile.TxRing,
+				RxChannels:       profile.RxChannels,
+				TxChannels:       profile.TxChannels,
+				CombinedChannels: profile.CombinedChannels,
+			}
+		}
 	}
 
+	// the vm of a sandboxed runtime owns the netns of the pod, the infra nic is handed to it
+	if opt.ifInfo.NICType == cns.InfraNIC {
+		if err := setSandboxedRuntime(opt.nwCfg, opt.args.Args, &endpointInfo); err != nil {
+			return nil, err
+		}
+
+		// only the traffic of the infra nic goes through the host, where it is marked
+		if endpointInfo.DSCP, err = opt.nwCfg.DSCP(); err != nil {
+			return nil, err
+		}
+		if endpointInfo.FlowLogs, err = opt.nwCfg.FlowLogs(); err != nil {
+			return nil, err
+		}
+
+		if arp := opt.nwCfg.BridgeARP; arp != nil {
+			endpointInfo.ARP = &network.ARPOptions{
+				DisableProxyARP: arp.DisableProxyARP,
+				SpoofProtection: arp.SpoofProtection,
+				GratuitousARP:   arp.GratuitousARP,
+			}
+		}
+	}
+
+	endpointInfo.OutboundNATExceptions = getOutboundNATExceptions(opt.ifInfo)
+
 	if err = addSubnetToEndpointInfo(*opt.ifInfo, &endpointInfo); err != nil {
 		logger.Info("Failed to add subnets to endpointInfo", zap.Error(err))
 		return nil, err
@@ -796,10 +1014,20 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 
 	if opt.ipamAddResult.ipv6Enabled { // not specific to this particular interface
 		endpointInfo.IPV6Mode = string(util.IpamMode(opt.nwCfg.IPAM.Mode)) // TODO: check IPV6Mode field can be deprecated and can we add IsIPv6Enabled flag for generic working
-	}
-
-	if opt.azIpamResult != nil && opt.azIpamResult.IPs != nil {
-		endpointInfo.InfraVnetIP = opt.azIpamResult.IPs[0].Address
+	} else if ipFamilies, _ := opt.nwCfg.IPFamilies(); len(ipFamilies) > 0 {
+		// the pod requested its IP families without IPv6, so IPv6 is not enabled in its netns
+		endpointInfo.IPV6Mode = ""
+	}
+
+	if opt.azIpamResult != nil {
+		// dual stack infra vnets give an ip of each family
+		for _, ipConfig := range opt.azIpamResult.IPs {
+			if ipConfig.Address.IP.To4() != nil && endpointInfo.InfraVnetIP.IP == nil {
+				endpointInfo.InfraVnetIP = ipConfig.Address
+			} else if ipConfig.Address.IP.To4() == nil && endpointInfo.InfraVnetIPv6.IP == nil {
+				endpointInfo.InfraVnetIPv6 = ipConfig.Address
+			}
+		}
 	}
 
 	if opt.nwCfg.MultiTenancy {
@@ -815,16 +1043,92 @@ func (plugin *NetPlugin) createEpInfo(opt *createEpInfoOpt) (*network.EndpointIn
 	return &endpointInfo, nil
 }
 
+// setDatapathGeneration applies the datapath generation requested by the network config, defaulting to the latest.
+func (plugin *NetPlugin) setDatapathGeneration(nwCfg *cni.NetworkConfig) error {
+	generation := -1
+	if nwCfg.DatapathGeneration != nil {
+		generation = *nwCfg.DatapathGeneration
+	}
+
+	return errors.Wrap(plugin.nm.SetDatapathGeneration(generation), "failed to set datapath generation")
+}
+
+// setStateStore moves the state to the store requested by the network config. The state is saved to the new store
+// right away, after which the files of the previous store are removed.
+func (plugin *NetPlugin) setStateStore(nwCfg *cni.NetworkConfig) error {
+	var bolt bool
+	switch nwCfg.StateStore {
+	case "", cni.StateStoreFile:
+	case cni.StateStoreBolt:
+		bolt = true
+	default:
+		return errors.Wrapf(cni.ErrUnknownStateStore, "%q", nwCfg.StateStore)
+	}
+
+	previous, err := plugin.SwitchKeyValueStore(bolt)
+	if err != nil || previous == nil {
+		return errors.Wrap(err, "failed to create state store")
+	}
+
+	if err := plugin.nm.SetStore(plugin.Store); err != nil {
+		// the previous store still holds the state, the new one is removed so that it isn't read instead
+		plugin.Store.Remove()
+		plugin.Store = previous
+		_ = plugin.nm.SetStore(previous)
+		return errors.Wrap(err, "failed to move state to the new store")
+	}
+	previous.Remove()
+	return nil
+}
+
+// setStateFormat applies the state file format requested by the network config, which takes effect on the next save.
+// The state is read in either format, so changing it converts the state file.
+func (plugin *NetPlugin) setStateFormat(nwCfg *cni.NetworkConfig) error {
+	formatStore, ok := plugin.Store.(store.FormatStore)
+	if !ok {
+		return nil
+	}
+
+	return errors.Wrap(formatStore.SetFormat(store.Format(nwCfg.StateFormat)), "failed to set state format")
+}
+
+// pushNetworkMetrics sends the network metrics of this invocation to CNS when enabled by the network config.
+// Failures are logged and do not fail the command.
+func pushNetworkMetrics(nwCfg *cni.NetworkConfig) {
+	if nwCfg == nil || !nwCfg.PushMetricsToCNS {
+		return
+	}
+
+	families, err := network.MetricsRegistry.Gather()
+	if err != nil {
+		logger.Error("Failed to gather network metrics", zap.Error(err))
+		return
+	}
+
+	cnsClient, err := cnscli.New(nwCfg.CNSUrl, defaultRequestTimeout)
+	if err != nil {
+		logger.Error("Failed to create cns client to push network metrics", zap.Error(err))
+		return
+	}
+
+	if err := cnsClient.PushNetworkMetrics(context.TODO(), families); err != nil {
+		logger.Error("Failed to push network metrics to cns", zap.Error(err))
+	}
+}
+
 // cleanup allocated ipv4 and ipv6 addresses if they exist
 func (plugin *NetPlugin) cleanupAllocationOnError(
+	ctx context.Context,
 	result []*network.IPConfig,
 	nwCfg *cni.NetworkConfig,
 	args *cniSkel.CmdArgs,
 	options map[string]interface{},
 ) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
 	if result != nil {
 		for i := 0; i < len(result); i++ {
-			if er := plugin.ipamInvoker.Delete(&result[i].Address, nwCfg, args, options); er != nil {
+			if er := plugin.ipamInvoker.Delete(ctx, &result[i].Address, nwCfg, args, options); er != nil {
 				logger.Error("Failed to cleanup ip allocation on failure", zap.Error(er))
 			}
 		}
@@ -873,6 +1177,8 @@ func (plugin *NetPlugin) Get(args *cniSkel.CmdArgs) error {
 		zap.String("path", args.Path))
 
 	defer func() {
+		err = plugin.withErrorCode(err, args.Netns)
+
 		// Add Interfaces to result.
 		iface = &cniTypesCurr.Interface{
 			Name: args.IfName,
@@ -910,6 +1216,18 @@ func (plugin *NetPlugin) Get(args *cniSkel.CmdArgs) error {
 
 	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
 
+	if err = plugin.setDatapathGeneration(nwCfg); err != nil {
+		return err
+	}
+
+	if err = plugin.setStateStore(nwCfg); err != nil {
+		return err
+	}
+
+	if err = plugin.setStateFormat(nwCfg); err != nil {
+		return err
+	}
+
 	// Initialize values from network config.
 	if networkID, err = plugin.getNetworkName(args.Netns, nil, nwCfg); err != nil {
 		// TODO: Ideally we should return from here only.
@@ -931,6 +1249,29 @@ func (plugin *NetPlugin) Get(args *cniSkel.CmdArgs) error {
 		return err
 	}
 
+	// the flows of ovs endpoints are lost when ovs restarts, the check installs them again
+	var checkErr error
+	if failures, ovsErr := plugin.nm.CheckOVSHealth(networkID); ovsErr != nil {
+		checkErr = ovsErr
+	} else if len(failures) > 0 {
+		checkErr = errors.Errorf("ovs datapath is unhealthy: %s", strings.Join(failures, "; "))
+	}
+
+	// drivers may reset the rings and channels of the delegated vfs, the check sets them again
+	if checkErr == nil {
+		if failures, ethtoolErr := plugin.nm.CheckEthtoolSettings(args.ContainerID); ethtoolErr != nil {
+			checkErr = ethtoolErr
+		} else if len(failures) > 0 {
+			checkErr = errors.Errorf("ethtool settings drifted: %s", strings.Join(failures, "; "))
+		}
+	}
+
+	if checkErr != nil {
+		logger.Error("Endpoint check failed", zap.String("endpointID", endpointID), zap.Error(checkErr))
+		err = checkErr
+		return err
+	}
+
 	for _, ipAddresses := range epInfo.IPAddresses {
 		ipConfig := &cniTypesCurr.IPConfig{
 			Interface: &epInfo.IfIndex,
@@ -945,7 +1286,7 @@ func (plugin *NetPlugin) Get(args *cniSkel.CmdArgs) error {
 	}
 
 	for _, route := range epInfo.Routes {
-		result.Routes = append(result.Routes, &cniTypes.Route{Dst: route.Dst, GW: route.Gw})
+		result.Routes = append(result.Routes, &cniTypes.Route{Dst: route.Dst, GW: route.Gw, MTU: route.MTU, AdvMSS: route.AdvMSS})
 	}
 
 	result.DNS.Nameservers = epInfo.EndpointDNS.Servers
@@ -955,9 +1296,8 @@ func (plugin *NetPlugin) Get(args *cniSkel.CmdArgs) error {
 }
 
 // Delete handles CNI delete commands.
-func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
+func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) (err error) {
 	var (
-		err          error
 		nwCfg        *cni.NetworkConfig
 		k8sPodName   string
 		k8sNamespace string
@@ -974,12 +1314,14 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		zap.ByteString("stdinData", args.StdinData))
 
 	defer func() {
+		err = plugin.withErrorCode(err, args.Netns)
 		logger.Info("DEL command completed",
 			zap.String("pod", k8sPodName),
 			zap.Error(log.NewErrorWithoutStackTrace(err)))
 		telemetryClient.SendEvent(fmt.Sprintf("DEL command completed: [podname]: %s [namespace]: %s [error]: %v", k8sPodName, k8sNamespace, err))
 		operationTimeMs := time.Since(startTime).Milliseconds()
 		telemetryClient.SendMetric(telemetry.CNIDelTimeMetricStr, float64(operationTimeMs), make(map[string]string))
+		pushNetworkMetrics(nwCfg)
 	}()
 
 	// Parse network configuration from stdin.
@@ -988,6 +1330,9 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		return err
 	}
 
+	traceCtx, endTrace := plugin.startTracing(nwCfg, CNI_DEL, args)
+	defer func() { endTrace(err) }()
+
 	if argErr := plugin.validateArgs(args, nwCfg); argErr != nil {
 		err = argErr
 		return err
@@ -998,6 +1343,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		logger.Error("Failed to get POD info", zap.Error(err))
 	}
 	telemetryClient.Settings().ContainerName = k8sPodName + ":" + k8sNamespace
+	trace.SpanFromContext(traceCtx).SetAttributes(attribute.String("k8s.pod.name", k8sPodName), attribute.String("k8s.namespace.name", k8sNamespace))
 
 	plugin.setCNIReportDetails(args.ContainerID, CNI_DEL, "")
 	telemetryClient.SendEvent(fmt.Sprintf("[cni-net] Processing DEL command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v, StdinData:%s}.",
@@ -1005,11 +1351,37 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 
 	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
 
+	if err = plugin.setDatapathGeneration(nwCfg); err != nil {
+		return err
+	}
+
+	if err = plugin.setStateStore(nwCfg); err != nil {
+		return err
+	}
+
+	if err = plugin.setStateFormat(nwCfg); err != nil {
+		return err
+	}
+
 	platformInit(nwCfg)
 
+	ctx, cancel := context.WithTimeout(traceCtx, deleteTimeout)
+	defer cancel()
+
+	// the endpoints and ips of a sandbox whose processes still run are kept, the runtime retries the DEL once they exited
+	if nwCfg.DeferDelUntilSandboxExit {
+		var state sandboxState
+		state, err = plugin.checkSandboxExit(args.Netns)
+		logger.Info("Sandbox state", zap.String("netNS", args.Netns), zap.Stringer("state", state))
+		if err != nil {
+			err = plugin.RetriableError(err)
+			return err
+		}
+	}
+
 	logger.Info("Execution mode", zap.String("mode", nwCfg.ExecutionMode))
 	if nwCfg.ExecutionMode == string(util.Baremetal) {
-		_, err = plugin.nnsClient.DeleteContainerNetworking(context.Background(), k8sPodName, args.Netns)
+		_, err = plugin.nnsClient.DeleteContainerNetworking(ctx, k8sPodName, args.Netns)
 		if err != nil {
 			return fmt.Errorf("nnsClient.DeleteContainerNetworking failed with err %w", err)
 		}
@@ -1104,7 +1476,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 
 			logger.Warn("Release ip by ContainerID (endpoint not found)",
 				zap.String("containerID", args.ContainerID))
-			if err = plugin.ipamInvoker.Delete(nil, nwCfg, args, nwInfo.Options); err != nil {
+			if err = plugin.ipamInvoker.Delete(ctx, nil, nwCfg, args, nwInfo.Options); err != nil {
 				return plugin.RetriableError(fmt.Errorf("failed to release address(no endpoint): %w", err))
 			}
 		}
@@ -1117,7 +1489,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 	// delete endpoints
 	for _, epInfo := range epInfos {
 		// in stateless, network id is not populated in epInfo, but in stateful cni, it is (nw id is used in stateful)
-		if err = plugin.nm.DeleteEndpoint(epInfo.NetworkID, epInfo.EndpointID, epInfo); err != nil {
+		if err = plugin.nm.DeleteEndpoint(ctx, epInfo.NetworkID, epInfo.EndpointID, epInfo); err != nil {
 			// An error will not be returned if the endpoint is not found
 			// return a retriable error so the container runtime will retry this DEL later
 			// the implementation of this function returns nil if the endpoint doens't exist, so
@@ -1132,23 +1504,41 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 			zap.String("endpointID", epInfo.EndpointID))
 		telemetryClient.SendEvent("Deleting endpoint: " + epInfo.EndpointID)
 
+		// the ips of the additional networks are released to their own ipam plugin
+		if attCfg := attachmentConfig(nwCfg, epInfo.NetworkID); attCfg != nil {
+			if err = plugin.releaseAttachment(ctx, epInfo, attCfg, args); err != nil {
+				return plugin.RetriableError(err)
+			}
+			continue
+		}
+
 		if !nwCfg.MultiTenancy && (epInfo.NICType == cns.InfraNIC || epInfo.NICType == "") {
 			// Delegated/secondary nic ips are statically allocated so we don't need to release
 			// Call into IPAM plugin to release the endpoint's addresses.
 			for i := range epInfo.IPAddresses {
 				logger.Info("Release ip", zap.String("ip", epInfo.IPAddresses[i].IP.String()))
 				telemetryClient.SendEvent(fmt.Sprintf("Release ip: %s container id: %s endpoint id: %s", epInfo.IPAddresses[i].IP.String(), args.ContainerID, epInfo.EndpointID))
-				err = plugin.ipamInvoker.Delete(&epInfo.IPAddresses[i], nwCfg, args, nwInfo.Options)
+				err = plugin.ipamInvoker.Delete(ctx, &epInfo.IPAddresses[i], nwCfg, args, nwInfo.Options)
 				if err != nil {
 					return plugin.RetriableError(fmt.Errorf("failed to release address: %w", err))
 				}
 			}
 		} else if epInfo.EnableInfraVnet { // remove in future PR
-			nwCfg.IPAM.Subnet = nwInfo.Subnets[0].Prefix.String()
-			nwCfg.IPAM.Address = epInfo.InfraVnetIP.IP.String()
-			err = plugin.ipamInvoker.Delete(nil, nwCfg, args, nwInfo.Options)
-			if err != nil {
-				return plugin.RetriableError(fmt.Errorf("failed to release address: %w", err))
+			// the infra vnet ip of each family is released from the subnet of its family
+			for _, subnet := range nwInfo.Subnets {
+				infraIP := epInfo.InfraVnetIP
+				if subnet.Family == platform.AfINET6 {
+					infraIP = epInfo.InfraVnetIPv6
+				}
+				if infraIP.IP == nil {
+					continue
+				}
+				nwCfg.IPAM.Subnet = subnet.Prefix.String()
+				nwCfg.IPAM.Address = infraIP.IP.String()
+				err = plugin.ipamInvoker.Delete(ctx, nil, nwCfg, args, nwInfo.Options)
+				if err != nil {
+					return plugin.RetriableError(fmt.Errorf("failed to release address: %w", err))
+				}
 			}
 		}
 	}
@@ -1193,6 +1583,18 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 	logger.Info("Read network configuration", zap.Any("config", nwCfg))
 
 	iptables.DisableIPTableLock = nwCfg.DisableIPTableLock
+
+	if err = plugin.setDatapathGeneration(nwCfg); err != nil {
+		return err
+	}
+
+	if err = plugin.setStateStore(nwCfg); err != nil {
+		return err
+	}
+
+	if err = plugin.setStateFormat(nwCfg); err != nil {
+		return err
+	}
 	plugin.setCNIReportDetails(args.ContainerID, CNI_UPDATE, "")
 
 	defer func() {
@@ -1250,7 +1652,11 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 
 	// Query the existing endpoint since this is an update.
 	// Right now, we do not support updating pods that have multiple endpoints.
-	existingEpInfo, err = plugin.nm.GetEndpointInfoBasedOnPODDetails(networkID, k8sPodName, k8sNamespace, nwCfg.EnableExactMatchForPodName)
+	podMatch, err := podMatcher(nwCfg, k8sPodName, k8sNamespace, string(podCfg.K8S_POD_UID))
+	if err != nil {
+		return plugin.Errorf("Invalid network configuration: %v", err)
+	}
+	existingEpInfo, err = plugin.nm.GetEndpointInfoBasedOnPODDetails(networkID, podMatch)
 	if err != nil {
 		plugin.Errorf("Failed to retrieve target endpoint for CNI UPDATE [name=%v, namespace=%v]: %v", k8sPodName, k8sNamespace, err)
 		return err
@@ -1415,7 +1821,12 @@ func convertInterfaceInfoToCniResult(info network.InterfaceInfo, ifName string)
 		}
 
 		for i := range info.Routes {
-			result.Routes = append(result.Routes, &cniTypes.Route{Dst: info.Routes[i].Dst, GW: info.Routes[i].Gw})
+			result.Routes = append(result.Routes, &cniTypes.Route{
+				Dst:    info.Routes[i].Dst,
+				GW:     info.Routes[i].Gw,
+				MTU:    info.Routes[i].MTU,
+				AdvMSS: info.Routes[i].AdvMSS,
+			})
 		}
 	}
 
@@ -1431,7 +1842,7 @@ func convertCniResultToInterfaceInfo(result *cniTypesCurr.Result) network.Interf
 		}
 
 		for _, route := range result.Routes {
-			interfaceInfo.Routes = append(interfaceInfo.Routes, network.RouteInfo{Dst: route.Dst, Gw: route.GW})
+			interfaceInfo.Routes = append(interfaceInfo.Routes, network.RouteInfo{Dst: route.Dst, Gw: route.GW, MTU: route.MTU, AdvMSS: route.AdvMSS})
 		}
 
 		interfaceInfo.DNS = network.DNSInfo{
@@ -6,6 +6,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/network/policy"
 	cniTypesCurr "github.com/containernetworking/cni/pkg/types/100"
@@ -19,6 +20,9 @@ const (
 
 const snatConfigFileName = "/tmp/snatConfig"
 
+// dnsProxySupported is whether cns can intercept the dns of the pods with its dns proxy.
+const dnsProxySupported = true
+
 func addDefaultRoute(gwIPString string, epInfo *network.EndpointInfo, result *network.InterfaceInfo) {
 	_, defaultIPNet, _ := net.ParseCIDR("0.0.0.0/0")
 	dstIP := net.IPNet{IP: net.ParseIP("0.0.0.0"), Mask: defaultIPNet.Mask}
@@ -55,6 +59,8 @@ func setEndpointOptions(cnsNwConfig *cns.GetNetworkContainerResponse, epInfo *ne
 		epInfo.Data[network.SnatBridgeIPKey] = cnsNwConfig.LocalIPConfiguration.GatewayIPAddress + "/" + strconv.Itoa(int(cnsNwConfig.LocalIPConfiguration.IPSubnet.PrefixLength))
 		epInfo.AllowInboundFromHostToNC = cnsNwConfig.AllowHostToNCCommunication
 		epInfo.AllowInboundFromNCToHost = cnsNwConfig.AllowNCToHostCommunication
+		epInfo.HostToNCPortRules = cnsNwConfig.HostToNCPortRules
+		epInfo.NCToHostPortRules = cnsNwConfig.NCToHostPortRules
 		epInfo.NetworkContainerID = cnsNwConfig.NetworkContainerID
 	}
 
@@ -76,9 +82,16 @@ func setupInfraVnetRoutingForMultitenancy(
 	azIpamResult *cniTypesCurr.Result,
 	epInfo *network.EndpointInfo,
 ) {
-	if epInfo.EnableInfraVnet {
-		_, ipNet, _ := net.ParseCIDR(nwCfg.InfraVnetAddressSpace)
-		epInfo.Routes = append(epInfo.Routes, network.RouteInfo{Dst: *ipNet, Gw: azIpamResult.IPs[0].Gateway, DevName: infraInterface})
+	if epInfo.EnableInfraVnet && azIpamResult != nil {
+		// the subnet of each family is routed through the gateway of the infra vnet ip of its family
+		for _, ipNet := range infraVnetAddressSpaces(nwCfg) {
+			for _, ipConfig := range azIpamResult.IPs {
+				if (ipConfig.Address.IP.To4() != nil) == (ipNet.IP.To4() != nil) {
+					epInfo.Routes = append(epInfo.Routes, network.RouteInfo{Dst: *ipNet, Gw: ipConfig.Gateway, DevName: infraInterface})
+					break
+				}
+			}
+		}
 	}
 }
 
@@ -123,13 +136,57 @@ func getNATInfo(_ *cni.NetworkConfig, _ interface{}, _ bool) (natInfo []policy.N
 	return natInfo
 }
 
+// getOutboundNATExceptions returns nil, cns programs the SNAT exceptions of the NC for its whole pod subnet on linux
+// and keeps them up to date with the NNC.
+func getOutboundNATExceptions(_ *network.InterfaceInfo) []string {
+	return nil
+}
+
 func platformInit(cniConfig *cni.NetworkConfig) {}
 
+// checkDatapath is a no-op, the kernel programs the endpoints of linux nodes.
+func checkDatapath() error {
+	return nil
+}
+
+// setAttachmentVethName tells the veth of an additional network apart from the one of the default network, whose name
+// is keyed by the pod alone in transparent mode.
+func setAttachmentVethName(epInfo *network.EndpointInfo, ifName string) {
+	if key, ok := epInfo.Data[network.OptVethName].(string); ok {
+		epInfo.Data[network.OptVethName] = key + "." + ifName
+	}
+}
+
 // isDualNicFeatureSupported returns if the dual nic feature is supported. Currently it's only supported for windows hnsv2 path
 func (plugin *NetPlugin) isDualNicFeatureSupported(netNs string) bool {
 	return false
 }
 
+// findDelegatedInterface returns the name of the delegated nic, found by its mac on linux
+func (plugin *NetPlugin) findDelegatedInterface(ifInfo *network.InterfaceInfo) string {
+	return plugin.findInterfaceByMAC(ifInfo.MacAddress.String())
+}
+
+// isHostVSwitchInterface returns if the interface is a host vSwitch port, there are none on linux
+func isHostVSwitchInterface(_ string) bool {
+	return false
+}
+
+// getOnLinkGatewayRoutes returns the on link route of the gateway of a point-to-point pod ip, /31 or /32 (/127 or /128),
+// whose subnet doesn't hold the gateway. The kernel rejects the routes through the gateway without it.
+func getOnLinkGatewayRoutes(podSubnet *net.IPNet, gw net.IP) []network.RouteInfo {
+	ones, bits := podSubnet.Mask.Size()
+	if ones < bits-1 || podSubnet.Contains(gw) {
+		return nil
+	}
+	return []network.RouteInfo{
+		{
+			Dst:   net.IPNet{IP: gw, Mask: net.CIDRMask(bits, bits)},
+			Scope: netlink.RT_SCOPE_LINK,
+		},
+	}
+}
+
 func getOverlayGateway(_ *net.IPNet) (net.IP, error) {
 	return net.ParseIP("169.254.1.1"), nil
 }
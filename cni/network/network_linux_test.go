@@ -4,6 +4,8 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
@@ -11,10 +13,13 @@ import (
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cns"
+	cnstypes "github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/platform"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -141,6 +146,95 @@ func TestAddDefaultRoute(t *testing.T) {
 	}
 }
 
+func TestSetupInfraVnetRoutingForMultitenancy(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{InfraVnetAddressSpace: "10.0.0.0/16, fd00:10::/64"}
+	azIpamResult := &cniTypesCurr.Result{
+		IPs: []*cniTypesCurr.IPConfig{
+			{Address: *parseCIDR("10.0.0.4/16"), Gateway: net.ParseIP("10.0.0.1")},
+			{Address: *parseCIDR("fd00:10::4/64"), Gateway: net.ParseIP("fd00:10::1")},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		azIpamResult *cniTypesCurr.Result
+		want         []network.RouteInfo
+	}{
+		{
+			name:         "route of each family",
+			azIpamResult: azIpamResult,
+			want: []network.RouteInfo{
+				{Dst: *parseCIDR("10.0.0.0/16"), Gw: net.ParseIP("10.0.0.1"), DevName: infraInterface},
+				{Dst: *parseCIDR("fd00:10::/64"), Gw: net.ParseIP("fd00:10::1"), DevName: infraInterface},
+			},
+		},
+		{
+			name:         "no route of the family without an ip",
+			azIpamResult: &cniTypesCurr.Result{IPs: azIpamResult.IPs[:1]},
+			want: []network.RouteInfo{
+				{Dst: *parseCIDR("10.0.0.0/16"), Gw: net.ParseIP("10.0.0.1"), DevName: infraInterface},
+			},
+		},
+		{
+			name: "no ipam result",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			epInfo := &network.EndpointInfo{EnableInfraVnet: true}
+			setupInfraVnetRoutingForMultitenancy(nwCfg, tt.azIpamResult, epInfo)
+			assert.Equal(t, tt.want, epInfo.Routes)
+		})
+	}
+}
+
+func TestGetOnLinkGatewayRoutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		podSubnet string
+		gw        string
+		want      []network.RouteInfo
+	}{
+		{
+			name:      "Gateway of a /32 pod ip",
+			podSubnet: "10.0.1.10/32",
+			gw:        "10.0.0.1",
+			want:      []network.RouteInfo{{Dst: net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}, Scope: netlink.RT_SCOPE_LINK}},
+		},
+		{
+			name:      "Gateway of a /31 pod ip",
+			podSubnet: "10.0.1.10/31",
+			gw:        "10.0.1.1",
+			want:      []network.RouteInfo{{Dst: net.IPNet{IP: net.ParseIP("10.0.1.1"), Mask: net.CIDRMask(32, 32)}, Scope: netlink.RT_SCOPE_LINK}},
+		},
+		{
+			name:      "Gateway of a /128 pod ip",
+			podSubnet: "fd11:1234::1/128",
+			gw:        "fe80::1234:5678:9abc",
+			want:      []network.RouteInfo{{Dst: net.IPNet{IP: net.ParseIP("fe80::1234:5678:9abc"), Mask: net.CIDRMask(128, 128)}, Scope: netlink.RT_SCOPE_LINK}},
+		},
+		{
+			name:      "Gateway in the /31 of the pod ip",
+			podSubnet: "10.0.1.10/31",
+			gw:        "10.0.1.11",
+		},
+		{
+			name:      "Gateway of a pod subnet",
+			podSubnet: "10.0.1.10/24",
+			gw:        "10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, podSubnet, err := net.ParseCIDR(tt.podSubnet)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, getOnLinkGatewayRoutes(podSubnet, net.ParseIP(tt.gw)))
+		})
+	}
+}
+
 func TestAddSnatForDns(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -281,7 +375,7 @@ func TestPluginLinuxAdd(t *testing.T) {
 							"VlanID":       1, // Vlan ID used here
 							"localIP":      "168.254.0.4/17",
 							"snatBridgeIP": "168.254.0.1/17",
-							"vethname":     "mulnettest-containereth0",
+							"vethname":     "test-container.eth0",
 						},
 						Routes: []network.RouteInfo{
 							{
@@ -384,7 +478,7 @@ func TestPluginLinuxAdd(t *testing.T) {
 					epInfo: &network.EndpointInfo{
 						ContainerID: "test-container",
 						Data: map[string]interface{}{
-							"vethname": "nettest-containereth0",
+							"vethname": "test-container.eth0",
 						},
 						Routes: []network.RouteInfo{
 							{
@@ -441,7 +535,7 @@ func TestPluginLinuxAdd(t *testing.T) {
 						MacAddress:  parsedMACAddress,
 						ContainerID: "test-container",
 						Data: map[string]interface{}{
-							"vethname": "nettest-containereth0",
+							"vethname": "test-container.eth0",
 						},
 						Routes: []network.RouteInfo{
 							{
@@ -514,16 +608,22 @@ func TestPluginLinuxAdd(t *testing.T) {
 					epID = endpointInfo.EndpointID
 					require.Regexp(t, regexp.MustCompile(wantedEndpointEntry.epIDRegex), epID)
 
-					// omit endpoint id and ifname fields as they are nondeterministic
+					// the veth name is keyed by the ifname, so it is only checked against it
+					if vethName, ok := endpointInfo.Data[network.OptVethName]; ok {
+						require.Equal(t, endpointInfo.ContainerID+"."+endpointInfo.IfName, vethName)
+						endpointInfo.Data[network.OptVethName] = wantedEndpointEntry.epInfo.Data[network.OptVethName]
+					}
+					// omit endpoint id and ifname fields as they are nondeterministic, and the add result checked by the add tests
 					endpointInfo.EndpointID = ""
 					endpointInfo.IfName = ""
+					endpointInfo.AddResult = nil
 
 					require.Equal(t, wantedEndpointEntry.epInfo, endpointInfo)
 				}
 				if epID == "none" {
 					t.Fail()
 				}
-				err = tt.plugin.nm.DeleteEndpoint("", epID, nil)
+				err = tt.plugin.nm.DeleteEndpoint(context.Background(), "", epID, nil)
 				require.NoError(t, err)
 			}
 
@@ -547,3 +647,66 @@ func TestPluginLinuxAdd(t *testing.T) {
 		})
 	}
 }
+
+type mockIPPoolClient struct {
+	ips []cns.IPConfigurationStatus
+	err error
+}
+
+func (c *mockIPPoolClient) GetIPAddressesMatchingStates(context.Context, ...cnstypes.IPState) ([]cns.IPConfigurationStatus, error) {
+	return c.ips, c.err
+}
+
+func TestPluginStatus(t *testing.T) {
+	cnsCfg := cni.NetworkConfig{CNIVersion: "1.1.0", Name: "azure", Type: "azure-vnet"}
+	cnsCfg.IPAM.Type = network.AzureCNS
+	azureCfg := cni.NetworkConfig{CNIVersion: "1.1.0", Name: "azure", Type: "azure-vnet"}
+	azureCfg.IPAM.Type = "azure-vnet-ipam"
+
+	tests := []struct {
+		name     string
+		nwCfg    cni.NetworkConfig
+		client   *mockIPPoolClient
+		wantCode uint
+	}{
+		{
+			name:   "cns with ips in the pool",
+			nwCfg:  cnsCfg,
+			client: &mockIPPoolClient{ips: []cns.IPConfigurationStatus{{IPAddress: "10.0.0.4"}}},
+		},
+		{
+			name:     "cns unreachable",
+			nwCfg:    cnsCfg,
+			client:   &mockIPPoolClient{err: errors.New("connection refused")},
+			wantCode: cni.ErrPluginNotAvailable,
+		},
+		{
+			name:     "cns with an empty pool",
+			nwCfg:    cnsCfg,
+			client:   &mockIPPoolClient{},
+			wantCode: cni.ErrPluginNotAvailable,
+		},
+		{
+			name:   "cns is not checked without cns ipam",
+			nwCfg:  azureCfg,
+			client: &mockIPPoolClient{err: errors.New("connection refused")},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := GetTestResources()
+			plugin.newIPPoolClient = func(string) ipPoolClient { return tt.client }
+
+			err := plugin.Status(&cniSkel.CmdArgs{StdinData: tt.nwCfg.Serialize()})
+			if tt.wantCode == 0 {
+				require.NoError(t, err)
+				return
+			}
+			var cniErr *types.Error
+			require.ErrorAs(t, err, &cniErr)
+			assert.Equal(t, tt.wantCode, cniErr.Code)
+		})
+	}
+}
@@ -1,23 +1,32 @@
 package network
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"runtime"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cni/api"
 	"github.com/Azure/azure-container-networking/cni/util"
 	"github.com/Azure/azure-container-networking/cns"
+	cnscli "github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/common"
 	acnnetwork "github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/network/networkutils"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/nns"
+	"github.com/Azure/azure-container-networking/telemetry"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	cniTypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -123,6 +132,72 @@ func TestPluginAdd(t *testing.T) {
 	}
 }
 
+func TestPluginAddRetried(t *testing.T) {
+	plugin := GetTestResources()
+	args := &cniSkel.CmdArgs{
+		StdinData:   nwCfg.Serialize(),
+		ContainerID: "test-container",
+		Netns:       "test-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v", "test-pod", "test-pod-ns"),
+		IfName:      eth0IfName,
+	}
+	require.NoError(t, plugin.Add(args))
+	cniResult := plugin.cachedAddResult(args)
+	require.NotNil(t, cniResult)
+	require.Len(t, cniResult.IPs, 1)
+
+	// the retried add returns the result of the first one without allocating another ip
+	plugin.ipamInvoker = NewMockIpamInvoker(false, true, false, false, false)
+	require.NoError(t, plugin.Add(args))
+	endpoints, _ := plugin.nm.GetAllEndpoints(nwCfg.Name)
+	assert.Len(t, endpoints, 1)
+
+	// the result is kept by interface
+	args.IfName = "eth1"
+	assert.Nil(t, plugin.cachedAddResult(args))
+}
+
+func TestPluginAddEndpointValidationMode(t *testing.T) {
+	plugin := GetTestResources()
+	podUIDCfg := nwCfg
+	podUIDCfg.EndpointValidationMode = string(acnnetwork.ValidateByPodUID)
+	args := &cniSkel.CmdArgs{
+		StdinData:   podUIDCfg.Serialize(),
+		ContainerID: "test-container",
+		Netns:       "test-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v;K8S_POD_UID=%v", "test-pod", "test-pod-ns", "1d8d3c5e-6a4c-4c1a-9a3e-6f5b0b6f3a11"),
+		IfName:      eth0IfName,
+	}
+	require.NoError(t, plugin.Add(args))
+
+	endpoints, _ := plugin.nm.GetAllEndpoints(podUIDCfg.Name)
+	require.Len(t, endpoints, 1)
+	for _, ep := range endpoints {
+		assert.Equal(t, "1d8d3c5e-6a4c-4c1a-9a3e-6f5b0b6f3a11", ep.PODUID)
+		assert.Equal(t, acnnetwork.ValidateByPodUID, ep.EndpointValidationMode)
+	}
+}
+
+func TestPluginAddBridgeARP(t *testing.T) {
+	plugin := GetTestResources()
+	arpCfg := nwCfg
+	arpCfg.BridgeARP = &cni.BridgeARPConfig{DisableProxyARP: true, GratuitousARP: true}
+	args := &cniSkel.CmdArgs{
+		StdinData:   arpCfg.Serialize(),
+		ContainerID: "test-container",
+		Netns:       "test-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v", "test-pod", "test-pod-ns"),
+		IfName:      eth0IfName,
+	}
+	require.NoError(t, plugin.Add(args))
+
+	endpoints, _ := plugin.nm.GetAllEndpoints(arpCfg.Name)
+	require.Len(t, endpoints, 1)
+	for _, ep := range endpoints {
+		assert.Equal(t, &acnnetwork.ARPOptions{DisableProxyARP: true, GratuitousARP: true}, ep.ARP)
+	}
+}
+
 // Happy path scenario for delete
 func TestPluginDelete(t *testing.T) {
 	plugin := GetTestResources()
@@ -1203,6 +1278,28 @@ func TestGetAllEndpointState(t *testing.T) {
 	require.Exactly(t, res, state)
 }
 
+func TestGetAllEndpointStateWithTraffic(t *testing.T) {
+	plugin := GetTestResources()
+	networkid := "azure"
+
+	ep := getTestEndpoint("podname1", "podnamespace1", "10.0.0.1/24", "podinterfaceid1", "testcontainerid1")
+	ep.Data = map[string]interface{}{
+		acnnetwork.RxBytesKey:   uint64(100),
+		acnnetwork.TxBytesKey:   uint64(200),
+		acnnetwork.RxPacketsKey: uint64(1),
+		acnnetwork.TxPacketsKey: uint64(2),
+	}
+	ep.OperState = &acnnetwork.EndpointOperState{Up: true, MissingIPs: []string{"10.0.0.1"}}
+	require.NoError(t, plugin.nm.CreateEndpoint(nil, networkid, ep))
+
+	state, err := plugin.GetAllEndpointState(networkid)
+	require.NoError(t, err)
+	require.Equal(t, &api.EndpointTraffic{RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2},
+		state.ContainerInterfaces[ep.EndpointID].Traffic)
+	require.Equal(t, &api.EndpointOperState{Up: true, MissingIPs: []string{"10.0.0.1"}},
+		state.ContainerInterfaces[ep.EndpointID].OperState)
+}
+
 func TestEndpointsWithEmptyState(t *testing.T) {
 	plugin := GetTestResources()
 	networkid := "azure"
@@ -1849,3 +1946,450 @@ func TestValidateArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestSkipDNSRedirect(t *testing.T) {
+	exceptions := map[string]string{"kubernetes.azure.com/dns-redirect": "disabled"}
+
+	tests := []struct {
+		name        string
+		exceptions  map[string]string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name:        "Matching annotation",
+			exceptions:  exceptions,
+			annotations: map[string]string{"kubernetes.azure.com/dns-redirect": "disabled", "other": "value"},
+			want:        true,
+		},
+		{
+			name:        "Annotation with a different value",
+			exceptions:  exceptions,
+			annotations: map[string]string{"kubernetes.azure.com/dns-redirect": "enabled"},
+			want:        false,
+		},
+		{
+			name:        "No annotations",
+			exceptions:  exceptions,
+			annotations: nil,
+			want:        false,
+		},
+		{
+			name:        "No exceptions configured",
+			exceptions:  nil,
+			annotations: map[string]string{"kubernetes.azure.com/dns-redirect": "disabled"},
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{
+				DNSRedirectExceptionAnnotations: tt.exceptions,
+				RuntimeConfig:                   cni.RuntimeConfig{PodAnnotations: tt.annotations},
+			}
+			require.Equal(t, tt.want, cfg.SkipDNSRedirect())
+		})
+	}
+}
+
+func TestEthtoolProfile(t *testing.T) {
+	profiles := map[string]cni.EthtoolProfile{"high-throughput": {RxRing: 4096, TxRing: 4096, CombinedChannels: 16}}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *cni.EthtoolProfile
+		wantErr     error
+	}{
+		{
+			name:        "Selected profile",
+			annotations: map[string]string{cni.EthtoolProfileAnnotation: "high-throughput"},
+			want:        &cni.EthtoolProfile{RxRing: 4096, TxRing: 4096, CombinedChannels: 16},
+		},
+		{
+			name:        "No profile selected",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Unknown profile",
+			annotations: map[string]string{cni.EthtoolProfileAnnotation: "low-latency"},
+			wantErr:     cni.ErrUnknownEthtoolProfile,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{
+				EthtoolProfiles: profiles,
+				RuntimeConfig:   cni.RuntimeConfig{PodAnnotations: tt.annotations},
+			}
+			got, err := cfg.EthtoolProfile()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStaticIPs(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+		wantErr     error
+	}{
+		{
+			name:        "Single static IP",
+			annotations: map[string]string{cni.StaticIPAnnotation: "10.0.0.5"},
+			want:        []string{"10.0.0.5"},
+		},
+		{
+			name:        "Dual stack static IPs",
+			annotations: map[string]string{cni.StaticIPAnnotation: "10.0.0.5, fd00::5"},
+			want:        []string{"10.0.0.5", "fd00::5"},
+		},
+		{
+			name:        "No static IP",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Invalid static IP",
+			annotations: map[string]string{cni.StaticIPAnnotation: "10.0.0.500"},
+			wantErr:     cni.ErrInvalidStaticIP,
+		},
+		{
+			name:        "Two static IPs of a family",
+			annotations: map[string]string{cni.StaticIPAnnotation: "10.0.0.5,10.0.0.6"},
+			wantErr:     cni.ErrInvalidStaticIP,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{RuntimeConfig: cni.RuntimeConfig{PodAnnotations: tt.annotations}}
+			got, err := cfg.StaticIPs()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIPFamilies(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []cns.IPFamily
+		wantErr     error
+	}{
+		{
+			name:        "IPv4 only",
+			annotations: map[string]string{cni.IPFamiliesAnnotation: "IPv4"},
+			want:        []cns.IPFamily{cns.IPv4Family},
+		},
+		{
+			name:        "Dual stack",
+			annotations: map[string]string{cni.IPFamiliesAnnotation: "ipv4, IPv6"},
+			want:        []cns.IPFamily{cns.IPv4Family, cns.IPv6Family},
+		},
+		{
+			name:        "No families requested",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Unknown family",
+			annotations: map[string]string{cni.IPFamiliesAnnotation: "IPv5"},
+			wantErr:     cni.ErrInvalidIPFamilies,
+		},
+		{
+			name:        "Repeated family",
+			annotations: map[string]string{cni.IPFamiliesAnnotation: "IPv6,IPv6"},
+			wantErr:     cni.ErrInvalidIPFamilies,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{RuntimeConfig: cni.RuntimeConfig{PodAnnotations: tt.annotations}}
+			got, err := cfg.IPFamilies()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSecondaryIPs(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int
+		wantErr     error
+	}{
+		{
+			name:        "Secondary IPs",
+			annotations: map[string]string{cni.SecondaryIPsAnnotation: " 2 "},
+			want:        2,
+		},
+		{
+			name:        "No secondary IPs requested",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Not a number",
+			annotations: map[string]string{cni.SecondaryIPsAnnotation: "two"},
+			wantErr:     cni.ErrInvalidSecondaryIPs,
+		},
+		{
+			name:        "Negative",
+			annotations: map[string]string{cni.SecondaryIPsAnnotation: "-1"},
+			wantErr:     cni.ErrInvalidSecondaryIPs,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{RuntimeConfig: cni.RuntimeConfig{PodAnnotations: tt.annotations}}
+			got, err := cfg.SecondaryIPs()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDSCP(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int
+		wantErr     error
+	}{
+		{
+			name:        "Expedited forwarding",
+			annotations: map[string]string{cni.DSCPAnnotation: " 46 "},
+			want:        46,
+		},
+		{
+			name:        "No dscp requested",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Not a number",
+			annotations: map[string]string{cni.DSCPAnnotation: "EF"},
+			wantErr:     cni.ErrInvalidDSCP,
+		},
+		{
+			name:        "Out of range",
+			annotations: map[string]string{cni.DSCPAnnotation: "64"},
+			wantErr:     cni.ErrInvalidDSCP,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{RuntimeConfig: cni.RuntimeConfig{PodAnnotations: tt.annotations}}
+			got, err := cfg.DSCP()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFlowLogs(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+		wantErr     error
+	}{
+		{
+			name:        "Flow logs requested",
+			annotations: map[string]string{cni.FlowLogsAnnotation: " true "},
+			want:        true,
+		},
+		{
+			name:        "Flow logs turned off",
+			annotations: map[string]string{cni.FlowLogsAnnotation: "false"},
+		},
+		{
+			name:        "No flow logs requested",
+			annotations: map[string]string{"other": "value"},
+		},
+		{
+			name:        "Not a bool",
+			annotations: map[string]string{cni.FlowLogsAnnotation: "sampled"},
+			wantErr:     cni.ErrInvalidFlowLogs,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &cni.NetworkConfig{RuntimeConfig: cni.RuntimeConfig{PodAnnotations: tt.annotations}}
+			got, err := cfg.FlowLogs()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewIPAllocationRecord(t *testing.T) {
+	stats := &cns.IPAllocationStats{WaitForIP: 3 * time.Second, Requests: 2, WaitForPoolScaling: 2 * time.Second}
+
+	record := newIPAllocationRecord(time.Second, stats, nil)
+	assert.Equal(t, &telemetry.IPAllocationRecord{
+		IPAMDuration:       time.Second,
+		WaitForIP:          3 * time.Second,
+		CNSRequests:        2,
+		WaitForPoolScaling: 2 * time.Second,
+	}, record)
+
+	cnsErr := &cnscli.CNSClientError{Code: types.FailedToAllocateIPConfig, Err: errors.New("no IPs")}
+	record = newIPAllocationRecord(time.Second, nil, errors.Wrap(cnsErr, "failed to get IP address from CNS"))
+	assert.Equal(t, types.FailedToAllocateIPConfig.String(), record.ErrorCode)
+
+	record = newIPAllocationRecord(time.Second, nil, errors.New("ipam plugin failed"))
+	assert.Equal(t, telemetry.IPAMErrorStr, record.ErrorCode)
+}
+
+// fakeSandboxInspector returns the states in order, then keeps returning the last one.
+type fakeSandboxInspector struct {
+	states []sandboxState
+	calls  int
+}
+
+func (f *fakeSandboxInspector) State(string) (sandboxState, error) {
+	state := f.states[min(f.calls, len(f.states)-1)]
+	f.calls++
+	return state, nil
+}
+
+func TestPluginDeleteDeferredUntilSandboxExit(t *testing.T) {
+	cfg := nwCfg
+	cfg.DeferDelUntilSandboxExit = true
+	args := &cniSkel.CmdArgs{
+		StdinData:   cfg.Serialize(),
+		ContainerID: "test-container",
+		Netns:       "test-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v", "test-pod", "test-pod-ns"),
+		IfName:      eth0IfName,
+	}
+
+	plugin := GetTestResources()
+	require.NoError(t, plugin.Add(args))
+
+	// the containers still run, the del is retried once they exited
+	inspector := &fakeSandboxInspector{states: []sandboxState{sandboxRunning, sandboxExited}}
+	plugin.sandboxInspector = inspector
+	err := plugin.Delete(args)
+	var cniErr *cniTypes.Error
+	require.ErrorAs(t, err, &cniErr)
+	assert.Equal(t, cniTypes.ErrTryAgainLater, cniErr.Code)
+	assert.Equal(t, 1, inspector.calls)
+	endpoints, _ := plugin.nm.GetAllEndpoints(cfg.Name)
+	assert.NotEmpty(t, endpoints)
+
+	require.NoError(t, plugin.Delete(args))
+	assert.Equal(t, 2, inspector.calls)
+	endpoints, _ = plugin.nm.GetAllEndpoints(cfg.Name)
+	assert.Empty(t, endpoints)
+}
+
+func TestCheckSandboxExit(t *testing.T) {
+	plugin := GetTestResources()
+
+	plugin.sandboxInspector = &fakeSandboxInspector{states: []sandboxState{sandboxGone}}
+	state, err := plugin.checkSandboxExit("netns")
+	require.NoError(t, err)
+	assert.Equal(t, sandboxGone, state)
+
+	inspector := &fakeSandboxInspector{states: []sandboxState{sandboxRunning}}
+	plugin.sandboxInspector = inspector
+	state, err = plugin.checkSandboxExit("netns")
+	require.ErrorIs(t, err, errSandboxRunning)
+	assert.Equal(t, sandboxRunning, state)
+	assert.Equal(t, 1, inspector.calls)
+}
+
+func TestWithErrorCode(t *testing.T) {
+	plugin := GetTestResources()
+	plugin.sandboxInspector = &fakeSandboxInspector{states: []sandboxState{sandboxExited}}
+
+	cnsErr := &cnscli.CNSClientError{Code: types.FailedToAllocateIPConfig, Err: errors.New("no free ip")}
+	err := plugin.withErrorCode(fmt.Errorf("IPAM Invoker Add failed with error: %w", errors.Wrap(cnsErr, "failed to get IP address from CNS")), "netns")
+	var cniErr *cniTypes.Error
+	require.ErrorAs(t, err, &cniErr)
+	assert.Equal(t, cni.ErrIPAMExhausted, cniErr.Code)
+	assert.True(t, cni.IsRetryable(cniErr.Code))
+
+	err = plugin.withErrorCode(errors.Wrap(&url.Error{Op: "Post", URL: "http://localhost:10090", Err: errors.New("connection refused")}, "http request failed"), "netns")
+	require.ErrorAs(t, err, &cniErr)
+	assert.Equal(t, cni.ErrCNSUnreachable, cniErr.Code)
+
+	// a request to cns which ran past the deadline of the command fails with a url error too, it is retried
+	err = plugin.withErrorCode(errors.Wrap(&url.Error{Op: "Post", URL: "http://localhost:10090", Err: context.DeadlineExceeded}, "http request failed"), "netns")
+	require.ErrorAs(t, err, &cniErr)
+	assert.Equal(t, cniTypes.ErrTryAgainLater, cniErr.Code)
+
+	// the errors with a code of their own are kept
+	err = plugin.withErrorCode(plugin.RetriableError(errors.New("failed to save state")), "netns")
+	require.ErrorAs(t, err, &cniErr)
+	assert.Equal(t, cniTypes.ErrTryAgainLater, cniErr.Code)
+
+	// and the ones without a code are kept as they are while the netns is there
+	err = plugin.withErrorCode(errors.New("failed to create endpoint"), "netns")
+	assert.False(t, errors.As(err, &cniErr))
+
+	plugin.sandboxInspector = &fakeSandboxInspector{states: []sandboxState{sandboxGone}}
+	err = plugin.withErrorCode(plugin.Errorf("failed to create endpoint"), "netns")
+	require.ErrorAs(t, err, &cniErr)
+	assert.Equal(t, cni.ErrNetNsGone, cniErr.Code)
+	assert.False(t, cni.IsRetryable(cniErr.Code))
+	require.ErrorIs(t, plugin.withErrorCode(errSandboxRunning, "netns"), errSandboxRunning)
+
+	record := &telemetry.IPAllocationRecord{ErrorCode: telemetry.DatapathErrorStr}
+	recordErrorCode(record, err)
+	assert.Equal(t, "NetNsGone", record.ErrorCode)
+	assert.False(t, record.Retryable)
+}
+
+func TestErrorResult(t *testing.T) {
+	data, err := json.Marshal(cni.NewErrorResult(cniTypes.NewError(cni.ErrHNSFailure, "failed to create endpoint", "")))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"code":103,"msg":"failed to create endpoint","retryable":true}`, string(data))
+}
+
+func TestValidateEBPFDatapath(t *testing.T) {
+	tests := []struct {
+		name    string
+		nwCfg   cni.NetworkConfig
+		wantErr error
+	}{
+		{
+			name:  "ebpf datapath without policy engine",
+			nwCfg: cni.NetworkConfig{EnableEBPFDatapath: true},
+		},
+		{
+			name:  "policy engine without ebpf datapath",
+			nwCfg: cni.NetworkConfig{NetworkPolicyEngine: "azure-npm"},
+		},
+		{
+			name:    "ebpf datapath with policy engine",
+			nwCfg:   cni.NetworkConfig{EnableEBPFDatapath: true, NetworkPolicyEngine: "azure-npm"},
+			wantErr: cni.ErrEBPFDatapathPolicy,
+		},
+		{
+			name:    "ebpf datapath with ipvlan datapath",
+			nwCfg:   cni.NetworkConfig{EnableEBPFDatapath: true, EnableIPVlanL3S: true},
+			wantErr: cni.ErrEBPFDatapathIPVlan,
+		},
+		{
+			name:    "ebpf datapath with macvlan datapath",
+			nwCfg:   cni.NetworkConfig{EnableEBPFDatapath: true, EnableMacvlan: true},
+			wantErr: cni.ErrEBPFDatapathMacvlan,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.nwCfg.ValidateEBPFDatapath(), tt.wantErr)
+		})
+	}
+}
@@ -31,6 +31,16 @@ var (
 	dualStackCount = 2
 )
 
+const (
+	// hostVSwitchInterfacePrefix prefixes the host vNICs of the hns vSwitches
+	hostVSwitchInterfacePrefix = "vEthernet"
+	// vmbusPnPIDPrefix prefixes the PnP device IDs of the synthetic nics of the vm, which the delegated nics are
+	vmbusPnPIDPrefix = `VMBUS\`
+)
+
+// dnsProxySupported is whether cns can intercept the dns of the pods with its dns proxy.
+const dnsProxySupported = false
+
 func addDefaultRoute(_ string, _ *network.EndpointInfo, _ *network.InterfaceInfo) {
 }
 
@@ -74,7 +84,7 @@ func (plugin *NetPlugin) getNetworkName(netNs string, interfaceInfo *network.Int
 	determineWinVer()
 	// Swiftv2 L1VH Network Name
 	swiftv2NetworkNamePrefix := "azure-"
-	if interfaceInfo != nil && (interfaceInfo.NICType == cns.NodeNetworkInterfaceFrontendNIC || interfaceInfo.NICType == cns.BackendNIC) {
+	if interfaceInfo != nil && (interfaceInfo.NICType.IsFrontendNIC() || interfaceInfo.NICType == cns.BackendNIC) {
 		logger.Info("swiftv2", zap.String("network name", interfaceInfo.MacAddress.String()))
 		return swiftv2NetworkNamePrefix + interfaceInfo.MacAddress.String(), nil
 	}
@@ -398,6 +408,15 @@ func getNATInfo(nwCfg *cni.NetworkConfig, ncPrimaryIPIface interface{}, enableSn
 	return natInfo
 }
 
+// getOutboundNATExceptions returns the SNAT exceptions of the interface's NC, which are added to the OutboundNAT
+// policy of the endpoint.
+func getOutboundNATExceptions(ifInfo *network.InterfaceInfo) []string {
+	return ifInfo.SNATExceptionCIDRs
+}
+
+// setAttachmentVethName is a no-op, the hcn endpoints are named by their endpoint id.
+func setAttachmentVethName(_ *network.EndpointInfo, _ string) {}
+
 func platformInit(cniConfig *cni.NetworkConfig) {
 	if cniConfig.WindowsSettings.HnsTimeoutDurationInSeconds > 0 {
 		logger.Info("Enabling timeout for Hns calls",
@@ -407,6 +426,14 @@ func platformInit(cniConfig *cni.NetworkConfig) {
 	}
 }
 
+// checkDatapath returns an error when hns doesn't respond, the endpoints of the pods can't be created until it does.
+func checkDatapath() error {
+	if _, err := hnsv2.GetGlobals(); err != nil {
+		return errors.Wrap(err, "hns is not healthy")
+	}
+	return nil
+}
+
 // isDualNicFeatureSupported returns if the dual nic feature is supported. Currently it's only supported for windows hnsv2 path
 func (plugin *NetPlugin) isDualNicFeatureSupported(netNs string) bool {
 	useHnsV2, err := network.UseHnsV2(netNs)
@@ -417,6 +444,54 @@ func (plugin *NetPlugin) isDualNicFeatureSupported(netNs string) bool {
 	return false
 }
 
+// findDelegatedInterface returns the name of the delegated nic, found by the PnP device ID CNS gives for it, or else by
+// its mac among the synthetic nics of the vm: the VF of an accelerated nic and the host vNIC of a vSwitch carry the same
+// mac, and hns fails to create a network on either. The PnP device ID found is recorded on the interface.
+func (plugin *NetPlugin) findDelegatedInterface(ifInfo *network.InterfaceInfo) string {
+	if plugin.execClient == nil {
+		return plugin.findInterfaceByMAC(ifInfo.MacAddress.String())
+	}
+
+	filter := fmt.Sprintf("$_.MacAddress -eq '%s' -and $_.PnPDeviceID -like '%s*'",
+		strings.ToUpper(strings.ReplaceAll(ifInfo.MacAddress.String(), ":", "-")), vmbusPnPIDPrefix)
+	if ifInfo.PnPID != "" {
+		filter = fmt.Sprintf("$_.PnPDeviceID -eq '%s'", strings.ReplaceAll(ifInfo.PnPID, "'", "''"))
+	}
+	cmd := fmt.Sprintf("Get-NetAdapter | Where-Object { %s } | ForEach-Object { $_.Name + '|' + $_.PnPDeviceID }", filter)
+	out, err := plugin.execClient.ExecutePowershellCommand(cmd)
+	var adapters []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			adapters = append(adapters, line)
+		}
+	}
+	if err != nil || len(adapters) != 1 {
+		logger.Error("Failed to find delegated nic by PnP device ID", zap.String("macAddress", ifInfo.MacAddress.String()),
+			zap.String("pnpID", ifInfo.PnPID), zap.Strings("adapters", adapters), zap.Error(err))
+		if ifInfo.PnPID != "" {
+			// the nic CNS names is not on the node, another nic of the same mac is not it
+			return ""
+		}
+		return plugin.findInterfaceByMAC(ifInfo.MacAddress.String())
+	}
+
+	name, pnpID, _ := strings.Cut(adapters[0], "|")
+	ifInfo.PnPID = pnpID
+	return name
+}
+
+// isHostVSwitchInterface returns if the interface is the host vNIC of a vSwitch. The host vNIC carries the mac of the
+// nic the vSwitch is bound to, and hns fails to create a network on a vSwitch interface
+func isHostVSwitchInterface(ifName string) bool {
+	return strings.HasPrefix(ifName, hostVSwitchInterfacePrefix)
+}
+
+// getOnLinkGatewayRoutes returns no route, hns routes have no scope and reach the gateway through the vswitch port of
+// the endpoint whatever the prefix of the pod ip.
+func getOnLinkGatewayRoutes(*net.IPNet, net.IP) []network.RouteInfo {
+	return nil
+}
+
 func getOverlayGateway(podsubnet *net.IPNet) (net.IP, error) {
 	logger.Warn("No gateway specified for Overlay NC. CNI will choose one, but connectivity may break")
 	ncgw := podsubnet.IP
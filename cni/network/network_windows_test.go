@@ -4,7 +4,9 @@
 package network
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
@@ -1291,16 +1293,17 @@ func TestPluginWindowsAdd(t *testing.T) {
 					epID = endpointInfo.EndpointID
 					require.Regexp(t, regexp.MustCompile(wantedEndpointEntry.epIDRegex), epID)
 
-					// omit endpoint id and ifname fields as they are nondeterministic
+					// omit endpoint id and ifname fields as they are nondeterministic, and the add result checked by the add tests
 					endpointInfo.EndpointID = ""
 					endpointInfo.IfName = ""
+					endpointInfo.AddResult = nil
 
 					require.Equal(t, wantedEndpointEntry.epInfo, endpointInfo)
 				}
 				if epID == "none" {
 					t.Fail()
 				}
-				err = tt.plugin.nm.DeleteEndpoint("", epID, nil)
+				err = tt.plugin.nm.DeleteEndpoint(context.Background(), "", epID, nil)
 				require.NoError(t, err)
 			}
 
@@ -1342,3 +1345,148 @@ func TestPluginWindowsAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestFindInterfaceByMACSkipsHostVSwitchInterface(t *testing.T) {
+	macAddress, _ := net.ParseMAC("60:45:bd:12:45:65")
+	plugin := &NetPlugin{
+		netClient: &InterfaceGetterMock{
+			interfaces: []net.Interface{
+				{
+					Name:         "vEthernet (azure-60:45:bd:12:45:65)",
+					HardwareAddr: macAddress,
+				},
+				{
+					Name:         "Ethernet 3",
+					HardwareAddr: macAddress,
+				},
+			},
+		},
+	}
+
+	require.Equal(t, "Ethernet 3", plugin.findInterfaceByMAC(macAddress.String()))
+}
+
+func TestFindDelegatedInterface(t *testing.T) {
+	macAddress, _ := net.ParseMAC("60:45:bd:12:45:65")
+	netClient := &InterfaceGetterMock{
+		interfaces: []net.Interface{
+			{
+				Name:         "vEthernet (azure-60:45:bd:12:45:65)",
+				HardwareAddr: macAddress,
+			},
+			{
+				Name:         "Ethernet 3",
+				HardwareAddr: macAddress,
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		pnpID         string
+		response      string
+		err           error
+		wantCmd       string
+		wantInterface string
+		wantPnPID     string
+	}{
+		{
+			name:          "pnp id of cns",
+			pnpID:         `VMBUS\{abc}`,
+			response:      `Ethernet 2|VMBUS\{abc}` + "\r\n",
+			wantCmd:       `$_.PnPDeviceID -eq 'VMBUS\{abc}'`,
+			wantInterface: "Ethernet 2",
+			wantPnPID:     `VMBUS\{abc}`,
+		},
+		{
+			name:          "synthetic nic of the mac",
+			response:      `Ethernet 2|VMBUS\{def}` + "\r\n",
+			wantCmd:       `$_.MacAddress -eq '60-45-BD-12-45-65' -and $_.PnPDeviceID -like 'VMBUS\*'`,
+			wantInterface: "Ethernet 2",
+			wantPnPID:     `VMBUS\{def}`,
+		},
+		{
+			name:          "falls back to the mac without a pnp id",
+			err:           errors.New("powershell failed"),
+			wantInterface: "Ethernet 3",
+		},
+		{
+			name:          "pnp id of cns not on the node",
+			pnpID:         `VMBUS\{abc}`,
+			wantInterface: "",
+			wantPnPID:     `VMBUS\{abc}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			execClient := platform.NewMockExecClient(false)
+			execClient.SetPowershellCommandResponder(func(cmd string) (string, error) {
+				if tt.wantCmd != "" {
+					assert.Contains(t, cmd, tt.wantCmd)
+				}
+				return tt.response, tt.err
+			})
+			plugin := &NetPlugin{netClient: netClient, execClient: execClient}
+			ifInfo := &network.InterfaceInfo{MacAddress: macAddress, PnPID: tt.pnpID}
+
+			require.Equal(t, tt.wantInterface, plugin.findDelegatedInterface(ifInfo))
+			require.Equal(t, tt.wantPnPID, ifInfo.PnPID)
+		})
+	}
+}
+
+func TestNetAdapterNICTypeDetector(t *testing.T) {
+	macAddress, _ := net.ParseMAC("60:45:bd:12:45:65")
+
+	tests := []struct {
+		name      string
+		response  string
+		want      cns.NICType
+		wantPnPID string
+		wantErr   bool
+	}{
+		{
+			name:     "synthetic nic",
+			response: `VMBUS\{abc}|14` + "\r\n",
+			want:     cns.NodeNetworkInterfaceFrontendNIC,
+		},
+		{
+			name:     "accelnet nic",
+			response: `VMBUS\{abc}|14` + "\r\n" + `PCI\VEN_15B3&DEV_101A\1|14` + "\r\n",
+			want:     cns.NodeNetworkInterfaceAccelnetFrontendNIC,
+		},
+		{
+			name:      "infiniband nic",
+			response:  `PCI\VEN_15B3&DEV_101C\1|11` + "\r\n",
+			want:      cns.BackendNIC,
+			wantPnPID: `PCI\VEN_15B3&DEV_101C\1`,
+		},
+		{
+			name:    "nic not on the node",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			execClient := platform.NewMockExecClient(false)
+			execClient.SetPowershellCommandResponder(func(cmd string) (string, error) {
+				assert.Contains(t, cmd, "$_.MacAddress -eq '60-45-BD-12-45-65'")
+				return tt.response, nil
+			})
+			ifInfo := &network.InterfaceInfo{MacAddress: macAddress}
+
+			nicType, err := netAdapterNICTypeDetector{execClient: execClient}.Detect(ifInfo)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, nicType)
+			assert.Equal(t, tt.wantPnPID, ifInfo.PnPID)
+		})
+	}
+}
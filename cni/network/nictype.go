@@ -0,0 +1,50 @@
+package network
+
+import (
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var errNICNotFound = errors.New("nic not found on the node")
+
+// nicTypeDetector returns the type of a delegated nic from the metadata of its device on the node.
+type nicTypeDetector interface {
+	Detect(ifInfo *network.InterfaceInfo) (cns.NICType, error)
+}
+
+// detectNICTypes sets the type of the delegated nics of the pod to the type of their device, rather than rely on the
+// orchestrator to pass the right one. A nic whose device can't be inspected keeps the type of the orchestrator, and so
+// does a nic which lacks what the detected type needs: the ips of a frontend nic or the pnp id of a backend nic.
+func (plugin *NetPlugin) detectNICTypes(interfaceInfo map[string]network.InterfaceInfo) {
+	if plugin.nicTypeDetector == nil {
+		plugin.nicTypeDetector = newNICTypeDetector(plugin)
+	}
+
+	for key, ifInfo := range interfaceInfo {
+		if !ifInfo.NICType.IsFrontendNIC() && ifInfo.NICType != cns.BackendNIC {
+			continue
+		}
+
+		nicType, err := plugin.nicTypeDetector.Detect(&ifInfo)
+		if err != nil {
+			logger.Warn("Failed to detect the nic type, keeping the type of the orchestrator", zap.String("macAddress", ifInfo.MacAddress.String()),
+				zap.String("nicType", string(ifInfo.NICType)), zap.Error(err))
+			continue
+		}
+		if nicType == ifInfo.NICType {
+			continue
+		}
+		if (nicType == cns.BackendNIC && ifInfo.PnPID == "") || (nicType.IsFrontendNIC() && len(ifInfo.IPConfigs) == 0) {
+			logger.Warn("Detected nic type lacks the config of the orchestrator, keeping the type of the orchestrator",
+				zap.String("macAddress", ifInfo.MacAddress.String()), zap.String("nicType", string(ifInfo.NICType)), zap.String("detectedNICType", string(nicType)))
+			continue
+		}
+
+		logger.Info("Detected nic type differs from the orchestrator", zap.String("macAddress", ifInfo.MacAddress.String()),
+			zap.String("nicType", string(ifInfo.NICType)), zap.String("detectedNICType", string(nicType)))
+		ifInfo.NICType = nicType
+		interfaceInfo[key] = ifInfo
+	}
+}
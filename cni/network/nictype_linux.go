@@ -0,0 +1,56 @@
+package network
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/pkg/errors"
+)
+
+// arphrdInfiniband is the sysfs type of the IPoIB interfaces, see if_arp.h.
+const arphrdInfiniband = "32"
+
+// sysfsNICTypeDetector finds the type of a nic by the interfaces of its mac in sysfs. The VF of an accelnet nic shares
+// the mac of its synthetic nic, which the VF is enslaved to.
+type sysfsNICTypeDetector struct {
+	netClient       InterfaceGetter
+	sysClassNetPath string
+}
+
+func newNICTypeDetector(plugin *NetPlugin) nicTypeDetector {
+	return sysfsNICTypeDetector{netClient: plugin.netClient, sysClassNetPath: "/sys/class/net"}
+}
+
+func (d sysfsNICTypeDetector) Detect(ifInfo *network.InterfaceInfo) (cns.NICType, error) {
+	interfaces, err := d.netClient.GetNetworkInterfaces()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get interfaces")
+	}
+
+	names := map[string]struct{}{}
+	for _, iface := range interfaces {
+		if bytes.Equal(iface.HardwareAddr, ifInfo.MacAddress) {
+			names[iface.Name] = struct{}{}
+		}
+	}
+	if len(names) == 0 {
+		return "", errors.Wrapf(errNICNotFound, "no interface has mac %s", ifInfo.MacAddress)
+	}
+
+	nicType := cns.NodeNetworkInterfaceFrontendNIC
+	for name := range names {
+		if t, err := os.ReadFile(filepath.Join(d.sysClassNetPath, name, "type")); err == nil && strings.TrimSpace(string(t)) == arphrdInfiniband {
+			return cns.BackendNIC, nil
+		}
+		if master, err := os.Readlink(filepath.Join(d.sysClassNetPath, name, "master")); err == nil {
+			if _, ok := names[filepath.Base(master)]; ok {
+				nicType = cns.NodeNetworkInterfaceAccelnetFrontendNIC
+			}
+		}
+	}
+	return nicType, nil
+}
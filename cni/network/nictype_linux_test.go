@@ -0,0 +1,108 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysfsNICTypeDetector(t *testing.T) {
+	synthetic, _ := net.ParseMAC("60:45:bd:12:45:65")
+	accelnet, _ := net.ParseMAC("60:45:bd:12:45:66")
+	ib, _ := net.ParseMAC("60:45:bd:12:45:67")
+	missing, _ := net.ParseMAC("60:45:bd:12:45:68")
+
+	sysfs := t.TempDir()
+	for name, arphrd := range map[string]string{"eth1": "1", "eth2": "1", "enP1s1": "1", "ib0": arphrdInfiniband} {
+		require.NoError(t, os.MkdirAll(filepath.Join(sysfs, name), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(sysfs, name, "type"), []byte(arphrd+"\n"), 0o600))
+	}
+	// the VF of eth2 is enslaved to it
+	require.NoError(t, os.Symlink("../eth2", filepath.Join(sysfs, "enP1s1", "master")))
+
+	d := sysfsNICTypeDetector{
+		netClient: &InterfaceGetterMock{
+			interfaces: []net.Interface{
+				{Name: "eth1", HardwareAddr: synthetic},
+				{Name: "eth2", HardwareAddr: accelnet},
+				{Name: "enP1s1", HardwareAddr: accelnet},
+				{Name: "ib0", HardwareAddr: ib},
+			},
+		},
+		sysClassNetPath: sysfs,
+	}
+
+	tests := []struct {
+		name    string
+		mac     net.HardwareAddr
+		want    cns.NICType
+		wantErr error
+	}{
+		{name: "synthetic nic", mac: synthetic, want: cns.NodeNetworkInterfaceFrontendNIC},
+		{name: "accelnet nic", mac: accelnet, want: cns.NodeNetworkInterfaceAccelnetFrontendNIC},
+		{name: "infiniband nic", mac: ib, want: cns.BackendNIC},
+		{name: "nic not on the node", mac: missing, wantErr: errNICNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nicType, err := d.Detect(&network.InterfaceInfo{MacAddress: tt.mac})
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, nicType)
+		})
+	}
+}
+
+type fakeNICTypeDetector struct {
+	types map[string]cns.NICType
+}
+
+func (d fakeNICTypeDetector) Detect(ifInfo *network.InterfaceInfo) (cns.NICType, error) {
+	nicType, ok := d.types[ifInfo.MacAddress.String()]
+	if !ok {
+		return "", errNICNotFound
+	}
+	return nicType, nil
+}
+
+func TestDetectNICTypes(t *testing.T) {
+	frontend, _ := net.ParseMAC("60:45:bd:12:45:65")
+	accelnet, _ := net.ParseMAC("60:45:bd:12:45:66")
+	backend, _ := net.ParseMAC("60:45:bd:12:45:67")
+	undetected, _ := net.ParseMAC("60:45:bd:12:45:68")
+	ipConfigs := []*network.IPConfig{{Address: net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)}}}
+
+	plugin := &NetPlugin{
+		nicTypeDetector: fakeNICTypeDetector{types: map[string]cns.NICType{
+			frontend.String():   cns.NodeNetworkInterfaceFrontendNIC,
+			accelnet.String():   cns.NodeNetworkInterfaceAccelnetFrontendNIC,
+			backend.String():    cns.BackendNIC,
+			undetected.String(): cns.BackendNIC,
+		}},
+	}
+	interfaceInfo := map[string]network.InterfaceInfo{
+		string(cns.InfraNIC): {NICType: cns.InfraNIC, IPConfigs: ipConfigs},
+		frontend.String():    {NICType: cns.NodeNetworkInterfaceFrontendNIC, MacAddress: frontend, IPConfigs: ipConfigs},
+		accelnet.String():    {NICType: cns.NodeNetworkInterfaceFrontendNIC, MacAddress: accelnet, IPConfigs: ipConfigs},
+		backend.String():     {NICType: cns.NodeNetworkInterfaceFrontendNIC, MacAddress: backend, IPConfigs: ipConfigs, PnPID: "PCI\\VEN_15B3"},
+		// an infiniband nic without the pnp id it is handed to the pod by
+		undetected.String(): {NICType: cns.NodeNetworkInterfaceFrontendNIC, MacAddress: undetected, IPConfigs: ipConfigs},
+	}
+
+	plugin.detectNICTypes(interfaceInfo)
+	assert.Equal(t, cns.InfraNIC, interfaceInfo[string(cns.InfraNIC)].NICType)
+	assert.Equal(t, cns.NodeNetworkInterfaceFrontendNIC, interfaceInfo[frontend.String()].NICType)
+	assert.Equal(t, cns.NodeNetworkInterfaceAccelnetFrontendNIC, interfaceInfo[accelnet.String()].NICType)
+	assert.Equal(t, cns.BackendNIC, interfaceInfo[backend.String()].NICType)
+	assert.Equal(t, cns.NodeNetworkInterfaceFrontendNIC, interfaceInfo[undetected.String()].NICType)
+}
@@ -0,0 +1,68 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+)
+
+const (
+	// pciPnPIDPrefix prefixes the PnP device IDs of the VFs of the accelnet nics
+	pciPnPIDPrefix = `PCI\`
+	// ndisPhysicalMediumInfiniband is the NdisPhysicalMedium of the IPoIB adapters, see NDIS_PHYSICAL_MEDIUM
+	ndisPhysicalMediumInfiniband = "11"
+)
+
+var errPowershellNotAvailable = errors.New("powershell is not available")
+
+// netAdapterNICTypeDetector finds the type of a nic by the adapters of its mac. The VF of an accelnet nic, a PCI
+// device, shares the mac of its synthetic VMBus nic.
+type netAdapterNICTypeDetector struct {
+	execClient platform.ExecClient
+}
+
+func newNICTypeDetector(plugin *NetPlugin) nicTypeDetector {
+	return netAdapterNICTypeDetector{execClient: plugin.execClient}
+}
+
+func (d netAdapterNICTypeDetector) Detect(ifInfo *network.InterfaceInfo) (cns.NICType, error) {
+	if d.execClient == nil {
+		return "", errPowershellNotAvailable
+	}
+
+	cmd := fmt.Sprintf("Get-NetAdapter -IncludeHidden | Where-Object { $_.MacAddress -eq '%s' } | ForEach-Object { $_.PnPDeviceID + '|' + $_.NdisPhysicalMedium }",
+		strings.ToUpper(strings.ReplaceAll(ifInfo.MacAddress.String(), ":", "-")))
+	out, err := d.execClient.ExecutePowershellCommand(cmd)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the adapters of the mac")
+	}
+
+	var synthetic, vf bool
+	for _, line := range strings.Split(out, "\n") {
+		pnpID, medium, found := strings.Cut(strings.TrimSpace(line), "|")
+		if !found {
+			continue
+		}
+		if medium == ndisPhysicalMediumInfiniband {
+			if ifInfo.PnPID == "" {
+				ifInfo.PnPID = pnpID
+			}
+			return cns.BackendNIC, nil
+		}
+		synthetic = synthetic || strings.HasPrefix(pnpID, vmbusPnPIDPrefix)
+		vf = vf || strings.HasPrefix(pnpID, pciPnPIDPrefix)
+	}
+
+	switch {
+	case synthetic && vf:
+		return cns.NodeNetworkInterfaceAccelnetFrontendNIC, nil
+	case synthetic:
+		return cns.NodeNetworkInterfaceFrontendNIC, nil
+	default:
+		return "", errors.Wrapf(errNICNotFound, "no adapter has mac %s", ifInfo.MacAddress)
+	}
+}
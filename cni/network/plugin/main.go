@@ -4,6 +4,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -82,6 +83,11 @@ func rootExecute() error {
 	if cniCmd != cni.CmdVersion {
 		logger.Info("Environment variable set", zap.String("CNI_COMMAND", cniCmd))
 
+		// reading the counters of every endpoint is only worth it for the cns traffic api
+		config.CollectEndpointStats = cniCmd == cni.CmdGetEndpointsStats
+		// the state is only rebuilt from the dataplane when cns asks for it, before it reconciles its ips with the pods
+		config.RecoverEndpointState = cniCmd == cni.CmdRecoverEndpointState
+
 		cniReport.GetReport(pluginName, version, ipamQueryURL)
 
 		var upTime time.Time
@@ -91,6 +97,9 @@ func rootExecute() error {
 			cniReport.VMUptime = upTime.Format("2006-01-02 15:04:05")
 		}
 
+		// deferred before the lock is acquired, so that the spans are exported after it is released
+		defer netPlugin.FlushTracing()
+
 		// CNI attempts to acquire lock
 		if err = netPlugin.Plugin.InitializeKeyValueStore(&config); err != nil {
 			// Error acquiring lock
@@ -100,11 +109,10 @@ func rootExecute() error {
 			telemetry.AIClient.ConnectTelemetry(logger)
 			defer telemetry.AIClient.DisconnectTelemetry()
 
-			if telemetry.AIClient.IsConnected() {
-				telemetry.AIClient.SendError(err)
-			} else {
-				logger.Error("Not connected to telemetry service, skipping sending error to application insights")
+			if !telemetry.AIClient.IsConnected() {
+				logger.Error("Not connected to telemetry service, spooling the error until it is up")
 			}
+			telemetry.AIClient.SendError(err)
 			return errors.Wrap(err, "lock acquire error")
 		}
 
@@ -134,7 +142,7 @@ func rootExecute() error {
 		}
 
 		// used to dump state
-		if cniCmd == cni.CmdGetEndpointsState {
+		if cniCmd == cni.CmdGetEndpointsState || cniCmd == cni.CmdGetEndpointsStats || cniCmd == cni.CmdRecoverEndpointState {
 			logger.Debug("Retrieving state")
 			var simpleState *api.AzureCNIState
 			simpleState, err = netPlugin.GetAllEndpointState("azure")
@@ -150,6 +158,28 @@ func rootExecute() error {
 
 			return errors.Wrap(err, "Get cni state printresult error")
 		}
+
+		if cniCmd == cni.CmdReattachHnsEndpoints {
+			logger.Info("Reattaching hcn endpoints")
+			return errors.Wrap(netPlugin.ReattachHnsEndpoints(), "Reattach hcn endpoints error")
+		}
+
+		if cniCmd == cni.CmdMigrateDatapath {
+			var req api.DatapathMigrationRequest
+			if err = json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+				return errors.Wrap(err, "Decode datapath migration request error")
+			}
+
+			logger.Info("Migrating datapath", zap.Any("request", req))
+			var progress *api.DatapathMigrationProgress
+			progress, err = netPlugin.MigrateDatapath(req)
+			if err != nil {
+				logger.Error("Failed to migrate datapath", zap.Error(err))
+				return errors.Wrap(err, "Migrate datapath error")
+			}
+
+			return errors.Wrap(progress.PrintResult(), "Migrate datapath printresult error")
+		}
 	}
 
 	handled, _ := network.HandleIfCniUpdate(netPlugin.Update)
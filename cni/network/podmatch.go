@@ -0,0 +1,79 @@
+package network
+
+import (
+	"regexp"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/pkg/errors"
+)
+
+var errPodNameRegexNoMatch = errors.New("pod name doesn't match the pod name regex")
+
+// podMatchMode returns the PodMatch of the network config, with EnableExactMatchForPodName in place of the default.
+func podMatchMode(nwCfg *cni.NetworkConfig) network.PodMatchMode {
+	mode := network.PodMatchMode(nwCfg.PodMatch)
+	if mode == network.PodMatchWithoutSuffix && nwCfg.EnableExactMatchForPodName {
+		return network.PodMatchExact
+	}
+	return mode
+}
+
+// podNameRegex compiles the PodNameRegex of the network config.
+func podNameRegex(nwCfg *cni.NetworkConfig) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(nwCfg.PodNameRegex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pod name regex %q", nwCfg.PodNameRegex)
+	}
+	return re, nil
+}
+
+// podMatcher returns the matcher of the endpoints of the pod for the PodMatch of the network config.
+func podMatcher(nwCfg *cni.NetworkConfig, podName, podNamespace, podUID string) (network.PodMatcher, error) {
+	match := network.PodMatcher{
+		Mode:      podMatchMode(nwCfg),
+		Name:      podName,
+		Namespace: podNamespace,
+		UID:       podUID,
+	}
+	if match.Mode == network.PodMatchRegex {
+		re, err := podNameRegex(nwCfg)
+		if err != nil {
+			return network.PodMatcher{}, err
+		}
+		match.NameRegex = re
+	}
+	if err := match.Validate(); err != nil {
+		return network.PodMatcher{}, errors.Wrap(err, "invalid pod match")
+	}
+	return match, nil
+}
+
+// cnsPodInfo returns the pod info the network containers of the pod are found with in cns for the PodMatch of the
+// network config. The uid match finds them by the exact pod name, as cns has no uids for them.
+func cnsPodInfo(nwCfg *cni.NetworkConfig, podName, podNamespace string) (cns.KubernetesPodInfo, error) {
+	podInfo := cns.KubernetesPodInfo{
+		PodName:      podName,
+		PodNamespace: podNamespace,
+	}
+
+	switch mode := podMatchMode(nwCfg); mode {
+	case network.PodMatchWithoutSuffix:
+		podInfo.PodName = network.GetPodNameWithoutSuffix(podName)
+	case network.PodMatchExact, network.PodMatchUID:
+	case network.PodMatchPrefix:
+		podInfo.PodNameMatch = cns.PodNameMatchPrefix
+	case network.PodMatchRegex:
+		re, err := podNameRegex(nwCfg)
+		if err != nil {
+			return cns.KubernetesPodInfo{}, err
+		}
+		if podInfo.PodName = network.PodNameFromRegex(re, podName); podInfo.PodName == "" {
+			return cns.KubernetesPodInfo{}, errors.Wrapf(errPodNameRegexNoMatch, "%s doesn't match %s", podName, re)
+		}
+	default:
+		return cns.KubernetesPodInfo{}, errors.Errorf("unknown pod match %q", mode)
+	}
+	return podInfo, nil
+}
@@ -0,0 +1,94 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCNSPodInfo(t *testing.T) {
+	const podName = "my-web-app-5c689d88bb-qwq47"
+
+	tests := []struct {
+		name    string
+		nwCfg   cni.NetworkConfig
+		want    cns.KubernetesPodInfo
+		wantErr bool
+	}{
+		{
+			name:  "without suffix by default",
+			nwCfg: cni.NetworkConfig{},
+			want:  cns.KubernetesPodInfo{PodName: "my-web-app", PodNamespace: "ns"},
+		},
+		{
+			name:  "exact match flag",
+			nwCfg: cni.NetworkConfig{EnableExactMatchForPodName: true},
+			want:  cns.KubernetesPodInfo{PodName: podName, PodNamespace: "ns"},
+		},
+		{
+			name:  "prefix is matched by cns",
+			nwCfg: cni.NetworkConfig{PodMatch: "prefix"},
+			want:  cns.KubernetesPodInfo{PodName: podName, PodNamespace: "ns", PodNameMatch: cns.PodNameMatchPrefix},
+		},
+		{
+			name:  "regex capture group",
+			nwCfg: cni.NetworkConfig{PodMatch: "regex", PodNameRegex: `^(.+)-[a-z0-9]+-[a-z0-9]+$`},
+			want:  cns.KubernetesPodInfo{PodName: "my-web-app", PodNamespace: "ns"},
+		},
+		{
+			name:  "regex without capture group",
+			nwCfg: cni.NetworkConfig{PodMatch: "regex", PodNameRegex: `^my-web`},
+			want:  cns.KubernetesPodInfo{PodName: "my-web", PodNamespace: "ns"},
+		},
+		{
+			name:    "regex without match",
+			nwCfg:   cni.NetworkConfig{PodMatch: "regex", PodNameRegex: `^db-`},
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			nwCfg:   cni.NetworkConfig{PodMatch: "regex", PodNameRegex: `(`},
+			wantErr: true,
+		},
+		{
+			name:  "uid finds the network containers by the exact pod name",
+			nwCfg: cni.NetworkConfig{PodMatch: "uid"},
+			want:  cns.KubernetesPodInfo{PodName: podName, PodNamespace: "ns"},
+		},
+		{
+			name:    "unknown match",
+			nwCfg:   cni.NetworkConfig{PodMatch: "label"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cnsPodInfo(&tt.nwCfg, podName, "ns")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPodMatcher(t *testing.T) {
+	match, err := podMatcher(&cni.NetworkConfig{EnableExactMatchForPodName: true}, "pod", "ns", "")
+	require.NoError(t, err)
+	assert.Equal(t, network.PodMatchExact, match.Mode)
+
+	match, err = podMatcher(&cni.NetworkConfig{PodMatch: "regex", PodNameRegex: `^(.+)-\d+$`}, "pod-1", "ns", "")
+	require.NoError(t, err)
+	assert.Equal(t, "pod", network.PodNameFromRegex(match.NameRegex, match.Name))
+
+	_, err = podMatcher(&cni.NetworkConfig{PodMatch: "uid"}, "pod", "ns", "")
+	require.Error(t, err, "the uid match needs the K8S_POD_UID arg")
+}
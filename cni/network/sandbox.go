@@ -0,0 +1,90 @@
+package network
+
+import (
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	errSandboxRunning       = errors.New("sandbox is still running")
+	errInvalidSandboxDevice = errors.New("invalid sandbox device")
+)
+
+// sandboxState is the state of the sandbox of a pod, as seen from its network namespace.
+type sandboxState int
+
+const (
+	// sandboxGone is a sandbox whose netns is deleted or unmounted.
+	sandboxGone sandboxState = iota
+	// sandboxExited is a sandbox whose netns is still mounted without any process in it, the runtime removes the
+	// netns after the DEL.
+	sandboxExited
+	// sandboxRunning is a sandbox whose processes still run in its netns, the DEL arrived before the runtime stopped it.
+	sandboxRunning
+)
+
+func (s sandboxState) String() string {
+	switch s {
+	case sandboxGone:
+		return "gone"
+	case sandboxExited:
+		return "exited"
+	case sandboxRunning:
+		return "running"
+	default:
+		return "unknown"
+	}
+}
+
+// sandboxInspector returns the state of the sandbox of a netns.
+type sandboxInspector interface {
+	State(netnsPath string) (sandboxState, error)
+}
+
+// checkSandboxExit returns errSandboxRunning when processes still run in the netns of a sandbox. The DEL runs under
+// the store lock, so it does not wait for them and the runtime retries it instead. A sandbox which can't be inspected is
+// not held.
+func (plugin *NetPlugin) checkSandboxExit(netnsPath string) (sandboxState, error) {
+	if plugin.sandboxInspector == nil {
+		plugin.sandboxInspector = newSandboxInspector()
+	}
+
+	state, err := plugin.sandboxInspector.State(netnsPath)
+	if err != nil {
+		logger.Warn("Failed to inspect sandbox, not holding the DEL for it", zap.String("netNS", netnsPath), zap.Error(err))
+		return state, nil
+	}
+	if state == sandboxRunning {
+		return state, errors.Wrapf(errSandboxRunning, "processes still run in netns %s", netnsPath)
+	}
+	return state, nil
+}
+
+// setSandboxedRuntime hands the infra nic of a pod to the vm of its sandbox when the runtime class in the cni args is
+// a sandboxed runtime. The vm owns the netns, so the neighbors the pod needs are made permanent for the runtime to copy
+// them into the vm, and the device the runtime expects is added on the container veth.
+func setSandboxedRuntime(nwCfg *cni.NetworkConfig, cniArgs string, epInfo *network.EndpointInfo) error {
+	podCfg, err := cni.ParseCniArgs(cniArgs)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse cni args")
+	}
+
+	sandboxed := nwCfg.SandboxedRuntime(podCfg)
+	if sandboxed == nil {
+		return nil
+	}
+
+	switch sandboxed.Device {
+	case "", network.SandboxDeviceTap, network.SandboxDeviceIPVTap:
+	default:
+		return errors.Wrapf(errInvalidSandboxDevice, "runtime class %s hands %q to its vms", podCfg.K8S_POD_RUNTIME_CLASS, sandboxed.Device)
+	}
+
+	logger.Info("Pod runs in the vm of a sandboxed runtime", zap.String("runtimeClass", string(podCfg.K8S_POD_RUNTIME_CLASS)),
+		zap.String("device", sandboxed.Device))
+	epInfo.VMSandbox = true
+	epInfo.SandboxDevice = sandboxed.Device
+	return nil
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// procSandboxInspector finds the processes of a sandbox by the network namespace of the processes in /proc.
+type procSandboxInspector struct {
+	procPath string
+}
+
+func newSandboxInspector() sandboxInspector {
+	return procSandboxInspector{procPath: "/proc"}
+}
+
+func (i procSandboxInspector) State(netnsPath string) (sandboxState, error) {
+	if netnsPath == "" {
+		return sandboxGone, nil
+	}
+
+	// the runtime bind mounts the netns on the path, which is left as a regular file once it is unmounted
+	var fs unix.Statfs_t
+	if err := unix.Statfs(netnsPath, &fs); err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return sandboxGone, nil
+		}
+		return sandboxExited, errors.Wrapf(err, "failed to statfs netns %s", netnsPath)
+	}
+	if fs.Type != unix.NSFS_MAGIC {
+		return sandboxGone, nil
+	}
+
+	var netns unix.Stat_t
+	if err := unix.Stat(netnsPath, &netns); err != nil {
+		return sandboxExited, errors.Wrapf(err, "failed to stat netns %s", netnsPath)
+	}
+
+	entries, err := os.ReadDir(i.procPath)
+	if err != nil {
+		return sandboxExited, errors.Wrapf(err, "failed to list %s", i.procPath)
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		var ns unix.Stat_t
+		// the process may have exited meanwhile
+		if err := unix.Stat(filepath.Join(i.procPath, entry.Name(), "ns", "net"), &ns); err != nil {
+			continue
+		}
+		if ns.Dev == netns.Dev && ns.Ino == netns.Ino {
+			return sandboxRunning, nil
+		}
+	}
+	return sandboxExited, nil
+}
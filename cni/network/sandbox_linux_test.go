@@ -0,0 +1,69 @@
+package network
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcSandboxInspectorState(t *testing.T) {
+	inspector := newSandboxInspector()
+
+	state, err := inspector.State("")
+	require.NoError(t, err)
+	assert.Equal(t, sandboxGone, state)
+
+	state, err = inspector.State(filepath.Join(t.TempDir(), "netns"))
+	require.NoError(t, err)
+	assert.Equal(t, sandboxGone, state)
+
+	// a netns path which is not a netns mount
+	state, err = inspector.State(t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, sandboxGone, state)
+
+	// the test runs in its own netns
+	state, err = inspector.State("/proc/self/ns/net")
+	require.NoError(t, err)
+	assert.Equal(t, sandboxRunning, state)
+}
+
+func TestSetSandboxedRuntime(t *testing.T) {
+	nwCfg := &cni.NetworkConfig{
+		SandboxedRuntimes: map[string]cni.SandboxedRuntime{
+			"kata":    {},
+			"kata-fc": {Device: network.SandboxDeviceTap},
+			"broken":  {Device: "macvtap"},
+		},
+	}
+	tests := []struct {
+		name       string
+		args       string
+		wantVM     bool
+		wantDevice string
+		wantErr    error
+	}{
+		{name: "no runtime class", args: "K8S_POD_NAMESPACE=ns;K8S_POD_NAME=pod"},
+		{name: "regular runtime class", args: "K8S_POD_NAMESPACE=ns;K8S_POD_NAME=pod;K8S_POD_RUNTIME_CLASS=runc"},
+		{name: "runtime bridging the veth", args: "K8S_POD_RUNTIME_CLASS=kata", wantVM: true},
+		{name: "runtime expecting a tap", args: "K8S_POD_RUNTIME_CLASS=kata-fc", wantVM: true, wantDevice: network.SandboxDeviceTap},
+		{name: "unknown device", args: "K8S_POD_RUNTIME_CLASS=broken", wantErr: errInvalidSandboxDevice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			epInfo := &network.EndpointInfo{}
+			err := setSandboxedRuntime(nwCfg, tt.args, epInfo)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVM, epInfo.VMSandbox)
+			assert.Equal(t, tt.wantDevice, epInfo.SandboxDevice)
+		})
+	}
+}
@@ -82,6 +82,7 @@ func rootExecute() error {
 		network.PrintCNIError(fmt.Sprintf("Failed to create network plugin, err:%v.\n", err))
 		return errors.Wrap(err, "Create plugin error")
 	}
+	defer netPlugin.FlushTracing()
 
 	// Check CNI_COMMAND value
 	cniCmd := os.Getenv(cni.Cmd)
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cni/log"
+	"github.com/Azure/azure-container-networking/cns"
+	cnscli "github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/network"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ipPoolClient is the part of the cns client STATUS reads the ip pool of the node with.
+type ipPoolClient interface {
+	GetIPAddressesMatchingStates(ctx context.Context, stateFilter ...types.IPState) ([]cns.IPConfigurationStatus, error)
+}
+
+// Status handles CNI STATUS commands. The plugin is reported as not available when CNS can't be reached, the ip pool
+// of the node is empty or the datapath of the node can't program endpoints, so that the runtime marks the node
+// NotReady for networking rather than failing the ADD of every pod scheduled on it. A pool with every ip assigned is
+// not reported, the pods of a full node would be evicted otherwise.
+func (plugin *NetPlugin) Status(args *cniSkel.CmdArgs) (err error) {
+	logger.Info("Processing STATUS command", zap.String("path", args.Path))
+
+	defer func() {
+		logger.Info("STATUS command completed", zap.Error(log.NewErrorWithoutStackTrace(err)))
+	}()
+
+	nwCfg, err := cni.ParseNetworkConfig(args.StdinData)
+	if err != nil {
+		return plugin.Errorf("Failed to parse network configuration: %v.", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+
+	if nwCfg.IPAM.Type == network.AzureCNS {
+		if err = plugin.checkIPPool(ctx, nwCfg); err != nil {
+			return plugin.CodedError(cni.ErrPluginNotAvailable, err)
+		}
+	}
+
+	if err = checkDatapath(); err != nil {
+		return plugin.CodedError(cni.ErrPluginNotAvailable, err)
+	}
+
+	return nil
+}
+
+// checkIPPool returns an error when CNS can't be reached or the node has no ip in its pool.
+func (plugin *NetPlugin) checkIPPool(ctx context.Context, nwCfg *cni.NetworkConfig) error {
+	var client ipPoolClient
+	if plugin.newIPPoolClient != nil {
+		client = plugin.newIPPoolClient(nwCfg.CNSUrl)
+	} else {
+		cnsClient, err := cnscli.New(nwCfg.CNSUrl, defaultRequestTimeout)
+		if err != nil {
+			return errors.Wrap(err, "failed to create cns client")
+		}
+		client = cnsClient
+	}
+
+	ips, err := client.GetIPAddressesMatchingStates(ctx, types.Available, types.Assigned, types.PendingProgramming)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the ip pool of the node from cns")
+	}
+	if len(ips) == 0 {
+		return errors.New("the ip pool of the node is empty")
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/tracing"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// tracingFlushTimeout bounds the export of the spans of a command, which delays the exit of the plugin.
+const tracingFlushTimeout = 500 * time.Millisecond
+
+// startTracing batches the spans of the command when the network config enables tracing, and starts the span of the
+// command, which the spans of its steps and of the requests to cns are children of. The returned func ends the span
+// with the error of the command, the spans are exported by FlushTracing.
+func (plugin *NetPlugin) startTracing(nwCfg *cni.NetworkConfig, command string, args *cniSkel.CmdArgs) (context.Context, func(error)) {
+	if nwCfg.Tracing != nil {
+		shutdown, err := tracing.Init(context.Background(), plugin.Name, *nwCfg.Tracing)
+		if err != nil {
+			logger.Error("Failed to initialize tracing, spans are not exported", zap.Error(err))
+		} else {
+			plugin.flushTracing = shutdown
+		}
+	}
+
+	ctx, span := tracing.Start(context.Background(), "cni."+command,
+		attribute.String("container.id", args.ContainerID),
+		attribute.String("netns", args.Netns),
+		attribute.String("ifname", args.IfName))
+	return ctx, func(err error) {
+		tracing.End(span, err)
+	}
+}
+
+// FlushTracing exports the spans of the command which are not exported yet. It is called once the store lock is
+// released, so that a slow or unreachable collector does not hold up the commands of the other pods.
+func (plugin *NetPlugin) FlushTracing() {
+	if plugin.flushTracing == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+	if err := plugin.flushTracing(ctx); err != nil {
+		logger.Error("Failed to flush the spans", zap.Error(err))
+	}
+	plugin.flushTracing = nil
+}
@@ -35,6 +35,8 @@ var errEmptyContent = errors.New("read content is zero bytes")
 type Plugin struct {
 	*common.Plugin
 	version string
+	// lockClient is the process lock held by the store, handed over to the store which replaces it
+	lockClient processlock.Interface
 }
 
 // NewPlugin creates a new CNI plugin.
@@ -77,7 +79,7 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 				Msg:     fmt.Sprintf("%v", r),
 				Details: string(buf[:len]),
 			}
-			cniErr.Print()
+			NewErrorResult(cniErr).Print()
 			err = cniErr
 
 			logger.Info("Recovered panic",
@@ -90,9 +92,13 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 	pluginInfo := cniVers.PluginSupports(supportedVersions...)
 
 	// Parse args and call the appropriate cmd handler.
-	cniErr := cniSkel.PluginMainWithError(api.Add, api.Get, api.Delete, pluginInfo, plugin.version)
+	funcs := cniSkel.CNIFuncs{Add: api.Add, Check: api.Get, Del: api.Delete}
+	if statusAPI, ok := api.(StatusApi); ok {
+		funcs.Status = statusAPI.Status
+	}
+	cniErr := cniSkel.PluginMainFuncsWithError(funcs, pluginInfo, plugin.version)
 	if cniErr != nil {
-		cniErr.Print()
+		NewErrorResult(cniErr).Print()
 		return cniErr
 	}
 
@@ -100,7 +106,7 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 }
 
 // DelegateAdd calls the given plugin's ADD command and returns the result.
-func (plugin *Plugin) DelegateAdd(pluginName string, nwCfg *NetworkConfig) (*cniTypesCurr.Result, error) {
+func (plugin *Plugin) DelegateAdd(ctx context.Context, pluginName string, nwCfg *NetworkConfig) (*cniTypesCurr.Result, error) {
 	var result *cniTypesCurr.Result
 	var err error
 
@@ -114,7 +120,7 @@ func (plugin *Plugin) DelegateAdd(pluginName string, nwCfg *NetworkConfig) (*cni
 
 	os.Setenv(Cmd, CmdAdd)
 
-	res, err := cniInvoke.DelegateAdd(context.TODO(), pluginName, nwCfg.Serialize(), nil)
+	res, err := cniInvoke.DelegateAdd(ctx, pluginName, nwCfg.Serialize(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to delegate: %v", err)
 	}
@@ -128,7 +134,7 @@ func (plugin *Plugin) DelegateAdd(pluginName string, nwCfg *NetworkConfig) (*cni
 }
 
 // DelegateDel calls the given plugin's DEL command and returns the result.
-func (plugin *Plugin) DelegateDel(pluginName string, nwCfg *NetworkConfig) error {
+func (plugin *Plugin) DelegateDel(ctx context.Context, pluginName string, nwCfg *NetworkConfig) error {
 	var err error
 
 	logger.Info("Calling DEL",
@@ -142,7 +148,7 @@ func (plugin *Plugin) DelegateDel(pluginName string, nwCfg *NetworkConfig) error
 
 	os.Setenv(Cmd, CmdDel)
 
-	err = cniInvoke.DelegateDel(context.TODO(), pluginName, nwCfg.Serialize(), nil)
+	err = cniInvoke.DelegateDel(ctx, pluginName, nwCfg.Serialize(), nil)
 	if err != nil {
 		return fmt.Errorf("Failed to delegate: %v", err)
 	}
@@ -172,6 +178,17 @@ func (plugin *Plugin) Errorf(format string, args ...interface{}) *cniTypes.Error
 	return plugin.Error(fmt.Errorf(format, args...))
 }
 
+// CodedError creates and logs a CNI error with the error code of the failure.
+func (plugin *Plugin) CodedError(code uint, err error) *cniTypes.Error {
+	cniErr := cniTypes.NewError(code, err.Error(), "")
+	logger.Error("error",
+		zap.String("plugin", plugin.Name),
+		zap.String("code", ErrorCodeName(code)),
+		zap.Bool("retryable", IsRetryable(code)),
+		zap.Error(cniErr))
+	return cniErr
+}
+
 // RetriableError logs and returns a CNI error with the TryAgainLater error code
 func (plugin *Plugin) RetriableError(err error) *cniTypes.Error {
 	tryAgainErr := cniTypes.NewError(cniTypes.ErrTryAgainLater, err.Error(), "")
@@ -191,7 +208,10 @@ func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error
 			return errors.Wrap(err, "error creating new filelock")
 		}
 
-		plugin.Store, err = store.NewJsonFileStore(platform.CNIRuntimePath+plugin.Name+".json", lockclient, storeLogger)
+		// The state is read from the store it was last saved to, the network config then selects the store it is
+		// saved to, see SwitchKeyValueStore.
+		plugin.lockClient = lockclient
+		plugin.Store, err = plugin.newKeyValueStore(plugin.boltStoreIsCurrent())
 		if err != nil {
 			logger.Error("Failed to create store", zap.Error(err))
 			return err
@@ -214,6 +234,56 @@ func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error
 	return nil
 }
 
+// SwitchKeyValueStore replaces the locked store by a bolt store if bolt is set, or by a json file store otherwise,
+// which takes over the lock. It returns the replaced store, whose files the caller removes once the state is saved to
+// the new one, or nil if the store already is of that kind.
+func (plugin *Plugin) SwitchKeyValueStore(bolt bool) (store.KeyValueStore, error) {
+	if _, isBolt := plugin.Store.(store.EntryStore); isBolt == bolt || plugin.lockClient == nil {
+		return nil, nil
+	}
+
+	kvs, err := plugin.newKeyValueStore(bolt)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Switching store", zap.Bool("bolt", bolt))
+
+	previous := plugin.Store
+	plugin.Store = kvs
+	return previous, nil
+}
+
+// newKeyValueStore creates the bolt or the json file store of the plugin, without locking it.
+func (plugin *Plugin) newKeyValueStore(bolt bool) (store.KeyValueStore, error) {
+	if bolt {
+		return store.NewBoltStore(plugin.boltFileName(), plugin.lockClient, storeLogger) //nolint:wrapcheck // logged by the caller
+	}
+	return store.NewJsonFileStore(plugin.jsonFileName(), plugin.lockClient, storeLogger) //nolint:wrapcheck // logged by the caller
+}
+
+// boltStoreIsCurrent returns whether the state was last saved to the bolt store. A switch removes the files of the
+// previous store once the state is saved to the new one, so both only exist after a crash in between.
+func (plugin *Plugin) boltStoreIsCurrent() bool {
+	boltInfo, err := os.Stat(plugin.boltFileName())
+	if err != nil {
+		return false
+	}
+	jsonStore, err := store.NewJsonFileStore(plugin.jsonFileName(), nil, storeLogger)
+	if err != nil || !jsonStore.Exists() {
+		return true
+	}
+	modTime, err := jsonStore.GetModificationTime()
+	return err != nil || !modTime.After(boltInfo.ModTime())
+}
+
+func (plugin *Plugin) jsonFileName() string {
+	return platform.CNIRuntimePath + plugin.Name + ".json"
+}
+
+func (plugin *Plugin) boltFileName() string {
+	return platform.CNIRuntimePath + plugin.Name + ".db"
+}
+
 // Uninitialize key-value store
 func (plugin *Plugin) UninitializeKeyValueStore() error {
 	if plugin.Store != nil {
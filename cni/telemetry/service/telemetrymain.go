@@ -171,6 +171,11 @@ func main() {
 		logger.Error("AI Handle creation error:", zap.Error(err))
 	}
 	logger.Info("Report to host interval", zap.Duration("seconds", config.ReportToHostIntervalInSeconds))
-	tb.PushData(context.Background())
+
+	// upload the reports the plugin spooled while the service was down
+	ctx, cancel := context.WithCancel(context.Background())
+	go tb.UploadSpool(ctx, telemetry.NewSpool(telemetry.SpoolPath, telemetry.MaxSpoolSize))
+	tb.PushData(ctx)
+	cancel()
 	telemetry.CloseAITelemetryHandle()
 }
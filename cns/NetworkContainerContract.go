@@ -6,6 +6,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
@@ -38,6 +39,7 @@ const (
 	PathDebugIPAddresses                     = "/debug/ipaddresses"
 	PathDebugPodContext                      = "/debug/podcontext"
 	PathDebugRestData                        = "/debug/restdata"
+	PathDebugIPAMState                       = "/debug/ipamstate"
 	NumberOfCPUCores                         = NumberOfCPUCoresPath
 	NMAgentSupportedAPIs                     = NmAgentSupportedApisPath
 	EndpointAPI                              = EndpointPath
@@ -95,6 +97,11 @@ const (
 	NodeNetworkInterfaceBackendNIC NICType = "BackendNIC"
 )
 
+// IsFrontendNIC returns if the nic is a frontend nic delegated to the pod, with or without accelerated networking.
+func (n NICType) IsFrontendNIC() bool {
+	return n == NodeNetworkInterfaceFrontendNIC || n == NodeNetworkInterfaceAccelnetFrontendNIC
+}
+
 // ChannelMode :- CNS channel modes
 const (
 	Direct         = "Direct"
@@ -105,8 +112,9 @@ const (
 )
 
 var (
-	ErrInvalidNCID = errors.New("invalid NetworkContainerID")
-	ErrInvalidIP   = errors.New("invalid IP")
+	ErrInvalidNCID           = errors.New("invalid NetworkContainerID")
+	ErrInvalidIP             = errors.New("invalid IP")
+	ErrInvalidHostNCPortRule = errors.New("invalid host NC port rule")
 )
 
 // CreateNetworkContainerRequest specifies request to create a network container or network isolation boundary.
@@ -126,9 +134,13 @@ type CreateNetworkContainerRequest struct {
 	Routes                     []Route
 	AllowHostToNCCommunication bool
 	AllowNCToHostCommunication bool
+	HostToNCPortRules          []HostNCPortRule `json:",omitempty"` // the ports the host reaches the NC on, all of them when empty
+	NCToHostPortRules          []HostNCPortRule `json:",omitempty"` // the ports the NC reaches the host on, all of them when empty
 	EndpointPolicies           []NetworkContainerRequestPolicies
 	NCStatus                   v1alpha.NCStatus
 	NetworkInterfaceInfo       NetworkInterfaceInfo //nolint // introducing new field for backendnic, to be used later by cni code
+	SNATExceptionCIDRs         []string             `json:",omitempty"` // destination cidrs the NC's pods are not snatted to
+	AvailabilityZone           string               `json:",omitempty"` // availability zone of the NC's subnet
 }
 
 func (req *CreateNetworkContainerRequest) Validate() error {
@@ -144,9 +156,82 @@ func (req *CreateNetworkContainerRequest) Validate() error {
 	if req.IPConfiguration.GatewayIPAddress != "" && !isValidIP(req.IPConfiguration.GatewayIPAddress) {
 		return errors.Wrapf(ErrInvalidIP, "GatewayIPAddress %s is not a valid ip address", req.IPConfiguration.GatewayIPAddress)
 	}
+	for _, rule := range req.HostToNCPortRules {
+		if err := rule.Validate(); err != nil {
+			return errors.Wrap(err, "invalid HostToNCPortRules")
+		}
+	}
+	for _, rule := range req.NCToHostPortRules {
+		if err := rule.Validate(); err != nil {
+			return errors.Wrap(err, "invalid NCToHostPortRules")
+		}
+	}
 	return nil
 }
 
+// Protocols of the host NC port rules.
+const (
+	HostNCProtocolTCP = "tcp"
+	HostNCProtocolUDP = "udp"
+)
+
+// maxHostNCPorts is the most ports a host NC port rule has, a range counting as two, as iptables multiport matches
+// at most 15 ports.
+const maxHostNCPorts = 15
+
+// HostNCPortRule allows the host NC communication to some ports of some protocols, the destination ports of the
+// connections: those of the NC for host to NC, those of the host for NC to host.
+type HostNCPortRule struct {
+	// Protocols are tcp and udp.
+	Protocols []string `json:"protocols"`
+	// Ports are single ports like 443 and port ranges like 8000-8080, all the ports of the protocols when empty.
+	Ports []string `json:"ports,omitempty"`
+}
+
+// Validate returns an error when the rule has no protocol, a protocol other than tcp and udp, or an invalid port.
+func (r HostNCPortRule) Validate() error {
+	if len(r.Protocols) == 0 {
+		return errors.Wrap(ErrInvalidHostNCPortRule, "no protocol")
+	}
+	for _, protocol := range r.Protocols {
+		if protocol != HostNCProtocolTCP && protocol != HostNCProtocolUDP {
+			return errors.Wrapf(ErrInvalidHostNCPortRule, "protocol %q is not tcp or udp", protocol)
+		}
+	}
+
+	count := 0
+	for _, port := range r.Ports {
+		low, high, isRange := strings.Cut(port, "-")
+		first, err := parsePort(low)
+		if err != nil {
+			return errors.Wrapf(ErrInvalidHostNCPortRule, "port %q: %v", port, err)
+		}
+		count++
+		if isRange {
+			last, err := parsePort(high)
+			if err != nil {
+				return errors.Wrapf(ErrInvalidHostNCPortRule, "port %q: %v", port, err)
+			}
+			if last < first {
+				return errors.Wrapf(ErrInvalidHostNCPortRule, "port range %q is reversed", port)
+			}
+			count++
+		}
+	}
+	if count > maxHostNCPorts {
+		return errors.Wrapf(ErrInvalidHostNCPortRule, "%d ports, a rule has at most %d", count, maxHostNCPorts)
+	}
+	return nil
+}
+
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, errors.Errorf("%q is not a port", s)
+	}
+	return uint16(port), nil
+}
+
 func isValidIP(ipStr string) bool {
 	// if can parse (i.e. not nil), then valid ip
 	if ip, _, err := net.ParseCIDR(ipStr); err == nil {
@@ -234,11 +319,27 @@ type PodInfo interface {
 	String() string
 	// SecondaryInterfacesExist returns true if there exist a secondary interface for this pod
 	SecondaryInterfacesExist() bool
+	// NameMatch is how the name finds the network containers of the pod
+	NameMatch() PodNameMatch
 }
 
+// PodNameMatch is how the pod name of a KubernetesPodInfo is matched to the pod names the network containers are
+// registered with.
+type PodNameMatch string
+
+const (
+	// PodNameMatchExact finds the network containers registered with the pod name, the default
+	PodNameMatchExact PodNameMatch = "exact"
+	// PodNameMatchPrefix finds the network containers registered with the longest name the pod name is or starts with,
+	// followed by a dash, such as the name of the deployment of the pod
+	PodNameMatchPrefix PodNameMatch = "prefix"
+)
+
 type KubernetesPodInfo struct {
 	PodName      string
 	PodNamespace string
+	// PodNameMatch is how PodName finds the network containers of the pod, exact if empty
+	PodNameMatch PodNameMatch `json:",omitempty"`
 }
 
 var _ PodInfo = (*podInfo)(nil)
@@ -298,6 +399,13 @@ func (p *podInfo) Namespace() string {
 	return p.PodNamespace
 }
 
+func (p *podInfo) NameMatch() PodNameMatch {
+	if p.PodNameMatch == "" {
+		return PodNameMatchExact
+	}
+	return p.PodNameMatch
+}
+
 func (p *podInfo) OrchestratorContext() (json.RawMessage, error) {
 	jsonContext, err := json.Marshal(p.KubernetesPodInfo)
 	if err != nil {
@@ -427,6 +535,11 @@ type Route struct {
 	IPAddress        string
 	GatewayIPAddress string
 	InterfaceToUse   string
+	// MTU and AdvMSS clamp the packets and the tcp mss of the route, OnLink routes through a gateway outside of the
+	// subnets of the interface, on linux.
+	MTU    int  `json:",omitempty"`
+	AdvMSS int  `json:",omitempty"`
+	OnLink bool `json:",omitempty"`
 }
 
 // SetOrchestratorTypeRequest specifies the orchestrator type for the node.
@@ -439,6 +552,8 @@ type SetOrchestratorTypeRequest struct {
 // CreateNetworkContainerResponse specifies response of creating a network container.
 type CreateNetworkContainerResponse struct {
 	Response Response
+	// OperationID is the operation of an async request, see AsyncQuery.
+	OperationID string `json:",omitempty"`
 }
 
 // GetNetworkContainerStatusRequest specifies the details about the request to retrieve status of a specific network container.
@@ -483,6 +598,9 @@ type PostNetworkContainersResponse struct {
 type GetNetworkContainerRequest struct {
 	NetworkContainerid  string
 	OrchestratorContext json.RawMessage
+	// SnatBridgeSubnet moves the LocalIPConfiguration of the NCs to the subnet when set, failing when it conflicts
+	// with the vnet or host subnets or the host routes.
+	SnatBridgeSubnet string `json:",omitempty"`
 }
 
 // GetNetworkContainerResponse describes the response to retrieve a specific network container.
@@ -497,6 +615,8 @@ type GetNetworkContainerResponse struct {
 	Response                   Response
 	AllowHostToNCCommunication bool
 	AllowNCToHostCommunication bool
+	HostToNCPortRules          []HostNCPortRule `json:",omitempty"`
+	NCToHostPortRules          []HostNCPortRule `json:",omitempty"`
 	NetworkInterfaceInfo       NetworkInterfaceInfo
 }
 
@@ -516,6 +636,12 @@ type PodIpInfo struct {
 	PnPID string
 	// Default Deny ACL's to configure on HNS endpoints for Swiftv2 window nodes
 	EndpointPolicies []policy.Policy
+	// SecondaryIPConfigs are additional IPs to program on the same interface as PodIPConfig. Only honored for InfraNIC.
+	SecondaryIPConfigs []IPSubnet `json:",omitempty"`
+	// SNATExceptionCIDRs are destination cidrs the pod's traffic is not snatted to, from the NC of PodIPConfig
+	SNATExceptionCIDRs []string `json:",omitempty"`
+	// AvailabilityZone is the availability zone of the NC of PodIPConfig, empty when it is unknown
+	AvailabilityZone string `json:",omitempty"`
 }
 
 type HostIPInfo struct {
@@ -542,8 +668,19 @@ type IPConfigsRequest struct {
 	SecondaryInterfacesExist     bool            `json:"secondaryInterfacesExist"` // will be set by SWIFT v2 validator func
 	BackendInterfaceExist        bool            `json:"BackendInterfaceExist"`    // will be set by SWIFT v2 validator func
 	BackendInterfaceMacAddresses []string        `json:"BacknendInterfaceMacAddress"`
+	IPFamilies                   []IPFamily      `json:"ipFamilies,omitempty"` // families of the IPs to assign, all of the node's when empty
+	// SecondaryIPCount is the number of IPs to assign on top of each pod IP from its NC, returned as its SecondaryIPConfigs
+	SecondaryIPCount int `json:"secondaryIPCount,omitempty"`
 }
 
+// IPFamily is a family of the IPs a pod requests.
+type IPFamily string
+
+const (
+	IPv4Family IPFamily = "IPv4"
+	IPv6Family IPFamily = "IPv6"
+)
+
 // IPConfigResponse is used in CNS IPAM mode as a response to CNI ADD
 type IPConfigResponse struct {
 	PodIpInfo PodIpInfo
@@ -552,8 +689,20 @@ type IPConfigResponse struct {
 
 // IPConfigsResponse is used in CNS IPAM mode to return a slice of IP configs as a response to CNI ADD
 type IPConfigsResponse struct {
-	PodIPInfo []PodIpInfo `json:"podIPInfo"`
-	Response  Response    `json:"response"`
+	PodIPInfo       []PodIpInfo        `json:"podIPInfo"`
+	Response        Response           `json:"response"`
+	AllocationStats *IPAllocationStats `json:"allocationStats,omitempty"`
+}
+
+// IPAllocationStats describes how long a pod waited for its IPs, counting the requests which failed before them.
+type IPAllocationStats struct {
+	// WaitForIP is the time since the first request for the pod's IPs.
+	WaitForIP time.Duration `json:"waitForIP"`
+	// Requests is the number of requests for the pod's IPs, including the one which was answered.
+	Requests int `json:"requests"`
+	// WaitForPoolScaling is the time since a request for the pod's IPs first found the pool exhausted, zero if the
+	// pool never was.
+	WaitForPoolScaling time.Duration `json:"waitForPoolScaling,omitempty"`
 }
 
 // GetIPAddressesRequest is used in CNS IPAM mode to get the states of IPConfigs
@@ -594,6 +743,8 @@ type DeleteNetworkContainerRequest struct {
 // DeleteNetworkContainerResponse describes the response to delete a specific network container.
 type DeleteNetworkContainerResponse struct {
 	Response Response
+	// OperationID is the operation of an async request, see AsyncQuery.
+	OperationID string `json:",omitempty"`
 }
 
 // GetInterfaceForContainerRequest specifies the container ID for which interface needs to be identified.
@@ -0,0 +1,47 @@
+package cns
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzIPConfigsRequest decodes the IPConfigsRequest of the CNI and the pod info in its orchestrator context, which
+// CNS does for every ADD and DEL. The crashers go test records under testdata/fuzz are run as regression cases by the
+// unit tests.
+func FuzzIPConfigsRequest(f *testing.F) {
+	f.Add([]byte(`{"desiredIPAddresses":["10.0.0.4"],"podInterfaceID":"abc-eth0","infraContainerID":"abc",` +
+		`"orchestratorContext":{"PodName":"pod","PodNamespace":"default"},"ipFamilies":["IPv4"]}`))
+	f.Add([]byte(`{"podInterfaceID":"abc-eth0","orchestratorContext":"pod"}`))
+	f.Add([]byte(`{"orchestratorContext":null}`))
+	f.Fuzz(func(_ *testing.T, b []byte) {
+		var req IPConfigsRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			return
+		}
+		podInfo, err := NewPodInfoFromIPConfigsRequest(req)
+		if err != nil {
+			return
+		}
+		_ = podInfo.Key()
+		_ = podInfo.Name()
+		_ = podInfo.Namespace()
+		_, _ = podInfo.OrchestratorContext()
+	})
+}
+
+// FuzzCreateNetworkContainerRequest decodes and validates the CreateNetworkContainerRequest DNC-RC and the NNC
+// reconciler post to CNS.
+func FuzzCreateNetworkContainerRequest(f *testing.F) {
+	f.Add([]byte(`{"NetworkContainerid":"Swift_06867cf3-332d-409d-8819-ed70d2c116b0","PrimaryInterfaceIdentifier":"10.0.0.0/24",` +
+		`"IPConfiguration":{"IPSubnet":{"IPAddress":"10.0.0.5","PrefixLength":24},"GatewayIPAddress":"10.0.0.1"},` +
+		`"SecondaryIPConfigs":{"a":{"IPAddress":"10.0.0.6","NCVersion":1}}}`))
+	f.Add([]byte(`{"NetworkContainerid":"Swift_","IPConfiguration":{"GatewayIPAddress":"::1/x"}}`))
+	f.Fuzz(func(_ *testing.T, b []byte) {
+		var req CreateNetworkContainerRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			return
+		}
+		_ = req.Validate()
+		_ = req.String()
+	})
+}
@@ -135,6 +135,60 @@ func TestCreateNetworkContainerRequestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid port rules",
+			req: CreateNetworkContainerRequest{
+				NetworkContainerid: "f47ac10b-58cc-0372-8567-0e02b2c3d479",
+				HostToNCPortRules: []HostNCPortRule{
+					{Protocols: []string{HostNCProtocolTCP, HostNCProtocolUDP}, Ports: []string{"53", "8000-8080"}},
+				},
+				NCToHostPortRules: []HostNCPortRule{{Protocols: []string{HostNCProtocolTCP}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "port rule without protocol",
+			req: CreateNetworkContainerRequest{
+				NetworkContainerid: "f47ac10b-58cc-0372-8567-0e02b2c3d479",
+				HostToNCPortRules:  []HostNCPortRule{{Ports: []string{"80"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "port rule with unsupported protocol",
+			req: CreateNetworkContainerRequest{
+				NetworkContainerid: "f47ac10b-58cc-0372-8567-0e02b2c3d479",
+				NCToHostPortRules:  []HostNCPortRule{{Protocols: []string{"icmp"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "port rule with reversed range",
+			req: CreateNetworkContainerRequest{
+				NetworkContainerid: "f47ac10b-58cc-0372-8567-0e02b2c3d479",
+				HostToNCPortRules:  []HostNCPortRule{{Protocols: []string{HostNCProtocolTCP}, Ports: []string{"8080-8000"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "port rule with invalid port",
+			req: CreateNetworkContainerRequest{
+				NetworkContainerid: "f47ac10b-58cc-0372-8567-0e02b2c3d479",
+				HostToNCPortRules:  []HostNCPortRule{{Protocols: []string{HostNCProtocolTCP}, Ports: []string{"65536"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "port rule with too many ports",
+			req: CreateNetworkContainerRequest{
+				NetworkContainerid: "f47ac10b-58cc-0372-8567-0e02b2c3d479",
+				HostToNCPortRules: []HostNCPortRule{{
+					Protocols: []string{HostNCProtocolTCP},
+					Ports:     []string{"1-2", "3-4", "5-6", "7-8", "9-10", "11-12", "13-14", "15", "16"},
+				}},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -32,6 +32,24 @@ const (
 	V1Prefix                      = "/v0.1"
 	V2Prefix                      = "/v0.2"
 	EndpointPath                  = "/network/endpoints/"
+	PodEndpointsPath              = "/network/endpoints" // lists the endpoints of a pod given as ?pod=<namespace>/<name>
+	NetworkMetricsPath            = "/network/metrics"
+	NetworkUtilizationPath        = "/network/utilization" // the endpoints and subnet ips of the networks of the cni, as pushed with its metrics
+	VerifyAllEndpointsPath        = "/verify/all"
+	ReconcilePath                 = "/reconcile" // reports the drift of the endpoint state from the node, and fixes the classes posted
+	EndpointHealthPath            = "/network/endpointhealth"
+	NICTypesPath                  = "/network/nictypes"
+	EndpointPrefixPath            = "/network/endpointprefix"
+	EndpointEventsPath            = "/network/endpointevents" // long-polls the endpoint events after ?since=<sequence>
+	PodTrafficPath                = "/network/podtraffic"     // gets the traffic counters of the endpoints of a pod given as ?pod=<namespace>/<name>
+	PodFlowsPath                  = "/network/podflows"       // samples the flows of the endpoints of a pod given as ?pod=<namespace>/<name>[&limit=<n>]
+	IPAMPoolScalerPath            = "/ipam/pool/scaler"
+	IPAMScaleDownPreviewPath      = "/ipam/pool/scaledown/preview"
+	IPReservationsPath            = "/ipam/reservations"
+	NamespaceIPBlocksPath         = "/ipam/namespaceipblocks"
+	OperationsPath                = "/operations/" // gets the progress of an operation as /operations/<id>
+	DatapathMigrationPath         = "/network/datapathmigration"
+	NCProgrammingPath             = "/network/ncprogramming" // the programming status of the ncs, or of the one given as ?ncid=<id>
 	// Service Fabric SWIFTV2 mode
 	StandaloneSWIFTV2 SWIFTV2Mode = "StandaloneSWIFTV2"
 	// K8s SWIFTV2 mode
@@ -293,6 +311,30 @@ type IPAMPoolMonitor interface {
 	Start(ctx context.Context) error
 	Update(nnc *v1alpha.NodeNetworkConfig) error
 	GetStateSnapshot() IpamPoolMonitorStateSnapshot
+	// SetScalerOverride overrides the scaler of the NodeNetworkConfig until it is called again, and reconciles the
+	// pool with the new scaler right away.
+	SetScalerOverride(ctx context.Context, override IPAMPoolScalerOverride) error
+}
+
+// IPAMPoolScalerOverride overrides the scaler the pool monitor gets from the NodeNetworkConfig at runtime, to
+// pre-warm the pool of nodes running bursty workloads. The zero fields keep the value of the NodeNetworkConfig.
+type IPAMPoolScalerOverride struct {
+	BatchSize               int64 `json:"batchSize,omitempty"`
+	RequestThresholdPercent int64 `json:"requestThresholdPercent,omitempty"`
+	ReleaseThresholdPercent int64 `json:"releaseThresholdPercent,omitempty"`
+}
+
+// Apply sets the fields of the override on the scaler.
+func (o IPAMPoolScalerOverride) Apply(scaler *v1alpha.Scaler) {
+	if o.BatchSize > 0 {
+		scaler.BatchSize = o.BatchSize
+	}
+	if o.RequestThresholdPercent > 0 {
+		scaler.RequestThresholdPercent = o.RequestThresholdPercent
+	}
+	if o.ReleaseThresholdPercent > 0 {
+		scaler.ReleaseThresholdPercent = o.ReleaseThresholdPercent
+	}
 }
 
 type IpamPoolMonitorStateSnapshot struct {
@@ -382,3 +424,266 @@ type GetVMUniqueIDResponse struct {
 	Response   Response `json:"response"`
 	VMUniqueID string   `json:"vmuniqueid"`
 }
+
+// SetNICTypeStateRequest disables or re-enables the ADDs of pods which need a NIC of the given type on the node.
+type SetNICTypeStateRequest struct {
+	NICType  NICType `json:"nicType"`
+	Disabled bool    `json:"disabled"`
+	// Reason is returned in the error of the refused ADDs and published in the node event.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ResizeEndpointPrefixRequest delegates an IPv4 prefix to the infra interface of an endpoint, in addition to its own
+// IP, so the pod can hand out the addresses to nested containers. A prefix length of 32 returns the endpoint to its
+// single IP.
+type ResizeEndpointPrefixRequest struct {
+	EndpointID   string `json:"endpointID"`
+	PrefixLength int    `json:"prefixLength"`
+}
+
+// ResizeEndpointPrefixResponse returns the prefix delegated to the endpoint, empty once it is back to a single IP.
+type ResizeEndpointPrefixResponse struct {
+	Response Response `json:"response"`
+	Prefix   string   `json:"prefix,omitempty"`
+}
+
+// IPAMPoolScalerResponse returns the scaler override of the pool monitor, empty when the NodeNetworkConfig's scaler
+// is used.
+type IPAMPoolScalerResponse struct {
+	Response Response               `json:"response"`
+	Override IPAMPoolScalerOverride `json:"override"`
+}
+
+// IPAMScaleDownPreviewRequest proposes to shrink the pool of the node to RequestedIPCount IPs.
+type IPAMScaleDownPreviewRequest struct {
+	RequestedIPCount int64 `json:"requestedIPCount"`
+}
+
+// IPAMScaleDownBlocker is an assigned IP keeping the pool from scaling down, with the pod holding it.
+type IPAMScaleDownBlocker struct {
+	IPAddress    string `json:"ipAddress"`
+	PodName      string `json:"podName"`
+	PodNamespace string `json:"podNamespace"`
+}
+
+// IPAMScaleDownPreviewResponse previews a scale down of the pool without changing it: the free IPs which would be
+// released, in the order they would be, and when the assigned IPs keep the pool from shrinking to the requested
+// count, the pods holding them.
+type IPAMScaleDownPreviewResponse struct {
+	Response Response `json:"response"`
+	// CurrentIPCount is the count of IPs of the pool which are not already pending release.
+	CurrentIPCount int64    `json:"currentIPCount"`
+	ReleasedIPs    []string `json:"releasedIPs"`
+	// Blocked is set when there are not enough free IPs to release to reach the requested count.
+	Blocked bool `json:"blocked"`
+	// MinRequestedIPCount is the smallest count the pool can shrink to without freeing assigned IPs.
+	MinRequestedIPCount int64                  `json:"minRequestedIPCount"`
+	Blockers            []IPAMScaleDownBlocker `json:"blockers,omitempty"`
+}
+
+// IPReservationRequest reserves IPs of the node's pool for a consumer outside of the pod IPAM, such as a host network
+// VIP, or releases them. The IPs of a request are all reserved, or none of them is.
+type IPReservationRequest struct {
+	IPAddresses []string `json:"ipAddresses"`
+	// Owner names the consumer of the IPs, an IP reserved for another owner can't be reserved or released.
+	Owner   string `json:"owner"`
+	Release bool   `json:"release,omitempty"`
+}
+
+// IPReservationsResponse lists the reserved IPs of the node with their owner.
+type IPReservationsResponse struct {
+	Response     Response          `json:"response"`
+	Reservations map[string]string `json:"reservations"`
+}
+
+// NamespaceIPBlockUsage reports the occupancy of the IPs of the node pool in a CIDR block mapped to a namespace.
+type NamespaceIPBlockUsage struct {
+	Namespace string `json:"namespace"`
+	CIDR      string `json:"cidr"`
+	// PoolIPs are the IPs of the node pool in the block.
+	PoolIPs      int `json:"poolIPs"`
+	AssignedIPs  int `json:"assignedIPs"`
+	AvailableIPs int `json:"availableIPs"`
+	// FreeRanges are the runs of consecutive Available IPs in the block, the more runs the
+	// Available IPs are split in the more fragmented the block is.
+	FreeRanges       int `json:"freeRanges"`
+	LargestFreeRange int `json:"largestFreeRange"`
+}
+
+// NamespaceIPBlocksResponse lists the occupancy of the namespace IP blocks on the node.
+type NamespaceIPBlocksResponse struct {
+	Response Response                `json:"response"`
+	Blocks   []NamespaceIPBlockUsage `json:"blocks"`
+}
+
+// AsyncQuery is the query parameter which, set to true, starts the long running operations of the API in the
+// background. Their response returns the ID of the operation, whose progress is then polled from OperationsPath.
+const AsyncQuery = "async"
+
+// OperationPhase is the phase of an operation started through the API.
+type OperationPhase string
+
+const (
+	OperationRunning   OperationPhase = "Running"
+	OperationSucceeded OperationPhase = "Succeeded"
+	OperationFailed    OperationPhase = "Failed"
+)
+
+// Operation reports the progress of a long running operation, so callers can tell an operation which is still
+// working from one which is stuck: a Running operation which is stuck stops updating.
+type Operation struct {
+	ID    string         `json:"id"`
+	Kind  string         `json:"kind"`
+	Phase OperationPhase `json:"phase"`
+	// Step names what a Running operation is doing.
+	Step    string `json:"step,omitempty"`
+	Percent int    `json:"percent"`
+	// Error is the reason a Failed operation failed, as the synchronous call would have returned it.
+	Error     *Response `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OperationResponse returns an operation.
+type OperationResponse struct {
+	Response  Response  `json:"response"`
+	Operation Operation `json:"operation"`
+}
+
+// EndpointTraffic is the traffic counters of an endpoint of a pod, from the pod's point of view.
+type EndpointTraffic struct {
+	RxBytes   uint64 `json:"rxBytes"`
+	TxBytes   uint64 `json:"txBytes"`
+	RxPackets uint64 `json:"rxPackets"`
+	TxPackets uint64 `json:"txPackets"`
+	RxDropped uint64 `json:"rxDropped"`
+	TxDropped uint64 `json:"txDropped"`
+}
+
+// PodTrafficResponse returns the traffic counters of the endpoints of a pod, by endpoint id.
+type PodTrafficResponse struct {
+	Response  Response                   `json:"response"`
+	Endpoints map[string]EndpointTraffic `json:"endpoints"`
+}
+
+// EndpointFlow is a flow of an endpoint of a pod, as tracked by the host. The bytes and packets are from the pod's point
+// of view, and only counted on the hosts which account them.
+type EndpointFlow struct {
+	Protocol string `json:"protocol"`
+	// Direction is egress for the flows the pod originated and ingress for the others
+	Direction string `json:"direction"`
+	SrcIP     string `json:"srcIP"`
+	DstIP     string `json:"dstIP"`
+	SrcPort   uint16 `json:"srcPort,omitempty"`
+	DstPort   uint16 `json:"dstPort,omitempty"`
+	TxBytes   uint64 `json:"txBytes"`
+	RxBytes   uint64 `json:"rxBytes"`
+	TxPackets uint64 `json:"txPackets"`
+	RxPackets uint64 `json:"rxPackets"`
+	// Translated is set for the flows which were snatted or dnatted
+	Translated bool `json:"translated,omitempty"`
+}
+
+// PodFlowsResponse returns a sample of the flows of the endpoints of a pod which log their flows, by endpoint id, and
+// the number of flows each sample was taken from.
+type PodFlowsResponse struct {
+	Response   Response                  `json:"response"`
+	Endpoints  map[string][]EndpointFlow `json:"endpoints"`
+	TotalFlows map[string]int            `json:"totalFlows"`
+}
+
+// SubnetUtilization is the usage of the ips of a subnet of a network of the cni.
+type SubnetUtilization struct {
+	CapacityIPs  uint64 `json:"capacityIPs"`
+	AvailableIPs uint64 `json:"availableIPs"`
+}
+
+// NetworkUtilization is the number of endpoints of a network of the cni and the usage of its subnets, by subnet.
+type NetworkUtilization struct {
+	Endpoints int                          `json:"endpoints"`
+	Subnets   map[string]SubnetUtilization `json:"subnets,omitempty"`
+}
+
+// NetworkUtilizationResponse returns the utilization of the networks of the cni, by network.
+type NetworkUtilizationResponse struct {
+	Response Response                      `json:"response"`
+	Networks map[string]NetworkUtilization `json:"networks"`
+}
+
+// NCProgrammingStep is the outcome of a step of the programming of the goal state of a network container, such as
+// saving it, creating its host objects or programming its snat rules.
+type NCProgrammingStep struct {
+	Name      string    `json:"name"`
+	Succeeded bool      `json:"succeeded"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// NCProgrammingStatus is whether the goal state of a network container is fully programmed on the node. It is once CNS
+// programmed every step of the goal version and NMAgent programmed the goal version on the host.
+type NCProgrammingStatus struct {
+	NetworkContainerID string `json:"networkContainerID"`
+	// GoalVersion is the version of the goal state CNS was last given.
+	GoalVersion string `json:"goalVersion"`
+	// AppliedVersion is the last version CNS programmed every step of, empty until one is.
+	AppliedVersion string `json:"appliedVersion,omitempty"`
+	// HostVersion is the version NMAgent programmed on the host, -1 until it is known.
+	HostVersion   string              `json:"hostVersion"`
+	Programmed    bool                `json:"programmed"`
+	Steps         []NCProgrammingStep `json:"steps,omitempty"` // of the last programming of the goal state
+	LastError     string              `json:"lastError,omitempty"`
+	LastErrorTime *time.Time          `json:"lastErrorTime,omitempty"`
+}
+
+// NCProgrammingStatusResponse returns the programming status of the network containers of the node.
+type NCProgrammingStatusResponse struct {
+	Response          Response              `json:"response"`
+	NetworkContainers []NCProgrammingStatus `json:"networkContainers"`
+}
+
+// IPAMState is the ip address management state of the node in one snapshot, the ip configurations of the pool with
+// the pods they are assigned to, and the pool the monitor scales.
+type IPAMState struct {
+	// IPConfigurations are sorted by ip address.
+	IPConfigurations []IPConfigurationStatus `json:"ipConfigurations"`
+	// StateCounts is the number of ip configurations by state.
+	StateCounts map[types.IPState]int `json:"stateCounts"`
+	// Pool is only set in the CRD mode, where the pool monitor scales the pool.
+	Pool *IPAMPoolState `json:"pool,omitempty"`
+}
+
+// IPAMPoolState is the state of the pool monitor.
+type IPAMPoolState struct {
+	RequestedIPCount int64 `json:"requestedIPCount"`
+	MinimumFreeIPs   int64 `json:"minimumFreeIPs"`
+	MaximumFreeIPs   int64 `json:"maximumFreeIPs"`
+	// IPsNotInUseCount is the number of ips the pool monitor asked DNC to release.
+	IPsNotInUseCount int64 `json:"ipsNotInUseCount"`
+}
+
+// IPAMStateResponse returns the ip address management state of the node.
+type IPAMStateResponse struct {
+	Response  Response  `json:"response"`
+	IPAMState IPAMState `json:"ipamState"`
+}
+
+// DatapathMigrationRequest starts migrating the endpoints of the cni to a datapath generation, BatchSize endpoints at a
+// time, waiting IntervalSecs between the batches so the reprogramming is paced. The zero fields get their defaults.
+type DatapathMigrationRequest struct {
+	// Generation defaults to the latest generation the cni knows.
+	Generation   *int `json:"generation,omitempty"`
+	BatchSize    int  `json:"batchSize,omitempty"`
+	IntervalSecs int  `json:"intervalSecs,omitempty"`
+}
+
+// DatapathMigrationResponse returns the operation the migration is polled from.
+type DatapathMigrationResponse struct {
+	Response    Response `json:"response"`
+	OperationID string   `json:"operationID,omitempty"`
+}
+
+// GetNICTypeStatesResponse lists the disabled NIC types of the node with the reason each was disabled for.
+type GetNICTypeStatesResponse struct {
+	Response         Response           `json:"response"`
+	DisabledNICTypes map[NICType]string `json:"disabledNICTypes"`
+}
@@ -8,12 +8,16 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/restserver"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 )
 
 const (
@@ -36,6 +40,7 @@ var clientPaths = []string{
 	cns.PathDebugIPAddresses,
 	cns.PathDebugPodContext,
 	cns.PathDebugRestData,
+	cns.PathDebugIPAMState,
 	cns.UnpublishNetworkContainer,
 	cns.PublishNetworkContainer,
 	cns.CreateOrUpdateNetworkContainer,
@@ -46,6 +51,13 @@ var clientPaths = []string{
 	cns.NetworkContainersURLPath,
 	cns.GetHomeAz,
 	cns.EndpointAPI,
+	cns.NetworkMetricsPath,
+	cns.NetworkUtilizationPath,
+	cns.NCProgrammingPath,
+	cns.EndpointPrefixPath,
+	cns.EndpointEventsPath,
+	cns.IPAMScaleDownPreviewPath,
+	cns.OperationsPath,
 }
 
 type do interface {
@@ -78,9 +90,9 @@ func New(baseURL string, requestTimeout time.Duration) (*Client, error) {
 	}
 
 	return &Client{
-		client: &http.Client{
+		client: tracing.Client(&http.Client{
 			Timeout: requestTimeout,
-		},
+		}),
 		routes: routes,
 	}, nil
 }
@@ -105,10 +117,12 @@ func buildRoutes(baseURL string, paths []string) (map[string]url.URL, error) {
 	return routes, nil
 }
 
-// GetAllNetworkContainers Request to get network container configs.
-func (c *Client) GetAllNetworkContainers(ctx context.Context, orchestratorContext []byte) ([]cns.GetNetworkContainerResponse, error) {
+// GetAllNetworkContainers Request to get network container configs, with their LocalIPConfiguration in the snat bridge
+// subnet when it is set.
+func (c *Client) GetAllNetworkContainers(ctx context.Context, orchestratorContext []byte, snatBridgeSubnet string) ([]cns.GetNetworkContainerResponse, error) {
 	payload := cns.GetNetworkContainerRequest{
 		OrchestratorContext: orchestratorContext,
+		SnatBridgeSubnet:    snatBridgeSubnet,
 	}
 
 	var body bytes.Buffer
@@ -434,7 +448,10 @@ func (c *Client) RequestIPs(ctx context.Context, ipconfig cns.IPConfigsRequest)
 	}
 
 	if response.Response.ReturnCode != 0 {
-		return nil, errors.New(response.Response.Message)
+		return nil, &CNSClientError{
+			Code: response.Response.ReturnCode,
+			Err:  errors.New(response.Response.Message),
+		}
 	}
 
 	return &response, nil
@@ -596,6 +613,34 @@ func (c *Client) GetHTTPServiceData(ctx context.Context) (*restserver.GetHTTPSer
 	return &resp, nil
 }
 
+// GetIPAMState gets the ip configurations, their count by state and the pool monitor state of the node for debugging
+func (c *Client) GetIPAMState(ctx context.Context) (*cns.IPAMStateResponse, error) {
+	u := c.routes[cns.PathDebugIPAMState]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "http request failed")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+	var resp cns.IPAMStateResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "failed to decode IPAMStateResponse")
+	}
+
+	if resp.Response.ReturnCode != 0 {
+		return nil, errors.New(resp.Response.Message)
+	}
+
+	return &resp, nil
+}
+
 // NumOfCPUCores returns the number of CPU cores available on the host that
 // CNS is running on.
 func (c *Client) NumOfCPUCores(ctx context.Context) (*cns.NumOfCPUCoresResponse, error) {
@@ -1060,6 +1105,43 @@ func (c *Client) GetEndpoint(ctx context.Context, endpointID string) (*restserve
 	return &response, nil
 }
 
+// GetPodEndpoints calls the EndpointHandlerAPI in CNS to retrieve the states of the endpoints of the given pod
+func (c *Client) GetPodEndpoints(ctx context.Context, podNamespace, podName string) (*restserver.GetPodEndpointsResponse, error) {
+	// build the request
+	u := c.routes[cns.EndpointAPI]
+	u.RawQuery = url.Values{"pod": []string{podNamespace + "/" + podName}}.Encode()
+	var response restserver.GetPodEndpointsResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		response.Response.ReturnCode = types.UnexpectedError
+		return &response, errors.Wrap(err, "failed to build request")
+	}
+
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		response.Response.ReturnCode = types.ConnectionError
+		return &response, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		response.Response.ReturnCode = types.UnexpectedError
+		return &response, errors.Errorf("http response %d", res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		response.Response.ReturnCode = types.UnexpectedError
+		return &response, errors.Wrap(err, "failed to decode GetPodEndpointsResponse")
+	}
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
 // UpdateEndpoint calls the EndpointHandlerAPI in CNS
 // to update the state of a given EndpointID with either HNSEndpointID or HostVethName
 func (c *Client) UpdateEndpoint(ctx context.Context, endpointID string, ipInfo map[string]*restserver.IPInfo) (*cns.Response, error) {
@@ -1100,3 +1182,289 @@ func (c *Client) UpdateEndpoint(ctx context.Context, endpointID string, ipInfo m
 
 	return &response, nil
 }
+
+// DetachEndpointInterface calls the EndpointHandlerAPI in CNS to remove the delegated nic ifName from the state of
+// the endpoint, once it was released from the running pod.
+func (c *Client) DetachEndpointInterface(ctx context.Context, endpointID, ifName string) (*cns.Response, error) {
+	// build the request
+	u := c.routes[cns.EndpointAPI]
+	u.Path += endpointID
+	u.RawQuery = url.Values{"ifName": []string{ifName}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var response cns.Response
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode CNS Response")
+	}
+
+	if response.ReturnCode != 0 {
+		return &response, errors.New(response.Message)
+	}
+
+	return &response, nil
+}
+
+// ResizeEndpointPrefix calls the endpointPrefixHandler in CNS to delegate a prefix of the given length to the endpoint,
+// or to return it to a single IP with a length of 32.
+func (c *Client) ResizeEndpointPrefix(ctx context.Context, endpointID string, prefixLength int) (*cns.ResizeEndpointPrefixResponse, error) {
+	// build the request
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(cns.ResizeEndpointPrefixRequest{EndpointID: endpointID, PrefixLength: prefixLength}); err != nil {
+		return nil, errors.Wrap(err, "failed to encode ResizeEndpointPrefixRequest")
+	}
+
+	u := c.routes[cns.EndpointPrefixPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var response cns.ResizeEndpointPrefixResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode ResizeEndpointPrefixResponse")
+	}
+
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
+// PreviewScaleDown calls the scaleDownPreviewHandler in CNS to preview which IPs shrinking the pool to the requested
+// count would release, and which pods would block it, without changing the pool.
+func (c *Client) PreviewScaleDown(ctx context.Context, requestedIPCount int64) (*cns.IPAMScaleDownPreviewResponse, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(cns.IPAMScaleDownPreviewRequest{RequestedIPCount: requestedIPCount}); err != nil {
+		return nil, errors.Wrap(err, "failed to encode IPAMScaleDownPreviewRequest")
+	}
+
+	u := c.routes[cns.IPAMScaleDownPreviewPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var response cns.IPAMScaleDownPreviewResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode IPAMScaleDownPreviewResponse")
+	}
+
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
+// GetEndpointEvents long-polls the endpoint events after the given sequence from CNS, waiting up to the timeout for
+// the next event. Subscribers pass the LastSequence of the response to the next call, and relist the endpoints when
+// Missed is set. The timeout has to be shorter than the request timeout of the client.
+func (c *Client) GetEndpointEvents(ctx context.Context, since uint64, timeout time.Duration) (*restserver.GetEndpointEventsResponse, error) {
+	// build the request
+	u := c.routes[cns.EndpointEventsPath]
+	u.RawQuery = url.Values{
+		"since":   []string{strconv.FormatUint(since, 10)},
+		"timeout": []string{strconv.Itoa(int(timeout.Seconds()))},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+	var response restserver.GetEndpointEventsResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode GetEndpointEventsResponse")
+	}
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
+// GetOperation gets the progress of an operation started with an async request from CNS. A Running operation whose
+// UpdatedAt stops moving is stuck, while one which is still working keeps updating it.
+func (c *Client) GetOperation(ctx context.Context, operationID string) (*cns.OperationResponse, error) {
+	if operationID == "" {
+		return nil, errors.New("no operation ID provided")
+	}
+
+	// build the request
+	u := c.routes[cns.OperationsPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String()+url.PathEscape(operationID), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+	var response cns.OperationResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode OperationResponse")
+	}
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
+// GetNetworkUtilization returns the endpoints and the subnet ips of the networks of the CNI, as last pushed with its
+// metrics.
+func (c *Client) GetNetworkUtilization(ctx context.Context) (*cns.NetworkUtilizationResponse, error) {
+	// build the request
+	u := c.routes[cns.NetworkUtilizationPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+	var response cns.NetworkUtilizationResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode NetworkUtilizationResponse")
+	}
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
+// GetNCProgrammingStatus returns whether the goal state of the network containers of the node is fully programmed, of
+// the network container ncID only unless it is empty.
+func (c *Client) GetNCProgrammingStatus(ctx context.Context, ncID string) (*cns.NCProgrammingStatusResponse, error) {
+	// build the request
+	u := c.routes[cns.NCProgrammingPath]
+	if ncID != "" {
+		u.RawQuery = url.Values{"ncid": []string{ncID}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+	var response cns.NCProgrammingStatusResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to decode NCProgrammingStatusResponse")
+	}
+	if response.Response.ReturnCode != 0 {
+		return &response, errors.New(response.Response.Message)
+	}
+
+	return &response, nil
+}
+
+// PushNetworkMetrics sends the network metric families gathered by a short lived process to CNS, which accumulates
+// and exposes them with its own metrics.
+func (c *Client) PushNetworkMetrics(ctx context.Context, families []*dto.MetricFamily) error {
+	// build the request
+	var body bytes.Buffer
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(&body, mf); err != nil {
+			return errors.Wrap(err, "failed to encode network metrics")
+		}
+	}
+
+	u := c.routes[cns.NetworkMetricsPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+	res, err := c.client.Do(req)
+	if err != nil {
+		return &ConnectionFailureErr{cause: err}
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var response cns.Response
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return errors.Wrap(err, "failed to decode CNS Response")
+	}
+
+	if response.ReturnCode != 0 {
+		return errors.New(response.Message)
+	}
+
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/restserver"
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -343,9 +344,9 @@ func TestNew(t *testing.T) {
 			url:  "",
 			want: &Client{
 				routes: emptyRoutes,
-				client: &http.Client{
+				client: tracing.Client(&http.Client{
 					Timeout: 0,
-				},
+				}),
 			},
 			wantErr: false,
 		},
@@ -354,9 +355,9 @@ func TestNew(t *testing.T) {
 			url:  fqdnBaseURL,
 			want: &Client{
 				routes: fqdnRoutes,
-				client: &http.Client{
+				client: tracing.Client(&http.Client{
 					Timeout: 0,
-				},
+				}),
 			},
 			wantErr: false,
 		},
@@ -365,9 +366,9 @@ func TestNew(t *testing.T) {
 			url:  fqdnWithPortBaseURL,
 			want: &Client{
 				routes: fqdnWithPortRoutes,
-				client: &http.Client{
+				client: tracing.Client(&http.Client{
 					Timeout: 0,
-				},
+				}),
 			},
 			wantErr: false,
 		},
@@ -581,7 +582,7 @@ func TestGetAllNetworkContainers(t *testing.T) {
 			orchestratorContext, err := json.Marshal(tt.podInfo)
 			require.NoError(t, err, "marshaling orchestrator context failed")
 
-			got, err := client.GetAllNetworkContainers(tt.ctx, orchestratorContext)
+			got, err := client.GetAllNetworkContainers(tt.ctx, orchestratorContext, "")
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
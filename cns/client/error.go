@@ -41,3 +41,10 @@ func IsUnsupportedAPI(err error) bool {
 	e := &CNSClientError{}
 	return errors.As(err, &e) && (e.Code == types.UnsupportedAPI)
 }
+
+// IsStaticIPUnavailable tests if the provided error is of type CNSClientError and then
+// further tests if the error code is of type StaticIPUnavailable
+func IsStaticIPUnavailable(err error) bool {
+	e := &CNSClientError{}
+	return errors.As(err, &e) && (e.Code == types.StaticIPUnavailable)
+}
@@ -44,3 +44,13 @@ func TestIsNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestIsStaticIPUnavailable(t *testing.T) {
+	err := errors.Wrap(&CNSClientError{Code: types.StaticIPUnavailable, Err: errors.New("ip is assigned")}, "request failed")
+	if !IsStaticIPUnavailable(err) {
+		t.Errorf("IsStaticIPUnavailable() = false, want true")
+	}
+	if IsStaticIPUnavailable(&CNSClientError{Code: types.FailedToAllocateIPConfig, Err: errors.New("no ips")}) {
+		t.Errorf("IsStaticIPUnavailable() = true, want false")
+	}
+}
@@ -2,10 +2,14 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/client"
@@ -18,6 +22,8 @@ const (
 	getCmdArg       = "get"
 	getInMemoryData = "getInMemory"
 	getPodCmdArg    = "getPodContexts"
+	getIPAMStateArg = "getIPAMState"
+	jsonOutputArg   = "json"
 )
 
 func HandleCNSClientCommands(ctx context.Context, cmd string, arg string) error {
@@ -36,8 +42,11 @@ func HandleCNSClientCommands(ctx context.Context, cmd string, arg string) error
 		return getPodCmd(ctx, cnsClient)
 	case strings.EqualFold(getInMemoryData, cmd):
 		return getInMemory(ctx, cnsClient)
+	case strings.EqualFold(getIPAMStateArg, cmd):
+		return getIPAMState(ctx, cnsClient, arg)
 	default:
-		return fmt.Errorf("No debug cmd supplied, options are: %v", getCmdArg)
+		return fmt.Errorf("No debug cmd supplied, options are: %v",
+			[]string{getCmdArg, getPodCmdArg, getInMemoryData, getIPAMStateArg})
 	}
 }
 
@@ -99,3 +108,73 @@ func getInMemory(ctx context.Context, client *client.Client) error {
 		data.HTTPRestServiceData.PodIPIDByPodInterfaceKey, data.HTTPRestServiceData.PodIPConfigState)
 	return nil
 }
+
+// getIPAMState prints the pod to ip assignments, the pending ips and the pool state of CNS as tables, or as JSON when
+// the arg is json.
+func getIPAMState(ctx context.Context, client *client.Client, arg string) error {
+	resp, err := client.GetIPAMState(ctx)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(jsonOutputArg, arg) {
+		return printIPAMStateJSON(os.Stdout, &resp.IPAMState)
+	}
+	return printIPAMState(os.Stdout, &resp.IPAMState, time.Now())
+}
+
+func printIPAMStateJSON(w io.Writer, state *cns.IPAMState) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state) //nolint:wrapcheck // printed as is by the caller
+}
+
+// printIPAMState prints the pool, the assigned ips with their pods and the ips pending programming or release, with
+// how long they have been pending at now.
+func printIPAMState(w io.Writer, state *cns.IPAMState, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "POOL")
+	fmt.Fprintln(tw, "TOTAL\tASSIGNED\tAVAILABLE\tPENDING PROGRAMMING\tPENDING RELEASE")
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\n", len(state.IPConfigurations), state.StateCounts[types.Assigned],
+		state.StateCounts[types.Available], state.StateCounts[types.PendingProgramming], state.StateCounts[types.PendingRelease])
+	if pool := state.Pool; pool != nil {
+		fmt.Fprintln(tw, "REQUESTED\tMIN FREE\tMAX FREE\tNOT IN USE")
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\n", pool.RequestedIPCount, pool.MinimumFreeIPs, pool.MaximumFreeIPs, pool.IPsNotInUseCount)
+	}
+
+	fmt.Fprintln(tw, "\nASSIGNED")
+	fmt.Fprintln(tw, "IP\tNAMESPACE\tPOD\tINTERFACE\tNC\tSINCE")
+	for i := range state.IPConfigurations {
+		ipConfig := &state.IPConfigurations[i]
+		if ipConfig.GetState() != types.Assigned {
+			continue
+		}
+		namespace, name, ifID := "-", "-", "-"
+		if ipConfig.PodInfo != nil {
+			namespace, name, ifID = ipConfig.PodInfo.Namespace(), ipConfig.PodInfo.Name(), ipConfig.PodInfo.InterfaceID()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", ipConfig.IPAddress, namespace, name, ifID, ipConfig.NCID,
+			age(ipConfig.LastStateTransition, now))
+	}
+
+	fmt.Fprintln(tw, "\nPENDING")
+	fmt.Fprintln(tw, "IP\tSTATE\tNC\tSINCE")
+	for i := range state.IPConfigurations {
+		ipConfig := &state.IPConfigurations[i]
+		if s := ipConfig.GetState(); s != types.PendingProgramming && s != types.PendingRelease {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ipConfig.IPAddress, ipConfig.GetState(), ipConfig.NCID,
+			age(ipConfig.LastStateTransition, now))
+	}
+
+	return tw.Flush() //nolint:wrapcheck // printed as is by the caller
+}
+
+// age is how long ago t was at now, to the second.
+func age(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return now.Sub(t).Truncate(time.Second).String()
+}
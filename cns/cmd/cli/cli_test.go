@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintIPAMState(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)
+	ipConfig := func(ip string, state types.IPState, podInfo cns.PodInfo) cns.IPConfigurationStatus {
+		c := cns.IPConfigurationStatus{ID: ip, IPAddress: ip, NCID: "nc1", PodInfo: podInfo}
+		c.SetState(state)
+		c.LastStateTransition = now.Add(-90 * time.Second)
+		return c
+	}
+	state := &cns.IPAMState{
+		IPConfigurations: []cns.IPConfigurationStatus{
+			ipConfig("10.0.0.1", types.Available, nil),
+			ipConfig("10.0.0.2", types.Assigned, cns.NewPodInfo("abc-eth0", "abc", "pod1", "ns1")),
+			ipConfig("10.0.0.3", types.PendingRelease, nil),
+		},
+		StateCounts: map[types.IPState]int{types.Available: 1, types.Assigned: 1, types.PendingRelease: 1},
+		Pool:        &cns.IPAMPoolState{RequestedIPCount: 16, MinimumFreeIPs: 8, MaximumFreeIPs: 24, IPsNotInUseCount: 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printIPAMState(&buf, state, now))
+	want := `POOL
+TOTAL      ASSIGNED  AVAILABLE  PENDING PROGRAMMING  PENDING RELEASE
+3          1         1          0                    1
+REQUESTED  MIN FREE  MAX FREE   NOT IN USE
+16         8         24         1
+
+ASSIGNED
+IP        NAMESPACE  POD   INTERFACE  NC   SINCE
+10.0.0.2  ns1        pod1  abc        nc1  1m30s
+
+PENDING
+IP        STATE           NC   SINCE
+10.0.0.3  PendingRelease  nc1  1m30s
+`
+	assert.Equal(t, want, buf.String())
+}
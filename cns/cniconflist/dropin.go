@@ -0,0 +1,246 @@
+package cniconflist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const dropInExtension = ".json"
+
+var (
+	errInvalidDropIn = errors.New("invalid drop-in")
+	errInvalidBase   = errors.New("invalid base conflist")
+)
+
+// Generator writes a CNI conflist to its output stream, which Close completes.
+type Generator interface {
+	Generate() error
+	Close() error
+}
+
+// DropIn is a fragment of the conflist which the operator drops in the drop-in dir of a DropInGenerator.
+type DropIn struct {
+	// Plugins are chained after the plugins of the base conflist. A plugin of the type of a chained plugin replaces it,
+	// except the first plugin of the base conflist which can't be replaced.
+	Plugins []map[string]any `json:"plugins,omitempty"`
+	// RuntimeConfig is merged into the runtimeConfig of the first plugin of the base conflist, key by key.
+	RuntimeConfig map[string]any `json:"runtimeConfig,omitempty"`
+}
+
+// DropInGenerator generates the conflist of its base generator with the drop-ins of a dir merged into it, in the
+// lexical order of their file names. Only the files with the .json extension are drop-ins.
+type DropInGenerator struct {
+	Writer io.WriteCloser
+	// Dir is the dir of the drop-ins, the base conflist is generated as it is when it does not exist.
+	Dir string
+	// NewBase creates the generator of the scenario which writes the base conflist to w.
+	NewBase func(w io.WriteCloser) Generator
+
+	lock      sync.Mutex
+	generated bool
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Generate writes the base conflist with the drop-ins merged into it to the Generator's output stream.
+func (v *DropInGenerator) Generate() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.generate()
+}
+
+func (v *DropInGenerator) generate() error {
+	base := new(bytes.Buffer)
+	if err := v.NewBase(nopCloser{base}).Generate(); err != nil {
+		return errors.Wrap(err, "error generating base conflist")
+	}
+
+	var conflist map[string]any
+	if err := json.Unmarshal(base.Bytes(), &conflist); err != nil {
+		return errors.Wrap(err, "error decoding base conflist")
+	}
+
+	dropIns, err := v.readDropIns()
+	if err != nil {
+		return err
+	}
+	if err := mergeDropIns(conflist, dropIns); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(v.Writer)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(conflist); err != nil {
+		return errors.Wrap(err, "error encoding conflist to json")
+	}
+
+	return nil
+}
+
+// Close moves the generated conflist to its destination. The conflist is regenerated on the changes of the drop-ins
+// once it was first generated.
+func (v *DropInGenerator) Close() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if err := v.Writer.Close(); err != nil {
+		return errors.Wrap(err, "error closing generator")
+	}
+
+	v.generated = true
+	return nil
+}
+
+// readDropIns reads the drop-ins of the dir in the lexical order of their file names.
+func (v *DropInGenerator) readDropIns() ([]DropIn, error) {
+	entries, err := os.ReadDir(v.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error reading drop-in dir %s", v.Dir)
+	}
+
+	dropIns := []DropIn{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), dropInExtension) {
+			continue
+		}
+
+		path := filepath.Join(v.Dir, entry.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading drop-in %s", path)
+		}
+
+		var dropIn DropIn
+		if err := json.Unmarshal(b, &dropIn); err != nil {
+			return nil, errors.Wrapf(errInvalidDropIn, "error decoding drop-in %s: %v", path, err)
+		}
+		dropIns = append(dropIns, dropIn)
+	}
+
+	return dropIns, nil
+}
+
+// mergeDropIns chains the plugins of the drop-ins and merges their runtimeConfig into the first plugin of the conflist.
+func mergeDropIns(conflist map[string]any, dropIns []DropIn) error {
+	plugins, _ := conflist["plugins"].([]any)
+	if len(plugins) == 0 {
+		return errors.Wrap(errInvalidBase, "base conflist has no plugins")
+	}
+	first, ok := plugins[0].(map[string]any)
+	if !ok {
+		return errors.Wrap(errInvalidBase, "first plugin of the base conflist is not an object")
+	}
+
+	for _, dropIn := range dropIns {
+		for _, plugin := range dropIn.Plugins {
+			pluginType, _ := plugin["type"].(string)
+			if pluginType == "" {
+				return errors.Wrap(errInvalidDropIn, "chained plugin has no type")
+			}
+			if pluginType == first["type"] {
+				return errors.Wrapf(errInvalidDropIn, "chained plugin %s can't replace the first plugin of the conflist", pluginType)
+			}
+
+			replaced := false
+			for i := 1; i < len(plugins); i++ {
+				if chained, ok := plugins[i].(map[string]any); ok && chained["type"] == pluginType {
+					plugins[i] = plugin
+					replaced = true
+				}
+			}
+			if !replaced {
+				plugins = append(plugins, plugin)
+			}
+		}
+
+		if len(dropIn.RuntimeConfig) > 0 {
+			runtimeConfig, _ := first["runtimeConfig"].(map[string]any)
+			if runtimeConfig == nil {
+				runtimeConfig = map[string]any{}
+			}
+			for k, val := range dropIn.RuntimeConfig {
+				runtimeConfig[k] = val
+			}
+			first["runtimeConfig"] = runtimeConfig
+		}
+	}
+
+	conflist["plugins"] = plugins
+	return nil
+}
+
+// regenerate writes the conflist again once it was first generated. The conflist which was generated last is kept when
+// the drop-ins are invalid.
+func (v *DropInGenerator) regenerate() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !v.generated {
+		return nil
+	}
+
+	if err := v.generate(); err != nil {
+		return err
+	}
+	return errors.Wrap(v.Writer.Close(), "error closing generator")
+}
+
+// Watch regenerates the conflist on the changes of the drop-in dir, until the context is done. The dir is created
+// when it does not exist, so that the operator can drop the first drop-in in it.
+func (v *DropInGenerator) Watch(ctx context.Context, logger *zap.Logger) error {
+	if err := os.MkdirAll(v.Dir, 0o755); err != nil { //nolint:gomnd // the drop-ins are readable, like the conflist
+		return errors.Wrapf(err, "failed to create drop-in dir %s", v.Dir)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "error creating fsnotify watcher")
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(v.Dir); err != nil {
+		return errors.Wrap(err, "failed to add drop-in dir to fsnotify watcher")
+	}
+
+	// a drop-in which changed before the watch started is merged too
+	if err := v.regenerate(); err != nil {
+		logger.Error("failed to regenerate cni conflist, keeping the last one", zap.Error(err))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "exiting drop-in watch")
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("fsnotify watcher closed")
+			}
+			if !strings.HasSuffix(event.Name, dropInExtension) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			logger.Info("cni conflist drop-in changed, regenerating cni conflist", zap.String("event", event.String()))
+			if err := v.regenerate(); err != nil {
+				logger.Error("failed to regenerate cni conflist, keeping the last one", zap.Error(err))
+			}
+		case watcherErr := <-watcher.Errors:
+			logger.Error("fsnotify watcher error", zap.Error(watcherErr))
+		}
+	}
+}
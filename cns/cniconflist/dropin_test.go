@@ -0,0 +1,173 @@
+package cniconflist_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/cniconflist"
+	acnfs "github.com/Azure/azure-container-networking/internal/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const baseConflist = `{"cniVersion":"0.3.0","name":"azure","plugins":[{"type":"azure-vnet","mode":"transparent"},{"type":"portmap","snat":true}]}`
+
+type fakeBaseGenerator struct {
+	w io.WriteCloser
+}
+
+func (g *fakeBaseGenerator) Generate() error {
+	_, err := g.w.Write([]byte(baseConflist))
+	return err
+}
+
+func (g *fakeBaseGenerator) Close() error {
+	return g.w.Close()
+}
+
+func newFakeBase(w io.WriteCloser) cniconflist.Generator {
+	return &fakeBaseGenerator{w: w}
+}
+
+func writeDropIn(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+}
+
+func readConflist(t *testing.T, path string) map[string]any {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var conflist map[string]any
+	require.NoError(t, json.Unmarshal(b, &conflist))
+	return conflist
+}
+
+func TestDropInGenerator(t *testing.T) {
+	tests := []struct {
+		name        string
+		dropIns     map[string]string
+		wantPlugins []any
+		wantErr     bool
+	}{
+		{
+			name: "no drop-in",
+			wantPlugins: []any{
+				map[string]any{"type": "azure-vnet", "mode": "transparent"},
+				map[string]any{"type": "portmap", "snat": true},
+			},
+		},
+		{
+			name: "chained plugins and runtime config",
+			dropIns: map[string]string{
+				"10-bandwidth.json": `{"plugins":[{"type":"bandwidth","capabilities":{"bandwidth":true}}]}`,
+				"20-portmap.json":   `{"plugins":[{"type":"portmap","snat":false}],"runtimeConfig":{"mtu":1400}}`,
+				"30-dns.json":       `{"runtimeConfig":{"dns":{"nameservers":["10.0.0.10"]}}}`,
+				"README.md":         "not a drop-in",
+			},
+			wantPlugins: []any{
+				map[string]any{
+					"type": "azure-vnet", "mode": "transparent",
+					"runtimeConfig": map[string]any{"mtu": float64(1400), "dns": map[string]any{"nameservers": []any{"10.0.0.10"}}},
+				},
+				map[string]any{"type": "portmap", "snat": false},
+				map[string]any{"type": "bandwidth", "capabilities": map[string]any{"bandwidth": true}},
+			},
+		},
+		{
+			name:    "plugin without type",
+			dropIns: map[string]string{"10-invalid.json": `{"plugins":[{"name":"bandwidth"}]}`},
+			wantErr: true,
+		},
+		{
+			name:    "plugin replacing the first plugin",
+			dropIns: map[string]string{"10-invalid.json": `{"plugins":[{"type":"azure-vnet"}]}`},
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			dropIns: map[string]string{"10-invalid.json": `{"plugins":`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.dropIns {
+				writeDropIn(t, dir, name, content)
+			}
+			path := filepath.Join(t.TempDir(), "10-azure.conflist")
+			writer, err := acnfs.NewAtomicWriter(path)
+			require.NoError(t, err)
+
+			g := &cniconflist.DropInGenerator{Writer: writer, Dir: dir, NewBase: newFakeBase}
+			err = g.Generate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, g.Close())
+
+			conflist := readConflist(t, path)
+			assert.Equal(t, "azure", conflist["name"])
+			assert.Equal(t, tt.wantPlugins, conflist["plugins"])
+		})
+	}
+}
+
+func TestDropInGeneratorWatch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "10-azure.conflist.d")
+	path := filepath.Join(t.TempDir(), "10-azure.conflist")
+	writer, err := acnfs.NewAtomicWriter(path)
+	require.NoError(t, err)
+	g := &cniconflist.DropInGenerator{Writer: writer, Dir: dir, NewBase: newFakeBase}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- g.Watch(ctx, zap.NewNop()) }()
+
+	// the conflist is not written before it is first generated
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(dir)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	writeDropIn(t, dir, "10-bandwidth.json", `{"plugins":[{"type":"bandwidth"}]}`)
+	time.Sleep(100 * time.Millisecond)
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, g.Generate())
+	require.NoError(t, g.Close())
+	assert.Len(t, readConflist(t, path)["plugins"], 3)
+
+	// a changed drop-in regenerates the conflist
+	writeDropIn(t, dir, "20-tuning.json", `{"plugins":[{"type":"tuning"}]}`)
+	require.Eventually(t, func() bool {
+		return len(readConflist(t, path)["plugins"].([]any)) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// an invalid drop-in keeps the last conflist
+	writeDropIn(t, dir, "30-invalid.json", `{"plugins":[{}]}`)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, readConflist(t, path)["plugins"], 4)
+
+	// a removed drop-in regenerates the conflist
+	require.NoError(t, os.Remove(filepath.Join(dir, "30-invalid.json")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "20-tuning.json")))
+	require.Eventually(t, func() bool {
+		return len(readConflist(t, path)["plugins"].([]any)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -24,19 +24,32 @@ const (
 type CNSConfig struct {
 	AZRSettings                 AZRSettings
 	AsyncPodDeletePath          string
+	CNIConflistDropInDir        string
 	CNIConflistFilepath         string
 	CNIConflistScenario         string
 	ChannelMode                 string
+	DNSProxySettings            DNSProxySettings
+	DNSRegistrationSettings     DNSRegistrationSettings
+	DisabledNICTypes            []string
+	DuplicateAddressDetection   DuplicateAddressDetectionSettings
 	EnableAPIServerHealthPing   bool
 	EnableAsyncPodDelete        bool
 	EnableCNIConflistGeneration bool
 	EnableIPAMv2                bool
 	EnableK8sDevicePlugin       bool
 	EnableLoggerV2              bool
+	EnableNamespaceIPBlocks     bool
+	EnablePodFlowLogs           bool
+	EnablePodTrafficStats       bool
 	EnablePprof                 bool
 	EnableStateMigration        bool
 	EnableSubnetScarcity        bool
 	EnableSwiftV2               bool
+	EndpointHealthSettings      EndpointHealthSettings
+	HNSPolicyGCSettings         HNSPolicyGCSettings
+	HNSReattachSettings         HNSReattachSettings
+	HostNCApipaSubnet           string
+	IPReleaseGracePeriodSecs    int
 	InitializeFromCNI           bool
 	KeyVaultSettings            KeyVaultSettings
 	Logger                      loggerv2.Config
@@ -45,7 +58,10 @@ type CNSConfig struct {
 	ManagedSettings             ManagedSettings
 	MellanoxMonitorIntervalSecs int
 	MetricsBindAddress          string
+	NodeConditionsSettings      NodeConditionsSettings
 	ProgramSNATIPTables         bool
+	RouteHealthSettings         RouteHealthSettings
+	SelfTestSettings            SelfTestSettings
 	SyncHostNCTimeoutMs         int
 	SyncHostNCVersionIntervalMs int
 	TLSCertificatePath          string
@@ -53,10 +69,13 @@ type CNSConfig struct {
 	TLSPort                     string
 	TLSSubjectName              string
 	TelemetrySettings           TelemetrySettings
+	TracingSettings             tracing.Config
 	UseHTTPS                    bool
 	UseMTLS                     bool
 	WatchPods                   bool `json:"-"`
 	WireserverIP                string
+	WireguardSettings           WireguardSettings
+	VxlanSettings               VxlanSettings
 	GRPCSettings                GRPCSettings
 	MinTLSVersion               string
 }
@@ -117,6 +136,143 @@ type GRPCSettings struct {
 	Port      uint16
 }
 
+type DNSProxySettings struct {
+	// Enable the local dns proxy for multitenant pods, replacing SNAT for DNS.
+	Enable bool
+	// Address the proxy listens on, this is the snat bridge address pods reach the host on.
+	ListenAddress string
+	ListenPort    uint16
+	// Maximum number of responses cached across all tenants.
+	CacheSize int
+	// Timeout for queries forwarded to the tenant's resolver.
+	UpstreamTimeoutMs int
+}
+
+type DNSRegistrationSettings struct {
+	// Enable the registration of the A/AAAA and PTR records of the pod ips, requires ManageEndpointState.
+	Enable bool
+	// Backend the records are registered with, AzurePrivateDNS or RFC2136.
+	Backend string
+	// Zone the <pod>.<namespace> records are registered in.
+	Zone string
+	// Reverse zones the PTR records are registered in, the ips outside of them get no PTR record.
+	ReverseZones []string
+	TTLSecs      int
+	// Primary server of the zones as host:port, for the RFC2136 backend.
+	RFC2136Server string
+	// Location of the private dns zones, for the AzurePrivateDNS backend.
+	SubscriptionID          string
+	ResourceGroup           string
+	ResourceManagerEndpoint string
+	// Client id of the managed identity updating the private dns zones, the system assigned identity if empty.
+	ManagedIdentityClientID string
+	// Retries of each update of the server.
+	RetryAttempts int
+	RetryDelayMs  int
+	// Interval between the resyncs of the records with all the endpoints.
+	ResyncIntervalSecs int
+}
+
+type RouteHealthSettings struct {
+	// Enable the failover of the egress of multi-NIC pods between their default routes on linux, requires ManageEndpointState.
+	Enable bool
+	// Interval between the probes of the gateways of the default routes.
+	IntervalSecs   int
+	ProbeTimeoutMs int
+	// Failed probes in a row after which a gateway is unhealthy, and answered ones after which it is healthy again.
+	FailureThreshold  int
+	RecoveryThreshold int
+}
+
+type DuplicateAddressDetectionSettings struct {
+	// Enable probing the vnet with arp and ndp for the IPs assigned to pods on linux, the ones other hosts answer for
+	// are quarantined and the pods assigned other IPs.
+	Enable bool
+	// Interface the IPs are probed on, the interface of the host primary IP when empty.
+	Interface      string
+	ProbeTimeoutMs int
+	// How long an IP other hosts answered for stays out of the pool, after which it is probed again.
+	QuarantineSecs int
+	// IgnoredMACs are the macs whose answers are not conflicts, such as the one the vnet answers every arp request with.
+	IgnoredMACs []string
+}
+
+type EndpointHealthSettings struct {
+	// Enable the checks of the datapath of the pods on linux, served by the endpoint health API, requires ManageEndpointState.
+	Enable bool
+	// Interval between the checks of the endpoints.
+	IntervalSecs  int
+	PingTimeoutMs int
+	// Failed checks in a row after which an interface is unhealthy, and passed ones after which it is healthy again.
+	FailureThreshold  int
+	RecoveryThreshold int
+	// Checks to run among routes, gateway and neighbor, all of them when empty.
+	Checks []string
+	// Repair the unhealthy interfaces the checks can, by adding back their missing routes.
+	Repair bool
+	// Repairs after which the eviction of a pod still unhealthy is recommended with a node event, never when 0.
+	EvictAfterRepairs int
+}
+
+type WireguardSettings struct {
+	// Enable node to node encryption of pod traffic over a WireGuard interface.
+	Enable        bool
+	InterfaceName string
+	ListenPort    int
+	MTU           int
+	// Where the node's private key is kept across restarts and reboots, so it must not be on a tmpfs.
+	PrivateKeyPath string
+	// Interval between syncs of the peers with the cluster's nodes.
+	ReconcileIntervalSecs int
+}
+
+type VxlanSettings struct {
+	// Enable the sync of the vxlan interface of the pod networks in the vxlan mode with the cluster's nodes.
+	Enable bool
+	// The vxlan interface the CNI creates, it must match the vxlanIfName of the CNI network config.
+	InterfaceName string
+	// Interval between syncs of the peers with the cluster's nodes.
+	ReconcileIntervalSecs int
+}
+
+type SelfTestSettings struct {
+	// Enable the startup self-test, which plumbs a fake pod and probes the datapath from it before CNS reports ready.
+	Enable bool
+	// Timeout of each self-test attempt.
+	TimeoutSecs int
+	// Interval between the attempts until the self-test passes.
+	RetryIntervalSecs int
+	// HNS network the endpoint of the fake pod is created in on windows.
+	HNSNetworkName string
+}
+
+type HNSPolicyGCSettings struct {
+	// Enable the garbage collection of the policies left on the hns networks by the endpoints the cni orphaned, on windows.
+	Enable bool
+	// Interval between the collections.
+	IntervalSecs int
+}
+
+type HNSReattachSettings struct {
+	// Enable the watch for the hcn endpoints hns loses across a restart, which has the cni create them again, on windows.
+	Enable bool
+	// Interval between the checks of the hcn endpoints.
+	IntervalSecs int
+}
+
+type NodeConditionsSettings struct {
+	// Enable publishing the network readiness conditions on the node.
+	Enable bool
+	// Interval between the checks of the conditions.
+	IntervalSecs int
+	// Number of failed checks in a row which turn a condition False.
+	FailureThreshold int
+	// Number of passed checks in a row which turn a condition True.
+	SuccessThreshold int
+	// Minimum number of IPs available to pods for the node to be IPAM ready.
+	MinAvailableIPs int
+}
+
 func getConfigFilePath(cmdPath string) (string, error) {
 	// If config path is set from cmd line, return that.
 	if strings.TrimSpace(cmdPath) != "" {
@@ -205,12 +361,155 @@ func setKeyVaultSettingsDefaults(kvs *KeyVaultSettings) {
 	}
 }
 
+func setDNSProxySettingsDefaults(dps *DNSProxySettings) {
+	if dps.ListenAddress == "" {
+		dps.ListenAddress = "169.254.128.1"
+	}
+	if dps.ListenPort == 0 {
+		dps.ListenPort = 53
+	}
+	if dps.CacheSize == 0 {
+		dps.CacheSize = 4096 //nolint:gomnd // default cache size
+	}
+	if dps.UpstreamTimeoutMs == 0 {
+		dps.UpstreamTimeoutMs = 2000 //nolint:gomnd // default times
+	}
+}
+
+func setDNSRegistrationSettingsDefaults(drs *DNSRegistrationSettings) {
+	if drs.TTLSecs == 0 {
+		drs.TTLSecs = 300 //nolint:gomnd // default times
+	}
+	if drs.RetryAttempts == 0 {
+		drs.RetryAttempts = 5 //nolint:gomnd // default attempts
+	}
+	if drs.RetryDelayMs == 0 {
+		drs.RetryDelayMs = 1000 //nolint:gomnd // default times
+	}
+	if drs.ResyncIntervalSecs == 0 {
+		drs.ResyncIntervalSecs = 600 //nolint:gomnd // default times
+	}
+}
+
+func setRouteHealthSettingsDefaults(rhs *RouteHealthSettings) {
+	if rhs.IntervalSecs == 0 {
+		rhs.IntervalSecs = 5 //nolint:gomnd // default times
+	}
+	if rhs.ProbeTimeoutMs == 0 {
+		rhs.ProbeTimeoutMs = 1000 //nolint:gomnd // default times
+	}
+	if rhs.FailureThreshold == 0 {
+		rhs.FailureThreshold = 3 //nolint:gomnd // default threshold
+	}
+	if rhs.RecoveryThreshold == 0 {
+		rhs.RecoveryThreshold = 3 //nolint:gomnd // default threshold
+	}
+}
+
+func setEndpointHealthSettingsDefaults(ehs *EndpointHealthSettings) {
+	if ehs.IntervalSecs == 0 {
+		ehs.IntervalSecs = 30 //nolint:gomnd // default times
+	}
+	if ehs.PingTimeoutMs == 0 {
+		ehs.PingTimeoutMs = 1000 //nolint:gomnd // default times
+	}
+	if ehs.FailureThreshold == 0 {
+		ehs.FailureThreshold = 3 //nolint:gomnd // default threshold
+	}
+	if ehs.RecoveryThreshold == 0 {
+		ehs.RecoveryThreshold = 2 //nolint:gomnd // default threshold
+	}
+}
+
+func setWireguardSettingsDefaults(wgs *WireguardSettings) {
+	if wgs.InterfaceName == "" {
+		wgs.InterfaceName = "azwg0"
+	}
+	if wgs.ListenPort == 0 {
+		wgs.ListenPort = 51820 //nolint:gomnd // default wireguard port
+	}
+	if wgs.MTU == 0 {
+		wgs.MTU = 1420 //nolint:gomnd // 1500 less the wireguard overhead
+	}
+	if wgs.PrivateKeyPath == "" {
+		wgs.PrivateKeyPath = "/var/lib/azure-cns/wireguard.key"
+	}
+	if wgs.ReconcileIntervalSecs == 0 {
+		wgs.ReconcileIntervalSecs = 30 //nolint:gomnd // default times
+	}
+}
+
+func setVxlanSettingsDefaults(vs *VxlanSettings) {
+	if vs.InterfaceName == "" {
+		vs.InterfaceName = "azvxlan"
+	}
+	if vs.ReconcileIntervalSecs == 0 {
+		vs.ReconcileIntervalSecs = 30 //nolint:gomnd // default times
+	}
+}
+
+func setSelfTestSettingsDefaults(sts *SelfTestSettings) {
+	if sts.TimeoutSecs == 0 {
+		sts.TimeoutSecs = 10 //nolint:gomnd // default times
+	}
+	if sts.RetryIntervalSecs == 0 {
+		sts.RetryIntervalSecs = 30 //nolint:gomnd // default times
+	}
+	if sts.HNSNetworkName == "" {
+		sts.HNSNetworkName = "azure"
+	}
+}
+
+func setHNSPolicyGCSettingsDefaults(hgs *HNSPolicyGCSettings) {
+	if hgs.IntervalSecs == 0 {
+		hgs.IntervalSecs = 300 //nolint:gomnd // default times
+	}
+}
+
+func setHNSReattachSettingsDefaults(hrs *HNSReattachSettings) {
+	if hrs.IntervalSecs == 0 {
+		hrs.IntervalSecs = 30 //nolint:gomnd // default times
+	}
+}
+
+func setDuplicateAddressDetectionSettingsDefaults(dads *DuplicateAddressDetectionSettings) {
+	if dads.ProbeTimeoutMs == 0 {
+		dads.ProbeTimeoutMs = 200 //nolint:gomnd // default times
+	}
+	if dads.QuarantineSecs == 0 {
+		dads.QuarantineSecs = 600 //nolint:gomnd // default times
+	}
+}
+
+func setNodeConditionsSettingsDefaults(ncs *NodeConditionsSettings) {
+	if ncs.IntervalSecs == 0 {
+		ncs.IntervalSecs = 10 //nolint:gomnd // default times
+	}
+	if ncs.FailureThreshold == 0 {
+		ncs.FailureThreshold = 3 //nolint:gomnd // default threshold
+	}
+	if ncs.SuccessThreshold == 0 {
+		ncs.SuccessThreshold = 1
+	}
+}
+
 // SetCNSConfigDefaults set default values of CNS config if not specified
 func SetCNSConfigDefaults(config *CNSConfig) {
 	setTelemetrySettingDefaults(&config.TelemetrySettings)
 	setManagedSettingDefaults(&config.ManagedSettings)
 	setKeyVaultSettingsDefaults(&config.KeyVaultSettings)
 	setAZRSettingsDefaults(&config.AZRSettings)
+	setDNSProxySettingsDefaults(&config.DNSProxySettings)
+	setDNSRegistrationSettingsDefaults(&config.DNSRegistrationSettings)
+	setRouteHealthSettingsDefaults(&config.RouteHealthSettings)
+	setDuplicateAddressDetectionSettingsDefaults(&config.DuplicateAddressDetection)
+	setEndpointHealthSettingsDefaults(&config.EndpointHealthSettings)
+	setWireguardSettingsDefaults(&config.WireguardSettings)
+	setVxlanSettingsDefaults(&config.VxlanSettings)
+	setSelfTestSettingsDefaults(&config.SelfTestSettings)
+	setNodeConditionsSettingsDefaults(&config.NodeConditionsSettings)
+	setHNSPolicyGCSettingsDefaults(&config.HNSPolicyGCSettings)
+	setHNSReattachSettingsDefaults(&config.HNSReattachSettings)
 
 	if config.ChannelMode == "" {
 		config.ChannelMode = cns.Direct
@@ -244,7 +543,7 @@ func SetCNSConfigDefaults(config *CNSConfig) {
 	config.WatchPods = config.EnableIPAMv2 || config.EnableSwiftV2
 }
 
-// isStalessCNIMode verify if the CNI is running stateless mode
-func (cnsconfig *CNSConfig) IsStalessCNIWindows() bool {
-	return !cnsconfig.InitializeFromCNI && cnsconfig.ManageEndpointState && runtime.GOOS == "windows"
+// IsStatelessCNI verifies if the CNI is running in stateless mode, with CNS owning the endpoint state
+func (cnsconfig *CNSConfig) IsStatelessCNI() bool {
+	return !cnsconfig.InitializeFromCNI && cnsconfig.ManageEndpointState
 }
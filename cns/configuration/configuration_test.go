@@ -215,8 +215,63 @@ func TestSetCNSConfigDefaults(t *testing.T) {
 				AZRSettings: AZRSettings{
 					PopulateHomeAzCacheRetryIntervalSecs: 60,
 				},
+				DNSProxySettings: DNSProxySettings{
+					ListenAddress:     "169.254.128.1",
+					ListenPort:        53,
+					CacheSize:         4096,
+					UpstreamTimeoutMs: 2000,
+				},
+				DNSRegistrationSettings: DNSRegistrationSettings{
+					TTLSecs:            300,
+					RetryAttempts:      5,
+					RetryDelayMs:       1000,
+					ResyncIntervalSecs: 600,
+				},
 				WireserverIP:       "168.63.129.16",
 				AsyncPodDeletePath: "/var/run/azure-vnet/deleteIDs",
+				WireguardSettings: WireguardSettings{
+					InterfaceName:         "azwg0",
+					ListenPort:            51820,
+					MTU:                   1420,
+					PrivateKeyPath:        "/var/lib/azure-cns/wireguard.key",
+					ReconcileIntervalSecs: 30,
+				},
+				VxlanSettings: VxlanSettings{
+					InterfaceName:         "azvxlan",
+					ReconcileIntervalSecs: 30,
+				},
+				SelfTestSettings: SelfTestSettings{
+					TimeoutSecs:       10,
+					RetryIntervalSecs: 30,
+					HNSNetworkName:    "azure",
+				},
+				NodeConditionsSettings: NodeConditionsSettings{
+					IntervalSecs:     10,
+					FailureThreshold: 3,
+					SuccessThreshold: 1,
+				},
+				HNSPolicyGCSettings: HNSPolicyGCSettings{
+					IntervalSecs: 300,
+				},
+				HNSReattachSettings: HNSReattachSettings{
+					IntervalSecs: 30,
+				},
+				EndpointHealthSettings: EndpointHealthSettings{
+					IntervalSecs:      30,
+					PingTimeoutMs:     1000,
+					FailureThreshold:  3,
+					RecoveryThreshold: 2,
+				},
+				DuplicateAddressDetection: DuplicateAddressDetectionSettings{
+					ProbeTimeoutMs: 200,
+					QuarantineSecs: 600,
+				},
+				RouteHealthSettings: RouteHealthSettings{
+					IntervalSecs:      5,
+					ProbeTimeoutMs:    1000,
+					FailureThreshold:  3,
+					RecoveryThreshold: 3,
+				},
 				GRPCSettings: GRPCSettings{
 					Enable:    false,
 					IPAddress: "localhost",
@@ -248,6 +303,75 @@ func TestSetCNSConfigDefaults(t *testing.T) {
 				AZRSettings: AZRSettings{
 					PopulateHomeAzCacheRetryIntervalSecs: 10,
 				},
+				DNSProxySettings: DNSProxySettings{
+					Enable:            true,
+					ListenAddress:     "169.254.0.1",
+					ListenPort:        5353,
+					CacheSize:         10,
+					UpstreamTimeoutMs: 100,
+				},
+				DNSRegistrationSettings: DNSRegistrationSettings{
+					Enable:             true,
+					Backend:            "RFC2136",
+					TTLSecs:            60,
+					RetryAttempts:      2,
+					RetryDelayMs:       10,
+					ResyncIntervalSecs: 30,
+				},
+				WireguardSettings: WireguardSettings{
+					Enable:                true,
+					InterfaceName:         "wg1",
+					ListenPort:            51821,
+					MTU:                   1380,
+					PrivateKeyPath:        "/etc/wg.key",
+					ReconcileIntervalSecs: 5,
+				},
+				VxlanSettings: VxlanSettings{
+					Enable:                true,
+					InterfaceName:         "vxlan1",
+					ReconcileIntervalSecs: 5,
+				},
+				SelfTestSettings: SelfTestSettings{
+					Enable:            true,
+					TimeoutSecs:       5,
+					RetryIntervalSecs: 10,
+					HNSNetworkName:    "l2bridge",
+				},
+				NodeConditionsSettings: NodeConditionsSettings{
+					IntervalSecs:     10,
+					FailureThreshold: 3,
+					SuccessThreshold: 1,
+				},
+				HNSPolicyGCSettings: HNSPolicyGCSettings{
+					Enable:       true,
+					IntervalSecs: 60,
+				},
+				HNSReattachSettings: HNSReattachSettings{
+					Enable:       true,
+					IntervalSecs: 10,
+				},
+				EndpointHealthSettings: EndpointHealthSettings{
+					Enable:            true,
+					IntervalSecs:      10,
+					PingTimeoutMs:     500,
+					FailureThreshold:  2,
+					RecoveryThreshold: 1,
+					Checks:            []string{"routes"},
+					Repair:            true,
+					EvictAfterRepairs: 3,
+				},
+				DuplicateAddressDetection: DuplicateAddressDetectionSettings{
+					Enable:         true,
+					ProbeTimeoutMs: 100,
+					QuarantineSecs: 60,
+				},
+				RouteHealthSettings: RouteHealthSettings{
+					Enable:            true,
+					IntervalSecs:      1,
+					ProbeTimeoutMs:    200,
+					FailureThreshold:  5,
+					RecoveryThreshold: 4,
+				},
 				GRPCSettings: GRPCSettings{
 					Enable:    false,
 					IPAddress: "192.168.1.1",
@@ -278,6 +402,75 @@ func TestSetCNSConfigDefaults(t *testing.T) {
 				},
 				WireserverIP:       "168.63.129.16",
 				AsyncPodDeletePath: "/var/run/azure-vnet/deleteIDs",
+				DNSProxySettings: DNSProxySettings{
+					Enable:            true,
+					ListenAddress:     "169.254.0.1",
+					ListenPort:        5353,
+					CacheSize:         10,
+					UpstreamTimeoutMs: 100,
+				},
+				DNSRegistrationSettings: DNSRegistrationSettings{
+					Enable:             true,
+					Backend:            "RFC2136",
+					TTLSecs:            60,
+					RetryAttempts:      2,
+					RetryDelayMs:       10,
+					ResyncIntervalSecs: 30,
+				},
+				WireguardSettings: WireguardSettings{
+					Enable:                true,
+					InterfaceName:         "wg1",
+					ListenPort:            51821,
+					MTU:                   1380,
+					PrivateKeyPath:        "/etc/wg.key",
+					ReconcileIntervalSecs: 5,
+				},
+				VxlanSettings: VxlanSettings{
+					Enable:                true,
+					InterfaceName:         "vxlan1",
+					ReconcileIntervalSecs: 5,
+				},
+				SelfTestSettings: SelfTestSettings{
+					Enable:            true,
+					TimeoutSecs:       5,
+					RetryIntervalSecs: 10,
+					HNSNetworkName:    "l2bridge",
+				},
+				NodeConditionsSettings: NodeConditionsSettings{
+					IntervalSecs:     10,
+					FailureThreshold: 3,
+					SuccessThreshold: 1,
+				},
+				HNSPolicyGCSettings: HNSPolicyGCSettings{
+					Enable:       true,
+					IntervalSecs: 60,
+				},
+				HNSReattachSettings: HNSReattachSettings{
+					Enable:       true,
+					IntervalSecs: 10,
+				},
+				EndpointHealthSettings: EndpointHealthSettings{
+					Enable:            true,
+					IntervalSecs:      10,
+					PingTimeoutMs:     500,
+					FailureThreshold:  2,
+					RecoveryThreshold: 1,
+					Checks:            []string{"routes"},
+					Repair:            true,
+					EvictAfterRepairs: 3,
+				},
+				DuplicateAddressDetection: DuplicateAddressDetectionSettings{
+					Enable:         true,
+					ProbeTimeoutMs: 100,
+					QuarantineSecs: 60,
+				},
+				RouteHealthSettings: RouteHealthSettings{
+					Enable:            true,
+					IntervalSecs:      1,
+					ProbeTimeoutMs:    200,
+					FailureThreshold:  5,
+					RecoveryThreshold: 4,
+				},
 				GRPCSettings: GRPCSettings{
 					Enable:    false,
 					IPAddress: "192.168.1.1",
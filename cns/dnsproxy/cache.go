@@ -0,0 +1,161 @@
+package dnsproxy
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type cacheKey struct {
+	tenant string
+	name   string
+	qtype  dnsmessage.Type
+	class  dnsmessage.Class
+}
+
+func newCacheKey(tenant string, q dnsmessage.Question) cacheKey {
+	return cacheKey{
+		tenant: tenant,
+		name:   strings.ToLower(q.Name.String()),
+		qtype:  q.Type,
+		class:  q.Class,
+	}
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	response dnsmessage.Message
+	stored   time.Time
+	expires  time.Time
+}
+
+// cache is an LRU cache of DNS responses, partitioned by tenant. Entries expire with the smallest TTL in the response.
+type cache struct {
+	sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached response for key with its ID set to id and TTLs reduced by the time spent in the cache.
+func (c *cache) get(key cacheKey, id uint16) ([]byte, bool) {
+	c.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.Unlock()
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry) //nolint:forcetypeassert // only entries are stored
+	now := c.now()
+	if !now.Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		c.Unlock()
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	response := copyMessage(entry.response)
+	age := uint32(now.Sub(entry.stored).Seconds())
+	c.Unlock()
+
+	response.ID = id
+	for _, section := range [][]dnsmessage.Resource{response.Answers, response.Authorities, response.Additionals} {
+		for i := range section {
+			if section[i].Header.Type == dnsmessage.TypeOPT {
+				continue
+			}
+			section[i].Header.TTL -= min(age, section[i].Header.TTL)
+		}
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		return nil, false
+	}
+	return packed, true
+}
+
+// put caches a successful or negative response, other responses are not cached.
+func (c *cache) put(key cacheKey, packed []byte) {
+	if c.size <= 0 {
+		return
+	}
+
+	var response dnsmessage.Message
+	if err := response.Unpack(packed); err != nil {
+		return
+	}
+	if response.Truncated || (response.RCode != dnsmessage.RCodeSuccess && response.RCode != dnsmessage.RCodeNameError) {
+		return
+	}
+
+	ttl, ok := minTTL(response)
+	if !ok || ttl == 0 {
+		return
+	}
+
+	now := c.now()
+	entry := &cacheEntry{
+		key:      key,
+		response: response,
+		stored:   now,
+		expires:  now.Add(time.Duration(ttl) * time.Second),
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key) //nolint:forcetypeassert // only entries are stored
+	}
+}
+
+// minTTL returns the smallest TTL of the answer and authority records. A response without records has no TTL and
+// is not cached.
+func minTTL(m dnsmessage.Message) (uint32, bool) {
+	var (
+		ttl   uint32
+		found bool
+	)
+	for _, section := range [][]dnsmessage.Resource{m.Answers, m.Authorities} {
+		for i := range section {
+			if !found || section[i].Header.TTL < ttl {
+				ttl = section[i].Header.TTL
+				found = true
+			}
+		}
+	}
+	return ttl, found
+}
+
+// copyMessage copies the record slices of m so that TTLs can be adjusted without touching the cached message.
+func copyMessage(m dnsmessage.Message) dnsmessage.Message {
+	m.Questions = append([]dnsmessage.Question(nil), m.Questions...)
+	m.Answers = append([]dnsmessage.Resource(nil), m.Answers...)
+	m.Authorities = append([]dnsmessage.Resource(nil), m.Authorities...)
+	m.Additionals = append([]dnsmessage.Resource(nil), m.Additionals...)
+	return m
+}
@@ -0,0 +1,94 @@
+package dnsproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func newCacheTestKey(tenant, name string) cacheKey {
+	return newCacheKey(tenant, dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+}
+
+func TestCachePartitionedByTenant(t *testing.T) {
+	c := newCache(10)
+	response, err := answer(newQuery(t, 1, "example.com."), 300)
+	require.NoError(t, err)
+
+	c.put(newCacheTestKey("nc1", "example.com."), response)
+
+	_, ok := c.get(newCacheTestKey("nc1", "example.com."), 1)
+	assert.True(t, ok)
+	_, ok = c.get(newCacheTestKey("nc2", "example.com."), 1)
+	assert.False(t, ok)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCache(2)
+	for _, name := range []string{"a.com.", "b.com."} {
+		response, err := answer(newQuery(t, 1, name), 300)
+		require.NoError(t, err)
+		c.put(newCacheTestKey("nc", name), response)
+	}
+
+	// touch a so that b is the oldest
+	_, ok := c.get(newCacheTestKey("nc", "a.com."), 1)
+	require.True(t, ok)
+
+	response, err := answer(newQuery(t, 1, "c.com."), 300)
+	require.NoError(t, err)
+	c.put(newCacheTestKey("nc", "c.com."), response)
+
+	_, ok = c.get(newCacheTestKey("nc", "a.com."), 1)
+	assert.True(t, ok)
+	_, ok = c.get(newCacheTestKey("nc", "b.com."), 1)
+	assert.False(t, ok)
+}
+
+func TestCacheSkipsUncacheableResponses(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		mutate func(*dnsmessage.Message)
+	}{
+		{
+			name:   "server failure",
+			mutate: func(m *dnsmessage.Message) { m.RCode = dnsmessage.RCodeServerFailure },
+		},
+		{
+			name:   "truncated",
+			mutate: func(m *dnsmessage.Message) { m.Truncated = true },
+		},
+		{
+			name:   "no records",
+			mutate: func(m *dnsmessage.Message) { m.Answers = nil },
+		},
+		{
+			name:   "zero ttl",
+			mutate: func(m *dnsmessage.Message) { m.Answers[0].Header.TTL = 0 },
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCache(10)
+			c.now = func() time.Time { return now }
+
+			packed, err := answer(newQuery(t, 1, "example.com."), 300)
+			require.NoError(t, err)
+			msg := unpack(t, packed)
+			tt.mutate(&msg)
+			packed, err = msg.Pack()
+			require.NoError(t, err)
+
+			key := newCacheTestKey("nc", "example.com.")
+			c.put(key, packed)
+			_, ok := c.get(key, 1)
+			assert.False(t, ok)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package dnsproxy
+
+import (
+	"net/netip"
+	"strconv"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/network/snat"
+	goiptables "github.com/coreos/go-iptables/iptables"
+	"github.com/pkg/errors"
+)
+
+type interceptRule struct {
+	table string
+	chain string
+	spec  []string
+	// prepend inserts the rule at the top of the chain instead of appending it
+	prepend bool
+}
+
+// interceptRules redirect DNS traffic which tenant pods route to Azure DNS through the snat bridge to the proxy,
+// and accept it on the host. The redirect is appended so that the per-endpoint RETURN exceptions which CNI inserts
+// for pods that must reach Azure DNS directly are evaluated first.
+func interceptRules(listen netip.AddrPort) []interceptRule {
+	var rules []interceptRule
+	for _, protocol := range []string{iptables.UDP, iptables.TCP} {
+		rules = append(rules,
+			interceptRule{
+				table: iptables.Nat,
+				chain: iptables.Prerouting,
+				spec: []string{
+					"-i", snat.SnatBridgeName, "-d", networkutils.AzureDNS, "-p", protocol, "--dport", strconv.Itoa(iptables.DNSPort),
+					"-j", "DNAT", "--to-destination", listen.String(),
+				},
+			},
+			interceptRule{
+				table: iptables.Filter,
+				chain: iptables.Input,
+				spec: []string{
+					"-i", snat.SnatBridgeName, "-d", listen.Addr().String(), "-p", protocol, "--dport", strconv.Itoa(int(listen.Port())),
+					"-j", iptables.Accept,
+				},
+				prepend: true,
+			},
+		)
+	}
+	return rules
+}
+
+func addInterception(listen netip.AddrPort) error {
+	ipt, err := goiptables.New()
+	if err != nil {
+		return errors.Wrap(err, "failed to create iptables client")
+	}
+
+	for _, rule := range interceptRules(listen) {
+		exists, err := ipt.Exists(rule.table, rule.chain, rule.spec...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check for dns interception rule in %s %s", rule.table, rule.chain)
+		}
+		if exists {
+			continue
+		}
+		if rule.prepend {
+			err = ipt.Insert(rule.table, rule.chain, 1, rule.spec...)
+		} else {
+			err = ipt.Append(rule.table, rule.chain, rule.spec...)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to add dns interception rule in %s %s", rule.table, rule.chain)
+		}
+	}
+	return nil
+}
+
+// removeInterception lets tenant DNS traffic fall back to SNAT through the host while the proxy is not running.
+func removeInterception(listen netip.AddrPort) error {
+	ipt, err := goiptables.New()
+	if err != nil {
+		return errors.Wrap(err, "failed to create iptables client")
+	}
+
+	for _, rule := range interceptRules(listen) {
+		if err := ipt.DeleteIfExists(rule.table, rule.chain, rule.spec...); err != nil {
+			return errors.Wrapf(err, "failed to delete dns interception rule in %s %s", rule.table, rule.chain)
+		}
+	}
+	return nil
+}
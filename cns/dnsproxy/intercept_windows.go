@@ -0,0 +1,13 @@
+package dnsproxy
+
+import (
+	"net/netip"
+)
+
+func addInterception(netip.AddrPort) error {
+	return ErrInterceptionNotSupported
+}
+
+func removeInterception(netip.AddrPort) error {
+	return nil
+}
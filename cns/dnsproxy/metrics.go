@@ -0,0 +1,37 @@
+package dnsproxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	tenantLabel = "tenant"
+	resultLabel = "result"
+)
+
+var (
+	queryCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dns_proxy_queries_total",
+			Help: "Count of DNS queries handled by the DNS proxy by tenant and result.",
+		},
+		[]string{tenantLabel, resultLabel},
+	)
+	upstreamLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "dns_proxy_upstream_latency_seconds",
+			Help: "Latency of DNS queries forwarded to tenant resolvers in seconds.",
+			//nolint:gomnd // default bucket consts
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12), // 1 ms to ~2 seconds
+		},
+		[]string{tenantLabel},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		queryCount,
+		upstreamLatency,
+	)
+}
@@ -0,0 +1,334 @@
+// Package dnsproxy implements a local DNS proxy for multitenant pods. Tenant pods reach the proxy on the snat bridge
+// address and each query is forwarded to the resolvers of the network container the query came from, which replaces
+// SNATing tenant DNS traffic to the host.
+package dnsproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxMessageSize is the largest DNS message which can be carried over UDP or TCP.
+	maxMessageSize = 65535
+	// tcpIdleTimeout bounds how long a TCP client connection may sit idle between queries.
+	tcpIdleTimeout = 10 * time.Second
+)
+
+// Query results recorded in metrics.
+const (
+	resultCacheHit      = "cache_hit"
+	resultForwarded     = "forwarded"
+	resultRefused       = "refused"
+	resultUpstreamError = "upstream_error"
+)
+
+var errNoResolvers = errors.New("tenant has no resolvers")
+
+// ErrInterceptionNotSupported is returned by Run on platforms where the tenant DNS traffic can't be intercepted.
+var ErrInterceptionNotSupported = errors.New("dns interception is not supported on this platform")
+
+// Tenant is a network container whose pods send DNS queries to the proxy.
+type Tenant struct {
+	// ID of the network container, used to partition the cache and label metrics.
+	ID string
+	// Resolvers the tenant's queries are forwarded to, tried in order.
+	Resolvers []netip.AddrPort
+}
+
+// TenantLookup returns the tenant owning the source address of a query.
+type TenantLookup interface {
+	DNSTenant(source netip.Addr) (Tenant, bool)
+}
+
+// Config of the proxy.
+type Config struct {
+	ListenAddress   netip.AddrPort
+	CacheSize       int
+	UpstreamTimeout time.Duration
+}
+
+// Proxy answers tenant DNS queries on the snat bridge address.
+type Proxy struct {
+	cfg     Config
+	tenants TenantLookup
+	cache   *cache
+	log     *zap.Logger
+	// exchange sends a query to a resolver and returns the response, swapped out in tests.
+	exchange func(ctx context.Context, network string, resolver netip.AddrPort, query []byte) ([]byte, error)
+}
+
+// New creates a proxy which routes queries to the tenants returned by tenants.
+func New(cfg Config, tenants TenantLookup, logger *zap.Logger) *Proxy {
+	return &Proxy{
+		cfg:      cfg,
+		tenants:  tenants,
+		cache:    newCache(cfg.CacheSize),
+		log:      logger,
+		exchange: exchange,
+	}
+}
+
+// Run serves queries over UDP and TCP until ctx is cancelled. Interception of tenant DNS traffic is set up before
+// serving and removed when Run returns.
+func (p *Proxy) Run(ctx context.Context) error {
+	addr := p.cfg.ListenAddress.String()
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on udp %s", addr)
+	}
+	defer pc.Close()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on tcp %s", addr)
+	}
+	defer ln.Close()
+
+	if err := addInterception(p.cfg.ListenAddress); err != nil {
+		return errors.Wrap(err, "failed to intercept tenant dns traffic")
+	}
+	defer func() {
+		if err := removeInterception(p.cfg.ListenAddress); err != nil {
+			p.log.Error("failed to remove dns interception", zap.Error(err))
+		}
+	}()
+
+	p.log.Info("dns proxy listening", zap.String("address", addr))
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		<-ctx.Done()
+		pc.Close()
+		ln.Close()
+		return nil
+	})
+	g.Go(func() error {
+		return p.serveUDP(ctx, pc)
+	})
+	g.Go(func() error {
+		return p.serveTCP(ctx, ln)
+	})
+
+	if err := g.Wait(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Proxy) serveUDP(ctx context.Context, pc net.PacketConn) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to read udp query")
+		}
+
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func(addr net.Addr) {
+			source := addr.(*net.UDPAddr).AddrPort().Addr().Unmap() //nolint:forcetypeassert // udp conns return udp addrs
+			if response := p.handle(ctx, "udp", source, query); response != nil {
+				if _, err := pc.WriteTo(response, addr); err != nil {
+					p.log.Error("failed to write udp response", zap.Stringer("client", addr), zap.Error(err))
+				}
+			}
+		}(addr)
+	}
+}
+
+func (p *Proxy) serveTCP(ctx context.Context, ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to accept tcp connection")
+		}
+
+		go func() {
+			defer conn.Close()
+			source := conn.RemoteAddr().(*net.TCPAddr).AddrPort().Addr().Unmap() //nolint:forcetypeassert // tcp conns return tcp addrs
+			for {
+				_ = conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+
+				response := p.handle(ctx, "tcp", source, query)
+				if response == nil {
+					return
+				}
+
+				if err := writeTCPMessage(conn, response); err != nil {
+					p.log.Error("failed to write tcp response", zap.Stringer("client", conn.RemoteAddr()), zap.Error(err))
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle answers a single query from source. It returns nil when the query can't be parsed and should be dropped.
+func (p *Proxy) handle(ctx context.Context, network string, source netip.Addr, query []byte) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		p.log.Debug("dropping malformed dns query", zap.Stringer("source", source), zap.Error(err))
+		return nil
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		p.log.Debug("dropping malformed dns query", zap.Stringer("source", source), zap.Error(err))
+		return nil
+	}
+
+	tenant, ok := p.tenants.DNSTenant(source)
+	if !ok {
+		// only tenant pods may use the proxy, anything else would make it an open resolver on the bridge
+		queryCount.WithLabelValues("", resultRefused).Inc()
+		return errorResponse(header, questions, dnsmessage.RCodeRefused)
+	}
+
+	var key cacheKey
+	cacheable := len(questions) == 1
+	if cacheable {
+		key = newCacheKey(tenant.ID, questions[0])
+		if response, ok := p.cache.get(key, header.ID); ok {
+			queryCount.WithLabelValues(tenant.ID, resultCacheHit).Inc()
+			return response
+		}
+	}
+
+	response, err := p.forward(ctx, network, tenant, query)
+	if err != nil {
+		p.log.Error("failed to forward dns query", zap.String("tenant", tenant.ID), zap.Error(err))
+		queryCount.WithLabelValues(tenant.ID, resultUpstreamError).Inc()
+		return errorResponse(header, questions, dnsmessage.RCodeServerFailure)
+	}
+
+	queryCount.WithLabelValues(tenant.ID, resultForwarded).Inc()
+	if cacheable {
+		p.cache.put(key, response)
+	}
+	return response
+}
+
+// forward sends the query to the tenant's resolvers in order and returns the first response.
+func (p *Proxy) forward(ctx context.Context, network string, tenant Tenant, query []byte) ([]byte, error) {
+	if len(tenant.Resolvers) == 0 {
+		return nil, errors.Wrap(errNoResolvers, tenant.ID)
+	}
+
+	var err error
+	for _, resolver := range tenant.Resolvers {
+		start := time.Now()
+		exchangeCtx, cancel := context.WithTimeout(ctx, p.cfg.UpstreamTimeout)
+		var response []byte
+		response, err = p.exchange(exchangeCtx, network, resolver, query)
+		cancel()
+		upstreamLatency.WithLabelValues(tenant.ID).Observe(time.Since(start).Seconds())
+		if err == nil {
+			return response, nil
+		}
+		p.log.Debug("dns resolver failed", zap.String("tenant", tenant.ID), zap.Stringer("resolver", resolver), zap.Error(err))
+	}
+
+	return nil, err
+}
+
+// exchange sends the query to the resolver over network and waits for the response with the same ID.
+func exchange(ctx context.Context, network string, resolver netip.AddrPort, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, resolver.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial resolver %s", resolver)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, errors.Wrapf(err, "failed to send query to resolver %s", resolver)
+		}
+		response, err := readTCPMessage(conn)
+		return response, errors.Wrapf(err, "failed to read response from resolver %s", resolver)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, errors.Wrapf(err, "failed to send query to resolver %s", resolver)
+	}
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read response from resolver %s", resolver)
+		}
+		// ignore stray responses to earlier queries
+		if n >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// errorResponse builds a response with rcode to the query with header and questions.
+func errorResponse(header dnsmessage.Header, questions []dnsmessage.Question, rcode dnsmessage.RCode) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil
+		}
+	}
+	response, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, errors.Wrap(err, "failed to read message length")
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errors.Wrap(err, "failed to read message")
+	}
+	return msg, nil
+}
+
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2, 2+len(msg)) //nolint:gomnd // length prefix
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return errors.Wrap(err, "failed to write message")
+}
@@ -0,0 +1,153 @@
+package dnsproxy
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	tenantSource   = netip.MustParseAddr("169.254.128.10")
+	tenantResolver = netip.MustParseAddrPort("10.0.0.10:53")
+	backupResolver = netip.MustParseAddrPort("10.0.0.11:53")
+)
+
+type fakeTenants map[netip.Addr]Tenant
+
+func (f fakeTenants) DNSTenant(source netip.Addr) (Tenant, bool) {
+	t, ok := f[source]
+	return t, ok
+}
+
+func newQuery(t *testing.T, id uint16, name string) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+	}
+	query, err := msg.Pack()
+	require.NoError(t, err)
+	return query
+}
+
+// answer responds to query with a single A record with ttl.
+func answer(query []byte, ttl uint32) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, errors.Wrap(err, "failed to unpack query")
+	}
+	msg.Response = true
+	msg.Answers = []dnsmessage.Resource{
+		{
+			Header: dnsmessage.ResourceHeader{Name: msg.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: [4]byte{10, 1, 2, 3}},
+		},
+	}
+	response, err := msg.Pack()
+	return response, errors.Wrap(err, "failed to pack response")
+}
+
+func unpack(t *testing.T, response []byte) dnsmessage.Message {
+	t.Helper()
+	var msg dnsmessage.Message
+	require.NoError(t, msg.Unpack(response))
+	return msg
+}
+
+func newTestProxy(resolvers ...netip.AddrPort) *Proxy {
+	return New(Config{
+		CacheSize:       10,
+		UpstreamTimeout: time.Second,
+	}, fakeTenants{tenantSource: {ID: "nc", Resolvers: resolvers}}, zap.NewNop())
+}
+
+func TestHandleForwardsToTenantResolver(t *testing.T) {
+	p := newTestProxy(tenantResolver)
+	var got []netip.AddrPort
+	p.exchange = func(_ context.Context, network string, resolver netip.AddrPort, query []byte) ([]byte, error) {
+		assert.Equal(t, "udp", network)
+		got = append(got, resolver)
+		return answer(query, 300)
+	}
+
+	response := unpack(t, p.handle(context.Background(), "udp", tenantSource, newQuery(t, 1, "example.com.")))
+	assert.Equal(t, uint16(1), response.ID)
+	assert.Equal(t, dnsmessage.RCodeSuccess, response.RCode)
+	require.Len(t, response.Answers, 1)
+	assert.Equal(t, []netip.AddrPort{tenantResolver}, got)
+}
+
+func TestHandleServesFromCache(t *testing.T) {
+	p := newTestProxy(tenantResolver)
+	now := time.Now()
+	p.cache.now = func() time.Time { return now }
+	calls := 0
+	p.exchange = func(_ context.Context, _ string, _ netip.AddrPort, query []byte) ([]byte, error) {
+		calls++
+		return answer(query, 300)
+	}
+
+	p.handle(context.Background(), "udp", tenantSource, newQuery(t, 1, "example.com."))
+
+	now = now.Add(100 * time.Second)
+	response := unpack(t, p.handle(context.Background(), "udp", tenantSource, newQuery(t, 2, "EXAMPLE.com.")))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, uint16(2), response.ID)
+	require.Len(t, response.Answers, 1)
+	assert.Equal(t, uint32(200), response.Answers[0].Header.TTL)
+
+	// expired entries are fetched again
+	now = now.Add(200 * time.Second)
+	p.handle(context.Background(), "udp", tenantSource, newQuery(t, 3, "example.com."))
+	assert.Equal(t, 2, calls)
+}
+
+func TestHandleFallsBackToNextResolver(t *testing.T) {
+	p := newTestProxy(tenantResolver, backupResolver)
+	p.exchange = func(_ context.Context, _ string, resolver netip.AddrPort, query []byte) ([]byte, error) {
+		if resolver == tenantResolver {
+			return nil, errors.New("timeout")
+		}
+		return answer(query, 300)
+	}
+
+	response := unpack(t, p.handle(context.Background(), "udp", tenantSource, newQuery(t, 1, "example.com.")))
+	assert.Equal(t, dnsmessage.RCodeSuccess, response.RCode)
+}
+
+func TestHandleUpstreamFailure(t *testing.T) {
+	p := newTestProxy(tenantResolver)
+	p.exchange = func(context.Context, string, netip.AddrPort, []byte) ([]byte, error) {
+		return nil, errors.New("timeout")
+	}
+
+	response := unpack(t, p.handle(context.Background(), "udp", tenantSource, newQuery(t, 1, "example.com.")))
+	assert.Equal(t, uint16(1), response.ID)
+	assert.Equal(t, dnsmessage.RCodeServerFailure, response.RCode)
+	require.Len(t, response.Questions, 1)
+}
+
+func TestHandleRefusesUnknownSource(t *testing.T) {
+	p := newTestProxy(tenantResolver)
+	p.exchange = func(context.Context, string, netip.AddrPort, []byte) ([]byte, error) {
+		t.Fatal("query from unknown source must not be forwarded")
+		return nil, nil
+	}
+
+	response := unpack(t, p.handle(context.Background(), "udp", netip.MustParseAddr("169.254.128.99"), newQuery(t, 1, "example.com.")))
+	assert.Equal(t, dnsmessage.RCodeRefused, response.RCode)
+}
+
+func TestHandleDropsMalformedQuery(t *testing.T) {
+	p := newTestProxy(tenantResolver)
+	assert.Nil(t, p.handle(context.Background(), "udp", tenantSource, []byte{0x01}))
+}
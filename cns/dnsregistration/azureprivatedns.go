@@ -0,0 +1,150 @@
+package dnsregistration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultResourceManagerEndpoint is the resource manager of the public cloud.
+	DefaultResourceManagerEndpoint = "https://management.azure.com"
+	privateDNSAPIVersion           = "2020-06-01"
+	// createdByMetadata marks the record sets registered by CNS.
+	createdByMetadata = "azure-cns"
+)
+
+var errRecordSetRequest = errors.New("private dns record set request failed")
+
+// AzurePrivateDNSConfig locates the private dns zones of the records.
+type AzurePrivateDNSConfig struct {
+	SubscriptionID string
+	ResourceGroup  string
+	// ResourceManagerEndpoint is the resource manager of the cloud of the zones, DefaultResourceManagerEndpoint if empty.
+	ResourceManagerEndpoint string
+}
+
+// AzurePrivateDNS registers the records in Azure Private DNS zones through the resource manager.
+type AzurePrivateDNS struct {
+	cfg    AzurePrivateDNSConfig
+	cred   azcore.TokenCredential
+	client *http.Client
+}
+
+// NewAzurePrivateDNS creates a backend updating the zones in cfg with the identity of cred, which needs the Private DNS
+// Zone Contributor role on them.
+func NewAzurePrivateDNS(cfg AzurePrivateDNSConfig, cred azcore.TokenCredential) *AzurePrivateDNS {
+	if cfg.ResourceManagerEndpoint == "" {
+		cfg.ResourceManagerEndpoint = DefaultResourceManagerEndpoint
+	}
+	return &AzurePrivateDNS{cfg: cfg, cred: cred, client: &http.Client{Timeout: time.Minute}}
+}
+
+type recordSet struct {
+	Properties recordSetProperties `json:"properties"`
+}
+
+type recordSetProperties struct {
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	TTL         int64             `json:"ttl"`
+	ARecords    []aRecord         `json:"aRecords,omitempty"`
+	AAAARecords []aaaaRecord      `json:"aaaaRecords,omitempty"`
+	PTRRecords  []ptrRecord       `json:"ptrRecords,omitempty"`
+}
+
+type aRecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type aaaaRecord struct {
+	IPv6Address string `json:"ipv6Address"`
+}
+
+type ptrRecord struct {
+	PTRDName string `json:"ptrdname"`
+}
+
+// SetRecords creates or replaces the record set.
+func (b *AzurePrivateDNS) SetRecords(ctx context.Context, zone, name string, rrType RecordType, values []string, ttl time.Duration) error {
+	props := recordSetProperties{
+		Metadata: map[string]string{"createdBy": createdByMetadata},
+		TTL:      int64(ttl.Seconds()),
+	}
+	for _, value := range values {
+		switch rrType {
+		case A:
+			props.ARecords = append(props.ARecords, aRecord{IPv4Address: value})
+		case AAAA:
+			props.AAAARecords = append(props.AAAARecords, aaaaRecord{IPv6Address: value})
+		case PTR:
+			props.PTRRecords = append(props.PTRRecords, ptrRecord{PTRDName: strings.TrimSuffix(value, ".") + "."})
+		default:
+			return errors.Wrapf(errUnexpectedType, "%s", rrType)
+		}
+	}
+	body, err := json.Marshal(recordSet{Properties: props})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal record set")
+	}
+	return b.do(ctx, http.MethodPut, zone, name, rrType, body)
+}
+
+// DeleteRecords deletes the record set, which the resource manager ignores if it doesn't exist.
+func (b *AzurePrivateDNS) DeleteRecords(ctx context.Context, zone, name string, rrType RecordType) error {
+	return b.do(ctx, http.MethodDelete, zone, name, rrType, nil)
+}
+
+func (b *AzurePrivateDNS) do(ctx context.Context, method, zone, name string, rrType RecordType, body []byte) error {
+	token, err := b.cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{b.cfg.ResourceManagerEndpoint + "/.default"}})
+	if err != nil {
+		return errors.Wrap(err, "failed to get resource manager token")
+	}
+
+	u := b.recordSetURL(zone, name, rrType)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to %s record set %s", method, u)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		if method == http.MethodDelete {
+			return nil
+		}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096)) //nolint:gomnd // enough of the error to log
+	return errors.Wrapf(errRecordSetRequest, "%s %s: %d %s", method, u, resp.StatusCode, msg)
+}
+
+// recordSetURL returns the resource of the record set, named relative to its zone.
+func (b *AzurePrivateDNS) recordSetURL(zone, name string, rrType RecordType) string {
+	zone = strings.TrimSuffix(zone, ".")
+	relative := strings.TrimSuffix(strings.TrimSuffix(name, "."), "."+zone)
+	if relative == zone {
+		relative = "@"
+	}
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/privateDnsZones/%s/%s/%s?api-version=%s",
+		strings.TrimSuffix(b.cfg.ResourceManagerEndpoint, "/"), url.PathEscape(b.cfg.SubscriptionID), url.PathEscape(b.cfg.ResourceGroup),
+		url.PathEscape(zone), rrType, url.PathEscape(relative), privateDNSAPIVersion)
+}
@@ -0,0 +1,62 @@
+package dnsregistration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestAzurePrivateDNSSetRecords(t *testing.T) {
+	var got recordSet
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/privateDnsZones/10.in-addr.arpa/PTR/5.0.0",
+			r.URL.Path)
+		assert.Equal(t, privateDNSAPIVersion, r.URL.Query().Get("api-version"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	b := NewAzurePrivateDNS(AzurePrivateDNSConfig{SubscriptionID: "sub", ResourceGroup: "rg", ResourceManagerEndpoint: srv.URL}, fakeCredential{})
+	err := b.SetRecords(context.Background(), "10.in-addr.arpa", "5.0.0.10.in-addr.arpa", PTR, []string{"web.default.pods.contoso.internal"},
+		5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, recordSetProperties{
+		Metadata:   map[string]string{"createdBy": createdByMetadata},
+		TTL:        300,
+		PTRRecords: []ptrRecord{{PTRDName: "web.default.pods.contoso.internal."}},
+	}, got.Properties)
+}
+
+func TestAzurePrivateDNSDeleteRecords(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	b := NewAzurePrivateDNS(AzurePrivateDNSConfig{SubscriptionID: "sub", ResourceGroup: "rg", ResourceManagerEndpoint: srv.URL}, fakeCredential{})
+	// a record set which is already gone is deleted
+	require.NoError(t, b.DeleteRecords(context.Background(), "pods.contoso.internal", "web.default.pods.contoso.internal", A))
+
+	status = http.StatusForbidden
+	err := b.DeleteRecords(context.Background(), "pods.contoso.internal", "web.default.pods.contoso.internal", A)
+	require.ErrorIs(t, err, errRecordSetRequest)
+}
@@ -0,0 +1,341 @@
+// Package dnsregistration registers the A/AAAA and PTR records of the pod ips with a DNS server as the endpoints are
+// created and deleted, for networks which audit every address by its forward and reverse records. The records of a
+// pod are <pod>.<namespace>.<zone>, pointing to all its ips, and a PTR record pointing back to it for every ip in one
+// of the reverse zones.
+package dnsregistration
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/avast/retry-go/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// storeKey is the key the registered records are kept under in the store.
+const storeKey = "Registrations"
+
+// RecordType is the type of a record set.
+type RecordType string
+
+const (
+	A    RecordType = "A"
+	AAAA RecordType = "AAAA"
+	PTR  RecordType = "PTR"
+)
+
+// Names of the backends in the CNS configuration.
+const (
+	BackendAzurePrivateDNS = "AzurePrivateDNS"
+	BackendRFC2136         = "RFC2136"
+)
+
+// ErrUnknownBackend is returned for a backend name which is none of the above.
+var ErrUnknownBackend = errors.New("unknown dns registration backend")
+
+// Backend sets and deletes the record sets of a DNS server. Names are fully qualified, without the trailing dot.
+type Backend interface {
+	// SetRecords replaces the record set of the type at name in zone with values.
+	SetRecords(ctx context.Context, zone, name string, rrType RecordType, values []string, ttl time.Duration) error
+	// DeleteRecords deletes the record set of the type at name in zone, a missing record set is not an error.
+	DeleteRecords(ctx context.Context, zone, name string, rrType RecordType) error
+}
+
+// Endpoints follows the endpoint state of CNS.
+type Endpoints interface {
+	WaitEndpointEvents(ctx context.Context, since uint64, timeout time.Duration) (events []restserver.EndpointEvent, last uint64, missed bool)
+	ListEndpoints() map[string]*restserver.EndpointInfo
+}
+
+// Config of the registration.
+type Config struct {
+	// Zone the forward records are registered in.
+	Zone string
+	// ReverseZones the PTR records are registered in, the ips outside of them get no PTR record.
+	ReverseZones []string
+	TTL          time.Duration
+	// RetryAttempts and RetryDelay bound the retries of each update of the server, an endpoint whose records still
+	// fail is registered again on the next resync.
+	RetryAttempts uint
+	RetryDelay    time.Duration
+	// ResyncInterval is the interval between the resyncs of the records with all the endpoints, which register the
+	// endpoints which failed and delete the records of the endpoints deleted while CNS was down.
+	ResyncInterval time.Duration
+}
+
+// Registration is the records registered for an endpoint.
+type Registration struct {
+	Name string       `json:"name"`
+	IPs  []netip.Addr `json:"ips"`
+	// Incomplete is set when some of the records failed, the registration is then retried on resync.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// Registrar keeps the records of the pods in sync with the endpoints.
+type Registrar struct {
+	cfg       Config
+	backend   Backend
+	endpoints Endpoints
+	store     store.KeyValueStore
+	log       *zap.Logger
+	// registered are the records registered for each endpoint, persisted in store so that the records of the
+	// endpoints deleted while CNS was down are deleted after a restart.
+	registered map[string]Registration
+}
+
+// New creates a registrar of the records of endpoints with backend, which keeps the registered records in kvs.
+func New(cfg Config, backend Backend, endpoints Endpoints, kvs store.KeyValueStore, logger *zap.Logger) *Registrar {
+	return &Registrar{
+		cfg:        cfg,
+		backend:    backend,
+		endpoints:  endpoints,
+		store:      kvs,
+		log:        logger,
+		registered: make(map[string]Registration),
+	}
+}
+
+// Run registers the records of all the endpoints, then follows the endpoint events until ctx is cancelled.
+func (r *Registrar) Run(ctx context.Context) error {
+	if err := r.store.Read(storeKey, &r.registered); err != nil && !errors.Is(err, store.ErrKeyNotFound) && !errors.Is(err, store.ErrStoreEmpty) {
+		return errors.Wrap(err, "failed to read registered records")
+	}
+
+	// the events from here on are applied after the resync, which they may repeat
+	_, since, _ := r.endpoints.WaitEndpointEvents(ctx, 0, 0)
+	r.resync(ctx)
+	nextResync := time.Now().Add(r.cfg.ResyncInterval)
+	for {
+		events, last, missed := r.endpoints.WaitEndpointEvents(ctx, since, time.Until(nextResync))
+		if ctx.Err() != nil {
+			return nil
+		}
+		since = last
+		if missed || !time.Now().Before(nextResync) {
+			r.resync(ctx)
+			nextResync = time.Now().Add(r.cfg.ResyncInterval)
+			continue
+		}
+		for i := range events {
+			if err := r.sync(ctx, events[i].EndpointID, events[i].EndpointInfo); err != nil {
+				r.log.Error("Failed to register endpoint records, will retry on resync", zap.String("endpointID", events[i].EndpointID),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// resync registers the records of all the endpoints and deletes the records of the endpoints which are gone.
+func (r *Registrar) resync(ctx context.Context) {
+	endpoints := r.endpoints.ListEndpoints()
+	for endpointID := range r.registered {
+		if _, ok := endpoints[endpointID]; !ok {
+			if err := r.sync(ctx, endpointID, nil); err != nil {
+				r.log.Error("Failed to delete records of stale endpoint", zap.String("endpointID", endpointID), zap.Error(err))
+			}
+		}
+	}
+	for endpointID, endpointInfo := range endpoints {
+		if err := r.sync(ctx, endpointID, endpointInfo); err != nil {
+			r.log.Error("Failed to register endpoint records", zap.String("endpointID", endpointID), zap.Error(err))
+		}
+	}
+}
+
+// sync makes the records registered for the endpoint match its state, a nil state deleting them.
+func (r *Registrar) sync(ctx context.Context, endpointID string, endpointInfo *restserver.EndpointInfo) error {
+	desired := r.registration(endpointInfo)
+	current, registered := r.registered[endpointID]
+	if registered && !current.Incomplete && desired != nil && current.Name == desired.Name && slices.Equal(current.IPs, desired.IPs) {
+		return nil
+	}
+
+	if registered {
+		if err := r.unregister(ctx, endpointID, current); err != nil {
+			return err
+		}
+		delete(r.registered, endpointID)
+		if err := r.save(); err != nil {
+			return err
+		}
+	}
+	if desired == nil {
+		return nil
+	}
+
+	if err := r.register(ctx, *desired); err != nil {
+		// the records set so far are kept track of, so that they are deleted with the endpoint
+		desired.Incomplete = true
+		r.registered[endpointID] = *desired
+		if saveErr := r.save(); saveErr != nil {
+			r.log.Error("Failed to save registered records", zap.Error(saveErr))
+		}
+		return err
+	}
+	r.registered[endpointID] = *desired
+	r.log.Info("Registered endpoint records", zap.String("endpointID", endpointID), zap.String("name", desired.Name),
+		zap.Any("ips", desired.IPs))
+	return r.save()
+}
+
+// register sets the forward records of the registration, and the PTR records of its ips in the reverse zones.
+func (r *Registrar) register(ctx context.Context, reg Registration) error {
+	if err := r.setForwardRecords(ctx, reg); err != nil {
+		return err
+	}
+	for _, ip := range reg.IPs {
+		zone, ok := r.reverseZone(ip)
+		if !ok {
+			continue
+		}
+		if err := r.retry(ctx, func() error {
+			return r.backend.SetRecords(ctx, zone, ptrName(ip), PTR, []string{reg.Name}, r.cfg.TTL)
+		}); err != nil {
+			return errors.Wrapf(err, "failed to set PTR record of %s", ip)
+		}
+	}
+	return nil
+}
+
+// unregister deletes the records of the endpoint's registration. A name or ip registered by another endpoint as well,
+// e.g. a pod recreated with the same name before the old endpoint is deleted, keeps its records.
+func (r *Registrar) unregister(ctx context.Context, endpointID string, reg Registration) error {
+	if other, ok := r.registeredByOther(endpointID, func(o Registration) bool { return o.Name == reg.Name }); ok {
+		if err := r.setForwardRecords(ctx, other); err != nil {
+			return err
+		}
+	} else {
+		for _, rrType := range []RecordType{A, AAAA} {
+			if err := r.retry(ctx, func() error { return r.backend.DeleteRecords(ctx, r.cfg.Zone, reg.Name, rrType) }); err != nil {
+				return errors.Wrapf(err, "failed to delete %s record of %s", rrType, reg.Name)
+			}
+		}
+	}
+
+	for _, ip := range reg.IPs {
+		zone, ok := r.reverseZone(ip)
+		if !ok {
+			continue
+		}
+		if _, ok := r.registeredByOther(endpointID, func(o Registration) bool { return slices.Contains(o.IPs, ip) }); ok {
+			continue
+		}
+		if err := r.retry(ctx, func() error { return r.backend.DeleteRecords(ctx, zone, ptrName(ip), PTR) }); err != nil {
+			return errors.Wrapf(err, "failed to delete PTR record of %s", ip)
+		}
+	}
+	r.log.Info("Unregistered endpoint records", zap.String("endpointID", endpointID), zap.String("name", reg.Name))
+	return nil
+}
+
+// setForwardRecords sets the A and AAAA records of the registration's name to its ips.
+func (r *Registrar) setForwardRecords(ctx context.Context, reg Registration) error {
+	values := map[RecordType][]string{}
+	for _, ip := range reg.IPs {
+		rrType := A
+		if ip.Is6() {
+			rrType = AAAA
+		}
+		values[rrType] = append(values[rrType], ip.String())
+	}
+	for _, rrType := range []RecordType{A, AAAA} {
+		var err error
+		if len(values[rrType]) == 0 {
+			err = r.retry(ctx, func() error { return r.backend.DeleteRecords(ctx, r.cfg.Zone, reg.Name, rrType) })
+		} else {
+			err = r.retry(ctx, func() error {
+				return r.backend.SetRecords(ctx, r.cfg.Zone, reg.Name, rrType, values[rrType], r.cfg.TTL)
+			})
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to set %s record of %s", rrType, reg.Name)
+		}
+	}
+	return nil
+}
+
+// registeredByOther returns a registration of another endpoint matching the predicate.
+func (r *Registrar) registeredByOther(endpointID string, match func(Registration) bool) (Registration, bool) {
+	for otherID, other := range r.registered {
+		if otherID != endpointID && match(other) {
+			return other, true
+		}
+	}
+	return Registration{}, false
+}
+
+// registration returns the records of the endpoint, nil for an endpoint without pod or ips.
+func (r *Registrar) registration(endpointInfo *restserver.EndpointInfo) *Registration {
+	if endpointInfo == nil || endpointInfo.PodName == "" || endpointInfo.PodNamespace == "" {
+		return nil
+	}
+
+	var ips []netip.Addr
+	for _, ipInfo := range endpointInfo.IfnameToIPMap {
+		for _, ipNets := range [][]net.IPNet{ipInfo.IPv4, ipInfo.IPv6} {
+			for i := range ipNets {
+				if ip, ok := netip.AddrFromSlice(ipNets[i].IP); ok {
+					ips = append(ips, ip.Unmap())
+				}
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	slices.SortFunc(ips, netip.Addr.Compare)
+
+	// pod names are dns subdomains, so their dots would add levels to the name
+	name := strings.ReplaceAll(endpointInfo.PodName, ".", "-") + "." + endpointInfo.PodNamespace + "." + strings.TrimSuffix(r.cfg.Zone, ".")
+	return &Registration{Name: strings.ToLower(name), IPs: slices.Compact(ips)}
+}
+
+// reverseZone returns the longest reverse zone of the ip.
+func (r *Registrar) reverseZone(ip netip.Addr) (string, bool) {
+	name := ptrName(ip)
+	zone := ""
+	for _, z := range r.cfg.ReverseZones {
+		z = strings.ToLower(strings.TrimSuffix(z, "."))
+		if (name == z || strings.HasSuffix(name, "."+z)) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	return zone, zone != ""
+}
+
+func (r *Registrar) retry(ctx context.Context, update func() error) error {
+	return retry.Do(update, retry.Context(ctx), retry.Attempts(r.cfg.RetryAttempts), retry.Delay(r.cfg.RetryDelay),
+		retry.DelayType(retry.BackOffDelay), retry.LastErrorOnly(true))
+}
+
+func (r *Registrar) save() error {
+	return errors.Wrap(r.store.Write(storeKey, r.registered), "failed to save registered records")
+}
+
+// ptrName returns the in-addr.arpa or ip6.arpa name of the ip.
+func ptrName(ip netip.Addr) string {
+	if ip.Is4() {
+		b := ip.As4()
+		labels := make([]string, 0, len(b)+2)
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		return strings.Join(append(labels, "in-addr", "arpa"), ".")
+	}
+
+	const hexDigits = "0123456789abcdef"
+	b := ip.As16()
+	labels := make([]string, 0, 2*len(b)+2)
+	for i := len(b) - 1; i >= 0; i-- {
+		labels = append(labels, string(hexDigits[b[i]&0xf]), string(hexDigits[b[i]>>4]))
+	}
+	return strings.Join(append(labels, "ip6", "arpa"), ".")
+}
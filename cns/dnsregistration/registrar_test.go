@@ -0,0 +1,138 @@
+package dnsregistration
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var errFakeBackend = errors.New("fake backend error")
+
+type fakeBackend struct {
+	records map[string][]string
+	fail    bool
+}
+
+func (f *fakeBackend) SetRecords(_ context.Context, zone, name string, rrType RecordType, values []string, _ time.Duration) error {
+	if f.fail {
+		return errFakeBackend
+	}
+	f.records[zone+"/"+name+"/"+string(rrType)] = values
+	return nil
+}
+
+func (f *fakeBackend) DeleteRecords(_ context.Context, zone, name string, rrType RecordType) error {
+	if f.fail {
+		return errFakeBackend
+	}
+	delete(f.records, zone+"/"+name+"/"+string(rrType))
+	return nil
+}
+
+type fakeEndpoints struct {
+	endpoints map[string]*restserver.EndpointInfo
+}
+
+func (*fakeEndpoints) WaitEndpointEvents(context.Context, uint64, time.Duration) ([]restserver.EndpointEvent, uint64, bool) {
+	return nil, 0, false
+}
+
+func (f *fakeEndpoints) ListEndpoints() map[string]*restserver.EndpointInfo {
+	return f.endpoints
+}
+
+func endpoint(podName, podNamespace string, ips ...string) *restserver.EndpointInfo {
+	ipInfo := &restserver.IPInfo{}
+	for _, ip := range ips {
+		addr := netip.MustParseAddr(ip)
+		ipNet := net.IPNet{IP: addr.AsSlice(), Mask: net.CIDRMask(addr.BitLen(), addr.BitLen())}
+		if addr.Is4() {
+			ipInfo.IPv4 = append(ipInfo.IPv4, ipNet)
+		} else {
+			ipInfo.IPv6 = append(ipInfo.IPv6, ipNet)
+		}
+	}
+	return &restserver.EndpointInfo{PodName: podName, PodNamespace: podNamespace, IfnameToIPMap: map[string]*restserver.IPInfo{"eth0": ipInfo}}
+}
+
+func newTestRegistrar(backend Backend, endpoints Endpoints, kvs store.KeyValueStore) *Registrar {
+	return New(Config{
+		Zone:           "pods.contoso.internal",
+		ReverseZones:   []string{"10.in-addr.arpa", "d.f.ip6.arpa."},
+		TTL:            time.Minute,
+		RetryAttempts:  1,
+		ResyncInterval: time.Hour,
+	}, backend, endpoints, kvs, zap.NewNop())
+}
+
+func TestSyncRegistersAndDeletesRecords(t *testing.T) {
+	backend := &fakeBackend{records: map[string][]string{}}
+	r := newTestRegistrar(backend, &fakeEndpoints{}, store.NewMockStore(""))
+	ctx := context.Background()
+
+	require.NoError(t, r.sync(ctx, "ep1", endpoint("web.v1", "Default", "10.0.0.5", "fd00::5", "192.168.0.5")))
+	assert.Equal(t, map[string][]string{
+		"pods.contoso.internal/web-v1.default.pods.contoso.internal/A":    {"10.0.0.5", "192.168.0.5"},
+		"pods.contoso.internal/web-v1.default.pods.contoso.internal/AAAA": {"fd00::5"},
+		"10.in-addr.arpa/5.0.0.10.in-addr.arpa/PTR":                       {"web-v1.default.pods.contoso.internal"},
+		"d.f.ip6.arpa/5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa/PTR": {
+			"web-v1.default.pods.contoso.internal",
+		},
+	}, backend.records)
+
+	require.NoError(t, r.sync(ctx, "ep1", nil))
+	assert.Empty(t, backend.records)
+	assert.Empty(t, r.registered)
+}
+
+func TestSyncKeepsRecordsOfRecreatedPod(t *testing.T) {
+	backend := &fakeBackend{records: map[string][]string{}}
+	r := newTestRegistrar(backend, &fakeEndpoints{}, store.NewMockStore(""))
+	ctx := context.Background()
+
+	require.NoError(t, r.sync(ctx, "old", endpoint("web", "default", "10.0.0.5")))
+	require.NoError(t, r.sync(ctx, "new", endpoint("web", "default", "10.0.0.6")))
+	require.NoError(t, r.sync(ctx, "old", nil))
+
+	assert.Equal(t, map[string][]string{
+		"pods.contoso.internal/web.default.pods.contoso.internal/A": {"10.0.0.6"},
+		"10.in-addr.arpa/6.0.0.10.in-addr.arpa/PTR":                 {"web.default.pods.contoso.internal"},
+	}, backend.records)
+}
+
+func TestResyncRetriesFailedAndDeletesStaleRecords(t *testing.T) {
+	backend := &fakeBackend{records: map[string][]string{}}
+	kvs := store.NewMockStore("")
+	endpoints := &fakeEndpoints{endpoints: map[string]*restserver.EndpointInfo{"stale": endpoint("old", "default", "10.0.0.7")}}
+	r := newTestRegistrar(backend, endpoints, kvs)
+	ctx := context.Background()
+	r.resync(ctx)
+	require.Len(t, backend.records, 2)
+
+	// the stale endpoint is deleted while the registrar is down, and a new one fails to register
+	endpoints.endpoints = map[string]*restserver.EndpointInfo{"ep1": endpoint("web", "default", "10.0.0.5")}
+	r = newTestRegistrar(backend, endpoints, kvs)
+	require.NoError(t, kvs.Read(storeKey, &r.registered))
+	backend.fail = true
+	r.resync(ctx)
+	assert.True(t, r.registered["ep1"].Incomplete)
+
+	backend.fail = false
+	r.resync(ctx)
+	assert.Equal(t, map[string][]string{
+		"pods.contoso.internal/web.default.pods.contoso.internal/A": {"10.0.0.5"},
+		"10.in-addr.arpa/5.0.0.10.in-addr.arpa/PTR":                 {"web.default.pods.contoso.internal"},
+	}, backend.records)
+	assert.Equal(t, map[string]Registration{
+		"ep1": {Name: "web.default.pods.contoso.internal", IPs: []netip.Addr{netip.MustParseAddr("10.0.0.5")}},
+	}, r.registered)
+}
@@ -0,0 +1,184 @@
+package dnsregistration
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// opCodeUpdate is the opcode of dynamic updates.
+	opCodeUpdate dnsmessage.OpCode = 5
+	// rfc2136Timeout bounds an update without a deadline in its context.
+	rfc2136Timeout = 10 * time.Second
+)
+
+var (
+	errUpdateRefused  = errors.New("dns update refused")
+	errInvalidRecord  = errors.New("invalid record")
+	errUnexpectedType = errors.New("unexpected record type")
+)
+
+// RFC2136 updates the zones of a DNS server with dynamic updates, sent over TCP. The updates are not signed, the server
+// authorizes them by the address of the node.
+type RFC2136 struct {
+	server string
+	dial   func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewRFC2136 creates a backend sending the updates to the primary server of the zones, as host:port.
+func NewRFC2136(server string) *RFC2136 {
+	return &RFC2136{server: server, dial: (&net.Dialer{}).DialContext}
+}
+
+// SetRecords replaces the record set with values in a single update, so the name never resolves to a partial set.
+func (b *RFC2136) SetRecords(ctx context.Context, zone, name string, rrType RecordType, values []string, ttl time.Duration) error {
+	return b.update(ctx, zone, func(builder *dnsmessage.Builder) error {
+		if err := deleteRRSet(builder, name, rrType); err != nil {
+			return err
+		}
+		hdr := dnsmessage.ResourceHeader{Name: fqdn(name), Class: dnsmessage.ClassINET, TTL: uint32(ttl.Seconds())}
+		for _, value := range values {
+			if err := addRecord(builder, hdr, rrType, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteRecords deletes the record set, which the server ignores if it doesn't exist.
+func (b *RFC2136) DeleteRecords(ctx context.Context, zone, name string, rrType RecordType) error {
+	return b.update(ctx, zone, func(builder *dnsmessage.Builder) error {
+		return deleteRRSet(builder, name, rrType)
+	})
+}
+
+// update sends an update of the zone with the changes built by changes to the server.
+func (b *RFC2136) update(ctx context.Context, zone string, changes func(*dnsmessage.Builder) error) error {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: uint16(rand.Uint32()), OpCode: opCodeUpdate}) //nolint:gosec // not a secret
+	builder.EnableCompression()
+
+	// the zone section takes the place of the question section, the prerequisites of the answers and the updates of the
+	// authorities
+	if err := builder.StartQuestions(); err != nil {
+		return errors.Wrap(err, "failed to build update")
+	}
+	if err := builder.Question(dnsmessage.Question{Name: fqdn(zone), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return errors.Wrap(err, "failed to build update")
+	}
+	if err := builder.StartAuthorities(); err != nil {
+		return errors.Wrap(err, "failed to build update")
+	}
+	if err := changes(&builder); err != nil {
+		return errors.Wrap(err, "failed to build update")
+	}
+	msg, err := builder.Finish()
+	if err != nil {
+		return errors.Wrap(err, "failed to build update")
+	}
+
+	resp, err := b.exchange(ctx, msg)
+	if err != nil {
+		return err
+	}
+	var parser dnsmessage.Parser
+	hdr, err := parser.Start(resp)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse update response")
+	}
+	if hdr.RCode != dnsmessage.RCodeSuccess {
+		return errors.Wrapf(errUpdateRefused, "%s by %s for zone %s", hdr.RCode, b.server, zone)
+	}
+	return nil
+}
+
+// exchange sends the message with its length prefix over TCP and reads the response.
+func (b *RFC2136) exchange(ctx context.Context, msg []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rfc2136Timeout)
+		defer cancel()
+	}
+	conn, err := b.dial(ctx, "tcp", b.server)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", b.server)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(req, uint16(len(msg)))
+	if _, err := conn.Write(append(req, msg...)); err != nil {
+		return nil, errors.Wrapf(err, "failed to send update to %s", b.server)
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, errors.Wrapf(err, "failed to read update response from %s", b.server)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, errors.Wrapf(err, "failed to read update response from %s", b.server)
+	}
+	return resp, nil
+}
+
+// deleteRRSet adds the deletion of the record set, a record of class ANY without data.
+func deleteRRSet(builder *dnsmessage.Builder, name string, rrType RecordType) error {
+	t, err := dnsType(rrType)
+	if err != nil {
+		return err
+	}
+	return builder.UnknownResource(dnsmessage.ResourceHeader{Name: fqdn(name), Class: dnsmessage.ClassANY},
+		dnsmessage.UnknownResource{Type: t})
+}
+
+// addRecord adds the record with the value to the record set.
+func addRecord(builder *dnsmessage.Builder, hdr dnsmessage.ResourceHeader, rrType RecordType, value string) error {
+	switch rrType {
+	case A, AAAA:
+		ip, err := netip.ParseAddr(value)
+		if err != nil || ip.Is4() != (rrType == A) {
+			return errors.Wrapf(errInvalidRecord, "%s record %q", rrType, value)
+		}
+		if rrType == A {
+			return builder.AResource(hdr, dnsmessage.AResource{A: ip.As4()})
+		}
+		return builder.AAAAResource(hdr, dnsmessage.AAAAResource{AAAA: ip.As16()})
+	case PTR:
+		ptr := fqdn(value)
+		if ptr.Length == 0 {
+			return errors.Wrapf(errInvalidRecord, "PTR record %q", value)
+		}
+		return builder.PTRResource(hdr, dnsmessage.PTRResource{PTR: ptr})
+	}
+	return errors.Wrapf(errUnexpectedType, "%s", rrType)
+}
+
+func dnsType(rrType RecordType) (dnsmessage.Type, error) {
+	switch rrType {
+	case A:
+		return dnsmessage.TypeA, nil
+	case AAAA:
+		return dnsmessage.TypeAAAA, nil
+	case PTR:
+		return dnsmessage.TypePTR, nil
+	}
+	return 0, errors.Wrapf(errUnexpectedType, "%s", rrType)
+}
+
+// fqdn returns the name with its trailing dot. The builder fails on names which don't fit a dns name.
+func fqdn(name string) dnsmessage.Name {
+	n, _ := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	return n
+}
@@ -0,0 +1,114 @@
+package dnsregistration
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type update struct {
+	header      dnsmessage.Header
+	zone        dnsmessage.Question
+	authorities []dnsmessage.Resource
+}
+
+// fakeServer answers a single update over conn with rcode, returning the parsed update. The updates are parsed as
+// unknown resources, as the record set deletions have no data.
+func fakeServer(t *testing.T, conn net.Conn, rcode dnsmessage.RCode) <-chan update {
+	t.Helper()
+	updates := make(chan update, 1)
+	go func() {
+		defer conn.Close()
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		var (
+			u      update
+			parser dnsmessage.Parser
+			err    error
+		)
+		if u.header, err = parser.Start(req); err != nil {
+			return
+		}
+		if u.zone, err = parser.Question(); err != nil {
+			return
+		}
+		if err = parser.SkipAllQuestions(); err != nil {
+			return
+		}
+		if err = parser.SkipAllAnswers(); err != nil {
+			return
+		}
+		for {
+			hdr, err := parser.AuthorityHeader()
+			if err != nil {
+				break
+			}
+			body, err := parser.UnknownResource()
+			if err != nil {
+				return
+			}
+			u.authorities = append(u.authorities, dnsmessage.Resource{Header: hdr, Body: &body})
+		}
+		updates <- u
+
+		resp, _ := (&dnsmessage.Message{Header: dnsmessage.Header{ID: u.header.ID, Response: true, OpCode: opCodeUpdate, RCode: rcode}}).Pack()
+		binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+		_, _ = conn.Write(append(length[:], resp...))
+	}()
+	return updates
+}
+
+func TestRFC2136SetRecords(t *testing.T) {
+	client, server := net.Pipe()
+	updates := fakeServer(t, server, dnsmessage.RCodeSuccess)
+	b := NewRFC2136("10.0.0.53:53")
+	b.dial = func(context.Context, string, string) (net.Conn, error) { return client, nil }
+
+	err := b.SetRecords(context.Background(), "pods.contoso.internal", "web.default.pods.contoso.internal", A,
+		[]string{"10.0.0.5", "10.0.0.6"}, time.Minute)
+	require.NoError(t, err)
+
+	u := <-updates
+	assert.Equal(t, opCodeUpdate, u.header.OpCode)
+	assert.Equal(t, "pods.contoso.internal.", u.zone.Name.String())
+	assert.Equal(t, dnsmessage.TypeSOA, u.zone.Type)
+
+	// the record set is deleted, then replaced
+	require.Len(t, u.authorities, 3)
+	assert.Equal(t, dnsmessage.ClassANY, u.authorities[0].Header.Class)
+	assert.Equal(t, dnsmessage.TypeA, u.authorities[0].Header.Type)
+	assert.Empty(t, u.authorities[0].Body.(*dnsmessage.UnknownResource).Data)
+	for i, ip := range []string{"\x0a\x00\x00\x05", "\x0a\x00\x00\x06"} {
+		rr := u.authorities[i+1]
+		assert.Equal(t, "web.default.pods.contoso.internal.", rr.Header.Name.String())
+		assert.Equal(t, dnsmessage.ClassINET, rr.Header.Class)
+		assert.Equal(t, uint32(60), rr.Header.TTL)
+		assert.Equal(t, []byte(ip), rr.Body.(*dnsmessage.UnknownResource).Data)
+	}
+}
+
+func TestRFC2136Refused(t *testing.T) {
+	client, server := net.Pipe()
+	updates := fakeServer(t, server, dnsmessage.RCodeRefused)
+	b := NewRFC2136("10.0.0.53:53")
+	b.dial = func(context.Context, string, string) (net.Conn, error) { return client, nil }
+
+	err := b.DeleteRecords(context.Background(), "10.in-addr.arpa", "5.0.0.10.in-addr.arpa", PTR)
+	require.ErrorIs(t, err, errUpdateRefused)
+	u := <-updates
+	require.Len(t, u.authorities, 1)
+	assert.Equal(t, dnsmessage.TypePTR, u.authorities[0].Header.Type)
+}
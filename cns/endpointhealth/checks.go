@@ -0,0 +1,207 @@
+package endpointhealth
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// names of the built-in checks
+const (
+	CheckRoutes   = "routes"
+	CheckGateway  = "gateway"
+	CheckNeighbor = "neighbor"
+)
+
+var (
+	errUnknownCheck  = errors.New("unknown endpoint health check")
+	errRoutesMissing = errors.New("routes missing")
+)
+
+// Route is a route via an interface in a pod network namespace.
+type Route struct {
+	Dst     net.IPNet
+	Gateway net.IP
+	OnLink  bool
+}
+
+// Datapath reads the datapath of the pod network namespaces, and adds their missing routes.
+type Datapath interface {
+	// Ping returns an error unless ip answers an echo sent through the interface within timeout.
+	Ping(netNsPath, ifName string, ip net.IP, timeout time.Duration) error
+	// Neighbor returns an error unless the link layer address of ip is resolved on the interface.
+	Neighbor(netNsPath, ifName string, ip net.IP) error
+	// Routes returns the routes via the interface in table, the main table when 0.
+	Routes(netNsPath, ifName string, table int) ([]Route, error)
+	// AddRoute adds the route via the interface to table, the main table when 0.
+	AddRoute(netNsPath, ifName string, table int, route Route) error
+}
+
+// NewCheckers returns the built-in checks with the names, in the order the monitor is to run them: the routes first,
+// then the gateway, whose ping refreshes the neighbor entry the neighbor check then reads. All of them when names is
+// empty.
+func NewCheckers(dp Datapath, pingTimeout time.Duration, names []string) ([]Checker, error) {
+	all := []Checker{routeChecker{dp: dp}, gatewayChecker{dp: dp, timeout: pingTimeout}, neighborChecker{dp: dp}}
+	if len(names) == 0 {
+		return all, nil
+	}
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		known := false
+		for _, checker := range all {
+			known = known || checker.Name() == name
+		}
+		if !known {
+			return nil, errors.Wrapf(errUnknownCheck, "%s", name)
+		}
+		enabled[name] = true
+	}
+	checkers := make([]Checker, 0, len(enabled))
+	for _, checker := range all {
+		if enabled[checker.Name()] {
+			checkers = append(checkers, checker)
+		}
+	}
+	return checkers, nil
+}
+
+// routeChecker checks that the routes CNI programmed for the interface are in its table, and adds them back.
+type routeChecker struct {
+	dp Datapath
+}
+
+func (routeChecker) Name() string {
+	return CheckRoutes
+}
+
+func (c routeChecker) Check(target *Target) error {
+	missing, err := c.missing(target)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	routes := make([]string, len(missing))
+	for i := range missing {
+		routes[i] = missing[i].String()
+	}
+	return errors.Wrapf(errRoutesMissing, "%s", strings.Join(routes, ", "))
+}
+
+func (c routeChecker) Repair(target *Target) error {
+	missing, err := c.missing(target)
+	if err != nil {
+		return err
+	}
+	for i := range missing {
+		if err := c.dp.AddRoute(target.NetNsPath, target.IfName, target.RouteTable, missing[i]); err != nil {
+			return errors.Wrapf(err, "failed to add route %s", missing[i].String())
+		}
+	}
+	return nil
+}
+
+// missing returns the routes of the target which are not in its table.
+func (c routeChecker) missing(target *Target) ([]Route, error) {
+	if len(target.Routes) == 0 {
+		return nil, nil
+	}
+	routes, err := c.dp.Routes(target.NetNsPath, target.IfName, target.RouteTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list routes")
+	}
+	var missing []Route
+	for i := range target.Routes {
+		dst, ok := parseRouteDst(target.Routes[i].IPAddress)
+		if !ok {
+			continue
+		}
+		want := Route{Dst: dst, Gateway: net.ParseIP(target.Routes[i].GatewayIPAddress), OnLink: target.Routes[i].OnLink}
+		if !hasRoute(routes, want) {
+			missing = append(missing, want)
+		}
+	}
+	return missing, nil
+}
+
+// hasRoute returns whether the route to the destination of want, through its gateway when it has one, is in routes.
+func hasRoute(routes []Route, want Route) bool {
+	for i := range routes {
+		ones, _ := routes[i].Dst.Mask.Size()
+		wantOnes, _ := want.Dst.Mask.Size()
+		if !routes[i].Dst.IP.Equal(want.Dst.IP) || ones != wantOnes {
+			continue
+		}
+		if want.Gateway == nil || want.Gateway.IsUnspecified() || want.Gateway.Equal(routes[i].Gateway) {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayChecker checks that the gateway of the interface answers pings. The gateways of the IPv6 default routes are
+// only checked by the neighbor check.
+type gatewayChecker struct {
+	dp      Datapath
+	timeout time.Duration
+}
+
+func (gatewayChecker) Name() string {
+	return CheckGateway
+}
+
+func (c gatewayChecker) Check(target *Target) error {
+	if target.Gateway == nil || target.Gateway.To4() == nil {
+		return nil
+	}
+	return errors.Wrapf(c.dp.Ping(target.NetNsPath, target.IfName, target.Gateway, c.timeout), "gateway %s", target.Gateway)
+}
+
+// neighborChecker checks that the link layer address of the gateway of the interface is resolved, by ARP or ND.
+type neighborChecker struct {
+	dp Datapath
+}
+
+func (neighborChecker) Name() string {
+	return CheckNeighbor
+}
+
+func (c neighborChecker) Check(target *Target) error {
+	if target.Gateway == nil {
+		return nil
+	}
+	return errors.Wrapf(c.dp.Neighbor(target.NetNsPath, target.IfName, target.Gateway), "gateway %s", target.Gateway)
+}
+
+// parseRouteDst parses the destination of a cns route, a cidr or an address.
+func parseRouteDst(dst string) (net.IPNet, bool) {
+	if _, ipNet, err := net.ParseCIDR(dst); err == nil {
+		return *ipNet, true
+	}
+	ip := net.ParseIP(dst)
+	if ip == nil {
+		return net.IPNet{}, false
+	}
+	if ip.To4() != nil {
+		return net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, true //nolint:gomnd // host route
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, true //nolint:gomnd // host route
+}
+
+// isDefault returns whether the destination is a default route.
+func isDefault(dst net.IPNet) bool {
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+// String returns the route as ip route shows it.
+func (r Route) String() string {
+	if r.Gateway == nil || r.Gateway.IsUnspecified() {
+		return r.Dst.String()
+	}
+	return fmt.Sprintf("%s via %s", r.Dst.String(), r.Gateway)
+}
@@ -0,0 +1,139 @@
+package endpointhealth
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/routehealth"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+var errNeighborUnresolved = errors.New("neighbor unresolved")
+
+// netnsDatapath reads the neighbors and routes of the pods through netlink handles in their network namespaces, and
+// pings their gateways with the prober of the route health monitor.
+type netnsDatapath struct {
+	prober routehealth.Datapath
+}
+
+// NewDatapath returns the datapath of the monitor.
+func NewDatapath() (Datapath, error) {
+	prober, err := routehealth.NewDatapath()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the gateway prober")
+	}
+	return netnsDatapath{prober: prober}, nil
+}
+
+func (d netnsDatapath) Ping(netNsPath, ifName string, ip net.IP, timeout time.Duration) error {
+	return d.prober.Probe(netNsPath, routehealth.Route{IfName: ifName, Gateway: ip}, timeout) //nolint:wrapcheck // wrapped by the check
+}
+
+func (netnsDatapath) Neighbor(netNsPath, ifName string, ip net.IP) error {
+	return withLink(netNsPath, ifName, func(handle *netlink.Handle, link netlink.Link) error {
+		family := netlink.FAMILY_V6
+		if ip.To4() != nil {
+			family = netlink.FAMILY_V4
+		}
+		neighs, err := handle.NeighList(link.Attrs().Index, family)
+		if err != nil {
+			return errors.Wrap(err, "failed to list neighbors")
+		}
+		for i := range neighs {
+			if !neighs[i].IP.Equal(ip) {
+				continue
+			}
+			const resolved = netlink.NUD_REACHABLE | netlink.NUD_STALE | netlink.NUD_DELAY | netlink.NUD_PROBE |
+				netlink.NUD_PERMANENT | netlink.NUD_NOARP
+			if neighs[i].State&resolved != 0 {
+				return nil
+			}
+			return errors.Wrapf(errNeighborUnresolved, "state %s", neighStateString(neighs[i].State))
+		}
+		return errors.Wrap(errNeighborUnresolved, "no neighbor entry")
+	})
+}
+
+func (netnsDatapath) Routes(netNsPath, ifName string, table int) ([]Route, error) {
+	var routes []Route
+	err := withLink(netNsPath, ifName, func(handle *netlink.Handle, link netlink.Link) error {
+		filter := &netlink.Route{LinkIndex: link.Attrs().Index, Table: routeTable(table)}
+		list, err := handle.RouteListFiltered(netlink.FAMILY_ALL, filter, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return errors.Wrap(err, "failed to list routes")
+		}
+		for i := range list {
+			route := Route{Gateway: list[i].Gw, OnLink: list[i].Flags&int(netlink.FLAG_ONLINK) != 0}
+			switch {
+			case list[i].Dst != nil:
+				route.Dst = *list[i].Dst
+			case list[i].Family == netlink.FAMILY_V6:
+				route.Dst = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)} //nolint:gomnd // default route
+			default:
+				route.Dst = net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)} //nolint:gomnd // default route
+			}
+			routes = append(routes, route)
+		}
+		return nil
+	})
+	return routes, err
+}
+
+func (netnsDatapath) AddRoute(netNsPath, ifName string, table int, route Route) error {
+	return withLink(netNsPath, ifName, func(handle *netlink.Handle, link netlink.Link) error {
+		dst := route.Dst
+		nlRoute := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: &dst, Table: routeTable(table)}
+		if route.Gateway != nil && !route.Gateway.IsUnspecified() {
+			nlRoute.Gw = route.Gateway
+		}
+		if route.OnLink {
+			nlRoute.Flags = int(netlink.FLAG_ONLINK)
+		}
+		return errors.Wrap(handle.RouteReplace(nlRoute), "failed to replace route")
+	})
+}
+
+// neighStateString returns the name of the unresolved neighbor state as ip neigh shows it.
+func neighStateString(state int) string {
+	switch {
+	case state&netlink.NUD_FAILED != 0:
+		return "FAILED"
+	case state&netlink.NUD_INCOMPLETE != 0:
+		return "INCOMPLETE"
+	case state == netlink.NUD_NONE:
+		return "NONE"
+	default:
+		return fmt.Sprintf("0x%x", state)
+	}
+}
+
+// routeTable returns the netlink table of table, the main table when 0.
+func routeTable(table int) int {
+	if table == 0 {
+		return unix.RT_TABLE_MAIN
+	}
+	return table
+}
+
+// withLink calls f with a netlink handle in the network namespace and the interface.
+func withLink(netNsPath, ifName string, f func(*netlink.Handle, netlink.Link) error) error {
+	ns, err := netns.GetFromPath(netNsPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open netns %s", netNsPath)
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get netlink handle of netns %s", netNsPath)
+	}
+	defer handle.Close()
+	link, err := handle.LinkByName(ifName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get link %s", ifName)
+	}
+	return f(handle, link)
+}
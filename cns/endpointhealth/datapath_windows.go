@@ -0,0 +1,6 @@
+package endpointhealth
+
+// NewDatapath returns ErrUnsupported, the datapath of windows pods is programmed through hns.
+func NewDatapath() (Datapath, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,360 @@
+// Package endpointhealth checks the datapath of the interfaces of the pods from inside their network namespace: that
+// the routes CNI programmed are there, that the gateway answers and that its link layer address resolves. The checks
+// are pluggable. The health of each interface is recorded on its endpoint and served by the CNS endpoint health API;
+// the monitor repairs what the checks which can repair found, and recommends the eviction of the pods which stay
+// unhealthy through the repairs with a node event.
+package endpointhealth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ErrUnsupported is returned by NewDatapath on the platforms the monitor doesn't run on.
+var ErrUnsupported = errors.New("endpoint health checks are not supported on this platform")
+
+// reasons of the node events
+const (
+	reasonEndpointUnhealthy   = "EndpointUnhealthy"
+	reasonEndpointRecovered   = "EndpointRecovered"
+	reasonEndpointRepaired    = "EndpointRepaired"
+	reasonEvictionRecommended = "EndpointEvictionRecommended"
+)
+
+// Target is an interface of an endpoint to check.
+type Target struct {
+	EndpointID string
+	IfName     string
+	NetNsPath  string
+	IPs        []net.IPNet
+	// Routes are the routes CNI programmed for the interface, in RouteTable, the main table when 0.
+	Routes     []cns.Route
+	RouteTable int
+	// Gateway is the gateway of the default route of the interface, nil when it has none.
+	Gateway net.IP
+}
+
+// Checker checks an aspect of the datapath of an interface.
+type Checker interface {
+	// Name is the name of the check, the key of its failures on the endpoints.
+	Name() string
+	// Check returns why the aspect of the datapath of the interface is unhealthy, nil when it is healthy.
+	Check(target *Target) error
+}
+
+// Repairer is a Checker which can repair what its check found.
+type Repairer interface {
+	Checker
+	Repair(target *Target) error
+}
+
+// Endpoints lists the endpoints of CNS and records their health.
+type Endpoints interface {
+	ListEndpoints() map[string]*restserver.EndpointInfo
+	SetEndpointHealth(endpointID string, health map[string]*restserver.EndpointHealth, event restserver.EndpointHealthEvent) error
+}
+
+// Config of the monitor.
+type Config struct {
+	// Interval between the checks of the endpoints.
+	Interval time.Duration
+	// FailureThreshold is the number of failed checks in a row after which an interface is unhealthy, and
+	// RecoveryThreshold the number of passed checks in a row after which it is healthy again.
+	FailureThreshold  int
+	RecoveryThreshold int
+	// Repair has the checks which can repair what they found repair the unhealthy interfaces.
+	Repair bool
+	// EvictAfterRepairs is the number of repairs after which the eviction of a pod still unhealthy is recommended, at
+	// once when none of its failed checks can repair what it found. The eviction is never recommended when 0.
+	EvictAfterRepairs int
+}
+
+// Monitor checks the datapath of the interfaces of the endpoints.
+type Monitor struct {
+	cfg       Config
+	checkers  []Checker
+	endpoints Endpoints
+	log       *zap.Logger
+	now       func() time.Time
+	// states of the interfaces of the endpoints, by endpoint id and interface name
+	states map[string]map[string]*interfaceState
+}
+
+// interfaceState is the health of an interface.
+type interfaceState struct {
+	netNsPath  string
+	healthy    bool
+	evict      bool
+	failures   int // checks failed in a row
+	successes  int // checks passed in a row
+	repairs    int
+	lastErrors map[string]string
+	lastChange time.Time
+}
+
+// New creates a monitor running the checkers, in order, against the interfaces of endpoints.
+func New(cfg Config, checkers []Checker, endpoints Endpoints, logger *zap.Logger) *Monitor {
+	return &Monitor{
+		cfg:       cfg,
+		checkers:  checkers,
+		endpoints: endpoints,
+		log:       logger,
+		now:       time.Now,
+		states:    make(map[string]map[string]*interfaceState),
+	}
+}
+
+// Run checks the endpoints every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check checks all the endpoints, and forgets the endpoints which are gone.
+func (m *Monitor) check(ctx context.Context) {
+	endpoints := m.endpoints.ListEndpoints()
+	for endpointID := range m.states {
+		if _, ok := endpoints[endpointID]; !ok {
+			delete(m.states, endpointID)
+		}
+	}
+	endpointIDs := slices.Sorted(maps.Keys(endpoints))
+	for _, endpointID := range endpointIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := m.checkEndpoint(endpointID, endpoints[endpointID]); err != nil {
+			m.log.Error("Failed to check the health of endpoint", zap.String("endpointID", endpointID), zap.Error(err))
+		}
+	}
+}
+
+// checkEndpoint runs the checks against the interfaces of the endpoint in a pod network namespace, repairs the
+// unhealthy ones and records the changes.
+func (m *Monitor) checkEndpoint(endpointID string, endpointInfo *restserver.EndpointInfo) error {
+	states := m.syncStates(endpointID, endpointInfo)
+	if len(states) == 0 {
+		return nil
+	}
+
+	now := m.now()
+	var (
+		messages []string
+		event    = restserver.EndpointHealthEvent{Type: corev1.EventTypeNormal}
+		warn     = func(reason string) { event.Type, event.Reason = corev1.EventTypeWarning, reason }
+		changed  = false
+	)
+	for _, ifName := range slices.Sorted(maps.Keys(states)) {
+		state := states[ifName]
+		target := newTarget(endpointID, ifName, endpointInfo.IfnameToIPMap[ifName])
+		failed := m.runChecks(target)
+
+		if len(failed) == 0 {
+			state.failures, state.successes, state.lastErrors = 0, state.successes+1, nil
+			if !state.healthy && state.successes >= m.cfg.RecoveryThreshold {
+				state.healthy, state.evict, state.repairs, state.lastChange = true, false, 0, now
+				messages = append(messages, ifName+" recovered")
+				if event.Type == corev1.EventTypeNormal {
+					event.Reason = reasonEndpointRecovered
+				}
+				changed = true
+			}
+			continue
+		}
+
+		state.successes, state.failures = 0, state.failures+1
+		errs := make(map[string]string, len(failed))
+		for checker, err := range failed {
+			errs[checker.Name()] = err.Error()
+		}
+		if !maps.Equal(errs, state.lastErrors) {
+			state.lastErrors, changed = errs, changed || !state.healthy
+		}
+		if state.healthy {
+			if state.failures < m.cfg.FailureThreshold {
+				continue
+			}
+			state.healthy, state.lastChange, changed = false, now, true
+			messages = append(messages, fmt.Sprintf("%s is unhealthy: %s", ifName, failureSummary(errs)))
+			warn(reasonEndpointUnhealthy)
+		}
+
+		if state.evict {
+			continue
+		}
+		repairable := m.cfg.Repair && canRepair(failed)
+		if repairable && (m.cfg.EvictAfterRepairs == 0 || state.repairs < m.cfg.EvictAfterRepairs) {
+			state.repairs++
+			changed = true
+			if repaired := m.repair(target, failed); len(repaired) > 0 {
+				messages = append(messages, fmt.Sprintf("repaired %s of %s", strings.Join(repaired, ", "), ifName))
+				if event.Type == corev1.EventTypeNormal {
+					event.Reason = reasonEndpointRepaired
+				}
+			}
+			continue
+		}
+		if m.cfg.EvictAfterRepairs > 0 {
+			state.evict, changed = true, true
+			if repairable {
+				messages = append(messages, fmt.Sprintf("%s is still unhealthy after %d repairs, the pod should be recreated", ifName, state.repairs))
+			} else {
+				messages = append(messages, fmt.Sprintf("%s can't be repaired, the pod should be recreated", ifName))
+			}
+			warn(reasonEvictionRecommended)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if len(messages) > 0 {
+		event.Message = strings.Join(messages, ", ")
+		m.log.Info("Health of endpoint changed", zap.String("endpointID", endpointID), zap.String("change", event.Message))
+	} else {
+		// the failures or the repairs of an unhealthy interface changed, which are recorded without an event
+		event.Reason = ""
+		event.Message = "health updated"
+	}
+	health := make(map[string]*restserver.EndpointHealth, len(states))
+	for ifName, state := range states {
+		health[ifName] = &restserver.EndpointHealth{
+			Healthy:             state.healthy,
+			Failures:            state.lastErrors,
+			Repairs:             state.repairs,
+			EvictionRecommended: state.evict,
+			LastTransition:      state.lastChange,
+		}
+	}
+	return errors.Wrap(m.endpoints.SetEndpointHealth(endpointID, health, event), "failed to record endpoint health")
+}
+
+// runChecks runs the checks against the target and returns the errors of the failed ones.
+func (m *Monitor) runChecks(target *Target) map[Checker]error {
+	failed := map[Checker]error{}
+	for _, checker := range m.checkers {
+		if err := checker.Check(target); err != nil {
+			failed[checker] = err
+		}
+	}
+	return failed
+}
+
+// canRepair returns whether a failed check can repair what it found.
+func canRepair(failed map[Checker]error) bool {
+	for checker := range failed {
+		if _, ok := checker.(Repairer); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// repair has the failed checks which can repair what they found repair the target, and returns the names of the
+// checks whose repair succeeded.
+func (m *Monitor) repair(target *Target, failed map[Checker]error) []string {
+	var repaired []string
+	for _, checker := range m.checkers {
+		repairer, ok := checker.(Repairer)
+		if _, failing := failed[checker]; !ok || !failing {
+			continue
+		}
+		if err := repairer.Repair(target); err != nil {
+			m.log.Error("Failed to repair endpoint", zap.String("endpointID", target.EndpointID), zap.String("ifName", target.IfName),
+				zap.String("check", checker.Name()), zap.Error(err))
+			continue
+		}
+		repaired = append(repaired, checker.Name())
+	}
+	return repaired
+}
+
+// syncStates returns the states of the interfaces of the endpoint in a pod network namespace. The state of a new
+// interface is the one recorded on the endpoint, so that the repairs already attempted are known after a restart.
+func (m *Monitor) syncStates(endpointID string, endpointInfo *restserver.EndpointInfo) map[string]*interfaceState {
+	states, ok := m.states[endpointID]
+	if !ok {
+		states = make(map[string]*interfaceState)
+	}
+	for ifName, ipInfo := range endpointInfo.IfnameToIPMap {
+		if ipInfo == nil || ipInfo.NetNsPath == "" {
+			delete(states, ifName)
+			continue
+		}
+		if state, ok := states[ifName]; ok && state.netNsPath == ipInfo.NetNsPath {
+			continue
+		}
+		state := &interfaceState{netNsPath: ipInfo.NetNsPath, healthy: true}
+		if recorded := ipInfo.Health; recorded != nil {
+			state.healthy, state.evict, state.repairs = recorded.Healthy, recorded.EvictionRecommended, recorded.Repairs
+			state.lastErrors, state.lastChange = recorded.Failures, recorded.LastTransition
+		}
+		states[ifName] = state
+	}
+	for ifName := range states {
+		if _, ok := endpointInfo.IfnameToIPMap[ifName]; !ok {
+			delete(states, ifName)
+		}
+	}
+	if len(states) == 0 {
+		delete(m.states, endpointID)
+		return nil
+	}
+	m.states[endpointID] = states
+	return states
+}
+
+// newTarget returns the target of the interface of the endpoint.
+func newTarget(endpointID, ifName string, ipInfo *restserver.IPInfo) *Target {
+	target := &Target{
+		EndpointID: endpointID,
+		IfName:     ifName,
+		NetNsPath:  ipInfo.NetNsPath,
+		Routes:     ipInfo.Routes,
+		RouteTable: ipInfo.RouteTable,
+	}
+	target.IPs = append(append(target.IPs, ipInfo.IPv4...), ipInfo.IPv6...)
+	for i := range ipInfo.Routes {
+		if dst, ok := parseRouteDst(ipInfo.Routes[i].IPAddress); ok && isDefault(dst) {
+			if gw := net.ParseIP(ipInfo.Routes[i].GatewayIPAddress); gw != nil && !gw.IsUnspecified() {
+				target.Gateway = gw
+				break
+			}
+		}
+	}
+	return target
+}
+
+// failureSummary returns the failures sorted by check name.
+func failureSummary(errs map[string]string) string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summary := make([]string, len(names))
+	for i, name := range names {
+		summary[i] = name + ": " + errs[name]
+	}
+	return strings.Join(summary, "; ")
+}
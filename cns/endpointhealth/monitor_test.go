@@ -0,0 +1,217 @@
+package endpointhealth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testNetNs = "/var/run/netns/pod1"
+
+var (
+	errNoReply    = errors.New("no reply")
+	errUnresolved = errors.New("state FAILED")
+)
+
+// fakeDatapath holds the routes of the interfaces of a single netns, whose gateways answer unless down.
+type fakeDatapath struct {
+	routes map[string][]Route
+	down   map[string]bool
+	pings  int
+}
+
+func (f *fakeDatapath) Ping(_, _ string, ip net.IP, _ time.Duration) error {
+	f.pings++
+	if f.down[ip.String()] {
+		return errNoReply
+	}
+	return nil
+}
+
+func (f *fakeDatapath) Neighbor(_, _ string, ip net.IP) error {
+	if f.down[ip.String()] {
+		return errUnresolved
+	}
+	return nil
+}
+
+func (f *fakeDatapath) Routes(_, ifName string, _ int) ([]Route, error) {
+	return append([]Route(nil), f.routes[ifName]...), nil
+}
+
+func (f *fakeDatapath) AddRoute(_, ifName string, _ int, route Route) error {
+	f.routes[ifName] = append(f.routes[ifName], route)
+	return nil
+}
+
+// fakeEndpoints records the health set on the endpoints.
+type fakeEndpoints struct {
+	endpoints map[string]*restserver.EndpointInfo
+	events    []restserver.EndpointHealthEvent
+}
+
+func (f *fakeEndpoints) ListEndpoints() map[string]*restserver.EndpointInfo {
+	return f.endpoints
+}
+
+func (f *fakeEndpoints) SetEndpointHealth(endpointID string, health map[string]*restserver.EndpointHealth, event restserver.EndpointHealthEvent) error {
+	for ifName, ifHealth := range health {
+		f.endpoints[endpointID].IfnameToIPMap[ifName].Health = ifHealth
+	}
+	if event.Reason != "" {
+		f.events = append(f.events, event)
+	}
+	return nil
+}
+
+func newTestMonitor(t *testing.T, cfg Config) (*Monitor, *fakeDatapath, *fakeEndpoints) {
+	dp := &fakeDatapath{
+		routes: map[string][]Route{
+			"eth0": {{Dst: net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, Gateway: net.ParseIP("10.1.0.1")}},
+		},
+		down: map[string]bool{},
+	}
+	endpoints := &fakeEndpoints{endpoints: map[string]*restserver.EndpointInfo{
+		"ep1": {IfnameToIPMap: map[string]*restserver.IPInfo{
+			"eth0": {
+				NetNsPath: testNetNs,
+				IPv4:      []net.IPNet{{IP: net.ParseIP("10.1.0.4"), Mask: net.CIDRMask(16, 32)}},
+				Routes: []cns.Route{
+					{IPAddress: "0.0.0.0/0", GatewayIPAddress: "10.1.0.1"},
+					{IPAddress: "10.2.0.0/16", GatewayIPAddress: "10.1.0.1"},
+				},
+			},
+		}},
+		// the endpoints without a pod netns, like the ones of windows, aren't checked
+		"ep2": {IfnameToIPMap: map[string]*restserver.IPInfo{"eth0": {HnsEndpointID: "hns1"}}},
+	}}
+	checkers, err := NewCheckers(dp, time.Second, nil)
+	require.NoError(t, err)
+	cfg.Interval = time.Second
+	return New(cfg, checkers, endpoints, zap.NewNop()), dp, endpoints
+}
+
+func TestRepairMissingRoute(t *testing.T) {
+	m, dp, endpoints := newTestMonitor(t, Config{FailureThreshold: 2, RecoveryThreshold: 1, Repair: true, EvictAfterRepairs: 2})
+	ctx := context.Background()
+
+	// a single failed check doesn't make the interface unhealthy
+	m.check(ctx)
+	assert.Empty(t, endpoints.events)
+	assert.Nil(t, endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].Health)
+	assert.Equal(t, 1, dp.pings)
+
+	m.check(ctx)
+	require.Len(t, endpoints.events, 1)
+	assert.Equal(t, corev1.EventTypeWarning, endpoints.events[0].Type)
+	assert.Equal(t, reasonEndpointUnhealthy, endpoints.events[0].Reason)
+	assert.Equal(t, "eth0 is unhealthy: routes: 10.2.0.0/16 via 10.1.0.1: routes missing, repaired routes of eth0",
+		endpoints.events[0].Message)
+	health := endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].Health
+	assert.False(t, health.Healthy)
+	assert.Equal(t, 1, health.Repairs)
+	assert.Contains(t, health.Failures, CheckRoutes)
+	assert.Len(t, dp.routes["eth0"], 2)
+
+	m.check(ctx)
+	require.Len(t, endpoints.events, 2)
+	assert.Equal(t, corev1.EventTypeNormal, endpoints.events[1].Type)
+	assert.Equal(t, reasonEndpointRecovered, endpoints.events[1].Reason)
+	health = endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].Health
+	assert.True(t, health.Healthy)
+	assert.Zero(t, health.Repairs)
+	assert.Empty(t, health.Failures)
+}
+
+func TestEvictionRecommended(t *testing.T) {
+	m, dp, endpoints := newTestMonitor(t, Config{FailureThreshold: 1, RecoveryThreshold: 2, Repair: true, EvictAfterRepairs: 2})
+	ctx := context.Background()
+	dp.routes["eth0"] = append(dp.routes["eth0"], Route{
+		Dst: net.IPNet{IP: net.ParseIP("10.2.0.0").To4(), Mask: net.CIDRMask(16, 32)}, Gateway: net.ParseIP("10.1.0.1"),
+	})
+
+	// the gateway being down can't be repaired
+	dp.down["10.1.0.1"] = true
+	m.check(ctx)
+	require.Len(t, endpoints.events, 1)
+	assert.Equal(t, reasonEvictionRecommended, endpoints.events[0].Reason)
+	assert.Equal(t, "eth0 is unhealthy: gateway: gateway 10.1.0.1: no reply; neighbor: gateway 10.1.0.1: state FAILED, "+
+		"eth0 can't be repaired, the pod should be recreated", endpoints.events[0].Message)
+	assert.True(t, endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].Health.EvictionRecommended)
+
+	// the recommendation is made once
+	m.check(ctx)
+	assert.Len(t, endpoints.events, 1)
+
+	// and kept by a new monitor
+	m = New(m.cfg, m.checkers, endpoints, zap.NewNop())
+	m.check(ctx)
+	assert.Len(t, endpoints.events, 1)
+
+	dp.down["10.1.0.1"] = false
+	m.check(ctx)
+	m.check(ctx)
+	require.Len(t, endpoints.events, 2)
+	assert.Equal(t, reasonEndpointRecovered, endpoints.events[1].Reason)
+	assert.False(t, endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].Health.EvictionRecommended)
+}
+
+func TestEvictionAfterRepairs(t *testing.T) {
+	m, dp, endpoints := newTestMonitor(t, Config{FailureThreshold: 1, RecoveryThreshold: 1, Repair: true, EvictAfterRepairs: 2})
+	ctx := context.Background()
+	// the routes added back are lost again
+	base := dp.routes["eth0"]
+
+	for i := 0; i < 3; i++ {
+		dp.routes["eth0"] = base
+		m.check(ctx)
+	}
+	require.Len(t, endpoints.events, 3)
+	assert.Equal(t, reasonEndpointUnhealthy, endpoints.events[0].Reason)
+	assert.Equal(t, reasonEndpointRepaired, endpoints.events[1].Reason)
+	assert.Equal(t, reasonEvictionRecommended, endpoints.events[2].Reason)
+	assert.Equal(t, "eth0 is still unhealthy after 2 repairs, the pod should be recreated", endpoints.events[2].Message)
+	assert.Equal(t, 2, endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].Health.Repairs)
+}
+
+func TestNewCheckers(t *testing.T) {
+	dp := &fakeDatapath{}
+	checkers, err := NewCheckers(dp, time.Second, []string{CheckNeighbor, CheckRoutes})
+	require.NoError(t, err)
+	require.Len(t, checkers, 2)
+	assert.Equal(t, CheckRoutes, checkers[0].Name())
+	assert.Equal(t, CheckNeighbor, checkers[1].Name())
+
+	_, err = NewCheckers(dp, time.Second, []string{"mtu"})
+	require.ErrorIs(t, err, errUnknownCheck)
+}
+
+func TestNewTarget(t *testing.T) {
+	target := newTarget("ep1", "eth0", &restserver.IPInfo{
+		NetNsPath: testNetNs,
+		IPv4:      []net.IPNet{{IP: net.ParseIP("10.1.0.4"), Mask: net.CIDRMask(16, 32)}},
+		IPv6:      []net.IPNet{{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(64, 128)}},
+		Routes: []cns.Route{
+			{IPAddress: "10.2.0.0/16", GatewayIPAddress: "10.1.0.2"},
+			{IPAddress: "0.0.0.0/0", GatewayIPAddress: "10.1.0.1"},
+		},
+		RouteTable: 101,
+	})
+	assert.Len(t, target.IPs, 2)
+	assert.Equal(t, "10.1.0.1", target.Gateway.String())
+	assert.Equal(t, 101, target.RouteTable)
+
+	// host routes are given as addresses
+	dst, ok := parseRouteDst("10.3.0.1")
+	require.True(t, ok)
+	assert.Equal(t, "10.3.0.1/32", dst.String())
+}
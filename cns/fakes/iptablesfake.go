@@ -11,6 +11,7 @@ var (
 	errChainExists   = errors.New("chain already exists")
 	errChainNotFound = errors.New("chain not found")
 	errRuleExists    = errors.New("rule already exists")
+	errRuleNotFound  = errors.New("rule not found")
 )
 
 type IPTablesMock struct {
@@ -101,3 +102,34 @@ func (c *IPTablesMock) Append(table, chain string, rulespec ...string) error {
 func (c *IPTablesMock) Insert(table, chain string, _ int, rulespec ...string) error {
 	return c.Append(table, chain, rulespec...)
 }
+
+func (c *IPTablesMock) Delete(table, chain string, rulespec ...string) error {
+	c.ensureTableExists(table)
+
+	targetRule := strings.Join(rulespec, " ")
+	chainRules := c.state[table][chain]
+
+	for i, chainRule := range chainRules {
+		if targetRule == chainRule {
+			c.state[table][chain] = append(chainRules[:i:i], chainRules[i+1:]...)
+			return nil
+		}
+	}
+	return errRuleNotFound
+}
+
+// List returns the rules of the chain in the format of iptables -S.
+func (c *IPTablesMock) List(table, chain string) ([]string, error) {
+	c.ensureTableExists(table)
+
+	chainExists, _ := c.ChainExists(table, chain)
+	if !chainExists {
+		return nil, errChainNotFound
+	}
+
+	rules := []string{"-N " + chain}
+	for _, chainRule := range c.state[table][chain] {
+		rules = append(rules, "-A "+chain+" "+chainRule)
+	}
+	return rules, nil
+}
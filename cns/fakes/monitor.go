@@ -13,6 +13,7 @@ import (
 type MonitorFake struct {
 	IPsNotInUseCount  int64
 	NodeNetworkConfig *v1alpha.NodeNetworkConfig
+	ScalerOverride    cns.IPAMPoolScalerOverride
 }
 
 func (*MonitorFake) Start(ctx context.Context) error {
@@ -24,6 +25,11 @@ func (f *MonitorFake) Update(nnc *v1alpha.NodeNetworkConfig) error {
 	return nil
 }
 
+func (f *MonitorFake) SetScalerOverride(_ context.Context, override cns.IPAMPoolScalerOverride) error {
+	f.ScalerOverride = override
+	return nil
+}
+
 func (*MonitorFake) Reconcile() error {
 	return nil
 }
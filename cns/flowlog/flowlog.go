@@ -0,0 +1,37 @@
+// Package flowlog reads the flows of the pods which log their flows from the host, for the pod flows API.
+package flowlog
+
+import (
+	"net"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+)
+
+// Directions of the flows, from the pod's point of view.
+const (
+	Egress  = "egress"
+	Ingress = "ingress"
+)
+
+// ErrUnsupported is returned by NewReader on the platforms the flows of the pods can't be read on.
+var ErrUnsupported = errors.New("flow logs are not supported on this platform")
+
+// Reader reads the flows of the host.
+type Reader interface {
+	// Flows returns the flows from and to the ips, the dnatted and snatted ones included.
+	Flows(ips []net.IP) ([]cns.EndpointFlow, error)
+}
+
+// Sample returns limit of the flows, spread evenly over them, or the flows as they are when there are no more than
+// limit of them.
+func Sample(flows []cns.EndpointFlow, limit int) []cns.EndpointFlow {
+	if limit <= 0 || len(flows) <= limit {
+		return flows
+	}
+	sampled := make([]cns.EndpointFlow, 0, limit)
+	for i := 0; i < limit; i++ {
+		sampled = append(sampled, flows[i*len(flows)/limit])
+	}
+	return sampled
+}
@@ -0,0 +1,83 @@
+package flowlog
+
+import (
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var protocolNames = map[uint8]string{
+	unix.IPPROTO_ICMP:   "icmp",
+	unix.IPPROTO_TCP:    "tcp",
+	unix.IPPROTO_UDP:    "udp",
+	unix.IPPROTO_ICMPV6: "icmpv6",
+	unix.IPPROTO_SCTP:   "sctp",
+}
+
+// conntrackReader reads the flows from the conntrack table of the host, whose bytes and packets are counted once the
+// cni enabled the conntrack accounting for an endpoint which logs its flows.
+type conntrackReader struct{}
+
+// NewReader returns the reader of the flows of the host.
+func NewReader() (Reader, error) {
+	return conntrackReader{}, nil
+}
+
+func (conntrackReader) Flows(ips []net.IP) ([]cns.EndpointFlow, error) {
+	var flows []cns.EndpointFlow
+	for _, family := range []netlink.InetFamily{unix.AF_INET, unix.AF_INET6} {
+		ctFlows, err := netlink.ConntrackTableList(netlink.ConntrackTable, family)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list the conntrack table")
+		}
+		flows = append(flows, endpointFlows(ctFlows, ips)...)
+	}
+	return flows, nil
+}
+
+// endpointFlows returns the flows of the conntrack entries from and to the ips: the ones they originated, snatted or
+// not, and the ones to them, dnatted or not.
+func endpointFlows(ctFlows []*netlink.ConntrackFlow, ips []net.IP) []cns.EndpointFlow {
+	hasIP := func(ip net.IP) bool {
+		return slices.ContainsFunc(ips, ip.Equal)
+	}
+
+	var flows []cns.EndpointFlow
+	for _, ctFlow := range ctFlows {
+		fwd, rev := ctFlow.Forward, ctFlow.Reverse
+		flow := cns.EndpointFlow{
+			Protocol:   protocolName(fwd.Protocol),
+			SrcIP:      fwd.SrcIP.String(),
+			DstIP:      fwd.DstIP.String(),
+			SrcPort:    fwd.SrcPort,
+			DstPort:    fwd.DstPort,
+			Translated: !rev.SrcIP.Equal(fwd.DstIP) || !rev.DstIP.Equal(fwd.SrcIP),
+		}
+		switch {
+		case hasIP(fwd.SrcIP):
+			flow.Direction = Egress
+			flow.TxBytes, flow.TxPackets = fwd.Bytes, fwd.Packets
+			flow.RxBytes, flow.RxPackets = rev.Bytes, rev.Packets
+		case hasIP(fwd.DstIP) || hasIP(rev.SrcIP):
+			flow.Direction = Ingress
+			flow.RxBytes, flow.RxPackets = fwd.Bytes, fwd.Packets
+			flow.TxBytes, flow.TxPackets = rev.Bytes, rev.Packets
+		default:
+			continue
+		}
+		flows = append(flows, flow)
+	}
+	return flows
+}
+
+func protocolName(protocol uint8) string {
+	if name, ok := protocolNames[protocol]; ok {
+		return name
+	}
+	return strconv.Itoa(int(protocol))
+}
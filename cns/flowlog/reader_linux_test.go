@@ -0,0 +1,77 @@
+package flowlog
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func newTuple(protocol uint8, src, dst string, srcPort, dstPort uint16, bytes, packets uint64) netlink.IPTuple {
+	return netlink.IPTuple{
+		Protocol: protocol,
+		SrcIP:    net.ParseIP(src),
+		DstIP:    net.ParseIP(dst),
+		SrcPort:  srcPort,
+		DstPort:  dstPort,
+		Bytes:    bytes,
+		Packets:  packets,
+	}
+}
+
+func TestEndpointFlows(t *testing.T) {
+	ctFlows := []*netlink.ConntrackFlow{
+		// snatted to the node ip on its way out
+		{
+			Forward: newTuple(unix.IPPROTO_TCP, "10.240.0.4", "20.1.1.1", 40000, 443, 100, 2),
+			Reverse: newTuple(unix.IPPROTO_TCP, "20.1.1.1", "10.224.0.4", 443, 40000, 1000, 3),
+		},
+		// to a service ip dnatted to the pod
+		{
+			Forward: newTuple(unix.IPPROTO_UDP, "10.240.0.5", "10.0.0.10", 50000, 53, 60, 1),
+			Reverse: newTuple(unix.IPPROTO_UDP, "10.240.0.4", "10.240.0.5", 53, 50000, 120, 1),
+		},
+		// from a peer to the pod
+		{
+			Forward: newTuple(unix.IPPROTO_ICMP, "10.240.0.6", "10.240.0.4", 0, 0, 84, 1),
+			Reverse: newTuple(unix.IPPROTO_ICMP, "10.240.0.4", "10.240.0.6", 0, 0, 84, 1),
+		},
+		// of another pod
+		{
+			Forward: newTuple(unix.IPPROTO_TCP, "10.240.0.5", "10.240.0.6", 40000, 80, 1, 1),
+			Reverse: newTuple(unix.IPPROTO_TCP, "10.240.0.6", "10.240.0.5", 80, 40000, 1, 1),
+		},
+	}
+
+	flows := endpointFlows(ctFlows, []net.IP{net.ParseIP("10.240.0.4")})
+	assert.Equal(t, []cns.EndpointFlow{
+		{
+			Protocol: "tcp", Direction: Egress, SrcIP: "10.240.0.4", DstIP: "20.1.1.1", SrcPort: 40000, DstPort: 443,
+			TxBytes: 100, TxPackets: 2, RxBytes: 1000, RxPackets: 3, Translated: true,
+		},
+		{
+			Protocol: "udp", Direction: Ingress, SrcIP: "10.240.0.5", DstIP: "10.0.0.10", SrcPort: 50000, DstPort: 53,
+			RxBytes: 60, RxPackets: 1, TxBytes: 120, TxPackets: 1, Translated: true,
+		},
+		{
+			Protocol: "icmp", Direction: Ingress, SrcIP: "10.240.0.6", DstIP: "10.240.0.4",
+			RxBytes: 84, RxPackets: 1, TxBytes: 84, TxPackets: 1,
+		},
+	}, flows)
+}
+
+func TestSample(t *testing.T) {
+	var flows []cns.EndpointFlow
+	for port := uint16(0); port < 10; port++ {
+		flows = append(flows, cns.EndpointFlow{SrcPort: port})
+	}
+
+	assert.Equal(t, flows, Sample(flows, 10))
+	assert.Equal(t, flows, Sample(flows, 0))
+
+	sampled := Sample(flows, 3)
+	assert.Equal(t, []cns.EndpointFlow{{SrcPort: 0}, {SrcPort: 3}, {SrcPort: 6}}, sampled)
+}
@@ -0,0 +1,6 @@
+package flowlog
+
+// NewReader returns ErrUnsupported, hns doesn't expose the vfp flows of the windows pods.
+func NewReader() (Reader, error) {
+	return nil, ErrUnsupported
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -54,10 +55,16 @@ func New(cli ReleaseIPsClient, path string, logger *zap.Logger) (*watcher, error
 func (w *watcher) releaseAll(ctx context.Context) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
+	defer w.recordPending()
 	for containerID := range w.pendingDelete {
 		// read file contents
-		filepath := w.path + "/" + containerID
-		file, err := os.Open(filepath)
+		file, err := os.Open(filepath.Join(w.path, containerID))
+		if errors.Is(err, fs.ErrNotExist) {
+			// the delete was processed by a previous invocation of CNS
+			w.log.Info("missed delete is gone", zap.String("containerID", containerID))
+			delete(w.pendingDelete, containerID)
+			continue
+		}
 		if err != nil {
 			w.log.Error("failed to open file", zap.Error(err))
 		}
@@ -72,9 +79,11 @@ func (w *watcher) releaseAll(ctx context.Context) {
 		w.log.Info("releasing IP for missed delete", zap.String("podInterfaceID", podInterfaceID), zap.String("containerID", containerID))
 		if err := w.releaseIP(ctx, podInterfaceID, containerID); err != nil {
 			w.log.Error("failed to release IP for missed delete", zap.String("containerID", containerID), zap.Error(err))
+			releases.WithLabelValues(resultFailure).Inc()
 			continue
 		}
 		w.log.Info("successfully released IP for missed delete", zap.String("containerID", containerID))
+		releases.WithLabelValues(resultSuccess).Inc()
 		delete(w.pendingDelete, containerID)
 		if err := removeFile(containerID, w.path); err != nil {
 			w.log.Error("failed to remove file for missed delete", zap.Error(err))
@@ -92,7 +101,9 @@ func (w *watcher) watchPendingDelete(ctx context.Context) error {
 		case <-ctx.Done():
 			return errors.Wrap(ctx.Err(), "exiting watchPendingDelete")
 		case <-ticker.C:
+			w.lock.Lock()
 			n := len(w.pendingDelete)
+			w.lock.Unlock()
 			if n == 0 {
 				continue
 			}
@@ -135,6 +146,7 @@ func (w *watcher) watchFS(ctx context.Context) error {
 		w.log.Info("adding missed delete from file", zap.String("name", file.Name()))
 		w.pendingDelete[file.Name()] = struct{}{}
 	}
+	w.recordPending()
 	w.lock.Unlock()
 
 	// Start listening for events.
@@ -152,8 +164,10 @@ func (w *watcher) watchFS(ctx context.Context) error {
 				continue
 			}
 			w.log.Info("received create event", zap.String("event", event.Name))
+			// the event has the path of the file, the pending deletes are by the file name
 			w.lock.Lock()
-			w.pendingDelete[event.Name] = struct{}{}
+			w.pendingDelete[filepath.Base(event.Name)] = struct{}{}
+			w.recordPending()
 			w.lock.Unlock()
 		case watcherErr := <-watcher.Errors:
 			w.log.Error("fsnotify watcher error", zap.Error(watcherErr))
@@ -161,6 +175,28 @@ func (w *watcher) watchFS(ctx context.Context) error {
 	}
 }
 
+// recordPending sets the queue depth and the age of the oldest pending delete, from the modification time of its
+// file. It must be called with the lock held.
+func (w *watcher) recordPending() {
+	pendingDeletes.Set(float64(len(w.pendingDelete)))
+
+	var oldest time.Time
+	for containerID := range w.pendingDelete {
+		info, err := os.Stat(filepath.Join(w.path, containerID))
+		if err != nil {
+			continue
+		}
+		if oldest.IsZero() || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+		}
+	}
+	if oldest.IsZero() {
+		oldestPendingDelete.Set(0)
+		return
+	}
+	oldestPendingDelete.Set(time.Since(oldest).Seconds())
+}
+
 // Start starts the filesystem watcher to handle async Pod deletes.
 // Blocks until the context is closed; returns underlying fsnotify errors
 // if something goes fatally wrong.
@@ -1,10 +1,18 @@
 package fsnotify
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func TestAddFile(t *testing.T) {
@@ -85,3 +93,76 @@ func TestWatcherRemoveFile(t *testing.T) {
 		})
 	}
 }
+
+type fakeReleaseIPsClient struct {
+	released []cns.IPConfigsRequest
+	err      error
+}
+
+func (f *fakeReleaseIPsClient) ReleaseIPs(_ context.Context, ipconfig cns.IPConfigsRequest) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.released = append(f.released, ipconfig)
+	return nil
+}
+
+func TestReleaseAll(t *testing.T) {
+	path := t.TempDir()
+	cli := &fakeReleaseIPsClient{err: errors.New("cns is down")}
+	w, err := New(cli, path, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, AddFile("abc-eth0", "abc", path))
+	w.pendingDelete["abc"] = struct{}{}
+	// the file of a delete processed by a previous invocation of cns is gone
+	w.pendingDelete["gone"] = struct{}{}
+	failures := testutil.ToFloat64(releases.WithLabelValues(resultFailure))
+	successes := testutil.ToFloat64(releases.WithLabelValues(resultSuccess))
+
+	// the release is retried while cns is unreachable
+	w.releaseAll(context.Background())
+	assert.Equal(t, map[string]struct{}{"abc": {}}, w.pendingDelete)
+	assert.InDelta(t, 1, testutil.ToFloat64(pendingDeletes), 0)
+	assert.Greater(t, testutil.ToFloat64(oldestPendingDelete), 0.0)
+	assert.InDelta(t, failures+1, testutil.ToFloat64(releases.WithLabelValues(resultFailure)), 0)
+	assert.FileExists(t, filepath.Join(path, "abc"))
+
+	cli.err = nil
+	w.releaseAll(context.Background())
+	assert.Equal(t, []cns.IPConfigsRequest{{PodInterfaceID: "abc-eth0", InfraContainerID: "abc"}}, cli.released)
+	assert.Empty(t, w.pendingDelete)
+	assert.InDelta(t, 0, testutil.ToFloat64(pendingDeletes), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(oldestPendingDelete), 0)
+	assert.InDelta(t, successes+1, testutil.ToFloat64(releases.WithLabelValues(resultSuccess)), 0)
+	assert.NoFileExists(t, filepath.Join(path, "abc"))
+}
+
+func TestWatchFSQueuesByContainerID(t *testing.T) {
+	path := t.TempDir()
+	w, err := New(&fakeReleaseIPsClient{}, path, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, AddFile("old-eth0", "old", path))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.watchFS(ctx) }()
+
+	pending := func() map[string]struct{} {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		out := make(map[string]struct{}, len(w.pendingDelete))
+		for k, v := range w.pendingDelete {
+			out[k] = v
+		}
+		return out
+	}
+	require.Eventually(t, func() bool { return len(pending()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, AddFile("new-eth0", "new", path))
+	require.Eventually(t, func() bool { return len(pending()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]struct{}{"old": {}, "new": {}}, pending())
+
+	cancel()
+	require.Error(t, <-done)
+}
@@ -0,0 +1,42 @@
+package fsnotify
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	resultLabel   = "result"
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	pendingDeletes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_pod_delete_queue_depth",
+			Help: "Number of missed pod deletes whose IPs are waiting to be released.",
+		},
+	)
+	oldestPendingDelete = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_pod_delete_oldest_pending_seconds",
+			Help: "Age in seconds of the oldest missed pod delete whose IPs are waiting to be released.",
+		},
+	)
+	releases = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "async_pod_delete_releases_total",
+			Help: "Count of IP releases of missed pod deletes by result.",
+		},
+		[]string{resultLabel},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		pendingDeletes,
+		oldestPendingDelete,
+		releases,
+	)
+}
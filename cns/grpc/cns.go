@@ -2,12 +2,20 @@ package grpc
 
 import (
 	"context"
+	"time"
 
+	"github.com/Azure/azure-container-networking/cns"
 	pb "github.com/Azure/azure-container-networking/cns/grpc/v1alpha"
 	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/cns/types"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// endpointEventsWait is how long a watch waits for endpoint events before checking on the stream again.
+const endpointEventsWait = time.Minute
+
 // CNSService defines the CNS gRPC service.
 type CNS struct {
 	pb.UnimplementedCNSServer
@@ -26,3 +34,79 @@ func (s *CNS) GetNodeInfo(_ context.Context, req *pb.NodeInfoRequest) (*pb.NodeI
 	// todo: Implement the logic
 	return &pb.NodeInfoResponse{}, nil
 }
+
+func (s *CNS) RequestIPConfigs(ctx context.Context, req *pb.IPConfigsRequest) (*pb.IPConfigsResponse, error) {
+	s.Logger.Info("RequestIPConfigs called", zap.String("podInterfaceID", req.GetPodInterfaceID()), zap.String("infraContainerID", req.GetInfraContainerID()))
+	resp, err := s.State.RequestIPConfigs(ctx, ipConfigsRequestFromPB(req))
+	if err != nil {
+		return nil, statusFromResponse(resp.Response)
+	}
+	return ipConfigsResponseToPB(resp), nil
+}
+
+func (s *CNS) ReleaseIPConfigs(ctx context.Context, req *pb.IPConfigsRequest) (*pb.IPConfigsResponse, error) {
+	s.Logger.Info("ReleaseIPConfigs called", zap.String("podInterfaceID", req.GetPodInterfaceID()), zap.String("infraContainerID", req.GetInfraContainerID()))
+	resp, err := s.State.ReleaseIPConfigHandlerHelper(ctx, ipConfigsRequestFromPB(req))
+	if err != nil {
+		return nil, statusFromResponse(resp.Response)
+	}
+	return ipConfigsResponseToPB(resp), nil
+}
+
+func (s *CNS) CreateOrUpdateNetworkContainer(_ context.Context, req *pb.CreateOrUpdateNetworkContainerRequest) (*pb.CreateOrUpdateNetworkContainerResponse, error) {
+	nc := networkContainerFromPB(req.GetNetworkContainer())
+	s.Logger.Info("CreateOrUpdateNetworkContainer called", zap.String("networkContainerID", nc.NetworkContainerid), zap.String("version", nc.Version))
+	if returnCode := s.State.CreateOrUpdateNetworkContainerInternal(nc); returnCode != types.Success {
+		return nil, statusFromResponse(cns.Response{ReturnCode: returnCode, Message: "failed to create or update network container " + nc.NetworkContainerid})
+	}
+	return &pb.CreateOrUpdateNetworkContainerResponse{}, nil
+}
+
+func (s *CNS) GetNetworkContainer(_ context.Context, req *pb.GetNetworkContainerRequest) (*pb.GetNetworkContainerResponse, error) {
+	s.Logger.Info("GetNetworkContainer called", zap.String("networkContainerID", req.GetNetworkContainerID()))
+	nc, ok := s.State.GetNetworkContainerGoalState(req.GetNetworkContainerID())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "network container %s not found", req.GetNetworkContainerID())
+	}
+	return &pb.GetNetworkContainerResponse{NetworkContainer: networkContainerToPB(&nc)}, nil
+}
+
+func (s *CNS) DeleteNetworkContainer(_ context.Context, req *pb.DeleteNetworkContainerRequest) (*pb.DeleteNetworkContainerResponse, error) {
+	s.Logger.Info("DeleteNetworkContainer called", zap.String("networkContainerID", req.GetNetworkContainerID()))
+	if req.GetNetworkContainerID() == "" {
+		return nil, status.Error(codes.InvalidArgument, "network container ID is empty")
+	}
+	if returnCode := s.State.DeleteNetworkContainerInternal(cns.DeleteNetworkContainerRequest{NetworkContainerid: req.GetNetworkContainerID()}); returnCode != types.Success {
+		return nil, statusFromResponse(cns.Response{ReturnCode: returnCode, Message: "failed to delete network container " + req.GetNetworkContainerID()})
+	}
+	return &pb.DeleteNetworkContainerResponse{}, nil
+}
+
+// WatchEndpointEvents streams the endpoint events in batches until the client goes away. A batch with missed set is
+// sent when events were dropped, the stream then carries on from the last event.
+func (s *CNS) WatchEndpointEvents(req *pb.WatchEndpointEventsRequest, stream pb.CNS_WatchEndpointEventsServer) error {
+	s.Logger.Info("WatchEndpointEvents called", zap.Uint64("since", req.GetSince()))
+	ctx := stream.Context()
+	since := req.GetSince()
+	for {
+		events, last, missed := s.State.WaitEndpointEvents(ctx, since, endpointEventsWait)
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if len(events) == 0 && !missed {
+			continue
+		}
+		resp := &pb.WatchEndpointEventsResponse{LastSequence: last, Missed: missed}
+		for i := range events {
+			event, err := endpointEventToPB(&events[i])
+			if err != nil {
+				return err
+			}
+			resp.Events = append(resp.Events, event)
+		}
+		if err := stream.Send(resp); err != nil {
+			return err //nolint:wrapcheck // the stream error is already a status
+		}
+		since = last
+	}
+}
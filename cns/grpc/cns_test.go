@@ -0,0 +1,162 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/common"
+	"github.com/Azure/azure-container-networking/cns/fakes"
+	pb "github.com/Azure/azure-container-networking/cns/grpc/v1alpha"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/nmagent"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves the CNS gRPC service of a fresh CNS state over an in-memory connection. NMAgent reports
+// version 0 of the NC.
+func newTestClient(t *testing.T) (pb.CNSClient, *restserver.HTTPRestService) {
+	t.Helper()
+	logger.InitLogger("testlogs", 0, 0, "./")
+	var config common.ServiceConfig
+	nma := &fakes.NMAgentClientFake{
+		GetNCVersionListF: func(context.Context) (nmagent.NCVersionList, error) {
+			return nmagent.NCVersionList{Containers: []nmagent.NCVersion{{NetworkContainerID: "nc1", Version: "0"}}}, nil
+		},
+	}
+	state, err := restserver.NewHTTPRestService(&config, &fakes.WireserverClientFake{}, &fakes.WireserverProxyFake{},
+		&restserver.IPtablesProvider{}, nma, store.NewMockStore(""), nil, nil, fakes.NewMockIMDSClient())
+	require.NoError(t, err)
+	state.SetNodeOrchestrator(&cns.SetOrchestratorTypeRequest{OrchestratorType: cns.KubernetesCRD})
+	state.SetOption(acn.OptManageEndpointState, true)
+	state.EndpointStateStore = store.NewMockStore("")
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterCNSServer(server, &CNS{Logger: zap.NewNop(), State: state})
+	go server.Serve(lis) //nolint:errcheck // stopped by the cleanup
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewCNSClient(conn), state
+}
+
+func TestNetworkContainerAndIPConfigs(t *testing.T) {
+	client, state := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	nc := &pb.NetworkContainer{
+		NetworkContainerID:   "nc1",
+		NetworkContainerType: cns.Docker,
+		Version:              "0",
+		IpConfiguration: &pb.IPConfiguration{
+			IpSubnet:         &pb.IPSubnet{IpAddress: "10.0.0.5", PrefixLength: 24},
+			DnsServers:       []string{"168.63.129.16"},
+			GatewayIPAddress: "10.0.0.1",
+		},
+		SecondaryIPConfigs: map[string]*pb.SecondaryIPConfig{"ip1": {IpAddress: "10.0.0.6"}},
+	}
+	_, err := client.CreateOrUpdateNetworkContainer(ctx, &pb.CreateOrUpdateNetworkContainerRequest{NetworkContainer: nc})
+	require.NoError(t, err)
+
+	// the IPs are available once NMAgent programmed the NC
+	state.SyncHostNCVersion(ctx, cns.CRD)
+
+	got, err := client.GetNetworkContainer(ctx, &pb.GetNetworkContainerRequest{NetworkContainerID: "nc1"})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", got.GetNetworkContainer().GetIpConfiguration().GetIpSubnet().GetIpAddress())
+	assert.Equal(t, "10.0.0.6", got.GetNetworkContainer().GetSecondaryIPConfigs()["ip1"].GetIpAddress())
+
+	_, err = client.GetNetworkContainer(ctx, &pb.GetNetworkContainerRequest{NetworkContainerID: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// the primary CA of an NC can't change
+	nc.IpConfiguration.IpSubnet.IpAddress = "10.0.0.4"
+	_, err = client.CreateOrUpdateNetworkContainer(ctx, &pb.CreateOrUpdateNetworkContainerRequest{NetworkContainer: nc})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	events, err := client.WatchEndpointEvents(ctx, &pb.WatchEndpointEventsRequest{})
+	require.NoError(t, err)
+
+	orchestratorContext, err := json.Marshal(cns.KubernetesPodInfo{PodName: "pod1", PodNamespace: "default"})
+	require.NoError(t, err)
+	req := &pb.IPConfigsRequest{
+		PodInterfaceID:      "pod1-eth0",
+		InfraContainerID:    "container1",
+		OrchestratorContext: orchestratorContext,
+		Ifname:              "eth0",
+	}
+	resp, err := client.RequestIPConfigs(ctx, req)
+	require.NoError(t, err)
+	podIPInfo := PodIPInfoFromPB(resp)
+	require.Len(t, podIPInfo, 1)
+	assert.Equal(t, cns.IPSubnet{IPAddress: "10.0.0.6", PrefixLength: 24}, podIPInfo[0].PodIPConfig)
+	assert.Equal(t, "10.0.0.1", podIPInfo[0].NetworkContainerPrimaryIPConfig.GatewayIPAddress)
+
+	// the NC has no IP left
+	_, err = client.RequestIPConfigs(ctx, &pb.IPConfigsRequest{
+		PodInterfaceID:      "pod2-eth0",
+		InfraContainerID:    "container2",
+		OrchestratorContext: []byte(`{"PodName":"pod2","PodNamespace":"default"}`),
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	batch, err := events.Recv()
+	require.NoError(t, err)
+	require.Len(t, batch.GetEvents(), 1)
+	assert.Equal(t, string(restserver.EndpointCreated), batch.GetEvents()[0].GetType())
+	assert.Equal(t, "container1", batch.GetEvents()[0].GetEndpointID())
+	var endpointInfo restserver.EndpointInfo
+	require.NoError(t, json.Unmarshal(batch.GetEvents()[0].GetEndpointInfo(), &endpointInfo))
+	assert.Equal(t, "pod1", endpointInfo.PodName)
+
+	_, err = client.ReleaseIPConfigs(ctx, req)
+	require.NoError(t, err)
+	batch, err = events.Recv()
+	require.NoError(t, err)
+	require.Len(t, batch.GetEvents(), 1)
+	assert.Equal(t, string(restserver.EndpointDeleted), batch.GetEvents()[0].GetType())
+	assert.Empty(t, batch.GetEvents()[0].GetEndpointInfo())
+
+	_, err = client.DeleteNetworkContainer(ctx, &pb.DeleteNetworkContainerRequest{NetworkContainerID: "nc1"})
+	require.NoError(t, err)
+	_, err = client.GetNetworkContainer(ctx, &pb.GetNetworkContainerRequest{NetworkContainerID: "nc1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.DeleteNetworkContainer(ctx, &pb.DeleteNetworkContainerRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPodIPInfoConversion(t *testing.T) {
+	info := cns.PodIpInfo{
+		PodIPConfig:                     cns.IPSubnet{IPAddress: "10.0.0.6", PrefixLength: 24},
+		NetworkContainerPrimaryIPConfig: cns.IPConfiguration{IPSubnet: cns.IPSubnet{IPAddress: "10.0.0.5", PrefixLength: 24}, DNSServers: []string{"168.63.129.16"}, GatewayIPAddress: "10.0.0.1"},
+		HostPrimaryIPInfo:               cns.HostIPInfo{Gateway: "10.224.0.1", PrimaryIP: "10.224.0.4", Subnet: "10.224.0.0/16"},
+		NICType:                         cns.InfraNIC,
+		InterfaceName:                   "eth0",
+		MacAddress:                      "12:34:56:78:9a:bc",
+		SkipDefaultRoutes:               true,
+		Routes:                          []cns.Route{{IPAddress: "10.1.0.0/16", GatewayIPAddress: "10.0.0.1"}},
+		SecondaryIPConfigs:              []cns.IPSubnet{{IPAddress: "10.0.0.7", PrefixLength: 24}},
+		SNATExceptionCIDRs:              []string{"10.2.0.0/16"},
+	}
+	got := PodIPInfoFromPB(ipConfigsResponseToPB(&cns.IPConfigsResponse{PodIPInfo: []cns.PodIpInfo{info}}))
+	assert.Equal(t, []cns.PodIpInfo{info}, got)
+}
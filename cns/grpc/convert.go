@@ -0,0 +1,224 @@
+package grpc
+
+import (
+	"encoding/json"
+
+	"github.com/Azure/azure-container-networking/cns"
+	pb "github.com/Azure/azure-container-networking/cns/grpc/v1alpha"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/network/policy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusFromResponse converts a failed CNS response to the gRPC status of the closest code.
+func statusFromResponse(resp cns.Response) error {
+	var code codes.Code
+	switch resp.ReturnCode {
+	case types.Success:
+		return nil
+	case types.InvalidParameter, types.InvalidRequest, types.NetworkContainerNotSpecified, types.InvalidPrimaryIPConfig,
+		types.InvalidSecondaryIPConfig, types.EmptyOrchestratorContext, types.UnsupportedOrchestratorContext:
+		code = codes.InvalidArgument
+	case types.NotFound, types.UnknownContainerID:
+		code = codes.NotFound
+	case types.FailedToAllocateIPConfig, types.AddressUnavailable:
+		code = codes.ResourceExhausted
+	case types.UnsupportedOrchestratorType, types.PrimaryCANotSame, types.NICTypeDisabled:
+		code = codes.FailedPrecondition
+	case types.UnsupportedAPI, types.UnsupportedVerb:
+		code = codes.Unimplemented
+	default:
+		code = codes.Internal
+	}
+	return status.Errorf(code, "%s: %s", resp.ReturnCode, resp.Message)
+}
+
+func ipConfigsRequestFromPB(req *pb.IPConfigsRequest) cns.IPConfigsRequest {
+	return cns.IPConfigsRequest{
+		DesiredIPAddresses:  req.GetDesiredIPAddresses(),
+		PodInterfaceID:      req.GetPodInterfaceID(),
+		InfraContainerID:    req.GetInfraContainerID(),
+		OrchestratorContext: req.GetOrchestratorContext(),
+		Ifname:              req.GetIfname(),
+	}
+}
+
+func ipConfigsResponseToPB(resp *cns.IPConfigsResponse) *pb.IPConfigsResponse {
+	out := &pb.IPConfigsResponse{PodIPInfo: make([]*pb.PodIPInfo, 0, len(resp.PodIPInfo))}
+	for i := range resp.PodIPInfo {
+		out.PodIPInfo = append(out.PodIPInfo, podIPInfoToPB(&resp.PodIPInfo[i]))
+	}
+	return out
+}
+
+func podIPInfoToPB(info *cns.PodIpInfo) *pb.PodIPInfo {
+	out := &pb.PodIPInfo{
+		PodIPConfig:                     ipSubnetToPB(info.PodIPConfig),
+		NetworkContainerPrimaryIPConfig: ipConfigurationToPB(info.NetworkContainerPrimaryIPConfig),
+		HostPrimaryIPInfo: &pb.HostIPInfo{
+			Gateway:   info.HostPrimaryIPInfo.Gateway,
+			PrimaryIP: info.HostPrimaryIPInfo.PrimaryIP,
+			Subnet:    info.HostPrimaryIPInfo.Subnet,
+		},
+		NicType:            string(info.NICType),
+		InterfaceName:      info.InterfaceName,
+		MacAddress:         info.MacAddress,
+		SkipDefaultRoutes:  info.SkipDefaultRoutes,
+		Routes:             routesToPB(info.Routes),
+		PnpID:              info.PnPID,
+		SecondaryIPConfigs: ipSubnetsToPB(info.SecondaryIPConfigs),
+		SnatExceptionCIDRs: info.SNATExceptionCIDRs,
+	}
+	for _, p := range info.EndpointPolicies {
+		out.EndpointPolicies = append(out.EndpointPolicies, &pb.Policy{Type: string(p.Type), Data: p.Data})
+	}
+	return out
+}
+
+func podIPInfoFromPB(info *pb.PodIPInfo) cns.PodIpInfo {
+	out := cns.PodIpInfo{
+		PodIPConfig:                     ipSubnetFromPB(info.GetPodIPConfig()),
+		NetworkContainerPrimaryIPConfig: ipConfigurationFromPB(info.GetNetworkContainerPrimaryIPConfig()),
+		HostPrimaryIPInfo: cns.HostIPInfo{
+			Gateway:   info.GetHostPrimaryIPInfo().GetGateway(),
+			PrimaryIP: info.GetHostPrimaryIPInfo().GetPrimaryIP(),
+			Subnet:    info.GetHostPrimaryIPInfo().GetSubnet(),
+		},
+		NICType:            cns.NICType(info.GetNicType()),
+		InterfaceName:      info.GetInterfaceName(),
+		MacAddress:         info.GetMacAddress(),
+		SkipDefaultRoutes:  info.GetSkipDefaultRoutes(),
+		Routes:             routesFromPB(info.GetRoutes()),
+		PnPID:              info.GetPnpID(),
+		SecondaryIPConfigs: ipSubnetsFromPB(info.GetSecondaryIPConfigs()),
+		SNATExceptionCIDRs: info.GetSnatExceptionCIDRs(),
+	}
+	for _, p := range info.GetEndpointPolicies() {
+		out.EndpointPolicies = append(out.EndpointPolicies, policy.Policy{Type: policy.CNIPolicyType(p.GetType()), Data: p.GetData()})
+	}
+	return out
+}
+
+// PodIPInfoFromPB converts the IPs of a gRPC response to the PodIpInfo of the REST API, for the clients which share
+// code with it.
+func PodIPInfoFromPB(resp *pb.IPConfigsResponse) []cns.PodIpInfo {
+	out := make([]cns.PodIpInfo, 0, len(resp.GetPodIPInfo()))
+	for _, info := range resp.GetPodIPInfo() {
+		out = append(out, podIPInfoFromPB(info))
+	}
+	return out
+}
+
+func networkContainerFromPB(nc *pb.NetworkContainer) *cns.CreateNetworkContainerRequest {
+	req := &cns.CreateNetworkContainerRequest{
+		NetworkContainerid:         nc.GetNetworkContainerID(),
+		NetworkContainerType:       nc.GetNetworkContainerType(),
+		Version:                    nc.GetVersion(),
+		PrimaryInterfaceIdentifier: nc.GetPrimaryInterfaceIdentifier(),
+		IPConfiguration:            ipConfigurationFromPB(nc.GetIpConfiguration()),
+		SecondaryIPConfigs:         make(map[string]cns.SecondaryIPConfig, len(nc.GetSecondaryIPConfigs())),
+		CnetAddressSpace:           ipSubnetsFromPB(nc.GetCnetAddressSpace()),
+		Routes:                     routesFromPB(nc.GetRoutes()),
+		AllowHostToNCCommunication: nc.GetAllowHostToNCCommunication(),
+		AllowNCToHostCommunication: nc.GetAllowNCToHostCommunication(),
+		SNATExceptionCIDRs:         nc.GetSnatExceptionCIDRs(),
+	}
+	for id, ipConfig := range nc.GetSecondaryIPConfigs() {
+		req.SecondaryIPConfigs[id] = cns.SecondaryIPConfig{IPAddress: ipConfig.GetIpAddress(), NCVersion: int(ipConfig.GetNcVersion())}
+	}
+	return req
+}
+
+func networkContainerToPB(req *cns.CreateNetworkContainerRequest) *pb.NetworkContainer {
+	nc := &pb.NetworkContainer{
+		NetworkContainerID:         req.NetworkContainerid,
+		NetworkContainerType:       req.NetworkContainerType,
+		Version:                    req.Version,
+		PrimaryInterfaceIdentifier: req.PrimaryInterfaceIdentifier,
+		IpConfiguration:            ipConfigurationToPB(req.IPConfiguration),
+		SecondaryIPConfigs:         make(map[string]*pb.SecondaryIPConfig, len(req.SecondaryIPConfigs)),
+		CnetAddressSpace:           ipSubnetsToPB(req.CnetAddressSpace),
+		Routes:                     routesToPB(req.Routes),
+		AllowHostToNCCommunication: req.AllowHostToNCCommunication,
+		AllowNCToHostCommunication: req.AllowNCToHostCommunication,
+		SnatExceptionCIDRs:         req.SNATExceptionCIDRs,
+	}
+	for id, ipConfig := range req.SecondaryIPConfigs {
+		nc.SecondaryIPConfigs[id] = &pb.SecondaryIPConfig{IpAddress: ipConfig.IPAddress, NcVersion: int64(ipConfig.NCVersion)}
+	}
+	return nc
+}
+
+func endpointEventToPB(event *restserver.EndpointEvent) (*pb.EndpointEvent, error) {
+	out := &pb.EndpointEvent{
+		Sequence:   event.Sequence,
+		Type:       string(event.Type),
+		EndpointID: event.EndpointID,
+	}
+	if event.EndpointInfo != nil {
+		endpointInfo, err := json.Marshal(event.EndpointInfo)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to marshal endpoint %s: %v", event.EndpointID, err)
+		}
+		out.EndpointInfo = endpointInfo
+	}
+	return out, nil
+}
+
+func ipConfigurationToPB(ipConfig cns.IPConfiguration) *pb.IPConfiguration {
+	return &pb.IPConfiguration{
+		IpSubnet:         ipSubnetToPB(ipConfig.IPSubnet),
+		DnsServers:       ipConfig.DNSServers,
+		GatewayIPAddress: ipConfig.GatewayIPAddress,
+	}
+}
+
+func ipConfigurationFromPB(ipConfig *pb.IPConfiguration) cns.IPConfiguration {
+	return cns.IPConfiguration{
+		IPSubnet:         ipSubnetFromPB(ipConfig.GetIpSubnet()),
+		DNSServers:       ipConfig.GetDnsServers(),
+		GatewayIPAddress: ipConfig.GetGatewayIPAddress(),
+	}
+}
+
+func ipSubnetToPB(subnet cns.IPSubnet) *pb.IPSubnet {
+	return &pb.IPSubnet{IpAddress: subnet.IPAddress, PrefixLength: uint32(subnet.PrefixLength)}
+}
+
+func ipSubnetFromPB(subnet *pb.IPSubnet) cns.IPSubnet {
+	return cns.IPSubnet{IPAddress: subnet.GetIpAddress(), PrefixLength: uint8(subnet.GetPrefixLength())} //nolint:gosec // prefix lengths fit in a byte
+}
+
+func ipSubnetsToPB(subnets []cns.IPSubnet) []*pb.IPSubnet {
+	var out []*pb.IPSubnet
+	for _, subnet := range subnets {
+		out = append(out, ipSubnetToPB(subnet))
+	}
+	return out
+}
+
+func ipSubnetsFromPB(subnets []*pb.IPSubnet) []cns.IPSubnet {
+	var out []cns.IPSubnet
+	for _, subnet := range subnets {
+		out = append(out, ipSubnetFromPB(subnet))
+	}
+	return out
+}
+
+func routesToPB(routes []cns.Route) []*pb.Route {
+	var out []*pb.Route
+	for _, route := range routes {
+		out = append(out, &pb.Route{IpAddress: route.IPAddress, GatewayIPAddress: route.GatewayIPAddress, InterfaceToUse: route.InterfaceToUse})
+	}
+	return out
+}
+
+func routesFromPB(routes []*pb.Route) []cns.Route {
+	var out []cns.Route
+	for _, route := range routes {
+		out = append(out, cns.Route{IPAddress: route.GetIpAddress(), GatewayIPAddress: route.GetGatewayIPAddress(), InterfaceToUse: route.GetInterfaceToUse()})
+	}
+	return out
+}
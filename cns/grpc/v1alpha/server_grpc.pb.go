@@ -19,8 +19,14 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	CNS_SetOrchestratorInfo_FullMethodName = "/cns.CNS/SetOrchestratorInfo"
-	CNS_GetNodeInfo_FullMethodName         = "/cns.CNS/GetNodeInfo"
+	CNS_SetOrchestratorInfo_FullMethodName            = "/cns.CNS/SetOrchestratorInfo"
+	CNS_GetNodeInfo_FullMethodName                    = "/cns.CNS/GetNodeInfo"
+	CNS_RequestIPConfigs_FullMethodName               = "/cns.CNS/RequestIPConfigs"
+	CNS_ReleaseIPConfigs_FullMethodName               = "/cns.CNS/ReleaseIPConfigs"
+	CNS_CreateOrUpdateNetworkContainer_FullMethodName = "/cns.CNS/CreateOrUpdateNetworkContainer"
+	CNS_GetNetworkContainer_FullMethodName            = "/cns.CNS/GetNetworkContainer"
+	CNS_DeleteNetworkContainer_FullMethodName         = "/cns.CNS/DeleteNetworkContainer"
+	CNS_WatchEndpointEvents_FullMethodName            = "/cns.CNS/WatchEndpointEvents"
 )
 
 // CNSClient is the client API for CNS service.
@@ -32,6 +38,18 @@ type CNSClient interface {
 	// Retrieves detailed information about a specific node.
 	// Primarily used for health checks.
 	GetNodeInfo(ctx context.Context, in *NodeInfoRequest, opts ...grpc.CallOption) (*NodeInfoResponse, error)
+	// Assigns IPs to a pod interface.
+	RequestIPConfigs(ctx context.Context, in *IPConfigsRequest, opts ...grpc.CallOption) (*IPConfigsResponse, error)
+	// Releases the IPs of a pod interface.
+	ReleaseIPConfigs(ctx context.Context, in *IPConfigsRequest, opts ...grpc.CallOption) (*IPConfigsResponse, error)
+	// Creates a network container or updates its IPs.
+	CreateOrUpdateNetworkContainer(ctx context.Context, in *CreateOrUpdateNetworkContainerRequest, opts ...grpc.CallOption) (*CreateOrUpdateNetworkContainerResponse, error)
+	// Retrieves a network container.
+	GetNetworkContainer(ctx context.Context, in *GetNetworkContainerRequest, opts ...grpc.CallOption) (*GetNetworkContainerResponse, error)
+	// Deletes a network container.
+	DeleteNetworkContainer(ctx context.Context, in *DeleteNetworkContainerRequest, opts ...grpc.CallOption) (*DeleteNetworkContainerResponse, error)
+	// Streams the endpoint events after a sequence, as they happen.
+	WatchEndpointEvents(ctx context.Context, in *WatchEndpointEventsRequest, opts ...grpc.CallOption) (CNS_WatchEndpointEventsClient, error)
 }
 
 type cNSClient struct {
@@ -60,6 +78,83 @@ func (c *cNSClient) GetNodeInfo(ctx context.Context, in *NodeInfoRequest, opts .
 	return out, nil
 }
 
+func (c *cNSClient) RequestIPConfigs(ctx context.Context, in *IPConfigsRequest, opts ...grpc.CallOption) (*IPConfigsResponse, error) {
+	out := new(IPConfigsResponse)
+	err := c.cc.Invoke(ctx, CNS_RequestIPConfigs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) ReleaseIPConfigs(ctx context.Context, in *IPConfigsRequest, opts ...grpc.CallOption) (*IPConfigsResponse, error) {
+	out := new(IPConfigsResponse)
+	err := c.cc.Invoke(ctx, CNS_ReleaseIPConfigs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) CreateOrUpdateNetworkContainer(ctx context.Context, in *CreateOrUpdateNetworkContainerRequest, opts ...grpc.CallOption) (*CreateOrUpdateNetworkContainerResponse, error) {
+	out := new(CreateOrUpdateNetworkContainerResponse)
+	err := c.cc.Invoke(ctx, CNS_CreateOrUpdateNetworkContainer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) GetNetworkContainer(ctx context.Context, in *GetNetworkContainerRequest, opts ...grpc.CallOption) (*GetNetworkContainerResponse, error) {
+	out := new(GetNetworkContainerResponse)
+	err := c.cc.Invoke(ctx, CNS_GetNetworkContainer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) DeleteNetworkContainer(ctx context.Context, in *DeleteNetworkContainerRequest, opts ...grpc.CallOption) (*DeleteNetworkContainerResponse, error) {
+	out := new(DeleteNetworkContainerResponse)
+	err := c.cc.Invoke(ctx, CNS_DeleteNetworkContainer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cNSClient) WatchEndpointEvents(ctx context.Context, in *WatchEndpointEventsRequest, opts ...grpc.CallOption) (CNS_WatchEndpointEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CNS_ServiceDesc.Streams[0], CNS_WatchEndpointEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cNSWatchEndpointEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CNS_WatchEndpointEventsClient interface {
+	Recv() (*WatchEndpointEventsResponse, error)
+	grpc.ClientStream
+}
+
+type cNSWatchEndpointEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *cNSWatchEndpointEventsClient) Recv() (*WatchEndpointEventsResponse, error) {
+	m := new(WatchEndpointEventsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // CNSServer is the server API for CNS service.
 // All implementations must embed UnimplementedCNSServer
 // for forward compatibility
@@ -69,6 +164,18 @@ type CNSServer interface {
 	// Retrieves detailed information about a specific node.
 	// Primarily used for health checks.
 	GetNodeInfo(context.Context, *NodeInfoRequest) (*NodeInfoResponse, error)
+	// Assigns IPs to a pod interface.
+	RequestIPConfigs(context.Context, *IPConfigsRequest) (*IPConfigsResponse, error)
+	// Releases the IPs of a pod interface.
+	ReleaseIPConfigs(context.Context, *IPConfigsRequest) (*IPConfigsResponse, error)
+	// Creates a network container or updates its IPs.
+	CreateOrUpdateNetworkContainer(context.Context, *CreateOrUpdateNetworkContainerRequest) (*CreateOrUpdateNetworkContainerResponse, error)
+	// Retrieves a network container.
+	GetNetworkContainer(context.Context, *GetNetworkContainerRequest) (*GetNetworkContainerResponse, error)
+	// Deletes a network container.
+	DeleteNetworkContainer(context.Context, *DeleteNetworkContainerRequest) (*DeleteNetworkContainerResponse, error)
+	// Streams the endpoint events after a sequence, as they happen.
+	WatchEndpointEvents(*WatchEndpointEventsRequest, CNS_WatchEndpointEventsServer) error
 	mustEmbedUnimplementedCNSServer()
 }
 
@@ -82,6 +189,24 @@ func (UnimplementedCNSServer) SetOrchestratorInfo(context.Context, *SetOrchestra
 func (UnimplementedCNSServer) GetNodeInfo(context.Context, *NodeInfoRequest) (*NodeInfoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetNodeInfo not implemented")
 }
+func (UnimplementedCNSServer) RequestIPConfigs(context.Context, *IPConfigsRequest) (*IPConfigsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestIPConfigs not implemented")
+}
+func (UnimplementedCNSServer) ReleaseIPConfigs(context.Context, *IPConfigsRequest) (*IPConfigsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseIPConfigs not implemented")
+}
+func (UnimplementedCNSServer) CreateOrUpdateNetworkContainer(context.Context, *CreateOrUpdateNetworkContainerRequest) (*CreateOrUpdateNetworkContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateOrUpdateNetworkContainer not implemented")
+}
+func (UnimplementedCNSServer) GetNetworkContainer(context.Context, *GetNetworkContainerRequest) (*GetNetworkContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNetworkContainer not implemented")
+}
+func (UnimplementedCNSServer) DeleteNetworkContainer(context.Context, *DeleteNetworkContainerRequest) (*DeleteNetworkContainerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteNetworkContainer not implemented")
+}
+func (UnimplementedCNSServer) WatchEndpointEvents(*WatchEndpointEventsRequest, CNS_WatchEndpointEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEndpointEvents not implemented")
+}
 func (UnimplementedCNSServer) mustEmbedUnimplementedCNSServer() {}
 
 // UnsafeCNSServer may be embedded to opt out of forward compatibility for this service.
@@ -131,6 +256,117 @@ func _CNS_GetNodeInfo_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CNS_RequestIPConfigs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IPConfigsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).RequestIPConfigs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNS_RequestIPConfigs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).RequestIPConfigs(ctx, req.(*IPConfigsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_ReleaseIPConfigs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IPConfigsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).ReleaseIPConfigs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNS_ReleaseIPConfigs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).ReleaseIPConfigs(ctx, req.(*IPConfigsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_CreateOrUpdateNetworkContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateOrUpdateNetworkContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).CreateOrUpdateNetworkContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNS_CreateOrUpdateNetworkContainer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).CreateOrUpdateNetworkContainer(ctx, req.(*CreateOrUpdateNetworkContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_GetNetworkContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNetworkContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).GetNetworkContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNS_GetNetworkContainer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).GetNetworkContainer(ctx, req.(*GetNetworkContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_DeleteNetworkContainer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteNetworkContainerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNSServer).DeleteNetworkContainer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CNS_DeleteNetworkContainer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNSServer).DeleteNetworkContainer(ctx, req.(*DeleteNetworkContainerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CNS_WatchEndpointEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEndpointEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CNSServer).WatchEndpointEvents(m, &cNSWatchEndpointEventsServer{stream})
+}
+
+type CNS_WatchEndpointEventsServer interface {
+	Send(*WatchEndpointEventsResponse) error
+	grpc.ServerStream
+}
+
+type cNSWatchEndpointEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *cNSWatchEndpointEventsServer) Send(m *WatchEndpointEventsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // CNS_ServiceDesc is the grpc.ServiceDesc for CNS service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -146,7 +382,33 @@ var CNS_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetNodeInfo",
 			Handler:    _CNS_GetNodeInfo_Handler,
 		},
+		{
+			MethodName: "RequestIPConfigs",
+			Handler:    _CNS_RequestIPConfigs_Handler,
+		},
+		{
+			MethodName: "ReleaseIPConfigs",
+			Handler:    _CNS_ReleaseIPConfigs_Handler,
+		},
+		{
+			MethodName: "CreateOrUpdateNetworkContainer",
+			Handler:    _CNS_CreateOrUpdateNetworkContainer_Handler,
+		},
+		{
+			MethodName: "GetNetworkContainer",
+			Handler:    _CNS_GetNetworkContainer_Handler,
+		},
+		{
+			MethodName: "DeleteNetworkContainer",
+			Handler:    _CNS_DeleteNetworkContainer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEndpointEvents",
+			Handler:       _CNS_WatchEndpointEvents_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "cns/grpc/proto/server.proto",
 }
@@ -37,8 +37,11 @@ func DeleteHnsNetwork(networkName string) error {
 func CreateHostNCApipaEndpoint(
 	networkContainerID string,
 	localIPConfiguration cns.IPConfiguration,
+	loopbackIPAddress string,
 	allowNCToHostCommunication bool,
 	allowHostToNCCommunication bool,
+	ncToHostPortRules []cns.HostNCPortRule,
+	hostToNCPortRules []cns.HostNCPortRule,
 	ncPolicies []cns.NetworkContainerRequestPolicies) (string, error) {
 	return "", nil
 }
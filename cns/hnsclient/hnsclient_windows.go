@@ -282,7 +282,8 @@ func configureHostNCApipaNetwork(localIPConfiguration cns.IPConfiguration) (*hcn
 }
 
 func createHostNCApipaNetwork(
-	localIPConfiguration cns.IPConfiguration) (*hcn.HostComputeNetwork, error) {
+	localIPConfiguration cns.IPConfiguration,
+	loopbackIPAddress string) (*hcn.HostComputeNetwork, error) {
 	var (
 		network *hcn.HostComputeNetwork
 		err     error
@@ -316,7 +317,7 @@ func createHostNCApipaNetwork(
 		} else if !loopbackInterfaceExists && !vethernetLoopbackInterfaceExists {
 			ipconfig := cns.IPConfiguration{
 				IPSubnet: cns.IPSubnet{
-					IPAddress:    hnsLoopbackAdapterIPAddress,
+					IPAddress:    loopbackIPAddress,
 					PrefixLength: localIPConfiguration.IPSubnet.PrefixLength,
 				},
 				GatewayIPAddress: localIPConfiguration.GatewayIPAddress,
@@ -387,12 +388,33 @@ func addAclToEndpointPolicy(
 	return nil
 }
 
+// allowedPorts returns the ports of the allow ACLs of the protocol, a comma separated list per port rule of the
+// protocol, or all the ports of every protocol when there is no port rule.
+func allowedPorts(protocol string, portRules []cns.HostNCPortRule) []string {
+	if len(portRules) == 0 {
+		return []string{""}
+	}
+
+	ports := []string{}
+	for _, rule := range portRules {
+		for _, ruleProtocol := range rule.Protocols {
+			if (ruleProtocol == cns.HostNCProtocolTCP && protocol == protocolTCP) ||
+				(ruleProtocol == cns.HostNCProtocolUDP && protocol == protocolUDP) {
+				ports = append(ports, strings.Join(rule.Ports, ","))
+			}
+		}
+	}
+	return ports
+}
+
 func configureAclSettingHostNCApipaEndpoint(
 	protocolList []string,
 	networkContainerApipaIP string,
 	hostApipaIP string,
 	allowNCToHostCommunication bool,
 	allowHostToNCCommunication bool,
+	ncToHostPortRules []cns.HostNCPortRule,
+	hostToNCPortRules []cns.HostNCPortRule,
 	ncRequestedPolicies []cns.NetworkContainerRequestPolicies) ([]hcn.EndpointPolicy, error) {
 	var (
 		err              error
@@ -425,19 +447,22 @@ func configureAclSettingHostNCApipaEndpoint(
 
 		if allowNCToHostCommunication {
 			// Endpoint ACL to allow the outbound traffic from the Apipa IP of the container to
-			// Apipa IP of the host only
-			outAllowToHostOnly := hcn.AclPolicySetting{
-				Protocols:       protocol,
-				Action:          hcn.ActionTypeAllow,
-				Direction:       hcn.DirectionTypeOut,
-				LocalAddresses:  networkContainerApipaIP,
-				RemoteAddresses: hostApipaIP,
-				RuleType:        hcn.RuleTypeSwitch,
-				Priority:        aclPriority1000,
-			}
+			// Apipa IP of the host only, on the ports of the host allowed by the port rules
+			for _, ports := range allowedPorts(protocol, ncToHostPortRules) {
+				outAllowToHostOnly := hcn.AclPolicySetting{
+					Protocols:       protocol,
+					Action:          hcn.ActionTypeAllow,
+					Direction:       hcn.DirectionTypeOut,
+					LocalAddresses:  networkContainerApipaIP,
+					RemoteAddresses: hostApipaIP,
+					RemotePorts:     ports,
+					RuleType:        hcn.RuleTypeSwitch,
+					Priority:        aclPriority1000,
+				}
 
-			if err = addAclToEndpointPolicy(outAllowToHostOnly, &endpointPolicies); err != nil {
-				return nil, err
+				if err = addAclToEndpointPolicy(outAllowToHostOnly, &endpointPolicies); err != nil {
+					return nil, err
+				}
 			}
 		}
 
@@ -457,19 +482,22 @@ func configureAclSettingHostNCApipaEndpoint(
 
 		if allowHostToNCCommunication {
 			// Endpoint ACL to allow the inbound traffic from the apipa IP of the host to
-			// the apipa IP of the container only
-			inAllowFromHostOnly := hcn.AclPolicySetting{
-				Protocols:       protocol,
-				Action:          hcn.ActionTypeAllow,
-				Direction:       hcn.DirectionTypeIn,
-				LocalAddresses:  networkContainerApipaIP,
-				RemoteAddresses: hostApipaIP,
-				RuleType:        hcn.RuleTypeSwitch,
-				Priority:        aclPriority1000,
-			}
+			// the apipa IP of the container only, on the ports of the container allowed by the port rules
+			for _, ports := range allowedPorts(protocol, hostToNCPortRules) {
+				inAllowFromHostOnly := hcn.AclPolicySetting{
+					Protocols:       protocol,
+					Action:          hcn.ActionTypeAllow,
+					Direction:       hcn.DirectionTypeIn,
+					LocalAddresses:  networkContainerApipaIP,
+					RemoteAddresses: hostApipaIP,
+					LocalPorts:      ports,
+					RuleType:        hcn.RuleTypeSwitch,
+					Priority:        aclPriority1000,
+				}
 
-			if err = addAclToEndpointPolicy(inAllowFromHostOnly, &endpointPolicies); err != nil {
-				return nil, err
+				if err = addAclToEndpointPolicy(inAllowFromHostOnly, &endpointPolicies); err != nil {
+					return nil, err
+				}
 			}
 		}
 
@@ -506,8 +534,11 @@ func configureHostNCApipaEndpoint(
 	endpointName string,
 	networkID string,
 	localIPConfiguration cns.IPConfiguration,
+	loopbackIPAddress string,
 	allowNCToHostCommunication bool,
 	allowHostToNCCommunication bool,
+	ncToHostPortRules []cns.HostNCPortRule,
+	hostToNCPortRules []cns.HostNCPortRule,
 	ncPolicies []cns.NetworkContainerRequestPolicies) (*hcn.HostComputeEndpoint, error) {
 	endpoint := &hcn.HostComputeEndpoint{
 		Name:               endpointName,
@@ -524,9 +555,11 @@ func configureHostNCApipaEndpoint(
 	endpointPolicies, err := configureAclSettingHostNCApipaEndpoint(
 		protocolList,
 		networkContainerApipaIP,
-		hnsLoopbackAdapterIPAddress,
+		loopbackIPAddress,
 		allowNCToHostCommunication,
 		allowHostToNCCommunication,
+		ncToHostPortRules,
+		hostToNCPortRules,
 		ncPolicies)
 	if err != nil {
 		logger.Errorf("[Azure CNS] Failed to configure ACL for HostNCApipaEndpoint. Error: %v", err)
@@ -537,9 +570,9 @@ func configureHostNCApipaEndpoint(
 		endpoint.Policies = append(endpoint.Policies, endpointPolicy)
 	}
 
-	// keep Apipa Endpoint gw as 169.254.128.1 to make sure NC to host connectivity work for both Linux and Windows containers
+	// keep Apipa Endpoint gw as the loopback adapter ip to make sure NC to host connectivity work for both Linux and Windows containers
 	hcnRoute := hcn.Route{
-		NextHop:           hnsLoopbackAdapterIPAddress,
+		NextHop:           loopbackIPAddress,
 		DestinationPrefix: "0.0.0.0/0",
 	}
 
@@ -557,12 +590,16 @@ func configureHostNCApipaEndpoint(
 	return endpoint, nil
 }
 
-// CreateHostNCApipaEndpoint creates the endpoint in the apipa network for host container connectivity
+// CreateHostNCApipaEndpoint creates the endpoint in the apipa network for host container connectivity. The loopback
+// adapter of the host gets loopbackIPAddress, or 169.254.128.1 when it is empty.
 func CreateHostNCApipaEndpoint(
 	networkContainerID string,
 	localIPConfiguration cns.IPConfiguration,
+	loopbackIPAddress string,
 	allowNCToHostCommunication bool,
 	allowHostToNCCommunication bool,
+	ncToHostPortRules []cns.HostNCPortRule,
+	hostToNCPortRules []cns.HostNCPortRule,
 	ncPolicies []cns.NetworkContainerRequestPolicies) (string, error) {
 	var (
 		network      *hcn.HostComputeNetwork
@@ -588,8 +625,11 @@ func CreateHostNCApipaEndpoint(
 		return endpoint.Id, nil
 	}
 
-	updateGwForLocalIPConfiguration(&localIPConfiguration)
-	if network, err = createHostNCApipaNetwork(localIPConfiguration); err != nil {
+	if loopbackIPAddress == "" {
+		loopbackIPAddress = hnsLoopbackAdapterIPAddress
+		updateGwForLocalIPConfiguration(&localIPConfiguration)
+	}
+	if network, err = createHostNCApipaNetwork(localIPConfiguration, loopbackIPAddress); err != nil {
 		logger.Errorf("[Azure CNS] Failed to create HostNCApipaNetwork. Error: %v", err)
 		return "", err
 	}
@@ -601,8 +641,11 @@ func CreateHostNCApipaEndpoint(
 		endpointName,
 		network.Id,
 		localIPConfiguration,
+		loopbackIPAddress,
 		allowNCToHostCommunication,
 		allowHostToNCCommunication,
+		ncToHostPortRules,
+		hostToNCPortRules,
 		ncPolicies); err != nil {
 		logger.Errorf("[Azure CNS] Failed to configure HostNCApipaEndpoint: %s. Error: %v", endpointName, err)
 		return "", err
@@ -1,10 +1,13 @@
 package hnsclient
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Microsoft/hcsshim/hcn"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAdhocAdjustIPConfig(t *testing.T) {
@@ -33,3 +36,32 @@ func TestAdhocAdjustIPConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigureAclSettingHostNCApipaEndpointPortRules(t *testing.T) {
+	hostToNCPortRules := []cns.HostNCPortRule{
+		{Protocols: []string{cns.HostNCProtocolTCP}, Ports: []string{"80", "8000-8080"}},
+	}
+	policies, err := configureAclSettingHostNCApipaEndpoint(
+		[]string{protocolICMPv4, protocolTCP, protocolUDP}, "169.254.128.10", hnsLoopbackAdapterIPAddress, false, true, nil, hostToNCPortRules, nil)
+	require.NoError(t, err)
+
+	var allows []hcn.AclPolicySetting
+	blocks := 0
+	for _, policy := range policies {
+		var acl hcn.AclPolicySetting
+		require.NoError(t, json.Unmarshal(policy.Settings, &acl))
+		if acl.Action == hcn.ActionTypeBlock {
+			blocks++
+			continue
+		}
+		allows = append(allows, acl)
+	}
+
+	// every protocol stays blocked, only the ports of the tcp rule are allowed from the host
+	assert.Equal(t, 6, blocks)
+	require.Len(t, allows, 1)
+	assert.Equal(t, protocolTCP, allows[0].Protocols)
+	assert.Equal(t, hcn.DirectionTypeIn, allows[0].Direction)
+	assert.Equal(t, "80,8000-8080", allows[0].LocalPorts)
+	assert.Equal(t, hnsLoopbackAdapterIPAddress, allows[0].RemoteAddresses)
+}
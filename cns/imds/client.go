@@ -45,6 +45,7 @@ func RetryAttempts(attempts uint) ClientOption {
 
 const (
 	vmUniqueIDProperty    = "vmId"
+	zoneProperty          = "zone"
 	imdsComputePath       = "/metadata/instance/compute"
 	imdsComputeAPIVersion = "api-version=2021-01-01"
 	imdsFormatJSON        = "format=json"
@@ -102,6 +103,30 @@ func (c *Client) GetVMUniqueID(ctx context.Context) (string, error) {
 	return vmUniqueID, nil
 }
 
+// GetAvailabilityZone returns the availability zone of the VM, which is empty when the VM is not in a zone.
+func (c *Client) GetAvailabilityZone(ctx context.Context) (string, error) {
+	var zone string
+	err := retry.Do(func() error {
+		computeDoc, err := c.getInstanceComputeMetadata(ctx)
+		if err != nil {
+			return errors.Wrap(err, "error getting IMDS compute metadata")
+		}
+		zoneUntyped, ok := computeDoc[zoneProperty]
+		if !ok {
+			return nil
+		}
+		if zone, ok = zoneUntyped.(string); !ok {
+			return errors.New("unable to parse IMDS compute metadata, zone property is not a string")
+		}
+		return nil
+	}, retry.Context(ctx), retry.Attempts(c.config.retryAttempts), retry.DelayType(retry.BackOffDelay))
+	if err != nil {
+		return "", errors.Wrap(err, "exhausted retries querying IMDS compute metadata")
+	}
+
+	return zone, nil
+}
+
 func (c *Client) getInstanceComputeMetadata(ctx context.Context) (map[string]any, error) {
 	imdsComputeURL, err := url.JoinPath(c.config.endpoint, imdsComputePath)
 	if err != nil {
@@ -100,3 +100,53 @@ func TestInvalidVMUniqueID(t *testing.T) {
 	require.Error(t, err, "error querying testserver")
 	require.Equal(t, "", vmUniqueID)
 }
+
+func TestGetAvailabilityZone(t *testing.T) {
+	computeMetadata, err := os.ReadFile("testdata/computeMetadata.json")
+	require.NoError(t, err, "error reading testdata compute metadata file")
+
+	tests := []struct {
+		name     string
+		metadata []byte
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "vm not in a zone",
+			metadata: computeMetadata,
+			want:     "",
+		},
+		{
+			name:     "vm in a zone",
+			metadata: []byte(`{"vmId": "55b8499d-9b42-4f85-843f-24ff69f4a643", "zone": "2"}`),
+			want:     "2",
+		},
+		{
+			name:     "zone not a string",
+			metadata: []byte(`{"zone": 2}`),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			mockIMDSServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "true", r.Header.Get("Metadata"))
+				w.WriteHeader(http.StatusOK)
+				_, writeErr := w.Write(tt.metadata)
+				require.NoError(t, writeErr, "error writing response")
+			}))
+			defer mockIMDSServer.Close()
+
+			imdsClient := imds.NewClient(imds.Endpoint(mockIMDSServer.URL), imds.RetryAttempts(1))
+			zone, err := imdsClient.GetAvailabilityZone(context.Background())
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, zone)
+		})
+	}
+}
@@ -55,15 +55,18 @@ type Options struct {
 }
 
 type Monitor struct {
-	opts        *Options
-	spec        v1alpha.NodeNetworkConfigSpec
-	metastate   metaState
-	nnccli      nodeNetworkConfigSpecUpdater
-	httpService cns.HTTPService
-	cssSource   <-chan v1alpha1.ClusterSubnetState
-	nncSource   chan v1alpha.NodeNetworkConfig
-	started     chan interface{}
-	once        sync.Once
+	opts           *Options
+	spec           v1alpha.NodeNetworkConfigSpec
+	metastate      metaState
+	scaler         v1alpha.Scaler
+	override       cns.IPAMPoolScalerOverride
+	nnccli         nodeNetworkConfigSpecUpdater
+	httpService    cns.HTTPService
+	cssSource      <-chan v1alpha1.ClusterSubnetState
+	nncSource      chan v1alpha.NodeNetworkConfig
+	overrideSource chan cns.IPAMPoolScalerOverride
+	started        chan interface{}
+	once           sync.Once
 }
 
 func NewMonitor(httpService cns.HTTPService, nnccli nodeNetworkConfigSpecUpdater, cssSource <-chan v1alpha1.ClusterSubnetState, opts *Options) *Monitor {
@@ -74,12 +77,13 @@ func NewMonitor(httpService cns.HTTPService, nnccli nodeNetworkConfigSpecUpdater
 		opts.MaxIPs = DefaultMaxIPs
 	}
 	return &Monitor{
-		opts:        opts,
-		httpService: httpService,
-		nnccli:      nnccli,
-		cssSource:   cssSource,
-		nncSource:   make(chan v1alpha.NodeNetworkConfig),
-		started:     make(chan interface{}),
+		opts:           opts,
+		httpService:    httpService,
+		nnccli:         nnccli,
+		cssSource:      cssSource,
+		nncSource:      make(chan v1alpha.NodeNetworkConfig),
+		overrideSource: make(chan cns.IPAMPoolScalerOverride),
+		started:        make(chan interface{}),
 	}
 }
 
@@ -117,6 +121,17 @@ func (pm *Monitor) Start(ctx context.Context) error {
 			case <-pm.started: // this blocks until we have initialized
 				// if we have initialized and enter this case, we proceed out of the select and continue to reconcile.
 			}
+		case override := <-pm.overrideSource: // the scaler was overridden, reconcile the pool with it right away.
+			pm.override = override
+			pm.setScaler()
+			logger.Printf("[ipam-pool-monitor] scaler override set to %+v", pm.override)
+			select {
+			default:
+				// if we have NOT initialized and enter this case, we continue out of this iteration and let the for loop begin again.
+				continue
+			case <-pm.started: // this blocks until we have initialized
+				// if we have initialized and enter this case, we proceed out of the select and continue to reconcile.
+			}
 		case nnc := <-pm.nncSource: // received a new NodeNetworkConfig, extract the data from it and re-reconcile.
 			if len(nnc.Status.NetworkContainers) > 0 {
 				// Set SubnetName, SubnetAddressSpace and Pod Network ARM ID values to the global subnet, subnetCIDR and subnetARM variables.
@@ -142,10 +157,8 @@ func (pm *Monitor) Start(ctx context.Context) error {
 				}
 			}
 
-			scaler := nnc.Status.Scaler
-			pm.metastate.batch = scaler.BatchSize
-			pm.metastate.max = scaler.MaxIPCount
-			pm.metastate.minFreeCount, pm.metastate.maxFreeCount = CalculateMinFreeIPs(scaler), CalculateMaxFreeIPs(scaler)
+			pm.scaler = nnc.Status.Scaler
+			pm.setScaler()
 			pm.once.Do(func() {
 				pm.spec = nnc.Spec // set the spec from the NNC initially (afterwards we write the Spec so we know target state).
 				logger.Printf("[ipam-pool-monitor] set initial pool spec %+v", pm.spec)
@@ -160,6 +173,27 @@ func (pm *Monitor) Start(ctx context.Context) error {
 	}
 }
 
+// setScaler sets the batch and free IP thresholds of the pool from the scaler of the NodeNetworkConfig, overridden by
+// the scaler override.
+func (pm *Monitor) setScaler() {
+	scaler := pm.scaler
+	pm.override.Apply(&scaler)
+	pm.clampScaler(&scaler)
+	pm.metastate.batch = scaler.BatchSize
+	pm.metastate.max = scaler.MaxIPCount
+	pm.metastate.minFreeCount, pm.metastate.maxFreeCount = CalculateMinFreeIPs(scaler), CalculateMaxFreeIPs(scaler)
+}
+
+// SetScalerOverride pushes the scaler override to the Monitor's reconcile loop, blocking until the loop received it.
+func (pm *Monitor) SetScalerOverride(ctx context.Context, override cns.IPAMPoolScalerOverride) error {
+	select {
+	case pm.overrideSource <- override:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to push scaler override")
+	}
+}
+
 // ipPoolState is the current actual state of the CNS IP pool.
 type ipPoolState struct {
 	// allocatedToPods are the IPs CNS gives to Pods.
@@ -672,3 +672,26 @@ func TestCalculateIPs(t *testing.T) {
 		})
 	}
 }
+
+func TestSetScalerOverride(t *testing.T) {
+	pm := NewMonitor(nil, nil, nil, &Options{})
+	pm.scaler = v1alpha.Scaler{BatchSize: 10, RequestThresholdPercent: 50, ReleaseThresholdPercent: 150, MaxIPCount: 250}
+	pm.setScaler()
+	assert.Equal(t, int64(10), pm.metastate.batch)
+	assert.Equal(t, int64(5), pm.metastate.minFreeCount)
+	assert.Equal(t, int64(15), pm.metastate.maxFreeCount)
+
+	// pre-warm the pool in larger batches, keeping the release threshold of the nnc
+	pm.override = cns.IPAMPoolScalerOverride{BatchSize: 32, RequestThresholdPercent: 100}
+	pm.setScaler()
+	assert.Equal(t, int64(32), pm.metastate.batch)
+	assert.Equal(t, int64(32), pm.metastate.minFreeCount)
+	assert.Equal(t, int64(64), pm.metastate.maxFreeCount, "release threshold is clamped above the request threshold")
+	assert.Equal(t, int64(250), pm.metastate.max)
+
+	// the override is cleared
+	pm.override = cns.IPAMPoolScalerOverride{}
+	pm.setScaler()
+	assert.Equal(t, int64(10), pm.metastate.batch)
+	assert.Equal(t, int64(5), pm.metastate.minFreeCount)
+}
@@ -46,6 +46,9 @@ type Monitor struct {
 	demandSource          <-chan int
 	cssSource             <-chan v1alpha1.ClusterSubnetState
 	nncSource             <-chan v1alpha.NodeNetworkConfig
+	nncScaler             v1alpha.Scaler
+	override              cns.IPAMPoolScalerOverride
+	overrideSource        chan cns.IPAMPoolScalerOverride
 	started               chan interface{}
 	once                  sync.Once
 	legacyMetricsObserver func(context.Context) error
@@ -59,6 +62,7 @@ func NewMonitor(z *zap.Logger, store ipStateStore, nnccli nodeNetworkConfigSpecU
 		demandSource:          demandSource,
 		cssSource:             cssSource,
 		nncSource:             nncSource,
+		overrideSource:        make(chan cns.IPAMPoolScalerOverride),
 		started:               make(chan interface{}),
 		legacyMetricsObserver: func(context.Context) error { return nil },
 	}
@@ -81,10 +85,13 @@ func (pm *Monitor) Start(ctx context.Context) error {
 		case css := <-pm.cssSource: // received an updated ClusterSubnetState, recalculate request
 			pm.scaler.exhausted = css.Status.Exhausted
 			pm.z.Info("exhaustion update", zap.Bool("exhausted", pm.scaler.exhausted))
+		case override := <-pm.overrideSource: // the scaler was overridden, recalculate request
+			pm.override = override
+			pm.setScaler()
+			pm.z.Info("scaler override update", zap.Int64("batch", pm.scaler.batch), zap.Float64("buffer", pm.scaler.buffer))
 		case nnc := <-pm.nncSource: // received a new NodeNetworkConfig, extract the data from it and recalculate request
-			pm.scaler.max = int64(math.Min(float64(nnc.Status.Scaler.MaxIPCount), DefaultMaxIPs))
-			pm.scaler.batch = int64(math.Min(math.Max(float64(nnc.Status.Scaler.BatchSize), 1), float64(pm.scaler.max)))
-			pm.scaler.buffer = math.Abs(float64(nnc.Status.Scaler.RequestThresholdPercent)) / 100 //nolint:gomnd // it's a percentage
+			pm.nncScaler = nnc.Status.Scaler
+			pm.setScaler()
 			pm.once.Do(func() {
 				pm.request = nnc.Spec.RequestedIPCount
 				close(pm.started) // close the init channel the first time we fully receive a NodeNetworkConfig.
@@ -109,6 +116,26 @@ func (pm *Monitor) Start(ctx context.Context) error {
 	}
 }
 
+// setScaler sets the scaler from the one of the NodeNetworkConfig, overridden by the scaler override. The release
+// threshold is not used, as the pool is sized to the demand.
+func (pm *Monitor) setScaler() {
+	scaler := pm.nncScaler
+	pm.override.Apply(&scaler)
+	pm.scaler.max = int64(math.Min(float64(scaler.MaxIPCount), DefaultMaxIPs))
+	pm.scaler.batch = int64(math.Min(math.Max(float64(scaler.BatchSize), 1), float64(pm.scaler.max)))
+	pm.scaler.buffer = math.Abs(float64(scaler.RequestThresholdPercent)) / 100 //nolint:gomnd // it's a percentage
+}
+
+// SetScalerOverride pushes the scaler override to the Monitor's reconcile loop, blocking until the loop received it.
+func (pm *Monitor) SetScalerOverride(ctx context.Context, override cns.IPAMPoolScalerOverride) error {
+	select {
+	case pm.overrideSource <- override:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to push scaler override")
+	}
+}
+
 func (pm *Monitor) reconcile(ctx context.Context) error {
 	// if the subnet is exhausted, locally overwrite the batch/minfree/maxfree in the meta copy for this iteration
 	// (until the controlplane owns this and modifies the scaler values for us directly instead of writing "exhausted")
@@ -356,3 +356,19 @@ func TestReconcile(t *testing.T) {
 		})
 	}
 }
+
+func TestSetScalerOverride(t *testing.T) {
+	pm := NewMonitor(zap.NewNop(), nil, nil, nil, nil, nil)
+	pm.nncScaler = v1alpha.Scaler{BatchSize: 16, RequestThresholdPercent: 50, MaxIPCount: 250}
+	pm.setScaler()
+	assert.Equal(t, scaler{batch: 16, buffer: .5, max: 250}, pm.scaler)
+
+	pm.override = cns.IPAMPoolScalerOverride{BatchSize: 64, RequestThresholdPercent: 200}
+	pm.setScaler()
+	assert.Equal(t, scaler{batch: 64, buffer: 2, max: 250}, pm.scaler)
+
+	// the batch is still clamped at the max
+	pm.override = cns.IPAMPoolScalerOverride{BatchSize: 500}
+	pm.setScaler()
+	assert.Equal(t, scaler{batch: 250, buffer: .5, max: 250}, pm.scaler)
+}
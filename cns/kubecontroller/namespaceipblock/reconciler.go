@@ -0,0 +1,73 @@
+package namespaceipblock
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/Azure/azure-container-networking/crd/namespaceipblock"
+	"github.com/Azure/azure-container-networking/crd/namespaceipblock/api/v1alpha1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type nsipbLister interface {
+	List(context.Context) ([]v1alpha1.NamespaceIPBlock, error)
+}
+
+type ipBlockSetter interface {
+	SetNamespaceIPBlocks(map[string][]netip.Prefix)
+}
+
+// Reconciler watches the NamespaceIPBlocks of the cluster and pushes the IP blocks of every Namespace to
+// the sink on every change.
+type Reconciler struct {
+	z    *zap.Logger
+	cli  nsipbLister
+	sink ipBlockSetter
+}
+
+func New(z *zap.Logger, sink ipBlockSetter) *Reconciler {
+	return &Reconciler{
+		z:    z.With(zap.String("component", "namespaceipblock-reconciler")),
+		sink: sink,
+	}
+}
+
+// Reconcile lists all the NamespaceIPBlocks, since the blocks of a Namespace also restrict the IPs of the
+// Pods of every other Namespace.
+func (r *Reconciler) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	nsipbs, err := r.cli.List(ctx)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "failed to list namespaceipblocks")
+	}
+	r.sink.SetNamespaceIPBlocks(Blocks(r.z, nsipbs))
+	return reconcile.Result{}, nil
+}
+
+// Blocks returns the IP blocks of each Namespace of the NamespaceIPBlocks. The CIDRs which can't be
+// parsed are logged and skipped.
+func Blocks(z *zap.Logger, nsipbs []v1alpha1.NamespaceIPBlock) map[string][]netip.Prefix {
+	blocks := map[string][]netip.Prefix{}
+	for i := range nsipbs {
+		for _, cidr := range nsipbs[i].Spec.CIDRs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				z.Error("skipping invalid cidr", zap.String("namespace", nsipbs[i].Namespace),
+					zap.String("name", nsipbs[i].Name), zap.String("cidr", cidr), zap.Error(err))
+				continue
+			}
+			blocks[nsipbs[i].Namespace] = append(blocks[nsipbs[i].Namespace], prefix.Masked())
+		}
+	}
+	return blocks
+}
+
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.cli = namespaceipblock.NewClient(mgr.GetClient())
+	err := ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.NamespaceIPBlock{}).
+		Complete(r)
+	return errors.Wrap(err, "failed to setup namespaceipblock reconciler with manager")
+}
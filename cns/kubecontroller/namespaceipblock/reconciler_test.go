@@ -0,0 +1,51 @@
+package namespaceipblock
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/crd/namespaceipblock/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type fakeLister []v1alpha1.NamespaceIPBlock
+
+func (f fakeLister) List(context.Context) ([]v1alpha1.NamespaceIPBlock, error) {
+	return f, nil
+}
+
+type fakeSetter struct {
+	blocks map[string][]netip.Prefix
+}
+
+func (f *fakeSetter) SetNamespaceIPBlocks(blocks map[string][]netip.Prefix) {
+	f.blocks = blocks
+}
+
+func TestReconcile(t *testing.T) {
+	nsipb := func(namespace, name string, cidrs ...string) v1alpha1.NamespaceIPBlock {
+		return v1alpha1.NamespaceIPBlock{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       v1alpha1.NamespaceIPBlockSpec{CIDRs: cidrs},
+		}
+	}
+	sink := &fakeSetter{}
+	r := New(zap.NewNop(), sink)
+	r.cli = fakeLister{
+		nsipb("payments", "v4", "10.0.16.0/24"),
+		nsipb("payments", "v6", "fd00::/120", "not-a-cidr"),
+		nsipb("ledger", "blocks", "10.0.17.5/28"),
+	}
+
+	_, err := r.Reconcile(context.Background(), reconcile.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]netip.Prefix{
+		"payments": {netip.MustParsePrefix("10.0.16.0/24"), netip.MustParsePrefix("fd00::/120")},
+		"ledger":   {netip.MustParsePrefix("10.0.17.0/28")},
+	}, sink.blocks)
+}
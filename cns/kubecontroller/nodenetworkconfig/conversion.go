@@ -18,6 +18,8 @@ var (
 	ErrInvalidSecondaryIP = errors.New("invalid secondary IP")
 	// ErrUnsupportedNCQuantity indicates that the node has an unsupported nummber of Network Containers attached.
 	ErrUnsupportedNCQuantity = errors.New("unsupported number of network containers")
+	// ErrInvalidSNATExceptionCIDR indicates that a SNAT exception CIDR on the NC is invalid.
+	ErrInvalidSNATExceptionCIDR = errors.New("invalid SNAT exception CIDR")
 )
 
 // CreateNCRequestFromDynamicNC generates a CreateNetworkContainerRequest from a dynamic NetworkContainer.
@@ -56,6 +58,12 @@ func CreateNCRequestFromDynamicNC(nc v1alpha.NetworkContainer) (*cns.CreateNetwo
 			NCVersion: int(nc.Version),
 		}
 	}
+
+	snatExceptionCIDRs, err := parseSNATExceptionCIDRs(nc.SNATExceptionCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
 	return &cns.CreateNetworkContainerRequest{
 		HostPrimaryIP:        nc.NodeIP,
 		SecondaryIPConfigs:   secondaryIPConfigs,
@@ -66,7 +74,9 @@ func CreateNCRequestFromDynamicNC(nc v1alpha.NetworkContainer) (*cns.CreateNetwo
 			IPSubnet:         subnet,
 			GatewayIPAddress: nc.DefaultGateway,
 		},
-		NCStatus: nc.Status,
+		NCStatus:           nc.Status,
+		SNATExceptionCIDRs: snatExceptionCIDRs,
+		AvailabilityZone:   nc.AvailabilityZone,
 	}, nil
 }
 
@@ -102,5 +112,26 @@ func CreateNCRequestFromStaticNC(nc v1alpha.NetworkContainer) (*cns.CreateNetwor
 		return nil, errors.Wrapf(err, "error while creating NC request from static NC")
 	}
 
+	if req.SNATExceptionCIDRs, err = parseSNATExceptionCIDRs(nc.SNATExceptionCIDRs); err != nil {
+		return nil, err
+	}
+	req.AvailabilityZone = nc.AvailabilityZone
+
 	return req, err
 }
+
+// parseSNATExceptionCIDRs validates the NC's SNAT exception CIDRs and returns them masked to their prefix.
+func parseSNATExceptionCIDRs(cidrs []string) ([]string, error) {
+	if len(cidrs) == 0 {
+		return nil, nil
+	}
+	masked := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidSNATExceptionCIDR, "CIDR: %s", cidr)
+		}
+		masked = append(masked, prefix.Masked().String())
+	}
+	return masked, nil
+}
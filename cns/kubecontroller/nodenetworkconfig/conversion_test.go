@@ -211,6 +211,41 @@ func TestCreateNCRequestFromDynamicNC(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "SNAT exception CIDRs are masked",
+			input: func() v1alpha.NetworkContainer {
+				nc := validSwiftNC
+				nc.SNATExceptionCIDRs = []string{"192.168.1.10/24", "fd00::1/64"}
+				return nc
+			}(),
+			want: func() *cns.CreateNetworkContainerRequest {
+				req := *validSwiftRequest
+				req.SNATExceptionCIDRs = []string{"192.168.1.0/24", "fd00::/64"}
+				return &req
+			}(),
+		},
+		{
+			name: "availability zone",
+			input: func() v1alpha.NetworkContainer {
+				nc := validSwiftNC
+				nc.AvailabilityZone = "2"
+				return nc
+			}(),
+			want: func() *cns.CreateNetworkContainerRequest {
+				req := *validSwiftRequest
+				req.AvailabilityZone = "2"
+				return &req
+			}(),
+		},
+		{
+			name: "malformed SNAT exception CIDR",
+			input: func() v1alpha.NetworkContainer {
+				nc := validSwiftNC
+				nc.SNATExceptionCIDRs = []string{"192.168.1.0"}
+				return nc
+			}(),
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
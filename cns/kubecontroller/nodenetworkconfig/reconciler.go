@@ -2,6 +2,7 @@ package nodenetworkconfig
 
 import (
 	"context"
+	"encoding/json"
 	"sync"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -22,6 +23,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// ScalerOverrideAnnotation is the annotation of the NodeNetworkConfig overriding its scaler, as the JSON of a
+// cns.IPAMPoolScalerOverride. The scaler override set through the CNS API applies on top of it.
+const ScalerOverrideAnnotation = "acn.azure.com/ipam-scaler-override"
+
 type cnsClient interface {
 	CreateOrUpdateNetworkContainerInternal(*cns.CreateNetworkContainerRequest) cnstypes.ResponseCode
 	MustEnsureNoStaleNCs(validNCIDs []string)
@@ -130,6 +135,8 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	// record assigned IPs metric
 	allocatedIPs.Set(float64(ipAssignments))
 
+	applyScalerOverrideAnnotation(nnc)
+
 	// push the NNC to the registered NNC listeners.
 	for _, l := range listenersToNotify {
 		if err := l.Update(nnc); err != nil {
@@ -145,6 +152,22 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	return reconcile.Result{}, nil
 }
 
+// applyScalerOverrideAnnotation overrides the scaler of the NodeNetworkConfig with its scaler override annotation. An
+// invalid annotation is logged and ignored, so that it doesn't block the reconcile of the NCs.
+func applyScalerOverrideAnnotation(nnc *v1alpha.NodeNetworkConfig) {
+	annotation, ok := nnc.Annotations[ScalerOverrideAnnotation]
+	if !ok {
+		return
+	}
+	var override cns.IPAMPoolScalerOverride
+	if err := json.Unmarshal([]byte(annotation), &override); err != nil {
+		logger.Errorf("[cns-rc] ignoring invalid scaler override annotation %q: %v", annotation, err)
+		return
+	}
+	override.Apply(&nnc.Status.Scaler)
+	logger.Printf("[cns-rc] overrode the NNC scaler with %+v", override)
+}
+
 // Started blocks until the Reconciler has reconciled at least once,
 // then, and any time that it is called after that, it immediately returns true.
 // It accepts a cancellable Context and if the context is closed
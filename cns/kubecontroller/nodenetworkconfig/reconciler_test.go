@@ -266,3 +266,36 @@ func TestReconcileStaleNCs(t *testing.T) {
 	assert.Contains(t, cnsClient.state.reqsByNCID, "nc3")
 	assert.Contains(t, cnsClient.state.reqsByNCID, "nc4")
 }
+
+func TestApplyScalerOverrideAnnotation(t *testing.T) {
+	logger.InitLogger("", 0, 0, "")
+	scaler := v1alpha.Scaler{BatchSize: 10, RequestThresholdPercent: 50, ReleaseThresholdPercent: 150, MaxIPCount: 250}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        v1alpha.Scaler
+	}{
+		{
+			name: "no annotation",
+			want: scaler,
+		},
+		{
+			name:        "override",
+			annotations: map[string]string{ScalerOverrideAnnotation: `{"batchSize":32,"requestThresholdPercent":100}`},
+			want:        v1alpha.Scaler{BatchSize: 32, RequestThresholdPercent: 100, ReleaseThresholdPercent: 150, MaxIPCount: 250},
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{ScalerOverrideAnnotation: `{"batchSize":"large"}`},
+			want:        scaler,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nnc := &v1alpha.NodeNetworkConfig{Status: v1alpha.NodeNetworkConfigStatus{Scaler: scaler}}
+			nnc.Annotations = tt.annotations
+			applyScalerOverrideAnnotation(nnc)
+			assert.Equal(t, tt.want, nnc.Status.Scaler)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Package nodeconditions publishes the network readiness of the node as conditions of the node object, so that the
+// cluster autoscaler and operators can key off the readiness of the CNI rather than the generic NodeReady. Each
+// condition is set from a health check of CNS, and only flips once the check gave the same result a number of times
+// in a row.
+package nodeconditions
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// IPAMReady is True when CNS has IPs to assign to the pods of the node.
+	IPAMReady corev1.NodeConditionType = "AzureCNIIPAMReady"
+	// DatapathReady is True when the datapath of the node passed the CNS self-test.
+	DatapathReady corev1.NodeConditionType = "AzureCNIDatapathReady"
+	// HNSSvcReady is True when the HNS service of a windows node is running.
+	HNSSvcReady corev1.NodeConditionType = "HNSSvcReady"
+
+	reasonReady    = "Ready"
+	reasonNotReady = "NotReady"
+
+	// heartbeatPeriod is how often the conditions are published when none of them changed.
+	heartbeatPeriod = 5 * time.Minute
+)
+
+// Check returns an error while the signal it checks is unhealthy.
+type Check func(ctx context.Context) error
+
+// Condition is a node condition set from the result of its check.
+type Condition struct {
+	Type  corev1.NodeConditionType
+	Check Check
+}
+
+// Config of the publisher.
+type Config struct {
+	NodeName string
+	Interval time.Duration
+	// FailureThreshold is the number of failed checks in a row which turn a condition False.
+	FailureThreshold int
+	// SuccessThreshold is the number of passed checks in a row which turn a condition True.
+	SuccessThreshold int
+}
+
+// Nodes patches the conditions of a node.
+type Nodes interface {
+	PatchConditions(ctx context.Context, nodeName string, conditions []corev1.NodeCondition) error
+}
+
+// conditionState tracks the published status of a condition and the results of its checks since.
+type conditionState struct {
+	condition corev1.NodeCondition
+	successes int
+	failures  int
+}
+
+// Publisher runs the checks of the conditions and publishes them on the node.
+type Publisher struct {
+	cfg           Config
+	nodes         Nodes
+	conditions    []Condition
+	states        []conditionState
+	lastPublished time.Time
+	dirty         bool
+	log           *zap.Logger
+	now           func() time.Time
+}
+
+// New creates a publisher of the conditions on the node in cfg. The conditions are Unknown until their checks passed
+// or failed enough times.
+func New(cfg Config, nodes Nodes, conditions []Condition, logger *zap.Logger) *Publisher {
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.SuccessThreshold < 1 {
+		cfg.SuccessThreshold = 1
+	}
+	p := &Publisher{
+		cfg:        cfg,
+		nodes:      nodes,
+		conditions: conditions,
+		states:     make([]conditionState, len(conditions)),
+		log:        logger.With(zap.String("component", "node-conditions")),
+		now:        time.Now,
+	}
+	for i := range conditions {
+		p.states[i].condition = corev1.NodeCondition{
+			Type:   conditions[i].Type,
+			Status: corev1.ConditionUnknown,
+		}
+	}
+	return p
+}
+
+// Run checks and publishes the conditions every interval until ctx is cancelled.
+func (p *Publisher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.reconcile(ctx); err != nil {
+			p.log.Error("failed to publish node conditions", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err() //nolint:wrapcheck // the context error is the cause
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile runs the checks, and publishes the conditions when one of them changed since they were last published or
+// the heartbeat is due.
+func (p *Publisher) reconcile(ctx context.Context) error {
+	now := metav1.NewTime(p.now())
+	for i := range p.conditions {
+		if p.update(&p.states[i], p.conditions[i].Check(ctx), now) {
+			p.dirty = true
+		}
+	}
+	if !p.dirty && now.Sub(p.lastPublished) < heartbeatPeriod {
+		return nil
+	}
+
+	conditions := make([]corev1.NodeCondition, len(p.states))
+	for i := range p.states {
+		p.states[i].condition.LastHeartbeatTime = now
+		conditions[i] = p.states[i].condition
+	}
+	if err := p.nodes.PatchConditions(ctx, p.cfg.NodeName, conditions); err != nil {
+		return err //nolint:wrapcheck // the node client wraps its errors
+	}
+	p.lastPublished, p.dirty = now.Time, false
+	return nil
+}
+
+// update records the result of a check, and returns whether it changed the status or message of the condition.
+func (p *Publisher) update(state *conditionState, err error, now metav1.Time) bool {
+	status, reason, message := corev1.ConditionTrue, reasonReady, ""
+	if err != nil {
+		state.successes, state.failures = 0, state.failures+1
+		if state.failures < p.cfg.FailureThreshold {
+			return false
+		}
+		status, reason, message = corev1.ConditionFalse, reasonNotReady, err.Error()
+	} else {
+		state.successes, state.failures = state.successes+1, 0
+		if state.successes < p.cfg.SuccessThreshold {
+			return false
+		}
+	}
+
+	c := &state.condition
+	if c.Status == status && c.Message == message {
+		return false
+	}
+	if c.Status != status {
+		c.LastTransitionTime = now
+		p.log.Info("node condition changed", zap.String("type", string(c.Type)), zap.String("status", string(status)),
+			zap.String("message", message))
+	}
+	c.Status, c.Reason, c.Message = status, reason, message
+	return true
+}
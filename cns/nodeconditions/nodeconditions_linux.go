@@ -0,0 +1,6 @@
+package nodeconditions
+
+// PlatformConditions returns the conditions specific to the platform, none on linux.
+func PlatformConditions() []Condition {
+	return nil
+}
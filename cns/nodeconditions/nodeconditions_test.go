@@ -0,0 +1,86 @@
+package nodeconditions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var errUnhealthy = errors.New("unhealthy")
+
+type fakeNodes struct {
+	patches [][]corev1.NodeCondition
+}
+
+func (f *fakeNodes) PatchConditions(_ context.Context, _ string, conditions []corev1.NodeCondition) error {
+	f.patches = append(f.patches, conditions)
+	return nil
+}
+
+func TestPublisherThresholds(t *testing.T) {
+	var ipamErr error
+	nodes := &fakeNodes{}
+	p := New(Config{NodeName: "node", FailureThreshold: 2, SuccessThreshold: 2}, nodes, []Condition{
+		{Type: IPAMReady, Check: func(context.Context) error { return ipamErr }},
+		{Type: DatapathReady, Check: func(context.Context) error { return nil }},
+	}, zap.NewNop())
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	status := func() []corev1.ConditionStatus {
+		last := nodes.patches[len(nodes.patches)-1]
+		return []corev1.ConditionStatus{last[0].Status, last[1].Status}
+	}
+
+	// the conditions are published as unknown until the checks passed enough times
+	require.NoError(t, p.reconcile(context.Background()))
+	require.Len(t, nodes.patches, 1)
+	assert.Equal(t, []corev1.ConditionStatus{corev1.ConditionUnknown, corev1.ConditionUnknown}, status())
+
+	require.NoError(t, p.reconcile(context.Background()))
+	require.Len(t, nodes.patches, 2)
+	assert.Equal(t, []corev1.ConditionStatus{corev1.ConditionTrue, corev1.ConditionTrue}, status())
+
+	// a single failure doesn't flip the condition, and nothing is published while nothing changed
+	ipamErr = errUnhealthy
+	require.NoError(t, p.reconcile(context.Background()))
+	assert.Len(t, nodes.patches, 2)
+
+	require.NoError(t, p.reconcile(context.Background()))
+	require.Len(t, nodes.patches, 3)
+	assert.Equal(t, []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionTrue}, status())
+	assert.Equal(t, errUnhealthy.Error(), nodes.patches[2][0].Message)
+	assert.Equal(t, reasonNotReady, nodes.patches[2][0].Reason)
+
+	// the unchanged conditions are published again on the heartbeat
+	now = now.Add(heartbeatPeriod)
+	require.NoError(t, p.reconcile(context.Background()))
+	require.Len(t, nodes.patches, 4)
+	assert.Equal(t, []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionTrue}, status())
+	assert.Equal(t, nodes.patches[2][0].LastTransitionTime, nodes.patches[3][0].LastTransitionTime)
+}
+
+func TestNodeClientPatchConditions(t *testing.T) {
+	cs := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+	})
+	c := NewNodeClient(cs)
+
+	require.NoError(t, c.PatchConditions(context.Background(), "node", []corev1.NodeCondition{{Type: IPAMReady, Status: corev1.ConditionFalse}}))
+	require.NoError(t, c.PatchConditions(context.Background(), "node", []corev1.NodeCondition{{Type: IPAMReady, Status: corev1.ConditionTrue}}))
+
+	node, err := cs.CoreV1().Nodes().Get(context.Background(), "node", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		{Type: IPAMReady, Status: corev1.ConditionTrue},
+	}, node.Status.Conditions)
+}
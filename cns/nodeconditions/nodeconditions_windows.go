@@ -0,0 +1,39 @@
+package nodeconditions
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+var errHNSNotRunning = errors.New("hns service is not running")
+
+// PlatformConditions returns the conditions specific to the platform, the state of the HNS service on windows.
+func PlatformConditions() []Condition {
+	return []Condition{{Type: HNSSvcReady, Check: checkHNSService}}
+}
+
+func checkHNSService(context.Context) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "could not connect to service manager")
+	}
+	defer m.Disconnect() //nolint:errcheck // ignore error
+
+	service, err := m.OpenService("hns")
+	if err != nil {
+		return errors.Wrap(err, "could not access service")
+	}
+	defer service.Close()
+
+	status, err := service.Query()
+	if err != nil {
+		return errors.Wrap(err, "could not query service")
+	}
+	if status.State != svc.Running {
+		return errors.Wrapf(errHNSNotRunning, "state %d", status.State)
+	}
+	return nil
+}
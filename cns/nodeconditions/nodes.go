@@ -0,0 +1,34 @@
+package nodeconditions
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeClient patches the conditions of nodes through the kubernetes api.
+type NodeClient struct {
+	cs kubernetes.Interface
+}
+
+func NewNodeClient(cs kubernetes.Interface) *NodeClient {
+	return &NodeClient{cs: cs}
+}
+
+// PatchConditions merges the conditions into the status of the node by their type, leaving the other conditions alone.
+func (c *NodeClient) PatchConditions(ctx context.Context, nodeName string, conditions []corev1.NodeCondition) error {
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"conditions": conditions,
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal node status patch")
+	}
+
+	_, err = c.cs.CoreV1().Nodes().PatchStatus(ctx, nodeName, patch)
+	return errors.Wrapf(err, "failed to patch the conditions of node %s", nodeName)
+}
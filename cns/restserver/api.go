@@ -516,40 +516,23 @@ func (service *HTTPRestService) createOrUpdateNetworkContainer(w http.ResponseWr
 
 	logger.Request(service.Name, req.String(), nil)
 	var returnCode types.ResponseCode
-	var returnMessage string
+	var returnMessage, operationID string
 	var err error
 	switch r.Method {
 	case http.MethodPost:
-		if req.NetworkContainerType == cns.WebApps {
-			// try to get the saved nc state if it exists
-			existing, ok := service.getNetworkContainerDetails(req.NetworkContainerid)
-
-			// create/update nc only if it doesn't exist or it exists and the requested version is different from the saved version
-			if !ok || (ok && existing.VMVersion != req.Version) {
-				nc := service.networkContainer
-				if err = nc.Create(req); err != nil {
-					returnMessage = fmt.Sprintf("[Azure CNS] Error. CreateOrUpdateNetworkContainer failed %v", err.Error())
-					returnCode = types.UnexpectedError
-					break
-				}
-			}
-		} else if req.NetworkContainerType == cns.AzureContainerInstance {
-			// try to get the saved nc state if it exists
-			existing, ok := service.getNetworkContainerDetails(req.NetworkContainerid)
-
-			// create/update nc only if it doesn't exist or it exists and the requested version is different from the saved version
-			if ok && existing.VMVersion != req.Version {
-				nc := service.networkContainer
-				netPluginConfig := service.getNetPluginDetails()
-				if err = nc.Update(req, netPluginConfig); err != nil {
-					returnMessage = fmt.Sprintf("[Azure CNS] Error. CreateOrUpdateNetworkContainer failed %v", err.Error())
-					returnCode = types.UnexpectedError
-					break
+		if isAsync(r) {
+			op := service.operations.start(operationCreateOrUpdateNC)
+			operationID = op.id
+			go func() {
+				code, message := service.createOrUpdateNetworkContainerGoalState(req, op)
+				op.finish(code, message)
+				if code == types.Success {
+					logNCSnapshot(req)
 				}
-			}
+			}()
+			break
 		}
-
-		returnCode, returnMessage = service.saveNetworkContainerGoalState(req)
+		returnCode, returnMessage = service.createOrUpdateNetworkContainerGoalState(req, nil)
 
 	default:
 		returnMessage = "[Azure CNS] Error. CreateOrUpdateNetworkContainer did not receive a POST."
@@ -561,17 +544,61 @@ func (service *HTTPRestService) createOrUpdateNetworkContainer(w http.ResponseWr
 		Message:    returnMessage,
 	}
 
-	reserveResp := &cns.CreateNetworkContainerResponse{Response: resp}
+	reserveResp := &cns.CreateNetworkContainerResponse{Response: resp, OperationID: operationID}
 	err = common.Encode(w, &reserveResp)
 
 	// If the NC was created successfully, log NC snapshot.
-	if returnCode == types.Success {
+	if returnCode == types.Success && operationID == "" {
 		logNCSnapshot(req)
 	}
 
 	logger.Response(service.Name, reserveResp, resp.ReturnCode, err)
 }
 
+// createOrUpdateNetworkContainerGoalState creates or updates the network container of the request, and saves its goal
+// state, reporting its progress to the operation of an async request.
+func (service *HTTPRestService) createOrUpdateNetworkContainerGoalState(req cns.CreateNetworkContainerRequest, op *operation) (types.ResponseCode, string) {
+	pass := service.ncProgramming.start(req.NetworkContainerid, req.Version)
+	defer pass.finish()
+
+	op.progress("ProgrammingNetworkContainer", 0)
+	if req.NetworkContainerType == cns.WebApps {
+		// try to get the saved nc state if it exists
+		existing, ok := service.getNetworkContainerDetails(req.NetworkContainerid)
+
+		// create/update nc only if it doesn't exist or it exists and the requested version is different from the saved version
+		if !ok || (ok && existing.VMVersion != req.Version) {
+			nc := service.networkContainer
+			if err := nc.Create(req); err != nil {
+				message := fmt.Sprintf("[Azure CNS] Error. CreateOrUpdateNetworkContainer failed %v", err.Error())
+				pass.record(ncStepNetworkContainer, types.UnexpectedError, message)
+				return types.UnexpectedError, message
+			}
+			pass.record(ncStepNetworkContainer, types.Success, "")
+		}
+	} else if req.NetworkContainerType == cns.AzureContainerInstance {
+		// try to get the saved nc state if it exists
+		existing, ok := service.getNetworkContainerDetails(req.NetworkContainerid)
+
+		// create/update nc only if it doesn't exist or it exists and the requested version is different from the saved version
+		if ok && existing.VMVersion != req.Version {
+			nc := service.networkContainer
+			netPluginConfig := service.getNetPluginDetails()
+			if err := nc.Update(req, netPluginConfig); err != nil {
+				message := fmt.Sprintf("[Azure CNS] Error. CreateOrUpdateNetworkContainer failed %v", err.Error())
+				pass.record(ncStepNetworkContainer, types.UnexpectedError, message)
+				return types.UnexpectedError, message
+			}
+			pass.record(ncStepNetworkContainer, types.Success, "")
+		}
+	}
+
+	op.progress("SavingGoalState", 50)
+	returnCode, returnMessage := service.saveNetworkContainerGoalState(req)
+	pass.record(ncStepGoalState, returnCode, returnMessage)
+	return returnCode, returnMessage
+}
+
 func (service *HTTPRestService) getNetworkContainerByID(w http.ResponseWriter, r *http.Request) {
 	logger.Printf("[Azure CNS] getNetworkContainerByID")
 
@@ -694,47 +721,20 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 		returnMessage = "[Azure CNS] Error. NetworkContainerid is empty"
 	}
 
+	var operationID string
 	switch r.Method {
 	case http.MethodPost:
-		var containerStatus containerstatus
-		var ok bool
-
-		containerStatus, ok = service.getNetworkContainerDetails(ncid)
-
-		if !ok {
-			logger.Printf("Not able to retrieve network container details for this container id %v", ncid)
+		if isAsync(r) && returnCode == types.Success {
+			op := service.operations.start(operationDeleteNC)
+			operationID = op.id
+			go func() {
+				op.finish(service.deleteNetworkContainerState(ncid, op))
+			}()
 			break
 		}
-
-		if containerStatus.CreateNetworkContainerRequest.NetworkContainerType == cns.WebApps {
-			nc := service.networkContainer
-			if deleteErr := nc.Delete(ncid); deleteErr != nil { // nolint:gocritic
-				returnMessage = fmt.Sprintf("[Azure CNS] Error. DeleteNetworkContainer failed %v", deleteErr.Error())
-				returnCode = types.UnexpectedError
-				break
-			}
-		}
-
-		service.Lock()
-		defer service.Unlock()
-
-		if service.state.ContainerStatus != nil {
-			delete(service.state.ContainerStatus, ncid)
-		}
-
-		if service.state.ContainerIDByOrchestratorContext != nil {
-			for orchestratorContext, networkContainerIDs := range service.state.ContainerIDByOrchestratorContext { //nolint:gocritic // copy is ok
-				if networkContainerIDs.Contains(ncid) {
-					networkContainerIDs.Delete(ncid)
-					if *networkContainerIDs == "" {
-						delete(service.state.ContainerIDByOrchestratorContext, orchestratorContext)
-						break
-					}
-				}
-			}
+		if code, message := service.deleteNetworkContainerState(ncid, nil); code != types.Success {
+			returnCode, returnMessage = code, message
 		}
-
-		service.saveState()
 	default:
 		returnMessage = "[Azure CNS] Error. DeleteNetworkContainer did not receive a POST."
 		returnCode = types.InvalidParameter
@@ -745,11 +745,53 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 		Message:    returnMessage,
 	}
 
-	reserveResp := &cns.DeleteNetworkContainerResponse{Response: resp}
+	reserveResp := &cns.DeleteNetworkContainerResponse{Response: resp, OperationID: operationID}
 	err = common.Encode(w, &reserveResp)
 	logger.Response(service.Name, reserveResp, resp.ReturnCode, err)
 }
 
+// deleteNetworkContainerState deletes the network container and its saved state, reporting its progress to the
+// operation of an async request.
+func (service *HTTPRestService) deleteNetworkContainerState(ncid string, op *operation) (types.ResponseCode, string) {
+	containerStatus, ok := service.getNetworkContainerDetails(ncid)
+	if !ok {
+		logger.Printf("Not able to retrieve network container details for this container id %v", ncid)
+		return types.Success, ""
+	}
+
+	if containerStatus.CreateNetworkContainerRequest.NetworkContainerType == cns.WebApps {
+		op.progress("DeletingNetworkContainer", 0)
+		nc := service.networkContainer
+		if deleteErr := nc.Delete(ncid); deleteErr != nil {
+			return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. DeleteNetworkContainer failed %v", deleteErr.Error())
+		}
+	}
+
+	op.progress("SavingState", 50)
+	service.Lock()
+	defer service.Unlock()
+
+	if service.state.ContainerStatus != nil {
+		delete(service.state.ContainerStatus, ncid)
+	}
+	service.ncProgramming.forget(ncid)
+
+	if service.state.ContainerIDByOrchestratorContext != nil {
+		for orchestratorContext, networkContainerIDs := range service.state.ContainerIDByOrchestratorContext { //nolint:gocritic // copy is ok
+			if networkContainerIDs.Contains(ncid) {
+				networkContainerIDs.Delete(ncid)
+				if *networkContainerIDs == "" {
+					delete(service.state.ContainerIDByOrchestratorContext, orchestratorContext)
+					break
+				}
+			}
+		}
+	}
+
+	service.saveState()
+	return types.Success, ""
+}
+
 func (service *HTTPRestService) getInterfaceForContainer(w http.ResponseWriter, r *http.Request) {
 	logger.Printf("[Azure CNS] getInterfaceForContainer")
 
@@ -1148,11 +1190,23 @@ func (service *HTTPRestService) CreateHostNCApipaEndpoint(w http.ResponseWriter,
 					"AllowNCToHostCommunication or AllowHostToNCCommunication is set to true")
 				returnCode = types.InvalidRequest
 			} else {
-				if endpointID, err = hnsclient.CreateHostNCApipaEndpoint(
+				var (
+					localIPConfiguration cns.IPConfiguration
+					loopbackIPAddress    string
+				)
+				if localIPConfiguration, loopbackIPAddress, err = service.allocateHostNCApipaIP(
 					req.NetworkContainerID,
-					networkContainerDetails.CreateNetworkContainerRequest.LocalIPConfiguration,
+					networkContainerDetails.CreateNetworkContainerRequest.LocalIPConfiguration); err != nil {
+					returnMessage = fmt.Sprintf("CreateHostNCApipaEndpoint failed with error: %v", err)
+					returnCode = types.UnexpectedError
+				} else if endpointID, err = hnsclient.CreateHostNCApipaEndpoint(
+					req.NetworkContainerID,
+					localIPConfiguration,
+					loopbackIPAddress,
 					networkContainerDetails.CreateNetworkContainerRequest.AllowNCToHostCommunication,
 					networkContainerDetails.CreateNetworkContainerRequest.AllowHostToNCCommunication,
+					networkContainerDetails.CreateNetworkContainerRequest.NCToHostPortRules,
+					networkContainerDetails.CreateNetworkContainerRequest.HostToNCPortRules,
 					networkContainerDetails.CreateNetworkContainerRequest.EndpointPolicies); err != nil {
 					returnMessage = fmt.Sprintf("CreateHostNCApipaEndpoint failed with error: %v", err)
 					returnCode = types.UnexpectedError
@@ -1202,6 +1256,10 @@ func (service *HTTPRestService) DeleteHostNCApipaEndpoint(w http.ResponseWriter,
 			returnMessage = fmt.Sprintf("Failed to delete endpoint for Network Container: %s "+
 				"due to error: %v", req.NetworkContainerID, err)
 			returnCode = types.UnexpectedError
+		} else if err = service.releaseHostNCApipaIP(req.NetworkContainerID); err != nil {
+			returnMessage = fmt.Sprintf("Failed to release the apipa ip of Network Container: %s "+
+				"due to error: %v", req.NetworkContainerID, err)
+			returnCode = types.UnexpectedError
 		}
 	default:
 		returnMessage = "deleteHostNCApipaEndpoint API expects a DELETE"
@@ -8,12 +8,14 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -33,9 +35,9 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-const (
-	cnsJsonFileName = "azure-cns.json"
-)
+// cnsJsonFileName is the store of the test service, under a temp dir created by TestMain so that the tests don't
+// leave it in the tree.
+var cnsJsonFileName = "azure-cns.json"
 
 type IPAddress struct {
 	XMLName   xml.Name `xml:"IPAddress"`
@@ -174,6 +176,20 @@ func TestMain(m *testing.M) {
 	var err error
 	logger.InitLogger("testlogs", 0, 0, "./")
 
+	// the workers of go test -fuzz run the fuzz targets alone, which don't call the service over the network, and
+	// can't bind its ports while the coordinating process holds them
+	flag.Parse()
+	if fuzzWorker := flag.Lookup("test.fuzzworker"); fuzzWorker != nil && fuzzWorker.Value.String() == "true" {
+		os.Exit(m.Run())
+	}
+
+	stateDir, err := os.MkdirTemp("", "azure-cns")
+	if err != nil {
+		fmt.Printf("Failed to create CNS state dir. Error: %v", err)
+		os.Exit(1)
+	}
+	cnsJsonFileName = filepath.Join(stateDir, cnsJsonFileName)
+
 	// Create the service. If CRD channel mode is needed, then at the start of the test,
 	// it can stop the service (service.Stop), invoke startService again with new ServiceConfig (with CRD mode)
 	// perform the test and then restore the service again.
@@ -208,6 +224,7 @@ func TestMain(m *testing.M) {
 	// Cleanup.
 	service.Stop()
 	nmAgentServer.Stop()
+	os.RemoveAll(stateDir)
 
 	os.Exit(exitCode)
 }
@@ -6,8 +6,10 @@ const (
 	// Key against which CNS state is persisted.
 	storeKey         = "ContainerNetworkService"
 	EndpointStoreKey = "Endpoints"
-	attach           = "Attach"
-	detach           = "Detach"
+	// Key against which the IP reservations are persisted, in the store of the CNS state.
+	ipReservationsStoreKey = "IPReservations"
+	attach                 = "Attach"
+	detach                 = "Detach"
 	// Rest service state identifier for named lock
 	stateJoinedNetworks = "JoinedNetworks"
 	dncApiVersion       = "?api-version=2018-03-01"
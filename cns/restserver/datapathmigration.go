@@ -0,0 +1,151 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	cniapi "github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+const (
+	defaultDatapathMigrationBatchSize    = 10
+	defaultDatapathMigrationIntervalSecs = 5
+)
+
+// DatapathMigrator migrates a batch of the endpoints of the cni to a datapath generation, the cni client does it.
+type DatapathMigrator interface {
+	MigrateDatapath(req cniapi.DatapathMigrationRequest) (*cniapi.DatapathMigrationProgress, error)
+}
+
+// datapathMigration holds the migrator of the node and the operation of the migration running on it, if any.
+type datapathMigration struct {
+	sync.Mutex
+	migrator DatapathMigrator
+	running  string // id of the running operation
+	sleep    func(time.Duration)
+}
+
+// SetDatapathMigrator sets the migrator the endpoints are migrated to a datapath generation with through the API.
+func (service *HTTPRestService) SetDatapathMigrator(migrator DatapathMigrator) {
+	service.datapathMigration.Lock()
+	defer service.datapathMigration.Unlock()
+	service.datapathMigration.migrator = migrator
+}
+
+// datapathMigrationHandler starts a paced migration of the endpoints to a datapath generation on a POST, and returns
+// the operation its progress is polled from. Only one migration runs at a time.
+func (service *HTTPRestService) datapathMigrationHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "datapathMigrationHandler"
+	var response cns.DatapathMigrationResponse
+
+	service.datapathMigration.Lock()
+	defer service.datapathMigration.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		var req cns.DatapathMigrationRequest
+		err := common.Decode(w, r, &req)
+		logger.Request(service.Name, &req, err)
+		if err != nil {
+			return
+		}
+		switch {
+		case service.datapathMigration.migrator == nil:
+			response.Response = cns.Response{
+				ReturnCode: types.UnsupportedAPI,
+				Message:    "[Azure CNS] datapathMigration API needs the cni of the node.",
+			}
+		case req.BatchSize < 0 || req.IntervalSecs < 0:
+			response.Response = cns.Response{
+				ReturnCode: types.InvalidParameter,
+				Message:    fmt.Sprintf("[Azure CNS] %s got a negative batch size or interval %+v", opName, req),
+			}
+		case service.datapathMigration.running != "":
+			response.Response = cns.Response{
+				ReturnCode: types.InvalidRequest,
+				Message:    fmt.Sprintf("[Azure CNS] %s found migration %s still running", opName, service.datapathMigration.running),
+			}
+			response.OperationID = service.datapathMigration.running
+		default:
+			op := service.operations.start(operationMigrateDatapath)
+			service.datapathMigration.running = op.id
+			response.OperationID = op.id
+			go service.migrateDatapath(req, op)
+		}
+	default:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] datapathMigration API expects a POST.",
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// migrateDatapath has the cni migrate the endpoints batch by batch, reporting the endpoints gone through to the
+// operation. Endpoints which fail to migrate are left to be migrated when the cni next changes them, and fail the
+// operation once all the batches are done.
+func (service *HTTPRestService) migrateDatapath(req cns.DatapathMigrationRequest, op *operation) {
+	m := &service.datapathMigration
+	defer func() {
+		m.Lock()
+		m.running = ""
+		m.Unlock()
+	}()
+
+	m.Lock()
+	migrator, sleep := m.migrator, m.sleep
+	m.Unlock()
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	batch := cniapi.DatapathMigrationRequest{Generation: -1, BatchSize: req.BatchSize}
+	if req.Generation != nil {
+		batch.Generation = *req.Generation
+	}
+	if batch.BatchSize == 0 {
+		batch.BatchSize = defaultDatapathMigrationBatchSize
+	}
+	interval := time.Duration(req.IntervalSecs) * time.Second
+	if req.IntervalSecs == 0 {
+		interval = defaultDatapathMigrationIntervalSecs * time.Second
+	}
+
+	var migrated, failed int
+	for {
+		progress, err := migrator.MigrateDatapath(batch)
+		if err != nil {
+			op.finish(types.UnexpectedError, fmt.Sprintf("failed to migrate the datapath after %d endpoints: %v", migrated+failed, err))
+			return
+		}
+
+		migrated += progress.Migrated
+		failed += progress.Failed
+		done, percent := migrated+failed, 100 //nolint:gomnd // percent
+		if progress.Remaining > 0 {
+			percent = done * 100 / (done + progress.Remaining) //nolint:gomnd // percent
+		}
+		op.progress(fmt.Sprintf("migrated %d and failed %d endpoints to datapath generation %d, %d left",
+			migrated, failed, progress.Generation, progress.Remaining), percent)
+
+		if progress.Remaining == 0 {
+			break
+		}
+		batch.After = progress.Last
+		sleep(interval)
+	}
+
+	if failed > 0 {
+		op.finish(types.UnexpectedError, fmt.Sprintf("failed to migrate %d endpoints, they are migrated when the cni next changes them", failed))
+		return
+	}
+	op.finish(types.Success, "")
+}
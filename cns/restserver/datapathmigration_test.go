@@ -0,0 +1,135 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	cniapi "github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDatapathMigrator goes through endpoints named by their index, failing the ones in failed.
+type fakeDatapathMigrator struct {
+	sync.Mutex
+	endpoints int
+	failed    map[int]bool
+	err       error
+	requests  []cniapi.DatapathMigrationRequest
+	release   chan struct{}
+}
+
+func (m *fakeDatapathMigrator) MigrateDatapath(req cniapi.DatapathMigrationRequest) (*cniapi.DatapathMigrationProgress, error) {
+	if m.release != nil {
+		<-m.release
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.requests = append(m.requests, req)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	start := 0
+	if req.After != "" {
+		start = int(req.After[0]-'a') + 1
+	}
+	progress := &cniapi.DatapathMigrationProgress{Generation: 1, Last: req.After}
+	i := start
+	for ; i < m.endpoints && i < start+req.BatchSize; i++ {
+		if m.failed[i] {
+			progress.Failed++
+		} else {
+			progress.Migrated++
+		}
+		progress.Last = string(rune('a' + i))
+	}
+	progress.Remaining = m.endpoints - i
+	return progress, nil
+}
+
+func TestDatapathMigrationHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.datapathMigration.sleep = func(time.Duration) {}
+
+	do := func(method string, body interface{}) cns.DatapathMigrationResponse {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		svc.datapathMigrationHandler(w, httptest.NewRequest(method, cns.DatapathMigrationPath, &buf))
+		var resp cns.DatapathMigrationResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+	finished := func(id string) cns.Operation {
+		var op cns.Operation
+		require.Eventually(t, func() bool {
+			op, _ = svc.operations.get(id)
+			return op.Phase != cns.OperationRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		return op
+	}
+
+	resp := do(http.MethodPost, cns.DatapathMigrationRequest{})
+	assert.Equal(t, types.UnsupportedAPI, resp.Response.ReturnCode)
+
+	migrator := &fakeDatapathMigrator{endpoints: 5}
+	svc.SetDatapathMigrator(migrator)
+
+	resp = do(http.MethodPost, cns.DatapathMigrationRequest{BatchSize: -1})
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+
+	generation := 1
+	resp = do(http.MethodPost, cns.DatapathMigrationRequest{Generation: &generation, BatchSize: 2})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	op := finished(resp.OperationID)
+	assert.Equal(t, cns.OperationSucceeded, op.Phase)
+	assert.Equal(t, 100, op.Percent)
+	assert.Equal(t, []cniapi.DatapathMigrationRequest{
+		{Generation: 1, BatchSize: 2},
+		{Generation: 1, After: "b", BatchSize: 2},
+		{Generation: 1, After: "d", BatchSize: 2},
+	}, migrator.requests)
+
+	// failed endpoints don't stop the migration, but fail the operation
+	migrator = &fakeDatapathMigrator{endpoints: 3, failed: map[int]bool{1: true}}
+	svc.SetDatapathMigrator(migrator)
+	resp = do(http.MethodPost, cns.DatapathMigrationRequest{})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	op = finished(resp.OperationID)
+	assert.Equal(t, cns.OperationFailed, op.Phase)
+	assert.Contains(t, op.Error.Message, "failed to migrate 1 endpoints")
+	assert.Equal(t, -1, migrator.requests[0].Generation)
+	assert.Equal(t, defaultDatapathMigrationBatchSize, migrator.requests[0].BatchSize)
+
+	migrator = &fakeDatapathMigrator{err: errors.New("cni failed")}
+	svc.SetDatapathMigrator(migrator)
+	resp = do(http.MethodPost, cns.DatapathMigrationRequest{})
+	op = finished(resp.OperationID)
+	assert.Equal(t, cns.OperationFailed, op.Phase)
+	assert.Contains(t, op.Error.Message, "cni failed")
+
+	// only one migration runs at a time
+	migrator = &fakeDatapathMigrator{endpoints: 1, release: make(chan struct{})}
+	svc.SetDatapathMigrator(migrator)
+	resp = do(http.MethodPost, cns.DatapathMigrationRequest{})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	running := do(http.MethodPost, cns.DatapathMigrationRequest{})
+	assert.Equal(t, types.InvalidRequest, running.Response.ReturnCode)
+	assert.Equal(t, resp.OperationID, running.OperationID)
+	close(migrator.release)
+	assert.Equal(t, cns.OperationSucceeded, finished(resp.OperationID).Phase)
+
+	resp = do(http.MethodGet, nil)
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
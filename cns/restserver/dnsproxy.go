@@ -0,0 +1,43 @@
+package restserver
+
+import (
+	"net/netip"
+
+	"github.com/Azure/azure-container-networking/cns/dnsproxy"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+)
+
+// DNSTenant returns the network container whose snat local IP is source, so that the DNS proxy can forward queries
+// from its pods to the DNS servers of the network container, or to Azure DNS when it has none.
+func (service *HTTPRestService) DNSTenant(source netip.Addr) (dnsproxy.Tenant, bool) {
+	service.RLock()
+	defer service.RUnlock()
+
+	for ncID := range service.state.ContainerStatus {
+		req := service.state.ContainerStatus[ncID].CreateNetworkContainerRequest
+		localIP, err := netip.ParseAddr(req.LocalIPConfiguration.IPSubnet.IPAddress)
+		if err != nil || localIP != source {
+			continue
+		}
+
+		tenant := dnsproxy.Tenant{ID: ncID}
+		for _, server := range req.IPConfiguration.DNSServers {
+			addr, err := netip.ParseAddr(server)
+			if err != nil {
+				logger.Errorf("[Azure CNS] Ignoring invalid DNS server %s of NC %s: %v", server, ncID, err)
+				continue
+			}
+			tenant.Resolvers = append(tenant.Resolvers, netip.AddrPortFrom(addr, iptables.DNSPort))
+		}
+
+		if len(tenant.Resolvers) == 0 {
+			tenant.Resolvers = []netip.AddrPort{netip.AddrPortFrom(netip.MustParseAddr(networkutils.AzureDNS), iptables.DNSPort)}
+		}
+
+		return tenant, true
+	}
+
+	return dnsproxy.Tenant{}, false
+}
@@ -0,0 +1,61 @@
+package restserver
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/dnsproxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSTenant(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.state.ContainerStatus = map[string]containerstatus{
+		"nc-custom-dns": {
+			CreateNetworkContainerRequest: cns.CreateNetworkContainerRequest{
+				LocalIPConfiguration: cns.IPConfiguration{IPSubnet: cns.IPSubnet{IPAddress: "169.254.128.10", PrefixLength: 17}},
+				IPConfiguration:      cns.IPConfiguration{DNSServers: []string{"10.0.0.10", "invalid"}},
+			},
+		},
+		"nc-azure-dns": {
+			CreateNetworkContainerRequest: cns.CreateNetworkContainerRequest{
+				LocalIPConfiguration: cns.IPConfiguration{IPSubnet: cns.IPSubnet{IPAddress: "169.254.128.11", PrefixLength: 17}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   dnsproxy.Tenant
+		wantOK bool
+	}{
+		{
+			name:   "nc dns servers",
+			source: "169.254.128.10",
+			want:   dnsproxy.Tenant{ID: "nc-custom-dns", Resolvers: []netip.AddrPort{netip.MustParseAddrPort("10.0.0.10:53")}},
+			wantOK: true,
+		},
+		{
+			name:   "azure dns when nc has no dns servers",
+			source: "169.254.128.11",
+			want:   dnsproxy.Tenant{ID: "nc-azure-dns", Resolvers: []netip.AddrPort{netip.MustParseAddrPort("168.63.129.16:53")}},
+			wantOK: true,
+		},
+		{
+			name:   "unknown source",
+			source: "169.254.128.12",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := svc.DNSTenant(netip.MustParseAddr(tt.source))
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
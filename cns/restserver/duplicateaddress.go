@@ -0,0 +1,168 @@
+package restserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// maxDuplicateAddressAttempts is how many times a pod is assigned other IPs when hosts answer for its IPs.
+	maxDuplicateAddressAttempts = 3
+	duplicateAddressReason      = "DuplicateAddress"
+)
+
+// addressProber probes the link of the interface for the hosts using the ip, returning the macs of the ones which
+// answered within the timeout.
+type addressProber func(ifName string, ip net.IP, timeout time.Duration) ([]net.HardwareAddr, error)
+
+// duplicateAddressDetection probes the vnet for the IPs before they are returned to a pod, so that an IP another host
+// uses, such as one assigned to a VM by hand, is quarantined rather than given to the pod.
+type duplicateAddressDetection struct {
+	probe         addressProber // nil when the detection is disabled
+	ifName        string
+	probeTimeout  time.Duration
+	quarantine    time.Duration
+	ignoredMACs   map[string]struct{}
+	quarantinedAt map[string]time.Time // key : ip id, value : when a host answered for it
+}
+
+// EnableDuplicateAddressDetection probes the link of the interface for the IPs assigned to pods, the interface of the
+// host primary IP when ifName is empty. The IPs other hosts answer for are kept out of the pool for the quarantine. The
+// answers from the ignored macs, such as the one the vnet answers every arp request with, are no conflicts.
+func (service *HTTPRestService) EnableDuplicateAddressDetection(ifName string, probeTimeout, quarantine time.Duration, ignoredMACs []string) error {
+	probe, err := newAddressProber()
+	if err != nil {
+		return err
+	}
+	ignored := make(map[string]struct{}, len(ignoredMACs))
+	for _, s := range ignoredMACs {
+		mac, err := net.ParseMAC(s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid ignored mac %s", s)
+		}
+		ignored[mac.String()] = struct{}{}
+	}
+
+	service.Lock()
+	defer service.Unlock()
+	service.duplicateAddressDetection = duplicateAddressDetection{
+		probe:         probe,
+		ifName:        ifName,
+		probeTimeout:  probeTimeout,
+		quarantine:    quarantine,
+		ignoredMACs:   ignored,
+		quarantinedAt: map[string]time.Time{},
+	}
+	logger.Printf("[EnableDuplicateAddressDetection] Probing the IPs assigned to pods for %s, quarantining the ones in use for %s",
+		probeTimeout, quarantine)
+	return nil
+}
+
+// ipQuarantinedUntransacted returns whether a host answered for the IP within its quarantine.
+func (service *HTTPRestService) ipQuarantinedUntransacted(ipID string, now time.Time) bool {
+	quarantinedAt, ok := service.duplicateAddressDetection.quarantinedAt[ipID]
+	if !ok {
+		return false
+	}
+	if now.Sub(quarantinedAt) >= service.duplicateAddressDetection.quarantine {
+		// the IP is probed again the next time it is assigned
+		delete(service.duplicateAddressDetection.quarantinedAt, ipID)
+		return false
+	}
+	return true
+}
+
+// quarantineDuplicateAddresses probes the vnet for the IPs assigned to the pod, and quarantines the ones other hosts
+// answered for. It returns how many were quarantined, the pod keeps its IPs either way. A probe which fails is logged and
+// doesn't quarantine its IP.
+func (service *HTTPRestService) quarantineDuplicateAddresses(ctx context.Context, podInfo cns.PodInfo) int {
+	service.Lock()
+	dad := service.duplicateAddressDetection
+	if dad.probe == nil {
+		service.Unlock()
+		return 0
+	}
+	if dad.ifName == "" {
+		ifName, err := service.primaryHostInterfaceNameUntransacted(ctx)
+		if err != nil {
+			service.Unlock()
+			logger.Errorf("[quarantineDuplicateAddresses] Not probing the IPs of pod %+v: %v", podInfo, err)
+			return 0
+		}
+		service.duplicateAddressDetection.ifName, dad.ifName = ifName, ifName
+	}
+	ipConfigs := make([]cns.IPConfigurationStatus, 0, len(service.PodIPIDByPodInterfaceKey[podInfo.Key()]))
+	for _, ipID := range service.PodIPIDByPodInterfaceKey[podInfo.Key()] {
+		ipConfigs = append(ipConfigs, service.PodIPConfigState[ipID])
+	}
+	service.Unlock()
+
+	// the IPs are probed without the lock, the pods being assigned other IPs meanwhile
+	conflicts := map[string][]net.HardwareAddr{}
+	for i := range ipConfigs {
+		ip := net.ParseIP(ipConfigs[i].IPAddress)
+		macs, err := dad.probe(dad.ifName, ip, dad.probeTimeout)
+		if err != nil {
+			logger.Errorf("[quarantineDuplicateAddresses] Failed to probe IP %s of pod %+v: %v", ip, podInfo, err)
+			continue
+		}
+		for _, mac := range macs {
+			if _, ignored := dad.ignoredMACs[mac.String()]; !ignored {
+				conflicts[ipConfigs[i].ID] = append(conflicts[ipConfigs[i].ID], mac)
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return 0
+	}
+
+	service.Lock()
+	defer service.Unlock()
+	now := time.Now()
+	for i := range ipConfigs {
+		macs, found := conflicts[ipConfigs[i].ID]
+		if !found {
+			continue
+		}
+		service.duplicateAddressDetection.quarantinedAt[ipConfigs[i].ID] = now
+		duplicateAddressCount.Inc()
+		logger.Errorf("[quarantineDuplicateAddresses] Quarantining IP %s of %s for %s, hosts %v answered for it",
+			ipConfigs[i].IPAddress, ipConfigs[i].NCID, dad.quarantine, macs)
+		if service.nodeEvents != nil {
+			service.nodeEvents.Eventf(corev1.EventTypeWarning, duplicateAddressReason, "IP %s of NC %s is used by hosts %v, quarantined for %s",
+				ipConfigs[i].IPAddress, ipConfigs[i].NCID, macs, dad.quarantine)
+		}
+	}
+	return len(conflicts)
+}
+
+// primaryHostInterfaceNameUntransacted returns the name of the interface of the host primary IP.
+func (service *HTTPRestService) primaryHostInterfaceNameUntransacted(ctx context.Context) (string, error) {
+	primary, err := service.getPrimaryHostInterface(ctx)
+	if err != nil {
+		return "", err
+	}
+	primaryIP := net.ParseIP(primary.PrimaryIP)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list interfaces")
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(primaryIP) {
+				return ifaces[i].Name, nil
+			}
+		}
+	}
+	return "", errors.Errorf("no interface has the host primary IP %s", primary.PrimaryIP)
+}
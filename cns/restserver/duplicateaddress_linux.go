@@ -0,0 +1,10 @@
+package restserver
+
+import (
+	"github.com/Azure/azure-container-networking/network/networkutils"
+)
+
+// newAddressProber returns the prober of the IPs with arp and ndp probes.
+func newAddressProber() (addressProber, error) {
+	return networkutils.ProbeAddress, nil
+}
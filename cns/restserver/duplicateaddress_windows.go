@@ -0,0 +1,10 @@
+package restserver
+
+import (
+	"github.com/pkg/errors"
+)
+
+// newAddressProber refuses the detection, the IPs of the pods on windows can't be probed from the host.
+func newAddressProber() (addressProber, error) {
+	return nil, errors.New("duplicate address detection is not supported on windows")
+}
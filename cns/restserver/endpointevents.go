@@ -0,0 +1,190 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	// endpointEventLogSize is the number of events kept for the subscribers which fall behind.
+	endpointEventLogSize     = 1024
+	defaultEndpointEventWait = 30 * time.Second
+	maxEndpointEventWait     = 5 * time.Minute
+	sinceQueryKey            = "since"
+	timeoutQueryKey          = "timeout"
+)
+
+var errInvalidEndpointEventsQuery = errors.New("invalid endpoint events query")
+
+// endpointEventLog keeps the last endpoint events and wakes up the subscribers waiting for the next one.
+type endpointEventLog struct {
+	sync.Mutex
+	events []EndpointEvent // oldest first
+	size   int
+	last   uint64
+	// notify is closed and replaced on every event
+	notify chan struct{}
+}
+
+func newEndpointEventLog(size int) *endpointEventLog {
+	return &endpointEventLog{size: size, notify: make(chan struct{})}
+}
+
+// publish appends an event for the endpoint, with a copy of its state so later changes don't alter the event.
+func (l *endpointEventLog) publish(eventType EndpointEventType, endpointID string, endpointInfo *EndpointInfo) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+
+	l.last++
+	l.events = append(l.events, EndpointEvent{
+		Sequence:     l.last,
+		Type:         eventType,
+		EndpointID:   endpointID,
+		EndpointInfo: copyEndpointInfo(endpointInfo),
+	})
+	if len(l.events) > l.size {
+		l.events = l.events[len(l.events)-l.size:]
+	}
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// after returns the events after the sequence, and if some of them were dropped. A sequence ahead of the log, left from
+// before a restart of CNS, is reported as missed events as well.
+func (l *endpointEventLog) after(since uint64) (events []EndpointEvent, last uint64, missed bool, notify <-chan struct{}) {
+	l.Lock()
+	defer l.Unlock()
+
+	if since > l.last || (len(l.events) > 0 && since+1 < l.events[0].Sequence) {
+		missed = true
+	}
+	for i := range l.events {
+		if l.events[i].Sequence > since {
+			events = append(events, l.events[i:]...)
+			break
+		}
+	}
+	return events, l.last, missed, l.notify
+}
+
+// wait returns the events after the sequence, waiting up to the timeout for the next event if there are none yet.
+func (l *endpointEventLog) wait(ctx context.Context, since uint64, timeout time.Duration) (events []EndpointEvent, last uint64, missed bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		events, last, missed, notify := l.after(since)
+		if len(events) > 0 || missed {
+			return events, last, missed
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, last, false
+		case <-timer.C:
+			return nil, last, false
+		}
+	}
+}
+
+// WaitEndpointEvents returns the endpoint events after the sequence, waiting up to the timeout for the next event if
+// there are none yet. missed is set when events after the sequence were dropped, so the endpoint state must be resynced.
+func (service *HTTPRestService) WaitEndpointEvents(ctx context.Context, since uint64, timeout time.Duration) (events []EndpointEvent, last uint64, missed bool) {
+	return service.endpointEvents.wait(ctx, since, timeout)
+}
+
+// endpointEventsHandler long-polls the endpoint events after the sequence given as ?since=, so agents can follow the
+// endpoint state without polling it. The request returns as soon as there are events, or empty after ?timeout=
+// seconds.
+func (service *HTTPRestService) endpointEventsHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "endpointEventsHandler"
+	var response GetEndpointEventsResponse
+
+	switch {
+	case r.Method != http.MethodGet:
+		response.Response = Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure-CNS] endpointEvents API expects a GET.",
+		}
+	case service.Options[common.OptManageEndpointState] != true:
+		response.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[Azure-CNS] %s failed with error: %s", opName, ErrOptManageEndpointState),
+		}
+	default:
+		since, timeout, err := parseEndpointEventsQuery(r.URL.Query())
+		if err != nil {
+			response.Response = Response{
+				ReturnCode: types.InvalidParameter,
+				Message:    fmt.Sprintf("[Azure-CNS] %s failed with error: %v", opName, err),
+			}
+			break
+		}
+		response.Events, response.LastSequence, response.Missed = service.endpointEvents.wait(r.Context(), since, timeout)
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+func parseEndpointEventsQuery(query url.Values) (since uint64, timeout time.Duration, err error) {
+	if query.Has(sinceQueryKey) {
+		if since, err = strconv.ParseUint(query.Get(sinceQueryKey), 10, 64); err != nil {
+			return 0, 0, errors.Wrapf(errInvalidEndpointEventsQuery, "%s=%s", sinceQueryKey, query.Get(sinceQueryKey))
+		}
+	}
+
+	timeout = defaultEndpointEventWait
+	if query.Has(timeoutQueryKey) {
+		seconds, err := strconv.Atoi(query.Get(timeoutQueryKey))
+		if err != nil || seconds < 0 {
+			return 0, 0, errors.Wrapf(errInvalidEndpointEventsQuery, "%s=%s", timeoutQueryKey, query.Get(timeoutQueryKey))
+		}
+		timeout = time.Duration(seconds) * time.Second
+		if timeout > maxEndpointEventWait {
+			timeout = maxEndpointEventWait
+		}
+	}
+	return since, timeout, nil
+}
+
+// ListEndpoints returns a copy of the state of all the endpoints, which the subscribers relist when they missed events.
+func (service *HTTPRestService) ListEndpoints() map[string]*EndpointInfo {
+	service.RLock()
+	defer service.RUnlock()
+
+	endpoints := make(map[string]*EndpointInfo, len(service.EndpointState))
+	for endpointID, endpointInfo := range service.EndpointState {
+		endpoints[endpointID] = copyEndpointInfo(endpointInfo)
+	}
+	return endpoints
+}
+
+// copyEndpointInfo copies the endpoint and its interfaces.
+func copyEndpointInfo(endpointInfo *EndpointInfo) *EndpointInfo {
+	if endpointInfo == nil {
+		return nil
+	}
+	endpointCopy := &EndpointInfo{
+		PodName:       endpointInfo.PodName,
+		PodNamespace:  endpointInfo.PodNamespace,
+		IfnameToIPMap: make(map[string]*IPInfo, len(endpointInfo.IfnameToIPMap)),
+	}
+	for ifName, ipInfo := range endpointInfo.IfnameToIPMap {
+		ipInfoCopy := *ipInfo
+		endpointCopy.IfnameToIPMap[ifName] = &ipInfoCopy
+	}
+	return endpointCopy
+}
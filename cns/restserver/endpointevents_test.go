@@ -0,0 +1,116 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointEventLog(t *testing.T) {
+	l := newEndpointEventLog(2)
+	endpointInfo := &EndpointInfo{PodName: "pod1", IfnameToIPMap: map[string]*IPInfo{"eth0": {HostVethName: "azv1"}}}
+	l.publish(EndpointCreated, "ep1", endpointInfo)
+
+	// later changes of the endpoint don't alter the event
+	endpointInfo.IfnameToIPMap["eth0"].HostVethName = "azv2"
+	events, last, missed, _ := l.after(0)
+	require.Len(t, events, 1)
+	assert.Equal(t, "azv1", events[0].EndpointInfo.IfnameToIPMap["eth0"].HostVethName)
+	assert.Equal(t, uint64(1), last)
+	assert.False(t, missed)
+
+	l.publish(EndpointUpdated, "ep1", endpointInfo)
+	l.publish(EndpointDeleted, "ep1", nil)
+	events, last, missed, _ = l.after(1)
+	assert.Equal(t, []EndpointEventType{EndpointUpdated, EndpointDeleted}, []EndpointEventType{events[0].Type, events[1].Type})
+	assert.Equal(t, uint64(3), last)
+	assert.False(t, missed)
+
+	// the first event was dropped
+	_, _, missed, _ = l.after(0)
+	assert.True(t, missed)
+
+	// a sequence from before a restart
+	events, _, missed, _ = l.after(10)
+	assert.Empty(t, events)
+	assert.True(t, missed)
+}
+
+func TestEndpointEventsFromEndpointState(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.EndpointStateStore = store.NewMockStore("")
+
+	req := cns.IPConfigsRequest{InfraContainerID: testPod1Info.InfraContainerID(), Ifname: InfraInterfaceName}
+	podIPInfo := []cns.PodIpInfo{{PodIPConfig: cns.IPSubnet{IPAddress: testIP1, PrefixLength: 32}}}
+	require.NoError(t, svc.updateEndpointState(req, testPod1Info, podIPInfo))
+	require.NoError(t, svc.UpdateEndpointHelper(testPod1Info.InfraContainerID(), map[string]*IPInfo{
+		InfraInterfaceName: {HostVethName: "azv1", NICType: cns.InfraNIC},
+	}))
+	require.NoError(t, svc.removeEndpointState(testPod1Info))
+
+	events, _, _, _ := svc.endpointEvents.after(0)
+	require.Len(t, events, 3)
+	assert.Equal(t, EndpointCreated, events[0].Type)
+	assert.Equal(t, testPod1Info.Name(), events[0].EndpointInfo.PodName)
+	assert.Equal(t, EndpointUpdated, events[1].Type)
+	assert.Equal(t, "azv1", events[1].EndpointInfo.IfnameToIPMap[InfraInterfaceName].HostVethName)
+	assert.Equal(t, EndpointDeleted, events[2].Type)
+	assert.Nil(t, events[2].EndpointInfo)
+}
+
+func TestEndpointEventsHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	svc.EndpointStateStore = store.NewMockStore("")
+
+	get := func(path string) GetEndpointEventsResponse {
+		w := httptest.NewRecorder()
+		svc.endpointEventsHandler(w, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		var resp GetEndpointEventsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	// no events before the timeout
+	resp := get(cns.EndpointEventsPath + "?timeout=0")
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Empty(t, resp.Events)
+
+	resp = get(cns.EndpointEventsPath + "?since=-1")
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+
+	// a waiting subscriber gets the next event
+	done := make(chan GetEndpointEventsResponse)
+	go func() {
+		done <- get(cns.EndpointEventsPath + "?since=0&timeout=10")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, svc.UpdateEndpointHelper("ep1", map[string]*IPInfo{InfraInterfaceName: {HostVethName: "azv1"}}))
+	select {
+	case resp = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber was not woken up by the event")
+	}
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, EndpointCreated, resp.Events[0].Type)
+	assert.Equal(t, "ep1", resp.Events[0].EndpointID)
+	assert.Equal(t, uint64(1), resp.LastSequence)
+
+	// the wait ends with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	events, last, missed := svc.endpointEvents.wait(ctx, 1, time.Minute)
+	assert.Empty(t, events)
+	assert.Equal(t, uint64(1), last)
+	assert.False(t, missed)
+}
@@ -0,0 +1,120 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+)
+
+// EndpointHealthEvent is the node event recorded with a change of the health of an endpoint.
+type EndpointHealthEvent struct {
+	Type    string
+	Reason  string
+	Message string
+}
+
+// SetEndpointHealth records the health of the interfaces of the endpoint by interface name, and publishes the endpoint
+// update and the node event.
+func (service *HTTPRestService) SetEndpointHealth(endpointID string, health map[string]*EndpointHealth, event EndpointHealthEvent) error {
+	service.Lock()
+	defer service.Unlock()
+
+	if service.EndpointStateStore == nil {
+		return ErrStoreEmpty
+	}
+	endpointInfo, ok := service.EndpointState[endpointID]
+	if !ok {
+		return errors.Wrapf(ErrEndpointStateNotFound, "endpoint %s", endpointID)
+	}
+	previous := make(map[string]*EndpointHealth, len(health))
+	for ifName, ifHealth := range health {
+		if ipInfo, ok := endpointInfo.IfnameToIPMap[ifName]; ok {
+			previous[ifName] = ipInfo.Health
+			ipInfo.Health = ifHealth
+		}
+	}
+	if err := service.EndpointStateStore.Write(EndpointStoreKey, service.EndpointState); err != nil {
+		for ifName, ifHealth := range previous {
+			endpointInfo.IfnameToIPMap[ifName].Health = ifHealth
+		}
+		return errors.Wrapf(err, "failed to save the health of endpoint %s", endpointID)
+	}
+	service.endpointEvents.publish(EndpointUpdated, endpointID, endpointInfo)
+
+	logger.Printf("[EndpointHealth] Endpoint %s: %s", endpointID, event.Message)
+	if service.nodeEvents != nil && event.Reason != "" {
+		service.nodeEvents.Eventf(event.Type, event.Reason, "Pod %s/%s: %s", endpointInfo.PodNamespace, endpointInfo.PodName, event.Message)
+	}
+	return nil
+}
+
+// endpointHealthHandler serves the health of the endpoints checked by the endpoint health monitor, sorted by endpoint
+// id. The endpoints which were not checked yet, and the ones of the platforms the monitor doesn't run on, are left out.
+func (service *HTTPRestService) endpointHealthHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "endpointHealth"
+	var response EndpointHealthResponse
+
+	switch {
+	case r.Method != http.MethodGet:
+		response.Response = Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure-CNS] endpointHealth API expects a GET.",
+		}
+	case service.Options[common.OptManageEndpointState] != true:
+		response.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[Azure-CNS] endpointHealth failed with error: %s", ErrOptManageEndpointState),
+		}
+	default:
+		response.Endpoints = service.endpointHealth()
+		for i := range response.Endpoints {
+			healthy, evict := true, false
+			for _, ifHealth := range response.Endpoints[i].Interfaces {
+				healthy = healthy && ifHealth.Healthy
+				evict = evict || ifHealth.EvictionRecommended
+			}
+			if !healthy {
+				response.Unhealthy++
+			}
+			if evict {
+				response.EvictionRecommended++
+			}
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// endpointHealth returns the health of the endpoints with a checked interface, sorted by endpoint id.
+func (service *HTTPRestService) endpointHealth() []EndpointHealthStatus {
+	service.RLock()
+	defer service.RUnlock()
+
+	statuses := []EndpointHealthStatus{}
+	for endpointID, endpointInfo := range service.EndpointState {
+		interfaces := map[string]*EndpointHealth{}
+		for ifName, ipInfo := range endpointInfo.IfnameToIPMap {
+			if ipInfo != nil && ipInfo.Health != nil {
+				ifHealth := *ipInfo.Health
+				interfaces[ifName] = &ifHealth
+			}
+		}
+		if len(interfaces) == 0 {
+			continue
+		}
+		statuses = append(statuses, EndpointHealthStatus{
+			EndpointID:   endpointID,
+			PodName:      endpointInfo.PodName,
+			PodNamespace: endpointInfo.PodNamespace,
+			Interfaces:   interfaces,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].EndpointID < statuses[j].EndpointID })
+	return statuses
+}
@@ -0,0 +1,62 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestEndpointHealth(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	svc.EndpointStateStore = store.NewMockStore("")
+	events := &fakeNodeEventRecorder{}
+	svc.SetNodeEventRecorder(events)
+
+	require.ErrorIs(t, svc.SetEndpointHealth("ep1", nil, EndpointHealthEvent{}), ErrEndpointStateNotFound)
+
+	require.NoError(t, svc.UpdateEndpointHelper("ep1", map[string]*IPInfo{
+		InfraInterfaceName: {NICType: cns.InfraNIC, NetNsPath: "/var/run/netns/pod1"},
+	}))
+	require.NoError(t, svc.UpdateEndpointHelper("ep2", map[string]*IPInfo{
+		InfraInterfaceName: {NICType: cns.InfraNIC, NetNsPath: "/var/run/netns/pod2"},
+	}))
+	svc.EndpointState["ep1"].PodName, svc.EndpointState["ep1"].PodNamespace = "pod1", "default"
+
+	require.NoError(t, svc.SetEndpointHealth("ep1", map[string]*EndpointHealth{
+		InfraInterfaceName: {Failures: map[string]string{"gateway": "no reply"}, EvictionRecommended: true},
+		"eth1":             {Healthy: true},
+	}, EndpointHealthEvent{Type: corev1.EventTypeWarning, Reason: "EndpointEvictionRecommended", Message: "eth0 can't be repaired"}))
+	assert.NotContains(t, svc.EndpointState["ep1"].IfnameToIPMap, "eth1")
+	assert.Equal(t, []string{"EndpointEvictionRecommended: Pod default/pod1: eth0 can't be repaired"}, events.reasons[len(events.reasons)-1:])
+
+	endpointHealth := func(method string) EndpointHealthResponse {
+		w := httptest.NewRecorder()
+		svc.endpointHealthHandler(w, httptest.NewRequest(method, cns.EndpointHealthPath, http.NoBody))
+		var resp EndpointHealthResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	// the endpoints which were not checked yet are left out
+	resp := endpointHealth(http.MethodGet)
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, 1, resp.Unhealthy)
+	assert.Equal(t, 1, resp.EvictionRecommended)
+	require.Len(t, resp.Endpoints, 1)
+	assert.Equal(t, "ep1", resp.Endpoints[0].EndpointID)
+	assert.Equal(t, "pod1", resp.Endpoints[0].PodName)
+	assert.Equal(t, "no reply", resp.Endpoints[0].Interfaces[InfraInterfaceName].Failures["gateway"])
+
+	resp = endpointHealth(http.MethodPost)
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
@@ -0,0 +1,342 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+)
+
+// minDelegatedPrefixLength is the length of the largest prefix delegated to an endpoint.
+const minDelegatedPrefixLength = 24
+
+var (
+	ErrInvalidPrefixLength = errors.New("invalid prefix length")
+	ErrNoPrefixAvailable   = errors.New("no aligned block of available IPs for the prefix")
+)
+
+// delegatedPrefix is a block of secondary IPs of an NC delegated to an endpoint. The IPs are assigned to the pod, but
+// are not returned as its IPs.
+type delegatedPrefix struct {
+	prefix netip.Prefix
+	ipIDs  []string
+}
+
+// endpointPrefixRouter programs the on-link route of a delegated prefix to the host interface of an endpoint.
+type endpointPrefixRouter interface {
+	AddPrefixRoute(hostIfName string, prefix netip.Prefix) error
+	DeletePrefixRoute(hostIfName string, prefix netip.Prefix) error
+}
+
+// endpointPrefixHandler delegates a prefix to an endpoint, resizes it or returns the endpoint to a single IP on a POST.
+func (service *HTTPRestService) endpointPrefixHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "endpointPrefixHandler"
+	var response cns.ResizeEndpointPrefixResponse
+
+	switch {
+	case r.Method != http.MethodPost:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] endpointPrefix API expects a POST.",
+		}
+	case service.Options[common.OptManageEndpointState] != true:
+		response.Response = cns.Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[Azure CNS] %s failed with error: %s", opName, ErrOptManageEndpointState),
+		}
+	default:
+		var req cns.ResizeEndpointPrefixRequest
+		err := common.Decode(w, r, &req)
+		logger.Request(opName, &req, err)
+		if err != nil {
+			return
+		}
+		prefix, returnCode, err := service.ResizeEndpointPrefix(req.EndpointID, req.PrefixLength)
+		if err != nil {
+			response.Response = cns.Response{
+				ReturnCode: returnCode,
+				Message:    fmt.Sprintf("[Azure CNS] %s failed with error: %v", opName, err),
+			}
+			break
+		}
+		response.Prefix = prefix
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// ResizeEndpointPrefix delegates a prefix of the given length to the infra interface of the endpoint, taken from the
+// NC of its IPv4 address, and routes it on-link to the host interface. A length of 32 removes the delegated prefix.
+// The IP states, the route and the endpoint state are all updated, or none of them is.
+func (service *HTTPRestService) ResizeEndpointPrefix(endpointID string, prefixLength int) (string, types.ResponseCode, error) {
+	if prefixLength < minDelegatedPrefixLength || prefixLength > 32 {
+		return "", types.InvalidParameter, errors.Wrapf(ErrInvalidPrefixLength, "/%d, expected /%d to /32", prefixLength, minDelegatedPrefixLength)
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	if service.EndpointStateStore == nil {
+		return "", types.NilEndpointStateStore, ErrStoreEmpty
+	}
+	if err := service.EndpointStateStore.Read(EndpointStoreKey, &service.EndpointState); err != nil {
+		return "", types.NotFound, errors.Wrapf(ErrEndpointStateNotFound, "endpoint %s: %v", endpointID, err)
+	}
+	endpointInfo, ok := service.EndpointState[endpointID]
+	if !ok || endpointInfo.IfnameToIPMap[InfraInterfaceName] == nil {
+		return "", types.NotFound, errors.Wrapf(ErrEndpointStateNotFound, "endpoint %s", endpointID)
+	}
+	ipInfo := endpointInfo.IfnameToIPMap[InfraInterfaceName]
+	if ipInfo.HostVethName == "" {
+		return "", types.InvalidRequest, errors.Errorf("endpoint %s has no host interface to route a prefix to", endpointID)
+	}
+
+	current := service.delegatedPrefixes[endpointID]
+	var next delegatedPrefix
+	var podInfo cns.PodInfo
+	if prefixLength < 32 {
+		podIPConfig, found := service.endpointIPv4ConfigUntransacted(endpointID, current)
+		if !found {
+			return "", types.NotFound, errors.Errorf("no IPv4 address is assigned to endpoint %s", endpointID)
+		}
+		podInfo = podIPConfig.PodInfo
+		var err error
+		if next, err = service.findPrefixUntransacted(podIPConfig.NCID, prefixLength, current); err != nil {
+			return "", types.FailedToAllocateIPConfig, err
+		}
+	}
+	if next.prefix == current.prefix {
+		return prefixString(next.prefix), types.Success, nil
+	}
+
+	if err := service.updateDelegatedPrefixUntransacted(endpointID, ipInfo, podInfo, current, next); err != nil {
+		return "", types.UnexpectedError, err
+	}
+
+	if next.prefix.IsValid() {
+		service.delegatedPrefixes[endpointID] = next
+	} else {
+		delete(service.delegatedPrefixes, endpointID)
+	}
+	logger.Printf("[ResizeEndpointPrefix] Delegated prefix of endpoint %s changed from %q to %q", endpointID,
+		prefixString(current.prefix), prefixString(next.prefix))
+	return prefixString(next.prefix), types.Success, nil
+}
+
+// updateDelegatedPrefixUntransacted moves the endpoint from the current to the next delegated prefix, rolling back the
+// steps already taken when one fails.
+func (service *HTTPRestService) updateDelegatedPrefixUntransacted(endpointID string, ipInfo *IPInfo, podInfo cns.PodInfo,
+	current, next delegatedPrefix,
+) error {
+	added, removed := diffIPIDs(current.ipIDs, next.ipIDs)
+	for i, ipID := range added {
+		if _, err := service.updateIPConfigState(ipID, types.Assigned, podInfo); err != nil {
+			service.setIPConfigsAvailableUntransacted(added[:i])
+			return err
+		}
+	}
+
+	rollback := func() {
+		service.setIPConfigsAvailableUntransacted(added)
+	}
+	if next.prefix.IsValid() {
+		if err := service.prefixRouter.AddPrefixRoute(ipInfo.HostVethName, next.prefix); err != nil {
+			rollback()
+			return errors.Wrapf(err, "failed to route prefix %s to %s", next.prefix, ipInfo.HostVethName)
+		}
+		rollback = func() {
+			if err := service.prefixRouter.DeletePrefixRoute(ipInfo.HostVethName, next.prefix); err != nil {
+				logger.Errorf("[ResizeEndpointPrefix] Failed to delete route of prefix %s: %v", next.prefix, err)
+			}
+			service.setIPConfigsAvailableUntransacted(added)
+		}
+	}
+	if current.prefix.IsValid() {
+		if err := service.prefixRouter.DeletePrefixRoute(ipInfo.HostVethName, current.prefix); err != nil {
+			rollback()
+			return errors.Wrapf(err, "failed to delete route of prefix %s to %s", current.prefix, ipInfo.HostVethName)
+		}
+		previousRollback := rollback
+		rollback = func() {
+			if err := service.prefixRouter.AddPrefixRoute(ipInfo.HostVethName, current.prefix); err != nil {
+				logger.Errorf("[ResizeEndpointPrefix] Failed to restore route of prefix %s: %v", current.prefix, err)
+			}
+			previousRollback()
+		}
+	}
+
+	ipInfo.DelegatedPrefix = prefixString(next.prefix)
+	if err := service.EndpointStateStore.Write(EndpointStoreKey, service.EndpointState); err != nil {
+		ipInfo.DelegatedPrefix = prefixString(current.prefix)
+		rollback()
+		return errors.Wrapf(err, "failed to save the state of endpoint %s", endpointID)
+	}
+
+	service.setIPConfigsAvailableUntransacted(removed)
+	service.endpointEvents.publish(EndpointUpdated, endpointID, service.EndpointState[endpointID])
+	return nil
+}
+
+// endpointIPv4ConfigUntransacted returns the IPv4 address assigned to the endpoint as its own IP.
+func (service *HTTPRestService) endpointIPv4ConfigUntransacted(endpointID string, delegated delegatedPrefix) (cns.IPConfigurationStatus, bool) {
+	for _, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if ipConfig.GetState() != types.Assigned || ipConfig.PodInfo == nil || ipConfig.PodInfo.InfraContainerID() != endpointID {
+			continue
+		}
+		addr, err := netip.ParseAddr(ipConfig.IPAddress)
+		if err != nil || !addr.Is4() || (delegated.prefix.IsValid() && delegated.prefix.Contains(addr)) {
+			continue
+		}
+		return ipConfig, true
+	}
+	return cns.IPConfigurationStatus{}, false
+}
+
+// findPrefixUntransacted returns the lowest aligned block of IPs of the NC which are all available, or delegated to the
+// endpoint already.
+func (service *HTTPRestService) findPrefixUntransacted(ncID string, prefixLength int, current delegatedPrefix) (delegatedPrefix, error) {
+	free := make(map[netip.Addr]string)
+	for _, ipID := range current.ipIDs {
+		if addr, err := netip.ParseAddr(service.PodIPConfigState[ipID].IPAddress); err == nil {
+			free[addr] = ipID
+		}
+	}
+	for ipID, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if ipConfig.NCID != ncID || ipConfig.GetState() != types.Available {
+			continue
+		}
+		if addr, err := netip.ParseAddr(ipConfig.IPAddress); err == nil && addr.Is4() {
+			free[addr] = ipID
+		}
+	}
+
+	addrs := make([]netip.Addr, 0, len(free))
+	for addr := range free {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+
+	size := 1 << (32 - prefixLength)
+	for _, addr := range addrs {
+		prefix := netip.PrefixFrom(addr, prefixLength)
+		if prefix.Masked().Addr() != addr {
+			continue
+		}
+		ipIDs := make([]string, 0, size)
+		for a := addr; len(ipIDs) < size; a = a.Next() {
+			ipID, ok := free[a]
+			if !ok {
+				break
+			}
+			ipIDs = append(ipIDs, ipID)
+		}
+		if len(ipIDs) == size {
+			return delegatedPrefix{prefix: prefix, ipIDs: ipIDs}, nil
+		}
+	}
+	return delegatedPrefix{}, errors.Wrapf(ErrNoPrefixAvailable, "/%d in NC %s", prefixLength, ncID)
+}
+
+// releaseDelegatedPrefixUntransacted returns the IPs of the prefix delegated to the endpoint to the pool. The route
+// goes away with the host interface of the endpoint.
+func (service *HTTPRestService) releaseDelegatedPrefixUntransacted(endpointID string) {
+	delegated, ok := service.delegatedPrefixes[endpointID]
+	if !ok {
+		return
+	}
+	logger.Printf("[releaseDelegatedPrefix] Releasing prefix %s of endpoint %s", delegated.prefix, endpointID)
+	service.setIPConfigsAvailableUntransacted(delegated.ipIDs)
+	delete(service.delegatedPrefixes, endpointID)
+}
+
+// restoreDelegatedPrefixes assigns the prefixes recorded in the endpoint state again after a restart.
+func (service *HTTPRestService) restoreDelegatedPrefixes() {
+	if service.EndpointStateStore == nil {
+		return
+	}
+	var endpointState map[string]*EndpointInfo
+	if err := service.EndpointStateStore.Read(EndpointStoreKey, &endpointState); err != nil {
+		return
+	}
+
+	service.Lock()
+	defer service.Unlock()
+	ipIDByAddr := make(map[netip.Addr]string, len(service.PodIPConfigState))
+	for ipID, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if addr, err := netip.ParseAddr(ipConfig.IPAddress); err == nil {
+			ipIDByAddr[addr] = ipID
+		}
+	}
+
+	for endpointID, endpointInfo := range endpointState {
+		ipInfo := endpointInfo.IfnameToIPMap[InfraInterfaceName]
+		if ipInfo == nil || ipInfo.DelegatedPrefix == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(ipInfo.DelegatedPrefix)
+		if err != nil {
+			logger.Errorf("[restoreDelegatedPrefixes] Invalid prefix %s of endpoint %s: %v", ipInfo.DelegatedPrefix, endpointID, err)
+			continue
+		}
+		podInfo := cns.NewPodInfo(endpointID, endpointID, endpointInfo.PodName, endpointInfo.PodNamespace)
+		delegated := delegatedPrefix{prefix: prefix}
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			ipID, ok := ipIDByAddr[addr]
+			if !ok {
+				logger.Errorf("[restoreDelegatedPrefixes] IP %s of the prefix of endpoint %s is not in the pool", addr, endpointID)
+				continue
+			}
+			if _, err := service.updateIPConfigState(ipID, types.Assigned, podInfo); err != nil {
+				logger.Errorf("[restoreDelegatedPrefixes] Failed to assign IP %s to endpoint %s: %v", addr, endpointID, err)
+				continue
+			}
+			delegated.ipIDs = append(delegated.ipIDs, ipID)
+		}
+		service.delegatedPrefixes[endpointID] = delegated
+		logger.Printf("[restoreDelegatedPrefixes] Restored prefix %s of endpoint %s", prefix, endpointID)
+	}
+}
+
+// setIPConfigsAvailableUntransacted sets the IPs as available, logging the failures.
+func (service *HTTPRestService) setIPConfigsAvailableUntransacted(ipIDs []string) {
+	for _, ipID := range ipIDs {
+		if _, err := service.updateIPConfigState(ipID, types.Available, nil); err != nil {
+			logger.Errorf("[setIPConfigsAvailable] Failed to mark IP %s as available: %v", ipID, err)
+		}
+	}
+}
+
+// diffIPIDs returns the IDs only in next, and the IDs only in current.
+func diffIPIDs(current, next []string) (added, removed []string) {
+	inCurrent := make(map[string]struct{}, len(current))
+	for _, ipID := range current {
+		inCurrent[ipID] = struct{}{}
+	}
+	inNext := make(map[string]struct{}, len(next))
+	for _, ipID := range next {
+		inNext[ipID] = struct{}{}
+		if _, ok := inCurrent[ipID]; !ok {
+			added = append(added, ipID)
+		}
+	}
+	for _, ipID := range current {
+		if _, ok := inNext[ipID]; !ok {
+			removed = append(removed, ipID)
+		}
+	}
+	return added, removed
+}
+
+func prefixString(prefix netip.Prefix) string {
+	if !prefix.IsValid() {
+		return ""
+	}
+	return prefix.String()
+}
@@ -0,0 +1,48 @@
+package restserver
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// vethPrefixRouter routes delegated prefixes on-link to the host veth of the endpoint.
+type vethPrefixRouter struct{}
+
+func newEndpointPrefixRouter() endpointPrefixRouter {
+	return vethPrefixRouter{}
+}
+
+func (vethPrefixRouter) AddPrefixRoute(hostIfName string, prefix netip.Prefix) error {
+	route, err := prefixRoute(hostIfName, prefix)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(netlink.RouteReplace(route), "failed to add route")
+}
+
+func (vethPrefixRouter) DeletePrefixRoute(hostIfName string, prefix netip.Prefix) error {
+	route, err := prefixRoute(hostIfName, prefix)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(netlink.RouteDel(route), "failed to delete route")
+}
+
+// prefixRoute returns the link scoped route of the prefix through the host veth.
+func prefixRoute(hostIfName string, prefix netip.Prefix) (*netlink.Route, error) {
+	link, err := netlink.LinkByName(hostIfName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "host veth %s not found", hostIfName)
+	}
+	return &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Scope:     netlink.SCOPE_LINK,
+		Dst: &net.IPNet{
+			IP:   prefix.Addr().AsSlice(),
+			Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+		},
+	}, nil
+}
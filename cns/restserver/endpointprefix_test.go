@@ -0,0 +1,198 @@
+package restserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRouteFailed = errors.New("route failed")
+
+// fakePrefixRouter records the routed prefixes of each host interface.
+type fakePrefixRouter struct {
+	routes map[string]string
+	fail   bool
+}
+
+func (f *fakePrefixRouter) AddPrefixRoute(hostIfName string, prefix netip.Prefix) error {
+	if f.fail {
+		return errRouteFailed
+	}
+	f.routes[prefix.String()] = hostIfName
+	return nil
+}
+
+func (f *fakePrefixRouter) DeletePrefixRoute(_ string, prefix netip.Prefix) error {
+	if f.fail {
+		return errRouteFailed
+	}
+	delete(f.routes, prefix.String())
+	return nil
+}
+
+// newEndpointPrefixTestService returns a service with an NC of 10.0.0.1 to 10.0.0.48, where 10.0.0.1 is assigned to
+// the endpoint of testPod1Info and 10.0.0.18 to testPod2Info.
+func newEndpointPrefixTestService(t *testing.T) (*HTTPRestService, *fakePrefixRouter) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	svc.EndpointStateStore = store.NewMockStore("")
+	router := &fakePrefixRouter{routes: map[string]string{}}
+	svc.prefixRouter = router
+
+	ipconfigs := make(map[string]cns.IPConfigurationStatus)
+	for i := 1; i <= 48; i++ {
+		ipID := fmt.Sprintf("ip-%d", i)
+		ipconfigs[ipID] = newPodState(fmt.Sprintf("10.0.0.%d", i), ipID, testNCID, types.Available, 0)
+	}
+	ipconfigs["ip-1"], _ = newPodStateWithOrchestratorContext("10.0.0.1", "ip-1", testNCID, types.Assigned, 0, 0, testPod1Info)
+	ipconfigs["ip-18"], _ = newPodStateWithOrchestratorContext("10.0.0.18", "ip-18", testNCID, types.Assigned, 0, 0, testPod2Info)
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+
+	require.NoError(t, svc.EndpointStateStore.Write(EndpointStoreKey, map[string]*EndpointInfo{
+		testPod1Info.InfraContainerID(): {
+			PodName:      testPod1Info.Name(),
+			PodNamespace: testPod1Info.Namespace(),
+			IfnameToIPMap: map[string]*IPInfo{
+				InfraInterfaceName: {
+					IPv4:         []net.IPNet{{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}},
+					HostVethName: "azv1",
+					NICType:      cns.InfraNIC,
+				},
+			},
+		},
+	}))
+	return svc, router
+}
+
+func delegatedPrefixOf(t *testing.T, svc *HTTPRestService, endpointID string) string {
+	t.Helper()
+	endpointInfo, err := svc.GetEndpointHelper(endpointID)
+	require.NoError(t, err)
+	return endpointInfo.IfnameToIPMap[InfraInterfaceName].DelegatedPrefix
+}
+
+func TestResizeEndpointPrefix(t *testing.T) {
+	svc, router := newEndpointPrefixTestService(t)
+	endpointID := testPod1Info.InfraContainerID()
+
+	// 10.0.0.0/28 holds the ip of the pod and 10.0.0.16/28 an ip of another pod
+	prefix, code, err := svc.ResizeEndpointPrefix(endpointID, 28)
+	require.NoError(t, err)
+	assert.Equal(t, types.Success, code)
+	assert.Equal(t, "10.0.0.32/28", prefix)
+	assert.Equal(t, map[string]string{"10.0.0.32/28": "azv1"}, router.routes)
+	assert.Equal(t, "10.0.0.32/28", delegatedPrefixOf(t, svc, endpointID))
+	assert.Len(t, svc.GetAssignedIPConfigs(), 18)
+	assert.Len(t, svc.PodIPIDByPodInterfaceKey[testPod1Info.Key()], 1)
+
+	// the same length keeps the prefix
+	prefix, _, err = svc.ResizeEndpointPrefix(endpointID, 28)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.32/28", prefix)
+
+	// shrinking moves to the lowest free block
+	prefix, _, err = svc.ResizeEndpointPrefix(endpointID, 29)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.8/29", prefix)
+	assert.Equal(t, map[string]string{"10.0.0.8/29": "azv1"}, router.routes)
+	assert.Len(t, svc.GetAssignedIPConfigs(), 10)
+
+	// failures leave the state as it was
+	_, code, err = svc.ResizeEndpointPrefix(endpointID, 26)
+	require.ErrorIs(t, err, ErrNoPrefixAvailable)
+	assert.Equal(t, types.FailedToAllocateIPConfig, code)
+	router.fail = true
+	_, code, err = svc.ResizeEndpointPrefix(endpointID, 28)
+	require.ErrorIs(t, err, errRouteFailed)
+	assert.Equal(t, types.UnexpectedError, code)
+	router.fail = false
+	assert.Equal(t, "10.0.0.8/29", delegatedPrefixOf(t, svc, endpointID))
+	assert.Len(t, svc.GetAssignedIPConfigs(), 10)
+
+	_, code, err = svc.ResizeEndpointPrefix(endpointID, 20)
+	require.ErrorIs(t, err, ErrInvalidPrefixLength)
+	assert.Equal(t, types.InvalidParameter, code)
+	_, code, err = svc.ResizeEndpointPrefix("unknown", 28)
+	require.ErrorIs(t, err, ErrEndpointStateNotFound)
+	assert.Equal(t, types.NotFound, code)
+
+	// back to a single ip
+	prefix, _, err = svc.ResizeEndpointPrefix(endpointID, 32)
+	require.NoError(t, err)
+	assert.Empty(t, prefix)
+	assert.Empty(t, router.routes)
+	assert.Empty(t, delegatedPrefixOf(t, svc, endpointID))
+	assert.Len(t, svc.GetAssignedIPConfigs(), 2)
+}
+
+func TestReleaseEndpointWithDelegatedPrefix(t *testing.T) {
+	svc, _ := newEndpointPrefixTestService(t)
+	_, _, err := svc.ResizeEndpointPrefix(testPod1Info.InfraContainerID(), 28)
+	require.NoError(t, err)
+
+	req := cns.IPConfigsRequest{PodInterfaceID: testPod1Info.InterfaceID(), InfraContainerID: testPod1Info.InfraContainerID()}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+	_, err = svc.ReleaseIPConfigHandlerHelper(context.TODO(), req)
+	require.NoError(t, err)
+	assert.Len(t, svc.GetAssignedIPConfigs(), 1)
+	assert.Empty(t, svc.delegatedPrefixes)
+}
+
+func TestEndpointPrefixHandler(t *testing.T) {
+	svc, _ := newEndpointPrefixTestService(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		req        cns.ResizeEndpointPrefixRequest
+		wantCode   types.ResponseCode
+		wantPrefix string
+	}{
+		{
+			name:       "grow",
+			method:     http.MethodPost,
+			req:        cns.ResizeEndpointPrefixRequest{EndpointID: testPod1Info.InfraContainerID(), PrefixLength: 30},
+			wantCode:   types.Success,
+			wantPrefix: "10.0.0.4/30",
+		},
+		{
+			name:     "unknown endpoint",
+			method:   http.MethodPost,
+			req:      cns.ResizeEndpointPrefixRequest{EndpointID: "unknown", PrefixLength: 30},
+			wantCode: types.NotFound,
+		},
+		{
+			name:     "unsupported verb",
+			method:   http.MethodGet,
+			wantCode: types.UnsupportedVerb,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			require.NoError(t, json.NewEncoder(&body).Encode(tt.req))
+			w := httptest.NewRecorder()
+			svc.endpointPrefixHandler(w, httptest.NewRequest(tt.method, cns.EndpointPrefixPath, &body))
+
+			var resp cns.ResizeEndpointPrefixResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.wantCode, resp.Response.ReturnCode)
+			assert.Equal(t, tt.wantPrefix, resp.Prefix)
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package restserver
+
+import (
+	"net/netip"
+
+	"github.com/pkg/errors"
+)
+
+var errPrefixDelegationUnsupported = errors.New("prefix delegation is not supported on windows")
+
+// unsupportedPrefixRouter refuses delegated prefixes, hns endpoints can't be given an on-link prefix.
+type unsupportedPrefixRouter struct{}
+
+func newEndpointPrefixRouter() endpointPrefixRouter {
+	return unsupportedPrefixRouter{}
+}
+
+func (unsupportedPrefixRouter) AddPrefixRoute(string, netip.Prefix) error {
+	return errPrefixDelegationUnsupported
+}
+
+func (unsupportedPrefixRouter) DeletePrefixRoute(string, netip.Prefix) error {
+	return errPrefixDelegationUnsupported
+}
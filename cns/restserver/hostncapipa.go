@@ -0,0 +1,123 @@
+package restserver
+
+import (
+	"net/netip"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidHostNCApipaSubnet  = errors.New("invalid host NC apipa subnet")
+	ErrHostNCApipaSubnetConflict = errors.New("host NC apipa subnet conflicts with the host networking")
+	ErrHostNCApipaSubnetFull     = errors.New("no free ip in the host NC apipa subnet")
+)
+
+// linkLocalSubnet is the apipa range which the host NC apipa subnet must be in
+var linkLocalSubnet = netip.MustParsePrefix("169.254.0.0/16")
+
+const (
+	// the first ips of the host NC apipa subnet are the subnet address, the loopback adapter of the host and the
+	// gateway of the endpoints, the NCs get the ips after them
+	hostNCApipaLoopbackOffset = 1
+	hostNCApipaGatewayOffset  = 2
+	hostNCApipaFirstNCOffset  = 3
+	// maxHostNCApipaPrefixLength leaves room for the ips of the host and a few NCs
+	maxHostNCApipaPrefixLength = 29
+)
+
+// SetHostNCApipaSubnet sets the subnet the HostNCApipaEndpoints of the NCs get their ips from instead of the local ip
+// configuration of the NC. The subnet must be a link-local ipv4 subnet which doesn't conflict with the host networking.
+// An empty subnet keeps the local ip configuration of the NC.
+func (service *HTTPRestService) SetHostNCApipaSubnet(subnet string) error {
+	if subnet == "" {
+		return nil
+	}
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil || !prefix.Addr().Is4() {
+		return errors.Wrapf(ErrInvalidHostNCApipaSubnet, "%s is not an ipv4 subnet", subnet)
+	}
+	prefix = prefix.Masked()
+	if prefix.Bits() < linkLocalSubnet.Bits() || !linkLocalSubnet.Contains(prefix.Addr()) {
+		return errors.Wrapf(ErrInvalidHostNCApipaSubnet, "%s is not in the apipa range %s", prefix, linkLocalSubnet)
+	}
+	if prefix.Bits() > maxHostNCApipaPrefixLength {
+		return errors.Wrapf(ErrInvalidHostNCApipaSubnet, "%s is smaller than a /%d", prefix, maxHostNCApipaPrefixLength)
+	}
+	if err := service.checkHostSubnetConflicts(prefix, ErrHostNCApipaSubnetConflict); err != nil {
+		return err
+	}
+
+	service.Lock()
+	defer service.Unlock()
+	service.hostNCApipaSubnet = prefix
+	logger.Printf("[SetHostNCApipaSubnet] HostNCApipaEndpoints get their ips from %s", prefix)
+	return nil
+}
+
+// allocateHostNCApipaIP returns the ip configuration of the HostNCApipaEndpoint of the NC and the ip of the loopback
+// adapter of the host. Without a host NC apipa subnet, they are the local ip configuration of the NC and an empty ip
+// for the default loopback adapter ip. Otherwise the NC keeps the ip it is recorded with, or gets the first free ip of
+// the subnet recorded in the state.
+func (service *HTTPRestService) allocateHostNCApipaIP(ncID string, local cns.IPConfiguration) (cns.IPConfiguration, string, error) {
+	service.Lock()
+	defer service.Unlock()
+
+	subnet := service.hostNCApipaSubnet
+	if !subnet.IsValid() {
+		return local, "", nil
+	}
+
+	base := ipv4ToUint32(subnet.Addr())
+	ipConfig := cns.IPConfiguration{
+		IPSubnet:         cns.IPSubnet{PrefixLength: uint8(subnet.Bits())},
+		GatewayIPAddress: uint32ToIPv4(base + hostNCApipaGatewayOffset).String(),
+	}
+	loopbackIP := uint32ToIPv4(base + hostNCApipaLoopbackOffset).String()
+
+	if ip, ok := service.state.HostNCApipaIPs[ncID]; ok {
+		if addr, err := netip.ParseAddr(ip); err == nil && subnet.Contains(addr) {
+			ipConfig.IPSubnet.IPAddress = ip
+			return ipConfig, loopbackIP, nil
+		}
+	}
+
+	inUse := make(map[string]struct{}, len(service.state.HostNCApipaIPs))
+	for id, ip := range service.state.HostNCApipaIPs {
+		if id != ncID {
+			inUse[ip] = struct{}{}
+		}
+	}
+	// the last ip of the subnet is the broadcast address
+	last := base + 1<<(32-subnet.Bits()) - 1
+	for v := base + hostNCApipaFirstNCOffset; v < last; v++ {
+		ip := uint32ToIPv4(v).String()
+		if _, ok := inUse[ip]; ok {
+			continue
+		}
+		if service.state.HostNCApipaIPs == nil {
+			service.state.HostNCApipaIPs = make(map[string]string)
+		}
+		service.state.HostNCApipaIPs[ncID] = ip
+		if err := service.saveState(); err != nil {
+			delete(service.state.HostNCApipaIPs, ncID)
+			return cns.IPConfiguration{}, "", errors.Wrap(err, "failed to save the host NC apipa ip of the NC")
+		}
+		ipConfig.IPSubnet.IPAddress = ip
+		return ipConfig, loopbackIP, nil
+	}
+	return cns.IPConfiguration{}, "", errors.Wrapf(ErrHostNCApipaSubnetFull, "%s has no ip left for NC %s", subnet, ncID)
+}
+
+// releaseHostNCApipaIP frees the host NC apipa ip of the NC.
+func (service *HTTPRestService) releaseHostNCApipaIP(ncID string) error {
+	service.Lock()
+	defer service.Unlock()
+
+	if _, ok := service.state.HostNCApipaIPs[ncID]; !ok {
+		return nil
+	}
+	delete(service.state.HostNCApipaIPs, ncID)
+	return errors.Wrap(service.saveState(), "failed to save the release of the host NC apipa ip of the NC")
+}
@@ -0,0 +1,147 @@
+package restserver
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/wireserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetHostNCApipaSubnet(t *testing.T) {
+	tests := []struct {
+		name       string
+		subnet     string
+		hostRoutes []netip.Prefix
+		wantSubnet netip.Prefix
+		wantErr    error
+	}{
+		{
+			name:       "link-local subnet",
+			subnet:     "169.254.64.7/18",
+			wantSubnet: netip.MustParsePrefix("169.254.64.0/18"),
+		},
+		{
+			name: "no subnet keeps the local ip configuration",
+		},
+		{
+			name:    "not a subnet",
+			subnet:  "169.254.64.0",
+			wantErr: ErrInvalidHostNCApipaSubnet,
+		},
+		{
+			name:    "not link-local",
+			subnet:  "100.64.0.0/16",
+			wantErr: ErrInvalidHostNCApipaSubnet,
+		},
+		{
+			name:    "larger than the apipa range",
+			subnet:  "169.254.0.0/15",
+			wantErr: ErrInvalidHostNCApipaSubnet,
+		},
+		{
+			name:    "too small",
+			subnet:  "169.254.64.0/30",
+			wantErr: ErrInvalidHostNCApipaSubnet,
+		},
+		{
+			name:    "overlaps the host subnet",
+			subnet:  "169.254.0.0/16",
+			wantErr: ErrHostNCApipaSubnetConflict,
+		},
+		{
+			name:       "overlaps a host route",
+			subnet:     "169.254.64.0/18",
+			hostRoutes: []netip.Prefix{netip.MustParsePrefix("169.254.100.0/24")},
+			wantErr:    ErrHostNCApipaSubnetConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &HTTPRestService{
+				state:      &httpRestServiceState{primaryInterface: &wireserver.InterfaceInfo{Subnet: "169.254.200.0/24"}},
+				hostRoutes: fakeHostRouteLister{routes: tt.hostRoutes},
+			}
+
+			err := svc.SetHostNCApipaSubnet(tt.subnet)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSubnet, svc.hostNCApipaSubnet)
+		})
+	}
+}
+
+func TestAllocateHostNCApipaIP(t *testing.T) {
+	local := cns.IPConfiguration{
+		IPSubnet:         cns.IPSubnet{IPAddress: "169.254.128.7", PrefixLength: 17},
+		GatewayIPAddress: "169.254.128.1",
+	}
+
+	t.Run("no subnet keeps the local ip configuration", func(t *testing.T) {
+		svc := &HTTPRestService{state: &httpRestServiceState{}}
+		ipConfig, loopbackIP, err := svc.allocateHostNCApipaIP("nc1", local)
+		require.NoError(t, err)
+		assert.Equal(t, local, ipConfig)
+		assert.Empty(t, loopbackIP)
+		assert.Empty(t, svc.state.HostNCApipaIPs)
+	})
+
+	t.Run("ips are allocated per NC", func(t *testing.T) {
+		svc := &HTTPRestService{
+			state:             &httpRestServiceState{},
+			hostNCApipaSubnet: netip.MustParsePrefix("169.254.64.0/29"),
+		}
+
+		ipConfig, loopbackIP, err := svc.allocateHostNCApipaIP("nc1", local)
+		require.NoError(t, err)
+		assert.Equal(t, cns.IPConfiguration{
+			IPSubnet:         cns.IPSubnet{IPAddress: "169.254.64.3", PrefixLength: 29},
+			GatewayIPAddress: "169.254.64.2",
+		}, ipConfig)
+		assert.Equal(t, "169.254.64.1", loopbackIP)
+
+		// the NC keeps its ip
+		ipConfig, _, err = svc.allocateHostNCApipaIP("nc1", local)
+		require.NoError(t, err)
+		assert.Equal(t, "169.254.64.3", ipConfig.IPSubnet.IPAddress)
+
+		for ncID, want := range map[string]string{"nc2": "169.254.64.4", "nc3": "169.254.64.5", "nc4": "169.254.64.6"} {
+			_, _, err = svc.allocateHostNCApipaIP(ncID, local)
+			require.NoError(t, err)
+			assert.Equal(t, want, svc.state.HostNCApipaIPs[ncID])
+		}
+
+		// the broadcast address is never allocated
+		_, _, err = svc.allocateHostNCApipaIP("nc5", local)
+		require.ErrorIs(t, err, ErrHostNCApipaSubnetFull)
+
+		require.NoError(t, svc.releaseHostNCApipaIP("nc2"))
+		ipConfig, _, err = svc.allocateHostNCApipaIP("nc5", local)
+		require.NoError(t, err)
+		assert.Equal(t, "169.254.64.4", ipConfig.IPSubnet.IPAddress)
+		assert.Equal(t, map[string]string{
+			"nc1": "169.254.64.3",
+			"nc3": "169.254.64.5",
+			"nc4": "169.254.64.6",
+			"nc5": "169.254.64.4",
+		}, svc.state.HostNCApipaIPs)
+	})
+
+	t.Run("ip outside of the subnet is reallocated", func(t *testing.T) {
+		svc := &HTTPRestService{
+			state:             &httpRestServiceState{HostNCApipaIPs: map[string]string{"nc1": "169.254.128.7"}},
+			hostNCApipaSubnet: netip.MustParsePrefix("169.254.64.0/24"),
+		}
+		ipConfig, _, err := svc.allocateHostNCApipaIP("nc1", local)
+		require.NoError(t, err)
+		assert.Equal(t, "169.254.64.3", ipConfig.IPSubnet.IPAddress)
+		assert.Equal(t, map[string]string{"nc1": "169.254.64.3"}, svc.state.HostNCApipaIPs)
+	})
+}
@@ -366,6 +366,10 @@ func (service *HTTPRestService) ReconcileIPAssignment(podInfoByIP map[string]cns
 		}
 	}
 
+	// the IPs of the delegated prefixes are not pod IPs, so they are only found in the endpoint state
+	service.restoreDelegatedPrefixes()
+	// the reserved IPs are not pod IPs either, and are only taken out of the pool once the pods got theirs back
+	service.restoreIPReservations()
 	return types.Success
 }
 
@@ -487,6 +491,12 @@ func (service *HTTPRestService) GetNetworkContainerInternal(
 	return getNetworkContainerResponses[0], getNetworkContainerResponses[0].Response.ReturnCode
 }
 
+// GetNetworkContainerGoalState returns the saved create request of a network container.
+func (service *HTTPRestService) GetNetworkContainerGoalState(ncID string) (cns.CreateNetworkContainerRequest, bool) {
+	containerStatus, ok := service.getNetworkContainerDetails(ncID)
+	return containerStatus.CreateNetworkContainerRequest, ok
+}
+
 // DeleteNetworkContainerInternal deletes a network container.
 func (service *HTTPRestService) DeleteNetworkContainerInternal(
 	req cns.DeleteNetworkContainerRequest,
@@ -503,6 +513,7 @@ func (service *HTTPRestService) DeleteNetworkContainerInternal(
 	if service.state.ContainerStatus != nil {
 		delete(service.state.ContainerStatus, ncid)
 	}
+	service.ncProgramming.forget(ncid)
 
 	if service.state.ContainerIDByOrchestratorContext != nil {
 		for orchestratorContext, networkContainerIDs := range service.state.ContainerIDByOrchestratorContext { //nolint:gocritic // copy is ok
@@ -548,6 +559,7 @@ func (service *HTTPRestService) MustEnsureNoStaleNCs(validNCIDs []string) {
 
 			logger.Errorf("[Azure CNS] Found stale NC ID %s in CNS state. Removing...", ncID)
 			delete(service.state.ContainerStatus, ncID)
+			service.ncProgramming.forget(ncID)
 			mutated = true
 		}
 	}
@@ -597,6 +609,7 @@ func (service *HTTPRestService) CreateOrUpdateNetworkContainerInternal(req *cns.
 
 	// Validate if state exists already
 	existingNCInfo, ok := service.getNetworkContainerDetails(req.NetworkContainerid)
+	hadSNATExceptions := ok && len(existingNCInfo.CreateNetworkContainerRequest.SNATExceptionCIDRs) > 0
 	if ok {
 		existingReq := existingNCInfo.CreateNetworkContainerRequest
 		if !reflect.DeepEqual(existingReq.IPConfiguration.IPSubnet, req.IPConfiguration.IPSubnet) {
@@ -610,8 +623,12 @@ func (service *HTTPRestService) CreateOrUpdateNetworkContainerInternal(req *cns.
 		}
 	}
 
+	pass := service.ncProgramming.start(req.NetworkContainerid, req.Version)
+	defer pass.finish()
+
 	// This will Create Or Update the NC state.
 	returnCode, returnMessage := service.saveNetworkContainerGoalState(*req)
+	pass.record(ncStepGoalState, returnCode, returnMessage)
 
 	// If the NC was created successfully, log NC snapshot.
 	if returnCode == 0 {
@@ -623,6 +640,16 @@ func (service *HTTPRestService) CreateOrUpdateNetworkContainerInternal(req *cns.
 
 	if service.Options[common.OptProgramSNATIPTables] == true {
 		returnCode, returnMessage = service.programSNATRules(req)
+		pass.record(ncStepSNATRules, returnCode, returnMessage)
+		if returnCode != 0 {
+			logger.Errorf(returnMessage)
+		}
+	}
+
+	// reconcile the SNAT exceptions when the NC has or had some, so that removed ones are cleaned up
+	if returnCode == 0 && (len(req.SNATExceptionCIDRs) > 0 || hadSNATExceptions) {
+		returnCode, returnMessage = service.programSNATExceptionRules()
+		pass.record(ncStepSNATExceptions, returnCode, returnMessage)
 		if returnCode != 0 {
 			logger.Errorf(returnMessage)
 		}
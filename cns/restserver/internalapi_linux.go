@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/logger"
@@ -14,7 +15,11 @@ import (
 	"github.com/pkg/errors"
 )
 
-const SWIFT = "SWIFT-POSTROUTING"
+const (
+	SWIFT = "SWIFT-POSTROUTING"
+	// SWIFTSNATExceptions holds the rules exempting the NCs' pod traffic to their SNAT exception CIDRs from snat
+	SWIFTSNATExceptions = "SWIFT-SNAT-EXCEPTIONS"
+)
 
 type IPtablesProvider struct{}
 
@@ -114,6 +119,90 @@ func (service *HTTPRestService) programSNATRules(req *cns.CreateNetworkContainer
 	return types.Success, ""
 }
 
+// programSNATExceptionRules reconciles the SWIFT-SNAT-EXCEPTIONS chain with the SNAT exception CIDRs of all the NCs,
+// so that a change of the NNC is applied to the running pods. The chain is jumped to from the top of POSTROUTING and
+// accepts the traffic from an NC's pod subnet to its exception CIDRs, which skips the snat rules after it.
+func (service *HTTPRestService) programSNATExceptionRules() (types.ResponseCode, string) {
+	service.Lock()
+	defer service.Unlock()
+
+	desired := map[string][]string{}
+	for _, containerStatus := range service.state.ContainerStatus {
+		req := containerStatus.CreateNetworkContainerRequest
+		for _, v := range req.SecondaryIPConfigs {
+			_, podSubnet, err := net.ParseCIDR(v.IPAddress + "/" + fmt.Sprintf("%d", req.IPConfiguration.IPSubnet.PrefixLength))
+			if err != nil || podSubnet.IP.To4() == nil {
+				break
+			}
+			for _, cidr := range req.SNATExceptionCIDRs {
+				// iptables only programs ipv4
+				if ip, _, err := net.ParseCIDR(cidr); err != nil || ip.To4() == nil {
+					continue
+				}
+				rule := []string{"-s", podSubnet.String(), "-d", cidr, "-j", iptables.Accept}
+				desired[strings.Join(rule, " ")] = rule
+			}
+			// all secondary ips of the NC are in the same pod subnet
+			break
+		}
+	}
+
+	ipt, err := service.iptables.GetIPTables()
+	if err != nil {
+		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to create iptables interface : %v", err)
+	}
+
+	chainExist, err := ipt.ChainExists(iptables.Nat, SWIFTSNATExceptions)
+	if err != nil {
+		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to check for existence of SNAT exceptions chain: %v", err)
+	}
+	if !chainExist {
+		logger.Printf("[Azure CNS] Creating SNAT exceptions Chain ...")
+		if err = ipt.NewChain(iptables.Nat, SWIFTSNATExceptions); err != nil {
+			return types.FailedToRunIPTableCmd, "[Azure CNS] failed to create SNAT exceptions chain : " + err.Error()
+		}
+	}
+
+	jumpExist, err := ipt.Exists(iptables.Nat, iptables.Postrouting, "-j", SWIFTSNATExceptions)
+	if err != nil {
+		return types.UnexpectedError, fmt.Sprintf("[Azure CNS] Error. Failed to check for existence of POSTROUTING to SNAT exceptions chain jump: %v", err)
+	}
+	if !jumpExist {
+		logger.Printf("[Azure CNS] Inserting SNAT exceptions Chain to POSTROUTING ...")
+		if err = ipt.Insert(iptables.Nat, iptables.Postrouting, 1, "-j", SWIFTSNATExceptions); err != nil {
+			return types.FailedToRunIPTableCmd, "[Azure CNS] failed to insert SNAT exceptions chain : " + err.Error()
+		}
+	}
+
+	rules, err := ipt.List(iptables.Nat, SWIFTSNATExceptions)
+	if err != nil {
+		return types.FailedToRunIPTableCmd, "[Azure CNS] failed to list SNAT exceptions chain : " + err.Error()
+	}
+	for _, rule := range rules {
+		spec, ok := strings.CutPrefix(rule, "-A "+SWIFTSNATExceptions+" ")
+		if !ok {
+			continue
+		}
+		if _, ok := desired[spec]; ok {
+			delete(desired, spec)
+			continue
+		}
+		logger.Printf("[Azure CNS] Deleting stale SNAT exception rule %s", spec)
+		if err = ipt.Delete(iptables.Nat, SWIFTSNATExceptions, strings.Fields(spec)...); err != nil {
+			return types.FailedToRunIPTableCmd, "[Azure CNS] failed to delete SNAT exception rule : " + err.Error()
+		}
+	}
+
+	for spec, rule := range desired {
+		logger.Printf("[Azure CNS] Appending SNAT exception rule %s", spec)
+		if err = ipt.Append(iptables.Nat, SWIFTSNATExceptions, rule...); err != nil {
+			return types.FailedToRunIPTableCmd, "[Azure CNS] failed to append SNAT exception rule : " + err.Error()
+		}
+	}
+
+	return types.Success, ""
+}
+
 // no-op for linux
 func (service *HTTPRestService) setVFForAccelnetNICs() error {
 	return nil
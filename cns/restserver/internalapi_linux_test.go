@@ -146,3 +146,50 @@ func TestAddSNATRules(t *testing.T) {
 		}
 	}
 }
+
+func TestProgramSNATExceptionRules(t *testing.T) {
+	service := getTestService(cns.KubernetesCRD)
+	service.iptables = &FakeIPTablesProvider{}
+	service.state.ContainerStatus = map[string]containerstatus{
+		ncID: {
+			ID: ncID,
+			CreateNetworkContainerRequest: cns.CreateNetworkContainerRequest{
+				NetworkContainerid: ncID,
+				IPConfiguration: cns.IPConfiguration{
+					IPSubnet: cns.IPSubnet{IPAddress: "10.0.0.4", PrefixLength: 24},
+				},
+				SecondaryIPConfigs: map[string]cns.SecondaryIPConfig{"abc": {IPAddress: "240.1.2.7"}},
+				SNATExceptionCIDRs: []string{"192.168.0.0/16", "172.16.0.0/12", "fd00::/64"},
+			},
+		},
+	}
+
+	resp, msg := service.programSNATExceptionRules()
+	if resp != types.Success {
+		t.Fatal("failed to program snat exception rules", msg)
+	}
+	ipt, _ := service.iptables.GetIPTables()
+	if exists, _ := ipt.Exists(iptables.Nat, iptables.Postrouting, "-j", SWIFTSNATExceptions); !exists {
+		t.Fatal("jump to snat exceptions chain not found")
+	}
+	rules, _ := ipt.List(iptables.Nat, SWIFTSNATExceptions)
+	if len(rules) != 3 {
+		t.Fatal("expected the chain and two ipv4 rules, got", rules)
+	}
+
+	// a removed cidr is deleted and an added one is appended on the next reconcile
+	status := service.state.ContainerStatus[ncID]
+	status.CreateNetworkContainerRequest.SNATExceptionCIDRs = []string{"192.168.0.0/16", "100.64.0.0/10"}
+	service.state.ContainerStatus[ncID] = status
+
+	resp, msg = service.programSNATExceptionRules()
+	if resp != types.Success {
+		t.Fatal("failed to reconcile snat exception rules", msg)
+	}
+	for cidr, want := range map[string]bool{"192.168.0.0/16": true, "100.64.0.0/10": true, "172.16.0.0/12": false} {
+		exists, _ := ipt.Exists(iptables.Nat, SWIFTSNATExceptions, "-s", "240.1.2.0/24", "-d", cidr, "-j", iptables.Accept)
+		if exists != want {
+			t.Fatal("unexpected snat exception rule state", cidr, exists)
+		}
+	}
+}
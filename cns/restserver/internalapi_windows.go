@@ -29,6 +29,11 @@ func (service *HTTPRestService) programSNATRules(req *cns.CreateNetworkContainer
 	return types.Success, ""
 }
 
+// programSNATExceptionRules is a no-op on windows, the SNAT exceptions are programmed on the endpoints by the cni.
+func (service *HTTPRestService) programSNATExceptionRules() (types.ResponseCode, string) {
+	return types.Success, ""
+}
+
 // setVFForAccelnetNICs is used in SWIFTV2 mode to set VF on accelnet nics
 func (service *HTTPRestService) setVFForAccelnetNICs() error {
 	// supply the primary MAC address to HNS api
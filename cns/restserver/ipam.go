@@ -8,8 +8,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/filter"
@@ -18,21 +22,31 @@ import (
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/pkg/errors"
-	"golang.org/x/exp/maps"
 )
 
 var (
-	ErrStoreEmpty             = errors.New("empty endpoint state store")
-	ErrParsePodIPFailed       = errors.New("failed to parse pod's ip")
-	ErrNoNCs                  = errors.New("no NCs found in the CNS internal state")
-	ErrOptManageEndpointState = errors.New("CNS is not set to manage the endpoint state")
-	ErrEndpointStateNotFound  = errors.New("endpoint state could not be found in the statefile")
-	ErrGetAllNCResponseEmpty  = errors.New("failed to get NC responses from statefile")
+	ErrStoreEmpty               = errors.New("empty endpoint state store")
+	ErrParsePodIPFailed         = errors.New("failed to parse pod's ip")
+	ErrNoNCs                    = errors.New("no NCs found in the CNS internal state")
+	ErrOptManageEndpointState   = errors.New("CNS is not set to manage the endpoint state")
+	ErrEndpointStateNotFound    = errors.New("endpoint state could not be found in the statefile")
+	ErrGetAllNCResponseEmpty    = errors.New("failed to get NC responses from statefile")
+	ErrNotEnoughIPs             = errors.New("not enough IPs available, waiting on Azure CNS to allocate more")
+	ErrIPAMNotReady             = errors.New("IPAM is not ready")
+	ErrDesiredIPUnavailable     = errors.New("desired IP is not available in the pool")
+	ErrInvalidIPFamily          = errors.New("invalid IP family")
+	ErrInvalidSecondaryIPs      = errors.New("invalid secondary IP count")
+	ErrSecondaryIPsNotSupported = errors.New("secondary IPs are not supported on this node")
+	ErrNoNCsOfIPFamilies        = errors.New("no NCs of the requested IP families")
+	ErrInterfaceNotDelegated    = errors.New("interface is not a delegated nic")
+	ErrDuplicateAddress         = errors.New("other hosts answered for the IPs assigned to the pod")
 )
 
 const (
 	ContainerIDLength  = 8
 	InfraInterfaceName = "eth0"
+	podQueryKey        = "pod"
+	ifNameQueryKey     = "ifName"
 )
 
 // requestIPConfigHandlerHelper validates the request, assign IPs and return the IPConfigs
@@ -48,6 +62,15 @@ func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context
 		}, errors.New("failed to validate ip config request")
 	}
 
+	if returnCode, returnMessage = service.checkNICTypesEnabled(podInfo, ipconfigsRequest); returnCode != types.Success {
+		return &cns.IPConfigsResponse{
+			Response: cns.Response{
+				ReturnCode: returnCode,
+				Message:    returnMessage,
+			},
+		}, errors.New(returnMessage)
+	}
+
 	var podIPInfoResult []cns.PodIpInfo
 	if ipconfigsRequest.BackendInterfaceExist {
 		for _, bNICMacAddress := range ipconfigsRequest.BackendInterfaceMacAddresses {
@@ -74,9 +97,18 @@ func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context
 	service.podsPendingIPAssignment.Push(podInfo.Key())
 	podIPInfo, err := requestIPConfigsHelper(service, ipconfigsRequest) //nolint:contextcheck // appease linter for revert PR
 	if err != nil {
+		returnCode := types.FailedToAllocateIPConfig
+		if errors.Is(err, ErrNotEnoughIPs) {
+			// record a pod waiting for the pool to scale up
+			service.podsWaitingForIPPool.Push(podInfo.Key())
+		}
+		if errors.Is(err, ErrDesiredIPUnavailable) {
+			// the pod is pinned to IPs which are taken or not in the pool, so it fails fast
+			returnCode = types.StaticIPUnavailable
+		}
 		return &cns.IPConfigsResponse{
 			Response: cns.Response{
-				ReturnCode: types.FailedToAllocateIPConfig,
+				ReturnCode: returnCode,
 				Message:    fmt.Sprintf("AllocateIPConfig failed: %v, IP config request is %v", err, ipconfigsRequest),
 			},
 			PodIPInfo: podIPInfo,
@@ -84,12 +116,16 @@ func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context
 	}
 
 	// record a pod assigned an IP
-	defer func() {
+	allocationStats := &cns.IPAllocationStats{}
+	if since, requests := service.podsPendingIPAssignment.PopCount(podInfo.Key()); since > 0 {
 		// observe IP assignment wait time
-		if since := service.podsPendingIPAssignment.Pop(podInfo.Key()); since > 0 {
-			ipAssignmentLatency.Observe(since.Seconds())
-		}
-	}()
+		ipAssignmentLatency.Observe(since.Seconds())
+		allocationStats.WaitForIP = since
+		allocationStats.Requests = requests
+	}
+	if since := service.podsWaitingForIPPool.Pop(podInfo.Key()); since > 0 {
+		allocationStats.WaitForPoolScaling = since
+	}
 
 	// Check if http rest service managed endpoint state is set
 	if service.Options[common.OptManageEndpointState] == true {
@@ -110,7 +146,8 @@ func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context
 		Response: cns.Response{
 			ReturnCode: types.Success,
 		},
-		PodIPInfo: podIPInfoResult,
+		PodIPInfo:       podIPInfoResult,
+		AllocationStats: allocationStats,
 	}, nil
 }
 
@@ -280,8 +317,21 @@ func (service *HTTPRestService) RequestIPConfigsHandler(w http.ResponseWriter, r
 	if err != nil {
 		return
 	}
-	var ipConfigsResp *cns.IPConfigsResponse
+	ipConfigsResp, err := service.RequestIPConfigs(r.Context(), ipconfigsRequest)
+	if err != nil {
+		w.Header().Set(cnsReturnCode, ipConfigsResp.Response.ReturnCode.String())
+		err = common.Encode(w, &ipConfigsResp)
+		logger.ResponseEx(opName, ipconfigsRequest, ipConfigsResp, ipConfigsResp.Response.ReturnCode, err)
+		return
+	}
+
+	w.Header().Set(cnsReturnCode, ipConfigsResp.Response.ReturnCode.String())
+	err = common.Encode(w, &ipConfigsResp)
+	logger.ResponseEx(opName, ipconfigsRequest, ipConfigsResp, ipConfigsResp.Response.ReturnCode, err)
+}
 
+// RequestIPConfigs assigns the IPs of the request through the IPConfigsHandlerMiddleware if set, and returns the IPConfigs.
+func (service *HTTPRestService) RequestIPConfigs(ctx context.Context, ipconfigsRequest cns.IPConfigsRequest) (*cns.IPConfigsResponse, error) {
 	// Check if IPConfigsHandlerMiddleware is set
 	if service.IPConfigsHandlerMiddleware != nil {
 		// Wrap the default datapath handlers with the middleware depending on middleware type
@@ -294,21 +344,9 @@ func (service *HTTPRestService) RequestIPConfigsHandler(w http.ResponseWriter, r
 			wrappedHandler = service.IPConfigsHandlerMiddleware.IPConfigsRequestHandlerWrapper(service.requestIPConfigHandlerHelperStandalone, nil)
 		}
 
-		ipConfigsResp, err = wrappedHandler(r.Context(), ipconfigsRequest)
-	} else {
-		ipConfigsResp, err = service.requestIPConfigHandlerHelper(r.Context(), ipconfigsRequest) // nolint:contextcheck // appease linter
-	}
-
-	if err != nil {
-		w.Header().Set(cnsReturnCode, ipConfigsResp.Response.ReturnCode.String())
-		err = common.Encode(w, &ipConfigsResp)
-		logger.ResponseEx(opName, ipconfigsRequest, ipConfigsResp, ipConfigsResp.Response.ReturnCode, err)
-		return
+		return wrappedHandler(ctx, ipconfigsRequest)
 	}
-
-	w.Header().Set(cnsReturnCode, ipConfigsResp.Response.ReturnCode.String())
-	err = common.Encode(w, &ipConfigsResp)
-	logger.ResponseEx(opName, ipconfigsRequest, ipConfigsResp, ipConfigsResp.Response.ReturnCode, err)
+	return service.requestIPConfigHandlerHelper(ctx, ipconfigsRequest)
 }
 
 func (service *HTTPRestService) updateEndpointState(ipconfigsRequest cns.IPConfigsRequest, podInfo cns.PodInfo, podIPInfo []cns.PodIpInfo) error {
@@ -318,6 +356,10 @@ func (service *HTTPRestService) updateEndpointState(ipconfigsRequest cns.IPConfi
 	service.Lock()
 	defer service.Unlock()
 	logger.Printf("[updateEndpointState] Updating endpoint state for infra container %s", ipconfigsRequest.InfraContainerID)
+	eventType := EndpointUpdated
+	if _, ok := service.EndpointState[ipconfigsRequest.InfraContainerID]; !ok {
+		eventType = EndpointCreated
+	}
 	for i := range podIPInfo {
 		if endpointInfo, ok := service.EndpointState[ipconfigsRequest.InfraContainerID]; ok {
 			logger.Warnf("[updateEndpointState] Found existing endpoint state for infra container %s", ipconfigsRequest.InfraContainerID)
@@ -370,6 +412,9 @@ func (service *HTTPRestService) updateEndpointState(ipconfigsRequest cns.IPConfi
 			return fmt.Errorf("failed to write endpoint state to store: %w", err)
 		}
 	}
+	if len(podIPInfo) > 0 {
+		service.endpointEvents.publish(eventType, ipconfigsRequest.InfraContainerID, service.EndpointState[ipconfigsRequest.InfraContainerID])
+	}
 	return nil
 }
 
@@ -513,6 +558,7 @@ func (service *HTTPRestService) removeEndpointState(podInfo cns.PodInfo) error {
 		if err != nil {
 			return fmt.Errorf("failed to write endpoint state to store: %w", err)
 		}
+		service.endpointEvents.publish(EndpointDeleted, podInfo.InfraContainerID(), nil)
 	} else { // will not fail if no endpoint state for infra container id is found
 		logger.Printf("[removeEndpointState] No endpoint state found for infra container %s", podInfo.InfraContainerID())
 	}
@@ -527,37 +573,16 @@ func (service *HTTPRestService) MarkIPAsPendingRelease(totalIpsToRelease int) (m
 	service.Lock()
 	defer service.Unlock()
 
-	for uuid, existingIpConfig := range service.PodIPConfigState {
-		if existingIpConfig.GetState() == types.PendingProgramming {
-			updatedIPConfig, err := service.updateIPConfigState(uuid, types.PendingRelease, existingIpConfig.PodInfo)
-			if err != nil {
-				return nil, err
-			}
-
-			pendingReleasedIps[uuid] = updatedIPConfig
-			if len(pendingReleasedIps) == totalIpsToRelease {
-				return pendingReleasedIps, nil
-			}
+	for _, existingIpConfig := range service.releaseCandidatesUntransacted(totalIpsToRelease) { //nolint:gocritic // intentional value copy
+		updatedIPConfig, err := service.updateIPConfigState(existingIpConfig.ID, types.PendingRelease, existingIpConfig.PodInfo)
+		if err != nil {
+			return nil, err
 		}
+		pendingReleasedIps[existingIpConfig.ID] = updatedIPConfig
 	}
-
-	// if not all expected IPs are set to PendingRelease, then check the Available IPs
-	for uuid, existingIpConfig := range service.PodIPConfigState {
-		if existingIpConfig.GetState() == types.Available {
-			updatedIPConfig, err := service.updateIPConfigState(uuid, types.PendingRelease, existingIpConfig.PodInfo)
-			if err != nil {
-				return nil, err
-			}
-
-			pendingReleasedIps[uuid] = updatedIPConfig
-
-			if len(pendingReleasedIps) == totalIpsToRelease {
-				return pendingReleasedIps, nil
-			}
-		}
+	if len(pendingReleasedIps) != totalIpsToRelease {
+		logger.Printf("[MarkIPAsPendingRelease] Set total ips to PendingRelease %d, expected %d", len(pendingReleasedIps), totalIpsToRelease)
 	}
-
-	logger.Printf("[MarkIPAsPendingRelease] Set total ips to PendingRelease %d, expected %d", len(pendingReleasedIps), totalIpsToRelease)
 	return pendingReleasedIps, nil
 }
 
@@ -571,54 +596,58 @@ func (service *HTTPRestService) MarkNIPsPendingRelease(n int) (map[string]cns.IP
 	defer service.publishIPStateMetrics()
 	service.Lock()
 	defer service.Unlock()
-	// try to release from PendingProgramming
-	pendingProgrammingIPs := make(map[string]cns.IPConfigurationStatus)
-	for uuid, ipConfig := range service.PodIPConfigState { //nolint:gocritic // intentional value copy
-		if n <= 0 {
-			break
-		}
-		if ipConfig.GetState() == types.PendingProgramming {
-			updatedIPConfig, err := service.updateIPConfigState(uuid, types.PendingRelease, ipConfig.PodInfo)
-			if err != nil {
-				return nil, err
-			}
-
-			pendingProgrammingIPs[uuid] = updatedIPConfig
-			n--
-		}
+	candidates := service.releaseCandidatesUntransacted(n)
+	if len(candidates) < n {
+		return nil, errors.New("unable to release requested number of IPs")
 	}
 
-	// try to release from Available
-	availableIPs := make(map[string]cns.IPConfigurationStatus)
-	for uuid, ipConfig := range service.PodIPConfigState { //nolint:gocritic // intentional value copy
-		if n <= 0 {
-			break
-		}
-		if ipConfig.GetState() == types.Available {
-			updatedIPConfig, err := service.updateIPConfigState(uuid, types.PendingRelease, ipConfig.PodInfo)
-			if err != nil {
-				return nil, err
-			}
-
-			availableIPs[uuid] = updatedIPConfig
-			n--
+	pendingReleasedIPs := make(map[string]cns.IPConfigurationStatus)
+	for _, ipConfig := range candidates { //nolint:gocritic // intentional value copy
+		updatedIPConfig, err := service.updateIPConfigState(ipConfig.ID, types.PendingRelease, ipConfig.PodInfo)
+		if err != nil {
+			return nil, err
 		}
+		pendingReleasedIPs[ipConfig.ID] = updatedIPConfig
 	}
+	return pendingReleasedIPs, nil
+}
 
-	// if we can release the requested quantity, return the IPs
+// releaseCandidatesUntransacted returns up to [n] IPs to release when the pool scales down, the IPs in
+// PendingProgramming state first and then the Available ones, each ordered by address so that a preview of
+// the scale down picks the same IPs.
+// Note: this func is an untransacted API as the caller will take a Service lock
+func (service *HTTPRestService) releaseCandidatesUntransacted(n int) []cns.IPConfigurationStatus {
 	if n <= 0 {
-		maps.Copy(pendingProgrammingIPs, availableIPs)
-		return pendingProgrammingIPs, nil
-	}
-
-	// else revert changes
-	for uuid, ipConfig := range pendingProgrammingIPs { //nolint:gocritic // intentional value copy
-		_, _ = service.updateIPConfigState(uuid, types.PendingProgramming, ipConfig.PodInfo)
+		return nil
+	}
+	var pendingProgramming, available []cns.IPConfigurationStatus
+	for _, ipConfig := range service.PodIPConfigState { //nolint:gocritic // intentional value copy
+		switch ipConfig.GetState() { //nolint:exhaustive // only the free IPs are released
+		case types.PendingProgramming:
+			pendingProgramming = append(pendingProgramming, ipConfig)
+		case types.Available:
+			available = append(available, ipConfig)
+		}
 	}
-	for uuid, ipConfig := range availableIPs { //nolint:gocritic // intentional value copy
-		_, _ = service.updateIPConfigState(uuid, types.Available, ipConfig.PodInfo)
+	sortByAddress(pendingProgramming)
+	sortByAddress(available)
+	candidates := append(pendingProgramming, available...) //nolint:gocritic // pendingProgramming is not used after
+	if len(candidates) > n {
+		candidates = candidates[:n]
 	}
-	return nil, errors.New("unable to release requested number of IPs")
+	return candidates
+}
+
+// sortByAddress sorts the ip configurations by ip address.
+func sortByAddress(ipConfigs []cns.IPConfigurationStatus) {
+	sort.Slice(ipConfigs, func(i, j int) bool {
+		a, errA := netip.ParseAddr(ipConfigs[i].IPAddress)
+		b, errB := netip.ParseAddr(ipConfigs[j].IPAddress)
+		if errA != nil || errB != nil {
+			return ipConfigs[i].IPAddress < ipConfigs[j].IPAddress
+		}
+		return a.Less(b)
+	})
 }
 
 // TODO: Add a change so that we should only update the current state if it is different than the new state
@@ -679,6 +708,20 @@ func (service *HTTPRestService) GetPodIPConfigState() map[string]cns.IPConfigura
 	return podIPConfigState
 }
 
+// CheckIPAMReady returns an error until CNS has an IP pool, with at least minAvailableIPs IPs available to pods.
+func (service *HTTPRestService) CheckIPAMReady(minAvailableIPs int) error {
+	service.RLock()
+	defer service.RUnlock()
+	if len(service.PodIPConfigState) == 0 {
+		return errors.Wrap(ErrIPAMNotReady, "no IPs in the pool")
+	}
+	available := len(filter.MatchAnyIPConfigState(service.PodIPConfigState, filter.StateAvailable))
+	if available < minAvailableIPs {
+		return errors.Wrapf(ErrIPAMNotReady, "%d IPs available, want at least %d", available, minAvailableIPs)
+	}
+	return nil
+}
+
 func (service *HTTPRestService) HandleDebugPodContext(w http.ResponseWriter, r *http.Request) { //nolint
 	opName := "handleDebugPodContext"
 	service.RLock()
@@ -726,6 +769,52 @@ func (service *HTTPRestService) HandleDebugIPAddresses(w http.ResponseWriter, r
 	logger.ResponseEx(opName, req, resp, resp.Response.ReturnCode, err)
 }
 
+// HandleDebugIPAMState returns the ip configurations of the pool with the pods they are assigned to, their count by
+// state and the state of the pool monitor, for the debug commands to print without decoding the raw debug data.
+func (service *HTTPRestService) HandleDebugIPAMState(w http.ResponseWriter, r *http.Request) {
+	opName := "handleDebugIPAMState"
+	var resp cns.IPAMStateResponse
+
+	if r.Method != http.MethodGet {
+		resp.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] debug ipamstate API expects a GET.",
+		}
+		err := common.Encode(w, &resp)
+		logger.Response(opName, resp, resp.Response.ReturnCode, err)
+		return
+	}
+
+	state := cns.IPAMState{
+		IPConfigurations: make([]cns.IPConfigurationStatus, 0, len(service.PodIPConfigState)),
+		StateCounts:      map[types.IPState]int{},
+	}
+	service.RLock()
+	for _, ipConfig := range service.PodIPConfigState {
+		state.IPConfigurations = append(state.IPConfigurations, ipConfig)
+		state.StateCounts[ipConfig.GetState()]++
+	}
+	service.RUnlock()
+	sortByAddress(state.IPConfigurations)
+
+	// the pool monitor is read without the service lock, which it takes itself
+	service.ipamPoolScaler.Lock()
+	if monitor := service.ipamPoolScaler.monitor; monitor != nil {
+		snapshot := monitor.GetStateSnapshot()
+		state.Pool = &cns.IPAMPoolState{
+			RequestedIPCount: snapshot.CachedNNC.Spec.RequestedIPCount,
+			MinimumFreeIPs:   snapshot.MinimumFreeIps,
+			MaximumFreeIPs:   snapshot.MaximumFreeIps,
+			IPsNotInUseCount: snapshot.UpdatingIpsNotInUseCount,
+		}
+	}
+	service.ipamPoolScaler.Unlock()
+
+	resp.IPAMState = state
+	err := common.Encode(w, &resp)
+	logger.Response(opName, resp, resp.Response.ReturnCode, err)
+}
+
 // GetAssignedIPConfigs returns a filtered list of IPs which are in
 // Assigned State.
 func (service *HTTPRestService) GetAssignedIPConfigs() []cns.IPConfigurationStatus {
@@ -771,6 +860,7 @@ func (service *HTTPRestService) assignIPConfig(ipconfig cns.IPConfigurationStatu
 	}
 
 	service.PodIPIDByPodInterfaceKey[podInfo.Key()] = append(service.PodIPIDByPodInterfaceKey[podInfo.Key()], ipconfig.ID)
+	service.forgetIPReleaseUntransacted(ipconfig.ID)
 	return nil
 }
 
@@ -831,6 +921,12 @@ func (service *HTTPRestService) releaseIPConfigs(podInfo cns.PodInfo) error {
 		return fmt.Errorf("[releaseIPConfigs] Failed to release one or more IPs. Not releasing any IPs for pod %+v", podInfo)
 	}
 
+	now := time.Now()
+	for _, ip := range ipsToBeReleased { //nolint:gocritic // ignore copy
+		service.recordIPReleaseUntransacted(ip, now)
+	}
+
+	service.releaseDelegatedPrefixUntransacted(podInfo.InfraContainerID())
 	logger.Printf("[releaseIPConfigs] Successfully released all IPs for pod %+v", podInfo)
 	return nil
 }
@@ -862,16 +958,28 @@ func (service *HTTPRestService) GetExistingIPConfig(podInfo cns.PodInfo) ([]cns.
 	defer service.RUnlock()
 
 	numIPConfigs := len(service.PodIPIDByPodInterfaceKey[podInfo.Key()])
-	podIPInfo := make([]cns.PodIpInfo, numIPConfigs)
+	podIPInfo := make([]cns.PodIpInfo, 0, numIPConfigs)
 	ipConfigExists := false
+	// the IPs assigned after the first of an NC are the secondary IPs of the pod IP of that NC
+	podIPInfoByNC := make(map[string]int, numIPConfigs)
 
-	for i, ipID := range service.PodIPIDByPodInterfaceKey[podInfo.Key()] {
+	for _, ipID := range service.PodIPIDByPodInterfaceKey[podInfo.Key()] {
 		if ipID != "" {
 			if ipState, isExist := service.PodIPConfigState[ipID]; isExist {
-				if err := service.populateIPConfigInfoUntransacted(ipState, &podIPInfo[i]); err != nil {
+				ipConfigExists = true
+				if i, found := podIPInfoByNC[ipState.NCID]; found {
+					podIPInfo[i].SecondaryIPConfigs = append(podIPInfo[i].SecondaryIPConfigs, cns.IPSubnet{
+						IPAddress:    ipState.IPAddress,
+						PrefixLength: podIPInfo[i].PodIPConfig.PrefixLength,
+					})
+					continue
+				}
+				var info cns.PodIpInfo
+				if err := service.populateIPConfigInfoUntransacted(ipState, &info); err != nil {
 					return podIPInfo, isExist, err
 				}
-				ipConfigExists = true
+				podIPInfoByNC[ipState.NCID] = len(podIPInfo)
+				podIPInfo = append(podIPInfo, info)
 			} else {
 				errMsg := fmt.Sprintf("Failed to get existing ipconfig for pod %+v. Pod to IPID exists, but IPID to IPConfig doesn't exist, CNS State potentially corrupt", podInfo)
 				logger.Errorf(errMsg)
@@ -927,17 +1035,20 @@ func (service *HTTPRestService) AssignDesiredIPConfigs(podInfo cns.PodInfo, desi
 				}
 				numIPConfigsAssigned++
 			} else {
-				//nolint:goerr113 // return error
-				return []cns.PodIpInfo{}, fmt.Errorf("[AssignDesiredIPConfigs] Desired IP is already assigned %+v, requested for pod %+v", ipConfig, podInfo)
+				return []cns.PodIpInfo{}, errors.Wrapf(ErrDesiredIPUnavailable, "[AssignDesiredIPConfigs] Desired IP is already assigned %+v, requested for pod %+v", ipConfig, podInfo)
 			}
 		case types.Available, types.PendingProgramming:
+			// A pod pinned to an IP may not take it out of the blocks of its namespace, or from the blocks of another one
+			if !service.namespaceIPBlockAllowsUntransacted(podInfo.Namespace(), ipConfig.IPAddress) {
+				return []cns.PodIpInfo{}, errors.Wrapf(ErrDesiredIPUnavailable, "IP %s is outside of the IP blocks %v of namespace %s",
+					ipConfig.IPAddress, service.namespaceIPBlocks[podInfo.Namespace()], podInfo.Namespace())
+			}
 			// This race can happen during restart, where CNS state is lost and thus we have lost the NC programmed version
 			// As part of reconcile, we mark IPs as Assigned which are already assigned to Pods (listed from APIServer)
 			ipConfigsToAssign = append(ipConfigsToAssign, ipConfig)
 		default:
 			logger.Errorf("[AssignDesiredIPConfigs] Desired IP is not available %+v", ipConfig)
-			//nolint:goerr113 // return error
-			return podIPInfo, fmt.Errorf("IP not available")
+			return []cns.PodIpInfo{}, errors.Wrapf(ErrDesiredIPUnavailable, "IP %s is %s", ipConfig.IPAddress, ipConfig.GetState())
 		}
 
 		// checks if found all of the desired IPs either as an available IP or already assigned to the pod
@@ -948,8 +1059,7 @@ func (service *HTTPRestService) AssignDesiredIPConfigs(podInfo cns.PodInfo, desi
 
 	// if we did not find all of the desired IPs return an error
 	if len(ipConfigsToAssign)+numIPConfigsAssigned != numDesiredIPAddresses {
-		//nolint:goerr113 // return error
-		return podIPInfo, fmt.Errorf("not enough desired IPs found in pool")
+		return []cns.PodIpInfo{}, errors.Wrapf(ErrDesiredIPUnavailable, "not enough desired IPs %v found in pool", desiredIPAddresses)
 	}
 
 	failedToAssignIP := false
@@ -979,54 +1089,129 @@ func (service *HTTPRestService) AssignDesiredIPConfigs(podInfo cns.PodInfo, desi
 			}
 		}
 		//nolint:goerr113 // return error
-		return podIPInfo, fmt.Errorf("not all requested ips %v were found/available in the pool", desiredIPAddresses)
+		return []cns.PodIpInfo{}, fmt.Errorf("not all requested ips %v were found/available in the pool", desiredIPAddresses)
 	}
 
 	logger.Printf("[AssignDesiredIPConfigs] Successfully assigned all desired IPs for pod %+v", podInfo)
 	return podIPInfo, nil
 }
 
-// Assigns an available IP from each NC on the NNC. If there is one NC then we expect to only have one IP return
+// Assigns an available IP of each IP family on the NNC. If there is one NC then we expect to only have one IP return
 // In the case of dualstack we would expect to have one IPv6 from one NC and one IPv4 from a second NC
-func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([]cns.PodIpInfo, error) {
-	// Gets the number of NCs which will determine the number of IPs given to a pod
-	numOfNCs := len(service.state.ContainerStatus)
+// A node may have more than one NC of a family, one per pod subnet, in which case the IP is taken from any of them that
+// has one available, so that a node keeps getting IPs once its first pod subnet is exhausted.
+func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo, ipFamilies []cns.IPFamily) ([]cns.PodIpInfo, error) {
 	// if there are no NCs on the NNC there will be no IPs in the pool so return error
-	if numOfNCs == 0 {
+	if len(service.state.ContainerStatus) == 0 {
 		return nil, ErrNoNCs
 	}
 	service.Lock()
 	defer service.Unlock()
-	// Creates a slice of PodIpInfo with the size as number of NCs to hold the result for assigned IP configs
-	podIPInfo := make([]cns.PodIpInfo, numOfNCs)
-	// This map is used to store whether or not we have found an available IP from an NC when looping through the pool
-	ipsToAssign := make(map[string]cns.IPConfigurationStatus)
+	// Gets the NCs of the requested IP families, the number of families determines the number of IPs given to a pod
+	ncFamilies := service.ncIPFamiliesUntransacted(ipFamilies)
+	if len(ncFamilies) == 0 {
+		return nil, errors.Wrapf(ErrNoNCsOfIPFamilies, "requested %v", ipFamilies)
+	}
+	families := make(map[cns.IPFamily]struct{})
+	for _, family := range ncFamilies {
+		families[family] = struct{}{}
+	}
+	numOfFamilies := len(families)
+	// Creates a slice of PodIpInfo with the size as number of IP families to hold the result for assigned IP configs
+	podIPInfo := make([]cns.PodIpInfo, numOfFamilies)
+	// This map is used to store whether or not we have found an available IP of a family when looping through the pool
+	ipsToAssign := make(map[cns.IPFamily]cns.IPConfigurationStatus)
+	// This map holds, per family, the available IP closest to the end of its release grace period
+	coolingIPs := make(map[cns.IPFamily]cns.IPConfigurationStatus)
+	coolingRemaining := make(map[cns.IPFamily]time.Duration)
+	// This map holds, per family, an available IP of an NC outside the zone of the node
+	otherZoneIPs := make(map[cns.IPFamily]cns.IPConfigurationStatus)
+	now := time.Now()
 
 	// Searches for available IPs in the pool
 	for _, ipState := range service.PodIPConfigState {
-		// check if an IP from this NC is already set side for assignment.
-		if _, ncAlreadyMarkedForAssignment := ipsToAssign[ipState.NCID]; ncAlreadyMarkedForAssignment {
+		// Checks if the NC of the current IP is of a requested family
+		family, ok := ncFamilies[ipState.NCID]
+		if !ok {
+			continue
+		}
+		// check if an IP of this family is already set side for assignment.
+		if _, familyAlreadyMarkedForAssignment := ipsToAssign[family]; familyAlreadyMarkedForAssignment {
 			continue
 		}
 		// Checks if the current IP is available
 		if ipState.GetState() != types.Available {
 			continue
 		}
-		ipsToAssign[ipState.NCID] = ipState
-		// Once one IP per container is found break out of the loop and stop searching
-		if len(ipsToAssign) == numOfNCs {
+		// Checks if the current IP may be assigned to the namespace of the pod
+		if !service.namespaceIPBlockAllowsUntransacted(podInfo.Namespace(), ipState.IPAddress) {
+			continue
+		}
+		// Keeps the IPs other hosts answered for out of the pool
+		if service.ipQuarantinedUntransacted(ipState.ID, now) {
+			continue
+		}
+		// Keeps the IPs released recently out of the pool while they are in their grace period
+		if remaining := service.ipReleaseGraceRemainingUntransacted(ipState.ID, now); remaining > 0 {
+			if r, found := coolingRemaining[family]; !found || remaining < r {
+				coolingIPs[family], coolingRemaining[family] = ipState, remaining
+			}
+			continue
+		}
+		// Keeps looking for an IP of an NC in the zone of the node
+		if !service.ncInZoneUntransacted(ipState.NCID) {
+			if _, found := otherZoneIPs[family]; !found {
+				otherZoneIPs[family] = ipState
+			}
+			continue
+		}
+		ipsToAssign[family] = ipState
+		// Once one IP per family is found break out of the loop and stop searching
+		if len(ipsToAssign) == numOfFamilies {
 			break
 		}
 	}
 
-	// Checks to make sure we found one IP for each NC
-	if len(ipsToAssign) != numOfNCs {
-		for ncID := range service.state.ContainerStatus {
-			if _, found := ipsToAssign[ncID]; found {
+	// Falls back to the IPs of the NCs in other zones when the NCs in the zone of the node have none available
+	for family, ipState := range otherZoneIPs {
+		if _, found := ipsToAssign[family]; found {
+			continue
+		}
+		logger.Printf("[AssignAvailableIPConfigs] Assigning IP %s of %s outside availability zone %s, no IP of the zone is available",
+			ipState.IPAddress, ipState.NCID, service.availabilityZone)
+		ipsToAssign[family] = ipState
+	}
+
+	// Falls back to the IPs in their grace period rather than failing the pod when nothing else is available
+	for family, ipState := range coolingIPs {
+		if _, found := ipsToAssign[family]; found {
+			continue
+		}
+		logger.Printf("[AssignAvailableIPConfigs] Assigning IP %s %s before the end of its release grace period, no other IP is available for %s",
+			ipState.IPAddress, coolingRemaining[family], ipState.NCID)
+		ipReleaseGraceBypassCount.Inc()
+		ipsToAssign[family] = ipState
+	}
+
+	// Checks to make sure we found one IP for each family
+	if len(ipsToAssign) != numOfFamilies {
+		for family := range families {
+			if _, found := ipsToAssign[family]; found {
 				continue
 			}
-			return podIPInfo, errors.Errorf("not enough IPs available for %s, waiting on Azure CNS to allocate more with NC Status: %s",
-				ncID, string(service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.NCStatus))
+			ncIDs := make([]string, 0, len(ncFamilies))
+			ncStatuses := make([]string, 0, len(ncFamilies))
+			for ncID, ncFamily := range ncFamilies {
+				if ncFamily == family {
+					ncIDs = append(ncIDs, ncID)
+					ncStatuses = append(ncStatuses, string(service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.NCStatus))
+				}
+			}
+			if len(service.namespaceIPBlocks[podInfo.Namespace()]) > 0 {
+				return podIPInfo, errors.Wrapf(ErrNotEnoughIPs, "no IP available for %v in the IP blocks %v of namespace %s",
+					ncIDs, service.namespaceIPBlocks[podInfo.Namespace()], podInfo.Namespace())
+			}
+			return podIPInfo, errors.Wrapf(ErrNotEnoughIPs, "no IP available for %v with NC Status: %v", ncIDs, ncStatuses)
 		}
 	}
 
@@ -1078,16 +1263,158 @@ func requestIPConfigsHelper(service *HTTPRestService, req cns.IPConfigsRequest)
 		return podIPInfo, err
 	}
 
+	if req.SecondaryIPCount < 0 {
+		return []cns.PodIpInfo{}, errors.Wrapf(ErrInvalidSecondaryIPs, "%d", req.SecondaryIPCount)
+	}
+	if req.SecondaryIPCount > 0 {
+		// refused before any IP is assigned, rather than failing the endpoint creation of the pod
+		if err := secondaryIPsSupported(); err != nil {
+			return []cns.PodIpInfo{}, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		podIPInfo, err := assignIPConfigsHelper(service, podInfo, req)
+		// the desired IPs of a pod are the only ones it may get, they are not probed
+		if err != nil || len(req.DesiredIPAddresses) > 0 || service.quarantineDuplicateAddresses(context.TODO(), podInfo) == 0 {
+			return podIPInfo, err
+		}
+		// the pod is assigned other IPs than the ones other hosts answered for
+		if err := service.releaseIPConfigs(podInfo); err != nil {
+			return []cns.PodIpInfo{}, errors.Wrapf(err, "failed to release the duplicate IPs of pod %+v", podInfo)
+		}
+		if attempt == maxDuplicateAddressAttempts {
+			return []cns.PodIpInfo{}, errors.Wrapf(ErrDuplicateAddress, "%d attempts", attempt)
+		}
+	}
+}
+
+// assignIPConfigsHelper assigns the pod the IPs of the request, the desired ones or any free ones.
+func assignIPConfigsHelper(service *HTTPRestService, podInfo cns.PodInfo, req cns.IPConfigsRequest) ([]cns.PodIpInfo, error) {
+	var (
+		podIPInfo []cns.PodIpInfo
+		err       error
+	)
 	// if the desired IP configs are not specified, assign any free IPConfigs
 	if len(req.DesiredIPAddresses) == 0 {
-		return service.AssignAvailableIPConfigs(podInfo)
+		if err := validateIPFamilies(req.IPFamilies); err != nil {
+			return []cns.PodIpInfo{}, err
+		}
+		podIPInfo, err = service.AssignAvailableIPConfigs(podInfo, req.IPFamilies)
+	} else {
+		if err := validateDesiredIPAddresses(req.DesiredIPAddresses); err != nil {
+			return []cns.PodIpInfo{}, err
+		}
+		podIPInfo, err = service.AssignDesiredIPConfigs(podInfo, req.DesiredIPAddresses)
+	}
+	if err != nil || req.SecondaryIPCount == 0 {
+		return podIPInfo, err
+	}
+
+	if err := service.AssignSecondaryIPConfigs(podInfo, podIPInfo, req.SecondaryIPCount); err != nil {
+		// the pod gets all of its IPs or none of them
+		if releaseErr := service.releaseIPConfigs(podInfo); releaseErr != nil {
+			logger.Errorf("[requestIPConfigsHelper] failed to release the IPs of pod %+v. err: %v", podInfo, releaseErr)
+		}
+		return podIPInfo, err
+	}
+	return podIPInfo, nil
+}
+
+// AssignSecondaryIPConfigs assigns the pod count available IPs from the NC of each of its InfraNIC pod IPs, and adds
+// them to the SecondaryIPConfigs of the pod IP. The IPs are assigned to the pod, so they are released with it, which
+// the caller does when not all of them could be assigned.
+func (service *HTTPRestService) AssignSecondaryIPConfigs(podInfo cns.PodInfo, podIPInfo []cns.PodIpInfo, count int) error {
+	service.Lock()
+	defer service.Unlock()
+
+	// the NC of each pod IP, by the IP
+	ncIDs := make(map[string]string, len(podIPInfo))
+	for _, ipID := range service.PodIPIDByPodInterfaceKey[podInfo.Key()] {
+		if ipState, found := service.PodIPConfigState[ipID]; found {
+			ncIDs[ipState.IPAddress] = ipState.NCID
+		}
+	}
+
+	now := time.Now()
+	assigned := 0
+	for i := range podIPInfo {
+		ncID, found := ncIDs[podIPInfo[i].PodIPConfig.IPAddress]
+		if podIPInfo[i].NICType != cns.InfraNIC || !found {
+			continue
+		}
+		secondaryIPConfigs := make([]cns.IPSubnet, 0, count)
+		for _, ipState := range service.PodIPConfigState {
+			if len(secondaryIPConfigs) == count {
+				break
+			}
+			if ipState.NCID != ncID || ipState.GetState() != types.Available ||
+				!service.namespaceIPBlockAllowsUntransacted(podInfo.Namespace(), ipState.IPAddress) ||
+				service.ipQuarantinedUntransacted(ipState.ID, now) ||
+				service.ipReleaseGraceRemainingUntransacted(ipState.ID, now) > 0 {
+				continue
+			}
+			if err := service.assignIPConfig(ipState, podInfo); err != nil {
+				return err
+			}
+			assigned++
+			secondaryIPConfigs = append(secondaryIPConfigs, cns.IPSubnet{
+				IPAddress:    ipState.IPAddress,
+				PrefixLength: podIPInfo[i].PodIPConfig.PrefixLength,
+			})
+		}
+		if len(secondaryIPConfigs) < count {
+			return errors.Wrapf(ErrNotEnoughIPs, "%d secondary IPs of %s requested, %d available", count, ncID, len(secondaryIPConfigs))
+		}
+		podIPInfo[i].SecondaryIPConfigs = secondaryIPConfigs
+	}
+
+	logger.Printf("[AssignSecondaryIPConfigs] Successfully assigned %d secondary IPs for pod %+v", assigned, podInfo)
+	return nil
+}
+
+// ncIPFamiliesUntransacted returns the IP family of each NC whose IPs are of one of the families, or of all the NCs
+// when no family is given.
+// Note: this func is an untransacted API as the caller will take a Service lock
+func (service *HTTPRestService) ncIPFamiliesUntransacted(ipFamilies []cns.IPFamily) map[string]cns.IPFamily {
+	ncFamilies := make(map[string]cns.IPFamily, len(service.state.ContainerStatus))
+	for ncID := range service.state.ContainerStatus {
+		family := ncIPFamily(service.state.ContainerStatus[ncID].CreateNetworkContainerRequest)
+		if len(ipFamilies) == 0 || slices.Contains(ipFamilies, family) {
+			ncFamilies[ncID] = family
+		}
 	}
+	return ncFamilies
+}
 
-	if err := validateDesiredIPAddresses(req.DesiredIPAddresses); err != nil {
-		return []cns.PodIpInfo{}, err
+// ncIPFamily returns the family of the pod IPs of the NC, from one of its secondary IPs or else from its primary IP.
+func ncIPFamily(req cns.CreateNetworkContainerRequest) cns.IPFamily {
+	var ip net.IP
+	for _, secIPConfig := range req.SecondaryIPConfigs {
+		if ip = net.ParseIP(secIPConfig.IPAddress); ip != nil {
+			break
+		}
 	}
+	if ip == nil {
+		ip = net.ParseIP(req.IPConfiguration.IPSubnet.IPAddress)
+	}
+	if ip == nil {
+		return ""
+	}
+	if ip.To4() != nil {
+		return cns.IPv4Family
+	}
+	return cns.IPv6Family
+}
 
-	return service.AssignDesiredIPConfigs(podInfo, req.DesiredIPAddresses)
+// checks the IP families of a request are all known
+func validateIPFamilies(ipFamilies []cns.IPFamily) error {
+	for _, ipFamily := range ipFamilies {
+		if ipFamily != cns.IPv4Family && ipFamily != cns.IPv6Family {
+			return errors.Wrapf(ErrInvalidIPFamily, "%q", ipFamily)
+		}
+	}
+	return nil
 }
 
 // checks all desired IPs for a request to make sure they are all valid
@@ -1102,7 +1429,8 @@ func validateDesiredIPAddresses(desiredIPs []string) error {
 	return nil
 }
 
-// EndpointHandlerAPI forwards the endpoint related APIs to GetEndpointHandler or UpdateEndpointHandler based on the http method
+// EndpointHandlerAPI forwards the endpoint related APIs to GetEndpointHandler, UpdateEndpointHandler or
+// DetachEndpointInterfaceHandler based on the http method
 func (service *HTTPRestService) EndpointHandlerAPI(w http.ResponseWriter, r *http.Request) {
 	opName := "endpointHandler"
 	logger.Printf("[EndpointHandlerAPI] EndpointHandlerAPI received request with http Method %s", r.Method)
@@ -1120,11 +1448,17 @@ func (service *HTTPRestService) EndpointHandlerAPI(w http.ResponseWriter, r *htt
 	}
 	switch r.Method {
 	case http.MethodGet:
+		if r.URL.Query().Has(podQueryKey) {
+			service.GetPodEndpointsHandler(w, r)
+			return
+		}
 		service.GetEndpointHandler(w, r)
 	case http.MethodPatch:
 		service.UpdateEndpointHandler(w, r)
+	case http.MethodDelete:
+		service.DetachEndpointInterfaceHandler(w, r)
 	default:
-		logger.Errorf("[EndpointHandlerAPI] EndpointHandler API expect http Get or Patch method")
+		logger.Errorf("[EndpointHandlerAPI] EndpointHandler API expect http Get, Patch or Delete method")
 	}
 }
 
@@ -1203,6 +1537,65 @@ func (service *HTTPRestService) GetEndpointHelper(endpointID string) (*EndpointI
 	return nil, ErrEndpointStateNotFound
 }
 
+// GetPodEndpointsHandler handles the incoming requests for the endpoints of a pod, given as ?pod=<namespace>/<name>
+func (service *HTTPRestService) GetPodEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "getPodEndpoints"
+	pod := r.URL.Query().Get(podQueryKey)
+	logger.Printf("[GetPodEndpoints] GetPodEndpoints for pod %s", pod)
+
+	var response GetPodEndpointsResponse
+	podNamespace, podName, found := strings.Cut(pod, "/")
+	if !found || podNamespace == "" || podName == "" {
+		response.Response = Response{
+			ReturnCode: types.InvalidRequest,
+			Message:    fmt.Sprintf("[GetPodEndpoints] invalid pod %q, expected <namespace>/<name>", pod),
+		}
+	} else if endpoints, err := service.GetPodEndpointsHelper(podNamespace, podName); err != nil {
+		response.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[GetPodEndpoints] GetPodEndpoints failed with error: %s", err.Error()),
+		}
+		if errors.Is(err, ErrEndpointStateNotFound) {
+			response.Response.ReturnCode = types.NotFound
+		}
+	} else {
+		response.Response = Response{
+			ReturnCode: types.Success,
+			Message:    "[GetPodEndpoints] GetPodEndpoints returned successfully",
+		}
+		response.Endpoints = endpoints
+	}
+
+	w.Header().Set(cnsReturnCode, response.Response.ReturnCode.String())
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// GetPodEndpointsHelper returns the states of the endpoints of the given pod, by endpoint id
+func (service *HTTPRestService) GetPodEndpointsHelper(podNamespace, podName string) (map[string]*EndpointInfo, error) {
+	if service.EndpointStateStore == nil {
+		return nil, ErrStoreEmpty
+	}
+
+	if err := service.EndpointStateStore.Read(EndpointStoreKey, &service.EndpointState); err != nil {
+		if !errors.Is(err, store.ErrKeyNotFound) {
+			logger.Errorf("[GetPodEndpoints]  Failed to retrieve state, err:%v", err)
+		}
+		return nil, ErrEndpointStateNotFound
+	}
+
+	endpoints := make(map[string]*EndpointInfo)
+	for endpointID, endpointInfo := range service.EndpointState {
+		if endpointInfo.PodNamespace == podNamespace && endpointInfo.PodName == podName {
+			endpoints[endpointID] = endpointInfo
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, ErrEndpointStateNotFound
+	}
+	return endpoints, nil
+}
+
 // UpdateEndpointHandler handles the incoming UpdateEndpoint requests with http Patch method
 func (service *HTTPRestService) UpdateEndpointHandler(w http.ResponseWriter, r *http.Request) {
 	opName := "UpdateEndpointHandler"
@@ -1278,6 +1671,77 @@ func (service *HTTPRestService) UpdateEndpointHelper(endpointID string, req map[
 		return fmt.Errorf("[updateEndpoint] failed to write endpoint state to store for pod %s :  %w", endpointInfo.PodName, err)
 	}
 	logger.Printf("[updateEndpoint] successfully write the state to the file %s", endpointID)
+	if endpointExist {
+		service.endpointEvents.publish(EndpointUpdated, endpointID, endpointInfo)
+	} else {
+		service.endpointEvents.publish(EndpointCreated, endpointID, endpointInfo)
+	}
+	return nil
+}
+
+// DetachEndpointInterfaceHandler handles the incoming requests to remove a delegated nic, given as ?ifName=<name>, from
+// the state of a running endpoint with http Delete method, once the nic was released from the pod
+func (service *HTTPRestService) DetachEndpointInterfaceHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "detachEndpointInterface"
+	endpointID := strings.TrimPrefix(r.URL.Path, cns.EndpointPath)
+	ifName := r.URL.Query().Get(ifNameQueryKey)
+	logger.Printf("[DetachEndpointInterface] DetachEndpointInterface for %s of %s", ifName, endpointID)
+
+	response := cns.Response{
+		ReturnCode: types.Success,
+		Message:    "[DetachEndpointInterface] DetachEndpointInterface returned successfully",
+	}
+	if ifName == "" {
+		response = cns.Response{
+			ReturnCode: types.InvalidRequest,
+			Message:    "[DetachEndpointInterface] No Interface has been provided",
+		}
+	} else if err := service.DetachEndpointInterfaceHelper(endpointID, ifName); err != nil {
+		response = cns.Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[DetachEndpointInterface] DetachEndpointInterface failed with error: %s", err.Error()),
+		}
+		switch {
+		case errors.Is(err, ErrEndpointStateNotFound):
+			response.ReturnCode = types.NotFound
+		case errors.Is(err, ErrInterfaceNotDelegated):
+			response.ReturnCode = types.InvalidRequest
+		}
+	}
+
+	w.Header().Set(cnsReturnCode, response.ReturnCode.String())
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.ReturnCode, err)
+}
+
+// DetachEndpointInterfaceHelper removes the delegated nic ifName from the state of the given endpointId, which keeps
+// its other interfaces. A nic already removed is not an error, so that the caller can retry.
+func (service *HTTPRestService) DetachEndpointInterfaceHelper(endpointID, ifName string) error {
+	if service.EndpointStateStore == nil {
+		return ErrStoreEmpty
+	}
+
+	endpointInfo, ok := service.EndpointState[endpointID]
+	if !ok {
+		return ErrEndpointStateNotFound
+	}
+	ipInfo, ok := endpointInfo.IfnameToIPMap[ifName]
+	if !ok {
+		logger.Printf("[DetachEndpointInterface] %s was already removed from endpoint %s", ifName, endpointID)
+		return nil
+	}
+	if ipInfo.NICType != cns.NodeNetworkInterfaceFrontendNIC {
+		return errors.Wrapf(ErrInterfaceNotDelegated, "%s has nic type %q", ifName, ipInfo.NICType)
+	}
+
+	delete(endpointInfo.IfnameToIPMap, ifName)
+	if err := service.EndpointStateStore.Write(EndpointStoreKey, service.EndpointState); err != nil {
+		// keep the nic in the state the store still has, so that the detach is retried
+		endpointInfo.IfnameToIPMap[ifName] = ipInfo
+		return fmt.Errorf("[DetachEndpointInterface] failed to write endpoint state to store for pod %s :  %w", endpointInfo.PodName, err)
+	}
+	logger.Printf("[DetachEndpointInterface] removed %s from endpoint %s", ifName, endpointID)
+	service.endpointEvents.publish(EndpointUpdated, endpointID, endpointInfo)
 	return nil
 }
 
@@ -1313,6 +1777,30 @@ func updateIPInfoMap(iPInfo map[string]*IPInfo, interfaceInfo *IPInfo, ifName, e
 		iPInfo[ifName].MacAddress = interfaceInfo.MacAddress
 		logger.Printf("[updateEndpoint] update the endpoint %s with MacAddress  %s", endpointID, interfaceInfo.MacAddress)
 	}
+	if interfaceInfo.NetNsPath != "" {
+		iPInfo[ifName].NetNsPath = interfaceInfo.NetNsPath
+		logger.Printf("[updateEndpoint] update the endpoint %s with NetNsPath  %s", endpointID, interfaceInfo.NetNsPath)
+	}
+	if len(interfaceInfo.OutboundNATExceptions) > 0 {
+		iPInfo[ifName].OutboundNATExceptions = interfaceInfo.OutboundNATExceptions
+		logger.Printf("[updateEndpoint] update the endpoint %s with OutboundNATExceptions  %v", endpointID, interfaceInfo.OutboundNATExceptions)
+	}
+	if interfaceInfo.EnableEBPFDatapath {
+		iPInfo[ifName].EnableEBPFDatapath = true
+		logger.Printf("[updateEndpoint] update the endpoint %s with EnableEBPFDatapath", endpointID)
+	}
+	if len(interfaceInfo.Routes) > 0 {
+		iPInfo[ifName].Routes = interfaceInfo.Routes
+		logger.Printf("[updateEndpoint] update the endpoint %s with Routes  %+v", endpointID, interfaceInfo.Routes)
+	}
+	if len(interfaceInfo.HostProtectedPorts) > 0 {
+		iPInfo[ifName].HostProtectedPorts = interfaceInfo.HostProtectedPorts
+		logger.Printf("[updateEndpoint] update the endpoint %s with HostProtectedPorts  %v", endpointID, interfaceInfo.HostProtectedPorts)
+	}
+	if interfaceInfo.RouteTable != 0 {
+		iPInfo[ifName].RouteTable = interfaceInfo.RouteTable
+		logger.Printf("[updateEndpoint] update the endpoint %s with RouteTable  %d", endpointID, interfaceInfo.RouteTable)
+	}
 }
 
 // verifyUpdateEndpointStateRequest verify the CNI request body for the UpdateENdpointState API
@@ -0,0 +1,35 @@
+package restserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+)
+
+// FuzzIPConfigsHandlers posts request bodies to the ip config handlers the CNI calls on ADD and DEL, against a pool
+// with free IPs, where a malformed request must be answered with an error rather than a panic.
+func FuzzIPConfigsHandlers(f *testing.F) {
+	svc := getTestService(cns.KubernetesCRD)
+	req := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+		testIPID2: newSecondaryIPConfig(testIP2, -1),
+	}, testNCID, "-1")
+	if returnCode := svc.CreateOrUpdateNetworkContainerInternal(req); returnCode != types.Success {
+		f.Fatalf("failed to create nc: %s", returnCode)
+	}
+
+	f.Add([]byte(`{"podInterfaceID":"abc-eth0","infraContainerID":"abc","orchestratorContext":{"PodName":"pod","PodNamespace":"default"}}`))
+	f.Add([]byte(`{"desiredIPAddresses":["10.0.0.2"],"podInterfaceID":"abc-eth0","infraContainerID":"abc",` +
+		`"orchestratorContext":{"PodName":"pod","PodNamespace":"default"},"ipFamilies":["IPv6"]}`))
+	f.Add([]byte(`{"desiredIPAddresses":["not an ip"],"orchestratorContext":{}}`))
+	f.Add([]byte(`{"BackendInterfaceExist":true,"BacknendInterfaceMacAddress":[""]}`))
+	f.Fuzz(func(_ *testing.T, b []byte) {
+		for _, handler := range []http.HandlerFunc{svc.RequestIPConfigsHandler, svc.ReleaseIPConfigsHandler} {
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, cns.RequestIPConfigs, bytes.NewReader(b)))
+		}
+	})
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/netip"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/common"
@@ -16,6 +19,8 @@ import (
 	"github.com/Azure/azure-container-networking/cns/middlewares"
 	"github.com/Azure/azure-container-networking/cns/middlewares/mock"
 	"github.com/Azure/azure-container-networking/cns/types"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	nma "github.com/Azure/azure-container-networking/nmagent"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/pkg/errors"
@@ -313,6 +318,73 @@ func TestIPAMGetAvailableIPConfigMultipleNCs(t *testing.T) {
 	ipamGetAvailableIPConfig(t, nsStates)
 }
 
+// assign one IP per IP family to the pod, from the pod subnet that has one available
+func TestIPAMGetAvailableIPConfigMultiplePodSubnets(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	otherPod := cns.NewPodInfo("a-eth0", "a", "a", "default")
+	state, _ := newPodStateWithOrchestratorContext(testIP1, testIPID1, testNCID, types.Assigned, ipPrefixBitsv4, 0, otherPod)
+	require.NoError(t, updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{testIPID1: state}, testNCID))
+
+	// the second pod subnet of the node
+	secondNCID := "1d4b0e3a-8c1f-4a57-9b8e-2f6c3d9a7e10"
+	req := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testIPID2: newSecondaryIPConfig("10.1.0.4", -1),
+	}, secondNCID, "-1")
+	req.IPConfiguration.IPSubnet.IPAddress = "10.1.0.5"
+	req.IPConfiguration.GatewayIPAddress = "10.1.0.1"
+	require.Equal(t, types.Success, svc.CreateOrUpdateNetworkContainerInternal(req))
+
+	// the first subnet is exhausted, so the pod gets its IP and gateway from the second one
+	podIPInfo, err := svc.AssignAvailableIPConfigs(cns.NewPodInfo("b-eth0", "b", "b", "default"), nil)
+	require.NoError(t, err)
+	require.Len(t, podIPInfo, 1)
+	assert.Equal(t, "10.1.0.4", podIPInfo[0].PodIPConfig.IPAddress)
+	assert.Equal(t, "10.1.0.1", podIPInfo[0].NetworkContainerPrimaryIPConfig.GatewayIPAddress)
+
+	// with both subnets exhausted the error names all the NCs of the family
+	_, err = svc.AssignAvailableIPConfigs(cns.NewPodInfo("c-eth0", "c", "c", "default"), nil)
+	require.ErrorIs(t, err, ErrNotEnoughIPs)
+	assert.Contains(t, err.Error(), testNCID)
+	assert.Contains(t, err.Error(), secondNCID)
+}
+
+// assign the pod an IP of the pod subnet in the zone of the node before the ones of the other zones
+func TestIPAMGetAvailableIPConfigAvailabilityZone(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	require.NoError(t, svc.SyncAvailabilityZone(context.Background()))
+	require.Equal(t, "1", svc.availabilityZone)
+
+	// the pod subnet in another zone
+	otherZoneNCID := "1d4b0e3a-8c1f-4a57-9b8e-2f6c3d9a7e10"
+	req := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testIPID2: newSecondaryIPConfig("10.1.0.4", -1),
+	}, otherZoneNCID, "-1")
+	req.IPConfiguration.IPSubnet.IPAddress = "10.1.0.5"
+	req.IPConfiguration.GatewayIPAddress = "10.1.0.1"
+	req.AvailabilityZone = "2"
+	require.Equal(t, types.Success, svc.CreateOrUpdateNetworkContainerInternal(req))
+
+	// the pod subnet in the zone of the node
+	req = generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		testIPID1: newSecondaryIPConfig(testIP1, -1),
+	}, testNCID, "-1")
+	req.AvailabilityZone = "1"
+	require.Equal(t, types.Success, svc.CreateOrUpdateNetworkContainerInternal(req))
+
+	podIPInfo, err := svc.AssignAvailableIPConfigs(cns.NewPodInfo("a-eth0", "a", "a", "default"), nil)
+	require.NoError(t, err)
+	require.Len(t, podIPInfo, 1)
+	assert.Equal(t, testIP1, podIPInfo[0].PodIPConfig.IPAddress)
+	assert.Equal(t, "1", podIPInfo[0].AvailabilityZone)
+
+	// the zone of the node is exhausted, so the pod gets an IP of the other zone
+	podIPInfo, err = svc.AssignAvailableIPConfigs(cns.NewPodInfo("b-eth0", "b", "b", "default"), nil)
+	require.NoError(t, err)
+	require.Len(t, podIPInfo, 1)
+	assert.Equal(t, "10.1.0.4", podIPInfo[0].PodIPConfig.IPAddress)
+	assert.Equal(t, "2", podIPInfo[0].AvailabilityZone)
+}
+
 // Add one IP per NC to the pool and request those IPs
 func ipamGetAvailableIPConfig(t *testing.T, ncStates []ncState) {
 	svc := getTestService(cns.KubernetesCRD)
@@ -718,6 +790,7 @@ func ipamFailToGetDesiredIPConfigWithAlreadyAssignedSpecfiedIP(t *testing.T, ncS
 	if err == nil {
 		t.Fatalf("Expected failure requesting already assigned IP: %+v", err)
 	}
+	require.ErrorIs(t, err, ErrDesiredIPUnavailable)
 }
 
 func TestIPAMFailToGetIPWhenAllIPsAreAssignedSingleNC(t *testing.T) {
@@ -1467,6 +1540,31 @@ func TestIPAMFailToRequestOneIPWhenExpectedToHaveTwo(t *testing.T) {
 	}
 }
 
+func TestIPAMAllocationStatsAfterPoolExhausted(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	err := updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{}, testNCID)
+	require.NoError(t, err)
+
+	req := cns.IPConfigsRequest{PodInterfaceID: testPod1Info.InterfaceID(), InfraContainerID: testPod1Info.InfraContainerID()}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+
+	// the pool has no IP, so the pod waits for it to scale up
+	_, err = svc.requestIPConfigHandlerHelper(context.TODO(), req)
+	require.ErrorIs(t, err, ErrNotEnoughIPs)
+
+	testState := newPodState(testIP1, ipIDs[0][0], testNCID, types.Available, 0)
+	err = updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{testState.ID: testState}, testNCID)
+	require.NoError(t, err)
+
+	resp, err := svc.requestIPConfigHandlerHelper(context.TODO(), req)
+	require.NoError(t, err)
+	require.NotNil(t, resp.AllocationStats)
+	assert.Equal(t, 2, resp.AllocationStats.Requests)
+	assert.Positive(t, resp.AllocationStats.WaitForIP)
+	assert.Positive(t, resp.AllocationStats.WaitForPoolScaling)
+}
+
 func TestIPAMFailToReleasePartialIPsInPool(t *testing.T) {
 	svc := getTestService(cns.KubernetesCRD)
 
@@ -1535,6 +1633,224 @@ func TestIPAMFailToRequestPartialIPsInPool(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected fail requesting IPs due to only having one in the ipconfig map, IPs in the pool will not be assigned")
 	}
+	require.ErrorIs(t, err, ErrDesiredIPUnavailable)
+}
+
+func TestIPAMRequestIPFamilies(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	state := newPodState(testIP1, testIPID1, testNCID, types.Available, 0)
+	statev6 := newPodState(testIP1v6, testIPID1v6, testNCIDv6, types.Available, 0)
+	require.NoError(t, updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{state.ID: state}, testNCID))
+	require.NoError(t, updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{statev6.ID: statev6}, testNCIDv6))
+
+	req := cns.IPConfigsRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+		IPFamilies:       []cns.IPFamily{cns.IPv6Family},
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+
+	podIPInfo, err := requestIPConfigsHelper(svc, req)
+	require.NoError(t, err)
+	require.Len(t, podIPInfo, 1)
+	assert.Equal(t, testIP1v6, podIPInfo[0].PodIPConfig.IPAddress)
+	ipConfig := svc.PodIPConfigState[testIPID1]
+	assert.Equal(t, types.Available, ipConfig.GetState())
+
+	// a dual-stack pod gets an IP of each family
+	req.PodInterfaceID, req.InfraContainerID = testPod2Info.InterfaceID(), testPod2Info.InfraContainerID()
+	req.OrchestratorContext, _ = testPod2Info.OrchestratorContext()
+	req.IPFamilies = []cns.IPFamily{cns.IPv4Family, cns.IPv6Family}
+	_, err = requestIPConfigsHelper(svc, req)
+	require.ErrorIs(t, err, ErrNotEnoughIPs)
+
+	req.IPFamilies = []cns.IPFamily{"IPv5"}
+	_, err = requestIPConfigsHelper(svc, req)
+	require.ErrorIs(t, err, ErrInvalidIPFamily)
+
+	delete(svc.state.ContainerStatus, testNCIDv6)
+	req.IPFamilies = []cns.IPFamily{cns.IPv6Family}
+	_, err = requestIPConfigsHelper(svc, req)
+	require.ErrorIs(t, err, ErrNoNCsOfIPFamilies)
+}
+
+func TestIPAMRequestSecondaryIPs(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	ipconfigs := map[string]cns.IPConfigurationStatus{}
+	for _, state := range []cns.IPConfigurationStatus{
+		newPodState(testIP1, testIPID1, testNCID, types.Available, 0),
+		newPodState(testIP2, testIPID2, testNCID, types.Available, 0),
+		newPodState(testIP3, testIPID3, testNCID, types.Available, 0),
+	} {
+		ipconfigs[state.ID] = state
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+
+	req := cns.IPConfigsRequest{
+		PodInterfaceID:   testPod1Info.InterfaceID(),
+		InfraContainerID: testPod1Info.InfraContainerID(),
+		SecondaryIPCount: 2,
+	}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+
+	podIPInfo, err := requestIPConfigsHelper(svc, req)
+	require.NoError(t, err)
+	require.Len(t, podIPInfo, 1)
+	require.Len(t, podIPInfo[0].SecondaryIPConfigs, 2)
+	ips := []string{podIPInfo[0].PodIPConfig.IPAddress}
+	for _, secondaryIPConfig := range podIPInfo[0].SecondaryIPConfigs {
+		assert.Equal(t, podIPInfo[0].PodIPConfig.PrefixLength, secondaryIPConfig.PrefixLength)
+		ips = append(ips, secondaryIPConfig.IPAddress)
+	}
+	assert.ElementsMatch(t, []string{testIP1, testIP2, testIP3}, ips)
+
+	// the pod gets the same IPs back, with the secondary IPs still under the pod IP of their NC
+	existing, err := requestIPConfigsHelper(svc, req)
+	require.NoError(t, err)
+	assert.Equal(t, podIPInfo, existing)
+
+	// the secondary IPs are released with the pod
+	require.NoError(t, svc.releaseIPConfigs(testPod1Info))
+	for _, id := range []string{testIPID1, testIPID2, testIPID3} {
+		ipConfig := svc.PodIPConfigState[id]
+		assert.Equal(t, types.Available, ipConfig.GetState())
+	}
+
+	// the pod gets all of its IPs or none of them
+	req.SecondaryIPCount = 3
+	_, err = requestIPConfigsHelper(svc, req)
+	require.ErrorIs(t, err, ErrNotEnoughIPs)
+	for _, id := range []string{testIPID1, testIPID2, testIPID3} {
+		ipConfig := svc.PodIPConfigState[id]
+		assert.Equal(t, types.Available, ipConfig.GetState())
+	}
+
+	req.SecondaryIPCount = -1
+	_, err = requestIPConfigsHelper(svc, req)
+	require.ErrorIs(t, err, ErrInvalidSecondaryIPs)
+}
+
+func TestIPAMRequestDuplicateAddress(t *testing.T) {
+	conflictMAC, _ := net.ParseMAC("00:0d:3a:01:02:03")
+	vnetMAC, _ := net.ParseMAC("12:34:56:78:9a:bc")
+
+	tests := []struct {
+		name           string
+		answers        map[string][]net.HardwareAddr
+		wantIP         string
+		wantErr        error
+		wantQuarantine []string
+	}{
+		{
+			name: "the pod gets an IP no other host answers for",
+			answers: map[string][]net.HardwareAddr{
+				testIP1: {conflictMAC},
+				testIP2: {vnetMAC},
+			},
+			wantIP:  testIP2,
+			wantErr: ErrNotEnoughIPs,
+			// the second pod is only offered the quarantined IP
+			wantQuarantine: []string{testIPID1},
+		},
+		{
+			name: "the pod fails once all its attempts conflict",
+			answers: map[string][]net.HardwareAddr{
+				testIP1: {conflictMAC},
+				testIP2: {conflictMAC, vnetMAC},
+				testIP3: {conflictMAC},
+			},
+			wantErr:        ErrDuplicateAddress,
+			wantQuarantine: []string{testIPID1, testIPID2, testIPID3},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			svc := getTestService(cns.KubernetesCRD)
+			ipconfigs := map[string]cns.IPConfigurationStatus{}
+			for ip, id := range map[string]string{testIP1: testIPID1, testIP2: testIPID2, testIP3: testIPID3} {
+				if _, found := tt.answers[ip]; found {
+					ipconfigs[id] = newPodState(ip, id, testNCID, types.Available, 0)
+				}
+			}
+			require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+			svc.duplicateAddressDetection = duplicateAddressDetection{
+				probe: func(ifName string, ip net.IP, _ time.Duration) ([]net.HardwareAddr, error) {
+					assert.Equal(t, "eth0", ifName)
+					return tt.answers[ip.String()], nil
+				},
+				ifName:        "eth0",
+				quarantine:    time.Minute,
+				ignoredMACs:   map[string]struct{}{vnetMAC.String(): {}},
+				quarantinedAt: map[string]time.Time{},
+			}
+
+			req := cns.IPConfigsRequest{
+				PodInterfaceID:   testPod1Info.InterfaceID(),
+				InfraContainerID: testPod1Info.InfraContainerID(),
+			}
+			req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+			podIPInfo, err := requestIPConfigsHelper(svc, req)
+			if tt.wantIP != "" {
+				require.NoError(t, err)
+				require.Len(t, podIPInfo, 1)
+				assert.Equal(t, tt.wantIP, podIPInfo[0].PodIPConfig.IPAddress)
+
+				req.PodInterfaceID, req.InfraContainerID = testPod2Info.InterfaceID(), testPod2Info.InfraContainerID()
+				req.OrchestratorContext, _ = testPod2Info.OrchestratorContext()
+				_, err = requestIPConfigsHelper(svc, req)
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+
+			// the quarantined IPs are released, and kept out of the pool
+			for _, id := range tt.wantQuarantine {
+				ipConfig := svc.PodIPConfigState[id]
+				assert.Equal(t, types.Available, ipConfig.GetState())
+				assert.True(t, svc.ipQuarantinedUntransacted(id, time.Now()))
+				assert.False(t, svc.ipQuarantinedUntransacted(id, time.Now().Add(time.Minute)))
+			}
+		})
+	}
+}
+
+func TestIPAMRequestStaticIPUnavailable(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	assigned, _ := newPodStateWithOrchestratorContext(testIP1, testIPID1, testNCID, types.Assigned, prefixes[0], 0, testPod1Info)
+	available := newPodState(testIP2, testIPID2, testNCID, types.Available, 0)
+	ipconfigs := map[string]cns.IPConfigurationStatus{
+		assigned.ID:  assigned,
+		available.ID: available,
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+
+	req := cns.IPConfigsRequest{
+		PodInterfaceID:   testPod2Info.InterfaceID(),
+		InfraContainerID: testPod2Info.InfraContainerID(),
+	}
+	req.OrchestratorContext, _ = testPod2Info.OrchestratorContext()
+
+	// the IP is assigned to another pod
+	req.DesiredIPAddresses = []string{testIP1}
+	resp, err := svc.requestIPConfigHandlerHelper(context.Background(), req)
+	require.ErrorIs(t, err, ErrDesiredIPUnavailable)
+	assert.Equal(t, types.StaticIPUnavailable, resp.Response.ReturnCode)
+
+	// the IP is not in the pool
+	req.DesiredIPAddresses = []string{"10.0.0.250"}
+	resp, err = svc.requestIPConfigHandlerHelper(context.Background(), req)
+	require.ErrorIs(t, err, ErrDesiredIPUnavailable)
+	assert.Equal(t, types.StaticIPUnavailable, resp.Response.ReturnCode)
+
+	// the IP is free
+	req.DesiredIPAddresses = []string{testIP2}
+	resp, err = svc.requestIPConfigHandlerHelper(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, resp.PodIPInfo, 1)
+	assert.Equal(t, testIP2, resp.PodIPInfo[0].PodIPConfig.IPAddress)
 }
 
 func TestIPAMReleaseSWIFTV2PodIPSuccess(t *testing.T) {
@@ -2182,6 +2498,16 @@ func TestStatelessCNIStateFile(t *testing.T) {
 		HnsNetworkID:  "5c0712cd-824c-4898-b1c0-2fcb16ede4fb",
 		MacAddress:    "7c:1e:52:06:d3:4b",
 	}
+	// test Case 3 - linux stateless cni
+	endpointInfo3ContainerID := "2c5a28728f26e35ed506f518e9fc9d99f5517f69eb31a0f5fc86b3d3c8156ffb"
+	endpointInfo3 := &EndpointInfo{IfnameToIPMap: make(map[string]*IPInfo)}
+	endpointInfo3.IfnameToIPMap["eth1"] = &IPInfo{
+		NICType:               cns.NodeNetworkInterfaceFrontendNIC,
+		MacAddress:            "7c:1e:52:06:d3:4c",
+		NetNsPath:             "/var/run/netns/cni-1234",
+		OutboundNATExceptions: []string{"20.0.0.0/8"},
+		EnableEBPFDatapath:    true,
+	}
 	// test cases
 	tests := []struct {
 		name       string
@@ -2215,6 +2541,14 @@ func TestStatelessCNIStateFile(t *testing.T) {
 			want:       endpointInfo2,
 			wantErr:    false,
 		},
+		{
+			name:       "linux: update endpoint with the fields to delete it",
+			endpointID: endpointInfo3ContainerID,
+			req:        endpointInfo3.IfnameToIPMap,
+			store:      svc.EndpointStateStore,
+			want:       endpointInfo3,
+			wantErr:    false,
+		},
 	}
 	ncStates := []ncState{
 		{
@@ -2281,3 +2615,195 @@ func TestStatelessCNIStateFile(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPodEndpointsHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	svc.EndpointStateStore = store.NewMockStore("")
+
+	ipNet := []net.IPNet{{IP: net.ParseIP(testIP1), Mask: net.CIDRMask(32, 32)}}
+	pod1Endpoint := &EndpointInfo{
+		PodName:      testPod1Info.Name(),
+		PodNamespace: testPod1Info.Namespace(),
+		IfnameToIPMap: map[string]*IPInfo{
+			"eth0": {
+				IPv4:          ipNet,
+				HnsEndpointID: "5c15cccc-830a-4dff-81f3-4b1e55cb7dcb",
+				NICType:       cns.InfraNIC,
+				Routes:        []cns.Route{{IPAddress: "0.0.0.0/0", GatewayIPAddress: "10.0.0.1"}},
+			},
+		},
+	}
+	require.NoError(t, svc.EndpointStateStore.Write(EndpointStoreKey, map[string]*EndpointInfo{
+		"ep1": pod1Endpoint,
+		"ep2": {PodName: testPod2Info.Name(), PodNamespace: testPod2Info.Namespace(), IfnameToIPMap: map[string]*IPInfo{}},
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode types.ResponseCode
+		want     map[string]*EndpointInfo
+	}{
+		{
+			name:     "endpoints of the pod",
+			path:     cns.PodEndpointsPath + "?pod=" + testPod1Info.Namespace() + "/" + testPod1Info.Name(),
+			wantCode: types.Success,
+			want:     map[string]*EndpointInfo{"ep1": pod1Endpoint},
+		},
+		{
+			name:     "endpoints of the pod with the endpoint path",
+			path:     cns.EndpointPath + "?pod=" + testPod1Info.Namespace() + "/" + testPod1Info.Name(),
+			wantCode: types.Success,
+			want:     map[string]*EndpointInfo{"ep1": pod1Endpoint},
+		},
+		{
+			name:     "pod without endpoints",
+			path:     cns.PodEndpointsPath + "?pod=default/unknown",
+			wantCode: types.NotFound,
+		},
+		{
+			name:     "pod without namespace",
+			path:     cns.PodEndpointsPath + "?pod=" + testPod1Info.Name(),
+			wantCode: types.InvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svc.EndpointHandlerAPI(w, httptest.NewRequest(http.MethodGet, tt.path, http.NoBody))
+
+			var resp GetPodEndpointsResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.wantCode, resp.Response.ReturnCode)
+			assert.Equal(t, tt.want, resp.Endpoints)
+		})
+	}
+}
+
+func TestDetachEndpointInterfaceHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	svc.EndpointStateStore = store.NewMockStore("")
+	svc.EndpointState = map[string]*EndpointInfo{
+		"ep1": {
+			PodName:      testPod1Info.Name(),
+			PodNamespace: testPod1Info.Namespace(),
+			IfnameToIPMap: map[string]*IPInfo{
+				"eth0": {HostVethName: "azv1", NICType: cns.InfraNIC},
+				"eth1": {MacAddress: "12:34:56:78:9a:bc", NICType: cns.NodeNetworkInterfaceFrontendNIC},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode types.ResponseCode
+	}{
+		{
+			name:     "delegated nic",
+			path:     cns.EndpointPath + "ep1?ifName=eth1",
+			wantCode: types.Success,
+		},
+		{
+			name:     "delegated nic already detached",
+			path:     cns.EndpointPath + "ep1?ifName=eth1",
+			wantCode: types.Success,
+		},
+		{
+			name:     "infra nic",
+			path:     cns.EndpointPath + "ep1?ifName=eth0",
+			wantCode: types.InvalidRequest,
+		},
+		{
+			name:     "no interface",
+			path:     cns.EndpointPath + "ep1",
+			wantCode: types.InvalidRequest,
+		},
+		{
+			name:     "unknown endpoint",
+			path:     cns.EndpointPath + "ep2?ifName=eth1",
+			wantCode: types.NotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svc.EndpointHandlerAPI(w, httptest.NewRequest(http.MethodDelete, tt.path, http.NoBody))
+
+			var resp cns.Response
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.wantCode, resp.ReturnCode, resp.Message)
+		})
+	}
+
+	// the pod keeps its infra nic, in memory and in the store
+	var state map[string]*EndpointInfo
+	require.NoError(t, svc.EndpointStateStore.Read(EndpointStoreKey, &state))
+	for _, endpoints := range []map[string]*EndpointInfo{svc.EndpointState, state} {
+		require.Contains(t, endpoints, "ep1")
+		assert.Contains(t, endpoints["ep1"].IfnameToIPMap, "eth0")
+		assert.NotContains(t, endpoints["ep1"].IfnameToIPMap, "eth1")
+	}
+}
+
+func TestCheckIPAMReady(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	require.ErrorIs(t, svc.CheckIPAMReady(0), ErrIPAMNotReady)
+
+	svc.PodIPConfigState = map[string]cns.IPConfigurationStatus{
+		"id1": newPodState(testIP1, "id1", testNCID, types.Assigned, 0),
+		"id2": newPodState(testIP2, "id2", testNCID, types.Available, 0),
+	}
+	require.NoError(t, svc.CheckIPAMReady(0))
+	require.NoError(t, svc.CheckIPAMReady(1))
+	require.ErrorIs(t, svc.CheckIPAMReady(2), ErrIPAMNotReady)
+}
+
+func TestHandleDebugIPAMState(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	assigned, err := newPodStateWithOrchestratorContext(testIP2, "id2", testNCID, types.Assigned, ipPrefixBitsv4, 0, testPod2Info)
+	require.NoError(t, err)
+	svc.PodIPConfigState = map[string]cns.IPConfigurationStatus{
+		"id10": newPodState("10.0.0.10", "id10", testNCID, types.PendingRelease, 0),
+		"id2":  assigned,
+		"id1":  newPodState(testIP1, "id1", testNCID, types.Available, 0),
+	}
+
+	get := func() cns.IPAMStateResponse {
+		w := httptest.NewRecorder()
+		svc.HandleDebugIPAMState(w, httptest.NewRequest(http.MethodGet, cns.PathDebugIPAMState, http.NoBody))
+		var resp cns.IPAMStateResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		require.Equal(t, types.Success, resp.Response.ReturnCode, resp.Response.Message)
+		return resp
+	}
+
+	// the pool is only known with a pool monitor
+	state := get().IPAMState
+	require.Len(t, state.IPConfigurations, 3)
+	assert.Equal(t, []string{testIP1, testIP2, "10.0.0.10"},
+		[]string{state.IPConfigurations[0].IPAddress, state.IPConfigurations[1].IPAddress, state.IPConfigurations[2].IPAddress})
+	assert.Equal(t, "testpod2", state.IPConfigurations[1].PodInfo.Name())
+	assert.Equal(t, map[types.IPState]int{types.Available: 1, types.Assigned: 1, types.PendingRelease: 1}, state.StateCounts)
+	assert.Nil(t, state.Pool)
+
+	svc.SetIPAMPoolMonitor(&fakes.MonitorFake{
+		IPsNotInUseCount: 1,
+		NodeNetworkConfig: &v1alpha.NodeNetworkConfig{
+			Spec:   v1alpha.NodeNetworkConfigSpec{RequestedIPCount: 16},
+			Status: v1alpha.NodeNetworkConfigStatus{Scaler: v1alpha.Scaler{BatchSize: 16, RequestThresholdPercent: 50, ReleaseThresholdPercent: 150}},
+		},
+	})
+	state = get().IPAMState
+	assert.Equal(t, &cns.IPAMPoolState{RequestedIPCount: 16, MinimumFreeIPs: 8, MaximumFreeIPs: 24, IPsNotInUseCount: 1}, state.Pool)
+
+	w := httptest.NewRecorder()
+	svc.HandleDebugIPAMState(w, httptest.NewRequest(http.MethodPost, cns.PathDebugIPAMState, http.NoBody))
+	var resp cns.IPAMStateResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
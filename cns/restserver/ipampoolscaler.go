@@ -0,0 +1,81 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+// ipamPoolScaler holds the pool monitor of the node and the scaler override last set on it through the API.
+type ipamPoolScaler struct {
+	sync.Mutex
+	monitor  cns.IPAMPoolMonitor
+	override cns.IPAMPoolScalerOverride
+}
+
+// SetIPAMPoolMonitor sets the pool monitor whose scaler is overridden through the API.
+func (service *HTTPRestService) SetIPAMPoolMonitor(monitor cns.IPAMPoolMonitor) {
+	service.ipamPoolScaler.Lock()
+	defer service.ipamPoolScaler.Unlock()
+	service.ipamPoolScaler.monitor = monitor
+}
+
+// ipamPoolScalerHandler returns the scaler override of the pool monitor on a GET, and sets it on a POST. An empty
+// override on a POST returns the pool to the scaler of the NodeNetworkConfig.
+func (service *HTTPRestService) ipamPoolScalerHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "ipamPoolScalerHandler"
+	var response cns.IPAMPoolScalerResponse
+
+	service.ipamPoolScaler.Lock()
+	defer service.ipamPoolScaler.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req cns.IPAMPoolScalerOverride
+		err := common.Decode(w, r, &req)
+		logger.Request(service.Name, &req, err)
+		if err != nil {
+			return
+		}
+		switch {
+		case service.ipamPoolScaler.monitor == nil:
+			response.Response = cns.Response{
+				ReturnCode: types.UnsupportedAPI,
+				Message:    "[Azure CNS] ipamPoolScaler API needs the IPAM pool monitor of the CRD mode.",
+			}
+		case req.BatchSize < 0 || req.RequestThresholdPercent < 0 || req.ReleaseThresholdPercent < 0:
+			response.Response = cns.Response{
+				ReturnCode: types.InvalidParameter,
+				Message:    fmt.Sprintf("[Azure CNS] %s got a negative scaler override %+v", opName, req),
+			}
+		default:
+			if err := service.ipamPoolScaler.monitor.SetScalerOverride(r.Context(), req); err != nil {
+				response.Response = cns.Response{
+					ReturnCode: types.UnexpectedError,
+					Message:    fmt.Sprintf("[Azure CNS] %s failed with error: %v", opName, err),
+				}
+				break
+			}
+			service.ipamPoolScaler.override = req
+			logger.Printf("[Azure CNS] IPAM pool scaler overridden with %+v", req)
+		}
+	default:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] ipamPoolScaler API expects a GET or POST.",
+		}
+	}
+
+	if response.Response.ReturnCode == types.Success {
+		response.Override = service.ipamPoolScaler.override
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
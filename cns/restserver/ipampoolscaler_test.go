@@ -0,0 +1,59 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/fakes"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAMPoolScalerHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	override := cns.IPAMPoolScalerOverride{BatchSize: 32, RequestThresholdPercent: 100}
+
+	do := func(method string, body interface{}) cns.IPAMPoolScalerResponse {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		svc.ipamPoolScalerHandler(w, httptest.NewRequest(method, cns.IPAMPoolScalerPath, &buf))
+		var resp cns.IPAMPoolScalerResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	// the pool monitor only runs in the crd mode
+	resp := do(http.MethodPost, override)
+	assert.Equal(t, types.UnsupportedAPI, resp.Response.ReturnCode)
+
+	monitor := &fakes.MonitorFake{}
+	svc.SetIPAMPoolMonitor(monitor)
+	resp = do(http.MethodPost, override)
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, override, resp.Override)
+	assert.Equal(t, override, monitor.ScalerOverride)
+
+	resp = do(http.MethodGet, nil)
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, override, resp.Override)
+
+	resp = do(http.MethodPost, cns.IPAMPoolScalerOverride{BatchSize: -1})
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+	assert.Equal(t, override, monitor.ScalerOverride)
+
+	// an empty override returns the pool to the scaler of the nnc
+	resp = do(http.MethodPost, cns.IPAMPoolScalerOverride{})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, cns.IPAMPoolScalerOverride{}, monitor.ScalerOverride)
+
+	resp = do(http.MethodDelete, nil)
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
@@ -0,0 +1,68 @@
+package restserver
+
+import (
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+)
+
+const (
+	ipReleaseDelayed   = "delayed"
+	ipReleaseImmediate = "immediate"
+)
+
+// ipReleaseGrace keeps the IPs released by pods out of the free pool for a grace period, so that a churning pod
+// doesn't get an IP the conntrack entries and NSG flows of its predecessor still refer to.
+type ipReleaseGrace struct {
+	period     time.Duration
+	releasedAt map[string]time.Time // key : ip id, value : when the pod released it
+}
+
+// SetIPReleaseGracePeriod sets how long a released IP stays out of the free pool. A non-positive period returns the
+// released IPs to the pool immediately.
+func (service *HTTPRestService) SetIPReleaseGracePeriod(period time.Duration) {
+	service.Lock()
+	defer service.Unlock()
+	if period < 0 {
+		period = 0
+	}
+	service.ipReleaseGrace.period = period
+	service.ipReleaseGrace.releasedAt = map[string]time.Time{}
+	logger.Printf("[SetIPReleaseGracePeriod] Released IPs return to the pool after %s", period)
+}
+
+// recordIPReleaseUntransacted starts the grace period of the IP released by a pod.
+func (service *HTTPRestService) recordIPReleaseUntransacted(ipconfig cns.IPConfigurationStatus, now time.Time) { //nolint:gocritic // ignore hugeparam
+	if service.ipReleaseGrace.period <= 0 {
+		ipReleaseCount.WithLabelValues(ipReleaseImmediate).Inc()
+		return
+	}
+	// forget the IPs whose grace period is over so that the IPs removed from the pool don't pile up
+	for id, releasedAt := range service.ipReleaseGrace.releasedAt {
+		if now.Sub(releasedAt) >= service.ipReleaseGrace.period {
+			delete(service.ipReleaseGrace.releasedAt, id)
+		}
+	}
+	service.ipReleaseGrace.releasedAt[ipconfig.ID] = now
+	ipReleaseCount.WithLabelValues(ipReleaseDelayed).Inc()
+}
+
+// ipReleaseGraceRemainingUntransacted returns how long the IP stays out of the free pool, zero when it may be assigned.
+func (service *HTTPRestService) ipReleaseGraceRemainingUntransacted(ipID string, now time.Time) time.Duration {
+	releasedAt, ok := service.ipReleaseGrace.releasedAt[ipID]
+	if !ok {
+		return 0
+	}
+	remaining := service.ipReleaseGrace.period - now.Sub(releasedAt)
+	if remaining <= 0 {
+		delete(service.ipReleaseGrace.releasedAt, ipID)
+		return 0
+	}
+	return remaining
+}
+
+// forgetIPReleaseUntransacted ends the grace period of the IP, when it is assigned again.
+func (service *HTTPRestService) forgetIPReleaseUntransacted(ipID string) {
+	delete(service.ipReleaseGrace.releasedAt, ipID)
+}
@@ -0,0 +1,61 @@
+package restserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPReleaseGracePeriod(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	ipconfigs := map[string]cns.IPConfigurationStatus{
+		testIPID1: newPodState(testIP1, testIPID1, testNCID, types.Available, 0),
+		testIPID2: newPodState(testIP2, testIPID2, testNCID, types.Available, 0),
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+	svc.SetIPReleaseGracePeriod(time.Minute)
+
+	pod := cns.NewPodInfo("a-eth0", "a", "a", "default")
+	podIPInfo, err := svc.AssignAvailableIPConfigs(pod, nil)
+	require.NoError(t, err)
+	first := podIPInfo[0].PodIPConfig.IPAddress
+	require.NoError(t, svc.releaseIPConfigs(pod))
+
+	// the released IP is in its grace period, so the next pod gets the other one
+	pod = cns.NewPodInfo("b-eth0", "b", "b", "default")
+	podIPInfo, err = svc.AssignAvailableIPConfigs(pod, nil)
+	require.NoError(t, err)
+	second := podIPInfo[0].PodIPConfig.IPAddress
+	assert.NotEqual(t, first, second)
+
+	// with no other IP available the IP in its grace period is assigned rather than failing the pod
+	podIPInfo, err = svc.AssignAvailableIPConfigs(cns.NewPodInfo("c-eth0", "c", "c", "default"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, first, podIPInfo[0].PodIPConfig.IPAddress)
+	assert.Empty(t, svc.ipReleaseGrace.releasedAt)
+}
+
+func TestIPReleaseGraceRemaining(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetIPReleaseGracePeriod(time.Minute)
+	now := time.Now()
+
+	svc.recordIPReleaseUntransacted(cns.IPConfigurationStatus{ID: testIPID1}, now.Add(-2*time.Minute))
+	svc.recordIPReleaseUntransacted(cns.IPConfigurationStatus{ID: testIPID2}, now.Add(-20*time.Second))
+	// the expired releases are forgotten when another IP is released
+	assert.NotContains(t, svc.ipReleaseGrace.releasedAt, testIPID1)
+
+	assert.Equal(t, 40*time.Second, svc.ipReleaseGraceRemainingUntransacted(testIPID2, now))
+	assert.Zero(t, svc.ipReleaseGraceRemainingUntransacted(testIPID2, now.Add(time.Minute)))
+	assert.NotContains(t, svc.ipReleaseGrace.releasedAt, testIPID2)
+	assert.Zero(t, svc.ipReleaseGraceRemainingUntransacted(testIPID3, now))
+
+	// without a grace period the released IPs return to the pool immediately
+	svc.SetIPReleaseGracePeriod(0)
+	svc.recordIPReleaseUntransacted(cns.IPConfigurationStatus{ID: testIPID1}, now)
+	assert.Zero(t, svc.ipReleaseGraceRemainingUntransacted(testIPID1, now))
+}
@@ -0,0 +1,248 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/pkg/errors"
+)
+
+// ipReservationNamespace is the namespace of the pod info the reserved IPs are assigned to, so that they show up as
+// reservations in the debug APIs.
+const ipReservationNamespace = "cns-ip-reservations"
+
+var (
+	ErrIPNotInPool         = errors.New("IP is not in the pool")
+	ErrIPNotAvailable      = errors.New("IP is not available")
+	ErrIPReservedByOther   = errors.New("IP is reserved for another owner")
+	ErrEmptyIPReservation  = errors.New("no IPs or owner to reserve them for")
+	ErrIPReservationsStore = errors.New("failed to persist the IP reservations")
+)
+
+// ipReservationPodInfo is the pod info a reserved IP is assigned to. It is keyed by the IP, so that the pod IPAM
+// never finds it as the interface of a pod.
+func ipReservationPodInfo(ip, owner string) cns.PodInfo {
+	return cns.NewPodInfo("", "reserved-"+ip, owner, ipReservationNamespace)
+}
+
+// ipReservationsHandler lists the reserved IPs on a GET, and reserves or releases IPs on a POST.
+func (service *HTTPRestService) ipReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "ipReservationsHandler"
+	var response cns.IPReservationsResponse
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req cns.IPReservationRequest
+		err := common.Decode(w, r, &req)
+		logger.Request(opName, &req, err)
+		if err != nil {
+			return
+		}
+		if req.Release {
+			err = service.ReleaseIPReservations(req.IPAddresses, req.Owner)
+		} else {
+			err = service.ReserveIPs(req.IPAddresses, req.Owner)
+		}
+		if err != nil {
+			returnCode := types.InvalidParameter
+			if errors.Is(err, ErrIPReservationsStore) {
+				returnCode = types.UnexpectedError
+			}
+			response.Response = cns.Response{
+				ReturnCode: returnCode,
+				Message:    fmt.Sprintf("[Azure CNS] %s failed with error: %v", opName, err),
+			}
+		}
+	default:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] ipReservations API expects a GET or POST.",
+		}
+	}
+
+	if response.Response.ReturnCode == types.Success {
+		response.Reservations = service.getIPReservations()
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// ReserveIPs takes the IPs out of the pool for the owner, by assigning them to a pod info of their own, and persists
+// the reservations. IPs already reserved for the owner are left as they are.
+func (service *HTTPRestService) ReserveIPs(ips []string, owner string) error {
+	if len(ips) == 0 || owner == "" {
+		return ErrEmptyIPReservation
+	}
+	defer service.publishIPStateMetrics()
+	service.Lock()
+	defer service.Unlock()
+
+	ipIDs, err := service.ipIDsByAddressUntransacted(ips)
+	if err != nil {
+		return err
+	}
+	var reserved []string
+	for _, ip := range ips {
+		if current, ok := service.ipReservations[ip]; ok {
+			if current != owner {
+				return errors.Wrapf(ErrIPReservedByOther, "%s is reserved for %s", ip, current)
+			}
+			continue
+		}
+		ipConfig := service.PodIPConfigState[ipIDs[ip]]
+		if state := ipConfig.GetState(); state != types.Available {
+			return errors.Wrapf(ErrIPNotAvailable, "%s is %s", ip, state)
+		}
+		reserved = append(reserved, ip)
+	}
+
+	for _, ip := range reserved {
+		service.ipReservations[ip] = owner
+	}
+	if err := service.saveIPReservationsUntransacted(); err != nil {
+		for _, ip := range reserved {
+			delete(service.ipReservations, ip)
+		}
+		return err
+	}
+	for _, ip := range reserved {
+		if _, err := service.updateIPConfigState(ipIDs[ip], types.Assigned, ipReservationPodInfo(ip, owner)); err != nil {
+			logger.Errorf("[ReserveIPs] Failed to assign IP %s to its reservation: %v", ip, err)
+		}
+	}
+	logger.Printf("[ReserveIPs] Reserved IPs %v for %s", reserved, owner)
+	return nil
+}
+
+// ReleaseIPReservations returns the IPs reserved for the owner to the pool. IPs which are not reserved are ignored.
+func (service *HTTPRestService) ReleaseIPReservations(ips []string, owner string) error {
+	if len(ips) == 0 || owner == "" {
+		return ErrEmptyIPReservation
+	}
+	defer service.publishIPStateMetrics()
+	service.Lock()
+	defer service.Unlock()
+
+	var released []string
+	for _, ip := range ips {
+		current, ok := service.ipReservations[ip]
+		if !ok {
+			continue
+		}
+		if current != owner {
+			return errors.Wrapf(ErrIPReservedByOther, "%s is reserved for %s", ip, current)
+		}
+		released = append(released, ip)
+	}
+
+	for _, ip := range released {
+		delete(service.ipReservations, ip)
+	}
+	if err := service.saveIPReservationsUntransacted(); err != nil {
+		for _, ip := range released {
+			service.ipReservations[ip] = owner
+		}
+		return err
+	}
+	// the IPs which left the pool meanwhile have nothing to return
+	for ipID, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if ipConfig.GetState() != types.Assigned || ipConfig.PodInfo == nil || ipConfig.PodInfo.Namespace() != ipReservationNamespace {
+			continue
+		}
+		if _, stillReserved := service.ipReservations[ipConfig.IPAddress]; stillReserved {
+			continue
+		}
+		if _, err := service.updateIPConfigState(ipID, types.Available, nil); err != nil {
+			logger.Errorf("[ReleaseIPReservations] Failed to return IP %s to the pool: %v", ipConfig.IPAddress, err)
+		}
+	}
+	logger.Printf("[ReleaseIPReservations] Released IPs %v of %s", released, owner)
+	return nil
+}
+
+// restoreIPReservations reads the persisted reservations after a restart, and takes their IPs out of the pool again.
+// The reserved IPs which are not in the pool are taken out once they are added to it.
+func (service *HTTPRestService) restoreIPReservations() {
+	if service.store == nil {
+		return
+	}
+	var reservations map[string]string
+	if err := service.store.Read(ipReservationsStoreKey, &reservations); err != nil {
+		if !errors.Is(err, store.ErrKeyNotFound) && !errors.Is(err, store.ErrStoreEmpty) {
+			logger.Errorf("[restoreIPReservations] Failed to read the IP reservations: %v", err)
+		}
+		return
+	}
+
+	defer service.publishIPStateMetrics()
+	service.Lock()
+	defer service.Unlock()
+	if service.ipReservations == nil {
+		service.ipReservations = make(map[string]string, len(reservations))
+	}
+	for ip, owner := range reservations {
+		service.ipReservations[ip] = owner
+	}
+	for ipID, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		owner, reserved := service.ipReservations[ipConfig.IPAddress]
+		if !reserved {
+			continue
+		}
+		if state := ipConfig.GetState(); state != types.Available {
+			logger.Errorf("[restoreIPReservations] IP %s reserved for %s is %s, not taking it out of the pool", ipConfig.IPAddress, owner, state)
+			continue
+		}
+		if _, err := service.updateIPConfigState(ipID, types.Assigned, ipReservationPodInfo(ipConfig.IPAddress, owner)); err != nil {
+			logger.Errorf("[restoreIPReservations] Failed to assign IP %s to its reservation: %v", ipConfig.IPAddress, err)
+		}
+	}
+	logger.Printf("[restoreIPReservations] Restored %d IP reservations", len(reservations))
+}
+
+// ipIDsByAddressUntransacted returns the IDs of the IPs of the pool, or an error if one of them is not in the pool.
+func (service *HTTPRestService) ipIDsByAddressUntransacted(ips []string) (map[string]string, error) {
+	wanted := make(map[string]struct{}, len(ips))
+	for _, ip := range ips {
+		wanted[ip] = struct{}{}
+	}
+	ipIDs := make(map[string]string, len(ips))
+	for ipID, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		if _, ok := wanted[ipConfig.IPAddress]; ok {
+			ipIDs[ipConfig.IPAddress] = ipID
+		}
+	}
+	for _, ip := range ips {
+		if _, ok := ipIDs[ip]; !ok {
+			return nil, errors.Wrap(ErrIPNotInPool, ip)
+		}
+	}
+	return ipIDs, nil
+}
+
+func (service *HTTPRestService) saveIPReservationsUntransacted() error {
+	if service.store == nil {
+		return nil
+	}
+	if err := service.store.Write(ipReservationsStoreKey, service.ipReservations); err != nil {
+		return errors.Wrapf(ErrIPReservationsStore, "%v", err)
+	}
+	return nil
+}
+
+// getIPReservations returns a copy of the reserved IPs and their owner.
+func (service *HTTPRestService) getIPReservations() map[string]string {
+	service.RLock()
+	defer service.RUnlock()
+	reservations := make(map[string]string, len(service.ipReservations))
+	for ip, owner := range service.ipReservations {
+		reservations[ip] = owner
+	}
+	return reservations
+}
@@ -0,0 +1,110 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIPReservationTestService() *HTTPRestService {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.store = store.NewMockStore("")
+	svc.PodIPConfigState = map[string]cns.IPConfigurationStatus{
+		"id1": newPodState(testIP1, "id1", testNCID, types.Available, 0),
+		"id2": newPodState(testIP2, "id2", testNCID, types.Available, 0),
+		"id3": newPodState(testIP3, "id3", testNCID, types.Assigned, 0),
+	}
+	return svc
+}
+
+func TestReserveIPs(t *testing.T) {
+	svc := newIPReservationTestService()
+
+	require.NoError(t, svc.ReserveIPs([]string{testIP1}, "vip"))
+	ipConfig := svc.PodIPConfigState["id1"]
+	assert.Equal(t, types.Assigned, ipConfig.GetState())
+	assert.Equal(t, ipReservationNamespace, ipConfig.PodInfo.Namespace())
+	assert.Equal(t, map[string]string{testIP1: "vip"}, svc.getIPReservations())
+
+	// none of the ips are reserved when one of them can't be
+	require.ErrorIs(t, svc.ReserveIPs([]string{testIP2, testIP3}, "vip"), ErrIPNotAvailable)
+	require.ErrorIs(t, svc.ReserveIPs([]string{testIP2, "10.0.0.99"}, "vip"), ErrIPNotInPool)
+	require.ErrorIs(t, svc.ReserveIPs([]string{testIP1, testIP2}, "other"), ErrIPReservedByOther)
+	ipConfig = svc.PodIPConfigState["id2"]
+	assert.Equal(t, types.Available, ipConfig.GetState())
+
+	// reserving again is a no-op
+	require.NoError(t, svc.ReserveIPs([]string{testIP1, testIP2}, "vip"))
+	assert.Equal(t, map[string]string{testIP1: "vip", testIP2: "vip"}, svc.getIPReservations())
+
+	require.ErrorIs(t, svc.ReleaseIPReservations([]string{testIP1}, "other"), ErrIPReservedByOther)
+	require.NoError(t, svc.ReleaseIPReservations([]string{testIP1, testIP3}, "vip"))
+	ipConfig = svc.PodIPConfigState["id1"]
+	assert.Equal(t, types.Available, ipConfig.GetState())
+	assert.Nil(t, ipConfig.PodInfo)
+	ipConfig = svc.PodIPConfigState["id3"]
+	assert.Equal(t, types.Assigned, ipConfig.GetState())
+	assert.Equal(t, map[string]string{testIP2: "vip"}, svc.getIPReservations())
+}
+
+func TestRestoreIPReservations(t *testing.T) {
+	svc := newIPReservationTestService()
+	require.NoError(t, svc.ReserveIPs([]string{testIP2}, "vip"))
+
+	// cns restarts with the same store, the pool is rebuilt with the ips available
+	restarted := newIPReservationTestService()
+	restarted.store = svc.store
+	restarted.restoreIPReservations()
+	ipConfig := restarted.PodIPConfigState["id2"]
+	assert.Equal(t, types.Assigned, ipConfig.GetState())
+	assert.Equal(t, map[string]string{testIP2: "vip"}, restarted.getIPReservations())
+
+	// a reserved ip added to the pool later is kept from the pods
+	restarted.PodIPConfigState = map[string]cns.IPConfigurationStatus{}
+	restarted.addIPConfigStateUntransacted(testNCID, 0, map[string]cns.SecondaryIPConfig{
+		"id2": newSecondaryIPConfig(testIP2, 0),
+	}, nil)
+	ipConfig = restarted.PodIPConfigState["id2"]
+	assert.Equal(t, types.Assigned, ipConfig.GetState())
+}
+
+func TestIPReservationsHandler(t *testing.T) {
+	svc := newIPReservationTestService()
+
+	do := func(method string, body interface{}) cns.IPReservationsResponse {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		svc.ipReservationsHandler(w, httptest.NewRequest(method, cns.IPReservationsPath, &buf))
+		var resp cns.IPReservationsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := do(http.MethodPost, cns.IPReservationRequest{IPAddresses: []string{testIP1}, Owner: "vip"})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, map[string]string{testIP1: "vip"}, resp.Reservations)
+
+	resp = do(http.MethodPost, cns.IPReservationRequest{IPAddresses: []string{testIP3}, Owner: "vip"})
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+
+	resp = do(http.MethodGet, nil)
+	assert.Equal(t, map[string]string{testIP1: "vip"}, resp.Reservations)
+
+	resp = do(http.MethodPost, cns.IPReservationRequest{IPAddresses: []string{testIP1}, Owner: "vip", Release: true})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Empty(t, resp.Reservations)
+
+	resp = do(http.MethodDelete, nil)
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
@@ -111,6 +111,39 @@ var (
 		},
 		[]string{},
 	)
+	namespaceIPBlockIPCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "namespace_ip_block_ips",
+			Help: "Count of IPs of the pool in a namespace IP block by state",
+		},
+		[]string{"namespace", "cidr", "state"},
+	)
+	namespaceIPBlockFreeRanges = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "namespace_ip_block_free_ranges",
+			Help: "Count of runs of consecutive Available IPs in a namespace IP block",
+		},
+		[]string{"namespace", "cidr"},
+	)
+	ipReleaseCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ip_release_total",
+			Help: "Count of IPs released by pods, by whether they returned to the pool after the grace period or immediately",
+		},
+		[]string{"release"},
+	)
+	ipReleaseGraceBypassCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ip_release_grace_bypass_total",
+			Help: "Count of IPs assigned during their release grace period because no other IP was available",
+		},
+	)
+	duplicateAddressCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "duplicate_address_total",
+			Help: "Count of IPs quarantined because other hosts answered the probe of them",
+		},
+	)
 )
 
 func init() {
@@ -126,6 +159,12 @@ func init() {
 		availableIPCount,
 		pendingProgrammingIPCount,
 		pendingReleaseIPCount,
+		namespaceIPBlockIPCount,
+		namespaceIPBlockFreeRanges,
+		ipReleaseCount,
+		ipReleaseGraceBypassCount,
+		duplicateAddressCount,
+		networkMetrics,
 	)
 }
 
@@ -165,9 +204,10 @@ type ipState struct {
 }
 
 type asyncMetricsRecorder struct {
-	podIPConfigSrc func() map[string]cns.IPConfigurationStatus
-	sig            chan struct{}
-	once           sync.Once
+	podIPConfigSrc      func() map[string]cns.IPConfigurationStatus
+	namespaceIPBlockSrc func() []cns.NamespaceIPBlockUsage
+	sig                 chan struct{}
+	once                sync.Once
 }
 
 // singleton recorder
@@ -213,12 +253,23 @@ func (a *asyncMetricsRecorder) record() {
 	availableIPCount.WithLabelValues(labels...).Set(float64(state.availableIPs))
 	pendingProgrammingIPCount.WithLabelValues(labels...).Set(float64(state.programmingIPs))
 	pendingReleaseIPCount.WithLabelValues(labels...).Set(float64(state.releasingIPs))
+
+	// reset the namespace IP block metrics so that the removed blocks stop being reported
+	namespaceIPBlockIPCount.Reset()
+	namespaceIPBlockFreeRanges.Reset()
+	for _, usage := range a.namespaceIPBlockSrc() {
+		namespaceIPBlockIPCount.WithLabelValues(usage.Namespace, usage.CIDR, "pool").Set(float64(usage.PoolIPs))
+		namespaceIPBlockIPCount.WithLabelValues(usage.Namespace, usage.CIDR, string(types.Assigned)).Set(float64(usage.AssignedIPs))
+		namespaceIPBlockIPCount.WithLabelValues(usage.Namespace, usage.CIDR, string(types.Available)).Set(float64(usage.AvailableIPs))
+		namespaceIPBlockFreeRanges.WithLabelValues(usage.Namespace, usage.CIDR).Set(float64(usage.FreeRanges))
+	}
 }
 
 // publishIPStateMetrics logs and publishes the IP Config state metrics to Prometheus.
 func (service *HTTPRestService) publishIPStateMetrics() {
 	recorder.once.Do(func() {
 		recorder.podIPConfigSrc = service.PodIPConfigStates
+		recorder.namespaceIPBlockSrc = service.NamespaceIPBlockUsage
 		recorder.sig = make(chan struct{})
 		go recorder.run()
 	})
@@ -0,0 +1,122 @@
+package restserver
+
+import (
+	"net/http"
+	"net/netip"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+// SetNamespaceIPBlocks replaces the CIDR blocks the pods of each namespace are assigned IPs from.
+func (service *HTTPRestService) SetNamespaceIPBlocks(blocks map[string][]netip.Prefix) {
+	service.Lock()
+	service.namespaceIPBlocks = blocks
+	service.Unlock()
+	service.publishIPStateMetrics()
+}
+
+// namespaceIPBlockAllowsUntransacted returns whether the IP may be assigned to a pod of the namespace: when the
+// namespace has blocks of the family of the IP it must be in one of them, otherwise it must be outside of the
+// blocks of the other namespaces.
+func (service *HTTPRestService) namespaceIPBlockAllowsUntransacted(namespace, ip string) bool {
+	if len(service.namespaceIPBlocks) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return true
+	}
+	addr = addr.Unmap()
+	hasFamilyBlocks, inOtherBlock := false, false
+	for ns, prefixes := range service.namespaceIPBlocks {
+		for _, prefix := range prefixes {
+			if ns != namespace {
+				inOtherBlock = inOtherBlock || prefix.Contains(addr)
+				continue
+			}
+			if prefix.Addr().Is4() != addr.Is4() {
+				continue
+			}
+			if prefix.Contains(addr) {
+				return true
+			}
+			hasFamilyBlocks = true
+		}
+	}
+	return !hasFamilyBlocks && !inOtherBlock
+}
+
+// NamespaceIPBlockUsage returns the occupancy of the IPs of the pool in each namespace IP block, sorted by namespace
+// and block.
+func (service *HTTPRestService) NamespaceIPBlockUsage() []cns.NamespaceIPBlockUsage {
+	service.RLock()
+	defer service.RUnlock()
+
+	usages := []cns.NamespaceIPBlockUsage{}
+	for namespace, prefixes := range service.namespaceIPBlocks {
+		for _, prefix := range prefixes {
+			usage := cns.NamespaceIPBlockUsage{Namespace: namespace, CIDR: prefix.String()}
+			available := []netip.Addr{}
+			for _, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+				addr, err := netip.ParseAddr(ipConfig.IPAddress)
+				if err != nil || !prefix.Contains(addr.Unmap()) {
+					continue
+				}
+				usage.PoolIPs++
+				switch ipConfig.GetState() { //nolint:exhaustive // only the assigned and available IPs are reported
+				case types.Assigned:
+					usage.AssignedIPs++
+				case types.Available:
+					usage.AvailableIPs++
+					available = append(available, addr.Unmap())
+				}
+			}
+			usage.FreeRanges, usage.LargestFreeRange = freeRanges(available)
+			usages = append(usages, usage)
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Namespace != usages[j].Namespace {
+			return usages[i].Namespace < usages[j].Namespace
+		}
+		return usages[i].CIDR < usages[j].CIDR
+	})
+	return usages
+}
+
+// freeRanges returns the number of runs of consecutive addresses in addrs, and the length of the longest one.
+func freeRanges(addrs []netip.Addr) (ranges, largest int) {
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+	length := 0
+	for i := range addrs {
+		if i == 0 || addrs[i-1].Next() != addrs[i] {
+			ranges++
+			length = 0
+		}
+		length++
+		largest = max(largest, length)
+	}
+	return ranges, largest
+}
+
+// namespaceIPBlocksHandler lists the occupancy of the namespace IP blocks on the node.
+func (service *HTTPRestService) namespaceIPBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "namespaceIPBlocksHandler"
+	var response cns.NamespaceIPBlocksResponse
+
+	if r.Method == http.MethodGet {
+		response.Blocks = service.NamespaceIPBlockUsage()
+	} else {
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] namespaceIPBlocks API expects a GET.",
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
@@ -0,0 +1,111 @@
+package restserver
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignAvailableIPConfigsHonorsNamespaceIPBlocks(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	ipconfigs := map[string]cns.IPConfigurationStatus{}
+	for id, ip := range map[string]string{testIPID1: testIP1, testIPID2: testIP2, testIPID3: testIP3, "ip4": testIP4} {
+		ipconfigs[id] = newPodState(ip, id, testNCID, types.Available, 0)
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+	svc.SetNamespaceIPBlocks(map[string][]netip.Prefix{"payments": {netip.MustParsePrefix("10.0.0.2/31")}})
+
+	assigned := map[string]bool{}
+	for _, pod := range []cns.PodInfo{
+		cns.NewPodInfo("a-eth0", "a", "a", "payments"),
+		cns.NewPodInfo("b-eth0", "b", "b", "payments"),
+	} {
+		podIPInfo, err := svc.AssignAvailableIPConfigs(pod, nil)
+		require.NoError(t, err)
+		assigned[podIPInfo[0].PodIPConfig.IPAddress] = true
+	}
+	assert.Equal(t, map[string]bool{testIP2: true, testIP3: true}, assigned)
+
+	// the blocks of the namespace are exhausted
+	_, err := svc.AssignAvailableIPConfigs(cns.NewPodInfo("c-eth0", "c", "c", "payments"), nil)
+	require.ErrorIs(t, err, ErrNotEnoughIPs)
+
+	// the pods of other namespaces are assigned IPs outside of the blocks
+	podIPInfo, err := svc.AssignAvailableIPConfigs(cns.NewPodInfo("d-eth0", "d", "d", "default"), nil)
+	require.NoError(t, err)
+	assert.Contains(t, []string{testIP1, testIP4}, podIPInfo[0].PodIPConfig.IPAddress)
+
+	assert.Equal(t, []cns.NamespaceIPBlockUsage{
+		{Namespace: "payments", CIDR: "10.0.0.2/31", PoolIPs: 2, AssignedIPs: 2},
+	}, svc.NamespaceIPBlockUsage())
+}
+
+func TestNamespaceIPBlockAllows(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	assert.True(t, svc.namespaceIPBlockAllowsUntransacted("payments", "10.0.0.1"))
+
+	svc.SetNamespaceIPBlocks(map[string][]netip.Prefix{
+		"payments": {netip.MustParsePrefix("10.0.16.0/24")},
+		"ledger":   {netip.MustParsePrefix("10.0.17.0/24"), netip.MustParsePrefix("fd00::/120")},
+	})
+	tests := []struct {
+		namespace string
+		ip        string
+		want      bool
+	}{
+		{namespace: "payments", ip: "10.0.16.10", want: true},
+		{namespace: "payments", ip: "10.0.1.10", want: false},
+		{namespace: "payments", ip: "10.0.17.10", want: false},
+		// payments has no IPv6 blocks, so it may use the IPv6 IPs outside of the blocks of ledger
+		{namespace: "payments", ip: "fd01::10", want: true},
+		{namespace: "payments", ip: "fd00::10", want: false},
+		{namespace: "ledger", ip: "fd00::10", want: true},
+		{namespace: "default", ip: "10.0.1.10", want: true},
+		{namespace: "default", ip: "10.0.16.10", want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, svc.namespaceIPBlockAllowsUntransacted(tt.namespace, tt.ip), "%s %s", tt.namespace, tt.ip)
+	}
+}
+
+func TestFreeRanges(t *testing.T) {
+	addrs := []netip.Addr{}
+	for _, ip := range []string{"10.0.0.9", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.7", "10.0.0.10"} {
+		addrs = append(addrs, netip.MustParseAddr(ip))
+	}
+	ranges, largest := freeRanges(addrs)
+	assert.Equal(t, 3, ranges)
+	assert.Equal(t, 3, largest)
+
+	ranges, largest = freeRanges(nil)
+	assert.Zero(t, ranges)
+	assert.Zero(t, largest)
+}
+
+func TestAssignDesiredIPConfigsHonorsNamespaceIPBlocks(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	ipconfigs := map[string]cns.IPConfigurationStatus{}
+	for id, ip := range map[string]string{testIPID1: testIP1, testIPID2: testIP2} {
+		ipconfigs[id] = newPodState(ip, id, testNCID, types.Available, 0)
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+	svc.SetNamespaceIPBlocks(map[string][]netip.Prefix{"payments": {netip.MustParsePrefix("10.0.0.2/32")}})
+
+	// a pod may not be pinned to an IP of the blocks of another namespace
+	_, err := svc.AssignDesiredIPConfigs(cns.NewPodInfo("a-eth0", "a", "a", "default"), []string{testIP2})
+	require.ErrorIs(t, err, ErrDesiredIPUnavailable)
+
+	// nor to an IP outside of the blocks of its own namespace
+	_, err = svc.AssignDesiredIPConfigs(cns.NewPodInfo("b-eth0", "b", "b", "payments"), []string{testIP1})
+	require.ErrorIs(t, err, ErrDesiredIPUnavailable)
+
+	podIPInfo, err := svc.AssignDesiredIPConfigs(cns.NewPodInfo("b-eth0", "b", "b", "payments"), []string{testIP2})
+	require.NoError(t, err)
+	assert.Equal(t, testIP2, podIPInfo[0].PodIPConfig.IPAddress)
+	ipConfig := svc.PodIPConfigState[testIPID1]
+	assert.Equal(t, types.Available, ipConfig.GetState())
+}
@@ -0,0 +1,187 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+const ncQueryKey = "ncid"
+
+// steps of the programming of the goal state of a network container
+const (
+	ncStepNetworkContainer = "NetworkContainer" // the host objects of the nc, created by the network container client
+	ncStepGoalState        = "GoalState"
+	ncStepSNATRules        = "SNATRules"
+	ncStepSNATExceptions   = "SNATExceptions"
+)
+
+// ncProgrammingTracker holds the outcome of the last programming of the goal state of every network container.
+type ncProgrammingTracker struct {
+	sync.Mutex
+	ncs map[string]*ncProgramming
+	now func() time.Time
+}
+
+// ncProgramming is the programming of the goal state of a network container.
+type ncProgramming struct {
+	version        string
+	steps          []cns.NCProgrammingStep
+	appliedVersion string
+	lastError      string
+	lastErrorTime  time.Time
+}
+
+// ncProgrammingPass records the steps of one programming of the goal state of a network container.
+type ncProgrammingPass struct {
+	tracker *ncProgrammingTracker
+	ncID    string
+	failed  bool
+}
+
+func (t *ncProgrammingTracker) timeNow() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// start starts a programming of the version of the goal state of the nc, which replaces the steps of the last one.
+func (t *ncProgrammingTracker) start(ncID, version string) *ncProgrammingPass {
+	t.Lock()
+	defer t.Unlock()
+	if t.ncs == nil {
+		t.ncs = map[string]*ncProgramming{}
+	}
+	nc, ok := t.ncs[ncID]
+	if !ok {
+		nc = &ncProgramming{}
+		t.ncs[ncID] = nc
+	}
+	nc.version = version
+	nc.steps = nil
+	return &ncProgrammingPass{tracker: t, ncID: ncID}
+}
+
+// record records the outcome of a step, a failed step fails the programming.
+func (p *ncProgrammingPass) record(step string, returnCode types.ResponseCode, message string) {
+	t := p.tracker
+	t.Lock()
+	defer t.Unlock()
+	nc, ok := t.ncs[p.ncID]
+	if !ok {
+		return
+	}
+	s := cns.NCProgrammingStep{Name: step, Succeeded: returnCode == types.Success, Time: t.timeNow()}
+	if !s.Succeeded {
+		s.Error = fmt.Sprintf("%s: %s", returnCode, message)
+		nc.lastError = s.Error
+		nc.lastErrorTime = s.Time
+		p.failed = true
+	}
+	nc.steps = append(nc.steps, s)
+}
+
+// finish applies the version of the programming if none of its steps failed.
+func (p *ncProgrammingPass) finish() {
+	t := p.tracker
+	t.Lock()
+	defer t.Unlock()
+	if nc, ok := t.ncs[p.ncID]; ok && !p.failed {
+		nc.appliedVersion = nc.version
+	}
+}
+
+// forget drops the programming of a deleted nc.
+func (t *ncProgrammingTracker) forget(ncID string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.ncs, ncID)
+}
+
+// status returns the programming status of the nc, whose goal state is in ncStatus.
+func (t *ncProgrammingTracker) status(ncStatus *containerstatus) cns.NCProgrammingStatus {
+	status := cns.NCProgrammingStatus{
+		NetworkContainerID: ncStatus.ID,
+		GoalVersion:        ncStatus.CreateNetworkContainerRequest.Version,
+		HostVersion:        ncStatus.HostVersion,
+	}
+
+	t.Lock()
+	if nc, ok := t.ncs[ncStatus.ID]; ok {
+		status.AppliedVersion = nc.appliedVersion
+		status.Steps = append([]cns.NCProgrammingStep(nil), nc.steps...)
+		if nc.lastError != "" {
+			lastErrorTime := nc.lastErrorTime
+			status.LastError = nc.lastError
+			status.LastErrorTime = &lastErrorTime
+		}
+	}
+	t.Unlock()
+
+	status.Programmed = status.AppliedVersion == status.GoalVersion && isHostProgrammed(ncStatus)
+	return status
+}
+
+// isHostProgrammed returns whether NMAgent programmed the goal version of the nc on the host.
+func isHostProgrammed(ncStatus *containerstatus) bool {
+	if ncStatus.VfpUpdateComplete {
+		return true
+	}
+	goalVersion, err := strconv.Atoi(ncStatus.CreateNetworkContainerRequest.Version)
+	if err != nil {
+		return false
+	}
+	hostVersion, err := strconv.Atoi(ncStatus.HostVersion)
+	if err != nil {
+		return false
+	}
+	return hostVersion >= goalVersion
+}
+
+// ncProgrammingHandler returns whether the goal state of the network containers, or of the one given as ?ncid=<id>,
+// is fully programmed on a GET, so that DNC and operators can poll the convergence of the node.
+func (service *HTTPRestService) ncProgrammingHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "ncProgrammingHandler"
+	var response cns.NCProgrammingStatusResponse
+
+	ncID := r.URL.Query().Get(ncQueryKey)
+	switch r.Method {
+	case http.MethodGet:
+		service.RLock()
+		for id := range service.state.ContainerStatus {
+			if ncID != "" && id != ncID {
+				continue
+			}
+			ncStatus := service.state.ContainerStatus[id]
+			response.NetworkContainers = append(response.NetworkContainers, service.ncProgramming.status(&ncStatus))
+		}
+		service.RUnlock()
+
+		sort.Slice(response.NetworkContainers, func(i, j int) bool {
+			return response.NetworkContainers[i].NetworkContainerID < response.NetworkContainers[j].NetworkContainerID
+		})
+		if ncID != "" && len(response.NetworkContainers) == 0 {
+			response.Response = cns.Response{
+				ReturnCode: types.UnknownContainerID,
+				Message:    fmt.Sprintf("[Azure CNS] %s found no network container %s", opName, ncID),
+			}
+		}
+	default:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] ncProgramming API expects a GET.",
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(service.Name, response, response.Response.ReturnCode, err)
+}
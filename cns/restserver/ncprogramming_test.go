@@ -0,0 +1,107 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNCProgrammingHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	do := func(method, ncID string) cns.NCProgrammingStatusResponse {
+		w := httptest.NewRecorder()
+		svc.ncProgrammingHandler(w, httptest.NewRequest(method, cns.NCProgrammingPath+"?ncid="+ncID, http.NoBody))
+		var resp cns.NCProgrammingStatusResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	ncID := "nc1"
+	req := generateNetworkContainerRequest(map[string]cns.SecondaryIPConfig{
+		uuid.New().String(): newSecondaryIPConfig("10.0.0.16", 0),
+	}, ncID, "0")
+	require.Equal(t, types.Success, svc.CreateOrUpdateNetworkContainerInternal(req))
+
+	// cns programmed the goal state, nmagent did not yet
+	resp := do(http.MethodGet, ncID)
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	require.Len(t, resp.NetworkContainers, 1)
+	status := resp.NetworkContainers[0]
+	assert.Equal(t, ncID, status.NetworkContainerID)
+	assert.Equal(t, "0", status.GoalVersion)
+	assert.Equal(t, "0", status.AppliedVersion)
+	assert.Equal(t, "-1", status.HostVersion)
+	assert.False(t, status.Programmed)
+	require.Len(t, status.Steps, 1)
+	assert.Equal(t, ncStepGoalState, status.Steps[0].Name)
+	assert.True(t, status.Steps[0].Succeeded)
+	assert.Empty(t, status.LastError)
+
+	ncStatus := svc.state.ContainerStatus[ncID]
+	ncStatus.HostVersion = "0"
+	svc.state.ContainerStatus[ncID] = ncStatus
+	resp = do(http.MethodGet, "")
+	require.Len(t, resp.NetworkContainers, 1)
+	assert.True(t, resp.NetworkContainers[0].Programmed)
+
+	resp = do(http.MethodGet, "missing")
+	assert.Equal(t, types.UnknownContainerID, resp.Response.ReturnCode)
+
+	resp = do(http.MethodPost, ncID)
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
+
+func TestNCProgrammingTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := &ncProgrammingTracker{now: func() time.Time { return now }}
+	ncStatus := &containerstatus{
+		ID:                            "nc1",
+		HostVersion:                   "2",
+		CreateNetworkContainerRequest: cns.CreateNetworkContainerRequest{Version: "1"},
+	}
+
+	pass := tracker.start("nc1", "1")
+	pass.record(ncStepGoalState, types.Success, "")
+	pass.finish()
+	status := tracker.status(ncStatus)
+	assert.Equal(t, "1", status.AppliedVersion)
+	assert.True(t, status.Programmed)
+
+	// a failed step keeps the version applied before and is the last error until the next failure
+	ncStatus.CreateNetworkContainerRequest.Version = "2"
+	pass = tracker.start("nc1", "2")
+	pass.record(ncStepGoalState, types.Success, "")
+	pass.record(ncStepSNATRules, types.UnexpectedError, "iptables failed")
+	pass.finish()
+	status = tracker.status(ncStatus)
+	assert.Equal(t, "1", status.AppliedVersion)
+	assert.False(t, status.Programmed)
+	require.Len(t, status.Steps, 2)
+	assert.False(t, status.Steps[1].Succeeded)
+	assert.Equal(t, "UnexpectedError: iptables failed", status.LastError)
+	require.NotNil(t, status.LastErrorTime)
+	assert.Equal(t, now, *status.LastErrorTime)
+
+	pass = tracker.start("nc1", "2")
+	pass.record(ncStepGoalState, types.Success, "")
+	pass.record(ncStepSNATRules, types.Success, "")
+	pass.finish()
+	status = tracker.status(ncStatus)
+	assert.Equal(t, "2", status.AppliedVersion)
+	assert.True(t, status.Programmed)
+	assert.Equal(t, "UnexpectedError: iptables failed", status.LastError)
+
+	tracker.forget("nc1")
+	status = tracker.status(ncStatus)
+	assert.Empty(t, status.AppliedVersion)
+	assert.Nil(t, status.Steps)
+}
@@ -0,0 +1,306 @@
+package restserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// networkMetricsPrefix is the prefix of the metric families which the CNI may push to CNS.
+	networkMetricsPrefix = "network_"
+	// the gauges of the network utilization pushed by the CNI
+	networkEndpointsMetric          = "network_endpoints"
+	networkSubnetCapacityIPsMetric  = "network_subnet_capacity_ips"
+	networkSubnetAvailableIPsMetric = "network_subnet_available_ips"
+	// maxNetworkMetricsSize bounds the size of a pushed metrics body.
+	maxNetworkMetricsSize = 1 << 20
+)
+
+var errUnsupportedMetricType = errors.New("unsupported metric type")
+
+// networkMetrics accumulates the metrics pushed by the CNI so that they are exposed with the CNS metrics.
+var networkMetrics = newPushedMetrics(networkMetricsPrefix)
+
+// pushedSeries is the accumulated value of a single labelled series.
+type pushedSeries struct {
+	labelValues []string
+	value       float64
+	count       uint64
+	sum         float64
+	buckets     map[float64]uint64
+}
+
+// pushedFamily is an accumulated metric family. All series of a family share the same label names.
+type pushedFamily struct {
+	desc       *prometheus.Desc
+	metricType dto.MetricType
+	labelNames []string
+	series     map[string]*pushedSeries
+}
+
+// pushedMetrics is a prometheus.Collector of metrics pushed by short lived processes. Counters and histograms are
+// pushed as the deltas observed by the process and are summed, gauges are pushed as the current value and replace the
+// previous value of the series.
+type pushedMetrics struct {
+	sync.Mutex
+	prefix   string
+	families map[string]*pushedFamily
+}
+
+func newPushedMetrics(prefix string) *pushedMetrics {
+	return &pushedMetrics{
+		prefix:   prefix,
+		families: make(map[string]*pushedFamily),
+	}
+}
+
+// Describe sends no descriptors, which makes pushedMetrics an unchecked collector since its families are not known
+// until they are pushed.
+func (p *pushedMetrics) Describe(chan<- *prometheus.Desc) {}
+
+// Collect sends the accumulated value of every pushed series.
+func (p *pushedMetrics) Collect(ch chan<- prometheus.Metric) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, family := range p.families {
+		for _, series := range family.series {
+			var (
+				metric prometheus.Metric
+				err    error
+			)
+			switch family.metricType {
+			case dto.MetricType_COUNTER:
+				metric, err = prometheus.NewConstMetric(family.desc, prometheus.CounterValue, series.value, series.labelValues...)
+			case dto.MetricType_GAUGE:
+				metric, err = prometheus.NewConstMetric(family.desc, prometheus.GaugeValue, series.value, series.labelValues...)
+			case dto.MetricType_HISTOGRAM:
+				metric, err = prometheus.NewConstHistogram(family.desc, series.count, series.sum, series.buckets, series.labelValues...)
+			default:
+				continue
+			}
+			if err != nil {
+				metric = prometheus.NewInvalidMetric(family.desc, err)
+			}
+			ch <- metric
+		}
+	}
+}
+
+// merge adds the pushed families to the accumulated metrics. Families without the prefix or without metrics are
+// ignored. Nothing is merged if any family is invalid.
+func (p *pushedMetrics) merge(families map[string]*dto.MetricFamily) error {
+	p.Lock()
+	defer p.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name, mf := range families {
+		if !strings.HasPrefix(name, p.prefix) || len(mf.GetMetric()) == 0 {
+			continue
+		}
+		if err := p.validate(mf); err != nil {
+			return errors.Wrapf(err, "invalid metric family %s", name)
+		}
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		mf := families[name]
+		family, ok := p.families[name]
+		if !ok {
+			labelNames := labelNames(mf.GetMetric()[0])
+			family = &pushedFamily{
+				desc:       prometheus.NewDesc(name, mf.GetHelp(), labelNames, nil),
+				metricType: mf.GetType(),
+				labelNames: labelNames,
+				series:     make(map[string]*pushedSeries),
+			}
+			p.families[name] = family
+		}
+
+		for _, m := range mf.GetMetric() {
+			labelValues := labelValues(m)
+			key := strings.Join(labelValues, "\xff")
+			series, ok := family.series[key]
+			if !ok {
+				series = &pushedSeries{labelValues: labelValues}
+				family.series[key] = series
+			}
+
+			switch family.metricType {
+			case dto.MetricType_COUNTER:
+				series.value += m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				series.value = m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				series.count += h.GetSampleCount()
+				series.sum += h.GetSampleSum()
+				if series.buckets == nil {
+					series.buckets = make(map[float64]uint64, len(h.GetBucket()))
+				}
+				for _, b := range h.GetBucket() {
+					series.buckets[b.GetUpperBound()] += b.GetCumulativeCount()
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate checks that mf has a supported type and that all of its metrics have the label names of the family.
+func (p *pushedMetrics) validate(mf *dto.MetricFamily) error {
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_HISTOGRAM:
+	default:
+		return errors.Wrap(errUnsupportedMetricType, mf.GetType().String())
+	}
+
+	want := labelNames(mf.GetMetric()[0])
+	if family, ok := p.families[mf.GetName()]; ok {
+		if family.metricType != mf.GetType() {
+			return errors.Errorf("type %s does not match accumulated type %s", mf.GetType(), family.metricType)
+		}
+		want = family.labelNames
+	}
+
+	for _, m := range mf.GetMetric() {
+		if got := labelNames(m); strings.Join(got, ",") != strings.Join(want, ",") {
+			return errors.Errorf("labels %v do not match %v", got, want)
+		}
+	}
+	return nil
+}
+
+// gauge calls fn with the labels, by name, and the value of every series of the pushed gauge.
+func (p *pushedMetrics) gauge(name string, fn func(labels map[string]string, value float64)) {
+	p.Lock()
+	defer p.Unlock()
+
+	family, ok := p.families[name]
+	if !ok || family.metricType != dto.MetricType_GAUGE {
+		return
+	}
+	for _, series := range family.series {
+		labels := make(map[string]string, len(family.labelNames))
+		for i, name := range family.labelNames {
+			labels[name] = series.labelValues[i]
+		}
+		fn(labels, series.value)
+	}
+}
+
+func labelNames(m *dto.Metric) []string {
+	names := make([]string, 0, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		names = append(names, l.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// labelValues returns the label values of m in the order of the sorted label names.
+func labelValues(m *dto.Metric) []string {
+	labels := append([]*dto.LabelPair(nil), m.GetLabel()...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	values := make([]string, 0, len(labels))
+	for _, l := range labels {
+		values = append(values, l.GetValue())
+	}
+	return values
+}
+
+// pushNetworkMetrics accepts network metrics in the Prometheus text format pushed by the CNI and adds them to the
+// CNS metrics.
+func (service *HTTPRestService) pushNetworkMetrics(w http.ResponseWriter, r *http.Request) {
+	var (
+		returnCode types.ResponseCode
+		errMsg     string
+	)
+
+	switch r.Method {
+	case http.MethodPost:
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(http.MaxBytesReader(w, r.Body, maxNetworkMetricsSize))
+		if err == nil {
+			err = networkMetrics.merge(families)
+		}
+		if err != nil {
+			errMsg = "[Azure-CNS] pushNetworkMetrics failed: " + err.Error()
+			returnCode = types.InvalidParameter
+		}
+	default:
+		errMsg = "[Azure-CNS] pushNetworkMetrics API expects a POST."
+		returnCode = types.UnsupportedVerb
+	}
+
+	resp := cns.Response{ReturnCode: returnCode, Message: errMsg}
+	err := common.Encode(w, &resp)
+	if returnCode != types.Success {
+		logger.Errorf("[Azure-CNS] %s", errMsg)
+	}
+	logger.Response(service.Name, resp, resp.ReturnCode, err)
+}
+
+// networkUtilization returns the utilization of the networks of the CNI from the gauges it pushed.
+func (p *pushedMetrics) networkUtilization() map[string]cns.NetworkUtilization {
+	networks := map[string]cns.NetworkUtilization{}
+	p.gauge(networkEndpointsMetric, func(labels map[string]string, value float64) {
+		utilization := networks[labels["network"]]
+		utilization.Endpoints = int(value)
+		networks[labels["network"]] = utilization
+	})
+
+	setSubnet := func(set func(*cns.SubnetUtilization, uint64)) func(map[string]string, float64) {
+		return func(labels map[string]string, value float64) {
+			utilization := networks[labels["network"]]
+			if utilization.Subnets == nil {
+				utilization.Subnets = map[string]cns.SubnetUtilization{}
+			}
+			subnet := utilization.Subnets[labels["subnet"]]
+			set(&subnet, uint64(value))
+			utilization.Subnets[labels["subnet"]] = subnet
+			networks[labels["network"]] = utilization
+		}
+	}
+	p.gauge(networkSubnetCapacityIPsMetric, setSubnet(func(s *cns.SubnetUtilization, v uint64) { s.CapacityIPs = v }))
+	p.gauge(networkSubnetAvailableIPsMetric, setSubnet(func(s *cns.SubnetUtilization, v uint64) { s.AvailableIPs = v }))
+	return networks
+}
+
+// networkUtilizationHandler returns the endpoints and the subnet ips of the networks of the CNI, as last pushed with
+// its metrics.
+func (service *HTTPRestService) networkUtilizationHandler(w http.ResponseWriter, r *http.Request) {
+	var response cns.NetworkUtilizationResponse
+
+	switch r.Method {
+	case http.MethodGet:
+		response.Networks = networkMetrics.networkUtilization()
+		if len(response.Networks) == 0 {
+			response.Response = cns.Response{
+				ReturnCode: types.NotFound,
+				Message:    "[Azure-CNS] networkUtilization found no network, the CNI pushes them with pushMetricsToCns.",
+			}
+		}
+	default:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure-CNS] networkUtilization API expects a GET.",
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(service.Name, response, response.Response.ReturnCode, err)
+}
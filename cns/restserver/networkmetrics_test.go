@@ -0,0 +1,200 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pushedNetworkMetrics = `# HELP network_endpoint_operations_total Count of endpoint operations.
+# TYPE network_endpoint_operations_total counter
+network_endpoint_operations_total{nic_type="InfraNIC",operation="create",result="success"} 1
+# HELP network_endpoints Current number of endpoints by network.
+# TYPE network_endpoints gauge
+network_endpoints{network="azure"} 3
+# HELP network_endpoint_operation_latency_seconds Endpoint operation latency.
+# TYPE network_endpoint_operation_latency_seconds histogram
+network_endpoint_operation_latency_seconds_bucket{nic_type="InfraNIC",operation="create",le="0.5"} 1
+network_endpoint_operation_latency_seconds_bucket{nic_type="InfraNIC",operation="create",le="+Inf"} 1
+network_endpoint_operation_latency_seconds_sum{nic_type="InfraNIC",operation="create"} 0.25
+network_endpoint_operation_latency_seconds_count{nic_type="InfraNIC",operation="create"} 1
+# HELP cns_other Not a network metric.
+# TYPE cns_other counter
+cns_other 1
+`
+
+func parseMetrics(t *testing.T, text string) map[string]*dto.MetricFamily {
+	t.Helper()
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+	require.NoError(t, err)
+	return families
+}
+
+func gatherPushed(t *testing.T, p *pushedMetrics) map[string]*dto.MetricFamily {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(p))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+	return byName
+}
+
+func TestPushedMetricsMerge(t *testing.T) {
+	p := newPushedMetrics(networkMetricsPrefix)
+	require.NoError(t, p.merge(parseMetrics(t, pushedNetworkMetrics)))
+	require.NoError(t, p.merge(parseMetrics(t, strings.ReplaceAll(pushedNetworkMetrics, `{network="azure"} 3`, `{network="azure"} 2`))))
+
+	got := gatherPushed(t, p)
+	assert.NotContains(t, got, "cns_other")
+
+	counter := got["network_endpoint_operations_total"]
+	require.NotNil(t, counter)
+	require.Len(t, counter.GetMetric(), 1)
+	assert.InDelta(t, 2, counter.GetMetric()[0].GetCounter().GetValue(), 0)
+
+	gauge := got["network_endpoints"]
+	require.NotNil(t, gauge)
+	require.Len(t, gauge.GetMetric(), 1)
+	assert.InDelta(t, 2, gauge.GetMetric()[0].GetGauge().GetValue(), 0)
+
+	histogram := got["network_endpoint_operation_latency_seconds"]
+	require.NotNil(t, histogram)
+	require.Len(t, histogram.GetMetric(), 1)
+	h := histogram.GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(2), h.GetSampleCount())
+	assert.InDelta(t, 0.5, h.GetSampleSum(), 0)
+	assert.Equal(t, uint64(2), h.GetBucket()[0].GetCumulativeCount())
+}
+
+func TestPushedMetricsMergeRejectsInvalidFamilies(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "type changed",
+			text: "# TYPE network_endpoints counter\nnetwork_endpoints{network=\"azure\"} 1\n",
+		},
+		{
+			name: "labels changed",
+			text: "# TYPE network_endpoints gauge\nnetwork_endpoints{nw=\"azure\"} 1\n",
+		},
+		{
+			name: "unsupported type",
+			text: "# TYPE network_summary summary\nnetwork_summary_sum 1\nnetwork_summary_count 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPushedMetrics(networkMetricsPrefix)
+			require.NoError(t, p.merge(parseMetrics(t, pushedNetworkMetrics)))
+
+			require.Error(t, p.merge(parseMetrics(t, tt.text)))
+			gauge := gatherPushed(t, p)["network_endpoints"]
+			require.NotNil(t, gauge)
+			assert.InDelta(t, 3, gauge.GetMetric()[0].GetGauge().GetValue(), 0)
+		})
+	}
+}
+
+func TestPushNetworkMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		wantCode types.ResponseCode
+	}{
+		{
+			name:     "valid metrics",
+			method:   http.MethodPost,
+			body:     pushedNetworkMetrics,
+			wantCode: types.Success,
+		},
+		{
+			name:     "malformed metrics",
+			method:   http.MethodPost,
+			body:     "network_endpoints{network=\n",
+			wantCode: types.InvalidParameter,
+		},
+		{
+			name:     "unsupported verb",
+			method:   http.MethodGet,
+			wantCode: types.UnsupportedVerb,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, cns.NetworkMetricsPath, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+			svc.pushNetworkMetrics(w, req)
+
+			var resp cns.Response
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.wantCode, resp.ReturnCode)
+		})
+	}
+}
+
+func TestNetworkUtilizationHandler(t *testing.T) {
+	defer func(pushed *pushedMetrics) { networkMetrics = pushed }(networkMetrics)
+	networkMetrics = newPushedMetrics(networkMetricsPrefix)
+
+	get := func() cns.NetworkUtilizationResponse {
+		req := httptest.NewRequest(http.MethodGet, cns.NetworkUtilizationPath, http.NoBody)
+		w := httptest.NewRecorder()
+		svc.networkUtilizationHandler(w, req)
+
+		var resp cns.NetworkUtilizationResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	assert.Equal(t, types.NotFound, get().Response.ReturnCode)
+
+	require.NoError(t, networkMetrics.merge(parseMetrics(t, `# TYPE network_endpoints gauge
+network_endpoints{network="azure"} 3
+network_endpoints{network="empty"} 0
+# TYPE network_subnet_capacity_ips gauge
+network_subnet_capacity_ips{network="azure",subnet="10.0.0.0/24"} 251
+# TYPE network_subnet_available_ips gauge
+network_subnet_available_ips{network="azure",subnet="10.0.0.0/24"} 248
+`)))
+
+	resp := get()
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, map[string]cns.NetworkUtilization{
+		"azure": {
+			Endpoints: 3,
+			Subnets:   map[string]cns.SubnetUtilization{"10.0.0.0/24": {CapacityIPs: 251, AvailableIPs: 248}},
+		},
+		"empty": {},
+	}, resp.Networks)
+
+	req := httptest.NewRequest(http.MethodPost, cns.NetworkUtilizationPath, http.NoBody)
+	w := httptest.NewRecorder()
+	svc.networkUtilizationHandler(w, req)
+	var resp2 cns.NetworkUtilizationResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp2))
+	assert.Equal(t, types.UnsupportedVerb, resp2.Response.ReturnCode)
+}
@@ -0,0 +1,165 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ErrUnknownNICType is returned when disabling a NIC type CNS doesn't allocate.
+var ErrUnknownNICType = errors.New("unknown NIC type")
+
+const (
+	nicTypeDisabledReason      = "NICTypeDisabled"
+	nicTypeEnabledReason       = "NICTypeEnabled"
+	nicTypeAddRefusedReason    = "NICTypeDisabledAddRefused"
+	nicTypeDisabledByConfigMsg = "disabled by the CNS config"
+)
+
+// NodeEventRecorder publishes events on the node CNS runs on.
+type NodeEventRecorder interface {
+	Eventf(eventtype, reason, messageFmt string, args ...interface{})
+}
+
+// disabledNICTypes holds the NIC types an operator disabled on the node, with the reason given for each.
+type disabledNICTypes struct {
+	sync.RWMutex
+	reasons map[cns.NICType]string
+}
+
+// SetNodeEventRecorder sets the recorder of the node events, and publishes the NIC types disabled before it was set.
+func (service *HTTPRestService) SetNodeEventRecorder(recorder NodeEventRecorder) {
+	service.disabledNICTypes.Lock()
+	defer service.disabledNICTypes.Unlock()
+	service.nodeEvents = recorder
+	for nicType, reason := range service.disabledNICTypes.reasons {
+		recorder.Eventf(corev1.EventTypeWarning, nicTypeDisabledReason, "ADDs needing a %s NIC are refused: %s", nicType, reason)
+	}
+}
+
+// DisableNICTypesFromConfig disables the NIC types listed in the CNS config.
+func (service *HTTPRestService) DisableNICTypesFromConfig(nicTypes []string) error {
+	for _, nicType := range nicTypes {
+		if err := service.SetNICTypeState(cns.NICType(nicType), true, nicTypeDisabledByConfigMsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetNICTypeState disables or re-enables the ADDs of pods which need a NIC of the given type, publishing a node event
+// when the state changes.
+func (service *HTTPRestService) SetNICTypeState(nicType cns.NICType, disabled bool, reason string) error {
+	switch nicType {
+	case cns.InfraNIC, cns.DelegatedVMNIC, cns.BackendNIC, cns.NodeNetworkInterfaceAccelnetFrontendNIC:
+	default:
+		return errors.Wrapf(ErrUnknownNICType, "%q", nicType)
+	}
+
+	service.disabledNICTypes.Lock()
+	defer service.disabledNICTypes.Unlock()
+
+	_, wasDisabled := service.disabledNICTypes.reasons[nicType]
+	if disabled {
+		if service.disabledNICTypes.reasons == nil {
+			service.disabledNICTypes.reasons = make(map[cns.NICType]string)
+		}
+		service.disabledNICTypes.reasons[nicType] = reason
+	} else {
+		delete(service.disabledNICTypes.reasons, nicType)
+	}
+	if wasDisabled == disabled {
+		return nil
+	}
+
+	logger.Printf("[Azure CNS] NIC type %s disabled: %t, reason: %s", nicType, disabled, reason)
+	if service.nodeEvents == nil {
+		return nil
+	}
+	if disabled {
+		service.nodeEvents.Eventf(corev1.EventTypeWarning, nicTypeDisabledReason, "ADDs needing a %s NIC are refused: %s", nicType, reason)
+	} else {
+		service.nodeEvents.Eventf(corev1.EventTypeNormal, nicTypeEnabledReason, "ADDs needing a %s NIC are allowed again", nicType)
+	}
+	return nil
+}
+
+// checkNICTypesEnabled refuses a request for IPs needing a NIC of a disabled type. The request must already be
+// validated, since the SWIFT v2 validator sets which interfaces it needs.
+func (service *HTTPRestService) checkNICTypesEnabled(podInfo cns.PodInfo, req cns.IPConfigsRequest) (types.ResponseCode, string) {
+	needed := []cns.NICType{cns.InfraNIC}
+	if req.SecondaryInterfacesExist {
+		needed = append(needed, cns.DelegatedVMNIC)
+	}
+	if req.BackendInterfaceExist {
+		needed = append(needed, cns.BackendNIC)
+	}
+
+	service.disabledNICTypes.RLock()
+	defer service.disabledNICTypes.RUnlock()
+	for _, nicType := range needed {
+		reason, disabled := service.disabledNICTypes.reasons[nicType]
+		if !disabled {
+			continue
+		}
+		if service.nodeEvents != nil {
+			service.nodeEvents.Eventf(corev1.EventTypeWarning, nicTypeAddRefusedReason, "Refused the ADD of pod %s/%s needing a %s NIC: %s",
+				podInfo.Namespace(), podInfo.Name(), nicType, reason)
+		}
+		return types.NICTypeDisabled, fmt.Sprintf("NIC type %s is disabled on the node: %s", nicType, reason)
+	}
+	return types.Success, ""
+}
+
+// nicTypesHandler lists the disabled NIC types on a GET and disables or re-enables a NIC type on a POST.
+func (service *HTTPRestService) nicTypesHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "nicTypesHandler"
+	var response cns.GetNICTypeStatesResponse
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req cns.SetNICTypeStateRequest
+		err := common.Decode(w, r, &req)
+		logger.Request(service.Name, &req, err)
+		if err != nil {
+			return
+		}
+		if err := service.SetNICTypeState(req.NICType, req.Disabled, req.Reason); err != nil {
+			response.Response = cns.Response{
+				ReturnCode: types.InvalidParameter,
+				Message:    fmt.Sprintf("[Azure CNS] %s failed with error: %v", opName, err),
+			}
+		}
+	default:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] nicTypes API expects a GET or POST.",
+		}
+	}
+
+	if response.Response.ReturnCode == types.Success {
+		response.DisabledNICTypes = service.getDisabledNICTypes()
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// getDisabledNICTypes returns a copy of the disabled NIC types and their reasons.
+func (service *HTTPRestService) getDisabledNICTypes() map[cns.NICType]string {
+	service.disabledNICTypes.RLock()
+	defer service.disabledNICTypes.RUnlock()
+	disabled := make(map[cns.NICType]string, len(service.disabledNICTypes.reasons))
+	for nicType, reason := range service.disabledNICTypes.reasons {
+		disabled[nicType] = reason
+	}
+	return disabled
+}
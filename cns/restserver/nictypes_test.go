@@ -0,0 +1,132 @@
+package restserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNodeEventRecorder records the reasons of the published events.
+type fakeNodeEventRecorder struct {
+	reasons []string
+}
+
+func (f *fakeNodeEventRecorder) Eventf(_, reason, messageFmt string, args ...interface{}) {
+	f.reasons = append(f.reasons, reason+": "+fmt.Sprintf(messageFmt, args...))
+}
+
+func TestSetNICTypeState(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	// disabled before the recorder is set, published when it is
+	require.NoError(t, svc.DisableNICTypesFromConfig([]string{string(cns.BackendNIC)}))
+	events := &fakeNodeEventRecorder{}
+	svc.SetNodeEventRecorder(events)
+	assert.Equal(t, []string{"NICTypeDisabled: ADDs needing a BackendNIC NIC are refused: disabled by the CNS config"}, events.reasons)
+
+	require.NoError(t, svc.SetNICTypeState(cns.DelegatedVMNIC, true, "vf driver incident"))
+	// disabling again only updates the reason
+	require.NoError(t, svc.SetNICTypeState(cns.DelegatedVMNIC, true, "vf driver incident, see ticket"))
+	require.NoError(t, svc.SetNICTypeState(cns.BackendNIC, false, ""))
+	assert.Equal(t, map[cns.NICType]string{cns.DelegatedVMNIC: "vf driver incident, see ticket"}, svc.getDisabledNICTypes())
+	assert.Len(t, events.reasons, 3)
+
+	require.ErrorIs(t, svc.SetNICTypeState("VirtualNIC", true, ""), ErrUnknownNICType)
+	require.ErrorIs(t, svc.DisableNICTypesFromConfig([]string{"VirtualNIC"}), ErrUnknownNICType)
+}
+
+func TestRequestIPConfigsRefusedForDisabledNICType(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	testState := newPodState(testIP1, ipIDs[0][0], testNCID, types.Available, 0)
+	err := updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{testState.ID: testState}, testNCID)
+	require.NoError(t, err)
+
+	events := &fakeNodeEventRecorder{}
+	svc.SetNodeEventRecorder(events)
+	require.NoError(t, svc.SetNICTypeState(cns.InfraNIC, true, "maintenance"))
+
+	req := cns.IPConfigsRequest{PodInterfaceID: testPod1Info.InterfaceID(), InfraContainerID: testPod1Info.InfraContainerID()}
+	req.OrchestratorContext, _ = testPod1Info.OrchestratorContext()
+
+	resp, err := svc.requestIPConfigHandlerHelper(context.TODO(), req)
+	require.Error(t, err)
+	assert.Equal(t, types.NICTypeDisabled, resp.Response.ReturnCode)
+	assert.Contains(t, resp.Response.Message, "maintenance")
+	assert.Len(t, svc.GetAvailableIPConfigs(), 1)
+	assert.Contains(t, events.reasons[len(events.reasons)-1], "NICTypeDisabledAddRefused")
+
+	require.NoError(t, svc.SetNICTypeState(cns.InfraNIC, false, ""))
+	resp, err = svc.requestIPConfigHandlerHelper(context.TODO(), req)
+	require.NoError(t, err)
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+}
+
+func TestNICTypesHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	tests := []struct {
+		name     string
+		method   string
+		body     interface{}
+		wantCode types.ResponseCode
+		want     map[cns.NICType]string
+	}{
+		{
+			name:     "disable",
+			method:   http.MethodPost,
+			body:     cns.SetNICTypeStateRequest{NICType: cns.DelegatedVMNIC, Disabled: true, Reason: "incident"},
+			wantCode: types.Success,
+			want:     map[cns.NICType]string{cns.DelegatedVMNIC: "incident"},
+		},
+		{
+			name:     "list",
+			method:   http.MethodGet,
+			wantCode: types.Success,
+			want:     map[cns.NICType]string{cns.DelegatedVMNIC: "incident"},
+		},
+		{
+			name:     "unknown nic type",
+			method:   http.MethodPost,
+			body:     cns.SetNICTypeStateRequest{NICType: "VirtualNIC", Disabled: true},
+			wantCode: types.InvalidParameter,
+		},
+		{
+			name:     "enable",
+			method:   http.MethodPost,
+			body:     cns.SetNICTypeStateRequest{NICType: cns.DelegatedVMNIC},
+			wantCode: types.Success,
+			want:     map[cns.NICType]string{},
+		},
+		{
+			name:     "unsupported verb",
+			method:   http.MethodDelete,
+			wantCode: types.UnsupportedVerb,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				require.NoError(t, json.NewEncoder(&body).Encode(tt.body))
+			}
+			req := httptest.NewRequest(tt.method, cns.NICTypesPath, &body)
+			w := httptest.NewRecorder()
+			svc.nicTypesHandler(w, req)
+
+			var resp cns.GetNICTypeStatesResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.wantCode, resp.Response.ReturnCode)
+			assert.Equal(t, tt.want, resp.DisabledNICTypes)
+		})
+	}
+}
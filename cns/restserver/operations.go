@@ -0,0 +1,173 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxFinishedOperations bounds the finished operations kept for polling, the oldest are forgotten first.
+	maxFinishedOperations = 256
+	// finishedOperationTTL is how long a finished operation is kept for polling.
+	finishedOperationTTL = time.Hour
+)
+
+// kinds of operations
+const (
+	operationCreateOrUpdateNC = "CreateOrUpdateNetworkContainer"
+	operationDeleteNC         = "DeleteNetworkContainer"
+	operationMigrateDatapath  = "MigrateDatapath"
+)
+
+// operationTracker holds the operations started through the API, until they have been finished for a while.
+type operationTracker struct {
+	sync.Mutex
+	operations map[string]*cns.Operation
+	finished   []string // ids of the finished operations, oldest first
+	now        func() time.Time
+}
+
+// operation updates the progress of a tracked operation. A nil operation, of a synchronous call, ignores the updates.
+type operation struct {
+	tracker *operationTracker
+	id      string
+}
+
+func (t *operationTracker) timeNow() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// start starts tracking a new operation of the kind.
+func (t *operationTracker) start(kind string) *operation {
+	t.Lock()
+	defer t.Unlock()
+	if t.operations == nil {
+		t.operations = map[string]*cns.Operation{}
+	}
+	now := t.timeNow()
+	t.expire(now)
+	op := &cns.Operation{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		Phase:     cns.OperationRunning,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	t.operations[op.ID] = op
+	logger.Printf("[Azure CNS] Started %s operation %s", kind, op.ID)
+	return &operation{tracker: t, id: op.ID}
+}
+
+// get returns a copy of the operation.
+func (t *operationTracker) get(id string) (cns.Operation, bool) {
+	t.Lock()
+	defer t.Unlock()
+	t.expire(t.timeNow())
+	op, ok := t.operations[id]
+	if !ok {
+		return cns.Operation{}, false
+	}
+	return *op, true
+}
+
+// expire forgets the operations finished for longer than the ttl, and the oldest beyond the max.
+func (t *operationTracker) expire(now time.Time) {
+	n := 0
+	for n < len(t.finished) {
+		op := t.operations[t.finished[n]]
+		if len(t.finished)-n <= maxFinishedOperations && now.Sub(op.UpdatedAt) < finishedOperationTTL {
+			break
+		}
+		delete(t.operations, t.finished[n])
+		n++
+	}
+	t.finished = t.finished[n:]
+}
+
+// progress reports the step the operation is at, and its percentage done.
+func (o *operation) progress(step string, percent int) {
+	if o == nil {
+		return
+	}
+	t := o.tracker
+	t.Lock()
+	defer t.Unlock()
+	op := t.operations[o.id]
+	op.Step = step
+	op.Percent = percent
+	op.UpdatedAt = t.timeNow()
+}
+
+// finish completes the operation with the result the synchronous call would have returned.
+func (o *operation) finish(returnCode types.ResponseCode, message string) {
+	if o == nil {
+		return
+	}
+	t := o.tracker
+	t.Lock()
+	defer t.Unlock()
+	op := t.operations[o.id]
+	op.Step = ""
+	op.UpdatedAt = t.timeNow()
+	if returnCode == types.Success {
+		op.Phase = cns.OperationSucceeded
+		op.Percent = 100
+	} else {
+		op.Phase = cns.OperationFailed
+		op.Error = &cns.Response{ReturnCode: returnCode, Message: message}
+	}
+	t.finished = append(t.finished, o.id)
+	logger.Printf("[Azure CNS] Finished %s operation %s: %s", op.Kind, op.ID, op.Phase)
+}
+
+// isAsync returns whether the request asks for its operation to run in the background.
+func isAsync(r *http.Request) bool {
+	async, _ := strconv.ParseBool(r.URL.Query().Get(cns.AsyncQuery))
+	return async
+}
+
+// operationsHandler returns the operation of the id in the path on a GET.
+func (service *HTTPRestService) operationsHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "operationsHandler"
+	var response cns.OperationResponse
+
+	id := strings.TrimPrefix(r.URL.Path, cns.OperationsPath)
+	switch {
+	case r.Method != http.MethodGet:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] operations API expects a GET.",
+		}
+	case id == "":
+		response.Response = cns.Response{
+			ReturnCode: types.InvalidParameter,
+			Message:    "[Azure CNS] operations API expects an operation id in the path.",
+		}
+	default:
+		op, ok := service.operations.get(id)
+		if !ok {
+			response.Response = cns.Response{
+				ReturnCode: types.NotFound,
+				Message:    fmt.Sprintf("[Azure CNS] %s found no operation %s, it may have expired", opName, id),
+			}
+			break
+		}
+		response.Operation = op
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
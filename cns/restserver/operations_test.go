@@ -0,0 +1,138 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationTracker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := &operationTracker{now: func() time.Time { return now }}
+
+	op := tracker.start(operationCreateOrUpdateNC)
+	now = now.Add(time.Second)
+	op.progress("SavingGoalState", 50)
+	got, ok := tracker.get(op.id)
+	require.True(t, ok)
+	assert.Equal(t, cns.OperationRunning, got.Phase)
+	assert.Equal(t, "SavingGoalState", got.Step)
+	assert.Equal(t, 50, got.Percent)
+	assert.Equal(t, now, got.UpdatedAt)
+
+	failed := tracker.start(operationDeleteNC)
+	failed.finish(types.UnexpectedError, "nc delete failed")
+	got, ok = tracker.get(failed.id)
+	require.True(t, ok)
+	assert.Equal(t, cns.OperationFailed, got.Phase)
+	assert.Equal(t, &cns.Response{ReturnCode: types.UnexpectedError, Message: "nc delete failed"}, got.Error)
+
+	// finished operations expire, running ones don't
+	now = now.Add(finishedOperationTTL / 2)
+	op.finish(types.Success, "")
+	now = now.Add(finishedOperationTTL / 2)
+	_, ok = tracker.get(failed.id)
+	assert.False(t, ok)
+	_, ok = tracker.get(op.id)
+	assert.True(t, ok)
+	running := tracker.start(operationCreateOrUpdateNC)
+	now = now.Add(2 * finishedOperationTTL)
+	_, ok = tracker.get(running.id)
+	assert.True(t, ok)
+
+	// the oldest finished operations are dropped beyond the max
+	first := tracker.start(operationDeleteNC)
+	first.finish(types.Success, "")
+	for i := 0; i < maxFinishedOperations; i++ {
+		tracker.start(operationDeleteNC).finish(types.Success, "")
+	}
+	_, ok = tracker.get(first.id)
+	assert.False(t, ok)
+	assert.Len(t, tracker.finished, maxFinishedOperations)
+
+	// synchronous calls have no operation
+	var sync *operation
+	sync.progress("SavingGoalState", 50)
+	sync.finish(types.Success, "")
+}
+
+func getOperation(t *testing.T, id string) cns.OperationResponse {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, cns.OperationsPath+id, http.NoBody)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var resp cns.OperationResponse
+	require.NoError(t, decodeResponse(w, &resp))
+	return resp
+}
+
+func waitForOperation(t *testing.T, id string) cns.Operation {
+	t.Helper()
+	var resp cns.OperationResponse
+	require.Eventually(t, func() bool {
+		resp = getOperation(t, id)
+		return resp.Operation.Phase != cns.OperationRunning
+	}, 10*time.Second, 10*time.Millisecond)
+	return resp.Operation
+}
+
+func TestAsyncNetworkContainerOperations(t *testing.T) {
+	require.NoError(t, setOrchestratorType(t, cns.ServiceFabric))
+	ncID := cns.SwiftPrefix + "f47ac10b-58cc-0372-8567-0e02b2c3d479"
+	podInfo, _ := json.Marshal(cns.KubernetesPodInfo{PodName: "testpod", PodNamespace: "testpodnamespace"})
+
+	var body bytes.Buffer
+	require.NoError(t, json.NewEncoder(&body).Encode(&cns.CreateNetworkContainerRequest{
+		Version:                    "0",
+		NetworkContainerType:       "JobObject",
+		NetworkContainerid:         ncID,
+		OrchestratorContext:        podInfo,
+		PrimaryInterfaceIdentifier: "11.0.0.7",
+		IPConfiguration: cns.IPConfiguration{
+			IPSubnet:         cns.IPSubnet{IPAddress: "10.1.0.9", PrefixLength: 24},
+			GatewayIPAddress: "11.0.0.1",
+		},
+	}))
+	req, err := http.NewRequest(http.MethodPost, cns.CreateOrUpdateNetworkContainer+"?async=true", &body)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var createResp cns.CreateNetworkContainerResponse
+	require.NoError(t, decodeResponse(w, &createResp))
+	require.Equal(t, types.Success, createResp.Response.ReturnCode)
+	require.NotEmpty(t, createResp.OperationID)
+
+	op := waitForOperation(t, createResp.OperationID)
+	assert.Equal(t, cns.OperationSucceeded, op.Phase, "%+v", op.Error)
+	assert.Equal(t, 100, op.Percent)
+	assert.Equal(t, operationCreateOrUpdateNC, op.Kind)
+
+	body.Reset()
+	require.NoError(t, json.NewEncoder(&body).Encode(&cns.DeleteNetworkContainerRequest{NetworkContainerid: ncID}))
+	req, err = http.NewRequest(http.MethodPost, cns.DeleteNetworkContainer+"?async=true", &body)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var deleteResp cns.DeleteNetworkContainerResponse
+	require.NoError(t, decodeResponse(w, &deleteResp))
+	require.NotEmpty(t, deleteResp.OperationID)
+	op = waitForOperation(t, deleteResp.OperationID)
+	assert.Equal(t, cns.OperationSucceeded, op.Phase)
+
+	// the goal state is gone
+	_, ok := svc.getNetworkContainerDetails(ncID)
+	assert.False(t, ok)
+
+	resp := getOperation(t, "unknown")
+	assert.Equal(t, types.NotFound, resp.Response.ReturnCode, fmt.Sprint(resp.Response))
+}
@@ -0,0 +1,127 @@
+package restserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cniapi "github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/flowlog"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+const (
+	limitQueryKey = "limit"
+	// defaultFlowLimit and maxFlowLimit are the default and largest number of flows sampled for an endpoint
+	defaultFlowLimit = 100
+	maxFlowLimit     = 1000
+)
+
+// EndpointStateGetter returns the state of the endpoints of the cni, the cni client does it.
+type EndpointStateGetter interface {
+	GetEndpointState() (*cniapi.AzureCNIState, error)
+}
+
+// podFlows is where the pod flows API reads which endpoints log their flows, and their flows, from.
+type podFlows struct {
+	endpoints EndpointStateGetter
+	reader    flowlog.Reader
+}
+
+// SetFlowLogs sets where the pod flows API reads the endpoints which log their flows and their flows from.
+func (service *HTTPRestService) SetFlowLogs(endpoints EndpointStateGetter, reader flowlog.Reader) {
+	service.Lock()
+	defer service.Unlock()
+	service.podFlows = podFlows{endpoints: endpoints, reader: reader}
+}
+
+// podFlowsHandler returns a sample of the flows of the endpoints of the pod given as ?pod=<namespace>/<name> which log
+// their flows on a GET, at most ?limit=<n> flows per endpoint. The flows are read from the host when they are asked
+// for, so the API is meant for forensics rather than continuous export.
+func (service *HTTPRestService) podFlowsHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "podFlowsHandler"
+	var response cns.PodFlowsResponse
+
+	service.RLock()
+	flows := service.podFlows
+	service.RUnlock()
+
+	pod := r.URL.Query().Get(podQueryKey)
+	podNamespace, podName, found := strings.Cut(pod, "/")
+	limit := defaultFlowLimit
+	var limitErr error
+	if value := r.URL.Query().Get(limitQueryKey); value != "" {
+		limit, limitErr = strconv.Atoi(value)
+	}
+	switch {
+	case r.Method != http.MethodGet:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] podFlows API expects a GET.",
+		}
+	case flows.endpoints == nil || flows.reader == nil:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedAPI,
+			Message:    "[Azure CNS] podFlows API needs EnablePodFlowLogs.",
+		}
+	case !found || podNamespace == "" || podName == "":
+		response.Response = cns.Response{
+			ReturnCode: types.InvalidRequest,
+			Message:    fmt.Sprintf("[Azure CNS] %s got invalid pod %q, expected <namespace>/<name>", opName, pod),
+		}
+	case limitErr != nil || limit <= 0 || limit > maxFlowLimit:
+		response.Response = cns.Response{
+			ReturnCode: types.InvalidRequest,
+			Message:    fmt.Sprintf("[Azure CNS] %s got invalid limit %q, expected 1 to %d", opName, r.URL.Query().Get(limitQueryKey), maxFlowLimit),
+		}
+	default:
+		state, err := flows.endpoints.GetEndpointState()
+		if err != nil {
+			response.Response = cns.Response{
+				ReturnCode: types.UnexpectedError,
+				Message:    fmt.Sprintf("[Azure CNS] %s failed to get the endpoint state: %v", opName, err),
+			}
+			break
+		}
+
+		response.Endpoints = map[string][]cns.EndpointFlow{}
+		response.TotalFlows = map[string]int{}
+		for endpointID, ep := range state.ContainerInterfaces {
+			if ep.PodNamespace != podNamespace || ep.PodName != podName || !ep.FlowLogs {
+				continue
+			}
+			ips := make([]net.IP, 0, len(ep.IPAddresses))
+			for _, ipAddr := range ep.IPAddresses {
+				ips = append(ips, ipAddr.IP)
+			}
+			epFlows, err := flows.reader.Flows(ips)
+			if err != nil {
+				response.Response = cns.Response{
+					ReturnCode: types.UnexpectedError,
+					Message:    fmt.Sprintf("[Azure CNS] %s failed to read the flows of endpoint %s: %v", opName, endpointID, err),
+				}
+				break
+			}
+			response.Endpoints[endpointID] = flowlog.Sample(epFlows, limit)
+			response.TotalFlows[endpointID] = len(epFlows)
+		}
+		if response.Response.ReturnCode != types.Success {
+			response.Endpoints, response.TotalFlows = nil, nil
+			break
+		}
+		if len(response.Endpoints) == 0 {
+			response.Response = cns.Response{
+				ReturnCode: types.NotFound,
+				Message:    fmt.Sprintf("[Azure CNS] %s found no endpoint logging its flows for pod %s", opName, pod),
+			}
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
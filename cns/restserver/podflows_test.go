@@ -0,0 +1,101 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cniapi "github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEndpointStateGetter struct {
+	state *cniapi.AzureCNIState
+	err   error
+}
+
+func (f *fakeEndpointStateGetter) GetEndpointState() (*cniapi.AzureCNIState, error) {
+	return f.state, f.err
+}
+
+// fakeFlowReader returns the flows of each ip it is given.
+type fakeFlowReader struct {
+	flows map[string][]cns.EndpointFlow
+	err   error
+}
+
+func (f *fakeFlowReader) Flows(ips []net.IP) ([]cns.EndpointFlow, error) {
+	var flows []cns.EndpointFlow
+	for _, ip := range ips {
+		flows = append(flows, f.flows[ip.String()]...)
+	}
+	return flows, f.err
+}
+
+func TestPodFlowsHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	do := func(method, query string) cns.PodFlowsResponse {
+		w := httptest.NewRecorder()
+		svc.podFlowsHandler(w, httptest.NewRequest(method, cns.PodFlowsPath+"?"+query, http.NoBody))
+		var resp cns.PodFlowsResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := do(http.MethodGet, "pod=ns/pod")
+	assert.Equal(t, types.UnsupportedAPI, resp.Response.ReturnCode)
+
+	podIP := net.IPNet{IP: net.ParseIP("10.240.0.4"), Mask: net.CIDRMask(24, 32)}
+	getter := &fakeEndpointStateGetter{state: &cniapi.AzureCNIState{
+		ContainerInterfaces: map[string]cniapi.PodNetworkInterfaceInfo{
+			"c1-eth0": {PodName: "pod", PodNamespace: "ns", IPAddresses: []net.IPNet{podIP}, FlowLogs: true},
+			"c2-eth0": {PodName: "quiet", PodNamespace: "ns", IPAddresses: []net.IPNet{podIP}},
+		},
+	}}
+	var flows []cns.EndpointFlow
+	for port := uint16(1); port <= 4; port++ {
+		flows = append(flows, cns.EndpointFlow{Protocol: "tcp", Direction: "egress", SrcIP: "10.240.0.4", DstIP: "20.1.1.1", SrcPort: port, DstPort: 443})
+	}
+	reader := &fakeFlowReader{flows: map[string][]cns.EndpointFlow{"10.240.0.4": flows}}
+	svc.SetFlowLogs(getter, reader)
+
+	resp = do(http.MethodGet, "pod=ns/pod")
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, map[string][]cns.EndpointFlow{"c1-eth0": flows}, resp.Endpoints)
+	assert.Equal(t, map[string]int{"c1-eth0": 4}, resp.TotalFlows)
+
+	// the flows are sampled down to the limit
+	resp = do(http.MethodGet, "pod=ns/pod&limit=2")
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, []cns.EndpointFlow{flows[0], flows[2]}, resp.Endpoints["c1-eth0"])
+	assert.Equal(t, map[string]int{"c1-eth0": 4}, resp.TotalFlows)
+
+	// the endpoints which don't log their flows are not read
+	resp = do(http.MethodGet, "pod=ns/quiet")
+	assert.Equal(t, types.NotFound, resp.Response.ReturnCode)
+
+	resp = do(http.MethodGet, "pod=ns/pod&limit=0")
+	assert.Equal(t, types.InvalidRequest, resp.Response.ReturnCode)
+
+	resp = do(http.MethodGet, "pod=pod")
+	assert.Equal(t, types.InvalidRequest, resp.Response.ReturnCode)
+
+	reader.err = errors.New("conntrack failed")
+	resp = do(http.MethodGet, "pod=ns/pod")
+	assert.Equal(t, types.UnexpectedError, resp.Response.ReturnCode)
+	assert.Empty(t, resp.Endpoints)
+
+	getter.err = errors.New("cni failed")
+	resp = do(http.MethodGet, "pod=ns/pod")
+	assert.Equal(t, types.UnexpectedError, resp.Response.ReturnCode)
+
+	resp = do(http.MethodPost, "pod=ns/pod")
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
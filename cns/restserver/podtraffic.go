@@ -0,0 +1,82 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	cniapi "github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+// EndpointStatsGetter returns the state of the endpoints of the cni with their traffic counters, the cni client does it.
+type EndpointStatsGetter interface {
+	GetEndpointStats() (*cniapi.AzureCNIState, error)
+}
+
+// SetEndpointStatsGetter sets where the traffic counters served by the pod traffic API are read from.
+func (service *HTTPRestService) SetEndpointStatsGetter(getter EndpointStatsGetter) {
+	service.Lock()
+	defer service.Unlock()
+	service.endpointStats = getter
+}
+
+// podTrafficHandler returns the traffic counters of the endpoints of the pod given as ?pod=<namespace>/<name> on a GET.
+// The counters are read by the cni when they are asked for, so the API is meant for occasional queries.
+func (service *HTTPRestService) podTrafficHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "podTrafficHandler"
+	var response cns.PodTrafficResponse
+
+	service.RLock()
+	getter := service.endpointStats
+	service.RUnlock()
+
+	pod := r.URL.Query().Get(podQueryKey)
+	podNamespace, podName, found := strings.Cut(pod, "/")
+	switch {
+	case r.Method != http.MethodGet:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] podTraffic API expects a GET.",
+		}
+	case getter == nil:
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedAPI,
+			Message:    "[Azure CNS] podTraffic API needs EnablePodTrafficStats.",
+		}
+	case !found || podNamespace == "" || podName == "":
+		response.Response = cns.Response{
+			ReturnCode: types.InvalidRequest,
+			Message:    fmt.Sprintf("[Azure CNS] %s got invalid pod %q, expected <namespace>/<name>", opName, pod),
+		}
+	default:
+		state, err := getter.GetEndpointStats()
+		if err != nil {
+			response.Response = cns.Response{
+				ReturnCode: types.UnexpectedError,
+				Message:    fmt.Sprintf("[Azure CNS] %s failed to get the endpoint stats: %v", opName, err),
+			}
+			break
+		}
+
+		response.Endpoints = map[string]cns.EndpointTraffic{}
+		for endpointID, ep := range state.ContainerInterfaces {
+			if ep.PodNamespace != podNamespace || ep.PodName != podName || ep.Traffic == nil {
+				continue
+			}
+			response.Endpoints[endpointID] = cns.EndpointTraffic(*ep.Traffic)
+		}
+		if len(response.Endpoints) == 0 {
+			response.Response = cns.Response{
+				ReturnCode: types.NotFound,
+				Message:    fmt.Sprintf("[Azure CNS] %s found no endpoint with traffic counters for pod %s", opName, pod),
+			}
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
@@ -0,0 +1,68 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cniapi "github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEndpointStatsGetter struct {
+	state *cniapi.AzureCNIState
+	err   error
+}
+
+func (f *fakeEndpointStatsGetter) GetEndpointStats() (*cniapi.AzureCNIState, error) {
+	return f.state, f.err
+}
+
+func TestPodTrafficHandler(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+
+	do := func(method, pod string) cns.PodTrafficResponse {
+		w := httptest.NewRecorder()
+		svc.podTrafficHandler(w, httptest.NewRequest(method, cns.PodTrafficPath+"?pod="+pod, http.NoBody))
+		var resp cns.PodTrafficResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := do(http.MethodGet, "ns/pod")
+	assert.Equal(t, types.UnsupportedAPI, resp.Response.ReturnCode)
+
+	traffic := &cniapi.EndpointTraffic{RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2, RxDropped: 3, TxDropped: 4}
+	getter := &fakeEndpointStatsGetter{state: &cniapi.AzureCNIState{
+		ContainerInterfaces: map[string]cniapi.PodNetworkInterfaceInfo{
+			"c1-eth0": {PodName: "pod", PodNamespace: "ns", Traffic: traffic},
+			"c1-eth1": {PodName: "pod", PodNamespace: "ns"},
+			"c2-eth0": {PodName: "other", PodNamespace: "ns", Traffic: traffic},
+		},
+	}}
+	svc.SetEndpointStatsGetter(getter)
+
+	resp = do(http.MethodGet, "ns/pod")
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, map[string]cns.EndpointTraffic{
+		"c1-eth0": {RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2, RxDropped: 3, TxDropped: 4},
+	}, resp.Endpoints)
+
+	resp = do(http.MethodGet, "ns/missing")
+	assert.Equal(t, types.NotFound, resp.Response.ReturnCode)
+
+	resp = do(http.MethodGet, "pod")
+	assert.Equal(t, types.InvalidRequest, resp.Response.ReturnCode)
+
+	getter.err = errors.New("cni failed")
+	resp = do(http.MethodGet, "ns/pod")
+	assert.Equal(t, types.UnexpectedError, resp.Response.ReturnCode)
+
+	resp = do(http.MethodPost, "ns/pod")
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
@@ -0,0 +1,175 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+)
+
+// ErrDriftNotFixable is returned when fixing a drift of a class the node can't fix.
+var ErrDriftNotFixable = errors.New("drift class can't be fixed on this node")
+
+// orphanGracePeriod is how long a host interface stays unowned before it is reported as orphaned. The cni creates the
+// host veth before it records the endpoint in cns, so the veth of an ADD in flight is unowned for a while.
+const orphanGracePeriod = 2 * time.Minute
+
+// orphanTracker remembers when each unowned host interface was first seen.
+type orphanTracker struct {
+	sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+// settled returns the orphans which were already unowned orphanGracePeriod before now, and forgets the interfaces
+// which are owned or gone since.
+func (o *orphanTracker) settled(orphans []Drift, now time.Time) []Drift {
+	o.Lock()
+	defer o.Unlock()
+
+	firstSeen := make(map[string]time.Time, len(orphans))
+	var settled []Drift
+	for i := range orphans {
+		seen, ok := o.firstSeen[orphans[i].Interface]
+		if !ok {
+			seen = now
+		}
+		firstSeen[orphans[i].Interface] = seen
+		if now.Sub(seen) >= orphanGracePeriod {
+			settled = append(settled, orphans[i])
+		}
+	}
+	o.firstSeen = firstSeen
+	return settled
+}
+
+// reconcile cross-checks the endpoint state with the node at once, instead of on the next CNI CHECK of each pod, and
+// fixes the drift of the classes posted.
+func (service *HTTPRestService) reconcile(w http.ResponseWriter, r *http.Request) {
+	opName := "reconcile"
+	var response ReconcileResponse
+
+	switch {
+	case r.Method != http.MethodPost:
+		response.Response = Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure-CNS] reconcile API expects a POST.",
+		}
+	case service.Options[common.OptManageEndpointState] != true:
+		response.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[Azure-CNS] reconcile failed with error: %s", ErrOptManageEndpointState),
+		}
+	default:
+		// the body is optional, nothing is fixed without one
+		var req ReconcileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			response.Response = Response{
+				ReturnCode: types.InvalidParameter,
+				Message:    fmt.Sprintf("[Azure-CNS] reconcile failed to decode the request: %v", err),
+			}
+			break
+		}
+		fixable := service.datapathVerifier.FixableDriftClasses()
+		fix := make(map[DriftClass]bool, len(req.Fix))
+		for _, class := range req.Fix {
+			if !slices.Contains(fixable, class) {
+				response.Response = Response{
+					ReturnCode: types.InvalidParameter,
+					Message:    fmt.Sprintf("[Azure-CNS] reconcile failed with error: %s: %s, fixable are %v", ErrDriftNotFixable, class, fixable),
+				}
+				break
+			}
+			fix[class] = true
+		}
+		if response.Response.ReturnCode != types.Success {
+			break
+		}
+
+		response.Drifts = service.reconcileDrift(r.Context(), fix)
+		for i := range response.Drifts {
+			if response.Drifts[i].Fixed {
+				response.Fixed++
+			}
+		}
+		logger.Printf("[Azure-CNS] reconcile found %d drifts, fixed %d", len(response.Drifts), response.Fixed)
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// reconcileDrift returns the drift of the endpoints from the node and the host interfaces no endpoint owns, after
+// fixing the drift of the classes in fix.
+func (service *HTTPRestService) reconcileDrift(ctx context.Context, fix map[DriftClass]bool) []Drift {
+	_, endpoints, endpointDrifts := service.endpointsDrift(ctx)
+	drifts := []Drift{}
+	for i := range endpointDrifts {
+		drifts = append(drifts, endpointDrifts[i]...)
+	}
+	orphans, err := service.datapathVerifier.OrphanedInterfaces(ownedInterfaces(endpoints))
+	if err != nil {
+		logger.Errorf("[Azure-CNS] reconcile failed to list the orphaned interfaces: %v", err)
+	}
+	drifts = append(drifts, service.orphans.settled(orphans, time.Now())...)
+
+	for i := range drifts {
+		if !fix[drifts[i].Class] {
+			continue
+		}
+		// an endpoint may have been added since the interfaces were listed
+		if drifts[i].Class == DriftInterfaceOrphaned && service.ownsInterface(drifts[i].Interface) {
+			drifts[i].FixError = "interface is owned by an endpoint added since"
+			continue
+		}
+		if err := service.datapathVerifier.FixDrift(&drifts[i]); err != nil {
+			drifts[i].FixError = err.Error()
+			logger.Errorf("[Azure-CNS] reconcile failed to fix %s drift of %s: %v", drifts[i].Class, drifts[i].Interface, err)
+			continue
+		}
+		drifts[i].Fixed = true
+		logger.Printf("[Azure-CNS] reconcile fixed %s drift of %s: %s", drifts[i].Class, drifts[i].Interface, drifts[i].Message)
+	}
+	return drifts
+}
+
+// ownedInterfaces returns the host veths and hns endpoints of the endpoints.
+func ownedInterfaces(endpoints map[string]EndpointInfo) map[string]bool {
+	owned := map[string]bool{}
+	for _, endpointInfo := range endpoints {
+		for _, ipInfo := range endpointInfo.IfnameToIPMap {
+			if ipInfo == nil {
+				continue
+			}
+			if ipInfo.HostVethName != "" {
+				owned[ipInfo.HostVethName] = true
+			}
+			if ipInfo.HnsEndpointID != "" {
+				owned[ipInfo.HnsEndpointID] = true
+			}
+		}
+	}
+	return owned
+}
+
+// ownsInterface returns whether an endpoint in the endpoint state owns the host interface.
+func (service *HTTPRestService) ownsInterface(name string) bool {
+	service.RLock()
+	defer service.RUnlock()
+	for _, endpointInfo := range service.EndpointState {
+		for _, ipInfo := range endpointInfo.IfnameToIPMap {
+			if ipInfo != nil && (ipInfo.HostVethName == name || ipInfo.HnsEndpointID == name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	var fixed []string
+	svc.datapathVerifier = fakeDatapathVerifier{
+		missing: map[string]bool{"azv2": true},
+		down:    map[string]bool{"azv3": true},
+		orphans: []string{"azv1", "azv9"},
+		fixed:   &fixed,
+	}
+	svc.EndpointState = map[string]*EndpointInfo{
+		"ep1": {IfnameToIPMap: map[string]*IPInfo{"eth0": {HostVethName: "azv1", NICType: cns.NodeNetworkInterfaceFrontendNIC}}},
+		"ep2": {IfnameToIPMap: map[string]*IPInfo{"eth0": {HostVethName: "azv2", NICType: cns.NodeNetworkInterfaceFrontendNIC}}},
+		"ep3": {IfnameToIPMap: map[string]*IPInfo{"eth0": {HostVethName: "azv3", NICType: cns.NodeNetworkInterfaceFrontendNIC}}},
+	}
+	svc.orphans.firstSeen = map[string]time.Time{"azv9": time.Now().Add(-orphanGracePeriod)}
+
+	reconcile := func(body string) ReconcileResponse {
+		w := httptest.NewRecorder()
+		svc.reconcile(w, httptest.NewRequest(http.MethodPost, cns.ReconcilePath, strings.NewReader(body)))
+		var resp ReconcileResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	// without a body the drift is only reported
+	resp := reconcile("")
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, []Drift{
+		{Class: DriftInterfaceMissing, EndpointID: "ep2", IfName: "eth0", Interface: "azv2", Message: "host veth azv2 not found"},
+		{Class: DriftInterfaceDown, EndpointID: "ep3", IfName: "eth0", Interface: "azv3", Message: "host veth azv3 is down"},
+		{Class: DriftInterfaceOrphaned, Interface: "azv9", Message: "host veth azv9 is not owned by any endpoint"},
+	}, resp.Drifts)
+	assert.Zero(t, resp.Fixed)
+	assert.Empty(t, fixed)
+
+	// only the selected classes are fixed
+	resp = reconcile(`{"fix": ["InterfaceDown"]}`)
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, 1, resp.Fixed)
+	assert.True(t, resp.Drifts[1].Fixed)
+	assert.Equal(t, []string{"InterfaceDown azv3"}, fixed)
+
+	fixed = nil
+	resp = reconcile(`{"fix": ["InterfaceOrphaned"]}`)
+	assert.Equal(t, 1, resp.Fixed)
+	assert.Equal(t, []string{"InterfaceOrphaned azv9"}, fixed)
+
+	// the classes which can't be fixed are refused
+	resp = reconcile(`{"fix": ["IPNotAssigned"]}`)
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+	assert.Empty(t, resp.Drifts)
+	resp = reconcile(`{"fix":`)
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+
+	w := httptest.NewRecorder()
+	svc.reconcile(w, httptest.NewRequest(http.MethodGet, cns.ReconcilePath, http.NoBody))
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
+
+func TestOrphanTrackerSettled(t *testing.T) {
+	var tracker orphanTracker
+	now := time.Now()
+	orphan := func(name string) Drift { return Drift{Class: DriftInterfaceOrphaned, Interface: name} }
+
+	// the veth of an add in flight is not reported until it has been unowned for the grace period
+	assert.Empty(t, tracker.settled([]Drift{orphan("azv1"), orphan("azv2")}, now))
+	assert.Empty(t, tracker.settled([]Drift{orphan("azv1"), orphan("azv2")}, now.Add(orphanGracePeriod/2)))
+
+	// azv2 was recorded by its endpoint in between, so it starts over when it is unowned again
+	assert.Empty(t, tracker.settled([]Drift{orphan("azv1")}, now.Add(orphanGracePeriod/2)))
+	assert.Equal(t, []Drift{orphan("azv1")}, tracker.settled([]Drift{orphan("azv1"), orphan("azv2")}, now.Add(orphanGracePeriod)))
+	assert.Equal(t, []Drift{orphan("azv1"), orphan("azv2")}, tracker.settled([]Drift{orphan("azv1"), orphan("azv2")}, now.Add(2*orphanGracePeriod)))
+}
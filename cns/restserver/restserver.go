@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 	acn "github.com/Azure/azure-container-networking/common"
 	nma "github.com/Azure/azure-container-networking/nmagent"
 	"github.com/Azure/azure-container-networking/store"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -52,6 +54,7 @@ type wireserverProxy interface {
 
 type imdsClient interface {
 	GetVMUniqueID(ctx context.Context) (string, error)
+	GetAvailabilityZone(ctx context.Context) (string, error)
 }
 
 type iptablesClient interface {
@@ -60,6 +63,8 @@ type iptablesClient interface {
 	Append(table string, chain string, rulespec ...string) error
 	Exists(table string, chain string, rulespec ...string) (bool, error)
 	Insert(table string, chain string, pos int, rulespec ...string) error
+	Delete(table string, chain string, rulespec ...string) error
+	List(table string, chain string) ([]string, error)
 }
 
 type iptablesGetter interface {
@@ -82,6 +87,7 @@ type HTTPRestService struct {
 	store                    store.KeyValueStore
 	state                    *httpRestServiceState
 	podsPendingIPAssignment  *bounded.TimedSet
+	podsWaitingForIPPool     *bounded.TimedSet
 	sync.RWMutex
 	dncPartitionKey            string
 	EndpointState              map[string]*EndpointInfo // key : container id
@@ -92,6 +98,26 @@ type HTTPRestService struct {
 	PnpIDByMacAddress          map[string]string
 	imdsClient                 imdsClient
 	nodesubnetIPFetcher        *nodesubnet.IPFetcher
+	datapathVerifier           endpointDatapathVerifier
+	orphans                    orphanTracker
+	disabledNICTypes           disabledNICTypes
+	nodeEvents                 NodeEventRecorder
+	prefixRouter               endpointPrefixRouter
+	hostRoutes                 hostRouteLister
+	delegatedPrefixes          map[string]delegatedPrefix // key : container id
+	endpointEvents             *endpointEventLog
+	ipamPoolScaler             ipamPoolScaler
+	ipReservations             map[string]string         // key : reserved ip address, value : owner
+	namespaceIPBlocks          map[string][]netip.Prefix // key : namespace, value : the blocks its pods are assigned IPs from
+	ipReleaseGrace             ipReleaseGrace
+	operations                 operationTracker
+	ncProgramming              ncProgrammingTracker
+	datapathMigration          datapathMigration
+	endpointStats              EndpointStatsGetter
+	podFlows                   podFlows
+	hostNCApipaSubnet          netip.Prefix
+	availabilityZone           string // the zone of the node, the IPs of the NCs in it are assigned first
+	duplicateAddressDetection  duplicateAddressDetection
 }
 
 type CNIConflistGenerator interface {
@@ -123,6 +149,49 @@ type IPInfo struct {
 	HostVethName  string      `json:",omitempty"`
 	MacAddress    string      `json:",omitempty"`
 	NICType       cns.NICType
+	// NetNsPath is the network namespace of the pod, to move delegated nics back to the host on linux
+	NetNsPath string `json:",omitempty"`
+	// OutboundNATExceptions are the destination cidrs the endpoint's traffic is not snatted to on linux
+	OutboundNATExceptions []string `json:",omitempty"`
+	// EnableEBPFDatapath is set for linux endpoints plumbed with the ebpf datapath
+	EnableEBPFDatapath bool `json:",omitempty"`
+	// Routes are the routes CNI programmed for the interface
+	Routes []cns.Route `json:",omitempty"`
+	// HostProtectedPorts are the host ports the endpoint's traffic is blocked to on windows
+	HostProtectedPorts []string `json:",omitempty"`
+	// DelegatedPrefix is the ipv4 prefix routed on-link to the interface in addition to its ips
+	DelegatedPrefix string `json:",omitempty"`
+	// RouteHealth is the health of the default route via the interface in multi-NIC pods on linux
+	RouteHealth *RouteHealth `json:",omitempty"`
+	// RouteTable is the policy routing table of the delegated nic in the pod on linux
+	RouteTable int `json:",omitempty"`
+	// Health is the health of the datapath of the interface in the pod on linux, as checked by the endpoint health monitor
+	Health *EndpointHealth `json:",omitempty"`
+}
+
+// RouteHealth is the health of the gateway of a default route of a pod, as probed by the route health monitor, which
+// moves the routes via unhealthy gateways behind the healthy ones.
+type RouteHealth struct {
+	Gateway string
+	Healthy bool
+	// Metric is the current metric of the route, BaseMetric the one it had before the monitor changed it.
+	Metric         int
+	BaseMetric     int
+	LastError      string `json:",omitempty"`
+	LastTransition time.Time
+}
+
+// EndpointHealth is the health of the datapath of an interface of a pod, as checked by the endpoint health monitor,
+// which repairs what the checks can and recommends the eviction of the pods which stay unhealthy.
+type EndpointHealth struct {
+	Healthy bool
+	// Failures are the errors of the failing checks, by check name.
+	Failures map[string]string `json:",omitempty"`
+	// Repairs is the number of repairs attempted since the interface was last healthy.
+	Repairs int `json:",omitempty"`
+	// EvictionRecommended is set once the interface stayed unhealthy through the repairs, the pod is to be recreated.
+	EvictionRecommended bool `json:",omitempty"`
+	LastTransition      time.Time
 }
 
 type GetHTTPServiceDataResponse struct {
@@ -148,6 +217,117 @@ type GetEndpointResponse struct {
 	EndpointInfo EndpointInfo `json:"endpointInfo"`
 }
 
+// GetPodEndpointsResponse holds the endpoints of a pod, by endpoint id.
+type GetPodEndpointsResponse struct {
+	Response  Response                 `json:"response"`
+	Endpoints map[string]*EndpointInfo `json:"endpoints"`
+}
+
+// EndpointEventType is the change of an endpoint an EndpointEvent reports.
+type EndpointEventType string
+
+const (
+	EndpointCreated EndpointEventType = "Created"
+	EndpointUpdated EndpointEventType = "Updated"
+	EndpointDeleted EndpointEventType = "Deleted"
+)
+
+// EndpointEvent is a change of the endpoint state. EndpointInfo is the state after the change, and is nil once the
+// endpoint is deleted.
+type EndpointEvent struct {
+	Sequence     uint64            `json:"sequence"`
+	Type         EndpointEventType `json:"type"`
+	EndpointID   string            `json:"endpointID"`
+	EndpointInfo *EndpointInfo     `json:"endpointInfo,omitempty"`
+}
+
+// GetEndpointEventsResponse holds the endpoint events after the sequence a subscriber asked for. Missed is set when
+// some of the events were dropped, the subscriber then relists the endpoints before following the events from
+// LastSequence.
+type GetEndpointEventsResponse struct {
+	Response     Response        `json:"response"`
+	Events       []EndpointEvent `json:"events"`
+	LastSequence uint64          `json:"lastSequence"`
+	Missed       bool            `json:"missed,omitempty"`
+}
+
+// EndpointVerification is the result of verifying a single endpoint.
+type EndpointVerification struct {
+	EndpointID   string   `json:"endpointID"`
+	PodName      string   `json:"podName"`
+	PodNamespace string   `json:"podNamespace"`
+	Passed       bool     `json:"passed"`
+	Failures     []string `json:"failures,omitempty"`
+}
+
+// VerifyAllEndpointsResponse describes response from the VerifyAllEndpoints API.
+type VerifyAllEndpointsResponse struct {
+	Response  Response               `json:"response"`
+	Passed    int                    `json:"passed"`
+	Failed    int                    `json:"failed"`
+	Endpoints []EndpointVerification `json:"endpoints"`
+}
+
+// DriftClass is a kind of difference between the endpoint state and the node.
+type DriftClass string
+
+const (
+	// DriftIPNotAssigned is an ip of an endpoint which is not assigned to its pod in cns.
+	DriftIPNotAssigned DriftClass = "IPNotAssigned"
+	// DriftInterfaceMissing is the host interface of an endpoint, a host veth or hns endpoint, which is gone.
+	DriftInterfaceMissing DriftClass = "InterfaceMissing"
+	// DriftInterfaceMismatch is a host interface of an endpoint which is not configured as in the endpoint state.
+	DriftInterfaceMismatch DriftClass = "InterfaceMismatch"
+	// DriftInterfaceDown is a host veth of an endpoint which is down, fixed by setting it up.
+	DriftInterfaceDown DriftClass = "InterfaceDown"
+	// DriftRouteMissing is an ip of an endpoint which is not routed to its host veth, fixed by adding the route.
+	DriftRouteMissing DriftClass = "RouteMissing"
+	// DriftInterfaceOrphaned is a host veth which no endpoint has owned for orphanGracePeriod, fixed by deleting it.
+	DriftInterfaceOrphaned DriftClass = "InterfaceOrphaned"
+)
+
+// Drift is a single difference between the endpoint state and the node.
+type Drift struct {
+	Class      DriftClass `json:"class"`
+	EndpointID string     `json:"endpointID,omitempty"`
+	// IfName is the interface of the endpoint in the endpoint state.
+	IfName string `json:"ifName,omitempty"`
+	// Interface is the host veth or hns endpoint the drift is on.
+	Interface string `json:"interface,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Message   string `json:"message"`
+	Fixed     bool   `json:"fixed,omitempty"`
+	FixError  string `json:"fixError,omitempty"`
+}
+
+// EndpointHealthStatus is the health of the interfaces of an endpoint.
+type EndpointHealthStatus struct {
+	EndpointID   string                     `json:"endpointID"`
+	PodName      string                     `json:"podName"`
+	PodNamespace string                     `json:"podNamespace"`
+	Interfaces   map[string]*EndpointHealth `json:"interfaces"`
+}
+
+// EndpointHealthResponse describes response from the EndpointHealth API.
+type EndpointHealthResponse struct {
+	Response            Response               `json:"response"`
+	Unhealthy           int                    `json:"unhealthy"`
+	EvictionRecommended int                    `json:"evictionRecommended"`
+	Endpoints           []EndpointHealthStatus `json:"endpoints"`
+}
+
+// ReconcileRequest selects the drift classes the Reconcile API fixes, none by default.
+type ReconcileRequest struct {
+	Fix []DriftClass `json:"fix,omitempty"`
+}
+
+// ReconcileResponse describes response from the Reconcile API.
+type ReconcileResponse struct {
+	Response Response `json:"response"`
+	Drifts   []Drift  `json:"drifts"`
+	Fixed    int      `json:"fixed"`
+}
+
 // containerstatus is used to save status of an existing container
 type containerstatus struct {
 	ID                            string
@@ -171,6 +351,7 @@ type httpRestServiceState struct {
 	joinedNetworks                   map[string]struct{}
 	primaryInterface                 *wireserver.InterfaceInfo
 	PnpIDByMacAddress                map[string]string
+	HostNCApipaIPs                   map[string]string // NetworkContainerID is key, value is the ip of its HostNCApipaEndpoint.
 }
 
 type networkInfo struct {
@@ -236,11 +417,18 @@ func NewHTTPRestService(config *common.ServiceConfig, wscli interfaceGetter, wsp
 		routingTable:             routingTable,
 		state:                    serviceState,
 		podsPendingIPAssignment:  bounded.NewTimedSet(250), // nolint:gomnd // maxpods
+		podsWaitingForIPPool:     bounded.NewTimedSet(250), // nolint:gomnd // maxpods
 		EndpointStateStore:       endpointStateStore,
 		EndpointState:            make(map[string]*EndpointInfo),
 		homeAzMonitor:            homeAzMonitor,
 		cniConflistGenerator:     gen,
 		imdsClient:               imdsClient,
+		datapathVerifier:         newEndpointDatapathVerifier(),
+		prefixRouter:             newEndpointPrefixRouter(),
+		hostRoutes:               newHostRouteLister(),
+		delegatedPrefixes:        make(map[string]delegatedPrefix),
+		ipReservations:           make(map[string]string),
+		endpointEvents:           newEndpointEventLog(endpointEventLogSize),
 	}, nil
 }
 
@@ -270,28 +458,47 @@ func (service *HTTPRestService) Init(config *common.ServiceConfig) error {
 	listener.AddHandler(cns.DeleteNetworkContainer, service.deleteNetworkContainer)
 	listener.AddHandler(cns.GetInterfaceForContainer, service.getInterfaceForContainer)
 	listener.AddHandler(cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.GetNetworkContainerByOrchestratorContext, service.GetNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.GetAllNetworkContainers, service.GetAllNetworkContainers)
+	listener.AddHandler(cns.GetNetworkContainerByOrchestratorContext, tracing.Handler("cns.GetNetworkContainer", service.GetNetworkContainerByOrchestratorContext))
+	listener.AddHandler(cns.GetAllNetworkContainers, tracing.Handler("cns.GetAllNetworkContainers", service.GetAllNetworkContainers))
 	listener.AddHandler(cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
 	listener.AddHandler(cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
 	listener.AddHandler(cns.CreateHnsNetworkPath, service.createHnsNetwork)
 	listener.AddHandler(cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
 	listener.AddHandler(cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
-	listener.AddHandler(cns.CreateHostNCApipaEndpointPath, service.CreateHostNCApipaEndpoint)
-	listener.AddHandler(cns.DeleteHostNCApipaEndpointPath, service.DeleteHostNCApipaEndpoint)
+	listener.AddHandler(cns.CreateHostNCApipaEndpointPath, tracing.Handler("cns.CreateHostNCApipaEndpoint", service.CreateHostNCApipaEndpoint))
+	listener.AddHandler(cns.DeleteHostNCApipaEndpointPath, tracing.Handler("cns.DeleteHostNCApipaEndpoint", service.DeleteHostNCApipaEndpoint))
 	listener.AddHandler(cns.PublishNetworkContainer, service.publishNetworkContainer)
 	listener.AddHandler(cns.UnpublishNetworkContainer, service.unpublishNetworkContainer)
-	listener.AddHandler(cns.RequestIPConfig, NewHandlerFuncWithHistogram(service.RequestIPConfigHandler, HTTPRequestLatency))
-	listener.AddHandler(cns.RequestIPConfigs, NewHandlerFuncWithHistogram(service.RequestIPConfigsHandler, HTTPRequestLatency))
-	listener.AddHandler(cns.ReleaseIPConfig, NewHandlerFuncWithHistogram(service.ReleaseIPConfigHandler, HTTPRequestLatency))
-	listener.AddHandler(cns.ReleaseIPConfigs, NewHandlerFuncWithHistogram(service.ReleaseIPConfigsHandler, HTTPRequestLatency))
+	listener.AddHandler(cns.RequestIPConfig, tracing.Handler("cns.RequestIPConfig", NewHandlerFuncWithHistogram(service.RequestIPConfigHandler, HTTPRequestLatency)))
+	listener.AddHandler(cns.RequestIPConfigs, tracing.Handler("cns.RequestIPConfigs", NewHandlerFuncWithHistogram(service.RequestIPConfigsHandler, HTTPRequestLatency)))
+	listener.AddHandler(cns.ReleaseIPConfig, tracing.Handler("cns.ReleaseIPConfig", NewHandlerFuncWithHistogram(service.ReleaseIPConfigHandler, HTTPRequestLatency)))
+	listener.AddHandler(cns.ReleaseIPConfigs, tracing.Handler("cns.ReleaseIPConfigs", NewHandlerFuncWithHistogram(service.ReleaseIPConfigsHandler, HTTPRequestLatency)))
 	listener.AddHandler(cns.NmAgentSupportedApisPath, service.nmAgentSupportedApisHandler)
 	listener.AddHandler(cns.PathDebugIPAddresses, service.HandleDebugIPAddresses)
 	listener.AddHandler(cns.PathDebugPodContext, service.HandleDebugPodContext)
 	listener.AddHandler(cns.PathDebugRestData, service.HandleDebugRestData)
+	listener.AddHandler(cns.PathDebugIPAMState, service.HandleDebugIPAMState)
 	listener.AddHandler(cns.NetworkContainersURLPath, service.getOrRefreshNetworkContainers)
 	listener.AddHandler(cns.GetHomeAz, service.getHomeAz)
-	listener.AddHandler(cns.EndpointPath, service.EndpointHandlerAPI)
+	listener.AddHandler(cns.EndpointPath, tracing.Handler("cns.Endpoint", service.EndpointHandlerAPI))
+	listener.AddHandler(cns.PodEndpointsPath, service.EndpointHandlerAPI)
+	listener.AddHandler(cns.NetworkMetricsPath, service.pushNetworkMetrics)
+	listener.AddHandler(cns.NetworkUtilizationPath, service.networkUtilizationHandler)
+	listener.AddHandler(cns.NCProgrammingPath, service.ncProgrammingHandler)
+	listener.AddHandler(cns.VerifyAllEndpointsPath, service.verifyAllEndpoints)
+	listener.AddHandler(cns.ReconcilePath, service.reconcile)
+	listener.AddHandler(cns.EndpointHealthPath, service.endpointHealthHandler)
+	listener.AddHandler(cns.NICTypesPath, service.nicTypesHandler)
+	listener.AddHandler(cns.EndpointPrefixPath, service.endpointPrefixHandler)
+	listener.AddHandler(cns.EndpointEventsPath, service.endpointEventsHandler)
+	listener.AddHandler(cns.IPAMPoolScalerPath, service.ipamPoolScalerHandler)
+	listener.AddHandler(cns.IPAMScaleDownPreviewPath, service.scaleDownPreviewHandler)
+	listener.AddHandler(cns.IPReservationsPath, service.ipReservationsHandler)
+	listener.AddHandler(cns.NamespaceIPBlocksPath, service.namespaceIPBlocksHandler)
+	listener.AddHandler(cns.OperationsPath, service.operationsHandler)
+	listener.AddHandler(cns.DatapathMigrationPath, service.datapathMigrationHandler)
+	listener.AddHandler(cns.PodTrafficPath, service.podTrafficHandler)
+	listener.AddHandler(cns.PodFlowsPath, service.podFlowsHandler)
 	// This API is only needed for Direct channel mode.
 	if config.ChannelMode == cns.Direct {
 		listener.AddHandler(cns.GetVMUniqueID, service.getVMUniqueID)
@@ -319,6 +526,16 @@ func (service *HTTPRestService) Init(config *common.ServiceConfig) error {
 	listener.AddHandler(cns.V2Prefix+cns.NmAgentSupportedApisPath, service.nmAgentSupportedApisHandler)
 	listener.AddHandler(cns.V2Prefix+cns.GetHomeAz, service.getHomeAz)
 	listener.AddHandler(cns.V2Prefix+cns.EndpointPath, service.EndpointHandlerAPI)
+	listener.AddHandler(cns.V2Prefix+cns.PodEndpointsPath, service.EndpointHandlerAPI)
+	listener.AddHandler(cns.V2Prefix+cns.NetworkMetricsPath, service.pushNetworkMetrics)
+	listener.AddHandler(cns.V2Prefix+cns.NetworkUtilizationPath, service.networkUtilizationHandler)
+	listener.AddHandler(cns.V2Prefix+cns.NCProgrammingPath, service.ncProgrammingHandler)
+	listener.AddHandler(cns.V2Prefix+cns.VerifyAllEndpointsPath, service.verifyAllEndpoints)
+	listener.AddHandler(cns.V2Prefix+cns.ReconcilePath, service.reconcile)
+	listener.AddHandler(cns.V2Prefix+cns.EndpointHealthPath, service.endpointHealthHandler)
+	listener.AddHandler(cns.V2Prefix+cns.NICTypesPath, service.nicTypesHandler)
+	listener.AddHandler(cns.V2Prefix+cns.EndpointPrefixPath, service.endpointPrefixHandler)
+	listener.AddHandler(cns.V2Prefix+cns.EndpointEventsPath, service.endpointEventsHandler)
 	// This API is only needed for Direct channel mode.
 	if config.ChannelMode == cns.Direct {
 		listener.AddHandler(cns.V2Prefix+cns.GetVMUniqueID, service.getVMUniqueID)
@@ -0,0 +1,48 @@
+package restserver
+
+import (
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/pkg/errors"
+)
+
+// RouteHealthEvent is the node event recorded with a change of the route health of an endpoint.
+type RouteHealthEvent struct {
+	Type    string
+	Reason  string
+	Message string
+}
+
+// SetRouteHealth records the health of the default routes of the endpoint by interface name, and publishes the
+// endpoint update and the node event.
+func (service *HTTPRestService) SetRouteHealth(endpointID string, health map[string]*RouteHealth, event RouteHealthEvent) error {
+	service.Lock()
+	defer service.Unlock()
+
+	if service.EndpointStateStore == nil {
+		return ErrStoreEmpty
+	}
+	endpointInfo, ok := service.EndpointState[endpointID]
+	if !ok {
+		return errors.Wrapf(ErrEndpointStateNotFound, "endpoint %s", endpointID)
+	}
+	previous := make(map[string]*RouteHealth, len(health))
+	for ifName, routeHealth := range health {
+		if ipInfo, ok := endpointInfo.IfnameToIPMap[ifName]; ok {
+			previous[ifName] = ipInfo.RouteHealth
+			ipInfo.RouteHealth = routeHealth
+		}
+	}
+	if err := service.EndpointStateStore.Write(EndpointStoreKey, service.EndpointState); err != nil {
+		for ifName, routeHealth := range previous {
+			endpointInfo.IfnameToIPMap[ifName].RouteHealth = routeHealth
+		}
+		return errors.Wrapf(err, "failed to save the route health of endpoint %s", endpointID)
+	}
+	service.endpointEvents.publish(EndpointUpdated, endpointID, endpointInfo)
+
+	logger.Printf("[RouteHealth] Endpoint %s: %s", endpointID, event.Message)
+	if service.nodeEvents != nil && event.Reason != "" {
+		service.nodeEvents.Eventf(event.Type, event.Reason, "Pod %s/%s: %s", endpointInfo.PodNamespace, endpointInfo.PodName, event.Message)
+	}
+	return nil
+}
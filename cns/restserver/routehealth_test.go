@@ -0,0 +1,47 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetRouteHealth(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.EndpointStateStore = store.NewMockStore("")
+	events := &fakeNodeEventRecorder{}
+	svc.SetNodeEventRecorder(events)
+
+	require.ErrorIs(t, svc.SetRouteHealth("ep1", nil, RouteHealthEvent{}), ErrEndpointStateNotFound)
+
+	require.NoError(t, svc.UpdateEndpointHelper("ep1", map[string]*IPInfo{
+		InfraInterfaceName: {NICType: cns.InfraNIC},
+		"eth1":             {NICType: cns.DelegatedVMNIC, NetNsPath: "/var/run/netns/pod1"},
+	}))
+	svc.EndpointState["ep1"].PodName, svc.EndpointState["ep1"].PodNamespace = "pod1", "default"
+	_, since, _ := svc.WaitEndpointEvents(context.Background(), 0, 0)
+
+	now := time.Unix(1700000000, 0)
+	require.NoError(t, svc.SetRouteHealth("ep1", map[string]*RouteHealth{
+		InfraInterfaceName: {Gateway: "169.254.1.1", Metric: 200, BaseMetric: 100, LastError: "timeout", LastTransition: now},
+		"eth1":             {Gateway: "10.1.0.1", Healthy: true, Metric: 100, BaseMetric: 200, LastTransition: now},
+		"eth2":             {Gateway: "10.2.0.1", Healthy: true},
+	}, RouteHealthEvent{Type: corev1.EventTypeWarning, Reason: "DefaultRouteFailover", Message: "egress moved to eth1"}))
+
+	endpointInfo := svc.ListEndpoints()["ep1"]
+	assert.Equal(t, 200, endpointInfo.IfnameToIPMap[InfraInterfaceName].RouteHealth.Metric)
+	assert.True(t, endpointInfo.IfnameToIPMap["eth1"].RouteHealth.Healthy)
+	assert.NotContains(t, endpointInfo.IfnameToIPMap, "eth2")
+	assert.Equal(t, []string{"DefaultRouteFailover: Pod default/pod1: egress moved to eth1"}, events.reasons[len(events.reasons)-1:])
+
+	evs, _, _ := svc.WaitEndpointEvents(context.Background(), since, 0)
+	require.Len(t, evs, 1)
+	assert.Equal(t, EndpointUpdated, evs[0].Type)
+	assert.Equal(t, "10.1.0.1", evs[0].EndpointInfo.IfnameToIPMap["eth1"].RouteHealth.Gateway)
+}
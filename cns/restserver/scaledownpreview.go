@@ -0,0 +1,91 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidRequestedIPCount = errors.New("requested IP count must not be negative")
+
+// PreviewScaleDown reports what shrinking the pool to requestedIPCount IPs would do, without changing the pool. It
+// picks the IPs to release as MarkNIPsPendingRelease does.
+func (service *HTTPRestService) PreviewScaleDown(requestedIPCount int64) (cns.IPAMScaleDownPreviewResponse, error) {
+	if requestedIPCount < 0 {
+		return cns.IPAMScaleDownPreviewResponse{}, errors.Wrapf(ErrInvalidRequestedIPCount, "requested %d", requestedIPCount)
+	}
+	service.RLock()
+	defer service.RUnlock()
+
+	var preview cns.IPAMScaleDownPreviewResponse
+	var assigned []cns.IPConfigurationStatus
+	for _, ipConfig := range service.PodIPConfigState { //nolint:gocritic // ignore copy
+		switch ipConfig.GetState() { //nolint:exhaustive // the IPs pending release are already leaving the pool
+		case types.PendingRelease:
+			continue
+		case types.Assigned:
+			assigned = append(assigned, ipConfig)
+		}
+		preview.CurrentIPCount++
+	}
+	preview.MinRequestedIPCount = int64(len(assigned))
+
+	toRelease := preview.CurrentIPCount - requestedIPCount
+	if toRelease <= 0 {
+		return preview, nil
+	}
+	for _, ipConfig := range service.releaseCandidatesUntransacted(int(toRelease)) { //nolint:gocritic // ignore copy
+		preview.ReleasedIPs = append(preview.ReleasedIPs, ipConfig.IPAddress)
+	}
+	if int64(len(preview.ReleasedIPs)) == toRelease {
+		return preview, nil
+	}
+
+	// any of the assigned IPs would have to be freed for the pool to shrink further
+	preview.Blocked = true
+	sort.Slice(assigned, func(i, j int) bool { return assigned[i].IPAddress < assigned[j].IPAddress })
+	for _, ipConfig := range assigned { //nolint:gocritic // ignore copy
+		blocker := cns.IPAMScaleDownBlocker{IPAddress: ipConfig.IPAddress}
+		if ipConfig.PodInfo != nil {
+			blocker.PodName = ipConfig.PodInfo.Name()
+			blocker.PodNamespace = ipConfig.PodInfo.Namespace()
+		}
+		preview.Blockers = append(preview.Blockers, blocker)
+	}
+	return preview, nil
+}
+
+// scaleDownPreviewHandler previews a scale down of the pool to the requested IP count on a POST.
+func (service *HTTPRestService) scaleDownPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	opName := "scaleDownPreviewHandler"
+	var response cns.IPAMScaleDownPreviewResponse
+
+	if r.Method == http.MethodPost {
+		var req cns.IPAMScaleDownPreviewRequest
+		err := common.Decode(w, r, &req)
+		logger.Request(opName, &req, err)
+		if err != nil {
+			return
+		}
+		if response, err = service.PreviewScaleDown(req.RequestedIPCount); err != nil {
+			response.Response = cns.Response{
+				ReturnCode: types.InvalidParameter,
+				Message:    fmt.Sprintf("[Azure CNS] %s failed with error: %v", opName, err),
+			}
+		}
+	} else {
+		response.Response = cns.Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure CNS] scaleDownPreview API expects a POST.",
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
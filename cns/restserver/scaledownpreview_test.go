@@ -0,0 +1,102 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newScaleDownPreviewTestService() *HTTPRestService {
+	svc := getTestService(cns.KubernetesCRD)
+	assigned := newPodState(testIP1, "id1", testNCID, types.Assigned, 0)
+	assigned.PodInfo = cns.NewPodInfo("a1b2c3-eth0", "a1b2c3", "web-0", "payments")
+	svc.PodIPConfigState = map[string]cns.IPConfigurationStatus{
+		"id1": assigned,
+		"id2": newPodState(testIP2, "id2", testNCID, types.Available, 0),
+		"id3": newPodState(testIP3, "id3", testNCID, types.Available, 0),
+		"id4": newPodState(testIP4, "id4", testNCID, types.PendingProgramming, 0),
+		"id5": newPodState("10.0.0.5", "id5", testNCID, types.PendingRelease, 0),
+	}
+	return svc
+}
+
+func TestPreviewScaleDown(t *testing.T) {
+	svc := newScaleDownPreviewTestService()
+
+	preview, err := svc.PreviewScaleDown(2)
+	require.NoError(t, err)
+	assert.Equal(t, cns.IPAMScaleDownPreviewResponse{
+		CurrentIPCount:      4,
+		ReleasedIPs:         []string{testIP4, testIP2},
+		MinRequestedIPCount: 1,
+	}, preview)
+
+	// the scale down releases the previewed IPs
+	released, err := svc.MarkNIPsPendingRelease(2)
+	require.NoError(t, err)
+	ips := []string{}
+	for _, ipConfig := range released { //nolint:gocritic // ignore copy
+		ips = append(ips, ipConfig.IPAddress)
+	}
+	sort.Strings(ips)
+	assert.Equal(t, []string{testIP2, testIP4}, ips)
+
+	// the assigned IP keeps the pool from shrinking to zero
+	svc = newScaleDownPreviewTestService()
+	preview, err = svc.PreviewScaleDown(0)
+	require.NoError(t, err)
+	assert.Equal(t, cns.IPAMScaleDownPreviewResponse{
+		CurrentIPCount:      4,
+		ReleasedIPs:         []string{testIP4, testIP2, testIP3},
+		Blocked:             true,
+		MinRequestedIPCount: 1,
+		Blockers:            []cns.IPAMScaleDownBlocker{{IPAddress: testIP1, PodName: "web-0", PodNamespace: "payments"}},
+	}, preview)
+
+	// the preview doesn't change the pool
+	ipConfig := svc.PodIPConfigState["id2"]
+	assert.Equal(t, types.Available, ipConfig.GetState())
+
+	// not a scale down
+	preview, err = svc.PreviewScaleDown(10)
+	require.NoError(t, err)
+	assert.Empty(t, preview.ReleasedIPs)
+	assert.False(t, preview.Blocked)
+
+	_, err = svc.PreviewScaleDown(-1)
+	require.ErrorIs(t, err, ErrInvalidRequestedIPCount)
+}
+
+func TestScaleDownPreviewHandler(t *testing.T) {
+	svc := newScaleDownPreviewTestService()
+
+	do := func(method string, body interface{}) cns.IPAMScaleDownPreviewResponse {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		w := httptest.NewRecorder()
+		svc.scaleDownPreviewHandler(w, httptest.NewRequest(method, cns.IPAMScaleDownPreviewPath, &buf))
+		var resp cns.IPAMScaleDownPreviewResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := do(http.MethodPost, cns.IPAMScaleDownPreviewRequest{RequestedIPCount: 3})
+	require.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, []string{testIP4}, resp.ReleasedIPs)
+
+	resp = do(http.MethodPost, cns.IPAMScaleDownPreviewRequest{RequestedIPCount: -1})
+	assert.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+
+	resp = do(http.MethodGet, nil)
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
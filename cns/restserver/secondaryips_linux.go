@@ -0,0 +1,6 @@
+package restserver
+
+// secondaryIPsSupported returns nil, both endpoint clients program the secondary IPs of the pods on linux.
+func secondaryIPsSupported() error {
+	return nil
+}
@@ -0,0 +1,14 @@
+package restserver
+
+import (
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+)
+
+// secondaryIPsSupported returns an error on the nodes without the hcn api, whose hnsv1 endpoints take one IP per family.
+func secondaryIPsSupported() error {
+	if err := hcn.V2ApiSupported(); err != nil {
+		return errors.Wrap(ErrSecondaryIPsNotSupported, "the hnsv1 endpoints of the node take one IP per family")
+	}
+	return nil
+}
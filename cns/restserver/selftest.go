@@ -0,0 +1,54 @@
+package restserver
+
+import (
+	"context"
+	"net"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/selftest"
+	"github.com/pkg/errors"
+)
+
+const (
+	selfTestContainerID  = "azure-cns-selftest"
+	selfTestInterfaceID  = "azure-cns-selftest-eth0"
+	selfTestPodName      = "azure-cns-selftest"
+	selfTestPodNamespace = "kube-system"
+)
+
+var errNoSelfTestIPv4 = errors.New("no ipv4 address assigned to the self-test pod")
+
+// RunSelfTest assigns an IP of the pool to a fake pod, plumbs and probes an endpoint with it through the datapath, and
+// releases the IP again. The IP is assigned without the endpoint state, so the fake pod is never seen by CNI.
+func (service *HTTPRestService) RunSelfTest(ctx context.Context, datapath selftest.Datapath) error {
+	podInfo := cns.NewPodInfo(selfTestContainerID, selfTestInterfaceID, selfTestPodName, selfTestPodNamespace)
+	orchestratorContext, err := podInfo.OrchestratorContext()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the self-test pod info")
+	}
+	req := cns.IPConfigsRequest{
+		PodInterfaceID:      podInfo.InterfaceID(),
+		InfraContainerID:    podInfo.InfraContainerID(),
+		OrchestratorContext: orchestratorContext,
+	}
+
+	podIPInfo, err := requestIPConfigsHelper(service, req) //nolint:contextcheck // the pool doesn't take a context
+	if err != nil {
+		return errors.Wrap(err, "failed to assign an IP to the self-test pod")
+	}
+	defer func() {
+		if err := service.releaseIPConfigs(podInfo); err != nil {
+			logger.Errorf("[RunSelfTest] Failed to release the IPs of the self-test pod: %v", err)
+		}
+	}()
+
+	for i := range podIPInfo {
+		if ip := net.ParseIP(podIPInfo[i].PodIPConfig.IPAddress); ip == nil || ip.To4() == nil {
+			continue
+		}
+		logger.Printf("[RunSelfTest] Running the self-test with IP %s", podIPInfo[i].PodIPConfig.IPAddress)
+		return errors.Wrap(datapath.Run(ctx, &podIPInfo[i]), "self-test failed")
+	}
+	return errNoSelfTestIPv4
+}
@@ -0,0 +1,44 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/selftest"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSelfTestDatapath records the pod IPs it ran with.
+type fakeSelfTestDatapath struct {
+	podIPs []string
+	err    error
+}
+
+func (f *fakeSelfTestDatapath) Run(_ context.Context, podIPInfo *cns.PodIpInfo) error {
+	f.podIPs = append(f.podIPs, podIPInfo.PodIPConfig.IPAddress)
+	return f.err
+}
+
+func TestRunSelfTest(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	testState := newPodState(testIP1, ipIDs[0][0], testNCID, types.Available, 0)
+	require.NoError(t, updatePodIPConfigState(t, svc, map[string]cns.IPConfigurationStatus{testState.ID: testState}, testNCID))
+
+	datapath := &fakeSelfTestDatapath{}
+	require.NoError(t, svc.RunSelfTest(context.TODO(), datapath))
+	assert.Equal(t, []string{testIP1}, datapath.podIPs)
+
+	// the IP is released whether the datapath passed or not
+	datapath.err = selftest.ErrProbeFailed
+	require.ErrorIs(t, svc.RunSelfTest(context.TODO(), datapath), selftest.ErrProbeFailed)
+	assert.Len(t, svc.GetAvailableIPConfigs(), 1)
+	assert.Empty(t, svc.PodIPIDByPodInterfaceKey)
+
+	// without an IP in the pool the datapath isn't run
+	require.NoError(t, svc.MarkExistingIPsAsPendingRelease([]string{testState.ID}))
+	require.ErrorIs(t, svc.RunSelfTest(context.TODO(), datapath), ErrNotEnoughIPs)
+	assert.Len(t, datapath.podIPs, 2)
+}
@@ -0,0 +1,117 @@
+package restserver
+
+import (
+	"net/netip"
+	"strconv"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidSnatBridgeSubnet  = errors.New("invalid snat bridge subnet")
+	ErrSnatBridgeSubnetConflict = errors.New("snat bridge subnet conflicts with the host networking")
+)
+
+// hostRouteLister lists the destinations of the host routes which the snat bridge subnet must not overlap, leaving out
+// the default routes and the routes of the snat bridge itself.
+type hostRouteLister interface {
+	HostRoutes() ([]netip.Prefix, error)
+}
+
+// moveToSnatBridgeSubnet moves the LocalIPConfiguration of the NC, the ips of the snat bridge and of the NC on it, to
+// the snat bridge subnet. The ips keep their offset in their subnet. The subnet must not overlap the subnets of the
+// NC and the host or the host routes.
+func (service *HTTPRestService) moveToSnatBridgeSubnet(resp *cns.GetNetworkContainerResponse, snatBridgeSubnet string) error {
+	subnet, err := netip.ParsePrefix(snatBridgeSubnet)
+	if err != nil || !subnet.Addr().Is4() {
+		return errors.Wrapf(ErrInvalidSnatBridgeSubnet, "%s is not an ipv4 subnet", snatBridgeSubnet)
+	}
+	subnet = subnet.Masked()
+
+	local := resp.LocalIPConfiguration
+	localIP, err := moveToSubnet(local.IPSubnet.IPAddress, local.IPSubnet.PrefixLength, subnet)
+	if err != nil {
+		return err
+	}
+	gatewayIP, err := moveToSubnet(local.GatewayIPAddress, local.IPSubnet.PrefixLength, subnet)
+	if err != nil {
+		return err
+	}
+
+	if err := service.checkSnatBridgeSubnetConflicts(subnet, resp); err != nil {
+		return err
+	}
+
+	resp.LocalIPConfiguration.IPSubnet = cns.IPSubnet{IPAddress: localIP.String(), PrefixLength: uint8(subnet.Bits())}
+	resp.LocalIPConfiguration.GatewayIPAddress = gatewayIP.String()
+	return nil
+}
+
+// moveToSubnet returns the ip of the subnet at the offset of ip in its subnet of the prefix length.
+func moveToSubnet(ip string, prefixLength uint8, subnet netip.Prefix) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is4() {
+		return netip.Addr{}, errors.Wrapf(ErrInvalidSnatBridgeSubnet, "local ip %q of the NC is not an ipv4 address", ip)
+	}
+	from, err := addr.Prefix(int(prefixLength))
+	if err != nil {
+		return netip.Addr{}, errors.Wrapf(ErrInvalidSnatBridgeSubnet, "invalid prefix length %d of the local ip of the NC", prefixLength)
+	}
+
+	offset := ipv4ToUint32(addr) - ipv4ToUint32(from.Addr())
+	if subnet.Bits() > 0 && offset>>(32-subnet.Bits()) != 0 {
+		return netip.Addr{}, errors.Wrapf(ErrInvalidSnatBridgeSubnet, "%s is too small for the local ip %s of the NC", subnet, ip)
+	}
+	return uint32ToIPv4(ipv4ToUint32(subnet.Addr()) + offset), nil
+}
+
+// checkSnatBridgeSubnetConflicts returns an error when the subnet overlaps the subnet or the address space of the NC,
+// or the host networking.
+func (service *HTTPRestService) checkSnatBridgeSubnetConflicts(subnet netip.Prefix, resp *cns.GetNetworkContainerResponse) error {
+	ncSubnets := append([]cns.IPSubnet{resp.IPConfiguration.IPSubnet}, resp.CnetAddressSpace...)
+	for _, ncSubnet := range ncSubnets {
+		prefix, err := netip.ParsePrefix(ncSubnet.IPAddress + "/" + strconv.Itoa(int(ncSubnet.PrefixLength)))
+		if err != nil {
+			continue
+		}
+		if prefix.Overlaps(subnet) {
+			return errors.Wrapf(ErrSnatBridgeSubnetConflict, "%s overlaps the vnet subnet %s of the NC", subnet, prefix.Masked())
+		}
+	}
+
+	return service.checkHostSubnetConflicts(subnet, ErrSnatBridgeSubnetConflict)
+}
+
+// checkHostSubnetConflicts returns errConflict when the subnet overlaps the subnet of the primary interface of the host
+// or a host route.
+func (service *HTTPRestService) checkHostSubnetConflicts(subnet netip.Prefix, errConflict error) error {
+	if service.state.primaryInterface != nil {
+		if hostSubnet, err := netip.ParsePrefix(service.state.primaryInterface.Subnet); err == nil && hostSubnet.Overlaps(subnet) {
+			return errors.Wrapf(errConflict, "%s overlaps the host subnet %s", subnet, hostSubnet)
+		}
+	}
+
+	if service.hostRoutes == nil {
+		return nil
+	}
+	routes, err := service.hostRoutes.HostRoutes()
+	if err != nil {
+		return errors.Wrap(err, "failed to list the host routes")
+	}
+	for _, route := range routes {
+		if route.Overlaps(subnet) {
+			return errors.Wrapf(errConflict, "%s overlaps the host route to %s", subnet, route)
+		}
+	}
+	return nil
+}
+
+func ipv4ToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func uint32ToIPv4(v uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
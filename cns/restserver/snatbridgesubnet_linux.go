@@ -0,0 +1,45 @@
+package restserver
+
+import (
+	"net/netip"
+
+	"github.com/Azure/azure-container-networking/network/snat"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// netlinkRouteLister lists the ipv4 routes of the main routing table of the host.
+type netlinkRouteLister struct{}
+
+func newHostRouteLister() hostRouteLister {
+	return netlinkRouteLister{}
+}
+
+func (netlinkRouteLister) HostRoutes() ([]netip.Prefix, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list routes")
+	}
+
+	snatBridgeIndex := 0
+	if link, err := netlink.LinkByName(snat.SnatBridgeName); err == nil {
+		snatBridgeIndex = link.Attrs().Index
+	}
+
+	prefixes := []netip.Prefix{}
+	for i := range routes {
+		if routes[i].Dst == nil || (snatBridgeIndex != 0 && routes[i].LinkIndex == snatBridgeIndex) {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(routes[i].Dst.IP.To4())
+		if !ok {
+			continue
+		}
+		bits, _ := routes[i].Dst.Mask.Size()
+		if bits == 0 {
+			continue
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, bits))
+	}
+	return prefixes, nil
+}
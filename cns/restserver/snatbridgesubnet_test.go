@@ -0,0 +1,103 @@
+package restserver
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/wireserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHostRouteLister struct {
+	routes []netip.Prefix
+}
+
+func (f fakeHostRouteLister) HostRoutes() ([]netip.Prefix, error) {
+	return f.routes, nil
+}
+
+func TestMoveToSnatBridgeSubnet(t *testing.T) {
+	tests := []struct {
+		name        string
+		subnet      string
+		wantLocal   cns.IPConfiguration
+		wantErr     error
+		hostRoutes  []netip.Prefix
+		cnetSubnets []cns.IPSubnet
+	}{
+		{
+			name:   "moved to the subnet",
+			subnet: "100.64.0.0/16",
+			wantLocal: cns.IPConfiguration{
+				IPSubnet:         cns.IPSubnet{IPAddress: "100.64.0.5", PrefixLength: 16},
+				GatewayIPAddress: "100.64.0.1",
+			},
+			hostRoutes: []netip.Prefix{netip.MustParsePrefix("172.16.0.0/12")},
+		},
+		{
+			name:    "not a subnet",
+			subnet:  "100.64.0.0",
+			wantErr: ErrInvalidSnatBridgeSubnet,
+		},
+		{
+			name:    "ipv6 subnet",
+			subnet:  "fd00::/64",
+			wantErr: ErrInvalidSnatBridgeSubnet,
+		},
+		{
+			name:    "subnet too small for the local ips",
+			subnet:  "100.64.0.0/30",
+			wantErr: ErrInvalidSnatBridgeSubnet,
+		},
+		{
+			name:    "overlaps the NC subnet",
+			subnet:  "10.0.0.0/8",
+			wantErr: ErrSnatBridgeSubnetConflict,
+		},
+		{
+			name:        "overlaps the vnet address space",
+			subnet:      "192.168.0.0/24",
+			cnetSubnets: []cns.IPSubnet{{IPAddress: "192.168.0.0", PrefixLength: 16}},
+			wantErr:     ErrSnatBridgeSubnetConflict,
+		},
+		{
+			name:    "overlaps the host subnet",
+			subnet:  "10.240.0.0/24",
+			wantErr: ErrSnatBridgeSubnetConflict,
+		},
+		{
+			name:       "overlaps a host route",
+			subnet:     "100.64.0.0/16",
+			hostRoutes: []netip.Prefix{netip.MustParsePrefix("100.64.10.0/24")},
+			wantErr:    ErrSnatBridgeSubnetConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &HTTPRestService{
+				state:      &httpRestServiceState{primaryInterface: &wireserver.InterfaceInfo{Subnet: "10.240.0.0/16"}},
+				hostRoutes: fakeHostRouteLister{routes: tt.hostRoutes},
+			}
+			resp := &cns.GetNetworkContainerResponse{
+				IPConfiguration: cns.IPConfiguration{IPSubnet: cns.IPSubnet{IPAddress: "10.1.0.4", PrefixLength: 24}},
+				LocalIPConfiguration: cns.IPConfiguration{
+					IPSubnet:         cns.IPSubnet{IPAddress: "169.254.0.5", PrefixLength: 17},
+					GatewayIPAddress: "169.254.0.1",
+				},
+				CnetAddressSpace: tt.cnetSubnets,
+			}
+
+			err := svc.moveToSnatBridgeSubnet(resp, tt.subnet)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLocal, resp.LocalIPConfiguration)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package restserver
+
+import "net/netip"
+
+// noHostRouteLister lists no host routes, windows has no snat bridge and the host NC apipa endpoint only needs the
+// snat bridge subnet not to overlap the vnet and host subnets.
+type noHostRouteLister struct{}
+
+func newHostRouteLister() hostRouteLister {
+	return noHostRouteLister{}
+}
+
+func (noHostRouteLister) HostRoutes() ([]netip.Prefix, error) {
+	return nil, nil
+}
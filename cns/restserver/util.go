@@ -341,6 +341,11 @@ func (service *HTTPRestService) addIPConfigStateUntransacted(ncID string, hostVe
 			IPAddress: ipconfig.IPAddress,
 			PodInfo:   nil,
 		}
+		// an IP reserved while it was out of the pool is kept from the pods once it is back
+		if owner, reserved := service.ipReservations[ipconfig.IPAddress]; reserved && newIPCNSStatus == types.Available {
+			newIPCNSStatus = types.Assigned
+			ipconfigStatus.PodInfo = ipReservationPodInfo(ipconfig.IPAddress, owner)
+		}
 		ipconfigStatus.WithStateMiddleware(stateTransitionMiddleware)
 		ipconfigStatus.SetState(newIPCNSStatus)
 		logger.Printf("[Azure-Cns] Add IP %s as %s", ipconfig.IPAddress, newIPCNSStatus)
@@ -387,6 +392,34 @@ func (service *HTTPRestService) removeToBeDeletedIPStateUntransacted(
 	return 0, ""
 }
 
+// orchestratorContextOfPod returns the orchestrator context the network containers of the pod are registered with.
+// With the prefix match, it is the one in the namespace of the pod with the longest name the pod name is or starts
+// with, followed by a dash, or the one of the pod name if there is none.
+func (service *HTTPRestService) orchestratorContextOfPod(podInfo cns.PodInfo) (string, error) {
+	orchestratorContext := podInfo.Name() + podInfo.Namespace()
+	switch podInfo.NameMatch() {
+	case cns.PodNameMatchExact:
+		return orchestratorContext, nil
+	case cns.PodNameMatchPrefix:
+		longest := ""
+		for registered := range service.state.ContainerIDByOrchestratorContext {
+			name, ok := strings.CutSuffix(registered, podInfo.Namespace())
+			if !ok || name == "" || len(name) <= len(longest) {
+				continue
+			}
+			if podInfo.Name() == name || strings.HasPrefix(podInfo.Name(), name+"-") {
+				longest = name
+			}
+		}
+		if longest == "" {
+			return orchestratorContext, nil
+		}
+		return longest + podInfo.Namespace(), nil
+	default:
+		return "", errors.Errorf("unknown pod name match %q", podInfo.NameMatch())
+	}
+}
+
 func (service *HTTPRestService) getAllNetworkContainerResponses(
 	req cns.GetNetworkContainerRequest,
 ) []cns.GetNetworkContainerResponse {
@@ -416,7 +449,17 @@ func (service *HTTPRestService) getAllNetworkContainerResponses(
 		}
 
 		// get networkContainerIDs as string, "nc1, nc2"
-		orchestratorContext := podInfo.Name() + podInfo.Namespace()
+		orchestratorContext, err := service.orchestratorContextOfPod(podInfo)
+		if err != nil {
+			response := cns.Response{
+				ReturnCode: types.InvalidRequest,
+				Message:    err.Error(),
+			}
+
+			getNetworkContainerResponse.Response = response
+			getNetworkContainersResponse = append(getNetworkContainersResponse, getNetworkContainerResponse)
+			return getNetworkContainersResponse
+		}
 		if service.state.ContainerIDByOrchestratorContext[orchestratorContext] != nil {
 			ncs = strings.Split(string(*service.state.ContainerIDByOrchestratorContext[orchestratorContext]), ",")
 		}
@@ -530,6 +573,8 @@ func (service *HTTPRestService) getAllNetworkContainerResponses(
 			LocalIPConfiguration:       savedReq.LocalIPConfiguration,
 			AllowHostToNCCommunication: savedReq.AllowHostToNCCommunication,
 			AllowNCToHostCommunication: savedReq.AllowNCToHostCommunication,
+			HostToNCPortRules:          savedReq.HostToNCPortRules,
+			NCToHostPortRules:          savedReq.NCToHostPortRules,
 			NetworkInterfaceInfo:       savedReq.NetworkInterfaceInfo,
 		}
 
@@ -542,6 +587,15 @@ func (service *HTTPRestService) getAllNetworkContainerResponses(
 				}
 			}
 		}
+
+		if req.SnatBridgeSubnet != "" {
+			if err := service.moveToSnatBridgeSubnet(&getNetworkContainerResponse, req.SnatBridgeSubnet); err != nil {
+				getNetworkContainerResponse.Response = cns.Response{
+					ReturnCode: types.SnatBridgeSubnetConflict,
+					Message:    err.Error(),
+				}
+			}
+		}
 		getNetworkContainersResponse = append(getNetworkContainersResponse, getNetworkContainerResponse)
 	}
 
@@ -837,6 +891,8 @@ func (service *HTTPRestService) populateIPConfigInfoUntransacted(ipConfigStatus
 	}
 
 	podIPInfo.NetworkContainerPrimaryIPConfig = primaryIPCfg
+	podIPInfo.SNATExceptionCIDRs = ncStatus.CreateNetworkContainerRequest.SNATExceptionCIDRs
+	podIPInfo.AvailabilityZone = ncStatus.CreateNetworkContainerRequest.AvailabilityZone
 	primaryHostInterface, err := service.getPrimaryHostInterface(context.TODO())
 	if err != nil {
 		return err
@@ -933,6 +989,8 @@ func (service *HTTPRestService) handleGetNetworkContainers(w http.ResponseWriter
 			LocalIPConfiguration:       ncDetails.CreateNetworkContainerRequest.LocalIPConfiguration,
 			AllowHostToNCCommunication: ncDetails.CreateNetworkContainerRequest.AllowHostToNCCommunication,
 			AllowNCToHostCommunication: ncDetails.CreateNetworkContainerRequest.AllowNCToHostCommunication,
+			HostToNCPortRules:          ncDetails.CreateNetworkContainerRequest.HostToNCPortRules,
+			NCToHostPortRules:          ncDetails.CreateNetworkContainerRequest.NCToHostPortRules,
 		}
 		networkContainers[i] = getNcResp
 		i++
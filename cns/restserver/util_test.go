@@ -180,3 +180,67 @@ func TestGetPnpIDMapping(t *testing.T) {
 	_, err = svc.getPNPIDFromMacAddress(context.Background(), "macaddress8")
 	require.Error(t, err)
 }
+
+func TestOrchestratorContextOfPod(t *testing.T) {
+	svc := &HTTPRestService{state: &httpRestServiceState{
+		ContainerIDByOrchestratorContext: map[string]*ncList{
+			"my-webns":     new(ncList),
+			"my-web-appns": new(ncList),
+			"my-web-appdb": new(ncList),
+		},
+	}}
+
+	tests := []struct {
+		name      string
+		podName   string
+		nameMatch cns.PodNameMatch
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:    "exact by default",
+			podName: "my-web-app-5c689d88bb-qwq47",
+			want:    "my-web-app-5c689d88bb-qwq47ns",
+		},
+		{
+			name:      "longest prefix",
+			podName:   "my-web-app-5c689d88bb-qwq47",
+			nameMatch: cns.PodNameMatchPrefix,
+			want:      "my-web-appns",
+		},
+		{
+			name:      "prefix ends at a dash",
+			podName:   "my-website-5c689d88bb-qwq47",
+			nameMatch: cns.PodNameMatchPrefix,
+			want:      "my-website-5c689d88bb-qwq47ns",
+		},
+		{
+			name:      "prefix is the whole name",
+			podName:   "my-web",
+			nameMatch: cns.PodNameMatchPrefix,
+			want:      "my-webns",
+		},
+		{
+			name:      "unknown match",
+			podName:   "my-web",
+			nameMatch: "regex",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			podInfo, err := cns.UnmarshalPodInfo([]byte(`{"PodName":"` + tt.podName + `","PodNamespace":"ns","PodNameMatch":"` + string(tt.nameMatch) + `"}`))
+			require.NoError(t, err)
+
+			got, err := svc.orchestratorContextOfPod(podInfo)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
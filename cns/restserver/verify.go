@@ -0,0 +1,175 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"golang.org/x/sync/errgroup"
+)
+
+// endpointVerifyConcurrency bounds the number of endpoints whose datapath is verified at once.
+const endpointVerifyConcurrency = 8
+
+// endpointDatapathVerifier checks that the interfaces of the endpoints are programmed on the node, and fixes the drift
+// it can.
+type endpointDatapathVerifier interface {
+	// VerifyEndpoint returns the drift of the interface of an endpoint from the node.
+	VerifyEndpoint(ifName string, ipInfo *IPInfo) []Drift
+	// OrphanedInterfaces returns the host interfaces of endpoints which none of the owned ones is.
+	OrphanedInterfaces(owned map[string]bool) ([]Drift, error)
+	// FixDrift fixes a drift of one of the FixableDriftClasses.
+	FixDrift(drift *Drift) error
+	// FixableDriftClasses returns the drift classes FixDrift fixes.
+	FixableDriftClasses() []DriftClass
+}
+
+// verifyAllEndpoints runs the checks of a CNI CHECK against every endpoint in the endpoint state, so that datapath
+// drift, for example after an upgrade, can be measured on a node without calling the CNI for each pod.
+func (service *HTTPRestService) verifyAllEndpoints(w http.ResponseWriter, r *http.Request) {
+	opName := "verifyAllEndpoints"
+	var response VerifyAllEndpointsResponse
+
+	switch {
+	case r.Method != http.MethodGet:
+		response.Response = Response{
+			ReturnCode: types.UnsupportedVerb,
+			Message:    "[Azure-CNS] verifyAllEndpoints API expects a GET.",
+		}
+	case service.Options[common.OptManageEndpointState] != true:
+		response.Response = Response{
+			ReturnCode: types.UnexpectedError,
+			Message:    fmt.Sprintf("[Azure-CNS] verifyAllEndpoints failed with error: %s", ErrOptManageEndpointState),
+		}
+	default:
+		response.Endpoints = service.verifyEndpoints(r.Context())
+		for i := range response.Endpoints {
+			if response.Endpoints[i].Passed {
+				response.Passed++
+			} else {
+				response.Failed++
+			}
+		}
+	}
+
+	err := common.Encode(w, &response)
+	logger.Response(opName, response, response.Response.ReturnCode, err)
+}
+
+// verifyEndpoints verifies every endpoint in the endpoint state and returns the results sorted by endpoint id.
+func (service *HTTPRestService) verifyEndpoints(ctx context.Context) []EndpointVerification {
+	endpointIDs, endpoints, drifts := service.endpointsDrift(ctx)
+	results := make([]EndpointVerification, len(endpointIDs))
+	for i, endpointID := range endpointIDs {
+		results[i] = EndpointVerification{
+			EndpointID:   endpointID,
+			PodName:      endpoints[endpointID].PodName,
+			PodNamespace: endpoints[endpointID].PodNamespace,
+			Passed:       len(drifts[i]) == 0,
+		}
+		for j := range drifts[i] {
+			results[i].Failures = append(results[i].Failures, drifts[i][j].IfName+": "+drifts[i][j].Message)
+		}
+	}
+	return results
+}
+
+// endpointsDrift returns the ids of the endpoints in the endpoint state sorted, a copy of the endpoints, and the drift
+// of each from the node, verifying at most endpointVerifyConcurrency endpoints at once.
+func (service *HTTPRestService) endpointsDrift(ctx context.Context) ([]string, map[string]EndpointInfo, [][]Drift) {
+	service.RLock()
+	endpoints := make(map[string]EndpointInfo, len(service.EndpointState))
+	for endpointID, endpointInfo := range service.EndpointState {
+		endpoints[endpointID] = *endpointInfo
+	}
+	assignedIPs := make(map[string]cns.IPConfigurationStatus, len(service.PodIPConfigState))
+	for _, ipConfig := range service.PodIPConfigState {
+		assignedIPs[ipConfig.IPAddress] = ipConfig
+	}
+	service.RUnlock()
+
+	endpointIDs := make([]string, 0, len(endpoints))
+	for endpointID := range endpoints {
+		endpointIDs = append(endpointIDs, endpointID)
+	}
+	sort.Strings(endpointIDs)
+
+	drifts := make([][]Drift, len(endpointIDs))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(endpointVerifyConcurrency)
+	for i, endpointID := range endpointIDs {
+		i, endpointID := i, endpointID
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return ctx.Err() //nolint:wrapcheck // the request was cancelled
+			}
+			drifts[i] = service.endpointDrift(endpointID, endpoints[endpointID], assignedIPs)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		logger.Errorf("[Azure-CNS] Verifying the endpoints was cancelled: %v", err)
+	}
+
+	return endpointIDs, endpoints, drifts
+}
+
+// endpointDrift checks that the endpoint's infra ips are assigned to its pod, and that each of its interfaces is
+// programmed on the node.
+func (service *HTTPRestService) endpointDrift(endpointID string, endpointInfo EndpointInfo,
+	assignedIPs map[string]cns.IPConfigurationStatus,
+) []Drift {
+	ifNames := make([]string, 0, len(endpointInfo.IfnameToIPMap))
+	for ifName := range endpointInfo.IfnameToIPMap {
+		ifNames = append(ifNames, ifName)
+	}
+	sort.Strings(ifNames)
+
+	var drifts []Drift
+	for _, ifName := range ifNames {
+		ipInfo := endpointInfo.IfnameToIPMap[ifName]
+		if ipInfo == nil {
+			continue
+		}
+
+		first := len(drifts)
+		// ips of delegated nics are not allocated by cns
+		if ipInfo.NICType == cns.InfraNIC || ipInfo.NICType == "" {
+			for _, ips := range [][]net.IPNet{ipInfo.IPv4, ipInfo.IPv6} {
+				for i := range ips {
+					ip := ips[i].IP.String()
+					if failure := verifyIPAssignment(ip, &endpointInfo, assignedIPs); failure != "" {
+						drifts = append(drifts, Drift{Class: DriftIPNotAssigned, IP: ip, Message: failure})
+					}
+				}
+			}
+		}
+
+		drifts = append(drifts, service.datapathVerifier.VerifyEndpoint(ifName, ipInfo)...)
+		for i := first; i < len(drifts); i++ {
+			drifts[i].EndpointID, drifts[i].IfName = endpointID, ifName
+		}
+	}
+	return drifts
+}
+
+// verifyIPAssignment returns why ip is not assigned to the endpoint's pod, or an empty string if it is.
+func verifyIPAssignment(ip string, endpointInfo *EndpointInfo, assignedIPs map[string]cns.IPConfigurationStatus) string {
+	ipConfig, ok := assignedIPs[ip]
+	if !ok {
+		return fmt.Sprintf("ip %s is not in the cns ip pool", ip)
+	}
+	if ipConfig.GetState() != types.Assigned {
+		return fmt.Sprintf("ip %s is %s in cns", ip, ipConfig.GetState())
+	}
+	if ipConfig.PodInfo == nil || ipConfig.PodInfo.Name() != endpointInfo.PodName || ipConfig.PodInfo.Namespace() != endpointInfo.PodNamespace {
+		return fmt.Sprintf("ip %s is assigned to another pod in cns", ip)
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package restserver
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// hostVethPrefix is the prefix of the names of the host veths the cni creates.
+const hostVethPrefix = "azv"
+
+// vethDatapathVerifier verifies the host veth of an endpoint, or the interface in the pod of an endpoint without one.
+type vethDatapathVerifier struct {
+	netio netio.NetIOInterface
+}
+
+func newEndpointDatapathVerifier() endpointDatapathVerifier {
+	return vethDatapathVerifier{netio: &netio.NetIO{}}
+}
+
+func (v vethDatapathVerifier) VerifyEndpoint(ifName string, ipInfo *IPInfo) []Drift {
+	// delegated nics are moved into the pod, they have no host veth
+	if ipInfo.HostVethName == "" {
+		if ipInfo.NetNsPath == "" {
+			return nil
+		}
+		return v.verifyPodInterface(ifName, ipInfo)
+	}
+
+	link, err := netlink.LinkByName(ipInfo.HostVethName)
+	if err != nil {
+		return []Drift{{
+			Class:     DriftInterfaceMissing,
+			Interface: ipInfo.HostVethName,
+			Message:   fmt.Sprintf("host veth %s not found: %v", ipInfo.HostVethName, err),
+		}}
+	}
+
+	var drifts []Drift
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		drifts = append(drifts, Drift{
+			Class:     DriftInterfaceDown,
+			Interface: ipInfo.HostVethName,
+			Message:   fmt.Sprintf("host veth %s is down", ipInfo.HostVethName),
+		})
+	}
+
+	// veths enslaved to a bridge are reached through the bridge, otherwise each ip is routed to the veth
+	if link.Attrs().MasterIndex != 0 {
+		return drifts
+	}
+
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return append(drifts, Drift{
+			Class:     DriftInterfaceMismatch,
+			Interface: ipInfo.HostVethName,
+			Message:   fmt.Sprintf("failed to list routes of host veth %s: %v", ipInfo.HostVethName, err),
+		})
+	}
+	for _, ips := range [][]net.IPNet{ipInfo.IPv4, ipInfo.IPv6} {
+		for i := range ips {
+			if !hasHostRoute(routes, ips[i].IP) {
+				drifts = append(drifts, Drift{
+					Class:     DriftRouteMissing,
+					Interface: ipInfo.HostVethName,
+					IP:        ips[i].IP.String(),
+					Message:   fmt.Sprintf("no route to %s via host veth %s", ips[i].IP, ipInfo.HostVethName),
+				})
+			}
+		}
+	}
+	return drifts
+}
+
+// verifyPodInterface verifies the interface of the endpoint in the netns of the pod, found by its mac if it has one. The
+// drift in the pod is not fixable.
+func (v vethDatapathVerifier) verifyPodInterface(ifName string, ipInfo *IPInfo) []Drift {
+	ifaces, err := v.netio.GetNetworkInterfacesInNetNs(ipInfo.NetNsPath)
+	if err != nil {
+		return []Drift{{
+			Class:     DriftInterfaceMissing,
+			Interface: ifName,
+			Message:   fmt.Sprintf("failed to list the interfaces in the pod netns %s: %v", ipInfo.NetNsPath, err),
+		}}
+	}
+	mac, _ := net.ParseMAC(ipInfo.MacAddress)
+	var iface *net.Interface
+	for i := range ifaces {
+		if (mac != nil && bytes.Equal(ifaces[i].HardwareAddr, mac)) || (mac == nil && ifaces[i].Name == ifName) {
+			iface = &ifaces[i]
+			break
+		}
+	}
+	if iface == nil {
+		return []Drift{{
+			Class:     DriftInterfaceMissing,
+			Interface: ifName,
+			Message:   fmt.Sprintf("interface %s not found in the pod netns %s", ifName, ipInfo.NetNsPath),
+		}}
+	}
+
+	var drifts []Drift
+	if iface.Flags&net.FlagUp == 0 {
+		drifts = append(drifts, Drift{
+			Class:     DriftInterfaceMismatch,
+			Interface: iface.Name,
+			Message:   fmt.Sprintf("interface %s in the pod is down", iface.Name),
+		})
+	}
+
+	addrs, err := v.netio.GetNetworkInterfaceAddrsInNetNs(ipInfo.NetNsPath, iface.Name)
+	if err != nil {
+		return append(drifts, Drift{
+			Class:     DriftInterfaceMismatch,
+			Interface: iface.Name,
+			Message:   fmt.Sprintf("failed to list the addresses of interface %s in the pod: %v", iface.Name, err),
+		})
+	}
+	for _, ips := range [][]net.IPNet{ipInfo.IPv4, ipInfo.IPv6} {
+		for i := range ips {
+			if !hasAddr(addrs, ips[i].IP) {
+				drifts = append(drifts, Drift{
+					Class:     DriftInterfaceMismatch,
+					Interface: iface.Name,
+					IP:        ips[i].IP.String(),
+					Message:   fmt.Sprintf("ip %s is not on interface %s in the pod", ips[i].IP, iface.Name),
+				})
+			}
+		}
+	}
+	return drifts
+}
+
+func (vethDatapathVerifier) OrphanedInterfaces(owned map[string]bool) ([]Drift, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list links")
+	}
+	var drifts []Drift
+	for _, link := range links {
+		name := link.Attrs().Name
+		if link.Type() != "veth" || !strings.HasPrefix(name, hostVethPrefix) || owned[name] {
+			continue
+		}
+		drifts = append(drifts, Drift{
+			Class:     DriftInterfaceOrphaned,
+			Interface: name,
+			Message:   fmt.Sprintf("host veth %s is not owned by any endpoint", name),
+		})
+	}
+	return drifts, nil
+}
+
+func (vethDatapathVerifier) FixableDriftClasses() []DriftClass {
+	return []DriftClass{DriftInterfaceDown, DriftRouteMissing, DriftInterfaceOrphaned}
+}
+
+func (vethDatapathVerifier) FixDrift(drift *Drift) error {
+	link, err := netlink.LinkByName(drift.Interface)
+	if err != nil {
+		return errors.Wrapf(err, "host veth %s not found", drift.Interface)
+	}
+	switch drift.Class {
+	case DriftInterfaceDown:
+		return errors.Wrap(netlink.LinkSetUp(link), "failed to set host veth up")
+	case DriftRouteMissing:
+		ip := net.ParseIP(drift.IP)
+		if ip == nil {
+			return errors.Errorf("invalid ip %q", drift.IP)
+		}
+		bits := 128 //nolint:gomnd // ipv6 host route
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32 //nolint:gomnd // ipv4 host route
+		}
+		return errors.Wrap(netlink.RouteReplace(&netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Scope:     netlink.SCOPE_LINK,
+			Dst:       &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)},
+		}), "failed to add route")
+	case DriftInterfaceOrphaned:
+		return errors.Wrap(netlink.LinkDel(link), "failed to delete host veth")
+	default:
+		return errors.Wrapf(ErrDriftNotFixable, "%s", drift.Class)
+	}
+}
+
+// hasHostRoute returns if routes has a host route to ip.
+func hasHostRoute(routes []netlink.Route, ip net.IP) bool {
+	for i := range routes {
+		if routes[i].Dst == nil || !routes[i].Dst.IP.Equal(ip) {
+			continue
+		}
+		if ones, bits := routes[i].Dst.Mask.Size(); ones == bits {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAddr returns if addrs has ip.
+func hasAddr(addrs []net.Addr, ip net.IP) bool {
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
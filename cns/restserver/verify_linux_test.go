@@ -0,0 +1,72 @@
+package restserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPodInterface(t *testing.T) {
+	const netNsPath = "/var/run/netns/pod1"
+	mac, _ := net.ParseMAC("12:34:56:78:9a:bc")
+	podIP := net.IPNet{IP: net.ParseIP("10.1.0.5"), Mask: net.CIDRMask(24, 32)}
+
+	tests := []struct {
+		name        string
+		ifaces      []netio.MockNetNsInterface
+		ipInfo      IPInfo
+		wantClasses []DriftClass
+	}{
+		{
+			name: "interface found by mac with its ip",
+			ifaces: []netio.MockNetNsInterface{{
+				Interface: net.Interface{Name: "eth1", HardwareAddr: mac, Flags: net.FlagUp},
+				Addrs:     []net.Addr{&podIP},
+			}},
+			ipInfo: IPInfo{IPv4: []net.IPNet{podIP}, MacAddress: mac.String(), NetNsPath: netNsPath},
+		},
+		{
+			name: "interface found by name without mac",
+			ifaces: []netio.MockNetNsInterface{{
+				Interface: net.Interface{Name: "eth1", Flags: net.FlagUp},
+				Addrs:     []net.Addr{&podIP},
+			}},
+			ipInfo: IPInfo{IPv4: []net.IPNet{podIP}, NetNsPath: netNsPath},
+		},
+		{
+			name:        "interface missing from the pod",
+			ifaces:      []netio.MockNetNsInterface{{Interface: net.Interface{Name: "eth1", Flags: net.FlagUp}}},
+			ipInfo:      IPInfo{IPv4: []net.IPNet{podIP}, MacAddress: mac.String(), NetNsPath: netNsPath},
+			wantClasses: []DriftClass{DriftInterfaceMissing},
+		},
+		{
+			name: "interface down without its ip",
+			ifaces: []netio.MockNetNsInterface{{
+				Interface: net.Interface{Name: "eth1", HardwareAddr: mac},
+			}},
+			ipInfo:      IPInfo{IPv4: []net.IPNet{podIP}, MacAddress: mac.String(), NetNsPath: netNsPath},
+			wantClasses: []DriftClass{DriftInterfaceMismatch, DriftInterfaceMismatch},
+		},
+		{
+			name:   "endpoint without host veth or netns is not verified",
+			ipInfo: IPInfo{IPv4: []net.IPNet{podIP}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			netioCli := netio.NewMockNetIO(false, 0)
+			netioCli.SetNetNsInterfaces(netNsPath, tt.ifaces)
+			v := vethDatapathVerifier{netio: netioCli}
+
+			var classes []DriftClass
+			for _, drift := range v.VerifyEndpoint("eth1", &tt.ipInfo) {
+				classes = append(classes, drift.Class)
+			}
+			assert.Equal(t, tt.wantClasses, classes)
+		})
+	}
+}
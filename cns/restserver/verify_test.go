@@ -0,0 +1,142 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acn "github.com/Azure/azure-container-networking/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDatapathVerifier fails the interfaces whose host veth is in missing or down, reports the orphans, and records the
+// drift it fixes.
+type fakeDatapathVerifier struct {
+	missing map[string]bool
+	down    map[string]bool
+	orphans []string
+	fixed   *[]string
+}
+
+func (f fakeDatapathVerifier) VerifyEndpoint(_ string, ipInfo *IPInfo) []Drift {
+	switch {
+	case f.missing[ipInfo.HostVethName]:
+		return []Drift{{Class: DriftInterfaceMissing, Interface: ipInfo.HostVethName, Message: "host veth " + ipInfo.HostVethName + " not found"}}
+	case f.down[ipInfo.HostVethName]:
+		return []Drift{{Class: DriftInterfaceDown, Interface: ipInfo.HostVethName, Message: "host veth " + ipInfo.HostVethName + " is down"}}
+	}
+	return nil
+}
+
+func (f fakeDatapathVerifier) OrphanedInterfaces(owned map[string]bool) ([]Drift, error) {
+	var drifts []Drift
+	for _, name := range f.orphans {
+		if !owned[name] {
+			drifts = append(drifts, Drift{Class: DriftInterfaceOrphaned, Interface: name, Message: "host veth " + name + " is not owned by any endpoint"})
+		}
+	}
+	return drifts, nil
+}
+
+func (fakeDatapathVerifier) FixableDriftClasses() []DriftClass {
+	return []DriftClass{DriftInterfaceDown, DriftRouteMissing, DriftInterfaceOrphaned}
+}
+
+func (f fakeDatapathVerifier) FixDrift(drift *Drift) error {
+	*f.fixed = append(*f.fixed, string(drift.Class)+" "+drift.Interface)
+	return nil
+}
+
+func TestVerifyAllEndpoints(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, true)
+	svc.datapathVerifier = fakeDatapathVerifier{missing: map[string]bool{"azv3": true}}
+
+	for i, podInfo := range []cns.PodInfo{testPod1Info, testPod2Info} {
+		ipConfig := newPodState([]string{testIP1, testIP2}[i], ipIDs[0][i], testNCID, types.Assigned, 0)
+		ipConfig.PodInfo = podInfo
+		svc.PodIPConfigState[ipConfig.ID] = ipConfig
+	}
+
+	unknownPod := cns.NewPodInfo("", "", "unknownpod", "unknownpodnamespace")
+	ipNet := func(ip string) []net.IPNet {
+		return []net.IPNet{{IP: net.ParseIP(ip), Mask: net.CIDRMask(32, 32)}}
+	}
+	svc.EndpointState = map[string]*EndpointInfo{
+		// healthy
+		"ep1": {
+			PodName:       testPod1Info.Name(),
+			PodNamespace:  testPod1Info.Namespace(),
+			IfnameToIPMap: map[string]*IPInfo{"eth0": {IPv4: ipNet(testIP1), HostVethName: "azv1", NICType: cns.InfraNIC}},
+		},
+		// ip assigned to testpod1
+		"ep2": {
+			PodName:       testPod3Info.Name(),
+			PodNamespace:  testPod3Info.Namespace(),
+			IfnameToIPMap: map[string]*IPInfo{"eth0": {IPv4: ipNet(testIP1), HostVethName: "azv2", NICType: cns.InfraNIC}},
+		},
+		// host veth missing, and the ip of the delegated nic is not checked against cns
+		"ep3": {
+			PodName:      testPod2Info.Name(),
+			PodNamespace: testPod2Info.Namespace(),
+			IfnameToIPMap: map[string]*IPInfo{
+				"eth0": {IPv4: ipNet(testIP2), HostVethName: "azv3", NICType: cns.InfraNIC},
+				"eth1": {IPv4: ipNet("20.0.0.4"), NICType: cns.NodeNetworkInterfaceFrontendNIC},
+			},
+		},
+		// ip not in the pool
+		"ep4": {
+			PodName:       unknownPod.Name(),
+			PodNamespace:  unknownPod.Namespace(),
+			IfnameToIPMap: map[string]*IPInfo{"eth0": {IPv4: ipNet("10.0.0.99"), HostVethName: "azv4"}},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	svc.verifyAllEndpoints(w, httptest.NewRequest(http.MethodGet, cns.VerifyAllEndpointsPath, http.NoBody))
+
+	var resp VerifyAllEndpointsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.Success, resp.Response.ReturnCode)
+	assert.Equal(t, 1, resp.Passed)
+	assert.Equal(t, 3, resp.Failed)
+	assert.Equal(t, []EndpointVerification{
+		{EndpointID: "ep1", PodName: testPod1Info.Name(), PodNamespace: testPod1Info.Namespace(), Passed: true},
+		{
+			EndpointID: "ep2", PodName: testPod3Info.Name(), PodNamespace: testPod3Info.Namespace(),
+			Failures: []string{"eth0: ip " + testIP1 + " is assigned to another pod in cns"},
+		},
+		{
+			EndpointID: "ep3", PodName: testPod2Info.Name(), PodNamespace: testPod2Info.Namespace(),
+			Failures: []string{"eth0: host veth azv3 not found"},
+		},
+		{
+			EndpointID: "ep4", PodName: unknownPod.Name(), PodNamespace: unknownPod.Namespace(),
+			Failures: []string{"eth0: ip 10.0.0.99 is not in the cns ip pool"},
+		},
+	}, resp.Endpoints)
+}
+
+func TestVerifyAllEndpointsRequiresEndpointState(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	svc.SetOption(acn.OptManageEndpointState, false)
+
+	w := httptest.NewRecorder()
+	svc.verifyAllEndpoints(w, httptest.NewRequest(http.MethodGet, cns.VerifyAllEndpointsPath, http.NoBody))
+
+	var resp VerifyAllEndpointsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.UnexpectedError, resp.Response.ReturnCode)
+	assert.Empty(t, resp.Endpoints)
+
+	svc.SetOption(acn.OptManageEndpointState, true)
+	w = httptest.NewRecorder()
+	svc.verifyAllEndpoints(w, httptest.NewRequest(http.MethodPost, cns.VerifyAllEndpointsPath, http.NoBody))
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+}
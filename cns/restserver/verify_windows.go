@@ -0,0 +1,79 @@
+package restserver
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+)
+
+// hnsDatapathVerifier verifies the hns endpoint of an endpoint.
+type hnsDatapathVerifier struct{}
+
+func newEndpointDatapathVerifier() endpointDatapathVerifier {
+	return hnsDatapathVerifier{}
+}
+
+func (hnsDatapathVerifier) VerifyEndpoint(_ string, ipInfo *IPInfo) []Drift {
+	// backend nics have no hns endpoint
+	if ipInfo.HnsEndpointID == "" {
+		return nil
+	}
+
+	hnsEndpoint, err := hcn.GetEndpointByID(ipInfo.HnsEndpointID)
+	if err != nil {
+		return []Drift{{
+			Class:     DriftInterfaceMissing,
+			Interface: ipInfo.HnsEndpointID,
+			Message:   fmt.Sprintf("hns endpoint %s not found: %v", ipInfo.HnsEndpointID, err),
+		}}
+	}
+
+	var drifts []Drift
+	if ipInfo.HnsNetworkID != "" && hnsEndpoint.HostComputeNetwork != ipInfo.HnsNetworkID {
+		drifts = append(drifts, Drift{
+			Class:     DriftInterfaceMismatch,
+			Interface: ipInfo.HnsEndpointID,
+			Message: fmt.Sprintf("hns endpoint %s is in network %s instead of %s",
+				ipInfo.HnsEndpointID, hnsEndpoint.HostComputeNetwork, ipInfo.HnsNetworkID),
+		})
+	}
+
+	for _, ips := range [][]net.IPNet{ipInfo.IPv4, ipInfo.IPv6} {
+		for i := range ips {
+			if !hasIPConfiguration(hnsEndpoint, ips[i].IP) {
+				drifts = append(drifts, Drift{
+					Class:     DriftInterfaceMismatch,
+					Interface: ipInfo.HnsEndpointID,
+					IP:        ips[i].IP.String(),
+					Message:   fmt.Sprintf("hns endpoint %s has no ip %s", ipInfo.HnsEndpointID, ips[i].IP),
+				})
+			}
+		}
+	}
+	return drifts
+}
+
+// OrphanedInterfaces returns no interfaces, the hns endpoints of other orchestrators can't be told apart from the ones
+// the cni orphaned.
+func (hnsDatapathVerifier) OrphanedInterfaces(map[string]bool) ([]Drift, error) {
+	return nil, nil
+}
+
+func (hnsDatapathVerifier) FixableDriftClasses() []DriftClass {
+	return nil
+}
+
+func (hnsDatapathVerifier) FixDrift(drift *Drift) error {
+	return errors.Wrapf(ErrDriftNotFixable, "%s", drift.Class)
+}
+
+func hasIPConfiguration(hnsEndpoint *hcn.HostComputeEndpoint, ip net.IP) bool {
+	for _, ipConfig := range hnsEndpoint.IpConfigurations {
+		if ip.Equal(net.ParseIP(ipConfig.IpAddress)) {
+			return true
+		}
+	}
+	return false
+}
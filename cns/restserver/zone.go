@@ -0,0 +1,32 @@
+package restserver
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/pkg/errors"
+)
+
+// SyncAvailabilityZone learns the availability zone of the node from IMDS. The IPs of the NCs in the zone of the node
+// are assigned before the IPs of the NCs in other zones, so that the traffic of the pods stays in the zone where it
+// can. The node is left without a zone, and IPs are assigned from any NC, when IMDS can't be reached.
+func (service *HTTPRestService) SyncAvailabilityZone(ctx context.Context) error {
+	zone, err := service.imdsClient.GetAvailabilityZone(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the availability zone of the node")
+	}
+	service.Lock()
+	service.availabilityZone = zone
+	service.Unlock()
+	logger.Printf("[SyncAvailabilityZone] The node is in availability zone %q", zone)
+	return nil
+}
+
+// ncInZoneUntransacted returns whether the IPs of the NC are preferred for the zone of the node: either the NC is in the
+// zone of the node or the zone of the node is unknown.
+func (service *HTTPRestService) ncInZoneUntransacted(ncID string) bool {
+	if service.availabilityZone == "" {
+		return true
+	}
+	return service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.AvailabilityZone == service.availabilityZone
+}
@@ -0,0 +1,232 @@
+package routehealth
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+// netnsDatapath changes the routes of the pods through netlink handles in their network namespaces, and pings their
+// gateways from icmp sockets opened in them.
+type netnsDatapath struct{}
+
+// probeSeq tells apart the echos of the concurrent probes, which share the icmp id.
+var probeSeq atomic.Uint32
+
+// NewDatapath returns the datapath of the monitor.
+func NewDatapath() (Datapath, error) {
+	return netnsDatapath{}, nil
+}
+
+func (netnsDatapath) DefaultRoutes(netNsPath string) ([]Route, error) {
+	var routes []Route
+	err := withHandle(netNsPath, func(handle *netlink.Handle) error {
+		defaults, err := defaultRoutes(handle)
+		if err != nil {
+			return err
+		}
+		for i := range defaults {
+			link, err := handle.LinkByIndex(defaults[i].LinkIndex)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get link %d", defaults[i].LinkIndex)
+			}
+			routes = append(routes, Route{IfName: link.Attrs().Name, Gateway: defaults[i].Gw, Metric: defaults[i].Priority})
+		}
+		return nil
+	})
+	return routes, err
+}
+
+func (netnsDatapath) SetMetrics(netNsPath string, metrics map[string]int) error {
+	return withHandle(netNsPath, func(handle *netlink.Handle) error {
+		defaults, err := defaultRoutes(handle)
+		if err != nil {
+			return err
+		}
+		maxMetric := 0
+		var changed []netlink.Route
+		var final []int
+		for i := range defaults {
+			maxMetric = max(maxMetric, defaults[i].Priority)
+			link, err := handle.LinkByIndex(defaults[i].LinkIndex)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get link %d", defaults[i].LinkIndex)
+			}
+			if metric, ok := metrics[link.Attrs().Name]; ok && metric != defaults[i].Priority {
+				changed = append(changed, defaults[i])
+				final = append(final, metric)
+			}
+		}
+		for _, metric := range metrics {
+			maxMetric = max(maxMetric, metric)
+		}
+
+		// the routes are moved out of the way to unused metrics first, so that the final metrics are free, and each
+		// route is added at its new metric before it is deleted from its old one
+		for i := range changed {
+			moved, err := moveRoute(handle, changed[i], maxMetric+1+i)
+			if err != nil {
+				return err
+			}
+			changed[i] = moved
+		}
+		for i := range changed {
+			if _, err := moveRoute(handle, changed[i], final[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (netnsDatapath) Probe(netNsPath string, route Route, timeout time.Duration) error {
+	conn, err := listenICMP(netNsPath, route.IfName)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.Wrap(err, "failed to set deadline")
+	}
+
+	id := os.Getpid() & 0xffff           //nolint:gomnd // icmp echo id is 16 bits
+	seq := int(probeSeq.Add(1) & 0xffff) //nolint:gomnd // icmp echo seq is 16 bits
+	echo := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("azure-cns-routehealth")}}
+	packed, err := echo.Marshal(nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal icmp echo")
+	}
+	if _, err := conn.WriteTo(packed, &net.IPAddr{IP: route.Gateway}); err != nil {
+		return errors.Wrapf(err, "failed to ping gateway %s", route.Gateway)
+	}
+
+	buf := make([]byte, 1500) //nolint:gomnd // mtu
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return errors.Wrapf(err, "no reply from gateway %s", route.Gateway)
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n]) //nolint:gomnd // icmp protocol number
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply || peer.String() != route.Gateway.String() {
+			continue
+		}
+		if body, ok := reply.Body.(*icmp.Echo); ok && body.ID == id && body.Seq == seq {
+			return nil
+		}
+	}
+}
+
+// withHandle calls f with a netlink handle in the network namespace.
+func withHandle(netNsPath string, f func(*netlink.Handle) error) error {
+	ns, err := netns.GetFromPath(netNsPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open netns %s", netNsPath)
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get netlink handle of netns %s", netNsPath)
+	}
+	defer handle.Close()
+	return f(handle)
+}
+
+// defaultRoutes returns the IPv4 default routes through a gateway in the main table.
+func defaultRoutes(handle *netlink.Handle) ([]netlink.Route, error) {
+	routes, err := handle.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list routes")
+	}
+	var defaults []netlink.Route
+	for i := range routes {
+		if routes[i].Gw == nil {
+			continue
+		}
+		if dst := routes[i].Dst; dst != nil {
+			if ones, _ := dst.Mask.Size(); ones != 0 {
+				continue
+			}
+		}
+		defaults = append(defaults, routes[i])
+	}
+	return defaults, nil
+}
+
+// moveRoute adds the route at the metric, then deletes it from its current one.
+func moveRoute(handle *netlink.Handle, route netlink.Route, metric int) (netlink.Route, error) {
+	moved := route
+	moved.Priority = metric
+	if err := handle.RouteAdd(&moved); err != nil {
+		return route, errors.Wrapf(err, "failed to add default route via %s at metric %d", route.Gw, metric)
+	}
+	if err := handle.RouteDel(&route); err != nil {
+		return moved, errors.Wrapf(err, "failed to delete default route via %s at metric %d", route.Gw, route.Priority)
+	}
+	return moved, nil
+}
+
+// listenICMP opens an icmp socket in the network namespace, bound to the interface so that the echos leave through it
+// whatever the routes.
+func listenICMP(netNsPath, ifName string) (net.PacketConn, error) {
+	ns, err := netns.GetFromPath(netNsPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open netns %s", netNsPath)
+	}
+	defer ns.Close()
+
+	var conn net.PacketConn
+	err = inNetns(ns, func() error {
+		lc := net.ListenConfig{Control: func(_, _ string, c syscall.RawConn) error {
+			var bindErr error
+			if err := c.Control(func(fd uintptr) { bindErr = unix.BindToDevice(int(fd), ifName) }); err != nil {
+				return err //nolint:wrapcheck // wrapped below
+			}
+			return bindErr
+		}}
+		var err error
+		conn, err = lc.ListenPacket(context.Background(), "ip4:icmp", "0.0.0.0")
+		return errors.Wrapf(err, "failed to open icmp socket on %s", ifName)
+	})
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// inNetns calls f on a thread in the network namespace, the sockets f opens stay in it.
+func inNetns(ns netns.NsHandle, f func() error) error {
+	runtime.LockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return errors.Wrap(err, "failed to get the host netns")
+	}
+	defer origin.Close()
+
+	if err := netns.Set(ns); err != nil {
+		runtime.UnlockOSThread()
+		return errors.Wrap(err, "failed to enter the netns")
+	}
+	fErr := f()
+	if err := netns.Set(origin); err != nil {
+		// the thread is left locked so that it exits with the goroutine instead of running others in the netns
+		return errors.Wrap(err, "failed to return to the host netns")
+	}
+	runtime.UnlockOSThread()
+	return fErr
+}
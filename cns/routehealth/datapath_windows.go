@@ -0,0 +1,6 @@
+package routehealth
+
+// NewDatapath returns ErrUnsupported, the default routes of windows pods are programmed through hns.
+func NewDatapath() (Datapath, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,340 @@
+// Package routehealth keeps the egress of multi-NIC pods on a healthy gateway. Such pods have a default route via each
+// of their interfaces, the one with the lowest metric carrying all their egress, so an outage of its NIC or gateway
+// strands the pod although another default route is available. The monitor probes the gateway of every default route
+// from inside the pod network namespace, and when a gateway stops answering moves its route behind the routes via the
+// healthy gateways, by swapping their metrics, and back once it answers again.
+package routehealth
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ErrUnsupported is returned by NewDatapath on the platforms the monitor doesn't run on.
+var ErrUnsupported = errors.New("route health monitor is not supported on this platform")
+
+// reasons of the node events
+const (
+	reasonGatewayUnhealthy     = "DefaultRouteGatewayUnhealthy"
+	reasonGatewayRecovered     = "DefaultRouteGatewayRecovered"
+	reasonDefaultRouteFailover = "DefaultRouteFailover"
+)
+
+// Route is an IPv4 default route in a pod network namespace.
+type Route struct {
+	IfName  string
+	Gateway net.IP
+	Metric  int
+}
+
+// Datapath reads and changes the default routes of the pods and probes their gateways.
+type Datapath interface {
+	// DefaultRoutes returns the IPv4 default routes in the network namespace.
+	DefaultRoutes(netNsPath string) ([]Route, error)
+	// Probe returns an error unless the gateway of the route answers via the interface of the route within timeout.
+	Probe(netNsPath string, route Route, timeout time.Duration) error
+	// SetMetrics changes the metrics of the default routes via the interfaces to the given ones, without removing any
+	// of them while they are changed.
+	SetMetrics(netNsPath string, metrics map[string]int) error
+}
+
+// Endpoints lists the endpoints of CNS and records the health of their routes.
+type Endpoints interface {
+	ListEndpoints() map[string]*restserver.EndpointInfo
+	SetRouteHealth(endpointID string, health map[string]*restserver.RouteHealth, event restserver.RouteHealthEvent) error
+}
+
+// Config of the monitor.
+type Config struct {
+	// Interval between the probes of the gateways.
+	Interval     time.Duration
+	ProbeTimeout time.Duration
+	// FailureThreshold is the number of failed probes in a row after which a gateway is unhealthy, and
+	// RecoveryThreshold the number of answered probes in a row after which it is healthy again.
+	FailureThreshold  int
+	RecoveryThreshold int
+}
+
+// Monitor probes the gateways of the default routes of the multi-NIC pods and fails their egress over between them.
+type Monitor struct {
+	cfg       Config
+	dp        Datapath
+	endpoints Endpoints
+	log       *zap.Logger
+	now       func() time.Time
+	// states of the endpoints with more than one default route
+	states map[string]*endpointState
+}
+
+// endpointState is the health of the gateways of an endpoint.
+type endpointState struct {
+	netNsPath string
+	gateways  map[string]*gatewayState // by interface name
+}
+
+// gatewayState is the health of the gateway of a default route.
+type gatewayState struct {
+	gateway    string
+	healthy    bool
+	failures   int // probes failed in a row
+	successes  int // probes answered in a row
+	metric     int
+	baseMetric int
+	lastError  string
+	lastChange time.Time
+}
+
+// New creates a monitor of the routes of endpoints.
+func New(cfg Config, dp Datapath, endpoints Endpoints, logger *zap.Logger) *Monitor {
+	return &Monitor{
+		cfg:       cfg,
+		dp:        dp,
+		endpoints: endpoints,
+		log:       logger,
+		now:       time.Now,
+		states:    make(map[string]*endpointState),
+	}
+}
+
+// Run probes the gateways of the endpoints every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check probes the gateways of all the multi-NIC endpoints, and forgets the endpoints which are gone.
+func (m *Monitor) check(ctx context.Context) {
+	endpoints := m.endpoints.ListEndpoints()
+	for endpointID := range m.states {
+		if endpoint, ok := endpoints[endpointID]; !ok || netNsPath(endpoint) == "" {
+			delete(m.states, endpointID)
+		}
+	}
+	for endpointID, endpointInfo := range endpoints {
+		if ctx.Err() != nil {
+			return
+		}
+		nsPath := netNsPath(endpointInfo)
+		if nsPath == "" {
+			continue
+		}
+		if err := m.checkEndpoint(endpointID, endpointInfo, nsPath); err != nil {
+			m.log.Error("Failed to check the default routes of endpoint", zap.String("endpointID", endpointID), zap.Error(err))
+		}
+	}
+}
+
+// netNsPath returns the network namespace of a multi-NIC endpoint, empty for the other endpoints.
+func netNsPath(endpointInfo *restserver.EndpointInfo) string {
+	if len(endpointInfo.IfnameToIPMap) < 2 { //nolint:gomnd // multiple interfaces
+		return ""
+	}
+	for _, ipInfo := range endpointInfo.IfnameToIPMap {
+		if ipInfo.NetNsPath != "" {
+			return ipInfo.NetNsPath
+		}
+	}
+	return ""
+}
+
+// checkEndpoint probes the gateways of the default routes of the endpoint, orders the routes by the health of their
+// gateways and records the changes.
+func (m *Monitor) checkEndpoint(endpointID string, endpointInfo *restserver.EndpointInfo, nsPath string) error {
+	routes, err := m.dp.DefaultRoutes(nsPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to list default routes")
+	}
+	if len(routes) < 2 { //nolint:gomnd // multiple default routes
+		delete(m.states, endpointID)
+		return nil
+	}
+	state := m.syncState(endpointID, endpointInfo, nsPath, routes)
+
+	probeErrs := make([]error, len(routes))
+	var wg sync.WaitGroup
+	for i := range routes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			probeErrs[i] = m.dp.Probe(nsPath, routes[i], m.cfg.ProbeTimeout)
+		}(i)
+	}
+	wg.Wait()
+
+	now := m.now()
+	var (
+		messages []string
+		event    = restserver.RouteHealthEvent{Type: corev1.EventTypeNormal}
+	)
+	for i, route := range routes {
+		gw := state.gateways[route.IfName]
+		if probeErrs[i] == nil {
+			gw.failures, gw.successes = 0, gw.successes+1
+			if !gw.healthy && gw.successes >= m.cfg.RecoveryThreshold {
+				gw.healthy, gw.lastError, gw.lastChange = true, "", now
+				messages = append(messages, fmt.Sprintf("gateway %s via %s recovered", gw.gateway, route.IfName))
+				event.Reason = reasonGatewayRecovered
+			}
+			continue
+		}
+		gw.successes, gw.failures = 0, gw.failures+1
+		if gw.healthy && gw.failures >= m.cfg.FailureThreshold {
+			gw.healthy, gw.lastError, gw.lastChange = false, probeErrs[i].Error(), now
+			messages = append(messages, fmt.Sprintf("gateway %s via %s is unhealthy: %v", gw.gateway, route.IfName, probeErrs[i]))
+			event.Type, event.Reason = corev1.EventTypeWarning, reasonGatewayUnhealthy
+		}
+	}
+
+	current := make(map[string]int, len(routes))
+	for _, route := range routes {
+		current[route.IfName] = route.Metric
+	}
+	desired := state.metrics()
+	if !maps.Equal(current, desired) {
+		if err := m.dp.SetMetrics(nsPath, desired); err != nil {
+			// the routes are ordered again on the next check, the transitions are recorded meanwhile
+			if len(messages) == 0 {
+				return errors.Wrap(err, "failed to change the metrics of the default routes")
+			}
+			messages = append(messages, fmt.Sprintf("failed to change the metrics of the default routes: %v", err))
+			event.Type = corev1.EventTypeWarning
+		} else {
+			for ifName, metric := range desired {
+				state.gateways[ifName].metric = metric
+			}
+			messages = append(messages, "egress moved to the default route via "+state.primary())
+			event.Reason = reasonDefaultRouteFailover
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	event.Message = strings.Join(messages, ", ")
+	m.log.Info("Default routes of endpoint changed", zap.String("endpointID", endpointID), zap.String("change", event.Message))
+	health := make(map[string]*restserver.RouteHealth, len(state.gateways))
+	for ifName, gw := range state.gateways {
+		health[ifName] = &restserver.RouteHealth{
+			Gateway:        gw.gateway,
+			Healthy:        gw.healthy,
+			Metric:         gw.metric,
+			BaseMetric:     gw.baseMetric,
+			LastError:      gw.lastError,
+			LastTransition: gw.lastChange,
+		}
+	}
+	return errors.Wrap(m.endpoints.SetRouteHealth(endpointID, health, event), "failed to record route health")
+}
+
+// syncState returns the state of the endpoint with a gateway for each of the routes. The state of a new gateway is
+// the one recorded on the endpoint, so that the metrics the routes had before a failover are known after a restart.
+func (m *Monitor) syncState(endpointID string, endpointInfo *restserver.EndpointInfo, nsPath string, routes []Route) *endpointState {
+	state, ok := m.states[endpointID]
+	if !ok || state.netNsPath != nsPath {
+		state = &endpointState{netNsPath: nsPath, gateways: make(map[string]*gatewayState)}
+		m.states[endpointID] = state
+	}
+	seen := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		seen[route.IfName] = true
+		gateway := route.Gateway.String()
+		if gw, ok := state.gateways[route.IfName]; ok && gw.gateway == gateway {
+			gw.metric = route.Metric
+			continue
+		}
+		gw := &gatewayState{gateway: gateway, healthy: true, metric: route.Metric, baseMetric: route.Metric}
+		if ipInfo, ok := endpointInfo.IfnameToIPMap[route.IfName]; ok && ipInfo.RouteHealth != nil && ipInfo.RouteHealth.Gateway == gateway {
+			recorded := ipInfo.RouteHealth
+			gw.healthy, gw.baseMetric, gw.lastError, gw.lastChange = recorded.Healthy, recorded.BaseMetric, recorded.LastError, recorded.LastTransition
+		}
+		state.gateways[route.IfName] = gw
+	}
+	for ifName := range state.gateways {
+		if !seen[ifName] {
+			delete(state.gateways, ifName)
+		}
+	}
+	return state
+}
+
+// metrics returns the metrics of the routes which put the routes via the healthy gateways first, in the order of their
+// base metrics, then the ones via the unhealthy gateways. The routes have their base metrics back when all the
+// gateways are healthy, and keep their metrics when none is.
+func (s *endpointState) metrics() map[string]int {
+	ifNames := slices.Collect(maps.Keys(s.gateways))
+	slices.SortFunc(ifNames, func(a, b string) int {
+		if d := s.gateways[a].baseMetric - s.gateways[b].baseMetric; d != 0 {
+			return d
+		}
+		return strings.Compare(a, b)
+	})
+	metrics := make(map[string]int, len(ifNames))
+	bases := make([]int, len(ifNames))
+	anyHealthy, allHealthy := false, true
+	for i, ifName := range ifNames {
+		gw := s.gateways[ifName]
+		metrics[ifName] = gw.metric
+		// routes with the same base metric are told apart, so that their order is the one given here
+		bases[i] = gw.baseMetric
+		if i > 0 && bases[i] <= bases[i-1] {
+			bases[i] = bases[i-1] + 1
+		}
+		anyHealthy = anyHealthy || gw.healthy
+		allHealthy = allHealthy && gw.healthy
+	}
+	if !anyHealthy {
+		return metrics
+	}
+	if allHealthy {
+		for ifName, gw := range s.gateways {
+			metrics[ifName] = gw.baseMetric
+		}
+		return metrics
+	}
+
+	ordered := make([]string, 0, len(ifNames))
+	for _, ifName := range ifNames {
+		if s.gateways[ifName].healthy {
+			ordered = append(ordered, ifName)
+		}
+	}
+	for _, ifName := range ifNames {
+		if !s.gateways[ifName].healthy {
+			ordered = append(ordered, ifName)
+		}
+	}
+	for i, ifName := range ordered {
+		metrics[ifName] = bases[i]
+	}
+	return metrics
+}
+
+// primary returns the interface of the route with the lowest metric.
+func (s *endpointState) primary() string {
+	primary := ""
+	for ifName, gw := range s.gateways {
+		if primary == "" || gw.metric < s.gateways[primary].metric || (gw.metric == s.gateways[primary].metric && ifName < primary) {
+			primary = ifName
+		}
+	}
+	return primary
+}
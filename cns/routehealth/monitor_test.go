@@ -0,0 +1,200 @@
+package routehealth
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testNetNs = "/var/run/netns/pod1"
+
+var errNoReply = errors.New("no reply")
+
+// fakeDatapath holds the default routes of a single netns, whose gateways answer unless down.
+type fakeDatapath struct {
+	sync.Mutex
+	routes []Route
+	down   map[string]bool
+	probes map[string]int
+}
+
+func (f *fakeDatapath) DefaultRoutes(netNsPath string) ([]Route, error) {
+	f.Lock()
+	defer f.Unlock()
+	if netNsPath != testNetNs {
+		return nil, nil
+	}
+	return append([]Route(nil), f.routes...), nil
+}
+
+func (f *fakeDatapath) Probe(_ string, route Route, _ time.Duration) error {
+	f.Lock()
+	defer f.Unlock()
+	f.probes[route.IfName]++
+	if f.down[route.IfName] {
+		return errNoReply
+	}
+	return nil
+}
+
+func (f *fakeDatapath) SetMetrics(_ string, metrics map[string]int) error {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.routes {
+		if metric, ok := metrics[f.routes[i].IfName]; ok {
+			f.routes[i].Metric = metric
+		}
+	}
+	return nil
+}
+
+func (f *fakeDatapath) metrics() map[string]int {
+	f.Lock()
+	defer f.Unlock()
+	metrics := map[string]int{}
+	for _, route := range f.routes {
+		metrics[route.IfName] = route.Metric
+	}
+	return metrics
+}
+
+// fakeEndpoints records the route health set on the endpoints.
+type fakeEndpoints struct {
+	endpoints map[string]*restserver.EndpointInfo
+	events    []restserver.RouteHealthEvent
+}
+
+func (f *fakeEndpoints) ListEndpoints() map[string]*restserver.EndpointInfo {
+	return f.endpoints
+}
+
+func (f *fakeEndpoints) SetRouteHealth(endpointID string, health map[string]*restserver.RouteHealth, event restserver.RouteHealthEvent) error {
+	for ifName, routeHealth := range health {
+		f.endpoints[endpointID].IfnameToIPMap[ifName].RouteHealth = routeHealth
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func newTestMonitor() (*Monitor, *fakeDatapath, *fakeEndpoints) {
+	dp := &fakeDatapath{
+		routes: []Route{
+			{IfName: "eth0", Gateway: net.ParseIP("169.254.1.1"), Metric: 100},
+			{IfName: "eth1", Gateway: net.ParseIP("10.1.0.1"), Metric: 200},
+		},
+		down:   map[string]bool{},
+		probes: map[string]int{},
+	}
+	endpoints := &fakeEndpoints{endpoints: map[string]*restserver.EndpointInfo{
+		"ep1": {IfnameToIPMap: map[string]*restserver.IPInfo{
+			"eth0": {},
+			"eth1": {NetNsPath: testNetNs},
+		}},
+		// single NIC endpoints aren't probed
+		"ep2": {IfnameToIPMap: map[string]*restserver.IPInfo{"eth0": {NetNsPath: "/var/run/netns/pod2"}}},
+	}}
+	m := New(Config{Interval: time.Second, ProbeTimeout: time.Second, FailureThreshold: 2, RecoveryThreshold: 2}, dp, endpoints, zap.NewNop())
+	return m, dp, endpoints
+}
+
+func TestFailoverAndBack(t *testing.T) {
+	m, dp, endpoints := newTestMonitor()
+	ctx := context.Background()
+
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 1, "eth1": 1}, dp.probes)
+	assert.Empty(t, endpoints.events)
+
+	// a single failed probe doesn't fail over
+	dp.down["eth0"] = true
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 100, "eth1": 200}, dp.metrics())
+	assert.Empty(t, endpoints.events)
+
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 200, "eth1": 100}, dp.metrics())
+	require.Len(t, endpoints.events, 1)
+	assert.Equal(t, corev1.EventTypeWarning, endpoints.events[0].Type)
+	assert.Equal(t, reasonDefaultRouteFailover, endpoints.events[0].Reason)
+	assert.Equal(t, "gateway 169.254.1.1 via eth0 is unhealthy: no reply, egress moved to the default route via eth1",
+		endpoints.events[0].Message)
+	eth0 := endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].RouteHealth
+	assert.False(t, eth0.Healthy)
+	assert.Equal(t, 200, eth0.Metric)
+	assert.Equal(t, 100, eth0.BaseMetric)
+	assert.Equal(t, "no reply", eth0.LastError)
+
+	// the failed over routes stay while the gateway is down
+	m.check(ctx)
+	assert.Len(t, endpoints.events, 1)
+
+	dp.down["eth0"] = false
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 200, "eth1": 100}, dp.metrics())
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 100, "eth1": 200}, dp.metrics())
+	require.Len(t, endpoints.events, 2)
+	assert.Equal(t, corev1.EventTypeNormal, endpoints.events[1].Type)
+	assert.Equal(t, "gateway 169.254.1.1 via eth0 recovered, egress moved to the default route via eth0", endpoints.events[1].Message)
+	assert.True(t, endpoints.endpoints["ep1"].IfnameToIPMap["eth0"].RouteHealth.Healthy)
+}
+
+func TestNoHealthyGateway(t *testing.T) {
+	m, dp, endpoints := newTestMonitor()
+	ctx := context.Background()
+
+	dp.down["eth0"], dp.down["eth1"] = true, true
+	m.check(ctx)
+	m.check(ctx)
+	// the routes are left as they are
+	assert.Equal(t, map[string]int{"eth0": 100, "eth1": 200}, dp.metrics())
+	require.Len(t, endpoints.events, 1)
+	assert.Equal(t, reasonGatewayUnhealthy, endpoints.events[0].Reason)
+
+	dp.down["eth1"] = false
+	m.check(ctx)
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 200, "eth1": 100}, dp.metrics())
+}
+
+func TestRecordedStateAfterRestart(t *testing.T) {
+	m, dp, endpoints := newTestMonitor()
+	ctx := context.Background()
+
+	dp.down["eth0"] = true
+	m.check(ctx)
+	m.check(ctx)
+	require.Equal(t, map[string]int{"eth0": 200, "eth1": 100}, dp.metrics())
+
+	// a new monitor knows the metrics the routes had before the failover
+	m = New(m.cfg, dp, endpoints, zap.NewNop())
+	m.check(ctx)
+	m.check(ctx)
+	assert.Len(t, endpoints.events, 1)
+	dp.down["eth0"] = false
+	m.check(ctx)
+	m.check(ctx)
+	assert.Equal(t, map[string]int{"eth0": 100, "eth1": 200}, dp.metrics())
+}
+
+func TestMetrics(t *testing.T) {
+	state := &endpointState{gateways: map[string]*gatewayState{
+		"eth0": {healthy: false, metric: 0, baseMetric: 0},
+		"eth1": {healthy: true, metric: 0, baseMetric: 0},
+		"eth2": {healthy: true, metric: 0, baseMetric: 0},
+	}}
+	// routes of the same base metric are ordered by interface
+	assert.Equal(t, map[string]int{"eth0": 2, "eth1": 0, "eth2": 1}, state.metrics())
+
+	state.gateways["eth0"].healthy = true
+	assert.Equal(t, map[string]int{"eth0": 0, "eth1": 0, "eth2": 0}, state.metrics())
+}
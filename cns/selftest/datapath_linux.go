@@ -0,0 +1,243 @@
+package selftest
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	netnsName    = "azure-cns-selftest"
+	hostVethName = "azvselftest"
+	podVethName  = "azvselftestp"
+	podIfName    = "eth0"
+	// the pod reaches the host through the same virtual gateway as the pods of the transparent mode
+	virtualGatewayIP = "169.254.1.1"
+)
+
+// netnsDatapath plumbs the fake pod in a scratch network namespace, connected to the host with a veth pair and routed
+// like a pod of the transparent mode.
+type netnsDatapath struct{}
+
+// New returns the datapath of the self-test, the hns network is only used on windows.
+func New(string) Datapath {
+	return netnsDatapath{}
+}
+
+func (netnsDatapath) Run(ctx context.Context, podIPInfo *cns.PodIpInfo) error {
+	podIP := net.ParseIP(podIPInfo.PodIPConfig.IPAddress).To4()
+	if podIP == nil {
+		return errors.Errorf("self-test pod ip %s is not an ipv4 address", podIPInfo.PodIPConfig.IPAddress)
+	}
+
+	// remove the leftovers of an interrupted run first
+	cleanup()
+	defer cleanup()
+
+	ns, err := plumb(podIP)
+	if err != nil {
+		return errors.Wrap(err, "failed to plumb the self-test pod")
+	}
+	defer ns.Close()
+
+	return inNetns(ns, func() error {
+		if gateway := net.ParseIP(podIPInfo.NetworkContainerPrimaryIPConfig.GatewayIPAddress); gateway != nil {
+			if err := probeGateway(ctx, gateway); err != nil {
+				return err
+			}
+		}
+		for _, server := range dnsServers(podIPInfo) {
+			if err := probeDNS(ctx, net.JoinHostPort(server, dnsPort)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// plumb creates the network namespace of the fake pod with the pod ip, and routes the ip to it from the host.
+func plumb(podIP net.IP) (ns netns.NsHandle, err error) {
+	if ns, err = newNamedNetns(); err != nil {
+		return netns.None(), err
+	}
+	defer func() {
+		if err != nil {
+			ns.Close()
+		}
+	}()
+
+	if err := netlink.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: hostVethName}, PeerName: podVethName}); err != nil {
+		return ns, errors.Wrap(err, "failed to create veth pair")
+	}
+	hostVeth, err := netlink.LinkByName(hostVethName)
+	if err != nil {
+		return ns, errors.Wrap(err, "failed to get host veth")
+	}
+	podVeth, err := netlink.LinkByName(podVethName)
+	if err != nil {
+		return ns, errors.Wrap(err, "failed to get pod veth")
+	}
+	if err := netlink.LinkSetNsFd(podVeth, int(ns)); err != nil {
+		return ns, errors.Wrap(err, "failed to move pod veth to the netns")
+	}
+	if err := netlink.LinkSetUp(hostVeth); err != nil {
+		return ns, errors.Wrap(err, "failed to set host veth up")
+	}
+	podRoute := &netlink.Route{
+		LinkIndex: hostVeth.Attrs().Index,
+		Scope:     netlink.SCOPE_LINK,
+		Dst:       &net.IPNet{IP: podIP, Mask: net.CIDRMask(32, 32)}, //nolint:gomnd // host route
+	}
+	if err := netlink.RouteReplace(podRoute); err != nil {
+		return ns, errors.Wrap(err, "failed to route the pod ip to the host veth")
+	}
+
+	return ns, plumbPod(ns, podIP, hostVeth.Attrs().HardwareAddr)
+}
+
+// plumbPod configures the interface of the fake pod and its default route through the virtual gateway.
+func plumbPod(ns netns.NsHandle, podIP net.IP, hostMac net.HardwareAddr) error {
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return errors.Wrap(err, "failed to get netlink handle of the netns")
+	}
+	defer handle.Close()
+
+	podVeth, err := handle.LinkByName(podVethName)
+	if err != nil {
+		return errors.Wrap(err, "failed to get pod veth in the netns")
+	}
+	if err := handle.LinkSetName(podVeth, podIfName); err != nil {
+		return errors.Wrap(err, "failed to rename pod veth")
+	}
+	if err := handle.AddrAdd(podVeth, &netlink.Addr{IPNet: &net.IPNet{IP: podIP, Mask: net.CIDRMask(32, 32)}}); err != nil { //nolint:gomnd // host address
+		return errors.Wrap(err, "failed to add the pod ip")
+	}
+	if err := handle.LinkSetUp(podVeth); err != nil {
+		return errors.Wrap(err, "failed to set pod veth up")
+	}
+	if lo, err := handle.LinkByName("lo"); err == nil {
+		_ = handle.LinkSetUp(lo)
+	}
+
+	gatewayIP := net.ParseIP(virtualGatewayIP)
+	if err := handle.NeighAdd(&netlink.Neigh{
+		LinkIndex:    podVeth.Attrs().Index,
+		IP:           gatewayIP,
+		HardwareAddr: hostMac,
+		State:        netlink.NUD_PERMANENT,
+	}); err != nil {
+		return errors.Wrap(err, "failed to add the virtual gateway neighbor")
+	}
+	if err := handle.RouteAdd(&netlink.Route{
+		LinkIndex: podVeth.Attrs().Index,
+		Scope:     netlink.SCOPE_LINK,
+		Dst:       &net.IPNet{IP: gatewayIP, Mask: net.CIDRMask(32, 32)}, //nolint:gomnd // host route
+	}); err != nil {
+		return errors.Wrap(err, "failed to route the virtual gateway")
+	}
+	if err := handle.RouteAdd(&netlink.Route{LinkIndex: podVeth.Attrs().Index, Gw: gatewayIP}); err != nil {
+		return errors.Wrap(err, "failed to add the default route")
+	}
+	return nil
+}
+
+// newNamedNetns creates the named network namespace without moving the calling thread to it.
+func newNamedNetns() (netns.NsHandle, error) {
+	var ns netns.NsHandle
+	err := inNetns(netns.None(), func() error {
+		var err error
+		ns, err = netns.NewNamed(netnsName)
+		return errors.Wrap(err, "failed to create the netns")
+	})
+	return ns, err
+}
+
+// inNetns calls f on a thread in the network namespace, or in the namespace f moves the thread to for netns.None().
+func inNetns(ns netns.NsHandle, f func() error) error {
+	runtime.LockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return errors.Wrap(err, "failed to get the host netns")
+	}
+	defer origin.Close()
+
+	if ns != netns.None() {
+		if err := netns.Set(ns); err != nil {
+			runtime.UnlockOSThread()
+			return errors.Wrap(err, "failed to enter the netns")
+		}
+	}
+	fErr := f()
+	if err := netns.Set(origin); err != nil {
+		// the thread is left locked so that it exits with the goroutine instead of running others in the netns
+		return errors.Wrap(err, "failed to return to the host netns")
+	}
+	runtime.UnlockOSThread()
+	return fErr
+}
+
+// probeGateway pings the gateway from the network namespace of the calling thread.
+func probeGateway(ctx context.Context, gateway net.IP) error {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return errors.Wrap(err, "failed to open icmp socket")
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second) //nolint:gomnd // default timeout
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return errors.Wrap(err, "failed to set deadline")
+	}
+
+	id := os.Getpid() & 0xffff //nolint:gomnd // icmp echo id is 16 bits
+	echo := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: 1, Data: []byte(netnsName)}}
+	packed, err := echo.Marshal(nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal icmp echo")
+	}
+	if _, err := conn.WriteTo(packed, &net.IPAddr{IP: gateway}); err != nil {
+		return errors.Wrapf(ErrProbeFailed, "failed to ping gateway %s: %v", gateway, err)
+	}
+
+	buf := make([]byte, 1500) //nolint:gomnd // mtu
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return errors.Wrapf(ErrProbeFailed, "no reply from gateway %s: %v", gateway, err)
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n]) //nolint:gomnd // icmp protocol number
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply || peer.String() != gateway.String() {
+			continue
+		}
+		if body, ok := reply.Body.(*icmp.Echo); ok && body.ID == id {
+			return nil
+		}
+	}
+}
+
+// cleanup removes the veth pair and the network namespace of the fake pod.
+func cleanup() {
+	if link, err := netlink.LinkByName(hostVethName); err == nil {
+		if err := netlink.LinkDel(link); err != nil {
+			logger.Errorf("[selftest] Failed to delete host veth %s: %v", hostVethName, err)
+		}
+	}
+	if err := netns.DeleteNamed(netnsName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("[selftest] Failed to delete netns %s: %v", netnsName, err)
+	}
+}
@@ -0,0 +1,67 @@
+package selftest
+
+import (
+	"context"
+	"net"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+)
+
+const hnsEndpointName = "azure-cns-selftest"
+
+// hnsDatapath creates and deletes an hns endpoint for the fake pod in the hns network of the pods. The probes are not
+// run on windows, the host can't send from the compartment of an endpoint without a container.
+type hnsDatapath struct {
+	networkName string
+}
+
+// New returns the datapath of the self-test, creating the endpoint of the fake pod in the hns network.
+func New(hnsNetworkName string) Datapath {
+	return hnsDatapath{networkName: hnsNetworkName}
+}
+
+func (d hnsDatapath) Run(_ context.Context, podIPInfo *cns.PodIpInfo) error {
+	if net.ParseIP(podIPInfo.PodIPConfig.IPAddress) == nil {
+		return errors.Errorf("invalid self-test pod ip %s", podIPInfo.PodIPConfig.IPAddress)
+	}
+
+	// remove the leftover of an interrupted run first
+	deleteEndpoint()
+
+	network, err := hcn.GetNetworkByName(d.networkName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get hns network %s", d.networkName)
+	}
+	endpoint := &hcn.HostComputeEndpoint{
+		Name:               hnsEndpointName,
+		HostComputeNetwork: network.Id,
+		IpConfigurations: []hcn.IpConfig{
+			{IpAddress: podIPInfo.PodIPConfig.IPAddress, PrefixLength: podIPInfo.PodIPConfig.PrefixLength},
+		},
+		SchemaVersion: hcn.SchemaVersion{Major: 2, Minor: 0}, //nolint:gomnd // hcn schema version
+	}
+	created, err := endpoint.Create()
+	if err != nil {
+		return errors.Wrapf(ErrProbeFailed, "failed to create hns endpoint in network %s: %v", d.networkName, err)
+	}
+	defer deleteEndpoint()
+
+	if _, err := hcn.GetEndpointByID(created.Id); err != nil {
+		return errors.Wrapf(ErrProbeFailed, "hns endpoint %s not found after its creation: %v", created.Id, err)
+	}
+	return nil
+}
+
+// deleteEndpoint deletes the hns endpoint of the fake pod if it exists.
+func deleteEndpoint() {
+	endpoint, err := hcn.GetEndpointByName(hnsEndpointName)
+	if err != nil {
+		return
+	}
+	if err := endpoint.Delete(); err != nil {
+		logger.Errorf("[selftest] Failed to delete hns endpoint %s: %v", endpoint.Id, err)
+	}
+}
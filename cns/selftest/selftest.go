@@ -0,0 +1,76 @@
+// Package selftest plumbs the endpoint of a fake pod and probes the datapath of the node from it, so that a broken
+// node is caught before real pods are scheduled on it.
+package selftest
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// azureDNS is probed when the NC has no dns servers.
+	azureDNS = "168.63.129.16"
+	dnsPort  = "53"
+)
+
+// ErrProbeFailed is returned when the fake pod can't reach its gateway or dns servers.
+var ErrProbeFailed = errors.New("self-test probe failed")
+
+// Datapath plumbs an endpoint with the IP of the fake pod, probes the datapath from it, and removes it.
+type Datapath interface {
+	Run(ctx context.Context, podIPInfo *cns.PodIpInfo) error
+}
+
+// dnsServers returns the dns servers of the NC of the pod IP.
+func dnsServers(podIPInfo *cns.PodIpInfo) []string {
+	if len(podIPInfo.NetworkContainerPrimaryIPConfig.DNSServers) > 0 {
+		return podIPInfo.NetworkContainerPrimaryIPConfig.DNSServers
+	}
+	return []string{azureDNS}
+}
+
+// probeDNS queries the dns server at the address for the root name servers. The socket is created in the network
+// namespace of the calling thread.
+func probeDNS(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to dial dns server %s", address)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return errors.Wrap(err, "failed to set deadline")
+		}
+	}
+
+	id := uint16(time.Now().UnixNano())
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("."), Type: dnsmessage.TypeNS, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return errors.Wrap(err, "failed to pack dns query")
+	}
+	if _, err := conn.Write(packed); err != nil {
+		return errors.Wrapf(ErrProbeFailed, "failed to send dns query to %s: %v", address, err)
+	}
+
+	buf := make([]byte, 512) //nolint:gomnd // max udp dns message without edns
+	n, err := conn.Read(buf)
+	if err != nil {
+		return errors.Wrapf(ErrProbeFailed, "no dns response from %s: %v", address, err)
+	}
+	var parser dnsmessage.Parser
+	header, err := parser.Start(buf[:n])
+	if err != nil || !header.Response || header.ID != id {
+		return errors.Wrapf(ErrProbeFailed, "invalid dns response from %s", address)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package selftest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers the queries it gets with an empty response, or drops them.
+func serveDNS(t *testing.T, answer bool) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || !answer {
+				continue
+			}
+			query.Header.Response = true
+			resp, _ := query.Pack()
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestProbeDNS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, probeDNS(ctx, serveDNS(t, true)))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, probeDNS(ctx, serveDNS(t, false)), ErrProbeFailed)
+}
+
+func TestDNSServers(t *testing.T) {
+	assert.Equal(t, []string{azureDNS}, dnsServers(&cns.PodIpInfo{}))
+
+	podIPInfo := &cns.PodIpInfo{}
+	podIPInfo.NetworkContainerPrimaryIPConfig.DNSServers = []string{"10.0.0.10"}
+	assert.Equal(t, []string{"10.0.0.10"}, dnsServers(podIPInfo))
+}
@@ -8,8 +8,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"runtime"
@@ -19,6 +21,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
+	cniclient "github.com/Azure/azure-container-networking/cni/client"
 	"github.com/Azure/azure-container-networking/cns"
 	cnsclient "github.com/Azure/azure-container-networking/cns/client"
 	cnscli "github.com/Azure/azure-container-networking/cns/cmd/cli"
@@ -26,7 +29,11 @@ import (
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/cns/deviceplugin"
+	"github.com/Azure/azure-container-networking/cns/dnsproxy"
+	"github.com/Azure/azure-container-networking/cns/dnsregistration"
+	"github.com/Azure/azure-container-networking/cns/endpointhealth"
 	"github.com/Azure/azure-container-networking/cns/endpointmanager"
+	"github.com/Azure/azure-container-networking/cns/flowlog"
 	"github.com/Azure/azure-container-networking/cns/fsnotify"
 	"github.com/Azure/azure-container-networking/cns/grpc"
 	"github.com/Azure/azure-container-networking/cns/healthserver"
@@ -37,6 +44,7 @@ import (
 	ipampoolv2 "github.com/Azure/azure-container-networking/cns/ipampool/v2"
 	cssctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/clustersubnetstate"
 	mtpncctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/multitenantpodnetworkconfig"
+	nsipbctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/namespaceipblock"
 	nncctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/nodenetworkconfig"
 	podctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/pod"
 	"github.com/Azure/azure-container-networking/cns/logger"
@@ -45,11 +53,16 @@ import (
 	"github.com/Azure/azure-container-networking/cns/middlewares"
 	"github.com/Azure/azure-container-networking/cns/multitenantcontroller"
 	"github.com/Azure/azure-container-networking/cns/multitenantcontroller/multitenantoperator"
+	"github.com/Azure/azure-container-networking/cns/nodeconditions"
 	"github.com/Azure/azure-container-networking/cns/restserver"
 	restserverv2 "github.com/Azure/azure-container-networking/cns/restserver/v2"
+	"github.com/Azure/azure-container-networking/cns/routehealth"
+	"github.com/Azure/azure-container-networking/cns/selftest"
 	cnipodprovider "github.com/Azure/azure-container-networking/cns/stateprovider/cni"
 	cnspodprovider "github.com/Azure/azure-container-networking/cns/stateprovider/cns"
 	cnstypes "github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/cns/vxlan"
+	"github.com/Azure/azure-container-networking/cns/wireguard"
 	"github.com/Azure/azure-container-networking/cns/wireserver"
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/crd"
@@ -57,16 +70,20 @@ import (
 	cssv1alpha1 "github.com/Azure/azure-container-networking/crd/clustersubnetstate/api/v1alpha1"
 	"github.com/Azure/azure-container-networking/crd/multitenancy"
 	mtv1alpha1 "github.com/Azure/azure-container-networking/crd/multitenancy/api/v1alpha1"
+	nsipbv1alpha1 "github.com/Azure/azure-container-networking/crd/namespaceipblock/api/v1alpha1"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	acnfs "github.com/Azure/azure-container-networking/internal/fs"
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/network"
 	"github.com/Azure/azure-container-networking/nmagent"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/processlock"
 	localtls "github.com/Azure/azure-container-networking/server/tls"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/avast/retry-go/v4"
 	"github.com/go-logr/zapr"
 	"github.com/google/go-cmp/cmp"
@@ -80,7 +97,11 @@ import (
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	kexec "k8s.io/utils/exec"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -95,6 +116,7 @@ const (
 	name                              = "azure-cns"
 	pluginName                        = "azure-vnet"
 	endpointStoreName                 = "azure-endpoints"
+	dnsRegistrationStoreName          = "azure-cns-dns"
 	endpointStoreLocationLinux        = "/var/run/azure-cns/"
 	endpointStoreLocationWindows      = "/k/azurecns/"
 	defaultCNINetworkConfigFileName   = "10-azure.conflist"
@@ -116,6 +138,10 @@ const (
 	defaultDevicePluginMaxRetryCount = 5
 	initialVnetNICCount              = 0
 	initialIBNICCount                = 0
+	// tracingShutdownTimeout bounds the flush of the spans not exported yet on exit
+	tracingShutdownTimeout = 5 * time.Second
+	// availabilityZoneTimeout bounds the query of the zone of the node to imds, which isn't reachable off azure
+	availabilityZoneTimeout = 15 * time.Second
 )
 
 type cniConflistScenario string
@@ -307,14 +333,14 @@ var args = acn.ArgumentList{
 	{
 		Name:         acn.OptDebugCmd,
 		Shorthand:    acn.OptDebugCmdAlias,
-		Description:  "Debug flag to retrieve IPconfigs, available values: assigned, available, all",
+		Description:  "Debug command to run against a running CNS, available values: get, getPodContexts, getInMemory, getIPAMState",
 		Type:         "string",
 		DefaultValue: "",
 	},
 	{
 		Name:         acn.OptDebugArg,
 		Shorthand:    acn.OptDebugArgAlias,
-		Description:  "Argument flag to be paired with the 'debugcmd' flag.",
+		Description:  "Argument flag to be paired with the 'debugcmd' flag, the ip state for get and json for getIPAMState.",
 		Type:         "string",
 		DefaultValue: "",
 	},
@@ -592,8 +618,16 @@ func main() {
 	}
 	logger.Printf("[Azure CNS] Using config: %+v", cnsconfig)
 
+	// the spans of the requests from the plugin continue the traces of its commands
+	shutdownTracing, err := tracing.Init(rootCtx, name, cnsconfig.TracingSettings)
+	if err != nil {
+		logger.Errorf("Failed to initialize tracing, spans are not exported: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
 	_, envEnableConflistGeneration := os.LookupEnv(envVarEnableCNIConflistGeneration)
 	var conflistGenerator restserver.CNIConflistGenerator
+	var dropInGenerator *cniconflist.DropInGenerator
 	if cnsconfig.EnableCNIConflistGeneration || envEnableConflistGeneration {
 		conflistFilepath := cnsconfig.CNIConflistFilepath
 		if cniConflistFilepathArg != "" {
@@ -612,21 +646,30 @@ func main() {
 			scenarioString = cniConflistScenarioArg
 		}
 
+		var newBase func(w io.WriteCloser) cniconflist.Generator
 		switch scenario := cniConflistScenario(scenarioString); scenario {
 		case scenarioV4Overlay:
-			conflistGenerator = &cniconflist.V4OverlayGenerator{Writer: writer}
+			newBase = func(w io.WriteCloser) cniconflist.Generator { return &cniconflist.V4OverlayGenerator{Writer: w} }
 		case scenarioDualStackOverlay:
-			conflistGenerator = &cniconflist.DualStackOverlayGenerator{Writer: writer}
+			newBase = func(w io.WriteCloser) cniconflist.Generator { return &cniconflist.DualStackOverlayGenerator{Writer: w} }
 		case scenarioOverlay:
-			conflistGenerator = &cniconflist.OverlayGenerator{Writer: writer}
+			newBase = func(w io.WriteCloser) cniconflist.Generator { return &cniconflist.OverlayGenerator{Writer: w} }
 		case scenarioCilium:
-			conflistGenerator = &cniconflist.CiliumGenerator{Writer: writer}
+			newBase = func(w io.WriteCloser) cniconflist.Generator { return &cniconflist.CiliumGenerator{Writer: w} }
 		case scenarioSWIFT:
-			conflistGenerator = &cniconflist.SWIFTGenerator{Writer: writer}
+			newBase = func(w io.WriteCloser) cniconflist.Generator { return &cniconflist.SWIFTGenerator{Writer: w} }
 		default:
 			logger.Errorf("unable to generate cni conflist for unknown scenario: %s", scenario)
 			os.Exit(1)
 		}
+
+		// the drop-ins of the operator are merged into the conflist of the scenario, which is regenerated on their changes
+		if cnsconfig.CNIConflistDropInDir != "" {
+			dropInGenerator = &cniconflist.DropInGenerator{Writer: writer, Dir: cnsconfig.CNIConflistDropInDir, NewBase: newBase}
+			conflistGenerator = dropInGenerator
+		} else {
+			conflistGenerator = newBase(writer)
+		}
 	}
 
 	// Get host metadata and attach it to logger(v2) appinsights config.
@@ -786,6 +829,33 @@ func main() {
 	httpRemoteRestService.SetOption(acn.OptProgramSNATIPTables, cnsconfig.ProgramSNATIPTables)
 	httpRemoteRestService.SetOption(acn.OptManageEndpointState, cnsconfig.ManageEndpointState)
 
+	if err := httpRemoteRestService.DisableNICTypesFromConfig(cnsconfig.DisabledNICTypes); err != nil {
+		logger.Errorf("Failed to disable the NIC types of the CNS config, err:%v.\n", err)
+		return
+	}
+	if err := httpRemoteRestService.SetHostNCApipaSubnet(cnsconfig.HostNCApipaSubnet); err != nil {
+		logger.Errorf("Failed to set the host NC apipa subnet of the CNS config, err:%v.\n", err)
+		return
+	}
+	httpRemoteRestService.SetIPReleaseGracePeriod(time.Duration(cnsconfig.IPReleaseGracePeriodSecs) * time.Second)
+	if dad := cnsconfig.DuplicateAddressDetection; dad.Enable {
+		if err := httpRemoteRestService.EnableDuplicateAddressDetection(dad.Interface, time.Duration(dad.ProbeTimeoutMs)*time.Millisecond,
+			time.Duration(dad.QuarantineSecs)*time.Second, dad.IgnoredMACs); err != nil {
+			logger.Errorf("Not probing the IPs assigned to pods, err:%v", err)
+		}
+	}
+	httpRemoteRestService.SetDatapathMigrator(cniclient.New(kexec.New()))
+	if cnsconfig.EnablePodTrafficStats {
+		httpRemoteRestService.SetEndpointStatsGetter(cniclient.New(kexec.New()))
+	}
+	if cnsconfig.EnablePodFlowLogs {
+		if reader, err := flowlog.NewReader(); err != nil {
+			logger.Errorf("Failed to create the flow reader of the pod flows API, err:%v.\n", err)
+		} else {
+			httpRemoteRestService.SetFlowLogs(cniclient.New(kexec.New()), reader)
+		}
+	}
+
 	// Create default ext network if commandline option is set
 	if len(strings.TrimSpace(createDefaultExtNetworkType)) > 0 {
 		if err := hnsclient.CreateDefaultExtNetwork(createDefaultExtNetworkType); err == nil {
@@ -869,6 +939,13 @@ func main() {
 
 		logger.Printf("Set GlobalPodInfoScheme %v (InitializeFromCNI=%t)", cns.GlobalPodInfoScheme, cnsconfig.InitializeFromCNI)
 
+		// the IPs of the NCs in the zone of the node are assigned first
+		zoneCtx, cancelZone := context.WithTimeout(rootCtx, availabilityZoneTimeout)
+		if err = httpRemoteRestService.SyncAvailabilityZone(zoneCtx); err != nil {
+			logger.Errorf("Failed to sync the availability zone of the node, IPs are assigned from the NCs of any zone, err:%v", err)
+		}
+		cancelZone()
+
 		err = InitializeCRDState(rootCtx, z, httpRemoteRestService, cnsconfig)
 		if err != nil {
 			logger.Errorf("Failed to start CRD Controller, err:%v.\n", err)
@@ -979,7 +1056,7 @@ func main() {
 		}
 
 		// Initialize CNS service
-		cnsService := &grpc.CNS{Logger: z}
+		cnsService := &grpc.CNS{Logger: z, State: httpRemoteRestService}
 
 		// Create a new gRPC server
 		server, grpcErr := grpc.NewServer(settings, cnsService, z)
@@ -1050,8 +1127,8 @@ func main() {
 				z.Info("starting fsnotify watcher to process missed Pod deletes")
 				logger.Printf("starting fsnotify watcher to process missed Pod deletes")
 				var endpointCleanup fsnotify.ReleaseIPsClient = cnsclient
-				// using endpointmanager implmentation for stateless CNI sceanrio to remove HNS endpoint alongside the IPs
-				if cnsconfig.IsStalessCNIWindows() {
+				// using endpointmanager implmentation for stateless CNI sceanrio to remove HNS endpoint alongside the IPs on windows
+				if cnsconfig.IsStatelessCNI() {
 					endpointCleanup = endpointmanager.WithPlatformReleaseIPsManager(cnsclient)
 				}
 				w, err := fsnotify.New(endpointCleanup, cnsconfig.AsyncPodDeletePath, z)
@@ -1068,6 +1145,145 @@ func main() {
 		}()
 	}
 
+	if dropInGenerator != nil {
+		go func() {
+			_ = retry.Do(func() error {
+				z.Info("starting cni conflist drop-in watcher", zap.String("dir", dropInGenerator.Dir))
+				if err := dropInGenerator.Watch(rootCtx, z); err != nil && !errors.Is(err, context.Canceled) {
+					z.Error("failed to watch cni conflist drop-ins, will retry", zap.Error(err))
+					return errors.Wrap(err, "failed to watch cni conflist drop-ins, will retry")
+				}
+				return nil
+			}, retry.DelayType(retry.BackOffDelay), retry.UntilSucceeded(), retry.Context(rootCtx))
+		}()
+	}
+
+	if cnsconfig.DNSProxySettings.Enable {
+		z.Info("DNS proxy is enabled")
+		logger.Printf("DNS proxy is enabled")
+		listenIP, err := netip.ParseAddr(cnsconfig.DNSProxySettings.ListenAddress)
+		if err != nil {
+			logger.Errorf("Failed to parse DNS proxy listen address %s: %v", cnsconfig.DNSProxySettings.ListenAddress, err)
+			return
+		}
+		dnsProxy := dnsproxy.New(dnsproxy.Config{
+			ListenAddress:   netip.AddrPortFrom(listenIP, cnsconfig.DNSProxySettings.ListenPort),
+			CacheSize:       cnsconfig.DNSProxySettings.CacheSize,
+			UpstreamTimeout: time.Duration(cnsconfig.DNSProxySettings.UpstreamTimeoutMs) * time.Millisecond,
+		}, httpRemoteRestService, z)
+		go func() {
+			// the snat bridge address only exists once the first multitenant pod has been created, so keep retrying
+			_ = retry.Do(func() error {
+				if err := dnsProxy.Run(rootCtx); err != nil {
+					z.Error("failed to run dns proxy, will retry", zap.Error(err))
+					return errors.Wrap(err, "failed to run dns proxy, will retry")
+				}
+				return nil
+			}, retry.DelayType(retry.BackOffDelay), retry.MaxDelay(time.Minute), retry.UntilSucceeded(), retry.Context(rootCtx),
+				retry.RetryIf(func(err error) bool { return !errors.Is(err, dnsproxy.ErrInterceptionNotSupported) }))
+		}()
+	}
+
+	if cnsconfig.WireguardSettings.Enable {
+		z.Info("WireGuard node to node encryption is enabled")
+		logger.Printf("WireGuard node to node encryption is enabled")
+		go func() {
+			// a transient failure leaves the node without peers, pods in the wireguard mode wait for the interface
+			_ = retry.Do(func() error {
+				if err := runWireguard(rootCtx, z, &cnsconfig.WireguardSettings); err != nil {
+					z.Error("failed to run wireguard, will retry", zap.Error(err))
+					return errors.Wrap(err, "failed to run wireguard, will retry")
+				}
+				return nil
+			}, retry.DelayType(retry.BackOffDelay), retry.MaxDelay(time.Minute), retry.UntilSucceeded(), retry.Context(rootCtx),
+				retry.RetryIf(func(err error) bool { return !errors.Is(err, wireguard.ErrUnsupported) }))
+		}()
+	}
+
+	if cnsconfig.VxlanSettings.Enable {
+		z.Info("Vxlan peer sync is enabled")
+		logger.Printf("Vxlan peer sync is enabled")
+		go func() {
+			// pods in the vxlan mode only reach other nodes' pods once their peers are synced
+			_ = retry.Do(func() error {
+				if err := runVxlan(rootCtx, z, &cnsconfig.VxlanSettings); err != nil {
+					z.Error("failed to run vxlan peer sync, will retry", zap.Error(err))
+					return errors.Wrap(err, "failed to run vxlan peer sync, will retry")
+				}
+				return nil
+			}, retry.DelayType(retry.BackOffDelay), retry.MaxDelay(time.Minute), retry.UntilSucceeded(), retry.Context(rootCtx),
+				retry.RetryIf(func(err error) bool { return !errors.Is(err, vxlan.ErrUnsupported) }))
+		}()
+	}
+
+	if cnsconfig.DNSRegistrationSettings.Enable {
+		if !cnsconfig.ManageEndpointState {
+			logger.Errorf("DNS registration requires ManageEndpointState, not registering the pod records")
+		} else {
+			z.Info("DNS registration of the pod records is enabled")
+			logger.Printf("DNS registration of the pod records is enabled")
+			go func() {
+				_ = retry.Do(func() error {
+					if err := runDNSRegistration(rootCtx, z, httpRemoteRestService, &cnsconfig.DNSRegistrationSettings); err != nil {
+						z.Error("failed to run dns registration, will retry", zap.Error(err))
+						return errors.Wrap(err, "failed to run dns registration, will retry")
+					}
+					return nil
+				}, retry.DelayType(retry.BackOffDelay), retry.MaxDelay(time.Minute), retry.UntilSucceeded(), retry.Context(rootCtx),
+					retry.RetryIf(func(err error) bool { return !errors.Is(err, dnsregistration.ErrUnknownBackend) }))
+			}()
+		}
+	}
+
+	if cnsconfig.RouteHealthSettings.Enable {
+		if !cnsconfig.ManageEndpointState {
+			logger.Errorf("Route health monitor requires ManageEndpointState, not monitoring the default routes of the pods")
+		} else if datapath, err := routehealth.NewDatapath(); err != nil {
+			logger.Errorf("Not monitoring the default routes of the pods: %v", err)
+		} else {
+			z.Info("Route health monitor of the multi-NIC pods is enabled")
+			logger.Printf("Route health monitor of the multi-NIC pods is enabled")
+			rhs := &cnsconfig.RouteHealthSettings
+			monitor := routehealth.New(routehealth.Config{
+				Interval:          time.Duration(rhs.IntervalSecs) * time.Second,
+				ProbeTimeout:      time.Duration(rhs.ProbeTimeoutMs) * time.Millisecond,
+				FailureThreshold:  rhs.FailureThreshold,
+				RecoveryThreshold: rhs.RecoveryThreshold,
+			}, datapath, httpRemoteRestService, z)
+			go func() {
+				if err := monitor.Run(rootCtx); err != nil {
+					z.Error("route health monitor failed", zap.Error(err))
+				}
+			}()
+		}
+	}
+
+	if cnsconfig.EndpointHealthSettings.Enable {
+		ehs := &cnsconfig.EndpointHealthSettings
+		if !cnsconfig.ManageEndpointState {
+			logger.Errorf("Endpoint health checks require ManageEndpointState, not checking the datapath of the pods")
+		} else if datapath, err := endpointhealth.NewDatapath(); err != nil {
+			logger.Errorf("Not checking the datapath of the pods: %v", err)
+		} else if checkers, err := endpointhealth.NewCheckers(datapath, time.Duration(ehs.PingTimeoutMs)*time.Millisecond, ehs.Checks); err != nil {
+			logger.Errorf("Not checking the datapath of the pods: %v", err)
+		} else {
+			z.Info("Endpoint health checks are enabled", zap.Strings("checks", ehs.Checks), zap.Bool("repair", ehs.Repair))
+			logger.Printf("Endpoint health checks are enabled")
+			monitor := endpointhealth.New(endpointhealth.Config{
+				Interval:          time.Duration(ehs.IntervalSecs) * time.Second,
+				FailureThreshold:  ehs.FailureThreshold,
+				RecoveryThreshold: ehs.RecoveryThreshold,
+				Repair:            ehs.Repair,
+				EvictAfterRepairs: ehs.EvictAfterRepairs,
+			}, checkers, httpRemoteRestService, z)
+			go func() {
+				if err := monitor.Run(rootCtx); err != nil {
+					z.Error("endpoint health monitor failed", zap.Error(err))
+				}
+			}()
+		}
+	}
+
 	if !disableTelemetry {
 		go metric.SendHeartBeat(rootCtx, time.Minute*time.Duration(cnsconfig.TelemetrySettings.HeartBeatIntervalInMins), homeAzMonitor, cnsconfig.ChannelMode)
 		go httpRemoteRestService.SendNCSnapShotPeriodically(rootCtx, cnsconfig.TelemetrySettings.SnapshotIntervalInMins)
@@ -1116,8 +1332,36 @@ func main() {
 		httpRemoteRestService.StartNodeSubnet(rootCtx)
 	}
 
-	// mark the service as "ready"
-	close(readyCh)
+	// mark the service as "ready", once the datapath passed the self-test when it is enabled
+	if cnsconfig.SelfTestSettings.Enable && config.ChannelMode == cns.CRD {
+		go func() {
+			runSelfTest(rootCtx, z, httpRemoteRestService, &cnsconfig.SelfTestSettings)
+			close(readyCh)
+		}()
+	} else {
+		close(readyCh)
+	}
+	if cnsconfig.NodeConditionsSettings.Enable && config.ChannelMode == cns.CRD {
+		go func() {
+			_ = retry.Do(func() error {
+				if err := runNodeConditions(rootCtx, z, httpRemoteRestService, readyCh, &cnsconfig.NodeConditionsSettings); err != nil {
+					z.Error("failed to publish node conditions, will retry", zap.Error(err))
+					return errors.Wrap(err, "failed to publish node conditions, will retry")
+				}
+				return nil
+			}, retry.DelayType(retry.BackOffDelay), retry.MaxDelay(time.Minute), retry.UntilSucceeded(), retry.Context(rootCtx))
+		}()
+	}
+
+	if cnsconfig.HNSPolicyGCSettings.Enable {
+		go network.CollectStaleHnsPolicies(rootCtx, z, time.Duration(cnsconfig.HNSPolicyGCSettings.IntervalSecs)*time.Second)
+	}
+
+	if cnsconfig.HNSReattachSettings.Enable {
+		go network.WatchHnsEndpoints(rootCtx, z, time.Duration(cnsconfig.HNSReattachSettings.IntervalSecs)*time.Second,
+			cniclient.New(kexec.New()).ReattachHnsEndpoints)
+	}
+
 	// block until process exiting
 	<-rootCtx.Done()
 
@@ -1139,10 +1383,182 @@ func main() {
 		logger.Errorf("lockclient cns unlock error:%v", err)
 	}
 
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	if err = shutdownTracing(tracingCtx); err != nil {
+		logger.Errorf("Failed to flush the spans: %v", err)
+	}
+	cancelTracing()
+
 	logger.Printf("CNS exited")
 	logger.Close()
 }
 
+// runSelfTest runs the startup self-test until it passes, so that a node with a broken datapath stays unready.
+func runSelfTest(ctx context.Context, z *zap.Logger, service *restserver.HTTPRestService, sts *configuration.SelfTestSettings) {
+	z.Info("running the startup self-test")
+	datapath := selftest.New(sts.HNSNetworkName)
+	attempt := 0
+	_ = retry.Do(func() error {
+		attempt++
+		testCtx, cancel := context.WithTimeout(ctx, time.Duration(sts.TimeoutSecs)*time.Second)
+		defer cancel()
+		if err := service.RunSelfTest(testCtx, datapath); err != nil {
+			z.Error("startup self-test failed, will retry", zap.Int("attempt", attempt), zap.Error(err))
+			return errors.Wrap(err, "startup self-test failed")
+		}
+		return nil
+	}, retry.Context(ctx), retry.Delay(time.Duration(sts.RetryIntervalSecs)*time.Second), retry.DelayType(retry.FixedDelay), retry.UntilSucceeded())
+	z.Info("startup self-test passed", zap.Int("attempts", attempt))
+}
+
+// runNodeConditions publishes the network readiness conditions on the node: the IPAM readiness from the IP pool, the
+// datapath readiness from the startup self-test, and the platform's own conditions.
+func runNodeConditions(ctx context.Context, z *zap.Logger, service *restserver.HTTPRestService, readyCh <-chan any,
+	ncs *configuration.NodeConditionsSettings,
+) error {
+	kubeConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to get kubeconfig")
+	}
+	kubeConfig.UserAgent = "azure-cns-" + version
+
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to build clientset")
+	}
+
+	nodeName, err := configuration.NodeName()
+	if err != nil {
+		return errors.Wrap(err, "failed to get NodeName")
+	}
+
+	conditions := []nodeconditions.Condition{
+		{
+			Type:  nodeconditions.IPAMReady,
+			Check: func(context.Context) error { return service.CheckIPAMReady(ncs.MinAvailableIPs) },
+		},
+		{
+			Type: nodeconditions.DatapathReady,
+			Check: func(context.Context) error {
+				select {
+				case <-readyCh:
+					return nil
+				default:
+					return errors.New("the startup self-test has not passed")
+				}
+			},
+		},
+	}
+	conditions = append(conditions, nodeconditions.PlatformConditions()...)
+
+	p := nodeconditions.New(nodeconditions.Config{
+		NodeName:         nodeName,
+		Interval:         time.Duration(ncs.IntervalSecs) * time.Second,
+		FailureThreshold: ncs.FailureThreshold,
+		SuccessThreshold: ncs.SuccessThreshold,
+	}, nodeconditions.NewNodeClient(clientset), conditions, z)
+	return errors.Wrap(p.Run(ctx), "node conditions publisher failed")
+}
+
+// runWireguard brings up the node's WireGuard interface and keeps its peers in sync with the cluster's nodes.
+func runWireguard(ctx context.Context, z *zap.Logger, wgs *configuration.WireguardSettings) error {
+	kubeConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to get kubeconfig")
+	}
+	kubeConfig.UserAgent = "azure-cns-" + version
+
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to build clientset")
+	}
+
+	nodeName, err := configuration.NodeName()
+	if err != nil {
+		return errors.Wrap(err, "failed to get NodeName")
+	}
+
+	wg := wireguard.New(wireguard.Config{
+		NodeName:          nodeName,
+		InterfaceName:     wgs.InterfaceName,
+		ListenPort:        wgs.ListenPort,
+		MTU:               wgs.MTU,
+		PrivateKeyPath:    wgs.PrivateKeyPath,
+		ReconcileInterval: time.Duration(wgs.ReconcileIntervalSecs) * time.Second,
+	}, wireguard.NewNodeClient(clientset), z)
+	return errors.Wrap(wg.Run(ctx), "wireguard failed")
+}
+
+// runVxlan keeps the peers of the node's vxlan interface in sync with the cluster's nodes.
+func runVxlan(ctx context.Context, z *zap.Logger, vs *configuration.VxlanSettings) error {
+	kubeConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to get kubeconfig")
+	}
+	kubeConfig.UserAgent = "azure-cns-" + version
+
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to build clientset")
+	}
+
+	nodeName, err := configuration.NodeName()
+	if err != nil {
+		return errors.Wrap(err, "failed to get NodeName")
+	}
+
+	m := vxlan.New(vxlan.Config{
+		NodeName:          nodeName,
+		InterfaceName:     vs.InterfaceName,
+		ReconcileInterval: time.Duration(vs.ReconcileIntervalSecs) * time.Second,
+	}, vxlan.NewNodeClient(clientset), z)
+	return errors.Wrap(m.Run(ctx), "vxlan peer sync failed")
+}
+
+// runDNSRegistration registers the records of the pods with the configured backend as their endpoints come and go.
+func runDNSRegistration(ctx context.Context, z *zap.Logger, endpoints dnsregistration.Endpoints, drs *configuration.DNSRegistrationSettings) error {
+	var backend dnsregistration.Backend
+	switch drs.Backend {
+	case dnsregistration.BackendAzurePrivateDNS:
+		credOpts := azidentity.ManagedIdentityCredentialOptions{}
+		if drs.ManagedIdentityClientID != "" {
+			credOpts.ID = azidentity.ClientID(drs.ManagedIdentityClientID)
+		}
+		cred, err := azidentity.NewManagedIdentityCredential(&credOpts)
+		if err != nil {
+			return errors.Wrap(err, "failed to create managed identity credential")
+		}
+		backend = dnsregistration.NewAzurePrivateDNS(dnsregistration.AzurePrivateDNSConfig{
+			SubscriptionID:          drs.SubscriptionID,
+			ResourceGroup:           drs.ResourceGroup,
+			ResourceManagerEndpoint: drs.ResourceManagerEndpoint,
+		}, cred)
+	case dnsregistration.BackendRFC2136:
+		backend = dnsregistration.NewRFC2136(drs.RFC2136Server)
+	default:
+		return errors.Wrapf(dnsregistration.ErrUnknownBackend, "%q", drs.Backend)
+	}
+
+	lock, err := processlock.NewFileLock(platform.CNILockPath + dnsRegistrationStoreName + store.LockExtension)
+	if err != nil {
+		return errors.Wrap(err, "failed to create dns registration store lock")
+	}
+	kvs, err := store.NewJsonFileStore(acn.GetArg(acn.OptStoreFileLocation).(string)+dnsRegistrationStoreName+".json", lock, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create dns registration store")
+	}
+
+	r := dnsregistration.New(dnsregistration.Config{
+		Zone:           drs.Zone,
+		ReverseZones:   drs.ReverseZones,
+		TTL:            time.Duration(drs.TTLSecs) * time.Second,
+		RetryAttempts:  uint(drs.RetryAttempts),
+		RetryDelay:     time.Duration(drs.RetryDelayMs) * time.Millisecond,
+		ResyncInterval: time.Duration(drs.ResyncIntervalSecs) * time.Second,
+	}, backend, endpoints, kvs, z)
+	return errors.Wrap(r.Run(ctx), "dns registration failed")
+}
+
 // Poll CRD until it's set and update PluginManager
 func pollNodeInfoCRDAndUpdatePlugin(ctx context.Context, zlog *zap.Logger, pluginManager *deviceplugin.PluginManager) error {
 	kubeConfig, err := ctrl.GetConfig()
@@ -1413,6 +1829,14 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		return errors.Wrapf(err, "failed to get node %s", nodeName)
 	}
 
+	// publish the events of the rest service, such as refused ADDs, on the node
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	httpRestServiceImplementation.SetNodeEventRecorder(&nodeEventRecorder{
+		recorder: eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: name, Host: nodeName}),
+		node:     node,
+	})
+
 	// check the Node labels for Swift V2
 	if _, ok := node.Labels[configuration.LabelNodeSwiftV2]; ok {
 		cnsconfig.EnableSwiftV2 = true
@@ -1480,6 +1904,9 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 	if err = mtv1alpha1.AddToScheme(scheme); err != nil {
 		return errors.Wrap(err, "failed to add multitenantpodnetworkconfig/v1alpha1 to scheme")
 	}
+	if err = nsipbv1alpha1.AddToScheme(scheme); err != nil {
+		return errors.Wrap(err, "failed to add namespaceipblock/v1alpha1 to scheme")
+	}
 
 	// Set Selector options on the Manager cache which are used
 	// to perform *server-side* filtering of the cached objects. This is very important
@@ -1550,6 +1977,7 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		}
 		poolMonitor = ipampool.NewMonitor(httpRestServiceImplementation, cachedscopedcli, cssCh, &poolOpts)
 	}
+	httpRestServiceImplementation.SetIPAMPoolMonitor(poolMonitor)
 
 	// Start building the NNC Reconciler
 
@@ -1572,6 +2000,14 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		}
 	}
 
+	if cnsconfig.EnableNamespaceIPBlocks {
+		// NamespaceIPBlock reconciler
+		nsipbReconciler := nsipbctrl.New(z, httpRestServiceImplementation)
+		if err := nsipbReconciler.SetupWithManager(manager); err != nil {
+			return errors.Wrapf(err, "failed to setup namespaceipblock reconciler with manager")
+		}
+	}
+
 	// TODO: add pod listeners based on Swift V1 vs MT/V2 configuration
 	if cnsconfig.WatchPods {
 		pw := podctrl.New(z)
@@ -1690,6 +2126,16 @@ func getPodInfoByIPProvider(
 	return podInfoByIPProvider, nil
 }
 
+// nodeEventRecorder publishes events on the node through an event recorder.
+type nodeEventRecorder struct {
+	recorder record.EventRecorder
+	node     *corev1.Node
+}
+
+func (r *nodeEventRecorder) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	r.recorder.Eventf(r.node, eventtype, reason, messageFmt, args...)
+}
+
 // createOrUpdateNodeInfoCRD polls imds to learn the VM Unique ID and then creates or updates the NodeInfo CRD
 // with that vm unique ID
 func createOrUpdateNodeInfoCRD(ctx context.Context, restConfig *rest.Config, node *corev1.Node) error {
@@ -18,9 +18,13 @@ func New() (cns.PodInfoByIPProvider, error) {
 
 func podInfoProvider(exec kexec.Interface) (cns.PodInfoByIPProvider, error) {
 	cli := client.New(exec)
-	state, err := cli.GetEndpointState()
+	// the cni rebuilds its state from the dataplane when it was lost, so that the ips of the pods still running are
+	// not released. The cni versions without the recovery only dump their state.
+	state, err := cli.RecoverEndpointState()
 	if err != nil {
-		return nil, fmt.Errorf("failed to invoke CNI client.GetEndpointState(): %w", err)
+		if state, err = cli.GetEndpointState(); err != nil {
+			return nil, fmt.Errorf("failed to invoke CNI client.GetEndpointState(): %w", err)
+		}
 	}
 	return cns.PodInfoByIPProviderFunc(func() (map[string]cns.PodInfo, error) {
 		return cniStateToPodInfoByIP(state)
@@ -61,6 +61,20 @@ func TestNewCNIPodInfoProvider(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "cni without recovery",
+			exec: testutils.GetFakeExecWithScripts([]testutils.TestCmd{
+				{Cmd: []string{"/opt/cni/bin/azure-vnet"}, Stdout: "unknown CNI_COMMAND: RECOVER_ENDPOINT_STATE", ExitCode: 1},
+				{Cmd: []string{"/opt/cni/bin/azure-vnet"}, Stdout: `{"ContainerInterfaces":{"3f813b02-eth0":{"PodName":"metrics-server-77c8679d7d-6ksdh",
+				"IfName":"eth0","PodNamespace":"kube-system","PodEndpointID":"3f813b02-eth0",
+				"ContainerID":"3f813b029429b4e41a09ab33b6f6d365d2ed704017524c78d1d0dece33cdaf46",
+				"IPAddresses":[{"IP":"10.241.0.17","Mask":"//8AAA=="}]}}}`},
+			}),
+			want: map[string]cns.PodInfo{
+				"10.241.0.17": cns.NewPodInfo("3f813b029429b4e41a09ab33b6f6d365d2ed704017524c78d1d0dece33cdaf46", "3f813b02-eth0", "metrics-server-77c8679d7d-6ksdh", "kube-system"),
+			},
+			wantErr: false,
+		},
 		{
 			name: "empty CNI response",
 			exec: newCNIStateFakeExec(
@@ -10,8 +10,10 @@ var _ Item = (*TimedItem)(nil)
 
 // TimedItem implements Item for a string: time.Time tuple.
 type TimedItem struct {
-	Name  string
-	Time  time.Time
+	Name string
+	Time time.Time
+	// Count is the number of times the key was pushed.
+	Count int
 	index int
 }
 
@@ -46,17 +48,18 @@ func NewTimedSet(c int) *TimedSet {
 }
 
 // Push registers the passed key and saves the timestamp it is first registered.
-// If the key is already registered, does not overwrite the saved timestamp.
+// If the key is already registered, does not overwrite the saved timestamp but counts the push.
 func (ts *TimedSet) Push(key string) {
 	ts.Lock()
 	defer ts.Unlock()
 	if _, ok := ts.items.Contains(key); ok {
+		ts.items.m[key].(*TimedItem).Count++
 		return
 	}
 	if ts.items.Len() >= ts.capacity {
 		_ = heap.Pop(ts.items)
 	}
-	item := &TimedItem{Name: key}
+	item := &TimedItem{Name: key, Count: 1}
 	item.Time = time.Now()
 	heap.Push(ts.items, item)
 }
@@ -64,12 +67,19 @@ func (ts *TimedSet) Push(key string) {
 // Pop returns the elapsed duration since the passed key was first registered,
 // or -1 if it is not found.
 func (ts *TimedSet) Pop(key string) time.Duration {
+	since, _ := ts.PopCount(key)
+	return since
+}
+
+// PopCount returns the elapsed duration since the passed key was first registered and the number of times it was
+// pushed, or -1 and 0 if it is not found.
+func (ts *TimedSet) PopCount(key string) (time.Duration, int) {
 	ts.Lock()
 	defer ts.Unlock()
 	idx, ok := ts.items.Contains(key)
 	if !ok {
-		return -1
+		return -1, 0
 	}
-	item := heap.Remove(ts.items, idx)
-	return time.Since(item.(*TimedItem).Time)
+	item := heap.Remove(ts.items, idx).(*TimedItem)
+	return time.Since(item.Time), item.Count
 }
@@ -84,3 +84,22 @@ func TestNewTimedSet(t *testing.T) {
 		})
 	}
 }
+
+func TestTimedSetPopCount(t *testing.T) {
+	ts := NewTimedSet(2)
+	ts.Push("a")
+	ts.Push("a")
+	ts.Push("b")
+	ts.Push("a")
+
+	since, count := ts.PopCount("a")
+	assert.Positive(t, since)
+	assert.Equal(t, 3, count)
+
+	since, count = ts.PopCount("a")
+	assert.Equal(t, time.Duration(-1), since)
+	assert.Equal(t, 0, count)
+
+	_, count = ts.PopCount("b")
+	assert.Equal(t, 1, count)
+}
@@ -45,6 +45,9 @@ const (
 	UnsupportedAPI                         ResponseCode = 43
 	FailedToAllocateBackendConfig          ResponseCode = 44
 	ConnectionError                        ResponseCode = 45
+	NICTypeDisabled                        ResponseCode = 46
+	StaticIPUnavailable                    ResponseCode = 47
+	SnatBridgeSubnetConflict               ResponseCode = 48
 	UnexpectedError                        ResponseCode = 99
 	NmAgentNCVersionListError              ResponseCode = 100
 )
@@ -128,6 +131,12 @@ func (c ResponseCode) String() string {
 		return "StatusUnauthorized"
 	case FailedToAllocateBackendConfig:
 		return "FailedToAllocateBackendConfig"
+	case NICTypeDisabled:
+		return "NICTypeDisabled"
+	case StaticIPUnavailable:
+		return "StaticIPUnavailable"
+	case SnatBridgeSubnetConflict:
+		return "SnatBridgeSubnetConflict"
 	default:
 		return "UnknownError"
 	}
@@ -0,0 +1,190 @@
+package vxlan
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// kernelDevice programs the kernel vxlan interface.
+type kernelDevice struct{}
+
+func newDevice() device {
+	return kernelDevice{}
+}
+
+func (kernelDevice) MacAddress(name string) (net.HardwareAddr, error) {
+	link, err := linkByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return link.Attrs().HardwareAddr, nil
+}
+
+// SyncPeers routes the pod CIDRs of every peer on link through a gateway, which is the first address of the CIDR,
+// resolves the gateway to the mac address of the peer's vxlan interface with a neighbor, and sends the frames to that
+// mac address to the peer's node with a forwarding database entry. The interface has no address other than its ipv6
+// link local one, so every other route, neighbor and entry of it was added here.
+func (kernelDevice) SyncPeers(name string, peers []Peer) error {
+	link, err := linkByName(name)
+	if err != nil {
+		return err
+	}
+	index := link.Attrs().Index
+
+	fdb := map[string]netip.Addr{}
+	neighs := map[netip.Addr]net.HardwareAddr{}
+	routes := map[netip.Prefix]netip.Addr{}
+	for i := range peers {
+		fdb[peers[i].MacAddress.String()] = peers[i].VTEP
+		for _, prefix := range peers[i].PodCIDRs {
+			neighs[prefix.Addr()] = peers[i].MacAddress
+			routes[prefix] = prefix.Addr()
+		}
+	}
+
+	for mac, vtep := range fdb {
+		hwAddr, _ := net.ParseMAC(mac)
+		// bridge fdb replace <mac> dev azvxlan dst <vtep>
+		if err := netlink.NeighSet(&netlink.Neigh{
+			LinkIndex:    index,
+			Family:       unix.AF_BRIDGE,
+			State:        netlink.NUD_PERMANENT,
+			Flags:        netlink.NTF_SELF,
+			IP:           vtep.AsSlice(),
+			HardwareAddr: hwAddr,
+		}); err != nil {
+			return errors.Wrapf(err, "failed to add fdb entry of %s", mac)
+		}
+	}
+	for gw, mac := range neighs {
+		// ip neigh replace <gw> lladdr <mac> dev azvxlan nud permanent
+		if err := netlink.NeighSet(&netlink.Neigh{
+			LinkIndex:    index,
+			Family:       family(gw),
+			State:        netlink.NUD_PERMANENT,
+			IP:           gw.AsSlice(),
+			HardwareAddr: mac,
+		}); err != nil {
+			return errors.Wrapf(err, "failed to add neighbor %s", gw)
+		}
+	}
+	for prefix, gw := range routes {
+		// ip route replace <podcidr> via <gw> dev azvxlan onlink
+		if err := netlink.RouteReplace(&netlink.Route{
+			LinkIndex: index,
+			Dst:       toIPNet(prefix),
+			Gw:        gw.AsSlice(),
+			Flags:     int(netlink.FLAG_ONLINK),
+		}); err != nil {
+			return errors.Wrapf(err, "failed to add route %s", prefix)
+		}
+	}
+
+	return deleteStale(link, fdb, neighs, routes)
+}
+
+// deleteStale deletes the routes, neighbors and forwarding database entries of the interface of the nodes that are
+// gone or changed.
+func deleteStale(link netlink.Link, fdb map[string]netip.Addr, neighs map[netip.Addr]net.HardwareAddr,
+	routes map[netip.Prefix]netip.Addr,
+) error {
+	current, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list routes of %s", link.Attrs().Name)
+	}
+	for i := range current {
+		// the kernel routes the ipv6 link local addresses of the interface
+		if current[i].Dst == nil || current[i].Dst.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if prefix, ok := toPrefix(current[i].Dst); ok {
+			if _, ok := routes[prefix]; ok {
+				continue
+			}
+		}
+		if err := netlink.RouteDel(&current[i]); err != nil {
+			return errors.Wrapf(err, "failed to delete route %s", current[i].Dst)
+		}
+	}
+
+	// the neighbors of all families would include the forwarding database entries
+	var currentNeighs []netlink.Neigh
+	for _, neighFamily := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		familyNeighs, err := netlink.NeighList(link.Attrs().Index, neighFamily)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list neighbors of %s", link.Attrs().Name)
+		}
+		currentNeighs = append(currentNeighs, familyNeighs...)
+	}
+	for i := range currentNeighs {
+		if currentNeighs[i].State&netlink.NUD_PERMANENT == 0 {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(currentNeighs[i].IP); ok {
+			if mac, ok := neighs[addr.Unmap()]; ok && mac.String() == currentNeighs[i].HardwareAddr.String() {
+				continue
+			}
+		}
+		if err := netlink.NeighDel(&currentNeighs[i]); err != nil {
+			return errors.Wrapf(err, "failed to delete neighbor %s", currentNeighs[i].IP)
+		}
+	}
+
+	currentFDB, err := netlink.NeighList(link.Attrs().Index, unix.AF_BRIDGE)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list fdb entries of %s", link.Attrs().Name)
+	}
+	for i := range currentFDB {
+		if currentFDB[i].IP == nil {
+			continue
+		}
+		if vtep, ok := fdb[currentFDB[i].HardwareAddr.String()]; ok && vtep.String() == currentFDB[i].IP.String() {
+			continue
+		}
+		if err := netlink.NeighDel(&currentFDB[i]); err != nil {
+			return errors.Wrapf(err, "failed to delete fdb entry of %s", currentFDB[i].HardwareAddr)
+		}
+	}
+	return nil
+}
+
+func linkByName(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if errors.As(err, &netlink.LinkNotFoundError{}) {
+			return nil, ErrNoInterface
+		}
+		return nil, errors.Wrapf(err, "failed to get interface %s", name)
+	}
+	if link.Type() != "vxlan" {
+		return nil, errors.Errorf("interface %s exists with type %s", name, link.Type())
+	}
+	return link, nil
+}
+
+func family(addr netip.Addr) int {
+	if addr.Is4() {
+		return netlink.FAMILY_V4
+	}
+	return netlink.FAMILY_V6
+}
+
+func toIPNet(prefix netip.Prefix) *net.IPNet {
+	return &net.IPNet{
+		IP:   prefix.Addr().AsSlice(),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}
+}
+
+func toPrefix(ipNet *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ipNet.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	bits, _ := ipNet.Mask.Size()
+	return netip.PrefixFrom(addr.Unmap(), bits), true
+}
@@ -0,0 +1,18 @@
+package vxlan
+
+import "net"
+
+// unsupportedDevice is used on windows, where the vxlan network mode is not supported yet.
+type unsupportedDevice struct{}
+
+func newDevice() device {
+	return unsupportedDevice{}
+}
+
+func (unsupportedDevice) MacAddress(string) (net.HardwareAddr, error) {
+	return nil, ErrUnsupported
+}
+
+func (unsupportedDevice) SyncPeers(string, []Peer) error {
+	return ErrUnsupported
+}
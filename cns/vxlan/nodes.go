@@ -0,0 +1,46 @@
+package vxlan
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeClient reads and annotates nodes through the kubernetes api.
+type NodeClient struct {
+	cs kubernetes.Interface
+}
+
+func NewNodeClient(cs kubernetes.Interface) *NodeClient {
+	return &NodeClient{cs: cs}
+}
+
+func (c *NodeClient) List(ctx context.Context) ([]corev1.Node, error) {
+	nodes, err := c.cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	return nodes.Items, nil
+}
+
+func (c *NodeClient) PublishMacAddress(ctx context.Context, nodeName string, mac net.HardwareAddr) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{
+				MacAddressAnnotation: mac.String(),
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal node patch")
+	}
+
+	_, err = c.cs.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return errors.Wrapf(err, "failed to annotate node %s", nodeName)
+}
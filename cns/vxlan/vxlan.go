@@ -0,0 +1,178 @@
+// Package vxlan keeps the vxlan interface of the pod networks in the vxlan mode in sync with the cluster's nodes. The
+// network manager of the CNI creates the interface with the network, and CNS publishes its mac address on the node
+// object and gives it a forwarding database entry, a neighbor and a route for every other node's pod CIDRs, so that
+// pods reach other nodes' pods through the tunnel rather than through routes in the vnet's route tables.
+package vxlan
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MacAddressAnnotation is the node annotation carrying the mac address of the node's vxlan interface.
+const MacAddressAnnotation = "acn.azure.com/vxlan-mac-address"
+
+var (
+	// ErrUnsupported is returned on platforms without vxlan support.
+	ErrUnsupported = errors.New("vxlan is not supported on this platform")
+	// ErrNoInterface is returned until the network manager creates the vxlan interface with the first pod of the network.
+	ErrNoInterface = errors.New("vxlan interface does not exist")
+)
+
+// Config of the sync of the vxlan interface.
+type Config struct {
+	NodeName          string
+	InterfaceName     string
+	ReconcileInterval time.Duration
+}
+
+// Peer is another node, whose vxlan interface has MacAddress and is reached at VTEP, and whose pods are in PodCIDRs.
+type Peer struct {
+	Node       string
+	VTEP       netip.Addr
+	MacAddress net.HardwareAddr
+	PodCIDRs   []netip.Prefix
+}
+
+// Nodes lists the cluster's nodes and publishes the mac address of this node's vxlan interface.
+type Nodes interface {
+	List(ctx context.Context) ([]corev1.Node, error)
+	PublishMacAddress(ctx context.Context, nodeName string, mac net.HardwareAddr) error
+}
+
+// device programs the vxlan interface.
+type device interface {
+	// MacAddress returns the mac address of the interface, or ErrNoInterface if it does not exist.
+	MacAddress(name string) (net.HardwareAddr, error)
+	// SyncPeers makes the forwarding database entries, neighbors and routes of the interface exactly those of peers.
+	SyncPeers(name string, peers []Peer) error
+}
+
+// Manager keeps the node's vxlan interface in sync with the cluster's nodes.
+type Manager struct {
+	cfg       Config
+	nodes     Nodes
+	dev       device
+	log       *zap.Logger
+	published net.HardwareAddr
+}
+
+// New creates a manager for the interface in cfg, with peers from nodes.
+func New(cfg Config, nodes Nodes, logger *zap.Logger) *Manager {
+	return &Manager{
+		cfg:   cfg,
+		nodes: nodes,
+		dev:   newDevice(),
+		log:   logger,
+	}
+}
+
+// Run reconciles the peers of the interface until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.cfg.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.reconcile(ctx); err != nil {
+			if errors.Is(err, ErrUnsupported) {
+				return err
+			}
+			m.log.Error("failed to reconcile vxlan peers", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile publishes the mac address of the interface, which changes when the interface is created again, and
+// replaces its peers with the ones of the current nodes. There is nothing to do until the interface exists.
+func (m *Manager) reconcile(ctx context.Context) error {
+	mac, err := m.dev.MacAddress(m.cfg.InterfaceName)
+	if err != nil {
+		if errors.Is(err, ErrNoInterface) {
+			m.log.Debug("vxlan interface does not exist yet", zap.String("interface", m.cfg.InterfaceName))
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get mac address of %s", m.cfg.InterfaceName)
+	}
+
+	if mac.String() != m.published.String() {
+		if err := m.nodes.PublishMacAddress(ctx, m.cfg.NodeName, mac); err != nil {
+			return errors.Wrap(err, "failed to publish mac address")
+		}
+		m.published = mac
+		m.log.Info("published vxlan mac address", zap.String("interface", m.cfg.InterfaceName), zap.Stringer("mac", mac))
+	}
+
+	nodes, err := m.nodes.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+
+	peers := peersFromNodes(nodes, m.cfg.NodeName)
+	if err := m.dev.SyncPeers(m.cfg.InterfaceName, peers); err != nil {
+		return errors.Wrapf(err, "failed to sync peers on %s", m.cfg.InterfaceName)
+	}
+
+	m.log.Debug("reconciled vxlan peers", zap.Int("peers", len(peers)))
+	return nil
+}
+
+// peersFromNodes returns a peer for every node other than self which has published the mac address of its vxlan
+// interface. Nodes without a mac address, an internal ipv4 or pod CIDRs are skipped until they have them.
+func peersFromNodes(nodes []corev1.Node, self string) []Peer {
+	peers := make([]Peer, 0, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Name == self {
+			continue
+		}
+
+		mac, err := net.ParseMAC(node.Annotations[MacAddressAnnotation])
+		if err != nil {
+			continue
+		}
+
+		// the tunnel runs over the ipv4 underlay of the vnet
+		var vtep netip.Addr
+		for _, addr := range node.Status.Addresses {
+			if addr.Type != corev1.NodeInternalIP {
+				continue
+			}
+			if ip, err := netip.ParseAddr(addr.Address); err == nil && ip.Is4() {
+				vtep = ip
+				break
+			}
+		}
+		if !vtep.IsValid() {
+			continue
+		}
+
+		var podCIDRs []netip.Prefix
+		for _, cidr := range node.Spec.PodCIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				podCIDRs = append(podCIDRs, prefix.Masked())
+			}
+		}
+		if len(podCIDRs) == 0 {
+			continue
+		}
+
+		peers = append(peers, Peer{
+			Node:       node.Name,
+			VTEP:       vtep,
+			MacAddress: mac,
+			PodCIDRs:   podCIDRs,
+		})
+	}
+	return peers
+}
@@ -0,0 +1,117 @@
+package vxlan
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeNodes struct {
+	nodes     []corev1.Node
+	published map[string][]string
+}
+
+func (f *fakeNodes) List(context.Context) ([]corev1.Node, error) {
+	return f.nodes, nil
+}
+
+func (f *fakeNodes) PublishMacAddress(_ context.Context, nodeName string, mac net.HardwareAddr) error {
+	f.published[nodeName] = append(f.published[nodeName], mac.String())
+	return nil
+}
+
+type fakeDevice struct {
+	mac   net.HardwareAddr
+	peers []Peer
+}
+
+func (f *fakeDevice) MacAddress(string) (net.HardwareAddr, error) {
+	if f.mac == nil {
+		return nil, ErrNoInterface
+	}
+	return f.mac, nil
+}
+
+func (f *fakeDevice) SyncPeers(_ string, peers []Peer) error {
+	f.peers = peers
+	return nil
+}
+
+func newNode(name, internalIP, mac string, podCIDRs ...string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{MacAddressAnnotation: mac},
+		},
+		Spec: corev1.NodeSpec{PodCIDRs: podCIDRs},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: name},
+				{Type: corev1.NodeInternalIP, Address: internalIP},
+			},
+		},
+	}
+}
+
+func TestPeersFromNodes(t *testing.T) {
+	self := newNode("node-0", "10.224.0.4", "02:00:00:00:00:00", "10.244.0.0/24")
+	peer := newNode("node-1", "10.224.0.5", "02:00:00:00:00:01", "10.244.1.0/24", "fd00:1::/64")
+	noMac := newNode("node-2", "10.224.0.6", "", "10.244.2.0/24")
+	v6Only := newNode("node-3", "fd00::7", "02:00:00:00:00:03", "10.244.3.0/24")
+	noCIDRs := newNode("node-4", "10.224.0.8", "02:00:00:00:00:04")
+
+	peers := peersFromNodes([]corev1.Node{self, peer, noMac, v6Only, noCIDRs}, "node-0")
+
+	require.Len(t, peers, 1)
+	assert.Equal(t, "node-1", peers[0].Node)
+	assert.Equal(t, netip.MustParseAddr("10.224.0.5"), peers[0].VTEP)
+	assert.Equal(t, "02:00:00:00:00:01", peers[0].MacAddress.String())
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.244.1.0/24"), netip.MustParsePrefix("fd00:1::/64")}, peers[0].PodCIDRs)
+}
+
+func TestReconcile(t *testing.T) {
+	nodes := &fakeNodes{
+		nodes: []corev1.Node{
+			newNode("node-0", "10.224.0.4", "", "10.244.0.0/24"),
+			newNode("node-1", "10.224.0.5", "02:00:00:00:00:01", "10.244.1.0/24"),
+			newNode("node-2", "10.224.0.6", "02:00:00:00:00:02", "10.244.2.0/24"),
+		},
+		published: map[string][]string{},
+	}
+	dev := &fakeDevice{}
+	m := &Manager{
+		cfg:   Config{NodeName: "node-0", InterfaceName: "azvxlan"},
+		nodes: nodes,
+		dev:   dev,
+		log:   zap.NewNop(),
+	}
+
+	// nothing is synced until the network manager creates the interface
+	require.NoError(t, m.reconcile(context.Background()))
+	assert.Empty(t, nodes.published)
+	assert.Nil(t, dev.peers)
+
+	dev.mac, _ = net.ParseMAC("02:00:00:00:00:00")
+	require.NoError(t, m.reconcile(context.Background()))
+	assert.Equal(t, []string{"02:00:00:00:00:00"}, nodes.published["node-0"])
+	require.Len(t, dev.peers, 2)
+	assert.Equal(t, "node-1", dev.peers[0].Node)
+	assert.Equal(t, "node-2", dev.peers[1].Node)
+
+	// a removed node is dropped from the peers, the mac address is only published again once it changes
+	nodes.nodes = nodes.nodes[:2]
+	require.NoError(t, m.reconcile(context.Background()))
+	require.Len(t, dev.peers, 1)
+	assert.Equal(t, []string{"02:00:00:00:00:00"}, nodes.published["node-0"])
+
+	dev.mac, _ = net.ParseMAC("02:00:00:00:00:10")
+	require.NoError(t, m.reconcile(context.Background()))
+	assert.Equal(t, []string{"02:00:00:00:00:00", "02:00:00:00:00:10"}, nodes.published["node-0"])
+}
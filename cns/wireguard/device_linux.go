@@ -0,0 +1,108 @@
+package wireguard
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// kernelDevice programs the kernel WireGuard module.
+type kernelDevice struct{}
+
+func newDevice() device {
+	return kernelDevice{}
+}
+
+func (kernelDevice) Up(name string, mtu int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if !errors.As(err, &netlink.LinkNotFoundError{}) {
+			return errors.Wrapf(err, "failed to get interface %s", name)
+		}
+
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		attrs.MTU = mtu
+		link = &netlink.Wireguard{LinkAttrs: attrs}
+		if err := netlink.LinkAdd(link); err != nil {
+			return errors.Wrapf(err, "failed to add interface %s", name)
+		}
+	} else if link.Type() != "wireguard" {
+		return errors.Errorf("interface %s exists with type %s", name, link.Type())
+	}
+
+	if err := netlink.LinkSetMTU(link, mtu); err != nil {
+		return errors.Wrapf(err, "failed to set mtu of %s", name)
+	}
+	return errors.Wrapf(netlink.LinkSetUp(link), "failed to set %s up", name)
+}
+
+func (kernelDevice) Configure(name string, cfg wgtypes.Config) error {
+	client, err := wgctrl.New()
+	if err != nil {
+		return errors.Wrap(err, "failed to open wireguard client")
+	}
+	defer client.Close()
+
+	return errors.Wrapf(client.ConfigureDevice(name, cfg), "failed to configure %s", name)
+}
+
+func (kernelDevice) SyncRoutes(name string, prefixes []netip.Prefix) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get interface %s", name)
+	}
+
+	want := make(map[netip.Prefix]struct{}, len(prefixes))
+	for _, prefix := range prefixes {
+		want[prefix] = struct{}{}
+	}
+
+	// the interface has no address, so every route over it was added here
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list routes of %s", name)
+	}
+	for i := range routes {
+		if routes[i].Dst == nil {
+			continue
+		}
+		if prefix, ok := toPrefix(routes[i].Dst); ok {
+			if _, ok := want[prefix]; ok {
+				continue
+			}
+		}
+		if err := netlink.RouteDel(&routes[i]); err != nil {
+			return errors.Wrapf(err, "failed to delete route %s", routes[i].Dst)
+		}
+	}
+
+	for prefix := range want {
+		route := &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Scope:     unix.RT_SCOPE_LINK,
+			Dst: &net.IPNet{
+				IP:   prefix.Addr().AsSlice(),
+				Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+			},
+		}
+		if err := netlink.RouteReplace(route); err != nil {
+			return errors.Wrapf(err, "failed to add route %s", prefix)
+		}
+	}
+	return nil
+}
+
+func toPrefix(ipNet *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ipNet.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	bits, _ := ipNet.Mask.Size()
+	return netip.PrefixFrom(addr.Unmap(), bits), true
+}
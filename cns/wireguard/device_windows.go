@@ -0,0 +1,26 @@
+package wireguard
+
+import (
+	"net/netip"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// unsupportedDevice is used on windows, where node to node encryption is not supported yet.
+type unsupportedDevice struct{}
+
+func newDevice() device {
+	return unsupportedDevice{}
+}
+
+func (unsupportedDevice) Up(string, int) error {
+	return ErrUnsupported
+}
+
+func (unsupportedDevice) Configure(string, wgtypes.Config) error {
+	return ErrUnsupported
+}
+
+func (unsupportedDevice) SyncRoutes(string, []netip.Prefix) error {
+	return ErrUnsupported
+}
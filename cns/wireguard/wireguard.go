@@ -0,0 +1,232 @@
+// Package wireguard encrypts pod traffic between nodes. CNS brings up a WireGuard interface on the node, publishes its
+// public key on the node object and keeps a peer, and a route over the interface, for every other node's pod CIDRs.
+// Pods in the wireguard network mode reach other nodes' pods through these routes.
+package wireguard
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PublicKeyAnnotation is the node annotation carrying the node's WireGuard public key.
+const PublicKeyAnnotation = "acn.azure.com/wireguard-public-key"
+
+// ErrUnsupported is returned on platforms without WireGuard support.
+var ErrUnsupported = errors.New("wireguard is not supported on this platform")
+
+// Config of the WireGuard interface.
+type Config struct {
+	NodeName          string
+	InterfaceName     string
+	ListenPort        int
+	MTU               int
+	PrivateKeyPath    string
+	ReconcileInterval time.Duration
+}
+
+// Peer is another node, reached at Endpoint, whose pods are in AllowedIPs.
+type Peer struct {
+	Node       string
+	PublicKey  wgtypes.Key
+	Endpoint   netip.AddrPort
+	AllowedIPs []netip.Prefix
+}
+
+// Nodes lists the cluster's nodes and publishes this node's public key.
+type Nodes interface {
+	List(ctx context.Context) ([]corev1.Node, error)
+	PublishPublicKey(ctx context.Context, nodeName string, key wgtypes.Key) error
+}
+
+// device programs the WireGuard interface.
+type device interface {
+	// Up creates the interface if it does not exist and sets it up.
+	Up(name string, mtu int) error
+	Configure(name string, cfg wgtypes.Config) error
+	// SyncRoutes makes the routes over the interface exactly prefixes.
+	SyncRoutes(name string, prefixes []netip.Prefix) error
+}
+
+// Manager keeps the node's WireGuard interface in sync with the cluster's nodes.
+type Manager struct {
+	cfg   Config
+	nodes Nodes
+	dev   device
+	log   *zap.Logger
+}
+
+// New creates a manager for the interface in cfg, with peers from nodes.
+func New(cfg Config, nodes Nodes, logger *zap.Logger) *Manager {
+	return &Manager{
+		cfg:   cfg,
+		nodes: nodes,
+		dev:   newDevice(),
+		log:   logger,
+	}
+}
+
+// Run sets up the interface, publishes the node's public key and reconciles the peers until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context) error {
+	key, err := loadOrCreateKey(m.cfg.PrivateKeyPath)
+	if err != nil {
+		return err
+	}
+
+	if err := m.dev.Up(m.cfg.InterfaceName, m.cfg.MTU); err != nil {
+		return errors.Wrapf(err, "failed to set up %s", m.cfg.InterfaceName)
+	}
+
+	if err := m.dev.Configure(m.cfg.InterfaceName, wgtypes.Config{
+		PrivateKey: &key,
+		ListenPort: &m.cfg.ListenPort,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to configure %s", m.cfg.InterfaceName)
+	}
+
+	if err := m.nodes.PublishPublicKey(ctx, m.cfg.NodeName, key.PublicKey()); err != nil {
+		return errors.Wrap(err, "failed to publish public key")
+	}
+
+	m.log.Info("wireguard interface is up", zap.String("interface", m.cfg.InterfaceName), zap.Int("listenPort", m.cfg.ListenPort))
+
+	ticker := time.NewTicker(m.cfg.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.reconcile(ctx); err != nil {
+			m.log.Error("failed to reconcile wireguard peers", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile replaces the interface's peers and routes with the ones of the current nodes.
+func (m *Manager) reconcile(ctx context.Context) error {
+	nodes, err := m.nodes.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+
+	peers := peersFromNodes(nodes, m.cfg.NodeName, m.cfg.ListenPort)
+
+	peerConfigs := make([]wgtypes.PeerConfig, 0, len(peers))
+	var prefixes []netip.Prefix
+	for i := range peers {
+		endpoint := net.UDPAddrFromAddrPort(peers[i].Endpoint)
+		allowedIPs := make([]net.IPNet, 0, len(peers[i].AllowedIPs))
+		for _, prefix := range peers[i].AllowedIPs {
+			allowedIPs = append(allowedIPs, net.IPNet{
+				IP:   prefix.Addr().AsSlice(),
+				Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+			})
+		}
+		peerConfigs = append(peerConfigs, wgtypes.PeerConfig{
+			PublicKey:         peers[i].PublicKey,
+			Endpoint:          endpoint,
+			ReplaceAllowedIPs: true,
+			AllowedIPs:        allowedIPs,
+		})
+		prefixes = append(prefixes, peers[i].AllowedIPs...)
+	}
+
+	if err := m.dev.Configure(m.cfg.InterfaceName, wgtypes.Config{
+		ReplacePeers: true,
+		Peers:        peerConfigs,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to configure peers on %s", m.cfg.InterfaceName)
+	}
+
+	if err := m.dev.SyncRoutes(m.cfg.InterfaceName, prefixes); err != nil {
+		return errors.Wrapf(err, "failed to sync routes on %s", m.cfg.InterfaceName)
+	}
+
+	m.log.Debug("reconciled wireguard peers", zap.Int("peers", len(peers)))
+	return nil
+}
+
+// peersFromNodes returns a peer for every node other than self which has published its public key. Nodes without a
+// key, an internal ip or pod CIDRs are skipped until they have them.
+func peersFromNodes(nodes []corev1.Node, self string, listenPort int) []Peer {
+	peers := make([]Peer, 0, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Name == self {
+			continue
+		}
+
+		key, err := wgtypes.ParseKey(node.Annotations[PublicKeyAnnotation])
+		if err != nil {
+			continue
+		}
+
+		var endpoint netip.AddrPort
+		for _, addr := range node.Status.Addresses {
+			if addr.Type != corev1.NodeInternalIP {
+				continue
+			}
+			if ip, err := netip.ParseAddr(addr.Address); err == nil {
+				endpoint = netip.AddrPortFrom(ip, uint16(listenPort))
+				break
+			}
+		}
+		if !endpoint.IsValid() {
+			continue
+		}
+
+		var allowedIPs []netip.Prefix
+		for _, cidr := range node.Spec.PodCIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				allowedIPs = append(allowedIPs, prefix.Masked())
+			}
+		}
+		if len(allowedIPs) == 0 {
+			continue
+		}
+
+		peers = append(peers, Peer{
+			Node:       node.Name,
+			PublicKey:  key,
+			Endpoint:   endpoint,
+			AllowedIPs: allowedIPs,
+		})
+	}
+	return peers
+}
+
+// loadOrCreateKey loads the private key at path, generating and saving one if there is none, so that the node keeps
+// its key across CNS restarts.
+func loadOrCreateKey(path string) (wgtypes.Key, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		key, err := wgtypes.ParseKey(string(b))
+		return key, errors.Wrapf(err, "failed to parse private key %s", path)
+	}
+	if !os.IsNotExist(err) {
+		return wgtypes.Key{}, errors.Wrapf(err, "failed to read private key %s", path)
+	}
+
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, errors.Wrap(err, "failed to generate private key")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:gomnd // owner only
+		return wgtypes.Key{}, errors.Wrapf(err, "failed to create %s", filepath.Dir(path))
+	}
+	if err := os.WriteFile(path, []byte(key.String()), 0o600); err != nil { //nolint:gomnd // owner only
+		return wgtypes.Key{}, errors.Wrapf(err, "failed to save private key %s", path)
+	}
+	return key, nil
+}
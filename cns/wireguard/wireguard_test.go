@@ -0,0 +1,130 @@
+package wireguard
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeNodes struct {
+	nodes     []corev1.Node
+	published map[string]wgtypes.Key
+}
+
+func (f *fakeNodes) List(context.Context) ([]corev1.Node, error) {
+	return f.nodes, nil
+}
+
+func (f *fakeNodes) PublishPublicKey(_ context.Context, nodeName string, key wgtypes.Key) error {
+	f.published[nodeName] = key
+	return nil
+}
+
+type fakeDevice struct {
+	configs []wgtypes.Config
+	routes  []netip.Prefix
+}
+
+func (*fakeDevice) Up(string, int) error {
+	return nil
+}
+
+func (f *fakeDevice) Configure(_ string, cfg wgtypes.Config) error {
+	f.configs = append(f.configs, cfg)
+	return nil
+}
+
+func (f *fakeDevice) SyncRoutes(_ string, prefixes []netip.Prefix) error {
+	f.routes = prefixes
+	return nil
+}
+
+func newNode(t *testing.T, name, internalIP string, podCIDRs ...string) corev1.Node {
+	t.Helper()
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{PublicKeyAnnotation: key.PublicKey().String()},
+		},
+		Spec: corev1.NodeSpec{PodCIDRs: podCIDRs},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: name},
+				{Type: corev1.NodeInternalIP, Address: internalIP},
+			},
+		},
+	}
+}
+
+func TestPeersFromNodes(t *testing.T) {
+	self := newNode(t, "node-0", "10.224.0.4", "10.244.0.0/24")
+	peer := newNode(t, "node-1", "10.224.0.5", "10.244.1.0/24", "fd00:1::/64")
+	noKey := newNode(t, "node-2", "10.224.0.6", "10.244.2.0/24")
+	delete(noKey.Annotations, PublicKeyAnnotation)
+	noIP := newNode(t, "node-3", "", "10.244.3.0/24")
+	noCIDRs := newNode(t, "node-4", "10.224.0.8")
+
+	peers := peersFromNodes([]corev1.Node{self, peer, noKey, noIP, noCIDRs}, "node-0", 51820)
+
+	require.Len(t, peers, 1)
+	assert.Equal(t, "node-1", peers[0].Node)
+	assert.Equal(t, peer.Annotations[PublicKeyAnnotation], peers[0].PublicKey.String())
+	assert.Equal(t, netip.MustParseAddrPort("10.224.0.5:51820"), peers[0].Endpoint)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.244.1.0/24"), netip.MustParsePrefix("fd00:1::/64")}, peers[0].AllowedIPs)
+}
+
+func TestReconcile(t *testing.T) {
+	nodes := &fakeNodes{
+		nodes: []corev1.Node{
+			newNode(t, "node-0", "10.224.0.4", "10.244.0.0/24"),
+			newNode(t, "node-1", "10.224.0.5", "10.244.1.0/24"),
+			newNode(t, "node-2", "10.224.0.6", "10.244.2.0/24"),
+		},
+		published: map[string]wgtypes.Key{},
+	}
+	dev := &fakeDevice{}
+	m := &Manager{
+		cfg:   Config{NodeName: "node-0", InterfaceName: "azwg0", ListenPort: 51820},
+		nodes: nodes,
+		dev:   dev,
+		log:   zap.NewNop(),
+	}
+
+	require.NoError(t, m.reconcile(context.Background()))
+
+	require.Len(t, dev.configs, 1)
+	assert.True(t, dev.configs[0].ReplacePeers)
+	require.Len(t, dev.configs[0].Peers, 2)
+	assert.Equal(t, "10.224.0.5:51820", dev.configs[0].Peers[0].Endpoint.String())
+	assert.Equal(t, "10.244.1.0/24", dev.configs[0].Peers[0].AllowedIPs[0].String())
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.244.1.0/24"), netip.MustParsePrefix("10.244.2.0/24")}, dev.routes)
+
+	// a removed node is dropped from the peers and routes
+	nodes.nodes = nodes.nodes[:2]
+	require.NoError(t, m.reconcile(context.Background()))
+	require.Len(t, dev.configs[1].Peers, 1)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.244.1.0/24")}, dev.routes)
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wireguard", "wireguard.key")
+
+	key, err := loadOrCreateKey(path)
+	require.NoError(t, err)
+
+	// the saved key is loaded again after a restart
+	loaded, err := loadOrCreateKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, key, loaded)
+}
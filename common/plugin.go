@@ -42,6 +42,11 @@ type PluginConfig struct {
 	ErrChan   chan error
 	Store     store.KeyValueStore
 	Stateless bool
+	// CollectEndpointStats adds the endpoints' traffic counters to the EndpointInfo returned by the network manager
+	CollectEndpointStats bool
+	// RecoverEndpointState rebuilds the state of the network manager from the endpoints found in the dataplane when it
+	// is missing or can't be read
+	RecoverEndpointState bool
 }
 
 // NewPlugin creates a new Plugin object.
@@ -0,0 +1,45 @@
+//go:build !ignore_uncovered
+// +build !ignore_uncovered
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Important: Run "make" to regenerate code after modifying this file
+
+// +kubebuilder:object:root=true
+
+// NamespaceIPBlock is the Schema for the NamespaceIPBlock API. It maps the Pods of its Namespace to
+// CIDR blocks of the Pod subnet: CNS assigns the Pods of the Namespace IPs in the blocks, and the Pods
+// of other Namespaces IPs outside of them.
+// +kubebuilder:resource:shortName=nsipb,scope=Namespaced
+// +kubebuilder:printcolumn:name="CIDRs",type=string,JSONPath=`.spec.cidrs`
+type NamespaceIPBlock struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NamespaceIPBlockSpec `json:"spec,omitempty"`
+}
+
+// NamespaceIPBlockSpec defines the desired state of NamespaceIPBlock
+type NamespaceIPBlockSpec struct {
+	// CIDRs are the blocks of the Pod subnet the Pods of the Namespace are assigned IPs from.
+	// The blocks of all NamespaceIPBlocks in a Namespace are combined.
+	// +kubebuilder:validation:MinItems=1
+	CIDRs []string `json:"cidrs"`
+}
+
+// +kubebuilder:object:root=true
+
+// NamespaceIPBlockList contains a list of NamespaceIPBlock
+type NamespaceIPBlockList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespaceIPBlock `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespaceIPBlock{}, &NamespaceIPBlockList{})
+}
@@ -0,0 +1,38 @@
+package namespaceipblock
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/crd/namespaceipblock/api/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Scheme is a runtime scheme containing the client-go scheme and the NamespaceIPBlock scheme.
+var Scheme = runtime.NewScheme()
+
+func init() {
+	_ = scheme.AddToScheme(Scheme)
+	_ = v1alpha1.AddToScheme(Scheme)
+}
+
+// Client provides methods to interact with instances of the NamespaceIPBlock custom resource.
+type Client struct {
+	cli client.Client
+}
+
+// NewClient creates a new NamespaceIPBlock client from the passed ctrlcli.Client.
+func NewClient(cli client.Client) *Client {
+	return &Client{
+		cli: cli,
+	}
+}
+
+// List returns the NamespaceIPBlocks of all Namespaces.
+func (c *Client) List(ctx context.Context) ([]v1alpha1.NamespaceIPBlock, error) {
+	namespaceIPBlockList := &v1alpha1.NamespaceIPBlockList{}
+	err := c.cli.List(ctx, namespaceIPBlockList)
+	return namespaceIPBlockList.Items, errors.Wrap(err, "failed to list namespaceipblocks")
+}
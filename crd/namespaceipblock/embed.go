@@ -0,0 +1,26 @@
+package namespaceipblock
+
+import (
+	_ "embed"
+
+	// import the manifests package so that caller of this package have the manifests compiled in as a side-effect.
+	_ "github.com/Azure/azure-container-networking/crd/namespaceipblock/manifests"
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// NamespaceIPBlocksYAML embeds the CRD YAML for downstream consumers.
+//
+//go:embed manifests/acn.azure.com_namespaceipblocks.yaml
+var NamespaceIPBlocksYAML []byte
+
+// GetNamespaceIPBlocks parses the raw []byte NamespaceIPBlocks in
+// to a CustomResourceDefinition and returns it or an unmarshalling error.
+func GetNamespaceIPBlocks() (*apiextensionsv1.CustomResourceDefinition, error) {
+	namespaceIPBlocks := &apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(NamespaceIPBlocksYAML, &namespaceIPBlocks); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling embedded namespaceipblocks")
+	}
+	return namespaceIPBlocks, nil
+}
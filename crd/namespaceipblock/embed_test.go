@@ -0,0 +1,22 @@
+package namespaceipblock
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const filename = "manifests/acn.azure.com_namespaceipblocks.yaml"
+
+func TestEmbed(t *testing.T) {
+	b, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, b, NamespaceIPBlocksYAML)
+}
+
+func TestGetNamespaceIPBlocks(t *testing.T) {
+	crd, err := GetNamespaceIPBlocks()
+	assert.NoError(t, err)
+	assert.Equal(t, "namespaceipblocks.acn.azure.com", crd.Name)
+}
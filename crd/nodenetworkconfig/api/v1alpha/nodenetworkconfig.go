@@ -126,6 +126,11 @@ type NetworkContainer struct {
 	DefaultGatewayV6   string         `json:"defaultGatewayV6,omitempty"`
 	MacAddress         string         `json:"macAddress,omitempty"`
 	SubnetAddressSpace string         `json:"subnetAddressSpace,omitempty"`
+	// SNATExceptionCIDRs are the destination cidrs the traffic of the NC's pods is not source natted to
+	SNATExceptionCIDRs []string `json:"snatExceptionCIDRs,omitempty"`
+	// AvailabilityZone is the availability zone of the NC's subnet, the IPs of the NCs in the zone of the node are
+	// assigned first
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
 	// +kubebuilder:default=0
 	// +kubebuilder:validation:Optional
 	Version         int64    `json:"version"`
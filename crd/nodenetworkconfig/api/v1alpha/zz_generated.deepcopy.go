@@ -31,6 +31,11 @@ func (in *NetworkContainer) DeepCopyInto(out *NetworkContainer) {
 		*out = make([]IPAssignment, len(*in))
 		copy(*out, *in)
 	}
+	if in.SNATExceptionCIDRs != nil {
+		in, out := &in.SNATExceptionCIDRs, &out.SNATExceptionCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkContainer.
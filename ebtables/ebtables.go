@@ -24,6 +24,7 @@ const (
 	PostRouting = "POSTROUTING"
 	Brouting    = "BROUTING"
 	Forward     = "FORWARD"
+	Input       = "INPUT"
 	// Ebtable Protocols
 	IPV4 = "IPv4"
 	IPV6 = "IPv6"
@@ -52,6 +53,35 @@ func SetArpReply(ipAddress net.IP, macAddress net.HardwareAddr, action string) e
 	return runEbCmd(table, action, chain, rule)
 }
 
+// SetArpSpoofProtection sets the rules accepting the ARP packets received on an interface only from the given IP
+// addresses and MAC address, to the host and to the other ports of its bridge alike.
+func SetArpSpoofProtection(interfaceName string, ipAddresses []net.IP, macAddress net.HardwareAddr, action string) error {
+	table := Filter
+	var rules []string
+	for _, ipAddress := range ipAddresses {
+		rules = append(rules, fmt.Sprintf("-p ARP -i %s --arp-ip-src %s --arp-mac-src %s -j ACCEPT",
+			interfaceName, ipAddress, macAddress.String()))
+	}
+	rules = append(rules, fmt.Sprintf("-p ARP -i %s -j DROP", interfaceName))
+
+	// the deletes go on past a rule which is gone already, so that none of the others is left behind
+	var ruleErr error
+	for _, chain := range []string{Input, Forward} {
+		for _, rule := range rules {
+			if err := runEbCmd(table, action, chain, rule); err != nil {
+				if action != Delete {
+					return err
+				}
+				if ruleErr == nil {
+					ruleErr = err
+				}
+			}
+		}
+	}
+
+	return ruleErr
+}
+
 // SetBrouteAccept sets an EB rule.
 func SetBrouteAccept(ipAddress, action string) error {
 	table := Broute
@@ -0,0 +1,48 @@
+// Package undo records the inverse of each step of a configuration, so that a configuration which fails part way is
+// undone rather than left half applied.
+package undo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stack is the inverses of the steps made so far. The zero value is an empty stack.
+type Stack struct {
+	steps []step
+}
+
+// step undoes one change.
+type step struct {
+	desc string
+	fn   func() error
+}
+
+// Push records the inverse of a step, desc saying what it does for its error. The inverse of a step which may fail part
+// way is pushed before the step, and so must do nothing for the changes which weren't made.
+func (s *Stack) Push(desc string, fn func() error) {
+	s.steps = append(s.steps, step{desc: desc, fn: fn})
+}
+
+// Len returns the number of inverses recorded, for RollbackTo.
+func (s *Stack) Len() int {
+	return len(s.steps)
+}
+
+// RollbackTo runs the inverses recorded after the first n, the latest first. All of them are run, the errors of the
+// ones which fail are returned together.
+func (s *Stack) RollbackTo(n int) error {
+	var errs []error
+	for i := len(s.steps) - 1; i >= n; i-- {
+		if err := s.steps[i].fn(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to %s: %w", s.steps[i].desc, err))
+		}
+	}
+	s.steps = s.steps[:n]
+	return errors.Join(errs...)
+}
+
+// Rollback runs all the inverses recorded.
+func (s *Stack) Rollback() error {
+	return s.RollbackTo(0)
+}
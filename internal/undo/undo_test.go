@@ -0,0 +1,46 @@
+package undo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUndo = errors.New("undo failed")
+
+func TestStackRollback(t *testing.T) {
+	var (
+		stack Stack
+		calls []string
+	)
+	push := func(name string, err error) {
+		stack.Push("undo "+name, func() error {
+			calls = append(calls, name)
+			return err
+		})
+	}
+
+	push("veth", errUndo)
+	push("move", nil)
+	inNetns := stack.Len()
+	push("address", nil)
+	push("route", nil)
+	assert.Equal(t, 4, stack.Len())
+
+	require.NoError(t, stack.RollbackTo(inNetns))
+	assert.Equal(t, []string{"route", "address"}, calls)
+	assert.Equal(t, inNetns, stack.Len())
+
+	// all the inverses are run even when some fail
+	calls = nil
+	err := stack.Rollback()
+	require.ErrorIs(t, err, errUndo)
+	assert.Contains(t, err.Error(), "failed to undo veth")
+	assert.Equal(t, []string{"move", "veth"}, calls)
+	assert.Zero(t, stack.Len())
+
+	// an empty stack has nothing to undo
+	require.NoError(t, stack.Rollback())
+}
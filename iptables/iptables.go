@@ -92,17 +92,25 @@ type IPTableEntry struct {
 }
 
 type Client struct {
-	pl platform.ExecClient
+	pl      platform.ExecClient
+	backend Backend
 }
 
+// NewClient creates a client programming the rules with the backend of the host, see DetectBackend.
 func NewClient() *Client {
+	pl := platform.NewExecClient(logger)
 	return &Client{
-		pl: platform.NewExecClient(logger),
+		pl:      pl,
+		backend: DetectBackend(pl),
 	}
 }
 
-// Run iptables command
+// Run iptables command, translated to nft with the nftables backend
 func (c *Client) RunCmd(version, params string) error {
+	if c.backend == BackendNFTables {
+		return c.runNFT(version, params)
+	}
+
 	var cmd string
 
 	iptCmd := iptables
@@ -0,0 +1,351 @@
+package iptables
+
+// This file programs the iptables rules of the client with nftables, for hosts without a working iptables.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Backend is the framework the rules are programmed with.
+type Backend string
+
+const (
+	// BackendIPTables runs the iptables binaries, either flavour, iptables-nft programs nftables itself.
+	BackendIPTables Backend = "iptables"
+	// BackendNFTables translates the rules to nft commands, for hosts which have dropped legacy iptables and don't
+	// ship iptables-nft.
+	BackendNFTables Backend = "nftables"
+)
+
+const (
+	nft = "nft"
+	// maxCommentLen is the longest comment nftables keeps on a rule.
+	maxCommentLen = 128
+)
+
+var (
+	errUnsupportedRule = errors.New("iptables rule not supported by the nftables backend")
+	errRuleNotFound    = errors.New("rule not found")
+
+	detectOnce      sync.Once
+	detectedBackend Backend
+)
+
+// baseChain is the hook of a standard iptables chain in its table.
+type baseChain struct {
+	chainType string
+	hook      string
+	priority  int
+}
+
+// baseChains are the standard chains of each table, with the hooks and priorities of iptables.
+var baseChains = map[string]map[string]baseChain{
+	Filter: {
+		Input:   {"filter", "input", 0},
+		Forward: {"filter", "forward", 0},
+		Output:  {"filter", "output", 0},
+	},
+	Nat: {
+		Prerouting:  {"nat", "prerouting", -100},
+		Input:       {"nat", "input", 100},
+		Output:      {"nat", "output", -100},
+		Postrouting: {"nat", "postrouting", 100},
+	},
+	Mangle: {
+		Prerouting:  {"filter", "prerouting", -150},
+		Input:       {"filter", "input", -150},
+		Forward:     {"filter", "forward", -150},
+		Output:      {"route", "output", -150},
+		Postrouting: {"filter", "postrouting", -150},
+	},
+}
+
+// DetectBackend returns the backend of the host, once per process. iptables is used whenever it can list the filter
+// table, nftables only if it can't, or isn't installed, and nft is.
+func DetectBackend(pl platform.ExecClient) Backend {
+	detectOnce.Do(func() {
+		detectedBackend = detectBackend(pl, exec.LookPath)
+		logger.Info("Detected packet filtering backend", zap.String("backend", string(detectedBackend)))
+	})
+	return detectedBackend
+}
+
+func detectBackend(pl platform.ExecClient, lookPath func(string) (string, error)) Backend {
+	if _, err := lookPath(iptables); err == nil {
+		c := &Client{pl: pl}
+		if err := c.RunCmd(V4, fmt.Sprintf("-t %s -nL %s", Filter, Input)); err == nil {
+			return BackendIPTables
+		}
+	}
+	if _, err := lookPath(nft); err == nil {
+		return BackendNFTables
+	}
+	return BackendIPTables
+}
+
+// iptablesCmd is an iptables command of the client, parsed.
+type iptablesCmd struct {
+	table  string
+	op     string
+	chain  string
+	match  []string
+	target []string
+}
+
+// parseIPTablesCmd parses the commands the client builds: -N and -nL of a chain, and -C, -I, -A and -D of a rule.
+func parseIPTablesCmd(params string) (iptablesCmd, error) {
+	cmd := iptablesCmd{table: Filter}
+	args := strings.Fields(params)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-t":
+			if i+1 >= len(args) {
+				return cmd, errors.Wrapf(errUnsupportedRule, "%q", params)
+			}
+			i++
+			cmd.table = args[i]
+		case "-N", "-nL", "-C", "-I", "-A", "-D":
+			if cmd.op != "" || i+1 >= len(args) {
+				return cmd, errors.Wrapf(errUnsupportedRule, "%q", params)
+			}
+			cmd.op, cmd.chain = args[i], args[i+1]
+			i++
+			// only inserts at the start of the chain are supported, which is all the client does
+			if cmd.op == "-I" && i+1 < len(args) && args[i+1] == "1" {
+				i++
+			}
+		case "-j":
+			cmd.target = args[i+1:]
+			i = len(args)
+		default:
+			cmd.match = append(cmd.match, args[i])
+		}
+	}
+	if cmd.op == "" {
+		return cmd, errors.Wrapf(errUnsupportedRule, "%q", params)
+	}
+	if (cmd.op == "-N" || cmd.op == "-nL") && (len(cmd.match) > 0 || len(cmd.target) > 0) {
+		return cmd, errors.Wrapf(errUnsupportedRule, "%q", params)
+	}
+	return cmd, nil
+}
+
+// rule is the match and target of the rule, as given to iptables.
+func (cmd iptablesCmd) rule() string {
+	return strings.Join(append(append(append([]string{}, cmd.match...), "-j"), cmd.target...), " ")
+}
+
+// spec is the rule as iptables would print it, which identifies it in the comment of the nftables rule.
+func (cmd iptablesCmd) spec() string {
+	spec := cmd.rule()
+	if len(spec) <= maxCommentLen {
+		return spec
+	}
+	sum := sha256.Sum256([]byte(spec))
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
+
+// runNFT runs the iptables command with nft.
+func (c *Client) runNFT(version, params string) error {
+	cmd, err := parseIPTablesCmd(params)
+	if err != nil {
+		return err
+	}
+	family := "ip"
+	if version == V6 {
+		family = "ip6"
+	}
+
+	switch cmd.op {
+	case "-nL":
+		return c.nft("list", "chain", family, cmd.table, cmd.chain)
+	case "-N":
+		if err := c.nft("add", "table", family, cmd.table); err != nil {
+			return err
+		}
+		return c.nft("add", "chain", family, cmd.table, cmd.chain)
+	case "-C":
+		_, err := c.findNFTRule(family, cmd)
+		return err
+	case "-D":
+		handle, err := c.findNFTRule(family, cmd)
+		if err != nil {
+			return err
+		}
+		return c.nft("delete", "rule", family, cmd.table, cmd.chain, "handle", handle)
+	}
+
+	expr, err := translateRule(family, cmd.match, cmd.target)
+	if err != nil {
+		return errors.Wrapf(err, "%q", params)
+	}
+	if err := c.ensureNFTChain(family, cmd.table, cmd.chain); err != nil {
+		return err
+	}
+	verb := "add"
+	if cmd.op == "-I" {
+		verb = "insert"
+	}
+	args := append([]string{verb, "rule", family, cmd.table, cmd.chain}, expr...)
+	return c.nft(append(args, "comment", `"`+cmd.spec()+`"`)...)
+}
+
+// ensureNFTChain creates the table, and the chain if it is one of the standard chains of the table, which iptables
+// always has but nftables only once they are created.
+func (c *Client) ensureNFTChain(family, table, chain string) error {
+	bc, ok := baseChains[table][chain]
+	if !ok {
+		return nil
+	}
+	if err := c.nft("add", "table", family, table); err != nil {
+		return err
+	}
+	return c.nft("add", "chain", family, table, chain, "{", "type", bc.chainType, "hook", bc.hook, "priority",
+		fmt.Sprint(bc.priority), ";", "}")
+}
+
+// findNFTRule returns the handle of the rule, found by its comment.
+func (c *Client) findNFTRule(family string, cmd iptablesCmd) (string, error) {
+	out, err := c.pl.ExecuteCommand(context.TODO(), nft, "-a", "list", "chain", family, cmd.table, cmd.chain)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list chain %s %s %s", family, cmd.table, cmd.chain)
+	}
+	comment := `comment "` + cmd.spec() + `"`
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, comment) {
+			continue
+		}
+		if _, handle, ok := strings.Cut(line, "# handle "); ok {
+			return strings.TrimSpace(handle), nil
+		}
+	}
+	return "", errors.Wrapf(errRuleNotFound, "%s in %s %s %s", cmd.spec(), family, cmd.table, cmd.chain)
+}
+
+func (c *Client) nft(args ...string) error {
+	if _, err := c.pl.ExecuteCommand(context.TODO(), nft, args...); err != nil {
+		return errors.Wrapf(err, "nft %s failed", strings.Join(args, " "))
+	}
+	return nil
+}
+
+// translateRule translates the iptables match and target of a rule to an nftables expression.
+func translateRule(family string, match, target []string) ([]string, error) {
+	var (
+		expr            []string
+		proto, dp, sp   string
+		negate          bool
+		negatableOption = func(opt string) []string {
+			if negate {
+				return []string{opt, "!="}
+			}
+			return []string{opt}
+		}
+	)
+	for i := 0; i < len(match); i++ {
+		opt := match[i]
+		if opt == "!" {
+			negate = true
+			continue
+		}
+		if i+1 >= len(match) {
+			return nil, errors.Wrapf(errUnsupportedRule, "option %s without value", opt)
+		}
+		i++
+		value := match[i]
+		switch opt {
+		case "-s", "--source":
+			expr = append(append(expr, family), append(negatableOption("saddr"), value)...)
+		case "-d", "--destination":
+			expr = append(append(expr, family), append(negatableOption("daddr"), value)...)
+		case "-i", "--in-interface":
+			expr = append(expr, append(negatableOption("iifname"), `"`+value+`"`)...)
+		case "-o", "--out-interface":
+			expr = append(expr, append(negatableOption("oifname"), `"`+value+`"`)...)
+		case "--dst-type":
+			expr = append(append(expr, "fib", "daddr"), append(negatableOption("type"), strings.ToLower(value))...)
+		case "--src-type":
+			expr = append(append(expr, "fib", "saddr"), append(negatableOption("type"), strings.ToLower(value))...)
+		case "-m", "--match":
+			// the options of the modules are translated by themselves
+			if negate {
+				return nil, errors.Wrapf(errUnsupportedRule, "negated %s", opt)
+			}
+			switch value {
+			case "tcp", "udp", "state", "conntrack", "addrtype":
+			default:
+				return nil, errors.Wrapf(errUnsupportedRule, "match module %s", value)
+			}
+		case "--state", "--ctstate":
+			expr = append(append(expr, "ct"), append(negatableOption("state"), strings.ToLower(value))...)
+		case "-p", "--protocol", "--dport", "--destination-port", "--sport", "--source-port":
+			if negate {
+				return nil, errors.Wrapf(errUnsupportedRule, "negated %s", opt)
+			}
+			switch opt {
+			case "-p", "--protocol":
+				proto = value
+			case "--dport", "--destination-port":
+				dp = value
+			default:
+				sp = value
+			}
+		default:
+			return nil, errors.Wrapf(errUnsupportedRule, "option %s", opt)
+		}
+		negate = false
+	}
+	if negate {
+		return nil, errors.Wrap(errUnsupportedRule, "trailing !")
+	}
+
+	switch {
+	case proto == "" && (dp != "" || sp != ""):
+		return nil, errors.Wrap(errUnsupportedRule, "port without protocol")
+	case dp != "" || sp != "":
+		if sp != "" {
+			expr = append(expr, proto, "sport", sp)
+		}
+		if dp != "" {
+			expr = append(expr, proto, "dport", dp)
+		}
+	case proto != "":
+		expr = append(expr, "meta", "l4proto", proto)
+	}
+
+	verdict, err := translateTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return append(expr, verdict...), nil
+}
+
+// translateTarget translates the iptables targets of the client to an nftables statement.
+func translateTarget(target []string) ([]string, error) {
+	if len(target) == 0 {
+		return nil, errors.Wrap(errUnsupportedRule, "rule without target")
+	}
+	name, args := target[0], target[1:]
+	switch {
+	case len(args) == 0 && (name == Accept || name == Drop || name == Return || name == Masquerade):
+		return []string{strings.ToLower(name)}, nil
+	case name == Snat && len(args) == 2 && (args[0] == "--to" || args[0] == "--to-source"):
+		return []string{"snat", "to", args[1]}, nil
+	case name == "MARK" && len(args) == 2 && args[0] == "--set-mark":
+		return []string{"meta", "mark", "set", args[1]}, nil
+	case len(args) == 0:
+		// any other target is a chain
+		return []string{"jump", name}, nil
+	}
+	return nil, errors.Wrapf(errUnsupportedRule, "target %s", strings.Join(target, " "))
+}
@@ -0,0 +1,160 @@
+package iptables
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errNotFound = errors.New("not found")
+
+func TestTranslateRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		family string
+		match  string
+		target string
+		want   string
+	}{
+		{
+			name:   "swift dns snat",
+			family: "ip",
+			match:  " -m addrtype ! --dst-type local -s 10.240.0.0/16 -d 168.63.129.16 -p udp --dport 53",
+			target: "SNAT --to 10.240.0.4",
+			want:   "fib daddr type != local ip saddr 10.240.0.0/16 ip daddr 168.63.129.16 udp dport 53 snat to 10.240.0.4",
+		},
+		{
+			name:   "snat bridge established",
+			family: "ip",
+			match:  " -i azSnatbr -m state --state ESTABLISHED,RELATED",
+			target: "ACCEPT",
+			want:   `iifname "azSnatbr" ct state established,related accept`,
+		},
+		{
+			name:   "block port",
+			family: "ip",
+			match:  "-d 169.254.169.254 -p tcp -m tcp --dport 80",
+			target: "DROP",
+			want:   "ip daddr 169.254.169.254 tcp dport 80 drop",
+		},
+		{
+			name:   "ipv6 snat",
+			family: "ip6",
+			match:  "-s fd00::/64",
+			target: "SNAT --to fd00::4",
+			want:   "ip6 saddr fd00::/64 snat to fd00::4",
+		},
+		{
+			name:   "jump",
+			family: "ip",
+			target: "SWIFT",
+			want:   "jump SWIFT",
+		},
+		{
+			name:   "mark",
+			family: "ip",
+			match:  "! -i eth0 -p udp",
+			target: "MARK --set-mark 333",
+			want:   `iifname != "eth0" meta l4proto udp meta mark set 333`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := translateRule(tt.family, strings.Fields(tt.match), strings.Fields(tt.target))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, strings.Join(expr, " "))
+		})
+	}
+}
+
+func TestTranslateRuleUnsupported(t *testing.T) {
+	for _, match := range []string{"-m comment --comment x", "--dport 53", "! -p udp", "-s"} {
+		_, err := translateRule("ip", strings.Fields(match), []string{Accept})
+		require.ErrorIs(t, err, errUnsupportedRule, match)
+	}
+	_, err := translateRule("ip", nil, []string{"DNAT", "--to-destination", "10.0.0.1"})
+	require.ErrorIs(t, err, errUnsupportedRule)
+}
+
+func TestNFTInsertRule(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{pl: mockPL, backend: BackendNFTables}
+	var cmds []string
+	listed := ""
+	mockPL.SetExecCommand(func(cmd string, args ...string) (string, error) {
+		require.Equal(t, nft, cmd)
+		line := strings.Join(args, " ")
+		cmds = append(cmds, line)
+		if strings.HasPrefix(line, "-a list chain") {
+			return listed, nil
+		}
+		return "", nil
+	})
+
+	// the rule is checked, inserted, then checked again
+	listed = "table ip nat {\n\tchain POSTROUTING {\n\t}\n}\n"
+	err := client.InsertIptableRule(V4, Nat, Postrouting, "-s 10.0.0.0/8", Masquerade)
+	require.ErrorIs(t, err, errCouldNotValidateRuleExists)
+	assert.Equal(t, []string{
+		"-a list chain ip nat POSTROUTING",
+		"add table ip nat",
+		"add chain ip nat POSTROUTING { type nat hook postrouting priority 100 ; }",
+		`insert rule ip nat POSTROUTING ip saddr 10.0.0.0/8 masquerade comment "-s 10.0.0.0/8 -j MASQUERADE"`,
+		"-a list chain ip nat POSTROUTING",
+	}, cmds)
+
+	// an existing rule is found by its comment, and deleted by its handle
+	cmds = nil
+	listed = "table ip nat {\n\tchain POSTROUTING {\n\t\tip saddr 10.0.0.0/8 masquerade comment \"-s 10.0.0.0/8 -j MASQUERADE\" # handle 7\n\t}\n}\n"
+	require.NoError(t, client.InsertIptableRule(V4, Nat, Postrouting, "-s 10.0.0.0/8", Masquerade))
+	require.NoError(t, client.DeleteIptableRule(V4, Nat, Postrouting, "-s 10.0.0.0/8", Masquerade))
+	assert.Equal(t, []string{
+		"-a list chain ip nat POSTROUTING",
+		"-a list chain ip nat POSTROUTING",
+		"delete rule ip nat POSTROUTING handle 7",
+	}, cmds)
+}
+
+func TestNFTCreateChain(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{pl: mockPL, backend: BackendNFTables}
+	var cmds []string
+	mockPL.SetExecCommand(func(_ string, args ...string) (string, error) {
+		line := strings.Join(args, " ")
+		cmds = append(cmds, line)
+		if strings.HasPrefix(line, "list chain") {
+			return "", errNotFound
+		}
+		return "", nil
+	})
+
+	require.NoError(t, client.CreateChain(V6, Filter, CNIInputChain))
+	assert.Equal(t, []string{
+		"list chain ip6 filter AZURECNIINPUT",
+		"add table ip6 filter",
+		"add chain ip6 filter AZURECNIINPUT",
+	}, cmds)
+}
+
+func TestDetectBackend(t *testing.T) {
+	lookPath := func(found ...string) func(string) (string, error) {
+		return func(file string) (string, error) {
+			for _, f := range found {
+				if f == file {
+					return "/usr/sbin/" + file, nil
+				}
+			}
+			return "", errNotFound
+		}
+	}
+
+	// legacy iptables without kernel support
+	assert.Equal(t, BackendNFTables, detectBackend(platform.NewMockExecClient(true), lookPath(iptables, nft)))
+	assert.Equal(t, BackendNFTables, detectBackend(platform.NewMockExecClient(false), lookPath(nft)))
+	assert.Equal(t, BackendIPTables, detectBackend(platform.NewMockExecClient(false), lookPath(iptables, nft)))
+	assert.Equal(t, BackendIPTables, detectBackend(platform.NewMockExecClient(true), lookPath(iptables)))
+}
@@ -0,0 +1,348 @@
+package iptables
+
+// This file programs a set of rules with a single iptables-restore, so they are programmed all at once or not at all.
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	iptablesSave     = "iptables-save"
+	ip6tablesSave    = "ip6tables-save"
+	iptablesRestore  = "iptables-restore"
+	ip6tablesRestore = "ip6tables-restore"
+)
+
+// Transaction is a set of chains and rules of one ip version, programmed by Commit. Like the methods of the client, the
+// chains and rules which already exist aren't created again, and the rules which don't exist aren't deleted.
+type Transaction struct {
+	version string
+	cmds    []iptablesCmd
+}
+
+// NewTransaction returns an empty transaction of the ip version.
+func NewTransaction(version string) *Transaction {
+	return &Transaction{version: version}
+}
+
+// CreateChain creates the chain in the table.
+func (tx *Transaction) CreateChain(tableName, chainName string) {
+	tx.cmds = append(tx.cmds, iptablesCmd{table: tableName, op: "-N", chain: chainName})
+}
+
+// InsertRule inserts the rule at the beginning of the chain.
+func (tx *Transaction) InsertRule(tableName, chainName, match, target string) {
+	tx.addRule("-I", tableName, chainName, match, target)
+}
+
+// AppendRule appends the rule at the end of the chain.
+func (tx *Transaction) AppendRule(tableName, chainName, match, target string) {
+	tx.addRule("-A", tableName, chainName, match, target)
+}
+
+// DeleteRule deletes the rule from the chain.
+func (tx *Transaction) DeleteRule(tableName, chainName, match, target string) {
+	tx.addRule("-D", tableName, chainName, match, target)
+}
+
+// Add adds an entry built by the Get*Cmd methods of the client.
+func (tx *Transaction) Add(entry IPTableEntry) error {
+	if entry.Version != tx.version {
+		return errors.Errorf("entry of version %s added to transaction of version %s", entry.Version, tx.version)
+	}
+	cmd, err := parseIPTablesCmd(entry.Params)
+	if err != nil {
+		return err
+	}
+	if cmd.op == "-nL" || cmd.op == "-C" {
+		return errors.Wrapf(errUnsupportedRule, "%q in transaction", entry.Params)
+	}
+	tx.cmds = append(tx.cmds, cmd)
+	return nil
+}
+
+// Len returns the number of chains and rules in the transaction.
+func (tx *Transaction) Len() int {
+	return len(tx.cmds)
+}
+
+func (tx *Transaction) addRule(op, tableName, chainName, match, target string) {
+	tx.cmds = append(tx.cmds, iptablesCmd{
+		table:  tableName,
+		op:     op,
+		chain:  chainName,
+		match:  strings.Fields(match),
+		target: strings.Fields(target),
+	})
+}
+
+// Commit programs the transaction. The tables it changes are read once with iptables-save, and the chains and rules
+// missing from them are programmed with a single iptables-restore, which either applies all of them or fails without
+// changing the tables. The nftables backend has no such command, and programs them one at a time.
+func (c *Client) Commit(tx *Transaction) error {
+	if tx.Len() == 0 {
+		return nil
+	}
+	if c.backend == BackendNFTables {
+		return c.commitEach(tx)
+	}
+
+	input, changes, err := c.restoreInput(tx)
+	if err != nil {
+		return err
+	}
+	if changes == 0 {
+		logger.Info("iptables rules of transaction already programmed", zap.String("version", tx.version))
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "azure-cni-iptables-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create iptables-restore input")
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(input)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write iptables-restore input")
+	}
+
+	restore := iptablesRestore
+	if tx.version == V6 {
+		restore = ip6tablesRestore
+	}
+	args := []string{"--noflush", f.Name()}
+	if !DisableIPTableLock {
+		args = append([]string{"-w", strconv.Itoa(lockTimeout)}, args...)
+	}
+	logger.Info("Programming iptables rules", zap.String("version", tx.version), zap.Int("changes", changes),
+		zap.String("input", input))
+	if _, err := c.pl.ExecuteCommand(context.TODO(), restore, args...); err != nil {
+		return errors.Wrapf(err, "%s failed", restore)
+	}
+	return nil
+}
+
+// commitEach programs the transaction one chain and rule at a time.
+func (c *Client) commitEach(tx *Transaction) error {
+	for _, cmd := range tx.cmds {
+		match, target := strings.Join(cmd.match, " "), strings.Join(cmd.target, " ")
+		var err error
+		switch cmd.op {
+		case "-N":
+			err = c.CreateChain(tx.version, cmd.table, cmd.chain)
+		case "-I":
+			err = c.InsertIptableRule(tx.version, cmd.table, cmd.chain, match, target)
+		case "-A":
+			err = c.AppendIptableRule(tx.version, cmd.table, cmd.chain, match, target)
+		case "-D":
+			if c.RuleExists(tx.version, cmd.table, cmd.chain, match, target) {
+				err = c.DeleteIptableRule(tx.version, cmd.table, cmd.chain, match, target)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreInput returns the iptables-restore input of the changes of the transaction to the tables, and the number of
+// changes.
+func (c *Client) restoreInput(tx *Transaction) (string, int, error) {
+	var tables []string
+	byTable := map[string][]iptablesCmd{}
+	for _, cmd := range tx.cmds {
+		if _, ok := byTable[cmd.table]; !ok {
+			tables = append(tables, cmd.table)
+		}
+		byTable[cmd.table] = append(byTable[cmd.table], cmd)
+	}
+
+	var (
+		input   strings.Builder
+		changes int
+	)
+	for _, table := range tables {
+		saved, err := c.saveTable(tx.version, table)
+		if err != nil {
+			return "", 0, err
+		}
+
+		var chains, rules []string
+		for _, cmd := range byTable[table] {
+			key := cmd.chain + " " + canonicalRule(cmd.match, cmd.target)
+			switch cmd.op {
+			case "-N":
+				if !saved.chains[cmd.chain] {
+					// declaring an existing chain would flush it
+					chains = append(chains, fmt.Sprintf(":%s - [0:0]", cmd.chain))
+					saved.chains[cmd.chain] = true
+				}
+			case "-I", "-A":
+				if !saved.rules[key] {
+					pos := ""
+					if cmd.op == "-I" {
+						pos = " 1"
+					}
+					rules = append(rules, fmt.Sprintf("%s %s%s %s", cmd.op, cmd.chain, pos, cmd.rule()))
+					saved.rules[key] = true
+				}
+			case "-D":
+				if saved.rules[key] {
+					rules = append(rules, fmt.Sprintf("-D %s %s", cmd.chain, cmd.rule()))
+					delete(saved.rules, key)
+				}
+			}
+		}
+		if len(chains)+len(rules) == 0 {
+			continue
+		}
+		changes += len(chains) + len(rules)
+		fmt.Fprintf(&input, "*%s\n", table)
+		for _, line := range append(chains, rules...) {
+			fmt.Fprintln(&input, line)
+		}
+		fmt.Fprintln(&input, "COMMIT")
+	}
+	return input.String(), changes, nil
+}
+
+// savedTable is the chains and rules of a table, the rules keyed by their chain and canonical form.
+type savedTable struct {
+	chains map[string]bool
+	rules  map[string]bool
+}
+
+// saveTable reads the table with iptables-save.
+func (c *Client) saveTable(version, table string) (savedTable, error) {
+	save := iptablesSave
+	if version == V6 {
+		save = ip6tablesSave
+	}
+	out, err := c.pl.ExecuteCommand(context.TODO(), save, "-t", table)
+	if err != nil {
+		return savedTable{}, errors.Wrapf(err, "%s -t %s failed", save, table)
+	}
+	return parseSave(out), nil
+}
+
+// parseSave parses the output of iptables-save for a single table.
+func parseSave(out string) savedTable {
+	t := savedTable{chains: map[string]bool{}, rules: map[string]bool{}}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) > 0 && strings.HasPrefix(fields[0], ":"):
+			t.chains[strings.TrimPrefix(fields[0], ":")] = true
+		case len(fields) > 1 && fields[0] == "-A":
+			match, target := fields[2:], []string(nil)
+			for i, f := range match {
+				if f == "-j" {
+					match, target = match[:i], match[i+1:]
+					break
+				}
+			}
+			t.rules[fields[1]+" "+canonicalRule(match, target)] = true
+		}
+	}
+	return t
+}
+
+// longOptions are the long options of the client's rules with the short form iptables-save prints.
+var longOptions = map[string]string{
+	"--source":           "-s",
+	"--destination":      "-d",
+	"--in-interface":     "-i",
+	"--out-interface":    "-o",
+	"--protocol":         "-p",
+	"--destination-port": "--dport",
+	"--source-port":      "--sport",
+}
+
+// canonicalRule returns the form of a rule which is the same for the rule as the client builds it and as
+// iptables-save prints it. iptables-save adds the modules of the options, orders them its own way, prints the
+// addresses as networks and the targets with their long options, all of which the form leaves out or normalizes.
+func canonicalRule(match, target []string) string {
+	var clauses []string
+	for i := 0; i < len(match); i++ {
+		clause := ""
+		if match[i] == "!" && i+1 < len(match) {
+			clause = "! "
+			i++
+		}
+		opt := match[i]
+		var values []string
+		for i+1 < len(match) && match[i+1] != "!" && !strings.HasPrefix(match[i+1], "-") {
+			i++
+			values = append(values, match[i])
+		}
+		if opt == "-m" || opt == "--match" {
+			continue
+		}
+		if short, ok := longOptions[opt]; ok {
+			opt = short
+		}
+		values = canonicalValues(opt, values)
+		clauses = append(clauses, clause+strings.Join(append([]string{opt}, values...), " "))
+	}
+	sort.Strings(clauses)
+	return strings.Join(clauses, " ") + " -j " + strings.Join(canonicalTarget(target), " ")
+}
+
+func canonicalValues(opt string, values []string) []string {
+	if len(values) != 1 {
+		return values
+	}
+	value := values[0]
+	switch opt {
+	case "-s", "-d":
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil {
+				if ip.To4() != nil {
+					value += "/32"
+				} else {
+					value += "/128"
+				}
+			}
+		}
+		if _, ipNet, err := net.ParseCIDR(value); err == nil {
+			value = ipNet.String()
+		}
+	case "--state", "--ctstate":
+		states := strings.Split(strings.ToUpper(value), ",")
+		sort.Strings(states)
+		value = strings.Join(states, ",")
+	case "--dst-type", "--src-type":
+		value = strings.ToUpper(value)
+	case "-p":
+		value = strings.ToLower(value)
+	}
+	return []string{value}
+}
+
+func canonicalTarget(target []string) []string {
+	if len(target) != 3 {
+		return target
+	}
+	switch {
+	case target[0] == Snat && target[1] == "--to":
+		return []string{Snat, "--to-source", target[2]}
+	case target[0] == "MARK" && target[1] == "--set-mark":
+		if mark, err := strconv.ParseUint(target[2], 0, 32); err == nil {
+			return []string{"MARK", "--set-xmark", fmt.Sprintf("0x%x/0xffffffff", mark)}
+		}
+	}
+	return target
+}
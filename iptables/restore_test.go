@@ -0,0 +1,141 @@
+package iptables
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const savedFilter = `# Generated by iptables-save v1.8.7 on Thu Oct 15 10:00:00 2026
+*filter
+:INPUT ACCEPT [0:0]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:AZURECNIOUTPUT - [0:0]
+-A OUTPUT -j AZURECNIOUTPUT
+-A AZURECNIOUTPUT -s 169.254.0.1/32 -d 169.254.0.4/32 -j ACCEPT
+-A AZURECNIOUTPUT -o azSnatbr -m state --state RELATED,ESTABLISHED -j ACCEPT
+-A FORWARD -d 168.63.129.16/32 -i azSnatbr -j ACCEPT
+COMMIT
+# Completed on Thu Oct 15 10:00:00 2026
+`
+
+const savedNat = `*nat
+:PREROUTING ACCEPT [0:0]
+:POSTROUTING ACCEPT [0:0]
+:SWIFT - [0:0]
+-A POSTROUTING -j SWIFT
+-A SWIFT -s 10.0.1.0/24 -d 168.63.129.16/32 -p udp -m addrtype ! --dst-type LOCAL -m udp --dport 53 -j SNAT --to-source 10.0.1.20
+COMMIT
+`
+
+func TestCanonicalRule(t *testing.T) {
+	saved := parseSave(savedFilter + savedNat)
+	for _, rule := range []struct{ chain, match, target string }{
+		{Output, "", CNIOutputChain},
+		{CNIOutputChain, "-s 169.254.0.1 -d 169.254.0.4", Accept},
+		{CNIOutputChain, " -o azSnatbr -m state --state ESTABLISHED,RELATED", Accept},
+		{Forward, "-i azSnatbr -d 168.63.129.16", Accept},
+		{Swift, " -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p udp --dport 53", "SNAT --to 10.0.1.20"},
+	} {
+		key := rule.chain + " " + canonicalRule(strings.Fields(rule.match), strings.Fields(rule.target))
+		assert.True(t, saved.rules[key], "%+v", rule)
+	}
+
+	// the target, negation and chain are part of the rule
+	for _, rule := range []struct{ chain, match, target string }{
+		{CNIOutputChain, "-s 169.254.0.1 -d 169.254.0.4", Drop},
+		{CNIOutputChain, "! -s 169.254.0.1 -d 169.254.0.4", Accept},
+		{CNIInputChain, "-s 169.254.0.1 -d 169.254.0.4", Accept},
+		{Swift, " -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p udp --dport 53", "SNAT --to 10.0.1.21"},
+	} {
+		key := rule.chain + " " + canonicalRule(strings.Fields(rule.match), strings.Fields(rule.target))
+		assert.False(t, saved.rules[key], "%+v", rule)
+	}
+	assert.True(t, saved.chains[CNIOutputChain])
+	assert.False(t, saved.chains[CNIInputChain])
+}
+
+func TestCommit(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{pl: mockPL}
+	var (
+		cmds  []string
+		input string
+	)
+	mockPL.SetExecCommand(func(cmd string, args ...string) (string, error) {
+		cmds = append(cmds, cmd+" "+strings.Join(args[:len(args)-1], " "))
+		switch cmd {
+		case iptablesSave:
+			if args[1] == Nat {
+				return savedNat, nil
+			}
+			return savedFilter, nil
+		case iptablesRestore:
+			b, err := os.ReadFile(args[len(args)-1])
+			require.NoError(t, err)
+			input = string(b)
+		}
+		return "", nil
+	})
+
+	tx := NewTransaction(V4)
+	tx.CreateChain(Filter, CNIOutputChain)
+	tx.InsertRule(Filter, Output, "", CNIOutputChain)
+	tx.InsertRule(Filter, CNIOutputChain, "-s 169.254.0.1 -d 169.254.0.4", Accept)
+	tx.CreateChain(Filter, CNIInputChain)
+	tx.InsertRule(Filter, Input, "", CNIInputChain)
+	tx.InsertRule(Filter, CNIInputChain, " -i azSnatbr -m state --state ESTABLISHED,RELATED", Accept)
+	tx.AppendRule(Filter, Forward, "", Accept)
+	tx.DeleteRule(Filter, Forward, "-i azSnatbr -d 168.63.129.16", Accept)
+	tx.DeleteRule(Filter, Forward, "-i azSnatbr -d 10.0.0.0/8", Drop)
+	require.NoError(t, tx.Add(client.GetCreateChainCmd(V4, Nat, Swift)))
+	require.NoError(t, tx.Add(client.GetAppendIptableRuleCmd(V4, Nat, Postrouting, "", Swift)))
+	require.NoError(t, client.Commit(tx))
+
+	// the tables are read once, and only the missing chains and rules, and the existing rules to delete, are restored
+	assert.Equal(t, []string{
+		"iptables-save -t",
+		"iptables-save -t",
+		"iptables-restore -w 60 --noflush",
+	}, cmds)
+	assert.Equal(t, `*filter
+:AZURECNIINPUT - [0:0]
+-I INPUT 1 -j AZURECNIINPUT
+-I AZURECNIINPUT 1 -i azSnatbr -m state --state ESTABLISHED,RELATED -j ACCEPT
+-A FORWARD -j ACCEPT
+-D FORWARD -i azSnatbr -d 168.63.129.16 -j ACCEPT
+COMMIT
+`, input)
+
+	// nothing is restored once everything is programmed
+	cmds = nil
+	tx = NewTransaction(V4)
+	tx.CreateChain(Nat, Swift)
+	tx.AppendRule(Nat, Postrouting, "", Swift)
+	tx.InsertRule(Nat, Swift, " -m addrtype ! --dst-type local -s 10.0.1.0/24 -d 168.63.129.16 -p udp --dport 53", "SNAT --to 10.0.1.20")
+	require.NoError(t, client.Commit(tx))
+	assert.Equal(t, []string{"iptables-save -t"}, cmds)
+}
+
+func TestCommitFailure(t *testing.T) {
+	mockPL := platform.NewMockExecClient(false)
+	client := &Client{pl: mockPL}
+	mockPL.SetExecCommand(func(cmd string, _ ...string) (string, error) {
+		if cmd == iptablesRestore {
+			return "", platform.ErrMockExec
+		}
+		return "", nil
+	})
+
+	tx := NewTransaction(V4)
+	tx.InsertRule(Nat, Postrouting, "-s 169.254.0.0/16", Masquerade)
+	require.ErrorIs(t, client.Commit(tx), platform.ErrMockExec)
+
+	require.Error(t, tx.Add(client.GetAppendIptableRuleCmd(V6, Nat, Postrouting, "", Swift)))
+	require.ErrorIs(t, tx.Add(IPTableEntry{Version: V4, Params: "-t nat -C SWIFT -j RETURN"}), errUnsupportedRule)
+}
@@ -16,6 +16,14 @@ type MockNetIO struct {
 	failAttempt    int
 	numTimesCalled int
 	getInterfaceFn getInterfaceValidationFn
+	netNsIfaces    map[string][]MockNetNsInterface
+}
+
+// MockNetNsInterface is an interface in a network namespace of the mock.
+type MockNetNsInterface struct {
+	Interface net.Interface
+	Addrs     []net.Addr
+	Stats     InterfaceStats
 }
 
 // ErrMockNetIOFail - mock netio error
@@ -36,6 +44,14 @@ func (netshim *MockNetIO) SetGetInterfaceValidatonFn(fn getInterfaceValidationFn
 	netshim.getInterfaceFn = fn
 }
 
+// SetNetNsInterfaces sets the interfaces in the network namespace at the path.
+func (netshim *MockNetIO) SetNetNsInterfaces(netNsPath string, ifaces []MockNetNsInterface) {
+	if netshim.netNsIfaces == nil {
+		netshim.netNsIfaces = make(map[string][]MockNetNsInterface)
+	}
+	netshim.netNsIfaces[netNsPath] = ifaces
+}
+
 func (netshim *MockNetIO) GetNetworkInterfaceByName(name string) (*net.Interface, error) {
 	netshim.numTimesCalled++
 
@@ -86,3 +102,43 @@ func (netshim *MockNetIO) GetNetworkInterfaceByMac(mac net.HardwareAddr) (*net.I
 
 	return nil, fmt.Errorf("%w: %s", ErrMockNetIOFail, mac)
 }
+
+func (netshim *MockNetIO) GetNetworkInterfacesInNetNs(netNsPath string) ([]net.Interface, error) {
+	if netshim.fail {
+		return nil, fmt.Errorf("%w: %s", ErrMockNetIOFail, netNsPath)
+	}
+	ifaces := make([]net.Interface, 0, len(netshim.netNsIfaces[netNsPath]))
+	for i := range netshim.netNsIfaces[netNsPath] {
+		ifaces = append(ifaces, netshim.netNsIfaces[netNsPath][i].Interface)
+	}
+	return ifaces, nil
+}
+
+func (netshim *MockNetIO) GetNetworkInterfaceAddrsInNetNs(netNsPath, ifName string) ([]net.Addr, error) {
+	iface, err := netshim.netNsInterface(netNsPath, ifName)
+	if err != nil {
+		return nil, err
+	}
+	return iface.Addrs, nil
+}
+
+func (netshim *MockNetIO) GetNetworkInterfaceStatsInNetNs(netNsPath, ifName string) (*InterfaceStats, error) {
+	iface, err := netshim.netNsInterface(netNsPath, ifName)
+	if err != nil {
+		return nil, err
+	}
+	stats := iface.Stats
+	return &stats, nil
+}
+
+func (netshim *MockNetIO) netNsInterface(netNsPath, ifName string) (*MockNetNsInterface, error) {
+	if netshim.fail {
+		return nil, fmt.Errorf("%w: %s", ErrMockNetIOFail, netNsPath)
+	}
+	for i := range netshim.netNsIfaces[netNsPath] {
+		if netshim.netNsIfaces[netNsPath][i].Interface.Name == ifName {
+			return &netshim.netNsIfaces[netNsPath][i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in %s", ErrInterfaceNotFound, ifName, netNsPath)
+}
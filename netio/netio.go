@@ -12,6 +12,22 @@ type NetIOInterface interface {
 	GetNetworkInterfaceByName(name string) (*net.Interface, error)
 	GetNetworkInterfaceAddrs(iface *net.Interface) ([]net.Addr, error)
 	GetNetworkInterfaceByMac(mac net.HardwareAddr) (*net.Interface, error)
+	// GetNetworkInterfacesInNetNs returns the interfaces in the network namespace at the path.
+	GetNetworkInterfacesInNetNs(netNsPath string) ([]net.Interface, error)
+	// GetNetworkInterfaceAddrsInNetNs returns the addresses of the interface in the network namespace at the path.
+	GetNetworkInterfaceAddrsInNetNs(netNsPath, ifName string) ([]net.Addr, error)
+	// GetNetworkInterfaceStatsInNetNs returns the traffic counters of the interface in the network namespace at the path.
+	GetNetworkInterfaceStatsInNetNs(netNsPath, ifName string) (*InterfaceStats, error)
+}
+
+// InterfaceStats are the traffic counters of an interface.
+type InterfaceStats struct {
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	RxDropped uint64
+	TxDropped uint64
 }
 
 // ErrInterfaceNil - errors out when interface is nil
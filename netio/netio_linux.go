@@ -0,0 +1,91 @@
+package netio
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// withNetNsHandle calls fn with a netlink handle in the network namespace at the path. The handle works on a socket
+// opened in the namespace, so the calling thread stays in its own namespace.
+func withNetNsHandle(netNsPath string, fn func(h *netlink.Handle) error) error {
+	ns, err := netns.GetFromPath(netNsPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open netns %s", netNsPath)
+	}
+	defer ns.Close()
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get a netlink handle in netns %s", netNsPath)
+	}
+	defer h.Close()
+	return fn(h)
+}
+
+func (ns *NetIO) GetNetworkInterfacesInNetNs(netNsPath string) ([]net.Interface, error) {
+	var ifaces []net.Interface
+	err := withNetNsHandle(netNsPath, func(h *netlink.Handle) error {
+		links, err := h.LinkList()
+		if err != nil {
+			return errors.Wrap(err, "failed to list links")
+		}
+		for _, link := range links {
+			attrs := link.Attrs()
+			ifaces = append(ifaces, net.Interface{
+				Index:        attrs.Index,
+				MTU:          attrs.MTU,
+				Name:         attrs.Name,
+				HardwareAddr: attrs.HardwareAddr,
+				Flags:        attrs.Flags,
+			})
+		}
+		return nil
+	})
+	return ifaces, errors.Wrap(err, "GetNetworkInterfacesInNetNs failed")
+}
+
+func (ns *NetIO) GetNetworkInterfaceAddrsInNetNs(netNsPath, ifName string) ([]net.Addr, error) {
+	var addrs []net.Addr
+	err := withNetNsHandle(netNsPath, func(h *netlink.Handle) error {
+		link, err := h.LinkByName(ifName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get link %s", ifName)
+		}
+		list, err := h.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return errors.Wrapf(err, "failed to list addresses of %s", ifName)
+		}
+		for i := range list {
+			addrs = append(addrs, &net.IPNet{IP: list[i].IP, Mask: list[i].Mask})
+		}
+		return nil
+	})
+	return addrs, errors.Wrap(err, "GetNetworkInterfaceAddrsInNetNs failed")
+}
+
+func (ns *NetIO) GetNetworkInterfaceStatsInNetNs(netNsPath, ifName string) (*InterfaceStats, error) {
+	var stats *InterfaceStats
+	err := withNetNsHandle(netNsPath, func(h *netlink.Handle) error {
+		link, err := h.LinkByName(ifName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get link %s", ifName)
+		}
+		s := link.Attrs().Statistics
+		if s == nil {
+			return errors.Errorf("link %s has no statistics", ifName)
+		}
+		stats = &InterfaceStats{
+			RxBytes:   s.RxBytes,
+			TxBytes:   s.TxBytes,
+			RxPackets: s.RxPackets,
+			TxPackets: s.TxPackets,
+			RxDropped: s.RxDropped,
+			TxDropped: s.TxDropped,
+		}
+		return nil
+	})
+	return stats, errors.Wrap(err, "GetNetworkInterfaceStatsInNetNs failed")
+}
@@ -0,0 +1,22 @@
+package netio
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNetNsNotSupported is returned by the network namespace operations, which windows has no equivalent of.
+var ErrNetNsNotSupported = errors.New("network namespaces are not supported on windows")
+
+func (ns *NetIO) GetNetworkInterfacesInNetNs(string) ([]net.Interface, error) {
+	return nil, ErrNetNsNotSupported
+}
+
+func (ns *NetIO) GetNetworkInterfaceAddrsInNetNs(string, string) ([]net.Addr, error) {
+	return nil, ErrNetNsNotSupported
+}
+
+func (ns *NetIO) GetNetworkInterfaceStatsInNetNs(string, string) (*InterfaceStats, error) {
+	return nil, ErrNetNsNotSupported
+}
@@ -20,6 +20,9 @@ const (
 	RT_SCOPE_NOWHERE  = 255
 )
 
+// RTNH_F_ONLINK is the route flag of a gateway reachable on the link, whatever its subnets.
+const RTNH_F_ONLINK = unix.RTNH_F_ONLINK
+
 const (
 	RTPROT_KERNEL = 2
 )
@@ -94,6 +97,9 @@ type Route struct {
 	Priority   int
 	LinkIndex  int
 	ILinkIndex int
+	// MTU and AdvMSS are the route metrics of the same names, unset when 0.
+	MTU    int
+	AdvMSS int
 }
 
 // deserializeRoute decodes a netlink message into a Route struct.
@@ -133,12 +139,36 @@ func deserializeRoute(msg *message) (*Route, error) {
 			route.LinkIndex = int(encoder.Uint32(attr.value[0:4]))
 		case unix.RTA_IIF:
 			route.ILinkIndex = int(encoder.Uint32(attr.value[0:4]))
+		case unix.RTA_METRICS:
+			route.MTU, route.AdvMSS = deserializeRouteMetrics(attr.value)
 		}
 	}
 
 	return &route, nil
 }
 
+// deserializeRouteMetrics decodes the mtu and advmss of the nested metrics attributes of a route.
+func deserializeRouteMetrics(b []byte) (mtu, advMSS int) {
+	for len(b) >= unix.SizeofRtAttr {
+		length := int(encoder.Uint16(b[0:2]))
+		if length < unix.SizeofRtAttr+4 || length > len(b) {
+			break
+		}
+		switch encoder.Uint16(b[2:4]) {
+		case unix.RTAX_MTU:
+			mtu = int(encoder.Uint32(b[4:8]))
+		case unix.RTAX_ADVMSS:
+			advMSS = int(encoder.Uint32(b[4:8]))
+		}
+		length = (length + unix.RTA_ALIGNTO - 1) & ^(unix.RTA_ALIGNTO - 1)
+		if length > len(b) {
+			break
+		}
+		b = b[length:]
+	}
+	return mtu, advMSS
+}
+
 // GetIPRoute returns a list of IP routes matching the given filter.
 func (Netlink) GetIPRoute(filter *Route) ([]*Route, error) {
 	s, err := getSocket()
@@ -276,6 +306,17 @@ func setIpRoute(route *Route, add bool) error {
 		req.addPayload(newAttributeUint32(unix.RTA_IIF, uint32(route.ILinkIndex)))
 	}
 
+	if add && (route.MTU != 0 || route.AdvMSS != 0) {
+		metrics := newAttribute(unix.RTA_METRICS, nil)
+		if route.MTU != 0 {
+			metrics.addNested(newAttributeUint32(unix.RTAX_MTU, uint32(route.MTU)))
+		}
+		if route.AdvMSS != 0 {
+			metrics.addNested(newAttributeUint32(unix.RTAX_ADVMSS, uint32(route.AdvMSS)))
+		}
+		req.addPayload(metrics)
+	}
+
 	return s.sendAndWaitForAck(req)
 }
 
@@ -17,10 +17,14 @@ import (
 
 // Link types.
 const (
-	LINK_TYPE_BRIDGE = "bridge"
-	LINK_TYPE_VETH   = "veth"
-	LINK_TYPE_IPVLAN = "ipvlan"
-	LINK_TYPE_DUMMY  = "dummy"
+	LINK_TYPE_BRIDGE  = "bridge"
+	LINK_TYPE_VETH    = "veth"
+	LINK_TYPE_IPVLAN  = "ipvlan"
+	LINK_TYPE_IPVTAP  = "ipvtap"
+	LINK_TYPE_DUMMY   = "dummy"
+	LINK_TYPE_VLAN    = "vlan"
+	LINK_TYPE_MACVLAN = "macvlan"
+	LINK_TYPE_VXLAN   = "vxlan"
 )
 
 // IPVLAN link attributes.
@@ -33,6 +37,16 @@ const (
 	IPVLAN_MODE_MAX
 )
 
+// MACVLAN link attributes.
+type MacvlanMode uint32
+
+const (
+	MACVLAN_MODE_PRIVATE MacvlanMode = 1 << iota
+	MACVLAN_MODE_VEPA
+	MACVLAN_MODE_BRIDGE
+	MACVLAN_MODE_PASSTHRU
+)
+
 const (
 	ADD = iota
 	REMOVE
@@ -70,12 +84,32 @@ type VEthLink struct {
 	PeerName string
 }
 
-// IPVlanLink represents an IPVlan network interface.
+// IPVlanLink represents an IPVlan network interface, or an IPVTap one with the LINK_TYPE_IPVTAP type.
 type IPVlanLink struct {
 	LinkInfo
 	Mode IPVlanMode
 }
 
+// MacvlanLink represents a Macvlan network interface, which has its own mac address on its parent.
+type MacvlanLink struct {
+	LinkInfo
+	Mode MacvlanMode
+}
+
+// VxlanLink represents a vxlan tunnel interface over its parent. The remote ends of the tunnel are only those of the
+// forwarding database entries the interface is given, as it doesn't learn them.
+type VxlanLink struct {
+	LinkInfo
+	VxlanID int
+	Port    int
+}
+
+// VlanLink represents an 802.1q vlan sub-interface of its parent.
+type VlanLink struct {
+	LinkInfo
+	VlanID int
+}
+
 // DummyLink represents a dummy network interface.
 type DummyLink struct {
 	LinkInfo
@@ -151,6 +185,31 @@ func (Netlink) AddLink(link Link) error {
 		attrData := newAttribute(IFLA_INFO_DATA, nil)
 		attrData.addNested(newAttributeUint16(IFLA_IPVLAN_MODE, uint16(ipvlan.Mode)))
 
+		attrLinkInfo.addNested(attrData)
+	} else if macvlan, ok := link.(*MacvlanLink); ok {
+		// Set Macvlan attributes.
+		attrData := newAttribute(IFLA_INFO_DATA, nil)
+		attrData.addNested(newAttributeUint32(IFLA_MACVLAN_MODE, uint32(macvlan.Mode)))
+
+		attrLinkInfo.addNested(attrData)
+	} else if vxlan, ok := link.(*VxlanLink); ok {
+		// Set vxlan attributes.
+		attrData := newAttribute(IFLA_INFO_DATA, nil)
+		attrData.addNested(newAttributeUint32(IFLA_VXLAN_ID, uint32(vxlan.VxlanID)))
+		if vxlan.ParentIndex != 0 {
+			attrData.addNested(newAttributeUint32(IFLA_VXLAN_LINK, uint32(vxlan.ParentIndex)))
+		}
+		attrData.addNested(newAttributeUint8(IFLA_VXLAN_LEARNING, 0))
+		if vxlan.Port != 0 {
+			attrData.addNested(newAttributeUint16BigEndian(IFLA_VXLAN_PORT, uint16(vxlan.Port)))
+		}
+
+		attrLinkInfo.addNested(attrData)
+	} else if vlan, ok := link.(*VlanLink); ok {
+		// Set vlan attributes.
+		attrData := newAttribute(IFLA_INFO_DATA, nil)
+		attrData.addNested(newAttributeUint16(IFLA_VLAN_ID, uint16(vlan.VlanID)))
+
 		attrLinkInfo.addNested(attrData)
 	}
 
@@ -23,6 +23,7 @@ type MockNetlink struct {
 	deleteRouteFn routeValidateFn
 	addRouteFn    routeValidateFn
 	DeleteLinkFn  func(name string) error
+	AddLinkFn     func(l Link) error
 }
 
 func NewMockNetlink(returnError bool, errorString string) *MockNetlink {
@@ -48,6 +49,9 @@ func (f *MockNetlink) error() error {
 }
 
 func (f *MockNetlink) AddLink(l Link) error {
+	if f.AddLinkFn != nil {
+		return f.AddLinkFn(l)
+	}
 	return f.error()
 }
 
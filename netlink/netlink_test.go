@@ -172,6 +172,34 @@ func TestAddDeleteIPVlan(t *testing.T) {
 	}
 }
 
+// TestAddDeleteVlan tests adding and deleting a vlan interface.
+func TestAddDeleteVlan(t *testing.T) {
+	dummy, err := addDummyInterface(dummyName)
+	require.NoError(t, err)
+
+	link := VlanLink{
+		LinkInfo: LinkInfo{
+			Type:        LINK_TYPE_VLAN,
+			Name:        ifName,
+			ParentIndex: dummy.Index,
+		},
+		VlanID: 100,
+	}
+	nl := NewNetlink()
+
+	err = nl.AddLink(&link)
+	require.NoError(t, err, "AddLink failed")
+
+	_, err = net.InterfaceByName(ifName)
+	require.NoError(t, err, "vlan interface not created")
+
+	err = nl.DeleteLink(ifName)
+	require.NoError(t, err, "DeleteLink failed")
+
+	err = nl.DeleteLink(dummyName)
+	require.NoError(t, err, "DeleteLink failed")
+}
+
 // TestSetLinkState tests setting the operational state of a network interface.
 func TestSetLinkState(t *testing.T) {
 	_, err := addDummyInterface(ifName)
@@ -383,3 +411,13 @@ func TestAddDeleteRoute(t *testing.T) {
 		t.Errorf("DeleteLink failed: %+v", err)
 	}
 }
+
+func TestRouteMetrics(t *testing.T) {
+	metrics := newAttribute(unix.RTA_METRICS, nil)
+	metrics.addNested(newAttributeUint32(unix.RTAX_MTU, 1400))
+	metrics.addNested(newAttributeUint32(unix.RTAX_ADVMSS, 1360))
+
+	mtu, advMSS := deserializeRouteMetrics(metrics.serialize()[unix.SizeofRtAttr:])
+	require.Equal(t, 1400, mtu)
+	require.Equal(t, 1360, advMSS)
+}
@@ -50,13 +50,19 @@ const (
 
 // Netlink protocol constants that are not already defined in unix package.
 const (
-	IFLA_INFO_KIND   = 1
-	IFLA_INFO_DATA   = 2
-	IFLA_NET_NS_FD   = 28
-	IFLA_IPVLAN_MODE = 1
-	IFLA_BRPORT_MODE = 4
-	VETH_INFO_PEER   = 1
-	DEFAULT_CHANGE   = 0xFFFFFFFF
+	IFLA_INFO_KIND      = 1
+	IFLA_INFO_DATA      = 2
+	IFLA_NET_NS_FD      = 28
+	IFLA_IPVLAN_MODE    = 1
+	IFLA_VLAN_ID        = 1
+	IFLA_MACVLAN_MODE   = 1
+	IFLA_VXLAN_ID       = 1
+	IFLA_VXLAN_LINK     = 3
+	IFLA_VXLAN_LEARNING = 7
+	IFLA_VXLAN_PORT     = 15
+	IFLA_BRPORT_MODE    = 4
+	VETH_INFO_PEER      = 1
+	DEFAULT_CHANGE      = 0xFFFFFFFF
 )
 
 // Serializable types are used to construct netlink messages.
@@ -220,6 +226,18 @@ func newAttributeUint16(attrType int, value uint16) *attribute {
 	return newAttribute(attrType, buf)
 }
 
+// Creates a new attribute with a uint16 value in network byte order.
+func newAttributeUint16BigEndian(attrType int, value uint16) *attribute {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, value)
+	return newAttribute(attrType, buf)
+}
+
+// Creates a new attribute with a uint8 value.
+func newAttributeUint8(attrType int, value uint8) *attribute {
+	return newAttribute(attrType, []byte{value})
+}
+
 // Creates a new attribute with a net.IP value.
 func newAttributeIpAddress(attrType int, value net.IP) *attribute {
 	addr := value.To4()
@@ -0,0 +1,58 @@
+package netlink
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-container-networking/internal/undo"
+)
+
+// Transaction is a NetlinkInterface which pushes the inverses of the links, addresses and routes it adds and of the links
+// it renames on an undo stack, so that they are undone when a later step of the configuration they are part of fails.
+// The changes are undone through the same socket, so the ones made in a network namespace must be rolled back before
+// leaving it.
+type Transaction struct {
+	NetlinkInterface
+	*undo.Stack
+}
+
+// NewTransaction returns a transaction making its changes with nl, and pushing their inverses on stack.
+func NewTransaction(nl NetlinkInterface, stack *undo.Stack) *Transaction {
+	return &Transaction{NetlinkInterface: nl, Stack: stack}
+}
+
+func (tx *Transaction) AddLink(link Link) error {
+	if err := tx.NetlinkInterface.AddLink(link); err != nil {
+		return err //nolint:wrapcheck // the transaction is transparent
+	}
+	name := link.Info().Name
+	tx.Push("delete link "+name, func() error { return tx.NetlinkInterface.DeleteLink(name) })
+	return nil
+}
+
+func (tx *Transaction) SetLinkName(name, newName string) error {
+	if err := tx.NetlinkInterface.SetLinkName(name, newName); err != nil {
+		return err //nolint:wrapcheck // the transaction is transparent
+	}
+	tx.Push(fmt.Sprintf("rename link %s back to %s", newName, name), func() error { return tx.NetlinkInterface.SetLinkName(newName, name) })
+	return nil
+}
+
+func (tx *Transaction) AddIPAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
+	if err := tx.NetlinkInterface.AddIPAddress(ifName, ipAddress, ipNet); err != nil {
+		return err //nolint:wrapcheck // the transaction is transparent
+	}
+	tx.Push(fmt.Sprintf("delete address %v from %s", ipNet, ifName), func() error {
+		return tx.NetlinkInterface.DeleteIPAddress(ifName, ipAddress, ipNet)
+	})
+	return nil
+}
+
+func (tx *Transaction) AddIPRoute(route *Route) error {
+	if err := tx.NetlinkInterface.AddIPRoute(route); err != nil {
+		return err //nolint:wrapcheck // the transaction is transparent
+	}
+	added := *route
+	tx.Push(fmt.Sprintf("delete route %+v", added), func() error { return tx.NetlinkInterface.DeleteIPRoute(&added) })
+	return nil
+}
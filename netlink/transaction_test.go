@@ -0,0 +1,84 @@
+package netlink
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/internal/undo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNetlink records the calls made through it, and fails the deletes of the links in failDelete.
+type recordingNetlink struct {
+	MockNetlink
+	calls      []string
+	failDelete map[string]bool
+}
+
+func (r *recordingNetlink) AddLink(link Link) error {
+	r.calls = append(r.calls, "add link "+link.Info().Name)
+	return nil
+}
+
+func (r *recordingNetlink) DeleteLink(name string) error {
+	r.calls = append(r.calls, "delete link "+name)
+	if r.failDelete[name] {
+		return ErrorMockNetlink
+	}
+	return nil
+}
+
+func (r *recordingNetlink) SetLinkName(name, newName string) error {
+	r.calls = append(r.calls, fmt.Sprintf("rename link %s to %s", name, newName))
+	return nil
+}
+
+func (r *recordingNetlink) AddIPAddress(ifName string, _ net.IP, ipNet *net.IPNet) error {
+	r.calls = append(r.calls, fmt.Sprintf("add address %v to %s", ipNet, ifName))
+	return nil
+}
+
+func (r *recordingNetlink) DeleteIPAddress(ifName string, _ net.IP, ipNet *net.IPNet) error {
+	r.calls = append(r.calls, fmt.Sprintf("delete address %v from %s", ipNet, ifName))
+	return nil
+}
+
+func (r *recordingNetlink) AddIPRoute(*Route) error {
+	r.calls = append(r.calls, "add route")
+	return nil
+}
+
+func (r *recordingNetlink) DeleteIPRoute(*Route) error {
+	r.calls = append(r.calls, "delete route")
+	return nil
+}
+
+func TestTransactionRollback(t *testing.T) {
+	nl := &recordingNetlink{failDelete: map[string]bool{"azv1": true}}
+	tx := NewTransaction(nl, &undo.Stack{})
+	_, ipNet, _ := net.ParseCIDR("10.0.0.4/24")
+
+	require.NoError(t, tx.AddLink(&LinkInfo{Name: "azv1"}))
+	require.NoError(t, tx.AddIPRoute(&Route{}))
+	inNetns := tx.Len()
+	require.NoError(t, tx.SetLinkName("azv1-2", "eth0"))
+	require.NoError(t, tx.AddIPAddress("eth0", ipNet.IP, ipNet))
+	// the changes which aren't recorded are passed through
+	require.NoError(t, tx.SetLinkState("eth0", true))
+	assert.Equal(t, 4, tx.Len())
+
+	nl.calls = nil
+	require.NoError(t, tx.RollbackTo(inNetns))
+	assert.Equal(t, []string{"delete address 10.0.0.0/24 from eth0", "rename link eth0 to azv1-2"}, nl.calls)
+	assert.Equal(t, inNetns, tx.Len())
+
+	// all the changes are undone even when some fail
+	nl.calls = nil
+	err := tx.Rollback()
+	require.ErrorIs(t, err, ErrorMockNetlink)
+	assert.Contains(t, err.Error(), "failed to delete link azv1")
+	assert.Equal(t, []string{"delete route", "delete link azv1"}, nl.calls)
+	assert.Zero(t, tx.Len())
+}
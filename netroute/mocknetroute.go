@@ -0,0 +1,146 @@
+package netroute
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMockNetRouteFail - mock netroute error
+var ErrMockNetRouteFail = errors.New("netroute fail")
+
+// MockNetRoute is an in-memory route and neighbor table. Deleting a route or neighbor which is not present fails the
+// same way as the real implementation.
+type MockNetRoute struct {
+	sync.Mutex
+	fail           bool
+	failAttempt    int
+	numTimesCalled int
+	routes         []Route
+	neighbors      []Neighbor
+}
+
+// NewMockNetRoute returns an empty table. If fail is set, the failAttempt'th call fails with ErrMockNetRouteFail.
+func NewMockNetRoute(fail bool, failAttempt int) *MockNetRoute {
+	return &MockNetRoute{
+		fail:        fail,
+		failAttempt: failAttempt,
+	}
+}
+
+func (m *MockNetRoute) called(op string) error {
+	m.numTimesCalled++
+	if m.fail && m.failAttempt == m.numTimesCalled {
+		return fmt.Errorf("%w:%s", ErrMockNetRouteFail, op)
+	}
+	return nil
+}
+
+func (m *MockNetRoute) GetRoutes(ifName string) ([]Route, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.called("GetRoutes"); err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for i := range m.routes {
+		if ifName == "" || m.routes[i].Interface == ifName {
+			routes = append(routes, m.routes[i])
+		}
+	}
+	return routes, nil
+}
+
+func (m *MockNetRoute) AddRoute(route *Route) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.called("AddRoute"); err != nil {
+		return err
+	}
+	if err := route.validate(); err != nil {
+		return err
+	}
+
+	for i := range m.routes {
+		if m.routes[i].matches(route) {
+			return errors.Wrap(ErrRouteExists, route.String())
+		}
+	}
+	m.routes = append(m.routes, *route)
+	return nil
+}
+
+func (m *MockNetRoute) DeleteRoute(route *Route) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.called("DeleteRoute"); err != nil {
+		return err
+	}
+
+	for i := range m.routes {
+		if m.routes[i].matches(route) {
+			m.routes = append(m.routes[:i], m.routes[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Wrap(ErrRouteNotFound, route.String())
+}
+
+func (m *MockNetRoute) GetNeighbors(ifName string) ([]Neighbor, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.called("GetNeighbors"); err != nil {
+		return nil, err
+	}
+
+	var neighbors []Neighbor
+	for i := range m.neighbors {
+		if ifName == "" || m.neighbors[i].Interface == ifName {
+			neighbors = append(neighbors, m.neighbors[i])
+		}
+	}
+	return neighbors, nil
+}
+
+func (m *MockNetRoute) AddNeighbor(neigh *Neighbor) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.called("AddNeighbor"); err != nil {
+		return err
+	}
+	if err := neigh.validate(); err != nil {
+		return err
+	}
+
+	for i := range m.neighbors {
+		if m.neighbors[i].matches(neigh) {
+			return errors.Wrap(ErrNeighborExists, neigh.String())
+		}
+	}
+	m.neighbors = append(m.neighbors, *neigh)
+	return nil
+}
+
+func (m *MockNetRoute) DeleteNeighbor(neigh *Neighbor) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.called("DeleteNeighbor"); err != nil {
+		return err
+	}
+
+	for i := range m.neighbors {
+		if m.neighbors[i].matches(neigh) {
+			m.neighbors = append(m.neighbors[:i], m.neighbors[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Wrap(ErrNeighborNotFound, neigh.String())
+}
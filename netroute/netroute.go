@@ -0,0 +1,85 @@
+// Package netroute manages the host route and neighbor tables. The real implementation programs the Windows IP
+// Helper tables directly; MockNetRoute keeps the tables in memory so route programming can be asserted in tests.
+package netroute
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/pkg/errors"
+)
+
+//nolint:revive // keeping NetRouteInterface makes sense
+type NetRouteInterface interface {
+	GetRoutes(ifName string) ([]Route, error)
+	AddRoute(route *Route) error
+	DeleteRoute(route *Route) error
+	GetNeighbors(ifName string) ([]Neighbor, error)
+	AddNeighbor(neigh *Neighbor) error
+	DeleteNeighbor(neigh *Neighbor) error
+}
+
+var (
+	// ErrRouteExists - errors out when adding a route which is already present
+	ErrRouteExists = errors.New("route already exists")
+	// ErrRouteNotFound - errors out when deleting a route which is not present
+	ErrRouteNotFound = errors.New("route not found")
+	// ErrNeighborExists - errors out when adding a neighbor which is already present
+	ErrNeighborExists = errors.New("neighbor already exists")
+	// ErrNeighborNotFound - errors out when deleting a neighbor which is not present
+	ErrNeighborNotFound = errors.New("neighbor not found")
+	// ErrInvalidAddress - errors out when an address family does not match or an address is missing
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
+// Route is an entry of the host route table.
+type Route struct {
+	// Interface is the alias of the interface the route goes out of, e.g. "vEthernet (Ethernet)".
+	Interface   string
+	Destination netip.Prefix
+	// NextHop is the unspecified address of the destination family for on-link routes.
+	NextHop netip.Addr
+	// Metric is added to the interface metric.
+	Metric uint32
+}
+
+func (r *Route) String() string {
+	return fmt.Sprintf("%s via %s dev %q metric %d", r.Destination, r.NextHop, r.Interface, r.Metric)
+}
+
+// matches reports whether r and other are the same route, which is identified by its interface, destination and next hop.
+func (r *Route) matches(other *Route) bool {
+	return r.Interface == other.Interface && r.Destination == other.Destination && r.NextHop == other.NextHop
+}
+
+func (r *Route) validate() error {
+	if !r.Destination.IsValid() || !r.NextHop.IsValid() || r.Destination.Addr().Is4() != r.NextHop.Is4() {
+		return errors.Wrap(ErrInvalidAddress, r.String())
+	}
+	return nil
+}
+
+// Neighbor is an entry of the host neighbor (ARP and NDP) table.
+type Neighbor struct {
+	// Interface is the alias of the interface the neighbor is reachable on.
+	Interface    string
+	Address      netip.Addr
+	HardwareAddr net.HardwareAddr
+}
+
+func (n *Neighbor) String() string {
+	return fmt.Sprintf("%s lladdr %s dev %q", n.Address, n.HardwareAddr, n.Interface)
+}
+
+// matches reports whether n and other are the same neighbor, which is identified by its interface and address.
+func (n *Neighbor) matches(other *Neighbor) bool {
+	return n.Interface == other.Interface && n.Address == other.Address
+}
+
+func (n *Neighbor) validate() error {
+	if !n.Address.IsValid() || len(n.HardwareAddr) == 0 {
+		return errors.Wrap(ErrInvalidAddress, n.String())
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package netroute
+
+import (
+	"net"
+	"net/netip"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	afUnspec = 0
+	afInet   = 2
+	afInet6  = 23
+
+	// nlnsPermanent is NL_NEIGHBOR_STATE NlnsPermanent, a neighbor entry which never expires.
+	nlnsPermanent = 6
+	// tableOffset is the offset of the first row of a MIB table, which follows the entry count aligned to the rows.
+	tableOffset = 8
+)
+
+var (
+	iphlpapi                  = windows.NewLazySystemDLL("iphlpapi.dll")
+	procInitializeIPForward   = iphlpapi.NewProc("InitializeIpForwardEntry")
+	procGetIPForwardTable2    = iphlpapi.NewProc("GetIpForwardTable2")
+	procCreateIPForwardEntry2 = iphlpapi.NewProc("CreateIpForwardEntry2")
+	procDeleteIPForwardEntry2 = iphlpapi.NewProc("DeleteIpForwardEntry2")
+	procGetIPNetTable2        = iphlpapi.NewProc("GetIpNetTable2")
+	procCreateIPNetEntry2     = iphlpapi.NewProc("CreateIpNetEntry2")
+	procDeleteIPNetEntry2     = iphlpapi.NewProc("DeleteIpNetEntry2")
+	procFreeMibTable          = iphlpapi.NewProc("FreeMibTable")
+)
+
+// rawSockaddrInet is SOCKADDR_INET, the union of SOCKADDR_IN and SOCKADDR_IN6.
+type rawSockaddrInet struct {
+	family uint16
+	data   [26]byte
+}
+
+// ipAddressPrefix is IP_ADDRESS_PREFIX.
+type ipAddressPrefix struct {
+	prefix       rawSockaddrInet
+	prefixLength uint8
+	_            [3]byte
+}
+
+// mibIPForwardRow2 is MIB_IPFORWARD_ROW2.
+type mibIPForwardRow2 struct {
+	interfaceLUID        uint64
+	interfaceIndex       uint32
+	destinationPrefix    ipAddressPrefix
+	nextHop              rawSockaddrInet
+	sitePrefixLength     uint8
+	validLifetime        uint32
+	preferredLifetime    uint32
+	metric               uint32
+	protocol             uint32
+	loopback             uint8
+	autoconfigureAddress uint8
+	publish              uint8
+	immortal             uint8
+	age                  uint32
+	origin               uint32
+}
+
+// mibIPNetRow2 is MIB_IPNET_ROW2.
+type mibIPNetRow2 struct {
+	address               rawSockaddrInet
+	interfaceIndex        uint32
+	interfaceLUID         uint64
+	physicalAddress       [32]byte
+	physicalAddressLength uint32
+	state                 uint32
+	flags                 uint8
+	reachabilityTime      uint32
+}
+
+// mibTable is the header of MIB_IPFORWARD_TABLE2 and MIB_IPNET_TABLE2.
+type mibTable struct {
+	numEntries uint32
+}
+
+// NetRoute programs the host route and neighbor tables through the IP Helper API.
+type NetRoute struct{}
+
+func (*NetRoute) GetRoutes(ifName string) ([]Route, error) {
+	ifIndex, err := interfaceIndex(ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	var table *mibTable
+	if err := callIPHelper(procGetIPForwardTable2, afUnspec, uintptr(unsafe.Pointer(&table))); err != nil {
+		return nil, errors.Wrap(err, "GetIpForwardTable2 failed")
+	}
+	defer procFreeMibTable.Call(uintptr(unsafe.Pointer(table))) //nolint:errcheck // nothing to do on failure
+
+	rows := unsafe.Slice((*mibIPForwardRow2)(unsafe.Add(unsafe.Pointer(table), tableOffset)), table.numEntries)
+	routes := make([]Route, 0, len(rows))
+	for i := range rows {
+		if ifIndex != 0 && rows[i].interfaceIndex != ifIndex {
+			continue
+		}
+		iface, err := net.InterfaceByIndex(int(rows[i].interfaceIndex))
+		if err != nil {
+			continue
+		}
+		routes = append(routes, Route{
+			Interface:   iface.Name,
+			Destination: netip.PrefixFrom(rows[i].destinationPrefix.prefix.addr(), int(rows[i].destinationPrefix.prefixLength)),
+			NextHop:     rows[i].nextHop.addr(),
+			Metric:      rows[i].metric,
+		})
+	}
+	return routes, nil
+}
+
+func (*NetRoute) AddRoute(route *Route) error {
+	row, err := newIPForwardRow(route)
+	if err != nil {
+		return err
+	}
+
+	err = callIPHelper(procCreateIPForwardEntry2, uintptr(unsafe.Pointer(row)))
+	if errors.Is(err, windows.ERROR_OBJECT_ALREADY_EXISTS) {
+		return errors.Wrap(ErrRouteExists, route.String())
+	}
+	return errors.Wrapf(err, "CreateIpForwardEntry2 failed for %s", route)
+}
+
+func (*NetRoute) DeleteRoute(route *Route) error {
+	row, err := newIPForwardRow(route)
+	if err != nil {
+		return err
+	}
+
+	err = callIPHelper(procDeleteIPForwardEntry2, uintptr(unsafe.Pointer(row)))
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return errors.Wrap(ErrRouteNotFound, route.String())
+	}
+	return errors.Wrapf(err, "DeleteIpForwardEntry2 failed for %s", route)
+}
+
+func (*NetRoute) GetNeighbors(ifName string) ([]Neighbor, error) {
+	ifIndex, err := interfaceIndex(ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	var table *mibTable
+	if err := callIPHelper(procGetIPNetTable2, afUnspec, uintptr(unsafe.Pointer(&table))); err != nil {
+		return nil, errors.Wrap(err, "GetIpNetTable2 failed")
+	}
+	defer procFreeMibTable.Call(uintptr(unsafe.Pointer(table))) //nolint:errcheck // nothing to do on failure
+
+	rows := unsafe.Slice((*mibIPNetRow2)(unsafe.Add(unsafe.Pointer(table), tableOffset)), table.numEntries)
+	neighbors := make([]Neighbor, 0, len(rows))
+	for i := range rows {
+		if ifIndex != 0 && rows[i].interfaceIndex != ifIndex {
+			continue
+		}
+		iface, err := net.InterfaceByIndex(int(rows[i].interfaceIndex))
+		if err != nil {
+			continue
+		}
+		length := min(rows[i].physicalAddressLength, uint32(len(rows[i].physicalAddress)))
+		neighbors = append(neighbors, Neighbor{
+			Interface:    iface.Name,
+			Address:      rows[i].address.addr(),
+			HardwareAddr: append(net.HardwareAddr(nil), rows[i].physicalAddress[:length]...),
+		})
+	}
+	return neighbors, nil
+}
+
+func (*NetRoute) AddNeighbor(neigh *Neighbor) error {
+	row, err := newIPNetRow(neigh)
+	if err != nil {
+		return err
+	}
+
+	err = callIPHelper(procCreateIPNetEntry2, uintptr(unsafe.Pointer(row)))
+	if errors.Is(err, windows.ERROR_OBJECT_ALREADY_EXISTS) {
+		return errors.Wrap(ErrNeighborExists, neigh.String())
+	}
+	return errors.Wrapf(err, "CreateIpNetEntry2 failed for %s", neigh)
+}
+
+func (*NetRoute) DeleteNeighbor(neigh *Neighbor) error {
+	row, err := newIPNetRow(neigh)
+	if err != nil {
+		return err
+	}
+
+	err = callIPHelper(procDeleteIPNetEntry2, uintptr(unsafe.Pointer(row)))
+	if errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return errors.Wrap(ErrNeighborNotFound, neigh.String())
+	}
+	return errors.Wrapf(err, "DeleteIpNetEntry2 failed for %s", neigh)
+}
+
+func newIPForwardRow(route *Route) (*mibIPForwardRow2, error) {
+	if err := route.validate(); err != nil {
+		return nil, err
+	}
+	ifIndex, err := interfaceIndex(route.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &mibIPForwardRow2{}
+	procInitializeIPForward.Call(uintptr(unsafe.Pointer(row))) //nolint:errcheck // returns void
+	row.interfaceIndex = ifIndex
+	row.destinationPrefix.prefix = newRawSockaddrInet(route.Destination.Masked().Addr())
+	row.destinationPrefix.prefixLength = uint8(route.Destination.Bits())
+	row.nextHop = newRawSockaddrInet(route.NextHop)
+	row.metric = route.Metric
+	return row, nil
+}
+
+func newIPNetRow(neigh *Neighbor) (*mibIPNetRow2, error) {
+	if err := neigh.validate(); err != nil {
+		return nil, err
+	}
+	ifIndex, err := interfaceIndex(neigh.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &mibIPNetRow2{
+		address:        newRawSockaddrInet(neigh.Address),
+		interfaceIndex: ifIndex,
+		state:          nlnsPermanent,
+	}
+	row.physicalAddressLength = uint32(copy(row.physicalAddress[:], neigh.HardwareAddr))
+	return row, nil
+}
+
+// interfaceIndex returns the index of the interface with alias ifName, or 0 for an empty name.
+func interfaceIndex(ifName string) (uint32, error) {
+	if ifName == "" {
+		return 0, nil
+	}
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get interface %q", ifName)
+	}
+	return uint32(iface.Index), nil
+}
+
+func newRawSockaddrInet(addr netip.Addr) rawSockaddrInet {
+	var sa rawSockaddrInet
+	if addr.Is4() {
+		sa.family = afInet
+		a := addr.As4()
+		copy(sa.data[2:6], a[:])
+		return sa
+	}
+
+	sa.family = afInet6
+	a := addr.As16()
+	copy(sa.data[6:22], a[:])
+	return sa
+}
+
+func (sa *rawSockaddrInet) addr() netip.Addr {
+	switch sa.family {
+	case afInet:
+		return netip.AddrFrom4([4]byte(sa.data[2:6]))
+	case afInet6:
+		return netip.AddrFrom16([16]byte(sa.data[6:22]))
+	default:
+		return netip.Addr{}
+	}
+}
+
+// callIPHelper calls an IP Helper function which returns a NETIO_STATUS.
+func callIPHelper(proc *windows.LazyProc, args ...uintptr) error {
+	if err := proc.Find(); err != nil {
+		return errors.Wrapf(err, "failed to find %s", proc.Name)
+	}
+	r, _, _ := proc.Call(args...)
+	if r != 0 {
+		return windows.Errno(r)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package netroute
+
+import (
+	"net/netip"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowLayout(t *testing.T) {
+	// sizes of MIB_IPFORWARD_ROW2 and MIB_IPNET_ROW2 on amd64 and arm64
+	require.Equal(t, uintptr(104), unsafe.Sizeof(mibIPForwardRow2{}))
+	require.Equal(t, uintptr(88), unsafe.Sizeof(mibIPNetRow2{}))
+	require.Equal(t, uintptr(76), unsafe.Offsetof(mibIPForwardRow2{}.validLifetime))
+	require.Equal(t, uintptr(84), unsafe.Offsetof(mibIPNetRow2{}.reachabilityTime))
+}
+
+func TestRawSockaddrInet(t *testing.T) {
+	for _, addr := range []netip.Addr{
+		netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("fe80::1234:5678:9abc"),
+	} {
+		sa := newRawSockaddrInet(addr)
+		require.Equal(t, addr, sa.addr())
+	}
+}
@@ -10,16 +10,24 @@ import (
 
 var (
 	// Error responses returned by NetworkManager.
-	errSubnetNotFound         = fmt.Errorf("Subnet not found")
-	errNetworkModeInvalid     = fmt.Errorf("Network mode is invalid")
-	errNetworkExists          = fmt.Errorf("Network already exists")
-	errNetworkNotFound        = &networkNotFoundError{}
-	errEndpointExists         = fmt.Errorf("Endpoint already exists")
-	errEndpointNotFound       = fmt.Errorf("Endpoint not found")
-	errNamespaceNotFound      = fmt.Errorf("Namespace not found")
-	errMultipleEndpointsFound = fmt.Errorf("Multiple endpoints found")
-	errEndpointInUse          = fmt.Errorf("Endpoint is already joined to a sandbox")
-	errEndpointNotInUse       = fmt.Errorf("Endpoint is not joined to a sandbox")
+	errSubnetNotFound           = fmt.Errorf("Subnet not found")
+	errNetworkModeInvalid       = fmt.Errorf("Network mode is invalid")
+	errNetworkExists            = fmt.Errorf("Network already exists")
+	errNetworkNotFound          = &networkNotFoundError{}
+	errEndpointExists           = fmt.Errorf("Endpoint already exists")
+	errEndpointNotFound         = fmt.Errorf("Endpoint not found")
+	errNamespaceNotFound        = fmt.Errorf("Namespace not found")
+	errMultipleEndpointsFound   = fmt.Errorf("Multiple endpoints found")
+	errEndpointInUse            = fmt.Errorf("Endpoint is already joined to a sandbox")
+	errEndpointNotInUse         = fmt.Errorf("Endpoint is not joined to a sandbox")
+	errWireguardNotReady        = errors.New("wireguard interface is not ready")
+	errInvalidVlanID            = errors.New("vlan id is invalid")
+	errVlanTrunkNotSupported    = errors.New("vlan trunks are not supported")
+	errSecondaryIPsNotSupported = errors.New("secondary ips are not supported")
+	errEthtoolNotSupported      = errors.New("ethtool settings are not supported")
+	errDSCPNotSupported         = errors.New("dscp marking is not supported")
+	errFlowLogsNotSupported     = errors.New("flow logs are not supported")
+	errStatelessModeInvalid     = errors.New("network mode is not supported by stateless cni")
 )
 
 type networkNotFoundError struct{}
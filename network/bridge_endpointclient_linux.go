@@ -26,6 +26,7 @@ type LinuxBridgeEndpointClient struct {
 	hostPrimaryMac    net.HardwareAddr
 	containerMac      net.HardwareAddr
 	hostIPAddresses   []*net.IPNet
+	hostMTU           int
 	mode              string
 	netlink           netlink.NetlinkInterface
 	plClient          platform.ExecClient
@@ -48,6 +49,7 @@ func NewLinuxBridgeEndpointClient(
 		containerVethName: containerVethName,
 		hostPrimaryMac:    extIf.MacAddress,
 		hostIPAddresses:   []*net.IPNet{},
+		hostMTU:           extIf.MTU,
 		mode:              mode,
 		netlink:           nl,
 		plClient:          plc,
@@ -64,6 +66,17 @@ func (client *LinuxBridgeEndpointClient) AddEndpoints(epInfo *EndpointInfo) erro
 		return err
 	}
 
+	// a veth at the default mtu would lower the mtu of the bridge, which follows the lowest mtu of its ports
+	if mtu := linkMTU(epInfo.MTU, client.hostMTU); mtu > 0 {
+		logger.Info("Setting mtu on veth pair", zap.Int("MTU", mtu), zap.String("hostVethName", client.hostVethName))
+		if err := client.netlink.SetLinkMTU(client.hostVethName, mtu); err != nil {
+			return fmt.Errorf("failed to set mtu of %s: %w", client.hostVethName, err)
+		}
+		if err := client.netlink.SetLinkMTU(client.containerVethName, mtu); err != nil {
+			return fmt.Errorf("failed to set mtu of %s: %w", client.containerVethName, err)
+		}
+	}
+
 	containerIf, err := net.InterfaceByName(client.containerVethName)
 	if err != nil {
 		return err
@@ -81,8 +94,9 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		return err
 	}
 
+	arp := arpOptions(epInfo.ARP)
 	for _, ipAddr := range epInfo.IPAddresses {
-		if ipAddr.IP.To4() != nil {
+		if ipAddr.IP.To4() != nil && !arp.DisableProxyARP {
 			// Add ARP reply rule.
 			logger.Info("Adding ARP reply rule for IP address", zap.String("address", ipAddr.String()))
 			if err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(client.containerMac), ebtables.Append); err != nil {
@@ -96,7 +110,7 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 			return err
 		}
 
-		if client.mode != opModeTunnel && ipAddr.IP.To4() != nil {
+		if client.mode != opModeTunnel && ipAddr.IP.To4() != nil && !arp.DisableProxyARP {
 			logger.Info("Adding static arp for IP address and MAC in VM", zap.String("address", ipAddr.String()), zap.String("MAC", client.containerMac.String()))
 			linkInfo := netlink.LinkInfo{
 				Name:       client.bridgeName,
@@ -110,6 +124,13 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		}
 	}
 
+	if arp.SpoofProtection {
+		logger.Info("Adding ARP spoof protection rules", zap.String("hostVethName", client.hostVethName))
+		if err := ebtables.SetArpSpoofProtection(client.hostVethName, ipv4Addresses(epInfo.IPAddresses), client.containerMac, ebtables.Append); err != nil {
+			return err
+		}
+	}
+
 	addRuleToRouteViaHost(epInfo)
 
 	logger.Info("Setting hairpin for ", zap.String("hostveth", client.hostVethName))
@@ -122,9 +143,17 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 }
 
 func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
+	arp := arpOptions(ep.ARP)
+	if arp.SpoofProtection {
+		logger.Info("Deleting ARP spoof protection rules", zap.String("hostIfName", ep.HostIfName), zap.String("id", ep.Id))
+		if err := ebtables.SetArpSpoofProtection(ep.HostIfName, ipv4Addresses(ep.IPAddresses), ep.MacAddress, ebtables.Delete); err != nil {
+			logger.Error("Failed to delete ARP spoof protection rules", zap.String("hostIfName", ep.HostIfName), zap.Error(err))
+		}
+	}
+
 	// Delete rules for IP addresses on the container interface.
 	for _, ipAddr := range ep.IPAddresses {
-		if ipAddr.IP.To4() != nil {
+		if ipAddr.IP.To4() != nil && !arp.DisableProxyARP {
 			// Delete ARP reply rule.
 			logger.Info("Deleting ARP reply rule for IP address on", zap.String("address", ipAddr.String()), zap.String("id", ep.Id))
 			err := ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(ep.MacAddress), ebtables.Delete)
@@ -140,7 +169,7 @@ func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
 			logger.Error("Failed to delete MAC DNAT rule for IP address", zap.String("address", ipAddr.String()), zap.Error(err))
 		}
 
-		if client.mode != opModeTunnel && ipAddr.IP.To4() != nil {
+		if client.mode != opModeTunnel && ipAddr.IP.To4() != nil && !arp.DisableProxyARP {
 			logger.Info("Removing static arp for IP address and MAC from VM", zap.String("address", ipAddr.String()), zap.String("MAC", ep.MacAddress.String()))
 			linkInfo := netlink.LinkInfo{
 				Name:       client.bridgeName,
@@ -155,6 +184,24 @@ func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	}
 }
 
+// arpOptions returns the arp handling of an endpoint, the default one when it has none.
+func arpOptions(arp *ARPOptions) ARPOptions {
+	if arp == nil {
+		return ARPOptions{}
+	}
+	return *arp
+}
+
+func ipv4Addresses(ipAddresses []net.IPNet) []net.IP {
+	var ips []net.IP
+	for _, ipAddr := range ipAddresses {
+		if ipAddr.IP.To4() != nil {
+			ips = append(ips, ipAddr.IP)
+		}
+	}
+	return ips
+}
+
 // getArpReplyAddress returns the MAC address to use in ARP replies.
 func (client *LinuxBridgeEndpointClient) getArpReplyAddress(epMacAddress net.HardwareAddr) net.HardwareAddr {
 	var macAddress net.HardwareAddr
@@ -207,6 +254,15 @@ func (client *LinuxBridgeEndpointClient) ConfigureContainerInterfacesAndRoutes(e
 		return err
 	}
 
+	if arpOptions(epInfo.ARP).GratuitousARP {
+		for _, ip := range ipv4Addresses(epInfo.IPAddresses) {
+			// the arp caches are updated on their own eventually, an endpoint is not failed for it
+			if err := client.nuc.SendGratuitousARP(client.containerVethName, ip); err != nil {
+				logger.Error("Failed to send gratuitous arp", zap.String("ip", ip.String()), zap.Error(err))
+			}
+		}
+	}
+
 	return nil
 }
 
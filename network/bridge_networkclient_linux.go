@@ -55,6 +55,8 @@ func (client *LinuxBridgeClient) CreateBridge() error {
 		LinkInfo: netlink.LinkInfo{
 			Type: netlink.LINK_TYPE_BRIDGE,
 			Name: client.bridgeName,
+			// the bridge takes the mtu of the external interface once it is connected, unless one is configured
+			MTU: uint(client.nwInfo.MTU),
 		},
 	}
 
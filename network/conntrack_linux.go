@@ -0,0 +1,71 @@
+package network
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	vishnetlink "github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// conntrackClient deletes the conntrack entries of the network namespace of the calling thread.
+type conntrackClient interface {
+	ConntrackDeleteFilters(family vishnetlink.InetFamily, filters ...vishnetlink.CustomConntrackFilter) (uint, error)
+}
+
+type vishConntrackClient struct{}
+
+func newConntrackClient() conntrackClient {
+	return vishConntrackClient{}
+}
+
+func (vishConntrackClient) ConntrackDeleteFilters(family vishnetlink.InetFamily, filters ...vishnetlink.CustomConntrackFilter) (uint, error) {
+	deleted, err := vishnetlink.ConntrackDeleteFilters(vishnetlink.ConntrackTable, family, filters...)
+	return deleted, errors.Wrap(err, "failed to delete conntrack entries")
+}
+
+// getConntrackFilters returns the filters of the conntrack entries of the flows from and to ip, keyed by family: the
+// flows it originates, snatted ones included, and the flows to it, dnatted ones included.
+func getConntrackFilters(ips []net.IPNet) (map[vishnetlink.InetFamily][]vishnetlink.CustomConntrackFilter, error) {
+	filters := make(map[vishnetlink.InetFamily][]vishnetlink.CustomConntrackFilter)
+	for _, ipAddr := range ips {
+		family := vishnetlink.InetFamily(vishnetlink.FAMILY_V4)
+		if ipAddr.IP.To4() == nil {
+			family = vishnetlink.InetFamily(vishnetlink.FAMILY_V6)
+		}
+		for _, filterType := range []vishnetlink.ConntrackFilterType{
+			vishnetlink.ConntrackOrigSrcIP,
+			vishnetlink.ConntrackOrigDstIP,
+			vishnetlink.ConntrackReplyAnyIP,
+		} {
+			filter := &vishnetlink.ConntrackFilter{}
+			if err := filter.AddIP(filterType, ipAddr.IP); err != nil {
+				return nil, errors.Wrapf(err, "failed to create conntrack filter for %s", ipAddr.IP)
+			}
+			filters[family] = append(filters[family], filter)
+		}
+	}
+	return filters, nil
+}
+
+// flushConntrack deletes the conntrack entries of the ips of the endpoint, so that a pod the ips are reused for
+// doesn't inherit the nat and the established state of the flows of the endpoint. Errors are logged and ignored.
+func flushConntrack(ct conntrackClient, ep *endpoint) {
+	if ep.DisableConntrackFlush {
+		return
+	}
+
+	filters, err := getConntrackFilters(ep.IPAddresses)
+	if err != nil {
+		logger.Error("Failed to flush conntrack entries", zap.String("endpointID", ep.Id), zap.Error(err))
+		return
+	}
+	for family, familyFilters := range filters {
+		deleted, err := ct.ConntrackDeleteFilters(family, familyFilters...)
+		if err != nil {
+			logger.Error("Failed to flush conntrack entries", zap.String("endpointID", ep.Id), zap.Error(err))
+			continue
+		}
+		logger.Info("Flushed conntrack entries", zap.String("endpointID", ep.Id), zap.Uint("deleted", deleted))
+	}
+}
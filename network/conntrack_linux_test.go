@@ -0,0 +1,100 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	vishnetlink "github.com/vishvananda/netlink"
+)
+
+// fakeConntrackClient keeps the conntrack entries of a namespace in memory.
+type fakeConntrackClient struct {
+	flows []*vishnetlink.ConntrackFlow
+}
+
+func (f *fakeConntrackClient) ConntrackDeleteFilters(family vishnetlink.InetFamily, filters ...vishnetlink.CustomConntrackFilter) (uint, error) {
+	var kept []*vishnetlink.ConntrackFlow
+	var deleted uint
+	for _, flow := range f.flows {
+		matched := false
+		for _, filter := range filters {
+			if vishnetlink.InetFamily(flow.FamilyType) == family && filter.MatchConntrackFlow(flow) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			deleted++
+		} else {
+			kept = append(kept, flow)
+		}
+	}
+	f.flows = kept
+	return deleted, nil
+}
+
+func newTestConntrackFlow(origSrc, origDst, replySrc, replyDst string) *vishnetlink.ConntrackFlow {
+	flow := &vishnetlink.ConntrackFlow{FamilyType: vishnetlink.FAMILY_V4}
+	if net.ParseIP(origSrc).To4() == nil {
+		flow.FamilyType = vishnetlink.FAMILY_V6
+	}
+	flow.Forward.SrcIP = net.ParseIP(origSrc)
+	flow.Forward.DstIP = net.ParseIP(origDst)
+	flow.Reverse.SrcIP = net.ParseIP(replySrc)
+	flow.Reverse.DstIP = net.ParseIP(replyDst)
+	return flow
+}
+
+func TestFlushConntrack(t *testing.T) {
+	podIP := net.IPNet{IP: net.ParseIP("10.240.0.4"), Mask: net.CIDRMask(24, 32)}
+	podIPv6 := net.IPNet{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(64, 128)}
+	unrelated := newTestConntrackFlow("10.240.0.5", "10.240.0.6", "10.240.0.6", "10.240.0.5")
+	newFlows := func() []*vishnetlink.ConntrackFlow {
+		return []*vishnetlink.ConntrackFlow{
+			// snatted to the node ip on its way out
+			newTestConntrackFlow("10.240.0.4", "20.1.1.1", "20.1.1.1", "10.224.0.4"),
+			// to a service ip dnatted to the pod
+			newTestConntrackFlow("10.240.0.5", "10.0.0.10", "10.240.0.4", "10.240.0.5"),
+			// from a peer to the pod
+			newTestConntrackFlow("10.240.0.6", "10.240.0.4", "10.240.0.4", "10.240.0.6"),
+			newTestConntrackFlow("fd00::4", "fd00::5", "fd00::5", "fd00::4"),
+			unrelated,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		ep        *endpoint
+		wantFlows int
+	}{
+		{
+			name:      "the flows of the ips of the endpoint are flushed",
+			ep:        &endpoint{Id: "12345678-eth0", IPAddresses: []net.IPNet{podIP, podIPv6}},
+			wantFlows: 1,
+		},
+		{
+			name:      "the flows of the other family are kept",
+			ep:        &endpoint{Id: "12345678-eth0", IPAddresses: []net.IPNet{podIP}},
+			wantFlows: 2,
+		},
+		{
+			name:      "nothing is flushed when disabled",
+			ep:        &endpoint{Id: "12345678-eth0", IPAddresses: []net.IPNet{podIP, podIPv6}, DisableConntrackFlush: true},
+			wantFlows: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ct := &fakeConntrackClient{flows: newFlows()}
+			flushConntrack(ct, tt.ep)
+			require.Len(t, ct.flows, tt.wantFlows)
+			require.Contains(t, ct.flows, unrelated)
+		})
+	}
+}
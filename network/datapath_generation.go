@@ -0,0 +1,144 @@
+package network
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// datapathMigration moves an endpoint from the generation before it to the next one.
+// Migrations must be idempotent since a failed save may cause them to run again.
+type datapathMigration func(nm *networkManager, nw *network, ep *endpoint) error
+
+// defaultDatapathMigrations holds, in order, the migrations needed to move an endpoint from generation i to i+1.
+// Endpoints created before generations were introduced are at generation 0.
+var defaultDatapathMigrations = []datapathMigration{}
+
+var errInvalidDatapathGeneration = errors.New("invalid datapath generation")
+
+// DatapathMigrationProgress reports the endpoints a batch of a datapath migration went through.
+type DatapathMigrationProgress struct {
+	Generation int
+	Migrated   int
+	Failed     int
+	// Remaining is the number of endpoints left to migrate after Last.
+	Remaining int
+	// Last is the key of the last endpoint the batch went through, the next batch starts after it.
+	Last string
+}
+
+// LatestDatapathGeneration returns the newest datapath generation this binary knows how to program.
+func (nm *networkManager) LatestDatapathGeneration() int {
+	return len(nm.datapathMigrations)
+}
+
+// SetDatapathGeneration sets the generation new endpoints are created at and existing endpoints are migrated to.
+// A negative generation selects the latest known generation.
+func (nm *networkManager) SetDatapathGeneration(generation int) error {
+	nm.Lock()
+	defer nm.Unlock()
+
+	if generation < 0 {
+		generation = nm.LatestDatapathGeneration()
+	}
+
+	if generation > nm.LatestDatapathGeneration() {
+		return errors.Wrapf(errInvalidDatapathGeneration, "generation %d is newer than latest known generation %d",
+			generation, nm.LatestDatapathGeneration())
+	}
+
+	nm.datapathGeneration = generation
+	return nil
+}
+
+// migrateEndpoint runs the migrations needed to bring the endpoint up to the target generation.
+// The generation is recorded after each step so that a failure resumes from where it stopped.
+// Returns true if the endpoint was changed and the state needs to be saved.
+func (nm *networkManager) migrateEndpoint(nw *network, ep *endpoint) (bool, error) {
+	if ep.DatapathGeneration >= nm.datapathGeneration {
+		return false, nil
+	}
+
+	start := time.Now()
+	migrated := false
+	for ep.DatapathGeneration < nm.datapathGeneration {
+		logger.Info("Migrating endpoint datapath", zap.String("endpointID", ep.Id),
+			zap.Int("from", ep.DatapathGeneration), zap.Int("to", ep.DatapathGeneration+1))
+
+		if err := nm.datapathMigrations[ep.DatapathGeneration](nm, nw, ep); err != nil {
+			err = errors.Wrapf(err, "failed to migrate endpoint %s to datapath generation %d", ep.Id, ep.DatapathGeneration+1)
+			ep.addHistory(EndpointOperationRepair, start, err)
+			return migrated, err
+		}
+
+		ep.DatapathGeneration++
+		migrated = true
+	}
+
+	ep.addHistory(EndpointOperationRepair, start, nil)
+	return migrated, nil
+}
+
+// migrateEndpointOnTouch lazily migrates an endpoint which is being changed. Failures are logged and left for the
+// next touch or the background migrator. The caller saves the state, with the migration and its history.
+func (nm *networkManager) migrateEndpointOnTouch(nw *network, ep *endpoint) {
+	if _, err := nm.migrateEndpoint(nw, ep); err != nil {
+		logger.Error("Failed to lazily migrate endpoint", zap.String("endpointID", ep.Id), zap.Error(err))
+	}
+}
+
+// MigrateEndpoints migrates up to limit endpoints below the target generation, in the order of their keys, starting
+// after the key last returned by the previous batch. Every endpoint is gone through once, so an endpoint which fails to
+// migrate doesn't hold the migration back; it is left for the next touch. Pacing the batches is up to the caller, the
+// lock is only held during a batch.
+func (nm *networkManager) MigrateEndpoints(after string, limit int) (DatapathMigrationProgress, error) {
+	nm.Lock()
+	defer nm.Unlock()
+
+	type staleEndpoint struct {
+		key string
+		nw  *network
+		ep  *endpoint
+	}
+
+	var stale []staleEndpoint
+	for extIfName, extIf := range nm.ExternalInterfaces {
+		for nwID, nw := range extIf.Networks {
+			for epID, ep := range nw.Endpoints {
+				key := strings.Join([]string{extIfName, nwID, epID}, entryKeySeparator)
+				if ep.DatapathGeneration < nm.datapathGeneration && key > after {
+					stale = append(stale, staleEndpoint{key: key, nw: nw, ep: ep})
+				}
+			}
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].key < stale[j].key })
+
+	progress := DatapathMigrationProgress{Generation: nm.datapathGeneration, Last: after}
+	changed := false
+	for i, s := range stale {
+		if limit > 0 && i == limit {
+			break
+		}
+
+		migrated, err := nm.migrateEndpoint(s.nw, s.ep)
+		if err != nil {
+			logger.Error("Failed to migrate endpoint", zap.String("endpointID", s.ep.Id), zap.Error(err))
+			progress.Failed++
+		} else {
+			progress.Migrated++
+		}
+		changed = changed || migrated || err != nil
+		progress.Last = s.key
+	}
+	progress.Remaining = len(stale) - progress.Migrated - progress.Failed
+
+	logger.Info("Migrated datapath batch", zap.Any("progress", progress))
+	if !changed {
+		return progress, nil
+	}
+	return progress, errors.Wrap(nm.save(), "failed to save state after endpoint migration")
+}
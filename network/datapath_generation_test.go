@@ -0,0 +1,130 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newDatapathGenerationTestManager(migrations []datapathMigration, generations ...int) *networkManager {
+	nw := &network{
+		Id:        "azure",
+		Endpoints: map[string]*endpoint{},
+	}
+	for i, generation := range generations {
+		id := string(rune('a' + i))
+		nw.Endpoints[id] = &endpoint{Id: id, DatapathGeneration: generation}
+	}
+
+	return &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{
+			"eth0": {
+				Name:     "eth0",
+				Networks: map[string]*network{"azure": nw},
+			},
+		},
+		datapathGeneration: len(migrations),
+		datapathMigrations: migrations,
+	}
+}
+
+func TestSetDatapathGeneration(t *testing.T) {
+	noop := func(*networkManager, *network, *endpoint) error { return nil }
+	nm := newDatapathGenerationTestManager([]datapathMigration{noop, noop})
+
+	require.NoError(t, nm.SetDatapathGeneration(1))
+	require.Equal(t, 1, nm.datapathGeneration)
+
+	require.NoError(t, nm.SetDatapathGeneration(-1))
+	require.Equal(t, 2, nm.datapathGeneration)
+
+	require.ErrorIs(t, nm.SetDatapathGeneration(3), errInvalidDatapathGeneration)
+}
+
+func TestMigrateEndpointOnTouch(t *testing.T) {
+	var calls []string
+	migrations := []datapathMigration{
+		func(_ *networkManager, _ *network, ep *endpoint) error {
+			calls = append(calls, "0->1:"+ep.Id)
+			return nil
+		},
+		func(_ *networkManager, _ *network, ep *endpoint) error {
+			calls = append(calls, "1->2:"+ep.Id)
+			return nil
+		},
+	}
+	nm := newDatapathGenerationTestManager(migrations, 0, 2)
+
+	// reads don't migrate the endpoint
+	epInfo, err := nm.GetEndpointInfo("azure", "a")
+	require.NoError(t, err)
+	require.Equal(t, 0, epInfo.DatapathGeneration)
+	require.Empty(t, calls)
+
+	ep, err := nm.AttachEndpoint("azure", "a", "sandbox")
+	require.NoError(t, err)
+	require.Equal(t, 2, ep.DatapathGeneration)
+	require.Equal(t, []string{"0->1:a", "1->2:a"}, calls)
+
+	// endpoints already at the target generation are left alone
+	_, err = nm.AttachEndpoint("azure", "b", "sandbox")
+	require.NoError(t, err)
+	require.Len(t, calls, 2)
+}
+
+func TestMigrateEndpointOnTouchFailureResumes(t *testing.T) {
+	fail := true
+	migrations := []datapathMigration{
+		func(*networkManager, *network, *endpoint) error { return nil },
+		func(*networkManager, *network, *endpoint) error {
+			if fail {
+				return errors.New("migration failed")
+			}
+			return nil
+		},
+	}
+	nm := newDatapathGenerationTestManager(migrations, 0)
+
+	// a failed migration does not fail the attach, and keeps the progress already made
+	ep, err := nm.AttachEndpoint("azure", "a", "sandbox")
+	require.NoError(t, err)
+	require.Equal(t, 1, ep.DatapathGeneration)
+
+	fail = false
+	require.NoError(t, nm.DetachEndpoint("azure", "a"))
+	ep, err = nm.AttachEndpoint("azure", "a", "sandbox")
+	require.NoError(t, err)
+	require.Equal(t, 2, ep.DatapathGeneration)
+}
+
+func TestMigrateEndpoints(t *testing.T) {
+	migrations := []datapathMigration{
+		func(_ *networkManager, _ *network, ep *endpoint) error {
+			if ep.Id == "c" {
+				return errors.New("migration failed")
+			}
+			return nil
+		},
+	}
+	nm := newDatapathGenerationTestManager(migrations, 0, 1, 0, 0)
+
+	progress, err := nm.MigrateEndpoints("", 2)
+	require.NoError(t, err)
+	require.Equal(t, DatapathMigrationProgress{Generation: 1, Migrated: 1, Failed: 1, Remaining: 1, Last: "eth0/azure/c"}, progress)
+
+	// the failed endpoint is not tried again by the next batch
+	progress, err = nm.MigrateEndpoints(progress.Last, 2)
+	require.NoError(t, err)
+	require.Equal(t, DatapathMigrationProgress{Generation: 1, Migrated: 1, Last: "eth0/azure/d"}, progress)
+
+	nw := nm.ExternalInterfaces["eth0"].Networks["azure"]
+	require.Equal(t, 1, nw.Endpoints["a"].DatapathGeneration)
+	require.Equal(t, 0, nw.Endpoints["c"].DatapathGeneration)
+	require.Equal(t, 1, nw.Endpoints["d"].DatapathGeneration)
+
+	// a new migration goes through the endpoints left behind
+	progress, err = nm.MigrateEndpoints("", 0)
+	require.NoError(t, err)
+	require.Equal(t, DatapathMigrationProgress{Generation: 1, Failed: 1, Last: "eth0/azure/c"}, progress)
+}
@@ -0,0 +1,41 @@
+// Package ebpfdatapath redirects traffic between the pods of a node with a tc-eBPF program attached to the ingress of
+// their host veths. Packets to a pod of the node are handed straight to the peer of its host veth, so that they skip
+// the host's routing and iptables. Any other traffic continues through the host stack.
+package ebpfdatapath
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+//nolint:revive // keeping EBPFDatapathInterface makes sense
+type EBPFDatapathInterface interface {
+	// Attach attaches the redirect program to the ingress of the host veth.
+	Attach(hostIfName string) error
+	// AddEndpoint redirects traffic to ip into the pod behind hostIfName, whose interface has the address podMac.
+	AddEndpoint(ip net.IP, hostIfName string, podMac net.HardwareAddr) error
+	// DeleteEndpoint stops redirecting traffic to ip.
+	DeleteEndpoint(ip net.IP) error
+}
+
+// ErrUnsupportedAddress - errors out when an endpoint address is not ipv4, which is the only family redirected
+var ErrUnsupportedAddress = errors.New("only ipv4 addresses are redirected")
+
+// endpointKey is the key of the endpoint map, an ipv4 address in network byte order.
+type endpointKey [4]byte
+
+func newEndpointKey(ip net.IP) (endpointKey, error) {
+	ipv4 := ip.To4()
+	if ipv4 == nil {
+		return endpointKey{}, errors.Wrap(ErrUnsupportedAddress, ip.String())
+	}
+	return endpointKey(ipv4), nil
+}
+
+// endpointValue is the value of the endpoint map. The layout is read by the redirect program.
+type endpointValue struct {
+	IfIndex uint32
+	MAC     [6]byte
+	_       [2]byte
+}
@@ -0,0 +1,231 @@
+package ebpfdatapath
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// pinPath is where the endpoint map is pinned, so that it is shared by the programs of all host veths and
+	// outlives the cni invocations which update it.
+	pinPath = "/sys/fs/bpf/azure-cni"
+	// endpointMapName is the name of the pinned endpoint map, at most 15 characters.
+	endpointMapName = "azure_endpoints"
+	// maxEndpoints bounds the number of pod ips on the node.
+	maxEndpoints = 4096
+	// filterName names the tc filter of the redirect program.
+	filterName = "azure-cni-redirect"
+	// filterPriority and filterHandle identify the tc filter, so that reattaching replaces it.
+	filterPriority = 1
+	filterHandle   = 1
+
+	// offsets of __sk_buff fields
+	skbDataOffset    = 76
+	skbDataEndOffset = 80
+	// offsets in an ethernet frame carrying ipv4
+	ethHdrLen          = 14
+	ethProtoOffset     = 12
+	ipv4DstOffset      = ethHdrLen + 16
+	ipv4MinFrameLength = ethHdrLen + 20
+	// offsets in endpointValue
+	valueIfIndexOffset = 0
+	valueMACOffset     = 4
+	// tcActOK lets the packet continue through the host stack.
+	tcActOK = 0
+	// license must be gpl compatible for the redirect helpers.
+	license = "Dual MIT/GPL"
+)
+
+var endpointMapSpec = &ebpf.MapSpec{
+	Name:       endpointMapName,
+	Type:       ebpf.Hash,
+	KeySize:    uint32(binary.Size(endpointKey{})),
+	ValueSize:  uint32(binary.Size(endpointValue{})),
+	MaxEntries: maxEndpoints,
+	Pinning:    ebpf.PinByName,
+}
+
+// EBPFDatapath programs the redirect datapath. It needs CAP_BPF and CAP_NET_ADMIN, a mounted bpf filesystem and
+// a kernel with bpf_redirect_peer, 5.10 or later.
+type EBPFDatapath struct{}
+
+func New() *EBPFDatapath {
+	return &EBPFDatapath{}
+}
+
+func (*EBPFDatapath) Attach(hostIfName string) error {
+	link, err := netlink.LinkByName(hostIfName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get interface %s", hostIfName)
+	}
+
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0), //nolint:gomnd // clsact handle
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return errors.Wrapf(err, "failed to add clsact qdisc to %s", hostIfName)
+	}
+
+	endpoints, err := loadEndpointMap()
+	if err != nil {
+		return err
+	}
+	defer endpoints.Close()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "azure_redirect",
+		Type:         ebpf.SchedCLS,
+		Instructions: redirectInstructions(endpoints.FD()),
+		License:      license,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to load redirect program")
+	}
+	// the tc filter holds its own reference to the program
+	defer prog.Close()
+
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    netlink.HANDLE_MIN_INGRESS,
+			Handle:    filterHandle,
+			Priority:  filterPriority,
+			Protocol:  unix.ETH_P_ALL,
+		},
+		Fd:           prog.FD(),
+		Name:         filterName,
+		DirectAction: true,
+	}
+	if err := netlink.FilterReplace(filter); err != nil {
+		return errors.Wrapf(err, "failed to attach redirect program to %s", hostIfName)
+	}
+
+	return nil
+}
+
+func (*EBPFDatapath) AddEndpoint(ip net.IP, hostIfName string, podMac net.HardwareAddr) error {
+	key, err := newEndpointKey(ip)
+	if err != nil {
+		return err
+	}
+
+	link, err := netlink.LinkByName(hostIfName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get interface %s", hostIfName)
+	}
+
+	value := endpointValue{IfIndex: uint32(link.Attrs().Index)}
+	if copy(value.MAC[:], podMac) != len(value.MAC) {
+		return errors.Errorf("invalid mac address %s for %s", podMac, ip)
+	}
+
+	endpoints, err := loadEndpointMap()
+	if err != nil {
+		return err
+	}
+	defer endpoints.Close()
+
+	return errors.Wrapf(endpoints.Put(key, value), "failed to add endpoint %s", ip)
+}
+
+func (*EBPFDatapath) DeleteEndpoint(ip net.IP) error {
+	key, err := newEndpointKey(ip)
+	if err != nil {
+		return err
+	}
+
+	endpoints, err := loadEndpointMap()
+	if err != nil {
+		return err
+	}
+	defer endpoints.Close()
+
+	if err := endpoints.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return errors.Wrapf(err, "failed to delete endpoint %s", ip)
+	}
+	return nil
+}
+
+// loadEndpointMap opens the pinned endpoint map, creating and pinning it if it does not exist yet.
+func loadEndpointMap() (*ebpf.Map, error) {
+	if err := os.MkdirAll(pinPath, 0o700); err != nil { //nolint:gomnd // owner only
+		return nil, errors.Wrapf(err, "failed to create %s", pinPath)
+	}
+
+	m, err := ebpf.NewMapWithOptions(endpointMapSpec, ebpf.MapOptions{PinPath: pinPath})
+	return m, errors.Wrapf(err, "failed to load endpoint map %s", filepath.Join(pinPath, endpointMapName))
+}
+
+// redirectInstructions returns the tc program. For ipv4 packets to an endpoint in the map, it rewrites the
+// destination mac to the pod's and redirects the packet to the peer of the pod's host veth:
+//
+//	if eth.proto == ipv4 && (ep = endpoints[ip.daddr]) != nil {
+//		eth.dest = ep.mac
+//		return bpf_redirect_peer(ep.ifindex, 0)
+//	}
+//	return TC_ACT_OK
+func redirectInstructions(endpointMapFD int) asm.Instructions {
+	const pass = "pass"
+	ethPIPv4 := int32(binary.NativeEndian.Uint16([]byte{0x08, 0x00})) // htons(ETH_P_IP)
+
+	return asm.Instructions{
+		// r6 = skb
+		asm.Mov.Reg(asm.R6, asm.R1),
+
+		// bounds check the ethernet and ipv4 headers
+		asm.LoadMem(asm.R2, asm.R6, skbDataOffset, asm.Word),
+		asm.LoadMem(asm.R3, asm.R6, skbDataEndOffset, asm.Word),
+		asm.Mov.Reg(asm.R4, asm.R2),
+		asm.Add.Imm(asm.R4, ipv4MinFrameLength),
+		asm.JGT.Reg(asm.R4, asm.R3, pass),
+
+		// only ipv4 is redirected
+		asm.LoadMem(asm.R4, asm.R2, ethProtoOffset, asm.Half),
+		asm.JNE.Imm(asm.R4, ethPIPv4, pass),
+
+		// r0 = endpoints[ip.daddr]
+		asm.LoadMem(asm.R4, asm.R2, ipv4DstOffset, asm.Word),
+		asm.StoreMem(asm.RFP, -4, asm.R4, asm.Word),
+		asm.LoadMapPtr(asm.R1, endpointMapFD),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, pass),
+		asm.Mov.Reg(asm.R7, asm.R0),
+
+		// the helper call invalidated the packet pointers, check the ethernet header again
+		asm.LoadMem(asm.R2, asm.R6, skbDataOffset, asm.Word),
+		asm.LoadMem(asm.R3, asm.R6, skbDataEndOffset, asm.Word),
+		asm.Mov.Reg(asm.R4, asm.R2),
+		asm.Add.Imm(asm.R4, ethHdrLen),
+		asm.JGT.Reg(asm.R4, asm.R3, pass),
+
+		// eth.dest = ep.mac
+		asm.LoadMem(asm.R4, asm.R7, valueMACOffset, asm.Word),
+		asm.StoreMem(asm.R2, 0, asm.R4, asm.Word),
+		asm.LoadMem(asm.R4, asm.R7, valueMACOffset+4, asm.Half),
+		asm.StoreMem(asm.R2, 4, asm.R4, asm.Half),
+
+		// return bpf_redirect_peer(ep.ifindex, 0)
+		asm.LoadMem(asm.R1, asm.R7, valueIfIndexOffset, asm.Word),
+		asm.Mov.Imm(asm.R2, 0),
+		asm.FnRedirectPeer.Call(),
+		asm.Return(),
+
+		asm.Mov.Imm(asm.R0, tcActOK).WithSymbol(pass),
+		asm.Return(),
+	}
+}
@@ -0,0 +1,38 @@
+package ebpfdatapath
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointMapLayout(t *testing.T) {
+	require.Equal(t, 4, binary.Size(endpointKey{}))
+	require.Equal(t, 12, binary.Size(endpointValue{}))
+	require.Equal(t, uint32(12), endpointMapSpec.ValueSize)
+}
+
+func TestNewEndpointKey(t *testing.T) {
+	key, err := newEndpointKey(net.ParseIP("10.0.0.4"))
+	require.NoError(t, err)
+	require.Equal(t, endpointKey{10, 0, 0, 4}, key)
+
+	_, err = newEndpointKey(net.ParseIP("fc00::4"))
+	require.ErrorIs(t, err, ErrUnsupportedAddress)
+}
+
+func TestRedirectInstructions(t *testing.T) {
+	insns := redirectInstructions(3)
+
+	// all jumps resolve and the program assembles
+	var buf bytes.Buffer
+	require.NoError(t, insns.Marshal(&buf, binary.LittleEndian))
+
+	// the program ends in an exit on both paths
+	require.Equal(t, asm.Return(), insns[len(insns)-1])
+	require.Contains(t, insns.String(), "FnRedirectPeer")
+}
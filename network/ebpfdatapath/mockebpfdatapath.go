@@ -0,0 +1,86 @@
+package ebpfdatapath
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMockEBPFDatapath - mock ebpf datapath error
+var ErrMockEBPFDatapath = errors.New("mock ebpf datapath error")
+
+// MockEBPFDatapath keeps the attached interfaces and redirected endpoints in memory.
+type MockEBPFDatapath struct {
+	sync.Mutex
+	fail     bool
+	attached map[string]bool
+	// endpoints maps a redirected ip to the host veth name of its pod
+	endpoints map[string]string
+}
+
+// NewMockEBPFDatapath returns an empty datapath. If fail is set, every call fails with ErrMockEBPFDatapath.
+func NewMockEBPFDatapath(fail bool) *MockEBPFDatapath {
+	return &MockEBPFDatapath{
+		fail:      fail,
+		attached:  make(map[string]bool),
+		endpoints: make(map[string]string),
+	}
+}
+
+func (m *MockEBPFDatapath) Attach(hostIfName string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.fail {
+		return fmt.Errorf("%w:Attach", ErrMockEBPFDatapath)
+	}
+	m.attached[hostIfName] = true
+	return nil
+}
+
+func (m *MockEBPFDatapath) AddEndpoint(ip net.IP, hostIfName string, _ net.HardwareAddr) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.fail {
+		return fmt.Errorf("%w:AddEndpoint", ErrMockEBPFDatapath)
+	}
+	if _, err := newEndpointKey(ip); err != nil {
+		return err
+	}
+	m.endpoints[ip.String()] = hostIfName
+	return nil
+}
+
+func (m *MockEBPFDatapath) DeleteEndpoint(ip net.IP) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.fail {
+		return fmt.Errorf("%w:DeleteEndpoint", ErrMockEBPFDatapath)
+	}
+	delete(m.endpoints, ip.String())
+	return nil
+}
+
+// IsAttached returns whether the redirect program was attached to hostIfName.
+func (m *MockEBPFDatapath) IsAttached(hostIfName string) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.attached[hostIfName]
+}
+
+// Endpoints returns the redirected ips mapped to the host veth names of their pods.
+func (m *MockEBPFDatapath) Endpoints() map[string]string {
+	m.Lock()
+	defer m.Unlock()
+
+	endpoints := make(map[string]string, len(m.endpoints))
+	for ip, hostIfName := range m.endpoints {
+		endpoints[ip] = hostIfName
+	}
+	return endpoints
+}
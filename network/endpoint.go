@@ -4,10 +4,14 @@
 package network
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cni/log"
 	"github.com/Azure/azure-container-networking/cns"
@@ -15,7 +19,9 @@ import (
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -23,6 +29,23 @@ const (
 	InfraVnet = 0
 )
 
+// Range of the vlan ids which can be delivered to an endpoint over an 802.1q trunk. 0 and 4095 are reserved.
+const (
+	minTrunkVlanID = 1
+	maxTrunkVlanID = 4094
+)
+
+// Keys of the traffic counters getInfo adds to EndpointInfo.Data when stats collection is enabled. The counters are
+// uint64 values from the pod's point of view, i.e. rx is traffic received by the pod.
+const (
+	RxBytesKey   = "rxBytes"
+	TxBytesKey   = "txBytes"
+	RxPacketsKey = "rxPackets"
+	TxPacketsKey = "txPackets"
+	RxDroppedKey = "rxDropped"
+	TxDroppedKey = "txDropped"
+)
+
 var logger = log.CNILogger.With(zap.String("component", "net"))
 
 type AzureHNSEndpoint struct{}
@@ -37,6 +60,7 @@ type endpoint struct {
 	HostIfName               string
 	MacAddress               net.HardwareAddr
 	InfraVnetIP              net.IPNet
+	InfraVnetIPv6            net.IPNet
 	LocalIP                  string
 	IPAddresses              []net.IPNet
 	Gateways                 []net.IP
@@ -48,17 +72,55 @@ type endpoint struct {
 	EnableMultitenancy       bool
 	AllowInboundFromHostToNC bool
 	AllowInboundFromNCToHost bool
+	HostToNCPortRules        []cns.HostNCPortRule `json:",omitempty"`
+	NCToHostPortRules        []cns.HostNCPortRule `json:",omitempty"`
 	NetworkContainerID       string
 	NetworkNameSpace         string `json:",omitempty"`
 	ContainerID              string
 	PODName                  string `json:",omitempty"`
 	PODNameSpace             string `json:",omitempty"`
+	PODUID                   string `json:",omitempty"`
 	InfraVnetAddressSpace    string `json:",omitempty"`
 	NetNs                    string `json:",omitempty"` // used in windows
 	// SecondaryInterfaces is a map of interface name to InterfaceInfo
 	SecondaryInterfaces map[string]*InterfaceInfo
 	// Store nic type since we no longer populate SecondaryInterfaces
 	NICType cns.NICType
+	// OutboundNATExceptions are destination cidrs this endpoint's traffic is not snatted to
+	OutboundNATExceptions []string `json:",omitempty"`
+	// SkipDNSRedirect exempts this endpoint's dns traffic from dns interception, snat for dns is kept
+	SkipDNSRedirect bool `json:",omitempty"`
+	// DSCP is the dscp value the egress traffic of the endpoint is marked with, 0 leaves it unmarked
+	DSCP int `json:",omitempty"`
+	// FlowLogs is set for the endpoints whose flows are logged, which cns reads from the conntrack table on linux
+	FlowLogs bool `json:",omitempty"`
+	// DisableConntrackFlush keeps the conntrack entries of the endpoint's ips when it is deleted on linux
+	DisableConntrackFlush bool `json:",omitempty"`
+	// DatapathGeneration is the generation of the datapath the endpoint was last programmed with
+	DatapathGeneration int `json:",omitempty"`
+	// History is the last operations which programmed or inspected the endpoint, oldest first
+	History []EndpointOperation `json:",omitempty"`
+	// EnableEBPFDatapath is set for endpoints plumbed by the TransparentEBPFEndpointClient
+	EnableEBPFDatapath bool `json:",omitempty"`
+	// EnableIPVlanL3S is set for endpoints plumbed by the TransparentIPVlanEndpointClient
+	EnableIPVlanL3S bool `json:",omitempty"`
+	// EnableMacvlan is set for endpoints plumbed by the TransparentMacvlanEndpointClient
+	EnableMacvlan bool `json:",omitempty"`
+	// AllowedVlanIDs are the vlans delivered tagged to the endpoint's nic, i.e. the nic is an 802.1q trunk
+	AllowedVlanIDs []int `json:",omitempty"`
+	// EthtoolSettings are the ring sizes and channel counts applied to the endpoint's vf, kept so that repairs re-apply them
+	EthtoolSettings *EthtoolSettings `json:",omitempty"`
+	// ARP is the arp handling of the endpoint of a bridge network, kept so that its rules are deleted with it
+	ARP *ARPOptions `json:",omitempty"`
+	// HostProtectedPorts are the host ports, as <protocol>/<port>, the endpoint's traffic is blocked to on windows
+	HostProtectedPorts []string `json:",omitempty"`
+	// RouteTable is the policy routing table of the endpoint's delegated nic in the pod on linux, 0 for the main table
+	RouteTable int `json:",omitempty"`
+	// HnsEndpointConfig is the hcn endpoint the endpoint was created with on windows, kept so that it is created again
+	// when hns loses it
+	HnsEndpointConfig json.RawMessage `json:",omitempty"`
+	// AddResult is the CNI result of the ADD which created the endpoint, returned again when the ADD is retried
+	AddResult json.RawMessage `json:",omitempty"`
 }
 
 // EndpointInfo contains read-only information about an endpoint.
@@ -74,6 +136,7 @@ type EndpointInfo struct {
 	IPAddresses              []net.IPNet
 	IPsToRouteViaHost        []string
 	InfraVnetIP              net.IPNet
+	InfraVnetIPv6            net.IPNet
 	Routes                   []RouteInfo
 	EndpointPolicies         []policy.Policy // used in windows
 	NetworkPolicies          []policy.Policy // used in windows
@@ -84,9 +147,13 @@ type EndpointInfo struct {
 	EnableSnatForDns         bool
 	AllowInboundFromHostToNC bool
 	AllowInboundFromNCToHost bool
+	HostToNCPortRules        []cns.HostNCPortRule
+	NCToHostPortRules        []cns.HostNCPortRule
 	NetworkContainerID       string
 	PODName                  string
 	PODNameSpace             string
+	PODUID                   string
+	EndpointValidationMode   EndpointValidationMode // what the endpoints of the ADD must have in common, by container id if empty
 	Data                     map[string]interface{}
 	InfraVnetAddressSpace    string
 	SkipHotAttachEp          bool
@@ -94,6 +161,30 @@ type EndpointInfo struct {
 	VnetCidrs                string
 	ServiceCidrs             string
 	NATInfo                  []policy.NATInfo // windows only
+	OutboundNATExceptions    []string         // destination cidrs exempt from snat, in addition to VnetCidrs/ServiceCidrs
+	SkipDNSRedirect          bool             // dns queries reach azure dns directly, bypassing dns interception
+	DSCP                     int              // linux only, dscp value of the egress traffic, 0 leaves it unmarked
+	DisableConntrackFlush    bool             // linux only, keeps the conntrack entries of the ips when the endpoint is deleted
+	FlowLogs                 bool             // linux only, the flows of the endpoint are accounted and served by cns
+	EnableEBPFDatapath       bool             // linux transparent mode only
+	EnableIPVlanL3S          bool             // linux transparent mode only, for the network created with the endpoint
+	EnableMacvlan            bool             // linux transparent mode only, for the network created with the endpoint
+	WireguardIfName          string           // linux wireguard mode only, defaults to DefaultWireguardIfName
+	VxlanIfName              string           // linux vxlan mode only, defaults to DefaultVxlanIfName
+	VxlanID                  int              // linux vxlan mode only, defaults to DefaultVxlanID
+	VxlanPort                int              // linux vxlan mode only, defaults to DefaultVxlanPort
+	MTU                      int              // of the links of the network and endpoint, the master interface's when 0
+	AllowedVlanIDs           []int            // vlans delivered tagged to the pod nic, which is then an 802.1q trunk
+	EthtoolSettings          *EthtoolSettings // linux delegated nics only, ring sizes and channel counts of the vf
+	ARP                      *ARPOptions      // linux bridge mode only, the arp handling of the endpoint, nil for the default
+	VMSandbox                bool             // linux only, the netns belongs to the vm of a sandboxed runtime such as kata
+	SandboxDevice            string           // linux only, the tap or ipvtap device handed to the vm of a sandboxed runtime
+	HostProtectedPorts       []string         // windows only, host ports as <protocol>/<port> the pod's traffic is blocked to
+	RouteTable               int              // linux delegated nics only, policy routing table of the nic in the pod
+	AddResult                json.RawMessage  // CNI result of the ADD of the pod, kept on the endpoint of the interface of the ADD
+	DatapathGeneration       int
+	History                  []EndpointOperation
+	OperState                *EndpointOperState
 	NICType                  cns.NICType
 	SkipDefaultRoutes        bool
 	HNSEndpointID            string
@@ -114,6 +205,19 @@ type EndpointInfo struct {
 	PnPID                         string
 }
 
+// ARPOptions are the arp handling of the endpoints of bridge networks. The zero value is the handling of the endpoints
+// without options: the bridge answers the arp requests for their ips, the host has static neighbor entries for them,
+// and the arp they send is neither filtered nor announced.
+type ARPOptions struct {
+	// DisableProxyARP leaves answering the arp requests for the endpoint's ips to the endpoint itself, for appliances
+	// which move their ips between interfaces or answer arp for ips of their own
+	DisableProxyARP bool `json:",omitempty"`
+	// SpoofProtection drops the arp the endpoint sends with a sender ip or mac which isn't its own
+	SpoofProtection bool `json:",omitempty"`
+	// GratuitousARP announces the endpoint's ips once they are assigned, so the neighbors update the mac they cached
+	GratuitousARP bool `json:",omitempty"`
+}
+
 // RouteInfo contains information about an IP route.
 type RouteInfo struct {
 	Dst      net.IPNet
@@ -124,21 +228,28 @@ type RouteInfo struct {
 	Scope    int
 	Priority int
 	Table    int
+	// MTU and AdvMSS clamp the packets and the tcp mss of the route, for encapsulated traffic on linux.
+	MTU    int
+	AdvMSS int
+	// OnLink routes through the gateway even if no subnet of the interface holds it, on linux.
+	OnLink bool
 }
 
 // InterfaceInfo contains information for secondary interfaces
 type InterfaceInfo struct {
-	Name              string
-	MacAddress        net.HardwareAddr
-	IPConfigs         []*IPConfig
-	Routes            []RouteInfo
-	DNS               DNSInfo
-	NICType           cns.NICType
-	SkipDefaultRoutes bool
-	HostSubnetPrefix  net.IPNet // Move this field from ipamAddResult
-	NCResponse        *cns.GetNetworkContainerResponse
-	PnPID             string
-	EndpointPolicies  []policy.Policy
+	Name               string
+	MacAddress         net.HardwareAddr
+	IPConfigs          []*IPConfig
+	Routes             []RouteInfo
+	DNS                DNSInfo
+	NICType            cns.NICType
+	SkipDefaultRoutes  bool
+	HostSubnetPrefix   net.IPNet // Move this field from ipamAddResult
+	NCResponse         *cns.GetNetworkContainerResponse
+	PnPID              string
+	EndpointPolicies   []policy.Policy
+	SNATExceptionCIDRs []string // destination cidrs from the NC the interface's traffic is not snatted to
+	RouteTable         int      // policy routing table of a delegated nic in the pod on linux, 0 for the main table
 }
 
 type IPConfig struct {
@@ -184,6 +295,30 @@ func (ifInfo *InterfaceInfo) PrettyString() string {
 
 // NewEndpoint creates a new endpoint in the network.
 func (nw *network) newEndpoint(
+	ctx context.Context,
+	apipaCli apipaClient,
+	nl netlink.NetlinkInterface,
+	plc platform.ExecClient,
+	netioCli netio.NetIOInterface,
+	nsc NamespaceClientInterface,
+	iptc ipTablesClient,
+	dhcpc dhcpClient,
+	epInfo *EndpointInfo,
+) (*endpoint, error) {
+	start := time.Now()
+	ep, err := nw.programEndpoint(ctx, apipaCli, nl, plc, netioCli, nsc, iptc, dhcpc, epInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	nw.recordEndpoint(ep, epInfo, start)
+	return ep, nil
+}
+
+// programEndpoint programs the endpoint in the dataplane without adding it to the network's state, which only reads
+// the network, so that the endpoints of a pod can be programmed concurrently.
+func (nw *network) programEndpoint(
+	ctx context.Context,
 	apipaCli apipaClient,
 	nl netlink.NetlinkInterface,
 	plc platform.ExecClient,
@@ -196,27 +331,43 @@ func (nw *network) newEndpoint(
 	var ep *endpoint
 	var err error
 
+	ctx, span := tracing.Start(ctx, "network.CreateEndpoint",
+		attribute.String("endpoint.id", epInfo.EndpointID), attribute.String("nic.type", string(epInfo.NICType)))
+	start := time.Now()
 	defer func() {
+		tracing.End(span, err)
+		recordEndpointOperation(operationCreate, epInfo.NICType, start, err)
 		if err != nil {
 			logger.Error("Failed to create endpoint with err", zap.String("id", epInfo.EndpointID), zap.Error(err))
 		}
 	}()
 
+	if err = validateAllowedVlanIDs(epInfo.AllowedVlanIDs); err != nil {
+		return nil, err
+	}
+
 	// Call the platform implementation.
 	// Pass nil for epClient and will be initialized in newendpointImpl
-	ep, err = nw.newEndpointImpl(apipaCli, nl, plc, netioCli, nil, nsc, iptc, dhcpc, epInfo)
+	ep, err = nw.newEndpointImpl(ctx, apipaCli, nl, plc, netioCli, nil, nsc, iptc, dhcpc, epInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	nw.Endpoints[ep.Id] = ep
-	logger.Info("Created endpoint. Num of endpoints", zap.Any("ep", ep), zap.Int("numEndpoints", len(nw.Endpoints)))
-
 	return ep, nil
 }
 
+// recordEndpoint adds the endpoint programmed since start to the network's state.
+func (nw *network) recordEndpoint(ep *endpoint, epInfo *EndpointInfo, start time.Time) {
+	ep.AddResult = epInfo.AddResult
+	ep.History = append([]EndpointOperation(nil), nw.FailedAdds[failedAddKey(epInfo)]...)
+	ep.addHistory(EndpointOperationAdd, start, nil)
+	nw.addEndpoint(ep)
+	nw.recordUtilization()
+	logger.Info("Created endpoint. Num of endpoints", zap.Any("ep", ep), zap.Int("numEndpoints", len(nw.Endpoints)))
+}
+
 // DeleteEndpoint deletes an existing endpoint from the network.
-func (nw *network) deleteEndpoint(nl netlink.NetlinkInterface, plc platform.ExecClient, nioc netio.NetIOInterface, nsc NamespaceClientInterface,
+func (nw *network) deleteEndpoint(ctx context.Context, nl netlink.NetlinkInterface, plc platform.ExecClient, nioc netio.NetIOInterface, nsc NamespaceClientInterface,
 	iptc ipTablesClient, dhcpc dhcpClient, endpointID string,
 ) error {
 	var err error
@@ -237,17 +388,31 @@ func (nw *network) deleteEndpoint(nl netlink.NetlinkInterface, plc platform.Exec
 
 	// Call the platform implementation.
 	// Pass nil for epClient and will be initialized in deleteEndpointImpl
-	err = nw.deleteEndpointImpl(nl, plc, nil, nioc, nsc, iptc, dhcpc, ep)
+	ctx, span := tracing.Start(ctx, "network.DeleteEndpoint",
+		attribute.String("endpoint.id", ep.Id), attribute.String("nic.type", string(ep.NICType)))
+	start := time.Now()
+	err = nw.deleteEndpointImpl(ctx, nl, plc, nil, nioc, nsc, iptc, dhcpc, ep)
+	tracing.End(span, err)
+	recordEndpointOperation(operationDelete, ep.NICType, start, err)
 	if err != nil {
 		return err
 	}
 
 	// Remove the endpoint object.
-	delete(nw.Endpoints, endpointID)
-	logger.Info("Deleted endpoint. Num of endpoints", zap.Any("ep", ep), zap.Int("numEndpoints", len(nw.Endpoints)))
+	nw.removeEndpoint(ep)
 	return nil
 }
 
+// removeEndpoint removes an endpoint from the network's state.
+func (nw *network) removeEndpoint(ep *endpoint) {
+	delete(nw.Endpoints, ep.Id)
+	if nw.index != nil {
+		nw.index.remove(ep.Id, ep)
+	}
+	nw.recordUtilization()
+	logger.Info("Deleted endpoint. Num of endpoints", zap.Any("ep", ep), zap.Int("numEndpoints", len(nw.Endpoints)))
+}
+
 // GetEndpoint returns the endpoint with the given ID.
 func (nw *network) getEndpoint(endpointId string) (*endpoint, error) {
 	ep := nw.Endpoints[endpointId]
@@ -259,14 +424,91 @@ func (nw *network) getEndpoint(endpointId string) (*endpoint, error) {
 	return ep, nil
 }
 
-// GetEndpointByPOD returns the endpoint with the given ID.
-func (nw *network) getEndpointByPOD(podName string, podNameSpace string, doExactMatchForPodName bool) (*endpoint, error) {
-	logger.Info("Trying to retrieve endpoint for pod name in namespace", zap.String("podName", podName), zap.String("podNameSpace", podNameSpace))
+// PodMatchMode is how the endpoints of a pod are found by the details of the pod.
+type PodMatchMode string
+
+const (
+	// PodMatchWithoutSuffix matches the endpoints whose pod name without its last two dash-delimited parts, the
+	// replicaset and pod suffixes, is the name, the default
+	PodMatchWithoutSuffix PodMatchMode = ""
+	// PodMatchExact matches the endpoints whose pod name is the name
+	PodMatchExact PodMatchMode = "exact"
+	// PodMatchPrefix matches the endpoints whose pod name is the name or starts with the name followed by a dash
+	PodMatchPrefix PodMatchMode = "prefix"
+	// PodMatchRegex matches the endpoints whose pod name has the same name captured by the regex as the name
+	PodMatchRegex PodMatchMode = "regex"
+	// PodMatchUID matches the endpoints with the pod uid, regardless of their pod name
+	PodMatchUID PodMatchMode = "uid"
+)
+
+var (
+	errUnknownPodMatchMode = errors.New("unknown pod match mode")
+	errPodNameRegexMissing = errors.New("pod match by regex without a regex")
+	errPodUIDMissing       = errors.New("pod match by uid without a uid")
+)
+
+// PodMatcher finds the endpoints of a pod in a namespace.
+type PodMatcher struct {
+	Mode      PodMatchMode
+	Name      string
+	Namespace string
+	UID       string         // uid mode only
+	NameRegex *regexp.Regexp // regex mode only
+}
+
+// Validate returns an error if the matcher lacks what its mode matches on.
+func (m *PodMatcher) Validate() error {
+	switch m.Mode {
+	case PodMatchWithoutSuffix, PodMatchExact, PodMatchPrefix:
+	case PodMatchRegex:
+		if m.NameRegex == nil {
+			return errPodNameRegexMissing
+		}
+	case PodMatchUID:
+		if m.UID == "" {
+			return errPodUIDMissing
+		}
+	default:
+		return errors.Wrapf(errUnknownPodMatchMode, "%q", m.Mode)
+	}
+	return nil
+}
+
+func (m *PodMatcher) matches(ep *endpoint) bool {
+	if ep.PODNameSpace != m.Namespace {
+		return false
+	}
+
+	switch m.Mode {
+	case PodMatchWithoutSuffix:
+		return m.Name == GetPodNameWithoutSuffix(ep.PODName)
+	case PodMatchExact:
+		return ep.PODName == m.Name
+	case PodMatchPrefix:
+		return ep.PODName == m.Name || strings.HasPrefix(ep.PODName, m.Name+"-")
+	case PodMatchRegex:
+		name := PodNameFromRegex(m.NameRegex, m.Name)
+		return name != "" && PodNameFromRegex(m.NameRegex, ep.PODName) == name
+	case PodMatchUID:
+		return ep.PODUID == m.UID
+	default:
+		return false
+	}
+}
+
+// getEndpointByPOD returns the endpoint of the pod the matcher finds.
+func (nw *network) getEndpointByPOD(match PodMatcher) (*endpoint, error) {
+	logger.Info("Trying to retrieve endpoint for pod name in namespace", zap.String("podName", match.Name),
+		zap.String("podNameSpace", match.Namespace), zap.String("podMatch", string(match.Mode)))
+
+	if err := match.Validate(); err != nil {
+		return nil, err
+	}
 
 	var ep *endpoint
 
-	for _, endpoint := range nw.Endpoints {
-		if podNameMatches(endpoint.PODName, podName, doExactMatchForPodName) && endpoint.PODNameSpace == podNameSpace {
+	for _, endpoint := range nw.endpointIndex().podCandidates(&match) {
+		if match.matches(endpoint) {
 			if ep == nil {
 				ep = endpoint
 			} else {
@@ -282,13 +524,17 @@ func (nw *network) getEndpointByPOD(podName string, podNameSpace string, doExact
 	return ep, nil
 }
 
-func podNameMatches(source string, actualValue string, doExactMatch bool) bool {
-	if doExactMatch {
-		return source == actualValue
-	} else {
-		// If exact match flag is disabled we just check if the existing podname field for an endpoint
-		// starts with passed podname string.
-		return actualValue == GetPodNameWithoutSuffix(source)
+// PodNameFromRegex returns the name the regex captures from the pod name, its first capture group or the whole match
+// without one, or an empty name if the pod name doesn't match.
+func PodNameFromRegex(re *regexp.Regexp, podName string) string {
+	match := re.FindStringSubmatch(podName)
+	switch {
+	case match == nil:
+		return ""
+	case len(match) > 1:
+		return match[1]
+	default:
+		return match[0]
 	}
 }
 
@@ -296,12 +542,14 @@ func podNameMatches(source string, actualValue string, doExactMatch bool) bool {
 // Endpoint
 //
 
-// GetInfo returns information about the endpoint.
-func (ep *endpoint) getInfo() *EndpointInfo {
+// GetInfo returns information about the endpoint. If stats is set, the endpoint's traffic counters are read with it and
+// added to its Data.
+func (ep *endpoint) getInfo(stats netio.NetIOInterface) *EndpointInfo {
 	info := &EndpointInfo{
 		EndpointID:               ep.Id,
 		IPAddresses:              ep.IPAddresses,
 		InfraVnetIP:              ep.InfraVnetIP,
+		InfraVnetIPv6:            ep.InfraVnetIPv6,
 		Data:                     make(map[string]interface{}),
 		MacAddress:               ep.MacAddress,
 		SandboxKey:               ep.SandboxKey,
@@ -312,23 +560,51 @@ func (ep *endpoint) getInfo() *EndpointInfo {
 		EnableMultiTenancy:       ep.EnableMultitenancy,
 		AllowInboundFromHostToNC: ep.AllowInboundFromHostToNC,
 		AllowInboundFromNCToHost: ep.AllowInboundFromNCToHost,
+		HostToNCPortRules:        ep.HostToNCPortRules,
+		NCToHostPortRules:        ep.NCToHostPortRules,
 		IfName:                   ep.IfName,
 		ContainerID:              ep.ContainerID,
 		NetNsPath:                ep.NetworkNameSpace,
 		PODName:                  ep.PODName,
 		PODNameSpace:             ep.PODNameSpace,
+		PODUID:                   ep.PODUID,
 		NetworkContainerID:       ep.NetworkContainerID,
 		HNSEndpointID:            ep.HnsId,
 		HostIfName:               ep.HostIfName,
 		NICType:                  ep.NICType,
+		OutboundNATExceptions:    ep.OutboundNATExceptions,
+		SkipDNSRedirect:          ep.SkipDNSRedirect,
+		DSCP:                     ep.DSCP,
+		DisableConntrackFlush:    ep.DisableConntrackFlush,
+		FlowLogs:                 ep.FlowLogs,
+		EnableEBPFDatapath:       ep.EnableEBPFDatapath,
+		DatapathGeneration:       ep.DatapathGeneration,
+		RouteTable:               ep.RouteTable,
+		AddResult:                ep.AddResult,
 	}
 
 	info.Routes = append(info.Routes, ep.Routes...)
 
 	info.Gateways = append(info.Gateways, ep.Gateways...)
 
+	info.History = append(info.History, ep.History...)
+
+	info.AllowedVlanIDs = append(info.AllowedVlanIDs, ep.AllowedVlanIDs...)
+
+	if ep.EthtoolSettings != nil {
+		settings := *ep.EthtoolSettings
+		info.EthtoolSettings = &settings
+	}
+
+	if ep.ARP != nil {
+		arp := *ep.ARP
+		info.ARP = &arp
+	}
+
+	info.HostProtectedPorts = append(info.HostProtectedPorts, ep.HostProtectedPorts...)
+
 	// Call the platform implementation.
-	ep.getInfoImpl(info)
+	ep.getInfoImpl(info, stats)
 
 	return info
 }
@@ -359,6 +635,21 @@ func (ep *endpoint) detach() error {
 	return nil
 }
 
+// delegatedNICName returns the name of the delegated nic with the given mac address, if the endpoint holds it. The
+// nic is in the SecondaryInterfaces of linux endpoints, and is the endpoint itself on windows.
+func (ep *endpoint) delegatedNICName(macAddress net.HardwareAddr) (string, bool) {
+	for ifName, ifInfo := range ep.SecondaryInterfaces {
+		if bytes.Equal(ifInfo.MacAddress, macAddress) {
+			return ifName, true
+		}
+	}
+	if ep.NICType.IsFrontendNIC() && bytes.Equal(ep.MacAddress, macAddress) {
+		return ep.IfName, true
+	}
+
+	return "", false
+}
+
 // updateEndpoint updates an existing endpoint in the network.
 func (nm *networkManager) updateEndpoint(nw *network, existingEpInfo, targetEpInfo *EndpointInfo) error {
 	var err error
@@ -392,6 +683,9 @@ func (nm *networkManager) updateEndpoint(nw *network, existingEpInfo, targetEpIn
 	return nil
 }
 
+// GetPodNameWithoutSuffix strips the last two dash-delimited parts of the pod name, the replicaset and pod suffixes of
+// a deployment's pod. It strips the wrong parts of pods which aren't from a deployment, use a PodMatcher with another
+// mode for them.
 func GetPodNameWithoutSuffix(podName string) string {
 	nameSplit := strings.Split(podName, "-")
 	if len(nameSplit) > 2 {
@@ -417,17 +711,58 @@ func (ep *endpoint) validateEndpoint() error {
 	return nil
 }
 
-func validateEndpoints(eps []*endpoint) error {
-	containerIDs := map[string]bool{}
+// EndpointValidationMode selects what the endpoints of an ADD must have in common.
+type EndpointValidationMode string
+
+const (
+	// ValidateByContainerID requires the endpoints of an ADD to share a container id, the default
+	ValidateByContainerID EndpointValidationMode = "containerID"
+	// ValidateByPodUID requires the endpoints of an ADD to share a pod uid and allows differing container ids, for
+	// sandboxes such as windows hostprocess pods whose interfaces are added with the ids of different containers
+	ValidateByPodUID EndpointValidationMode = "podUID"
+)
+
+func validateEndpoints(eps []*endpoint, mode EndpointValidationMode) error {
+	switch mode {
+	case "", ValidateByContainerID:
+		return validateEndpointsBy(eps, "container id", func(ep *endpoint) string { return ep.ContainerID })
+	case ValidateByPodUID:
+		return validateEndpointsBy(eps, "pod uid", func(ep *endpoint) string { return ep.PODUID })
+	default:
+		return errors.Errorf("unknown endpoint validation mode %q", mode)
+	}
+}
+
+// validateEndpointsBy checks that the endpoints are valid and share a non-empty key.
+func validateEndpointsBy(eps []*endpoint, keyName string, key func(*endpoint) string) error {
+	keys := map[string]bool{}
 	for _, ep := range eps {
 		if err := ep.validateEndpoint(); err != nil {
 			return errors.Wrap(err, "failed to validate endpoint struct")
 		}
-		containerIDs[ep.ContainerID] = true
+		if key(ep) == "" {
+			return errors.Errorf("endpoint %s has no %s", ep.Id, keyName)
+		}
+		keys[key(ep)] = true
+
+		if len(keys) != 1 {
+			return errors.Errorf("multiple distinct %ss detected", keyName)
+		}
+	}
+	return nil
+}
 
-		if len(containerIDs) != 1 {
-			return errors.New("multiple distinct container ids detected")
+// validateAllowedVlanIDs checks that the vlans of an endpoint's trunk are distinct and in range.
+func validateAllowedVlanIDs(vlanIDs []int) error {
+	seen := make(map[int]bool, len(vlanIDs))
+	for _, vlanID := range vlanIDs {
+		if vlanID < minTrunkVlanID || vlanID > maxTrunkVlanID {
+			return errors.Wrapf(errInvalidVlanID, "%d is out of range [%d, %d]", vlanID, minTrunkVlanID, maxTrunkVlanID)
+		}
+		if seen[vlanID] {
+			return errors.Wrapf(errInvalidVlanID, "%d is duplicated", vlanID)
 		}
+		seen[vlanID] = true
 	}
 	return nil
 }
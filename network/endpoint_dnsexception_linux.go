@@ -0,0 +1,72 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/network/snat"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// getDNSRedirectExceptionMatches returns the nat PREROUTING match conditions that exempt dns traffic from the
+// endpoint's snat bridge ip to azure dns from the cns dns interception. Nothing is returned if the endpoint does not
+// skip dns redirection or has no snat bridge ip.
+func getDNSRedirectExceptionMatches(ep *endpoint) ([]string, error) {
+	if !ep.SkipDNSRedirect || ep.LocalIP == "" {
+		return nil, nil
+	}
+
+	localIP, _, err := net.ParseCIDR(ep.LocalIP)
+	if err != nil {
+		if localIP = net.ParseIP(ep.LocalIP); localIP == nil {
+			return nil, errors.Wrapf(err, "invalid local ip %s", ep.LocalIP)
+		}
+	}
+
+	var matches []string
+	for _, protocol := range []string{iptables.UDP, iptables.TCP} {
+		match := fmt.Sprintf("-i %s -s %s -d %s -p %s --dport %s",
+			snat.SnatBridgeName, localIP.String(), networkutils.AzureDNS, protocol, strconv.Itoa(iptables.DNSPort))
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// addDNSRedirectExceptions inserts RETURN rules at the top of nat PREROUTING so that the endpoint's dns queries
+// reach azure dns directly instead of being redirected to the cns dns proxy.
+func addDNSRedirectExceptions(iptc ipTablesClient, ep *endpoint) error {
+	matches, err := getDNSRedirectExceptionMatches(ep)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		logger.Info("Adding dns redirect exception", zap.String("endpointID", ep.Id), zap.String("match", match))
+		if err := iptc.InsertIptableRule(iptables.V4, iptables.Nat, iptables.Prerouting, match, iptables.Return); err != nil {
+			return errors.Wrapf(err, "failed to add dns redirect exception %s", match)
+		}
+	}
+
+	return nil
+}
+
+// deleteDNSRedirectExceptions removes the rules added by addDNSRedirectExceptions. Errors are logged and ignored.
+func deleteDNSRedirectExceptions(iptc ipTablesClient, ep *endpoint) {
+	matches, err := getDNSRedirectExceptionMatches(ep)
+	if err != nil {
+		logger.Error("Failed to get dns redirect exceptions", zap.String("endpointID", ep.Id), zap.Error(err))
+		return
+	}
+
+	for _, match := range matches {
+		logger.Info("Deleting dns redirect exception", zap.String("endpointID", ep.Id), zap.String("match", match))
+		if err := iptc.DeleteIptableRule(iptables.V4, iptables.Nat, iptables.Prerouting, match, iptables.Return); err != nil {
+			logger.Error("Failed to delete dns redirect exception", zap.String("match", match), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// getDSCPMarkMatches returns the mangle PREROUTING match conditions of the traffic the endpoint sends through the host,
+// keyed by iptables version, and the target marking it with the dscp of the endpoint. Nothing is returned if the
+// endpoint's traffic is not marked.
+func getDSCPMarkMatches(ep *endpoint) (matches map[string][]string, target string) {
+	if ep.DSCP == 0 {
+		return nil, ""
+	}
+
+	matches = make(map[string][]string)
+	for _, ipAddr := range ep.IPAddresses {
+		version := iptables.V4
+		if ipAddr.IP.To4() == nil {
+			version = iptables.V6
+		}
+		matches[version] = append(matches[version], "-s "+ipAddr.IP.String())
+	}
+
+	return matches, fmt.Sprintf("DSCP --set-dscp %d", ep.DSCP)
+}
+
+// addDSCPMarks appends rules to mangle PREROUTING which mark the egress traffic of the endpoint with its dscp, before
+// it is routed out of the node and snatted.
+func addDSCPMarks(iptc ipTablesClient, ep *endpoint) error {
+	matches, target := getDSCPMarkMatches(ep)
+	for version, versionMatches := range matches {
+		for _, match := range versionMatches {
+			logger.Info("Adding dscp mark", zap.String("endpointID", ep.Id), zap.String("match", match), zap.Int("dscp", ep.DSCP))
+			if err := iptc.AppendIptableRule(version, iptables.Mangle, iptables.Prerouting, match, target); err != nil {
+				return errors.Wrapf(err, "failed to add dscp mark %s", match)
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteDSCPMarks removes the rules added by addDSCPMarks. Errors are logged and ignored.
+func deleteDSCPMarks(iptc ipTablesClient, ep *endpoint) {
+	matches, target := getDSCPMarkMatches(ep)
+	for version, versionMatches := range matches {
+		for _, match := range versionMatches {
+			logger.Info("Deleting dscp mark", zap.String("endpointID", ep.Id), zap.String("match", match))
+			if err := iptc.DeleteIptableRule(version, iptables.Mangle, iptables.Prerouting, match, target); err != nil {
+				logger.Error("Failed to delete dscp mark", zap.String("match", match), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package network
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Operations recorded in an endpoint's history.
+const (
+	EndpointOperationAdd    = "ADD"
+	EndpointOperationUpdate = "UPDATE"
+	EndpointOperationRepair = "REPAIR"
+)
+
+const (
+	// maxEndpointHistory is the number of operations kept per endpoint, older operations are dropped.
+	maxEndpointHistory = 10
+	// maxFailedAddPods is the number of pods whose failed ADDs a network keeps, the pods which failed the longest
+	// ago are dropped first.
+	maxFailedAddPods = 64
+)
+
+// EndpointOperation is an operation which programmed an endpoint on this node.
+type EndpointOperation struct {
+	Operation string
+	Timestamp time.Time
+	Duration  time.Duration
+	// Error is the error the operation failed with, empty if it succeeded
+	Error string `json:",omitempty"`
+}
+
+// addHistory records an operation which started at start and completed with err, keeping the last
+// maxEndpointHistory operations.
+func (ep *endpoint) addHistory(operation string, start time.Time, err error) {
+	op := EndpointOperation{
+		Operation: operation,
+		Timestamp: start,
+		Duration:  time.Since(start),
+	}
+	if err != nil {
+		op.Error = err.Error()
+	}
+
+	ep.History = append(ep.History, op)
+	if len(ep.History) > maxEndpointHistory {
+		ep.History = append([]EndpointOperation(nil), ep.History[len(ep.History)-maxEndpointHistory:]...)
+	}
+}
+
+// failedAddKey returns the key the failed ADDs of the endpoint's pod are kept under. The ADD the runtime retries is of a
+// new sandbox, and so of a new endpoint, so the failures are kept by pod.
+func failedAddKey(epInfo *EndpointInfo) string {
+	if epInfo.PODName == "" {
+		return epInfo.EndpointID
+	}
+	return epInfo.PODNameSpace + "/" + epInfo.PODName
+}
+
+// recordFailedAdd keeps an ADD of the endpoint which failed, for the history of the endpoint the next ADD of its pod
+// creates, and persists it. It is a no-op in stateless cni mode, which keeps no endpoint state on the node.
+func (nm *networkManager) recordFailedAdd(epInfo *EndpointInfo, start time.Time, addErr error) {
+	if nm.IsStatelessCNIMode() {
+		return
+	}
+
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(epInfo.NetworkID)
+	if err != nil {
+		return
+	}
+
+	// the failures are kept as the history of an endpoint which never made it into the network
+	ep := &endpoint{Id: epInfo.EndpointID, History: nw.FailedAdds[failedAddKey(epInfo)]}
+	ep.addHistory(EndpointOperationAdd, start, addErr)
+	if nw.FailedAdds == nil {
+		nw.FailedAdds = make(map[string][]EndpointOperation)
+	}
+	nw.FailedAdds[failedAddKey(epInfo)] = ep.History
+
+	if len(nw.FailedAdds) > maxFailedAddPods {
+		oldest := ""
+		for key, ops := range nw.FailedAdds {
+			if oldest == "" || ops[len(ops)-1].Timestamp.Before(nw.FailedAdds[oldest][len(nw.FailedAdds[oldest])-1].Timestamp) {
+				oldest = key
+			}
+		}
+		delete(nw.FailedAdds, oldest)
+	}
+
+	nm.saveHistory(ep)
+}
+
+// forgetFailedAdds drops the failed ADDs of the pods of the endpoints, once an ADD of the pods has succeeded.
+func (nm *networkManager) forgetFailedAdds(epInfos []*EndpointInfo) {
+	nm.Lock()
+	defer nm.Unlock()
+
+	for _, epInfo := range epInfos {
+		if nw, err := nm.getNetwork(epInfo.NetworkID); err == nil {
+			delete(nw.FailedAdds, failedAddKey(epInfo))
+		}
+	}
+}
+
+// saveHistory persists an operation recorded while the lock is held. Failures are logged, the operation's own
+// result is what the caller reports.
+func (nm *networkManager) saveHistory(ep *endpoint) {
+	if err := nm.save(); err != nil {
+		logger.Error("Failed to save endpoint history", zap.String("endpointID", ep.Id), zap.Error(err))
+	}
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddHistoryKeepsLastOperations(t *testing.T) {
+	ep := &endpoint{Id: "a"}
+	for i := 0; i < maxEndpointHistory+3; i++ {
+		ep.addHistory(fmt.Sprintf("op%d", i), time.Now(), nil)
+	}
+	ep.addHistory(EndpointOperationUpdate, time.Now(), errors.New("update failed"))
+
+	require.Len(t, ep.History, maxEndpointHistory)
+	require.Equal(t, "op4", ep.History[0].Operation)
+	require.Equal(t, EndpointOperationUpdate, ep.History[maxEndpointHistory-1].Operation)
+	require.Equal(t, "update failed", ep.History[maxEndpointHistory-1].Error)
+
+	// the history is copied into the endpoint info
+	info := ep.getInfo(nil)
+	info.History[0].Operation = "changed"
+	require.Equal(t, "op4", ep.History[0].Operation)
+}
+
+func TestRecordFailedAdd(t *testing.T) {
+	nm := newDatapathGenerationTestManager(nil)
+	nw := nm.ExternalInterfaces["eth0"].Networks["azure"]
+
+	// the retried ADD is of a new endpoint of the same pod
+	start := time.Now()
+	nm.recordFailedAdd(&EndpointInfo{NetworkID: "azure", EndpointID: "c1-eth0", PODName: "pod", PODNameSpace: "ns"}, start,
+		errors.New("add failed"))
+	nm.recordFailedAdd(&EndpointInfo{NetworkID: "azure", EndpointID: "c2-eth0", PODName: "pod", PODNameSpace: "ns"}, start,
+		errors.New("add failed again"))
+	nm.recordFailedAdd(&EndpointInfo{NetworkID: "missing", EndpointID: "c3-eth0"}, start, errors.New("add failed"))
+
+	require.Len(t, nw.FailedAdds, 1)
+	require.Len(t, nw.FailedAdds["ns/pod"], 2)
+	require.Equal(t, EndpointOperationAdd, nw.FailedAdds["ns/pod"][1].Operation)
+	require.Equal(t, "add failed again", nw.FailedAdds["ns/pod"][1].Error)
+
+	nm.forgetFailedAdds([]*EndpointInfo{{NetworkID: "azure", EndpointID: "c4-eth0", PODName: "pod", PODNameSpace: "ns"}})
+	require.Empty(t, nw.FailedAdds)
+
+	// the pods which failed the longest ago are dropped first
+	for i := 0; i <= maxFailedAddPods; i++ {
+		nm.recordFailedAdd(&EndpointInfo{NetworkID: "azure", EndpointID: fmt.Sprintf("c%d-eth0", i)}, start.Add(time.Duration(i)*time.Second),
+			errors.New("add failed"))
+	}
+	require.Len(t, nw.FailedAdds, maxFailedAddPods)
+	require.NotContains(t, nw.FailedAdds, "c0-eth0")
+	require.Contains(t, nw.FailedAdds, fmt.Sprintf("c%d-eth0", maxFailedAddPods))
+}
+
+func TestMigrateEndpointRecordsRepair(t *testing.T) {
+	migrations := []datapathMigration{
+		func(*networkManager, *network, *endpoint) error { return nil },
+		func(*networkManager, *network, *endpoint) error { return errors.New("migration failed") },
+	}
+	nm := newDatapathGenerationTestManager(migrations, 0, 2)
+
+	_, err := nm.MigrateEndpoints("", 0)
+	require.NoError(t, err)
+
+	epInfo, err := nm.GetEndpointInfo("azure", "a")
+	require.NoError(t, err)
+	require.Len(t, epInfo.History, 1)
+	require.Equal(t, EndpointOperationRepair, epInfo.History[0].Operation)
+	require.Contains(t, epInfo.History[0].Error, "migration failed")
+
+	// endpoints at the target generation are not repaired
+	epInfo, err = nm.GetEndpointInfo("azure", "b")
+	require.NoError(t, err)
+	require.Empty(t, epInfo.History)
+}
@@ -0,0 +1,63 @@
+package network
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// EndpointHook is notified synchronously of the endpoints the network manager creates and deletes, so that a policy
+// agent like NPM can program the policies of an endpoint before its pod sends its first packets, rather than once it
+// learns of the pod from the apiserver.
+type EndpointHook interface {
+	// EndpointsCreated is called with the endpoints of a pod once all of them are created, before they are saved.
+	// An error fails the ADD, which deletes the endpoints.
+	EndpointsCreated(ctx context.Context, epInfos []*EndpointInfo) error
+	// EndpointDeleted is called once an endpoint is deleted. An error is only logged, the endpoint is gone anyway.
+	EndpointDeleted(ctx context.Context, epInfo *EndpointInfo) error
+}
+
+// AddEndpointHook registers a hook notified of the endpoints created and deleted from now on, after the hooks
+// registered before it.
+func (nm *networkManager) AddEndpointHook(hook EndpointHook) {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nm.endpointHooks = append(nm.endpointHooks, hook)
+}
+
+// notifyEndpointsCreated calls the hooks with the created endpoints, stopping at the first one which fails.
+func (nm *networkManager) notifyEndpointsCreated(ctx context.Context, eps []*endpoint) error {
+	nm.Lock()
+	hooks := nm.endpointHooks
+	nm.Unlock()
+
+	if len(hooks) == 0 || len(eps) == 0 {
+		return nil
+	}
+
+	epInfos := make([]*EndpointInfo, 0, len(eps))
+	for _, ep := range eps {
+		epInfos = append(epInfos, ep.getInfo(nil))
+	}
+	for _, hook := range hooks {
+		if err := hook.EndpointsCreated(ctx, epInfos); err != nil {
+			return errors.Wrapf(err, "endpoint hook failed on endpoints of container %s", eps[0].ContainerID)
+		}
+	}
+	return nil
+}
+
+// notifyEndpointDeleted calls all the hooks with the deleted endpoint.
+// Note: the caller holds the network manager lock.
+func (nm *networkManager) notifyEndpointDeleted(ctx context.Context, epInfo *EndpointInfo) {
+	if epInfo == nil {
+		return
+	}
+	for _, hook := range nm.endpointHooks {
+		if err := hook.EndpointDeleted(ctx, epInfo); err != nil {
+			logger.Error("Endpoint hook failed on deleted endpoint", zap.String("endpointID", epInfo.EndpointID), zap.Error(err))
+		}
+	}
+}
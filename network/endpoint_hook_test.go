@@ -0,0 +1,75 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestHook = errors.New("test hook failure")
+
+type recordingHook struct {
+	name    string
+	calls   *[]string
+	created [][]*EndpointInfo
+	err     error
+}
+
+func (h *recordingHook) EndpointsCreated(_ context.Context, epInfos []*EndpointInfo) error {
+	*h.calls = append(*h.calls, h.name+" created")
+	h.created = append(h.created, epInfos)
+	return h.err
+}
+
+func (h *recordingHook) EndpointDeleted(_ context.Context, epInfo *EndpointInfo) error {
+	*h.calls = append(*h.calls, h.name+" deleted "+epInfo.EndpointID)
+	return h.err
+}
+
+func TestNotifyEndpointsCreated(t *testing.T) {
+	var calls []string
+	first := &recordingHook{name: "first", calls: &calls}
+	second := &recordingHook{name: "second", calls: &calls}
+	nm := &networkManager{}
+	nm.AddEndpointHook(first)
+	nm.AddEndpointHook(second)
+
+	eps := []*endpoint{
+		{Id: "12345678-eth0", ContainerID: "12345678", IfName: "eth0", HostIfName: "azv1"},
+		{Id: "12345678-eth1", ContainerID: "12345678", IfName: "eth1"},
+	}
+	require.NoError(t, nm.notifyEndpointsCreated(context.Background(), eps))
+	assert.Equal(t, []string{"first created", "second created"}, calls)
+	require.Len(t, first.created, 1)
+	require.Len(t, first.created[0], 2)
+	assert.Equal(t, "12345678-eth0", first.created[0][0].EndpointID)
+	assert.Equal(t, "azv1", first.created[0][0].HostIfName)
+
+	// the hooks after a failed one are not called, the ADD fails
+	calls = nil
+	first.err = errTestHook
+	require.ErrorIs(t, nm.notifyEndpointsCreated(context.Background(), eps), errTestHook)
+	assert.Equal(t, []string{"first created"}, calls)
+
+	calls = nil
+	require.NoError(t, nm.notifyEndpointsCreated(context.Background(), nil))
+	assert.Empty(t, calls)
+}
+
+func TestNotifyEndpointDeleted(t *testing.T) {
+	var calls []string
+	nm := &networkManager{}
+	nm.AddEndpointHook(&recordingHook{name: "first", calls: &calls, err: errTestHook})
+	nm.AddEndpointHook(&recordingHook{name: "second", calls: &calls})
+
+	// a failed hook does not keep the others from being notified
+	nm.notifyEndpointDeleted(context.Background(), &EndpointInfo{EndpointID: "12345678-eth0"})
+	assert.Equal(t, []string{"first deleted 12345678-eth0", "second deleted 12345678-eth0"}, calls)
+
+	calls = nil
+	nm.notifyEndpointDeleted(context.Background(), nil)
+	assert.Empty(t, calls)
+}
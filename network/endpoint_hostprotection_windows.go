@@ -0,0 +1,96 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	hostProtectionRulePrefix = "azure-cni-host-protection"
+	netshCmd                 = "netsh"
+)
+
+var errInvalidHostProtectedPort = errors.New("invalid host protected port")
+
+// getHostProtectionRules returns the netsh arguments of the windows firewall rules, which are installed as wfp filters,
+// blocking the endpoint's traffic to its host protected ports, keyed by rule name. There is a rule per endpoint ip and
+// protocol, so the rules of an endpoint are found again from its ips at DEL.
+func getHostProtectionRules(ep *endpoint) (map[string][]string, error) {
+	if len(ep.HostProtectedPorts) == 0 || ep.NICType != cns.InfraNIC {
+		return nil, nil
+	}
+
+	ports := make(map[string][]string)
+	for _, hostPort := range ep.HostProtectedPorts {
+		protocol, port, found := strings.Cut(strings.ToLower(hostPort), "/")
+		if !found || (protocol != "tcp" && protocol != "udp") {
+			return nil, errors.Wrapf(errInvalidHostProtectedPort, "%s, expected <tcp|udp>/<port>", hostPort)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, errors.Wrapf(errInvalidHostProtectedPort, "%s, expected <tcp|udp>/<port>", hostPort)
+		}
+		ports[protocol] = append(ports[protocol], port)
+	}
+
+	rules := make(map[string][]string)
+	for _, ipAddr := range ep.IPAddresses {
+		for protocol, protocolPorts := range ports {
+			sort.Strings(protocolPorts)
+			name := fmt.Sprintf("%s-%s-%s", hostProtectionRulePrefix, ipAddr.IP.String(), protocol)
+			rules[name] = []string{
+				"advfirewall", "firewall", "add", "rule", "name=" + name, "dir=in", "action=block",
+				"protocol=" + protocol, "localport=" + strings.Join(protocolPorts, ","), "remoteip=" + ipAddr.IP.String(),
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// addHostProtectionRules installs the rules protecting the host from the endpoint's traffic. The rules left behind by
+// an earlier endpoint with the same ip are replaced.
+func addHostProtectionRules(plc platform.ExecClient, ep *endpoint) error {
+	rules, err := getHostProtectionRules(ep)
+	if err != nil {
+		return err
+	}
+
+	for name, args := range rules {
+		deleteHostProtectionRule(plc, name)
+		logger.Info("Adding host protection rule", zap.String("endpointID", ep.Id), zap.Strings("args", args))
+		if _, err := plc.ExecuteCommand(context.TODO(), netshCmd, args...); err != nil {
+			return errors.Wrapf(err, "failed to add host protection rule %s", name)
+		}
+	}
+
+	return nil
+}
+
+// deleteHostProtectionRules removes the rules protecting the host from the endpoint's traffic.
+func deleteHostProtectionRules(plc platform.ExecClient, ep *endpoint) {
+	rules, err := getHostProtectionRules(ep)
+	if err != nil {
+		logger.Error("Failed to get host protection rules", zap.String("endpointID", ep.Id), zap.Error(err))
+		return
+	}
+
+	for name := range rules {
+		logger.Info("Deleting host protection rule", zap.String("endpointID", ep.Id), zap.String("name", name))
+		deleteHostProtectionRule(plc, name)
+	}
+}
+
+// deleteHostProtectionRule removes a rule by name, netsh fails if no rule matches so errors are only logged.
+func deleteHostProtectionRule(plc platform.ExecClient, name string) {
+	if _, err := plc.ExecuteCommand(context.TODO(), netshCmd, "advfirewall", "firewall", "delete", "rule", "name="+name); err != nil {
+		logger.Info("Host protection rule not deleted", zap.String("name", name), zap.Error(err))
+	}
+}
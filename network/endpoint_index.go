@@ -0,0 +1,133 @@
+package network
+
+import "net"
+
+// endpointSets holds sets of endpoints, by their id in the endpoints of the network, by a key.
+type endpointSets map[string]map[string]*endpoint
+
+func (s endpointSets) add(key, id string, ep *endpoint) {
+	if s[key] == nil {
+		s[key] = make(map[string]*endpoint)
+	}
+	s[key][id] = ep
+}
+
+func (s endpointSets) remove(key, id string, _ *endpoint) {
+	set, ok := s[key]
+	if !ok {
+		return
+	}
+	delete(set, id)
+	if len(set) == 0 {
+		delete(s, key)
+	}
+}
+
+// endpointIndex holds the endpoints of a network by pod, container id and ip, so the lookups of a CNI call don't scan
+// every endpoint of nodes with many pods.
+type endpointIndex struct {
+	byNamespace            endpointSets
+	byPodName              endpointSets // namespace/name
+	byPodNameWithoutSuffix endpointSets // namespace/name without its suffix
+	byPodUID               endpointSets
+	byContainerID          endpointSets
+	byIP                   endpointSets
+}
+
+func newEndpointIndex(eps map[string]*endpoint) *endpointIndex {
+	index := &endpointIndex{
+		byNamespace:            make(endpointSets),
+		byPodName:              make(endpointSets),
+		byPodNameWithoutSuffix: make(endpointSets),
+		byPodUID:               make(endpointSets),
+		byContainerID:          make(endpointSets),
+		byIP:                   make(endpointSets),
+	}
+	for id, ep := range eps {
+		index.add(id, ep)
+	}
+	return index
+}
+
+func podKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// add indexes the endpoint by the id it has in the endpoints of the network.
+func (index *endpointIndex) add(id string, ep *endpoint) {
+	index.update(id, ep, endpointSets.add)
+}
+
+func (index *endpointIndex) remove(id string, ep *endpoint) {
+	index.update(id, ep, endpointSets.remove)
+}
+
+func (index *endpointIndex) update(id string, ep *endpoint, op func(endpointSets, string, string, *endpoint)) {
+	op(index.byNamespace, ep.PODNameSpace, id, ep)
+	op(index.byPodName, podKey(ep.PODNameSpace, ep.PODName), id, ep)
+	op(index.byPodNameWithoutSuffix, podKey(ep.PODNameSpace, GetPodNameWithoutSuffix(ep.PODName)), id, ep)
+	op(index.byPodUID, ep.PODUID, id, ep)
+	op(index.byContainerID, ep.ContainerID, id, ep)
+	for i := range ep.IPAddresses {
+		op(index.byIP, ep.IPAddresses[i].IP.String(), id, ep)
+	}
+}
+
+// podCandidates returns the endpoints the matcher may match. The prefix and regex matches are narrowed down to the
+// endpoints of the namespace only.
+func (index *endpointIndex) podCandidates(match *PodMatcher) map[string]*endpoint {
+	switch match.Mode {
+	case PodMatchWithoutSuffix:
+		return index.byPodNameWithoutSuffix[podKey(match.Namespace, match.Name)]
+	case PodMatchExact:
+		return index.byPodName[podKey(match.Namespace, match.Name)]
+	case PodMatchUID:
+		return index.byPodUID[match.UID]
+	default:
+		return index.byNamespace[match.Namespace]
+	}
+}
+
+// endpointIndex returns the index of the endpoints of the network. The index is built from the endpoints on its first
+// use, as the state is loaded into the endpoints directly, and kept up to date by addEndpoint and removeEndpoint.
+func (nw *network) endpointIndex() *endpointIndex {
+	if nw.index == nil {
+		nw.index = newEndpointIndex(nw.Endpoints)
+	}
+	return nw.index
+}
+
+// addEndpoint adds an endpoint to the network's state.
+func (nw *network) addEndpoint(ep *endpoint) {
+	if old, ok := nw.Endpoints[ep.Id]; ok && nw.index != nil {
+		nw.index.remove(ep.Id, old)
+	}
+	nw.Endpoints[ep.Id] = ep
+	if nw.index != nil {
+		nw.index.add(ep.Id, ep)
+	}
+}
+
+// getEndpointsByContainerID returns the endpoints of the container.
+func (nw *network) getEndpointsByContainerID(containerID string) []*endpoint {
+	var eps []*endpoint
+	for _, ep := range nw.endpointIndex().byContainerID[containerID] {
+		eps = append(eps, ep)
+	}
+	return eps
+}
+
+// getEndpointByIP returns the endpoint with the ip.
+func (nw *network) getEndpointByIP(ip net.IP) (*endpoint, error) {
+	var ep *endpoint
+	for _, candidate := range nw.endpointIndex().byIP[ip.String()] {
+		if ep != nil {
+			return nil, errMultipleEndpointsFound
+		}
+		ep = candidate
+	}
+	if ep == nil {
+		return nil, errEndpointNotFound
+	}
+	return ep, nil
+}
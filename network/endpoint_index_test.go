@@ -0,0 +1,62 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointIndex(t *testing.T) {
+	ip := func(s string) net.IPNet {
+		return net.IPNet{IP: net.ParseIP(s), Mask: net.CIDRMask(24, 32)}
+	}
+	nw := &network{Endpoints: map[string]*endpoint{
+		"ep1": {
+			Id: "ep1", ContainerID: "c1", PODName: "web-5c689d88bb-qwq47", PODNameSpace: "ns", PODUID: "uid1",
+			IPAddresses: []net.IPNet{ip("10.0.0.4")},
+		},
+	}}
+
+	// the index is built from the endpoints the state was loaded into
+	ep, err := nw.getEndpointByPOD(PodMatcher{Name: "web", Namespace: "ns"})
+	require.NoError(t, err)
+	assert.Equal(t, "ep1", ep.Id)
+
+	// and kept up to date with the endpoints added and removed
+	nw.addEndpoint(&endpoint{
+		Id: "ep2", ContainerID: "c1", PODName: "web-5c689d88bb-qwq47", PODNameSpace: "ns", PODUID: "uid1",
+		IPAddresses: []net.IPNet{ip("10.0.1.4")},
+	})
+	nw.addEndpoint(&endpoint{
+		Id: "ep3", ContainerID: "c2", PODName: "db-0", PODNameSpace: "ns", PODUID: "uid2",
+		IPAddresses: []net.IPNet{ip("10.0.0.5")},
+	})
+	assert.Len(t, nw.getEndpointsByContainerID("c1"), 2)
+	_, err = nw.getEndpointByPOD(PodMatcher{Mode: PodMatchUID, UID: "uid1", Namespace: "ns"})
+	require.ErrorIs(t, err, errMultipleEndpointsFound)
+
+	ep, err = nw.getEndpointByIP(net.ParseIP("10.0.1.4"))
+	require.NoError(t, err)
+	assert.Equal(t, "ep2", ep.Id)
+
+	ep, err = nw.getEndpointByPOD(PodMatcher{Mode: PodMatchPrefix, Name: "db", Namespace: "ns"})
+	require.NoError(t, err)
+	assert.Equal(t, "ep3", ep.Id)
+
+	nw.removeEndpoint(nw.Endpoints["ep1"])
+	assert.Len(t, nw.getEndpointsByContainerID("c1"), 1)
+	_, err = nw.getEndpointByIP(net.ParseIP("10.0.0.4"))
+	require.ErrorIs(t, err, errEndpointNotFound)
+	ep, err = nw.getEndpointByPOD(PodMatcher{Mode: PodMatchExact, Name: "web-5c689d88bb-qwq47", Namespace: "ns"})
+	require.NoError(t, err)
+	assert.Equal(t, "ep2", ep.Id)
+
+	// an endpoint added again with the same id replaces the old one in the index
+	nw.addEndpoint(&endpoint{Id: "ep3", ContainerID: "c3", PODName: "db-0", PODNameSpace: "ns"})
+	assert.Empty(t, nw.getEndpointsByContainerID("c2"))
+	assert.Len(t, nw.getEndpointsByContainerID("c3"), 1)
+	_, err = nw.getEndpointByIP(net.ParseIP("10.0.0.5"))
+	require.ErrorIs(t, err, errEndpointNotFound)
+}
@@ -4,18 +4,27 @@
 package network
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/internal/undo"
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/ebpfdatapath"
 	"github.com/Azure/azure-container-networking/network/networkutils"
 	"github.com/Azure/azure-container-networking/ovsctl"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -27,6 +36,9 @@ const (
 	hostVEthInterfacePrefix = commonInterfacePrefix + "v"
 )
 
+// sysClassNetPath is where the kernel exposes the interface counters, overridden in tests.
+var sysClassNetPath = "/sys/class/net"
+
 type AzureHNSEndpointClient interface{}
 
 func generateVethName(key string) string {
@@ -50,6 +62,7 @@ func ConstructEndpointID(containerID string, _ string, ifName string) (string, s
 
 // newEndpointImpl creates a new endpoint in the network.
 func (nw *network) newEndpointImpl(
+	ctx context.Context,
 	_ apipaClient,
 	nl netlink.NetlinkInterface,
 	plc platform.ExecClient,
@@ -112,6 +125,7 @@ func (nw *network) newEndpointImpl(
 		IfName:                   nicName, // container veth pair name. In cnm, we won't rename this and docker expects veth name.
 		HostIfName:               hostIfName,
 		InfraVnetIP:              epInfo.InfraVnetIP,
+		InfraVnetIPv6:            epInfo.InfraVnetIPv6,
 		LocalIP:                  localIP,
 		IPAddresses:              epInfo.IPAddresses,
 		DNS:                      epInfo.EndpointDNS,
@@ -121,18 +135,37 @@ func (nw *network) newEndpointImpl(
 		EnableMultitenancy:       epInfo.EnableMultiTenancy,
 		AllowInboundFromHostToNC: epInfo.AllowInboundFromHostToNC,
 		AllowInboundFromNCToHost: epInfo.AllowInboundFromNCToHost,
+		HostToNCPortRules:        epInfo.HostToNCPortRules,
+		NCToHostPortRules:        epInfo.NCToHostPortRules,
 		NetworkNameSpace:         epInfo.NetNsPath,
 		ContainerID:              epInfo.ContainerID,
 		PODName:                  epInfo.PODName,
 		PODNameSpace:             epInfo.PODNameSpace,
+		PODUID:                   epInfo.PODUID,
 		Routes:                   epInfo.Routes,
 		SecondaryInterfaces:      make(map[string]*InterfaceInfo),
 		NICType:                  epInfo.NICType,
+		OutboundNATExceptions:    epInfo.OutboundNATExceptions,
+		SkipDNSRedirect:          epInfo.SkipDNSRedirect,
+		DSCP:                     epInfo.DSCP,
+		DisableConntrackFlush:    epInfo.DisableConntrackFlush,
+		FlowLogs:                 epInfo.FlowLogs,
+		EnableEBPFDatapath:       epInfo.EnableEBPFDatapath && nw.Mode == opModeTransparent && !nw.IPVlanL3S && !nw.Macvlan && !epInfo.NICType.IsFrontendNIC(),
+		EnableIPVlanL3S:          nw.IPVlanL3S && !epInfo.NICType.IsFrontendNIC(),
+		EnableMacvlan:            nw.Macvlan && !epInfo.NICType.IsFrontendNIC(),
+		AllowedVlanIDs:           epInfo.AllowedVlanIDs,
+		EthtoolSettings:          epInfo.EthtoolSettings,
+		ARP:                      epInfo.ARP,
 	}
 	if nw.extIf != nil {
 		ep.Gateways = []net.IP{nw.extIf.IPv4Gateway}
 	}
 
+	// each step from here on pushes its inverse, the steps made are all undone, the latest first, if a later one fails.
+	// The links, addresses and routes are pushed by the netlink transaction.
+	var rollback undo.Stack
+	nl = netlink.NewTransaction(nl, &rollback)
+
 	// testEpClient is non-nil only when the endpoint is created for the unit test
 	// resetting epClient to testEpClient in loop to use the test endpoint client if specified
 	epClient := testEpClient
@@ -163,36 +196,54 @@ func (nw *network) newEndpointImpl(
 					plc,
 					iptc)
 			}
-		} else if nw.Mode != opModeTransparent {
+		} else if nw.Mode != opModeTransparent && nw.Mode != opModeWireguard && nw.Mode != opModeVxlan {
 			logger.Info("Bridge client")
 			epClient = NewLinuxBridgeEndpointClient(nw.extIf, hostIfName, contIfName, nw.Mode, nl, plc)
-		} else if epInfo.NICType == cns.NodeNetworkInterfaceFrontendNIC {
+		} else if epInfo.NICType.IsFrontendNIC() {
 			logger.Info("Secondary client")
 			epClient = NewSecondaryEndpointClient(nl, netioCli, plc, nsc, dhcpclient, ep)
+		} else if nw.Mode == opModeWireguard {
+			logger.Info("Wireguard client")
+			epClient = NewWireguardEndpointClient(nw.extIf, hostIfName, contIfName, nw.Mode, epInfo.WireguardIfName, nl, netioCli, plc)
+		} else if ep.EnableIPVlanL3S {
+			logger.Info("Transparent ipvlan client")
+			// the endpoint has no device on the host
+			ep.HostIfName = ""
+			epClient = NewTransparentIPVlanEndpointClient(nw.extIf, contIfName, nl, netioCli, plc, nsc)
+		} else if ep.EnableMacvlan {
+			logger.Info("Transparent macvlan client")
+			// the endpoint has no device on the host
+			ep.HostIfName = ""
+			epClient = NewTransparentMacvlanEndpointClient(nw.extIf, contIfName, nl, netioCli, plc, nsc, dhcpclient)
+		} else if ep.EnableEBPFDatapath {
+			logger.Info("Transparent ebpf client")
+			epClient = NewTransparentEBPFEndpointClient(nw.extIf, hostIfName, contIfName, nw.Mode, nl, netioCli, plc, ebpfdatapath.New())
 		} else {
 			logger.Info("Transparent client")
 			epClient = NewTransparentEndpointClient(nw.extIf, hostIfName, contIfName, nw.Mode, nl, netioCli, plc)
 		}
 	}
 
-	//nolint:gocritic
-	defer func(client EndpointClient, contIfName string) {
-		// Cleanup on failure.
+	defer func() {
 		if err != nil {
-			logger.Error("CNI error. Delete Endpoint and rules that are created", zap.Error(err), zap.String("contIfName", contIfName))
-			if containerIf != nil {
-				client.DeleteEndpointRules(ep)
+			logger.Error("CNI error. Rolling back the endpoint", zap.Error(err), zap.String("contIfName", contIfName))
+			if rollbackErr := rollback.Rollback(); rollbackErr != nil {
+				logger.Error("Failed to roll back the endpoint", zap.Error(rollbackErr))
 			}
-			// set deleteHostVeth to true to cleanup host veth interface if created
-			//nolint:errcheck // ignore error
-			client.DeleteEndpoints(ep)
 		}
-	}(epClient, contIfName)
+	}()
 
 	// wrapping endpoint client commands in anonymous func so that namespace can be exit and closed before the next loop
 	//nolint:wrapcheck // ignore wrap check
-	err = func() error {
-		if epErr := epClient.AddEndpoints(epInfo); epErr != nil {
+	err = func() (nsErr error) {
+		if epErr := checkDeadline(ctx, "adding the endpoint interfaces"); epErr != nil {
+			return epErr
+		}
+		// the interfaces are deleted whatever the step they failed at, the ones moved to the netns are moved back
+		rollback.Push("delete the endpoint interfaces", func() error { return epClient.DeleteEndpoints(ep) })
+		if epErr := tracing.WithSpan(ctx, "endpoint.AddInterfaces", func(context.Context) error {
+			return epClient.AddEndpoints(epInfo)
+		}); epErr != nil {
 			return epErr
 		}
 
@@ -206,12 +257,22 @@ func (nw *network) newEndpointImpl(
 		}
 
 		// Setup rules for IP addresses on the container interface.
+		if epErr := checkDeadline(ctx, "adding the endpoint rules"); epErr != nil {
+			return epErr
+		}
+		rollback.Push("delete the endpoint rules", func() error {
+			epClient.DeleteEndpointRules(ep)
+			return nil
+		})
 		if epErr := epClient.AddEndpointRules(epInfo); epErr != nil {
 			return epErr
 		}
 
 		// If a network namespace for the container interface is specified...
 		if epInfo.NetNsPath != "" {
+			if epErr := checkDeadline(ctx, "moving the endpoint interfaces to the netns"); epErr != nil {
+				return epErr
+			}
 			// Open the network namespace.
 			logger.Info("Opening netns", zap.Any("NetNsPath", epInfo.NetNsPath))
 			ns, epErr := nsc.OpenNamespace(epInfo.NetNsPath)
@@ -220,18 +281,29 @@ func (nw *network) newEndpointImpl(
 			}
 			defer ns.Close()
 
-			if epErr := epClient.MoveEndpointsToContainerNS(epInfo, ns.GetFd()); epErr != nil {
+			if epErr := tracing.WithSpan(ctx, "netns.MoveInterfaces", func(context.Context) error {
+				return epClient.MoveEndpointsToContainerNS(epInfo, ns.GetFd())
+			}); epErr != nil {
 				return epErr
 			}
 
 			// Enter the container network namespace.
 			logger.Info("Entering netns", zap.Any("NetNsPath", epInfo.NetNsPath))
-			if epErr := ns.Enter(); epErr != nil {
+			if epErr := tracing.WithSpan(ctx, "netns.Enter", func(context.Context) error {
+				return ns.Enter()
+			}); epErr != nil {
 				return epErr
 			}
 
-			// Return to host network namespace.
+			// Return to host network namespace, after rolling back the changes made in the container network namespace
+			// on failure, which can't be rolled back from the host.
+			nsChanges := rollback.Len()
 			defer func() {
+				if nsErr != nil {
+					if rollbackErr := rollback.RollbackTo(nsChanges); rollbackErr != nil {
+						logger.Error("Failed to roll back the changes in netns", zap.Error(rollbackErr))
+					}
+				}
 				logger.Info("Exiting netns", zap.Any("NetNsPath", epInfo.NetNsPath))
 				if epErr := ns.Exit(); epErr != nil {
 					logger.Error("Failed to exit netns with", zap.Error(epErr))
@@ -248,56 +320,135 @@ func (nw *network) newEndpointImpl(
 			}
 		}
 
+		if epErr := checkDeadline(ctx, "setting up the container interfaces"); epErr != nil {
+			return epErr
+		}
+
 		// If a name for the container interface is specified...
 		if epInfo.IfName != "" {
-			if epErr := epClient.SetupContainerInterfaces(epInfo); epErr != nil {
+			if epErr := tracing.WithSpan(ctx, "container.SetupInterfaces", func(context.Context) error {
+				return epClient.SetupContainerInterfaces(epInfo)
+			}); epErr != nil {
 				return epErr
 			}
 		}
 
-		return epClient.ConfigureContainerInterfacesAndRoutes(epInfo)
+		if epErr := tracing.WithSpan(ctx, "container.ConfigureRoutes", func(context.Context) error {
+			return epClient.ConfigureContainerInterfacesAndRoutes(epInfo)
+		}); epErr != nil {
+			return epErr
+		}
+
+		if epInfo.SandboxDevice != "" {
+			if epErr := addSandboxDevice(nl, netioCli, plc, epInfo.IfName, epInfo.SandboxDevice); epErr != nil {
+				return epErr
+			}
+		}
+
+		return addTrunkVlanInterfaces(nl, netioCli, ep.IfName, ep.AllowedVlanIDs)
 	}()
 	if err != nil {
 		return nil, err
 	}
 
+	// the flows of the endpoint are read from the conntrack table by cns, with their counters once accounting is on
+	if ep.FlowLogs {
+		if err = networkutils.NewNetworkUtils(nl, plc).EnableConntrackAccounting(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = checkDeadline(ctx, "adding the iptables exceptions"); err != nil {
+		return nil, err
+	}
+
+	if err = tracing.WithSpan(ctx, "iptables.AddExceptions", func(context.Context) error {
+		return addEndpointExceptions(iptc, ep, &rollback)
+	}); err != nil {
+		return nil, err
+	}
+
+	// the metadata of the endpoint is kept on its host interface, for the state to be recovered from when it is lost.
+	// The host interface of the endpoints of transparent vlan networks is in the namespace of their vnet.
+	if ep.HostIfName != "" && !ep.NICType.IsFrontendNIC() && nw.Mode != opModeTransparentVlan {
+		addRecoveryAltNames(newAltNameClient(), nw, ep)
+	}
+
 	return ep, nil
 }
 
+// addEndpointExceptions adds the outbound nat and dns redirect exceptions and the dscp marks of the endpoint, pushing
+// the deletion of each on the rollback before adding it, so that none of them are left when it fails.
+func addEndpointExceptions(iptc ipTablesClient, ep *endpoint, rollback *undo.Stack) error {
+	rollback.Push("delete the outbound nat exceptions", func() error {
+		deleteOutboundNATExceptions(iptc, ep)
+		return nil
+	})
+	if err := addOutboundNATExceptions(iptc, ep); err != nil {
+		return err
+	}
+
+	rollback.Push("delete the dns redirect exceptions", func() error {
+		deleteDNSRedirectExceptions(iptc, ep)
+		return nil
+	})
+	if err := addDNSRedirectExceptions(iptc, ep); err != nil {
+		return err
+	}
+
+	rollback.Push("delete the dscp marks", func() error {
+		deleteDSCPMarks(iptc, ep)
+		return nil
+	})
+	return addDSCPMarks(iptc, ep)
+}
+
 // deleteEndpointImpl deletes an existing endpoint from the network.
-func (nw *network) deleteEndpointImpl(nl netlink.NetlinkInterface, plc platform.ExecClient, epClient EndpointClient, nioc netio.NetIOInterface, nsc NamespaceClientInterface,
+func (nw *network) deleteEndpointImpl(_ context.Context, nl netlink.NetlinkInterface, plc platform.ExecClient, epClient EndpointClient, nioc netio.NetIOInterface, nsc NamespaceClientInterface,
 	iptc ipTablesClient, dhcpc dhcpClient, ep *endpoint,
 ) error {
 	// Delete the veth pair by deleting one of the peer interfaces.
 	// Deleting the host interface is more convenient since it does not require
 	// entering the container netns and hence works both for CNI and CNM.
 
+	deleteOutboundNATExceptions(iptc, ep)
+	deleteDNSRedirectExceptions(iptc, ep)
+	deleteDSCPMarks(iptc, ep)
+
 	// epClient is nil only for unit test.
 	if epClient == nil {
 		//nolint:gocritic
 		if ep.VlanID != 0 {
-			epInfo := ep.getInfo()
+			epInfo := ep.getInfo(nil)
 			if nw.Mode == opModeTransparentVlan {
 				epClient = NewTransparentVlanEndpointClient(nw, epInfo, ep.HostIfName, "", ep.VlanID, ep.LocalIP, nl, plc, nsc, iptc)
 			} else {
 				epClient = NewOVSEndpointClient(nw, epInfo, ep.HostIfName, "", ep.VlanID, ep.LocalIP, nl, ovsctl.NewOvsctl(), plc, iptc)
 			}
-		} else if nw.Mode != opModeTransparent {
+		} else if nw.Mode != opModeTransparent && nw.Mode != opModeWireguard && nw.Mode != opModeVxlan {
 			epClient = NewLinuxBridgeEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode, nl, plc)
 		} else {
 			// delete if secondary interfaces populated or endpoint of type delegated (new way)
-			if len(ep.SecondaryInterfaces) > 0 || ep.NICType == cns.NodeNetworkInterfaceFrontendNIC {
+			if len(ep.SecondaryInterfaces) > 0 || ep.NICType.IsFrontendNIC() {
 				epClient = NewSecondaryEndpointClient(nl, nioc, plc, nsc, dhcpc, ep)
 				epClient.DeleteEndpointRules(ep)
 				//nolint:errcheck // ignore error
 				epClient.DeleteEndpoints(ep)
-				if ep.NICType == cns.NodeNetworkInterfaceFrontendNIC {
+				if ep.NICType.IsFrontendNIC() {
 					// if the ep itself is of type secondary (new way), don't use transparent client below
 					return nil
 				}
 			}
 
-			epClient = NewTransparentEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode, nl, nioc, plc)
+			if ep.EnableIPVlanL3S {
+				epClient = NewTransparentIPVlanEndpointClient(nw.extIf, "", nl, nioc, plc, nsc)
+			} else if ep.EnableMacvlan {
+				epClient = NewTransparentMacvlanEndpointClient(nw.extIf, "", nl, nioc, plc, nsc, dhcpc)
+			} else if ep.EnableEBPFDatapath {
+				epClient = NewTransparentEBPFEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode, nl, nioc, plc, ebpfdatapath.New())
+			} else {
+				epClient = NewTransparentEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode, nl, nioc, plc)
+			}
 		}
 	}
 
@@ -307,11 +458,177 @@ func (nw *network) deleteEndpointImpl(nl netlink.NetlinkInterface, plc platform.
 	//nolint:errcheck // ignore error
 	epClient.DeleteEndpoints(ep)
 
+	// flushed once the endpoint is gone, so that no flow of the pod creates new entries
+	flushConntrack(newConntrackClient(), ep)
+
 	return nil
 }
 
+// detachDelegatedNICImpl detaches the delegated nic ifName from the endpoint, which keeps its other interfaces.
+func (nw *network) detachDelegatedNICImpl(nl netlink.NetlinkInterface, plc platform.ExecClient, nioc netio.NetIOInterface,
+	nsc NamespaceClientInterface, dhcpc dhcpClient, ep *endpoint, ifName string,
+) error {
+	return NewSecondaryEndpointClient(nl, nioc, plc, nsc, dhcpc, ep).DetachInterface(ifName)
+}
+
+// newStatelessEndpoint builds the endpoint to delete from its record in CNS. Stateless cni only creates transparent
+// networks on linux, and the delegated nic of the endpoint is moved back to the host from the pod's namespace.
+func newStatelessEndpoint(networkID string, epInfo *EndpointInfo) (*network, *endpoint) {
+	nw := &network{
+		Id:    networkID,
+		Mode:  opModeTransparent,
+		extIf: &externalInterface{},
+	}
+
+	ep := &endpoint{
+		Id:                    epInfo.EndpointID,
+		IfName:                epInfo.IfName,
+		HostIfName:            epInfo.HostIfName,
+		MacAddress:            epInfo.MacAddress,
+		IPAddresses:           epInfo.IPAddresses,
+		NetworkNameSpace:      epInfo.NetNsPath,
+		ContainerID:           epInfo.ContainerID,
+		NICType:               epInfo.NICType,
+		OutboundNATExceptions: epInfo.OutboundNATExceptions,
+		EnableEBPFDatapath:    epInfo.EnableEBPFDatapath,
+		SecondaryInterfaces:   make(map[string]*InterfaceInfo),
+		RouteTable:            epInfo.RouteTable,
+	}
+	if ep.NICType.IsFrontendNIC() {
+		ep.SecondaryInterfaces[ep.IfName] = &InterfaceInfo{
+			Name:       ep.IfName,
+			MacAddress: ep.MacAddress,
+			NICType:    ep.NICType,
+			RouteTable: ep.RouteTable,
+		}
+	}
+
+	return nw, ep
+}
+
 // getInfoImpl returns information about the endpoint.
-func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
+func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo, stats netio.NetIOInterface) {
+	if stats == nil {
+		return
+	}
+
+	epInfo.OperState = ep.operState(stats)
+
+	// interfaces without a host veth, like the delegated nics, are moved into the pod and read from its netns
+	if ep.HostIfName == "" {
+		if ep.NetworkNameSpace == "" || ep.IfName == "" {
+			return
+		}
+		counters, err := stats.GetNetworkInterfaceStatsInNetNs(ep.NetworkNameSpace, ep.IfName)
+		if err != nil {
+			logger.Error("Failed to read endpoint traffic counters in the pod", zap.String("endpointID", ep.Id), zap.Error(err))
+			return
+		}
+		epInfo.Data[RxBytesKey] = counters.RxBytes
+		epInfo.Data[TxBytesKey] = counters.TxBytes
+		epInfo.Data[RxPacketsKey] = counters.RxPackets
+		epInfo.Data[TxPacketsKey] = counters.TxPackets
+		epInfo.Data[RxDroppedKey] = counters.RxDropped
+		epInfo.Data[TxDroppedKey] = counters.TxDropped
+		return
+	}
+
+	// the counters are read from the host side of the veth pair, so its rx is the pod's tx and vice versa
+	for key, stat := range map[string]string{
+		RxBytesKey:   "tx_bytes",
+		TxBytesKey:   "rx_bytes",
+		RxPacketsKey: "tx_packets",
+		TxPacketsKey: "rx_packets",
+		RxDroppedKey: "tx_dropped",
+		TxDroppedKey: "rx_dropped",
+	} {
+		value, err := readInterfaceStat(ep.HostIfName, stat)
+		if err != nil {
+			logger.Error("Failed to read endpoint traffic counter", zap.String("endpointID", ep.Id), zap.String("stat", stat), zap.Error(err))
+			continue
+		}
+		epInfo.Data[key] = value
+	}
+}
+
+// operState reads the state of the interface of the endpoint in the pod's netns, nil when the endpoint has none.
+func (ep *endpoint) operState(nioc netio.NetIOInterface) *EndpointOperState {
+	if ep.NetworkNameSpace == "" || ep.IfName == "" {
+		return nil
+	}
+
+	ifaces, err := nioc.GetNetworkInterfacesInNetNs(ep.NetworkNameSpace)
+	if err != nil {
+		return &EndpointOperState{Error: err.Error()}
+	}
+	i := slices.IndexFunc(ifaces, func(iface net.Interface) bool { return iface.Name == ep.IfName })
+	if i < 0 {
+		return &EndpointOperState{Error: fmt.Sprintf("interface %s not found in %s", ep.IfName, ep.NetworkNameSpace)}
+	}
+	state := &EndpointOperState{
+		Up:      ifaces[i].Flags&net.FlagUp != 0,
+		Carrier: ifaces[i].Flags&net.FlagRunning != 0,
+	}
+
+	addrs, err := nioc.GetNetworkInterfaceAddrsInNetNs(ep.NetworkNameSpace, ep.IfName)
+	if err != nil {
+		state.Error = err.Error()
+		return state
+	}
+	ifIPs := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ifIPs = append(ifIPs, ipNet.IP)
+		}
+	}
+	state.MissingIPs = missingIPs(ep.IPAddresses, ifIPs)
+	return state
+}
+
+// readInterfaceStat reads a counter of the interface from sysfs.
+func readInterfaceStat(ifName, stat string) (uint64, error) {
+	b, err := os.ReadFile(filepath.Join(sysClassNetPath, ifName, "statistics", stat))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read %s of %s", stat, ifName)
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return value, errors.Wrapf(err, "failed to parse %s of %s", stat, ifName)
+}
+
+// addTrunkVlanInterfaces adds a vlan sub-interface of the container interface for each vlan of its trunk, named like
+// eth0.100. The sub-interfaces are removed by the kernel along with the container interface.
+func addTrunkVlanInterfaces(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, ifName string, vlanIDs []int) error {
+	if len(vlanIDs) == 0 {
+		return nil
+	}
+
+	trunkIf, err := netioshim.GetNetworkInterfaceByName(ifName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get trunk interface %s", ifName)
+	}
+
+	for _, vlanID := range vlanIDs {
+		vlanIfName := fmt.Sprintf("%s.%d", ifName, vlanID)
+		logger.Info("Adding trunk vlan interface", zap.String("vlanIfName", vlanIfName), zap.Int("vlanID", vlanID))
+
+		link := &netlink.VlanLink{
+			LinkInfo: netlink.LinkInfo{
+				Type:        netlink.LINK_TYPE_VLAN,
+				Name:        vlanIfName,
+				ParentIndex: trunkIf.Index,
+			},
+			VlanID: vlanID,
+		}
+		if err := nl.AddLink(link); err != nil {
+			return errors.Wrapf(err, "failed to add vlan interface %s", vlanIfName)
+		}
+
+		if err := nl.SetLinkState(vlanIfName, true); err != nil {
+			return errors.Wrapf(err, "failed to set vlan interface %s up", vlanIfName)
+		}
+	}
+
+	return nil
 }
 
 func addRoutes(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, interfaceName string, routes []RouteInfo) error {
@@ -344,6 +661,11 @@ func addRoutes(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, inte
 			Protocol:  route.Protocol,
 			Scope:     route.Scope,
 			Table:     route.Table,
+			MTU:       route.MTU,
+			AdvMSS:    route.AdvMSS,
+		}
+		if route.OnLink {
+			nlRoute.Flags |= netlink.RTNH_F_ONLINK
 		}
 
 		logger.Info("Adding IP route to link", zap.Any("route", route), zap.String("interfaceName", interfaceName))
@@ -359,6 +681,12 @@ func addRoutes(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, inte
 	return nil
 }
 
+// hasKernelSubnetRoute returns if the kernel adds a subnet route for the address, which it doesn't for ipv4 /32 addresses.
+func hasKernelSubnetRoute(ipNet *net.IPNet) bool {
+	ones, bits := ipNet.Mask.Size()
+	return ipNet.IP.To4() == nil || ones != bits
+}
+
 func deleteRoutes(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, interfaceName string, routes []RouteInfo) error {
 	ifIndex := 0
 
@@ -476,19 +804,21 @@ func (nm *networkManager) updateRoutes(existingEp *EndpointInfo, targetEp *Endpo
 	// collect routes and skip default and infravnet routes if applicable
 	logger.Info("Key for default route", zap.String("route", defaultDst.String()))
 
-	infraVnetKey := ""
-	if targetEp.EnableInfraVnet {
-		infraVnetSubnet := targetEp.InfraVnetAddressSpace
-		if infraVnetSubnet != "" {
-			infraVnetKey = strings.Split(infraVnetSubnet, "/")[0]
+	// the infra vnet address space has a subnet per ip family
+	infraVnetKeys := map[string]bool{}
+	if targetEp.EnableInfraVnet && targetEp.InfraVnetAddressSpace != "" {
+		for _, infraVnetSubnet := range strings.Split(targetEp.InfraVnetAddressSpace, ",") {
+			if _, ipNet, err := net.ParseCIDR(strings.TrimSpace(infraVnetSubnet)); err == nil {
+				infraVnetKeys[ipNet.IP.String()] = true
+			}
 		}
 	}
 
-	logger.Info("Key for route to infra vnet", zap.String("infraVnetKey", infraVnetKey))
+	logger.Info("Keys for routes to infra vnet", zap.Any("infraVnetKeys", infraVnetKeys))
 	for _, route := range existingEp.Routes {
 		destination := route.Dst.IP.String()
 		isDefaultRoute := destination == defaultDst.String()
-		isInfraVnetRoute := targetEp.EnableInfraVnet && (destination == infraVnetKey)
+		isInfraVnetRoute := targetEp.EnableInfraVnet && infraVnetKeys[destination]
 		if !isDefaultRoute && !isInfraVnetRoute {
 			existingRoutes[route.Dst.String()] = route
 			logger.Info("was skipped", zap.String("destination", destination))
@@ -1,11 +1,18 @@
 package network
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
@@ -134,4 +141,331 @@ var _ = Describe("Test TestEndpointLinux", func() {
 			Expect(err).ToNot(BeNil())
 		})
 	})
+	Describe("Test outbound nat exceptions", func() {
+		ep := &endpoint{
+			Id: "ep1",
+			IPAddresses: []net.IPNet{
+				{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)},
+				{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(64, 128)},
+			},
+			OutboundNATExceptions: []string{"20.0.0.0/8", "fc00::/7"},
+		}
+
+		It("Should insert an accept rule per matching ip family", func() {
+			iptc := &mockIPTablesClient{}
+			err := addOutboundNATExceptions(iptc, ep)
+			Expect(err).To(BeNil())
+			Expect(iptc.rules).To(ConsistOf(
+				"4 nat POSTROUTING -s 10.0.0.4 -d 20.0.0.0/8 -j ACCEPT",
+				"6 nat POSTROUTING -s fd00::4 -d fc00::/7 -j ACCEPT",
+			))
+
+			deleteOutboundNATExceptions(iptc, ep)
+			Expect(iptc.rules).To(BeEmpty())
+		})
+
+		It("Should fail on an invalid cidr", func() {
+			iptc := &mockIPTablesClient{}
+			err := addOutboundNATExceptions(iptc, &endpoint{
+				IPAddresses:           ep.IPAddresses,
+				OutboundNATExceptions: []string{"not-a-cidr"},
+			})
+			Expect(err).ToNot(BeNil())
+			Expect(iptc.rules).To(BeEmpty())
+		})
+	})
+	Describe("Test dns redirect exceptions", func() {
+		It("Should insert a return rule per protocol", func() {
+			iptc := &mockIPTablesClient{}
+			ep := &endpoint{Id: "ep1", LocalIP: "169.254.128.10/17", SkipDNSRedirect: true}
+			err := addDNSRedirectExceptions(iptc, ep)
+			Expect(err).To(BeNil())
+			Expect(iptc.rules).To(ConsistOf(
+				"4 nat PREROUTING -i azSnatbr -s 169.254.128.10 -d 168.63.129.16 -p udp --dport 53 -j RETURN",
+				"4 nat PREROUTING -i azSnatbr -s 169.254.128.10 -d 168.63.129.16 -p tcp --dport 53 -j RETURN",
+			))
+
+			deleteDNSRedirectExceptions(iptc, ep)
+			Expect(iptc.rules).To(BeEmpty())
+		})
+
+		It("Should not add rules if the endpoint does not skip dns redirection", func() {
+			iptc := &mockIPTablesClient{}
+			err := addDNSRedirectExceptions(iptc, &endpoint{LocalIP: "169.254.128.10/17"})
+			Expect(err).To(BeNil())
+			Expect(iptc.rules).To(BeEmpty())
+		})
+	})
+	Describe("Test dscp marks", func() {
+		It("Should append a mark rule per ip", func() {
+			iptc := &mockIPTablesClient{}
+			ep := &endpoint{
+				Id: "ep1",
+				IPAddresses: []net.IPNet{
+					{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)},
+					{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(64, 128)},
+				},
+				DSCP: 46,
+			}
+			err := addDSCPMarks(iptc, ep)
+			Expect(err).To(BeNil())
+			Expect(iptc.rules).To(ConsistOf(
+				"4 mangle PREROUTING -s 10.0.0.4 -j DSCP --set-dscp 46",
+				"6 mangle PREROUTING -s fd00::4 -j DSCP --set-dscp 46",
+			))
+
+			deleteDSCPMarks(iptc, ep)
+			Expect(iptc.rules).To(BeEmpty())
+		})
+
+		It("Should not add rules if the endpoint's traffic is not marked", func() {
+			iptc := &mockIPTablesClient{}
+			err := addDSCPMarks(iptc, &endpoint{IPAddresses: []net.IPNet{{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)}}})
+			Expect(err).To(BeNil())
+			Expect(iptc.rules).To(BeEmpty())
+		})
+	})
+	Describe("Test trunk vlan interfaces", func() {
+		It("Should add a vlan interface of the container interface per vlan", func() {
+			nl := &recordingNetlink{MockNetlink: netlink.NewMockNetlink(false, "")}
+			err := addTrunkVlanInterfaces(nl, netio.NewMockNetIO(false, 0), "eth1", []int{100, 200})
+			Expect(err).To(BeNil())
+			Expect(nl.links).To(HaveLen(2))
+			vlan, ok := nl.links[0].(*netlink.VlanLink)
+			Expect(ok).To(BeTrue())
+			Expect(vlan.Name).To(Equal("eth1.100"))
+			Expect(vlan.Type).To(Equal(netlink.LINK_TYPE_VLAN))
+			Expect(vlan.VlanID).To(Equal(100))
+			Expect(nl.links[1].Info().Name).To(Equal("eth1.200"))
+		})
+
+		It("Should not look up the container interface without vlans", func() {
+			err := addTrunkVlanInterfaces(netlink.NewMockNetlink(true, ""), netio.NewMockNetIO(true, 1), "eth1", nil)
+			Expect(err).To(BeNil())
+		})
+
+		It("Should fail if the vlan interface cannot be added", func() {
+			err := addTrunkVlanInterfaces(netlink.NewMockNetlink(true, ""), netio.NewMockNetIO(false, 0), "eth1", []int{100})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+	Describe("Test sandbox devices", func() {
+		It("Should add an ipvtap device on the container interface", func() {
+			nl := &recordingNetlink{MockNetlink: netlink.NewMockNetlink(false, "")}
+			err := addSandboxDevice(nl, netio.NewMockNetIO(false, 0), platform.NewMockExecClient(false), "eth0", SandboxDeviceIPVTap)
+			Expect(err).To(BeNil())
+			Expect(nl.links).To(HaveLen(1))
+			ipvtap, ok := nl.links[0].(*netlink.IPVlanLink)
+			Expect(ok).To(BeTrue())
+			Expect(ipvtap.Name).To(Equal("tap_eth0"))
+			Expect(ipvtap.Type).To(Equal(netlink.LINK_TYPE_IPVTAP))
+			Expect(ipvtap.Mode).To(Equal(netlink.IPVLAN_MODE_L2))
+		})
+
+		It("Should redirect the traffic between the container interface and the tap device", func() {
+			plc := platform.NewMockExecClient(false)
+			var filters []string
+			plc.SetExecCommand(func(cmd string, args ...string) (string, error) {
+				if cmd == "tc" && args[0] == "filter" {
+					filters = append(filters, fmt.Sprintf("%s>%s", args[3], args[len(args)-1]))
+				}
+				return "", nil
+			})
+			err := addSandboxDevice(netlink.NewMockNetlink(false, ""), netio.NewMockNetIO(false, 0), plc, "eth0", SandboxDeviceTap)
+			Expect(err).To(BeNil())
+			Expect(filters).To(Equal([]string{"eth0>tap_eth0", "tap_eth0>eth0"}))
+		})
+
+		It("Should fail on an unknown device", func() {
+			err := addSandboxDevice(netlink.NewMockNetlink(false, ""), netio.NewMockNetIO(false, 0), platform.NewMockExecClient(false), "eth0", "macvtap")
+			Expect(errors.Is(err, errUnknownSandboxDevice)).To(BeTrue())
+		})
+
+		It("Should keep the device name within the kernel limit", func() {
+			Expect(SandboxDeviceName("eth0")).To(Equal("tap_eth0"))
+			Expect(len(SandboxDeviceName("averylongifname"))).To(Equal(maxIfNameLen))
+		})
+	})
+	Describe("Test stateless endpoint deletion", func() {
+		ipAddresses := []net.IPNet{{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)}}
+
+		It("Should delete the endpoint rules from the cns record", func() {
+			iptc := &mockIPTablesClient{}
+			nm := &networkManager{
+				netlink:        netlink.NewMockNetlink(false, ""),
+				plClient:       platform.NewMockExecClient(false),
+				netio:          netio.NewMockNetIO(false, 0),
+				nsClient:       NewMockNamespaceClient(),
+				iptablesClient: iptc,
+			}
+			epInfo := &EndpointInfo{
+				EndpointID:            "12345678",
+				ContainerID:           "12345678",
+				IfName:                "eth0",
+				HostIfName:            "azv1234567",
+				IPAddresses:           ipAddresses,
+				NICType:               cns.InfraNIC,
+				OutboundNATExceptions: []string{"20.0.0.0/8"},
+			}
+			Expect(addOutboundNATExceptions(iptc, &endpoint{IPAddresses: ipAddresses, OutboundNATExceptions: epInfo.OutboundNATExceptions})).To(Succeed())
+
+			Expect(nm.DeleteEndpointState(context.Background(), "", epInfo)).To(Succeed())
+			Expect(iptc.rules).To(BeEmpty())
+		})
+
+		It("Should move the delegated nic back to the host", func() {
+			mac, _ := net.ParseMAC("12:34:56:78:9a:bc")
+			nw, ep := newStatelessEndpoint("", &EndpointInfo{
+				IfName:     "eth1",
+				MacAddress: mac,
+				NetNsPath:  "/var/run/netns/pod",
+				NICType:    cns.NodeNetworkInterfaceFrontendNIC,
+			})
+			Expect(nw.Mode).To(Equal(opModeTransparent))
+			Expect(ep.NetworkNameSpace).To(Equal("/var/run/netns/pod"))
+			Expect(ep.SecondaryInterfaces).To(HaveKeyWithValue("eth1", &InterfaceInfo{
+				Name:       "eth1",
+				MacAddress: mac,
+				NICType:    cns.NodeNetworkInterfaceFrontendNIC,
+			}))
+		})
+
+		It("Should only create transparent networks", func() {
+			nm := &networkManager{statelessCniMode: true}
+			_, err := nm.newNetworkImpl(&EndpointInfo{Mode: opModeBridge}, &externalInterface{Name: "eth0"})
+			Expect(errors.Is(err, errStatelessModeInvalid)).To(BeTrue())
+		})
+	})
+	Describe("Test endpoint traffic counters", func() {
+		It("Should add the host veth counters from the pod's point of view", func() {
+			dir, err := os.MkdirTemp("", "sysclassnet")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			defaultPath := sysClassNetPath
+			sysClassNetPath = dir
+			defer func() { sysClassNetPath = defaultPath }()
+
+			statsDir := filepath.Join(sysClassNetPath, "azv1", "statistics")
+			Expect(os.MkdirAll(statsDir, 0o755)).To(Succeed())
+			for stat, value := range map[string]string{
+				"rx_bytes": "100", "tx_bytes": "200",
+				"rx_packets": "3", "tx_packets": "4",
+				"rx_dropped": "0", "tx_dropped": "1",
+			} {
+				Expect(os.WriteFile(filepath.Join(statsDir, stat), []byte(value+"\n"), 0o600)).To(Succeed())
+			}
+
+			ep := &endpoint{Id: "ep1", HostIfName: "azv1"}
+			Expect(ep.getInfo(nil).Data).ToNot(HaveKey(RxBytesKey))
+
+			data := ep.getInfo(netio.NewMockNetIO(false, 0)).Data
+			Expect(data).To(HaveKeyWithValue(RxBytesKey, uint64(200)))
+			Expect(data).To(HaveKeyWithValue(TxBytesKey, uint64(100)))
+			Expect(data).To(HaveKeyWithValue(RxPacketsKey, uint64(4)))
+			Expect(data).To(HaveKeyWithValue(TxPacketsKey, uint64(3)))
+			Expect(data).To(HaveKeyWithValue(RxDroppedKey, uint64(1)))
+			Expect(data).To(HaveKeyWithValue(TxDroppedKey, uint64(0)))
+		})
+
+		It("Should add the counters of an interface without host veth from the pod's netns", func() {
+			netioCli := netio.NewMockNetIO(false, 0)
+			netioCli.SetNetNsInterfaces("/var/run/netns/pod1", []netio.MockNetNsInterface{{
+				Interface: net.Interface{Name: "eth1"},
+				Stats:     netio.InterfaceStats{RxBytes: 100, TxBytes: 200, RxPackets: 3, TxPackets: 4, TxDropped: 1},
+			}})
+
+			ep := &endpoint{Id: "ep1", IfName: "eth1", NetworkNameSpace: "/var/run/netns/pod1"}
+			data := ep.getInfo(netioCli).Data
+			Expect(data).To(HaveKeyWithValue(RxBytesKey, uint64(100)))
+			Expect(data).To(HaveKeyWithValue(TxBytesKey, uint64(200)))
+			Expect(data).To(HaveKeyWithValue(RxPacketsKey, uint64(3)))
+			Expect(data).To(HaveKeyWithValue(TxPacketsKey, uint64(4)))
+			Expect(data).To(HaveKeyWithValue(RxDroppedKey, uint64(0)))
+			Expect(data).To(HaveKeyWithValue(TxDroppedKey, uint64(1)))
+
+			// the counters are left out when the interface is gone from the pod
+			ep.IfName = "eth2"
+			Expect(ep.getInfo(netioCli).Data).ToNot(HaveKey(RxBytesKey))
+		})
+	})
+	Describe("Test endpoint operational state", func() {
+		netioCli := netio.NewMockNetIO(false, 0)
+		netioCli.SetNetNsInterfaces("/var/run/netns/pod1", []netio.MockNetNsInterface{{
+			Interface: net.Interface{Name: "eth0", Flags: net.FlagUp},
+			Addrs:     []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)}},
+		}})
+		ep := &endpoint{
+			Id:               "ep1",
+			IfName:           "eth0",
+			HostIfName:       "azv1",
+			NetworkNameSpace: "/var/run/netns/pod1",
+			IPAddresses: []net.IPNet{
+				{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)},
+				{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(64, 128)},
+			},
+		}
+
+		It("Should only be read with the traffic counters", func() {
+			Expect(ep.getInfo(nil).OperState).To(BeNil())
+		})
+
+		It("Should report the link state and the ips missing from the interface in the pod", func() {
+			Expect(ep.operState(netioCli)).To(Equal(&EndpointOperState{Up: true, MissingIPs: []string{"fd00::4"}}))
+		})
+
+		It("Should report the interface gone from the pod", func() {
+			gone := *ep
+			gone.IfName = "eth1"
+			state := gone.operState(netioCli)
+			Expect(state.Up).To(BeFalse())
+			Expect(state.Error).To(ContainSubstring("interface eth1 not found"))
+		})
+	})
 })
+
+type mockIPTablesClient struct {
+	rules []string
+}
+
+func (m *mockIPTablesClient) InsertIptableRule(version, tableName, chainName, match, target string) error {
+	m.rules = append(m.rules, fmt.Sprintf("%s %s %s %s -j %s", version, tableName, chainName, match, target))
+	return nil
+}
+
+func (m *mockIPTablesClient) AppendIptableRule(version, tableName, chainName, match, target string) error {
+	return m.InsertIptableRule(version, tableName, chainName, match, target)
+}
+
+func (m *mockIPTablesClient) DeleteIptableRule(version, tableName, chainName, match, target string) error {
+	rule := fmt.Sprintf("%s %s %s %s -j %s", version, tableName, chainName, match, target)
+	for i := range m.rules {
+		if m.rules[i] == rule {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("rule not found")
+}
+
+func (m *mockIPTablesClient) CreateChain(_, _, _ string) error {
+	return nil
+}
+
+func (m *mockIPTablesClient) RunCmd(_, _ string) error {
+	return nil
+}
+
+func (m *mockIPTablesClient) Commit(_ *iptables.Transaction) error {
+	return nil
+}
+
+type recordingNetlink struct {
+	*netlink.MockNetlink
+	links []netlink.Link
+}
+
+func (r *recordingNetlink) AddLink(link netlink.Link) error {
+	r.links = append(r.links, link)
+	return r.MockNetlink.AddLink(link)
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// getOutboundNATExceptionMatches returns the nat POSTROUTING match conditions that exempt traffic from the
+// endpoint's ips to its outbound nat exception cidrs from snat, keyed by iptables version.
+func getOutboundNATExceptionMatches(ep *endpoint) (map[string][]string, error) {
+	matches := make(map[string][]string)
+	for _, cidr := range ep.OutboundNATExceptions {
+		_, dst, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid outbound nat exception %s", cidr)
+		}
+
+		for _, ipAddr := range ep.IPAddresses {
+			// only pair source and destination of the same ip family
+			if (ipAddr.IP.To4() == nil) != (dst.IP.To4() == nil) {
+				continue
+			}
+
+			version := iptables.V4
+			if ipAddr.IP.To4() == nil {
+				version = iptables.V6
+			}
+
+			match := fmt.Sprintf("-s %s -d %s", ipAddr.IP.String(), dst.String())
+			matches[version] = append(matches[version], match)
+		}
+	}
+
+	return matches, nil
+}
+
+// addOutboundNATExceptions inserts ACCEPT rules at the top of nat POSTROUTING so that they are evaluated before
+// any MASQUERADE/SNAT rule for the endpoint.
+func addOutboundNATExceptions(iptc ipTablesClient, ep *endpoint) error {
+	matches, err := getOutboundNATExceptionMatches(ep)
+	if err != nil {
+		return err
+	}
+
+	for version, versionMatches := range matches {
+		for _, match := range versionMatches {
+			logger.Info("Adding outbound nat exception", zap.String("endpointID", ep.Id), zap.String("match", match))
+			if err := iptc.InsertIptableRule(version, iptables.Nat, iptables.Postrouting, match, iptables.Accept); err != nil {
+				return errors.Wrapf(err, "failed to add outbound nat exception %s", match)
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteOutboundNATExceptions removes the rules added by addOutboundNATExceptions. Errors are logged and ignored.
+func deleteOutboundNATExceptions(iptc ipTablesClient, ep *endpoint) {
+	matches, err := getOutboundNATExceptionMatches(ep)
+	if err != nil {
+		logger.Error("Failed to get outbound nat exceptions", zap.String("endpointID", ep.Id), zap.Error(err))
+		return
+	}
+
+	for version, versionMatches := range matches {
+		for _, match := range versionMatches {
+			logger.Info("Deleting outbound nat exception", zap.String("endpointID", ep.Id), zap.String("match", match))
+			if err := iptc.DeleteIptableRule(version, iptables.Nat, iptables.Postrouting, match, iptables.Accept); err != nil {
+				logger.Error("Failed to delete outbound nat exception", zap.String("match", match), zap.Error(err))
+			}
+		}
+	}
+}
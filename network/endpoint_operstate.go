@@ -0,0 +1,36 @@
+package network
+
+import (
+	"net"
+)
+
+// EndpointOperState is the state of the dataplane of an endpoint, read from the host rather than the store, to tell an
+// endpoint which is in the state from one which works. It is only read along with the traffic counters.
+type EndpointOperState struct {
+	// Up is whether the interface of the endpoint is up, on windows whether the hcn endpoint is attached to a namespace
+	Up bool
+	// Carrier is whether the interface has a carrier, for a veth whether its host peer is up too, linux only
+	Carrier bool `json:",omitempty"`
+	// MissingIPs are the ips of the endpoint which are not on its interface
+	MissingIPs []string `json:",omitempty"`
+	// Error is why the state could not be read, the fields after it was are unset
+	Error string `json:",omitempty"`
+}
+
+// missingIPs returns the ips of the endpoint which are not in the ips of its interface.
+func missingIPs(ipAddresses []net.IPNet, ifIPs []net.IP) []string {
+	var missing []string
+	for _, ipAddr := range ipAddresses {
+		found := false
+		for _, ip := range ifIPs {
+			if ip.Equal(ipAddr.IP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ipAddr.IP.String())
+		}
+	}
+	return missing
+}
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"go.uber.org/zap"
+)
+
+// maxParallelEndpoints is the most endpoints of the secondary interfaces of a pod programmed at once. Their VF moves
+// and DHCP discovers are slow enough to push the ADD of a pod with several of them over the runtime's timeout when
+// they are programmed one after the other.
+const maxParallelEndpoints = 4
+
+// isSecondaryEndpoint returns whether the endpoint is of a nic of its own, delegated to the pod or infiniband, which is
+// programmed without changing its network.
+func isSecondaryEndpoint(epInfo *EndpointInfo) bool {
+	return epInfo.NICType.IsFrontendNIC() || epInfo.NICType == cns.BackendNIC
+}
+
+// createSecondaryEndpoints creates the endpoints of the secondary interfaces of a pod concurrently, at most
+// maxParallelEndpoints at once, and adds the ones created to their network. The errors of all of the endpoints which
+// failed are returned, the ones created are returned either way so that they are deleted with the pod.
+func (nm *networkManager) createSecondaryEndpoints(ctx context.Context, cli apipaClient, epInfos []*EndpointInfo) ([]*endpoint, error) {
+	nws := make([]*network, len(epInfos))
+	nm.Lock()
+	for i, epInfo := range epInfos {
+		nw, err := nm.getNetwork(epInfo.NetworkID)
+		if err != nil {
+			nm.Unlock()
+			return nil, err
+		}
+		if nw.VlanId != 0 && epInfo.Data[VlanIDKey] == nil {
+			logger.Info("overriding endpoint vlanid with network vlanid")
+			epInfo.Data[VlanIDKey] = nw.VlanId
+		}
+		nws[i] = nw
+	}
+	nm.Unlock()
+
+	// the endpoints are only programmed concurrently, the networks are not changed until all of them are done
+	start := time.Now()
+	eps := make([]*endpoint, len(epInfos))
+	errs := make([]error, len(epInfos))
+	sem := make(chan struct{}, maxParallelEndpoints)
+	var wg sync.WaitGroup
+	for i := range epInfos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			eps[i], errs[i] = nws[i].programEndpoint(ctx, cli, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient,
+				nm.dhcpClient, epInfos[i])
+		}(i)
+	}
+	wg.Wait()
+	logger.Info("Programmed secondary endpoints", zap.Int("endpoints", len(epInfos)), zap.Duration("duration", time.Since(start)))
+
+	nm.Lock()
+	defer nm.Unlock()
+	created := make([]*endpoint, 0, len(eps))
+	for i, ep := range eps {
+		if ep == nil {
+			continue
+		}
+		// new endpoints are always programmed with the target datapath
+		ep.DatapathGeneration = nm.datapathGeneration
+		nws[i].recordEndpoint(ep, epInfos[i], start)
+		created = append(created, ep)
+	}
+	return created, errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSecondaryEndpoints(t *testing.T) {
+	_, defaultRoute, _ := net.ParseCIDR("0.0.0.0/0")
+	newSecondaryEpInfo := func(id string, mac net.HardwareAddr) *EndpointInfo {
+		return &EndpointInfo{
+			EndpointID:  id,
+			NetworkID:   "azure",
+			ContainerID: "768e8deb",
+			Data:        make(map[string]interface{}),
+			NICType:     cns.NodeNetworkInterfaceFrontendNIC,
+			MacAddress:  mac,
+			Routes:      []RouteInfo{{Dst: *defaultRoute}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		epInfos  []*EndpointInfo
+		created  []string
+		wantErrs int
+	}{
+		{
+			name: "all created",
+			epInfos: []*EndpointInfo{
+				newSecondaryEpInfo("768e8deb-eth1", netio.HwAddr),
+				newSecondaryEpInfo("768e8deb-eth2", netio.HwAddr),
+			},
+			created: []string{"768e8deb-eth1", "768e8deb-eth2"},
+		},
+		{
+			name: "the errors of all the failed endpoints are returned",
+			epInfos: []*EndpointInfo{
+				newSecondaryEpInfo("768e8deb-eth1", netio.BadHwAddr),
+				newSecondaryEpInfo("768e8deb-eth2", netio.HwAddr),
+				newSecondaryEpInfo("768e8deb-eth3", netio.BadHwAddr),
+			},
+			created:  []string{"768e8deb-eth2"},
+			wantErrs: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nw := &network{
+				Id:        "azure",
+				Mode:      opModeTransparent,
+				Endpoints: map[string]*endpoint{},
+				extIf:     &externalInterface{Name: "eth0"},
+			}
+			nm := &networkManager{
+				ExternalInterfaces: map[string]*externalInterface{"eth0": nw.extIf},
+				netlink:            netlink.NewMockNetlink(false, ""),
+				plClient:           platform.NewMockExecClient(false),
+				netio:              netio.NewMockNetIO(false, 0),
+				nsClient:           NewMockNamespaceClient(),
+				dhcpClient:         &mockDHCP{},
+				datapathGeneration: 2,
+			}
+			nw.extIf.Networks = map[string]*network{nw.Id: nw}
+
+			eps, err := nm.createSecondaryEndpoints(context.Background(), nil, tt.epInfos)
+			if tt.wantErrs > 0 {
+				require.Error(t, err)
+				assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), tt.wantErrs)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var created []string
+			for _, ep := range eps {
+				created = append(created, ep.Id)
+				assert.Equal(t, ep, nw.Endpoints[ep.Id])
+				assert.Equal(t, 2, ep.DatapathGeneration)
+			}
+			assert.ElementsMatch(t, tt.created, created)
+			assert.Len(t, nw.Endpoints, len(tt.created))
+		})
+	}
+}
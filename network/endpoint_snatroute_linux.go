@@ -3,6 +3,7 @@ package network
 import (
 	"fmt"
 
+	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network/snat"
 	"github.com/Azure/azure-container-networking/platform"
@@ -18,6 +19,15 @@ func GetSnatContIfName(epInfo *EndpointInfo) string {
 	return fmt.Sprintf("%s%s-2", snatVethInterfacePrefix, epInfo.EndpointID[:7])
 }
 
+// snatPortRules converts the host NC port rules of the NC to the port rules of its snat client.
+func snatPortRules(rules []cns.HostNCPortRule) []snat.PortRule {
+	portRules := make([]snat.PortRule, 0, len(rules))
+	for _, rule := range rules {
+		portRules = append(portRules, snat.PortRule{Protocols: rule.Protocols, Ports: rule.Ports})
+	}
+	return portRules
+}
+
 func AddSnatEndpoint(snatClient *snat.Client) error {
 	if err := snatClient.CreateSnatEndpoint(); err != nil {
 		return errors.Wrap(err, "failed to add snat endpoint")
@@ -26,29 +36,9 @@ func AddSnatEndpoint(snatClient *snat.Client) error {
 }
 
 func AddSnatEndpointRules(snatClient *snat.Client, hostToNC, ncToHost bool, nl netlink.NetlinkInterface, plc platform.ExecClient) error {
-	// Allow specific Private IPs via Snat Bridge
-	if err := snatClient.AllowIPAddressesOnSnatBridge(); err != nil {
-		return errors.Wrap(err, "failed to allow ip addresses on snat bridge")
-	}
-
-	// Block Private IPs via Snat Bridge
-	if err := snatClient.BlockIPAddressesOnSnatBridge(); err != nil {
-		return errors.Wrap(err, "failed to block ip addresses on snat bridge")
-	}
-	if err := snatClient.EnableIPForwarding(); err != nil {
-		return errors.Wrap(err, "failed to enable ip forwarding")
-	}
-
-	if hostToNC {
-		if err := snatClient.AllowInboundFromHostToNC(); err != nil {
-			return errors.Wrap(err, "failed to allow inbound from host to nc")
-		}
-	}
-
-	if ncToHost {
-		if err := snatClient.AllowInboundFromNCToHost(); err != nil {
-			return errors.Wrap(err, "failed to allow inbound from nc to host")
-		}
+	// Allow specific Private IPs and block the others via Snat Bridge, and allow inbound from host to nc and nc to host
+	if err := snatClient.AddSnatEndpointRules(hostToNC, ncToHost); err != nil {
+		return errors.Wrap(err, "failed to add snat endpoint rules")
 	}
 	return nil
 }
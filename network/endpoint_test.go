@@ -4,7 +4,9 @@
 package network
 
 import (
+	"context"
 	"net"
+	"regexp"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/cns"
@@ -93,7 +95,7 @@ var _ = Describe("Test Endpoint", func() {
 					PODName:      podName,
 					PODNameSpace: podNS,
 				}
-				ep, err := nw.getEndpointByPOD(podName, podNS, true)
+				ep, err := nw.getEndpointByPOD(PodMatcher{Mode: PodMatchExact, Name: podName, Namespace: podNS})
 				Expect(err).To(Equal(errMultipleEndpointsFound))
 				Expect(ep).To(BeNil())
 			})
@@ -104,7 +106,7 @@ var _ = Describe("Test Endpoint", func() {
 				nw := &network{
 					Endpoints: map[string]*endpoint{},
 				}
-				ep, err := nw.getEndpointByPOD("invalid", "", false)
+				ep, err := nw.getEndpointByPOD(PodMatcher{Name: "invalid"})
 				Expect(err).To(Equal(errEndpointNotFound))
 				Expect(ep).To(BeNil())
 			})
@@ -121,33 +123,69 @@ var _ = Describe("Test Endpoint", func() {
 					PODName:      podName,
 					PODNameSpace: podNS,
 				}
-				ep, err := nw.getEndpointByPOD(podName, podNS, true)
+				ep, err := nw.getEndpointByPOD(PodMatcher{Mode: PodMatchExact, Name: podName, Namespace: podNS})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ep.PODName).To(Equal(podName))
 			})
 		})
 	})
 
-	Describe("Test podNameMatches", func() {
-		Context("When doExactMatch flag is set", func() {
+	Describe("Test PodMatcher", func() {
+		Context("When matching exactly", func() {
 			It("Should exact match", func() {
-				actual := "nginx"
-				valid := "nginx"
-				invalid := "nginx-deployment-5c689d88bb"
-				Expect(podNameMatches(valid, actual, true)).To(BeTrue())
-				Expect(podNameMatches(invalid, actual, true)).To(BeFalse())
+				match := PodMatcher{Mode: PodMatchExact, Name: "nginx", Namespace: "ns"}
+				Expect(match.matches(&endpoint{PODName: "nginx", PODNameSpace: "ns"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "nginx", PODNameSpace: "other"})).To(BeFalse())
+				Expect(match.matches(&endpoint{PODName: "nginx-deployment-5c689d88bb", PODNameSpace: "ns"})).To(BeFalse())
 			})
 		})
 
-		Context("When doExactMatch flag is not set", func() {
-			It("Should not exact match", func() {
-				actual := "nginx"
-				valid1 := "nginx"
-				valid2 := "nginx-deployment-5c689d88bb"
-				invalid := "nginx-deployment-5c689d88bb-qwq47"
-				Expect(podNameMatches(valid1, actual, false)).To(BeTrue())
-				Expect(podNameMatches(valid2, actual, false)).To(BeTrue())
-				Expect(podNameMatches(invalid, actual, false)).To(BeFalse())
+		Context("When matching without suffix", func() {
+			It("Should strip the last two parts of the pod name", func() {
+				match := PodMatcher{Name: "nginx", Namespace: "ns"}
+				Expect(match.matches(&endpoint{PODName: "nginx", PODNameSpace: "ns"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "nginx-deployment-5c689d88bb", PODNameSpace: "ns"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "nginx-deployment-5c689d88bb-qwq47", PODNameSpace: "ns"})).To(BeFalse())
+			})
+		})
+
+		Context("When matching by prefix", func() {
+			It("Should match the pod names starting with the name and a dash", func() {
+				match := PodMatcher{Mode: PodMatchPrefix, Name: "my-web-app", Namespace: "ns"}
+				Expect(match.matches(&endpoint{PODName: "my-web-app", PODNameSpace: "ns"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "my-web-app-5c689d88bb-qwq47", PODNameSpace: "ns"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "my-web-application-5c689d88bb-qwq47", PODNameSpace: "ns"})).To(BeFalse())
+			})
+		})
+
+		Context("When matching by regex", func() {
+			It("Should match the pod names the regex captures the same name from", func() {
+				match := PodMatcher{
+					Mode:      PodMatchRegex,
+					Name:      "my-web-app-5c689d88bb-abcde",
+					Namespace: "ns",
+					NameRegex: regexp.MustCompile(`^(.+)-[a-z0-9]{10}-[a-z0-9]{5}$`),
+				}
+				Expect(match.matches(&endpoint{PODName: "my-web-app-5c689d88bb-qwq47", PODNameSpace: "ns"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "my-web-5c689d88bb-qwq47", PODNameSpace: "ns"})).To(BeFalse())
+				Expect(match.matches(&endpoint{PODName: "my-web-app", PODNameSpace: "ns"})).To(BeFalse())
+			})
+		})
+
+		Context("When matching by uid", func() {
+			It("Should match the pod uid regardless of the pod name", func() {
+				match := PodMatcher{Mode: PodMatchUID, Name: "nginx", Namespace: "ns", UID: "uid1"}
+				Expect(match.matches(&endpoint{PODName: "web", PODNameSpace: "ns", PODUID: "uid1"})).To(BeTrue())
+				Expect(match.matches(&endpoint{PODName: "nginx", PODNameSpace: "ns", PODUID: "uid2"})).To(BeFalse())
+			})
+		})
+
+		Context("When the matcher lacks what its mode matches on", func() {
+			It("Should be invalid", func() {
+				Expect((&PodMatcher{Mode: PodMatchUID}).Validate()).ToNot(Succeed())
+				Expect((&PodMatcher{Mode: PodMatchRegex}).Validate()).ToNot(Succeed())
+				Expect((&PodMatcher{Mode: "label"}).Validate()).ToNot(Succeed())
+				Expect((&PodMatcher{Mode: PodMatchPrefix}).Validate()).To(Succeed())
 			})
 		})
 	})
@@ -211,7 +249,7 @@ var _ = Describe("Test Endpoint", func() {
 
 			It("Should be added", func() {
 				// Add endpoint with valid id
-				ep, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ep).NotTo(BeNil())
@@ -223,7 +261,7 @@ var _ = Describe("Test Endpoint", func() {
 					Endpoints: map[string]*endpoint{},
 					extIf:     &externalInterface{IPv4Gateway: net.ParseIP("192.168.0.1")},
 				}
-				ep, err := nw2.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err := nw2.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ep).NotTo(BeNil())
@@ -241,7 +279,7 @@ var _ = Describe("Test Endpoint", func() {
 				err := mockCli.AddEndpoints(epInfo)
 				Expect(err).ToNot(HaveOccurred())
 				// Adding endpoint with same id should fail and delete should cleanup the state
-				ep2, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep2, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), mockCli, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).To(HaveOccurred())
 				Expect(ep2).To(BeNil())
@@ -251,18 +289,18 @@ var _ = Describe("Test Endpoint", func() {
 			It("Should be deleted", func() {
 				// Adding an endpoint with an id.
 				mockCli := NewMockEndpointClient(nil)
-				ep2, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep2, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), mockCli, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(ep2).ToNot(BeNil())
 				Expect(len(mockCli.endpoints)).To(Equal(1))
 				// Deleting the endpoint
 				//nolint:errcheck // ignore error
-				nw.deleteEndpointImpl(netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli, netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, ep2)
+				nw.deleteEndpointImpl(context.Background(), netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli, netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, ep2)
 				Expect(len(mockCli.endpoints)).To(Equal(0))
 				// Deleting same endpoint with same id should not fail
 				//nolint:errcheck // ignore error
-				nw.deleteEndpointImpl(netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli, netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, ep2)
+				nw.deleteEndpointImpl(context.Background(), netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli, netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, ep2)
 				Expect(len(mockCli.endpoints)).To(Equal(0))
 			})
 		})
@@ -281,7 +319,7 @@ var _ = Describe("Test Endpoint", func() {
 					Endpoints: map[string]*endpoint{},
 					extIf:     &externalInterface{IPv4Gateway: net.ParseIP("192.168.0.1")},
 				}
-				ep, err := nw2.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err := nw2.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ep).NotTo(BeNil())
@@ -303,17 +341,20 @@ var _ = Describe("Test Endpoint", func() {
 					IfName:     eth0IfName,
 					NICType:    cns.InfraNIC,
 				}
-				ep, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
-					netio.NewMockNetIO(false, 0), NewMockEndpointClient(func(ep *EndpointInfo) error {
-						if ep.NICType == cns.InfraNIC {
-							return NewErrorMockEndpointClient("AddEndpoints Infra NIC failed")
-						}
-
-						return nil
-					}), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
+				epClient := NewMockEndpointClient(func(ep *EndpointInfo) error {
+					if ep.NICType == cns.InfraNIC {
+						return NewErrorMockEndpointClient("AddEndpoints Infra NIC failed")
+					}
+
+					return nil
+				})
+				ep, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+					netio.NewMockNetIO(false, 0), epClient, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).To(HaveOccurred())
 				Expect(ep).To(BeNil())
-				ep, err = nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				// the interfaces added before the failure are rolled back
+				Expect(epClient.endpoints).To(BeEmpty())
+				ep, err = nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ep).NotTo(BeNil())
@@ -342,14 +383,14 @@ var _ = Describe("Test Endpoint", func() {
 
 			It("Should not add endpoint to the network when there is an error", func() {
 				secondaryEpInfo.MacAddress = netio.BadHwAddr // mock netlink will fail to set link state on bad eth
-				ep, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), nil, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, secondaryEpInfo)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("SecondaryEndpointClient Error: " + netlink.ErrorMockNetlink.Error()))
 				Expect(ep).To(BeNil())
 				// should not panic or error when going through the unified endpoint impl flow with only the delegated nic type fields
 				secondaryEpInfo.MacAddress = netio.HwAddr
-				ep, err = nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err = nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), nil, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, secondaryEpInfo)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(ep.Id).To(Equal(epInfo.EndpointID))
@@ -357,12 +398,12 @@ var _ = Describe("Test Endpoint", func() {
 
 			It("Should add endpoint when there are no errors", func() {
 				secondaryEpInfo.MacAddress = netio.HwAddr
-				ep, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), nil, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, secondaryEpInfo)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(ep.Id).To(Equal(epInfo.EndpointID))
 
-				ep, err = nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+				ep, err = nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 					netio.NewMockNetIO(false, 0), nil, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(ep.Id).To(Equal(epInfo.EndpointID))
@@ -403,6 +444,20 @@ var _ = Describe("Test Endpoint", func() {
 		})
 	})
 
+	Describe("Test validateAllowedVlanIDs", func() {
+		It("Should allow distinct vlan ids in range", func() {
+			Expect(validateAllowedVlanIDs(nil)).To(Succeed())
+			Expect(validateAllowedVlanIDs([]int{1, 100, 4094})).To(Succeed())
+		})
+		It("Should reject reserved vlan ids", func() {
+			Expect(validateAllowedVlanIDs([]int{0})).To(MatchError(errInvalidVlanID))
+			Expect(validateAllowedVlanIDs([]int{100, 4095})).To(MatchError(errInvalidVlanID))
+		})
+		It("Should reject duplicated vlan ids", func() {
+			Expect(validateAllowedVlanIDs([]int{100, 200, 100})).To(MatchError(errInvalidVlanID))
+		})
+	})
+
 	// validation when calling add
 	Describe("Test validateEndpoints", func() {
 		Context("When in a single add call we create two endpoint structs", func() {
@@ -417,7 +472,7 @@ var _ = Describe("Test Endpoint", func() {
 						NICType:     cns.NodeNetworkInterfaceFrontendNIC,
 					},
 				}
-				Expect(validateEndpoints(eps)).To(BeNil())
+				Expect(validateEndpoints(eps, ValidateByContainerID)).To(BeNil())
 			})
 		})
 		Context("When in a single add call we have different container ids", func() {
@@ -432,7 +487,7 @@ var _ = Describe("Test Endpoint", func() {
 						NICType:     cns.NodeNetworkInterfaceFrontendNIC,
 					},
 				}
-				Expect(validateEndpoints(eps)).ToNot(BeNil())
+				Expect(validateEndpoints(eps, ValidateByContainerID)).ToNot(BeNil())
 			})
 		})
 		Context("When no container id", func() {
@@ -447,7 +502,7 @@ var _ = Describe("Test Endpoint", func() {
 						NICType:     cns.NodeNetworkInterfaceFrontendNIC,
 					},
 				}
-				Expect(validateEndpoints(eps)).ToNot(BeNil())
+				Expect(validateEndpoints(eps, ValidateByContainerID)).ToNot(BeNil())
 			})
 		})
 		Context("When missing nic type", func() {
@@ -462,7 +517,7 @@ var _ = Describe("Test Endpoint", func() {
 						NICType:     "",
 					},
 				}
-				Expect(validateEndpoints(eps)).ToNot(BeNil())
+				Expect(validateEndpoints(eps, ValidateByContainerID)).ToNot(BeNil())
 			})
 		})
 		Context("When no container id ib nic", func() {
@@ -473,7 +528,63 @@ var _ = Describe("Test Endpoint", func() {
 						NICType:     cns.NodeNetworkInterfaceBackendNIC,
 					},
 				}
-				Expect(validateEndpoints(eps)).ToNot(BeNil())
+				Expect(validateEndpoints(eps, ValidateByContainerID)).ToNot(BeNil())
+			})
+		})
+		Context("When validating by pod uid and the container ids differ", func() {
+			It("Should have the same pod uid", func() {
+				eps := []*endpoint{
+					{
+						ContainerID: "0ea7476f26d192f067abdc8b3df43ce3cdbe324386e1c010cb48de87eefef480",
+						PODUID:      "1d8d3c5e-6a4c-4c1a-9a3e-6f5b0b6f3a11",
+						NICType:     cns.InfraNIC,
+					},
+					{
+						ContainerID: "0ea7476f26d192f067abdc8b3df43ce3cdbe324386e1c010cb48de87eefef481",
+						PODUID:      "1d8d3c5e-6a4c-4c1a-9a3e-6f5b0b6f3a11",
+						NICType:     cns.NodeNetworkInterfaceFrontendNIC,
+					},
+				}
+				Expect(validateEndpoints(eps, ValidateByPodUID)).To(BeNil())
+			})
+		})
+		Context("When validating by pod uid and the pod uids differ", func() {
+			It("Should error", func() {
+				eps := []*endpoint{
+					{
+						ContainerID: "0ea7476f26d192f067abdc8b3df43ce3cdbe324386e1c010cb48de87eefef480",
+						PODUID:      "1d8d3c5e-6a4c-4c1a-9a3e-6f5b0b6f3a11",
+						NICType:     cns.InfraNIC,
+					},
+					{
+						ContainerID: "0ea7476f26d192f067abdc8b3df43ce3cdbe324386e1c010cb48de87eefef480",
+						PODUID:      "1d8d3c5e-6a4c-4c1a-9a3e-6f5b0b6f3a12",
+						NICType:     cns.NodeNetworkInterfaceFrontendNIC,
+					},
+				}
+				Expect(validateEndpoints(eps, ValidateByPodUID)).ToNot(BeNil())
+			})
+		})
+		Context("When validating by pod uid and no pod uid", func() {
+			It("Should error", func() {
+				eps := []*endpoint{
+					{
+						ContainerID: "0ea7476f26d192f067abdc8b3df43ce3cdbe324386e1c010cb48de87eefef480",
+						NICType:     cns.InfraNIC,
+					},
+				}
+				Expect(validateEndpoints(eps, ValidateByPodUID)).ToNot(BeNil())
+			})
+		})
+		Context("When the validation mode is unknown", func() {
+			It("Should error", func() {
+				eps := []*endpoint{
+					{
+						ContainerID: "0ea7476f26d192f067abdc8b3df43ce3cdbe324386e1c010cb48de87eefef480",
+						NICType:     cns.InfraNIC,
+					},
+				}
+				Expect(validateEndpoints(eps, "sandbox")).ToNot(BeNil())
 			})
 		})
 	})
@@ -5,15 +5,21 @@ package network
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/netip"
+	"slices"
 	"strings"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/internal/undo"
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/netroute"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/Microsoft/hcsshim"
 	"github.com/Microsoft/hcsshim/hcn"
 	"github.com/pkg/errors"
@@ -21,12 +27,6 @@ import (
 )
 
 const (
-	// hcnSchemaVersionMajor indicates major version number for hcn schema
-	hcnSchemaVersionMajor = 2
-
-	// hcnSchemaVersionMinor indicates minor version number for hcn schema
-	hcnSchemaVersionMinor = 0
-
 	// hcnIpamTypeStatic indicates the static type of ipam
 	hcnIpamTypeStatic = "Static"
 
@@ -133,6 +133,7 @@ func (nw *network) getEndpointWithVFDevice(plc platform.ExecClient, epInfo *Endp
 		Id:          epInfo.MasterIfName,
 		IfName:      epInfo.MasterIfName,
 		ContainerID: epInfo.ContainerID,
+		PODUID:      epInfo.PODUID,
 		MacAddress:  epInfo.MacAddress,
 		NICType:     cns.BackendNIC,
 	}
@@ -143,6 +144,7 @@ func (nw *network) getEndpointWithVFDevice(plc platform.ExecClient, epInfo *Endp
 
 // newEndpointImpl creates a new endpoint in the network.
 func (nw *network) newEndpointImpl(
+	ctx context.Context,
 	cli apipaClient,
 	_ netlink.NetlinkInterface,
 	plc platform.ExecClient,
@@ -157,39 +159,105 @@ func (nw *network) newEndpointImpl(
 		return nw.getEndpointWithVFDevice(plc, epInfo)
 	}
 
-	if useHnsV2, err := UseHnsV2(epInfo.NetNsPath); useHnsV2 {
+	if epInfo.EthtoolSettings != nil {
+		return nil, errors.Wrap(errEthtoolNotSupported, "ethtool settings cannot be applied to windows endpoints")
+	}
+
+	if epInfo.DSCP != 0 {
+		return nil, errors.Wrap(errDSCPNotSupported, "hns qos policies only cap the bandwidth of windows endpoints")
+	}
+	if epInfo.FlowLogs {
+		return nil, errors.Wrap(errFlowLogsNotSupported, "hns doesn't expose the vfp flows of windows endpoints")
+	}
+
+	var (
+		ep  *endpoint
+		err error
+		// each step pushes its inverse, the steps made are all undone, the latest first, if a later one fails
+		rollback undo.Stack
+	)
+	defer func() {
 		if err != nil {
-			return nil, err
+			if rollbackErr := rollback.Rollback(); rollbackErr != nil {
+				logger.Error("Failed to roll back the endpoint", zap.String("endpointID", epInfo.EndpointID), zap.Error(rollbackErr))
+			}
+		}
+	}()
+
+	if useHnsV2, hnsErr := UseHnsV2(epInfo.NetNsPath); useHnsV2 {
+		if hnsErr != nil {
+			return nil, hnsErr
 		}
 
-		return nw.newEndpointImplHnsV2(cli, epInfo)
+		ep, err = nw.newEndpointImplHnsV2(ctx, cli, epInfo, &rollback)
+	} else {
+		ep, err = nw.newEndpointImplHnsV1(ctx, epInfo, &rollback)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nw.newEndpointImplHnsV1(epInfo, plc)
+	ep.HostProtectedPorts = epInfo.HostProtectedPorts
+	rollback.Push("delete the host protection rules", func() error {
+		deleteHostProtectionRules(plc, ep)
+		return nil
+	})
+	if err = tracing.WithSpan(ctx, "policy.AddHostProtection", func(context.Context) error {
+		return addHostProtectionRules(plc, ep)
+	}); err != nil {
+		return nil, err
+	}
+
+	return ep, nil
 }
 
-// newEndpointImplHnsV1 creates a new endpoint in the network using HnsV1
-func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo, plc platform.ExecClient) (*endpoint, error) {
+// newEndpointImplHnsV1 creates a new endpoint in the network using HnsV1, pushing the inverses of its steps on rollback.
+func (nw *network) newEndpointImplHnsV1(ctx context.Context, epInfo *EndpointInfo, rollback *undo.Stack) (*endpoint, error) {
 	var vlanid int
 
+	if len(epInfo.AllowedVlanIDs) > 0 {
+		return nil, errors.Wrap(errVlanTrunkNotSupported, "hnsv1 endpoints cannot be vlan trunks")
+	}
+
 	if epInfo.Data != nil {
 		if _, ok := epInfo.Data[VlanIDKey]; ok {
 			vlanid = epInfo.Data[VlanIDKey].(int)
 		}
 	}
 
+	endpointPolicies, err := policy.AddOutBoundNATExceptions(epInfo.EndpointPolicies, epInfo.OutboundNATExceptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add outbound nat exceptions")
+	}
+
+	if endpointPolicies, err = policy.AddIPv6Policies(endpointPolicies, ipv6Prefixes(epInfo.IPAddresses)); err != nil {
+		return nil, errors.Wrap(err, "failed to add ipv6 policies")
+	}
+
+	if epInfo.SkipDNSRedirect {
+		if endpointPolicies, err = policy.AddL4WFPProxyDNSExceptions(endpointPolicies); err != nil {
+			return nil, errors.Wrap(err, "failed to add dns redirect exceptions")
+		}
+	}
+
 	// Get Infrastructure containerID. Handle ADD calls for workload container.
-	var err error
 	infraEpName, _ := ConstructEndpointID(epInfo.ContainerID, epInfo.NetNsPath, epInfo.IfName)
 	hnsEndpoint := &hcsshim.HNSEndpoint{
 		Name:           infraEpName,
 		VirtualNetwork: nw.HnsId,
 		DNSSuffix:      epInfo.EndpointDNS.Suffix,
 		DNSServerList:  strings.Join(epInfo.EndpointDNS.Servers, ","),
-		Policies:       policy.SerializePolicies(policy.EndpointPolicy, epInfo.EndpointPolicies, epInfo.Data, epInfo.EnableSnatForDns, epInfo.EnableMultiTenancy),
+		Policies:       policy.SerializePolicies(policy.EndpointPolicy, endpointPolicies, epInfo.Data, epInfo.EnableSnatForDns, epInfo.EnableMultiTenancy),
 	}
 
-	// HNS currently supports one IP address and one IPv6 address per endpoint.
+	// HNS currently supports one IP address and one IPv6 address per endpoint, the secondary ips of the pod need hnsv2.
+	families := map[bool]bool{}
+	for _, ipAddr := range epInfo.IPAddresses {
+		if families[ipAddr.IP.To4() != nil] {
+			return nil, errors.Wrapf(errSecondaryIPsNotSupported, "hnsv1 endpoints take one ip per family, got %v", epInfo.IPAddresses)
+		}
+		families[ipAddr.IP.To4() != nil] = true
+	}
 
 	for _, ipAddr := range epInfo.IPAddresses {
 		if ipAddr.IP.To4() != nil {
@@ -206,51 +274,50 @@ func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo, plc platform.ExecC
 		}
 	}
 
+	if err = checkDeadline(ctx, "creating the hns endpoint"); err != nil {
+		return nil, err
+	}
+	_, span := tracing.Start(ctx, "hns.CreateEndpoint")
 	hnsResponse, err := Hnsv1.CreateEndpoint(hnsEndpoint, "")
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		if err != nil {
-			logger.Info("HNSEndpointRequest DELETE id", zap.String("id", hnsResponse.Id))
-			hnsResponse, err := Hnsv1.DeleteEndpoint(hnsResponse.Id)
-			logger.Error("HNSEndpointRequest DELETE response", zap.Any("hnsResponse", hnsResponse), zap.Error(err))
-		}
-	}()
+	rollback.Push("delete hns endpoint "+hnsResponse.Id, func() error {
+		logger.Info("HNSEndpointRequest DELETE id", zap.String("id", hnsResponse.Id))
+		_, err := Hnsv1.DeleteEndpoint(hnsResponse.Id)
+		return err //nolint:wrapcheck // wrapped by the rollback
+	})
 
-	if epInfo.SkipHotAttachEp {
-		logger.Info("Skipping attaching the endpoint to container",
-			zap.String("id", hnsResponse.Id), zap.String("id", epInfo.ContainerID))
-	} else {
-		// Attach the endpoint.
-		logger.Info("Attaching endpoint to container", zap.String("id", hnsResponse.Id), zap.String("ContainerID", epInfo.ContainerID))
-		err = Hnsv1.HotAttachEndpoint(epInfo.ContainerID, hnsResponse.Id)
-		if err != nil {
-			logger.Error("Failed to attach endpoint", zap.Error(err))
-			return nil, err
-		}
+	if err = checkDeadline(ctx, "attaching the hns endpoint"); err != nil {
+		return nil, err
+	}
+	if err = hotAttachEndpoint(epInfo, hnsResponse.Id); err != nil {
+		return nil, err
 	}
 
 	// add ipv6 neighbor entry for gateway IP to default mac in container
-	if err := nw.addIPv6NeighborEntryForGateway(epInfo, plc); err != nil {
+	if err := nw.addIPv6NeighborEntryForGateway(epInfo); err != nil {
 		return nil, err
 	}
 
 	// Create the endpoint object.
 	ep := &endpoint{
-		Id:               infraEpName,
-		HnsId:            hnsResponse.Id,
-		SandboxKey:       epInfo.ContainerID,
-		IfName:           epInfo.IfName,
-		IPAddresses:      epInfo.IPAddresses,
-		Gateways:         []net.IP{net.ParseIP(hnsResponse.GatewayAddress)},
-		DNS:              epInfo.EndpointDNS,
-		VlanID:           vlanid,
-		EnableSnatOnHost: epInfo.EnableSnatOnHost,
-		NetNs:            epInfo.NetNsPath,
-		ContainerID:      epInfo.ContainerID,
-		NICType:          epInfo.NICType,
+		Id:                    infraEpName,
+		HnsId:                 hnsResponse.Id,
+		SandboxKey:            epInfo.ContainerID,
+		IfName:                epInfo.IfName,
+		IPAddresses:           epInfo.IPAddresses,
+		Gateways:              []net.IP{net.ParseIP(hnsResponse.GatewayAddress)},
+		DNS:                   epInfo.EndpointDNS,
+		VlanID:                vlanid,
+		EnableSnatOnHost:      epInfo.EnableSnatOnHost,
+		NetNs:                 epInfo.NetNsPath,
+		ContainerID:           epInfo.ContainerID,
+		NICType:               epInfo.NICType,
+		OutboundNATExceptions: epInfo.OutboundNATExceptions,
+		SkipDNSRedirect:       epInfo.SkipDNSRedirect,
 	}
 
 	for _, route := range epInfo.Routes {
@@ -264,58 +331,100 @@ func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo, plc platform.ExecC
 	return ep, nil
 }
 
-func (nw *network) addIPv6NeighborEntryForGateway(epInfo *EndpointInfo, plc platform.ExecClient) error {
-	var (
-		err error
-		out string
-	)
+// hotAttachEndpoint attaches the hns endpoint to the container of a docker netns, which is no hcn namespace. Compute
+// systems aren't hcn objects, so this remains an hns v1 request whatever the api the endpoint was created with.
+func hotAttachEndpoint(epInfo *EndpointInfo, hnsEndpointID string) error {
+	if epInfo.SkipHotAttachEp {
+		logger.Info("Skipping attaching the endpoint to container",
+			zap.String("id", hnsEndpointID), zap.String("ContainerID", epInfo.ContainerID))
+		return nil
+	}
 
-	if epInfo.IPV6Mode == IPV6Nat {
-		if len(nw.Subnets) < 2 {
-			return fmt.Errorf("Ipv6 subnet not found in network state")
-		}
+	logger.Info("Attaching endpoint to container", zap.String("id", hnsEndpointID), zap.String("ContainerID", epInfo.ContainerID))
+	if err := Hnsv1.HotAttachEndpoint(epInfo.ContainerID, hnsEndpointID); err != nil {
+		logger.Error("Failed to attach endpoint", zap.Error(err))
+		return errors.Wrapf(err, "failed to attach endpoint %s to container %s", hnsEndpointID, epInfo.ContainerID)
+	}
+	return nil
+}
+
+func (nw *network) addIPv6NeighborEntryForGateway(epInfo *EndpointInfo) error {
+	if epInfo.IPV6Mode != IPV6Nat {
+		return nil
+	}
 
-		// run powershell cmd to set neighbor entry for gw ip to 12-34-56-78-9a-bc
-		cmd := fmt.Sprintf("New-NetNeighbor -IPAddress %s -InterfaceAlias \"%s (%s)\" -LinkLayerAddress \"%s\"",
-			nw.Subnets[1].Gateway.String(), containerIfNamePrefix, epInfo.EndpointID, defaultGwMac)
+	if len(nw.Subnets) < 2 {
+		return fmt.Errorf("Ipv6 subnet not found in network state")
+	}
 
-		if out, err = plc.ExecutePowershellCommand(cmd); err != nil {
-			logger.Error("Adding ipv6 gw neigh entry failed", zap.Any("out", out), zap.Error(err))
-			return err
-		}
+	gateway, ok := netip.AddrFromSlice(nw.Subnets[1].Gateway)
+	if !ok {
+		return errors.Errorf("invalid ipv6 gateway %s", nw.Subnets[1].Gateway.String())
+	}
+	mac, err := net.ParseMAC(defaultGwMac)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse gateway mac %s", defaultGwMac)
 	}
 
-	return err
+	// set neighbor entry for gw ip to 12-34-56-78-9a-bc
+	neigh := &netroute.Neighbor{
+		Interface:    fmt.Sprintf("%s (%s)", containerIfNamePrefix, epInfo.EndpointID),
+		Address:      gateway.Unmap(),
+		HardwareAddr: mac,
+	}
+	if err := NetRoute.AddNeighbor(neigh); err != nil {
+		logger.Error("Adding ipv6 gw neigh entry failed", zap.Stringer("neighbor", neigh), zap.Error(err))
+		return err
+	}
+
+	return nil
 }
 
 // configureHcnEndpoint configures hcn endpoint for creation
 func (nw *network) configureHcnEndpoint(epInfo *EndpointInfo) (*hcn.HostComputeEndpoint, error) {
+	schemaVersion, err := hcnSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
 	infraEpName, _ := ConstructEndpointID(epInfo.ContainerID, epInfo.NetNsPath, epInfo.IfName)
 
 	hcnEndpoint := &hcn.HostComputeEndpoint{
-		Name:               infraEpName,
+		Name:               infraEpName + hcnEndpointOwnerTag,
 		HostComputeNetwork: nw.HnsId,
 		Dns: hcn.Dns{
 			Search:     strings.Split(epInfo.EndpointDNS.Suffix, ","),
 			ServerList: epInfo.EndpointDNS.Servers,
 			Options:    epInfo.EndpointDNS.Options,
 		},
-		SchemaVersion: hcn.SchemaVersion{
-			Major: hcnSchemaVersionMajor,
-			Minor: hcnSchemaVersionMinor,
-		},
+		SchemaVersion: schemaVersion,
 	}
 
 	// macAddress type for InfraNIC is like "60:45:bd:12:45:65"
 	// if NICType is delegatedVMNIC or AccelnetNIC, convert the macaddress format
 	macAddress := epInfo.MacAddress.String()
-	if epInfo.NICType == cns.NodeNetworkInterfaceFrontendNIC {
+	if epInfo.NICType.IsFrontendNIC() {
 		// convert the format of macAddress that HNS can accept, i.e, "60-45-bd-12-45-65" if NIC type is delegated NIC
 		macAddress = strings.Join(strings.Split(macAddress, ":"), "-")
 	}
 	hcnEndpoint.MacAddress = macAddress
 
-	if epPolicies, err := policy.GetHcnEndpointPolicies(policy.EndpointPolicy, epInfo.EndpointPolicies, epInfo.Data, epInfo.EnableSnatForDns, epInfo.EnableMultiTenancy, epInfo.NATInfo); err == nil {
+	endpointPolicies, err := policy.AddOutBoundNATExceptions(epInfo.EndpointPolicies, epInfo.OutboundNATExceptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add outbound nat exceptions")
+	}
+
+	if endpointPolicies, err = policy.AddIPv6Policies(endpointPolicies, ipv6Prefixes(epInfo.IPAddresses)); err != nil {
+		return nil, errors.Wrap(err, "failed to add ipv6 policies")
+	}
+
+	if epInfo.SkipDNSRedirect {
+		if endpointPolicies, err = policy.AddL4WFPProxyDNSExceptions(endpointPolicies); err != nil {
+			return nil, errors.Wrap(err, "failed to add dns redirect exceptions")
+		}
+	}
+
+	if epPolicies, err := policy.GetHcnEndpointPolicies(policy.EndpointPolicy, endpointPolicies, epInfo.Data, epInfo.EnableSnatForDns, epInfo.EnableMultiTenancy, epInfo.NATInfo); err == nil {
 		hcnEndpoint.Policies = append(hcnEndpoint.Policies, epPolicies...)
 	} else {
 		logger.Error("Failed to get endpoint policies due to", zap.Error(err))
@@ -323,7 +432,7 @@ func (nw *network) configureHcnEndpoint(epInfo *EndpointInfo) (*hcn.HostComputeE
 	}
 
 	// add hcnEndpoint policy for accelnet for frontendNIC
-	if epInfo.NICType == cns.NodeNetworkInterfaceFrontendNIC {
+	if epInfo.NICType.IsFrontendNIC() {
 		endpointPolicy, err := policy.AddAccelnetPolicySetting()
 		if err != nil {
 			logger.Error("Failed to set iov endpoint policy", zap.Error(err))
@@ -332,6 +441,15 @@ func (nw *network) configureHcnEndpoint(epInfo *EndpointInfo) (*hcn.HostComputeE
 		hcnEndpoint.Policies = append(hcnEndpoint.Policies, endpointPolicy)
 	}
 
+	// deliver the trunk's vlans tagged to the endpoint
+	if len(epInfo.AllowedVlanIDs) > 0 {
+		endpointPolicy, err := policy.AddVlanTrunkPolicySetting(epInfo.AllowedVlanIDs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to set vlan trunk endpoint policy for endpointId :%s", epInfo.EndpointID)
+		}
+		hcnEndpoint.Policies = append(hcnEndpoint.Policies, endpointPolicy)
+	}
+
 	for _, route := range epInfo.Routes {
 		hcnRoute := hcn.Route{
 			NextHop:           route.Gw.String(),
@@ -387,7 +505,7 @@ func (nw *network) deleteHostNCApipaEndpoint(networkContainerID string) error {
 
 // createHostNCApipaEndpoint creates a new endpoint in the HostNCApipaNetwork
 // for host container connectivity
-func (nw *network) createHostNCApipaEndpoint(cli apipaClient, epInfo *EndpointInfo) error {
+func (nw *network) createHostNCApipaEndpoint(ctx context.Context, cli apipaClient, epInfo *EndpointInfo, rollback *undo.Stack) error {
 	var (
 		err                   error
 		hostNCApipaEndpointID string
@@ -402,15 +520,13 @@ func (nw *network) createHostNCApipaEndpoint(cli apipaClient, epInfo *EndpointIn
 	logger.Info("Creating HostNCApipaEndpoint for host container connectivity for NC",
 		zap.String("NetworkContainerID", epInfo.NetworkContainerID))
 
-	if hostNCApipaEndpointID, err = cli.CreateHostNCApipaEndpoint(context.TODO(), epInfo.NetworkContainerID); err != nil {
+	if hostNCApipaEndpointID, err = cli.CreateHostNCApipaEndpoint(ctx, epInfo.NetworkContainerID); err != nil {
 		return err
 	}
 
-	defer func() {
-		if err != nil {
-			nw.deleteHostNCApipaEndpoint(epInfo.NetworkContainerID)
-		}
-	}()
+	rollback.Push("delete the host nc apipa endpoint "+hostNCApipaEndpointID, func() error {
+		return nw.deleteHostNCApipaEndpoint(epInfo.NetworkContainerID)
+	})
 
 	if err = hcn.AddNamespaceEndpoint(namespace.Id, hostNCApipaEndpointID); err != nil {
 		return fmt.Errorf("Failed to add HostNCApipaEndpoint: %s to namespace: %s due to error: %v", hostNCApipaEndpointID, namespace.Id, err) //nolint
@@ -420,7 +536,7 @@ func (nw *network) createHostNCApipaEndpoint(cli apipaClient, epInfo *EndpointIn
 }
 
 // newEndpointImplHnsV2 creates a new endpoint in the network using Hnsv2
-func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (*endpoint, error) {
+func (nw *network) newEndpointImplHnsV2(ctx context.Context, cli apipaClient, epInfo *EndpointInfo, rollback *undo.Stack) (*endpoint, error) {
 	hcnEndpoint, err := nw.configureHcnEndpoint(epInfo)
 	if err != nil {
 		logger.Error("Failed to configure hcn endpoint due to", zap.Error(err))
@@ -428,43 +544,62 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 	}
 
 	// Create the HCN endpoint.
+	if err = checkDeadline(ctx, "creating the hcn endpoint"); err != nil {
+		return nil, err
+	}
 	logger.Info("Creating hcn endpoint", zap.Any("hcnEndpoint", hcnEndpoint), zap.String("computenetwork", hcnEndpoint.HostComputeNetwork))
+	_, span := tracing.Start(ctx, "hcn.CreateEndpoint")
 	hnsResponse, err := Hnsv2.CreateEndpoint(hcnEndpoint)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create endpoint: %s due to error: %v", hcnEndpoint.Name, err)
 	}
 
 	logger.Info("Successfully created hcn endpoint with response", zap.Any("hnsResponse", hnsResponse))
 
-	defer func() {
-		if err != nil {
-			logger.Info("Deleting hcn endpoint with id", zap.String("id", hnsResponse.Id))
-			err = Hnsv2.DeleteEndpoint(hnsResponse)
-			logger.Error("Completed hcn endpoint deletion for id with error", zap.String("id", hnsResponse.Id), zap.Error(err))
-		}
-	}()
+	rollback.Push("delete hcn endpoint "+hnsResponse.Id, func() error {
+		logger.Info("Deleting hcn endpoint with id", zap.String("id", hnsResponse.Id))
+		return Hnsv2.DeleteEndpoint(hnsResponse) //nolint:wrapcheck // wrapped by the rollback
+	})
 
+	if err = checkDeadline(ctx, "adding the hcn endpoint to the namespace"); err != nil {
+		return nil, err
+	}
+
+	// the endpoint of a docker container is attached to the container, which has no hcn namespace
 	var namespace *hcn.HostComputeNamespace
 	if namespace, err = Hnsv2.GetNamespaceByID(epInfo.NetNsPath); err != nil {
-		return nil, fmt.Errorf("Failed to get hcn namespace: %s due to error: %v", epInfo.NetNsPath, err)
-	}
+		if isHcnNamespaceID(epInfo.NetNsPath) {
+			return nil, fmt.Errorf("Failed to get hcn namespace: %s due to error: %v", epInfo.NetNsPath, err)
+		}
 
-	if err = Hnsv2.AddNamespaceEndpoint(namespace.Id, hnsResponse.Id); err != nil {
-		return nil, fmt.Errorf("Failed to add endpoint: %s to hcn namespace: %s due to error: %v", hnsResponse.Id, namespace.Id, err) //nolint
-	}
+		if err = hotAttachEndpoint(epInfo, hnsResponse.Id); err != nil {
+			return nil, err
+		}
 
-	defer func() {
-		if err != nil {
-			if errRemoveNsEp := Hnsv2.RemoveNamespaceEndpoint(namespace.Id, hnsResponse.Id); errRemoveNsEp != nil {
-				logger.Error("Failed to remove endpoint from namespace due to error",
-					zap.String("id", hnsResponse.Id), zap.String("id", hnsResponse.Id), zap.Error(errRemoveNsEp))
-			}
+		// add ipv6 neighbor entry for gateway IP to default mac in container
+		if err = nw.addIPv6NeighborEntryForGateway(epInfo); err != nil {
+			return nil, err
 		}
-	}()
+	} else {
+		if err = tracing.WithSpan(ctx, "hcn.AddNamespaceEndpoint", func(context.Context) error {
+			return Hnsv2.AddNamespaceEndpoint(namespace.Id, hnsResponse.Id)
+		}); err != nil {
+			return nil, fmt.Errorf("Failed to add endpoint: %s to hcn namespace: %s due to error: %v", hnsResponse.Id, namespace.Id, err) //nolint
+		}
+
+		namespaceID := namespace.Id
+		rollback.Push(fmt.Sprintf("remove hcn endpoint %s from namespace %s", hnsResponse.Id, namespaceID), func() error {
+			return Hnsv2.RemoveNamespaceEndpoint(namespaceID, hnsResponse.Id) //nolint:wrapcheck // wrapped by the rollback
+		})
+	}
 
 	// If the Host - container connectivity is requested, create endpoint in HostNCApipaNetwork
-	if epInfo.AllowInboundFromHostToNC || epInfo.AllowInboundFromNCToHost {
-		if err = nw.createHostNCApipaEndpoint(cli, epInfo); err != nil {
+	if (epInfo.AllowInboundFromHostToNC || epInfo.AllowInboundFromNCToHost) && namespace == nil {
+		logger.Info("Skipping HostNCApipaEndpoint, docker containers have no hcn namespace to add it to",
+			zap.String("ContainerID", epInfo.ContainerID))
+	} else if epInfo.AllowInboundFromHostToNC || epInfo.AllowInboundFromNCToHost {
+		if err = nw.createHostNCApipaEndpoint(ctx, cli, epInfo, rollback); err != nil {
 			return nil, fmt.Errorf("Failed to create HostNCApipaEndpoint due to error: %v", err)
 		}
 	}
@@ -487,9 +622,11 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 		nicName = epInfo.MasterIfName
 	}
 
+	infraEpName, _ := ConstructEndpointID(epInfo.ContainerID, epInfo.NetNsPath, epInfo.IfName)
+
 	// Create the endpoint object.
 	ep := &endpoint{
-		Id:                       hcnEndpoint.Name,
+		Id:                       infraEpName,
 		HnsId:                    hnsResponse.Id,
 		SandboxKey:               epInfo.ContainerID,
 		IfName:                   nicName,
@@ -505,8 +642,12 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 		ContainerID:              epInfo.ContainerID,
 		PODName:                  epInfo.PODName,
 		PODNameSpace:             epInfo.PODNameSpace,
+		PODUID:                   epInfo.PODUID,
 		HNSNetworkID:             epInfo.HNSNetworkID,
 		NICType:                  epInfo.NICType,
+		OutboundNATExceptions:    epInfo.OutboundNATExceptions,
+		SkipDNSRedirect:          epInfo.SkipDNSRedirect,
+		AllowedVlanIDs:           epInfo.AllowedVlanIDs,
 	}
 
 	for _, route := range epInfo.Routes {
@@ -514,6 +655,7 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 	}
 
 	ep.MacAddress, _ = net.ParseMAC(hnsResponse.MacAddress)
+	ep.recordHnsEndpointConfig(hcnEndpoint)
 
 	epInfo.HNSEndpointID = hnsResponse.Id // we use the ep info hns id later in stateless to clean up in ADD if there is an error
 
@@ -521,7 +663,7 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 }
 
 // deleteEndpointImpl deletes an existing endpoint from the network.
-func (nw *network) deleteEndpointImpl(_ netlink.NetlinkInterface, _ platform.ExecClient, _ EndpointClient, _ netio.NetIOInterface, _ NamespaceClientInterface,
+func (nw *network) deleteEndpointImpl(ctx context.Context, _ netlink.NetlinkInterface, plc platform.ExecClient, _ EndpointClient, _ netio.NetIOInterface, _ NamespaceClientInterface,
 	_ ipTablesClient, _ dhcpClient, ep *endpoint,
 ) error {
 	// endpoint deletion is not required for IB
@@ -529,6 +671,8 @@ func (nw *network) deleteEndpointImpl(_ netlink.NetlinkInterface, _ platform.Exe
 		return nil
 	}
 
+	deleteHostProtectionRules(plc, ep)
+
 	if ep.HnsId == "" {
 		logger.Error("No HNS id found. Skip endpoint deletion", zap.Any("nicType", ep.NICType), zap.String("containerId", ep.ContainerID))
 		return fmt.Errorf("No HNS id found. Skip endpoint deletion for nicType %v, containerID %s", ep.NICType, ep.ContainerID) //nolint
@@ -539,16 +683,68 @@ func (nw *network) deleteEndpointImpl(_ netlink.NetlinkInterface, _ platform.Exe
 			return err
 		}
 
-		return nw.deleteEndpointImplHnsV2(ep)
+		return nw.deleteEndpointImplHnsV2(ctx, ep)
 	}
 
-	return nw.deleteEndpointImplHnsV1(ep)
+	return nw.deleteEndpointImplHnsV1(ctx, ep)
+}
+
+// detachDelegatedNICImpl deletes the hns endpoint of the delegated nic, which returns the nic to the host. A delegated
+// nic is an endpoint of its own on windows, so it is not looked up by name.
+func (nw *network) detachDelegatedNICImpl(nl netlink.NetlinkInterface, plc platform.ExecClient, nioc netio.NetIOInterface,
+	nsc NamespaceClientInterface, dhcpc dhcpClient, ep *endpoint, _ string,
+) error {
+	return nw.deleteEndpointImpl(context.Background(), nl, plc, nil, nioc, nsc, nil, dhcpc, ep)
+}
+
+// newStatelessEndpoint builds the endpoint to delete from its record in CNS. Stateless cni always uses hnsv2, a dummy
+// guid as NetNs makes the deletion fail on the nodes which don't support it instead of falling back to hnsv1.
+func newStatelessEndpoint(networkID string, epInfo *EndpointInfo) (*network, *endpoint) {
+	nw := &network{
+		Id:           networkID, // currently unused in stateless cni
+		HnsId:        epInfo.HNSNetworkID,
+		Mode:         opModeTransparentVlan,
+		SnatBridgeIP: "",
+		NetNs:        dummyGUID, // to trigger hns v2, windows
+		extIf: &externalInterface{
+			Name:       InfraInterfaceName,
+			MacAddress: nil,
+		},
+	}
+
+	ep := &endpoint{
+		Id:                       epInfo.EndpointID,
+		HnsId:                    epInfo.HNSEndpointID,
+		HNSNetworkID:             epInfo.HNSNetworkID, // unused (we use nw.HnsId for deleting the network)
+		HostIfName:               epInfo.HostIfName,
+		LocalIP:                  "",
+		VlanID:                   0,
+		AllowInboundFromHostToNC: false, // stateless currently does not support apipa
+		AllowInboundFromNCToHost: false,
+		EnableSnatOnHost:         false,
+		EnableMultitenancy:       false,
+		NetworkContainerID:       epInfo.NetworkContainerID, // we don't use this as long as AllowInboundFromHostToNC and AllowInboundFromNCToHost are false
+		NetNs:                    dummyGUID,                 // to trigger hnsv2, windows
+		NICType:                  epInfo.NICType,
+		IfName:                   epInfo.IfName,
+		IPAddresses:              epInfo.IPAddresses,
+		HostProtectedPorts:       epInfo.HostProtectedPorts,
+	}
+
+	return nw, ep
 }
 
 // deleteEndpointImplHnsV1 deletes an existing endpoint from the network using HNS v1.
-func (nw *network) deleteEndpointImplHnsV1(ep *endpoint) error {
+func (nw *network) deleteEndpointImplHnsV1(ctx context.Context, ep *endpoint) error {
 	logger.Info("HNSEndpointRequest DELETE id", zap.String("id", ep.HnsId))
-	hnsResponse, err := Hnsv1.DeleteEndpoint(ep.HnsId)
+	var hnsResponse *hcsshim.HNSEndpoint
+	_, span := tracing.Start(ctx, "hns.DeleteEndpoint")
+	err := runStage(ctx, "deleting the hns endpoint", func() error {
+		var deleteErr error
+		hnsResponse, deleteErr = Hnsv1.DeleteEndpoint(ep.HnsId)
+		return deleteErr
+	})
+	tracing.End(span, err)
 	logger.Info("HNSEndpointRequest DELETE response err", zap.Any("hnsResponse", hnsResponse), zap.Error(err))
 
 	// todo: may need to improve error handling if hns or hcsshim change their error bubbling.
@@ -565,7 +761,7 @@ func (nw *network) deleteEndpointImplHnsV1(ep *endpoint) error {
 }
 
 // deleteEndpointImplHnsV2 deletes an existing endpoint from the network using HNS v2.
-func (nw *network) deleteEndpointImplHnsV2(ep *endpoint) error {
+func (nw *network) deleteEndpointImplHnsV2(ctx context.Context, ep *endpoint) error {
 	var (
 		hcnEndpoint *hcn.HostComputeEndpoint
 		err         error
@@ -580,7 +776,11 @@ func (nw *network) deleteEndpointImplHnsV2(ep *endpoint) error {
 
 	logger.Info("Deleting hcn endpoint with id", zap.String("HnsId", ep.HnsId))
 
-	hcnEndpoint, err = Hnsv2.GetEndpointByID(ep.HnsId)
+	err = runStage(ctx, "getting the hcn endpoint", func() error {
+		var getErr error
+		hcnEndpoint, getErr = Hnsv2.GetEndpointByID(ep.HnsId)
+		return getErr
+	})
 	if err != nil {
 		// If error is anything other than EndpointNotFoundError, return error.
 		// else log the error but don't return error because endpoint is already deleted.
@@ -592,14 +792,20 @@ func (nw *network) deleteEndpointImplHnsV2(ep *endpoint) error {
 		return nil
 	}
 
-	// Remove this endpoint from the namespace
-	if err = Hnsv2.RemoveNamespaceEndpoint(hcnEndpoint.HostComputeNamespace, hcnEndpoint.Id); err != nil {
-		logger.Error("Failed to remove hcn endpoint from namespace due to error", zap.String("HnsId", ep.HnsId),
-			zap.String("HostComputeNamespace", hcnEndpoint.HostComputeNamespace), zap.Error(err))
+	// Remove this endpoint from the namespace, the endpoints of docker containers have none
+	if hcnEndpoint.HostComputeNamespace != "" {
+		if err = Hnsv2.RemoveNamespaceEndpoint(hcnEndpoint.HostComputeNamespace, hcnEndpoint.Id); err != nil {
+			logger.Error("Failed to remove hcn endpoint from namespace due to error", zap.String("HnsId", ep.HnsId),
+				zap.String("HostComputeNamespace", hcnEndpoint.HostComputeNamespace), zap.Error(err))
+		}
 	}
 
-	if err = Hnsv2.DeleteEndpoint(hcnEndpoint); err != nil {
-		return fmt.Errorf("Failed to delete hcn endpoint: %s due to error: %v", ep.HnsId, err)
+	if err = tracing.WithSpan(ctx, "hcn.DeleteEndpoint", func(ctx context.Context) error {
+		return runStage(ctx, "deleting the hcn endpoint", func() error {
+			return Hnsv2.DeleteEndpoint(hcnEndpoint)
+		})
+	}); err != nil {
+		return fmt.Errorf("Failed to delete hcn endpoint: %s due to error: %w", ep.HnsId, err)
 	}
 
 	logger.Info("Successfully deleted hcn endpoint with id", zap.String("HnsId", ep.HnsId))
@@ -608,13 +814,158 @@ func (nw *network) deleteEndpointImplHnsV2(ep *endpoint) error {
 }
 
 // getInfoImpl returns information about the endpoint.
-func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
+func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo, statsClient netio.NetIOInterface) {
 	epInfo.Data["hnsid"] = ep.HnsId
+
+	// the counters of the hns endpoint are read from hns, the stats client only tells they are collected
+	if statsClient == nil || ep.HnsId == "" {
+		return
+	}
+
+	if isHcnNamespaceID(ep.NetNs) {
+		epInfo.OperState = ep.operState()
+	}
+
+	// hcn has no endpoint statistics, they are read with hns v1 whatever the api the endpoint was created with
+	stats, err := Hnsv1.GetHNSEndpointStats(ep.HnsId)
+	if err != nil {
+		logger.Error("Failed to get endpoint traffic counters", zap.String("endpointID", ep.Id), zap.Error(err))
+		return
+	}
+
+	epInfo.Data[RxBytesKey] = stats.BytesReceived
+	epInfo.Data[TxBytesKey] = stats.BytesSent
+	epInfo.Data[RxPacketsKey] = stats.PacketsReceived
+	epInfo.Data[TxPacketsKey] = stats.PacketsSent
+	epInfo.Data[RxDroppedKey] = stats.DroppedPacketsIncoming
+	epInfo.Data[TxDroppedKey] = stats.DroppedPacketsOutgoing
+}
+
+// operState reads the state of the hcn endpoint from hns, which has no link state: the endpoint is up once it is
+// attached to the namespace of the pod.
+func (ep *endpoint) operState() *EndpointOperState {
+	hcnEndpoint, err := Hnsv2.GetEndpointByID(ep.HnsId)
+	if err != nil {
+		return &EndpointOperState{Error: err.Error()}
+	}
+
+	ifIPs := make([]net.IP, 0, len(hcnEndpoint.IpConfigurations))
+	for _, ipConfig := range hcnEndpoint.IpConfigurations {
+		if ip := net.ParseIP(ipConfig.IpAddress); ip != nil {
+			ifIPs = append(ifIPs, ip)
+		}
+	}
+	return &EndpointOperState{
+		Up:         hcnEndpoint.HostComputeNamespace != "",
+		MissingIPs: missingIPs(ep.IPAddresses, ifIPs),
+	}
 }
 
-// updateEndpointImpl in windows does nothing for now
+// updateEndpointImpl replaces the ACL policies of an existing hcn endpoint with the ones in targetEpInfo. Other
+// endpoint properties can't be updated on windows yet.
 func (nm *networkManager) updateEndpointImpl(nw *network, existingEpInfo *EndpointInfo, targetEpInfo *EndpointInfo) (*endpoint, error) {
-	return nil, nil
+	ep := nw.Endpoints[existingEpInfo.EndpointID]
+	if ep == nil {
+		return nil, errEndpointNotFound
+	}
+
+	aclPolicies, err := getHcnACLPolicies(targetEpInfo.EndpointPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(aclPolicies) == 0 {
+		return ep, nil
+	}
+
+	if useHnsV2, err := UseHnsV2(ep.NetNs); !useHnsV2 {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, errors.New("updating ACL policies requires hcn, which this node does not support")
+	}
+
+	if err := applyHcnACLPolicies(ep.HnsId, aclPolicies); err != nil {
+		return nil, err
+	}
+
+	// the endpoint is created again with the ACLs it has now if hns loses it
+	if len(ep.HnsEndpointConfig) > 0 {
+		hcnEndpoint := &hcn.HostComputeEndpoint{}
+		if err := json.Unmarshal(ep.HnsEndpointConfig, hcnEndpoint); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal hcn endpoint config")
+		}
+		hcnEndpoint.Policies = replaceACLPolicies(hcnEndpoint.Policies, aclPolicies)
+		ep.recordHnsEndpointConfig(hcnEndpoint)
+	}
+
+	return ep, nil
+}
+
+// ipv6Prefixes returns the ipv6 prefixes of the addresses of a dual-stack endpoint, whose ipv4 policies are paired
+// with ipv6 ones.
+func ipv6Prefixes(ipAddresses []net.IPNet) []string {
+	var prefixes []string
+	for _, ipAddr := range ipAddresses {
+		if ipAddr.IP.To4() != nil {
+			continue
+		}
+		prefix := (&net.IPNet{IP: ipAddr.IP.Mask(ipAddr.Mask), Mask: ipAddr.Mask}).String()
+		if !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// getHcnACLPolicies returns the hcn ACL policies among the endpoint policies.
+func getHcnACLPolicies(endpointPolicies []policy.Policy) ([]hcn.EndpointPolicy, error) {
+	var aclPolicies []hcn.EndpointPolicy
+	for _, p := range endpointPolicies {
+		if p.Type != policy.EndpointPolicy || policy.GetPolicyType(p) != policy.ACLPolicy {
+			continue
+		}
+
+		aclPolicy, err := policy.GetHcnACLPolicy(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse ACL policy")
+		}
+
+		aclPolicies = append(aclPolicies, aclPolicy)
+	}
+
+	return aclPolicies, nil
+}
+
+// applyHcnACLPolicies replaces the ACL policies of the hcn endpoint, keeping its other policies. All ACLs are applied
+// in a single ModifyEndpoint request, so large policy sets don't cost one hns round trip per rule.
+func applyHcnACLPolicies(hnsEndpointID string, aclPolicies []hcn.EndpointPolicy) error {
+	hcnEndpoint, err := Hnsv2.GetEndpointByID(hnsEndpointID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get hcn endpoint %s", hnsEndpointID)
+	}
+
+	// an update request replaces every policy on the endpoint
+	policies := replaceACLPolicies(hcnEndpoint.Policies, aclPolicies)
+
+	logger.Info("Applying ACL policies to hcn endpoint", zap.String("id", hnsEndpointID), zap.Int("count", len(aclPolicies)))
+	if err := Hnsv2.ApplyEndpointPolicy(hcnEndpoint, hcn.RequestTypeUpdate, hcn.PolicyEndpointRequest{Policies: policies}); err != nil {
+		return errors.Wrapf(err, "failed to apply ACL policies to hcn endpoint %s", hnsEndpointID)
+	}
+
+	return nil
+}
+
+// replaceACLPolicies returns the policies with their ACL policies replaced by aclPolicies.
+func replaceACLPolicies(policies, aclPolicies []hcn.EndpointPolicy) []hcn.EndpointPolicy {
+	replaced := make([]hcn.EndpointPolicy, 0, len(policies)+len(aclPolicies))
+	for _, p := range policies {
+		if p.Type != hcn.ACL {
+			replaced = append(replaced, p)
+		}
+	}
+	return append(replaced, aclPolicies...)
 }
 
 // GetEndpointInfoByIPImpl returns an endpointInfo with the corrsponding HNS Endpoint ID that matches an specific IP Address.
@@ -7,20 +7,27 @@
 package network
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/internal/undo"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/netroute"
 	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -57,13 +64,13 @@ func TestNewAndDeleteEndpointImplHnsV2(t *testing.T) {
 		NICType:      cns.InfraNIC,
 		HNSNetworkID: "853d3fb6-e9b3-49e2-a109-2acc5dda61f1",
 	}
-	ep, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
 	if err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
 	}
 
-	if err = validateEndpoints([]*endpoint{ep}); err != nil {
+	if err = validateEndpoints([]*endpoint{ep}, ValidateByContainerID); err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
 	}
@@ -80,7 +87,7 @@ func TestNewAndDeleteEndpointImplHnsV2(t *testing.T) {
 		t.Fatal("hns network id was not copied to the endpoint struct during new endpoint impl call")
 	}
 
-	err = nw.deleteEndpointImplHnsV2(ep)
+	err = nw.deleteEndpointImplHnsV2(context.Background(), ep)
 
 	if err != nil {
 		fmt.Printf("+%v", err)
@@ -88,6 +95,93 @@ func TestNewAndDeleteEndpointImplHnsV2(t *testing.T) {
 	}
 }
 
+func TestConfigureHcnEndpointVlanTrunk(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:     "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID:    "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:      "fakeNameSpace",
+		IfName:         "eth1",
+		Data:           make(map[string]interface{}),
+		MacAddress:     net.HardwareAddr("00:00:5e:00:53:01"),
+		NICType:        cns.NodeNetworkInterfaceFrontendNIC,
+		AllowedVlanIDs: []int{100, 200},
+	}
+
+	hcnEndpoint, err := nw.configureHcnEndpoint(epInfo)
+	require.NoError(t, err)
+
+	var trunkPolicies []hcn.EndpointPolicy
+	for _, endpointPolicy := range hcnEndpoint.Policies {
+		if endpointPolicy.Type == policy.VlanTrunk {
+			trunkPolicies = append(trunkPolicies, endpointPolicy)
+		}
+	}
+	require.Len(t, trunkPolicies, 1)
+	require.JSONEq(t, `{"AllowedVlanIds":[100,200]}`, string(trunkPolicies[0].Settings))
+
+	// hnsv1 endpoints cannot be trunks
+	_, err = nw.newEndpointImplHnsV1(context.Background(), epInfo, &undo.Stack{})
+	require.ErrorIs(t, err, errVlanTrunkNotSupported)
+}
+
+func TestNewEndpointImplEthtoolSettings(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:      "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID:     "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:       "fakeNameSpace",
+		IfName:          "eth1",
+		NICType:         cns.NodeNetworkInterfaceFrontendNIC,
+		EthtoolSettings: &EthtoolSettings{RxRing: 4096},
+	}
+
+	_, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), nil, nil, nil, nil, nil, epInfo)
+	require.ErrorIs(t, err, errEthtoolNotSupported)
+}
+
+func TestNewEndpointImplDSCP(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:  "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID: "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:   "fakeNameSpace",
+		IfName:      "eth0",
+		NICType:     cns.InfraNIC,
+		DSCP:        46,
+	}
+
+	_, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), nil, nil, nil, nil, nil, epInfo)
+	require.ErrorIs(t, err, errDSCPNotSupported)
+}
+
+func TestNewEndpointImplFlowLogs(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:  "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID: "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:   "fakeNameSpace",
+		IfName:      "eth0",
+		NICType:     cns.InfraNIC,
+		FlowLogs:    true,
+	}
+
+	_, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), nil, nil, nil, nil, nil, epInfo)
+	require.ErrorIs(t, err, errFlowLogsNotSupported)
+}
+
 func TestDeleteEndpointImplHnsV2ForIB(t *testing.T) {
 	nw := &network{
 		Endpoints: map[string]*endpoint{},
@@ -107,7 +201,7 @@ func TestDeleteEndpointImplHnsV2ForIB(t *testing.T) {
 	}
 
 	mockCli := NewMockEndpointClient(nil)
-	err := nw.deleteEndpointImpl(netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli,
+	err := nw.deleteEndpointImpl(context.Background(), netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli,
 		netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, &ep)
 	if err != nil {
 		t.Fatal("endpoint deletion for IB is executed")
@@ -135,7 +229,7 @@ func TestDeleteEndpointImplHnsV2WithEmptyHNSID(t *testing.T) {
 
 	// should return nil because HnsID is empty
 	mockCli := NewMockEndpointClient(nil)
-	err := nw.deleteEndpointImpl(netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli,
+	err := nw.deleteEndpointImpl(context.Background(), netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli,
 		netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, &ep)
 	if err != nil {
 		t.Fatal("endpoint deletion gets executed")
@@ -172,7 +266,7 @@ func TestNewEndpointImplHnsv2Timesout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	_, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	_, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
 
 	if err == nil {
 		t.Fatal("Failed to timeout HNS calls for creating endpoint")
@@ -199,7 +293,7 @@ func TestDeleteEndpointImplHnsv2Timeout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	endpoint, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	endpoint, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
 	if err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
@@ -214,13 +308,149 @@ func TestDeleteEndpointImplHnsv2Timeout(t *testing.T) {
 		HnsCallTimeout: 5 * time.Second,
 	}
 
-	err = nw.deleteEndpointImplHnsV2(endpoint)
+	err = nw.deleteEndpointImplHnsV2(context.Background(), endpoint)
 
 	if err == nil {
 		t.Fatal("Failed to timeout HNS calls for deleting endpoint")
 	}
 }
 
+// countingHnsv2 counts endpoint policy requests made to the fake hns.
+type countingHnsv2 struct {
+	*hnswrapper.Hnsv2wrapperFake
+	applyEndpointPolicyCalls int
+}
+
+func (c *countingHnsv2) ApplyEndpointPolicy(endpoint *hcn.HostComputeEndpoint, requestType hcn.RequestType, endpointPolicy hcn.PolicyEndpointRequest) error {
+	c.applyEndpointPolicyCalls++
+	return c.Hnsv2wrapperFake.ApplyEndpointPolicy(endpoint, requestType, endpointPolicy) //nolint:wrapcheck // test wrapper
+}
+
+func TestUpdateEndpointImplHnsV2AppliesACLsInOneRequest(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	fake := &countingHnsv2{Hnsv2wrapperFake: hnswrapper.NewHnsv2wrapperFake()}
+	Hnsv2 = fake
+
+	epInfo := &EndpointInfo{
+		EndpointID:   "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID:  "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:    "8f3e5c1a-6d2b-4f7e-9a1c-3b5d7e9f1a2c",
+		IfName:       "eth0",
+		Data:         make(map[string]interface{}),
+		MacAddress:   net.HardwareAddr("00:00:5e:00:53:01"),
+		NICType:      cns.InfraNIC,
+		HNSNetworkID: "853d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+	}
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nw.Endpoints[epInfo.EndpointID] = ep
+
+	var targetEpInfo EndpointInfo
+	for i := 0; i < 30; i++ {
+		targetEpInfo.EndpointPolicies = append(targetEpInfo.EndpointPolicies, policy.Policy{
+			Type: policy.EndpointPolicy,
+			Data: []byte(fmt.Sprintf(`{"Type":"ACL","Protocols":"6","Action":"Allow","Direction":"In","LocalPorts":"%d"}`, 8000+i)),
+		})
+	}
+
+	nm := &networkManager{}
+	updatedEp, err := nm.updateEndpointImpl(nw, epInfo, &targetEpInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updatedEp != ep {
+		t.Fatal("update should return the existing endpoint")
+	}
+
+	if fake.applyEndpointPolicyCalls != 1 {
+		t.Fatalf("expected ACLs to be applied in a single request, got %d requests", fake.applyEndpointPolicyCalls)
+	}
+
+	if acls := fake.Cache.GetAllACLs()[ep.HnsId]; len(acls) != 30 {
+		t.Fatalf("expected 30 ACLs on the endpoint, got %d", len(acls))
+	}
+}
+
+func TestConfigureHcnEndpointSecondaryIPs(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:  "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID: "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:   "fakeNameSpace",
+		IfName:      "eth0",
+		Data:        make(map[string]interface{}),
+		MacAddress:  net.HardwareAddr("00:00:5e:00:53:01"),
+		NICType:     cns.InfraNIC,
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("10.240.0.5"), Mask: net.CIDRMask(16, 32)},
+			{IP: net.ParseIP("10.240.0.6"), Mask: net.CIDRMask(16, 32)},
+			{IP: net.ParseIP("10.240.0.7"), Mask: net.CIDRMask(16, 32)},
+		},
+	}
+
+	hcnEndpoint, err := nw.configureHcnEndpoint(epInfo)
+	require.NoError(t, err)
+	require.Equal(t, []hcn.IpConfig{
+		{IpAddress: "10.240.0.5", PrefixLength: 16},
+		{IpAddress: "10.240.0.6", PrefixLength: 16},
+		{IpAddress: "10.240.0.7", PrefixLength: 16},
+	}, hcnEndpoint.IpConfigurations)
+
+	// hnsv1 endpoints take one ip per family
+	_, err = nw.newEndpointImplHnsV1(context.Background(), epInfo, &undo.Stack{})
+	require.ErrorIs(t, err, errSecondaryIPsNotSupported)
+}
+
+func TestConfigureHcnEndpointDualStackPolicies(t *testing.T) {
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:  "753d3fb6-e9b3-49e2-a109-2acc5dda61f1",
+		ContainerID: "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:   "fakeNameSpace",
+		IfName:      "eth0",
+		Data:        make(map[string]interface{}),
+		MacAddress:  net.HardwareAddr("00:00:5e:00:53:01"),
+		NICType:     cns.InfraNIC,
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("10.240.0.5"), Mask: net.CIDRMask(16, 32)},
+			{IP: net.ParseIP("fd00:10::5"), Mask: net.CIDRMask(64, 128)},
+		},
+		EndpointPolicies: []policy.Policy{
+			{
+				Type: policy.EndpointPolicy,
+				Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":["10.240.0.0/16"]}`),
+			},
+		},
+		OutboundNATExceptions: []string{"fd00:20::/64"},
+	}
+
+	hcnEndpoint, err := nw.configureHcnEndpoint(epInfo)
+	require.NoError(t, err)
+
+	var exceptions [][]string
+	for _, p := range hcnEndpoint.Policies {
+		if p.Type != hcn.OutBoundNAT {
+			continue
+		}
+		var setting hcn.OutboundNatPolicySetting
+		require.NoError(t, json.Unmarshal(p.Settings, &setting))
+		exceptions = append(exceptions, setting.Exceptions)
+	}
+	require.Equal(t, [][]string{{"10.240.0.0/16"}, {"fd00:20::/64", "fd00:10::/64"}}, exceptions)
+}
+
 func TestCreateEndpointImplHnsv1Timeout(t *testing.T) {
 	nw := &network{
 		Endpoints: map[string]*endpoint{},
@@ -248,7 +478,7 @@ func TestCreateEndpointImplHnsv1Timeout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	_, err := nw.newEndpointImplHnsV1(epInfo, nil)
+	_, err := nw.newEndpointImplHnsV1(context.Background(), epInfo, &undo.Stack{})
 
 	if err == nil {
 		t.Fatal("Failed to timeout HNS calls for creating endpoint")
@@ -275,7 +505,7 @@ func TestDeleteEndpointImplHnsv1Timeout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	endpoint, err := nw.newEndpointImplHnsV1(epInfo, nil)
+	endpoint, err := nw.newEndpointImplHnsV1(context.Background(), epInfo, &undo.Stack{})
 	if err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
@@ -290,7 +520,7 @@ func TestDeleteEndpointImplHnsv1Timeout(t *testing.T) {
 		HnsCallTimeout: 5 * time.Second,
 	}
 
-	err = nw.deleteEndpointImplHnsV1(endpoint)
+	err = nw.deleteEndpointImplHnsV1(context.Background(), endpoint)
 
 	if err == nil {
 		t.Fatal("Failed to timeout HNS calls for deleting endpoint")
@@ -493,7 +723,7 @@ func TestNewEndpointImplHnsv2ForIBHappyPath(t *testing.T) {
 	}
 
 	// Happy Path
-	endpoint, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+	endpoint, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 		netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 
 	if endpoint != nil || err != nil {
@@ -523,7 +753,7 @@ func TestNewEndpointImplHnsv2ForIBUnHappyPath(t *testing.T) {
 	}
 
 	// Set UnHappy Path
-	_, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(true),
+	_, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(true),
 		netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 
 	if err == nil {
@@ -558,13 +788,13 @@ func TestCreateAndDeleteEndpointImplHnsv2ForDelegatedHappyPath(t *testing.T) {
 	}
 
 	// Happy Path to create and delete endpoint for delegated NIC
-	ep, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
 	if err != nil {
 		t.Fatalf("Failed to create endpoint for Delegated NIC due to %v", err)
 	}
 
 	mockCli := NewMockEndpointClient(nil)
-	err = nw.deleteEndpointImpl(netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli,
+	err = nw.deleteEndpointImpl(context.Background(), netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false), mockCli,
 		netio.NewMockNetIO(false, 0), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, ep)
 	if err != nil {
 		t.Fatalf("Failed to delete endpoint for Delegated NIC due to %v", err)
@@ -668,13 +898,13 @@ func TestDeleteEndpointStateForInfraDelegatedNIC(t *testing.T) {
 
 	// mock DeleteEndpointState() to make sure endpoint and network is deleted from cache
 	// network and endpoint should be deleted from cache for delegatedNIC
-	err = nm.DeleteEndpointState(networkID, delegatedEpInfo)
+	err = nm.DeleteEndpointState(context.Background(), networkID, delegatedEpInfo)
 	if err != nil {
 		t.Fatalf("Failed to delete endpoint for delegatedNIC state due to %v", err)
 	}
 
 	// endpoint should be deleted from cache for delegatedNIC and network is still there
-	err = nm.DeleteEndpointState(infraNetworkID, infraEpInfo)
+	err = nm.DeleteEndpointState(context.Background(), infraNetworkID, infraEpInfo)
 	if err != nil {
 		t.Fatalf("Failed to delete endpoint for delegatedNIC state due to %v", err)
 	}
@@ -695,3 +925,173 @@ func TestDeleteEndpointStateForInfraDelegatedNIC(t *testing.T) {
 		t.Fatal("Network for InfraNIC does not exist")
 	}
 }
+
+func TestDeleteEndpointStateForDelegatedNICWithoutNetwork(t *testing.T) {
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{},
+	}
+
+	hnsFake := hnswrapper.NewHnsv2wrapperFake()
+	Hnsv2 = hnswrapper.Hnsv2wrapperwithtimeout{
+		Hnsv2:          hnsFake,
+		HnsCallTimeout: 5 * time.Second,
+	}
+
+	// the nic and its network are gone, a stateless DEL still has the endpoint in CNS
+	delegatedEpInfo := &EndpointInfo{
+		EndpointID:    "delegatedEndpoint",
+		Data:          make(map[string]interface{}),
+		IfName:        "eth1",
+		NICType:       cns.NodeNetworkInterfaceFrontendNIC,
+		MacAddress:    net.HardwareAddr(macAddress),
+		HNSEndpointID: "delegatedEndpoint",
+		HNSNetworkID:  networkID,
+	}
+
+	err := nm.DeleteEndpointState(context.Background(), networkID, delegatedEpInfo)
+	require.NoError(t, err)
+}
+
+func TestAddIPv6NeighborEntryForGateway(t *testing.T) {
+	fake := netroute.NewMockNetRoute(false, 0)
+	NetRoute = fake
+	defer func() { NetRoute = &netroute.NetRoute{} }()
+
+	nw := &network{
+		Subnets: []SubnetInfo{
+			{Gateway: net.ParseIP("10.240.0.1")},
+			{Gateway: net.ParseIP("fd00:abcd::1")},
+		},
+	}
+	epInfo := &EndpointInfo{
+		EndpointID: "753d3fb6-eth0",
+		IPV6Mode:   IPV6Nat,
+	}
+
+	require.NoError(t, nw.addIPv6NeighborEntryForGateway(epInfo))
+
+	mac, _ := net.ParseMAC(defaultGwMac)
+	neighbors, err := fake.GetNeighbors("vEthernet (753d3fb6-eth0)")
+	require.NoError(t, err)
+	require.Equal(t, []netroute.Neighbor{
+		{
+			Interface:    "vEthernet (753d3fb6-eth0)",
+			Address:      netip.MustParseAddr("fd00:abcd::1"),
+			HardwareAddr: mac,
+		},
+	}, neighbors)
+
+	// adding the entry again fails like New-NetNeighbor does
+	require.ErrorIs(t, nw.addIPv6NeighborEntryForGateway(epInfo), netroute.ErrNeighborExists)
+}
+
+func TestGetInfoImplCollectsEndpointStats(t *testing.T) {
+	Hnsv1 = hnswrapper.NewHnsv1wrapperFake()
+	defer func() { Hnsv1 = hnswrapper.Hnsv1wrapper{} }()
+
+	ep := &endpoint{Id: "753d3fb6-eth0", HnsId: "753d3fb6-hns"}
+
+	info := ep.getInfo(nil)
+	require.Equal(t, "753d3fb6-hns", info.Data["hnsid"])
+	require.NotContains(t, info.Data, RxBytesKey)
+
+	info = ep.getInfo(netio.NewMockNetIO(false, 0))
+	for _, key := range []string{RxBytesKey, TxBytesKey, RxPacketsKey, TxPacketsKey, RxDroppedKey, TxDroppedKey} {
+		require.Contains(t, info.Data, key)
+	}
+}
+
+func TestHostProtectionRules(t *testing.T) {
+	ep := &endpoint{
+		Id:                 "ep1",
+		NICType:            cns.InfraNIC,
+		IPAddresses:        []net.IPNet{{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)}},
+		HostProtectedPorts: []string{"tcp/5985", "TCP/10250", "udp/3389"},
+	}
+
+	var cmds []string
+	plc := platform.NewMockExecClient(false)
+	plc.SetExecCommand(func(cmd string, args ...string) (string, error) {
+		cmds = append(cmds, cmd+" "+strings.Join(args, " "))
+		return "", nil
+	})
+
+	err := addHostProtectionRules(plc, ep)
+	require.NoError(t, err)
+	require.Contains(t, cmds, "netsh advfirewall firewall add rule name=azure-cni-host-protection-10.0.0.4-tcp dir=in "+
+		"action=block protocol=tcp localport=10250,5985 remoteip=10.0.0.4")
+	require.Contains(t, cmds, "netsh advfirewall firewall add rule name=azure-cni-host-protection-10.0.0.4-udp dir=in "+
+		"action=block protocol=udp localport=3389 remoteip=10.0.0.4")
+	// the rules of an earlier endpoint with the same ip are replaced
+	require.Len(t, cmds, 4)
+
+	cmds = nil
+	deleteHostProtectionRules(plc, ep)
+	require.ElementsMatch(t, []string{
+		"netsh advfirewall firewall delete rule name=azure-cni-host-protection-10.0.0.4-tcp",
+		"netsh advfirewall firewall delete rule name=azure-cni-host-protection-10.0.0.4-udp",
+	}, cmds)
+
+	// only the pod ips of the infra nic are protected against
+	cmds = nil
+	delegated := *ep
+	delegated.NICType = cns.NodeNetworkInterfaceFrontendNIC
+	require.NoError(t, addHostProtectionRules(plc, &delegated))
+	require.Empty(t, cmds)
+
+	ep.HostProtectedPorts = []string{"sctp/22"}
+	require.ErrorIs(t, addHostProtectionRules(plc, ep), errInvalidHostProtectedPort)
+}
+
+// dockerHnsv2 is the hns of a node running docker containers, whose netns are no hcn namespaces.
+type dockerHnsv2 struct {
+	*hnswrapper.Hnsv2wrapperFake
+}
+
+func (dockerHnsv2) GetNamespaceByID(netNs string) (*hcn.HostComputeNamespace, error) {
+	return nil, hcn.NamespaceNotFoundError{NamespaceID: netNs}
+}
+
+func TestNewAndDeleteEndpointImplHnsV2DockerContainer(t *testing.T) {
+	Hnsv1 = hnswrapper.NewHnsv1wrapperFake()
+	Hnsv2 = dockerHnsv2{hnswrapper.NewHnsv2wrapperFake()}
+	defer func() {
+		Hnsv1 = hnswrapper.Hnsv1wrapper{}
+		Hnsv2 = hnswrapper.Hnsv2wrapper{}
+	}()
+
+	nw := &network{
+		Endpoints: map[string]*endpoint{},
+	}
+	epInfo := &EndpointInfo{
+		EndpointID:  "753d3fb6-eth0",
+		ContainerID: "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:   "545055c2",
+		IfName:      "eth0",
+		Data:        make(map[string]interface{}),
+		MacAddress:  net.HardwareAddr("00:00:5e:00:53:01"),
+		NICType:     cns.InfraNIC,
+	}
+
+	// the endpoint of a docker container is created with hcn and attached to the container
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
+	require.NoError(t, err)
+	require.NotEmpty(t, ep.HnsId)
+
+	hcnEndpoint, err := Hnsv2.GetEndpointByID(ep.HnsId)
+	require.NoError(t, err)
+	require.Empty(t, hcnEndpoint.HostComputeNamespace)
+
+	require.NoError(t, nw.deleteEndpointImplHnsV2(context.Background(), ep))
+
+	// a pod namespace which can't be found fails the creation, the hcn endpoint created is deleted by the rollback
+	epInfo.NetNsPath = "bc526fae-4ba0-4e80-bc90-ad721e5850bf"
+	var rollback undo.Stack
+	_, err = nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &rollback)
+	require.Error(t, err)
+	require.NoError(t, rollback.Rollback())
+
+	endpoints, err := Hnsv2.ListEndpointsQuery(hcn.HostComputeQuery{})
+	require.NoError(t, err)
+	require.Empty(t, endpoints)
+}
@@ -0,0 +1,42 @@
+package network
+
+import "fmt"
+
+// EthtoolSettings are the ring sizes and channel counts of a nic. Zero values are left as the driver set them.
+type EthtoolSettings struct {
+	RxRing           uint32 `json:",omitempty"`
+	TxRing           uint32 `json:",omitempty"`
+	RxChannels       uint32 `json:",omitempty"`
+	TxChannels       uint32 `json:",omitempty"`
+	CombinedChannels uint32 `json:",omitempty"`
+}
+
+func (s *EthtoolSettings) hasRings() bool {
+	return s.RxRing != 0 || s.TxRing != 0
+}
+
+func (s *EthtoolSettings) hasChannels() bool {
+	return s.RxChannels != 0 || s.TxChannels != 0 || s.CombinedChannels != 0
+}
+
+// drift returns the settings which differ from the current ones of the nic, as "<setting> <current>, want <value>".
+func (s *EthtoolSettings) drift(current EthtoolSettings) []string {
+	var drifted []string
+	check := func(name string, want, got uint32) {
+		if want != 0 && want != got {
+			drifted = append(drifted, fmt.Sprintf("%s %d, want %d", name, got, want))
+		}
+	}
+	check("rx ring", s.RxRing, current.RxRing)
+	check("tx ring", s.TxRing, current.TxRing)
+	check("rx channels", s.RxChannels, current.RxChannels)
+	check("tx channels", s.TxChannels, current.TxChannels)
+	check("combined channels", s.CombinedChannels, current.CombinedChannels)
+	return drifted
+}
+
+// ethtoolClient gets and sets the ethtool settings of the nics of the network namespace of the calling thread.
+type ethtoolClient interface {
+	GetSettings(ifName string) (EthtoolSettings, error)
+	SetSettings(ifName string, settings *EthtoolSettings) error
+}
@@ -0,0 +1,231 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// genlEthtoolClient talks to the ethtool generic netlink family of the kernel. The family is per network namespace,
+// so the socket is opened on each call, in the namespace of the calling thread.
+type genlEthtoolClient struct{}
+
+func newEthtoolClient() ethtoolClient {
+	return genlEthtoolClient{}
+}
+
+func (genlEthtoolClient) GetSettings(ifName string) (EthtoolSettings, error) {
+	var settings EthtoolSettings
+	err := withEthtoolFamily(func(c *genetlink.Conn, family uint16) error {
+		rings, err := ethtoolGet(c, family, unix.ETHTOOL_MSG_RINGS_GET, unix.ETHTOOL_A_RINGS_HEADER, ifName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get rings of %s", ifName)
+		}
+		for rings.Next() {
+			switch rings.Type() {
+			case unix.ETHTOOL_A_RINGS_RX:
+				settings.RxRing = rings.Uint32()
+			case unix.ETHTOOL_A_RINGS_TX:
+				settings.TxRing = rings.Uint32()
+			}
+		}
+		if err := rings.Err(); err != nil {
+			return errors.Wrapf(err, "failed to decode rings of %s", ifName)
+		}
+
+		channels, err := ethtoolGet(c, family, unix.ETHTOOL_MSG_CHANNELS_GET, unix.ETHTOOL_A_CHANNELS_HEADER, ifName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get channels of %s", ifName)
+		}
+		for channels.Next() {
+			switch channels.Type() {
+			case unix.ETHTOOL_A_CHANNELS_RX_COUNT:
+				settings.RxChannels = channels.Uint32()
+			case unix.ETHTOOL_A_CHANNELS_TX_COUNT:
+				settings.TxChannels = channels.Uint32()
+			case unix.ETHTOOL_A_CHANNELS_COMBINED_COUNT:
+				settings.CombinedChannels = channels.Uint32()
+			}
+		}
+		return errors.Wrapf(channels.Err(), "failed to decode channels of %s", ifName)
+	})
+	return settings, err
+}
+
+// SetSettings sets the channels before the rings, as some drivers size the rings by the number of queues.
+func (genlEthtoolClient) SetSettings(ifName string, settings *EthtoolSettings) error {
+	return withEthtoolFamily(func(c *genetlink.Conn, family uint16) error {
+		if settings.hasChannels() {
+			err := ethtoolSet(c, family, unix.ETHTOOL_MSG_CHANNELS_SET, unix.ETHTOOL_A_CHANNELS_HEADER, ifName,
+				func(ae *netlink.AttributeEncoder) {
+					putNonZero(ae, unix.ETHTOOL_A_CHANNELS_RX_COUNT, settings.RxChannels)
+					putNonZero(ae, unix.ETHTOOL_A_CHANNELS_TX_COUNT, settings.TxChannels)
+					putNonZero(ae, unix.ETHTOOL_A_CHANNELS_COMBINED_COUNT, settings.CombinedChannels)
+				})
+			if err != nil {
+				return errors.Wrapf(err, "failed to set channels of %s", ifName)
+			}
+		}
+		if settings.hasRings() {
+			err := ethtoolSet(c, family, unix.ETHTOOL_MSG_RINGS_SET, unix.ETHTOOL_A_RINGS_HEADER, ifName,
+				func(ae *netlink.AttributeEncoder) {
+					putNonZero(ae, unix.ETHTOOL_A_RINGS_RX, settings.RxRing)
+					putNonZero(ae, unix.ETHTOOL_A_RINGS_TX, settings.TxRing)
+				})
+			if err != nil {
+				return errors.Wrapf(err, "failed to set rings of %s", ifName)
+			}
+		}
+		return nil
+	})
+}
+
+func withEthtoolFamily(f func(c *genetlink.Conn, family uint16) error) error {
+	c, err := genetlink.Dial(nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to dial generic netlink")
+	}
+	defer c.Close()
+
+	family, err := c.GetFamily(unix.ETHTOOL_GENL_NAME)
+	if err != nil {
+		return errors.Wrapf(errEthtoolNotSupported, "failed to get ethtool netlink family: %v", err)
+	}
+	return f(c, family.ID)
+}
+
+func encodeHeader(ae *netlink.AttributeEncoder, header uint16, ifName string) {
+	ae.Nested(header, func(nae *netlink.AttributeEncoder) error {
+		nae.String(unix.ETHTOOL_A_HEADER_DEV_NAME, ifName)
+		return nil
+	})
+}
+
+func putNonZero(ae *netlink.AttributeEncoder, typ uint16, v uint32) {
+	if v != 0 {
+		ae.Uint32(typ, v)
+	}
+}
+
+func ethtoolGet(c *genetlink.Conn, family uint16, cmd uint8, header uint16, ifName string) (*netlink.AttributeDecoder, error) {
+	ae := netlink.NewAttributeEncoder()
+	encodeHeader(ae, header, ifName)
+	data, err := ae.Encode()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode request")
+	}
+
+	msgs, err := c.Execute(genetlink.Message{
+		Header: genetlink.Header{Command: cmd, Version: unix.ETHTOOL_GENL_VERSION},
+		Data:   data,
+	}, family, netlink.Request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to execute request")
+	}
+	if len(msgs) != 1 {
+		return nil, errors.Errorf("expected 1 reply, got %d", len(msgs))
+	}
+	ad, err := netlink.NewAttributeDecoder(msgs[0].Data)
+	return ad, errors.Wrap(err, "failed to decode reply")
+}
+
+func ethtoolSet(c *genetlink.Conn, family uint16, cmd uint8, header uint16, ifName string, encode func(ae *netlink.AttributeEncoder)) error {
+	ae := netlink.NewAttributeEncoder()
+	encodeHeader(ae, header, ifName)
+	encode(ae)
+	data, err := ae.Encode()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode request")
+	}
+
+	_, err = c.Execute(genetlink.Message{
+		Header: genetlink.Header{Command: cmd, Version: unix.ETHTOOL_GENL_VERSION},
+		Data:   data,
+	}, family, netlink.Request|netlink.Acknowledge)
+	return errors.Wrap(err, "failed to execute request")
+}
+
+// CheckEthtoolSettings compares the ethtool settings of the delegated nics of the container with the ones they were
+// created with, and applies them again to the nics which drifted, e.g. after a driver reset. It returns the settings
+// which could not be applied again.
+func (nm *networkManager) CheckEthtoolSettings(containerID string) ([]string, error) {
+	return nm.checkEthtoolSettings(containerID, newEthtoolClient())
+}
+
+func (nm *networkManager) checkEthtoolSettings(containerID string, ethtool ethtoolClient) ([]string, error) {
+	nm.Lock()
+	var eps []*endpoint
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			for _, ep := range nw.getEndpointsByContainerID(containerID) {
+				if ep.EthtoolSettings != nil {
+					eps = append(eps, ep)
+				}
+			}
+		}
+	}
+	nm.Unlock()
+	sort.Slice(eps, func(i, j int) bool { return eps[i].Id < eps[j].Id })
+
+	var failures []string
+	for _, ep := range eps {
+		epFailures, err := nm.checkEndpointEthtoolSettings(ep, ethtool)
+		if err != nil {
+			return failures, errors.Wrapf(err, "failed to check ethtool settings of endpoint %s", ep.Id)
+		}
+		for _, failure := range epFailures {
+			failures = append(failures, fmt.Sprintf("endpoint %s: %s", ep.Id, failure))
+		}
+	}
+	return failures, nil
+}
+
+// checkEndpointEthtoolSettings checks the nics of the endpoint from its network namespace, where the vfs were moved.
+func (nm *networkManager) checkEndpointEthtoolSettings(ep *endpoint, ethtool ethtoolClient) ([]string, error) {
+	ns, err := nm.nsClient.OpenNamespace(ep.NetworkNameSpace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open netns")
+	}
+	defer ns.Close()
+
+	if err := ns.Enter(); err != nil {
+		return nil, errors.Wrap(err, "failed to enter netns")
+	}
+	defer func() {
+		if err := ns.Exit(); err != nil {
+			logger.Error("Failed to exit netns", zap.String("netns", ep.NetworkNameSpace), zap.Error(err))
+		}
+	}()
+
+	ifNames := make([]string, 0, len(ep.SecondaryInterfaces))
+	for ifName := range ep.SecondaryInterfaces {
+		ifNames = append(ifNames, ifName)
+	}
+	sort.Strings(ifNames)
+
+	var failures []string
+	for _, ifName := range ifNames {
+		current, err := ethtool.GetSettings(ifName)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("failed to get ethtool settings of %s: %v", ifName, err))
+			continue
+		}
+		drifted := ep.EthtoolSettings.drift(current)
+		if len(drifted) == 0 {
+			continue
+		}
+
+		logger.Info("Applying again the ethtool settings of nic", zap.String("endpointID", ep.Id), zap.String("ifName", ifName),
+			zap.Strings("drifted", drifted))
+		if err := ethtool.SetSettings(ifName, ep.EthtoolSettings); err != nil {
+			failures = append(failures, fmt.Sprintf("%s has %s and failed to be set again: %v", ifName, strings.Join(drifted, ", "), err))
+		}
+	}
+	return failures, nil
+}
@@ -0,0 +1,118 @@
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errFakeEthtool = errors.New("fake ethtool error")
+
+// fakeEthtool is an ethtool whose nics have the settings in settings, which fails to set the nics in failSet.
+type fakeEthtool struct {
+	settings map[string]EthtoolSettings
+	failSet  map[string]bool
+	set      []string
+}
+
+func (f *fakeEthtool) GetSettings(ifName string) (EthtoolSettings, error) {
+	settings, ok := f.settings[ifName]
+	if !ok {
+		return EthtoolSettings{}, errFakeEthtool
+	}
+	return settings, nil
+}
+
+func (f *fakeEthtool) SetSettings(ifName string, settings *EthtoolSettings) error {
+	f.set = append(f.set, ifName)
+	if f.failSet[ifName] {
+		return errFakeEthtool
+	}
+	current := f.settings[ifName]
+	if settings.RxRing != 0 {
+		current.RxRing = settings.RxRing
+	}
+	if settings.TxRing != 0 {
+		current.TxRing = settings.TxRing
+	}
+	if settings.CombinedChannels != 0 {
+		current.CombinedChannels = settings.CombinedChannels
+	}
+	f.settings[ifName] = current
+	return nil
+}
+
+func TestSecondaryMoveEndpointsAppliesEthtoolSettings(t *testing.T) {
+	ethtool := &fakeEthtool{settings: map[string]EthtoolSettings{"eth1": {RxRing: 1024, TxRing: 1024}}}
+	client := &SecondaryEndpointClient{netlink: netlink.NewMockNetlink(false, ""), ethtool: ethtool}
+
+	settings := &EthtoolSettings{RxRing: 4096, TxRing: 4096, CombinedChannels: 16}
+	require.NoError(t, client.MoveEndpointsToContainerNS(&EndpointInfo{IfName: "eth1", EthtoolSettings: settings}, 1))
+	assert.Equal(t, *settings, ethtool.settings["eth1"])
+
+	// endpoints without settings are left alone
+	require.NoError(t, client.MoveEndpointsToContainerNS(&EndpointInfo{IfName: "eth2"}, 1))
+	assert.Equal(t, []string{"eth1"}, ethtool.set)
+
+	// the vf is not moved to the pod when it can't be sized
+	ethtool.failSet = map[string]bool{"eth1": true}
+	client.netlink = netlink.NewMockNetlink(true, "")
+	err := client.MoveEndpointsToContainerNS(&EndpointInfo{IfName: "eth1", EthtoolSettings: settings}, 1)
+	require.ErrorIs(t, err, errFakeEthtool)
+}
+
+func TestCheckEthtoolSettings(t *testing.T) {
+	settings := &EthtoolSettings{RxRing: 4096, CombinedChannels: 16}
+	nw := &network{
+		Id: "nw",
+		Endpoints: map[string]*endpoint{
+			"ep1-eth1": {
+				Id: "ep1-eth1", ContainerID: "ep1", NetworkNameSpace: "/var/run/netns/ep1", EthtoolSettings: settings,
+				SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}},
+			},
+			"ep1-eth2": {
+				Id: "ep1-eth2", ContainerID: "ep1", NetworkNameSpace: "/var/run/netns/ep1", EthtoolSettings: settings,
+				SecondaryInterfaces: map[string]*InterfaceInfo{"eth2": {Name: "eth2"}},
+			},
+			"ep2-eth1": {
+				Id: "ep2-eth1", ContainerID: "ep2", NetworkNameSpace: "/var/run/netns/ep2", EthtoolSettings: settings,
+				SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}},
+			},
+		},
+	}
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{"eth0": {Networks: map[string]*network{nw.Id: nw}}},
+		nsClient:           NewMockNamespaceClient(),
+	}
+
+	// eth1 was reset by its driver, eth2 kept its settings
+	ethtool := &fakeEthtool{settings: map[string]EthtoolSettings{
+		"eth1": {RxRing: 1024, CombinedChannels: 16},
+		"eth2": {RxRing: 4096, TxRing: 1024, CombinedChannels: 16},
+	}}
+	failures, err := nm.checkEthtoolSettings("ep1", ethtool)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+	assert.Equal(t, []string{"eth1"}, ethtool.set)
+	assert.Equal(t, uint32(4096), ethtool.settings["eth1"].RxRing)
+
+	ethtool.settings["eth1"] = EthtoolSettings{RxRing: 1024, CombinedChannels: 8}
+	ethtool.failSet = map[string]bool{"eth1": true}
+	failures, err = nm.checkEthtoolSettings("ep1", ethtool)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"endpoint ep1-eth1: eth1 has rx ring 1024, want 4096, combined channels 8, want 16 and failed to be set again: " + errFakeEthtool.Error(),
+	}, failures)
+
+	// the netns of the endpoint is gone
+	nw.Endpoints["ep1-eth1"].NetworkNameSpace = ""
+	_, err = nm.checkEthtoolSettings("ep1", ethtool)
+	require.Error(t, err)
+
+	failures, err = nm.checkEthtoolSettings("unknown", ethtool)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
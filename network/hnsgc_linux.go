@@ -0,0 +1,11 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CollectStaleHnsPolicies is a no-op on linux, which has no HNS.
+func CollectStaleHnsPolicies(context.Context, *zap.Logger, time.Duration) {}
@@ -0,0 +1,136 @@
+package network
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// hcnEndpointOwnerTag is appended to the name of the hcn endpoints created by this plugin. HNS objects have no labels,
+// so the name is how the stale policy collector tells them apart from the endpoints of other owners on shared networks.
+const hcnEndpointOwnerTag = "_azcni"
+
+// StaleHnsPolicyCollector garbage collects the policies of the hcn endpoints this plugin created whose pod sandbox is
+// gone. HNS keeps the ACL, NAT and route policies on the endpoints, so the orphaned endpoints are deleted with them.
+type StaleHnsPolicyCollector struct {
+	hns    hnswrapper.HnsV2WrapperInterface
+	logger *zap.Logger
+	// suspects are the endpoints found orphaned by the last pass. An endpoint is only deleted once two passes in a row
+	// found it orphaned, so that the endpoints an ADD just created and did not add to their namespace yet are spared.
+	suspects map[string]struct{}
+}
+
+// HnsPolicyCollection is the result of a collection pass.
+type HnsPolicyCollection struct {
+	// Endpoints is the number of orphaned endpoints deleted.
+	Endpoints int
+	// Policies is the number of policies removed with them, by policy type.
+	Policies map[hcn.EndpointPolicyType]int
+}
+
+// NewStaleHnsPolicyCollector creates a collector of the stale policies on the hcn endpoints of the node, which logs
+// to z since it runs in the long lived callers rather than in the cni.
+func NewStaleHnsPolicyCollector(z *zap.Logger) *StaleHnsPolicyCollector {
+	return &StaleHnsPolicyCollector{
+		hns:      Hnsv2,
+		logger:   z,
+		suspects: map[string]struct{}{},
+	}
+}
+
+// CollectStaleHnsPolicies collects the stale policies on the hcn endpoints of the node every interval until ctx is done.
+func CollectStaleHnsPolicies(ctx context.Context, z *zap.Logger, interval time.Duration) {
+	NewStaleHnsPolicyCollector(z).Run(ctx, interval)
+}
+
+// Run collects the stale policies every interval until ctx is done.
+func (c *StaleHnsPolicyCollector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		collection, err := c.Collect()
+		if err != nil {
+			c.logger.Error("Failed to collect stale hns policies", zap.Error(err))
+		}
+		if collection.Endpoints > 0 {
+			c.logger.Info("Collected stale hns policies", zap.Int("endpoints", collection.Endpoints), zap.Any("policies", collection.Policies))
+		}
+	}
+}
+
+// Collect runs a collection pass. It goes on past the endpoints it fails to delete, and returns the last error.
+func (c *StaleHnsPolicyCollector) Collect() (HnsPolicyCollection, error) {
+	collection := HnsPolicyCollection{Policies: map[hcn.EndpointPolicyType]int{}}
+	endpoints, err := c.hns.ListEndpointsQuery(hcn.HostComputeQuery{
+		SchemaVersion: hcn.V2SchemaVersion(),
+		Flags:         hcn.HostComputeQueryFlagsNone,
+	})
+	if err != nil {
+		return collection, errors.Wrap(err, "failed to list hcn endpoints")
+	}
+
+	var lastErr error
+	suspects := map[string]struct{}{}
+	for i := range endpoints {
+		hcnEndpoint := &endpoints[i]
+		if !strings.HasSuffix(hcnEndpoint.Name, hcnEndpointOwnerTag) {
+			continue
+		}
+
+		orphaned, err := c.isOrphaned(hcnEndpoint)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !orphaned {
+			continue
+		}
+		if _, ok := c.suspects[hcnEndpoint.Id]; !ok {
+			suspects[hcnEndpoint.Id] = struct{}{}
+			continue
+		}
+
+		c.logger.Info("Deleting orphaned hcn endpoint", zap.String("id", hcnEndpoint.Id), zap.String("name", hcnEndpoint.Name),
+			zap.String("network", hcnEndpoint.HostComputeNetwork), zap.Int("policies", len(hcnEndpoint.Policies)))
+		if err := c.hns.DeleteEndpoint(hcnEndpoint); err != nil {
+			// try again on the next pass
+			suspects[hcnEndpoint.Id] = struct{}{}
+			lastErr = errors.Wrapf(err, "failed to delete orphaned hcn endpoint %s", hcnEndpoint.Id)
+			continue
+		}
+		collection.Endpoints++
+		for _, p := range hcnEndpoint.Policies {
+			collection.Policies[p.Type]++
+		}
+	}
+	c.suspects = suspects
+
+	return collection, lastErr
+}
+
+// isOrphaned returns whether the pod sandbox of the hcn endpoint is gone, which is when the endpoint is in no
+// namespace or its namespace no longer exists.
+func (c *StaleHnsPolicyCollector) isOrphaned(hcnEndpoint *hcn.HostComputeEndpoint) (bool, error) {
+	if hcnEndpoint.HostComputeNamespace == "" {
+		return true, nil
+	}
+
+	if _, err := c.hns.GetNamespaceByID(hcnEndpoint.HostComputeNamespace); err != nil {
+		if hcn.IsNotFoundError(err) {
+			return true, nil
+		}
+		return false, errors.Wrapf(err, "failed to get hcn namespace %s of endpoint %s", hcnEndpoint.HostComputeNamespace, hcnEndpoint.Id)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,81 @@
+//go:build windows
+// +build windows
+
+package network
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// namespacesFake is a fake HNS in which only the listed namespaces exist.
+type namespacesFake struct {
+	*hnswrapper.Hnsv2wrapperFake
+	namespaces map[string]bool
+}
+
+func (f namespacesFake) GetNamespaceByID(id string) (*hcn.HostComputeNamespace, error) {
+	if !f.namespaces[id] {
+		return nil, hcn.NamespaceNotFoundError{NamespaceID: id}
+	}
+	return &hcn.HostComputeNamespace{Id: id}, nil
+}
+
+func TestStaleHnsPolicyCollector(t *testing.T) {
+	hns := namespacesFake{Hnsv2wrapperFake: hnswrapper.NewHnsv2wrapperFake(), namespaces: map[string]bool{"live-ns": true}}
+	for _, ep := range []*hcn.HostComputeEndpoint{
+		{Id: "live", Name: "aaaaaaaa-eth0" + hcnEndpointOwnerTag, HostComputeNamespace: "live-ns"},
+		{Id: "deleted-ns", Name: "bbbbbbbb-eth0" + hcnEndpointOwnerTag, HostComputeNamespace: "gone-ns"},
+		{Id: "no-ns", Name: "cccccccc-eth0" + hcnEndpointOwnerTag},
+		// the endpoints of other owners are left alone even without a namespace
+		{Id: "foreign", Name: "dddddddd-eth0"},
+	} {
+		_, err := hns.CreateEndpoint(ep)
+		require.NoError(t, err)
+	}
+	c := &StaleHnsPolicyCollector{hns: hns, logger: zap.NewNop(), suspects: map[string]struct{}{}}
+
+	// the first pass only marks the orphaned endpoints as suspects
+	collection, err := c.Collect()
+	require.NoError(t, err)
+	assert.Zero(t, collection.Endpoints)
+	assert.Len(t, c.suspects, 2)
+
+	collection, err = c.Collect()
+	require.NoError(t, err)
+	assert.Equal(t, 2, collection.Endpoints)
+	assert.Empty(t, c.suspects)
+
+	for _, id := range []string{"live", "foreign"} {
+		_, err := hns.GetEndpointByID(id)
+		require.NoError(t, err, id)
+	}
+	for _, id := range []string{"deleted-ns", "no-ns"} {
+		_, err := hns.GetEndpointByID(id)
+		assert.True(t, hcn.IsNotFoundError(err), id)
+	}
+}
+
+func TestStaleHnsPolicyCollectorSparesEndpointsAddedToNamespace(t *testing.T) {
+	hns := namespacesFake{Hnsv2wrapperFake: hnswrapper.NewHnsv2wrapperFake(), namespaces: map[string]bool{}}
+	_, err := hns.CreateEndpoint(&hcn.HostComputeEndpoint{Id: "adding", Name: "aaaaaaaa-eth0" + hcnEndpointOwnerTag})
+	require.NoError(t, err)
+	c := &StaleHnsPolicyCollector{hns: hns, logger: zap.NewNop(), suspects: map[string]struct{}{}}
+
+	_, err = c.Collect()
+	require.NoError(t, err)
+
+	// the ADD adds the endpoint to its namespace before the next pass
+	hns.namespaces["ns"] = true
+	require.NoError(t, hns.AddNamespaceEndpoint("ns", "adding"))
+
+	collection, err := c.Collect()
+	require.NoError(t, err)
+	assert.Zero(t, collection.Endpoints)
+	assert.Empty(t, c.suspects)
+}
@@ -0,0 +1,16 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WatchHnsEndpoints is a no-op on linux, which has no HNS.
+func WatchHnsEndpoints(context.Context, *zap.Logger, time.Duration, func() error) {}
+
+// ReattachHnsEndpoints is a no-op on linux, which has no HNS.
+func (*networkManager) ReattachHnsEndpoints() error {
+	return nil
+}
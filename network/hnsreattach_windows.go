@@ -0,0 +1,181 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// hnsEndpointWatcher tells when hns lost hcn endpoints of the plugin, which it does across a restart of its service.
+type hnsEndpointWatcher struct {
+	hns hnswrapper.HnsV2WrapperInterface
+	// seen are the hcn endpoints of the plugin found by the last pass, nil before the first pass
+	seen map[string]struct{}
+}
+
+// WatchHnsEndpoints calls reattach, which has the cni create again the hcn endpoints hns lost, when hcn endpoints of
+// the plugin found by the previous check are gone, checking every interval until ctx is done. The check only lists the
+// hcn endpoints, so the cni and its lock are only involved when endpoints went away, which a DEL also causes. The first
+// check always calls reattach, for the endpoints lost while nothing watched.
+func WatchHnsEndpoints(ctx context.Context, z *zap.Logger, interval time.Duration, reattach func() error) {
+	w := &hnsEndpointWatcher{hns: Hnsv2}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		lost, err := w.lost()
+		if err != nil {
+			z.Error("Failed to list hcn endpoints", zap.Error(err))
+		} else if lost {
+			if err := reattach(); err != nil {
+				z.Error("Failed to reattach hcn endpoints", zap.Error(err))
+				// check again on the next pass
+				w.seen = nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lost returns whether hcn endpoints of the plugin found by the last pass are gone.
+func (w *hnsEndpointWatcher) lost() (bool, error) {
+	endpoints, err := w.hns.ListEndpointsQuery(hcn.HostComputeQuery{
+		SchemaVersion: hcn.V2SchemaVersion(),
+		Flags:         hcn.HostComputeQueryFlagsNone,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list hcn endpoints")
+	}
+
+	current := make(map[string]struct{}, len(endpoints))
+	for i := range endpoints {
+		if strings.HasSuffix(endpoints[i].Name, hcnEndpointOwnerTag) {
+			current[endpoints[i].Id] = struct{}{}
+		}
+	}
+
+	lost := w.seen == nil
+	for id := range w.seen {
+		if _, ok := current[id]; !ok {
+			lost = true
+			break
+		}
+	}
+	w.seen = current
+	return lost, nil
+}
+
+// ReattachHnsEndpoints creates again the hcn endpoints of the endpoints hns no longer has and attaches them to their pod
+// again. hns can lose the endpoints across a restart of its service, which would otherwise blackhole the pods until
+// they are recreated.
+func (nm *networkManager) ReattachHnsEndpoints() error {
+	// the endpoints of the nodes without hcn are not recorded, there is nothing to rebuild them from
+	schemaVersion, err := hcnSchemaVersion()
+	if err != nil {
+		return nil
+	}
+
+	hcnEndpoints, err := Hnsv2.ListEndpointsQuery(hcn.HostComputeQuery{
+		SchemaVersion: schemaVersion,
+		Flags:         hcn.HostComputeQueryFlagsNone,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to list hcn endpoints")
+	}
+	existing := make(map[string]bool, len(hcnEndpoints))
+	for i := range hcnEndpoints {
+		existing[hcnEndpoints[i].Id] = true
+	}
+
+	nm.Lock()
+	defer nm.Unlock()
+
+	reattached := 0
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			for _, ep := range nw.Endpoints {
+				if ep.HnsId == "" || existing[ep.HnsId] || len(ep.HnsEndpointConfig) == 0 {
+					continue
+				}
+
+				logger.Info("Reattaching hcn endpoint lost by hns", zap.String("endpointID", ep.Id), zap.String("hnsID", ep.HnsId),
+					zap.String("netns", ep.NetNs))
+				if err := nw.reattachHnsEndpoint(ep); err != nil {
+					logger.Error("Failed to reattach hcn endpoint", zap.String("endpointID", ep.Id), zap.Error(err))
+					continue
+				}
+				reattached++
+			}
+		}
+	}
+	if reattached == 0 {
+		return nil
+	}
+
+	return errors.Wrap(nm.save(), "failed to save state after reattaching hcn endpoints")
+}
+
+// reattachHnsEndpoint creates the hcn endpoint of ep again from the config it was created with, and adds it to the
+// namespace of its pod, or attaches it to its docker container. The endpoints of the pods which are gone are left to
+// their DEL.
+func (nw *network) reattachHnsEndpoint(ep *endpoint) error {
+	var namespace *hcn.HostComputeNamespace
+	if isHcnNamespaceID(ep.NetNs) {
+		var err error
+		if namespace, err = Hnsv2.GetNamespaceByID(ep.NetNs); err != nil {
+			return errors.Wrapf(err, "failed to get hcn namespace %s", ep.NetNs)
+		}
+	}
+
+	hcnEndpoint := &hcn.HostComputeEndpoint{}
+	if err := json.Unmarshal(ep.HnsEndpointConfig, hcnEndpoint); err != nil {
+		return errors.Wrap(err, "failed to unmarshal hcn endpoint config")
+	}
+	hcnEndpoint.Id = ""
+	hcnEndpoint.HostComputeNetwork = nw.HnsId
+	hcnEndpoint.HostComputeNamespace = ""
+
+	hnsResponse, err := Hnsv2.CreateEndpoint(hcnEndpoint)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create hcn endpoint %s", hcnEndpoint.Name)
+	}
+
+	if namespace != nil {
+		err = Hnsv2.AddNamespaceEndpoint(namespace.Id, hnsResponse.Id)
+		err = errors.Wrapf(err, "failed to add hcn endpoint %s to namespace %s", hnsResponse.Id, namespace.Id)
+	} else {
+		err = hotAttachEndpoint(&EndpointInfo{ContainerID: ep.ContainerID}, hnsResponse.Id)
+	}
+	if err != nil {
+		if errDelete := Hnsv2.DeleteEndpoint(hnsResponse); errDelete != nil {
+			logger.Error("Failed to delete hcn endpoint", zap.String("id", hnsResponse.Id), zap.Error(errDelete))
+		}
+		return err
+	}
+
+	logger.Info("Reattached hcn endpoint", zap.String("endpointID", ep.Id), zap.String("lostHnsID", ep.HnsId),
+		zap.String("hnsID", hnsResponse.Id))
+	ep.HnsId = hnsResponse.Id
+	return nil
+}
+
+// recordHnsEndpointConfig keeps the config of the hcn endpoint of ep, so that the endpoint can be created again when
+// hns loses it.
+func (ep *endpoint) recordHnsEndpointConfig(hcnEndpoint *hcn.HostComputeEndpoint) {
+	config, err := json.Marshal(hcnEndpoint)
+	if err != nil {
+		logger.Error("Failed to marshal hcn endpoint config", zap.String("endpointID", ep.Id), zap.Error(err))
+		return
+	}
+	ep.HnsEndpointConfig = config
+}
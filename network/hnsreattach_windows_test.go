@@ -0,0 +1,94 @@
+//go:build windows
+// +build windows
+
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/internal/undo"
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReattachHnsEndpoints(t *testing.T) {
+	Hnsv2 = hnswrapper.NewHnsv2wrapperFake()
+	defer func() {
+		Hnsv2 = hnswrapper.Hnsv2wrapper{}
+	}()
+
+	nw := &network{
+		Id:        "azure",
+		HnsId:     "hns-azure",
+		Endpoints: map[string]*endpoint{},
+	}
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{
+			"eth0": {Name: "eth0", Networks: map[string]*network{nw.Id: nw}},
+		},
+	}
+
+	epInfo := &EndpointInfo{
+		EndpointID:  "753d3fb6-eth0",
+		ContainerID: "545055c2-1462-42c8-b222-e75d0b291632",
+		NetNsPath:   "bc526fae-4ba0-4e80-bc90-ad721e5850bf",
+		IfName:      "eth0",
+		Data:        make(map[string]interface{}),
+		MacAddress:  net.HardwareAddr("00:00:5e:00:53:01"),
+		NICType:     cns.InfraNIC,
+		IPAddresses: []net.IPNet{{IP: net.ParseIP("10.240.0.4"), Mask: net.CIDRMask(16, 32)}},
+	}
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo, &undo.Stack{})
+	require.NoError(t, err)
+	require.NotEmpty(t, ep.HnsEndpointConfig)
+	nw.Endpoints[ep.Id] = ep
+
+	// the endpoints of older versions have no config to rebuild them from
+	legacy := &endpoint{Id: "legacy-eth0", HnsId: "legacy-hns", NetNs: epInfo.NetNsPath}
+	nw.Endpoints[legacy.Id] = legacy
+
+	// hns loses the endpoint
+	hcnEndpoint, err := Hnsv2.GetEndpointByID(ep.HnsId)
+	require.NoError(t, err)
+	require.NoError(t, Hnsv2.DeleteEndpoint(hcnEndpoint))
+
+	require.NoError(t, nm.ReattachHnsEndpoints())
+
+	hcnEndpoint, err = Hnsv2.GetEndpointByID(ep.HnsId)
+	require.NoError(t, err)
+	require.Equal(t, nw.HnsId, hcnEndpoint.HostComputeNetwork)
+	require.NotEmpty(t, hcnEndpoint.HostComputeNamespace)
+	require.Len(t, hcnEndpoint.IpConfigurations, 1)
+	require.Equal(t, "10.240.0.4", hcnEndpoint.IpConfigurations[0].IpAddress)
+
+	_, err = Hnsv2.GetEndpointByID(legacy.HnsId)
+	require.Error(t, err)
+}
+
+func TestHnsEndpointWatcherLost(t *testing.T) {
+	hns := hnswrapper.NewHnsv2wrapperFake()
+	w := &hnsEndpointWatcher{hns: hns}
+
+	hcnEndpoint, err := hns.CreateEndpoint(&hcn.HostComputeEndpoint{Name: "753d3fb6-eth0" + hcnEndpointOwnerTag})
+	require.NoError(t, err)
+	_, err = hns.CreateEndpoint(&hcn.HostComputeEndpoint{Name: "other"})
+	require.NoError(t, err)
+
+	// the first pass reattaches the endpoints lost while nothing watched
+	lost, err := w.lost()
+	require.NoError(t, err)
+	require.True(t, lost)
+
+	lost, err = w.lost()
+	require.NoError(t, err)
+	require.False(t, lost)
+
+	require.NoError(t, hns.DeleteEndpoint(hcnEndpoint))
+	lost, err = w.lost()
+	require.NoError(t, err)
+	require.True(t, lost)
+}
@@ -0,0 +1,41 @@
+package network
+
+import (
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// hcnSchemaVersion negotiates the schema of the hcn objects with the hns of the node: the v2 schema whenever hns
+// serves the hcn api, which windows 1809 and later do, and an error on the older nodes which only serve hns v1.
+func hcnSchemaVersion() (hcn.SchemaVersion, error) {
+	if err := Hnsv2.HNSV2Supported(); err != nil {
+		return hcn.SchemaVersion{}, errors.Wrap(err, "hns does not serve the hcn api")
+	}
+	return hcn.V2SchemaVersion(), nil
+}
+
+// UseHnsV2 indicates whether to use HNSv1 or HNSv2. HNSv2 is used whenever the platform has HCN, HNSv1 remaining
+// for the platforms without it. The namespace of a pod, a GUID, can't be programmed with HNSv1, so an error is
+// returned along with true when such a platform is asked to.
+func UseHnsV2(netNs string) (bool, error) {
+	_, err := hcnSchemaVersion()
+	if err == nil {
+		return true, nil
+	}
+
+	if isHcnNamespaceID(netNs) {
+		logger.Info("HNSV2 is not supported on this windows platform", zap.Error(err))
+		return true, err
+	}
+
+	return false, nil
+}
+
+// isHcnNamespaceID returns whether netNs is the id of an hcn namespace, the netns of a docker container being the
+// container itself.
+func isHcnNamespaceID(netNs string) bool {
+	_, err := uuid.Parse(netNs)
+	return err == nil
+}
@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/stretchr/testify/require"
+)
+
+var errHcnNotSupported = errors.New("platform does not support feature V2 Api/Schema")
+
+// hnsv1OnlyFake is the hns of a node older than windows 1809, which doesn't serve the hcn api.
+type hnsv1OnlyFake struct {
+	*hnswrapper.Hnsv2wrapperFake
+}
+
+func (hnsv1OnlyFake) HNSV2Supported() error {
+	return errHcnNotSupported
+}
+
+func TestUseHnsV2(t *testing.T) {
+	defer func() { Hnsv2 = hnswrapper.Hnsv2wrapper{} }()
+
+	// hcn is used whenever the node supports it, whatever the netns
+	Hnsv2 = hnswrapper.NewHnsv2wrapperFake()
+	for _, netNs := range []string{"bc526fae-4ba0-4e80-bc90-ad721e5850bf", "test-container", ""} {
+		useHnsV2, err := UseHnsV2(netNs)
+		require.NoError(t, err)
+		require.True(t, useHnsV2, netNs)
+	}
+	schemaVersion, err := hcnSchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, hcn.V2SchemaVersion(), schemaVersion)
+
+	// docker containers fall back to hns v1 on the nodes without hcn, pod namespaces can't
+	Hnsv2 = hnsv1OnlyFake{hnswrapper.NewHnsv2wrapperFake()}
+	useHnsV2, err := UseHnsV2("test-container")
+	require.NoError(t, err)
+	require.False(t, useHnsV2)
+
+	useHnsV2, err = UseHnsV2("bc526fae-4ba0-4e80-bc90-ad721e5850bf")
+	require.ErrorIs(t, err, errHcnNotSupported)
+	require.True(t, useHnsV2)
+
+	_, err = hcnSchemaVersion()
+	require.ErrorIs(t, err, errHcnNotSupported)
+}
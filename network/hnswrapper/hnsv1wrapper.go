@@ -92,3 +92,7 @@ func (Hnsv1wrapper) IsAttached(endpoint *hcsshim.HNSEndpoint, containerID string
 func (w Hnsv1wrapper) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
 	return hcsshim.GetHNSGlobals()
 }
+
+func (Hnsv1wrapper) GetHNSEndpointStats(endpointID string) (*hcsshim.HNSEndpointStats, error) {
+	return hcsshim.GetHNSEndpointStats(endpointID)
+}
@@ -61,3 +61,8 @@ func (h Hnsv1wrapperfake) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
 	delayHnsCall(h.Delay)
 	return &hcsshim.HNSGlobals{}, nil
 }
+
+func (h Hnsv1wrapperfake) GetHNSEndpointStats(endpointID string) (*hcsshim.HNSEndpointStats, error) {
+	delayHnsCall(h.Delay)
+	return &hcsshim.HNSEndpointStats{EndpointID: endpointID}, nil
+}
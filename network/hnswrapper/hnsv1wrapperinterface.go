@@ -20,4 +20,5 @@ type HnsV1WrapperInterface interface {
 	HotAttachEndpoint(containerID string, endpointID string) error
 	IsAttached(hnsep *hcsshim.HNSEndpoint, containerID string) (bool, error)
 	GetHNSGlobals() (*hcsshim.HNSGlobals, error)
+	GetHNSEndpointStats(endpointID string) (*hcsshim.HNSEndpointStats, error)
 }
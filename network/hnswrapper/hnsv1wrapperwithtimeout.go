@@ -37,6 +37,11 @@ type HnsGlobalFuncResult struct {
 	Err        error
 }
 
+type EndpointStatsFuncResult struct {
+	endpointStats *hcsshim.HNSEndpointStats
+	Err           error
+}
+
 func (h Hnsv1wrapperwithtimeout) CreateEndpoint(endpoint *hcsshim.HNSEndpoint, path string) (*hcsshim.HNSEndpoint, error) {
 	r := make(chan EndpointFuncResult)
 	ctx, cancel := context.WithTimeout(context.TODO(), h.HnsCallTimeout)
@@ -229,3 +234,25 @@ func (h Hnsv1wrapperwithtimeout) GetHNSGlobals() (*hcsshim.HNSGlobals, error) {
 		return nil, errors.Wrapf(ErrHNSCallTimeout, "GetHNSGlobals timeout value is %v ", h.HnsCallTimeout.String())
 	}
 }
+
+func (h Hnsv1wrapperwithtimeout) GetHNSEndpointStats(endpointID string) (*hcsshim.HNSEndpointStats, error) {
+	r := make(chan EndpointStatsFuncResult)
+	ctx, cancel := context.WithTimeout(context.TODO(), h.HnsCallTimeout)
+	defer cancel()
+
+	go func() {
+		endpointStats, err := h.Hnsv1.GetHNSEndpointStats(endpointID)
+
+		r <- EndpointStatsFuncResult{
+			endpointStats: endpointStats,
+			Err:           err,
+		}
+	}()
+
+	select {
+	case res := <-r:
+		return res.endpointStats, res.Err
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ErrHNSCallTimeout, "GetHNSEndpointStats timeout value is %v ", h.HnsCallTimeout.String())
+	}
+}
@@ -206,7 +206,7 @@ func (f Hnsv2wrapperFake) GetNetworkByID(networkID string) (*hcn.HostComputeNetw
 			return network.GetHCNObj(), nil
 		}
 	}
-	return &hcn.HostComputeNetwork{}, nil
+	return &hcn.HostComputeNetwork{}, hcn.NetworkNotFoundError{NetworkID: networkID}
 }
 
 func (f Hnsv2wrapperFake) GetEndpointByID(endpointID string) (*hcn.HostComputeEndpoint, error) {
@@ -245,12 +245,22 @@ func (f Hnsv2wrapperFake) GetNamespaceByID(netNamespacePath string) (*hcn.HostCo
 }
 
 func (f Hnsv2wrapperFake) AddNamespaceEndpoint(namespaceId string, endpointId string) error {
+	f.Lock()
+	defer f.Unlock()
 	delayHnsCall(f.Delay)
+	if ep, ok := f.Cache.endpoints[endpointId]; ok {
+		ep.HostComputeNamespace = namespaceId
+	}
 	return nil
 }
 
 func (f Hnsv2wrapperFake) RemoveNamespaceEndpoint(namespaceId string, endpointId string) error {
+	f.Lock()
+	defer f.Unlock()
 	delayHnsCall(f.Delay)
+	if ep, ok := f.Cache.endpoints[endpointId]; ok && ep.HostComputeNamespace == namespaceId {
+		ep.HostComputeNamespace = ""
+	}
 	return nil
 }
 
@@ -491,12 +501,13 @@ func (fNetwork *FakeHostComputeNetwork) GetHCNObj() *hcn.HostComputeNetwork {
 }
 
 type FakeHostComputeEndpoint struct {
-	ID                 string
-	Name               string
-	HostComputeNetwork string
-	Policies           []*FakeEndpointPolicy
-	IPConfiguration    string
-	Flags              hcn.EndpointFlags
+	ID                   string
+	Name                 string
+	HostComputeNetwork   string
+	HostComputeNamespace string
+	Policies             []*FakeEndpointPolicy
+	IPConfiguration      string
+	Flags                hcn.EndpointFlags
 }
 
 func NewFakeHostComputeEndpoint(endpoint *hcn.HostComputeEndpoint) *FakeHostComputeEndpoint {
@@ -505,11 +516,12 @@ func NewFakeHostComputeEndpoint(endpoint *hcn.HostComputeEndpoint) *FakeHostComp
 		ip = endpoint.IpConfigurations[0].IpAddress
 	}
 	return &FakeHostComputeEndpoint{
-		ID:                 endpoint.Id,
-		Name:               endpoint.Name,
-		HostComputeNetwork: endpoint.HostComputeNetwork,
-		IPConfiguration:    ip,
-		Flags:              endpoint.Flags,
+		ID:                   endpoint.Id,
+		Name:                 endpoint.Name,
+		HostComputeNetwork:   endpoint.HostComputeNetwork,
+		HostComputeNamespace: endpoint.HostComputeNamespace,
+		IPConfiguration:      ip,
+		Flags:                endpoint.Flags,
 	}
 }
 
@@ -538,9 +550,10 @@ func (fEndpoint *FakeHostComputeEndpoint) GetHCNObj() *hcn.HostComputeEndpoint {
 	}
 
 	return &hcn.HostComputeEndpoint{
-		Id:                 fEndpoint.ID,
-		Name:               fEndpoint.Name,
-		HostComputeNetwork: fEndpoint.HostComputeNetwork,
+		Id:                   fEndpoint.ID,
+		Name:                 fEndpoint.Name,
+		HostComputeNetwork:   fEndpoint.HostComputeNetwork,
+		HostComputeNamespace: fEndpoint.HostComputeNamespace,
 		IpConfigurations: []hcn.IpConfig{
 			{
 				IpAddress: fEndpoint.IPConfiguration,
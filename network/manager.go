@@ -4,7 +4,9 @@
 package network
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net"
 	"sync"
 	"time"
@@ -19,7 +21,9 @@ import (
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/store"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -76,18 +80,33 @@ type EndpointClient interface {
 
 // NetworkManager manages the set of container networking resources.
 type networkManager struct {
-	statelessCniMode   bool
-	CnsClient          *cnsclient.Client
-	Version            string
-	TimeStamp          time.Time
-	ExternalInterfaces map[string]*externalInterface
-	store              store.KeyValueStore
-	netlink            netlink.NetlinkInterface
-	netio              netio.NetIOInterface
-	plClient           platform.ExecClient
-	nsClient           NamespaceClientInterface
-	iptablesClient     ipTablesClient
-	dhcpClient         dhcpClient
+	statelessCniMode bool
+	// collectEndpointStats adds the endpoints' traffic counters to the EndpointInfo returned by the getters
+	collectEndpointStats bool
+	// recoverEndpointState rebuilds the state from the dataplane when it is missing or can't be read
+	recoverEndpointState bool
+	CnsClient            *cnsclient.Client
+	Version              string
+	TimeStamp            time.Time
+	ExternalInterfaces   map[string]*externalInterface
+	store                store.KeyValueStore
+	netlink              netlink.NetlinkInterface
+	netio                netio.NetIOInterface
+	plClient             platform.ExecClient
+	nsClient             NamespaceClientInterface
+	iptablesClient       ipTablesClient
+	dhcpClient           dhcpClient
+	datapathGeneration   int
+	datapathMigrations   []datapathMigration
+	stateMigrations      []stateMigration
+	// SchemaVersion is the version of the layout of the serialized state, see defaultStateMigrations
+	SchemaVersion int
+	// stateEntries are the endpoint entries last read from or written to a store.EntryStore, see writeState
+	stateEntries map[string]json.RawMessage
+	// endpointHooks are notified of the endpoints created and deleted, see AddEndpointHook
+	endpointHooks []EndpointHook
+	// the lock only guards the manager within a cni command. The commands themselves are serialized by the file lock of
+	// the store, which each holds from reading the state to saving it, see cni.Plugin.InitializeKeyValueStore.
 	sync.Mutex
 }
 
@@ -99,6 +118,7 @@ type NetworkManager interface {
 	AddExternalInterface(ifName, subnet, nicType string) error
 
 	CreateNetwork(nwInfo *EndpointInfo) error
+	AddNetworkSubnets(nwInfo *EndpointInfo) error
 	DeleteNetwork(networkID string) error
 	GetNetworkInfo(networkID string) (EndpointInfo, error)
 	// FindNetworkIDFromNetNs returns the network name that contains an endpoint created for this netNS, errNetworkNotFound if no network is found
@@ -106,11 +126,12 @@ type NetworkManager interface {
 	GetNumEndpointsByContainerID(containerID string) int
 
 	CreateEndpoint(client apipaClient, networkID string, epInfo *EndpointInfo) error
-	EndpointCreate(client apipaClient, epInfos []*EndpointInfo) error // TODO: change name
-	DeleteEndpoint(networkID string, endpointID string, epInfo *EndpointInfo) error
+	EndpointCreate(ctx context.Context, client apipaClient, epInfos []*EndpointInfo) error // TODO: change name
+	DeleteEndpoint(ctx context.Context, networkID string, endpointID string, epInfo *EndpointInfo) error
 	GetEndpointInfo(networkID string, endpointID string) (*EndpointInfo, error)
 	GetAllEndpoints(networkID string) (map[string]*EndpointInfo, error)
-	GetEndpointInfoBasedOnPODDetails(networkID string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error)
+	GetEndpointInfoBasedOnPODDetails(networkID string, match PodMatcher) (*EndpointInfo, error)
+	GetEndpointInfoByIP(networkID string, ip net.IP) (*EndpointInfo, error)
 	AttachEndpoint(networkID string, endpointID string, sandboxKey string) (*endpoint, error)
 	DetachEndpoint(networkID string, endpointID string) error
 	UpdateEndpoint(networkID string, existingEpInfo *EndpointInfo, targetEpInfo *EndpointInfo) error
@@ -121,6 +142,15 @@ type NetworkManager interface {
 	DeleteState(epInfos []*EndpointInfo) error
 	GetEndpointInfosFromContainerID(containerID string) []*EndpointInfo
 	GetEndpointState(networkID, containerID string) ([]*EndpointInfo, error)
+	SetDatapathGeneration(generation int) error
+	SetStore(kvs store.KeyValueStore) error
+	ReattachHnsEndpoints() error
+	MigrateEndpoints(after string, limit int) (DatapathMigrationProgress, error)
+	CheckOVSHealth(networkID string) ([]string, error)
+	CheckEthtoolSettings(containerID string) ([]string, error)
+	DetachDelegatedNIC(networkID, containerID string, macAddress net.HardwareAddr) error
+	GetNetworkUtilization() []NetworkUtilization
+	AddEndpointHook(hook EndpointHook)
 }
 
 // Creates a new network manager.
@@ -135,6 +165,9 @@ func NewNetworkManager(nl netlink.NetlinkInterface, plc platform.ExecClient, net
 		nsClient:           nsc,
 		iptablesClient:     iptc,
 		dhcpClient:         dhcpc,
+		datapathGeneration: len(defaultDatapathMigrations),
+		datapathMigrations: defaultDatapathMigrations,
+		stateMigrations:    defaultStateMigrations,
 	}
 
 	return nm, nil
@@ -144,6 +177,8 @@ func NewNetworkManager(nl netlink.NetlinkInterface, plc platform.ExecClient, net
 func (nm *networkManager) Initialize(config *common.PluginConfig, isRehydrationRequired bool) error {
 	nm.Version = config.Version
 	nm.store = config.Store
+	nm.collectEndpointStats = config.CollectEndpointStats
+	nm.recoverEndpointState = config.RecoverEndpointState
 	if config.Stateless {
 		if err := nm.SetStatelessCNIMode(); err != nil {
 			return errors.Wrapf(err, "Failed to initialize stateles CNI")
@@ -152,8 +187,12 @@ func (nm *networkManager) Initialize(config *common.PluginConfig, isRehydrationR
 	}
 
 	// Restore persisted state.
-	err := nm.restore(isRehydrationRequired)
-	return err
+	if err := nm.restore(isRehydrationRequired); err != nil {
+		return err
+	}
+
+	nm.reinstallOVSFlowsOnRestart()
+	return nil
 }
 
 // Uninitialize cleans up network manager.
@@ -190,18 +229,31 @@ func (nm *networkManager) restore(isRehydrationRequired bool) error {
 	// Ignore the persisted state if it is older than the last reboot time.
 
 	// Read any persisted state.
-	err := nm.store.Read(storeKey, nm)
+	raw, err := nm.readState()
 	if err != nil {
 		if err == store.ErrKeyNotFound {
 			logger.Info("network store key not found")
 			// Considered successful.
-			return nil
+			return nm.recoverFromDataplane(nil)
 		} else if err == store.ErrStoreEmpty {
 			logger.Info("network store empty")
-			return nil
+			return nm.recoverFromDataplane(nil)
 		} else {
 			logger.Error("Failed to restore state", zap.Error(err))
-			return err
+			return nm.recoverFromDataplane(err)
+		}
+	}
+
+	// the state is migrated before it is decoded, so that migrations can rename or restructure its fields
+	migrated := false
+	if len(raw) > 0 {
+		if raw, migrated, err = migrateState(raw, nm.stateMigrations); err != nil {
+			logger.Error("Failed to migrate state", zap.Error(err))
+			return nm.recoverFromDataplane(err)
+		}
+		if err = json.Unmarshal(raw, nm); err != nil {
+			logger.Error("Failed to restore state", zap.Error(err))
+			return nm.recoverFromDataplane(errors.Wrap(err, "failed to unmarshal state"))
 		}
 	}
 
@@ -269,6 +321,14 @@ func (nm *networkManager) restore(isRehydrationRequired bool) error {
 		}
 	}
 
+	// write the migrated state so that it is only migrated once
+	if migrated {
+		if err := nm.save(); err != nil {
+			logger.Error("Failed to save migrated state", zap.Error(err))
+		}
+	}
+
+	nm.recordUtilization()
 	logger.Info("Restored state")
 	return nil
 }
@@ -286,8 +346,19 @@ func (nm *networkManager) save() error {
 
 	// Update time stamp.
 	nm.TimeStamp = time.Now()
+	nm.SchemaVersion = len(nm.stateMigrations)
 
-	err := nm.store.Write(storeKey, nm)
+	var err error
+	if nm.writesBinaryState() {
+		err = nm.writeBinaryState()
+	} else {
+		var state []byte
+		if state, err = json.Marshal(nm); err != nil {
+			logger.Error("Save failed", zap.Error(err))
+			return errors.Wrap(err, "failed to marshal network manager state")
+		}
+		err = nm.writeState(state)
+	}
 	if err == nil {
 		logger.Info("Save succeeded")
 	} else {
@@ -296,6 +367,17 @@ func (nm *networkManager) save() error {
 	return err
 }
 
+// SetStore moves the state to the given store, saving all of it there.
+func (nm *networkManager) SetStore(kvs store.KeyValueStore) error {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nm.store = kvs
+	// the endpoint entries written last are those of the previous store, so all of them are written
+	nm.stateEntries = nil
+	return nm.save()
+}
+
 //
 // NetworkManager API
 //
@@ -328,6 +410,31 @@ func (nm *networkManager) CreateNetwork(epInfo *EndpointInfo) error {
 	return nil
 }
 
+// AddNetworkSubnets adds the subnets of the network info the existing network doesn't have yet to it, programming the
+// gateways and routes of the new subnets.
+func (nm *networkManager) AddNetworkSubnets(nwInfo *EndpointInfo) error {
+	added, err := nm.addNetworkSubnets(nwInfo)
+	if err != nil || !added {
+		return err
+	}
+
+	nm.Lock()
+	defer nm.Unlock()
+	return nm.save()
+}
+
+func (nm *networkManager) addNetworkSubnets(nwInfo *EndpointInfo) (bool, error) {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(nwInfo.NetworkID)
+	if err != nil {
+		return false, err
+	}
+
+	return nm.addSubnets(nw, nwInfo)
+}
+
 // DeleteNetwork deletes an existing container network.
 func (nm *networkManager) DeleteNetwork(networkID string) error {
 	nm.Lock()
@@ -373,7 +480,7 @@ func (nm *networkManager) GetNetworkInfo(networkID string) (EndpointInfo, error)
 	return nwInfo, nil
 }
 
-func (nm *networkManager) createEndpoint(cli apipaClient, networkID string, epInfo *EndpointInfo) (*endpoint, error) {
+func (nm *networkManager) createEndpoint(ctx context.Context, cli apipaClient, networkID string, epInfo *EndpointInfo) (*endpoint, error) {
 	nm.Lock()
 	defer nm.Unlock()
 
@@ -389,16 +496,18 @@ func (nm *networkManager) createEndpoint(cli apipaClient, networkID string, epIn
 		}
 	}
 
-	ep, err := nw.newEndpoint(cli, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, epInfo)
+	ep, err := nw.newEndpoint(ctx, cli, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, epInfo)
 	if err != nil {
 		return nil, err
 	}
+	// new endpoints are always programmed with the target datapath
+	ep.DatapathGeneration = nm.datapathGeneration
 	// any error after this point should also clean up the endpoint we created above
 	defer func() {
 		if err != nil {
 			logger.Error("Create endpoint failure", zap.Error(err))
 			logger.Info("Cleanup resources")
-			delErr := nw.deleteEndpoint(nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, ep.Id)
+			delErr := nw.deleteEndpoint(ctx, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, ep.Id)
 			if delErr != nil {
 				logger.Error("Deleting endpoint after create endpoint failure failed with", zap.Error(delErr))
 			}
@@ -410,7 +519,7 @@ func (nm *networkManager) createEndpoint(cli apipaClient, networkID string, epIn
 
 // CreateEndpoint creates a new container endpoint (this is for compatibility-- add flow should no longer use this).
 func (nm *networkManager) CreateEndpoint(cli apipaClient, networkID string, epInfo *EndpointInfo) error {
-	_, err := nm.createEndpoint(cli, networkID, epInfo)
+	_, err := nm.createEndpoint(context.Background(), cli, networkID, epInfo)
 	return err
 }
 
@@ -485,13 +594,13 @@ func (nm *networkManager) GetEndpointState(networkID, containerID string) ([]*En
 }
 
 // DeleteEndpoint deletes an existing container endpoint.
-func (nm *networkManager) DeleteEndpoint(networkID, endpointID string, epInfo *EndpointInfo) error {
+func (nm *networkManager) DeleteEndpoint(ctx context.Context, networkID, endpointID string, epInfo *EndpointInfo) error {
 	nm.Lock()
 	defer nm.Unlock()
 
 	if nm.IsStatelessCNIMode() {
 		// Calls deleteEndpointImpl directly, skipping the get network check; does not call cns
-		return nm.DeleteEndpointState(networkID, epInfo)
+		return nm.DeleteEndpointState(ctx, networkID, epInfo)
 	}
 
 	nw, err := nm.getNetwork(networkID)
@@ -499,52 +608,38 @@ func (nm *networkManager) DeleteEndpoint(networkID, endpointID string, epInfo *E
 		return err
 	}
 
-	err = nw.deleteEndpoint(nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, endpointID)
+	var deletedEpInfo *EndpointInfo
+	if ep, ok := nw.Endpoints[endpointID]; ok && len(nm.endpointHooks) > 0 {
+		deletedEpInfo = ep.getInfo(nil)
+	}
+	err = nw.deleteEndpoint(ctx, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, endpointID)
 	if err != nil {
 		return err
 	}
+	nm.notifyEndpointDeleted(ctx, deletedEpInfo)
+
+	if epInfo != nil {
+		return nm.deleteDelegatedNetwork(nw, epInfo.NICType)
+	}
 
 	return nil
 }
 
-func (nm *networkManager) DeleteEndpointState(networkID string, epInfo *EndpointInfo) error {
-	// we want to always use hnsv2 in stateless
-	// hnsv2 is only enabled if NetNs has a valid guid and the hnsv2 api is supported
-	// by passing in a dummy guid, we satisfy the first condition
-	nw := &network{
-		Id:           networkID, // currently unused in stateless cni
-		HnsId:        epInfo.HNSNetworkID,
-		Mode:         opModeTransparentVlan,
-		SnatBridgeIP: "",
-		NetNs:        dummyGUID, // to trigger hns v2, windows
-		extIf: &externalInterface{
-			Name:       InfraInterfaceName,
-			MacAddress: nil,
-		},
-	}
-
-	ep := &endpoint{
-		Id:                       epInfo.EndpointID,
-		HnsId:                    epInfo.HNSEndpointID,
-		HNSNetworkID:             epInfo.HNSNetworkID, // unused (we use nw.HnsId for deleting the network)
-		HostIfName:               epInfo.HostIfName,
-		LocalIP:                  "",
-		VlanID:                   0,
-		AllowInboundFromHostToNC: false, // stateless currently does not support apipa
-		AllowInboundFromNCToHost: false,
-		EnableSnatOnHost:         false,
-		EnableMultitenancy:       false,
-		NetworkContainerID:       epInfo.NetworkContainerID, // we don't use this as long as AllowInboundFromHostToNC and AllowInboundFromNCToHost are false
-		NetNs:                    dummyGUID,                 // to trigger hnsv2, windows
-		NICType:                  epInfo.NICType,
-		IfName:                   epInfo.IfName, // TODO: For stateless cni linux populate IfName here to use in deletion in secondary endpoint client
-	}
+// DeleteEndpointState deletes the endpoint of a stateless cni from its record in CNS, without a network in the state.
+func (nm *networkManager) DeleteEndpointState(ctx context.Context, networkID string, epInfo *EndpointInfo) error {
+	nw, ep := newStatelessEndpoint(networkID, epInfo)
 	logger.Info("Deleting endpoint with", zap.String("Endpoint Info: ", epInfo.PrettyString()), zap.String("HNISID : ", ep.HnsId))
 
-	err := nw.deleteEndpointImpl(netlink.NewNetlink(), platform.NewExecClient(logger), nil, nil, nil, nil, nil, ep)
+	ctx, span := tracing.Start(ctx, "network.DeleteEndpoint",
+		attribute.String("endpoint.id", ep.Id), attribute.String("nic.type", string(ep.NICType)))
+	start := time.Now()
+	err := nw.deleteEndpointImpl(ctx, nm.netlink, nm.plClient, nil, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, ep)
+	tracing.End(span, err)
+	recordEndpointOperation(operationDelete, ep.NICType, start, err)
 	if err != nil {
 		return err
 	}
+	nm.notifyEndpointDeleted(ctx, epInfo)
 
 	err = nm.deleteNetworkImpl(nw, ep.NICType)
 	// no need to clean up state in stateless
@@ -555,6 +650,89 @@ func (nm *networkManager) DeleteEndpointState(networkID string, epInfo *Endpoint
 	return nil
 }
 
+// DetachDelegatedNIC releases the delegated nic with the given mac address from the running endpoints of the container,
+// when the fabric reclaims the nic without the pod being deleted: the nic is returned to the host without its routes and
+// dropped from the state of the endpoint, so that the next DEL of the pod doesn't fail on it.
+func (nm *networkManager) DetachDelegatedNIC(networkID, containerID string, macAddress net.HardwareAddr) error {
+	logger.Info("Detaching delegated nic", zap.String("networkID", networkID), zap.String("containerID", containerID),
+		zap.String("macAddress", macAddress.String()))
+
+	if nm.IsStatelessCNIMode() {
+		return nm.detachDelegatedNICState(networkID, containerID, macAddress)
+	}
+
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ep     *endpoint
+		ifName string
+	)
+	for _, candidate := range nw.getEndpointsByContainerID(containerID) {
+		if name, ok := candidate.delegatedNICName(macAddress); ok {
+			ep, ifName = candidate, name
+			break
+		}
+	}
+	if ep == nil {
+		return errors.Wrapf(errEndpointNotFound, "no delegated nic %s in container %s", macAddress, containerID)
+	}
+
+	if err := nw.detachDelegatedNICImpl(nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.dhcpClient, ep, ifName); err != nil {
+		return errors.Wrapf(err, "failed to detach delegated nic %s", ifName)
+	}
+
+	// an endpoint of the nic alone goes with it, an endpoint holding it in its SecondaryInterfaces stays
+	if ep.NICType.IsFrontendNIC() {
+		nw.removeEndpoint(ep)
+		if err := nm.deleteDelegatedNetwork(nw, ep.NICType); err != nil {
+			return err
+		}
+	}
+
+	return nm.save()
+}
+
+// detachDelegatedNICState detaches the delegated nic of a stateless cni endpoint found in its record in CNS, and
+// removes the nic from the record.
+func (nm *networkManager) detachDelegatedNICState(networkID, containerID string, macAddress net.HardwareAddr) error {
+	epInfos, err := nm.GetEndpointState(networkID, containerID)
+	if err != nil {
+		return err
+	}
+
+	var epInfo *EndpointInfo
+	for _, candidate := range epInfos {
+		// CNS keeps the mac address as a string, which GetEndpointState doesn't parse
+		mac, parseErr := net.ParseMAC(string(candidate.MacAddress))
+		if candidate.NICType.IsFrontendNIC() && parseErr == nil && bytes.Equal(mac, macAddress) {
+			epInfo = candidate
+			break
+		}
+	}
+	if epInfo == nil {
+		return errors.Wrapf(errEndpointNotFound, "no delegated nic %s in container %s", macAddress, containerID)
+	}
+
+	nw, ep := newStatelessEndpoint(networkID, epInfo)
+	if err := nw.detachDelegatedNICImpl(nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.dhcpClient, ep, epInfo.IfName); err != nil {
+		return errors.Wrapf(err, "failed to detach delegated nic %s", epInfo.IfName)
+	}
+	if err := nm.deleteNetworkImpl(nw, ep.NICType); err != nil {
+		return errors.Wrap(err, "failed to delete network of delegated nic")
+	}
+
+	if _, err := nm.CnsClient.DetachEndpointInterface(context.TODO(), containerID, epInfo.IfName); err != nil {
+		return errors.Wrapf(err, "failed to remove delegated nic %s from the endpoint state", epInfo.IfName)
+	}
+	return nil
+}
+
 // GetEndpointInfo returns information about the given endpoint.
 func (nm *networkManager) GetEndpointInfo(networkID, endpointID string) (*EndpointInfo, error) {
 	nm.Lock()
@@ -585,7 +763,15 @@ func (nm *networkManager) GetEndpointInfo(networkID, endpointID string) (*Endpoi
 		return nil, err
 	}
 
-	return ep.getInfo(), nil
+	return ep.getInfo(nm.endpointStatsClient()), nil
+}
+
+// endpointStatsClient returns the client the endpoints' traffic counters are read with, or nil if they aren't collected.
+func (nm *networkManager) endpointStatsClient() netio.NetIOInterface {
+	if !nm.collectEndpointStats {
+		return nil
+	}
+	return nm.netio
 }
 
 func (nm *networkManager) GetAllEndpoints(networkId string) (map[string]*EndpointInfo, error) {
@@ -606,15 +792,15 @@ func (nm *networkManager) GetAllEndpoints(networkId string) (map[string]*Endpoin
 	}
 
 	for epid, ep := range nw.Endpoints {
-		eps[epid] = ep.getInfo()
+		eps[epid] = ep.getInfo(nm.endpointStatsClient())
 	}
 
 	return eps, nil
 }
 
-// GetEndpointInfoBasedOnPODDetails returns information about the given endpoint.
+// GetEndpointInfoBasedOnPODDetails returns information about the endpoint of the pod the matcher finds.
 // It returns an error if a single pod has multiple endpoints.
-func (nm *networkManager) GetEndpointInfoBasedOnPODDetails(networkID string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error) {
+func (nm *networkManager) GetEndpointInfoBasedOnPODDetails(networkID string, match PodMatcher) (*EndpointInfo, error) {
 	nm.Lock()
 	defer nm.Unlock()
 
@@ -623,12 +809,31 @@ func (nm *networkManager) GetEndpointInfoBasedOnPODDetails(networkID string, pod
 		return nil, err
 	}
 
-	ep, err := nw.getEndpointByPOD(podName, podNameSpace, doExactMatchForPodName)
+	ep, err := nw.getEndpointByPOD(match)
 	if err != nil {
 		return nil, err
 	}
 
-	return ep.getInfo(), nil
+	return ep.getInfo(nm.endpointStatsClient()), nil
+}
+
+// GetEndpointInfoByIP returns information about the endpoint with the ip.
+// It returns an error if multiple endpoints have the ip.
+func (nm *networkManager) GetEndpointInfoByIP(networkID string, ip net.IP) (*EndpointInfo, error) {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := nw.getEndpointByIP(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return ep.getInfo(nm.endpointStatsClient()), nil
 }
 
 // AttachEndpoint attaches an endpoint to a sandbox.
@@ -646,6 +851,8 @@ func (nm *networkManager) AttachEndpoint(networkId string, endpointId string, sa
 		return nil, err
 	}
 
+	nm.migrateEndpointOnTouch(nw, ep)
+
 	err = ep.attach(sandboxKey)
 	if err != nil {
 		return nil, err
@@ -697,8 +904,20 @@ func (nm *networkManager) UpdateEndpoint(networkID string, existingEpInfo *Endpo
 		return err
 	}
 
+	ep, getErr := nw.getEndpoint(existingEpInfo.EndpointID)
+	if getErr == nil {
+		nm.migrateEndpointOnTouch(nw, ep)
+	}
+
+	start := time.Now()
 	err = nm.updateEndpoint(nw, existingEpInfo, targetEpInfo)
+	if getErr == nil {
+		ep.addHistory(EndpointOperationUpdate, start, err)
+	}
 	if err != nil {
+		if getErr == nil {
+			nm.saveHistory(ep)
+		}
 		return err
 	}
 
@@ -809,23 +1028,25 @@ func cnsEndpointInfotoCNIEpInfos(endpointInfo restserver.EndpointInfo, endpointI
 		epInfo.NICType = ipInfo.NICType
 		epInfo.HNSNetworkID = ipInfo.HnsNetworkID
 		epInfo.MacAddress = net.HardwareAddr(ipInfo.MacAddress)
+		epInfo.NetNsPath = ipInfo.NetNsPath
+		epInfo.OutboundNATExceptions = ipInfo.OutboundNATExceptions
+		epInfo.EnableEBPFDatapath = ipInfo.EnableEBPFDatapath
+		epInfo.HostProtectedPorts = ipInfo.HostProtectedPorts
+		epInfo.RouteTable = ipInfo.RouteTable
 		ret = append(ret, epInfo)
 	}
 	return ret
 }
 
 // gets all endpoint infos associated with a container id and populates the network id field
-// nictype may be empty in which case it is likely of type "infra"
 func (nm *networkManager) GetEndpointInfosFromContainerID(containerID string) []*EndpointInfo {
 	ret := []*EndpointInfo{}
 	for _, extIf := range nm.ExternalInterfaces {
 		for networkID, nw := range extIf.Networks {
-			for _, ep := range nw.Endpoints {
-				if ep.ContainerID == containerID {
-					val := ep.getInfo()
-					val.NetworkID = networkID // endpoint doesn't contain the network id
-					ret = append(ret, val)
-				}
+			for _, ep := range nw.getEndpointsByContainerID(containerID) {
+				val := ep.getInfo(nm.endpointStatsClient())
+				val.NetworkID = networkID // endpoint doesn't contain the network id
+				ret = append(ret, val)
 			}
 		}
 	}
@@ -842,8 +1063,34 @@ func generateCNSIPInfoMap(eps []*endpoint) map[string]*restserver.IPInfo {
 			HnsNetworkID:  ep.HNSNetworkID,
 			HostVethName:  ep.HostIfName,
 			MacAddress:    ep.MacAddress.String(),
+			// the fields below are only used to delete linux endpoints
+			NetNsPath:             ep.NetworkNameSpace,
+			OutboundNATExceptions: ep.OutboundNATExceptions,
+			EnableEBPFDatapath:    ep.EnableEBPFDatapath,
+			Routes:                cnsRoutes(ep.Routes),
+			HostProtectedPorts:    ep.HostProtectedPorts,
+			RouteTable:            ep.RouteTable,
 		}
 	}
 
 	return ifNametoIPInfoMap
 }
+
+// cnsRoutes converts the routes of an endpoint to the routes kept in its CNS record.
+func cnsRoutes(routes []RouteInfo) []cns.Route {
+	if len(routes) == 0 {
+		return nil
+	}
+
+	ret := make([]cns.Route, len(routes))
+	for i := range routes {
+		ret[i] = cns.Route{
+			IPAddress:      routes[i].Dst.String(),
+			InterfaceToUse: routes[i].DevName,
+		}
+		if routes[i].Gw != nil {
+			ret[i].GatewayIPAddress = routes[i].Gw.String()
+		}
+	}
+	return ret
+}
@@ -1,7 +1,12 @@
 package network
 
 import (
+	"bytes"
+	"context"
+	"net"
+
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/store"
 )
 
 // MockNetworkManager is a mock structure for Network Manager
@@ -41,6 +46,19 @@ func (nm *MockNetworkManager) CreateNetwork(nwInfo *EndpointInfo) error {
 	return nil
 }
 
+// AddNetworkSubnets mock
+func (nm *MockNetworkManager) AddNetworkSubnets(nwInfo *EndpointInfo) error {
+	info, exists := nm.TestNetworkInfoMap[nwInfo.NetworkID]
+	if !exists {
+		return errNetworkNotFound
+	}
+	nw := &network{Subnets: info.Subnets}
+	updated := *info
+	updated.Subnets = append(append([]SubnetInfo{}, info.Subnets...), nw.newSubnets(nwInfo.Subnets)...)
+	nm.TestNetworkInfoMap[nwInfo.NetworkID] = &updated
+	return nil
+}
+
 // DeleteNetwork mock
 func (nm *MockNetworkManager) DeleteNetwork(networkID string) error {
 	return nil
@@ -66,7 +84,7 @@ func (nm *MockNetworkManager) CreateEndpoint(_ apipaClient, _ string, epInfo *En
 }
 
 // DeleteEndpoint mock
-func (nm *MockNetworkManager) DeleteEndpoint(_, endpointID string, _ *EndpointInfo) error {
+func (nm *MockNetworkManager) DeleteEndpoint(_ context.Context, _, endpointID string, _ *EndpointInfo) error {
 	delete(nm.TestEndpointInfoMap, endpointID)
 	return nil
 }
@@ -107,10 +125,22 @@ func (nm *MockNetworkManager) GetEndpointInfo(_, endpointID string) (*EndpointIn
 }
 
 // GetEndpointInfoBasedOnPODDetails mock
-func (nm *MockNetworkManager) GetEndpointInfoBasedOnPODDetails(networkID string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error) {
+func (nm *MockNetworkManager) GetEndpointInfoBasedOnPODDetails(networkID string, match PodMatcher) (*EndpointInfo, error) {
 	return &EndpointInfo{}, nil
 }
 
+// GetEndpointInfoByIP mock
+func (nm *MockNetworkManager) GetEndpointInfoByIP(_ string, ip net.IP) (*EndpointInfo, error) {
+	for _, epInfo := range nm.TestEndpointInfoMap {
+		for i := range epInfo.IPAddresses {
+			if epInfo.IPAddresses[i].IP.Equal(ip) {
+				return epInfo, nil
+			}
+		}
+	}
+	return nil, errEndpointNotFound
+}
+
 // AttachEndpoint mock
 func (nm *MockNetworkManager) AttachEndpoint(networkID string, endpointID string, sandboxKey string) (*endpoint, error) {
 	return &endpoint{}, nil
@@ -164,7 +194,7 @@ func (nm *MockNetworkManager) SaveState(eps []*endpoint) error {
 	return nil
 }
 
-func (nm *MockNetworkManager) EndpointCreate(client apipaClient, epInfos []*EndpointInfo) error {
+func (nm *MockNetworkManager) EndpointCreate(_ context.Context, client apipaClient, epInfos []*EndpointInfo) error {
 	eps := []*endpoint{}
 	for _, epInfo := range epInfos {
 		_, nwGetErr := nm.GetNetworkInfo(epInfo.NetworkID)
@@ -210,3 +240,47 @@ func (nm *MockNetworkManager) GetEndpointInfosFromContainerID(containerID string
 func (nm *MockNetworkManager) GetEndpointState(_, _ string) ([]*EndpointInfo, error) {
 	return []*EndpointInfo{}, nil
 }
+
+func (nm *MockNetworkManager) SetDatapathGeneration(_ int) error {
+	return nil
+}
+
+func (nm *MockNetworkManager) SetStore(_ store.KeyValueStore) error {
+	return nil
+}
+
+func (nm *MockNetworkManager) ReattachHnsEndpoints() error {
+	return nil
+}
+
+func (nm *MockNetworkManager) MigrateEndpoints(_ string, _ int) (DatapathMigrationProgress, error) {
+	return DatapathMigrationProgress{}, nil
+}
+
+func (nm *MockNetworkManager) CheckOVSHealth(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func (nm *MockNetworkManager) CheckEthtoolSettings(_ string) ([]string, error) {
+	return nil, nil
+}
+
+// DetachDelegatedNIC mock
+func (nm *MockNetworkManager) DetachDelegatedNIC(_, containerID string, macAddress net.HardwareAddr) error {
+	for endpointID, epInfo := range nm.TestEndpointInfoMap {
+		if epInfo.ContainerID == containerID && epInfo.NICType.IsFrontendNIC() &&
+			bytes.Equal(epInfo.MacAddress, macAddress) {
+			delete(nm.TestEndpointInfoMap, endpointID)
+			return nil
+		}
+	}
+	return errEndpointNotFound
+}
+
+// GetNetworkUtilization mock
+func (nm *MockNetworkManager) GetNetworkUtilization() []NetworkUtilization {
+	return nil
+}
+
+// AddEndpointHook mock
+func (nm *MockNetworkManager) AddEndpointHook(_ EndpointHook) {}
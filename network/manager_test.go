@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sort"
@@ -272,7 +273,7 @@ var _ = Describe("Test Manager", func() {
 		Context("When no endpoints provided", func() {
 			It("Should return 0", func() {
 				nm := &networkManager{}
-				err := nm.EndpointCreate(nil, []*EndpointInfo{})
+				err := nm.EndpointCreate(context.Background(), nil, []*EndpointInfo{})
 				Expect(err).NotTo(HaveOccurred())
 				num := nm.GetNumberOfEndpoints("", "")
 				Expect(num).To(Equal(0))
@@ -394,6 +395,7 @@ var _ = Describe("Test Manager", func() {
 							HnsNetworkID:  "hnsNetworkID2",
 							MacAddress:    "22:34:56:78:9a:bc",
 							NICType:       cns.NodeNetworkInterfaceFrontendNIC,
+							NetNsPath:     "/var/run/netns/pod",
 						},
 					},
 					PodName:      "test-pod",
@@ -428,6 +430,7 @@ var _ = Describe("Test Manager", func() {
 						NICType:            cns.NodeNetworkInterfaceFrontendNIC,
 						HNSNetworkID:       "hnsNetworkID2",
 						MacAddress:         net.HardwareAddr("22:34:56:78:9a:bc"),
+						NetNsPath:          "/var/run/netns/pod",
 						ContainerID:        endpointID,
 						EndpointID:         endpointID,
 						NetworkContainerID: endpointID,
@@ -453,12 +456,17 @@ var _ = Describe("Test Manager", func() {
 						MacAddress:   mac1,
 					},
 					{
-						IfName:       "eth1",
-						NICType:      cns.NodeNetworkInterfaceFrontendNIC,
-						HnsId:        "hnsEndpointID2",
-						HNSNetworkID: "hnsNetworkID2",
-						HostIfName:   "hostIfName2",
-						MacAddress:   mac2,
+						IfName:           "eth1",
+						NICType:          cns.NodeNetworkInterfaceFrontendNIC,
+						HnsId:            "hnsEndpointID2",
+						HNSNetworkID:     "hnsNetworkID2",
+						HostIfName:       "hostIfName2",
+						MacAddress:       mac2,
+						NetworkNameSpace: "/var/run/netns/pod",
+						Routes: []RouteInfo{
+							{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, Gw: net.ParseIP("10.0.0.1")},
+							{Dst: net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}, DevName: "eth1"},
+						},
 					},
 				}
 				cnsEpInfos := generateCNSIPInfoMap(endpoints)
@@ -483,6 +491,11 @@ var _ = Describe("Test Manager", func() {
 						HnsNetworkID:  "hnsNetworkID2",
 						HostVethName:  "hostIfName2",
 						MacAddress:    "22:34:56:78:9a:bc",
+						NetNsPath:     "/var/run/netns/pod",
+						Routes: []cns.Route{
+							{IPAddress: "0.0.0.0/0", GatewayIPAddress: "10.0.0.1"},
+							{IPAddress: "10.0.0.1/32", InterfaceToUse: "eth1"},
+						},
 					},
 				))
 			})
@@ -0,0 +1,109 @@
+package network
+
+import (
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	operationCreate = "create"
+	operationDelete = "delete"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// MetricsRegistry holds the metrics of the network package. It is kept apart from the default registry so that
+// short lived callers such as the CNI can gather and push it to CNS, which exposes it with its own metrics.
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	endpointOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "network_endpoint_operations_total",
+			Help: "Count of endpoint operations by operation, NIC type and result.",
+		},
+		[]string{"operation", "nic_type", "result"},
+	)
+	endpointOperationLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "network_endpoint_operation_latency_seconds",
+			Help: "Endpoint operation latency in seconds by operation and NIC type.",
+			//nolint:gomnd // default bucket consts
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1 ms to ~16 seconds
+		},
+		[]string{"operation", "nic_type"},
+	)
+	endpointCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_endpoints",
+			Help: "Current number of endpoints by network.",
+		},
+		[]string{"network"},
+	)
+	subnetCapacityIPs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_subnet_capacity_ips",
+			Help: "Number of ips of a subnet the endpoints can get by network and subnet.",
+		},
+		[]string{"network", "subnet"},
+	)
+	subnetAvailableIPs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_subnet_available_ips",
+			Help: "Number of ips of a subnet no endpoint has by network and subnet.",
+		},
+		[]string{"network", "subnet"},
+	)
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		endpointOperations,
+		endpointOperationLatency,
+		endpointCount,
+		subnetCapacityIPs,
+		subnetAvailableIPs,
+	)
+}
+
+// recordEndpointOperation records the result and latency of an endpoint operation which started at start.
+func recordEndpointOperation(operation string, nicType cns.NICType, start time.Time, err error) {
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+	}
+
+	endpointOperations.WithLabelValues(operation, string(nicType), result).Inc()
+	endpointOperationLatency.WithLabelValues(operation, string(nicType)).Observe(time.Since(start).Seconds())
+}
+
+// recordUtilization sets the endpoint count of every network known to the network manager and the capacity and
+// available ips of their subnets.
+func (nm *networkManager) recordUtilization() {
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			nw.recordUtilization()
+		}
+	}
+}
+
+// recordUtilization sets the endpoint count of the network and the capacity and available ips of its subnets.
+func (nw *network) recordUtilization() {
+	utilization := nw.utilization()
+	endpointCount.WithLabelValues(nw.Id).Set(float64(utilization.Endpoints))
+	for i := range utilization.Subnets {
+		subnet := &utilization.Subnets[i]
+		subnetCapacityIPs.WithLabelValues(nw.Id, subnet.Prefix.String()).Set(float64(subnet.CapacityIPs))
+		subnetAvailableIPs.WithLabelValues(nw.Id, subnet.Prefix.String()).Set(float64(subnet.AvailableIPs))
+	}
+}
+
+// deleteUtilization removes the metrics of a deleted network.
+func (nw *network) deleteUtilization() {
+	endpointCount.DeleteLabelValues(nw.Id)
+	subnetCapacityIPs.DeletePartialMatch(prometheus.Labels{"network": nw.Id})
+	subnetAvailableIPs.DeletePartialMatch(prometheus.Labels{"network": nw.Id})
+}
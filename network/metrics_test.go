@@ -0,0 +1,43 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordEndpointOperation(t *testing.T) {
+	success := endpointOperations.WithLabelValues(operationCreate, string(cns.NodeNetworkInterfaceFrontendNIC), resultSuccess)
+	failure := endpointOperations.WithLabelValues(operationCreate, string(cns.NodeNetworkInterfaceFrontendNIC), resultFailure)
+	successes, failures := testutil.ToFloat64(success), testutil.ToFloat64(failure)
+
+	recordEndpointOperation(operationCreate, cns.NodeNetworkInterfaceFrontendNIC, time.Now(), nil)
+	recordEndpointOperation(operationCreate, cns.NodeNetworkInterfaceFrontendNIC, time.Now(), errors.New("failed"))
+	recordEndpointOperation(operationCreate, cns.NodeNetworkInterfaceFrontendNIC, time.Now(), nil)
+
+	require.InDelta(t, successes+2, testutil.ToFloat64(success), 0)
+	require.InDelta(t, failures+1, testutil.ToFloat64(failure), 0)
+}
+
+func TestRecordUtilization(t *testing.T) {
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{
+			"eth0": {
+				Name: "eth0",
+				Networks: map[string]*network{
+					"metrics-a": {Id: "metrics-a", Endpoints: map[string]*endpoint{"1": {}, "2": {}}},
+					"metrics-b": {Id: "metrics-b", Endpoints: map[string]*endpoint{}},
+				},
+			},
+		},
+	}
+
+	nm.recordUtilization()
+
+	require.InDelta(t, 2, testutil.ToFloat64(endpointCount.WithLabelValues("metrics-a")), 0)
+	require.InDelta(t, 0, testutil.ToFloat64(endpointCount.WithLabelValues("metrics-b")), 0)
+}
@@ -4,14 +4,18 @@
 package network
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -21,7 +25,25 @@ const (
 	opModeTunnel          = "tunnel"
 	opModeTransparent     = "transparent"
 	opModeTransparentVlan = "transparent-vlan"
-	opModeDefault         = opModeTunnel
+	// opModeWireguard plumbs endpoints like transparent mode, pod traffic to other nodes is routed over the node's
+	// wireguard interface managed by cns.
+	opModeWireguard = "wireguard"
+	// opModeVxlan plumbs endpoints like transparent mode, pod traffic to other nodes is routed over the vxlan interface
+	// of the network, whose forwarding database, neighbors and routes cns keeps in sync with the cluster's nodes.
+	opModeVxlan   = "vxlan"
+	opModeDefault = opModeTunnel
+)
+
+// DefaultWireguardIfName is the wireguard interface cns brings up unless configured otherwise.
+const DefaultWireguardIfName = "azwg0"
+
+// Defaults of the vxlan interface of networks in the vxlan mode.
+const (
+	DefaultVxlanIfName = "azvxlan"
+	DefaultVxlanID     = 4096
+	DefaultVxlanPort   = 4789
+	// vxlanOverhead is the size of the outer ipv4, udp and vxlan headers and of the inner ethernet header
+	vxlanOverhead = 50
 )
 
 const (
@@ -41,6 +63,8 @@ type externalInterface struct {
 	Routes      []*route
 	IPv4Gateway net.IP
 	IPv6Gateway net.IP
+	// MTU is the mtu detected on the interface when a network was last created on it, 0 until one is
+	MTU int `json:",omitempty"`
 }
 
 // A container network is a set of endpoints allowed to communicate with each other.
@@ -56,6 +80,20 @@ type network struct {
 	EnableSnatOnHost bool
 	NetNs            string
 	SnatBridgeIP     string
+	// OVSDaemonPID is the pid of the ovs-vswitchd the flows of the network's endpoints were last verified in
+	OVSDaemonPID string `json:",omitempty"`
+	// IPVlanL3S plumbs the endpoints of the transparent network as ipvlan devices in l3s mode in place of veth pairs
+	IPVlanL3S bool `json:",omitempty"`
+	// Macvlan plumbs the endpoints of the transparent network as macvlan devices with mac addresses of their own
+	Macvlan bool `json:",omitempty"`
+	// VxlanIfName is the vxlan interface the vxlan network created and deletes with it
+	VxlanIfName string `json:",omitempty"`
+	// Recovered is set for the networks rebuilt from the endpoints found in the dataplane, which lack the configuration
+	// of the network until the next ADD in them creates them again
+	Recovered bool `json:",omitempty"`
+	// FailedAdds holds the failed ADDs of the pods without an endpoint in the network, by pod
+	FailedAdds map[string][]EndpointOperation `json:",omitempty"`
+	index      *endpointIndex
 }
 
 // NetworkInfo contains read-only information about a container network. Use EndpointInfo instead when possible.
@@ -99,6 +137,15 @@ func (nwInfo *NetworkInfo) PrettyString() string {
 		nwInfo.AdapterName, nwInfo.Mode, nwInfo.Subnets, nwInfo.PodSubnet, nwInfo.EnableSnatOnHost)
 }
 
+// linkMTU returns the mtu of the links created for a network on an external interface, the configured mtu if set, else
+// the mtu detected on the interface. 0 leaves the links at their default mtu.
+func linkMTU(configuredMTU, detectedMTU int) int {
+	if configuredMTU > 0 {
+		return configuredMTU
+	}
+	return detectedMTU
+}
+
 // NewExternalInterface adds a host interface to the list of available external interfaces.
 func (nm *networkManager) newExternalInterface(ifName, subnet, nicType string) error {
 	// Check whether the external interface is already configured.
@@ -210,6 +257,11 @@ func (nm *networkManager) newNetwork(nwInfo *EndpointInfo) (*network, error) {
 		return nil, err // nolint
 	}
 
+	// the mtu of the interface may have changed since it was added, such as with jumbo frames enabled on the sku
+	if hostIf, ifErr := net.InterfaceByName(extIf.Name); ifErr == nil {
+		extIf.MTU = hostIf.MTU
+	}
+
 	// Call the OS-specific implementation.
 	nw, err = nm.newNetworkImpl(nwInfo, extIf)
 	if err != nil {
@@ -219,11 +271,78 @@ func (nm *networkManager) newNetwork(nwInfo *EndpointInfo) (*network, error) {
 	// Add the network object.
 	nw.Subnets = nwInfo.Subnets
 	extIf.Networks[nwInfo.NetworkID] = nw
+	nw.recordUtilization()
 
 	logger.Info("Created network on interface", zap.String("id", nwInfo.NetworkID), zap.String("Name", extIf.Name))
 	return nw, nil
 }
 
+// addSubnets adds the subnets of the network info the network doesn't have yet to the network, so the address space of
+// a node can be expanded without deleting the network and its endpoints. Returns whether any subnet was added.
+func (nm *networkManager) addSubnets(nw *network, nwInfo *EndpointInfo) (bool, error) {
+	subnets := nw.newSubnets(nwInfo.Subnets)
+	if len(subnets) == 0 {
+		return false, nil
+	}
+
+	if !canAddSubnets(nw.Mode) {
+		// the endpoints keep using the subnets the network was created with, as they always did
+		logger.Info("Subnets of the network can't be changed, not adding subnets",
+			zap.String("id", nw.Id), zap.String("mode", nw.Mode), zap.Any("subnets", subnets))
+		return false, nil
+	}
+
+	logger.Info("Adding subnets to network", zap.String("id", nw.Id), zap.Any("subnets", subnets))
+	if err := nm.addSubnetsImpl(nw, nwInfo, subnets); err != nil {
+		return false, errors.Wrapf(err, "failed to add subnets to network %s", nw.Id)
+	}
+
+	// copy the subnets, as the network may share them with the network info it was created from
+	nw.Subnets = append(append(make([]SubnetInfo, 0, len(nw.Subnets)+len(subnets)), nw.Subnets...), subnets...)
+	if nw.extIf != nil {
+		for i := range subnets {
+			prefix := subnets[i].Prefix.String()
+			if nm.findExternalInterfaceBySubnet(prefix) == nil {
+				nw.extIf.Subnets = append(nw.extIf.Subnets, prefix)
+			}
+		}
+	}
+	nw.recordUtilization()
+
+	logger.Info("Added subnets to network", zap.String("id", nw.Id), zap.Any("subnets", nw.Subnets))
+	return true, nil
+}
+
+// newSubnets returns the subnets whose prefix isn't one of the subnets of the network.
+func (nw *network) newSubnets(subnets []SubnetInfo) []SubnetInfo {
+	var added []SubnetInfo
+	for i := range subnets {
+		if subnets[i].Prefix.IP == nil || nw.hasSubnet(subnets[i].Prefix) {
+			continue
+		}
+		found := false
+		for j := range added {
+			if added[j].Prefix.String() == subnets[i].Prefix.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, subnets[i])
+		}
+	}
+	return added
+}
+
+func (nw *network) hasSubnet(prefix net.IPNet) bool {
+	for i := range nw.Subnets {
+		if nw.Subnets[i].Prefix.String() == prefix.String() {
+			return true
+		}
+	}
+	return false
+}
+
 // DeleteNetwork deletes an existing container network.
 func (nm *networkManager) deleteNetwork(networkID string) error {
 	var err error
@@ -251,6 +370,7 @@ func (nm *networkManager) deleteNetwork(networkID string) error {
 	if nw.extIf != nil {
 		delete(nw.extIf.Networks, networkID)
 	}
+	nw.deleteUtilization()
 
 	logger.Info("Deleted network", zap.Any("nw", nw))
 	return nil
@@ -298,13 +418,10 @@ func (nm *networkManager) GetNumEndpointsByContainerID(containerID string) int {
 	for _, iface := range nm.ExternalInterfaces {
 		// Look through the networks
 		for _, network := range iface.Networks {
-			// Network may have multiple endpoints, so look through all of them
-			for _, endpoint := range network.Endpoints {
-				// If the netNs matches for this endpoint, return the network ID (which is the name)
-				if endpoint.ContainerID == containerID {
-					logger.Info("Found endpoint for containerID", zap.String("id", endpoint.Id), zap.String("containerID", containerID))
-					numEndpoints++
-				}
+			// Network may have multiple endpoints of the container
+			for _, endpoint := range network.getEndpointsByContainerID(containerID) {
+				logger.Info("Found endpoint for containerID", zap.String("id", endpoint.Id), zap.String("containerID", containerID))
+				numEndpoints++
 			}
 		}
 	}
@@ -313,8 +430,20 @@ func (nm *networkManager) GetNumEndpointsByContainerID(containerID string) int {
 }
 
 // Creates the network and corresponding endpoint (should be called once during Add)
-func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*EndpointInfo) error {
+func (nm *networkManager) EndpointCreate(ctx context.Context, cnsclient apipaClient, epInfos []*EndpointInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "network.EndpointCreate", attribute.Int("endpoints", len(epInfos)))
+	defer func() { tracing.End(span, err) }()
+
+	// the endpoints of an ADD are all of the same pod
+	start := time.Now()
+	defer func() {
+		if err != nil && len(epInfos) > 0 {
+			nm.recordFailedAdd(epInfos[0], start, err)
+		}
+	}()
+
 	eps := []*endpoint{} // save endpoints for stateless
+	var secondaryEpInfos []*EndpointInfo
 
 	for _, epInfo := range epInfos {
 		logger.Info("Creating endpoint and network", zap.String("endpointInfo", epInfo.PrettyString()))
@@ -336,9 +465,25 @@ func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*Endpo
 			if err != nil {
 				return err
 			}
+		} else if nm.isRecoveredNetwork(epInfo.NetworkID) {
+			// the network rebuilt from the dataplane lacks its configuration, it is created again as on the first ADD
+			if err := nm.recreateRecoveredNetwork(epInfo); err != nil {
+				return err
+			}
+		} else if epInfo.NICType == cns.InfraNIC || epInfo.NICType == "" {
+			// the address space of the node may have been expanded since the network was created
+			if _, err := nm.addNetworkSubnets(epInfo); err != nil {
+				return err
+			}
 		}
 
-		ep, err := nm.createEndpoint(cnsclient, epInfo.NetworkID, epInfo)
+		// the endpoints of the secondary interfaces are programmed together once the networks are all there
+		if isSecondaryEndpoint(epInfo) {
+			secondaryEpInfos = append(secondaryEpInfos, epInfo)
+			continue
+		}
+
+		ep, err := nm.createEndpoint(ctx, cnsclient, epInfo.NetworkID, epInfo)
 		if err != nil {
 			return err
 		}
@@ -346,10 +491,33 @@ func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*Endpo
 		eps = append(eps, ep)
 	}
 
-	if err := validateEndpoints(eps); err != nil {
+	if len(secondaryEpInfos) > 0 {
+		// the endpoints created when others failed are kept in their network, as the ones created before them are
+		secondaryEps, err := nm.createSecondaryEndpoints(ctx, cnsclient, secondaryEpInfos)
+		if err != nil {
+			return err
+		}
+		eps = append(eps, secondaryEps...)
+	}
+
+	var validationMode EndpointValidationMode
+	if len(epInfos) > 0 {
+		validationMode = epInfos[0].EndpointValidationMode
+	}
+	if err := validateEndpoints(eps, validationMode); err != nil {
+		return err
+	}
+
+	// the policy agents program the endpoints before the pod is started
+	if err := nm.notifyEndpointsCreated(ctx, eps); err != nil {
 		return err
 	}
 
 	// save endpoints
-	return nm.SaveState(eps)
+	if err := nm.SaveState(eps); err != nil {
+		return err
+	}
+
+	nm.forgetFailedAdds(epInfos)
+	return nil
 }
@@ -69,6 +69,12 @@ func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalIn
 	opt, _ := nwInfo.Options[genericData].(map[string]interface{})
 	logger.Info("opt options", zap.Any("opt", opt), zap.Any("options", nwInfo.Options))
 
+	// stateless cni creates the network on every add, and deletes endpoints without it, which only transparent
+	// networks allow
+	if nm.IsStatelessCNIMode() && nwInfo.Mode != opModeTransparent {
+		return nil, errors.Wrapf(errStatelessModeInvalid, "mode %s", nwInfo.Mode)
+	}
+
 	switch nwInfo.Mode {
 	case opModeTunnel:
 		fallthrough
@@ -82,8 +88,8 @@ func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalIn
 		if opt != nil && opt[VlanIDKey] != nil {
 			vlanid, _ = strconv.Atoi(opt[VlanIDKey].(string))
 		}
-	case opModeTransparent:
-		logger.Info("Transparent mode")
+	case opModeTransparent, opModeWireguard, opModeVxlan:
+		logger.Info("Transparent mode", zap.String("mode", nwInfo.Mode))
 		ifName = extIf.Name
 		if nwInfo.IPV6Mode != "" {
 			nu := networkutils.NewNetworkUtils(nm.netlink, nm.plClient)
@@ -115,6 +121,13 @@ func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalIn
 		return nil, err
 	}
 
+	var vxlanIfName string
+	if nwInfo.Mode == opModeVxlan {
+		if vxlanIfName, err = nm.addVxlanInterface(nwInfo, extIf); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create the network object.
 	nw := &network{
 		Id:               nwInfo.NetworkID,
@@ -123,11 +136,60 @@ func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalIn
 		extIf:            extIf,
 		VlanId:           vlanid,
 		EnableSnatOnHost: nwInfo.EnableSnatOnHost,
+		IPVlanL3S:        nwInfo.EnableIPVlanL3S && nwInfo.Mode == opModeTransparent,
+		Macvlan:          nwInfo.EnableMacvlan && !nwInfo.EnableIPVlanL3S && nwInfo.Mode == opModeTransparent,
+		VxlanIfName:      vxlanIfName,
 	}
 
 	return nw, nil
 }
 
+// canAddSubnets returns whether subnets can be added to the networks of the mode once they are created.
+func canAddSubnets(mode string) bool {
+	switch mode {
+	case opModeBridge, opModeTunnel, opModeTransparent:
+		return true
+	default:
+		return false
+	}
+}
+
+// addSubnetsImpl programs the subnets added to an existing network. The host reaches the endpoints of the new subnets
+// of a bridge network through the bridge, the ipv6 nat gateways of the new subnets are assigned to it as well. The
+// endpoints of transparent networks are reached through their own host routes, which only need ip forwarding.
+func (nm *networkManager) addSubnetsImpl(nw *network, nwInfo *EndpointInfo, subnets []SubnetInfo) error {
+	switch nw.Mode {
+	case opModeBridge, opModeTunnel:
+		if nw.extIf == nil || nw.extIf.BridgeName == "" {
+			return errors.Errorf("network %s is not connected to a bridge", nw.Id)
+		}
+		routes := make([]RouteInfo, 0, len(subnets))
+		for i := range subnets {
+			routes = append(routes, RouteInfo{Dst: subnets[i].Prefix, Scope: netlink.RT_SCOPE_LINK})
+		}
+		if err := addRoutes(nm.netlink, nm.netio, nw.extIf.BridgeName, routes); err != nil {
+			return errors.Wrap(err, "failed to add subnet routes to bridge")
+		}
+		if nwInfo.IPV6Mode == IPV6Nat {
+			return nm.addIpv6NatGateway(nw.extIf.BridgeName, subnets)
+		}
+	case opModeTransparent:
+		if nwInfo.IPV6Mode == "" {
+			return nil
+		}
+		for i := range subnets {
+			if subnets[i].Family == platform.AfINET6 {
+				nu := networkutils.NewNetworkUtils(nm.netlink, nm.plClient)
+				if err := nu.EnableIPV6Forwarding(); err != nil {
+					return errors.Wrap(err, "ipv6 forwarding failed")
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
 func (nm *networkManager) handleCommonOptions(ifName string, nwInfo *EndpointInfo) error {
 	var err error
 	if routes, exists := nwInfo.Options[RoutesKey]; exists {
@@ -147,6 +209,55 @@ func (nm *networkManager) handleCommonOptions(ifName string, nwInfo *EndpointInf
 	return nil
 }
 
+// addVxlanInterface adds the vxlan interface of the network over the external interface, unless a previous ADD
+// did. It only has the forwarding database entries of the other nodes cns gives it, so the pod traffic it
+// carries reaches the other nodes only once cns has synced them.
+func (nm *networkManager) addVxlanInterface(nwInfo *EndpointInfo, extIf *externalInterface) (string, error) {
+	link := &netlink.VxlanLink{
+		LinkInfo: netlink.LinkInfo{
+			Type: netlink.LINK_TYPE_VXLAN,
+			Name: nwInfo.VxlanIfName,
+		},
+		VxlanID: nwInfo.VxlanID,
+		Port:    nwInfo.VxlanPort,
+	}
+	if link.Name == "" {
+		link.Name = DefaultVxlanIfName
+	}
+	if link.VxlanID == 0 {
+		link.VxlanID = DefaultVxlanID
+	}
+	if link.Port == 0 {
+		link.Port = DefaultVxlanPort
+	}
+
+	if _, err := nm.netio.GetNetworkInterfaceByName(link.Name); err == nil {
+		logger.Info("Vxlan interface exists", zap.String("name", link.Name))
+		return link.Name, nil
+	}
+
+	parent, err := nm.netio.GetNetworkInterfaceByName(extIf.Name)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get interface %s", extIf.Name)
+	}
+	link.ParentIndex = parent.Index
+	link.MTU = uint(parent.MTU - vxlanOverhead)
+
+	logger.Info("Adding vxlan interface", zap.String("name", link.Name), zap.Int("vni", link.VxlanID),
+		zap.Int("port", link.Port), zap.String("parent", extIf.Name))
+	if err := nm.netlink.AddLink(link); err != nil {
+		return "", errors.Wrapf(err, "failed to add vxlan interface %s", link.Name)
+	}
+	if err := nm.netlink.SetLinkState(link.Name, true); err != nil {
+		if delErr := nm.netlink.DeleteLink(link.Name); delErr != nil {
+			logger.Error("Failed to delete vxlan interface", zap.String("name", link.Name), zap.Error(delErr))
+		}
+		return "", errors.Wrapf(err, "failed to set vxlan interface %s up", link.Name)
+	}
+
+	return link.Name, nil
+}
+
 // DeleteNetworkImpl deletes an existing container network.
 func (nm *networkManager) deleteNetworkImpl(nw *network, _ cns.NICType) error {
 	var networkClient NetworkClient
@@ -157,6 +268,23 @@ func (nm *networkManager) deleteNetworkImpl(nw *network, _ cns.NICType) error {
 		networkClient = NewLinuxBridgeClient(nw.extIf.BridgeName, nw.extIf.Name, EndpointInfo{}, nm.netlink, nm.plClient)
 	}
 
+	// the endpoints of the network are gone, and the host no longer needs to reach them
+	if nw.IPVlanL3S {
+		if err := nm.netlink.DeleteLink(ipvlanHostIfName); err != nil {
+			logger.Error("Failed to delete host ipvlan device", zap.Error(err))
+		}
+	}
+	if nw.Macvlan {
+		if err := nm.netlink.DeleteLink(macvlanHostIfName); err != nil {
+			logger.Error("Failed to delete host macvlan device", zap.Error(err))
+		}
+	}
+	if nw.VxlanIfName != "" {
+		if err := nm.netlink.DeleteLink(nw.VxlanIfName); err != nil {
+			logger.Error("Failed to delete vxlan interface", zap.String("name", nw.VxlanIfName), zap.Error(err))
+		}
+	}
+
 	// Disconnect the interface if this was the last network using it.
 	if len(nw.extIf.Networks) == 1 {
 		nm.disconnectExternalInterface(nw.extIf, networkClient)
@@ -165,6 +293,11 @@ func (nm *networkManager) deleteNetworkImpl(nw *network, _ cns.NICType) error {
 	return nil
 }
 
+// deleteDelegatedNetwork is a no-op on linux, where delegated nics are moved into the pod without a network of their own.
+func (*networkManager) deleteDelegatedNetwork(_ *network, _ cns.NICType) error {
+	return nil
+}
+
 // SaveIPConfig saves the IP configuration of an interface.
 func (nm *networkManager) saveIPConfig(hostIf *net.Interface, extIf *externalInterface) error {
 	// Save the default routes on the interface.
@@ -601,7 +734,7 @@ func (nm *networkManager) connectExternalInterface(extIf *externalInterface, nwI
 
 	if nwInfo.IPV6Mode == IPV6Nat {
 		// adds pod cidr gateway ip to bridge
-		if err = nm.addIpv6NatGateway(nwInfo); err != nil {
+		if err = nm.addIpv6NatGateway(nwInfo.BridgeName, nwInfo.Subnets); err != nil {
 			logger.Error("Adding IPv6 Nat Gateway failed with", zap.Error(err))
 			return err
 		}
@@ -651,29 +784,43 @@ func (nm *networkManager) disconnectExternalInterface(extIf *externalInterface,
 	logger.Info("Disconnected interface", zap.String("Name", extIf.Name))
 }
 
+// addToIptables programs the iptables rules with a transaction per ip version, so they are either all programmed or
+// none are.
 func (nm *networkManager) addToIptables(cmds []iptables.IPTableEntry) error {
 	logger.Info("Adding additional iptable rules...")
+	txs := map[string]*iptables.Transaction{
+		iptables.V4: iptables.NewTransaction(iptables.V4),
+		iptables.V6: iptables.NewTransaction(iptables.V6),
+	}
 	for _, cmd := range cmds {
-		err := nm.iptablesClient.RunCmd(cmd.Version, cmd.Params)
-		if err != nil {
+		tx, ok := txs[cmd.Version]
+		if !ok {
+			return errors.Errorf("unknown iptables version %q of %q", cmd.Version, cmd.Params)
+		}
+		if err := tx.Add(cmd); err != nil {
+			return errors.Wrapf(err, "failed to add iptables rule %+v", cmd)
+		}
+	}
+	for _, version := range []string{iptables.V4, iptables.V6} {
+		if err := nm.iptablesClient.Commit(txs[version]); err != nil {
 			return err
 		}
-		logger.Info("Successfully run iptables rule", zap.Any("cmd", cmd))
 	}
+	logger.Info("Successfully programmed iptables rules", zap.Any("cmds", cmds))
 	return nil
 }
 
 // Add ipv6 nat gateway IP on bridge
-func (nm *networkManager) addIpv6NatGateway(nwInfo *EndpointInfo) error {
+func (nm *networkManager) addIpv6NatGateway(bridgeName string, subnets []SubnetInfo) error {
 	logger.Info("Adding ipv6 nat gateway on azure bridge")
-	for _, subnetInfo := range nwInfo.Subnets {
+	for _, subnetInfo := range subnets {
 		if subnetInfo.Family == platform.AfINET6 {
 			ipAddr := []net.IPNet{{
 				IP:   subnetInfo.Gateway,
 				Mask: subnetInfo.Prefix.Mask,
 			}}
 			nuc := networkutils.NewNetworkUtils(nm.netlink, nm.plClient)
-			err := nuc.AssignIPToInterface(nwInfo.BridgeName, ipAddr)
+			err := nuc.AssignIPToInterface(bridgeName, ipAddr)
 			if err != nil {
 				return newErrorNetworkManager(err.Error())
 			}
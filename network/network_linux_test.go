@@ -0,0 +1,180 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddNetworkSubnets(t *testing.T) {
+	subnet := func(prefix string) SubnetInfo {
+		_, ipNet, _ := net.ParseCIDR(prefix)
+		return SubnetInfo{Family: platform.AfINET, Prefix: *ipNet}
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		subnets     []SubnetInfo
+		wantSubnets []string
+		wantRoutes  []string
+		routeErr    bool
+		wantErr     bool
+	}{
+		{
+			name:        "bridge network gets a route to the new subnet on the bridge",
+			mode:        opModeBridge,
+			subnets:     []SubnetInfo{subnet("10.0.0.0/24"), subnet("10.1.0.0/24")},
+			wantSubnets: []string{"10.0.0.0/24", "10.1.0.0/24"},
+			wantRoutes:  []string{"10.1.0.0/24"},
+		},
+		{
+			name:        "transparent network needs no route",
+			mode:        opModeTransparent,
+			subnets:     []SubnetInfo{subnet("10.1.0.0/24")},
+			wantSubnets: []string{"10.0.0.0/24", "10.1.0.0/24"},
+		},
+		{
+			name:        "subnets the network has are not added again",
+			mode:        opModeBridge,
+			subnets:     []SubnetInfo{subnet("10.0.0.0/24")},
+			wantSubnets: []string{"10.0.0.0/24"},
+		},
+		{
+			name:        "subnets of transparent vlan networks can't be changed",
+			mode:        opModeTransparentVlan,
+			subnets:     []SubnetInfo{subnet("10.1.0.0/24")},
+			wantSubnets: []string{"10.0.0.0/24"},
+		},
+		{
+			name:        "subnet isn't added when its route fails",
+			mode:        opModeBridge,
+			subnets:     []SubnetInfo{subnet("10.1.0.0/24")},
+			wantSubnets: []string{"10.0.0.0/24"},
+			routeErr:    true,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nl := netlink.NewMockNetlink(tt.routeErr, "route failed")
+			var routes []string
+			nl.SetAddRouteValidationFn(func(r *netlink.Route) error {
+				if tt.routeErr {
+					return netlink.ErrorMockNetlink
+				}
+				assert.Equal(t, netlink.RT_SCOPE_LINK, r.Scope)
+				routes = append(routes, r.Dst.String())
+				return nil
+			})
+
+			extIf := &externalInterface{
+				Name:       "eth0",
+				BridgeName: "azure0",
+				Subnets:    []string{"10.0.0.0/24"},
+				Networks:   map[string]*network{},
+			}
+			nw := &network{
+				Id:        "azure",
+				Mode:      tt.mode,
+				Subnets:   []SubnetInfo{subnet("10.0.0.0/24")},
+				Endpoints: map[string]*endpoint{},
+				extIf:     extIf,
+			}
+			extIf.Networks[nw.Id] = nw
+			nm := &networkManager{
+				ExternalInterfaces: map[string]*externalInterface{extIf.Name: extIf},
+				netlink:            nl,
+				netio:              netio.NewMockNetIO(false, 0),
+				plClient:           platform.NewMockExecClient(false),
+			}
+
+			err := nm.AddNetworkSubnets(&EndpointInfo{NetworkID: nw.Id, Subnets: tt.subnets})
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var got []string
+			for i := range nw.Subnets {
+				got = append(got, nw.Subnets[i].Prefix.String())
+			}
+			assert.Equal(t, tt.wantSubnets, got)
+			assert.Equal(t, tt.wantSubnets, extIf.Subnets)
+			assert.Equal(t, tt.wantRoutes, routes)
+		})
+	}
+}
+
+func TestAddVxlanInterface(t *testing.T) {
+	tests := []struct {
+		name     string
+		nwInfo   *EndpointInfo
+		exists   bool
+		wantName string
+		wantLink *netlink.VxlanLink
+	}{
+		{
+			name:     "defaults",
+			nwInfo:   &EndpointInfo{Mode: opModeVxlan},
+			wantName: DefaultVxlanIfName,
+			wantLink: &netlink.VxlanLink{
+				LinkInfo: netlink.LinkInfo{Type: netlink.LINK_TYPE_VXLAN, Name: DefaultVxlanIfName, MTU: 1450, ParentIndex: 2},
+				VxlanID:  DefaultVxlanID,
+				Port:     DefaultVxlanPort,
+			},
+		},
+		{
+			name:     "configured interface",
+			nwInfo:   &EndpointInfo{Mode: opModeVxlan, VxlanIfName: "vxlan1", VxlanID: 1, VxlanPort: 8472},
+			wantName: "vxlan1",
+			wantLink: &netlink.VxlanLink{
+				LinkInfo: netlink.LinkInfo{Type: netlink.LINK_TYPE_VXLAN, Name: "vxlan1", MTU: 1450, ParentIndex: 2},
+				VxlanID:  1,
+				Port:     8472,
+			},
+		},
+		{
+			name:     "interface of a previous add is kept",
+			nwInfo:   &EndpointInfo{Mode: opModeVxlan},
+			exists:   true,
+			wantName: DefaultVxlanIfName,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nl := netlink.NewMockNetlink(false, "")
+			var added *netlink.VxlanLink
+			nl.AddLinkFn = func(l netlink.Link) error {
+				added = l.(*netlink.VxlanLink)
+				return nil
+			}
+			nioc := netio.NewMockNetIO(false, 0)
+			nioc.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+				if name == "eth0" {
+					return &net.Interface{Name: name, Index: 2, MTU: 1500}, nil
+				}
+				if tt.exists {
+					return &net.Interface{Name: name}, nil
+				}
+				return nil, netio.ErrMockNetIOFail
+			})
+			nm := &networkManager{netlink: nl, netio: nioc, plClient: platform.NewMockExecClient(false)}
+
+			name, err := nm.addVxlanInterface(tt.nwInfo, &externalInterface{Name: "eth0"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantLink, added)
+		})
+	}
+}
@@ -4,19 +4,21 @@
 package network
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/netroute"
 	"github.com/Azure/azure-container-networking/network/hnswrapper"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Microsoft/hcsshim"
 	"github.com/Microsoft/hcsshim/hcn"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -33,10 +35,6 @@ const (
 	ifNamePrefix = "vEthernet"
 	// ipv4 default hop
 	ipv4DefaultHop = "0.0.0.0"
-	// ipv6 default hop
-	ipv6DefaultHop = "::"
-	// ipv6 route cmd
-	routeCmd = "netsh interface ipv6 %s route \"%s\" \"%s\" \"%s\" store=persistent"
 	// add/delete ipv4 and ipv6 route rules to/from windows node
 	netRouteCmd = "netsh interface %s %s route \"%s\" \"%s\" \"%s\""
 	// Default IPv6 Route
@@ -48,29 +46,15 @@ const (
 // Windows implementation of route.
 type route interface{}
 
-// UseHnsV2 indicates whether to use HNSv1 or HNSv2
-// HNSv2 should be used if the NetNs is a valid GUID and if the platform
-// has HCN which supports HNSv2 API.
-func UseHnsV2(netNs string) (bool, error) {
-	// Check if the netNs is a valid GUID to decide on HNSv1 or HNSv2
-	useHnsV2 := false
-	var err error
-	if _, err = uuid.Parse(netNs); err == nil {
-		useHnsV2 = true
-		if err = Hnsv2.HNSV2Supported(); err != nil {
-			logger.Info("HNSV2 is not supported on this windows platform")
-		}
-	}
-
-	return useHnsV2, err
-}
-
 // Regarding this Hnsv2 and Hnv1 variable
 // this pattern is to avoid passing around os specific objects in platform agnostic code
 var Hnsv2 hnswrapper.HnsV2WrapperInterface = hnswrapper.Hnsv2wrapper{}
 
 var Hnsv1 hnswrapper.HnsV1WrapperInterface = hnswrapper.Hnsv1wrapper{}
 
+// NetRoute programs the host route and neighbor tables, following the same pattern as Hnsv2 and Hnsv1
+var NetRoute netroute.NetRouteInterface = &netroute.NetRoute{}
+
 func EnableHnsV2Timeout(timeoutValue int) {
 	if _, ok := Hnsv2.(hnswrapper.Hnsv2wrapperwithtimeout); !ok {
 		timeoutDuration := time.Duration(timeoutValue) * time.Second
@@ -160,6 +144,8 @@ func (nm *networkManager) newNetworkImplHnsV1(nwInfo *EndpointInfo, extIf *exter
 		return nil, err
 	}
 
+	nm.setHostVNICMTU(nwInfo, extIf)
+
 	// Create the network object.
 	nw := &network{
 		Id:               nwInfo.NetworkID,
@@ -186,40 +172,82 @@ func (nm *networkManager) newNetworkImplHnsV1(nwInfo *EndpointInfo, extIf *exter
 }
 
 func (nm *networkManager) appIPV6RouteEntry(nwInfo *EndpointInfo) error {
-	var (
-		err error
-		out string
-	)
+	if nwInfo.IPV6Mode != IPV6Nat {
+		return nil
+	}
 
-	if nwInfo.IPV6Mode == IPV6Nat {
-		if len(nwInfo.Subnets) < 2 {
-			return fmt.Errorf("Ipv6 subnet not found in network state")
-		}
+	if len(nwInfo.Subnets) < 2 {
+		return fmt.Errorf("Ipv6 subnet not found in network state")
+	}
 
-		// get interface name of VM adapter
-		ifName := nwInfo.MasterIfName
-		if !strings.Contains(nwInfo.MasterIfName, ifNamePrefix) {
-			ifName = fmt.Sprintf("%s (%s)", ifNamePrefix, nwInfo.MasterIfName)
-		}
+	// get interface name of VM adapter
+	ifName := nwInfo.MasterIfName
+	if !strings.Contains(nwInfo.MasterIfName, ifNamePrefix) {
+		ifName = fmt.Sprintf("%s (%s)", ifNamePrefix, nwInfo.MasterIfName)
+	}
 
-		cmd := fmt.Sprintf(routeCmd, "delete", nwInfo.Subnets[1].Prefix.String(),
-			ifName, ipv6DefaultHop)
-		if out, err = nm.plClient.ExecuteRawCommand(cmd); err != nil {
-			logger.Error("Deleting ipv6 route failed", zap.Any("out", out), zap.Error(err))
-		}
+	prefix, err := netip.ParsePrefix(nwInfo.Subnets[1].Prefix.String())
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse ipv6 subnet %s", nwInfo.Subnets[1].Prefix.String())
+	}
 
-		cmd = fmt.Sprintf(routeCmd, "add", nwInfo.Subnets[1].Prefix.String(),
-			ifName, ipv6DefaultHop)
-		if out, err = nm.plClient.ExecuteRawCommand(cmd); err != nil {
-			logger.Error("Adding ipv6 route failed", zap.Any("out", out), zap.Error(err))
-		}
+	route := &netroute.Route{
+		Interface:   ifName,
+		Destination: prefix.Masked(),
+		NextHop:     netip.IPv6Unspecified(),
+	}
+
+	// replace any stale route for the pod cidr
+	if err = NetRoute.DeleteRoute(route); err != nil && !errors.Is(err, netroute.ErrRouteNotFound) {
+		logger.Error("Deleting ipv6 route failed", zap.Stringer("route", route), zap.Error(err))
+	}
+
+	if err = NetRoute.AddRoute(route); err != nil {
+		logger.Error("Adding ipv6 route failed", zap.Stringer("route", route), zap.Error(err))
 	}
 
 	return err
 }
 
+// setHostVNICMTU sets the mtu of the network on the host vnic of the vswitch hns creates on the adapter, which hns
+// leaves at 1500 even when the adapter has jumbo frames enabled. A failure is logged, the network works at 1500.
+func (nm *networkManager) setHostVNICMTU(nwInfo *EndpointInfo, extIf *externalInterface) {
+	mtu := linkMTU(nwInfo.MTU, extIf.MTU)
+	if mtu <= 0 {
+		return
+	}
+
+	ifName := extIf.Name
+	if nwInfo.AdapterName != "" {
+		ifName = nwInfo.AdapterName
+	}
+	if !strings.HasPrefix(ifName, vEthernetAdapterPrefix) {
+		ifName = fmt.Sprintf("%s (%s)", vEthernetAdapterPrefix, ifName)
+	}
+	families := []string{"ipv4"}
+	for i := range nwInfo.Subnets {
+		if nwInfo.Subnets[i].Family == platform.AfINET6 {
+			families = append(families, "ipv6")
+			break
+		}
+	}
+	for _, family := range families {
+		// netsh interface ipv4 set subinterface "vEthernet (Ethernet)" mtu=9000 store=persistent
+		args := []string{"interface", family, "set", "subinterface", ifName, "mtu=" + strconv.Itoa(mtu), "store=persistent"}
+		if _, err := nm.plClient.ExecuteCommand(context.TODO(), netshCmd, args...); err != nil {
+			logger.Error("Failed to set mtu of host vnic", zap.String("ifName", ifName), zap.String("family", family),
+				zap.Int("mtu", mtu), zap.Error(err))
+		}
+	}
+}
+
 // configureHcnEndpoint configures hcn endpoint for creation
 func (nm *networkManager) configureHcnNetwork(nwInfo *EndpointInfo, extIf *externalInterface) (*hcn.HostComputeNetwork, error) {
+	schemaVersion, err := hcnSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize HNS network.
 	hcnNetwork := &hcn.HostComputeNetwork{
 		Name: nwInfo.NetworkID,
@@ -229,10 +257,7 @@ func (nm *networkManager) configureHcnNetwork(nwInfo *EndpointInfo, extIf *exter
 				Type: hcnIpamTypeStatic,
 			},
 		},
-		SchemaVersion: hcn.SchemaVersion{
-			Major: hcnSchemaVersionMajor,
-			Minor: hcnSchemaVersionMinor,
-		},
+		SchemaVersion: schemaVersion,
 	}
 
 	// Set hcn network adaptor name policy
@@ -267,7 +292,6 @@ func (nm *networkManager) configureHcnNetwork(nwInfo *EndpointInfo, extIf *exter
 
 	opt, _ := nwInfo.Options[genericData].(map[string]interface{})
 	if opt != nil && opt[VlanIDKey] != nil {
-		var err error
 		vlanID, _ := strconv.ParseUint(opt[VlanIDKey].(string), baseDecimal, bitSize)
 		subnetPolicy, err = policy.SerializeHcnSubnetVlanPolicy((uint32)(vlanID))
 		if err != nil {
@@ -280,7 +304,7 @@ func (nm *networkManager) configureHcnNetwork(nwInfo *EndpointInfo, extIf *exter
 
 	// AccelnetNIC flag: hcn.EnableIov(9216) - treat Delegated/FrontendNIC also the same as Accelnet
 	// For L1VH with accelnet, hcn.DisableHostPort and hcn.EnableIov must be configured
-	if nwInfo.NICType == cns.NodeNetworkInterfaceFrontendNIC {
+	if nwInfo.NICType.IsFrontendNIC() {
 		hcnNetwork.Type = hcn.Transparent
 		// set transparent network as non-persistent so that networks will be gone after the node gets rebooted
 		// hcnNetwork.flags = hcn.DisableHostPort | hcn.EnableIov | hcn.EnableNonPersistent (1024 + 8192 + 8 = 9224)
@@ -390,6 +414,8 @@ func (nm *networkManager) newNetworkImplHnsV2(nwInfo *EndpointInfo, extIf *exter
 		}
 	}
 
+	nm.setHostVNICMTU(nwInfo, extIf)
+
 	var vlanid int
 	opt, _ := nwInfo.Options[genericData].(map[string]interface{})
 	if opt != nil && opt[VlanIDKey] != nil {
@@ -416,6 +442,15 @@ func (nm *networkManager) newNetworkImplHnsV2(nwInfo *EndpointInfo, extIf *exter
 
 // NewNetworkImpl creates a new container network.
 func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalInterface) (*network, error) {
+	if nwInfo.Mode == opModeWireguard {
+		// cns does not bring up a wireguard interface on windows, fail rather than leave pod traffic unencrypted
+		return nil, errors.Wrap(errNetworkModeInvalid, "wireguard mode is not supported on windows")
+	}
+	if nwInfo.Mode == opModeVxlan {
+		// cns does not sync the vxlan interfaces of windows nodes
+		return nil, errors.Wrap(errNetworkModeInvalid, "vxlan mode is not supported on windows")
+	}
+
 	if useHnsV2, err := UseHnsV2(nwInfo.NetNs); useHnsV2 {
 		if err != nil {
 			return nil, err
@@ -427,7 +462,7 @@ func (nm *networkManager) newNetworkImpl(nwInfo *EndpointInfo, extIf *externalIn
 
 // DeleteNetworkImpl deletes an existing container network.
 func (nm *networkManager) deleteNetworkImpl(nw *network, nicType cns.NICType) error {
-	if nicType != cns.NodeNetworkInterfaceFrontendNIC { //nolint
+	if !nicType.IsFrontendNIC() { //nolint
 		return nil
 	}
 
@@ -442,6 +477,28 @@ func (nm *networkManager) deleteNetworkImpl(nw *network, nicType cns.NICType) er
 	return nm.deleteNetworkImplHnsV1(nw)
 }
 
+// deleteDelegatedNetwork deletes the transparent network of a delegated nic once its last endpoint is deleted. The
+// network is created per nic, so it would otherwise outlive the nic being detached from the node.
+func (nm *networkManager) deleteDelegatedNetwork(nw *network, nicType cns.NICType) error {
+	if !nicType.IsFrontendNIC() || len(nw.Endpoints) > 0 {
+		return nil
+	}
+
+	if err := nm.deleteNetworkImpl(nw, nicType); err != nil {
+		return errors.Wrapf(err, "failed to delete network %s of delegated nic", nw.Id)
+	}
+
+	if nw.extIf != nil {
+		delete(nw.extIf.Networks, nw.Id)
+		if len(nw.extIf.Networks) == 0 {
+			delete(nm.ExternalInterfaces, nw.extIf.Name)
+		}
+	}
+
+	logger.Info("Deleted network of delegated nic", zap.String("networkID", nw.Id))
+	return nil
+}
+
 // DeleteNetworkImplHnsV1 deletes an existing container network using HnsV1.
 func (nm *networkManager) deleteNetworkImplHnsV1(nw *network) error {
 	logger.Info("HNSNetworkRequest DELETE id", zap.String("id", nw.HnsId))
@@ -458,6 +515,11 @@ func (nm *networkManager) deleteNetworkImplHnsV2(nw *network) error {
 	logger.Info("Deleting hcn network with id", zap.String("id", nw.HnsId))
 
 	if hcnNetwork, err = Hnsv2.GetNetworkByID(nw.HnsId); err != nil {
+		// the network of a delegated nic is gone with the nic or a reboot, a stateless DEL finds it in CNS nonetheless
+		if errors.As(err, &hcn.NetworkNotFoundError{}) {
+			logger.Info("hcn network is already deleted", zap.String("id", nw.HnsId))
+			return nil
+		}
 		return fmt.Errorf("Failed to get hcn network with id: %s due to err: %v", nw.HnsId, err)
 	}
 
@@ -472,3 +534,25 @@ func (nm *networkManager) deleteNetworkImplHnsV2(nw *network) error {
 
 func getNetworkInfoImpl(_ *EndpointInfo, _ *network) {
 }
+
+// canAddSubnets returns false, the subnets of hns networks can't be changed once they are created.
+func canAddSubnets(string) bool {
+	return false
+}
+
+// addSubnetsImpl is never called on windows, see canAddSubnets.
+func (*networkManager) addSubnetsImpl(nw *network, _ *EndpointInfo, _ []SubnetInfo) error {
+	return errors.Errorf("subnets can't be added to hns network %s", nw.Id)
+}
+
+// CheckOVSHealth has nothing to check on windows, which has no ovs datapath.
+func (*networkManager) CheckOVSHealth(string) ([]string, error) {
+	return nil, nil
+}
+
+// CheckEthtoolSettings has nothing to check on windows, whose endpoints have no ethtool settings.
+func (*networkManager) CheckEthtoolSettings(string) ([]string, error) {
+	return nil, nil
+}
+
+func (*networkManager) reinstallOVSFlowsOnRestart() {}
@@ -10,14 +10,17 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/netroute"
 	"github.com/Azure/azure-container-networking/network/hnswrapper"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -596,3 +599,156 @@ func TestConfigureHCNNetworkSwiftv2DelegatedNIC(t *testing.T) {
 		t.Fatalf("host network flags is not configured as %v when interface NIC type is delegatedVMNIC", expectedSwifv2NetworkFlags)
 	}
 }
+
+func TestAppIPV6RouteEntry(t *testing.T) {
+	fake := netroute.NewMockNetRoute(false, 0)
+	NetRoute = fake
+	defer func() { NetRoute = &netroute.NetRoute{} }()
+
+	nm := &networkManager{}
+	_, v4Subnet, _ := net.ParseCIDR("10.240.0.0/16")
+	_, v6Subnet, _ := net.ParseCIDR("fd00:abcd::/64")
+	nwInfo := &EndpointInfo{
+		MasterIfName: "eth0",
+		IPV6Mode:     IPV6Nat,
+		Subnets: []SubnetInfo{
+			{Prefix: *v4Subnet},
+			{Prefix: *v6Subnet},
+		},
+	}
+	want := netroute.Route{
+		Interface:   "vEthernet (eth0)",
+		Destination: netip.MustParsePrefix("fd00:abcd::/64"),
+		NextHop:     netip.IPv6Unspecified(),
+	}
+
+	// the route is added when missing and replaced when present
+	for i := 0; i < 2; i++ {
+		require.NoError(t, nm.appIPV6RouteEntry(nwInfo))
+		routes, err := fake.GetRoutes("")
+		require.NoError(t, err)
+		require.Equal(t, []netroute.Route{want}, routes)
+	}
+
+	// the route is only programmed for ipv6 nat
+	nwInfo.IPV6Mode = ""
+	require.NoError(t, fake.DeleteRoute(&want))
+	require.NoError(t, nm.appIPV6RouteEntry(nwInfo))
+	routes, err := fake.GetRoutes("")
+	require.NoError(t, err)
+	require.Empty(t, routes)
+}
+
+func TestAppIPV6RouteEntryAddFailure(t *testing.T) {
+	// the first call deletes the stale route, the second call adds the route
+	NetRoute = netroute.NewMockNetRoute(true, 2)
+	defer func() { NetRoute = &netroute.NetRoute{} }()
+
+	nm := &networkManager{}
+	_, v6Subnet, _ := net.ParseCIDR("fd00:abcd::/64")
+	nwInfo := &EndpointInfo{
+		MasterIfName: "vEthernet (eth0)",
+		IPV6Mode:     IPV6Nat,
+		Subnets:      []SubnetInfo{{}, {Prefix: *v6Subnet}},
+	}
+
+	require.ErrorIs(t, nm.appIPV6RouteEntry(nwInfo), netroute.ErrMockNetRouteFail)
+}
+
+func TestDeleteDelegatedNetwork(t *testing.T) {
+	hnsFake := hnswrapper.NewHnsv2wrapperFake()
+	Hnsv2 = hnsFake
+
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{},
+	}
+
+	nwInfo := &EndpointInfo{
+		NetworkID:    "azure-60:45:bd:12:45:65",
+		MasterIfName: "Ethernet 3",
+		NetNs:        dummyGUID,
+		NICType:      cns.NodeNetworkInterfaceFrontendNIC,
+	}
+	extIf := &externalInterface{
+		Name:     "Ethernet 3",
+		Networks: map[string]*network{},
+	}
+	nm.ExternalInterfaces[extIf.Name] = extIf
+
+	nw, err := nm.newNetworkImplHnsV2(nwInfo, extIf)
+	require.NoError(t, err)
+	nw.Endpoints = map[string]*endpoint{"ep": {Id: "ep"}}
+	extIf.Networks[nw.Id] = nw
+
+	// the network is kept while it has endpoints
+	require.NoError(t, nm.deleteDelegatedNetwork(nw, cns.NodeNetworkInterfaceFrontendNIC))
+	require.Len(t, hnsFake.Cache.GetNetworks(), 1)
+
+	// infra networks are shared by the node's pods and are kept
+	delete(nw.Endpoints, "ep")
+	require.NoError(t, nm.deleteDelegatedNetwork(nw, cns.InfraNIC))
+	require.Len(t, hnsFake.Cache.GetNetworks(), 1)
+
+	require.NoError(t, nm.deleteDelegatedNetwork(nw, cns.NodeNetworkInterfaceFrontendNIC))
+	require.Empty(t, hnsFake.Cache.GetNetworks())
+	require.Empty(t, nm.ExternalInterfaces)
+}
+
+func TestSetHostVNICMTU(t *testing.T) {
+	_, ipnetv4, _ := net.ParseCIDR("10.240.0.0/12")
+	_, ipnetv6, _ := net.ParseCIDR("fc00::/64")
+
+	tests := []struct {
+		name     string
+		nwInfo   *EndpointInfo
+		extIf    *externalInterface
+		wantArgs []string
+	}{
+		{
+			name:   "no mtu detected or configured",
+			nwInfo: &EndpointInfo{},
+			extIf:  &externalInterface{Name: "Ethernet"},
+		},
+		{
+			name:   "detected jumbo frames on ipv4",
+			nwInfo: &EndpointInfo{Subnets: []SubnetInfo{{Family: platform.AfINET, Prefix: *ipnetv4}}},
+			extIf:  &externalInterface{Name: "Ethernet", MTU: 9000},
+			wantArgs: []string{
+				"interface ipv4 set subinterface vEthernet (Ethernet) mtu=9000 store=persistent",
+			},
+		},
+		{
+			name: "configured mtu on dualstack adapter",
+			nwInfo: &EndpointInfo{
+				MTU:         3900,
+				AdapterName: "vEthernet (Ethernet 2)",
+				Subnets: []SubnetInfo{
+					{Family: platform.AfINET, Prefix: *ipnetv4},
+					{Family: platform.AfINET6, Prefix: *ipnetv6},
+				},
+			},
+			extIf: &externalInterface{Name: "Ethernet", MTU: 9000},
+			wantArgs: []string{
+				"interface ipv4 set subinterface vEthernet (Ethernet 2) mtu=3900 store=persistent",
+				"interface ipv6 set subinterface vEthernet (Ethernet 2) mtu=3900 store=persistent",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgs []string
+			plClient := platform.NewMockExecClient(false)
+			plClient.SetExecCommand(func(cmd string, args ...string) (string, error) {
+				require.Equal(t, netshCmd, cmd)
+				gotArgs = append(gotArgs, strings.Join(args, " "))
+				return "", nil
+			})
+			nm := &networkManager{plClient: plClient}
+
+			nm.setHostVNICMTU(tt.nwInfo, tt.extIf)
+			require.Equal(t, tt.wantArgs, gotArgs)
+		})
+	}
+}
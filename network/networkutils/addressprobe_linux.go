@@ -0,0 +1,169 @@
+//go:build linux
+// +build linux
+
+package networkutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	arpOpRequest = 1
+	arpOpReply   = 2
+
+	icmpv6NeighborSolicitation  = 135
+	icmpv6NeighborAdvertisement = 136
+	ipv6HeaderLen               = 40
+	ndpHopLimit                 = 255
+)
+
+// ProbeAddress probes the link of the interface for the hosts using the ip, the way duplicate address detection does:
+// with an arp probe for an ipv4 address (RFC 5227) and a neighbor solicitation from the unspecified address for an ipv6
+// address (RFC 4862). It returns the macs of the hosts which answered within the timeout, none when the ip is free.
+func ProbeAddress(ifName string, ip net.IP, timeout time.Duration) ([]net.HardwareAddr, error) {
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find interface %s", ifName)
+	}
+
+	protocol, dstMac, probe, isAnswer := uint16(unix.ETH_P_ARP), broadcastMac, arpRequest(iface.HardwareAddr, net.IPv4zero, ip), isARPAnswer
+	if ip.To4() == nil {
+		protocol, dstMac, probe, isAnswer = unix.ETH_P_IPV6, solicitedNodeMac(ip), neighborSolicitation(ip), isNeighborAdvertisement
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(htons(protocol)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open probe socket")
+	}
+	defer unix.Close(fd)
+
+	addr := unix.SockaddrLinklayer{
+		Ifindex:  iface.Index,
+		Protocol: htons(protocol),
+		Halen:    uint8(len(dstMac)),
+	}
+	copy(addr.Addr[:], dstMac)
+	// only the answers received on the interface are read
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Ifindex: iface.Index, Protocol: htons(protocol)}); err != nil {
+		return nil, errors.Wrapf(err, "failed to bind probe socket to %s", ifName)
+	}
+
+	logger.Info("Probing address", zap.String("ifName", ifName), zap.String("ip", ip.String()))
+	if err := unix.Sendto(fd, probe, 0, &addr); err != nil {
+		return nil, errors.Wrapf(err, "failed to probe %s on %s", ip, ifName)
+	}
+
+	var macs []net.HardwareAddr
+	buf := make([]byte, 1500) //nolint:gomnd // the mtu of the answers
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return macs, nil
+		}
+		tv := unix.NsecToTimeval(remaining.Nanoseconds())
+		if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+			return nil, errors.Wrap(err, "failed to set probe socket timeout")
+		}
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the answers to the probe of %s on %s", ip, ifName)
+		}
+		sender, ok := from.(*unix.SockaddrLinklayer)
+		// the probe itself is read back as an outgoing packet
+		if !ok || sender.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		if isAnswer(buf[:n], ip) {
+			mac := make(net.HardwareAddr, sender.Halen)
+			copy(mac, sender.Addr[:sender.Halen])
+			macs = append(macs, mac)
+		}
+	}
+}
+
+// isARPAnswer returns whether the arp packet is a host claiming the ipv4 address, with a reply or a request of its own.
+func isARPAnswer(packet []byte, ip net.IP) bool {
+	if len(packet) < 8 || packet[5] != net.IPv4len {
+		return false
+	}
+	op := binary.BigEndian.Uint16(packet[6:])
+	senderIP := 8 + int(packet[4])
+	if (op != arpOpReply && op != arpOpRequest) || len(packet) < senderIP+net.IPv4len {
+		return false
+	}
+	return net.IP(packet[senderIP : senderIP+net.IPv4len]).Equal(ip)
+}
+
+// isNeighborAdvertisement returns whether the ipv6 packet is a neighbor advertisement of the ipv6 address.
+func isNeighborAdvertisement(packet []byte, ip net.IP) bool {
+	const nextHeaderICMPv6 = 58
+	if len(packet) < ipv6HeaderLen+24 || packet[6] != nextHeaderICMPv6 { //nolint:gomnd // the neighbor advertisement
+		return false
+	}
+	icmp := packet[ipv6HeaderLen:]
+	return icmp[0] == icmpv6NeighborAdvertisement && net.IP(icmp[8:24]).Equal(ip)
+}
+
+// solicitedNodeMac returns the multicast mac of the solicited-node address of the ipv6 address.
+func solicitedNodeMac(ip net.IP) net.HardwareAddr {
+	ip16 := ip.To16()
+	return net.HardwareAddr{0x33, 0x33, 0xff, ip16[13], ip16[14], ip16[15]}
+}
+
+// neighborSolicitation returns the ipv6 packet soliciting the neighbors using the ipv6 address from the unspecified
+// address, to the solicited-node address of the ip.
+func neighborSolicitation(ip net.IP) []byte {
+	const nextHeaderICMPv6 = 58
+	ip16 := ip.To16()
+	dst := net.IP{0xff, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0xff, ip16[13], ip16[14], ip16[15]}
+
+	// type, code, checksum, reserved and the target, without the source link-layer address option which the
+	// unspecified address mustn't have
+	icmp := make([]byte, 24) //nolint:gomnd // the neighbor solicitation
+	icmp[0] = icmpv6NeighborSolicitation
+	copy(icmp[8:], ip16)
+
+	// the checksum covers the pseudo-header of the source, destination, length and next header
+	pseudo := bytes.NewBuffer(make([]byte, 0, 2*net.IPv6len+8+len(icmp)))
+	pseudo.Write(net.IPv6unspecified)
+	pseudo.Write(dst)
+	_ = binary.Write(pseudo, binary.BigEndian, uint32(len(icmp)))
+	pseudo.Write([]byte{0, 0, 0, nextHeaderICMPv6})
+	pseudo.Write(icmp)
+	binary.BigEndian.PutUint16(icmp[2:], checksum(pseudo.Bytes()))
+
+	packet := make([]byte, ipv6HeaderLen, ipv6HeaderLen+len(icmp))
+	packet[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(packet[4:], uint16(len(icmp)))
+	packet[6] = nextHeaderICMPv6
+	packet[7] = ndpHopLimit
+	copy(packet[8:], net.IPv6unspecified)
+	copy(packet[24:], dst)
+	return append(packet, icmp...)
+}
+
+// checksum returns the internet checksum of the data (RFC 1071).
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8 //nolint:gomnd // the odd byte is the high byte of its word
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + sum>>16
+	}
+	return ^uint16(sum)
+}
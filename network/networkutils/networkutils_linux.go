@@ -4,6 +4,7 @@
 package networkutils
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
 )
 
 /*RFC For Private Address Space: https://tools.ietf.org/html/rfc1918
@@ -36,6 +38,8 @@ const (
 	enableIPV4ForwardCmd = "sysctl -w net.ipv4.conf.all.forwarding=1"
 	disableRACmd         = "sysctl -w net.ipv6.conf.%s.accept_ra=0"
 	acceptRAV6File       = "/proc/sys/net/ipv6/conf/%s/accept_ra"
+	// enableConntrackAcctCmd counts the bytes and packets of the conntrack entries created from then on
+	enableConntrackAcctCmd = "sysctl -w net.netfilter.nf_conntrack_acct=1"
 )
 
 var logger = log.CNILogger.With(zap.String("component", "net-utils"))
@@ -77,6 +81,15 @@ func (nu NetworkUtils) CreateEndpoint(hostVethName, containerVethName string, ma
 	}
 
 	err := nu.netlink.AddLink(&link)
+	if errors.Is(err, unix.EEXIST) {
+		// the veth names are derived from the container, so the links are left over by an earlier ADD of the same
+		// container which didn't get to clean up, e.g. because the plugin crashed
+		logger.Info("Deleting the stale veth pair", zap.String("hostVethName", hostVethName), zap.String("containerVethName", containerVethName))
+		if err = nu.deleteStaleVethPair(hostVethName, containerVethName); err != nil {
+			return newErrorNetworkUtils(err.Error())
+		}
+		err = nu.netlink.AddLink(&link)
+	}
 	if err != nil {
 		logger.Error("Failed to create veth pair with", zap.Error(err))
 		return newErrorNetworkUtils(err.Error())
@@ -94,6 +107,17 @@ func (nu NetworkUtils) CreateEndpoint(hostVethName, containerVethName string, ma
 	return nil
 }
 
+// deleteStaleVethPair deletes the links of the names of the veth pair. Deleting either end of a veth deletes its peer
+// as well, the container end is deleted on its own in case it got separated from the host end.
+func (nu NetworkUtils) deleteStaleVethPair(hostVethName, containerVethName string) error {
+	for _, name := range []string{hostVethName, containerVethName} {
+		if err := nu.netlink.DeleteLink(name); err != nil && !errors.Is(err, unix.ENODEV) {
+			return errors.Wrapf(err, "failed to delete the stale link %s", name)
+		}
+	}
+	return nil
+}
+
 func (nu NetworkUtils) SetupContainerInterface(containerVethName, targetIfName string) error {
 	// Interface needs to be down before renaming.
 	if err := nu.netlink.SetLinkState(containerVethName, false); err != nil {
@@ -132,8 +156,7 @@ func (nu NetworkUtils) AssignIPToInterface(interfaceName string, ipAddresses []n
 	return nil
 }
 
-func (nu NetworkUtils) addOrDeleteFilterRule(iptablesClient ipTablesClient, bridgeName, action, ipAddress, chainName, target string) error {
-	var err error
+func (nu NetworkUtils) addOrDeleteFilterRule(tx *iptables.Transaction, bridgeName, action, ipAddress, chainName, target string) {
 	option := "i"
 
 	if chainName == iptables.Output {
@@ -144,38 +167,26 @@ func (nu NetworkUtils) addOrDeleteFilterRule(iptablesClient ipTablesClient, brid
 
 	switch action {
 	case iptables.Insert:
-		err = iptablesClient.InsertIptableRule(iptables.V4, iptables.Filter, chainName, matchCondition, target)
+		tx.InsertRule(iptables.Filter, chainName, matchCondition, target)
 	case iptables.Append:
-		err = iptablesClient.AppendIptableRule(iptables.V4, iptables.Filter, chainName, matchCondition, target)
+		tx.AppendRule(iptables.Filter, chainName, matchCondition, target)
 	case iptables.Delete:
-		err = iptablesClient.DeleteIptableRule(iptables.V4, iptables.Filter, chainName, matchCondition, target)
+		tx.DeleteRule(iptables.Filter, chainName, matchCondition, target)
 	}
-
-	return err
 }
 
-func (nu NetworkUtils) AllowIPAddresses(iptablesClient ipTablesClient, bridgeName string, skipAddresses []string, action string) error {
+// AllowIPAddresses adds the rules allowing the addresses via the bridge to the transaction.
+func (nu NetworkUtils) AllowIPAddresses(tx *iptables.Transaction, bridgeName string, skipAddresses []string, action string) {
 	chains := getFilterChains()
 	target := getFilterchainTarget()
 
 	logger.Info("Addresses to allow", zap.Any("skipAddresses", skipAddresses))
 
 	for _, address := range skipAddresses {
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, address, chains[0], target[0]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, address, chains[1], target[0]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, address, chains[2], target[0]); err != nil {
-			return err
+		for _, chain := range chains {
+			nu.addOrDeleteFilterRule(tx, bridgeName, action, address, chain, target[0])
 		}
-
 	}
-
-	return nil
 }
 
 func (nu NetworkUtils) BlockEgressTrafficFromContainer(iptablesClient ipTablesClient, version, ipAddress, protocol string, port int) error {
@@ -184,7 +195,8 @@ func (nu NetworkUtils) BlockEgressTrafficFromContainer(iptablesClient ipTablesCl
 	return errors.Wrap(iptablesClient.InsertIptableRule(version, iptables.Filter, iptables.Forward, dropTraffic, iptables.Drop), "iptables block traffic failed")
 }
 
-func (nu NetworkUtils) BlockIPAddresses(iptablesClient ipTablesClient, bridgeName, action string) error {
+// BlockIPAddresses adds the rules blocking the private address space via the bridge to the transaction.
+func (nu NetworkUtils) BlockIPAddresses(tx *iptables.Transaction, bridgeName, action string) {
 	privateIPAddresses := getPrivateIPSpace()
 	chains := getFilterChains()
 	target := getFilterchainTarget()
@@ -192,20 +204,10 @@ func (nu NetworkUtils) BlockIPAddresses(iptablesClient ipTablesClient, bridgeNam
 	logger.Info("Addresses to block", zap.Any("privateIPAddresses", privateIPAddresses))
 
 	for _, ipAddress := range privateIPAddresses {
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, ipAddress, chains[0], target[1]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, ipAddress, chains[1], target[1]); err != nil {
-			return err
-		}
-
-		if err := nu.addOrDeleteFilterRule(iptablesClient, bridgeName, action, ipAddress, chains[2], target[1]); err != nil {
-			return err
+		for _, chain := range chains {
+			nu.addOrDeleteFilterRule(tx, bridgeName, action, ipAddress, chain, target[1])
 		}
 	}
-
-	return nil
 }
 
 func (nu NetworkUtils) EnableIPV4Forwarding() error {
@@ -218,6 +220,14 @@ func (nu NetworkUtils) EnableIPV4Forwarding() error {
 	return nil
 }
 
+// EnableConntrackAccounting counts the bytes and packets of the flows of the host in their conntrack entries.
+func (nu NetworkUtils) EnableConntrackAccounting() error {
+	if _, err := nu.plClient.ExecuteRawCommand(enableConntrackAcctCmd); err != nil {
+		return errors.Wrap(err, "enable conntrack accounting failed")
+	}
+	return nil
+}
+
 func (nu NetworkUtils) EnableIPV6Forwarding() error {
 	cmd := fmt.Sprint(enableIPV6ForwardCmd)
 	_, err := nu.plClient.ExecuteRawCommand(cmd)
@@ -275,6 +285,67 @@ func (nu NetworkUtils) SetProxyArp(ifName string) error {
 	return errors.Wrapf(err, "failed to set proxy arp for interface %v", ifName)
 }
 
+// SendGratuitousARP announces the ip of the interface with a gratuitous arp request, so the neighbors which cached an
+// earlier mac of the ip update it.
+func (nu NetworkUtils) SendGratuitousARP(ifName string, ip net.IP) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errors.Errorf("gratuitous arp needs an ipv4 address, got %s", ip)
+	}
+
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find interface %s", ifName)
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return errors.Wrap(err, "failed to open arp socket")
+	}
+	defer unix.Close(fd)
+
+	addr := unix.SockaddrLinklayer{
+		Ifindex:  iface.Index,
+		Protocol: htons(unix.ETH_P_ARP),
+		Halen:    uint8(len(broadcastMac)),
+	}
+	copy(addr.Addr[:], broadcastMac)
+
+	logger.Info("Sending gratuitous arp", zap.String("ifName", ifName), zap.String("ip", ip4.String()))
+	return errors.Wrapf(unix.Sendto(fd, gratuitousARP(iface.HardwareAddr, ip4), 0, &addr),
+		"failed to send gratuitous arp for %s on %s", ip4, ifName)
+}
+
+var broadcastMac = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// gratuitousARP returns the arp request announcing the ipv4 address at the mac, with the ip as the sender and the
+// target alike.
+func gratuitousARP(mac net.HardwareAddr, ip net.IP) []byte {
+	return arpRequest(mac, ip, ip)
+}
+
+// arpRequest returns the arp request of the sender at the mac for the target ip.
+func arpRequest(mac net.HardwareAddr, senderIP, targetIP net.IP) []byte {
+	const hwTypeEthernet = 1
+	packet := make([]byte, 8, 8+2*(len(mac)+net.IPv4len)) //nolint:gomnd // the fixed arp header
+	binary.BigEndian.PutUint16(packet[0:], hwTypeEthernet)
+	binary.BigEndian.PutUint16(packet[2:], unix.ETH_P_IP)
+	packet[4] = byte(len(mac))
+	packet[5] = net.IPv4len
+	binary.BigEndian.PutUint16(packet[6:], arpOpRequest)
+	packet = append(packet, mac...)
+	packet = append(packet, senderIP.To4()...)
+	packet = append(packet, make([]byte, len(mac))...)
+	return append(packet, targetIP.To4()...)
+}
+
+// htons converts a short from the host to the network byte order.
+func htons(v uint16) uint16 {
+	var tmp [2]byte
+	binary.BigEndian.PutUint16(tmp[:], v)
+	return binary.LittleEndian.Uint16(tmp[:])
+}
+
 func getPrivateIPSpace() []string {
 	privateIPAddresses := []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"}
 	return privateIPAddresses
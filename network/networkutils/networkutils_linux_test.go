@@ -0,0 +1,131 @@
+//go:build linux
+// +build linux
+
+package networkutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestCreateEndpointDeletesStaleVethPair(t *testing.T) {
+	tests := []struct {
+		name        string
+		addLinkErrs []error
+		wantDeleted []string
+		wantErr     bool
+	}{
+		{
+			name: "no stale links",
+		},
+		{
+			name:        "stale links are deleted and the veth pair is created again",
+			addLinkErrs: []error{unix.EEXIST},
+			wantDeleted: []string{"azv1234", "azv12342"},
+		},
+		{
+			name:        "links which are still there after the cleanup fail the ADD",
+			addLinkErrs: []error{unix.EEXIST, unix.EEXIST},
+			wantDeleted: []string{"azv1234", "azv12342"},
+			wantErr:     true,
+		},
+		{
+			name:        "other errors don't delete links",
+			addLinkErrs: []error{unix.EPERM},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nl := netlink.NewMockNetlink(false, "")
+			addLinkErrs := tt.addLinkErrs
+			nl.AddLinkFn = func(netlink.Link) error {
+				if len(addLinkErrs) == 0 {
+					return nil
+				}
+				err := addLinkErrs[0]
+				addLinkErrs = addLinkErrs[1:]
+				return err
+			}
+			var deleted []string
+			nl.DeleteLinkFn = func(name string) error {
+				deleted = append(deleted, name)
+				return nil
+			}
+
+			err := NewNetworkUtils(nl, platform.NewMockExecClient(false)).CreateEndpoint("azv1234", "azv12342", nil)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantDeleted, deleted)
+		})
+	}
+}
+
+func TestGratuitousARP(t *testing.T) {
+	mac, err := net.ParseMAC("00:0d:3a:01:02:03")
+	require.NoError(t, err)
+
+	packet := gratuitousARP(mac, net.ParseIP("10.0.0.4"))
+	assert.Equal(t, []byte{
+		0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01, // ethernet, ipv4, request
+		0x00, 0x0d, 0x3a, 0x01, 0x02, 0x03, 10, 0, 0, 4, // sender
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 10, 0, 0, 4, // target
+	}, packet)
+}
+
+func TestARPProbe(t *testing.T) {
+	mac, err := net.ParseMAC("00:0d:3a:01:02:03")
+	require.NoError(t, err)
+	ip := net.ParseIP("10.0.0.4")
+
+	// the probe has no sender ip, so that it doesn't update the caches of the neighbors
+	probe := arpRequest(mac, net.IPv4zero, ip)
+	assert.Equal(t, []byte{
+		0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01, // ethernet, ipv4, request
+		0x00, 0x0d, 0x3a, 0x01, 0x02, 0x03, 0, 0, 0, 0, // sender
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 10, 0, 0, 4, // target
+	}, probe)
+	assert.False(t, isARPAnswer(probe, ip))
+
+	reply := arpRequest(mac, ip, net.ParseIP("10.0.0.5"))
+	reply[7] = arpOpReply
+	assert.True(t, isARPAnswer(reply, ip))
+	assert.True(t, isARPAnswer(gratuitousARP(mac, ip), ip))
+	assert.False(t, isARPAnswer(reply, net.ParseIP("10.0.0.5")))
+	assert.False(t, isARPAnswer(reply[:10], ip))
+}
+
+func TestNeighborSolicitation(t *testing.T) {
+	ip := net.ParseIP("fd00::1:2:3")
+	assert.Equal(t, net.HardwareAddr{0x33, 0x33, 0xff, 0x02, 0x00, 0x03}, solicitedNodeMac(ip))
+
+	packet := neighborSolicitation(ip)
+	require.Len(t, packet, ipv6HeaderLen+24)
+	assert.Equal(t, byte(0x60), packet[0])
+	assert.Equal(t, byte(ndpHopLimit), packet[7])
+	assert.True(t, net.IPv6unspecified.Equal(packet[8:24]))
+	assert.Equal(t, net.ParseIP("ff02::1:ff02:3"), net.IP(packet[24:40]))
+	assert.Equal(t, byte(icmpv6NeighborSolicitation), packet[40])
+	assert.Equal(t, ip, net.IP(packet[48:64]))
+
+	// the checksum of the pseudo-header and the message with its checksum is zero
+	pseudo := append(append(append([]byte{}, packet[8:40]...), 0, 0, 0, 24, 0, 0, 0, 58), packet[40:]...)
+	assert.Equal(t, uint16(0), checksum(pseudo))
+
+	// the solicitation isn't an answer, an advertisement of the ip is
+	assert.False(t, isNeighborAdvertisement(packet, ip))
+	packet[40] = icmpv6NeighborAdvertisement
+	assert.True(t, isNeighborAdvertisement(packet, ip))
+	assert.False(t, isNeighborAdvertisement(packet, net.ParseIP("fd00::1:2:4")))
+}
@@ -7,6 +7,17 @@ import (
 	"github.com/Azure/azure-container-networking/network/ovsinfravnet"
 )
 
+// infraVnetIPs returns the infra vnet ips of the endpoint which are set, the ipv6 one only on dual stack.
+func infraVnetIPs(ipv4, ipv6 net.IPNet) []net.IPNet {
+	infraIPs := []net.IPNet{}
+	for _, infraIP := range []net.IPNet{ipv4, ipv6} {
+		if infraIP.IP != nil {
+			infraIPs = append(infraIPs, infraIP)
+		}
+	}
+	return infraIPs
+}
+
 func NewInfraVnetClient(client *OVSEndpointClient, epID string) {
 	if client.enableInfraVnet {
 		hostIfName := fmt.Sprintf("%s%s", infraVethInterfacePrefix, epID)
@@ -24,9 +35,9 @@ func AddInfraVnetEndpoint(client *OVSEndpointClient) error {
 	return nil
 }
 
-func AddInfraEndpointRules(client *OVSEndpointClient, infraIP net.IPNet, hostPort string) error {
+func AddInfraEndpointRules(client *OVSEndpointClient, infraIPs []net.IPNet, hostPort string) error {
 	if client.enableInfraVnet {
-		return client.infraVnetClient.CreateInfraVnetRules(client.bridgeName, infraIP, client.hostPrimaryMac, hostPort)
+		return client.infraVnetClient.CreateInfraVnetRules(client.bridgeName, infraIPs, client.hostPrimaryMac, hostPort)
 	}
 
 	return nil
@@ -34,7 +45,7 @@ func AddInfraEndpointRules(client *OVSEndpointClient, infraIP net.IPNet, hostPor
 
 func DeleteInfraVnetEndpointRules(client *OVSEndpointClient, ep *endpoint, hostPort string) {
 	if client.enableInfraVnet {
-		client.infraVnetClient.DeleteInfraVnetRules(client.bridgeName, ep.InfraVnetIP, hostPort)
+		client.infraVnetClient.DeleteInfraVnetRules(client.bridgeName, infraVnetIPs(ep.InfraVnetIP, ep.InfraVnetIPv6), hostPort)
 	}
 }
 
@@ -54,9 +65,9 @@ func SetupInfraVnetContainerInterface(client *OVSEndpointClient) error {
 	return nil
 }
 
-func ConfigureInfraVnetContainerInterface(client *OVSEndpointClient, infraIP net.IPNet) error {
+func ConfigureInfraVnetContainerInterface(client *OVSEndpointClient, infraIPs []net.IPNet) error {
 	if client.enableInfraVnet {
-		return client.infraVnetClient.ConfigureInfraVnetContainerInterface(infraIP)
+		return client.infraVnetClient.ConfigureInfraVnetContainerInterface(infraIPs)
 	}
 
 	return nil
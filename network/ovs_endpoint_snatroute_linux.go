@@ -35,6 +35,8 @@ func (client *OVSEndpointClient) NewSnatClient(snatBridgeIP, localIP string, epI
 			client.iptablesClient,
 			client.netioshim,
 		)
+		client.snatClient.HostToNCPortRules = snatPortRules(epInfo.HostToNCPortRules)
+		client.snatClient.NCToHostPortRules = snatPortRules(epInfo.NCToHostPortRules)
 	}
 }
 
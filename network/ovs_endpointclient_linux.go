@@ -111,6 +111,16 @@ func (client *OVSEndpointClient) AddEndpointRules(epInfo *EndpointInfo) error {
 		return err
 	}
 
+	if err := client.addEndpointFlows(epInfo); err != nil {
+		return err
+	}
+
+	return client.AddSnatEndpointRules()
+}
+
+// addEndpointFlows installs the flows of the endpoint on the bridge, its host veth must already be a port of the bridge.
+// The flows are not persisted by ovs, so they are installed again by the health check after ovs restarts.
+func (client *OVSEndpointClient) addEndpointFlows(epInfo *EndpointInfo) error {
 	logger.Info("[ovs] Get ovs port for interface", zap.String("hostVethName", client.hostVethName))
 	containerOVSPort, err := client.ovsctlClient.GetOVSPortNumber(client.hostVethName)
 	if err != nil {
@@ -149,11 +159,7 @@ func (client *OVSEndpointClient) AddEndpointRules(epInfo *EndpointInfo) error {
 		}
 	}
 
-	if err := AddInfraEndpointRules(client, epInfo.InfraVnetIP, hostPort); err != nil {
-		return err
-	}
-
-	return client.AddSnatEndpointRules()
+	return AddInfraEndpointRules(client, infraVnetIPs(epInfo.InfraVnetIP, epInfo.InfraVnetIPv6), hostPort)
 }
 
 func (client *OVSEndpointClient) DeleteEndpointRules(ep *endpoint) {
@@ -173,18 +179,21 @@ func (client *OVSEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	logger.Info("[ovs] Deleting IP SNAT for port", zap.String("containerPort", containerPort))
 	client.ovsctlClient.DeleteIPSnatRule(client.bridgeName, containerPort)
 
-	// Delete Arp Reply Rules for container
-	logger.Info("[ovs] Deleting ARP reply rule for ip vlanid for container port", zap.String("address", ep.IPAddresses[0].IP.String()),
-		zap.Any("VlanID", ep.VlanID), zap.String("containerPort", containerPort))
-	client.ovsctlClient.DeleteArpReplyRule(client.bridgeName, containerPort, ep.IPAddresses[0].IP, ep.VlanID)
-
-	// Delete MAC address translation rule.
-	logger.Info("[ovs] Deleting MAC DNAT rule for IP address and vlan", zap.String("address", ep.IPAddresses[0].IP.String()),
-		zap.Any("VlanID", ep.VlanID))
-	client.ovsctlClient.DeleteMacDnatRule(client.bridgeName, hostPort, ep.IPAddresses[0].IP, ep.VlanID)
+	// the rules were added for each ip of the container
+	for _, ipAddr := range ep.IPAddresses {
+		// Delete Arp Reply Rules for container
+		logger.Info("[ovs] Deleting ARP reply rule for ip vlanid for container port", zap.String("address", ipAddr.IP.String()),
+			zap.Any("VlanID", ep.VlanID), zap.String("containerPort", containerPort))
+		client.ovsctlClient.DeleteArpReplyRule(client.bridgeName, containerPort, ipAddr.IP, ep.VlanID)
+
+		// Delete MAC address translation rule.
+		logger.Info("[ovs] Deleting MAC DNAT rule for IP address and vlan", zap.String("address", ipAddr.IP.String()),
+			zap.Any("VlanID", ep.VlanID))
+		client.ovsctlClient.DeleteMacDnatRule(client.bridgeName, hostPort, ipAddr.IP, ep.VlanID)
+	}
 
 	// Delete port from ovs bridge
-	logger.Info("[ovs] Deleting MAC DNAT rule for IP address and vlan", zap.String("address", ep.IPAddresses[0].IP.String()),
+	logger.Info("[ovs] Deleting port from ovs bridge", zap.String("hostVethName", client.hostVethName),
 		zap.Any("VlanID", ep.VlanID))
 	if err := client.ovsctlClient.DeletePortFromOVS(client.bridgeName, client.hostVethName); err != nil {
 		logger.Error("[ovs] Deletion of interface from bridge failed", zap.String("hostVethName", client.hostVethName), zap.String("bridgeName", client.bridgeName))
@@ -233,7 +242,7 @@ func (client *OVSEndpointClient) ConfigureContainerInterfacesAndRoutes(epInfo *E
 		return err
 	}
 
-	if err := ConfigureInfraVnetContainerInterface(client, epInfo.InfraVnetIP); err != nil {
+	if err := ConfigureInfraVnetContainerInterface(client, infraVnetIPs(epInfo.InfraVnetIP, epInfo.InfraVnetIPv6)); err != nil {
 		return err
 	}
 
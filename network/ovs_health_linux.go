@@ -0,0 +1,168 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/ovsctl"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// CheckOVSHealth checks the kernel datapath and the userspace daemon of ovs, the bridge of the network and the flows of
+// each of its endpoints, and installs again the flows of the endpoints which lost them. It returns the failed checks.
+// Networks which are not on an ovs bridge have nothing to check.
+func (nm *networkManager) CheckOVSHealth(networkID string) ([]string, error) {
+	return nm.checkOVSHealth(networkID, ovsctl.NewOvsctl(), true)
+}
+
+// reinstallOVSFlowsOnRestart checks the ovs networks whose flows were verified in another ovs-vswitchd than the running
+// one. ovs doesn't persist the flows, so they are installed again after an ovs restart without recreating the pods.
+func (nm *networkManager) reinstallOVSFlowsOnRestart() {
+	nm.Lock()
+	var networkIDs []string
+	for _, extIf := range nm.ExternalInterfaces {
+		for networkID, nw := range extIf.Networks {
+			if isOVSNetwork(nw) {
+				networkIDs = append(networkIDs, networkID)
+			}
+		}
+	}
+	nm.Unlock()
+
+	ovs := ovsctl.NewOvsctl()
+	for _, networkID := range networkIDs {
+		failures, err := nm.checkOVSHealth(networkID, ovs, false)
+		if err != nil || len(failures) > 0 {
+			logger.Error("OVS network is unhealthy", zap.String("networkID", networkID), zap.Strings("failures", failures), zap.Error(err))
+		}
+	}
+}
+
+// isOVSNetwork returns if the endpoints of the network are ports of an ovs bridge.
+func isOVSNetwork(nw *network) bool {
+	return nw.VlanId != 0 && nw.Mode != opModeTransparentVlan && nw.extIf != nil
+}
+
+// checkOVSHealth checks the ovs network, unless full is false and the running ovs-vswitchd is the one the network
+// was last verified in. The pid of ovs-vswitchd is recorded once all the checks pass.
+func (nm *networkManager) checkOVSHealth(networkID string, ovs ovsctl.OvsInterface, full bool) ([]string, error) {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isOVSNetwork(nw) {
+		return nil, nil
+	}
+
+	pid, err := ovs.GetOVSDaemonPID()
+	if err != nil {
+		return []string{fmt.Sprintf("ovs-vswitchd is not running: %v", err)}, nil
+	}
+	if !full && pid == nw.OVSDaemonPID {
+		return nil, nil
+	}
+
+	logger.Info("Checking ovs network", zap.String("networkID", networkID), zap.String("pid", pid),
+		zap.String("lastPid", nw.OVSDaemonPID))
+	failures := checkOVSNetwork(nw, ovs, nm.netlink, nm.plClient, nm.iptablesClient)
+	if len(failures) > 0 || pid == nw.OVSDaemonPID {
+		return failures, nil
+	}
+
+	nw.OVSDaemonPID = pid
+	return failures, errors.Wrap(nm.save(), "failed to save state after ovs health check")
+}
+
+// checkOVSNetwork checks ovs, the bridge and the flows of the network, installing again the missing flows.
+func checkOVSNetwork(nw *network, ovs ovsctl.OvsInterface, nl netlink.NetlinkInterface, plc platform.ExecClient,
+	iptc ipTablesClient,
+) []string {
+	if err := ovs.CheckOVSDatapath(); err != nil {
+		return []string{fmt.Sprintf("ovs kernel datapath is not loaded: %v", err)}
+	}
+	if err := ovs.CheckOVSDaemon(); err != nil {
+		return []string{fmt.Sprintf("ovs-vswitchd is not responding: %v", err)}
+	}
+
+	bridgeName := nw.extIf.BridgeName
+	exists, err := ovs.OVSBridgeExists(bridgeName)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to list ovs bridges: %v", err)}
+	}
+	if !exists {
+		return []string{fmt.Sprintf("ovs bridge %s not found", bridgeName)}
+	}
+
+	var failures []string
+	hostPort, err := ovs.GetOVSPortNumber(nw.extIf.Name)
+	if err != nil || hostPort == "" {
+		return []string{fmt.Sprintf("host interface %s is not a port of ovs bridge %s", nw.extIf.Name, bridgeName)}
+	}
+	if count, err := ovs.GetOVSFlowCount(bridgeName, "arp,in_port="+hostPort); err != nil {
+		failures = append(failures, fmt.Sprintf("failed to dump flows of host interface %s: %v", nw.extIf.Name, err))
+	} else if count == 0 {
+		logger.Info("Installing again the flows of host interface", zap.String("name", nw.extIf.Name))
+		if err := NewOVSClient(bridgeName, nw.extIf.Name, ovs, nl, plc).AddL2Rules(nw.extIf); err != nil {
+			failures = append(failures, fmt.Sprintf("failed to install flows of host interface %s: %v", nw.extIf.Name, err))
+		}
+	}
+
+	endpointIDs := make([]string, 0, len(nw.Endpoints))
+	for endpointID := range nw.Endpoints {
+		endpointIDs = append(endpointIDs, endpointID)
+	}
+	sort.Strings(endpointIDs)
+
+	for _, endpointID := range endpointIDs {
+		if failure := checkOVSEndpoint(nw, nw.Endpoints[endpointID], ovs, nl, plc, iptc); failure != "" {
+			failures = append(failures, fmt.Sprintf("endpoint %s: %s", endpointID, failure))
+		}
+	}
+
+	return failures
+}
+
+// checkOVSEndpoint returns why the flows of the endpoint are missing and can't be installed again, or an empty string.
+func checkOVSEndpoint(nw *network, ep *endpoint, ovs ovsctl.OvsInterface, nl netlink.NetlinkInterface,
+	plc platform.ExecClient, iptc ipTablesClient,
+) string {
+	if ep.VlanID == 0 {
+		return ""
+	}
+
+	bridgeName := nw.extIf.BridgeName
+	port, err := ovs.GetOVSPortNumber(ep.HostIfName)
+	if err != nil || port == "" {
+		return fmt.Sprintf("host veth %s is not a port of ovs bridge %s", ep.HostIfName, bridgeName)
+	}
+
+	count, err := ovs.GetOVSFlowCount(bridgeName, "ip,in_port="+port)
+	if err != nil {
+		return fmt.Sprintf("failed to dump flows of host veth %s: %v", ep.HostIfName, err)
+	}
+	if count > 0 {
+		return ""
+	}
+
+	// the mac of the container interface is needed to forward the ingress traffic to it
+	if len(ep.MacAddress) == 0 {
+		return fmt.Sprintf("flows of host veth %s are missing and the container mac is unknown", ep.HostIfName)
+	}
+
+	logger.Info("Installing again the flows of endpoint", zap.String("endpointID", ep.Id), zap.String("port", port))
+	epInfo := ep.getInfo(nil)
+	client := NewOVSEndpointClient(nw, epInfo, ep.HostIfName, "", ep.VlanID, ep.LocalIP, nl, ovs, plc, iptc)
+	client.containerMac = ep.MacAddress.String()
+	if err := client.addEndpointFlows(epInfo); err != nil {
+		return fmt.Sprintf("failed to install flows of host veth %s: %v", ep.HostIfName, err)
+	}
+
+	return ""
+}
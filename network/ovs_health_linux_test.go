@@ -0,0 +1,133 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/ovsctl"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOVS is an ovs whose bridge has the ports in ports and the flows counted in flows, which records the flows added.
+type fakeOVS struct {
+	ovsctl.MockOvsctl
+	pid   string
+	ports map[string]string
+	flows map[string]int
+	added []string
+}
+
+func (f *fakeOVS) GetOVSDaemonPID() (string, error) {
+	return f.pid, nil
+}
+
+func (f *fakeOVS) GetOVSPortNumber(interfaceName string) (string, error) {
+	return f.ports[interfaceName], nil
+}
+
+func (f *fakeOVS) GetOVSFlowCount(_, match string) (int, error) {
+	return f.flows[match], nil
+}
+
+func (f *fakeOVS) AddArpDnatRule(_, port, _ string) error {
+	f.added = append(f.added, "arp,in_port="+port)
+	return nil
+}
+
+func (f *fakeOVS) AddIPSnatRule(_ string, _ net.IP, _ int, port, _, _ string) error {
+	f.added = append(f.added, "ip,in_port="+port)
+	return nil
+}
+
+func newOVSHealthTestManager() (*networkManager, *network) {
+	extIf := &externalInterface{
+		Name:       "eth0",
+		BridgeName: "azure0",
+		MacAddress: net.HardwareAddr{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc},
+		Networks:   map[string]*network{},
+	}
+	nw := &network{
+		Id:     "nw",
+		VlanId: 1,
+		extIf:  extIf,
+		Endpoints: map[string]*endpoint{
+			"ep1-eth0": {
+				Id: "ep1-eth0", HostIfName: "azv1", VlanID: 1,
+				MacAddress:  net.HardwareAddr{0x12, 0x34, 0x56, 0x78, 0x9a, 0x01},
+				IPAddresses: []net.IPNet{{IP: net.ParseIP("10.240.0.5"), Mask: net.CIDRMask(24, 32)}},
+			},
+			"ep2-eth0": {
+				Id: "ep2-eth0", HostIfName: "azv2", VlanID: 1,
+				MacAddress:  net.HardwareAddr{0x12, 0x34, 0x56, 0x78, 0x9a, 0x02},
+				IPAddresses: []net.IPNet{{IP: net.ParseIP("10.240.0.6"), Mask: net.CIDRMask(24, 32)}},
+			},
+		},
+	}
+	extIf.Networks[nw.Id] = nw
+
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{extIf.Name: extIf},
+		netlink:            netlink.NewMockNetlink(false, ""),
+		plClient:           platform.NewMockExecClient(false),
+	}
+	return nm, nw
+}
+
+func TestCheckOVSHealthReinstallsFlowsAfterRestart(t *testing.T) {
+	nm, nw := newOVSHealthTestManager()
+	ovs := &fakeOVS{
+		MockOvsctl: ovsctl.NewMockOvsctl(false, "", ""),
+		pid:        "100",
+		ports:      map[string]string{"eth0": "1", "azv1": "2", "azv2": "3"},
+		// ovs restarted and lost the flows of the host interface and of azv2
+		flows: map[string]int{"ip,in_port=2": 2},
+	}
+
+	failures, err := nm.checkOVSHealth(nw.Id, ovs, false)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+	assert.Equal(t, []string{"arp,in_port=1", "ip,in_port=3"}, ovs.added)
+	assert.Equal(t, "100", nw.OVSDaemonPID)
+
+	// the same ovs-vswitchd is not checked again unless the check is forced
+	ovs.added = nil
+	failures, err = nm.checkOVSHealth(nw.Id, ovs, false)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+	assert.Empty(t, ovs.added)
+}
+
+func TestCheckOVSHealthFailures(t *testing.T) {
+	nm, nw := newOVSHealthTestManager()
+	nw.Endpoints["ep2-eth0"].MacAddress = nil
+	ovs := &fakeOVS{
+		MockOvsctl: ovsctl.NewMockOvsctl(false, "", ""),
+		pid:        "100",
+		ports:      map[string]string{"eth0": "1", "azv2": "3"},
+		flows:      map[string]int{"arp,in_port=1": 1},
+	}
+
+	failures, err := nm.checkOVSHealth(nw.Id, ovs, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"endpoint ep1-eth0: host veth azv1 is not a port of ovs bridge azure0",
+		"endpoint ep2-eth0: flows of host veth azv2 are missing and the container mac is unknown",
+	}, failures)
+	// the pid is not recorded so that the next invocation checks again
+	assert.Empty(t, nw.OVSDaemonPID)
+
+	// ovs being down fails all the checks
+	failures, err = nm.checkOVSHealth(nw.Id, ovsctl.NewMockOvsctl(true, "down", ""), true)
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	assert.Contains(t, failures[0], "ovs-vswitchd is not running")
+
+	// networks which are not on ovs have nothing to check
+	nw.VlanId = 0
+	failures, err = nm.checkOVSHealth(nw.Id, ovs, true)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
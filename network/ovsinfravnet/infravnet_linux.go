@@ -75,9 +75,10 @@ func (client *OVSInfraVnetClient) CreateInfraVnetEndpoint(bridgeName string) err
 	return nil
 }
 
+// CreateInfraVnetRules adds the snat and dnat rules of the infra vnet ips, one per ip family.
 func (client *OVSInfraVnetClient) CreateInfraVnetRules(
 	bridgeName string,
-	infraIP net.IPNet,
+	infraIPs []net.IPNet,
 	hostPrimaryMac string,
 	hostPort string,
 ) error {
@@ -89,16 +90,18 @@ func (client *OVSInfraVnetClient) CreateInfraVnetRules(
 		return err
 	}
 
-	// 0 signifies not to add vlan tag to this traffic
-	if err := ovs.AddIPSnatRule(bridgeName, infraIP.IP, 0, infraContainerPort, hostPrimaryMac, hostPort); err != nil {
-		logger.Error("[ovs] AddIpSnatRule failed with", zap.Error(err))
-		return err
-	}
-
-	// 0 signifies not to match traffic based on vlan tag
-	if err := ovs.AddMacDnatRule(bridgeName, hostPort, infraIP.IP, client.containerInfraMac, 0, infraContainerPort); err != nil {
-		logger.Error("[ovs] AddMacDnatRule failed with", zap.Error(err))
-		return err
+	for _, infraIP := range infraIPs {
+		// 0 signifies not to add vlan tag to this traffic
+		if err := ovs.AddIPSnatRule(bridgeName, infraIP.IP, 0, infraContainerPort, hostPrimaryMac, hostPort); err != nil {
+			logger.Error("[ovs] AddIpSnatRule failed with", zap.Error(err))
+			return err
+		}
+
+		// 0 signifies not to match traffic based on vlan tag
+		if err := ovs.AddMacDnatRule(bridgeName, hostPort, infraIP.IP, client.containerInfraMac, 0, infraContainerPort); err != nil {
+			logger.Error("[ovs] AddMacDnatRule failed with", zap.Error(err))
+			return err
+		}
 	}
 
 	return nil
@@ -125,24 +128,28 @@ func (client *OVSInfraVnetClient) SetupInfraVnetContainerInterface() error {
 	return nil
 }
 
-func (client *OVSInfraVnetClient) ConfigureInfraVnetContainerInterface(infraIP net.IPNet) error {
-	logger.Info("[ovs] Adding IP address to link", zap.String("IP", infraIP.String()), zap.String("ContainerInfraVethName", client.ContainerInfraVethName))
-	err := client.netlink.AddIPAddress(client.ContainerInfraVethName, infraIP.IP, &infraIP)
-	if err != nil {
-		return newErrorOVSInfraVnetClient(err.Error())
+func (client *OVSInfraVnetClient) ConfigureInfraVnetContainerInterface(infraIPs []net.IPNet) error {
+	for i := range infraIPs {
+		logger.Info("[ovs] Adding IP address to link", zap.String("IP", infraIPs[i].String()), zap.String("ContainerInfraVethName", client.ContainerInfraVethName))
+		err := client.netlink.AddIPAddress(client.ContainerInfraVethName, infraIPs[i].IP, &infraIPs[i])
+		if err != nil {
+			return newErrorOVSInfraVnetClient(err.Error())
+		}
 	}
 	return nil
 }
 
 func (client *OVSInfraVnetClient) DeleteInfraVnetRules(
 	bridgeName string,
-	infraIP net.IPNet,
+	infraIPs []net.IPNet,
 	hostPort string,
 ) {
 	ovs := ovsctl.NewOvsctl()
 
-	logger.Info("[ovs] Deleting MAC DNAT rule for infravnet IP address", zap.String("IP", infraIP.IP.String()))
-	ovs.DeleteMacDnatRule(bridgeName, hostPort, infraIP.IP, 0)
+	for _, infraIP := range infraIPs {
+		logger.Info("[ovs] Deleting MAC DNAT rule for infravnet IP address", zap.String("IP", infraIP.IP.String()))
+		ovs.DeleteMacDnatRule(bridgeName, hostPort, infraIP.IP, 0)
+	}
 
 	logger.Info("[ovs] Get ovs port for infravnet interface", zap.String("hostInfraVethName", client.hostInfraVethName))
 	infraContainerPort, err := ovs.GetOVSPortNumber(client.hostInfraVethName)
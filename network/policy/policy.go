@@ -2,6 +2,11 @@ package policy
 
 import (
 	"encoding/json"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -22,8 +27,367 @@ type Policy struct {
 	Data json.RawMessage
 }
 
+var errInvalidL4WFPProxyPolicy = errors.New("invalid L4WFPPROXY policy")
+
+// dnsPort is the port exempted from the L4WFPPROXY redirect of the endpoints which skip dns redirection.
+const dnsPort = "53"
+
+// L4WFPProxySetting is the data of an L4WFPPROXY endpoint policy, which has HNS redirect the endpoint's traffic
+// to a local proxy so that a service mesh can intercept it without a sidecar. Field names follow the HNS schema,
+// the filter tuple and exceptions are passed through to HNS as is.
+type L4WFPProxySetting struct {
+	InboundProxyPort   string          `json:",omitempty"`
+	OutboundProxyPort  string          `json:",omitempty"`
+	UserSID            string          `json:",omitempty"`
+	FilterTuple        json.RawMessage `json:",omitempty"`
+	InboundExceptions  json.RawMessage `json:",omitempty"`
+	OutboundExceptions json.RawMessage `json:",omitempty"`
+}
+
 // NATInfo contains information about NAT rules
 type NATInfo struct {
 	Destinations []string
 	VirtualIP    string
 }
+
+// AddOutBoundNATExceptions returns a copy of policies where the given destination cidrs are appended to the
+// exception list of every OutBoundNAT endpoint policy. Endpoints without an OutBoundNAT policy are not snatted,
+// so no policy is created when none is present.
+func AddOutBoundNATExceptions(policies []Policy, exceptions []string) ([]Policy, error) {
+	if len(exceptions) == 0 {
+		return policies, nil
+	}
+
+	result := make([]Policy, 0, len(policies))
+	for _, policy := range policies {
+		if policy.Type != EndpointPolicy {
+			result = append(result, policy)
+			continue
+		}
+
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(policy.Data, &data); err != nil {
+			// not all endpoint policies are json objects we understand, leave them untouched
+			result = append(result, policy)
+			continue
+		}
+
+		var policyType CNIPolicyType
+		if err := json.Unmarshal(data["Type"], &policyType); err != nil || policyType != OutBoundNatPolicy {
+			result = append(result, policy)
+			continue
+		}
+
+		var exceptionList []string
+		if rawExceptionList, ok := data["ExceptionList"]; ok {
+			if err := json.Unmarshal(rawExceptionList, &exceptionList); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal outbound nat exception list")
+			}
+		}
+		exceptionList = append(exceptionList, exceptions...)
+
+		rawExceptionList, err := json.Marshal(exceptionList)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal outbound nat exception list")
+		}
+		data["ExceptionList"] = rawExceptionList
+
+		rawData, err := json.Marshal(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal outbound nat policy")
+		}
+
+		result = append(result, Policy{Type: policy.Type, Data: rawData})
+	}
+
+	return result, nil
+}
+
+// AddIPv6Policies returns a copy of policies for an endpoint with ipv6 addresses, where the OutBoundNAT and ROUTE
+// endpoint policies which only cover ipv4 are paired with ipv6 ones, so that the ipv6 egress of the endpoint is
+// snatted and routed like its ipv4 egress. The ipv6 exceptions of the ipv4 OutBoundNAT policies move to the ipv6
+// OutBoundNAT policy, which also exempts the ipv6 prefixes of the endpoint, and the ipv4 ROUTE policies are paired
+// with ROUTE policies to the ipv6 prefixes. Policies of the endpoint which already cover ipv6 are kept.
+func AddIPv6Policies(policies []Policy, ipv6Prefixes []string) ([]Policy, error) {
+	if len(ipv6Prefixes) == 0 {
+		return policies, nil
+	}
+
+	var (
+		result          = make([]Policy, 0, len(policies))
+		ipv6Exceptions  []string
+		ipv6OutBoundNAT = -1
+		ipv4OutBoundNAT bool
+		ipv4Route       bool
+		ipv4NeedEncap   bool
+		ipv6Route       bool
+	)
+	for _, policy := range policies {
+		data, policyType, ok := endpointPolicyData(policy)
+		switch {
+		case !ok:
+		case policyType == OutBoundNatPolicy:
+			exceptionList, err := outBoundNATExceptionList(data)
+			if err != nil {
+				return nil, err
+			}
+			if IsIPv6ExceptionList(exceptionList) {
+				ipv6OutBoundNAT = len(result)
+				break
+			}
+			ipv4OutBoundNAT = true
+			var ipv4Exceptions []string
+			for _, exception := range exceptionList {
+				if IsIPv6(exception) {
+					ipv6Exceptions = append(ipv6Exceptions, exception)
+				} else {
+					ipv4Exceptions = append(ipv4Exceptions, exception)
+				}
+			}
+			if len(ipv4Exceptions) < len(exceptionList) {
+				if policy, err = withOutBoundNATExceptionList(policy.Type, data, ipv4Exceptions); err != nil {
+					return nil, err
+				}
+			}
+		case policyType == RoutePolicy:
+			var destinationPrefix string
+			_ = json.Unmarshal(data["DestinationPrefix"], &destinationPrefix)
+			if IsIPv6(destinationPrefix) {
+				ipv6Route = true
+				break
+			}
+			var needEncap bool
+			_ = json.Unmarshal(data["NeedEncap"], &needEncap)
+			ipv4Route = true
+			ipv4NeedEncap = ipv4NeedEncap || needEncap
+		}
+		result = append(result, policy)
+	}
+
+	switch {
+	case ipv6OutBoundNAT >= 0 && len(ipv6Exceptions) > 0:
+		data, _, _ := endpointPolicyData(result[ipv6OutBoundNAT])
+		exceptionList, err := outBoundNATExceptionList(data)
+		if err != nil {
+			return nil, err
+		}
+		if result[ipv6OutBoundNAT], err = withOutBoundNATExceptionList(EndpointPolicy, data, append(exceptionList, ipv6Exceptions...)); err != nil {
+			return nil, err
+		}
+	case ipv6OutBoundNAT < 0 && ipv4OutBoundNAT:
+		data := map[string]json.RawMessage{"Type": json.RawMessage(`"` + OutBoundNatPolicy + `"`)}
+		policy, err := withOutBoundNATExceptionList(EndpointPolicy, data, append(ipv6Exceptions, ipv6Prefixes...))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, policy)
+	}
+
+	if ipv4Route && !ipv6Route {
+		for _, prefix := range ipv6Prefixes {
+			data, err := json.Marshal(struct {
+				Type              CNIPolicyType
+				DestinationPrefix string
+				NeedEncap         bool
+			}{
+				Type:              RoutePolicy,
+				DestinationPrefix: prefix,
+				NeedEncap:         ipv4NeedEncap,
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to marshal route policy")
+			}
+			result = append(result, Policy{Type: EndpointPolicy, Data: data})
+		}
+	}
+
+	return result, nil
+}
+
+// IsIPv6 returns whether the address or cidr is an ipv6 one.
+func IsIPv6(addressOrCIDR string) bool {
+	if prefix, err := netip.ParsePrefix(addressOrCIDR); err == nil {
+		return prefix.Addr().Is6() && !prefix.Addr().Is4In6()
+	}
+	if addr, err := netip.ParseAddr(addressOrCIDR); err == nil {
+		return addr.Is6() && !addr.Is4In6()
+	}
+	return false
+}
+
+// IsIPv6ExceptionList returns whether the exceptions of an OutBoundNAT policy make it the ipv6 one of the endpoint,
+// HNS only snats the family of the exceptions of the policy.
+func IsIPv6ExceptionList(exceptionList []string) bool {
+	for _, exception := range exceptionList {
+		if !IsIPv6(exception) {
+			return false
+		}
+	}
+	return len(exceptionList) > 0
+}
+
+// endpointPolicyData returns the fields and the type of an endpoint policy, if it is a json object.
+func endpointPolicyData(policy Policy) (map[string]json.RawMessage, CNIPolicyType, bool) {
+	if policy.Type != EndpointPolicy {
+		return nil, "", false
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(policy.Data, &data); err != nil {
+		return nil, "", false
+	}
+	var policyType CNIPolicyType
+	if err := json.Unmarshal(data["Type"], &policyType); err != nil {
+		return nil, "", false
+	}
+	return data, policyType, true
+}
+
+func outBoundNATExceptionList(data map[string]json.RawMessage) ([]string, error) {
+	var exceptionList []string
+	if rawExceptionList, ok := data["ExceptionList"]; ok {
+		if err := json.Unmarshal(rawExceptionList, &exceptionList); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal outbound nat exception list")
+		}
+	}
+	return exceptionList, nil
+}
+
+func withOutBoundNATExceptionList(policyType CNIPolicyType, data map[string]json.RawMessage, exceptionList []string) (Policy, error) {
+	rawExceptionList, err := json.Marshal(exceptionList)
+	if err != nil {
+		return Policy{}, errors.Wrap(err, "failed to marshal outbound nat exception list")
+	}
+	data["ExceptionList"] = rawExceptionList
+
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return Policy{}, errors.Wrap(err, "failed to marshal outbound nat policy")
+	}
+	return Policy{Type: policyType, Data: rawData}, nil
+}
+
+// AddL4WFPProxyDNSExceptions returns a copy of policies where the dns port is appended to the outbound port exceptions
+// of every L4WFPPROXY endpoint policy, so that HNS doesn't redirect the endpoint's dns to the proxy.
+func AddL4WFPProxyDNSExceptions(policies []Policy) ([]Policy, error) {
+	result := make([]Policy, 0, len(policies))
+	for _, policy := range policies {
+		if policy.Type != EndpointPolicy {
+			result = append(result, policy)
+			continue
+		}
+
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(policy.Data, &data); err != nil {
+			result = append(result, policy)
+			continue
+		}
+
+		var policyType CNIPolicyType
+		if err := json.Unmarshal(data["Type"], &policyType); err != nil || policyType != L4WFPProxyPolicy {
+			result = append(result, policy)
+			continue
+		}
+
+		var exceptions map[string]json.RawMessage
+		if rawExceptions, ok := data["OutboundExceptions"]; ok {
+			if err := json.Unmarshal(rawExceptions, &exceptions); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal L4WFPPROXY outbound exceptions")
+			}
+		}
+		if exceptions == nil {
+			exceptions = make(map[string]json.RawMessage)
+		}
+
+		var ports []string
+		if rawPorts, ok := exceptions["PortExceptions"]; ok {
+			if err := json.Unmarshal(rawPorts, &ports); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal L4WFPPROXY outbound port exceptions")
+			}
+		}
+		ports = append(ports, dnsPort)
+
+		rawPorts, err := json.Marshal(ports)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal L4WFPPROXY outbound port exceptions")
+		}
+		exceptions["PortExceptions"] = rawPorts
+
+		if data["OutboundExceptions"], err = json.Marshal(exceptions); err != nil {
+			return nil, errors.Wrap(err, "failed to marshal L4WFPPROXY outbound exceptions")
+		}
+
+		rawData, err := json.Marshal(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal L4WFPPROXY policy")
+		}
+
+		result = append(result, Policy{Type: policy.Type, Data: rawData})
+	}
+
+	return result, nil
+}
+
+// NewL4WFPProxyPolicy validates the setting and returns it as an endpoint policy which can be added to
+// EndpointInfo.EndpointPolicies.
+func NewL4WFPProxyPolicy(setting L4WFPProxySetting) (Policy, error) {
+	if err := setting.validate(); err != nil {
+		return Policy{}, err
+	}
+
+	data, err := json.Marshal(struct {
+		Type CNIPolicyType
+		L4WFPProxySetting
+	}{
+		Type:              L4WFPProxyPolicy,
+		L4WFPProxySetting: setting,
+	})
+	if err != nil {
+		return Policy{}, errors.Wrap(err, "failed to marshal L4WFPPROXY policy")
+	}
+
+	return Policy{Type: EndpointPolicy, Data: data}, nil
+}
+
+// ParseL4WFPProxySetting unmarshals and validates the data of an L4WFPPROXY endpoint policy.
+func ParseL4WFPProxySetting(data json.RawMessage) (L4WFPProxySetting, error) {
+	var setting L4WFPProxySetting
+	if err := json.Unmarshal(data, &setting); err != nil {
+		return setting, errors.Wrap(err, "failed to unmarshal L4WFPPROXY policy")
+	}
+
+	return setting, setting.validate()
+}
+
+// validate checks the setting before it reaches HNS, where a malformed policy only surfaces as a failed
+// endpoint creation.
+func (s L4WFPProxySetting) validate() error {
+	if s.InboundProxyPort == "" && s.OutboundProxyPort == "" {
+		return errors.Wrap(errInvalidL4WFPProxyPolicy, "at least one of InboundProxyPort or OutboundProxyPort must be set")
+	}
+
+	if err := validateProxyPort("InboundProxyPort", s.InboundProxyPort); err != nil {
+		return err
+	}
+
+	if err := validateProxyPort("OutboundProxyPort", s.OutboundProxyPort); err != nil {
+		return err
+	}
+
+	if s.UserSID != "" && !strings.HasPrefix(s.UserSID, "S-") {
+		return errors.Wrapf(errInvalidL4WFPProxyPolicy, "UserSID %q is not a valid security identifier", s.UserSID)
+	}
+
+	return nil
+}
+
+func validateProxyPort(name, port string) error {
+	if port == "" {
+		return nil
+	}
+
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return errors.Wrapf(errInvalidL4WFPProxyPolicy, "%s %q is not a valid port", name, port)
+	}
+
+	return nil
+}
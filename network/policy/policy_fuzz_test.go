@@ -0,0 +1,47 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzAddOutBoundNATExceptions adds exceptions to the endpoint policies of the network config, whose data is passed
+// through from the conflist as is. The crashers go test records under testdata/fuzz are run as regression cases by
+// the unit tests.
+func FuzzAddOutBoundNATExceptions(f *testing.F) {
+	f.Add([]byte(`{"Type":"OutBoundNAT","ExceptionList":["10.240.0.0/16"]}`), "10.0.0.0/8")
+	f.Add([]byte(`{"Type":"OutBoundNAT"}`), "")
+	f.Add([]byte(`{"Type":"OutBoundNAT","ExceptionList":"10.240.0.0/16"}`), "10.0.0.0/8")
+	f.Add([]byte(`{"Type":"ROUTE","DestinationPrefix":"10.0.0.0/8","NeedEncap":true}`), "10.0.0.0/8")
+	f.Fuzz(func(t *testing.T, data []byte, exception string) {
+		policies := []Policy{{Type: EndpointPolicy, Data: data}, {Type: NetworkPolicy, Data: data}}
+		result, err := AddOutBoundNATExceptions(policies, []string{exception})
+		if err != nil {
+			return
+		}
+		if len(result) != len(policies) {
+			t.Fatalf("got %d policies from %d", len(result), len(policies))
+		}
+		for _, p := range result {
+			if p.Type == EndpointPolicy && !json.Valid(p.Data) && json.Valid(data) {
+				t.Fatalf("valid policy %s turned into invalid %s", data, p.Data)
+			}
+		}
+	})
+}
+
+// FuzzParseL4WFPProxySetting parses the data of L4WFPPROXY endpoint policies, and checks the valid ones make a policy.
+func FuzzParseL4WFPProxySetting(f *testing.F) {
+	f.Add([]byte(`{"InboundProxyPort":"15001","OutboundProxyPort":"15006","UserSID":"S-1-5-18","FilterTuple":{"Protocols":"6"}}`))
+	f.Add([]byte(`{"InboundProxyPort":"0"}`))
+	f.Add([]byte(`{"OutboundProxyPort":"65536","UserSID":"x"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		setting, err := ParseL4WFPProxySetting(data)
+		if err != nil {
+			return
+		}
+		if _, err := NewL4WFPProxyPolicy(setting); err != nil {
+			t.Fatalf("valid setting %s makes no policy: %v", data, err)
+		}
+	})
+}
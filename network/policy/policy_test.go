@@ -0,0 +1,340 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddOutBoundNATExceptions(t *testing.T) {
+	outBoundNAT := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":["10.240.0.0/16"]}`),
+	}
+	acl := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"ACL","Protocols":"6"}`),
+	}
+
+	tests := []struct {
+		name       string
+		policies   []Policy
+		exceptions []string
+		want       []Policy
+		wantErr    bool
+	}{
+		{
+			name:       "no exceptions leaves policies untouched",
+			policies:   []Policy{outBoundNAT, acl},
+			exceptions: nil,
+			want:       []Policy{outBoundNAT, acl},
+		},
+		{
+			name:       "exceptions are appended to outbound nat policy only",
+			policies:   []Policy{outBoundNAT, acl},
+			exceptions: []string{"20.0.0.0/8", "fd00::/8"},
+			want: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"ExceptionList":["10.240.0.0/16","20.0.0.0/8","fd00::/8"],"Type":"OutBoundNAT"}`),
+				},
+				acl,
+			},
+		},
+		{
+			name:       "no outbound nat policy does not create one",
+			policies:   []Policy{acl},
+			exceptions: []string{"20.0.0.0/8"},
+			want:       []Policy{acl},
+		},
+		{
+			name: "invalid exception list",
+			policies: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":"10.240.0.0/16"}`),
+				},
+			},
+			exceptions: []string{"20.0.0.0/8"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AddOutBoundNATExceptions(tt.policies, tt.exceptions)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAddIPv6Policies(t *testing.T) {
+	outBoundNAT := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":["10.240.0.0/16"]}`),
+	}
+	route := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"ROUTE","DestinationPrefix":"10.0.0.0/8","NeedEncap":true}`),
+	}
+	acl := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"ACL","Protocols":"6"}`),
+	}
+	ipv6OutBoundNAT := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":["fd00:10::/64"]}`),
+	}
+
+	tests := []struct {
+		name         string
+		policies     []Policy
+		ipv6Prefixes []string
+		want         []Policy
+		wantErr      bool
+	}{
+		{
+			name:     "ipv4 only endpoint leaves policies untouched",
+			policies: []Policy{outBoundNAT, route, acl},
+			want:     []Policy{outBoundNAT, route, acl},
+		},
+		{
+			name:         "ipv4 outbound nat and route are paired",
+			policies:     []Policy{outBoundNAT, route, acl},
+			ipv6Prefixes: []string{"fd00:10::/64"},
+			want: []Policy{
+				outBoundNAT, route, acl,
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"ExceptionList":["fd00:10::/64"],"Type":"OutBoundNAT"}`),
+				},
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"ROUTE","DestinationPrefix":"fd00:10::/64","NeedEncap":true}`),
+				},
+			},
+		},
+		{
+			name: "ipv6 exceptions move to the paired policy",
+			policies: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":["10.240.0.0/16","fd00::/8"]}`),
+				},
+			},
+			ipv6Prefixes: []string{"fd00:10::/64"},
+			want: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"ExceptionList":["10.240.0.0/16"],"Type":"OutBoundNAT"}`),
+				},
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"ExceptionList":["fd00::/8","fd00:10::/64"],"Type":"OutBoundNAT"}`),
+				},
+			},
+		},
+		{
+			name: "ipv6 exceptions move to the existing ipv6 policy",
+			policies: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":["10.240.0.0/16","fd00::/8"]}`),
+				},
+				ipv6OutBoundNAT,
+			},
+			ipv6Prefixes: []string{"fd00:10::/64"},
+			want: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"ExceptionList":["10.240.0.0/16"],"Type":"OutBoundNAT"}`),
+				},
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"ExceptionList":["fd00:10::/64","fd00::/8"],"Type":"OutBoundNAT"}`),
+				},
+			},
+		},
+		{
+			name: "policies covering ipv6 are not paired again",
+			policies: []Policy{
+				outBoundNAT, ipv6OutBoundNAT, route,
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"ROUTE","DestinationPrefix":"fd00::/8","NeedEncap":true}`),
+				},
+			},
+			ipv6Prefixes: []string{"fd00:10::/64"},
+			want: []Policy{
+				outBoundNAT, ipv6OutBoundNAT, route,
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"ROUTE","DestinationPrefix":"fd00::/8","NeedEncap":true}`),
+				},
+			},
+		},
+		{
+			name: "invalid exception list",
+			policies: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"OutBoundNAT","ExceptionList":"10.240.0.0/16"}`),
+				},
+			},
+			ipv6Prefixes: []string{"fd00:10::/64"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AddIPv6Policies(tt.policies, tt.ipv6Prefixes)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAddL4WFPProxyDNSExceptions(t *testing.T) {
+	proxy := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"L4WFPPROXY","OutboundProxyPort":"15001"}`),
+	}
+	acl := Policy{
+		Type: EndpointPolicy,
+		Data: json.RawMessage(`{"Type":"ACL","Protocols":"6"}`),
+	}
+
+	tests := []struct {
+		name     string
+		policies []Policy
+		want     []Policy
+		wantErr  bool
+	}{
+		{
+			name:     "dns port is added to the proxy policy only",
+			policies: []Policy{proxy, acl},
+			want: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"OutboundExceptions":{"PortExceptions":["53"]},"OutboundProxyPort":"15001","Type":"L4WFPPROXY"}`),
+				},
+				acl,
+			},
+		},
+		{
+			name: "dns port is appended to existing exceptions",
+			policies: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"L4WFPPROXY","OutboundProxyPort":"15001","OutboundExceptions":{"IpAddressExceptions":["10.0.0.1"],"PortExceptions":["443"]}}`),
+				},
+			},
+			want: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"OutboundExceptions":{"IpAddressExceptions":["10.0.0.1"],"PortExceptions":["443","53"]},"OutboundProxyPort":"15001","Type":"L4WFPPROXY"}`),
+				},
+			},
+		},
+		{
+			name:     "no proxy policy does not create one",
+			policies: []Policy{acl},
+			want:     []Policy{acl},
+		},
+		{
+			name: "invalid port exceptions",
+			policies: []Policy{
+				{
+					Type: EndpointPolicy,
+					Data: json.RawMessage(`{"Type":"L4WFPPROXY","OutboundExceptions":{"PortExceptions":"443"}}`),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AddL4WFPProxyDNSExceptions(tt.policies)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewL4WFPProxyPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting L4WFPProxySetting
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "outbound and inbound ports",
+			setting: L4WFPProxySetting{
+				OutboundProxyPort: "15001",
+				InboundProxyPort:  "15003",
+				UserSID:           "S-1-5-32-556",
+				FilterTuple:       json.RawMessage(`{"Protocols":"6"}`),
+			},
+			want: `{"Type":"L4WFPPROXY","InboundProxyPort":"15003","OutboundProxyPort":"15001","UserSID":"S-1-5-32-556","FilterTuple":{"Protocols":"6"}}`,
+		},
+		{
+			name:    "no proxy port",
+			setting: L4WFPProxySetting{UserSID: "S-1-5-32-556"},
+			wantErr: true,
+		},
+		{
+			name:    "port out of range",
+			setting: L4WFPProxySetting{OutboundProxyPort: "70000"},
+			wantErr: true,
+		},
+		{
+			name:    "port not a number",
+			setting: L4WFPProxySetting{InboundProxyPort: "http"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid user sid",
+			setting: L4WFPProxySetting{OutboundProxyPort: "15001", UserSID: "istio"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewL4WFPProxyPolicy(tt.setting)
+			if tt.wantErr {
+				require.ErrorIs(t, err, errInvalidL4WFPProxyPolicy)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, EndpointPolicy, got.Type)
+			require.JSONEq(t, tt.want, string(got.Data))
+
+			setting, err := ParseL4WFPProxySetting(got.Data)
+			require.NoError(t, err)
+			require.Equal(t, tt.setting.OutboundProxyPort, setting.OutboundProxyPort)
+			require.Equal(t, tt.setting.InboundProxyPort, setting.InboundProxyPort)
+		})
+	}
+}
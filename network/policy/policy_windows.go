@@ -61,6 +61,14 @@ type KVPairL4WfpProxyPolicy struct {
 	OutboundExceptions json.RawMessage `json:"OutboundExceptions"`
 }
 
+// VlanTrunk is the hns endpoint policy which makes the endpoint's port an 802.1q trunk of the allowed vlans.
+const VlanTrunk hcn.EndpointPolicyType = "VlanTrunk"
+
+// VlanTrunkPolicySetting lists the vlans delivered tagged to the endpoint.
+type VlanTrunkPolicySetting struct {
+	AllowedVlanIds []uint32 `json:",omitempty"`
+}
+
 type LoopbackDSR struct {
 	Type      CNIPolicyType `json:"Type"`
 	IPAddress net.IP        `json:"IPAddress"`
@@ -179,10 +187,14 @@ func SerializeOutBoundNATPolicy(policy Policy, epInfoData map[string]interface{}
 		}
 	}
 
+	// the cnet address space is only exempted by the policy of its family
+	ipv6 := IsIPv6ExceptionList(exceptionList)
 	if epInfoData[CnetAddressSpace] != nil {
 		if cnetAddressSpace := epInfoData[CnetAddressSpace].([]string); cnetAddressSpace != nil {
 			for _, ipAddress := range cnetAddressSpace {
-				outBoundNatPolicy.Exceptions = append(outBoundNatPolicy.Exceptions, ipAddress)
+				if IsIPv6(ipAddress) == ipv6 {
+					outBoundNatPolicy.Exceptions = append(outBoundNatPolicy.Exceptions, ipAddress)
+				}
 			}
 		}
 	}
@@ -337,10 +349,14 @@ func GetHcnOutBoundNATPolicy(policy Policy, epInfoData map[string]interface{}) (
 		}
 	}
 
+	// the cnet address space is only exempted by the policy of its family
+	ipv6 := IsIPv6ExceptionList(exceptionList)
 	if epInfoData[CnetAddressSpace] != nil {
 		if cnetAddressSpace := epInfoData[CnetAddressSpace].([]string); cnetAddressSpace != nil {
 			for _, ipAddress := range cnetAddressSpace {
-				outBoundNATPolicySetting.Exceptions = append(outBoundNATPolicySetting.Exceptions, ipAddress)
+				if IsIPv6(ipAddress) == ipv6 {
+					outBoundNATPolicySetting.Exceptions = append(outBoundNATPolicySetting.Exceptions, ipAddress)
+				}
 			}
 		}
 	}
@@ -441,6 +457,10 @@ func GetHcnL4WFPProxyPolicy(policy Policy) (hcn.EndpointPolicy, error) {
 
 	// Check beforehand, the input meets the expected format
 	// otherwise, endpoint creation will fail later on.
+	if _, err := ParseL4WFPProxySetting(policy.Data); err != nil {
+		return l4WfpEndpolicySetting, err
+	}
+
 	var l4WfpProxyPolicySetting hcn.L4WfpProxyPolicySetting
 	if err := json.Unmarshal(policy.Data, &l4WfpProxyPolicySetting); err != nil {
 		return l4WfpEndpolicySetting, err
@@ -580,3 +600,22 @@ func AddAccelnetPolicySetting() (hcn.EndpointPolicy, error) {
 
 	return endpointPolicy, nil
 }
+
+// AddVlanTrunkPolicySetting returns the endpoint policy delivering the vlans of vlanIDs tagged to the endpoint
+func AddVlanTrunkPolicySetting(vlanIDs []int) (hcn.EndpointPolicy, error) {
+	vlanTrunkPolicy := VlanTrunkPolicySetting{}
+	for _, vlanID := range vlanIDs {
+		vlanTrunkPolicy.AllowedVlanIds = append(vlanTrunkPolicy.AllowedVlanIds, uint32(vlanID))
+	}
+
+	rawPolicy, err := json.Marshal(vlanTrunkPolicy)
+	if err != nil {
+		return hcn.EndpointPolicy{}, errors.Wrap(err, "Failed to marshal vlan trunk policy")
+	}
+	endpointPolicy := hcn.EndpointPolicy{
+		Type:     VlanTrunk,
+		Settings: rawPolicy,
+	}
+
+	return endpointPolicy, nil
+}
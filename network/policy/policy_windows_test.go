@@ -29,6 +29,19 @@ var _ = Describe("Windows Policies", func() {
 			Expect(err).NotTo(BeNil())
 		})
 
+		It("Should raise error for invalid proxy port", func() {
+			policy := Policy{
+				Type: L4WFPProxyPolicy,
+				Data: []byte(`{
+					"Type": "L4WFPPROXY",
+					"OutboundProxyPort": "150001"
+					}`),
+			}
+
+			_, err := GetHcnL4WFPProxyPolicy(policy)
+			Expect(err).To(MatchError(errInvalidL4WFPProxyPolicy))
+		})
+
 		It("Should marshall the policy correctly", func() {
 			policy := Policy{
 				Type: L4WFPProxyPolicy,
@@ -113,6 +126,23 @@ var _ = Describe("Windows Policies", func() {
 			Expect(err).To(BeNil())
 			Expect(string(generatedPolicy.Settings)).To(Equal(expectedPolicy))
 		})
+
+		It("Should not add the ipv4 cnet address space to the ipv6 OutBoundNAT policy", func() {
+			policy := Policy{
+				Type: OutBoundNatPolicy,
+				Data: []byte(`{
+					"Type": "OutBoundNAT",
+					"ExceptionList": ["fd00:10::/64"]
+					}`),
+			}
+			expectedPolicy := `{"Exceptions":["fd00:10::/64"]}`
+
+			epInfoData := make(map[string]interface{})
+			epInfoData[CnetAddressSpace] = []string{"50.1.1.1", "60.1.1.1"}
+			generatedPolicy, err := GetHcnOutBoundNATPolicy(policy, epInfoData)
+			Expect(err).To(BeNil())
+			Expect(string(generatedPolicy.Settings)).To(Equal(expectedPolicy))
+		})
 	})
 
 	Describe("Test GetHcnRoutePolicy", func() {
@@ -0,0 +1,99 @@
+package network
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	vishnetlink "github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+const (
+	// The policy routing tables of the delegated nics of a pod are allocated from this range, above the tables the
+	// endpoint clients use by constant, like the tunneling table of transparent vlan, and below the default table.
+	minPolicyRouteTable = 100
+	maxPolicyRouteTable = 252
+	// policyRulePriority is the priority of the rules selecting the table of a delegated nic, ahead of the main table.
+	policyRulePriority = 1000
+)
+
+var errNoFreeRouteTable = errors.New("no free policy routing table")
+
+// ipRuleClient lists, adds and deletes the ip rules of the network namespace of the calling thread.
+type ipRuleClient interface {
+	RuleList(family int) ([]vishnetlink.Rule, error)
+	RuleAdd(rule *vishnetlink.Rule) error
+	RuleDel(rule *vishnetlink.Rule) error
+}
+
+type vishIPRuleClient struct{}
+
+func newIPRuleClient() ipRuleClient {
+	return vishIPRuleClient{}
+}
+
+func (vishIPRuleClient) RuleList(family int) ([]vishnetlink.Rule, error) {
+	rules, err := vishnetlink.RuleList(family)
+	return rules, errors.Wrap(err, "failed to list ip rules")
+}
+
+func (vishIPRuleClient) RuleAdd(rule *vishnetlink.Rule) error {
+	return errors.Wrap(vishnetlink.RuleAdd(rule), "failed to add ip rule")
+}
+
+func (vishIPRuleClient) RuleDel(rule *vishnetlink.Rule) error {
+	return errors.Wrap(vishnetlink.RuleDel(rule), "failed to delete ip rule")
+}
+
+// allocateRouteTable returns the lowest table of the policy routing range no rule looks up, the rules of the other
+// delegated nics of the pod holding the tables already allocated to them.
+func allocateRouteTable(rules []vishnetlink.Rule) (int, error) {
+	used := make(map[int]bool, len(rules))
+	for i := range rules {
+		used[rules[i].Table] = true
+	}
+	for table := minPolicyRouteTable; table <= maxPolicyRouteTable; table++ {
+		if !used[table] {
+			return table, nil
+		}
+	}
+	return 0, errNoFreeRouteTable
+}
+
+// newSourceRule returns the rule looking up table for the traffic sourced from ip.
+func newSourceRule(ip net.IP, table int) *vishnetlink.Rule {
+	rule := vishnetlink.NewRule()
+	rule.Priority = policyRulePriority
+	rule.Table = table
+	if ip.To4() != nil {
+		rule.Family = vishnetlink.FAMILY_V4
+		rule.Src = &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(ipv4FullMask, ipv4Bits)}
+	} else {
+		rule.Family = vishnetlink.FAMILY_V6
+		rule.Src = &net.IPNet{IP: ip, Mask: net.CIDRMask(ipv6FullMask, ipv6Bits)}
+	}
+	return rule
+}
+
+// deleteTableRules deletes the rules looking up table, all of them being attempted even when some fail, and returns
+// the first failure.
+func deleteTableRules(ipRules ipRuleClient, table int) error {
+	rules, err := ipRules.RuleList(vishnetlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for i := range rules {
+		if rules[i].Table != table {
+			continue
+		}
+		logger.Info("Deleting ip rule", zap.Int("table", table), zap.Stringer("src", rules[i].Src))
+		if err := ipRules.RuleDel(&rules[i]); err != nil {
+			logger.Error("Failed to delete ip rule", zap.Int("table", table), zap.Stringer("src", rules[i].Src), zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return errors.Wrapf(firstErr, "failed to delete the rules of table %d", table)
+}
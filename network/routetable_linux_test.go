@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+	vishnetlink "github.com/vishvananda/netlink"
+)
+
+var errFakeIPRule = errors.New("fake ip rule failure")
+
+// fakeIPRuleClient keeps the rules of a namespace in memory, and fails adding the rules from failSrc.
+type fakeIPRuleClient struct {
+	rules   []vishnetlink.Rule
+	failSrc string
+}
+
+func (f *fakeIPRuleClient) RuleList(int) ([]vishnetlink.Rule, error) {
+	return append([]vishnetlink.Rule(nil), f.rules...), nil
+}
+
+func (f *fakeIPRuleClient) RuleAdd(rule *vishnetlink.Rule) error {
+	if rule.Src != nil && rule.Src.IP.String() == f.failSrc {
+		return errFakeIPRule
+	}
+	f.rules = append(f.rules, *rule)
+	return nil
+}
+
+func (f *fakeIPRuleClient) RuleDel(rule *vishnetlink.Rule) error {
+	for i := range f.rules {
+		if f.rules[i].Table == rule.Table && f.rules[i].Src.String() == rule.Src.String() {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return nil
+		}
+	}
+	return errFakeIPRule
+}
+
+func TestAllocateRouteTable(t *testing.T) {
+	table, err := allocateRouteTable(nil)
+	require.NoError(t, err)
+	require.Equal(t, minPolicyRouteTable, table)
+
+	// the tables of the other nics, and the ones outside of the range, are skipped
+	rules := []vishnetlink.Rule{{Table: 254}, {Table: tunnelingTable}, {Table: 100}, {Table: 101}, {Table: 103}}
+	table, err = allocateRouteTable(rules)
+	require.NoError(t, err)
+	require.Equal(t, 102, table)
+
+	rules = nil
+	for table := minPolicyRouteTable; table <= maxPolicyRouteTable; table++ {
+		rules = append(rules, vishnetlink.Rule{Table: table})
+	}
+	_, err = allocateRouteTable(rules)
+	require.ErrorIs(t, err, errNoFreeRouteTable)
+}
+
+func TestSecondaryPolicyRouting(t *testing.T) {
+	ipRules := &fakeIPRuleClient{}
+	ep := &endpoint{
+		NetworkNameSpace:    "testns",
+		SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}, "eth2": {Name: "eth2"}},
+	}
+	client := &SecondaryEndpointClient{
+		netlink:   netlink.NewMockNetlink(false, ""),
+		netioshim: netio.NewMockNetIO(false, 0),
+		plClient:  platform.NewMockExecClient(false),
+		nsClient:  NewMockNamespaceClient(),
+		ipRules:   ipRules,
+		ep:        ep,
+	}
+	routes := []RouteInfo{{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, ipv4Bits)}, Gw: net.ParseIP("10.1.0.1")}}
+
+	// each nic of the pod gets a table of its own
+	require.NoError(t, client.addPolicyRouting(ep.SecondaryInterfaces["eth1"],
+		[]net.IPNet{{IP: net.ParseIP("10.1.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)}}, routes))
+	require.NoError(t, client.addPolicyRouting(ep.SecondaryInterfaces["eth2"],
+		[]net.IPNet{{IP: net.ParseIP("10.2.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)}}, routes))
+	require.Equal(t, minPolicyRouteTable, ep.SecondaryInterfaces["eth1"].RouteTable)
+	require.Equal(t, minPolicyRouteTable+1, ep.SecondaryInterfaces["eth2"].RouteTable)
+	require.Equal(t, minPolicyRouteTable+1, ep.RouteTable)
+	require.Len(t, ipRules.rules, 2)
+	require.Equal(t, "10.2.0.4/32", ipRules.rules[1].Src.String())
+	require.Equal(t, policyRulePriority, ipRules.rules[1].Priority)
+
+	// the rules added are deleted again when one fails
+	ipRules.failSrc = "10.3.0.5"
+	ep.SecondaryInterfaces["eth3"] = &InterfaceInfo{Name: "eth3"}
+	err := client.addPolicyRouting(ep.SecondaryInterfaces["eth3"], []net.IPNet{
+		{IP: net.ParseIP("10.3.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+		{IP: net.ParseIP("10.3.0.5"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+	}, routes)
+	require.ErrorIs(t, err, errFakeIPRule)
+	require.Len(t, ipRules.rules, 2)
+	require.Zero(t, ep.SecondaryInterfaces["eth3"].RouteTable)
+	delete(ep.SecondaryInterfaces, "eth3")
+
+	// the rules of a nic go with it
+	require.NoError(t, client.DetachInterface("eth1"))
+	require.Len(t, ipRules.rules, 1)
+	require.Equal(t, minPolicyRouteTable+1, ipRules.rules[0].Table)
+
+	require.NoError(t, client.DeleteEndpoints(ep))
+	require.Empty(t, ipRules.rules)
+}
@@ -0,0 +1,22 @@
+package network
+
+// The devices the infra nic of a pod is handed to the vm of a sandboxed runtime with, on the container veth in the
+// netns the vm owns.
+const (
+	// SandboxDeviceTap is a tap device the traffic of the container veth is redirected to and from with tc.
+	SandboxDeviceTap = "tap"
+	// SandboxDeviceIPVTap is an ipvtap device on the container veth.
+	SandboxDeviceIPVTap = "ipvtap"
+)
+
+// maxIfNameLen is the longest interface name the kernel accepts.
+const maxIfNameLen = 15
+
+// SandboxDeviceName returns the name of the device handed to the vm for the container interface ifName.
+func SandboxDeviceName(ifName string) string {
+	name := "tap_" + ifName
+	if len(name) > maxIfNameLen {
+		name = name[:maxIfNameLen]
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package network
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var errUnknownSandboxDevice = errors.New("unknown sandbox device")
+
+// addSandboxDevice adds the device handed to the vm of a sandboxed runtime on the container interface ifName. It runs
+// in the netns of the pod. The ip configuration stays on the container interface, where the runtime reads it from to
+// configure the vm.
+func addSandboxDevice(nl netlink.NetlinkInterface, netioshim netio.NetIOInterface, plc platform.ExecClient, ifName, device string) error {
+	contIf, err := netioshim.GetNetworkInterfaceByName(ifName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get container interface %s", ifName)
+	}
+
+	name := SandboxDeviceName(ifName)
+	logger.Info("Adding sandbox device", zap.String("device", device), zap.String("name", name), zap.String("ifName", ifName))
+	switch device {
+	case SandboxDeviceIPVTap:
+		// the ipvtap device shares the mac of the container interface, so the host sees no new address
+		link := &netlink.IPVlanLink{
+			LinkInfo: netlink.LinkInfo{
+				Type:        netlink.LINK_TYPE_IPVTAP,
+				Name:        name,
+				MTU:         uint(contIf.MTU),
+				ParentIndex: contIf.Index,
+			},
+			Mode: netlink.IPVLAN_MODE_L2,
+		}
+		if err := nl.AddLink(link); err != nil {
+			return errors.Wrapf(err, "failed to add ipvtap device %s", name)
+		}
+	case SandboxDeviceTap:
+		if err := addRedirectedTap(plc, ifName, name, contIf.MTU); err != nil {
+			// the netns outlives the failed add, so don't leave a half wired tap in it
+			if delErr := nl.DeleteLink(name); delErr != nil {
+				logger.Error("Failed to delete tap device", zap.String("name", name), zap.Error(delErr))
+			}
+			return err
+		}
+	default:
+		return errors.Wrapf(errUnknownSandboxDevice, "%q", device)
+	}
+
+	if err := nl.SetLinkState(name, true); err != nil {
+		return errors.Wrapf(err, "failed to set sandbox device %s up", name)
+	}
+
+	return nil
+}
+
+// addRedirectedTap adds the tap device tapName and redirects all the traffic between it and the container interface
+// ifName with tc, which the netlink package has no support for.
+func addRedirectedTap(plc platform.ExecClient, ifName, tapName string, mtu int) error {
+	cmds := [][]string{
+		{"ip", "tuntap", "add", "dev", tapName, "mode", "tap"},
+		{"ip", "link", "set", "dev", tapName, "mtu", strconv.Itoa(mtu)},
+		{"tc", "qdisc", "add", "dev", ifName, "ingress"},
+		{"tc", "qdisc", "add", "dev", tapName, "ingress"},
+		{"tc", "filter", "add", "dev", ifName, "parent", "ffff:", "protocol", "all", "u32", "match", "u8", "0", "0",
+			"action", "mirred", "egress", "redirect", "dev", tapName},
+		{"tc", "filter", "add", "dev", tapName, "parent", "ffff:", "protocol", "all", "u32", "match", "u8", "0", "0",
+			"action", "mirred", "egress", "redirect", "dev", ifName},
+	}
+	for _, cmd := range cmds {
+		if _, err := plc.ExecuteCommand(context.TODO(), cmd[0], cmd[1:]...); err != nil {
+			return errors.Wrapf(err, "failed to wire tap device %s to %s", tapName, ifName)
+		}
+	}
+
+	return nil
+}
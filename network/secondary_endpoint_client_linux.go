@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"net"
 	"os"
 	"strings"
 	"time"
@@ -12,7 +13,9 @@ import (
 	"github.com/Azure/azure-container-networking/network/networkutils"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/pkg/errors"
+	vishnetlink "github.com/vishvananda/netlink"
 	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
 )
 
 var errorSecondaryEndpointClient = errors.New("SecondaryEndpointClient Error")
@@ -28,6 +31,8 @@ type SecondaryEndpointClient struct {
 	netUtilsClient networkutils.NetworkUtils
 	nsClient       NamespaceClientInterface
 	dhcpClient     dhcpClient
+	ethtool        ethtoolClient
+	ipRules        ipRuleClient
 	ep             *endpoint
 }
 
@@ -46,6 +51,8 @@ func NewSecondaryEndpointClient(
 		netUtilsClient: networkutils.NewNetworkUtils(nl, plc),
 		nsClient:       nsc,
 		dhcpClient:     dhcpClient,
+		ethtool:        newEthtoolClient(),
+		ipRules:        newIPRuleClient(),
 		ep:             endpoint,
 	}
 
@@ -87,6 +94,14 @@ func (client *SecondaryEndpointClient) DeleteEndpointRules(_ *endpoint) {
 }
 
 func (client *SecondaryEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
+	// The vf is sized while the host still owns it, some drivers reset the queues when the link is brought up in the pod.
+	if epInfo.EthtoolSettings != nil {
+		logger.Info("[net] Applying ethtool settings.", zap.String("IfName", epInfo.IfName), zap.Any("EthtoolSettings", epInfo.EthtoolSettings))
+		if err := client.ethtool.SetSettings(epInfo.IfName, epInfo.EthtoolSettings); err != nil {
+			return newErrorSecondaryEndpointClient(err)
+		}
+	}
+
 	// Move the container interface to container's network namespace.
 	logger.Info("[net] Setting link %v netns %v.", zap.String("IfName", epInfo.IfName), zap.String("NetNsPath", epInfo.NetNsPath))
 	if err := client.netlink.SetLinkNetNs(epInfo.IfName, nsID); err != nil {
@@ -143,6 +158,10 @@ func (client *SecondaryEndpointClient) ConfigureContainerInterfacesAndRoutes(epI
 	if err != nil {
 		return errors.Wrapf(err, "failed to issue dhcp discover packet to create mapping in host")
 	}
+
+	if err := client.addPolicyRouting(ifInfo, epInfo.IPAddresses, epInfo.Routes); err != nil {
+		return newErrorSecondaryEndpointClient(err)
+	}
 	logger.Info("Finished configuring container interfaces and routes for secondary endpoint client")
 
 	return nil
@@ -187,8 +206,14 @@ func (client *SecondaryEndpointClient) DeleteEndpoints(ep *endpoint) error {
 			logger.Error("Failed to exit netns with", zap.Error(newErrorSecondaryEndpointClient(err)))
 		}
 	}()
-	// TODO: For stateless cni linux, check if delegated vmnic type, and if so, delete using this *endpoint* struct's ifname
-	for iface := range ep.SecondaryInterfaces {
+	for iface, ifInfo := range ep.SecondaryInterfaces {
+		// the kernel drops the routes of the table along with the nic, not the rules looking it up
+		if ifInfo.RouteTable != 0 {
+			if err := deleteTableRules(client.ipRules, ifInfo.RouteTable); err != nil {
+				logger.Error("Failed to delete policy routing rules", zap.String("IfName", iface), zap.Error(err))
+			}
+		}
+
 		if err := client.netlink.SetLinkNetNs(iface, uintptr(vmns)); err != nil {
 			logger.Error("Failed to move interface", zap.String("IfName", iface), zap.Error(newErrorSecondaryEndpointClient(err)))
 			continue
@@ -199,3 +224,111 @@ func (client *SecondaryEndpointClient) DeleteEndpoints(ep *endpoint) error {
 
 	return nil
 }
+
+// addPolicyRouting routes the traffic sourced from the ips of the delegated nic through a table of its own, so that in
+// multi-NIC pods it leaves by the nic it belongs to whatever the default route of the main table. The routes of the nic
+// are copied to the table, which is allocated among the tables the rules of the pod don't look up yet, and a rule per
+// ip selects it. The table is kept in the state of the endpoint to delete the rules with the nic.
+func (client *SecondaryEndpointClient) addPolicyRouting(ifInfo *InterfaceInfo, ipAddresses []net.IPNet, routes []RouteInfo) error {
+	table := ifInfo.RouteTable
+	if table == 0 {
+		rules, err := client.ipRules.RuleList(vishnetlink.FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		if table, err = allocateRouteTable(rules); err != nil {
+			return err
+		}
+	}
+
+	tableRoutes := make([]RouteInfo, len(routes))
+	for i := range routes {
+		tableRoutes[i] = routes[i]
+		tableRoutes[i].Table = table
+	}
+	logger.Info("Adding policy routing table", zap.String("IfName", ifInfo.Name), zap.Int("table", table))
+	if err := addRoutes(client.netlink, client.netioshim, ifInfo.Name, tableRoutes); err != nil {
+		return err
+	}
+
+	for i := range ipAddresses {
+		// the rules of a table kept in the state may be there already
+		if err := client.ipRules.RuleAdd(newSourceRule(ipAddresses[i].IP, table)); err != nil && !errors.Is(err, unix.EEXIST) {
+			//nolint:errcheck // the rule failure is returned
+			deleteTableRules(client.ipRules, table)
+			return errors.Wrapf(err, "failed to add rule from %s to table %d", ipAddresses[i].IP, table)
+		}
+	}
+
+	ifInfo.RouteTable = table
+	client.ep.RouteTable = table
+	return nil
+}
+
+// DetachInterface moves the delegated nic ifName of a running endpoint back to the host, after deleting the routes
+// added through it, and removes it from the SecondaryInterfaces of the endpoint. A nic the fabric already took from
+// the pod, or whose pod namespace is gone, has nothing left to move.
+func (client *SecondaryEndpointClient) DetachInterface(ifName string) error {
+	ifInfo, exists := client.ep.SecondaryInterfaces[ifName]
+	if !exists {
+		return nil
+	}
+
+	vmns, err := netns.New().Get()
+	if err != nil {
+		return newErrorSecondaryEndpointClient(err)
+	}
+
+	logger.Info("Opening netns", zap.Any("NetNsPath", client.ep.NetworkNameSpace))
+	ns, err := client.nsClient.OpenNamespace(client.ep.NetworkNameSpace)
+	if err != nil {
+		if strings.Contains(err.Error(), errFileNotExist.Error()) {
+			delete(client.ep.SecondaryInterfaces, ifName)
+			return nil
+		}
+
+		return newErrorSecondaryEndpointClient(err)
+	}
+	defer ns.Close()
+
+	logger.Info("Entering netns", zap.Any("NetNsPath", client.ep.NetworkNameSpace))
+	if err := ns.Enter(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			delete(client.ep.SecondaryInterfaces, ifName)
+			return nil
+		}
+
+		return newErrorSecondaryEndpointClient(err)
+	}
+
+	defer func() {
+		logger.Info("Exiting netns", zap.Any("NetNsPath", client.ep.NetworkNameSpace))
+		if err := ns.Exit(); err != nil {
+			logger.Error("Failed to exit netns with", zap.Error(newErrorSecondaryEndpointClient(err)))
+		}
+	}()
+
+	if _, err := client.netioshim.GetNetworkInterfaceByName(ifName); err != nil {
+		logger.Info("Delegated nic is already gone from the pod", zap.String("IfName", ifName), zap.Error(err))
+		delete(client.ep.SecondaryInterfaces, ifName)
+		return nil
+	}
+
+	// the kernel drops the routes of the nic when it leaves the namespace, so a failure here doesn't stop the detach
+	if err := deleteRoutes(client.netlink, client.netioshim, ifName, ifInfo.Routes); err != nil {
+		logger.Error("Failed to delete routes of delegated nic", zap.String("IfName", ifName), zap.Error(err))
+	}
+	if ifInfo.RouteTable != 0 {
+		if err := deleteTableRules(client.ipRules, ifInfo.RouteTable); err != nil {
+			logger.Error("Failed to delete policy routing rules of delegated nic", zap.String("IfName", ifName), zap.Error(err))
+		}
+	}
+
+	logger.Info("Moving delegated nic back to the host", zap.String("IfName", ifName))
+	if err := client.netlink.SetLinkNetNs(ifName, uintptr(vmns)); err != nil {
+		return newErrorSecondaryEndpointClient(err)
+	}
+
+	delete(client.ep.SecondaryInterfaces, ifName)
+	return nil
+}
@@ -37,6 +37,7 @@ func TestSecondaryAddEndpoints(t *testing.T) {
 				netioshim:      netio.NewMockNetIO(false, 0),
 				ep:             &endpoint{SecondaryInterfaces: make(map[string]*InterfaceInfo)},
 				dhcpClient:     &mockDHCP{},
+				ipRules:        &fakeIPRuleClient{},
 			},
 			epInfo:  &EndpointInfo{MacAddress: mac},
 			wantErr: false,
@@ -258,6 +259,7 @@ func TestSecondaryConfigureContainerInterfacesAndRoutes(t *testing.T) {
 				netUtilsClient: networkutils.NewNetworkUtils(nl, plc),
 				netioshim:      netio.NewMockNetIO(false, 0),
 				dhcpClient:     &mockDHCP{},
+				ipRules:        &fakeIPRuleClient{},
 				ep:             &endpoint{SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}}},
 			},
 			epInfo: &EndpointInfo{
@@ -284,6 +286,7 @@ func TestSecondaryConfigureContainerInterfacesAndRoutes(t *testing.T) {
 				netUtilsClient: networkutils.NewNetworkUtils(netlink.NewMockNetlink(true, ""), plc),
 				netioshim:      netio.NewMockNetIO(false, 0),
 				dhcpClient:     &mockDHCP{},
+				ipRules:        &fakeIPRuleClient{},
 				ep:             &endpoint{SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}}},
 			},
 			epInfo: &EndpointInfo{
@@ -306,6 +309,7 @@ func TestSecondaryConfigureContainerInterfacesAndRoutes(t *testing.T) {
 				netUtilsClient: networkutils.NewNetworkUtils(nl, plc),
 				netioshim:      netio.NewMockNetIO(true, 1),
 				dhcpClient:     &mockDHCP{},
+				ipRules:        &fakeIPRuleClient{},
 				ep:             &endpoint{SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}}},
 			},
 			epInfo: &EndpointInfo{
@@ -333,6 +337,7 @@ func TestSecondaryConfigureContainerInterfacesAndRoutes(t *testing.T) {
 				netUtilsClient: networkutils.NewNetworkUtils(nl, plc),
 				netioshim:      netio.NewMockNetIO(false, 0),
 				dhcpClient:     &mockDHCP{},
+				ipRules:        &fakeIPRuleClient{},
 				ep:             &endpoint{SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}}},
 			},
 			epInfo: &EndpointInfo{
@@ -355,6 +360,7 @@ func TestSecondaryConfigureContainerInterfacesAndRoutes(t *testing.T) {
 				netUtilsClient: networkutils.NewNetworkUtils(nl, plc),
 				netioshim:      netio.NewMockNetIO(false, 0),
 				dhcpClient:     &mockDHCP{},
+				ipRules:        &fakeIPRuleClient{},
 				ep:             &endpoint{SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1"}}},
 			},
 			epInfo: &EndpointInfo{
@@ -378,3 +384,139 @@ func TestSecondaryConfigureContainerInterfacesAndRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestSecondaryDetachInterface(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	plc := platform.NewMockExecClient(false)
+	newEndpoint := func(netNs string) *endpoint {
+		return &endpoint{
+			NetworkNameSpace: netNs,
+			SecondaryInterfaces: map[string]*InterfaceInfo{
+				"eth1": {
+					Name: "eth1",
+					Routes: []RouteInfo{
+						{
+							Dst: net.IPNet{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(ipv4FullMask, ipv4Bits)},
+						},
+					},
+				},
+				"eth2": {Name: "eth2"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		netlink      netlink.NetlinkInterface
+		netioshim    netio.NetIOInterface
+		ep           *endpoint
+		ifName       string
+		wantErr      bool
+		wantDetached bool
+	}{
+		{
+			name:         "Detach interface happy path",
+			netlink:      netlink.NewMockNetlink(false, ""),
+			netioshim:    netio.NewMockNetIO(false, 0),
+			ep:           newEndpoint("testns"),
+			ifName:       "eth1",
+			wantDetached: true,
+		},
+		{
+			name:         "Detach interface already reclaimed",
+			netlink:      netlink.NewMockNetlink(false, ""),
+			netioshim:    netio.NewMockNetIO(true, 1),
+			ep:           newEndpoint("testns"),
+			ifName:       "eth1",
+			wantDetached: true,
+		},
+		{
+			name:         "Detach interface namespace not found",
+			netlink:      netlink.NewMockNetlink(false, ""),
+			netioshim:    netio.NewMockNetIO(false, 0),
+			ep:           newEndpoint(""),
+			ifName:       "eth1",
+			wantDetached: true,
+		},
+		{
+			name:      "Detach interface netlink failure",
+			netlink:   netlink.NewMockNetlink(true, "netlink failure"),
+			netioshim: netio.NewMockNetIO(false, 0),
+			ep:        newEndpoint("testns"),
+			ifName:    "eth1",
+			wantErr:   true,
+		},
+		{
+			name:      "Detach unknown interface",
+			netlink:   netlink.NewMockNetlink(false, ""),
+			netioshim: netio.NewMockNetIO(false, 0),
+			ep:        newEndpoint("testns"),
+			ifName:    "eth3",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := &SecondaryEndpointClient{
+				netlink:        tt.netlink,
+				plClient:       plc,
+				netUtilsClient: networkutils.NewNetworkUtils(nl, plc),
+				netioshim:      tt.netioshim,
+				nsClient:       NewMockNamespaceClient(),
+				ep:             tt.ep,
+			}
+			err := client.DetachInterface(tt.ifName)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			// the other delegated nics of the endpoint stay in the pod
+			require.Contains(t, tt.ep.SecondaryInterfaces, "eth2")
+			if tt.wantDetached {
+				require.NotContains(t, tt.ep.SecondaryInterfaces, "eth1")
+			} else {
+				require.Contains(t, tt.ep.SecondaryInterfaces, "eth1")
+			}
+		})
+	}
+}
+
+func TestDetachDelegatedNIC(t *testing.T) {
+	mac1, _ := net.ParseMAC("12:34:56:78:9a:bc")
+	mac2, _ := net.ParseMAC("22:34:56:78:9a:bc")
+	nw := &network{
+		Id: "nw",
+		Endpoints: map[string]*endpoint{
+			// an infra endpoint holding a delegated nic the way older cni versions did
+			"container1-eth0": {
+				Id: "container1-eth0", ContainerID: "container1", NetworkNameSpace: "testns", NICType: cns.InfraNIC,
+				SecondaryInterfaces: map[string]*InterfaceInfo{"eth2": {Name: "eth2", MacAddress: mac2}},
+			},
+			"container1-eth1": {
+				Id: "container1-eth1", ContainerID: "container1", NetworkNameSpace: "testns", IfName: "eth1",
+				NICType:             cns.NodeNetworkInterfaceFrontendNIC,
+				SecondaryInterfaces: map[string]*InterfaceInfo{"eth1": {Name: "eth1", MacAddress: mac1}},
+			},
+		},
+	}
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{"eth0": {Networks: map[string]*network{nw.Id: nw}}},
+		netlink:            netlink.NewMockNetlink(false, ""),
+		plClient:           platform.NewMockExecClient(false),
+		netio:              netio.NewMockNetIO(false, 0),
+		nsClient:           NewMockNamespaceClient(),
+	}
+
+	require.ErrorIs(t, nm.DetachDelegatedNIC("nw", "container2", mac1), errEndpointNotFound)
+
+	// the endpoint of the nic is deleted with it, the pod keeps its infra endpoint
+	require.NoError(t, nm.DetachDelegatedNIC("nw", "container1", mac1))
+	require.NotContains(t, nw.Endpoints, "container1-eth1")
+	require.Contains(t, nw.Endpoints, "container1-eth0")
+
+	require.NoError(t, nm.DetachDelegatedNIC("nw", "container1", mac2))
+	require.Contains(t, nw.Endpoints, "container1-eth0")
+	require.Empty(t, nw.Endpoints["container1-eth0"].SecondaryInterfaces)
+}
@@ -33,10 +33,7 @@ const (
 var logger = log.CNILogger.With(zap.String("component", "net"))
 
 type ipTablesClient interface {
-	InsertIptableRule(version, tableName, chainName, match, target string) error
-	AppendIptableRule(version, tableName, chainName, match, target string) error
-	DeleteIptableRule(version, tableName, chainName, match, target string) error
-	CreateChain(version, tableName, chainName string) error
+	Commit(tx *iptables.Transaction) error
 }
 
 var errorSnatClient = errors.New("SnatClient Error")
@@ -45,6 +42,13 @@ func newErrorSnatClient(errStr string) error {
 	return fmt.Errorf("%w : %s", errorSnatClient, errStr)
 }
 
+// PortRule narrows the host to NC or NC to host allow rules to the destination ports of its protocols.
+type PortRule struct {
+	Protocols []string
+	// Ports are single ports and ranges like 8000-8080, all the ports of the protocols when empty.
+	Ports []string
+}
+
 type Client struct {
 	hostSnatVethName       string
 	hostPrimaryMac         string
@@ -52,6 +56,9 @@ type Client struct {
 	localIP                string
 	SnatBridgeIP           string
 	SkipAddressesFromBlock []string
+	// HostToNCPortRules and NCToHostPortRules narrow the allow rules, which allow all the ports when they are empty
+	HostToNCPortRules      []PortRule
+	NCToHostPortRules      []PortRule
 	enableProxyArpOnBridge bool
 	netlink                netlink.NetlinkInterface
 	plClient               platform.ExecClient
@@ -132,25 +139,37 @@ func (client *Client) CreateSnatEndpoint() error {
 	return nil
 }
 
-// AllowIPAddressesOnSnatBridge adds iptables rules  that allows only specific Private IPs via linux bridge
-func (client *Client) AllowIPAddressesOnSnatBridge() error {
-	nu := networkutils.NewNetworkUtils(client.netlink, client.plClient)
-	if err := nu.AllowIPAddresses(client.ipTablesClient, SnatBridgeName, client.SkipAddressesFromBlock, iptables.Insert); err != nil {
-		logger.Error("AllowIPAddresses failed with", zap.Error(err))
-		return newErrorSnatClient(err.Error())
+// AddSnatEndpointRules programs the iptables rules of the snat endpoint in a single transaction, so a failure leaves
+// none of them behind: the private IPs allowed and blocked via the linux bridge, forwarding from it, and optionally the
+// rules allowing host to NC and NC to host communication.
+func (client *Client) AddSnatEndpointRules(hostToNC, ncToHost bool) error {
+	// Enable ip forwading on linux vm.
+	// sysctl -w net.ipv4.ip_forward=1
+	if _, err := client.plClient.ExecuteRawCommand(enableIPForwardCmd); err != nil {
+		return errors.Wrap(err, "enable ipforwarding command failed")
 	}
 
-	return nil
-}
-
-// BlockIPAddressesOnSnatBridge adds iptables rules  that blocks all private IPs flowing via linux bridge
-func (client *Client) BlockIPAddressesOnSnatBridge() error {
 	nu := networkutils.NewNetworkUtils(client.netlink, client.plClient)
-	if err := nu.BlockIPAddresses(client.ipTablesClient, SnatBridgeName, iptables.Append); err != nil {
-		logger.Error("AllowIPAddresses failed with", zap.Error(err))
+	tx := iptables.NewTransaction(iptables.V4)
+	// Allow specific Private IPs via linux bridge, and block all the others
+	nu.AllowIPAddresses(tx, SnatBridgeName, client.SkipAddressesFromBlock, iptables.Insert)
+	nu.BlockIPAddresses(tx, SnatBridgeName, iptables.Append)
+	// Append a rule in forward chain to allow forwarding from bridge
+	tx.AppendRule(iptables.Filter, iptables.Forward, "", iptables.Accept)
+	if hostToNC {
+		client.addInboundFromHostToNCRules(tx)
+	}
+	if ncToHost {
+		client.addInboundFromNCToHostRules(tx)
+	}
+	if err := client.ipTablesClient.Commit(tx); err != nil {
+		logger.Error("AddSnatEndpointRules failed with", zap.Error(err))
 		return newErrorSnatClient(err.Error())
 	}
 
+	if hostToNC || ncToHost {
+		return client.addContainerStaticArpEntry()
+	}
 	return nil
 }
 
@@ -183,57 +202,106 @@ func getNCLocalAndGatewayIP(client *Client) (brIP, contIP net.IP) {
 	return bridgeIP, containerIP
 }
 
-// This function adds iptables rules that allows only host to NC communication and not the other way
-func (client *Client) AllowInboundFromHostToNC() error {
-	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
-
-	// Create CNI Output chain
-	if err := client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
+// allowMatchConditions returns the match conditions of the rules allowing the connections from src to dst, one per
+// protocol of each port rule, or a single one for all the protocols and ports when there is no port rule.
+func allowMatchConditions(src, dst net.IP, portRules []PortRule) []string {
+	base := fmt.Sprintf("-s %s -d %s", src.String(), dst.String())
+	if len(portRules) == 0 {
+		return []string{base}
+	}
+
+	matchConditions := []string{}
+	for _, rule := range portRules {
+		for _, protocol := range rule.Protocols {
+			matchCondition := fmt.Sprintf("%s -p %s", base, protocol)
+			if len(rule.Ports) > 0 {
+				// iptables separates the first and last ports of a range with a colon
+				matchCondition += fmt.Sprintf(" -m multiport --dports %s", strings.ReplaceAll(strings.Join(rule.Ports, ","), "-", ":"))
+			}
+			matchConditions = append(matchConditions, matchCondition)
+		}
 	}
+	return matchConditions
+}
 
-	// Forward traffic from Ouptut chain to CNI Output chain
-	if err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Output, "", iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
-	}
+// addInboundFromHostToNCRules adds the rules that allow only host to NC communication and not the other way.
+func (client *Client) addInboundFromHostToNCRules(tx *iptables.Transaction) {
+	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
+
+	// Create CNI Output chain, and forward traffic from Output chain to it
+	tx.CreateChain(iptables.Filter, iptables.CNIOutputChain)
+	tx.InsertRule(iptables.Filter, iptables.Output, "", iptables.CNIOutputChain)
 
 	// Allow connection from Host to NC
-	matchCondition := fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String())
-	err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting output rule failed with ", zap.Error(err))
-		return newErrorSnatClient(err.Error())
+	for _, matchCondition := range allowMatchConditions(bridgeIP, containerIP, client.HostToNCPortRules) {
+		tx.InsertRule(iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
 	}
 
-	// Create cniinput chain
-	if err = client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
-		return newErrorSnatClient(err.Error())
+	// Create cniinput chain, and forward from Input to it
+	tx.CreateChain(iptables.Filter, iptables.CNIInputChain)
+	tx.InsertRule(iptables.Filter, iptables.Input, "", iptables.CNIInputChain)
+
+	// Accept packets from NC only if established connection
+	matchCondition := fmt.Sprintf(" -i %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related)
+	tx.InsertRule(iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
+}
+
+// addInboundFromNCToHostRules adds the rules that allow only NC to host communication and not the other way.
+func (client *Client) addInboundFromNCToHostRules(tx *iptables.Transaction) {
+	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
+
+	// Create CNI Input chain, and forward traffic from Input to it
+	tx.CreateChain(iptables.Filter, iptables.CNIInputChain)
+	tx.InsertRule(iptables.Filter, iptables.Input, "", iptables.CNIInputChain)
+
+	// Allow NC to Host connection
+	for _, matchCondition := range allowMatchConditions(containerIP, bridgeIP, client.NCToHostPortRules) {
+		tx.InsertRule(iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
 	}
 
-	// Forward from Input to cniinput chain
-	if err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Input, "", iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting forward rule to failed with", zap.Any("CNIOutputChain", iptables.CNIOutputChain), zap.Error(err))
+	// Create CNI output chain, and forward traffic from Output to it
+	tx.CreateChain(iptables.Filter, iptables.CNIOutputChain)
+	tx.InsertRule(iptables.Filter, iptables.Output, "", iptables.CNIOutputChain)
+
+	// Accept packets from Host only if established connection
+	matchCondition := fmt.Sprintf(" -o %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related)
+	tx.InsertRule(iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
+}
+
+// This function adds iptables rules that allows only host to NC communication and not the other way
+func (client *Client) AllowInboundFromHostToNC() error {
+	tx := iptables.NewTransaction(iptables.V4)
+	client.addInboundFromHostToNCRules(tx)
+	if err := client.ipTablesClient.Commit(tx); err != nil {
+		logger.Error("AllowInboundFromHostToNC: Programming rules failed with", zap.Error(err))
 		return newErrorSnatClient(err.Error())
 	}
 
-	// Accept packets from NC only if established connection
-	matchCondition = fmt.Sprintf(" -i %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related)
-	err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting input rule failed with", zap.Error(err))
+	return client.addContainerStaticArpEntry()
+}
+
+// This function adds iptables rules that allows only NC to Host communication and not the other way
+func (client *Client) AllowInboundFromNCToHost() error {
+	tx := iptables.NewTransaction(iptables.V4)
+	client.addInboundFromNCToHostRules(tx)
+	if err := client.ipTablesClient.Commit(tx); err != nil {
+		logger.Error("AllowInboundFromNCToHost: Programming rules failed with", zap.Error(err))
 		return newErrorSnatClient(err.Error())
 	}
 
+	return client.addContainerStaticArpEntry()
+}
+
+// addContainerStaticArpEntry adds a static arp entry for the container local IP, to prevent arp going out of VM.
+func (client *Client) addContainerStaticArpEntry() error {
+	_, containerIP := getNCLocalAndGatewayIP(client)
+
 	snatContainerVeth, err := client.netioClient.GetNetworkInterfaceByName(client.containerSnatVethName)
 	if err != nil {
 		logger.Info("Could not find interface", zap.String("containerSnatVethName", client.containerSnatVethName))
-		return errors.Wrap(newErrorSnatClient(err.Error()), "could not find container snat veth name for allow host to nc")
+		return errors.Wrap(newErrorSnatClient(err.Error()), "could not find container snat veth name for static arp entry")
 	}
 
-	// Add static arp entry for localIP to prevent arp going out of VM
 	logger.Info("Adding static arp entry for ip", zap.Any("containerIP", containerIP),
 		zap.String("HardwareAddr", snatContainerVeth.HardwareAddr.String()))
 	linkInfo := netlink.LinkInfo{
@@ -244,7 +312,7 @@ func (client *Client) AllowInboundFromHostToNC() error {
 
 	err = client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.ADD, netlink.NUD_PERMANENT)
 	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Error adding static arp entry for ip", zap.Any("containerIP", containerIP),
+		logger.Error("Error adding static arp entry for ip", zap.Any("containerIP", containerIP),
 			zap.String("HardwareAddr", snatContainerVeth.HardwareAddr.String()), zap.Error(err))
 		return newErrorSnatClient(err.Error())
 	}
@@ -256,111 +324,36 @@ func (client *Client) DeleteInboundFromHostToNC() error {
 	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
 
 	// Delete allow connection from Host to NC
-	matchCondition := fmt.Sprintf("-s %s -d %s", bridgeIP.String(), containerIP.String())
-	err := client.ipTablesClient.DeleteIptableRule(iptables.V4, iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("DeleteInboundFromHostToNC: Error removing output rule", zap.Error(err))
-	}
-
-	// Remove static arp entry added for container local IP
-	logger.Info("Removing static arp entry for ip", zap.Any("containerIP", containerIP))
-	linkInfo := netlink.LinkInfo{
-		Name:       SnatBridgeName,
-		IPAddr:     containerIP,
-		MacAddress: nil,
+	tx := iptables.NewTransaction(iptables.V4)
+	for _, matchCondition := range allowMatchConditions(bridgeIP, containerIP, client.HostToNCPortRules) {
+		tx.DeleteRule(iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
 	}
-
-	err = client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.REMOVE, netlink.NUD_INCOMPLETE)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Error removing static arp entry for ip", zap.Any("containerIP", containerIP),
-			zap.Error(err))
+	if err := client.ipTablesClient.Commit(tx); err != nil {
+		logger.Error("DeleteInboundFromHostToNC: Error removing output rule", zap.Error(err))
 	}
 
-	return err
+	return client.removeContainerStaticArpEntry()
 }
 
-// This function adds iptables rules that allows only NC to Host communication and not the other way
-func (client *Client) AllowInboundFromNCToHost() error {
+func (client *Client) DeleteInboundFromNCToHost() error {
 	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
 
-	// Create CNI Input chain
-	if err := client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Forward traffic from Input to cniinput chain
-	if err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Input, "", iptables.CNIInputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting forward rule to failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Allow NC to Host connection
-	matchCondition := fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String())
-	err := client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting output rule failed with", zap.Error(err))
-		return err
-	}
-
-	// Create CNI output chain
-	if err = client.ipTablesClient.CreateChain(iptables.V4, iptables.Filter, iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Creating failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Forward traffic from Output to CNI Output chain
-	if err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.Output, "", iptables.CNIOutputChain); err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting forward rule to failed with", zap.String("CNIInputChain", iptables.CNIInputChain),
-			zap.Error(err))
-		return err
-	}
-
-	// Accept packets from Host only if established connection
-	matchCondition = fmt.Sprintf(" -o %s -m state --state %s,%s", SnatBridgeName, iptables.Established, iptables.Related)
-	err = client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Filter, iptables.CNIOutputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("AllowInboundFromHostToNC: Inserting input rule failed with", zap.Error(err))
-		return err
-	}
-
-	snatContainerVeth, err := client.netioClient.GetNetworkInterfaceByName(client.containerSnatVethName)
-	if err != nil {
-		logger.Info("Could not find interface", zap.String("containerSnatVethName", client.containerSnatVethName))
-		return errors.Wrap(newErrorSnatClient(err.Error()), "could not find container snat veth name for allow nc to host")
-	}
-
-	// Add static arp entry for localIP to prevent arp going out of VM
-	logger.Info("Adding static arp entry for ip", zap.Any("containerIP", containerIP), zap.String("HardwareAddr", snatContainerVeth.HardwareAddr.String()))
-	linkInfo := netlink.LinkInfo{
-		Name:       SnatBridgeName,
-		IPAddr:     containerIP,
-		MacAddress: snatContainerVeth.HardwareAddr,
+	// Delete allow NC to Host connection
+	tx := iptables.NewTransaction(iptables.V4)
+	for _, matchCondition := range allowMatchConditions(containerIP, bridgeIP, client.NCToHostPortRules) {
+		tx.DeleteRule(iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
 	}
-
-	err = client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.ADD, netlink.NUD_PERMANENT)
-	if err != nil {
-		logger.Error("AllowInboundFromNCToHost: Error adding static arp entry for ip", zap.Any("containerIP", containerIP),
-			zap.String("HardwareAddr", snatContainerVeth.HardwareAddr.String()), zap.Error(err))
+	if err := client.ipTablesClient.Commit(tx); err != nil {
+		logger.Error("DeleteInboundFromNCToHost: Error removing output rule", zap.Error(err))
 	}
 
-	return err
+	return client.removeContainerStaticArpEntry()
 }
 
-func (client *Client) DeleteInboundFromNCToHost() error {
-	bridgeIP, containerIP := getNCLocalAndGatewayIP(client)
-
-	// Delete allow NC to Host connection
-	matchCondition := fmt.Sprintf("-s %s -d %s", containerIP.String(), bridgeIP.String())
-	err := client.ipTablesClient.DeleteIptableRule(iptables.V4, iptables.Filter, iptables.CNIInputChain, matchCondition, iptables.Accept)
-	if err != nil {
-		logger.Error("DeleteInboundFromNCToHost: Error removing output rule", zap.Error(err))
-	}
+// removeContainerStaticArpEntry removes the static arp entry added for the container local IP.
+func (client *Client) removeContainerStaticArpEntry() error {
+	_, containerIP := getNCLocalAndGatewayIP(client)
 
-	// Remove static arp entry added for container local IP
 	logger.Info("Removing static arp entry for ip", zap.Any("containerIP", containerIP))
 	linkInfo := netlink.LinkInfo{
 		Name:       SnatBridgeName,
@@ -368,10 +361,9 @@ func (client *Client) DeleteInboundFromNCToHost() error {
 		MacAddress: nil,
 	}
 
-	err = client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.REMOVE, netlink.NUD_INCOMPLETE)
+	err := client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.REMOVE, netlink.NUD_INCOMPLETE)
 	if err != nil {
-		logger.Error("DeleteInboundFromNCToHost: Error removing static arp entry for ip",
-			zap.Any("containerIP", containerIP), zap.Error(err))
+		logger.Error("Error removing static arp entry for ip", zap.Any("containerIP", containerIP), zap.Error(err))
 	}
 
 	return err
@@ -475,8 +467,9 @@ func (client *Client) createSnatBridge(snatBridgeIP, hostPrimaryMac string) erro
 func (client *Client) addMasqueradeRule(snatBridgeIPWithPrefix string) error {
 	_, ipNet, _ := net.ParseCIDR(snatBridgeIPWithPrefix)
 	matchCondition := fmt.Sprintf("-s %s", ipNet.String())
-	return errors.Wrap(client.ipTablesClient.InsertIptableRule(iptables.V4, iptables.Nat, iptables.Postrouting, matchCondition, iptables.Masquerade),
-		"failed to add masquerade rule")
+	tx := iptables.NewTransaction(iptables.V4)
+	tx.InsertRule(iptables.Nat, iptables.Postrouting, matchCondition, iptables.Masquerade)
+	return errors.Wrap(client.ipTablesClient.Commit(tx), "failed to add masquerade rule")
 }
 
 // Drop all vlan traffic on linux bridge
@@ -497,20 +490,3 @@ func (client *Client) addVlanDropRule() error {
 	_, err = client.plClient.ExecuteRawCommand(vlanDropAddRule)
 	return err
 }
-
-// This function enables ip forwarding in VM and allow forwarding packets from the interface
-func (client *Client) EnableIPForwarding() error {
-	// Enable ip forwading on linux vm.
-	// sysctl -w net.ipv4.ip_forward=1
-	_, err := client.plClient.ExecuteRawCommand(enableIPForwardCmd)
-	if err != nil {
-		return errors.Wrap(err, "enable ipforwarding command failed")
-	}
-
-	// Append a rule in forward chain to allow forwarding from bridge
-	if err := client.ipTablesClient.AppendIptableRule(iptables.V4, iptables.Filter, iptables.Forward, "", iptables.Accept); err != nil {
-		return errors.Wrap(err, "appending forward chain rule to allow traffic from snat bridge failed")
-	}
-
-	return nil
-}
@@ -1,30 +1,25 @@
 package snat
 
 import (
+	"net"
 	"os"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/netio"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
 )
 
 var anyInterface = "dummy"
 
-type mockIPTablesClient struct{}
-
-func (c mockIPTablesClient) InsertIptableRule(_, _, _, _, _ string) error {
-	return nil
-}
-
-func (c mockIPTablesClient) AppendIptableRule(_, _, _, _, _ string) error {
-	return nil
-}
-
-func (c mockIPTablesClient) DeleteIptableRule(_, _, _, _, _ string) error {
-	return nil
+type mockIPTablesClient struct {
+	txs []*iptables.Transaction
 }
 
-func (c mockIPTablesClient) CreateChain(_, _, _ string) error {
+func (c *mockIPTablesClient) Commit(tx *iptables.Transaction) error {
+	c.txs = append(c.txs, tx)
 	return nil
 }
 
@@ -96,6 +91,39 @@ func TestAllowInboundFromHostToNC(t *testing.T) {
 	}
 }
 
+func TestAllowMatchConditions(t *testing.T) {
+	src, dst := net.ParseIP("169.254.0.1"), net.ParseIP("169.254.0.4")
+	tests := []struct {
+		name      string
+		portRules []PortRule
+		want      []string
+	}{
+		{
+			name: "all protocols and ports",
+			want: []string{"-s 169.254.0.1 -d 169.254.0.4"},
+		},
+		{
+			name: "ports and ranges of protocols",
+			portRules: []PortRule{
+				{Protocols: []string{"tcp", "udp"}, Ports: []string{"53", "8000-8080"}},
+				{Protocols: []string{"tcp"}},
+			},
+			want: []string{
+				"-s 169.254.0.1 -d 169.254.0.4 -p tcp -m multiport --dports 53,8000:8080",
+				"-s 169.254.0.1 -d 169.254.0.4 -p udp -m multiport --dports 53,8000:8080",
+				"-s 169.254.0.1 -d 169.254.0.4 -p tcp",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, allowMatchConditions(src, dst, tt.portRules))
+		})
+	}
+}
+
 func TestAllowInboundFromNCToHost(t *testing.T) {
 	nl := netlink.NewMockNetlink(false, "")
 	iptc := &mockIPTablesClient{}
@@ -144,3 +172,21 @@ func TestAllowInboundFromNCToHost(t *testing.T) {
 		t.Errorf("Expected error when interface not found in allow nc to host but got nil")
 	}
 }
+
+func TestAddSnatEndpointRules(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	iptc := &mockIPTablesClient{}
+	client := GetTestClient(nl, iptc, netio.NewMockNetIO(false, 0))
+	client.plClient = platform.NewMockExecClient(false)
+	client.SkipAddressesFromBlock = []string{"168.63.129.16"}
+
+	if err := client.AddSnatEndpointRules(true, true); err != nil {
+		t.Errorf("Error adding snat endpoint rules: %v", err)
+	}
+
+	// the allowed and blocked addresses in 3 chains each, forwarding, and both directions of host and nc traffic are
+	// programmed at once
+	if len(iptc.txs) != 1 || iptc.txs[0].Len() != 3+12+1+6+6 {
+		t.Errorf("Expected a single transaction of all the rules but got %d", len(iptc.txs))
+	}
+}
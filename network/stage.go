@@ -0,0 +1,38 @@
+package network
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// checkDeadline returns the error of ctx once the endpoint operation ran past its deadline or was canceled, before the
+// stage starts. The stages which program the pod netns run in the os thread locked in it and can't be abandoned, the
+// operation stops between them instead, rolling back what the stages before did.
+func checkDeadline(ctx context.Context, stage string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "endpoint operation stopped before %s", stage)
+	}
+	return nil
+}
+
+// runStage runs a call of a stage which can't be canceled, like an hns call, and returns its error, or the error of ctx
+// as soon as the endpoint operation runs past its deadline. The call which is then abandoned completes in the
+// background, its result is dropped.
+func runStage(ctx context.Context, stage string, call func() error) error {
+	if err := checkDeadline(ctx, stage); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "%s did not complete", stage)
+	}
+}
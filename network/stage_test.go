@@ -0,0 +1,45 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDeadline(t *testing.T) {
+	require.NoError(t, checkDeadline(context.Background(), "adding the endpoint rules"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err := checkDeadline(ctx, "adding the endpoint rules")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "before adding the endpoint rules")
+}
+
+func TestRunStage(t *testing.T) {
+	errCall := errors.New("call failed")
+	require.ErrorIs(t, runStage(context.Background(), "deleting the hcn endpoint", func() error { return errCall }), errCall)
+
+	// a call which doesn't return in time is abandoned
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	err := runStage(ctx, "deleting the hcn endpoint", func() error {
+		<-release
+		return nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// and one which would start after the deadline is not called
+	called := false
+	err = runStage(ctx, "deleting the hcn endpoint", func() error {
+		called = true
+		return nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.False(t, called)
+}
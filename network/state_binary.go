@@ -0,0 +1,80 @@
+package network
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/pkg/errors"
+)
+
+// binaryState is the state as it is written to a store in the binary format. It holds the fields of the networkManager
+// which are serialized, without its lock and clients which encoding/gob can't encode.
+type binaryState struct {
+	Version            string
+	TimeStamp          time.Time
+	ExternalInterfaces map[string]*externalInterface
+	SchemaVersion      int
+}
+
+// writesBinaryState returns whether the store writes the state in the binary format.
+func (nm *networkManager) writesBinaryState() bool {
+	formatStore, ok := nm.store.(store.FormatStore)
+	return ok && formatStore.Format() == store.FormatBinary
+}
+
+// readsBinaryState returns whether the state in the store was written in the binary format.
+func (nm *networkManager) readsBinaryState() bool {
+	formatStore, ok := nm.store.(store.FormatStore)
+	if !ok {
+		return false
+	}
+	// errors are returned by the read of the state itself
+	format, err := formatStore.KeyFormat(storeKey)
+	return err == nil && format == store.FormatBinary
+}
+
+// writeBinaryState writes the state to the store in the binary format.
+func (nm *networkManager) writeBinaryState() error {
+	return nm.store.Write(storeKey, &binaryState{ //nolint:wrapcheck // logged by the caller
+		Version:            nm.Version,
+		TimeStamp:          nm.TimeStamp,
+		ExternalInterfaces: nm.ExternalInterfaces,
+		SchemaVersion:      nm.SchemaVersion,
+	})
+}
+
+// readBinaryState reads the state written in the binary format into the network manager. A state of an older schema
+// is returned as JSON instead, since the migrations work on the JSON encoding of the state.
+func (nm *networkManager) readBinaryState() (json.RawMessage, error) {
+	var state binaryState
+	if err := nm.store.Read(storeKey, &state); err != nil {
+		return nil, err //nolint:wrapcheck // callers compare with the store errors
+	}
+
+	if state.SchemaVersion < len(nm.stateMigrations) {
+		raw, err := json.Marshal(&state)
+		return raw, errors.Wrap(err, "failed to encode state for migration")
+	}
+
+	// encoding/gob leaves out empty maps, the state expects the maps it made to still be there
+	if state.ExternalInterfaces == nil {
+		state.ExternalInterfaces = make(map[string]*externalInterface)
+	}
+	for _, extIf := range state.ExternalInterfaces {
+		if extIf.Networks == nil {
+			extIf.Networks = make(map[string]*network)
+		}
+		for _, nw := range extIf.Networks {
+			if nw.Endpoints == nil {
+				nw.Endpoints = make(map[string]*endpoint)
+			}
+		}
+	}
+
+	nm.Version = state.Version
+	nm.TimeStamp = state.TimeStamp
+	nm.ExternalInterfaces = state.ExternalInterfaces
+	nm.SchemaVersion = state.SchemaVersion
+	return nil, nil
+}
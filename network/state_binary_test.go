@@ -0,0 +1,82 @@
+package network
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network/policy"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveRestoreBinaryState(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "azure-vnet.json")
+	newManager := func(format store.Format) *networkManager {
+		kvs, err := store.NewJsonFileStore(fileName, processlock.NewMockFileLock(false), nil)
+		require.NoError(t, err)
+		require.NoError(t, kvs.(store.FormatStore).SetFormat(format))
+		return &networkManager{
+			ExternalInterfaces: map[string]*externalInterface{},
+			store:              kvs,
+			plClient:           platform.NewMockExecClient(false),
+			stateMigrations:    defaultStateMigrations,
+		}
+	}
+
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/16")
+	ep := &endpoint{
+		Id:          "ep1-eth0",
+		ContainerID: "ep1",
+		MacAddress:  net.HardwareAddr{0, 0x0d, 0x3a, 0, 0, 1},
+		IPAddresses: []net.IPNet{{IP: net.ParseIP("10.0.0.4"), Mask: subnet.Mask}},
+		Routes:      []RouteInfo{{Dst: *subnet, Gw: net.ParseIP("10.0.0.1")}},
+		SecondaryInterfaces: map[string]*InterfaceInfo{
+			"eth1": {
+				Name:             "eth1",
+				NICType:          cns.DelegatedVMNIC,
+				NCResponse:       &cns.GetNetworkContainerResponse{NetworkContainerID: "nc1"},
+				EndpointPolicies: []policy.Policy{{Type: policy.ACLPolicy, Data: json.RawMessage(`{"Action":"Block"}`)}},
+			},
+		},
+		History:   []EndpointOperation{{Operation: "ADD", Timestamp: time.Now().UTC(), Duration: time.Second}},
+		AddResult: json.RawMessage(`{"cniVersion":"1.0.0"}`),
+	}
+
+	// the json state is converted to the binary format on the next save
+	nm := newManager(store.FormatJSON)
+	nm.ExternalInterfaces["eth0"] = &externalInterface{
+		Name: "eth0",
+		Networks: map[string]*network{
+			"azure": {Id: "azure", Endpoints: map[string]*endpoint{ep.Id: ep}},
+			"empty": {Id: "empty", Endpoints: map[string]*endpoint{}},
+		},
+	}
+	require.NoError(t, nm.save())
+
+	nm = newManager(store.FormatBinary)
+	require.NoError(t, nm.restore(false))
+	require.NoError(t, nm.save())
+	require.NoFileExists(t, fileName)
+
+	// the state restored from the binary format is the one restored from json
+	restored := newManager(store.FormatBinary)
+	require.NoError(t, restored.restore(false))
+	assert.Equal(t, nm.ExternalInterfaces["eth0"].Networks["azure"].Endpoints[ep.Id],
+		restored.ExternalInterfaces["eth0"].Networks["azure"].Endpoints[ep.Id])
+	assert.NotNil(t, restored.ExternalInterfaces["eth0"].Networks["empty"].Endpoints)
+	assert.Equal(t, restored.ExternalInterfaces["eth0"], restored.ExternalInterfaces["eth0"].Networks["azure"].extIf)
+
+	// and back
+	nm = newManager(store.FormatJSON)
+	require.NoError(t, nm.restore(false))
+	require.NoError(t, nm.save())
+	require.FileExists(t, fileName)
+	assert.Len(t, nm.ExternalInterfaces["eth0"].Networks, 2)
+}
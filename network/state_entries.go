@@ -0,0 +1,219 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// With a store.EntryStore, each endpoint of the state is kept as an entry of its own, keyed by
+// "<external interface>/<network>/<endpoint>", and the rest of the state is kept as the value of storeKey. A save then
+// only writes the endpoints which changed, instead of the whole state.
+
+const (
+	externalInterfacesKey = "ExternalInterfaces"
+	networksKey           = "Networks"
+	endpointsKey          = "Endpoints"
+	entryKeySeparator     = "/"
+)
+
+// readState reads the serialized state from the store, joining the endpoint entries back into it. A state in the binary
+// format is read into the network manager, and no JSON is returned unless it has to be migrated.
+func (nm *networkManager) readState() (json.RawMessage, error) {
+	if nm.readsBinaryState() {
+		return nm.readBinaryState()
+	}
+
+	var raw json.RawMessage
+	if err := nm.store.Read(storeKey, &raw); err != nil {
+		return nil, err //nolint:wrapcheck // callers compare with the store errors
+	}
+
+	entryStore, ok := nm.store.(store.EntryStore)
+	if !ok || len(raw) == 0 {
+		return raw, nil
+	}
+
+	entries, err := entryStore.ReadEntries(storeKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read endpoint entries")
+	}
+
+	nm.stateEntries = entries
+
+	return joinStateEntries(raw, entries)
+}
+
+// writeState writes the serialized state to the store. With an EntryStore only the endpoints which changed since the
+// last read or write are written.
+func (nm *networkManager) writeState(state json.RawMessage) error {
+	entryStore, ok := nm.store.(store.EntryStore)
+	if !ok {
+		return nm.store.Write(storeKey, state) //nolint:wrapcheck // logged by the caller
+	}
+
+	base, entries, err := splitStateEntries(state)
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string]json.RawMessage)
+	for k, v := range entries {
+		if !bytes.Equal(nm.stateEntries[k], v) {
+			changed[k] = v
+		}
+	}
+	var deleted []string
+	for k := range nm.stateEntries {
+		if _, ok := entries[k]; !ok {
+			deleted = append(deleted, k)
+		}
+	}
+
+	if err := entryStore.WriteEntries(storeKey, base, changed, deleted); err != nil {
+		return errors.Wrap(err, "failed to write state")
+	}
+	logger.Info("Wrote endpoint entries", zap.Int("changed", len(changed)), zap.Int("deleted", len(deleted)))
+
+	nm.stateEntries = entries
+	return nil
+}
+
+// splitStateEntries removes the endpoints from the serialized state and returns them as entries.
+func splitStateEntries(state json.RawMessage) (json.RawMessage, map[string]json.RawMessage, error) {
+	entries := make(map[string]json.RawMessage)
+
+	base, err := editStateNetworks(state, func(extIfName, nwID string, nw map[string]json.RawMessage) error {
+		var endpoints map[string]json.RawMessage
+		if len(nw[endpointsKey]) > 0 {
+			if err := json.Unmarshal(nw[endpointsKey], &endpoints); err != nil {
+				return errors.Wrapf(err, "failed to decode endpoints of network %s", nwID)
+			}
+		}
+		for epID, ep := range endpoints {
+			entries[strings.Join([]string{extIfName, nwID, epID}, entryKeySeparator)] = ep
+		}
+		nw[endpointsKey] = json.RawMessage("{}")
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return base, entries, nil
+}
+
+// joinStateEntries adds the endpoint entries back into the serialized state.
+func joinStateEntries(base json.RawMessage, entries map[string]json.RawMessage) (json.RawMessage, error) {
+	if len(entries) == 0 {
+		return base, nil
+	}
+
+	// endpoints by network, by external interface
+	grouped := make(map[string]map[string]map[string]json.RawMessage)
+	for k, ep := range entries {
+		parts := strings.SplitN(k, entryKeySeparator, 3) //nolint:gomnd // external interface, network, endpoint
+		if len(parts) != 3 {                             //nolint:gomnd // external interface, network, endpoint
+			logger.Error("Ignoring endpoint entry with an invalid key", zap.String("key", k))
+			continue
+		}
+		if grouped[parts[0]] == nil {
+			grouped[parts[0]] = make(map[string]map[string]json.RawMessage)
+		}
+		if grouped[parts[0]][parts[1]] == nil {
+			grouped[parts[0]][parts[1]] = make(map[string]json.RawMessage)
+		}
+		grouped[parts[0]][parts[1]][parts[2]] = ep
+	}
+
+	state, err := editStateNetworks(base, func(extIfName, nwID string, nw map[string]json.RawMessage) error {
+		endpoints := make(map[string]json.RawMessage)
+		if len(nw[endpointsKey]) > 0 {
+			if err := json.Unmarshal(nw[endpointsKey], &endpoints); err != nil {
+				return errors.Wrapf(err, "failed to decode endpoints of network %s", nwID)
+			}
+		}
+		for epID, ep := range grouped[extIfName][nwID] {
+			endpoints[epID] = ep
+		}
+		delete(grouped[extIfName], nwID)
+
+		raw, err := json.Marshal(endpoints)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode endpoints of network %s", nwID)
+		}
+		nw[endpointsKey] = raw
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for extIfName, networks := range grouped {
+		for nwID := range networks {
+			logger.Error("Ignoring endpoint entries of a network not in the state", zap.String("extIf", extIfName),
+				zap.String("network", nwID))
+		}
+	}
+
+	return state, nil
+}
+
+// editStateNetworks calls fn with each network of the serialized state, as its decoded fields, and returns the state
+// with the networks as fn left them. Only the levels down to the networks are decoded, the rest is kept as written.
+func editStateNetworks(state json.RawMessage, fn func(extIfName, nwID string, nw map[string]json.RawMessage) error) (json.RawMessage, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(state, &top); err != nil {
+		return nil, errors.Wrap(err, "failed to decode state")
+	}
+
+	var extIfs map[string]map[string]json.RawMessage
+	if len(top[externalInterfacesKey]) > 0 {
+		if err := json.Unmarshal(top[externalInterfacesKey], &extIfs); err != nil {
+			return nil, errors.Wrap(err, "failed to decode external interfaces")
+		}
+	}
+
+	for extIfName, extIf := range extIfs {
+		if extIf == nil {
+			continue
+		}
+		var networks map[string]map[string]json.RawMessage
+		if len(extIf[networksKey]) > 0 {
+			if err := json.Unmarshal(extIf[networksKey], &networks); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode networks of external interface %s", extIfName)
+			}
+		}
+
+		for nwID, nw := range networks {
+			if nw == nil {
+				continue
+			}
+			if err := fn(extIfName, nwID, nw); err != nil {
+				return nil, err
+			}
+		}
+
+		raw, err := json.Marshal(networks)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode networks of external interface %s", extIfName)
+		}
+		extIf[networksKey] = raw
+	}
+
+	raw, err := json.Marshal(extIfs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode external interfaces")
+	}
+	top[externalInterfacesKey] = raw
+
+	edited, err := json.Marshal(top)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode state")
+	}
+	return edited, nil
+}
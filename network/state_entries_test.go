@@ -0,0 +1,113 @@
+package network
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitJoinStateEntries(t *testing.T) {
+	base, entries, err := splitStateEntries(json.RawMessage(unversionedState))
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"Id": "ep1-eth0", "ContainerID": "ep1", "VlanID": 1}`, string(entries["eth0/azure/ep1-eth0"]))
+	assert.JSONEq(t, `{"Id": "ep2-eth1", "ContainerID": "ep2", "NICType": "FrontendNIC"}`,
+		string(entries["eth0/azure/ep2-eth1"]))
+	assert.Len(t, entries, 2)
+	assert.NotContains(t, string(base), "ep1-eth0")
+
+	// entries of a network which is no longer in the state are dropped
+	entries["eth1/gone/ep3-eth0"] = json.RawMessage(`{"Id": "ep3-eth0"}`)
+
+	joined, err := joinStateEntries(base, entries)
+	require.NoError(t, err)
+	assert.JSONEq(t, unversionedState, string(joined))
+}
+
+func TestSaveRestoreEntryStore(t *testing.T) {
+	kvs, err := store.NewBoltStore(filepath.Join(t.TempDir(), "test.db"), processlock.NewMockFileLock(false), nil)
+	require.NoError(t, err)
+
+	newManager := func() *networkManager {
+		return &networkManager{
+			ExternalInterfaces: map[string]*externalInterface{},
+			store:              kvs,
+			plClient:           platform.NewMockExecClient(false),
+			stateMigrations:    defaultStateMigrations,
+		}
+	}
+
+	nm := newManager()
+	nm.ExternalInterfaces["eth0"] = &externalInterface{
+		Name: "eth0",
+		Networks: map[string]*network{
+			"azure": {
+				Id: "azure",
+				Endpoints: map[string]*endpoint{
+					"ep1-eth0": {Id: "ep1-eth0", ContainerID: "ep1"},
+					"ep2-eth0": {Id: "ep2-eth0", ContainerID: "ep2"},
+				},
+			},
+		},
+	}
+	require.NoError(t, nm.save())
+
+	// only the changed and removed endpoints are written
+	delete(nm.ExternalInterfaces["eth0"].Networks["azure"].Endpoints, "ep2-eth0")
+	nm.ExternalInterfaces["eth0"].Networks["azure"].Endpoints["ep1-eth0"].VlanID = 2
+	require.NoError(t, nm.save())
+
+	entries, err := kvs.ReadEntries(storeKey)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	restored := newManager()
+	require.NoError(t, restored.restore(false))
+	endpoints := restored.ExternalInterfaces["eth0"].Networks["azure"].Endpoints
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, 2, endpoints["ep1-eth0"].VlanID)
+	assert.Equal(t, restored.ExternalInterfaces["eth0"], restored.ExternalInterfaces["eth0"].Networks["azure"].extIf)
+}
+
+func TestSetStoreMovesState(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := store.NewJsonFileStore(filepath.Join(dir, "azure-vnet.json"), processlock.NewMockFileLock(false), nil)
+	require.NoError(t, err)
+	boltStore, err := store.NewBoltStore(filepath.Join(dir, "azure-vnet.db"), processlock.NewMockFileLock(false), nil)
+	require.NoError(t, err)
+
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{},
+		store:              fileStore,
+		plClient:           platform.NewMockExecClient(false),
+		stateMigrations:    defaultStateMigrations,
+	}
+	nm.ExternalInterfaces["eth0"] = &externalInterface{
+		Name: "eth0",
+		Networks: map[string]*network{
+			"azure": {Id: "azure", Endpoints: map[string]*endpoint{"ep1-eth0": {Id: "ep1-eth0", ContainerID: "ep1"}}},
+		},
+	}
+	require.NoError(t, nm.save())
+
+	// all of the state is written to the new store, the endpoints included
+	require.NoError(t, nm.SetStore(boltStore))
+	entries, err := boltStore.ReadEntries(storeKey)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	restored := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{},
+		store:              boltStore,
+		plClient:           platform.NewMockExecClient(false),
+		stateMigrations:    defaultStateMigrations,
+	}
+	require.NoError(t, restored.restore(false))
+	assert.Contains(t, restored.ExternalInterfaces["eth0"].Networks["azure"].Endpoints, "ep1-eth0")
+}
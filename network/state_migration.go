@@ -0,0 +1,103 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// stateMigration rewrites the serialized state from the schema version before it to the next one. The state is the
+// decoded json, so a migration sees the fields as they were written rather than as the current structs, which lets it
+// rename or restructure them. Migrations must be idempotent: after a rollback an older binary writes the state with
+// its older version, but the state may still hold the fields of the newer versions.
+type stateMigration func(state map[string]interface{}) error
+
+// defaultStateMigrations holds, in order, the migrations needed to move the state from schema version i to i+1.
+// States written before schema versions were introduced are at version 0.
+var defaultStateMigrations = []stateMigration{
+	migrateStateEndpointNICType,
+}
+
+// schemaVersionKey is the key of the schema version in the serialized state, see networkManager.SchemaVersion.
+const schemaVersionKey = "SchemaVersion"
+
+// migrateState runs the migrations needed to bring the serialized state up to the latest schema version.
+// Returns true if the state was migrated and needs to be saved.
+func migrateState(raw json.RawMessage, migrations []stateMigration) (json.RawMessage, bool, error) {
+	var state map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	// keep the numbers as written, e.g. a uint64 doesn't fit a float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&state); err != nil {
+		return nil, false, errors.Wrap(err, "failed to decode state")
+	}
+
+	version := 0
+	if v, ok := state[schemaVersionKey].(json.Number); ok {
+		n, err := v.Int64()
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "invalid state schema version %s", v)
+		}
+		version = int(n)
+	}
+
+	latest := len(migrations)
+	if version > latest {
+		// written by a newer binary before a rollback, the fields this binary knows are still readable
+		logger.Warn("State schema version is newer than the latest known version", zap.Int("version", version),
+			zap.Int("latest", latest))
+		return raw, false, nil
+	}
+	if version == latest {
+		return raw, false, nil
+	}
+
+	for ; version < latest; version++ {
+		logger.Info("Migrating state schema", zap.Int("from", version), zap.Int("to", version+1))
+		if err := migrations[version](state); err != nil {
+			return nil, false, errors.Wrapf(err, "failed to migrate state to schema version %d", version+1)
+		}
+	}
+	state[schemaVersionKey] = version
+
+	migrated, err := json.Marshal(state)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to encode migrated state")
+	}
+	return migrated, true, nil
+}
+
+// forEachEndpointState calls fn with each endpoint of the serialized state.
+func forEachEndpointState(state map[string]interface{}, fn func(ep map[string]interface{}) error) error {
+	extIfs, _ := state["ExternalInterfaces"].(map[string]interface{})
+	for _, extIf := range extIfs {
+		extIf, _ := extIf.(map[string]interface{})
+		networks, _ := extIf["Networks"].(map[string]interface{})
+		for _, nw := range networks {
+			nw, _ := nw.(map[string]interface{})
+			endpoints, _ := nw["Endpoints"].(map[string]interface{})
+			for _, ep := range endpoints {
+				if ep, ok := ep.(map[string]interface{}); ok {
+					if err := fn(ep); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// migrateStateEndpointNICType sets the nic type of the endpoints created before it was stored, which were all infra
+// nics, the delegated nics of that time being held in the SecondaryInterfaces of the infra endpoint.
+func migrateStateEndpointNICType(state map[string]interface{}) error {
+	return forEachEndpointState(state, func(ep map[string]interface{}) error {
+		if nicType, _ := ep["NICType"].(string); nicType == "" {
+			ep["NICType"] = string(cns.InfraNIC)
+		}
+		return nil
+	})
+}
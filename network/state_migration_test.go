@@ -0,0 +1,126 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/store"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unversionedState = `{
+	"ExternalInterfaces": {
+		"eth0": {
+			"Name": "eth0",
+			"Networks": {
+				"azure": {
+					"Id": "azure",
+					"Endpoints": {
+						"ep1-eth0": {"Id": "ep1-eth0", "ContainerID": "ep1", "VlanID": 1},
+						"ep2-eth1": {"Id": "ep2-eth1", "ContainerID": "ep2", "NICType": "FrontendNIC"}
+					}
+				}
+			}
+		}
+	},
+	"SeqNumber": 18446744073709551615
+}`
+
+func TestMigrateState(t *testing.T) {
+	errMigration := errors.New("migration failed")
+
+	tests := []struct {
+		name         string
+		state        string
+		migrations   []stateMigration
+		wantMigrated bool
+		wantVersion  json.Number
+		wantErr      error
+	}{
+		{
+			name:         "unversioned state is migrated to the latest version",
+			state:        unversionedState,
+			migrations:   defaultStateMigrations,
+			wantMigrated: true,
+			wantVersion:  json.Number("1"),
+		},
+		{
+			name:       "state at the latest version is left as is",
+			state:      `{"SchemaVersion": 1}`,
+			migrations: defaultStateMigrations,
+		},
+		{
+			name:       "state of a newer binary is left as is",
+			state:      `{"SchemaVersion": 5}`,
+			migrations: defaultStateMigrations,
+		},
+		{
+			name:       "failed migration",
+			state:      `{}`,
+			migrations: []stateMigration{func(map[string]interface{}) error { return errMigration }},
+			wantErr:    errMigration,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			raw, migrated, err := migrateState(json.RawMessage(tt.state), tt.migrations)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMigrated, migrated)
+			if !migrated {
+				assert.Equal(t, tt.state, string(raw))
+				return
+			}
+
+			var state map[string]interface{}
+			decoder := json.NewDecoder(bytes.NewReader(raw))
+			decoder.UseNumber()
+			require.NoError(t, decoder.Decode(&state))
+			assert.Equal(t, tt.wantVersion, state[schemaVersionKey])
+			// numbers which don't fit a float64 are kept as written
+			assert.Equal(t, json.Number("18446744073709551615"), state["SeqNumber"])
+		})
+	}
+}
+
+func TestMigrateStateEndpointNICType(t *testing.T) {
+	var state map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(unversionedState), &state))
+	require.NoError(t, migrateStateEndpointNICType(state))
+
+	endpoints := state["ExternalInterfaces"].(map[string]interface{})["eth0"].(map[string]interface{})["Networks"].(map[string]interface{})["azure"].(map[string]interface{})["Endpoints"].(map[string]interface{})
+	assert.Equal(t, string(cns.InfraNIC), endpoints["ep1-eth0"].(map[string]interface{})["NICType"])
+	assert.Equal(t, "FrontendNIC", endpoints["ep2-eth1"].(map[string]interface{})["NICType"])
+}
+
+func TestRestoreMigratesState(t *testing.T) {
+	kvs := store.NewMockStore("")
+	require.NoError(t, kvs.Write(storeKey, json.RawMessage(unversionedState)))
+
+	nm := &networkManager{
+		ExternalInterfaces: map[string]*externalInterface{},
+		store:              kvs,
+		plClient:           platform.NewMockExecClient(false),
+		stateMigrations:    defaultStateMigrations,
+	}
+	require.NoError(t, nm.restore(false))
+
+	ep := nm.ExternalInterfaces["eth0"].Networks["azure"].Endpoints["ep1-eth0"]
+	assert.Equal(t, cns.InfraNIC, ep.NICType)
+	assert.Equal(t, 1, ep.VlanID)
+
+	// the migrated state is saved with its version
+	var saved struct{ SchemaVersion int }
+	require.NoError(t, kvs.Read(storeKey, &saved))
+	assert.Equal(t, 1, saved.SchemaVersion)
+}
@@ -0,0 +1,130 @@
+package network
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// recoveredEndpoint is an endpoint found in the dataplane, with the network and the external interface it is in.
+type recoveredEndpoint struct {
+	NetworkID    string
+	HnsNetworkID string
+	Mode         string
+	ExtIfName    string
+	Endpoint     *endpoint
+}
+
+// recoverFromDataplane rebuilds the state from the endpoints found in the dataplane when the plugin was asked to, in
+// place of starting with no endpoints or failing when the state is missing or can't be read, as stateErr tells. The
+// pods whose endpoints are recovered are then known to cns and DEL again. Without recovery stateErr is returned as is.
+func (nm *networkManager) recoverFromDataplane(stateErr error) error {
+	if !nm.recoverEndpointState {
+		return stateErr
+	}
+
+	eps, err := nm.listRecoverableEndpoints()
+	if err != nil {
+		logger.Error("Failed to list the endpoints of the dataplane", zap.Error(err), zap.NamedError("stateErr", stateErr))
+		if stateErr != nil {
+			return stateErr
+		}
+		return errors.Wrap(err, "failed to list the endpoints of the dataplane")
+	}
+
+	logger.Info("Recovering state from the dataplane", zap.Int("endpoints", len(eps)), zap.NamedError("stateErr", stateErr))
+	nm.recoverState(eps)
+	if err := nm.save(); err != nil {
+		logger.Error("Failed to save recovered state", zap.Error(err))
+		return err
+	}
+
+	nm.recordUtilization()
+	return nil
+}
+
+// recoverState replaces the networks and endpoints of the state with the ones of the endpoints found in the dataplane.
+// The networks only have the id, mode and interface the endpoints were found with, they are marked recovered so that
+// the next ADD in them creates them again with their configuration.
+func (nm *networkManager) recoverState(eps []recoveredEndpoint) {
+	nm.ExternalInterfaces = make(map[string]*externalInterface)
+	for _, rec := range eps {
+		extIf := nm.ExternalInterfaces[rec.ExtIfName]
+		if extIf == nil {
+			extIf = &externalInterface{
+				Name:        rec.ExtIfName,
+				Networks:    make(map[string]*network),
+				IPv4Gateway: net.IPv4zero,
+				IPv6Gateway: net.IPv6unspecified,
+			}
+			if hostIf, err := net.InterfaceByName(rec.ExtIfName); err == nil {
+				extIf.MacAddress = hostIf.HardwareAddr
+			}
+			nm.ExternalInterfaces[rec.ExtIfName] = extIf
+		}
+
+		nw := extIf.Networks[rec.NetworkID]
+		if nw == nil {
+			nw = &network{
+				Id:        rec.NetworkID,
+				HnsId:     rec.HnsNetworkID,
+				Mode:      rec.Mode,
+				Endpoints: make(map[string]*endpoint),
+				extIf:     extIf,
+				Recovered: true,
+			}
+			extIf.Networks[rec.NetworkID] = nw
+		}
+
+		logger.Info("Recovered endpoint", zap.String("networkID", nw.Id), zap.String("endpointID", rec.Endpoint.Id),
+			zap.String("podName", rec.Endpoint.PODName), zap.String("podNamespace", rec.Endpoint.PODNameSpace))
+		nw.addEndpoint(rec.Endpoint)
+	}
+}
+
+// isRecoveredNetwork returns whether the network was rebuilt from the dataplane and not created again since.
+func (nm *networkManager) isRecoveredNetwork(networkID string) bool {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkID)
+	return err == nil && nw.Recovered
+}
+
+// recreateRecoveredNetwork creates the network rebuilt from the dataplane again with the configuration of the ADD, and
+// moves its endpoints to it. The recovered network is kept when it fails.
+func (nm *networkManager) recreateRecoveredNetwork(nwInfo *EndpointInfo) error {
+	nm.Lock()
+	defer nm.Unlock()
+
+	recovered, err := nm.getNetwork(nwInfo.NetworkID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Creating recovered network again", zap.String("id", recovered.Id))
+	if err = nm.newExternalInterface(nwInfo.MasterIfName, nwInfo.HostSubnetPrefix, string(nwInfo.NICType)); err != nil {
+		return err
+	}
+	extIf := nm.ExternalInterfaces[nwInfo.MasterIfName]
+	if nwInfo.HostSubnetPrefix != "" && len(extIf.Subnets) == 0 {
+		extIf.Subnets = append(extIf.Subnets, nwInfo.HostSubnetPrefix)
+	}
+
+	nw, err := nm.newNetwork(nwInfo)
+	if err != nil {
+		return err
+	}
+
+	if recovered.extIf != nw.extIf {
+		delete(recovered.extIf.Networks, recovered.Id)
+		if len(recovered.extIf.Networks) == 0 {
+			delete(nm.ExternalInterfaces, recovered.extIf.Name)
+		}
+	}
+	for _, ep := range recovered.Endpoints {
+		nw.addEndpoint(ep)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package network
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+	vishnetlink "github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+// The metadata of an endpoint is kept in alternative names of its host interface, so that the endpoint can be recovered
+// from the dataplane when the state is lost. The alternative names are unique on the host, so each one is the name of
+// the interface, a key and a value: azv1234567.pod.<namespace>_<name>. Kernels older than 5.5 have no alternative names,
+// their endpoints can't be recovered.
+const (
+	altNameEndpointID  = "ep"
+	altNameNetworkID   = "nw"
+	altNameMode        = "mode"
+	altNameExtIf       = "ext"
+	altNameContainerID = "ctr"
+	altNamePod         = "pod"
+	altNameIfName      = "if"
+	altNameVlanID      = "vlan"
+	altNameIP          = "ip"
+	// maxAltNameLen is the length of the longest alternative name, ALTIFNAMSIZ less its terminating nul
+	maxAltNameLen = 127
+)
+
+// altNameClient adds and lists the alternative names of the links of the host.
+type altNameClient interface {
+	LinkAddAltName(ifName, altName string) error
+	LinkList() ([]vishnetlink.Link, error)
+}
+
+type vishAltNameClient struct{}
+
+func newAltNameClient() altNameClient {
+	return vishAltNameClient{}
+}
+
+func (vishAltNameClient) LinkAddAltName(ifName, altName string) error {
+	link, err := vishnetlink.LinkByName(ifName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find link %s", ifName)
+	}
+	return errors.Wrapf(vishnetlink.LinkAddAltName(link, altName), "failed to add alternative name %s to %s", altName, ifName)
+}
+
+func (vishAltNameClient) LinkList() ([]vishnetlink.Link, error) {
+	links, err := vishnetlink.LinkList()
+	return links, errors.Wrap(err, "failed to list links")
+}
+
+// recoveryAltNames returns the alternative names the metadata of the endpoint is kept in on its host interface. The ':'
+// of the ips are replaced with '-', and the '/' of their prefix and of the pod with '_', as alternative names can't have
+// them.
+func recoveryAltNames(nw *network, ep *endpoint) []string {
+	var extIfName string
+	if nw.extIf != nil {
+		extIfName = nw.extIf.Name
+	}
+	values := [][2]string{
+		{altNameEndpointID, ep.Id},
+		{altNameNetworkID, nw.Id},
+		{altNameMode, nw.Mode},
+		{altNameExtIf, extIfName},
+		{altNameContainerID, ep.ContainerID},
+		{altNameIfName, ep.IfName},
+	}
+	if ep.PODName != "" {
+		values = append(values, [2]string{altNamePod, ep.PODNameSpace + "_" + ep.PODName})
+	}
+	if ep.VlanID != 0 {
+		values = append(values, [2]string{altNameVlanID, strconv.Itoa(ep.VlanID)})
+	}
+	for _, ipAddr := range ep.IPAddresses {
+		ones, _ := ipAddr.Mask.Size()
+		ip := strings.ReplaceAll(ipAddr.IP.String(), ":", "-")
+		values = append(values, [2]string{altNameIP, ip + "_" + strconv.Itoa(ones)})
+	}
+
+	altNames := make([]string, 0, len(values))
+	for _, kv := range values {
+		if kv[1] == "" {
+			continue
+		}
+		altName := ep.HostIfName + "." + kv[0] + "." + kv[1]
+		if len(altName) > maxAltNameLen || strings.ContainsAny(altName, "/: \t\n") {
+			logger.Info("Skipping alternative name the endpoint's metadata doesn't fit in", zap.String("altName", altName))
+			continue
+		}
+		altNames = append(altNames, altName)
+	}
+	return altNames
+}
+
+// addRecoveryAltNames keeps the metadata of the endpoint in alternative names of its host interface. Errors are logged
+// and ignored, they only leave the endpoint unrecoverable.
+func addRecoveryAltNames(c altNameClient, nw *network, ep *endpoint) {
+	for _, altName := range recoveryAltNames(nw, ep) {
+		if err := c.LinkAddAltName(ep.HostIfName, altName); err != nil {
+			logger.Error("Failed to keep the endpoint's metadata on its host interface", zap.String("endpointID", ep.Id),
+				zap.Error(err))
+			return
+		}
+	}
+}
+
+// parseIPNet parses the ip and prefix length of an endpoint, keeping the ip rather than the address of its subnet.
+func parseIPNet(cidr string) (net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return net.IPNet{}, errors.Wrapf(err, "failed to parse %s", cidr)
+	}
+	return net.IPNet{IP: ip, Mask: ipNet.Mask}, nil
+}
+
+// listRecoverableEndpoints returns the endpoints whose metadata is kept on their host interface.
+func (*networkManager) listRecoverableEndpoints() ([]recoveredEndpoint, error) {
+	return listHostIfEndpoints(newAltNameClient())
+}
+
+// listHostIfEndpoints returns the endpoints whose metadata is kept in the alternative names of their host interface.
+func listHostIfEndpoints(c altNameClient) ([]recoveredEndpoint, error) {
+	links, err := c.LinkList()
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the client
+	}
+
+	var eps []recoveredEndpoint
+	for _, link := range links {
+		attrs := link.Attrs()
+		rec := recoveredEndpoint{
+			Endpoint: &endpoint{
+				HostIfName:          attrs.Name,
+				NICType:             cns.InfraNIC,
+				SecondaryInterfaces: make(map[string]*InterfaceInfo),
+			},
+		}
+		ep := rec.Endpoint
+		for _, altName := range attrs.AltNames {
+			rest, ok := strings.CutPrefix(altName, attrs.Name+".")
+			if !ok {
+				continue
+			}
+			key, value, _ := strings.Cut(rest, ".")
+			switch key {
+			case altNameEndpointID:
+				ep.Id = value
+			case altNameNetworkID:
+				rec.NetworkID = value
+			case altNameMode:
+				rec.Mode = value
+			case altNameExtIf:
+				rec.ExtIfName = value
+			case altNameContainerID:
+				ep.ContainerID = value
+			case altNameIfName:
+				ep.IfName = value
+			case altNamePod:
+				ep.PODNameSpace, ep.PODName, _ = strings.Cut(value, "_")
+			case altNameVlanID:
+				ep.VlanID, _ = strconv.Atoi(value)
+			case altNameIP:
+				ip, prefixLen, _ := strings.Cut(value, "_")
+				ipNet, err := parseIPNet(strings.ReplaceAll(ip, "-", ":") + "/" + prefixLen)
+				if err != nil {
+					logger.Error("Failed to parse the ip of a host interface", zap.String("altName", altName), zap.Error(err))
+					continue
+				}
+				ep.IPAddresses = append(ep.IPAddresses, ipNet)
+			}
+		}
+		if ep.Id == "" || rec.NetworkID == "" {
+			continue
+		}
+		eps = append(eps, rec)
+	}
+	return eps, nil
+}
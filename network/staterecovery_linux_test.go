@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vishnetlink "github.com/vishvananda/netlink"
+)
+
+// fakeAltNameClient keeps the links of a namespace in memory.
+type fakeAltNameClient struct {
+	links []vishnetlink.Link
+}
+
+func (f *fakeAltNameClient) LinkAddAltName(ifName, altName string) error {
+	for _, link := range f.links {
+		if link.Attrs().Name == ifName {
+			link.Attrs().AltNames = append(link.Attrs().AltNames, altName)
+			return nil
+		}
+	}
+	return errors.Errorf("link %s not found", ifName)
+}
+
+func (f *fakeAltNameClient) LinkList() ([]vishnetlink.Link, error) {
+	return f.links, nil
+}
+
+func TestRecoverStateFromHostInterfaces(t *testing.T) {
+	extIf := &externalInterface{Name: "eth0"}
+	nw := &network{Id: "azure", Mode: opModeTransparent, extIf: extIf}
+	ep := &endpoint{
+		Id:           "3f813b02-eth0",
+		HostIfName:   "azv3f813b0",
+		IfName:       "eth0",
+		ContainerID:  "3f813b029429b4e41a09ab33b6f6d365d2ed704017524c78d1d0dece33cdaf46",
+		PODName:      "metrics-server-77c8679d7d-6ksdh",
+		PODNameSpace: "kube-system",
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("10.241.0.17"), Mask: net.CIDRMask(16, 32)},
+			{IP: net.ParseIP("fd00::11"), Mask: net.CIDRMask(64, 128)},
+		},
+	}
+
+	c := &fakeAltNameClient{links: []vishnetlink.Link{
+		&vishnetlink.Veth{LinkAttrs: vishnetlink.LinkAttrs{Name: ep.HostIfName}},
+		// the interfaces of other owners have no metadata of an endpoint
+		&vishnetlink.Veth{LinkAttrs: vishnetlink.LinkAttrs{Name: "veth1234", AltNames: []string{"veth1234.ep.other"}}},
+		&vishnetlink.Device{LinkAttrs: vishnetlink.LinkAttrs{Name: "eth0", AltNames: []string{"enP1s1"}}},
+	}}
+	addRecoveryAltNames(c, nw, ep)
+	assert.Contains(t, c.links[0].Attrs().AltNames, "azv3f813b0.pod.kube-system_metrics-server-77c8679d7d-6ksdh")
+	assert.Contains(t, c.links[0].Attrs().AltNames, "azv3f813b0.ip.fd00--11_64")
+
+	eps, err := listHostIfEndpoints(c)
+	require.NoError(t, err)
+	require.Len(t, eps, 1)
+	assert.Equal(t, "azure", eps[0].NetworkID)
+	assert.Equal(t, opModeTransparent, eps[0].Mode)
+	assert.Equal(t, "eth0", eps[0].ExtIfName)
+
+	nm := &networkManager{}
+	nm.recoverState(eps)
+	recovered, err := nm.getNetwork("azure")
+	require.NoError(t, err)
+	assert.True(t, recovered.Recovered)
+	assert.Equal(t, "eth0", recovered.extIf.Name)
+
+	got := recovered.Endpoints[ep.Id]
+	require.NotNil(t, got)
+	assert.Equal(t, ep.HostIfName, got.HostIfName)
+	assert.Equal(t, ep.IfName, got.IfName)
+	assert.Equal(t, ep.ContainerID, got.ContainerID)
+	assert.Equal(t, ep.PODName, got.PODName)
+	assert.Equal(t, ep.PODNameSpace, got.PODNameSpace)
+	assert.Equal(t, ep.IPAddresses[0].String(), got.IPAddresses[0].String())
+	assert.Equal(t, ep.IPAddresses[1].String(), got.IPAddresses[1].String())
+	assert.Equal(t, []*endpoint{got}, recovered.getEndpointsByContainerID(ep.ContainerID))
+}
+
+func TestRecoverFromDataplaneDisabled(t *testing.T) {
+	nm := &networkManager{}
+	stateErr := errors.New("corrupt state")
+	assert.Equal(t, stateErr, nm.recoverFromDataplane(stateErr))
+	assert.NoError(t, nm.recoverFromDataplane(nil))
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network/hnswrapper"
+	"github.com/Microsoft/hcsshim/hcn"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// listRecoverableEndpoints returns the hcn endpoints of the plugin.
+func (*networkManager) listRecoverableEndpoints() ([]recoveredEndpoint, error) {
+	return listHcnEndpoints(Hnsv2)
+}
+
+// listHcnEndpoints returns the hcn endpoints of the plugin, which are told apart by their name, with the hcn network
+// they are in. hcn objects have no labels, so the pods of the endpoints are unknown: the endpoints only have their id,
+// which is the container id and interface of the pod, their ips, mac address and namespace.
+func listHcnEndpoints(hns hnswrapper.HnsV2WrapperInterface) ([]recoveredEndpoint, error) {
+	hcnEndpoints, err := hns.ListEndpointsQuery(hcn.HostComputeQuery{
+		SchemaVersion: hcn.V2SchemaVersion(),
+		Flags:         hcn.HostComputeQueryFlagsNone,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list hcn endpoints")
+	}
+
+	hcnNetworks := make(map[string]*hcn.HostComputeNetwork)
+	var eps []recoveredEndpoint
+	for i := range hcnEndpoints {
+		hcnEndpoint := &hcnEndpoints[i]
+		endpointID, ok := strings.CutSuffix(hcnEndpoint.Name, hcnEndpointOwnerTag)
+		if !ok {
+			continue
+		}
+
+		hcnNetwork, ok := hcnNetworks[hcnEndpoint.HostComputeNetwork]
+		if !ok {
+			if hcnNetwork, err = hns.GetNetworkByID(hcnEndpoint.HostComputeNetwork); err != nil {
+				return nil, errors.Wrapf(err, "failed to get hcn network %s of endpoint %s", hcnEndpoint.HostComputeNetwork, endpointID)
+			}
+			hcnNetworks[hcnEndpoint.HostComputeNetwork] = hcnNetwork
+		}
+
+		ep := &endpoint{
+			Id:                  endpointID,
+			HnsId:               hcnEndpoint.Id,
+			HNSNetworkID:        hcnNetwork.Id,
+			NetNs:               hcnEndpoint.HostComputeNamespace,
+			NICType:             cns.InfraNIC,
+			SecondaryInterfaces: make(map[string]*InterfaceInfo),
+		}
+		if sep := strings.LastIndex(endpointID, "-"); sep >= 0 {
+			ep.IfName = endpointID[sep+1:]
+		}
+		ep.MacAddress, _ = net.ParseMAC(hcnEndpoint.MacAddress)
+		for _, ipConfig := range hcnEndpoint.IpConfigurations {
+			ip := net.ParseIP(ipConfig.IpAddress)
+			if ip == nil {
+				logger.Error("Failed to parse the ip of an hcn endpoint", zap.String("endpointID", endpointID),
+					zap.String("ip", ipConfig.IpAddress))
+				continue
+			}
+			bits := net.IPv6len * 8
+			if ip.To4() != nil {
+				bits = net.IPv4len * 8
+			}
+			ep.IPAddresses = append(ep.IPAddresses, net.IPNet{IP: ip, Mask: net.CIDRMask(int(ipConfig.PrefixLength), bits)})
+		}
+
+		mode := opModeBridge
+		if hcnNetwork.Type == hcn.L2Tunnel {
+			mode = opModeTunnel
+		}
+		eps = append(eps, recoveredEndpoint{
+			NetworkID:    hcnNetwork.Name,
+			HnsNetworkID: hcnNetwork.Id,
+			Mode:         mode,
+			ExtIfName:    hcnNetworkAdapterName(hcnNetwork),
+			Endpoint:     ep,
+		})
+	}
+	return eps, nil
+}
+
+// hcnNetworkAdapterName returns the name of the adapter of the hcn network, empty when hns picked it.
+func hcnNetworkAdapterName(hcnNetwork *hcn.HostComputeNetwork) string {
+	for _, p := range hcnNetwork.Policies {
+		if p.Type != hcn.NetAdapterName {
+			continue
+		}
+		var setting hcn.NetAdapterNameNetworkPolicySetting
+		if err := json.Unmarshal(p.Settings, &setting); err == nil {
+			return setting.NetworkAdapterName
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/ebpfdatapath"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTransparentEBPFEndpointClient(nl netlink.NetlinkInterface, edp ebpfdatapath.EBPFDatapathInterface) *TransparentEBPFEndpointClient {
+	plc := platform.NewMockExecClient(false)
+	containerMac, _ := net.ParseMAC("12:34:56:78:9a:bc")
+	return &TransparentEBPFEndpointClient{
+		TransparentEndpointClient: &TransparentEndpointClient{
+			hostPrimaryIfName: "eth0",
+			hostVethName:      "azvhost",
+			containerVethName: "azvcontainer",
+			containerMac:      containerMac,
+			netlink:           nl,
+			plClient:          plc,
+			netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+			netioshim:         netio.NewMockNetIO(false, 0),
+		},
+		ebpfDatapath: edp,
+	}
+}
+
+func TestTransEBPFAddEndpointsRules(t *testing.T) {
+	dualStackIPs := []net.IPNet{
+		{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+		{IP: net.ParseIP("fc00::4"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)},
+	}
+
+	tests := []struct {
+		name          string
+		nl            netlink.NetlinkInterface
+		edp           *ebpfdatapath.MockEBPFDatapath
+		epInfo        *EndpointInfo
+		wantErr       bool
+		wantErrMsg    string
+		wantEndpoints map[string]string
+	}{
+		{
+			name:          "Add endpoint rules redirects ipv4 only",
+			nl:            netlink.NewMockNetlink(false, ""),
+			edp:           ebpfdatapath.NewMockEBPFDatapath(false),
+			epInfo:        &EndpointInfo{IPAddresses: dualStackIPs},
+			wantEndpoints: map[string]string{"192.168.0.4": "azvhost"},
+		},
+		{
+			name:          "Add endpoint rules route fail",
+			nl:            netlink.NewMockNetlink(true, "addroute fail"),
+			edp:           ebpfdatapath.NewMockEBPFDatapath(false),
+			epInfo:        &EndpointInfo{IPAddresses: dualStackIPs},
+			wantErr:       true,
+			wantErrMsg:    "addroute fail",
+			wantEndpoints: map[string]string{},
+		},
+		{
+			name:          "Add endpoint rules ebpf fail",
+			nl:            netlink.NewMockNetlink(false, ""),
+			edp:           ebpfdatapath.NewMockEBPFDatapath(true),
+			epInfo:        &EndpointInfo{IPAddresses: dualStackIPs},
+			wantErr:       true,
+			wantErrMsg:    ebpfdatapath.ErrMockEBPFDatapath.Error(),
+			wantEndpoints: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestTransparentEBPFEndpointClient(tt.nl, tt.edp)
+			err := client.AddEndpointRules(tt.epInfo)
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErrMsg)
+			} else {
+				require.NoError(t, err)
+				require.True(t, tt.edp.IsAttached("azvhost"))
+			}
+			require.Equal(t, tt.wantEndpoints, tt.edp.Endpoints())
+		})
+	}
+}
+
+func TestTransEBPFDeleteEndpointsRules(t *testing.T) {
+	edp := ebpfdatapath.NewMockEBPFDatapath(false)
+	client := newTestTransparentEBPFEndpointClient(netlink.NewMockNetlink(false, ""), edp)
+	epInfo := &EndpointInfo{
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+		},
+	}
+	require.NoError(t, client.AddEndpointRules(epInfo))
+	require.Len(t, edp.Endpoints(), 1)
+
+	client.DeleteEndpointRules(&endpoint{IPAddresses: epInfo.IPAddresses})
+	require.Empty(t, edp.Endpoints())
+}
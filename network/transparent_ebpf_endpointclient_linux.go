@@ -0,0 +1,74 @@
+package network
+
+import (
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/ebpfdatapath"
+	"github.com/Azure/azure-container-networking/platform"
+	"go.uber.org/zap"
+)
+
+// TransparentEBPFEndpointClient plumbs endpoints like the TransparentEndpointClient, and additionally redirects
+// traffic between the node's pods with a tc-eBPF program on the host veths, so that pod to pod traffic skips the
+// host's routing and iptables. The host routes are kept for traffic from the host and from outside the node.
+type TransparentEBPFEndpointClient struct {
+	*TransparentEndpointClient
+	ebpfDatapath ebpfdatapath.EBPFDatapathInterface
+}
+
+func NewTransparentEBPFEndpointClient(
+	extIf *externalInterface,
+	hostVethName string,
+	containerVethName string,
+	mode string,
+	nl netlink.NetlinkInterface,
+	nioc netio.NetIOInterface,
+	plc platform.ExecClient,
+	edp ebpfdatapath.EBPFDatapathInterface,
+) *TransparentEBPFEndpointClient {
+	return &TransparentEBPFEndpointClient{
+		TransparentEndpointClient: NewTransparentEndpointClient(extIf, hostVethName, containerVethName, mode, nl, nioc, plc),
+		ebpfDatapath:              edp,
+	}
+}
+
+func (client *TransparentEBPFEndpointClient) AddEndpointRules(epInfo *EndpointInfo) error {
+	if err := client.TransparentEndpointClient.AddEndpointRules(epInfo); err != nil {
+		return err
+	}
+
+	logger.Info("Attaching ebpf redirect program", zap.String("hostVethName", client.hostVethName))
+	if err := client.ebpfDatapath.Attach(client.hostVethName); err != nil {
+		return newErrorTransparentEndpointClient(err)
+	}
+
+	for _, ipAddr := range epInfo.IPAddresses {
+		// only ipv4 is redirected, ipv6 keeps going through the host routes
+		if ipAddr.IP.To4() == nil {
+			continue
+		}
+
+		logger.Info("Adding ebpf redirect for", zap.String("ip", ipAddr.IP.String()))
+		if err := client.ebpfDatapath.AddEndpoint(ipAddr.IP, client.hostVethName, client.containerMac); err != nil {
+			return newErrorTransparentEndpointClient(err)
+		}
+	}
+
+	return nil
+}
+
+func (client *TransparentEBPFEndpointClient) DeleteEndpointRules(ep *endpoint) {
+	// the redirect program is removed with the host veth
+	for _, ipAddr := range ep.IPAddresses {
+		if ipAddr.IP.To4() == nil {
+			continue
+		}
+
+		logger.Info("Deleting ebpf redirect for", zap.String("ip", ipAddr.IP.String()))
+		if err := client.ebpfDatapath.DeleteEndpoint(ipAddr.IP); err != nil {
+			logger.Error("Failed to delete ebpf redirect for", zap.String("ip", ipAddr.IP.String()), zap.Error(err))
+		}
+	}
+
+	client.TransparentEndpointClient.DeleteEndpointRules(ep)
+}
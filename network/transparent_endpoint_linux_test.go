@@ -330,6 +330,31 @@ func TestTransConfigureContainerInterfacesAndRoutes(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Configure Interface and routes with secondary ips happy path",
+			client: &TransparentEndpointClient{
+				hostPrimaryIfName: "eth0",
+				hostVethName:      "azvhost",
+				containerVethName: "azvcontainer",
+				netlink:           netlink.NewMockNetlink(false, ""),
+				plClient:          platform.NewMockExecClient(false),
+				netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+				netioshim:         netio.NewMockNetIO(false, 0),
+			},
+			epInfo: &EndpointInfo{
+				IPAddresses: []net.IPNet{
+					{
+						IP:   net.ParseIP("192.168.0.4"),
+						Mask: net.CIDRMask(subnetv4Mask, ipv4Bits),
+					},
+					{
+						IP:   net.ParseIP("192.168.0.5"),
+						Mask: net.CIDRMask(subnetv4Mask, ipv4Bits),
+					},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Configure Interface and routes assign ip fail",
 			client: &TransparentEndpointClient{
@@ -389,3 +414,31 @@ func TestTransConfigureContainerInterfacesAndRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestTransConfigureContainerInterfacesAndRoutesHostPrefix(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var deleted []string
+	nl.SetDeleteRouteValidationFn(func(r *netlink.Route) error {
+		deleted = append(deleted, r.Dst.String())
+		return nil
+	})
+	client := &TransparentEndpointClient{
+		hostPrimaryIfName: "eth0",
+		hostVethName:      "azvhost",
+		containerVethName: "azvcontainer",
+		netlink:           nl,
+		plClient:          platform.NewMockExecClient(false),
+		netUtilsClient:    networkutils.NewNetworkUtils(nl, platform.NewMockExecClient(false)),
+		netioshim:         netio.NewMockNetIO(false, 0),
+	}
+
+	// the kernel adds no subnet route for the /32 ip, only the route of the /24 ip is deleted
+	epInfo := &EndpointInfo{
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(ipv4FullMask, ipv4Bits)},
+			{IP: net.ParseIP("192.168.1.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+		},
+	}
+	require.NoError(t, client.ConfigureContainerInterfacesAndRoutes(epInfo))
+	require.Equal(t, []string{"192.168.1.0/24"}, deleted)
+}
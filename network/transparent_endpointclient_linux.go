@@ -122,13 +122,14 @@ func (client *TransparentEndpointClient) AddEndpoints(epInfo *EndpointInfo) erro
 
 	client.hostVethMac = hostVethIf.HardwareAddr
 
-	logger.Info("Setting mtu on veth interface", zap.Int("MTU", primaryIf.MTU), zap.String("hostVethName", client.hostVethName))
-	if err := client.netlink.SetLinkMTU(client.hostVethName, primaryIf.MTU); err != nil {
+	mtu := linkMTU(epInfo.MTU, primaryIf.MTU)
+	logger.Info("Setting mtu on veth interface", zap.Int("MTU", mtu), zap.String("hostVethName", client.hostVethName))
+	if err := client.netlink.SetLinkMTU(client.hostVethName, mtu); err != nil {
 		logger.Error("Setting mtu failed for hostveth", zap.String("hostVethName", client.hostVethName),
 			zap.Error(err))
 	}
 
-	if err := client.netlink.SetLinkMTU(client.containerVethName, primaryIf.MTU); err != nil {
+	if err := client.netlink.SetLinkMTU(client.containerVethName, mtu); err != nil {
 		logger.Error("Setting mtu failed for containerveth", zap.String("containerVethName", client.containerVethName),
 			zap.Error(err))
 	}
@@ -219,8 +220,15 @@ func (client *TransparentEndpointClient) ConfigureContainerInterfacesAndRoutes(e
 	}
 
 	// ip route del 10.240.0.0/12 dev eth0 (removing kernel subnet route added by above call)
+	// secondary ips in the same subnet share a single kernel route, so only delete it once
+	deletedSubnets := make(map[string]struct{}, len(epInfo.IPAddresses))
 	for _, ipAddr := range epInfo.IPAddresses {
 		_, ipnet, _ := net.ParseCIDR(ipAddr.String())
+		if _, ok := deletedSubnets[ipnet.String()]; ok || !hasKernelSubnetRoute(ipnet) {
+			continue
+		}
+		deletedSubnets[ipnet.String()] = struct{}{}
+
 		routeInfo := RouteInfo{
 			Dst:      *ipnet,
 			Scope:    netlink.RT_SCOPE_LINK,
@@ -266,7 +274,13 @@ func (client *TransparentEndpointClient) ConfigureContainerInterfacesAndRoutes(e
 		MacAddress: client.hostVethMac,
 	}
 
-	if err := client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.ADD, netlink.NUD_PROBE); err != nil {
+	// the vm of a sandboxed runtime has its own neighbor table, and the runtime only copies the permanent entries of
+	// the netns into it
+	neighState := netlink.NUD_PROBE
+	if epInfo.VMSandbox {
+		neighState = netlink.NUD_PERMANENT
+	}
+	if err := client.netlink.SetOrRemoveLinkAddress(linkInfo, netlink.ADD, neighState); err != nil {
 		return fmt.Errorf("Adding arp in container failed: %w", err)
 	}
 
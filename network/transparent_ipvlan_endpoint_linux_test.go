@@ -0,0 +1,156 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTransparentIPVlanEndpointClient(nl netlink.NetlinkInterface, nioc netio.NetIOInterface) *TransparentIPVlanEndpointClient {
+	plc := platform.NewMockExecClient(false)
+	return &TransparentIPVlanEndpointClient{
+		hostPrimaryIfName: "eth0",
+		containerIfName:   "azvcontainer",
+		netlink:           nl,
+		netioshim:         nioc,
+		plClient:          plc,
+		nsClient:          NewMockNamespaceClient(),
+		netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+	}
+}
+
+func TestTransIPVlanAddEndpoints(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var links []*netlink.IPVlanLink
+	nl.AddLinkFn = func(l netlink.Link) error {
+		links = append(links, l.(*netlink.IPVlanLink))
+		return nil
+	}
+	nioc := netio.NewMockNetIO(false, 0)
+	// only the primary interface is there, the host ipvlan device is added with the first endpoint
+	nioc.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name == "eth0" {
+			return &net.Interface{Name: name, Index: 2, MTU: 1500}, nil
+		}
+		for _, link := range links {
+			if link.Name == name {
+				return &net.Interface{Name: name}, nil
+			}
+		}
+		return nil, netio.ErrMockNetIOFail
+	})
+	client := newTestTransparentIPVlanEndpointClient(nl, nioc)
+
+	epInfo := &EndpointInfo{
+		IPAddresses: []net.IPNet{{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)}},
+	}
+	require.NoError(t, client.AddEndpoints(epInfo))
+	require.NoError(t, client.AddEndpointRules(epInfo))
+
+	require.Len(t, links, 2)
+	for i, name := range []string{"azvcontainer", ipvlanHostIfName} {
+		assert.Equal(t, name, links[i].Name)
+		assert.Equal(t, netlink.LINK_TYPE_IPVLAN, links[i].Type)
+		assert.Equal(t, netlink.IPVLAN_MODE_L3S, links[i].Mode)
+		assert.Equal(t, 2, links[i].ParentIndex)
+		assert.Equal(t, uint(1500), links[i].MTU)
+	}
+}
+
+func TestTransIPVlanAddEndpointRules(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var routes []string
+	nl.SetAddRouteValidationFn(func(r *netlink.Route) error {
+		routes = append(routes, r.Dst.String())
+		return nil
+	})
+	nl.AddLinkFn = func(netlink.Link) error {
+		t.Fatal("the host ipvlan device is there already")
+		return nil
+	}
+	client := newTestTransparentIPVlanEndpointClient(nl, netio.NewMockNetIO(false, 0))
+
+	epInfo := &EndpointInfo{
+		IPAddresses: []net.IPNet{
+			{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+			{IP: net.ParseIP("fc00::4"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)},
+		},
+	}
+	require.NoError(t, client.AddEndpointRules(epInfo))
+	assert.Equal(t, []string{"192.168.0.4/32", "fc00::4/128"}, routes)
+}
+
+func TestTransIPVlanConfigureContainerInterfacesAndRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		epInfo     *EndpointInfo
+		wantRoutes []string
+	}{
+		{
+			name: "default routes on link for every family",
+			epInfo: &EndpointInfo{
+				IPAddresses: []net.IPNet{
+					{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+					{IP: net.ParseIP("192.168.0.5"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+					{IP: net.ParseIP("fc00::4"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)},
+				},
+			},
+			wantRoutes: []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name: "routes of the endpoint in place of the default routes",
+			epInfo: &EndpointInfo{
+				IPAddresses: []net.IPNet{
+					{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+				},
+				SkipDefaultRoutes: true,
+				Routes: []RouteInfo{
+					{Dst: net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, ipv4Bits)}},
+				},
+			},
+			wantRoutes: []string{"10.0.0.0/8"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nl := netlink.NewMockNetlink(false, "")
+			var routes []string
+			nl.SetAddRouteValidationFn(func(r *netlink.Route) error {
+				if r.Gw == nil && !tt.epInfo.SkipDefaultRoutes {
+					assert.Equal(t, netlink.RT_SCOPE_LINK, r.Scope)
+				}
+				routes = append(routes, r.Dst.String())
+				return nil
+			})
+			client := newTestTransparentIPVlanEndpointClient(nl, netio.NewMockNetIO(false, 0))
+			require.NoError(t, client.ConfigureContainerInterfacesAndRoutes(tt.epInfo))
+			assert.Equal(t, tt.wantRoutes, routes)
+		})
+	}
+}
+
+func TestTransIPVlanDeleteEndpoints(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var deleted []string
+	nl.DeleteLinkFn = func(name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+	client := newTestTransparentIPVlanEndpointClient(nl, netio.NewMockNetIO(false, 0))
+
+	// the device is deleted in the netns of the pod, unless the netns is gone
+	require.NoError(t, client.DeleteEndpoints(&endpoint{IfName: "eth0", NetworkNameSpace: "/var/run/netns/pod"}))
+	require.NoError(t, client.DeleteEndpoints(&endpoint{IfName: "eth0"}))
+	assert.Equal(t, []string{"eth0"}, deleted)
+}
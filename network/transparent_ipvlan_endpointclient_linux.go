@@ -0,0 +1,244 @@
+package network
+
+import (
+	"net"
+	"os"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ipvlanHostIfName is the ipvlan device of the host on the parent of the endpoints of ipvlan networks. The host reaches
+// the endpoints through it, as the traffic the parent sends itself never reaches the ipvlan devices on it.
+const ipvlanHostIfName = "azipvlanhost"
+
+var errorTransparentIPVlanEndpointClient = errors.New("TransparentIPVlanEndpointClient Error")
+
+func newErrorTransparentIPVlanEndpointClient(err error) error {
+	return errors.Wrapf(err, "%s", errorTransparentIPVlanEndpointClient)
+}
+
+// TransparentIPVlanEndpointClient plumbs the endpoints of transparent networks as ipvlan devices in l3s mode on the host
+// interface, in place of the veth pairs of the TransparentEndpointClient. The ipvlan driver delivers the traffic of the
+// endpoints' ips to them, so they need neither proxy arp nor static arp entries, and the l3s mode still passes their
+// traffic through the netfilter hooks of the host. Only the host reaches them through host routes, on ipvlanHostIfName.
+type TransparentIPVlanEndpointClient struct {
+	hostPrimaryIfName string
+	containerIfName   string
+	netlink           netlink.NetlinkInterface
+	netioshim         netio.NetIOInterface
+	plClient          platform.ExecClient
+	nsClient          NamespaceClientInterface
+	netUtilsClient    networkutils.NetworkUtils
+}
+
+func NewTransparentIPVlanEndpointClient(
+	extIf *externalInterface,
+	containerIfName string,
+	nl netlink.NetlinkInterface,
+	nioc netio.NetIOInterface,
+	plc platform.ExecClient,
+	nsc NamespaceClientInterface,
+) *TransparentIPVlanEndpointClient {
+	return &TransparentIPVlanEndpointClient{
+		hostPrimaryIfName: extIf.Name,
+		containerIfName:   containerIfName,
+		netlink:           nl,
+		netioshim:         nioc,
+		plClient:          plc,
+		nsClient:          nsc,
+		netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+	}
+}
+
+func (client *TransparentIPVlanEndpointClient) AddEndpoints(_ *EndpointInfo) error {
+	primaryIf, err := client.netioshim.GetNetworkInterfaceByName(client.hostPrimaryIfName)
+	if err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	if _, err := client.netioshim.GetNetworkInterfaceByName(client.containerIfName); err == nil {
+		logger.Info("Deleting old ipvlan device", zap.String("containerIfName", client.containerIfName))
+		if err := client.netlink.DeleteLink(client.containerIfName); err != nil {
+			return newErrorTransparentIPVlanEndpointClient(err)
+		}
+	}
+
+	logger.Info("Adding ipvlan device", zap.String("containerIfName", client.containerIfName),
+		zap.String("parent", client.hostPrimaryIfName))
+	if err := client.netlink.AddLink(client.ipvlanLink(client.containerIfName, primaryIf)); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *TransparentIPVlanEndpointClient) ipvlanLink(name string, parent *net.Interface) *netlink.IPVlanLink {
+	return &netlink.IPVlanLink{
+		LinkInfo: netlink.LinkInfo{
+			Type:        netlink.LINK_TYPE_IPVLAN,
+			Name:        name,
+			MTU:         uint(parent.MTU),
+			ParentIndex: parent.Index,
+		},
+		Mode: netlink.IPVLAN_MODE_L3S,
+	}
+}
+
+// ensureHostIPVlan adds the ipvlan device of the host, unless an endpoint added it before.
+func (client *TransparentIPVlanEndpointClient) ensureHostIPVlan() error {
+	if _, err := client.netioshim.GetNetworkInterfaceByName(ipvlanHostIfName); err == nil {
+		return nil
+	}
+
+	primaryIf, err := client.netioshim.GetNetworkInterfaceByName(client.hostPrimaryIfName)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	logger.Info("Adding host ipvlan device", zap.String("name", ipvlanHostIfName), zap.String("parent", client.hostPrimaryIfName))
+	if err := client.netlink.AddLink(client.ipvlanLink(ipvlanHostIfName, primaryIf)); err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	return client.netlink.SetLinkState(ipvlanHostIfName, true) //nolint:wrapcheck // wrapped by the caller
+}
+
+// hostRoutes returns the routes of the host to the ips of the endpoint.
+func hostRoutes(ipAddresses []net.IPNet) []RouteInfo {
+	routes := make([]RouteInfo, 0, len(ipAddresses))
+	for _, ipAddr := range ipAddresses {
+		ipNet := net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(ipv6FullMask, ipv6Bits)}
+		if ipAddr.IP.To4() != nil {
+			ipNet = net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(ipv4FullMask, ipv4Bits)}
+		}
+		routes = append(routes, RouteInfo{Dst: ipNet})
+	}
+	return routes
+}
+
+func (client *TransparentIPVlanEndpointClient) AddEndpointRules(epInfo *EndpointInfo) error {
+	if err := client.ensureHostIPVlan(); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	// ip route add <podip> dev azipvlanhost
+	if err := addRoutes(client.netlink, client.netioshim, ipvlanHostIfName, hostRoutes(epInfo.IPAddresses)); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *TransparentIPVlanEndpointClient) DeleteEndpointRules(ep *endpoint) {
+	for _, route := range hostRoutes(ep.IPAddresses) {
+		logger.Info("Deleting route for the", zap.String("ip", route.Dst.String()))
+		if err := deleteRoutes(client.netlink, client.netioshim, ipvlanHostIfName, []RouteInfo{route}); err != nil {
+			logger.Error("Failed to delete route on VM for the", zap.String("ip", route.Dst.String()), zap.Error(err))
+		}
+	}
+}
+
+func (client *TransparentIPVlanEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
+	logger.Info("Setting link netns", zap.String("containerIfName", client.containerIfName), zap.String("NetNsPath", epInfo.NetNsPath))
+	if err := client.netlink.SetLinkNetNs(client.containerIfName, nsID); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *TransparentIPVlanEndpointClient) SetupContainerInterfaces(epInfo *EndpointInfo) error {
+	if err := client.netUtilsClient.SetupContainerInterface(client.containerIfName, epInfo.IfName); err != nil {
+		return err
+	}
+
+	client.containerIfName = epInfo.IfName
+
+	return nil
+}
+
+func (client *TransparentIPVlanEndpointClient) ConfigureContainerInterfacesAndRoutes(epInfo *EndpointInfo) error {
+	if err := client.netUtilsClient.AssignIPToInterface(client.containerIfName, epInfo.IPAddresses); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	if epInfo.SkipDefaultRoutes {
+		if err := addRoutes(client.netlink, client.netioshim, client.containerIfName, epInfo.Routes); err != nil {
+			return newErrorTransparentIPVlanEndpointClient(err)
+		}
+		return nil
+	}
+
+	// the ipvlan device has no neighbors, everything is routed on link through it to the host's routing
+	// ip route add default dev eth0
+	routes := defaultLinkRoutes(epInfo.IPAddresses)
+	if err := addRoutes(client.netlink, client.netioshim, client.containerIfName, routes); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+// defaultLinkRoutes returns the default routes on link of the families of the ips of the endpoint.
+func defaultLinkRoutes(ipAddresses []net.IPNet) []RouteInfo {
+	var routes []RouteInfo
+	families := map[bool]bool{}
+	for _, ipAddr := range ipAddresses {
+		isIPv4 := ipAddr.IP.To4() != nil
+		if families[isIPv4] {
+			continue
+		}
+		families[isIPv4] = true
+
+		_, dst, _ := net.ParseCIDR(defaultv6Cidr)
+		if isIPv4 {
+			_, dst, _ = net.ParseCIDR(defaultGwCidr)
+		}
+		routes = append(routes, RouteInfo{Dst: *dst, Scope: netlink.RT_SCOPE_LINK})
+	}
+	return routes
+}
+
+// DeleteEndpoints deletes the ipvlan device of the endpoint in the netns of the pod, which may outlive the endpoint,
+// as the ipvlan driver refuses the ips of the device to other devices on the parent while it is there.
+func (client *TransparentIPVlanEndpointClient) DeleteEndpoints(ep *endpoint) error {
+	if ep.NetworkNameSpace == "" {
+		return nil
+	}
+
+	ns, err := client.nsClient.OpenNamespace(ep.NetworkNameSpace)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// the device went away with the netns
+			return nil
+		}
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+	defer ns.Close()
+
+	logger.Info("Entering netns", zap.String("NetNsPath", ep.NetworkNameSpace))
+	if err := ns.Enter(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+	defer func() {
+		logger.Info("Exiting netns", zap.String("NetNsPath", ep.NetworkNameSpace))
+		if err := ns.Exit(); err != nil {
+			logger.Error("Failed to exit netns with", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Deleting ipvlan device", zap.String("ifName", ep.IfName))
+	if err := client.netlink.DeleteLink(ep.IfName); err != nil {
+		return newErrorTransparentIPVlanEndpointClient(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestDHCP = errors.New("dhcp failed")
+
+type testDHCP struct {
+	macs    []net.HardwareAddr
+	ifNames []string
+	err     error
+}
+
+func (d *testDHCP) DiscoverRequest(_ context.Context, mac net.HardwareAddr, ifName string) error {
+	d.macs = append(d.macs, mac)
+	d.ifNames = append(d.ifNames, ifName)
+	return d.err
+}
+
+func newTestTransparentMacvlanEndpointClient(nl netlink.NetlinkInterface, nioc netio.NetIOInterface, dhcpc dhcpClient) *TransparentMacvlanEndpointClient {
+	plc := platform.NewMockExecClient(false)
+	return &TransparentMacvlanEndpointClient{
+		hostPrimaryIfName: "eth0",
+		containerIfName:   "azvcontainer",
+		netlink:           nl,
+		netioshim:         nioc,
+		plClient:          plc,
+		nsClient:          NewMockNamespaceClient(),
+		dhcpClient:        dhcpc,
+		netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+	}
+}
+
+func TestTransMacvlanAddEndpoints(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var links []*netlink.MacvlanLink
+	nl.AddLinkFn = func(l netlink.Link) error {
+		links = append(links, l.(*netlink.MacvlanLink))
+		return nil
+	}
+	nioc := netio.NewMockNetIO(false, 0)
+	// only the primary interface is there, the host macvlan device is added with the first endpoint
+	nioc.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+		if name == "eth0" {
+			return &net.Interface{Name: name, Index: 2, MTU: 1500}, nil
+		}
+		for _, link := range links {
+			if link.Name == name {
+				return &net.Interface{Name: name}, nil
+			}
+		}
+		return nil, netio.ErrMockNetIOFail
+	})
+	client := newTestTransparentMacvlanEndpointClient(nl, nioc, &testDHCP{})
+
+	epInfo := &EndpointInfo{
+		IPAddresses: []net.IPNet{{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)}},
+	}
+	require.NoError(t, client.AddEndpoints(epInfo))
+	require.NoError(t, client.AddEndpointRules(epInfo))
+
+	require.Len(t, links, 2)
+	for i, name := range []string{"azvcontainer", macvlanHostIfName} {
+		assert.Equal(t, name, links[i].Name)
+		assert.Equal(t, netlink.LINK_TYPE_MACVLAN, links[i].Type)
+		assert.Equal(t, netlink.MACVLAN_MODE_BRIDGE, links[i].Mode)
+		assert.Equal(t, 2, links[i].ParentIndex)
+		assert.Equal(t, uint(1500), links[i].MTU)
+	}
+}
+
+func TestTransMacvlanConfigureContainerInterfacesAndRoutes(t *testing.T) {
+	mac, _ := net.ParseMAC("12:34:56:78:9a:bc")
+
+	tests := []struct {
+		name       string
+		dhcpErr    error
+		wantRoutes []string
+		wantErr    bool
+	}{
+		{
+			name:       "default routes on link and mac address registered",
+			wantRoutes: []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			name:       "dhcp discover failure fails the endpoint",
+			dhcpErr:    errTestDHCP,
+			wantRoutes: []string{"0.0.0.0/0", "::/0"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nl := netlink.NewMockNetlink(false, "")
+			var routes []string
+			nl.SetAddRouteValidationFn(func(r *netlink.Route) error {
+				assert.Equal(t, netlink.RT_SCOPE_LINK, r.Scope)
+				routes = append(routes, r.Dst.String())
+				return nil
+			})
+			nioc := netio.NewMockNetIO(false, 0)
+			nioc.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+				return &net.Interface{Name: name, HardwareAddr: mac}, nil
+			})
+			dhcpc := &testDHCP{err: tt.dhcpErr}
+			client := newTestTransparentMacvlanEndpointClient(nl, nioc, dhcpc)
+			client.containerIfName = "eth0"
+
+			err := client.ConfigureContainerInterfacesAndRoutes(&EndpointInfo{
+				IPAddresses: []net.IPNet{
+					{IP: net.ParseIP("192.168.0.4"), Mask: net.CIDRMask(subnetv4Mask, ipv4Bits)},
+					{IP: net.ParseIP("fc00::4"), Mask: net.CIDRMask(subnetv6Mask, ipv6Bits)},
+				},
+			})
+			if tt.wantErr {
+				require.ErrorIs(t, err, errTestDHCP)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRoutes, routes)
+			assert.Equal(t, []net.HardwareAddr{mac}, dhcpc.macs)
+			assert.Equal(t, []string{"eth0"}, dhcpc.ifNames)
+		})
+	}
+}
+
+func TestTransMacvlanDeleteEndpoints(t *testing.T) {
+	nl := netlink.NewMockNetlink(false, "")
+	var deleted []string
+	nl.DeleteLinkFn = func(name string) error {
+		deleted = append(deleted, name)
+		return nil
+	}
+	client := newTestTransparentMacvlanEndpointClient(nl, netio.NewMockNetIO(false, 0), &testDHCP{})
+
+	// the device is deleted in the netns of the pod, unless the netns is gone
+	require.NoError(t, client.DeleteEndpoints(&endpoint{IfName: "eth0", NetworkNameSpace: "/var/run/netns/pod"}))
+	require.NoError(t, client.DeleteEndpoints(&endpoint{IfName: "eth0"}))
+	assert.Equal(t, []string{"eth0"}, deleted)
+}
@@ -0,0 +1,237 @@
+package network
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// macvlanHostIfName is the macvlan device of the host on the parent of the endpoints of macvlan networks. The host
+	// reaches the endpoints through it, as the parent itself can't talk to the macvlan devices on it.
+	macvlanHostIfName = "azmacvlanhost"
+	// macvlanDHCPTimeout bounds the dhcp discover registering the mac address of an endpoint with the fabric.
+	macvlanDHCPTimeout = 3 * time.Second
+)
+
+var errorTransparentMacvlanEndpointClient = errors.New("TransparentMacvlanEndpointClient Error")
+
+func newErrorTransparentMacvlanEndpointClient(err error) error {
+	return errors.Wrapf(err, "%s", errorTransparentMacvlanEndpointClient)
+}
+
+// TransparentMacvlanEndpointClient plumbs the endpoints of transparent networks as macvlan devices in bridge mode on the
+// host interface, in place of the veth pairs of the TransparentEndpointClient, for the appliances that need the pods to
+// appear on the vnet with a mac address of their own. The fabric only delivers the traffic of the mac addresses it
+// knows, so every endpoint registers its mac address with a dhcp discover once its ips are set, as the
+// SecondaryEndpointClient does. Only the host reaches the endpoints through host routes, on macvlanHostIfName.
+type TransparentMacvlanEndpointClient struct {
+	hostPrimaryIfName string
+	containerIfName   string
+	netlink           netlink.NetlinkInterface
+	netioshim         netio.NetIOInterface
+	plClient          platform.ExecClient
+	nsClient          NamespaceClientInterface
+	dhcpClient        dhcpClient
+	netUtilsClient    networkutils.NetworkUtils
+}
+
+func NewTransparentMacvlanEndpointClient(
+	extIf *externalInterface,
+	containerIfName string,
+	nl netlink.NetlinkInterface,
+	nioc netio.NetIOInterface,
+	plc platform.ExecClient,
+	nsc NamespaceClientInterface,
+	dhcpc dhcpClient,
+) *TransparentMacvlanEndpointClient {
+	return &TransparentMacvlanEndpointClient{
+		hostPrimaryIfName: extIf.Name,
+		containerIfName:   containerIfName,
+		netlink:           nl,
+		netioshim:         nioc,
+		plClient:          plc,
+		nsClient:          nsc,
+		dhcpClient:        dhcpc,
+		netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+	}
+}
+
+func (client *TransparentMacvlanEndpointClient) AddEndpoints(_ *EndpointInfo) error {
+	primaryIf, err := client.netioshim.GetNetworkInterfaceByName(client.hostPrimaryIfName)
+	if err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	if _, err := client.netioshim.GetNetworkInterfaceByName(client.containerIfName); err == nil {
+		logger.Info("Deleting old macvlan device", zap.String("containerIfName", client.containerIfName))
+		if err := client.netlink.DeleteLink(client.containerIfName); err != nil {
+			return newErrorTransparentMacvlanEndpointClient(err)
+		}
+	}
+
+	// the kernel generates the mac address of the device
+	logger.Info("Adding macvlan device", zap.String("containerIfName", client.containerIfName),
+		zap.String("parent", client.hostPrimaryIfName))
+	if err := client.netlink.AddLink(client.macvlanLink(client.containerIfName, primaryIf)); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *TransparentMacvlanEndpointClient) macvlanLink(name string, parent *net.Interface) *netlink.MacvlanLink {
+	return &netlink.MacvlanLink{
+		LinkInfo: netlink.LinkInfo{
+			Type:        netlink.LINK_TYPE_MACVLAN,
+			Name:        name,
+			MTU:         uint(parent.MTU),
+			ParentIndex: parent.Index,
+		},
+		Mode: netlink.MACVLAN_MODE_BRIDGE,
+	}
+}
+
+// ensureHostMacvlan adds the macvlan device of the host, unless an endpoint added it before.
+func (client *TransparentMacvlanEndpointClient) ensureHostMacvlan() error {
+	if _, err := client.netioshim.GetNetworkInterfaceByName(macvlanHostIfName); err == nil {
+		return nil
+	}
+
+	primaryIf, err := client.netioshim.GetNetworkInterfaceByName(client.hostPrimaryIfName)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	logger.Info("Adding host macvlan device", zap.String("name", macvlanHostIfName), zap.String("parent", client.hostPrimaryIfName))
+	if err := client.netlink.AddLink(client.macvlanLink(macvlanHostIfName, primaryIf)); err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	return client.netlink.SetLinkState(macvlanHostIfName, true) //nolint:wrapcheck // wrapped by the caller
+}
+
+func (client *TransparentMacvlanEndpointClient) AddEndpointRules(epInfo *EndpointInfo) error {
+	if err := client.ensureHostMacvlan(); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	// ip route add <podip> dev azmacvlanhost
+	if err := addRoutes(client.netlink, client.netioshim, macvlanHostIfName, hostRoutes(epInfo.IPAddresses)); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *TransparentMacvlanEndpointClient) DeleteEndpointRules(ep *endpoint) {
+	for _, route := range hostRoutes(ep.IPAddresses) {
+		logger.Info("Deleting route for the", zap.String("ip", route.Dst.String()))
+		if err := deleteRoutes(client.netlink, client.netioshim, macvlanHostIfName, []RouteInfo{route}); err != nil {
+			logger.Error("Failed to delete route on VM for the", zap.String("ip", route.Dst.String()), zap.Error(err))
+		}
+	}
+}
+
+func (client *TransparentMacvlanEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
+	logger.Info("Setting link netns", zap.String("containerIfName", client.containerIfName), zap.String("NetNsPath", epInfo.NetNsPath))
+	if err := client.netlink.SetLinkNetNs(client.containerIfName, nsID); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	return nil
+}
+
+func (client *TransparentMacvlanEndpointClient) SetupContainerInterfaces(epInfo *EndpointInfo) error {
+	if err := client.netUtilsClient.SetupContainerInterface(client.containerIfName, epInfo.IfName); err != nil {
+		return err
+	}
+
+	client.containerIfName = epInfo.IfName
+
+	return nil
+}
+
+func (client *TransparentMacvlanEndpointClient) ConfigureContainerInterfacesAndRoutes(epInfo *EndpointInfo) error {
+	if err := client.netUtilsClient.AssignIPToInterface(client.containerIfName, epInfo.IPAddresses); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	routes := epInfo.Routes
+	if !epInfo.SkipDefaultRoutes {
+		// the vnet answers the arp requests of the endpoint for every ip, so everything is routed on link
+		// ip route add default dev eth0
+		routes = defaultLinkRoutes(epInfo.IPAddresses)
+	}
+
+	if err := addRoutes(client.netlink, client.netioshim, client.containerIfName, routes); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	return client.registerMacAddress()
+}
+
+// registerMacAddress issues a dhcp discover from the macvlan device, which has the host create the mapping of its mac
+// address in the fabric. The response isn't used for anything.
+func (client *TransparentMacvlanEndpointClient) registerMacAddress() error {
+	containerIf, err := client.netioshim.GetNetworkInterfaceByName(client.containerIfName)
+	if err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), macvlanDHCPTimeout)
+	defer cancel()
+	logger.Info("Sending DHCP packet", zap.Any("macAddress", containerIf.HardwareAddr), zap.String("ifName", client.containerIfName))
+	if err := client.dhcpClient.DiscoverRequest(ctx, containerIf.HardwareAddr, client.containerIfName); err != nil {
+		return errors.Wrapf(err, "failed to issue dhcp discover packet to register mac address %s", containerIf.HardwareAddr)
+	}
+
+	return nil
+}
+
+// DeleteEndpoints deletes the macvlan device of the endpoint in the netns of the pod, which may outlive the endpoint,
+// as the mac address of the device would keep receiving the traffic of the ips of the endpoint while it is there.
+func (client *TransparentMacvlanEndpointClient) DeleteEndpoints(ep *endpoint) error {
+	if ep.NetworkNameSpace == "" {
+		return nil
+	}
+
+	ns, err := client.nsClient.OpenNamespace(ep.NetworkNameSpace)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// the device went away with the netns
+			return nil
+		}
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+	defer ns.Close()
+
+	logger.Info("Entering netns", zap.String("NetNsPath", ep.NetworkNameSpace))
+	if err := ns.Enter(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+	defer func() {
+		logger.Info("Exiting netns", zap.String("NetNsPath", ep.NetworkNameSpace))
+		if err := ns.Exit(); err != nil {
+			logger.Error("Failed to exit netns with", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Deleting macvlan device", zap.String("ifName", ep.IfName))
+	if err := client.netlink.DeleteLink(ep.IfName); err != nil {
+		return newErrorTransparentMacvlanEndpointClient(err)
+	}
+
+	return nil
+}
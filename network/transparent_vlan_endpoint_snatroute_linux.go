@@ -23,6 +23,8 @@ func (client *TransparentVlanEndpointClient) NewSnatClient(snatBridgeIP, localIP
 			client.iptablesClient,
 			client.netioshim,
 		)
+		client.snatClient.HostToNCPortRules = snatPortRules(epInfo.HostToNCPortRules)
+		client.snatClient.NCToHostPortRules = snatPortRules(epInfo.NCToHostPortRules)
 	}
 }
 
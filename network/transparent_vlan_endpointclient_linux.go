@@ -492,6 +492,9 @@ func (client *TransparentVlanEndpointClient) ConfigureContainerInterfacesAndRout
 	// kernel subnet route auto added by above call must be removed
 	for _, ipAddr := range epInfo.IPAddresses {
 		_, ipnet, _ := net.ParseCIDR(ipAddr.String())
+		if !hasKernelSubnetRoute(ipnet) {
+			continue
+		}
 		routeInfo := RouteInfo{
 			Dst:      *ipnet,
 			Scope:    netlink.RT_SCOPE_LINK,
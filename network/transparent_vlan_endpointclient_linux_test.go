@@ -106,6 +106,18 @@ func (ns *mockNetIO) GetNetworkInterfaceAddrs(_ *net.Interface) ([]net.Addr, err
 	return []net.Addr{}, nil
 }
 
+func (ns *mockNetIO) GetNetworkInterfacesInNetNs(string) ([]net.Interface, error) {
+	return nil, nil
+}
+
+func (ns *mockNetIO) GetNetworkInterfaceAddrsInNetNs(string, string) ([]net.Addr, error) {
+	return []net.Addr{}, nil
+}
+
+func (ns *mockNetIO) GetNetworkInterfaceStatsInNetNs(string, string) (*netio.InterfaceStats, error) {
+	return &netio.InterfaceStats{}, nil
+}
+
 func (ns *mockNetIO) GetNetworkInterfaceByMac(mac net.HardwareAddr) (*net.Interface, error) {
 	return &net.Interface{
 		//nolint:gomnd // Dummy MTU
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"math"
+	"net"
+)
+
+// NetworkUtilization is the number of endpoints of a network and the usage of the ips of its subnets.
+type NetworkUtilization struct {
+	NetworkID string
+	Endpoints int
+	Subnets   []SubnetUtilization
+}
+
+// SubnetUtilization is the usage of the ips of a subnet of a network. The capacity is the number of ips the endpoints
+// can get, without the subnet and broadcast addresses and the gateway and primary ip of the subnet.
+type SubnetUtilization struct {
+	Prefix       net.IPNet
+	CapacityIPs  uint64
+	UsedIPs      uint64
+	AvailableIPs uint64
+}
+
+// GetNetworkUtilization returns the utilization of every network known to the network manager.
+func (nm *networkManager) GetNetworkUtilization() []NetworkUtilization {
+	nm.Lock()
+	defer nm.Unlock()
+
+	var utilizations []NetworkUtilization
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			utilizations = append(utilizations, nw.utilization())
+		}
+	}
+	return utilizations
+}
+
+// utilization returns the number of endpoints of the network and the usage of the ips of its subnets.
+func (nw *network) utilization() NetworkUtilization {
+	utilization := NetworkUtilization{
+		NetworkID: nw.Id,
+		Endpoints: len(nw.Endpoints),
+	}
+	for i := range nw.Subnets {
+		utilization.Subnets = append(utilization.Subnets, nw.subnetUtilization(&nw.Subnets[i]))
+	}
+	return utilization
+}
+
+func (nw *network) subnetUtilization(subnet *SubnetInfo) SubnetUtilization {
+	reserved := map[string]bool{}
+	for _, ip := range []net.IP{subnet.Gateway, subnet.PrimaryIP} {
+		if ip != nil && subnet.Prefix.Contains(ip) {
+			reserved[ip.String()] = true
+		}
+	}
+
+	used := map[string]bool{}
+	for _, ep := range nw.Endpoints {
+		for i := range ep.IPAddresses {
+			ip := ep.IPAddresses[i].IP
+			if subnet.Prefix.Contains(ip) && !reserved[ip.String()] {
+				used[ip.String()] = true
+			}
+		}
+	}
+
+	utilization := SubnetUtilization{
+		Prefix:      subnet.Prefix,
+		CapacityIPs: subnetCapacity(subnet.Prefix, uint64(len(reserved))),
+		UsedIPs:     uint64(len(used)),
+	}
+	if utilization.CapacityIPs > utilization.UsedIPs {
+		utilization.AvailableIPs = utilization.CapacityIPs - utilization.UsedIPs
+	}
+	return utilization
+}
+
+// subnetCapacity returns the number of ips of the prefix the endpoints can get. The subnet and broadcast addresses of
+// ipv4 subnets larger than a /31, the subnet-router anycast address of ipv6 subnets and the reserved ips are left out.
+// The capacity of ipv6 subnets larger than a /65 saturates.
+func subnetCapacity(prefix net.IPNet, reserved uint64) uint64 {
+	ones, bits := prefix.Mask.Size()
+	hostBits := bits - ones
+	if bits == 0 {
+		return 0
+	}
+	if hostBits >= 64 { //nolint:gomnd // the bits of a uint64
+		return math.MaxUint64
+	}
+
+	size := uint64(1) << hostBits
+	var unusable uint64
+	switch {
+	case bits == net.IPv6len*8:
+		unusable = 1
+	case hostBits > 1:
+		unusable = 2
+	}
+	unusable += reserved
+	if size <= unusable {
+		return 0
+	}
+	return size - unusable
+}
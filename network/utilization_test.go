@@ -0,0 +1,70 @@
+package network
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubnetCapacity(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		reserved uint64
+		want     uint64
+	}{
+		{prefix: "10.0.0.0/24", want: 254},
+		{prefix: "10.0.0.0/24", reserved: 2, want: 252},
+		{prefix: "10.0.0.0/30", reserved: 2, want: 0},
+		{prefix: "10.0.0.0/31", want: 2},
+		{prefix: "10.0.0.1/32", want: 1},
+		{prefix: "fd00::/120", reserved: 1, want: 254},
+		{prefix: "fd00::/64", want: math.MaxUint64},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.prefix, func(t *testing.T) {
+			_, prefix, err := net.ParseCIDR(tt.prefix)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, subnetCapacity(*prefix, tt.reserved))
+		})
+	}
+}
+
+func TestNetworkUtilization(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/29")
+	ip := func(s string) net.IPNet {
+		return net.IPNet{IP: net.ParseIP(s), Mask: subnet.Mask}
+	}
+	nw := &network{
+		Id: "utilization",
+		Subnets: []SubnetInfo{{
+			Prefix:    *subnet,
+			Gateway:   net.ParseIP("10.0.0.1"),
+			PrimaryIP: net.ParseIP("10.0.0.2"),
+		}},
+		Endpoints: map[string]*endpoint{
+			"ep1": {IPAddresses: []net.IPNet{ip("10.0.0.3"), ip("fd00::3")}},
+			"ep2": {IPAddresses: []net.IPNet{ip("10.0.0.4")}},
+			// an ip outside of the subnet or of the host isn't used by the endpoints
+			"ep3": {IPAddresses: []net.IPNet{ip("10.0.1.4"), ip("10.0.0.2")}},
+		},
+	}
+
+	utilization := nw.utilization()
+	assert.Equal(t, 3, utilization.Endpoints)
+	require.Len(t, utilization.Subnets, 1)
+	assert.Equal(t, SubnetUtilization{Prefix: *subnet, CapacityIPs: 4, UsedIPs: 2, AvailableIPs: 2}, utilization.Subnets[0])
+
+	nw.recordUtilization()
+	assert.InDelta(t, 4, testutil.ToFloat64(subnetCapacityIPs.WithLabelValues("utilization", "10.0.0.0/29")), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(subnetAvailableIPs.WithLabelValues("utilization", "10.0.0.0/29")), 0)
+
+	nw.deleteUtilization()
+	assert.False(t, subnetCapacityIPs.DeleteLabelValues("utilization", "10.0.0.0/29"))
+	assert.False(t, subnetAvailableIPs.DeleteLabelValues("utilization", "10.0.0.0/29"))
+}
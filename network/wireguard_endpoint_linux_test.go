@@ -0,0 +1,90 @@
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/network/networkutils"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireguardAddEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		wgFlags net.Flags
+		wgErr   error
+		wantErr error
+	}{
+		{
+			name:    "Add endpoints with wireguard interface up",
+			wgFlags: net.FlagUp,
+		},
+		{
+			name:    "Add endpoints with wireguard interface down",
+			wantErr: errWireguardNotReady,
+		},
+		{
+			name:    "Add endpoints without wireguard interface",
+			wgErr:   netio.ErrMockNetIOFail,
+			wantErr: errWireguardNotReady,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			nl := netlink.NewMockNetlink(false, "")
+			plc := platform.NewMockExecClient(false)
+			nioc := netio.NewMockNetIO(false, 0)
+			nioc.SetGetInterfaceValidatonFn(func(name string) (*net.Interface, error) {
+				if name == DefaultWireguardIfName {
+					if tt.wgErr != nil {
+						return nil, tt.wgErr
+					}
+					return &net.Interface{Name: name, Flags: tt.wgFlags}, nil
+				}
+				return &net.Interface{Name: name, HardwareAddr: netio.HwAddr, Index: 2}, nil
+			})
+
+			client := &WireguardEndpointClient{
+				TransparentEndpointClient: &TransparentEndpointClient{
+					hostPrimaryIfName: "eth0",
+					hostVethName:      "azvhost",
+					containerVethName: "azvcontainer",
+					netlink:           nl,
+					plClient:          plc,
+					netUtilsClient:    networkutils.NewNetworkUtils(nl, plc),
+					netioshim:         nioc,
+				},
+				wireguardIfName: DefaultWireguardIfName,
+			}
+
+			err := client.AddEndpoints(&EndpointInfo{})
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, client.hostVethMac, "host veth should have been created")
+		})
+	}
+}
+
+func TestNewWireguardEndpointClientDefaultsIfName(t *testing.T) {
+	extIf := &externalInterface{Name: "eth0"}
+	nl := netlink.NewMockNetlink(false, "")
+	plc := platform.NewMockExecClient(false)
+	nioc := netio.NewMockNetIO(false, 0)
+
+	client := NewWireguardEndpointClient(extIf, "azvhost", "azvcontainer", opModeWireguard, "", nl, nioc, plc)
+	require.Equal(t, DefaultWireguardIfName, client.wireguardIfName)
+
+	client = NewWireguardEndpointClient(extIf, "azvhost", "azvcontainer", opModeWireguard, "wg1", nl, nioc, plc)
+	require.Equal(t, "wg1", client.wireguardIfName)
+}
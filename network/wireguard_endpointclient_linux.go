@@ -0,0 +1,52 @@
+package network
+
+import (
+	"net"
+
+	"github.com/Azure/azure-container-networking/netio"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// WireguardEndpointClient plumbs endpoints like the TransparentEndpointClient. Traffic to other nodes' pods is routed
+// over the wireguard interface cns manages, so endpoints are only added once the interface is up, rather than letting
+// the pod's traffic leave the node unencrypted.
+type WireguardEndpointClient struct {
+	*TransparentEndpointClient
+	wireguardIfName string
+}
+
+func NewWireguardEndpointClient(
+	extIf *externalInterface,
+	hostVethName string,
+	containerVethName string,
+	mode string,
+	wireguardIfName string,
+	nl netlink.NetlinkInterface,
+	nioc netio.NetIOInterface,
+	plc platform.ExecClient,
+) *WireguardEndpointClient {
+	if wireguardIfName == "" {
+		wireguardIfName = DefaultWireguardIfName
+	}
+
+	return &WireguardEndpointClient{
+		TransparentEndpointClient: NewTransparentEndpointClient(extIf, hostVethName, containerVethName, mode, nl, nioc, plc),
+		wireguardIfName:           wireguardIfName,
+	}
+}
+
+func (client *WireguardEndpointClient) AddEndpoints(epInfo *EndpointInfo) error {
+	wgIf, err := client.netioshim.GetNetworkInterfaceByName(client.wireguardIfName)
+	if err != nil {
+		return errors.Wrapf(errWireguardNotReady, "%s: %v", client.wireguardIfName, err)
+	}
+	if wgIf.Flags&net.FlagUp == 0 {
+		return errors.Wrapf(errWireguardNotReady, "%s is down", client.wireguardIfName)
+	}
+
+	logger.Info("Wireguard interface is up", zap.String("wireguardIfName", client.wireguardIfName))
+	return client.TransparentEndpointClient.AddEndpoints(epInfo)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 
 	"github.com/Azure/azure-container-networking/cni/log"
@@ -19,6 +20,7 @@ var logger = log.CNILogger.With(zap.String("component", "ovs"))
 
 const (
 	defaultMacForArpResponse = "12:34:56:78:9a:bc"
+	ovsVswitchdPidFile       = "/var/run/openvswitch/ovs-vswitchd.pid"
 )
 
 // Open flow rule priorities. Higher the number higher the priority
@@ -51,6 +53,11 @@ type OvsInterface interface {
 	DeleteIPSnatRule(bridgeName string, port string)
 	DeleteMacDnatRule(bridgeName string, port string, ip net.IP, vlanid int)
 	DeletePortFromOVS(bridgeName string, interfaceName string) error
+	GetOVSDaemonPID() (string, error)
+	CheckOVSDaemon() error
+	CheckOVSDatapath() error
+	OVSBridgeExists(bridgeName string) (bool, error)
+	GetOVSFlowCount(bridgeName string, match string) (int, error)
 }
 
 type Ovsctl struct {
@@ -132,6 +139,28 @@ func (o Ovsctl) AddArpSnatRule(bridgeName, mac, macHex, ofport string) error {
 	return nil
 }
 
+// ipProtocol returns the ovs match of the packets of the ip family of ip.
+func ipProtocol(ip net.IP) string {
+	if ip.To4() == nil {
+		return "ipv6"
+	}
+	return "ip"
+}
+
+// ipMatch returns the ovs match of the packets of the ip family of ip from or to ip.
+func ipMatch(ip net.IP, src bool) string {
+	field := "nw_dst"
+	switch {
+	case ip.To4() != nil && src:
+		field = "nw_src"
+	case ip.To4() == nil && src:
+		field = "ipv6_src"
+	case ip.To4() == nil:
+		field = "ipv6_dst"
+	}
+	return fmt.Sprintf("%s,%s=%s", ipProtocol(ip), field, ip.String())
+}
+
 // IP SNAT Rule - Change src mac to VM Mac for packets coming from container host veth port.
 func (o Ovsctl) AddIPSnatRule(bridgeName string, ip net.IP, vlanID int, port, mac, outport string) error {
 	var cmd string
@@ -139,26 +168,34 @@ func (o Ovsctl) AddIPSnatRule(bridgeName string, ip net.IP, vlanID int, port, ma
 		outport = "normal"
 	}
 
-	commonPrefix := fmt.Sprintf("ovs-ofctl add-flow %v priority=%d,ip,nw_src=%s,in_port=%s,vlan_tci=0,actions=mod_dl_src:%s", bridgeName, high, ip.String(), port, mac)
-
-	// This rule also checks if packets coming from right source ip based on the ovs port to prevent ip spoofing.
-	// Otherwise it drops the packet.
-	if vlanID != 0 {
-		cmd = fmt.Sprintf("%s,mod_vlan_vid:%v,%v", commonPrefix, vlanID, outport)
-	} else {
-		cmd = fmt.Sprintf("%s,strip_vlan,%v", commonPrefix, outport)
+	matches := []string{ipMatch(ip, true)}
+	if ip.To4() == nil {
+		// the neighbor solicitations and advertisements of the container are sent from its link local address
+		matches = append(matches, "icmp6,icmp_type=135", "icmp6,icmp_type=136")
 	}
 
-	_, err := o.execcli.ExecuteRawCommand(cmd)
-	if err != nil {
-		logger.Error("Adding IP SNAT rule failed with", zap.Error(err))
-		return newErrorOvsctl(err.Error())
+	for _, match := range matches {
+		commonPrefix := fmt.Sprintf("ovs-ofctl add-flow %v priority=%d,%s,in_port=%s,vlan_tci=0,actions=mod_dl_src:%s", bridgeName, high, match, port, mac)
+
+		// This rule also checks if packets coming from right source ip based on the ovs port to prevent ip spoofing.
+		// Otherwise it drops the packet.
+		if vlanID != 0 {
+			cmd = fmt.Sprintf("%s,mod_vlan_vid:%v,%v", commonPrefix, vlanID, outport)
+		} else {
+			cmd = fmt.Sprintf("%s,strip_vlan,%v", commonPrefix, outport)
+		}
+
+		_, err := o.execcli.ExecuteRawCommand(cmd)
+		if err != nil {
+			logger.Error("Adding IP SNAT rule failed with", zap.Error(err))
+			return newErrorOvsctl(err.Error())
+		}
 	}
 
 	// Drop other packets which doesn't satisfy above condition
-	cmd = fmt.Sprintf("ovs-ofctl add-flow %v priority=%d,ip,in_port=%s,actions=drop",
-		bridgeName, low, port)
-	_, err = o.execcli.ExecuteRawCommand(cmd)
+	cmd = fmt.Sprintf("ovs-ofctl add-flow %v priority=%d,%s,in_port=%s,actions=drop",
+		bridgeName, low, ipProtocol(ip), port)
+	_, err := o.execcli.ExecuteRawCommand(cmd)
 	if err != nil {
 		logger.Error("Dropping vlantag packet rule failed with", zap.Error(err))
 		return newErrorOvsctl(err.Error())
@@ -235,7 +272,7 @@ func (o Ovsctl) AddMacDnatRule(bridgeName, port string, ip net.IP, mac string, v
 	// This rule changes the destination mac to speciifed mac based on the ip and vlanid.
 	// and forwards the packet to corresponding container hostveth port
 
-	commonPrefix := fmt.Sprintf("ovs-ofctl add-flow %s ip,nw_dst=%s,in_port=%s", bridgeName, ip.String(), port)
+	commonPrefix := fmt.Sprintf("ovs-ofctl add-flow %s %s,in_port=%s", bridgeName, ipMatch(ip, false), port)
 	if vlanid != 0 {
 		cmd = fmt.Sprintf("%s,dl_vlan=%v,actions=mod_dl_dst:%s,strip_vlan,%s", commonPrefix, vlanid, mac, containerPort)
 	} else {
@@ -267,11 +304,13 @@ func (o Ovsctl) DeleteArpReplyRule(bridgeName, port string, ip net.IP, vlanid in
 }
 
 func (o Ovsctl) DeleteIPSnatRule(bridgeName, port string) {
-	cmd := fmt.Sprintf("ovs-ofctl del-flows %v ip,in_port=%s",
-		bridgeName, port)
-	_, err := o.execcli.ExecuteRawCommand(cmd)
-	if err != nil {
-		logger.Error("Error while deleting ovs rule", zap.String("cmd", cmd), zap.Error(err))
+	for _, protocol := range []string{"ip", "ipv6"} {
+		cmd := fmt.Sprintf("ovs-ofctl del-flows %v %s,in_port=%s",
+			bridgeName, protocol, port)
+		_, err := o.execcli.ExecuteRawCommand(cmd)
+		if err != nil {
+			logger.Error("Error while deleting ovs rule", zap.String("cmd", cmd), zap.Error(err))
+		}
 	}
 }
 
@@ -279,11 +318,11 @@ func (o Ovsctl) DeleteMacDnatRule(bridgeName, port string, ip net.IP, vlanid int
 	var cmd string
 
 	if vlanid != 0 {
-		cmd = fmt.Sprintf("ovs-ofctl del-flows %s ip,nw_dst=%s,dl_vlan=%v,in_port=%s",
-			bridgeName, ip.String(), vlanid, port)
+		cmd = fmt.Sprintf("ovs-ofctl del-flows %s %s,dl_vlan=%v,in_port=%s",
+			bridgeName, ipMatch(ip, false), vlanid, port)
 	} else {
-		cmd = fmt.Sprintf("ovs-ofctl del-flows %s ip,nw_dst=%s,in_port=%s",
-			bridgeName, ip.String(), port)
+		cmd = fmt.Sprintf("ovs-ofctl del-flows %s %s,in_port=%s",
+			bridgeName, ipMatch(ip, false), port)
 	}
 
 	_, err := o.execcli.ExecuteRawCommand(cmd)
@@ -303,3 +342,73 @@ func (o Ovsctl) DeletePortFromOVS(bridgeName, interfaceName string) error {
 
 	return nil
 }
+
+// GetOVSDaemonPID returns the pid of ovs-vswitchd, which changes when ovs restarts and drops the flows.
+func (Ovsctl) GetOVSDaemonPID() (string, error) {
+	pid, err := os.ReadFile(ovsVswitchdPidFile)
+	if err != nil {
+		return "", newErrorOvsctl(err.Error())
+	}
+
+	return strings.TrimSpace(string(pid)), nil
+}
+
+// CheckOVSDaemon checks that the userspace daemon ovs-vswitchd answers on its control socket.
+func (o Ovsctl) CheckOVSDaemon() error {
+	if _, err := o.execcli.ExecuteRawCommand("ovs-appctl -t ovs-vswitchd version"); err != nil {
+		logger.Error("ovs-vswitchd is not responding", zap.Error(err))
+		return newErrorOvsctl(err.Error())
+	}
+
+	return nil
+}
+
+// CheckOVSDatapath checks that the kernel datapath of ovs is loaded.
+func (o Ovsctl) CheckOVSDatapath() error {
+	out, err := o.execcli.ExecuteRawCommand("ovs-dpctl show")
+	if err != nil {
+		logger.Error("Showing ovs kernel datapath failed with", zap.Error(err))
+		return newErrorOvsctl(err.Error())
+	}
+
+	if strings.TrimSpace(out) == "" {
+		return newErrorOvsctl("no ovs kernel datapath")
+	}
+
+	return nil
+}
+
+func (o Ovsctl) OVSBridgeExists(bridgeName string) (bool, error) {
+	out, err := o.execcli.ExecuteRawCommand("ovs-vsctl list-br")
+	if err != nil {
+		logger.Error("Listing OVS bridges failed with", zap.Error(err))
+		return false, newErrorOvsctl(err.Error())
+	}
+
+	for _, name := range strings.Split(out, "\n") {
+		if strings.TrimSpace(name) == bridgeName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetOVSFlowCount returns the number of flows of the bridge matching match, e.g. ip,in_port=2.
+func (o Ovsctl) GetOVSFlowCount(bridgeName, match string) (int, error) {
+	cmd := fmt.Sprintf("ovs-ofctl dump-flows %s %s", bridgeName, match)
+	out, err := o.execcli.ExecuteRawCommand(cmd)
+	if err != nil {
+		logger.Error("Dumping flows failed with", zap.Error(err))
+		return 0, newErrorOvsctl(err.Error())
+	}
+
+	count := 0
+	for _, flow := range strings.Split(out, "\n") {
+		if strings.Contains(flow, "actions=") {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -104,3 +104,38 @@ func (m MockOvsctl) DeletePortFromOVS(bridgeName string, interfaceName string) e
 	}
 	return nil
 }
+
+func (m MockOvsctl) GetOVSDaemonPID() (string, error) {
+	if m.returnError {
+		return "", newErrorOvsctl(m.errorStr)
+	}
+	return "", nil
+}
+
+func (m MockOvsctl) CheckOVSDaemon() error {
+	if m.returnError {
+		return newErrorOvsctl(m.errorStr)
+	}
+	return nil
+}
+
+func (m MockOvsctl) CheckOVSDatapath() error {
+	if m.returnError {
+		return newErrorOvsctl(m.errorStr)
+	}
+	return nil
+}
+
+func (m MockOvsctl) OVSBridgeExists(bridgeName string) (bool, error) {
+	if m.returnError {
+		return false, newErrorOvsctl(m.errorStr)
+	}
+	return true, nil
+}
+
+func (m MockOvsctl) GetOVSFlowCount(bridgeName string, match string) (int, error) {
+	if m.returnError {
+		return 0, newErrorOvsctl(m.errorStr)
+	}
+	return 1, nil
+}
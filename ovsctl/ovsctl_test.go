@@ -0,0 +1,66 @@
+package ovsctl
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOvsctl() (Ovsctl, *[]string) {
+	cmds := []string{}
+	execcli := platform.NewMockExecClient(false)
+	execcli.SetExecRawCommand(func(cmd string) (string, error) {
+		cmds = append(cmds, cmd)
+		return "", nil
+	})
+	return Ovsctl{execcli: execcli}, &cmds
+}
+
+func TestAddIPSnatRule(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want []string
+	}{
+		{
+			name: "ipv4",
+			ip:   "10.0.0.4",
+			want: []string{
+				"ovs-ofctl add-flow azure0 priority=20,ip,nw_src=10.0.0.4,in_port=3,vlan_tci=0,actions=mod_dl_src:00:0d:3a:00:00:01,strip_vlan,1",
+				"ovs-ofctl add-flow azure0 priority=10,ip,in_port=3,actions=drop",
+			},
+		},
+		{
+			name: "ipv6 with neighbor discovery",
+			ip:   "fd00::4",
+			want: []string{
+				"ovs-ofctl add-flow azure0 priority=20,ipv6,ipv6_src=fd00::4,in_port=3,vlan_tci=0,actions=mod_dl_src:00:0d:3a:00:00:01,strip_vlan,1",
+				"ovs-ofctl add-flow azure0 priority=20,icmp6,icmp_type=135,in_port=3,vlan_tci=0,actions=mod_dl_src:00:0d:3a:00:00:01,strip_vlan,1",
+				"ovs-ofctl add-flow azure0 priority=20,icmp6,icmp_type=136,in_port=3,vlan_tci=0,actions=mod_dl_src:00:0d:3a:00:00:01,strip_vlan,1",
+				"ovs-ofctl add-flow azure0 priority=10,ipv6,in_port=3,actions=drop",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			o, cmds := newTestOvsctl()
+			require.NoError(t, o.AddIPSnatRule("azure0", net.ParseIP(tt.ip), 0, "3", "00:0d:3a:00:00:01", "1"))
+			assert.Equal(t, tt.want, *cmds)
+		})
+	}
+}
+
+func TestMacDnatRule(t *testing.T) {
+	o, cmds := newTestOvsctl()
+	require.NoError(t, o.AddMacDnatRule("azure0", "1", net.ParseIP("fd00::4"), "12:34:56:78:9a:bc", 0, "3"))
+	o.DeleteMacDnatRule("azure0", "1", net.ParseIP("fd00::4"), 0)
+	assert.Equal(t, []string{
+		"ovs-ofctl add-flow azure0 ipv6,ipv6_dst=fd00::4,in_port=1,actions=mod_dl_dst:12:34:56:78:9a:bc,strip_vlan,3",
+		"ovs-ofctl del-flows azure0 ipv6,ipv6_dst=fd00::4,in_port=1",
+	}, *cmds)
+}
@@ -26,6 +26,8 @@ const (
 	CNILockPath = "/var/run/azure-vnet/"
 	// CNIStateFilePath is the path to the CNI state file
 	CNIStateFilePath = "/var/run/azure-vnet.json"
+	// CNIBoltStateFilePath is the path to the CNI state database, used instead of the state file when it exists
+	CNIBoltStateFilePath = "/var/run/azure-vnet.db"
 	// CNIIpamStatePath is the name of IPAM state file
 	CNIIpamStatePath = "/var/run/azure-vnet-ipam.json"
 	// CNIBinaryPath is the path to the CNI binary
@@ -39,6 +39,9 @@ const (
 	// CNIStateFilePath is the path to the CNI state file
 	CNIStateFilePath = "C:\\k\\azure-vnet.json"
 
+	// CNIBoltStateFilePath is the path to the CNI state database, used instead of the state file when it exists
+	CNIBoltStateFilePath = "C:\\k\\azure-vnet.db"
+
 	// CNIIpamStatePath is the name of IPAM state file
 	CNIIpamStatePath = "C:\\k\\azure-vnet-ipam.json"
 
@@ -168,16 +171,16 @@ func SetOutboundSNAT(subnet string) error {
 	return nil
 }
 
-// ClearNetworkConfiguration clears the azure-vnet.json contents.
+// ClearNetworkConfiguration clears the azure-vnet.json contents, or those of azure-vnet.bin in the binary format.
 // This will be called only when reboot is detected - This is windows specific
 func (p *execClient) ClearNetworkConfiguration() (bool, error) {
-	jsonStore := CNIRuntimePath + "azure-vnet.json"
-	p.logger.Info("Deleting the json", zap.String("store", jsonStore))
-	cmd := exec.Command("cmd", "/c", "del", jsonStore)
-
-	if err := cmd.Run(); err != nil {
-		p.logger.Info("Error deleting the json", zap.String("store", jsonStore))
-		return true, err
+	for _, stateFile := range []string{"azure-vnet.json", "azure-vnet.bin"} {
+		jsonStore := CNIRuntimePath + stateFile
+		p.logger.Info("Deleting the json", zap.String("store", jsonStore))
+		if err := os.Remove(jsonStore); err != nil && !os.IsNotExist(err) {
+			p.logger.Info("Error deleting the json", zap.String("store", jsonStore))
+			return true, err
+		}
 	}
 
 	return true, nil
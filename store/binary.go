@@ -0,0 +1,181 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format is the encoding of a file store on disk.
+type Format string
+
+const (
+	// FormatJSON is an indented JSON object of the keys, readable by older versions and by hand.
+	FormatJSON Format = "json"
+	// FormatBinary is a length-prefixed list of the keys with their values encoded by encoding/gob, which are written
+	// and read without the reflection and scanning of JSON. It is kept in a file of its own next to the JSON file, so
+	// that a version without it never reads it as JSON.
+	FormatBinary Format = "binary"
+)
+
+// binaryExtension replaces the extension of the file name of the store for the file in the binary format.
+const binaryExtension = ".bin"
+
+// binaryMagic starts the files in the binary format. Its leading NUL can't start a JSON document, so the format of a
+// file is told apart by its first bytes.
+var binaryMagic = []byte{0, 'A', 'C', 'N', 'S', 'T', 'A', 'T'}
+
+const binaryVersion = 1
+
+// The encodings of the values in the binary format. A value is kept in the encoding it was written in until it is
+// written again, so a file converted to the binary format still holds the JSON of the keys which weren't written since.
+const (
+	encodingJSON byte = iota
+	encodingGob
+)
+
+var (
+	ErrUnknownFormat  = errors.New("unknown store format")
+	errCorruptBinary  = errors.New("corrupt binary store")
+	errBinaryChecksum = errors.New("binary store checksum mismatch")
+)
+
+// FormatStore is a KeyValueStore whose file format can be changed. Reads accept either format, so switching the format
+// converts the store on the next write, in both directions.
+type FormatStore interface {
+	KeyValueStore
+	SetFormat(format Format) error
+	// Format returns the format values are written in.
+	Format() Format
+	// KeyFormat returns the format the value of the key was last written in. A value written in the binary format is
+	// decoded by encoding/gob, which matches the fields by name and ignores the JSON tags, so it can't be read as a
+	// json.RawMessage.
+	KeyFormat(key string) (Format, error)
+}
+
+// storedValue is the encoded value of a key.
+type storedValue struct {
+	raw      []byte
+	encoding byte
+}
+
+// binaryFileName returns the name of the file in the binary format of the store in fileName.
+func binaryFileName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + binaryExtension
+}
+
+// isBinary returns whether b is in the binary format.
+func isBinary(b []byte) bool {
+	return bytes.HasPrefix(b, binaryMagic)
+}
+
+// encodeGob encodes a value for the binary format.
+func encodeGob(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, errors.Wrap(err, "failed to encode value")
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeGob decodes a value encoded by encodeGob.
+func decodeGob(raw []byte, value interface{}) error {
+	return errors.Wrap(gob.NewDecoder(bytes.NewReader(raw)).Decode(value), "failed to decode value")
+}
+
+// encodeBinary encodes the keys as the magic, the version and the number of keys, followed by the length-prefixed key,
+// the encoding and the length-prefixed value of each key, and the CRC32 of all of the above, which catches a truncated
+// or torn file.
+func encodeBinary(data map[string]storedValue) []byte {
+	size := len(binaryMagic) + 1 + binary.MaxVarintLen64 + crc32.Size
+	for k, v := range data {
+		size += 2*binary.MaxVarintLen64 + 1 + len(k) + len(v.raw)
+	}
+
+	buf := make([]byte, 0, size)
+	buf = append(buf, binaryMagic...)
+	buf = append(buf, binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	for k, v := range data {
+		buf = binary.AppendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = append(buf, v.encoding)
+		buf = binary.AppendUvarint(buf, uint64(len(v.raw)))
+		buf = append(buf, v.raw...)
+	}
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeBinary decodes the keys of a file in the binary format. The values share the memory of b.
+func decodeBinary(b []byte) (map[string]storedValue, error) {
+	if len(b) < len(binaryMagic)+1+crc32.Size {
+		return nil, errors.Wrap(errCorruptBinary, "file too short")
+	}
+	body, sum := b[:len(b)-crc32.Size], binary.BigEndian.Uint32(b[len(b)-crc32.Size:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, errBinaryChecksum
+	}
+	if version := body[len(binaryMagic)]; version != binaryVersion {
+		return nil, errors.Wrapf(errCorruptBinary, "unsupported version %d", version)
+	}
+
+	r := body[len(binaryMagic)+1:]
+	count, err := readUvarint(&r)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]storedValue, min(count, uint64(len(r))))
+	for i := uint64(0); i < count; i++ {
+		k, err := readBytes(&r)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) == 0 {
+			return nil, errors.Wrap(errCorruptBinary, "missing encoding")
+		}
+		encoding := r[0]
+		if encoding != encodingJSON && encoding != encodingGob {
+			return nil, errors.Wrapf(errCorruptBinary, "unknown encoding %d", encoding)
+		}
+		r = r[1:]
+		v, err := readBytes(&r)
+		if err != nil {
+			return nil, err
+		}
+		data[string(k)] = storedValue{raw: v, encoding: encoding}
+	}
+	if len(r) != 0 {
+		return nil, errors.Wrapf(errCorruptBinary, "%d trailing bytes", len(r))
+	}
+	return data, nil
+}
+
+func readUvarint(r *[]byte) (uint64, error) {
+	v, n := binary.Uvarint(*r)
+	if n <= 0 {
+		return 0, errors.Wrap(errCorruptBinary, "invalid length")
+	}
+	*r = (*r)[n:]
+	return v, nil
+}
+
+func readBytes(r *[]byte) ([]byte, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(*r)) {
+		return nil, errors.Wrap(errCorruptBinary, "length past the end of the file")
+	}
+	v := (*r)[:n:n]
+	*r = (*r)[n:]
+	return v, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileStore(t testing.TB, fileName string) FormatStore {
+	t.Helper()
+	kvs, err := NewJsonFileStore(fileName, processlock.NewMockFileLock(false), nil)
+	require.NoError(t, err)
+	return kvs.(FormatStore)
+}
+
+func TestFileStoreConvertsFormats(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.json")
+	kvs := newTestFileStore(t, fileName)
+	require.NoError(t, kvs.Write(testKey1, &testType1{"test", 42}))
+
+	// the json file is read and replaced by a file in the binary format, which holds the values written since as gob
+	kvs = newTestFileStore(t, fileName)
+	require.NoError(t, kvs.SetFormat(FormatBinary))
+	var value testType1
+	require.NoError(t, kvs.Read(testKey1, &value))
+	require.NoError(t, kvs.Write(testKey2, &testType1{"test2", 43}))
+	require.NoFileExists(t, fileName)
+	b, err := os.ReadFile(binaryFileName(fileName))
+	require.NoError(t, err)
+	require.True(t, isBinary(b))
+
+	kvs = newTestFileStore(t, fileName)
+	format, err := kvs.KeyFormat(testKey1)
+	require.NoError(t, err)
+	require.Equal(t, FormatJSON, format)
+	format, err = kvs.KeyFormat(testKey2)
+	require.NoError(t, err)
+	require.Equal(t, FormatBinary, format)
+
+	// the binary file is kept until the values written in it are written again
+	require.NoError(t, kvs.Flush())
+	require.FileExists(t, binaryFileName(fileName))
+	require.NoError(t, kvs.Read(testKey2, &value))
+	require.Equal(t, testType1{"test2", 43}, value)
+	require.NoError(t, kvs.Write(testKey2, &value))
+
+	// and back
+	require.NoFileExists(t, binaryFileName(fileName))
+	b, err = os.ReadFile(fileName)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"key1":{"Field1":"test","Field2":42},"key2":{"Field1":"test2","Field2":43}}`, string(b))
+
+	require.ErrorIs(t, kvs.SetFormat("protobuf"), ErrUnknownFormat)
+}
+
+func TestFileStoreReadsNewerFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.json")
+	kvs := newTestFileStore(t, fileName)
+	require.NoError(t, kvs.SetFormat(FormatBinary))
+	require.NoError(t, kvs.Write(testKey1, &testType1{"binary", 1}))
+
+	// a crash between writing the json file and removing the binary file leaves both
+	require.NoError(t, os.WriteFile(fileName, []byte(`{"key1":{"Field1":"json","Field2":2}}`), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(fileName, later, later))
+
+	kvs = newTestFileStore(t, fileName)
+	var value testType1
+	require.NoError(t, kvs.Read(testKey1, &value))
+	require.Equal(t, testType1{"json", 2}, value)
+}
+
+func TestDecodeBinaryRejectsCorruptFiles(t *testing.T) {
+	raw, err := encodeGob(&testType1{"test", 42})
+	require.NoError(t, err)
+	data := map[string]storedValue{
+		testKey1: {raw: raw, encoding: encodingGob},
+		testKey2: {raw: []byte(`{"Field1":"test","Field2":42}`), encoding: encodingJSON},
+	}
+	b := encodeBinary(data)
+
+	decoded, err := decodeBinary(b)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+
+	_, err = decodeBinary(b[:len(b)-1])
+	require.ErrorIs(t, err, errBinaryChecksum)
+
+	torn := append([]byte{}, b...)
+	torn[len(binaryMagic)+4] ^= 0xff
+	_, err = decodeBinary(torn)
+	require.ErrorIs(t, err, errBinaryChecksum)
+
+	_, err = decodeBinary(binaryMagic)
+	require.ErrorIs(t, err, errCorruptBinary)
+}
+
+type benchmarkEndpoint struct {
+	ID                  string
+	IfName              string
+	ContainerID         string
+	NetworkNameSpace    string
+	IPAddresses         []net.IPNet
+	Routes              []benchmarkRoute
+	PODName             string
+	PODNameSpace        string
+	MacAddress          net.HardwareAddr
+	SecondaryInterfaces map[string]string
+}
+
+type benchmarkRoute struct {
+	Dst net.IPNet
+	Gw  net.IP
+}
+
+type benchmarkNode struct {
+	Endpoints map[string]*benchmarkEndpoint
+}
+
+// benchmarkState returns a state the size of a node with the given number of endpoints.
+func benchmarkState(endpoints int) *benchmarkNode {
+	_, dst, _ := net.ParseCIDR("0.0.0.0/0")
+	state := &benchmarkNode{Endpoints: make(map[string]*benchmarkEndpoint, endpoints)}
+	for i := 0; i < endpoints; i++ {
+		id := fmt.Sprintf("%08x-eth0", i)
+		state.Endpoints[id] = &benchmarkEndpoint{
+			ID:               id,
+			IfName:           "azv" + id[:8],
+			ContainerID:      fmt.Sprintf("%064x", i),
+			NetworkNameSpace: fmt.Sprintf("/var/run/netns/cni-%08x-0000-0000-0000-000000000000", i),
+			IPAddresses:      []net.IPNet{{IP: net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)), Mask: net.CIDRMask(8, 32)}},
+			Routes:           []benchmarkRoute{{Dst: *dst, Gw: net.IPv4(10, 0, 0, 1)}},
+			PODName:          fmt.Sprintf("pod-%d", i),
+			PODNameSpace:     "default",
+			MacAddress:       net.HardwareAddr{0, 0, 0, 0, 0, byte(i)},
+		}
+	}
+	return state
+}
+
+// BenchmarkFileStore measures an invocation of the cni on a node's state, which reads and writes the state once.
+func BenchmarkFileStore(b *testing.B) {
+	for _, endpoints := range []int{30, 250} {
+		state := benchmarkState(endpoints)
+		for _, format := range []Format{FormatJSON, FormatBinary} {
+			b.Run(fmt.Sprintf("%s/%d", format, endpoints), func(b *testing.B) {
+				fileName := filepath.Join(b.TempDir(), "state.json")
+				kvs := newTestFileStore(b, fileName)
+				require.NoError(b, kvs.SetFormat(format))
+				require.NoError(b, kvs.Write("Network", state))
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					kvs := newTestFileStore(b, fileName)
+					if err := kvs.SetFormat(format); err != nil {
+						b.Fatal(err)
+					}
+					var node benchmarkNode
+					if err := kvs.Read("Network", &node); err != nil {
+						b.Fatal(err)
+					}
+					if err := kvs.Write("Network", &node); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
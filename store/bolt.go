@@ -0,0 +1,303 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var (
+	// valuesBucket holds the value of each key.
+	valuesBucket = []byte("values")
+	// entriesBucket holds a nested bucket of entries for each key written with WriteEntries.
+	entriesBucket = []byte("entries")
+)
+
+// EntryStore is a KeyValueStore which can also hold part of the value of a key as separate entries, so that a change
+// to one entry is written without rewriting the others.
+type EntryStore interface {
+	KeyValueStore
+	// ReadEntries returns the entries of the given key.
+	ReadEntries(key string) (map[string]json.RawMessage, error)
+	// WriteEntries saves the value and the given entries of the key and removes the deleted entries in one
+	// transaction. Entries of the key which are neither written nor deleted are left as they are.
+	WriteEntries(key string, value interface{}, entries map[string]json.RawMessage, deleted []string) error
+}
+
+// boltStore is an implementation of KeyValueStore using a local bbolt database. Each write is a single transaction,
+// so a crash mid-write leaves the previous value in place rather than a truncated file.
+type boltStore struct {
+	fileName    string
+	db          *bolt.DB
+	processLock processlock.Interface
+	sync.Mutex
+	logger *zap.Logger
+}
+
+// NewBoltStore creates a new boltStore object, accessed as a KeyValueStore.
+func NewBoltStore(fileName string, lockclient processlock.Interface, logger *zap.Logger) (EntryStore, error) {
+	if fileName == "" {
+		return &boltStore{}, errors.New("need to pass in a bolt db file path")
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &boltStore{
+		fileName:    fileName,
+		processLock: lockclient,
+		logger:      logger,
+	}, nil
+}
+
+func (kvs *boltStore) Exists() bool {
+	if _, err := os.Stat(kvs.fileName); err != nil {
+		return false
+	}
+	return true
+}
+
+// Read restores the value for the given key from persistent store.
+func (kvs *boltStore) Read(key string, value interface{}) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	var raw []byte
+	err := kvs.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(valuesBucket)
+		if b == nil {
+			return ErrKeyNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrKeyNotFound
+		}
+		// v is only valid for the life of the transaction.
+		raw = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, value)
+}
+
+// ReadEntries returns the entries of the given key.
+func (kvs *boltStore) ReadEntries(key string) (map[string]json.RawMessage, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	entries := make(map[string]json.RawMessage)
+	err := kvs.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(entriesBucket)
+		if b == nil {
+			return nil
+		}
+		kb := b.Bucket([]byte(key))
+		if kb == nil {
+			return nil
+		}
+		return kb.ForEach(func(k, v []byte) error {
+			entries[string(k)] = append(json.RawMessage{}, v...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Write saves the given key value pair to persistent store.
+func (kvs *boltStore) Write(key string, value interface{}) error {
+	return kvs.WriteEntries(key, value, nil, nil)
+}
+
+// WriteEntries saves the value and the given entries of the key and removes the deleted entries in one transaction.
+func (kvs *boltStore) WriteEntries(key string, value interface{}, entries map[string]json.RawMessage, deleted []string) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return kvs.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(valuesBucket)
+		if err != nil {
+			return errors.Wrap(err, "failed to create values bucket")
+		}
+		if err := b.Put([]byte(key), raw); err != nil {
+			return errors.Wrapf(err, "failed to write key %s", key)
+		}
+
+		if len(entries) == 0 && len(deleted) == 0 {
+			return nil
+		}
+
+		eb, err := tx.CreateBucketIfNotExists(entriesBucket)
+		if err != nil {
+			return errors.Wrap(err, "failed to create entries bucket")
+		}
+		kb, err := eb.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return errors.Wrapf(err, "failed to create entries bucket for key %s", key)
+		}
+		for k, v := range entries {
+			if err := kb.Put([]byte(k), v); err != nil {
+				return errors.Wrapf(err, "failed to write entry %s of key %s", k, key)
+			}
+		}
+		for _, k := range deleted {
+			if err := kb.Delete([]byte(k)); err != nil {
+				return errors.Wrapf(err, "failed to delete entry %s of key %s", k, key)
+			}
+		}
+		return nil
+	})
+}
+
+// Flush commits in-memory state to persistent store. Every write is committed by its own transaction, so there is
+// nothing to flush.
+func (kvs *boltStore) Flush() error {
+	return nil
+}
+
+func (kvs *boltStore) lockUtil(status chan error) {
+	err := kvs.processLock.Lock()
+	status <- err
+}
+
+// Lock locks the store for exclusive access and keeps the database open until Unlock.
+func (kvs *boltStore) Lock(timeout time.Duration) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	afterTime := time.After(timeout)
+	status := make(chan error)
+
+	kvs.logger.Info("Acquiring process lock")
+
+	go kvs.lockUtil(status)
+
+	var err error
+	select {
+	case <-afterTime:
+		return ErrTimeoutLockingStore
+	case err = <-status:
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "processLock acquire error")
+	}
+
+	kvs.logger.Info("Acquired process lock with timeout value of", zap.Any("timeout", timeout))
+
+	db, err := bolt.Open(kvs.fileName, 0o600, &bolt.Options{Timeout: timeout}) //nolint:gomnd // state file permissions
+	if err != nil {
+		if unlockErr := kvs.processLock.Unlock(); unlockErr != nil {
+			kvs.logger.Error("Failed to release process lock", zap.Error(unlockErr))
+		}
+		return errors.Wrapf(err, "failed to open bolt db %s", kvs.fileName)
+	}
+	kvs.db = db
+
+	return nil
+}
+
+// Unlock closes the database and unlocks the store.
+func (kvs *boltStore) Unlock() error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if kvs.db != nil {
+		if err := kvs.db.Close(); err != nil {
+			kvs.logger.Error("Failed to close bolt db", zap.String("fileName", kvs.fileName), zap.Error(err))
+		}
+		kvs.db = nil
+	}
+
+	err := kvs.processLock.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "unlock error")
+	}
+
+	kvs.logger.Info("Released process lock")
+
+	return nil
+}
+
+// GetModificationTime returns the modification time of the persistent store.
+func (kvs *boltStore) GetModificationTime() (time.Time, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	info, err := os.Stat(kvs.fileName)
+	if err != nil {
+		kvs.logger.Info("os.stat() for file", zap.String("fileName", kvs.fileName), zap.Error(err))
+		return time.Time{}.UTC(), err
+	}
+
+	return info.ModTime().UTC(), nil
+}
+
+// Remove closes the database, if the store is locked, and removes its file. The store stays locked.
+func (kvs *boltStore) Remove() {
+	kvs.Mutex.Lock()
+	if kvs.db != nil {
+		if err := kvs.db.Close(); err != nil {
+			kvs.logger.Error("Failed to close bolt db", zap.String("fileName", kvs.fileName), zap.Error(err))
+		}
+		kvs.db = nil
+	}
+	if err := os.Remove(kvs.fileName); err != nil {
+		kvs.logger.Error("could not remove file", zap.String("fileName", kvs.fileName), zap.Error(err))
+	}
+	kvs.Mutex.Unlock()
+}
+
+// view runs fn in a read transaction, opening the database for its duration if the store isn't locked.
+func (kvs *boltStore) view(fn func(*bolt.Tx) error) error {
+	if kvs.db != nil {
+		return kvs.db.View(fn) //nolint:wrapcheck // errors are wrapped by fn
+	}
+
+	if !kvs.Exists() {
+		return ErrKeyNotFound
+	}
+
+	db, err := bolt.Open(kvs.fileName, 0o600, &bolt.Options{Timeout: DefaultLockTimeout, ReadOnly: true}) //nolint:gomnd // state file permissions
+	if err != nil {
+		return errors.Wrapf(err, "failed to open bolt db %s", kvs.fileName)
+	}
+	defer db.Close()
+
+	return db.View(fn) //nolint:wrapcheck // errors are wrapped by fn
+}
+
+// update runs fn in a write transaction, opening the database for its duration if the store isn't locked.
+func (kvs *boltStore) update(fn func(*bolt.Tx) error) error {
+	if kvs.db != nil {
+		return kvs.db.Update(fn) //nolint:wrapcheck // errors are wrapped by fn
+	}
+
+	db, err := bolt.Open(kvs.fileName, 0o600, &bolt.Options{Timeout: DefaultLockTimeout}) //nolint:gomnd // state file permissions
+	if err != nil {
+		return errors.Wrapf(err, "failed to open bolt db %s", kvs.fileName)
+	}
+	defer db.Close()
+
+	return db.Update(fn) //nolint:wrapcheck // errors are wrapped by fn
+}
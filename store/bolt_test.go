@@ -0,0 +1,99 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/processlock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBoltStore(t *testing.T) (EntryStore, string) {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "test.db")
+	kvs, err := NewBoltStore(fileName, processlock.NewMockFileLock(false), nil)
+	require.NoError(t, err)
+	return kvs, fileName
+}
+
+func TestBoltStoreReadWrite(t *testing.T) {
+	kvs, _ := newTestBoltStore(t)
+
+	var value testType1
+	require.ErrorIs(t, kvs.Read(testKey1, &value), ErrKeyNotFound)
+	require.False(t, kvs.Exists())
+
+	// Writes outside Lock open the database for the write only.
+	require.NoError(t, kvs.Write(testKey1, &testType1{"test", 42}))
+	require.True(t, kvs.Exists())
+
+	require.NoError(t, kvs.Lock(DefaultLockTimeout))
+	require.NoError(t, kvs.Write(testKey2, &testType1{"test2", 43}))
+	require.NoError(t, kvs.Read(testKey1, &value))
+	require.Equal(t, testType1{"test", 42}, value)
+	require.NoError(t, kvs.Unlock())
+
+	require.NoError(t, kvs.Read(testKey2, &value))
+	require.Equal(t, testType1{"test2", 43}, value)
+}
+
+func TestBoltStoreEntries(t *testing.T) {
+	kvs, fileName := newTestBoltStore(t)
+
+	require.NoError(t, kvs.Lock(DefaultLockTimeout))
+	err := kvs.WriteEntries(testKey1, &testType1{"base", 1}, map[string]json.RawMessage{
+		"a": json.RawMessage(`{"Field1":"a"}`),
+		"b": json.RawMessage(`{"Field1":"b"}`),
+	}, nil)
+	require.NoError(t, err)
+
+	// Only the written entry changes and the deleted entry is removed; the rest are kept.
+	err = kvs.WriteEntries(testKey1, &testType1{"base", 2}, map[string]json.RawMessage{
+		"c": json.RawMessage(`{"Field1":"c"}`),
+	}, []string{"a"})
+	require.NoError(t, err)
+	require.NoError(t, kvs.Unlock())
+
+	// A new store on the same file sees the committed entries.
+	kvs, err = NewBoltStore(fileName, processlock.NewMockFileLock(false), nil)
+	require.NoError(t, err)
+
+	entries, err := kvs.ReadEntries(testKey1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]json.RawMessage{
+		"b": json.RawMessage(`{"Field1":"b"}`),
+		"c": json.RawMessage(`{"Field1":"c"}`),
+	}, entries)
+
+	var value testType1
+	require.NoError(t, kvs.Read(testKey1, &value))
+	require.Equal(t, testType1{"base", 2}, value)
+
+	entries, err = kvs.ReadEntries(testKey2)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestBoltStoreRemove(t *testing.T) {
+	kvs, fileName := newTestBoltStore(t)
+	require.NoError(t, kvs.Lock(DefaultLockTimeout))
+	require.NoError(t, kvs.Write(testKey1, &testType1{"test", 42}))
+
+	// the database is closed before its file is removed, which windows requires
+	kvs.Remove()
+	require.NoFileExists(t, fileName)
+	require.NoError(t, kvs.Unlock())
+}
+
+func TestBoltStoreLockFailure(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.db")
+	kvs, err := NewBoltStore(fileName, processlock.NewMockFileLock(true), nil)
+	require.NoError(t, err)
+
+	require.Error(t, kvs.Lock(DefaultLockTimeout))
+	require.False(t, kvs.Exists())
+}
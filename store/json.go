@@ -29,12 +29,14 @@ const (
 	DefaultLockTimeoutWindows = 60000 * time.Millisecond
 )
 
-// jsonFileStore is an implementation of KeyValueStore using a local JSON file.
+// jsonFileStore is an implementation of KeyValueStore using a local JSON file, or a file in the binary format.
 type jsonFileStore struct {
-	fileName    string
-	data        map[string]*json.RawMessage
-	inSync      bool
-	processLock processlock.Interface
+	fileName       string
+	binaryFileName string
+	format         Format
+	data           map[string]storedValue
+	inSync         bool
+	processLock    processlock.Interface
 	sync.Mutex
 	logger *zap.Logger
 }
@@ -47,22 +49,37 @@ func NewJsonFileStore(fileName string, lockclient processlock.Interface, logger
 		return &jsonFileStore{}, errors.New("need to pass in a json file path")
 	}
 	kvs := &jsonFileStore{
-		fileName:    fileName,
-		processLock: lockclient,
-		data:        make(map[string]*json.RawMessage),
-		logger:      logger,
+		fileName:       fileName,
+		binaryFileName: binaryFileName(fileName),
+		format:         FormatJSON,
+		processLock:    lockclient,
+		data:           make(map[string]storedValue),
+		logger:         logger,
 	}
 
 	return kvs, nil
 }
 
 func (kvs *jsonFileStore) Exists() bool {
-	if _, err := os.Stat(kvs.fileName); err != nil {
+	if _, err := os.Stat(kvs.currentFileName()); err != nil {
 		return false
 	}
 	return true
 }
 
+// currentFileName returns the file the store was last written to, the newer of the JSON and the binary file. A write
+// removes the other file once it's done, so both only exist after a crash in between.
+func (kvs *jsonFileStore) currentFileName() string {
+	binaryInfo, err := os.Stat(kvs.binaryFileName)
+	if err != nil {
+		return kvs.fileName
+	}
+	if jsonInfo, err := os.Stat(kvs.fileName); err == nil && jsonInfo.ModTime().After(binaryInfo.ModTime()) {
+		return kvs.fileName
+	}
+	return kvs.binaryFileName
+}
+
 // Read restores the value for the given key from persistent store.
 func (kvs *jsonFileStore) Read(key string, value interface{}) error {
 	kvs.Mutex.Lock()
@@ -70,45 +87,70 @@ func (kvs *jsonFileStore) Read(key string, value interface{}) error {
 
 	// Read contents from file if memory is not in sync.
 	if !kvs.inSync {
-		// Open and parse the file if it exists.
-		file, err := os.Open(kvs.fileName)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return ErrKeyNotFound
-			}
+		if err := kvs.load(); err != nil {
 			return err
 		}
-		defer file.Close()
+	}
 
-		b, err := io.ReadAll(file)
-		if err != nil {
-			return err
-		}
+	v, ok := kvs.data[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
 
-		if len(b) == 0 {
-			if kvs.logger != nil {
-				kvs.logger.Info("Unable to read empty file", zap.String("fileName", kvs.fileName))
-			} else {
-				log.Printf("Unable to read file %s, was empty", kvs.fileName)
-			}
+	if v.encoding == encodingGob {
+		return decodeGob(v.raw, value)
+	}
+	return json.Unmarshal(v.raw, value)
+}
 
-			return ErrStoreEmpty
+// load reads the keys from the file the store was last written to.
+func (kvs *jsonFileStore) load() error {
+	fileName := kvs.currentFileName()
+
+	// Open and parse the file if it exists.
+	file, err := os.Open(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrKeyNotFound
 		}
+		return err
+	}
+	defer file.Close()
 
-		// Decode to raw JSON messages.
-		if err := json.Unmarshal(b, &kvs.data); err != nil {
-			return err
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if len(b) == 0 {
+		if kvs.logger != nil {
+			kvs.logger.Info("Unable to read empty file", zap.String("fileName", fileName))
+		} else {
+			log.Printf("Unable to read file %s, was empty", fileName)
 		}
 
-		kvs.inSync = true
+		return ErrStoreEmpty
 	}
 
-	raw, ok := kvs.data[key]
-	if !ok {
-		return ErrKeyNotFound
+	if isBinary(b) {
+		data, err := decodeBinary(b)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode %s", fileName)
+		}
+		kvs.data = data
+	} else {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(b, &values); err != nil {
+			return err
+		}
+		kvs.data = make(map[string]storedValue, len(values))
+		for k, v := range values {
+			kvs.data[k] = storedValue{raw: v, encoding: encodingJSON}
+		}
 	}
 
-	return json.Unmarshal(*raw, value)
+	kvs.inSync = true
+	return nil
 }
 
 // Write saves the given key value pair to persistent store.
@@ -116,13 +158,19 @@ func (kvs *jsonFileStore) Write(key string, value interface{}) error {
 	kvs.Mutex.Lock()
 	defer kvs.Mutex.Unlock()
 
-	var raw json.RawMessage
-	raw, err := json.Marshal(value)
+	v := storedValue{encoding: encodingJSON}
+	var err error
+	if kvs.format == FormatBinary {
+		v.encoding = encodingGob
+		v.raw, err = encodeGob(value)
+	} else {
+		v.raw, err = json.Marshal(value)
+	}
 	if err != nil {
 		return err
 	}
 
-	kvs.data[key] = &raw
+	kvs.data[key] = v
 
 	return kvs.flush()
 }
@@ -135,14 +183,88 @@ func (kvs *jsonFileStore) Flush() error {
 	return kvs.flush()
 }
 
+// SetFormat sets the format the file is written in from the next write on.
+func (kvs *jsonFileStore) SetFormat(format Format) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	switch format {
+	case FormatJSON, FormatBinary:
+		kvs.format = format
+		return nil
+	case "":
+		kvs.format = FormatJSON
+		return nil
+	}
+	return errors.Wrapf(ErrUnknownFormat, "%q", format)
+}
+
+// Format returns the format values are written in.
+func (kvs *jsonFileStore) Format() Format {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	return kvs.format
+}
+
+// KeyFormat returns the format the value of the key was last written in.
+func (kvs *jsonFileStore) KeyFormat(key string) (Format, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if !kvs.inSync {
+		if err := kvs.load(); err != nil {
+			return "", err
+		}
+	}
+
+	v, ok := kvs.data[key]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	if v.encoding == encodingGob {
+		return FormatBinary, nil
+	}
+	return FormatJSON, nil
+}
+
+// hasGobValues returns whether any value is encoded by encoding/gob, which only the binary format can hold.
+func (kvs *jsonFileStore) hasGobValues() bool {
+	for _, v := range kvs.data {
+		if v.encoding == encodingGob {
+			return true
+		}
+	}
+	return false
+}
+
 // Lock-free flush for internal callers.
 func (kvs *jsonFileStore) flush() error {
-	buf, err := json.MarshalIndent(&kvs.data, "", "\t")
-	if err != nil {
-		return err
+	fileName, staleFileName := kvs.fileName, kvs.binaryFileName
+	var buf []byte
+	if kvs.format == FormatBinary || kvs.hasGobValues() {
+		if kvs.format != FormatBinary {
+			// the values written in the binary format can only be converted by writing them again
+			if kvs.logger != nil {
+				kvs.logger.Info("Keeping the binary format until its values are written again", zap.String("fileName", kvs.fileName))
+			} else {
+				log.Printf("Keeping the binary format of %s until its values are written again", kvs.fileName)
+			}
+		}
+		buf = encodeBinary(kvs.data)
+		fileName, staleFileName = kvs.binaryFileName, kvs.fileName
+	} else {
+		values := make(map[string]json.RawMessage, len(kvs.data))
+		for k, v := range kvs.data {
+			values[k] = v.raw
+		}
+		var err error
+		if buf, err = json.MarshalIndent(values, "", "\t"); err != nil {
+			return err
+		}
 	}
 
-	dir, file := filepath.Split(kvs.fileName)
+	dir, file := filepath.Split(fileName)
 	if dir == "" {
 		dir = "."
 	}
@@ -172,10 +294,16 @@ func (kvs *jsonFileStore) flush() error {
 	}
 
 	// atomic replace
-	if err = platform.ReplaceFile(tmpFileName, kvs.fileName); err != nil {
+	if err = platform.ReplaceFile(tmpFileName, fileName); err != nil {
 		return fmt.Errorf("rename temp file to state file failed:%v", err)
 	}
 
+	// remove the file in the other format, so that neither a restart nor a version without the binary format reads
+	// its stale keys
+	if removeErr := os.Remove(staleFileName); removeErr != nil && !os.IsNotExist(removeErr) {
+		return fmt.Errorf("remove stale state file failed: %v", removeErr)
+	}
+
 	return nil
 }
 
@@ -244,12 +372,13 @@ func (kvs *jsonFileStore) GetModificationTime() (time.Time, error) {
 	kvs.Mutex.Lock()
 	defer kvs.Mutex.Unlock()
 
-	info, err := os.Stat(kvs.fileName)
+	fileName := kvs.currentFileName()
+	info, err := os.Stat(fileName)
 	if err != nil {
 		if kvs.logger != nil {
-			kvs.logger.Info("os.stat() for file", zap.String("fileName", kvs.fileName), zap.Error(err))
+			kvs.logger.Info("os.stat() for file", zap.String("fileName", fileName), zap.Error(err))
 		} else {
-			log.Printf("os.stat() for file %v failed: %v", kvs.fileName, err)
+			log.Printf("os.stat() for file %v failed: %v", fileName, err)
 		}
 
 		return time.Time{}.UTC(), err
@@ -260,8 +389,10 @@ func (kvs *jsonFileStore) GetModificationTime() (time.Time, error) {
 
 func (kvs *jsonFileStore) Remove() {
 	kvs.Mutex.Lock()
-	if err := os.Remove(kvs.fileName); err != nil {
-		log.Errorf("could not remove file %s. Error: %v", kvs.fileName, err)
+	for _, fileName := range []string{kvs.fileName, kvs.binaryFileName} {
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			log.Errorf("could not remove file %s. Error: %v", fileName, err)
+		}
 	}
 	kvs.Mutex.Unlock()
 }
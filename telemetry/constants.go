@@ -9,6 +9,7 @@ const (
 	CNIDelTimeMetricStr    = "CNIDelTimeMs"
 	CNIUpdateTimeMetricStr = "CNIUpdateTimeMs"
 	CNILockTimeoutStr      = "CNILockTimeoutError"
+	CNIIPAllocationTimeStr = "CNIIPAllocationTimeMs"
 
 	// Dimension Names
 	ContextStr        = "Context"
@@ -21,9 +22,20 @@ const (
 	CNINetworkModeStr = "CNINetworkMode"
 	OSTypeStr         = "OSType"
 
+	// IP allocation dimension names, see IPAllocationRecord
+	AddTimeMsStr            = "AddTimeMs"
+	WaitForIPMsStr          = "WaitForIPMs"
+	CNSRequestsStr          = "CNSRequests"
+	PoolScalingStr          = "PoolScaling"
+	WaitForPoolScalingMsStr = "WaitForPoolScalingMs"
+	ErrorCodeStr            = "ErrorCode"
+	RetryableStr            = "Retryable"
+
 	// Values
 	SucceededStr     = "Succeeded"
 	FailedStr        = "Failed"
 	SingleTenancyStr = "SingleTenancy"
 	MultiTenancyStr  = "MultiTenancy"
+	IPAMErrorStr     = "IPAMError"
+	DatapathErrorStr = "DatapathError"
 )
@@ -0,0 +1,241 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxSpoolSize bounds the size of the spool in bytes, the reports are dropped once it is full.
+	MaxSpoolSize = 4 * 1024 * 1024
+	// SpoolBatchSize is the number of spooled reports uploaded at once.
+	SpoolBatchSize = 100
+
+	spoolMinInterval = 5 * time.Second
+	spoolMaxInterval = 5 * time.Minute
+	pendingSuffix    = ".pending"
+)
+
+var (
+	ErrSpoolFull      = errors.New("telemetry spool is full")
+	errNotUploadable  = errors.New("ai telemetry handle is not initialized")
+	errInvalidReport  = errors.New("invalid telemetry report")
+	errReportTooLarge = errors.New("telemetry report is larger than the max payload size")
+)
+
+// Spool is a bounded queue of reports on disk. The plugin appends the reports it can't write to the telemetry service,
+// and the service uploads them once it is up, so that the reports survive restarts of the service and of the node.
+//
+// The plugins only append to the spool file, which the service renames to the pending file before it reads it, so
+// that the service is the only writer of the pending file.
+type Spool struct {
+	path    string
+	maxSize int64
+	mutex   sync.Mutex
+}
+
+// NewSpool returns the spool of the file at path, which holds at most maxSize bytes of reports.
+func NewSpool(path string, maxSize int64) *Spool {
+	return &Spool{path: path, maxSize: maxSize}
+}
+
+// Append appends the report to the spool, or returns ErrSpoolFull when the spool has no room for it.
+func (s *Spool) Append(report []byte) error {
+	if len(report) >= MaxPayloadSize {
+		return errReportTooLarge
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create spool directory")
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open spool")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "failed to stat spool")
+	}
+	if info.Size()+int64(len(report))+1 > s.maxSize {
+		return ErrSpoolFull
+	}
+
+	// a single write of less than the max payload size, so that the reports of concurrent plugins don't interleave
+	line := make([]byte, 0, len(report)+1)
+	line = append(line, report...)
+	line = append(line, Delimiter)
+	if _, err := f.Write(line); err != nil {
+		return errors.Wrap(err, "failed to append report to spool")
+	}
+	return nil
+}
+
+// Peek returns at most n reports from the head of the spool without removing them.
+func (s *Spool) Peek(n int) ([][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := s.path + pendingSuffix
+	if _, err := os.Stat(pending); os.IsNotExist(err) {
+		if err := os.Rename(s.path, pending); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, errors.Wrap(err, "failed to rename spool")
+		}
+	}
+
+	f, err := os.Open(pending)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open pending spool")
+	}
+	defer f.Close()
+
+	reports := make([][]byte, 0, n)
+	scanner := bufio.NewScanner(f)
+	for len(reports) < n && scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			reports = append(reports, bytes.Clone(line))
+		}
+	}
+	return reports, errors.Wrap(scanner.Err(), "failed to read pending spool")
+}
+
+// Remove removes the n reports at the head of the spool, which were returned by Peek.
+func (s *Spool) Remove(n int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := s.path + pendingSuffix
+	b, err := os.ReadFile(pending)
+	if err != nil {
+		return errors.Wrap(err, "failed to read pending spool")
+	}
+
+	var rest []byte
+	for removed := 0; len(b) > 0; {
+		line, next, _ := bytes.Cut(b, []byte{Delimiter})
+		if removed == n {
+			rest = b
+			break
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			removed++
+		}
+		b = next
+	}
+
+	if len(rest) == 0 {
+		return errors.Wrap(os.Remove(pending), "failed to remove pending spool")
+	}
+	tmp := pending + ".tmp"
+	if err := os.WriteFile(tmp, rest, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write pending spool")
+	}
+	return errors.Wrap(os.Rename(tmp, pending), "failed to replace pending spool")
+}
+
+// spoolReport appends the report to the spool of the buffer, if it has one.
+func (tb *TelemetryBuffer) spoolReport(report []byte) error {
+	if tb.spool == nil {
+		return nil
+	}
+	if err := tb.spool.Append(report); err != nil {
+		return err
+	}
+	if tb.logger != nil {
+		tb.logger.Info("Spooled telemetry report", zap.String("path", tb.spool.path))
+	}
+	return nil
+}
+
+// UploadSpool uploads the reports of the spool in batches until ctx is done. The interval between the batches doubles
+// while the reports can't be uploaded, up to spoolMaxInterval.
+func (tb *TelemetryBuffer) UploadSpool(ctx context.Context, spool *Spool) {
+	interval := spoolMinInterval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		uploaded, err := uploadBatch(spool)
+		switch {
+		case err != nil:
+			interval = min(2*interval, spoolMaxInterval)
+			if tb.logger != nil {
+				tb.logger.Error("Failed to upload spooled reports", zap.Error(err), zap.Duration("retryIn", interval))
+			}
+		case uploaded == SpoolBatchSize:
+			// there may be more reports spooled, upload them now
+			interval = 0
+		default:
+			interval = spoolMinInterval
+		}
+		timer.Reset(interval)
+	}
+}
+
+// uploadBatch uploads a batch of reports of the spool, and returns the number of reports uploaded.
+func uploadBatch(spool *Spool) (int, error) {
+	reports, err := spool.Peek(SpoolBatchSize)
+	if err != nil || len(reports) == 0 {
+		return 0, err
+	}
+	if th == nil {
+		return 0, errNotUploadable
+	}
+
+	for _, b := range reports {
+		report, err := decodeReport(b)
+		if err != nil {
+			// the report can never be uploaded, drop it with the batch
+			continue
+		}
+		push(report)
+	}
+	th.Flush()
+
+	return len(reports), spool.Remove(len(reports))
+}
+
+// decodeReport decodes the report the plugin wrote to the telemetry service or to the spool.
+func decodeReport(b []byte) (interface{}, error) {
+	var tmp map[string]interface{}
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal report")
+	}
+
+	if _, ok := tmp["CniSucceeded"]; ok {
+		var cniReport CNIReport
+		err := json.Unmarshal(b, &cniReport)
+		return cniReport, errors.Wrap(err, "failed to unmarshal cni report")
+	}
+	if _, ok := tmp["Metric"]; ok {
+		var aiMetric AIMetric
+		err := json.Unmarshal(b, &aiMetric)
+		return aiMetric, errors.Wrap(err, "failed to unmarshal metric")
+	}
+	return nil, errors.Wrapf(errInvalidReport, "%+v", tmp)
+}
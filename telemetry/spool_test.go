@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolAppendPeekRemove(t *testing.T) {
+	spool := NewSpool(filepath.Join(t.TempDir(), "telemetry.spool"), MaxSpoolSize)
+
+	reports, err := spool.Peek(SpoolBatchSize)
+	require.NoError(t, err)
+	require.Empty(t, reports)
+
+	for _, report := range []string{`{"a":1}`, `{"b":2}`, `{"c":3}`} {
+		require.NoError(t, spool.Append([]byte(report)))
+	}
+
+	reports, err = spool.Peek(2)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}, reports)
+
+	// reports appended while a batch is pending are uploaded after it
+	require.NoError(t, spool.Append([]byte(`{"d":4}`)))
+	require.NoError(t, spool.Remove(len(reports)))
+
+	reports, err = spool.Peek(SpoolBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`{"c":3}`)}, reports)
+	require.NoError(t, spool.Remove(len(reports)))
+
+	reports, err = spool.Peek(SpoolBatchSize)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`{"d":4}`)}, reports)
+}
+
+func TestSpoolFull(t *testing.T) {
+	spool := NewSpool(filepath.Join(t.TempDir(), "telemetry.spool"), 12)
+
+	require.NoError(t, spool.Append([]byte(`{"a":1}`)))
+	require.ErrorIs(t, spool.Append([]byte(`{"b":2}`)), ErrSpoolFull)
+	require.ErrorIs(t, spool.Append(make([]byte, MaxPayloadSize)), errReportTooLarge)
+}
+
+func TestDecodeReport(t *testing.T) {
+	report, err := decodeReport([]byte(`{"CniSucceeded":true,"ErrorMessage":"failed"}`))
+	require.NoError(t, err)
+	require.Equal(t, CNIReport{CniSucceeded: true, ErrorMessage: "failed"}, report)
+
+	_, err = decodeReport([]byte(`{"Unknown":1}`))
+	require.ErrorIs(t, err, errInvalidReport)
+
+	_, err = decodeReport([]byte(`not json`))
+	require.Error(t, err)
+}
@@ -135,32 +135,50 @@ func (reportMgr *ReportManager) ReportToBytes() ([]byte, error) {
 	return report, err
 }
 
-// This function for sending CNI metrics to telemetry service
+// This function for sending CNI metrics to telemetry service, the metric is spooled when it can't be written to it
 func SendCNIMetric(cniMetric *AIMetric, tb *TelemetryBuffer) error {
-	var err error
-	var report []byte
-
-	if tb != nil && tb.Connected {
-		reportMgr := &ReportManager{Report: cniMetric}
-		report, err = reportMgr.ReportToBytes()
-		if err == nil {
-			if _, err = tb.Write(report); err != nil {
-				tb.logger.Error("Error writing to telemetry socket", zap.Error(err))
-			}
-		}
+	if tb == nil {
+		return nil
 	}
 
-	return err
+	reportMgr := &ReportManager{Report: cniMetric}
+	report, err := reportMgr.ReportToBytes()
+	if err != nil {
+		return err
+	}
+	return tb.send(report)
 }
 
+// SendCNIEvent sends the cni report to telemetry service, the report is spooled when it can't be written to it
 func SendCNIEvent(tb *TelemetryBuffer, report *CNIReport) {
-	if tb != nil && tb.Connected {
-		reportMgr := &ReportManager{Report: report}
-		reportBytes, err := reportMgr.ReportToBytes()
+	if tb == nil {
+		return
+	}
+
+	reportMgr := &ReportManager{Report: report}
+	reportBytes, err := reportMgr.ReportToBytes()
+	if err == nil {
+		err = tb.send(reportBytes)
+	}
+	if err != nil && tb.logger != nil {
+		tb.logger.Error("Failed to send cni report", zap.Error(err))
+	}
+}
+
+// send writes the report to the telemetry service, or appends it to the spool when the buffer isn't connected to the
+// service or the write fails.
+func (tb *TelemetryBuffer) send(report []byte) error {
+	if tb.Connected {
+		_, err := tb.Write(report)
 		if err == nil {
-			if _, err = tb.Write(reportBytes); err != nil {
-				tb.logger.Error("Error writing to telemetry socket", zap.Error(err))
-			}
+			return nil
+		}
+		if tb.logger != nil {
+			tb.logger.Error("Error writing to telemetry socket", zap.Error(err))
+		}
+		if tb.spool == nil {
+			return err
 		}
 	}
+	return tb.spoolReport(report)
 }
@@ -3,7 +3,9 @@ package telemetry
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/Azure/azure-container-networking/aitelemetry"
 	"go.uber.org/zap"
@@ -46,12 +48,14 @@ func (c *Client) IsConnected() bool {
 
 func (c *Client) ConnectTelemetry(logger *zap.Logger) {
 	c.tb = NewTelemetryBuffer(logger)
+	c.tb.SetSpool(NewSpool(SpoolPath, MaxSpoolSize))
 	c.tb.ConnectToTelemetry()
 	c.logger = logger
 }
 
 func (c *Client) StartAndConnectTelemetry(logger *zap.Logger) {
 	c.tb = NewTelemetryBuffer(logger)
+	c.tb.SetSpool(NewSpool(SpoolPath, MaxSpoolSize))
 	c.tb.ConnectToTelemetryService(telemetryNumberRetries, telemetryWaitTimeInMilliseconds)
 	c.logger = logger
 }
@@ -111,3 +115,40 @@ func (c *Client) SendMetric(name string, value float64, customDims map[string]st
 		c.sendLog("Couldn't send metric: " + err.Error())
 	}
 }
+
+// IPAllocationRecord breaks down the time a CNI ADD spent getting the pod's IPs.
+type IPAllocationRecord struct {
+	// IPAMDuration is the time the ADD spent in IPAM, the rest of AddDuration is spent on the datapath.
+	IPAMDuration time.Duration
+	AddDuration  time.Duration
+	// WaitForIP is the time since the first request for the pod's IPs, across the retries of the ADD.
+	WaitForIP time.Duration
+	// CNSRequests is the number of requests for the pod's IPs CNS received, including the failed ones.
+	CNSRequests int
+	// WaitForPoolScaling is the time the pod waited for the NC to scale up, zero if it didn't.
+	WaitForPoolScaling time.Duration
+	// ErrorCode is the code of the error which failed the ADD: the CNS response code or IPAMErrorStr if the
+	// allocation failed, DatapathErrorStr if the ADD failed after it, unless the CNI error has a code of the plugin,
+	// whose name it is then. Empty if the ADD succeeded.
+	ErrorCode string
+	// Retryable is whether the runtime can retry the failed ADD.
+	Retryable bool
+}
+
+// SendIPAllocationRecord sends the IPAM duration of an ADD as a metric, with the rest of the record as dimensions.
+func (c *Client) SendIPAllocationRecord(record *IPAllocationRecord) {
+	status := SucceededStr
+	if record.ErrorCode != "" {
+		status = FailedStr
+	}
+	c.SendMetric(CNIIPAllocationTimeStr, float64(record.IPAMDuration.Milliseconds()), map[string]string{
+		AddTimeMsStr:            strconv.FormatInt(record.AddDuration.Milliseconds(), 10),
+		WaitForIPMsStr:          strconv.FormatInt(record.WaitForIP.Milliseconds(), 10),
+		CNSRequestsStr:          strconv.Itoa(record.CNSRequests),
+		PoolScalingStr:          strconv.FormatBool(record.WaitForPoolScaling > 0),
+		WaitForPoolScalingMsStr: strconv.FormatInt(record.WaitForPoolScaling.Milliseconds(), 10),
+		ErrorCodeStr:            record.ErrorCode,
+		RetryableStr:            strconv.FormatBool(record.Retryable),
+		StatusStr:               status,
+	})
+}
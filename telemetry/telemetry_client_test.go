@@ -51,6 +51,7 @@ func TestClient(t *testing.T) {
 
 	// test sending aimetrics doesn't panic...
 	require.NotPanics(t, func() { emptyClient.SendMetric("", 0, nil) })
+	require.NotPanics(t, func() { emptyClient.SendIPAllocationRecord(&IPAllocationRecord{ErrorCode: "FailedToAllocateIPConfig"}) })
 	// ...and doesn't affect the cni report
 	require.Regexp(t, allowedEventMsg, emptyClient.Settings().EventMessage)
 	require.Equal(t, "", emptyClient.Settings().ErrorMessage)
@@ -17,6 +17,7 @@ import (
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -58,6 +59,7 @@ type TelemetryBuffer struct {
 	mutex       sync.Mutex
 	logger      *zap.Logger
 	plc         platform.ExecClient
+	spool       *Spool
 }
 
 // Buffer object holds the different types of reports
@@ -144,37 +146,24 @@ func (tb *TelemetryBuffer) StartServer() error {
 						}
 						reportStr = reportStr[:len(reportStr)-1]
 
-						var tmp map[string]interface{}
-						err = json.Unmarshal(reportStr, &tmp)
-						if err != nil {
+						report, err := decodeReport(reportStr)
+						if errors.Is(err, errInvalidReport) {
 							if tb.logger != nil {
-								tb.logger.Error("StartServer: unmarshal error", zap.Error(err))
+								tb.logger.Info("StartServer: default", zap.Error(err))
 							} else {
-								log.Logf("StartServer: unmarshal error:%v", err)
+								log.Logf("StartServer: default case:%v...", err)
 							}
-							return
+							continue
 						}
-						if _, ok := tmp["CniSucceeded"]; ok {
-							var cniReport CNIReport
-							err = json.Unmarshal([]byte(reportStr), &cniReport)
-							if err != nil {
-								return
-							}
-							tb.data <- cniReport
-						} else if _, ok := tmp["Metric"]; ok {
-							var aiMetric AIMetric
-							err = json.Unmarshal([]byte(reportStr), &aiMetric)
-							if err != nil {
-								return
-							}
-							tb.data <- aiMetric
-						} else {
+						if err != nil {
 							if tb.logger != nil {
-								tb.logger.Info("StartServer: default", zap.Any("case", tmp))
+								tb.logger.Error("StartServer: unmarshal error", zap.Error(err))
 							} else {
-								log.Logf("StartServer: default case:%+v...", tmp)
+								log.Logf("StartServer: unmarshal error:%v", err)
 							}
+							return
 						}
+						tb.data <- report
 					}
 				}()
 			} else {
@@ -230,6 +219,11 @@ func (tb *TelemetryBuffer) PushData(ctx context.Context) {
 	}
 }
 
+// SetSpool sets the spool the reports which can't be written to the telemetry service are appended to.
+func (tb *TelemetryBuffer) SetSpool(spool *Spool) {
+	tb.spool = spool
+}
+
 // Write - write to the file descriptor.
 func (tb *TelemetryBuffer) Write(b []byte) (c int, err error) {
 	buf := make([]byte, len(b))
@@ -14,6 +14,8 @@ const (
 	TelemetryServiceProcessName = "azure-vnet-telemetry"
 	CniInstallDir               = "/opt/cni/bin"
 	metadataFile                = "/tmp/azuremetadata.json"
+	// SpoolPath is on disk rather than on tmpfs so that the spooled reports survive a reboot of the node.
+	SpoolPath = "/var/lib/azure-network/azure-vnet-telemetry.spool"
 )
 
 // Dial - try to connect to/create a socket with 'name'
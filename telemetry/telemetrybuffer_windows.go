@@ -15,6 +15,7 @@ const (
 	TelemetryServiceProcessName = "azure-vnet-telemetry.exe"
 	CniInstallDir               = "c:\\k\\azurecni\\bin"
 	metadataFile                = "azuremetadata.json"
+	SpoolPath                   = "c:\\k\\azurecni\\azure-vnet-telemetry.spool"
 )
 
 // Dial - try to connect to a named pipe with 'name'
@@ -0,0 +1,128 @@
+// Package tracing exports the spans of the cni commands and of the cns requests they make to an OpenTelemetry
+// collector over OTLP, so that the latency of an ADD or DEL can be broken down across the plugin and cns.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Azure/azure-container-networking"
+
+// propagator carries the trace context in the headers of the requests from the plugin to cns.
+var propagator = propagation.TraceContext{}
+
+// Config is the configuration of the export of the spans.
+type Config struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector the spans are exported to, tracing is off when it is empty.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Insecure exports the spans over http rather than https.
+	Insecure bool `json:"insecure,omitempty"`
+	// SampleRatio is the ratio of the traces which are sampled, all of them when it is 0. The requests to cns are
+	// sampled as the command which sent them was.
+	SampleRatio float64 `json:"sampleRatio,omitempty"`
+}
+
+// Init exports the spans of the service to the collector of the config, and returns the func which flushes the spans
+// not exported yet and stops the export. The spans are dropped when the endpoint is empty.
+func Init(ctx context.Context, serviceName string, cfg Config) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create otlp exporter")
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the name as a child of the span of ctx, and returns the ctx of the span.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, recording the error the operation of the span failed with.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WithSpan runs the call in a span of the name and returns its error.
+func WithSpan(ctx context.Context, name string, call func(context.Context) error, attrs ...attribute.KeyValue) error {
+	ctx, span := Start(ctx, name, attrs...)
+	err := call(ctx)
+	End(span, err)
+	return err
+}
+
+// Doer sends http requests, like http.Client.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type client struct {
+	doer Doer
+}
+
+// Client returns the doer which sends the requests in spans of their own, with the trace context in their headers so
+// that the server continues the trace.
+func Client(doer Doer) Doer {
+	return &client{doer: doer}
+}
+
+func (c *client) Do(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", req.Method), attribute.String("url.path", req.URL.Path)))
+	req = req.WithContext(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := c.doer.Do(req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+	}
+	End(span, err)
+	return res, err //nolint:wrapcheck // the error of the doer is returned as it is
+}
+
+// Handler returns the handler which serves the requests in spans of the name, which continue the trace of the client
+// of the request.
+func Handler(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", req.Method), attribute.String("url.path", req.URL.Path)))
+		defer span.End()
+		handler(w, req.WithContext(ctx))
+	}
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+	return recorder
+}
+
+func TestInitWithoutEndpoint(t *testing.T) {
+	shutdown, err := Init(context.Background(), "azure-vnet", Config{})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+}
+
+func TestWithSpan(t *testing.T) {
+	recorder := recordSpans(t)
+
+	errCall := errors.New("failed to enter netns")
+	ctx, parent := Start(context.Background(), "cni.ADD")
+	require.ErrorIs(t, WithSpan(ctx, "netns.Enter", func(context.Context) error { return errCall }), errCall)
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "netns.Enter", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestClientHandler(t *testing.T) {
+	recorder := recordSpans(t)
+
+	server := httptest.NewServer(Handler("cns.RequestIPConfigs", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, parent := Start(context.Background(), "cni.ADD")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/network/requestipconfigs", http.NoBody)
+	require.NoError(t, err)
+	res, err := Client(server.Client()).Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	End(parent, nil)
+
+	// the span of the server continues the trace of the request
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	serverSpan, clientSpan := spans[0], spans[1]
+	assert.Equal(t, "cns.RequestIPConfigs", serverSpan.Name())
+	assert.Equal(t, "POST /network/requestipconfigs", clientSpan.Name())
+	assert.Equal(t, parent.SpanContext().TraceID(), serverSpan.SpanContext().TraceID())
+	assert.Equal(t, clientSpan.SpanContext().SpanID(), serverSpan.Parent().SpanID())
+	assert.Equal(t, parent.SpanContext().SpanID(), clientSpan.Parent().SpanID())
+}